@@ -20,9 +20,12 @@ type Account struct {
 	Status                 Status           `json:"status"`
 	OrdersURL              string           `json:"orders"`
 	ExternalAccountBinding interface{}      `json:"externalAccountBinding,omitempty"`
+	TermsOfServiceAgreed   bool             `json:"termsOfServiceAgreed,omitempty"`
 	LocationPrefix         string           `json:"-"`
 	ProvisionerID          string           `json:"-"`
 	ProvisionerName        string           `json:"-"`
+	Policy                 *Policy          `json:"-"`
+	RateLimitTier          string           `json:"-"`
 }
 
 // GetLocation returns the URL location of the given account.
@@ -58,8 +61,9 @@ func KeyToID(jwk *jose.JSONWebKey) (string, error) {
 
 // PolicyNames contains ACME account level policy names
 type PolicyNames struct {
-	DNSNames []string `json:"dns"`
-	IPRanges []string `json:"ips"`
+	DNSNames   []string `json:"dns"`
+	IPRanges   []string `json:"ips"`
+	URIDomains []string `json:"uris,omitempty"`
 }
 
 // X509Policy contains ACME account level X.509 policy
@@ -81,6 +85,7 @@ func (p *Policy) GetAllowedNameOptions() *policy.X509NameOptions {
 	return &policy.X509NameOptions{
 		DNSDomains: p.X509.Allowed.DNSNames,
 		IPRanges:   p.X509.Allowed.IPRanges,
+		URIDomains: p.X509.Allowed.URIDomains,
 	}
 }
 
@@ -91,6 +96,7 @@ func (p *Policy) GetDeniedNameOptions() *policy.X509NameOptions {
 	return &policy.X509NameOptions{
 		DNSDomains: p.X509.Denied.DNSNames,
 		IPRanges:   p.X509.Denied.IPRanges,
+		URIDomains: p.X509.Denied.URIDomains,
 	}
 }
 
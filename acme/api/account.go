@@ -8,6 +8,8 @@ import (
 
 	"github.com/go-chi/chi/v5"
 
+	"go.step.sm/crypto/jose"
+
 	"github.com/smallstep/certificates/acme"
 	"github.com/smallstep/certificates/api/render"
 	"github.com/smallstep/certificates/logging"
@@ -119,6 +121,17 @@ func NewAccount(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
+		// If the provisioner defines terms of service, clients must agree to
+		// them to create a new account (RFC 8555, section 7.3).
+		if prov.TermsOfService != "" && !nar.TermsOfServiceAgreed {
+			w.Header().Add("Link", link(prov.TermsOfService, "terms-of-service"))
+			acmeErr := acme.NewError(acme.ErrorUserActionRequiredType,
+				"terms of service must be agreed to create an account")
+			acmeErr.Status = http.StatusForbidden
+			render.Error(w, r, acmeErr)
+			return
+		}
+
 		jwk, err := jwkFromContext(ctx)
 		if err != nil {
 			render.Error(w, r, err)
@@ -132,12 +145,13 @@ func NewAccount(w http.ResponseWriter, r *http.Request) {
 		}
 
 		acc = &acme.Account{
-			Key:             jwk,
-			Contact:         nar.Contact,
-			Status:          acme.StatusValid,
-			LocationPrefix:  getAccountLocationPath(ctx, linker, ""),
-			ProvisionerID:   prov.ID,
-			ProvisionerName: prov.Name,
+			Key:                  jwk,
+			Contact:              nar.Contact,
+			Status:               acme.StatusValid,
+			LocationPrefix:       getAccountLocationPath(ctx, linker, ""),
+			ProvisionerID:        prov.ID,
+			ProvisionerName:      prov.Name,
+			TermsOfServiceAgreed: nar.TermsOfServiceAgreed,
 		}
 		if err := db.CreateAccount(ctx, acc); err != nil {
 			render.Error(w, r, acme.WrapErrorISE(err, "error creating account"))
@@ -216,6 +230,162 @@ func GetOrUpdateAccount(w http.ResponseWriter, r *http.Request) {
 	render.JSON(w, r, acc)
 }
 
+// KeyChangeRequest represents the payload of the inner JWS of a key-change
+// request.
+type KeyChangeRequest struct {
+	Account string           `json:"account"`
+	OldKey  *jose.JSONWebKey `json:"oldKey"`
+}
+
+// Validate validates a key-change request body.
+func (k *KeyChangeRequest) Validate() error {
+	switch {
+	case k.Account == "":
+		return acme.NewError(acme.ErrorMalformedType, "key-change request must contain an account")
+	case k.OldKey == nil:
+		return acme.NewError(acme.ErrorMalformedType, "key-change request must contain the old key")
+	default:
+		return nil
+	}
+}
+
+// KeyChange is the api for rolling over the key of an ACME account, as
+// defined in RFC 8555 section 7.3.5. The payload of the request is a JWS
+// signed with the new key, that contains the account URL and the old key.
+func KeyChange(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	db := acme.MustDatabaseFromContext(ctx)
+	linker := acme.MustLinkerFromContext(ctx)
+
+	acc, err := accountFromContext(ctx)
+	if err != nil {
+		render.Error(w, r, err)
+		return
+	}
+	outerJWS, err := jwsFromContext(ctx)
+	if err != nil {
+		render.Error(w, r, err)
+		return
+	}
+	payload, err := payloadFromContext(ctx)
+	if err != nil {
+		render.Error(w, r, err)
+		return
+	}
+	if payload.isPostAsGet {
+		render.Error(w, r, acme.NewError(acme.ErrorMalformedType, "key-change request must contain a payload"))
+		return
+	}
+
+	innerJWS, err := jose.ParseJWS(string(payload.value))
+	if err != nil {
+		render.Error(w, r, acme.WrapError(acme.ErrorMalformedType, err, "failed to parse key-change inner jws"))
+		return
+	}
+	newKey, acmeErr := validateKeyChangeJWS(innerJWS, outerJWS)
+	if acmeErr != nil {
+		render.Error(w, r, acmeErr)
+		return
+	}
+	innerPayload, err := innerJWS.Verify(newKey)
+	if err != nil {
+		render.Error(w, r, acme.WrapError(acme.ErrorMalformedType, err, "error verifying key-change inner jws"))
+		return
+	}
+
+	var kcr KeyChangeRequest
+	if err := json.Unmarshal(innerPayload, &kcr); err != nil {
+		render.Error(w, r, acme.WrapError(acme.ErrorMalformedType, err,
+			"failed to unmarshal key-change request payload"))
+		return
+	}
+	if err := kcr.Validate(); err != nil {
+		render.Error(w, r, err)
+		return
+	}
+	if kid := outerJWS.Signatures[0].Protected.KeyID; kcr.Account != kid {
+		render.Error(w, r, acme.NewError(acme.ErrorMalformedType,
+			"account in key-change request (%s) does not match the jws kid (%s)", kcr.Account, kid))
+		return
+	}
+	if !keysAreEqual(kcr.OldKey, acc.Key) {
+		render.Error(w, r, acme.NewError(acme.ErrorMalformedType, "old key in key-change request does not match the account key"))
+		return
+	}
+
+	newKey.KeyID, err = acme.KeyToID(newKey)
+	if err != nil {
+		render.Error(w, r, acme.WrapErrorISE(err, "error getting KeyID from JWK"))
+		return
+	}
+	existing, err := db.GetAccountByKeyID(ctx, newKey.KeyID)
+	switch {
+	case err == nil:
+		// RFC 8555 section 7.3.5 requires a 409 (Conflict) with the location
+		// of the account that is already using the new key.
+		w.Header().Set("Location", getAccountLocationPath(ctx, linker, existing.ID))
+		acmeErr := acme.NewDetailedError(acme.ErrorMalformedType, "new key is already in use by another account")
+		acmeErr.Status = http.StatusConflict
+		render.Error(w, r, acmeErr)
+		return
+	case !acme.IsErrNotFound(err):
+		render.Error(w, r, acme.WrapErrorISE(err, "error retrieving account by key"))
+		return
+	}
+
+	acc.Key = newKey
+	if err := db.UpdateAccount(ctx, acc); err != nil {
+		render.Error(w, r, acme.WrapErrorISE(err, "error updating account key"))
+		return
+	}
+
+	linker.LinkAccount(ctx, acc)
+
+	w.Header().Set("Location", getAccountLocationPath(ctx, linker, acc.ID))
+	render.JSON(w, r, acc)
+}
+
+// validateKeyChangeJWS validates the inner JWS of a key-change request and
+// returns the new account key. The protected header of the JWS MUST meet the
+// following criteria:
+//
+//   - It MUST contain a single signature
+//   - The "jwk" field MUST contain the new key, and "kid" MUST NOT be present
+//   - The "nonce" field MUST NOT be present
+//   - The "url" field MUST be set to the same value as the outer JWS
+func validateKeyChangeJWS(jws, outerJWS *jose.JSONWebSignature) (*jose.JSONWebKey, *acme.Error) {
+	if len(jws.Signatures) != 1 {
+		return nil, acme.NewError(acme.ErrorMalformedType, "key-change inner jws must contain exactly one signature")
+	}
+	hdr := jws.Signatures[0].Protected
+	if hdr.JSONWebKey == nil {
+		return nil, acme.NewError(acme.ErrorMalformedType, "key-change inner jws must contain a jwk")
+	}
+	if hdr.KeyID != "" {
+		return nil, acme.NewError(acme.ErrorMalformedType, "key-change inner jws must not contain a kid")
+	}
+	if hdr.Nonce != "" {
+		return nil, acme.NewError(acme.ErrorMalformedType, "key-change inner jws must not contain a nonce")
+	}
+	if !hdr.JSONWebKey.Valid() || !hdr.JSONWebKey.IsPublic() {
+		return nil, acme.NewError(acme.ErrorMalformedType, "invalid jwk in key-change inner jws")
+	}
+	if err := validateJWSAlgorithm(hdr); err != nil {
+		return nil, err
+	}
+
+	innerURL, ok := hdr.ExtraHeaders["url"].(string)
+	if !ok {
+		return nil, acme.NewError(acme.ErrorMalformedType, "key-change inner jws missing url protected header")
+	}
+	outerURL, _ := outerJWS.Signatures[0].Protected.ExtraHeaders["url"].(string)
+	if innerURL != outerURL {
+		return nil, acme.NewError(acme.ErrorMalformedType,
+			"url header in key-change inner jws (%s) does not match outer jws url (%s)", innerURL, outerURL)
+	}
+	return hdr.JSONWebKey, nil
+}
+
 func logOrdersByAccount(w http.ResponseWriter, oids []string) {
 	if rl, ok := w.(logging.ResponseLogger); ok {
 		m := map[string]interface{}{
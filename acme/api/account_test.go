@@ -56,6 +56,9 @@ func (*fakeProvisioner) GetID() string                                 { return
 func (*fakeProvisioner) GetName() string                               { return "" }
 func (*fakeProvisioner) DefaultTLSCertDuration() time.Duration         { return 0 }
 func (*fakeProvisioner) GetOptions() *provisioner.Options              { return nil }
+func (*fakeProvisioner) GetProfile(string) (*provisioner.ACMEProfile, error) {
+	return nil, nil
+}
 
 func newProv() acme.Provisioner {
 	// Initialize provisioners
@@ -651,6 +654,61 @@ func TestHandler_NewAccount(t *testing.T) {
 				err:        acme.NewError(acme.ErrorServerInternalType, "error updating external account binding key"),
 			}
 		},
+		"fail/terms-of-service-not-agreed": func(t *testing.T) test {
+			nar := &NewAccountRequest{
+				Contact: []string{"foo", "bar"},
+			}
+			b, err := json.Marshal(nar)
+			assert.FatalError(t, err)
+			jwk, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+			assert.FatalError(t, err)
+			tosProv := newACMEProv(t)
+			tosProv.TermsOfService = "https://ca.example.com/terms"
+			ctx := context.WithValue(context.Background(), payloadContextKey, &payloadInfo{value: b})
+			ctx = context.WithValue(ctx, jwkContextKey, jwk)
+			ctx = acme.NewProvisionerContext(ctx, tosProv)
+			return test{
+				db:         &acme.MockDB{},
+				ctx:        ctx,
+				statusCode: 403,
+				err: acme.NewError(acme.ErrorUserActionRequiredType,
+					"terms of service must be agreed to create an account"),
+			}
+		},
+		"ok/new-account-terms-of-service-agreed": func(t *testing.T) test {
+			nar := &NewAccountRequest{
+				Contact:              []string{"foo", "bar"},
+				TermsOfServiceAgreed: true,
+			}
+			b, err := json.Marshal(nar)
+			assert.FatalError(t, err)
+			jwk, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+			assert.FatalError(t, err)
+			tosProv := newACMEProv(t)
+			tosProv.TermsOfService = "https://ca.example.com/terms"
+			ctx := context.WithValue(context.Background(), payloadContextKey, &payloadInfo{value: b})
+			ctx = context.WithValue(ctx, jwkContextKey, jwk)
+			ctx = acme.NewProvisionerContext(ctx, tosProv)
+			return test{
+				db: &acme.MockDB{
+					MockCreateAccount: func(ctx context.Context, acc *acme.Account) error {
+						acc.ID = "accountID"
+						assert.True(t, acc.TermsOfServiceAgreed)
+						return nil
+					},
+				},
+				acc: &acme.Account{
+					ID:                   "accountID",
+					Key:                  jwk,
+					Status:               acme.StatusValid,
+					Contact:              []string{"foo", "bar"},
+					OrdersURL:            fmt.Sprintf("%s/acme/%s/account/accountID/orders", baseURL.String(), escProvName),
+					TermsOfServiceAgreed: true,
+				},
+				ctx:        ctx,
+				statusCode: 201,
+			}
+		},
 		"ok/new-account": func(t *testing.T) test {
 			nar := &NewAccountRequest{
 				Contact: []string{"foo", "bar"},
@@ -1054,3 +1112,232 @@ func TestHandler_GetOrUpdateAccount(t *testing.T) {
 		})
 	}
 }
+
+func TestHandler_KeyChange(t *testing.T) {
+	prov := newProv()
+	escProvName := url.PathEscape(prov.GetName())
+	baseURL := &url.URL{Scheme: "https", Host: "test.ca.smallstep.com"}
+	keyChangeURL := fmt.Sprintf("%s/acme/%s/key-change", baseURL.String(), escProvName)
+	accURL := fmt.Sprintf("%s/acme/%s/account/accountID", baseURL.String(), escProvName)
+
+	oldJWK, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+	assert.FatalError(t, err)
+	newJWK, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+	assert.FatalError(t, err)
+	oldPub := oldJWK.Public()
+	newPub := newJWK.Public()
+	newKID, err := acme.KeyToID(&newPub)
+	assert.FatalError(t, err)
+
+	outerJWS := &jose.JSONWebSignature{
+		Signatures: []jose.Signature{{
+			Protected: jose.Header{
+				KeyID:        accURL,
+				ExtraHeaders: map[jose.HeaderKey]interface{}{"url": keyChangeURL},
+			},
+		}},
+	}
+	newAccount := func() *acme.Account {
+		return &acme.Account{ID: "accountID", Status: acme.StatusValid, Key: &oldPub}
+	}
+	innerJWS := func(t *testing.T, key *jose.JSONWebKey, embed bool, u string, kcr *KeyChangeRequest) []byte {
+		t.Helper()
+		extraHeaders := map[jose.HeaderKey]interface{}{"url": u}
+		if !embed {
+			extraHeaders["kid"] = accURL
+		}
+		signer, err := jose.NewSigner(
+			jose.SigningKey{Algorithm: jose.ES256, Key: key},
+			&jose.SignerOptions{ExtraHeaders: extraHeaders, EmbedJWK: embed},
+		)
+		assert.FatalError(t, err)
+		b, err := json.Marshal(kcr)
+		assert.FatalError(t, err)
+		jws, err := signer.Sign(b)
+		assert.FatalError(t, err)
+		return []byte(jws.FullSerialize())
+	}
+	newContext := func(acc *acme.Account, p *payloadInfo) context.Context {
+		ctx := acme.NewProvisionerContext(context.Background(), prov)
+		ctx = context.WithValue(ctx, accContextKey, acc)
+		ctx = context.WithValue(ctx, jwsContextKey, outerJWS)
+		return context.WithValue(ctx, payloadContextKey, p)
+	}
+
+	type test struct {
+		db         acme.DB
+		ctx        context.Context
+		statusCode int
+		location   string
+		err        *acme.Error
+	}
+	var tests = map[string]func(t *testing.T) test{
+		"fail/no-account": func(t *testing.T) test {
+			return test{
+				db:         &acme.MockDB{},
+				ctx:        context.Background(),
+				statusCode: 400,
+				err:        acme.NewError(acme.ErrorAccountDoesNotExistType, "account does not exist"),
+			}
+		},
+		"fail/post-as-get": func(t *testing.T) test {
+			return test{
+				db:         &acme.MockDB{},
+				ctx:        newContext(newAccount(), &payloadInfo{isPostAsGet: true}),
+				statusCode: 400,
+				err:        acme.NewError(acme.ErrorMalformedType, "key-change request must contain a payload"),
+			}
+		},
+		"fail/parse-inner-jws": func(t *testing.T) test {
+			return test{
+				db:         &acme.MockDB{},
+				ctx:        newContext(newAccount(), &payloadInfo{value: []byte("{}")}),
+				statusCode: 400,
+				err:        acme.NewError(acme.ErrorMalformedType, "failed to parse key-change inner jws"),
+			}
+		},
+		"fail/inner-jws-without-jwk": func(t *testing.T) test {
+			b := innerJWS(t, newJWK, false, keyChangeURL, &KeyChangeRequest{Account: accURL, OldKey: &oldPub})
+			return test{
+				db:         &acme.MockDB{},
+				ctx:        newContext(newAccount(), &payloadInfo{value: b}),
+				statusCode: 400,
+				err:        acme.NewError(acme.ErrorMalformedType, "key-change inner jws must contain a jwk"),
+			}
+		},
+		"fail/inner-jws-url": func(t *testing.T) test {
+			b := innerJWS(t, newJWK, true, accURL, &KeyChangeRequest{Account: accURL, OldKey: &oldPub})
+			return test{
+				db:         &acme.MockDB{},
+				ctx:        newContext(newAccount(), &payloadInfo{value: b}),
+				statusCode: 400,
+				err:        acme.NewError(acme.ErrorMalformedType, "url header in key-change inner jws does not match"),
+			}
+		},
+		"fail/missing-old-key": func(t *testing.T) test {
+			b := innerJWS(t, newJWK, true, keyChangeURL, &KeyChangeRequest{Account: accURL})
+			return test{
+				db:         &acme.MockDB{},
+				ctx:        newContext(newAccount(), &payloadInfo{value: b}),
+				statusCode: 400,
+				err:        acme.NewError(acme.ErrorMalformedType, "key-change request must contain the old key"),
+			}
+		},
+		"fail/account-mismatch": func(t *testing.T) test {
+			b := innerJWS(t, newJWK, true, keyChangeURL, &KeyChangeRequest{Account: accURL + "foo", OldKey: &oldPub})
+			return test{
+				db:         &acme.MockDB{},
+				ctx:        newContext(newAccount(), &payloadInfo{value: b}),
+				statusCode: 400,
+				err:        acme.NewError(acme.ErrorMalformedType, "account in key-change request does not match the jws kid"),
+			}
+		},
+		"fail/old-key-mismatch": func(t *testing.T) test {
+			b := innerJWS(t, newJWK, true, keyChangeURL, &KeyChangeRequest{Account: accURL, OldKey: &newPub})
+			return test{
+				db:         &acme.MockDB{},
+				ctx:        newContext(newAccount(), &payloadInfo{value: b}),
+				statusCode: 400,
+				err:        acme.NewError(acme.ErrorMalformedType, "old key in key-change request does not match the account key"),
+			}
+		},
+		"fail/key-in-use": func(t *testing.T) test {
+			b := innerJWS(t, newJWK, true, keyChangeURL, &KeyChangeRequest{Account: accURL, OldKey: &oldPub})
+			return test{
+				db: &acme.MockDB{
+					MockGetAccountByKeyID: func(ctx context.Context, kid string) (*acme.Account, error) {
+						assert.Equals(t, kid, newKID)
+						return &acme.Account{ID: "otherID"}, nil
+					},
+				},
+				ctx:        newContext(newAccount(), &payloadInfo{value: b}),
+				statusCode: 409,
+				location:   fmt.Sprintf("%s/acme/%s/account/otherID", baseURL.String(), escProvName),
+				err:        acme.NewDetailedError(acme.ErrorMalformedType, "new key is already in use by another account"),
+			}
+		},
+		"fail/db.GetAccountByKeyID-error": func(t *testing.T) test {
+			b := innerJWS(t, newJWK, true, keyChangeURL, &KeyChangeRequest{Account: accURL, OldKey: &oldPub})
+			return test{
+				db: &acme.MockDB{
+					MockGetAccountByKeyID: func(ctx context.Context, kid string) (*acme.Account, error) {
+						return nil, errors.New("force")
+					},
+				},
+				ctx:        newContext(newAccount(), &payloadInfo{value: b}),
+				statusCode: 500,
+				err:        acme.NewErrorISE("error retrieving account by key"),
+			}
+		},
+		"fail/db.UpdateAccount-error": func(t *testing.T) test {
+			b := innerJWS(t, newJWK, true, keyChangeURL, &KeyChangeRequest{Account: accURL, OldKey: &oldPub})
+			return test{
+				db: &acme.MockDB{
+					MockGetAccountByKeyID: func(ctx context.Context, kid string) (*acme.Account, error) {
+						return nil, acme.ErrNotFound
+					},
+					MockUpdateAccount: func(ctx context.Context, acc *acme.Account) error {
+						return errors.New("force")
+					},
+				},
+				ctx:        newContext(newAccount(), &payloadInfo{value: b}),
+				statusCode: 500,
+				err:        acme.NewErrorISE("error updating account key"),
+			}
+		},
+		"ok": func(t *testing.T) test {
+			b := innerJWS(t, newJWK, true, keyChangeURL, &KeyChangeRequest{Account: accURL, OldKey: &oldPub})
+			return test{
+				db: &acme.MockDB{
+					MockGetAccountByKeyID: func(ctx context.Context, kid string) (*acme.Account, error) {
+						assert.Equals(t, kid, newKID)
+						return nil, acme.ErrNotFound
+					},
+					MockUpdateAccount: func(ctx context.Context, acc *acme.Account) error {
+						assert.Equals(t, acc.ID, "accountID")
+						assert.Equals(t, acc.Key.KeyID, newKID)
+						assert.True(t, keysAreEqual(acc.Key, &newPub))
+						return nil
+					},
+				},
+				ctx:        newContext(newAccount(), &payloadInfo{value: b}),
+				statusCode: 200,
+				location:   accURL,
+			}
+		},
+	}
+	for name, run := range tests {
+		tc := run(t)
+		t.Run(name, func(t *testing.T) {
+			ctx := acme.NewContext(tc.ctx, tc.db, nil, acme.NewLinker("test.ca.smallstep.com", "acme"), nil)
+			req := httptest.NewRequest("POST", keyChangeURL, http.NoBody)
+			req = req.WithContext(ctx)
+			w := httptest.NewRecorder()
+			KeyChange(w, req)
+			res := w.Result()
+
+			assert.Equals(t, res.StatusCode, tc.statusCode)
+
+			body, err := io.ReadAll(res.Body)
+			res.Body.Close()
+			assert.FatalError(t, err)
+
+			if tc.location != "" {
+				assert.Equals(t, res.Header["Location"], []string{tc.location})
+			}
+			if res.StatusCode >= 400 && assert.NotNil(t, tc.err) {
+				var ae acme.Error
+				assert.FatalError(t, json.Unmarshal(bytes.TrimSpace(body), &ae))
+
+				assert.Equals(t, ae.Type, tc.err.Type)
+				assert.Equals(t, ae.Detail, tc.err.Detail)
+				assert.Equals(t, res.Header["Content-Type"], []string{"application/problem+json"})
+			} else {
+				var acc acme.Account
+				assert.FatalError(t, json.Unmarshal(bytes.TrimSpace(body), &acc))
+				assert.Equals(t, acc.Status, acme.StatusValid)
+				assert.Equals(t, res.Header["Content-Type"], []string{"application/json"})
+			}
+		})
+	}
+}
@@ -0,0 +1,130 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/smallstep/certificates/acme"
+	"github.com/smallstep/certificates/api/render"
+)
+
+// NewAuthzRequest represents the body for a NewAuthz request.
+type NewAuthzRequest struct {
+	Identifier acme.Identifier `json:"identifier"`
+}
+
+// Validate validates a new-authz request body. Only DNS and IP identifiers
+// can be pre-authorized, and wildcard identifiers are not allowed, as defined
+// in RFC 8555 section 7.4.1.
+func (n *NewAuthzRequest) Validate() error {
+	switch n.Identifier.Type {
+	case acme.DNS:
+		if strings.HasPrefix(n.Identifier.Value, "*.") {
+			return acme.NewError(acme.ErrorMalformedType, "wildcard identifiers cannot be pre-authorized")
+		}
+	case acme.IP:
+	default:
+		return acme.NewError(acme.ErrorMalformedType, "identifier type %s cannot be pre-authorized", n.Identifier.Type)
+	}
+	nor := &NewOrderRequest{Identifiers: []acme.Identifier{n.Identifier}}
+	return nor.Validate()
+}
+
+// NewAuthorization ACME api for pre-authorizing an identifier. If the account
+// already has a valid authorization for the identifier, it's returned instead
+// of creating a new one.
+func NewAuthorization(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	ca := mustAuthority(ctx)
+	db := acme.MustDatabaseFromContext(ctx)
+	linker := acme.MustLinkerFromContext(ctx)
+
+	acc, err := accountFromContext(ctx)
+	if err != nil {
+		render.Error(w, r, err)
+		return
+	}
+	acmeProv, err := acmeProvisionerFromContext(ctx)
+	if err != nil {
+		render.Error(w, r, err)
+		return
+	}
+	if !acmeProv.EnablePreAuthorization {
+		render.Error(w, r, acme.NewError(acme.ErrorNotImplementedType,
+			"pre-authorization is not enabled in provisioner %s", acmeProv.GetName()))
+		return
+	}
+	payload, err := payloadFromContext(ctx)
+	if err != nil {
+		render.Error(w, r, err)
+		return
+	}
+
+	var nar NewAuthzRequest
+	if err := json.Unmarshal(payload.value, &nar); err != nil {
+		render.Error(w, r, acme.WrapError(acme.ErrorMalformedType, err,
+			"failed to unmarshal new-authz request payload"))
+		return
+	}
+	if err := nar.Validate(); err != nil {
+		render.Error(w, r, err)
+		return
+	}
+
+	var eak *acme.ExternalAccountKey
+	if acmeProv.RequireEAB {
+		if eak, err = db.GetExternalAccountKeyByAccountID(ctx, acmeProv.GetID(), acc.ID); err != nil {
+			render.Error(w, r, acme.WrapErrorISE(err, "error retrieving external account binding key"))
+			return
+		}
+	}
+
+	acmePolicy, err := newACMEPolicyEngine(acc, eak)
+	if err != nil {
+		render.Error(w, r, acme.WrapErrorISE(err, "error creating ACME policy engine"))
+		return
+	}
+
+	// evaluate the ACME account, provisioner and authority level policies
+	identifier := nar.Identifier
+	if err = authorizeIdentifier(ctx, ca, acmePolicy, acmeProv, identifier); err != nil {
+		render.Error(w, r, acme.NewError(acme.ErrorRejectedIdentifierType, "not authorized").AddSubproblems(
+			acme.NewSubproblemWithIdentifier(acme.ErrorRejectedIdentifierType, identifier, "%s", err)))
+		return
+	}
+
+	now := clock.Now()
+	validAuthzs, err := validAuthorizationsByAccountID(ctx, db, acmeProv, acc.ID, now)
+	if err != nil {
+		render.Error(w, r, err)
+		return
+	}
+	if az, ok := validAuthzs[identifier]; ok {
+		az, err = db.GetAuthorization(ctx, az.ID)
+		if err != nil {
+			render.Error(w, r, acme.WrapErrorISE(err, "error retrieving authorization"))
+			return
+		}
+		linker.LinkAuthorization(ctx, az)
+		w.Header().Set("Location", linker.GetLink(ctx, acme.AuthzLinkType, az.ID))
+		render.JSON(w, r, az)
+		return
+	}
+
+	az := &acme.Authorization{
+		AccountID:  acc.ID,
+		Identifier: identifier,
+		ExpiresAt:  now.Add(defaultOrderExpiry),
+		Status:     acme.StatusPending,
+	}
+	if err := newAuthorization(ctx, az); err != nil {
+		render.Error(w, r, err)
+		return
+	}
+
+	linker.LinkAuthorization(ctx, az)
+
+	w.Header().Set("Location", linker.GetLink(ctx, acme.AuthzLinkType, az.ID))
+	render.JSONStatus(w, r, az, http.StatusCreated)
+}
@@ -0,0 +1,195 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/smallstep/certificates/acme"
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+func TestNewAuthzRequest_Validate(t *testing.T) {
+	tests := []struct {
+		name       string
+		identifier acme.Identifier
+		wantErr    string
+	}{
+		{"ok/dns", acme.Identifier{Type: "dns", Value: "example.com"}, ""},
+		{"ok/ip", acme.Identifier{Type: "ip", Value: "192.168.10.1"}, ""},
+		{"fail/wildcard", acme.Identifier{Type: "dns", Value: "*.example.com"}, "wildcard identifiers cannot be pre-authorized"},
+		{"fail/email", acme.Identifier{Type: "email", Value: "jane@example.com"}, "identifier type email cannot be pre-authorized"},
+		{"fail/bad-dns", acme.Identifier{Type: "dns", Value: "xn--bücher.example.com"}, "invalid DNS name: xn--bücher.example.com"},
+		{"fail/bad-ip", acme.Identifier{Type: "ip", Value: "192.168.10.256"}, "invalid IP address: 192.168.10.256"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nar := &NewAuthzRequest{Identifier: tt.identifier}
+			err := nar.Validate()
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			var ae *acme.Error
+			require.ErrorAs(t, err, &ae)
+			assert.Equal(t, acme.NewError(acme.ErrorMalformedType, "").Type, ae.Type)
+			assert.EqualError(t, ae.Err, tt.wantErr)
+		})
+	}
+}
+
+func TestNewAuthorization(t *testing.T) {
+	prov := newACMEProv(t)
+	prov.EnablePreAuthorization = true
+	disabledProv := newACMEProv(t)
+	// The challenge used in the existing authorization is no longer enabled.
+	dnsProv := newACMEProv(t)
+	dnsProv.EnablePreAuthorization = true
+	dnsProv.Challenges = []provisioner.ACMEChallenge{provisioner.DNS_01}
+	provName := url.PathEscape(prov.GetName())
+	baseURL := &url.URL{Scheme: "https", Host: "test.ca.smallstep.com"}
+	acc := &acme.Account{ID: "accID"}
+	identifier := acme.Identifier{Type: "dns", Value: "example.com"}
+	expiresAt := clock.Now().Add(time.Hour)
+
+	payload := func(t *testing.T, nar *NewAuthzRequest) *payloadInfo {
+		t.Helper()
+		b, err := json.Marshal(nar)
+		require.NoError(t, err)
+		return &payloadInfo{value: b}
+	}
+	newDB := func(azs ...*acme.Authorization) *acme.MockDB {
+		return &acme.MockDB{
+			MockGetAuthorizationsByAccountID: func(ctx context.Context, accountID string) ([]*acme.Authorization, error) {
+				assert.Equal(t, "accID", accountID)
+				return azs, nil
+			},
+			MockGetAuthorization: func(ctx context.Context, id string) (*acme.Authorization, error) {
+				assert.Equal(t, "existingID", id)
+				return &acme.Authorization{
+					ID:         id,
+					AccountID:  "accID",
+					Identifier: identifier,
+					Status:     acme.StatusValid,
+					ExpiresAt:  expiresAt,
+					Challenges: []*acme.Challenge{{ID: "chID", Type: acme.HTTP01, Status: acme.StatusValid}},
+				}, nil
+			},
+			MockCreateChallenge: func(ctx context.Context, ch *acme.Challenge) error {
+				ch.ID = string(ch.Type)
+				return nil
+			},
+			MockCreateAuthorization: func(ctx context.Context, az *acme.Authorization) error {
+				az.ID = "newID"
+				assert.Equal(t, "accID", az.AccountID)
+				assert.Equal(t, identifier, az.Identifier)
+				assert.Equal(t, acme.StatusPending, az.Status)
+				return nil
+			},
+		}
+	}
+
+	tests := []struct {
+		name         string
+		ctx          func(t *testing.T) context.Context
+		db           acme.DB
+		ca           acme.CertificateAuthority
+		wantStatus   int
+		wantAuthzID  string
+		wantAuthzSts acme.Status
+	}{
+		{"ok/new", func(t *testing.T) context.Context {
+			ctx := acme.NewProvisionerContext(context.Background(), prov)
+			ctx = context.WithValue(ctx, accContextKey, acc)
+			return context.WithValue(ctx, payloadContextKey, payload(t, &NewAuthzRequest{Identifier: identifier}))
+		}, newDB(), &mockCA{}, 201, "newID", acme.StatusPending},
+		{"ok/existing", func(t *testing.T) context.Context {
+			ctx := acme.NewProvisionerContext(context.Background(), prov)
+			ctx = context.WithValue(ctx, accContextKey, acc)
+			return context.WithValue(ctx, payloadContextKey, payload(t, &NewAuthzRequest{Identifier: identifier}))
+		}, newDB(&acme.Authorization{
+			ID: "existingID", AccountID: "accID", Identifier: identifier, Status: acme.StatusValid, ExpiresAt: expiresAt,
+		}), &mockCA{}, 200, "existingID", acme.StatusValid},
+		{"ok/existing-expired", func(t *testing.T) context.Context {
+			ctx := acme.NewProvisionerContext(context.Background(), prov)
+			ctx = context.WithValue(ctx, accContextKey, acc)
+			return context.WithValue(ctx, payloadContextKey, payload(t, &NewAuthzRequest{Identifier: identifier}))
+		}, newDB(&acme.Authorization{
+			ID: "existingID", AccountID: "accID", Identifier: identifier, Status: acme.StatusValid, ExpiresAt: clock.Now().Add(-time.Minute),
+		}), &mockCA{}, 201, "newID", acme.StatusPending},
+		{"ok/existing-challenge-disabled", func(t *testing.T) context.Context {
+			ctx := acme.NewProvisionerContext(context.Background(), dnsProv)
+			ctx = context.WithValue(ctx, accContextKey, acc)
+			return context.WithValue(ctx, payloadContextKey, payload(t, &NewAuthzRequest{Identifier: identifier}))
+		}, newDB(&acme.Authorization{
+			ID: "existingID", AccountID: "accID", Identifier: identifier, Status: acme.StatusValid, ExpiresAt: expiresAt,
+		}), &mockCA{}, 201, "newID", acme.StatusPending},
+		{"fail/no-account", func(t *testing.T) context.Context {
+			return acme.NewProvisionerContext(context.Background(), prov)
+		}, newDB(), &mockCA{}, 400, "", ""},
+		{"fail/disabled", func(t *testing.T) context.Context {
+			ctx := acme.NewProvisionerContext(context.Background(), disabledProv)
+			ctx = context.WithValue(ctx, accContextKey, acc)
+			return context.WithValue(ctx, payloadContextKey, payload(t, &NewAuthzRequest{Identifier: identifier}))
+		}, newDB(), &mockCA{}, 501, "", ""},
+		{"fail/wildcard", func(t *testing.T) context.Context {
+			ctx := acme.NewProvisionerContext(context.Background(), prov)
+			ctx = context.WithValue(ctx, accContextKey, acc)
+			return context.WithValue(ctx, payloadContextKey, payload(t, &NewAuthzRequest{
+				Identifier: acme.Identifier{Type: "dns", Value: "*.example.com"},
+			}))
+		}, newDB(), &mockCA{}, 400, "", ""},
+		{"fail/ca.AreSANsAllowed", func(t *testing.T) context.Context {
+			ctx := acme.NewProvisionerContext(context.Background(), prov)
+			ctx = context.WithValue(ctx, accContextKey, acc)
+			return context.WithValue(ctx, payloadContextKey, payload(t, &NewAuthzRequest{Identifier: identifier}))
+		}, newDB(), &mockCA{
+			MockAreSANsallowed: func(ctx context.Context, sans []string) error {
+				assert.Equal(t, []string{"example.com"}, sans)
+				return errors.New("force")
+			},
+		}, 400, "", ""},
+		{"fail/db.GetAuthorizationsByAccountID", func(t *testing.T) context.Context {
+			ctx := acme.NewProvisionerContext(context.Background(), prov)
+			ctx = context.WithValue(ctx, accContextKey, acc)
+			return context.WithValue(ctx, payloadContextKey, payload(t, &NewAuthzRequest{Identifier: identifier}))
+		}, &acme.MockDB{
+			MockGetAuthorizationsByAccountID: func(ctx context.Context, accountID string) ([]*acme.Authorization, error) {
+				return nil, errors.New("force")
+			},
+		}, &mockCA{}, 500, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockMustAuthority(t, tt.ca)
+			ctx := newBaseContext(tt.ctx(t), tt.db, acme.NewLinker("test.ca.smallstep.com", "acme"))
+			req := httptest.NewRequest("POST", "/acme/prov/new-authz", http.NoBody)
+			w := httptest.NewRecorder()
+			NewAuthorization(w, req.WithContext(ctx))
+			res := w.Result()
+			defer res.Body.Close()
+
+			assert.Equal(t, tt.wantStatus, res.StatusCode)
+			if tt.wantAuthzID == "" {
+				assert.Equal(t, "application/problem+json", res.Header.Get("Content-Type"))
+				return
+			}
+
+			var az acme.Authorization
+			require.NoError(t, json.NewDecoder(res.Body).Decode(&az))
+			assert.Equal(t, tt.wantAuthzSts, az.Status)
+			assert.Equal(t, identifier, az.Identifier)
+			assert.NotEmpty(t, az.Challenges)
+			assert.Equal(t, fmt.Sprintf("%s/acme/%s/authz/%s", baseURL.String(), provName, tt.wantAuthzID), res.Header.Get("Location"))
+		})
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"encoding/pem"
 	"fmt"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/go-chi/chi/v5"
@@ -161,8 +162,8 @@ func route(r api.Router, middleware func(next nextHTTP) nextHTTP) {
 		extractPayloadByJWK(NewAccount))
 	r.MethodFunc("POST", getPath(acme.AccountLinkType, "{provisionerID}", "{accID}"),
 		extractPayloadByKid(GetOrUpdateAccount))
-	r.MethodFunc("POST", getPath(acme.KeyChangeLinkType, "{provisionerID}", "{accID}"),
-		extractPayloadByKid(NotImplemented))
+	r.MethodFunc("POST", getPath(acme.KeyChangeLinkType, "{provisionerID}"),
+		extractPayloadByKid(KeyChange))
 	r.MethodFunc("POST", getPath(acme.NewOrderLinkType, "{provisionerID}"),
 		extractPayloadByKid(NewOrder))
 	r.MethodFunc("POST", getPath(acme.OrderLinkType, "{provisionerID}", "{ordID}"),
@@ -171,14 +172,20 @@ func route(r api.Router, middleware func(next nextHTTP) nextHTTP) {
 		extractPayloadByKid(isPostAsGet(GetOrdersByAccountID)))
 	r.MethodFunc("POST", getPath(acme.FinalizeLinkType, "{provisionerID}", "{ordID}"),
 		extractPayloadByKid(FinalizeOrder))
+	r.MethodFunc("POST", getPath(acme.NewAuthzLinkType, "{provisionerID}"),
+		extractPayloadByKid(NewAuthorization))
 	r.MethodFunc("POST", getPath(acme.AuthzLinkType, "{provisionerID}", "{authzID}"),
 		extractPayloadByKid(isPostAsGet(GetAuthorization)))
 	r.MethodFunc("POST", getPath(acme.ChallengeLinkType, "{provisionerID}", "{authzID}", "{chID}"),
 		extractPayloadByKid(GetChallenge))
 	r.MethodFunc("POST", getPath(acme.CertificateLinkType, "{provisionerID}", "{certID}"),
 		extractPayloadByKid(isPostAsGet(GetCertificate)))
+	r.MethodFunc("POST", getPath(acme.CertificateLinkType, "{provisionerID}", "{certID}", "{chain}"),
+		extractPayloadByKid(isPostAsGet(GetCertificate)))
 	r.MethodFunc("POST", getPath(acme.RevokeCertLinkType, "{provisionerID}"),
 		extractPayloadByKidOrJWK(RevokeCert))
+	r.MethodFunc("GET", getPath(acme.RenewalInfoLinkType, "{provisionerID}", "{certID}"),
+		commonMiddleware(GetRenewalInfo))
 }
 
 // GetNonce just sets the right header since a Nonce is added to each response
@@ -192,20 +199,23 @@ func GetNonce(w http.ResponseWriter, r *http.Request) {
 }
 
 type Meta struct {
-	TermsOfService          string   `json:"termsOfService,omitempty"`
-	Website                 string   `json:"website,omitempty"`
-	CaaIdentities           []string `json:"caaIdentities,omitempty"`
-	ExternalAccountRequired bool     `json:"externalAccountRequired,omitempty"`
+	TermsOfService          string            `json:"termsOfService,omitempty"`
+	Website                 string            `json:"website,omitempty"`
+	CaaIdentities           []string          `json:"caaIdentities,omitempty"`
+	ExternalAccountRequired bool              `json:"externalAccountRequired,omitempty"`
+	Profiles                map[string]string `json:"profiles,omitempty"`
 }
 
 // Directory represents an ACME directory for configuring clients.
 type Directory struct {
-	NewNonce   string `json:"newNonce"`
-	NewAccount string `json:"newAccount"`
-	NewOrder   string `json:"newOrder"`
-	RevokeCert string `json:"revokeCert"`
-	KeyChange  string `json:"keyChange"`
-	Meta       *Meta  `json:"meta,omitempty"`
+	NewNonce    string `json:"newNonce"`
+	NewAccount  string `json:"newAccount"`
+	NewOrder    string `json:"newOrder"`
+	NewAuthz    string `json:"newAuthz,omitempty"`
+	RevokeCert  string `json:"revokeCert"`
+	KeyChange   string `json:"keyChange"`
+	RenewalInfo string `json:"renewalInfo,omitempty"`
+	Meta        *Meta  `json:"meta,omitempty"`
 }
 
 // ToLog enables response logging for the Directory type.
@@ -229,13 +239,21 @@ func GetDirectory(w http.ResponseWriter, r *http.Request) {
 
 	linker := acme.MustLinkerFromContext(ctx)
 
+	// The newAuthz resource is only available if pre-authorization is enabled.
+	var newAuthz string
+	if acmeProv.EnablePreAuthorization {
+		newAuthz = linker.GetLink(ctx, acme.NewAuthzLinkType)
+	}
+
 	render.JSON(w, r, &Directory{
-		NewNonce:   linker.GetLink(ctx, acme.NewNonceLinkType),
-		NewAccount: linker.GetLink(ctx, acme.NewAccountLinkType),
-		NewOrder:   linker.GetLink(ctx, acme.NewOrderLinkType),
-		RevokeCert: linker.GetLink(ctx, acme.RevokeCertLinkType),
-		KeyChange:  linker.GetLink(ctx, acme.KeyChangeLinkType),
-		Meta:       createMetaObject(acmeProv),
+		NewNonce:    linker.GetLink(ctx, acme.NewNonceLinkType),
+		NewAccount:  linker.GetLink(ctx, acme.NewAccountLinkType),
+		NewOrder:    linker.GetLink(ctx, acme.NewOrderLinkType),
+		NewAuthz:    newAuthz,
+		RevokeCert:  linker.GetLink(ctx, acme.RevokeCertLinkType),
+		KeyChange:   linker.GetLink(ctx, acme.KeyChangeLinkType),
+		RenewalInfo: linker.GetLink(ctx, acme.RenewalInfoLinkType),
+		Meta:        createMetaObject(acmeProv),
 	})
 }
 
@@ -249,11 +267,25 @@ func createMetaObject(p *provisioner.ACME) *Meta {
 			Website:                 p.Website,
 			CaaIdentities:           p.CaaIdentities,
 			ExternalAccountRequired: p.RequireEAB,
+			Profiles:                createMetaProfiles(p),
 		}
 	}
 	return nil
 }
 
+// createMetaProfiles returns the profiles supported by the ACME provisioner,
+// mapping the name of the profiles to their description.
+func createMetaProfiles(p *provisioner.ACME) map[string]string {
+	if len(p.Profiles) == 0 {
+		return nil
+	}
+	profiles := make(map[string]string, len(p.Profiles))
+	for _, profile := range p.Profiles {
+		profiles[profile.Name] = profile.Description
+	}
+	return profiles
+}
+
 // shouldAddMetaObject returns whether or not the ACME provisioner
 // has properties configured that must be added to the ACME directory object.
 func shouldAddMetaObject(p *provisioner.ACME) bool {
@@ -266,6 +298,8 @@ func shouldAddMetaObject(p *provisioner.ACME) bool {
 		return true
 	case p.RequireEAB:
 		return true
+	case len(p.Profiles) > 0:
+		return true
 	default:
 		return false
 	}
@@ -350,10 +384,28 @@ func GetChallenge(w http.ResponseWriter, r *http.Request) {
 		render.Error(w, r, err)
 		return
 	}
+	acmeProv, err := acmeProvisionerFromContext(ctx)
+	if err != nil {
+		render.Error(w, r, err)
+		return
+	}
+	validating := ch.Status == acme.StatusPending
+	if validating {
+		if err := checkFailedValidationsRateLimit(ctx, acmeProv, acc); err != nil {
+			render.Error(w, r, err)
+			return
+		}
+	}
 	if err = ch.Validate(ctx, db, jwk, payload.value); err != nil {
 		render.Error(w, r, acme.WrapErrorISE(err, "error validating challenge"))
 		return
 	}
+	if validating && ch.Status == acme.StatusInvalid {
+		if err := countFailedValidation(ctx, acmeProv, acc); err != nil {
+			render.Error(w, r, err)
+			return
+		}
+	}
 
 	linker.LinkChallenge(ctx, ch, azID)
 
@@ -362,7 +414,9 @@ func GetChallenge(w http.ResponseWriter, r *http.Request) {
 	render.JSON(w, r, ch)
 }
 
-// GetCertificate ACME api for retrieving a Certificate.
+// GetCertificate ACME api for retrieving a Certificate. If alternate chains
+// are available, links to them are added using the "alternate" relation as
+// described in RFC 8555, Section 7.4.2.
 func GetCertificate(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	db := acme.MustDatabaseFromContext(ctx)
@@ -385,8 +439,26 @@ func GetCertificate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	chain := append([]*x509.Certificate{cert.Leaf}, cert.Intermediates...)
+	alternates := mustAuthority(ctx).GetAlternateX509Chains(chain)
+	if s := chi.URLParam(r, "chain"); s != "" {
+		i, err := strconv.Atoi(s)
+		if err != nil || i < 1 || i > len(alternates) {
+			render.Error(w, r, acme.NewError(acme.ErrorMalformedType,
+				"alternate chain '%s' does not exist for certificate '%s'", s, certID))
+			return
+		}
+		chain = alternates[i-1]
+	}
+	if len(alternates) > 0 {
+		linker := acme.MustLinkerFromContext(ctx)
+		for i := range alternates {
+			w.Header().Add("Link", link(linker.GetLink(ctx, acme.CertificateLinkType, certID, strconv.Itoa(i+1)), "alternate"))
+		}
+	}
+
 	var certBytes []byte
-	for _, c := range append([]*x509.Certificate{cert.Leaf}, cert.Intermediates...) {
+	for _, c := range chain {
 		certBytes = append(certBytes, pem.EncodeToMemory(&pem.Block{
 			Type:  "CERTIFICATE",
 			Bytes: c.Raw,
@@ -108,11 +108,12 @@ func TestHandler_GetDirectory(t *testing.T) {
 			baseURL := &url.URL{Scheme: "https", Host: "test.ca.smallstep.com"}
 			ctx := acme.NewProvisionerContext(context.Background(), prov)
 			expDir := Directory{
-				NewNonce:   fmt.Sprintf("%s/acme/%s/new-nonce", baseURL.String(), provName),
-				NewAccount: fmt.Sprintf("%s/acme/%s/new-account", baseURL.String(), provName),
-				NewOrder:   fmt.Sprintf("%s/acme/%s/new-order", baseURL.String(), provName),
-				RevokeCert: fmt.Sprintf("%s/acme/%s/revoke-cert", baseURL.String(), provName),
-				KeyChange:  fmt.Sprintf("%s/acme/%s/key-change", baseURL.String(), provName),
+				NewNonce:    fmt.Sprintf("%s/acme/%s/new-nonce", baseURL.String(), provName),
+				NewAccount:  fmt.Sprintf("%s/acme/%s/new-account", baseURL.String(), provName),
+				NewOrder:    fmt.Sprintf("%s/acme/%s/new-order", baseURL.String(), provName),
+				RevokeCert:  fmt.Sprintf("%s/acme/%s/revoke-cert", baseURL.String(), provName),
+				KeyChange:   fmt.Sprintf("%s/acme/%s/key-change", baseURL.String(), provName),
+				RenewalInfo: fmt.Sprintf("%s/acme/%s/renewal-info", baseURL.String(), provName),
 			}
 			return test{
 				ctx:        ctx,
@@ -127,11 +128,12 @@ func TestHandler_GetDirectory(t *testing.T) {
 			baseURL := &url.URL{Scheme: "https", Host: "test.ca.smallstep.com"}
 			ctx := acme.NewProvisionerContext(context.Background(), prov)
 			expDir := Directory{
-				NewNonce:   fmt.Sprintf("%s/acme/%s/new-nonce", baseURL.String(), provName),
-				NewAccount: fmt.Sprintf("%s/acme/%s/new-account", baseURL.String(), provName),
-				NewOrder:   fmt.Sprintf("%s/acme/%s/new-order", baseURL.String(), provName),
-				RevokeCert: fmt.Sprintf("%s/acme/%s/revoke-cert", baseURL.String(), provName),
-				KeyChange:  fmt.Sprintf("%s/acme/%s/key-change", baseURL.String(), provName),
+				NewNonce:    fmt.Sprintf("%s/acme/%s/new-nonce", baseURL.String(), provName),
+				NewAccount:  fmt.Sprintf("%s/acme/%s/new-account", baseURL.String(), provName),
+				NewOrder:    fmt.Sprintf("%s/acme/%s/new-order", baseURL.String(), provName),
+				RevokeCert:  fmt.Sprintf("%s/acme/%s/revoke-cert", baseURL.String(), provName),
+				KeyChange:   fmt.Sprintf("%s/acme/%s/key-change", baseURL.String(), provName),
+				RenewalInfo: fmt.Sprintf("%s/acme/%s/renewal-info", baseURL.String(), provName),
 				Meta: &Meta{
 					ExternalAccountRequired: true,
 				},
@@ -142,6 +144,27 @@ func TestHandler_GetDirectory(t *testing.T) {
 				statusCode: 200,
 			}
 		},
+		"ok/pre-authorization": func(t *testing.T) test {
+			prov := newACMEProv(t)
+			prov.EnablePreAuthorization = true
+			provName := url.PathEscape(prov.GetName())
+			baseURL := &url.URL{Scheme: "https", Host: "test.ca.smallstep.com"}
+			ctx := acme.NewProvisionerContext(context.Background(), prov)
+			expDir := Directory{
+				NewNonce:    fmt.Sprintf("%s/acme/%s/new-nonce", baseURL.String(), provName),
+				NewAccount:  fmt.Sprintf("%s/acme/%s/new-account", baseURL.String(), provName),
+				NewOrder:    fmt.Sprintf("%s/acme/%s/new-order", baseURL.String(), provName),
+				NewAuthz:    fmt.Sprintf("%s/acme/%s/new-authz", baseURL.String(), provName),
+				RevokeCert:  fmt.Sprintf("%s/acme/%s/revoke-cert", baseURL.String(), provName),
+				KeyChange:   fmt.Sprintf("%s/acme/%s/key-change", baseURL.String(), provName),
+				RenewalInfo: fmt.Sprintf("%s/acme/%s/renewal-info", baseURL.String(), provName),
+			}
+			return test{
+				ctx:        ctx,
+				dir:        expDir,
+				statusCode: 200,
+			}
+		},
 		"ok/full-meta": func(t *testing.T) test {
 			prov := newACMEProv(t)
 			prov.TermsOfService = "https://terms.ca.local/"
@@ -152,11 +175,12 @@ func TestHandler_GetDirectory(t *testing.T) {
 			baseURL := &url.URL{Scheme: "https", Host: "test.ca.smallstep.com"}
 			ctx := acme.NewProvisionerContext(context.Background(), prov)
 			expDir := Directory{
-				NewNonce:   fmt.Sprintf("%s/acme/%s/new-nonce", baseURL.String(), provName),
-				NewAccount: fmt.Sprintf("%s/acme/%s/new-account", baseURL.String(), provName),
-				NewOrder:   fmt.Sprintf("%s/acme/%s/new-order", baseURL.String(), provName),
-				RevokeCert: fmt.Sprintf("%s/acme/%s/revoke-cert", baseURL.String(), provName),
-				KeyChange:  fmt.Sprintf("%s/acme/%s/key-change", baseURL.String(), provName),
+				NewNonce:    fmt.Sprintf("%s/acme/%s/new-nonce", baseURL.String(), provName),
+				NewAccount:  fmt.Sprintf("%s/acme/%s/new-account", baseURL.String(), provName),
+				NewOrder:    fmt.Sprintf("%s/acme/%s/new-order", baseURL.String(), provName),
+				RevokeCert:  fmt.Sprintf("%s/acme/%s/revoke-cert", baseURL.String(), provName),
+				KeyChange:   fmt.Sprintf("%s/acme/%s/key-change", baseURL.String(), provName),
+				RenewalInfo: fmt.Sprintf("%s/acme/%s/renewal-info", baseURL.String(), provName),
 				Meta: &Meta{
 					TermsOfService:          "https://terms.ca.local/",
 					Website:                 "https://ca.local/",
@@ -400,6 +424,13 @@ func TestHandler_GetCertificate(t *testing.T) {
 		Bytes: root.Raw,
 	})...)
 	certID := "certID"
+	altCertBytes := append(pem.EncodeToMemory(&pem.Block{
+		Type:  "CERTIFICATE",
+		Bytes: leaf.Raw,
+	}), pem.EncodeToMemory(&pem.Block{
+		Type:  "CERTIFICATE",
+		Bytes: root.Raw,
+	})...)
 
 	prov := newProv()
 	provName := url.PathEscape(prov.GetName())
@@ -412,8 +443,12 @@ func TestHandler_GetCertificate(t *testing.T) {
 
 	type test struct {
 		db         acme.DB
+		ca         acme.CertificateAuthority
 		ctx        context.Context
+		chain      string
 		statusCode int
+		links      []string
+		certBytes  []byte
 		err        *acme.Error
 	}
 	var tests = map[string]func(t *testing.T) test{
@@ -480,14 +515,105 @@ func TestHandler_GetCertificate(t *testing.T) {
 						}, nil
 					},
 				},
+				ca:         &mockCA{},
+				ctx:        ctx,
+				statusCode: 200,
+				certBytes:  certBytes,
+			}
+		},
+		"ok/alternate-links": func(t *testing.T) test {
+			acc := &acme.Account{ID: "accID"}
+			ctx := context.WithValue(context.Background(), accContextKey, acc)
+			ctx = context.WithValue(ctx, chi.RouteCtxKey, chiCtx)
+			ctx = acme.NewProvisionerContext(ctx, prov)
+			ctx = acme.NewLinkerContext(ctx, acme.NewLinker("test.ca.smallstep.com", "acme"))
+			return test{
+				db: &acme.MockDB{
+					MockGetCertificate: func(ctx context.Context, id string) (*acme.Certificate, error) {
+						return &acme.Certificate{
+							AccountID:     "accID",
+							Leaf:          leaf,
+							Intermediates: []*x509.Certificate{inter, root},
+							ID:            id,
+						}, nil
+					},
+				},
+				ca: &mockCA{
+					MockGetAlternateX509Chains: func(chain []*x509.Certificate) [][]*x509.Certificate {
+						assert.Equals(t, chain, []*x509.Certificate{leaf, inter, root})
+						return [][]*x509.Certificate{{leaf, root}}
+					},
+				},
+				ctx:        ctx,
+				statusCode: 200,
+				links:      []string{fmt.Sprintf("<%s/acme/%s/certificate/%s/1>;rel=\"alternate\"", baseURL, provName, certID)},
+				certBytes:  certBytes,
+			}
+		},
+		"ok/alternate-chain": func(t *testing.T) test {
+			acc := &acme.Account{ID: "accID"}
+			ctx := context.WithValue(context.Background(), accContextKey, acc)
+			chiCtx := chi.NewRouteContext()
+			chiCtx.URLParams.Add("certID", certID)
+			chiCtx.URLParams.Add("chain", "1")
+			ctx = context.WithValue(ctx, chi.RouteCtxKey, chiCtx)
+			ctx = acme.NewProvisionerContext(ctx, prov)
+			ctx = acme.NewLinkerContext(ctx, acme.NewLinker("test.ca.smallstep.com", "acme"))
+			return test{
+				db: &acme.MockDB{
+					MockGetCertificate: func(ctx context.Context, id string) (*acme.Certificate, error) {
+						return &acme.Certificate{
+							AccountID:     "accID",
+							Leaf:          leaf,
+							Intermediates: []*x509.Certificate{inter, root},
+							ID:            id,
+						}, nil
+					},
+				},
+				ca: &mockCA{
+					MockGetAlternateX509Chains: func(chain []*x509.Certificate) [][]*x509.Certificate {
+						return [][]*x509.Certificate{{leaf, root}}
+					},
+				},
 				ctx:        ctx,
 				statusCode: 200,
+				links:      []string{fmt.Sprintf("<%s/acme/%s/certificate/%s/1>;rel=\"alternate\"", baseURL, provName, certID)},
+				certBytes:  altCertBytes,
+			}
+		},
+		"fail/alternate-chain-not-found": func(t *testing.T) test {
+			acc := &acme.Account{ID: "accID"}
+			ctx := context.WithValue(context.Background(), accContextKey, acc)
+			chiCtx := chi.NewRouteContext()
+			chiCtx.URLParams.Add("certID", certID)
+			chiCtx.URLParams.Add("chain", "2")
+			ctx = context.WithValue(ctx, chi.RouteCtxKey, chiCtx)
+			return test{
+				db: &acme.MockDB{
+					MockGetCertificate: func(ctx context.Context, id string) (*acme.Certificate, error) {
+						return &acme.Certificate{
+							AccountID:     "accID",
+							Leaf:          leaf,
+							Intermediates: []*x509.Certificate{inter, root},
+							ID:            id,
+						}, nil
+					},
+				},
+				ca: &mockCA{
+					MockGetAlternateX509Chains: func(chain []*x509.Certificate) [][]*x509.Certificate {
+						return [][]*x509.Certificate{{leaf, root}}
+					},
+				},
+				ctx:        ctx,
+				statusCode: 400,
+				err:        acme.NewError(acme.ErrorMalformedType, "alternate chain '2' does not exist for certificate 'certID'"),
 			}
 		},
 	}
 	for name, run := range tests {
 		tc := run(t)
 		t.Run(name, func(t *testing.T) {
+			mockMustAuthority(t, tc.ca)
 			ctx := acme.NewDatabaseContext(tc.ctx, tc.db)
 			req := httptest.NewRequest("GET", u, http.NoBody)
 			req = req.WithContext(ctx)
@@ -510,7 +636,8 @@ func TestHandler_GetCertificate(t *testing.T) {
 				assert.Equals(t, ae.Subproblems, tc.err.Subproblems)
 				assert.Equals(t, res.Header["Content-Type"], []string{"application/problem+json"})
 			} else {
-				assert.Equals(t, bytes.TrimSpace(body), bytes.TrimSpace(certBytes))
+				assert.Equals(t, bytes.TrimSpace(body), bytes.TrimSpace(tc.certBytes))
+				assert.Equals(t, res.Header["Link"], tc.links)
 				assert.Equals(t, res.Header["Content-Type"], []string{"application/pem-certificate-chain"})
 			}
 		})
@@ -837,6 +964,23 @@ func Test_createMetaObject(t *testing.T) {
 				ExternalAccountRequired: true,
 			},
 		},
+		{
+			name: "profiles",
+			p: &provisioner.ACME{
+				Type: "ACME",
+				Name: "acme",
+				Profiles: []provisioner.ACMEProfile{
+					{Name: "tlsserver", Description: "Server TLS certificates"},
+					{Name: "shortlived"},
+				},
+			},
+			want: &Meta{
+				Profiles: map[string]string{
+					"tlsserver":  "Server TLS certificates",
+					"shortlived": "",
+				},
+			},
+		},
 		{
 			name: "full-meta",
 			p: &provisioner.ACME{
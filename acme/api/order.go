@@ -5,9 +5,11 @@ import (
 	"crypto/x509"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net"
 	"net/http"
+	"net/mail"
 	"strings"
 	"time"
 
@@ -28,6 +30,7 @@ type NewOrderRequest struct {
 	Identifiers []acme.Identifier `json:"identifiers"`
 	NotBefore   time.Time         `json:"notBefore,omitempty"`
 	NotAfter    time.Time         `json:"notAfter,omitempty"`
+	Profile     string            `json:"profile,omitempty"`
 }
 
 // Validate validates a new-order request body.
@@ -38,18 +41,34 @@ func (n *NewOrderRequest) Validate() error {
 	for _, id := range n.Identifiers {
 		switch id.Type {
 		case acme.IP:
-			if net.ParseIP(id.Value) == nil {
+			ip := net.ParseIP(id.Value)
+			if ip == nil {
 				return acme.NewError(acme.ErrorMalformedType, "invalid IP address: %s", id.Value)
 			}
+			// RFC 8738 requires the textual form defined in RFC 1123 for IPv4
+			// and in RFC 5952 for IPv6 addresses.
+			if s := ip.String(); s != id.Value {
+				return acme.NewError(acme.ErrorMalformedType, "IP address %s is not in canonical form, use %s", id.Value, s)
+			}
 		case acme.DNS:
 			value, _ := trimIfWildcard(id.Value)
 			if _, err := x509util.SanitizeName(value); err != nil {
 				return acme.NewError(acme.ErrorMalformedType, "invalid DNS name: %s", id.Value)
 			}
+			// Only onion service v3 names can be validated.
+			if acme.IsOnionName(value) {
+				if _, err := acme.OnionPublicKey(value); err != nil {
+					return acme.WrapError(acme.ErrorMalformedType, err, "invalid onion name: %s", id.Value)
+				}
+			}
 		case acme.PermanentIdentifier:
 			if id.Value == "" {
 				return acme.NewError(acme.ErrorMalformedType, "permanent identifier cannot be empty")
 			}
+		case acme.Email:
+			if addr, err := mail.ParseAddress(id.Value); err != nil || addr.Address != id.Value {
+				return acme.NewError(acme.ErrorMalformedType, "invalid email address: %s", id.Value)
+			}
 		case acme.WireUser, acme.WireDevice:
 			// validation of Wire identifiers is performed in `validateWireIdentifiers`, but
 			// marked here as known and supported types.
@@ -63,6 +82,11 @@ func (n *NewOrderRequest) Validate() error {
 		return acme.WrapError(acme.ErrorMalformedType, err, "failed validating Wire identifiers")
 	}
 
+	// S/MIME certificates can only be requested for email identifiers.
+	if emails := len(identifiersOfType(acme.Email, n.Identifiers)); emails > 0 && emails != len(n.Identifiers) {
+		return acme.NewError(acme.ErrorMalformedType, "email identifiers cannot be combined with other identifier types")
+	}
+
 	// TODO(hs): add some validations for DNS domains?
 	// TODO(hs): combine the errors from this with allow/deny policy, like example error in https://datatracker.ietf.org/doc/html/rfc8555#section-6.7.1
 
@@ -214,32 +238,67 @@ func NewOrder(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	acmePolicy, err := newACMEPolicyEngine(eak)
+	// The profile defines the template and the lifetime of the certificate. If
+	// the request does not define one, the default profile is used.
+	profile, err := prov.GetProfile(nor.Profile)
 	if err != nil {
-		render.Error(w, r, acme.WrapErrorISE(err, "error creating ACME policy engine"))
+		render.Error(w, r, acme.WrapError(acme.ErrorInvalidProfileType, err, "invalid profile"))
 		return
 	}
 
-	for _, identifier := range nor.Identifiers {
-		// evaluate the ACME account level policy
-		if err = isIdentifierAllowed(acmePolicy, identifier); err != nil {
-			render.Error(w, r, acme.WrapError(acme.ErrorRejectedIdentifierType, err, "not authorized"))
-			return
+	now := clock.Now()
+	if profile != nil && !nor.NotAfter.IsZero() {
+		notBefore := nor.NotBefore
+		if notBefore.IsZero() {
+			notBefore = now
 		}
-		// evaluate the provisioner level policy
-		orderIdentifier := provisioner.ACMEIdentifier{Type: provisioner.ACMEIdentifierType(identifier.Type), Value: identifier.Value}
-		if err = prov.AuthorizeOrderIdentifier(ctx, orderIdentifier); err != nil {
-			render.Error(w, r, acme.WrapError(acme.ErrorRejectedIdentifierType, err, "not authorized"))
+		maxDuration := profile.GetMaxTLSCertDuration(nor.NotAfter.Sub(notBefore))
+		if nor.NotAfter.Sub(notBefore) > maxDuration {
+			render.Error(w, r, acme.NewError(acme.ErrorMalformedType,
+				"requested duration of %s is more than the maximum of %s allowed by the profile %s",
+				nor.NotAfter.Sub(notBefore), maxDuration, profile.Name))
 			return
 		}
-		// evaluate the authority level policy
-		if err = ca.AreSANsAllowed(ctx, []string{identifier.Value}); err != nil {
-			render.Error(w, r, acme.WrapError(acme.ErrorRejectedIdentifierType, err, "not authorized"))
-			return
+	}
+
+	acmePolicy, err := newACMEPolicyEngine(acc, eak)
+	if err != nil {
+		render.Error(w, r, acme.WrapErrorISE(err, "error creating ACME policy engine"))
+		return
+	}
+
+	// evaluate the ACME account, provisioner and authority level policies, the
+	// rejected identifiers are gathered and returned as subproblems of the
+	// same error
+	var problems, wildcardProblems []acme.Subproblem
+	for _, identifier := range nor.Identifiers {
+		if err = authorizeIdentifier(ctx, ca, acmePolicy, prov, identifier); err != nil {
+			var wErr *provisioner.ACMEWildcardError
+			if errors.As(err, &wErr) {
+				wildcardProblems = append(wildcardProblems, acme.NewSubproblemWithIdentifier(
+					acme.ErrorRejectedIdentifierType, identifier, "%s", wErr.Reason))
+				continue
+			}
+			problems = append(problems, acme.NewSubproblemWithIdentifier(
+				acme.ErrorRejectedIdentifierType, identifier, "%s", err))
 		}
 	}
+	switch {
+	case len(problems) > 0:
+		render.Error(w, r, acme.NewError(acme.ErrorRejectedIdentifierType,
+			"not authorized").AddSubproblems(append(problems, wildcardProblems...)...))
+		return
+	case len(wildcardProblems) > 0:
+		render.Error(w, r, acme.NewDetailedError(acme.ErrorRejectedIdentifierType,
+			"wildcard identifiers are not allowed by the provisioner policy").AddSubproblems(wildcardProblems...))
+		return
+	}
+
+	if err := checkOrdersRateLimit(ctx, acmeProv, acc); err != nil {
+		render.Error(w, r, err)
+		return
+	}
 
-	now := clock.Now()
 	// New order.
 	o := &acme.Order{
 		AccountID:        acc.ID,
@@ -251,8 +310,27 @@ func NewOrder(w http.ResponseWriter, r *http.Request) {
 		NotBefore:        nor.NotBefore,
 		NotAfter:         nor.NotAfter,
 	}
+	if profile != nil {
+		o.Profile = profile.Name
+	}
 
+	// If pre-authorization is enabled, the valid authorizations of the account
+	// are reused instead of creating new ones.
+	var validAuthzs map[acme.Identifier]*acme.Authorization
+	if acmeProv.EnablePreAuthorization {
+		if validAuthzs, err = validAuthorizationsByAccountID(ctx, db, prov, acc.ID, now); err != nil {
+			render.Error(w, r, err)
+			return
+		}
+	}
+
+	var reused int
 	for i, identifier := range o.Identifiers {
+		if az, ok := validAuthzs[identifier]; ok {
+			o.AuthorizationIDs[i] = az.ID
+			reused++
+			continue
+		}
 		az := &acme.Authorization{
 			AccountID:  acc.ID,
 			Identifier: identifier,
@@ -265,12 +343,15 @@ func NewOrder(w http.ResponseWriter, r *http.Request) {
 		}
 		o.AuthorizationIDs[i] = az.ID
 	}
+	if reused == len(o.Identifiers) {
+		o.Status = acme.StatusReady
+	}
 
 	if o.NotBefore.IsZero() {
 		o.NotBefore = now
 	}
 	if o.NotAfter.IsZero() {
-		o.NotAfter = o.NotBefore.Add(prov.DefaultTLSCertDuration())
+		o.NotAfter = o.NotBefore.Add(profile.GetDefaultTLSCertDuration(prov.DefaultTLSCertDuration()))
 	}
 	// If request NotBefore was empty then backdate the order.NotBefore (now)
 	// to avoid timing issues.
@@ -289,19 +370,64 @@ func NewOrder(w http.ResponseWriter, r *http.Request) {
 	render.JSONStatus(w, r, o, http.StatusCreated)
 }
 
-func isIdentifierAllowed(acmePolicy policy.X509Policy, identifier acme.Identifier) error {
-	if acmePolicy == nil {
+// authorizeIdentifier evaluates the ACME account, provisioner and authority
+// level policies for the given identifier.
+func authorizeIdentifier(ctx context.Context, ca acme.CertificateAuthority, acmePolicy accountPolicy, prov acme.Provisioner, identifier acme.Identifier) error {
+	// evaluate the ACME account level policy
+	if err := isIdentifierAllowed(acmePolicy, identifier); err != nil {
+		return err
+	}
+	// evaluate the provisioner level policy
+	orderIdentifier := provisioner.ACMEIdentifier{Type: provisioner.ACMEIdentifierType(identifier.Type), Value: identifier.Value}
+	if err := prov.AuthorizeOrderIdentifier(ctx, orderIdentifier); err != nil {
+		return err
+	}
+	// evaluate the authority level policy, permanent identifiers are
+	// authorized by the provisioner
+	if identifier.Type == acme.PermanentIdentifier {
 		return nil
 	}
+	return ca.AreSANsAllowed(ctx, []string{identifier.Value})
+}
+
+// accountPolicy contains the ACME account level policy engines, one for the
+// policy of the account and one for the policy of the EAB key bound to it.
+// A name must be allowed by all of them.
+type accountPolicy []policy.X509Policy
+
+// AreSANsAllowed returns an error if any of the given SANs is not allowed by
+// the account level policies.
+func (p accountPolicy) AreSANsAllowed(sans []string) error {
+	for _, engine := range p {
+		if err := engine.AreSANsAllowed(sans); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func isIdentifierAllowed(acmePolicy accountPolicy, identifier acme.Identifier) error {
 	return acmePolicy.AreSANsAllowed([]string{identifier.Value})
 }
 
-func newACMEPolicyEngine(eak *acme.ExternalAccountKey) (policy.X509Policy, error) {
-	if eak == nil {
-		//nolint:nilnil,nolintlint // expected values
-		return nil, nil
+func newACMEPolicyEngine(acc *acme.Account, eak *acme.ExternalAccountKey) (accountPolicy, error) {
+	var policies []*acme.Policy
+	if acc != nil && acc.Policy != nil {
+		policies = append(policies, acc.Policy)
 	}
-	return policy.NewX509PolicyEngine(eak.Policy)
+	if eak != nil && eak.Policy != nil {
+		policies = append(policies, eak.Policy)
+	}
+
+	var acmePolicy accountPolicy
+	for _, p := range policies {
+		engine, err := policy.NewX509PolicyEngine(p)
+		if err != nil {
+			return nil, err
+		}
+		acmePolicy = append(acmePolicy, engine)
+	}
+	return acmePolicy, nil
 }
 
 func trimIfWildcard(value string) (string, bool) {
@@ -311,6 +437,52 @@ func trimIfWildcard(value string) (string, bool) {
 	return value, false
 }
 
+// validAuthorizationsByAccountID returns the valid and not expired
+// authorizations of an account indexed by their identifier. Wildcard
+// authorizations are not included, so they are never reused.
+//
+// The authorizations are checked against the current configuration of the
+// provisioner: the identifier must be allowed by the provisioner policy, and
+// the challenge used to validate it must still be enabled. The callers are
+// responsible for evaluating the account and authority level policies.
+func validAuthorizationsByAccountID(ctx context.Context, db acme.DB, prov acme.Provisioner, accountID string, now time.Time) (map[acme.Identifier]*acme.Authorization, error) {
+	azs, err := db.GetAuthorizationsByAccountID(ctx, accountID)
+	if err != nil {
+		return nil, acme.WrapErrorISE(err, "error retrieving authorizations")
+	}
+	m := make(map[acme.Identifier]*acme.Authorization)
+	for _, az := range azs {
+		if az.Status != acme.StatusValid || az.Wildcard || !now.Before(az.ExpiresAt) {
+			continue
+		}
+		orderIdentifier := provisioner.ACMEIdentifier{Type: provisioner.ACMEIdentifierType(az.Identifier.Type), Value: az.Identifier.Value}
+		if err := prov.AuthorizeOrderIdentifier(ctx, orderIdentifier); err != nil {
+			continue
+		}
+		// The list of authorizations does not include the challenges.
+		full, err := db.GetAuthorization(ctx, az.ID)
+		if err != nil {
+			return nil, acme.WrapErrorISE(err, "error retrieving authorization")
+		}
+		if !isValidChallengeEnabled(ctx, prov, full) {
+			continue
+		}
+		m[az.Identifier] = az
+	}
+	return m, nil
+}
+
+// isValidChallengeEnabled returns true if the authorization has been
+// validated using a challenge that is enabled in the provisioner.
+func isValidChallengeEnabled(ctx context.Context, prov acme.Provisioner, az *acme.Authorization) bool {
+	for _, ch := range az.Challenges {
+		if ch.Status == acme.StatusValid && prov.IsChallengeEnabled(ctx, provisioner.ACMEChallenge(ch.Type)) {
+			return true
+		}
+	}
+	return false
+}
+
 func newAuthorization(ctx context.Context, az *acme.Authorization) error {
 	value, isWildcard := trimIfWildcard(az.Identifier.Value)
 	az.Wildcard = isWildcard
@@ -373,6 +545,16 @@ func newAuthorization(ctx context.Context, az *acme.Authorization) error {
 			Status:    acme.StatusPending,
 			Target:    target,
 		}
+		switch typ {
+		case acme.EMAILREPLY00:
+			if err := acme.SendEmailChallenge(ctx, ch); err != nil {
+				return err
+			}
+		case acme.ONIONCSR01:
+			if err := acme.NewOnionNonce(ch); err != nil {
+				return err
+			}
+		}
 		if err := db.CreateChallenge(ctx, ch); err != nil {
 			return acme.WrapErrorISE(err, "error creating challenge")
 		}
@@ -475,11 +657,37 @@ func FinalizeOrder(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// evaluate the ACME account level policies again, they might have changed
+	// since the order was created
+	if err := isCSRAllowedByAccountPolicy(ctx, db, acc, fr.csr); err != nil {
+		render.Error(w, r, err)
+		return
+	}
+
+	acmeProv, err := acmeProvisionerFromContext(ctx)
+	if err != nil {
+		render.Error(w, r, err)
+		return
+	}
+	issuing := o.Status != acme.StatusValid && o.Status != acme.StatusInvalid
+	if issuing {
+		if err := checkDuplicateCertificatesRateLimit(ctx, acmeProv, acc, o); err != nil {
+			render.Error(w, r, err)
+			return
+		}
+	}
+
 	ca := mustAuthority(ctx)
 	if err = o.Finalize(ctx, db, fr.csr, ca, prov); err != nil {
 		render.Error(w, r, acme.WrapErrorISE(err, "error finalizing order"))
 		return
 	}
+	if issuing && o.Status == acme.StatusValid {
+		if err := countDuplicateCertificate(ctx, acmeProv, acc, o); err != nil {
+			render.Error(w, r, err)
+			return
+		}
+	}
 
 	linker.LinkOrder(ctx, o)
 
@@ -487,6 +695,52 @@ func FinalizeOrder(w http.ResponseWriter, r *http.Request) {
 	render.JSON(w, r, o)
 }
 
+// isCSRAllowedByAccountPolicy returns an error if the SANs in the CSR are not
+// allowed by the ACME account level policies.
+func isCSRAllowedByAccountPolicy(ctx context.Context, db acme.DB, acc *acme.Account, csr *x509.CertificateRequest) error {
+	acmeProv, err := acmeProvisionerFromContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	var eak *acme.ExternalAccountKey
+	if acmeProv.RequireEAB {
+		if eak, err = db.GetExternalAccountKeyByAccountID(ctx, acmeProv.GetID(), acc.ID); err != nil {
+			return acme.WrapErrorISE(err, "error retrieving external account binding key")
+		}
+	}
+
+	acmePolicy, err := newACMEPolicyEngine(acc, eak)
+	if err != nil {
+		return acme.WrapErrorISE(err, "error creating ACME policy engine")
+	}
+	if len(acmePolicy) == 0 {
+		return nil
+	}
+
+	sans := append([]string{}, csr.DNSNames...)
+	for _, ip := range csr.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+	sans = append(sans, csr.EmailAddresses...)
+	for _, u := range csr.URIs {
+		sans = append(sans, u.String())
+	}
+
+	// every SAN is evaluated, so all the rejected names are returned as
+	// subproblems of the same error
+	var problems []acme.Subproblem
+	for _, san := range sans {
+		if err := acmePolicy.AreSANsAllowed([]string{san}); err != nil {
+			problems = append(problems, acme.NewPolicySubproblem(err))
+		}
+	}
+	if len(problems) > 0 {
+		return acme.NewError(acme.ErrorRejectedIdentifierType, "not authorized").AddSubproblems(problems...)
+	}
+	return nil
+}
+
 // challengeTypes determines the types of challenges that should be used
 // for the ACME authorization request.
 func challengeTypes(az *acme.Authorization) []acme.ChallengeType {
@@ -496,6 +750,12 @@ func challengeTypes(az *acme.Authorization) []acme.ChallengeType {
 	case acme.IP:
 		chTypes = []acme.ChallengeType{acme.HTTP01, acme.TLSALPN01}
 	case acme.DNS:
+		// Onion names are not in the public DNS, they are validated with a CSR
+		// signed by the key of the onion service.
+		if acme.IsOnionName(az.Identifier.Value) {
+			chTypes = []acme.ChallengeType{acme.ONIONCSR01}
+			break
+		}
 		chTypes = []acme.ChallengeType{acme.DNS01}
 		// HTTP and TLS challenges can only be used for identifiers without wildcards.
 		if !az.Wildcard {
@@ -507,6 +767,8 @@ func challengeTypes(az *acme.Authorization) []acme.ChallengeType {
 		chTypes = []acme.ChallengeType{acme.WIREOIDC01}
 	case acme.WireDevice:
 		chTypes = []acme.ChallengeType{acme.WIREDPOP01}
+	case acme.Email:
+		chTypes = []acme.ChallengeType{acme.EMAILREPLY00}
 	default:
 		chTypes = []acme.ChallengeType{}
 	}
@@ -100,6 +100,26 @@ func TestNewOrderRequest_Validate(t *testing.T) {
 				err: acme.NewError(acme.ErrorMalformedType, "invalid IP address: %s", "192.168.42.1000"),
 			}
 		},
+		"fail/bad-identifier/ipv6-not-canonical": func(t *testing.T) test {
+			return test{
+				nor: &NewOrderRequest{
+					Identifiers: []acme.Identifier{
+						{Type: "ip", Value: "2001:0DB8:0:0::1"},
+					},
+				},
+				err: acme.NewError(acme.ErrorMalformedType, "IP address %s is not in canonical form, use %s", "2001:0DB8:0:0::1", "2001:db8::1"),
+			}
+		},
+		"fail/bad-identifier/ipv4-mapped-ipv6": func(t *testing.T) test {
+			return test{
+				nor: &NewOrderRequest{
+					Identifiers: []acme.Identifier{
+						{Type: "ip", Value: "::ffff:192.168.42.42"},
+					},
+				},
+				err: acme.NewError(acme.ErrorMalformedType, "IP address %s is not in canonical form, use %s", "::ffff:192.168.42.42", "192.168.42.42"),
+			}
+		},
 		"fail/bad-identifier/wireapp-invalid-uri": func(t *testing.T) test {
 			return test{
 				nor: &NewOrderRequest{
@@ -211,6 +231,69 @@ func TestNewOrderRequest_Validate(t *testing.T) {
 				naf: naf,
 			}
 		},
+		"fail/bad-identifier/bad-email": func(t *testing.T) test {
+			return test{
+				nor: &NewOrderRequest{
+					Identifiers: []acme.Identifier{
+						{Type: "email", Value: "Jane Doe <jane@example.com>"},
+					},
+				},
+				err: acme.NewError(acme.ErrorMalformedType, "invalid email address: Jane Doe <jane@example.com>"),
+			}
+		},
+		"fail/bad-identifier/mixed-email-and-dns": func(t *testing.T) test {
+			return test{
+				nor: &NewOrderRequest{
+					Identifiers: []acme.Identifier{
+						{Type: "email", Value: "jane@example.com"},
+						{Type: "dns", Value: "example.com"},
+					},
+				},
+				err: acme.NewError(acme.ErrorMalformedType, "email identifiers cannot be combined with other identifier types"),
+			}
+		},
+		"fail/bad-identifier/onion-v2": func(t *testing.T) test {
+			return test{
+				nor: &NewOrderRequest{
+					Identifiers: []acme.Identifier{
+						{Type: "dns", Value: "expyuzz4wqqyqhjn.onion"},
+					},
+				},
+				err: acme.NewError(acme.ErrorMalformedType, "invalid onion name: expyuzz4wqqyqhjn.onion"),
+			}
+		},
+		"ok/onion": func(t *testing.T) test {
+			nbf := time.Now().UTC().Add(time.Minute)
+			naf := time.Now().UTC().Add(5 * time.Minute)
+			return test{
+				nor: &NewOrderRequest{
+					Identifiers: []acme.Identifier{
+						{Type: "dns", Value: "2gzyxa5ihm7nsggfxnu52rck2vv4rvmdlkiu3zzui5du4xyclen53wid.onion"},
+						{Type: "dns", Value: "*.2gzyxa5ihm7nsggfxnu52rck2vv4rvmdlkiu3zzui5du4xyclen53wid.onion"},
+					},
+					NotAfter:  naf,
+					NotBefore: nbf,
+				},
+				nbf: nbf,
+				naf: naf,
+			}
+		},
+		"ok/email": func(t *testing.T) test {
+			nbf := time.Now().UTC().Add(time.Minute)
+			naf := time.Now().UTC().Add(5 * time.Minute)
+			return test{
+				nor: &NewOrderRequest{
+					Identifiers: []acme.Identifier{
+						{Type: "email", Value: "jane@example.com"},
+						{Type: "email", Value: "jane.doe@example.com"},
+					},
+					NotAfter:  naf,
+					NotBefore: nbf,
+				},
+				nbf: nbf,
+				naf: naf,
+			}
+		},
 		"ok/wireapp": func(t *testing.T) test {
 			nbf := time.Now().UTC().Add(time.Minute)
 			naf := time.Now().UTC().Add(5 * time.Minute)
@@ -1289,7 +1372,41 @@ MCowBQYDK2VwAyEA5c+4NKZSNQcR1T8qN6SjwgdPZQ0Ge12Ylx/YeGAJ35k=
 						}, nil
 					},
 				},
-				err: acme.NewError(acme.ErrorRejectedIdentifierType, "not authorized"),
+				err: acme.NewError(acme.ErrorRejectedIdentifierType, "not authorized").AddSubproblems(
+					acme.NewSubproblemWithIdentifier(acme.ErrorRejectedIdentifierType,
+						acme.Identifier{Type: "dns", Value: "zap.internal"}, "dns name \"zap.internal\" not allowed")),
+			}
+		},
+		"fail/multiple-rejected-identifiers": func(t *testing.T) test {
+			acc := &acme.Account{ID: "accID", Policy: &acme.Policy{
+				X509: acme.X509Policy{
+					Allowed: acme.PolicyNames{
+						DNSNames: []string{"*.local"},
+					},
+				},
+			}}
+			fr := &NewOrderRequest{
+				Identifiers: []acme.Identifier{
+					{Type: "dns", Value: "zap.internal"},
+					{Type: "dns", Value: "zap.local"},
+					{Type: "ip", Value: "10.0.0.1"},
+				},
+			}
+			b, err := json.Marshal(fr)
+			assert.FatalError(t, err)
+			ctx := acme.NewProvisionerContext(context.Background(), newACMEProv(t))
+			ctx = context.WithValue(ctx, accContextKey, acc)
+			ctx = context.WithValue(ctx, payloadContextKey, &payloadInfo{value: b})
+			return test{
+				ctx:        ctx,
+				statusCode: 400,
+				ca:         &mockCA{},
+				db:         &acme.MockDB{},
+				err: acme.NewError(acme.ErrorRejectedIdentifierType, "not authorized").AddSubproblems(
+					acme.NewSubproblemWithIdentifier(acme.ErrorRejectedIdentifierType,
+						acme.Identifier{Type: "dns", Value: "zap.internal"}, "dns name \"zap.internal\" not allowed"),
+					acme.NewSubproblemWithIdentifier(acme.ErrorRejectedIdentifierType,
+						acme.Identifier{Type: "ip", Value: "10.0.0.1"}, "ip name \"10.0.0.1\" not allowed")),
 			}
 		},
 		"fail/prov.AuthorizeOrderIdentifier-error": func(t *testing.T) test {
@@ -1332,7 +1449,293 @@ MCowBQYDK2VwAyEA5c+4NKZSNQcR1T8qN6SjwgdPZQ0Ge12Ylx/YeGAJ35k=
 						}, nil
 					},
 				},
-				err: acme.NewError(acme.ErrorRejectedIdentifierType, "not authorized"),
+				err: acme.NewError(acme.ErrorRejectedIdentifierType, "not authorized").AddSubproblems(
+					acme.NewSubproblemWithIdentifier(acme.ErrorRejectedIdentifierType,
+						acme.Identifier{Type: "dns", Value: "zap.internal"}, "dns name \"zap.internal\" not allowed")),
+			}
+		},
+		"fail/prov.AuthorizeOrderIdentifier-wildcard-policy": func(t *testing.T) test {
+			provWithPolicy := newACMEProvWithOptions(t, nil)
+			provWithPolicy.Wildcards = &provisioner.ACMEWildcardPolicy{
+				AllowedZones: []string{"internal"},
+			}
+			acc := &acme.Account{ID: "accID"}
+			fr := &NewOrderRequest{
+				Identifiers: []acme.Identifier{
+					{Type: "dns", Value: "*.zap.internal"},
+					{Type: "dns", Value: "*.zap.local"},
+					{Type: "dns", Value: "zap.local"},
+					{Type: "dns", Value: "*.zap.corp"},
+				},
+			}
+			b, err := json.Marshal(fr)
+			assert.FatalError(t, err)
+			ctx := acme.NewProvisionerContext(context.Background(), provWithPolicy)
+			ctx = context.WithValue(ctx, accContextKey, acc)
+			ctx = context.WithValue(ctx, payloadContextKey, &payloadInfo{value: b})
+			return test{
+				ctx:        ctx,
+				statusCode: 400,
+				ca:         &mockCA{},
+				db:         &acme.MockDB{},
+				err: acme.NewDetailedError(acme.ErrorRejectedIdentifierType,
+					"wildcard identifiers are not allowed by the provisioner policy").AddSubproblems(
+					acme.NewSubproblemWithIdentifier(acme.ErrorRejectedIdentifierType,
+						acme.Identifier{Type: "dns", Value: "*.zap.local"}, `zone "zap.local" is not in the allowed zones`),
+					acme.NewSubproblemWithIdentifier(acme.ErrorRejectedIdentifierType,
+						acme.Identifier{Type: "dns", Value: "*.zap.corp"}, `zone "zap.corp" is not in the allowed zones`),
+				),
+			}
+		},
+		"fail/prov.GetProfile-error": func(t *testing.T) test {
+			provWithProfiles := newACMEProvWithOptions(t, nil)
+			provWithProfiles.Profiles = []provisioner.ACMEProfile{{Name: "tlsserver"}}
+			acc := &acme.Account{ID: "accID"}
+			fr := &NewOrderRequest{
+				Identifiers: []acme.Identifier{
+					{Type: "dns", Value: "zap.internal"},
+				},
+				Profile: "tlsclient",
+			}
+			b, err := json.Marshal(fr)
+			assert.FatalError(t, err)
+			ctx := acme.NewProvisionerContext(context.Background(), provWithProfiles)
+			ctx = context.WithValue(ctx, accContextKey, acc)
+			ctx = context.WithValue(ctx, payloadContextKey, &payloadInfo{value: b})
+			return test{
+				ctx:        ctx,
+				statusCode: 400,
+				ca:         &mockCA{},
+				db:         &acme.MockDB{},
+				err:        acme.NewError(acme.ErrorInvalidProfileType, "invalid profile"),
+			}
+		},
+		"fail/profile-max-duration": func(t *testing.T) test {
+			provWithProfiles := newACMEProvWithOptions(t, nil)
+			provWithProfiles.Profiles = []provisioner.ACMEProfile{{
+				Name:               "shortlived",
+				MaxTLSCertDuration: &provisioner.Duration{Duration: time.Hour},
+			}}
+			acc := &acme.Account{ID: "accID"}
+			now := clock.Now()
+			fr := &NewOrderRequest{
+				Identifiers: []acme.Identifier{
+					{Type: "dns", Value: "zap.internal"},
+				},
+				NotBefore: now,
+				NotAfter:  now.Add(2 * time.Hour),
+				Profile:   "shortlived",
+			}
+			b, err := json.Marshal(fr)
+			assert.FatalError(t, err)
+			ctx := acme.NewProvisionerContext(context.Background(), provWithProfiles)
+			ctx = context.WithValue(ctx, accContextKey, acc)
+			ctx = context.WithValue(ctx, payloadContextKey, &payloadInfo{value: b})
+			return test{
+				ctx:        ctx,
+				statusCode: 400,
+				ca:         &mockCA{},
+				db:         &acme.MockDB{},
+				err: acme.NewError(acme.ErrorMalformedType,
+					"requested duration of 2h0m0s is more than the maximum of 1h0m0s allowed by the profile shortlived"),
+			}
+		},
+		"ok/default-profile": func(t *testing.T) test {
+			provWithProfiles := newACMEProvWithOptions(t, nil)
+			provWithProfiles.Profiles = []provisioner.ACMEProfile{
+				{Name: "tlsserver"},
+				{Name: "shortlived", DefaultTLSCertDuration: &provisioner.Duration{Duration: time.Hour}},
+			}
+			provWithProfiles.DefaultProfile = "shortlived"
+			acc := &acme.Account{ID: "accID"}
+			nor := &NewOrderRequest{
+				Identifiers: []acme.Identifier{
+					{Type: "dns", Value: "zap.internal"},
+				},
+			}
+			b, err := json.Marshal(nor)
+			assert.FatalError(t, err)
+			ctx := acme.NewProvisionerContext(context.Background(), provWithProfiles)
+			ctx = context.WithValue(ctx, accContextKey, acc)
+			ctx = context.WithValue(ctx, payloadContextKey, &payloadInfo{value: b})
+			return test{
+				ctx:        ctx,
+				statusCode: 201,
+				nor:        nor,
+				ca:         &mockCA{},
+				db: &acme.MockDB{
+					MockCreateChallenge: func(ctx context.Context, ch *acme.Challenge) error {
+						ch.ID = string(ch.Type)
+						return nil
+					},
+					MockCreateAuthorization: func(ctx context.Context, az *acme.Authorization) error {
+						az.ID = "az1ID"
+						return nil
+					},
+					MockCreateOrder: func(ctx context.Context, o *acme.Order) error {
+						o.ID = "ordID"
+						assert.Equals(t, o.Profile, "shortlived")
+						return nil
+					},
+				},
+				vr: func(t *testing.T, o *acme.Order) {
+					testBufferDur := 5 * time.Second
+					expNaf := clock.Now().Add(time.Hour)
+
+					assert.Equals(t, o.Profile, "shortlived")
+					assert.True(t, o.NotAfter.Add(-testBufferDur).Before(expNaf))
+					assert.True(t, o.NotAfter.Add(testBufferDur).After(expNaf))
+				},
+			}
+		},
+		"ok/pre-authorized": func(t *testing.T) test {
+			provWithPreAuthz := newACMEProvWithOptions(t, nil)
+			provWithPreAuthz.EnablePreAuthorization = true
+			acc := &acme.Account{ID: "accID"}
+			nor := &NewOrderRequest{
+				Identifiers: []acme.Identifier{
+					{Type: "dns", Value: "zap.internal"},
+					{Type: "dns", Value: "*.zap.internal"},
+				},
+			}
+			b, err := json.Marshal(nor)
+			assert.FatalError(t, err)
+			ctx := acme.NewProvisionerContext(context.Background(), provWithPreAuthz)
+			ctx = context.WithValue(ctx, accContextKey, acc)
+			ctx = context.WithValue(ctx, payloadContextKey, &payloadInfo{value: b})
+			return test{
+				ctx:        ctx,
+				statusCode: 201,
+				nor:        nor,
+				ca:         &mockCA{},
+				db: &acme.MockDB{
+					MockGetAuthorizationsByAccountID: func(ctx context.Context, accountID string) ([]*acme.Authorization, error) {
+						assert.Equals(t, "accID", accountID)
+						return []*acme.Authorization{
+							{ID: "preID", Identifier: acme.Identifier{Type: "dns", Value: "zap.internal"}, Status: acme.StatusValid, ExpiresAt: clock.Now().Add(time.Hour)},
+							{ID: "wildcardID", Identifier: acme.Identifier{Type: "dns", Value: "zap.internal"}, Wildcard: true, Status: acme.StatusValid, ExpiresAt: clock.Now().Add(time.Hour)},
+						}, nil
+					},
+					MockGetAuthorization: func(ctx context.Context, id string) (*acme.Authorization, error) {
+						assert.Equals(t, "preID", id)
+						return &acme.Authorization{ID: id, Challenges: []*acme.Challenge{{Type: acme.DNS01, Status: acme.StatusValid}}}, nil
+					},
+					MockCreateChallenge: func(ctx context.Context, ch *acme.Challenge) error {
+						ch.ID = string(ch.Type)
+						return nil
+					},
+					MockCreateAuthorization: func(ctx context.Context, az *acme.Authorization) error {
+						az.ID = "az2ID"
+						assert.Equals(t, az.Identifier, acme.Identifier{Type: "dns", Value: "zap.internal"})
+						assert.Equals(t, az.Wildcard, true)
+						return nil
+					},
+					MockCreateOrder: func(ctx context.Context, o *acme.Order) error {
+						o.ID = "ordID"
+						assert.Equals(t, o.Status, acme.StatusPending)
+						assert.Equals(t, o.AuthorizationIDs, []string{"preID", "az2ID"})
+						return nil
+					},
+				},
+				vr: func(t *testing.T, o *acme.Order) {
+					assert.Equals(t, o.Status, acme.StatusPending)
+					assert.Equals(t, o.AuthorizationURLs, []string{
+						fmt.Sprintf("%s/acme/%s/authz/preID", baseURL.String(), escProvName),
+						fmt.Sprintf("%s/acme/%s/authz/az2ID", baseURL.String(), escProvName),
+					})
+				},
+			}
+		},
+		"ok/pre-authorized-ready": func(t *testing.T) test {
+			provWithPreAuthz := newACMEProvWithOptions(t, nil)
+			provWithPreAuthz.EnablePreAuthorization = true
+			acc := &acme.Account{ID: "accID"}
+			nor := &NewOrderRequest{
+				Identifiers: []acme.Identifier{
+					{Type: "dns", Value: "zap.internal"},
+				},
+			}
+			b, err := json.Marshal(nor)
+			assert.FatalError(t, err)
+			ctx := acme.NewProvisionerContext(context.Background(), provWithPreAuthz)
+			ctx = context.WithValue(ctx, accContextKey, acc)
+			ctx = context.WithValue(ctx, payloadContextKey, &payloadInfo{value: b})
+			return test{
+				ctx:        ctx,
+				statusCode: 201,
+				nor:        nor,
+				ca:         &mockCA{},
+				db: &acme.MockDB{
+					MockGetAuthorizationsByAccountID: func(ctx context.Context, accountID string) ([]*acme.Authorization, error) {
+						return []*acme.Authorization{
+							{ID: "preID", Identifier: acme.Identifier{Type: "dns", Value: "zap.internal"}, Status: acme.StatusValid, ExpiresAt: clock.Now().Add(time.Hour)},
+						}, nil
+					},
+					MockGetAuthorization: func(ctx context.Context, id string) (*acme.Authorization, error) {
+						return &acme.Authorization{ID: id, Challenges: []*acme.Challenge{{Type: acme.HTTP01, Status: acme.StatusValid}}}, nil
+					},
+					MockCreateOrder: func(ctx context.Context, o *acme.Order) error {
+						o.ID = "ordID"
+						assert.Equals(t, o.Status, acme.StatusReady)
+						assert.Equals(t, o.AuthorizationIDs, []string{"preID"})
+						return nil
+					},
+				},
+				vr: func(t *testing.T, o *acme.Order) {
+					assert.Equals(t, o.Status, acme.StatusReady)
+				},
+			}
+		},
+		"ok/pre-authorized-challenge-disabled": func(t *testing.T) test {
+			// The authorization was validated with http-01, which has been
+			// disabled in the provisioner since then.
+			provWithPreAuthz := newACMEProvWithOptions(t, nil)
+			provWithPreAuthz.EnablePreAuthorization = true
+			provWithPreAuthz.Challenges = []provisioner.ACMEChallenge{provisioner.DNS_01}
+			acc := &acme.Account{ID: "accID"}
+			nor := &NewOrderRequest{
+				Identifiers: []acme.Identifier{
+					{Type: "dns", Value: "zap.internal"},
+				},
+			}
+			b, err := json.Marshal(nor)
+			assert.FatalError(t, err)
+			ctx := acme.NewProvisionerContext(context.Background(), provWithPreAuthz)
+			ctx = context.WithValue(ctx, accContextKey, acc)
+			ctx = context.WithValue(ctx, payloadContextKey, &payloadInfo{value: b})
+			return test{
+				ctx:        ctx,
+				statusCode: 201,
+				nor:        nor,
+				ca:         &mockCA{},
+				db: &acme.MockDB{
+					MockGetAuthorizationsByAccountID: func(ctx context.Context, accountID string) ([]*acme.Authorization, error) {
+						return []*acme.Authorization{
+							{ID: "preID", Identifier: acme.Identifier{Type: "dns", Value: "zap.internal"}, Status: acme.StatusValid, ExpiresAt: clock.Now().Add(time.Hour)},
+						}, nil
+					},
+					MockGetAuthorization: func(ctx context.Context, id string) (*acme.Authorization, error) {
+						return &acme.Authorization{ID: id, Challenges: []*acme.Challenge{{Type: acme.HTTP01, Status: acme.StatusValid}}}, nil
+					},
+					MockCreateChallenge: func(ctx context.Context, ch *acme.Challenge) error {
+						assert.Equals(t, ch.Type, acme.DNS01)
+						ch.ID = string(ch.Type)
+						return nil
+					},
+					MockCreateAuthorization: func(ctx context.Context, az *acme.Authorization) error {
+						az.ID = "az1ID"
+						return nil
+					},
+					MockCreateOrder: func(ctx context.Context, o *acme.Order) error {
+						o.ID = "ordID"
+						assert.Equals(t, o.Status, acme.StatusPending)
+						assert.Equals(t, o.AuthorizationIDs, []string{"az1ID"})
+						return nil
+					},
+				},
+				vr: func(t *testing.T, o *acme.Order) {
+					assert.Equals(t, o.Status, acme.StatusPending)
+				},
 			}
 		},
 		"fail/ca.AreSANsAllowed-error": func(t *testing.T) test {
@@ -1379,7 +1782,9 @@ MCowBQYDK2VwAyEA5c+4NKZSNQcR1T8qN6SjwgdPZQ0Ge12Ylx/YeGAJ35k=
 						}, nil
 					},
 				},
-				err: acme.NewError(acme.ErrorRejectedIdentifierType, "not authorized"),
+				err: acme.NewError(acme.ErrorRejectedIdentifierType, "not authorized").AddSubproblems(
+					acme.NewSubproblemWithIdentifier(acme.ErrorRejectedIdentifierType,
+						acme.Identifier{Type: "dns", Value: "zap.internal"}, "force: not authorized by authority")),
 			}
 		},
 		"fail/error-h.newAuthorization": func(t *testing.T) test {
@@ -1416,6 +1821,34 @@ MCowBQYDK2VwAyEA5c+4NKZSNQcR1T8qN6SjwgdPZQ0Ge12Ylx/YeGAJ35k=
 				err: acme.NewErrorISE("error creating challenge: force"),
 			}
 		},
+		"fail/rate-limited": func(t *testing.T) test {
+			rateLimitedProv := newACMEProv(t)
+			rateLimitedProv.RateLimits = &provisioner.ACMERateLimits{
+				ACMERateLimit: provisioner.ACMERateLimit{OrdersPerHour: 1},
+			}
+			acc := &acme.Account{ID: "accID"}
+			fr := &NewOrderRequest{
+				Identifiers: []acme.Identifier{
+					{Type: "dns", Value: "zap.internal"},
+				},
+			}
+			b, err := json.Marshal(fr)
+			assert.FatalError(t, err)
+			store := acme.NewMemoryRateLimitStore()
+			_, err = store.IncrementRateLimitCounter(context.Background(), "orders/"+rateLimitedProv.GetID()+"/accID", time.Hour)
+			assert.FatalError(t, err)
+			ctx := acme.NewProvisionerContext(context.Background(), rateLimitedProv)
+			ctx = acme.NewRateLimitStoreContext(ctx, store)
+			ctx = context.WithValue(ctx, accContextKey, acc)
+			ctx = context.WithValue(ctx, payloadContextKey, &payloadInfo{value: b})
+			return test{
+				ctx:        ctx,
+				statusCode: 429,
+				ca:         &mockCA{},
+				db:         &acme.MockDB{},
+				err:        acme.NewError(acme.ErrorRateLimitedType, "account accID has exceeded its limit of 1 orders per hour"),
+			}
+		},
 		"fail/error-db.CreateOrder": func(t *testing.T) test {
 			acc := &acme.Account{ID: "accID"}
 			fr := &NewOrderRequest{
@@ -2608,6 +3041,26 @@ func TestHandler_challengeTypes(t *testing.T) {
 			},
 			want: []acme.ChallengeType{acme.HTTP01, acme.TLSALPN01},
 		},
+		{
+			name: "ok/email",
+			args: args{
+				az: &acme.Authorization{
+					Identifier: acme.Identifier{Type: "email", Value: "jane@example.com"},
+					Wildcard:   false,
+				},
+			},
+			want: []acme.ChallengeType{acme.EMAILREPLY00},
+		},
+		{
+			name: "ok/onion",
+			args: args{
+				az: &acme.Authorization{
+					Identifier: acme.Identifier{Type: "dns", Value: "2gzyxa5ihm7nsggfxnu52rck2vv4rvmdlkiu3zzui5du4xyclen53wid.onion"},
+					Wildcard:   false,
+				},
+			},
+			want: []acme.ChallengeType{acme.ONIONCSR01},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -2646,3 +3099,189 @@ func TestTrimIfWildcard(t *testing.T) {
 		})
 	}
 }
+
+func Test_validAuthorizationsByAccountID(t *testing.T) {
+	now := clock.Now()
+	prov := newACMEProv(t)
+	dnsProv := newACMEProv(t)
+	dnsProv.Challenges = []provisioner.ACMEChallenge{provisioner.DNS_01}
+	deniedProv := newACMEProvWithOptions(t, &provisioner.Options{
+		X509: &provisioner.X509Options{
+			DeniedNames: &policy.X509NameOptions{
+				DNSDomains: []string{"denied.internal"},
+			},
+		},
+	})
+
+	azs := []*acme.Authorization{
+		{ID: "validID", Identifier: acme.Identifier{Type: "dns", Value: "valid.internal"}, Status: acme.StatusValid, ExpiresAt: now.Add(time.Hour)},
+		{ID: "deniedID", Identifier: acme.Identifier{Type: "dns", Value: "denied.internal"}, Status: acme.StatusValid, ExpiresAt: now.Add(time.Hour)},
+		{ID: "pendingID", Identifier: acme.Identifier{Type: "dns", Value: "pending.internal"}, Status: acme.StatusPending, ExpiresAt: now.Add(time.Hour)},
+		{ID: "expiredID", Identifier: acme.Identifier{Type: "dns", Value: "expired.internal"}, Status: acme.StatusValid, ExpiresAt: now.Add(-time.Minute)},
+		{ID: "wildcardID", Identifier: acme.Identifier{Type: "dns", Value: "wildcard.internal"}, Wildcard: true, Status: acme.StatusValid, ExpiresAt: now.Add(time.Hour)},
+	}
+	newDB := func(getErr error) *acme.MockDB {
+		return &acme.MockDB{
+			MockGetAuthorizationsByAccountID: func(ctx context.Context, accountID string) ([]*acme.Authorization, error) {
+				assert.Equals(t, "accID", accountID)
+				return azs, nil
+			},
+			MockGetAuthorization: func(ctx context.Context, id string) (*acme.Authorization, error) {
+				if getErr != nil {
+					return nil, getErr
+				}
+				return &acme.Authorization{ID: id, Challenges: []*acme.Challenge{
+					{Type: acme.DNS01, Status: acme.StatusPending},
+					{Type: acme.HTTP01, Status: acme.StatusValid},
+				}}, nil
+			},
+		}
+	}
+
+	tests := []struct {
+		name    string
+		db      acme.DB
+		prov    acme.Provisioner
+		want    []string
+		wantErr bool
+	}{
+		{"ok", newDB(nil), prov, []string{"validID", "deniedID"}, false},
+		{"ok/provisioner-policy", newDB(nil), deniedProv, []string{"validID"}, false},
+		{"ok/challenge-disabled", newDB(nil), dnsProv, []string{}, false},
+		{"fail/db.GetAuthorization", newDB(errors.New("force")), prov, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := validAuthorizationsByAccountID(context.Background(), tt.db, tt.prov, "accID", now)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.FatalError(t, err)
+			ids := []string{}
+			for _, az := range azs {
+				if got[az.Identifier] != nil {
+					ids = append(ids, got[az.Identifier].ID)
+				}
+			}
+			assert.Equals(t, tt.want, ids)
+		})
+	}
+}
+
+func Test_newACMEPolicyEngine(t *testing.T) {
+	accPolicy := &acme.Policy{
+		X509: acme.X509Policy{
+			Allowed: acme.PolicyNames{DNSNames: []string{"*.team.internal"}},
+		},
+	}
+	eakPolicy := &acme.Policy{
+		X509: acme.X509Policy{
+			Denied: acme.PolicyNames{DNSNames: []string{"db.team.internal"}},
+		},
+	}
+
+	acmePolicy, err := newACMEPolicyEngine(&acme.Account{}, nil)
+	require.NoError(t, err)
+	sassert.Empty(t, acmePolicy)
+	sassert.NoError(t, isIdentifierAllowed(acmePolicy, acme.Identifier{Type: "dns", Value: "www.example.com"}))
+
+	acmePolicy, err = newACMEPolicyEngine(&acme.Account{Policy: accPolicy}, &acme.ExternalAccountKey{Policy: eakPolicy})
+	require.NoError(t, err)
+	sassert.Len(t, acmePolicy, 2)
+	sassert.NoError(t, isIdentifierAllowed(acmePolicy, acme.Identifier{Type: "dns", Value: "www.team.internal"}))
+	sassert.Error(t, isIdentifierAllowed(acmePolicy, acme.Identifier{Type: "dns", Value: "www.other.internal"}))
+	sassert.Error(t, isIdentifierAllowed(acmePolicy, acme.Identifier{Type: "dns", Value: "db.team.internal"}))
+
+	_, err = newACMEPolicyEngine(&acme.Account{Policy: &acme.Policy{
+		X509: acme.X509Policy{
+			Allowed: acme.PolicyNames{DNSNames: []string{"**.local"}},
+		},
+	}}, nil)
+	sassert.Error(t, err)
+}
+
+func Test_isCSRAllowedByAccountPolicy(t *testing.T) {
+	prov := newACMEProv(t)
+	eabProv := newACMEProv(t)
+	eabProv.RequireEAB = true
+	uriPolicy := &acme.Policy{
+		X509: acme.X509Policy{
+			Allowed: acme.PolicyNames{
+				DNSNames:   []string{"*.team.internal"},
+				URIDomains: []string{"*.team.internal"},
+			},
+		},
+	}
+	u, err := url.Parse("spiffe://svc.team.internal/api")
+	require.NoError(t, err)
+	otherURI, err := url.Parse("spiffe://svc.other.internal/api")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		prov     acme.Provisioner
+		acc      *acme.Account
+		db       acme.DB
+		csr      *x509.CertificateRequest
+		wantType acme.ProblemType
+		wantErr  bool
+	}{
+		{"ok/no-policy", prov, &acme.Account{ID: "accID"}, &acme.MockDB{}, &x509.CertificateRequest{
+			DNSNames: []string{"www.example.com"},
+		}, 0, false},
+		{"ok/account-policy", prov, &acme.Account{ID: "accID", Policy: uriPolicy}, &acme.MockDB{}, &x509.CertificateRequest{
+			DNSNames: []string{"www.team.internal"},
+			URIs:     []*url.URL{u},
+		}, 0, false},
+		{"fail/account-policy-dns", prov, &acme.Account{ID: "accID", Policy: uriPolicy}, &acme.MockDB{}, &x509.CertificateRequest{
+			DNSNames: []string{"www.other.internal"},
+		}, acme.ErrorRejectedIdentifierType, true},
+		{"fail/account-policy-uri", prov, &acme.Account{ID: "accID", Policy: uriPolicy}, &acme.MockDB{}, &x509.CertificateRequest{
+			DNSNames: []string{"www.team.internal"},
+			URIs:     []*url.URL{otherURI},
+		}, acme.ErrorRejectedIdentifierType, true},
+		{"fail/eak-policy", eabProv, &acme.Account{ID: "accID"}, &acme.MockDB{
+			MockGetExternalAccountKeyByAccountID: func(ctx context.Context, provisionerID, accountID string) (*acme.ExternalAccountKey, error) {
+				sassert.Equal(t, "accID", accountID)
+				return &acme.ExternalAccountKey{Policy: uriPolicy}, nil
+			},
+		}, &x509.CertificateRequest{
+			DNSNames: []string{"www.other.internal"},
+		}, acme.ErrorRejectedIdentifierType, true},
+		{"fail/db.GetExternalAccountKeyByAccountID", eabProv, &acme.Account{ID: "accID"}, &acme.MockDB{
+			MockGetExternalAccountKeyByAccountID: func(ctx context.Context, provisionerID, accountID string) (*acme.ExternalAccountKey, error) {
+				return nil, errors.New("force")
+			},
+		}, &x509.CertificateRequest{
+			DNSNames: []string{"www.team.internal"},
+		}, acme.ErrorServerInternalType, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := acme.NewProvisionerContext(context.Background(), tt.prov)
+			err := isCSRAllowedByAccountPolicy(ctx, tt.db, tt.acc, tt.csr)
+			if !tt.wantErr {
+				sassert.NoError(t, err)
+				return
+			}
+			var ae *acme.Error
+			require.ErrorAs(t, err, &ae)
+			sassert.Equal(t, acme.NewError(tt.wantType, "").Type, ae.Type)
+		})
+	}
+
+	// All the rejected names are reported as subproblems.
+	ctx := acme.NewProvisionerContext(context.Background(), prov)
+	err = isCSRAllowedByAccountPolicy(ctx, &acme.MockDB{}, &acme.Account{ID: "accID", Policy: uriPolicy}, &x509.CertificateRequest{
+		DNSNames: []string{"www.team.internal", "www.other.internal"},
+		URIs:     []*url.URL{otherURI},
+	})
+	var ae *acme.Error
+	require.ErrorAs(t, err, &ae)
+	sassert.Equal(t, []acme.Subproblem{
+		acme.NewSubproblemWithIdentifier(acme.ErrorRejectedIdentifierType,
+			acme.Identifier{Type: "dns", Value: "www.other.internal"}, `dns name "www.other.internal" not allowed`),
+		acme.NewSubproblem(acme.ErrorRejectedIdentifierType, `uri name "spiffe://svc.other.internal/api" not allowed`),
+	}, ae.Subproblems)
+}
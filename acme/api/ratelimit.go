@@ -0,0 +1,146 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/smallstep/certificates/acme"
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+const (
+	// ordersRateLimitWindow is the window of the ordersPerHour limit.
+	ordersRateLimitWindow = time.Hour
+	// failedValidationsRateLimitWindow is the window of the
+	// failedValidationsPerHour limit.
+	failedValidationsRateLimitWindow = time.Hour
+	// duplicateCertificatesRateLimitWindow is the window of the
+	// duplicateCertificatesPerWeek limit.
+	duplicateCertificatesRateLimitWindow = 7 * 24 * time.Hour
+)
+
+// accountRateLimit returns the rate limits that apply to the given account,
+// or nil if the provisioner does not define them.
+func accountRateLimit(p *provisioner.ACME, acc *acme.Account) *provisioner.ACMERateLimit {
+	return p.RateLimits.GetLimit(acc.RateLimitTier)
+}
+
+// rateLimitedError returns the rateLimited error sent when the counter has
+// reached a limit.
+func rateLimitedError(c *acme.RateLimitCounter, format string, args ...any) *acme.Error {
+	err := acme.NewError(acme.ErrorRateLimitedType, format, args...)
+	err.Status = http.StatusTooManyRequests
+	err.RetryAfter = time.Until(c.ResetAt)
+	return err
+}
+
+// checkOrdersRateLimit counts a new order of the given account and returns a
+// rateLimited error if the ordersPerHour limit has been exceeded.
+func checkOrdersRateLimit(ctx context.Context, p *provisioner.ACME, acc *acme.Account) error {
+	l := accountRateLimit(p, acc)
+	if l == nil || l.OrdersPerHour == 0 {
+		return nil
+	}
+	c, err := acme.RateLimitStoreFromContext(ctx).IncrementRateLimitCounter(ctx,
+		"orders/"+p.GetID()+"/"+acc.ID, ordersRateLimitWindow)
+	if err != nil {
+		return acme.WrapErrorISE(err, "error updating rate limit counter")
+	}
+	if c.Count > int64(l.OrdersPerHour) {
+		return rateLimitedError(c, "account %s has exceeded its limit of %d orders per hour", acc.ID, l.OrdersPerHour)
+	}
+	return nil
+}
+
+// failedValidationsKey returns the key of the failedValidationsPerHour
+// counter of an account.
+func failedValidationsKey(p *provisioner.ACME, acc *acme.Account) string {
+	return "failedValidations/" + p.GetID() + "/" + acc.ID
+}
+
+// checkFailedValidationsRateLimit returns a rateLimited error if the challenge
+// validations of the given account have failed too many times in the current
+// window.
+func checkFailedValidationsRateLimit(ctx context.Context, p *provisioner.ACME, acc *acme.Account) error {
+	l := accountRateLimit(p, acc)
+	if l == nil || l.FailedValidationsPerHour == 0 {
+		return nil
+	}
+	c, err := acme.RateLimitStoreFromContext(ctx).GetRateLimitCounter(ctx, failedValidationsKey(p, acc))
+	switch {
+	case acme.IsErrNotFound(err):
+		return nil
+	case err != nil:
+		return acme.WrapErrorISE(err, "error retrieving rate limit counter")
+	}
+	if c.Current(time.Now()) >= int64(l.FailedValidationsPerHour) {
+		return rateLimitedError(c, "account %s has exceeded its limit of %d failed validations per hour", acc.ID, l.FailedValidationsPerHour)
+	}
+	return nil
+}
+
+// countFailedValidation adds a failed challenge validation to the counter of
+// the given account.
+func countFailedValidation(ctx context.Context, p *provisioner.ACME, acc *acme.Account) error {
+	l := accountRateLimit(p, acc)
+	if l == nil || l.FailedValidationsPerHour == 0 {
+		return nil
+	}
+	if _, err := acme.RateLimitStoreFromContext(ctx).IncrementRateLimitCounter(ctx,
+		failedValidationsKey(p, acc), failedValidationsRateLimitWindow); err != nil {
+		return acme.WrapErrorISE(err, "error updating rate limit counter")
+	}
+	return nil
+}
+
+// duplicateCertificatesKey returns the key of the
+// duplicateCertificatesPerWeek counter of the set of identifiers in an order.
+func duplicateCertificatesKey(p *provisioner.ACME, o *acme.Order) string {
+	values := make([]string, len(o.Identifiers))
+	for i, id := range o.Identifiers {
+		values[i] = string(id.Type) + ":" + strings.ToLower(id.Value)
+	}
+	sort.Strings(values)
+	sum := sha256.Sum256([]byte(strings.Join(values, ",")))
+	return "duplicateCertificates/" + p.GetID() + "/" + hex.EncodeToString(sum[:])
+}
+
+// checkDuplicateCertificatesRateLimit returns a rateLimited error if too many
+// certificates with the identifiers of the given order have been issued in
+// the current window.
+func checkDuplicateCertificatesRateLimit(ctx context.Context, p *provisioner.ACME, acc *acme.Account, o *acme.Order) error {
+	l := accountRateLimit(p, acc)
+	if l == nil || l.DuplicateCertificatesPerWeek == 0 {
+		return nil
+	}
+	c, err := acme.RateLimitStoreFromContext(ctx).GetRateLimitCounter(ctx, duplicateCertificatesKey(p, o))
+	switch {
+	case acme.IsErrNotFound(err):
+		return nil
+	case err != nil:
+		return acme.WrapErrorISE(err, "error retrieving rate limit counter")
+	}
+	if c.Current(time.Now()) >= int64(l.DuplicateCertificatesPerWeek) {
+		return rateLimitedError(c, "order %s has exceeded the limit of %d duplicate certificates per week", o.ID, l.DuplicateCertificatesPerWeek)
+	}
+	return nil
+}
+
+// countDuplicateCertificate adds a certificate issued for the identifiers of
+// the given order to the duplicateCertificatesPerWeek counter.
+func countDuplicateCertificate(ctx context.Context, p *provisioner.ACME, acc *acme.Account, o *acme.Order) error {
+	l := accountRateLimit(p, acc)
+	if l == nil || l.DuplicateCertificatesPerWeek == 0 {
+		return nil
+	}
+	if _, err := acme.RateLimitStoreFromContext(ctx).IncrementRateLimitCounter(ctx,
+		duplicateCertificatesKey(p, o), duplicateCertificatesRateLimitWindow); err != nil {
+		return acme.WrapErrorISE(err, "error updating rate limit counter")
+	}
+	return nil
+}
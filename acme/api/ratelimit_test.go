@@ -0,0 +1,106 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/smallstep/certificates/acme"
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+func newRateLimitedACMEProv(t *testing.T) *provisioner.ACME {
+	t.Helper()
+	p := newACMEProv(t)
+	p.RateLimits = &provisioner.ACMERateLimits{
+		ACMERateLimit: provisioner.ACMERateLimit{
+			OrdersPerHour:                2,
+			DuplicateCertificatesPerWeek: 1,
+			FailedValidationsPerHour:     1,
+		},
+		Tiers: map[string]provisioner.ACMERateLimit{
+			"unlimited": {},
+		},
+	}
+	return p
+}
+
+func assertRateLimited(t *testing.T, err error) {
+	t.Helper()
+	var ae *acme.Error
+	require.ErrorAs(t, err, &ae)
+	assert.Equal(t, acme.NewError(acme.ErrorRateLimitedType, "").Type, ae.Type)
+	assert.Equal(t, http.StatusTooManyRequests, ae.Status)
+	assert.Greater(t, ae.RetryAfter, time.Duration(0))
+}
+
+func Test_checkOrdersRateLimit(t *testing.T) {
+	p := newRateLimitedACMEProv(t)
+	ctx := acme.NewRateLimitStoreContext(context.Background(), acme.NewMemoryRateLimitStore())
+	acc := &acme.Account{ID: "accID"}
+
+	assert.NoError(t, checkOrdersRateLimit(ctx, p, acc))
+	assert.NoError(t, checkOrdersRateLimit(ctx, p, acc))
+	assertRateLimited(t, checkOrdersRateLimit(ctx, p, acc))
+
+	// Other accounts are not affected.
+	assert.NoError(t, checkOrdersRateLimit(ctx, p, &acme.Account{ID: "otherID"}))
+
+	// Accounts in a tier use its limits.
+	acc.RateLimitTier = "unlimited"
+	assert.NoError(t, checkOrdersRateLimit(ctx, p, acc))
+
+	// Provisioners without rate limits.
+	assert.NoError(t, checkOrdersRateLimit(ctx, newACMEProv(t), &acme.Account{ID: "accID"}))
+}
+
+func Test_failedValidationsRateLimit(t *testing.T) {
+	p := newRateLimitedACMEProv(t)
+	ctx := acme.NewRateLimitStoreContext(context.Background(), acme.NewMemoryRateLimitStore())
+	acc := &acme.Account{ID: "accID"}
+
+	assert.NoError(t, checkFailedValidationsRateLimit(ctx, p, acc))
+	require.NoError(t, countFailedValidation(ctx, p, acc))
+	assertRateLimited(t, checkFailedValidationsRateLimit(ctx, p, acc))
+	assert.NoError(t, checkFailedValidationsRateLimit(ctx, p, &acme.Account{ID: "otherID"}))
+
+	acc.RateLimitTier = "unlimited"
+	assert.NoError(t, countFailedValidation(ctx, p, acc))
+	assert.NoError(t, checkFailedValidationsRateLimit(ctx, p, acc))
+}
+
+func Test_duplicateCertificatesRateLimit(t *testing.T) {
+	p := newRateLimitedACMEProv(t)
+	ctx := acme.NewRateLimitStoreContext(context.Background(), acme.NewMemoryRateLimitStore())
+	acc := &acme.Account{ID: "accID"}
+	o := &acme.Order{ID: "ordID", Identifiers: []acme.Identifier{
+		{Type: "dns", Value: "foo.internal"},
+		{Type: "dns", Value: "bar.internal"},
+	}}
+
+	assert.NoError(t, checkDuplicateCertificatesRateLimit(ctx, p, acc, o))
+	require.NoError(t, countDuplicateCertificate(ctx, p, acc, o))
+	assertRateLimited(t, checkDuplicateCertificatesRateLimit(ctx, p, acc, o))
+
+	// The same identifiers in a different order and case, from another
+	// account.
+	dup := &acme.Order{ID: "dupID", Identifiers: []acme.Identifier{
+		{Type: "dns", Value: "BAR.internal"},
+		{Type: "dns", Value: "foo.internal"},
+	}}
+	assertRateLimited(t, checkDuplicateCertificatesRateLimit(ctx, p, &acme.Account{ID: "otherID"}, dup))
+
+	// A different set of identifiers.
+	other := &acme.Order{ID: "otherID", Identifiers: []acme.Identifier{
+		{Type: "dns", Value: "foo.internal"},
+	}}
+	assert.NoError(t, checkDuplicateCertificatesRateLimit(ctx, p, acc, other))
+
+	// Accounts in a tier use its limits.
+	acc.RateLimitTier = "unlimited"
+	assert.NoError(t, checkDuplicateCertificatesRateLimit(ctx, p, acc, o))
+}
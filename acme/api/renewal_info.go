@@ -0,0 +1,83 @@
+package api
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/smallstep/certificates/acme"
+	"github.com/smallstep/certificates/api/render"
+)
+
+// GetRenewalInfo is the ACME resource returning the suggested renewal window of
+// a certificate, as defined in RFC 9773. The window is in the past if the
+// certificate is revoked or if the provisioner requests its early renewal.
+func GetRenewalInfo(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	db := acme.MustDatabaseFromContext(ctx)
+
+	acmeProv, err := acmeProvisionerFromContext(ctx)
+	if err != nil {
+		render.Error(w, r, err)
+		return
+	}
+
+	certID := chi.URLParam(r, "certID")
+	aki, serialNumber, err := acme.ParseRenewalInfoCertID(certID)
+	if err != nil {
+		render.Error(w, r, acme.WrapError(acme.ErrorMalformedType, err, "error parsing certificate identifier"))
+		return
+	}
+
+	serial := serialNumber.String()
+	cert, err := db.GetCertificateBySerial(ctx, serial)
+	if err != nil {
+		var ae *acme.Error
+		if errors.As(err, &ae) && ae.Status < http.StatusInternalServerError {
+			render.Error(w, r, renewalInfoNotFound(certID))
+			return
+		}
+		render.Error(w, r, acme.WrapErrorISE(err, "error retrieving certificate by serial"))
+		return
+	}
+	if !bytes.Equal(cert.Leaf.AuthorityKeyId, aki) {
+		render.Error(w, r, renewalInfoNotFound(certID))
+		return
+	}
+
+	// Only the provisioner that issued the certificate can return its renewal
+	// information.
+	o, err := db.GetOrder(ctx, cert.OrderID)
+	if err != nil {
+		render.Error(w, r, acme.WrapErrorISE(err, "error retrieving order"))
+		return
+	}
+	if o.ProvisionerID != acmeProv.GetID() {
+		render.Error(w, r, renewalInfoNotFound(certID))
+		return
+	}
+
+	revoked, err := mustAuthority(ctx).IsRevoked(serial)
+	if err != nil {
+		render.Error(w, r, acme.WrapErrorISE(err, "error checking revocation status"))
+		return
+	}
+
+	forceRenewal := revoked || acmeProv.RenewalInfo.ShouldRenew(cert.Leaf)
+	info := acme.NewRenewalInfo(cert.Leaf, clock.Now(), forceRenewal)
+	if forceRenewal {
+		info.ExplanationURL = acmeProv.RenewalInfo.GetExplanationURL()
+	}
+
+	w.Header().Set("Retry-After", strconv.Itoa(int(acmeProv.RenewalInfo.GetRetryAfter().Seconds())))
+	render.JSON(w, r, info)
+}
+
+func renewalInfoNotFound(certID string) *acme.Error {
+	err := acme.NewError(acme.ErrorMalformedType, "certificate %s not found", certID)
+	err.Status = http.StatusNotFound
+	return err
+}
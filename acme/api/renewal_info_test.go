@@ -0,0 +1,131 @@
+package api
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/smallstep/certificates/acme"
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+func TestGetRenewalInfo(t *testing.T) {
+	now := clock.Now()
+	leaf := &x509.Certificate{
+		SerialNumber:   big.NewInt(0x0087654321),
+		AuthorityKeyId: []byte{1, 2, 3, 4},
+		NotBefore:      now.Add(-time.Hour),
+		NotAfter:       now.Add(23 * time.Hour),
+	}
+	certID := acme.RenewalInfoCertID(leaf)
+	serial := leaf.SerialNumber.String()
+
+	prov := newACMEProv(t)
+	issuedBefore := now.Add(-time.Minute)
+	provWithRenewal := newACMEProv(t)
+	provWithRenewal.RenewalInfo = &provisioner.ACMERenewalInfo{
+		RenewIssuedBefore: &issuedBefore,
+		ExplanationURL:    "https://status.example.com/incident",
+		RetryAfter:        &provisioner.Duration{Duration: time.Hour},
+	}
+
+	newDB := func(provisionerID string) *acme.MockDB {
+		return &acme.MockDB{
+			MockGetCertificateBySerial: func(ctx context.Context, s string) (*acme.Certificate, error) {
+				if s != serial {
+					return nil, acme.NewError(acme.ErrorMalformedType, "certificate with serial %s not found", s)
+				}
+				return &acme.Certificate{ID: "certID", OrderID: "ordID", Leaf: leaf}, nil
+			},
+			MockGetOrder: func(ctx context.Context, id string) (*acme.Order, error) {
+				assert.Equal(t, "ordID", id)
+				return &acme.Order{ID: "ordID", ProvisionerID: provisionerID}, nil
+			},
+		}
+	}
+	window := acme.RenewalWindow{Start: now.Add(15 * time.Hour), End: now.Add(19 * time.Hour)}
+	forcedWindow := acme.RenewalWindow{Start: now.Add(-time.Hour), End: now}
+
+	tests := []struct {
+		name           string
+		prov           *provisioner.ACME
+		certID         string
+		db             acme.DB
+		ca             acme.CertificateAuthority
+		wantStatus     int
+		wantInfo       *acme.RenewalInfo
+		wantRetryAfter string
+	}{
+		{"ok", prov, certID, newDB(prov.GetID()), &mockCA{}, 200, &acme.RenewalInfo{SuggestedWindow: window}, "21600"},
+		{"ok/revoked", prov, certID, newDB(prov.GetID()), &mockCA{
+			MockIsRevoked: func(sn string) (bool, error) {
+				assert.Equal(t, serial, sn)
+				return true, nil
+			},
+		}, 200, &acme.RenewalInfo{SuggestedWindow: forcedWindow}, "21600"},
+		{"ok/renew-issued-before", provWithRenewal, certID, newDB(provWithRenewal.GetID()), &mockCA{}, 200, &acme.RenewalInfo{
+			SuggestedWindow: forcedWindow,
+			ExplanationURL:  "https://status.example.com/incident",
+		}, "3600"},
+		{"fail/bad-certID", prov, "foo", newDB(prov.GetID()), &mockCA{}, 400, nil, ""},
+		{"fail/serial-not-found", prov, acme.RenewalInfoCertID(&x509.Certificate{
+			SerialNumber:   big.NewInt(1234),
+			AuthorityKeyId: []byte{1, 2, 3, 4},
+		}), newDB(prov.GetID()), &mockCA{}, 404, nil, ""},
+		{"fail/aki-mismatch", prov, acme.RenewalInfoCertID(&x509.Certificate{
+			SerialNumber:   leaf.SerialNumber,
+			AuthorityKeyId: []byte{4, 3, 2, 1},
+		}), newDB(prov.GetID()), &mockCA{}, 404, nil, ""},
+		{"fail/provisioner-mismatch", prov, certID, newDB("otherID"), &mockCA{}, 404, nil, ""},
+		{"fail/db.GetCertificateBySerial", prov, certID, &acme.MockDB{
+			MockGetCertificateBySerial: func(ctx context.Context, s string) (*acme.Certificate, error) {
+				return nil, errors.New("force")
+			},
+		}, &mockCA{}, 500, nil, ""},
+		{"fail/IsRevoked", prov, certID, newDB(prov.GetID()), &mockCA{
+			MockIsRevoked: func(sn string) (bool, error) {
+				return false, errors.New("force")
+			},
+		}, 500, nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockMustAuthority(t, tt.ca)
+			chiCtx := chi.NewRouteContext()
+			chiCtx.URLParams.Add("certID", tt.certID)
+			ctx := acme.NewProvisionerContext(context.Background(), tt.prov)
+			ctx = acme.NewDatabaseContext(ctx, tt.db)
+			ctx = context.WithValue(ctx, chi.RouteCtxKey, chiCtx)
+
+			req := httptest.NewRequest("GET", "/acme/prov/renewal-info/"+tt.certID, http.NoBody)
+			w := httptest.NewRecorder()
+			GetRenewalInfo(w, req.WithContext(ctx))
+			res := w.Result()
+			defer res.Body.Close()
+
+			assert.Equal(t, tt.wantStatus, res.StatusCode)
+			if tt.wantInfo == nil {
+				assert.Equal(t, "application/problem+json", res.Header.Get("Content-Type"))
+				return
+			}
+
+			var info acme.RenewalInfo
+			require.NoError(t, json.NewDecoder(res.Body).Decode(&info))
+			// The forced window depends on the time of the request.
+			assert.WithinDuration(t, tt.wantInfo.SuggestedWindow.Start, info.SuggestedWindow.Start, time.Second)
+			assert.WithinDuration(t, tt.wantInfo.SuggestedWindow.End, info.SuggestedWindow.End, time.Second)
+			assert.Equal(t, tt.wantInfo.ExplanationURL, info.ExplanationURL)
+			assert.Equal(t, tt.wantRetryAfter, res.Header.Get("Retry-After"))
+		})
+	}
+}
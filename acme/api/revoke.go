@@ -232,7 +232,10 @@ func validateReasonCode(reasonCode *int) *acme.Error {
 	//		used by the user. If a request contains a disallowed reasonCode,
 	//		then the server MUST reject it with the error type
 	//		"urn:ietf:params:acme:error:badRevocationReason"
-	// No additional checks have been implemented so far.
+	// Certificates on hold can only be released using the revoke API.
+	if reasonCode != nil && *reasonCode == ocsp.RemoveFromCRL {
+		return acme.NewError(acme.ErrorBadRevocationReasonType, "reasonCode removeFromCRL is not allowed")
+	}
 	return nil
 }
 
@@ -243,7 +246,7 @@ func revokeOptions(serial string, certToBeRevoked *x509.Certificate, reasonCode
 		ACME:   true,
 		Crt:    certToBeRevoked,
 	}
-	if reasonCode != nil { // NOTE: when implementing CRL and/or OCSP, and reason code is missing, CRL entry extension should be omitted
+	if reasonCode != nil { // NOTE: the CRL entry reasonCode extension is omitted for the unspecified reason code
 		opts.Reason = reason(*reasonCode)
 		opts.ReasonCode = *reasonCode
 	}
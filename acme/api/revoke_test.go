@@ -276,9 +276,10 @@ func jwsFinal(_ crypto.Hash, sig []byte, phead, payload string) ([]byte, error)
 }
 
 type mockCA struct {
-	MockIsRevoked      func(sn string) (bool, error)
-	MockRevoke         func(ctx context.Context, opts *authority.RevokeOptions) error
-	MockAreSANsallowed func(ctx context.Context, sans []string) error
+	MockIsRevoked              func(sn string) (bool, error)
+	MockRevoke                 func(ctx context.Context, opts *authority.RevokeOptions) error
+	MockAreSANsallowed         func(ctx context.Context, sans []string) error
+	MockGetAlternateX509Chains func(chain []*x509.Certificate) [][]*x509.Certificate
 }
 
 func (m *mockCA) SignWithContext(context.Context, *x509.CertificateRequest, provisioner.SignOptions, ...provisioner.SignOption) ([]*x509.Certificate, error) {
@@ -310,6 +311,13 @@ func (m *mockCA) LoadProvisionerByName(string) (provisioner.Interface, error) {
 	return nil, nil
 }
 
+func (m *mockCA) GetAlternateX509Chains(chain []*x509.Certificate) [][]*x509.Certificate {
+	if m.MockGetAlternateX509Chains != nil {
+		return m.MockGetAlternateX509Chains(chain)
+	}
+	return nil
+}
+
 func Test_validateReasonCode(t *testing.T) {
 	tests := []struct {
 		name       string
@@ -337,6 +345,11 @@ func Test_validateReasonCode(t *testing.T) {
 
 			want: acme.NewError(acme.ErrorBadRevocationReasonType, "reasonCode out of bounds"),
 		},
+		{
+			name:       "fail/remove-from-crl",
+			reasonCode: v(ocsp.RemoveFromCRL),
+			want:       acme.NewError(acme.ErrorBadRevocationReasonType, "reasonCode removeFromCRL is not allowed"),
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
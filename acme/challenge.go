@@ -56,6 +56,11 @@ const (
 	WIREOIDC01 ChallengeType = "wire-oidc-01"
 	// WIREDPOP01 is the Wire DPoP challenge type
 	WIREDPOP01 ChallengeType = "wire-dpop-01"
+	// EMAILREPLY00 is the email-reply-00 ACME challenge type defined in
+	// RFC 8823.
+	EMAILREPLY00 ChallengeType = "email-reply-00"
+	// ONIONCSR01 is the onion-csr-01 ACME challenge type defined in RFC 9799.
+	ONIONCSR01 ChallengeType = "onion-csr-01"
 )
 
 var (
@@ -87,6 +92,9 @@ type Challenge struct {
 	ValidatedAt     string        `json:"validated,omitempty"`
 	URL             string        `json:"url"`
 	Target          string        `json:"target,omitempty"`
+	From            string        `json:"from,omitempty"`
+	Nonce           string        `json:"nonce,omitempty"`
+	TokenPart1      string        `json:"-"`
 	Error           *Error        `json:"error,omitempty"`
 }
 
@@ -116,6 +124,10 @@ func (ch *Challenge) Validate(ctx context.Context, db DB, jwk *jose.JSONWebKey,
 		return tlsalpn01Validate(ctx, ch, db, jwk)
 	case DEVICEATTEST01:
 		return deviceAttest01Validate(ctx, ch, db, jwk, payload)
+	case EMAILREPLY00:
+		return emailReply00Validate(ctx, ch, db, jwk)
+	case ONIONCSR01:
+		return onionCSR01Validate(ctx, ch, db, payload)
 	case WIREOIDC01:
 		wireDB, ok := db.(WireDB)
 		if !ok {
@@ -133,19 +145,34 @@ func (ch *Challenge) Validate(ctx context.Context, db DB, jwk *jose.JSONWebKey,
 	}
 }
 
+// validationPorts returns the ports used to validate the http-01 and
+// tls-alpn-01 challenges. The insecure ports take precedence over the ports
+// configured in the client. A zero value means that the default port is used.
+func validationPorts(vc Client) (http01Port, tlsALPN01Port int) {
+	if c, ok := vc.(interface{ validationPorts() (int, int) }); ok {
+		http01Port, tlsALPN01Port = c.validationPorts()
+	}
+	if InsecurePortHTTP01 != 0 {
+		http01Port = InsecurePortHTTP01
+	}
+	if InsecurePortTLSALPN01 != 0 {
+		tlsALPN01Port = InsecurePortTLSALPN01
+	}
+	return
+}
+
 func http01Validate(ctx context.Context, ch *Challenge, db DB, jwk *jose.JSONWebKey) error {
 	u := &url.URL{Scheme: "http", Host: ch.Value, Path: fmt.Sprintf("/.well-known/acme-challenge/%s", ch.Token)}
 	challengeURL := &url.URL{Scheme: "http", Host: http01ChallengeHost(ch.Value), Path: fmt.Sprintf("/.well-known/acme-challenge/%s", ch.Token)}
 
-	// Append insecure port if set.
-	// Only used for testing purposes.
-	if InsecurePortHTTP01 != 0 {
-		insecurePort := strconv.Itoa(InsecurePortHTTP01)
-		u.Host += ":" + insecurePort
-		challengeURL.Host += ":" + insecurePort
+	// Append the insecure or the configured port if set.
+	vc := MustClientFromContext(ctx)
+	if port, _ := validationPorts(vc); port != 0 {
+		p := strconv.Itoa(port)
+		u.Host += ":" + p
+		challengeURL.Host += ":" + p
 	}
 
-	vc := MustClientFromContext(ctx)
 	resp, err := vc.Get(challengeURL.String())
 	if err != nil {
 		return storeError(ctx, db, ch, false, WrapError(ErrorConnectionType, err,
@@ -244,15 +271,15 @@ func tlsalpn01Validate(ctx context.Context, ch *Challenge, db DB, jwk *jose.JSON
 		InsecureSkipVerify: true, //nolint:gosec // we expect a self-signed challenge certificate
 	}
 
-	// Allow to change TLS port for testing purposes.
+	// Allow to change TLS port using the insecure or the configured port.
+	vc := MustClientFromContext(ctx)
 	hostPort := tlsAlpn01ChallengeHost(ch.Value)
-	if port := InsecurePortTLSALPN01; port == 0 {
+	if _, port := validationPorts(vc); port == 0 {
 		hostPort = net.JoinHostPort(hostPort, "443")
 	} else {
 		hostPort = net.JoinHostPort(hostPort, strconv.Itoa(port))
 	}
 
-	vc := MustClientFromContext(ctx)
 	conn, err := vc.TLSDial("tcp", hostPort, config)
 	if err != nil {
 		// With Go 1.17+ tls.Dial fails if there's no overlap between configured
@@ -359,8 +386,15 @@ func dns01Validate(ctx context.Context, ch *Challenge, db DB, jwk *jose.JSONWebK
 	// Instead perform txt lookup for _acme-challenge.example.com
 	domain := strings.TrimPrefix(ch.Value, "*.")
 
-	vc := MustClientFromContext(ctx)
-	txtRecords, err := vc.LookupTxt(dns01ChallengeHost(domain))
+	// Use the resolvers configured in the provisioner, if any.
+	var txtRecords []string
+	var err error
+	resolver := dns01ResolverFromContext(ctx)
+	if resolver != nil {
+		txtRecords, err = resolver.LookupTXT(ctx, dns01ChallengeHost(domain))
+	} else {
+		txtRecords, err = MustClientFromContext(ctx).LookupTxt(dns01ChallengeHost(domain))
+	}
 	if err != nil {
 		return storeError(ctx, db, ch, false, WrapError(ErrorDNSType, err,
 			"error looking up TXT records for domain %s", domain))
@@ -384,6 +418,67 @@ func dns01Validate(ctx context.Context, ch *Challenge, db DB, jwk *jose.JSONWebK
 			"keyAuthorization does not match; expected %s, but got %s", expectedKeyAuth, txtRecords))
 	}
 
+	// Make sure the record is visible to any other resolver before marking
+	// the challenge as valid. The challenge stays pending if it's not.
+	if resolver != nil && resolver.propagationCheck {
+		if err := resolver.CheckPropagation(ctx, dns01ChallengeHost(domain), expected); err != nil {
+			return storeError(ctx, db, ch, false, WrapError(ErrorDNSType, err,
+				"error checking propagation of TXT records for domain %s", domain))
+		}
+	}
+
+	// Update and store the challenge.
+	ch.Status = StatusValid
+	ch.Error = nil
+	ch.ValidatedAt = clock.Now().Format(time.RFC3339)
+
+	if err = db.UpdateChallenge(ctx, ch); err != nil {
+		return WrapErrorISE(err, "error updating challenge")
+	}
+	return nil
+}
+
+func emailReply00Validate(ctx context.Context, ch *Challenge, db DB, jwk *jose.JSONWebKey) error {
+	ec, ok := EmailClientFromContext(ctx)
+	if !ok {
+		return NewErrorISE("email-reply-00 challenge requires an email client")
+	}
+
+	body, err := ec.LookupReply(ctx, ch.Value, emailChallengeSubject(ch.TokenPart1))
+	if err != nil {
+		if errors.Is(err, ErrEmailReplyNotFound) {
+			return storeError(ctx, db, ch, false, NewError(ErrorIncorrectResponseType,
+				"response email from %s has not been received", ch.Value))
+		}
+		// A forged response does not invalidate the challenge, the user can
+		// still send an authenticated one.
+		if errors.Is(err, ErrEmailReplyNotAuthenticated) {
+			return storeError(ctx, db, ch, false, WrapError(ErrorUnauthorizedType, err,
+				"response email from %s is not authenticated", ch.Value))
+		}
+		return storeError(ctx, db, ch, false, WrapError(ErrorConnectionType, err,
+			"error looking up response email from %s", ch.Value))
+	}
+
+	// The key authorization is built using the concatenation of the token sent
+	// by email and the token in the challenge object.
+	expectedKeyAuth, err := KeyAuthorization(ch.TokenPart1+ch.Token, jwk)
+	if err != nil {
+		return err
+	}
+	h := sha256.Sum256([]byte(expectedKeyAuth))
+	expected := base64.RawURLEncoding.EncodeToString(h[:])
+
+	value, ok := parseEmailResponse(body)
+	if !ok {
+		return storeError(ctx, db, ch, true, NewError(ErrorIncorrectResponseType,
+			"response email from %s does not contain an ACME response", ch.Value))
+	}
+	if subtle.ConstantTimeCompare([]byte(value), []byte(expected)) == 0 {
+		return storeError(ctx, db, ch, true, NewError(ErrorRejectedIdentifierType,
+			"keyAuthorization does not match; expected %s, but got %s", expected, value))
+	}
+
 	// Update and store the challenge.
 	ch.Status = StatusValid
 	ch.Error = nil
@@ -853,12 +948,15 @@ func deviceAttest01Validate(ctx context.Context, ch *Challenge, db DB, jwk *jose
 			return WrapErrorISE(err, "error validating attestation")
 		}
 
-		// Validate nonce with SHA-256 of the token.
-		if len(data.Nonce) != 0 {
-			sum := sha256.Sum256([]byte(ch.Token))
-			if subtle.ConstantTimeCompare(data.Nonce, sum[:]) != 1 {
-				return storeError(ctx, db, ch, true, NewDetailedError(ErrorBadAttestationStatementType, "challenge token does not match"))
-			}
+		// Validate nonce with SHA-256 of the token. The nonce is required to
+		// verify the freshness of the attestation, without it a previous
+		// attestation of the device could be replayed.
+		if len(data.Nonce) == 0 {
+			return storeError(ctx, db, ch, true, NewDetailedError(ErrorBadAttestationStatementType, "attestation does not contain a nonce"))
+		}
+		sum := sha256.Sum256([]byte(ch.Token))
+		if subtle.ConstantTimeCompare(data.Nonce, sum[:]) != 1 {
+			return storeError(ctx, db, ch, true, NewDetailedError(ErrorBadAttestationStatementType, "challenge token does not match"))
 		}
 
 		// Validate Apple's ClientIdentifier (Identifier.Value) with device
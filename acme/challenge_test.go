@@ -116,16 +116,19 @@ func mustAttestApple(t *testing.T, nonce string) ([]byte, *x509.Certificate, *x5
 	signer, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
 	fatalError(t, err)
 
-	nonceSum := sha256.Sum256([]byte(nonce))
+	extensions := []pkix.Extension{
+		{Id: oidAppleSerialNumber, Value: []byte("serial-number")},
+		{Id: oidAppleUniqueDeviceIdentifier, Value: []byte("udid")},
+		{Id: oidAppleSecureEnclaveProcessorOSVersion, Value: []byte("16.0")},
+	}
+	if nonce != "" {
+		nonceSum := sha256.Sum256([]byte(nonce))
+		extensions = append(extensions, pkix.Extension{Id: oidAppleNonce, Value: nonceSum[:]})
+	}
 	leaf, err := ca.Sign(&x509.Certificate{
-		Subject:   pkix.Name{CommonName: "attestation cert"},
-		PublicKey: signer.Public(),
-		ExtraExtensions: []pkix.Extension{
-			{Id: oidAppleSerialNumber, Value: []byte("serial-number")},
-			{Id: oidAppleUniqueDeviceIdentifier, Value: []byte("udid")},
-			{Id: oidAppleSecureEnclaveProcessorOSVersion, Value: []byte("16.0")},
-			{Id: oidAppleNonce, Value: nonceSum[:]},
-		},
+		Subject:         pkix.Name{CommonName: "attestation cert"},
+		PublicKey:       signer.Public(),
+		ExtraExtensions: extensions,
 	})
 	fatalError(t, err)
 
@@ -4359,6 +4362,53 @@ func Test_deviceAttest01Validate(t *testing.T) {
 				wantErr: nil,
 			}
 		},
+		"ok/doAppleAttestationFormat-missing-nonce": func(t *testing.T) test {
+			jwk, _ := mustAccountAndKeyAuthorization(t, "token")
+			payload, _, root := mustAttestApple(t, "")
+
+			caRoot := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: root.Raw})
+			ctx := NewProvisionerContext(context.Background(), mustAttestationProvisioner(t, caRoot))
+
+			return test{
+				args: args{
+					ctx: ctx,
+					jwk: jwk,
+					ch: &Challenge{
+						ID:              "chID",
+						AuthorizationID: "azID",
+						Token:           "token",
+						Type:            "device-attest-01",
+						Status:          StatusPending,
+						Value:           "serial-number",
+					},
+					payload: payload,
+					db: &MockDB{
+						MockGetAuthorization: func(ctx context.Context, id string) (*Authorization, error) {
+							assert.Equal(t, "azID", id)
+							return &Authorization{ID: "azID"}, nil
+						},
+						MockUpdateChallenge: func(ctx context.Context, updch *Challenge) error {
+							assert.Equal(t, "chID", updch.ID)
+							assert.Equal(t, "token", updch.Token)
+							assert.Equal(t, StatusInvalid, updch.Status)
+							assert.Equal(t, ChallengeType("device-attest-01"), updch.Type)
+							assert.Equal(t, "serial-number", updch.Value)
+
+							err := NewDetailedError(ErrorBadAttestationStatementType, "attestation does not contain a nonce")
+
+							assert.EqualError(t, updch.Error.Err, err.Err.Error())
+							assert.Equal(t, err.Type, updch.Error.Type)
+							assert.Equal(t, err.Detail, updch.Error.Detail)
+							assert.Equal(t, err.Status, updch.Error.Status)
+							assert.Equal(t, err.Subproblems, updch.Error.Subproblems)
+
+							return nil
+						},
+					},
+				},
+				wantErr: nil,
+			}
+		},
 		"ok/doAppleAttestationFormat-non-matching-challenge-value": func(t *testing.T) test {
 			jwk, _ := mustAccountAndKeyAuthorization(t, "token")
 			payload, _, root := mustAttestApple(t, "nonce")
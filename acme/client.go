@@ -1,11 +1,17 @@
 package acme
 
 import (
+	"bufio"
 	"context"
 	"crypto/tls"
+	"encoding/base64"
+	"fmt"
 	"net"
 	"net/http"
+	"net/url"
 	"time"
+
+	"golang.org/x/net/proxy"
 )
 
 // Client is the interface used to verify ACME challenges.
@@ -45,26 +51,93 @@ func MustClientFromContext(ctx context.Context) Client {
 }
 
 type client struct {
-	http   *http.Client
-	dialer *net.Dialer
+	http          *http.Client
+	dialer        *net.Dialer
+	proxyDialer   proxy.ContextDialer
+	http01Port    int
+	tlsALPN01Port int
+}
+
+// ClientOption is the type of the options used to configure the client
+// returned by NewClient.
+type ClientOption func(c *clientOptions)
+
+type clientOptions struct {
+	sourceAddress net.IP
+	proxy         *url.URL
+	http01Port    int
+	tlsALPN01Port int
+}
+
+// WithSourceAddress sets the local IP address used to connect to the
+// challenge targets, or to the proxy if one is configured.
+func WithSourceAddress(ip net.IP) ClientOption {
+	return func(o *clientOptions) {
+		o.sourceAddress = ip
+	}
+}
+
+// WithProxy sets the proxy used to reach the challenge targets. HTTP and HTTPS
+// proxies must support the CONNECT method to validate tls-alpn-01 challenges.
+// SOCKS5 proxies are supported using the socks5 and socks5h schemes.
+func WithProxy(u *url.URL) ClientOption {
+	return func(o *clientOptions) {
+		o.proxy = u
+	}
+}
+
+// WithHTTP01Port sets the port used to validate http-01 challenges.
+func WithHTTP01Port(port int) ClientOption {
+	return func(o *clientOptions) {
+		o.http01Port = port
+	}
+}
+
+// WithTLSALPN01Port sets the port used to validate tls-alpn-01 challenges.
+func WithTLSALPN01Port(port int) ClientOption {
+	return func(o *clientOptions) {
+		o.tlsALPN01Port = port
+	}
 }
 
 // NewClient returns an implementation of Client for verifying ACME challenges.
-func NewClient() Client {
+func NewClient(opts ...ClientOption) Client {
+	o := new(clientOptions)
+	for _, fn := range opts {
+		fn(o)
+	}
+
+	dialer := &net.Dialer{
+		Timeout: 30 * time.Second,
+	}
+	if o.sourceAddress != nil {
+		dialer.LocalAddr = &net.TCPAddr{IP: o.sourceAddress}
+	}
+
+	transport := &http.Transport{
+		Proxy:       http.ProxyFromEnvironment,
+		DialContext: dialer.DialContext,
+		TLSClientConfig: &tls.Config{
+			//nolint:gosec // used on tls-alpn-01 challenge
+			InsecureSkipVerify: true, // lgtm[go/disabled-certificate-check]
+		},
+	}
+
+	var proxyDialer proxy.ContextDialer
+	if o.proxy != nil {
+		transport.Proxy = http.ProxyURL(o.proxy)
+		proxyDialer = newProxyDialer(o.proxy, dialer)
+	}
+
 	return &client{
 		http: &http.Client{
-			Timeout: 30 * time.Second,
-			Transport: &http.Transport{
-				Proxy: http.ProxyFromEnvironment,
-				TLSClientConfig: &tls.Config{
-					//nolint:gosec // used on tls-alpn-01 challenge
-					InsecureSkipVerify: true, // lgtm[go/disabled-certificate-check]
-				},
-			},
-		},
-		dialer: &net.Dialer{
-			Timeout: 30 * time.Second,
+			Timeout:   30 * time.Second,
+			Transport: transport,
 		},
+		dialer:        dialer,
+		proxyDialer:   proxyDialer,
+		http01Port:    o.http01Port,
+		tlsALPN01Port: o.tlsALPN01Port,
 	}
 }
 
@@ -77,5 +150,122 @@ func (c *client) LookupTxt(name string) ([]string, error) {
 }
 
 func (c *client) TLSDial(network, addr string, config *tls.Config) (*tls.Conn, error) {
-	return tls.DialWithDialer(c.dialer, network, addr, config)
+	if c.proxyDialer == nil {
+		return tls.DialWithDialer(c.dialer, network, addr, config)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.dialer.Timeout)
+	defer cancel()
+
+	conn, err := c.proxyDialer.DialContext(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+	tlsConn := tls.Client(conn, config)
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return tlsConn, nil
+}
+
+// validationPorts returns the ports used to validate the http-01 and
+// tls-alpn-01 challenges. A zero value means that the default port is used.
+func (c *client) validationPorts() (http01Port, tlsALPN01Port int) {
+	return c.http01Port, c.tlsALPN01Port
+}
+
+// newProxyDialer returns the dialer used to connect to the tls-alpn-01
+// challenge targets through the given proxy.
+func newProxyDialer(u *url.URL, forward *net.Dialer) proxy.ContextDialer {
+	switch u.Scheme {
+	case "socks5", "socks5h":
+		var auth *proxy.Auth
+		if u.User != nil {
+			auth = &proxy.Auth{User: u.User.Username()}
+			auth.Password, _ = u.User.Password()
+		}
+		port := u.Port()
+		if port == "" {
+			port = "1080"
+		}
+		// SOCKS5 never fails and always returns a context dialer.
+		d, _ := proxy.SOCKS5("tcp", net.JoinHostPort(u.Hostname(), port), auth, forward)
+		return d.(proxy.ContextDialer)
+	default:
+		return &connectDialer{proxy: u, forward: forward}
+	}
+}
+
+// connectDialer is a proxy.ContextDialer that creates connections through an
+// HTTP or HTTPS proxy using the CONNECT method.
+type connectDialer struct {
+	proxy   *url.URL
+	forward *net.Dialer
+}
+
+func (d *connectDialer) DialContext(ctx context.Context, _, addr string) (net.Conn, error) {
+	proxyAddr := d.proxy.Host
+	if d.proxy.Port() == "" {
+		if d.proxy.Scheme == "https" {
+			proxyAddr = net.JoinHostPort(d.proxy.Hostname(), "443")
+		} else {
+			proxyAddr = net.JoinHostPort(d.proxy.Hostname(), "80")
+		}
+	}
+
+	conn, err := d.forward.DialContext(ctx, "tcp", proxyAddr)
+	if err != nil {
+		return nil, err
+	}
+	if d.proxy.Scheme == "https" {
+		tlsConn := tls.Client(conn, &tls.Config{
+			ServerName: d.proxy.Hostname(),
+			MinVersion: tls.VersionTLS12,
+		})
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		conn = tlsConn
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := conn.SetDeadline(deadline); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		defer conn.SetDeadline(time.Time{})
+	}
+
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: make(http.Header),
+	}
+	if u := d.proxy.User; u != nil {
+		password, _ := u.Password()
+		req.Header.Set("Proxy-Authorization", "Basic "+
+			base64.StdEncoding.EncodeToString([]byte(u.Username()+":"+password)))
+	}
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	// The target will not send any data before the TLS handshake, so the
+	// buffered reader can be discarded after reading the response.
+	resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, fmt.Errorf("proxy %s returned %s connecting to %s", d.proxy.Redacted(), resp.Status, addr)
+	}
+
+	return conn, nil
 }
@@ -0,0 +1,175 @@
+package acme
+
+import (
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/proxy"
+)
+
+// newConnectProxy returns an HTTP proxy that supports the CONNECT method and
+// forwards plain HTTP requests to the given handler.
+func newConnectProxy(t *testing.T, forward http.Handler) (*httptest.Server, func() []*http.Request) {
+	t.Helper()
+
+	var mu sync.Mutex
+	var requests []*http.Request
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests = append(requests, r)
+		mu.Unlock()
+
+		if r.Method != http.MethodConnect {
+			forward.ServeHTTP(w, r)
+			return
+		}
+		if r.Header.Get("Proxy-Authorization") == "Basic Zm9vOmJhcg==" { // foo:bar
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+
+		target, err := net.Dial("tcp", r.Host)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		conn, _, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			target.Close()
+			return
+		}
+		io.WriteString(conn, "HTTP/1.1 200 Connection established\r\n\r\n") //nolint:errcheck // test proxy
+		go func() {
+			defer target.Close()
+			defer conn.Close()
+			go io.Copy(target, conn) //nolint:errcheck // test proxy
+			io.Copy(conn, target)    //nolint:errcheck // test proxy
+		}()
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv, func() []*http.Request {
+		mu.Lock()
+		defer mu.Unlock()
+		return requests
+	}
+}
+
+func TestNewClient(t *testing.T) {
+	u, err := url.Parse("socks5://proxy.internal:1080")
+	require.NoError(t, err)
+
+	c := NewClient().(*client)
+	assert.Nil(t, c.dialer.LocalAddr)
+	assert.Nil(t, c.proxyDialer)
+
+	c = NewClient(WithSourceAddress(net.ParseIP("10.0.0.1")), WithProxy(u),
+		WithHTTP01Port(8080), WithTLSALPN01Port(8443)).(*client)
+	assert.Equal(t, &net.TCPAddr{IP: net.ParseIP("10.0.0.1")}, c.dialer.LocalAddr)
+	assert.Implements(t, (*proxy.ContextDialer)(nil), c.proxyDialer)
+	_, isConnect := c.proxyDialer.(*connectDialer)
+	assert.False(t, isConnect)
+	assert.Equal(t, 8080, c.http01Port)
+	assert.Equal(t, 8443, c.tlsALPN01Port)
+
+	u, err = url.Parse("http://proxy.internal:3128")
+	require.NoError(t, err)
+	c = NewClient(WithProxy(u)).(*client)
+	assert.Equal(t, &connectDialer{proxy: u, forward: c.dialer}, c.proxyDialer)
+}
+
+func Test_validationPorts(t *testing.T) {
+	http01Port, tlsALPN01Port := validationPorts(&mockClient{})
+	assert.Equal(t, 0, http01Port)
+	assert.Equal(t, 0, tlsALPN01Port)
+
+	vc := NewClient(WithHTTP01Port(8080), WithTLSALPN01Port(8443))
+	http01Port, tlsALPN01Port = validationPorts(vc)
+	assert.Equal(t, 8080, http01Port)
+	assert.Equal(t, 8443, tlsALPN01Port)
+
+	t.Cleanup(func() {
+		InsecurePortHTTP01 = 0
+		InsecurePortTLSALPN01 = 0
+	})
+	InsecurePortHTTP01 = 5080
+	InsecurePortTLSALPN01 = 5443
+	http01Port, tlsALPN01Port = validationPorts(vc)
+	assert.Equal(t, 5080, http01Port)
+	assert.Equal(t, 5443, tlsALPN01Port)
+}
+
+func TestClient_Get_sourceAddress(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		assert.NoError(t, err)
+		io.WriteString(w, host) //nolint:errcheck // test server
+	}))
+	defer srv.Close()
+
+	vc := NewClient(WithSourceAddress(net.ParseIP("127.0.0.1")))
+	resp, err := vc.Get(srv.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "127.0.0.1", string(b))
+}
+
+func TestClient_Get_proxy(t *testing.T) {
+	proxySrv, requests := newConnectProxy(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "proxied "+r.URL.String()) //nolint:errcheck // test server
+	}))
+	u, err := url.Parse(proxySrv.URL)
+	require.NoError(t, err)
+
+	vc := NewClient(WithProxy(u))
+	resp, err := vc.Get("http://challenge.internal/.well-known/acme-challenge/token")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "proxied http://challenge.internal/.well-known/acme-challenge/token", string(b))
+	assert.Len(t, requests(), 1)
+}
+
+func TestClient_TLSDial_proxy(t *testing.T) {
+	target := httptest.NewTLSServer(http.NotFoundHandler())
+	defer target.Close()
+	targetAddr := target.Listener.Addr().String()
+
+	proxySrv, requests := newConnectProxy(t, http.NotFoundHandler())
+	u, err := url.Parse(proxySrv.URL)
+	require.NoError(t, err)
+
+	vc := NewClient(WithProxy(u))
+	conn, err := vc.TLSDial("tcp", targetAddr, &tls.Config{
+		InsecureSkipVerify: true, //nolint:gosec // test server
+	})
+	require.NoError(t, err)
+	assert.True(t, conn.ConnectionState().HandshakeComplete)
+	require.NoError(t, conn.Close())
+
+	reqs := requests()
+	require.Len(t, reqs, 1)
+	assert.Equal(t, http.MethodConnect, reqs[0].Method)
+	assert.Equal(t, targetAddr, reqs[0].Host)
+	assert.Empty(t, reqs[0].Header.Get("Proxy-Authorization"))
+
+	// The proxy rejects the credentials.
+	u.User = url.UserPassword("foo", "bar")
+	vc = NewClient(WithProxy(u))
+	_, err = vc.TLSDial("tcp", targetAddr, &tls.Config{
+		InsecureSkipVerify: true, //nolint:gosec // test server
+	})
+	assert.ErrorContains(t, err, "403 Forbidden")
+	assert.NotContains(t, err.Error(), "bar")
+}
@@ -26,6 +26,7 @@ type CertificateAuthority interface {
 	IsRevoked(sn string) (bool, error)
 	Revoke(context.Context, *authority.RevokeOptions) error
 	LoadProvisionerByName(string) (provisioner.Interface, error)
+	GetAlternateX509Chains(chain []*x509.Certificate) [][]*x509.Certificate
 }
 
 // NewContext adds the given acme components to the context.
@@ -78,6 +79,7 @@ type Provisioner interface {
 	GetName() string
 	DefaultTLSCertDuration() time.Duration
 	GetOptions() *provisioner.Options
+	GetProfile(name string) (*provisioner.ACMEProfile, error)
 }
 
 type provisionerKey struct{}
@@ -120,6 +122,7 @@ type MockProvisioner struct {
 	MgetAttestationRoots      func() (*x509.CertPool, bool)
 	MdefaultTLSCertDuration   func() time.Duration
 	MgetOptions               func() *provisioner.Options
+	MgetProfile               func(name string) (*provisioner.ACMEProfile, error)
 }
 
 // GetName mock
@@ -193,6 +196,14 @@ func (m *MockProvisioner) GetOptions() *provisioner.Options {
 	return m.Mret1.(*provisioner.Options)
 }
 
+// GetProfile mock
+func (m *MockProvisioner) GetProfile(name string) (*provisioner.ACMEProfile, error) {
+	if m.MgetProfile != nil {
+		return m.MgetProfile(name)
+	}
+	return nil, nil
+}
+
 // GetID mock
 func (m *MockProvisioner) GetID() string {
 	if m.MgetID != nil {
@@ -25,6 +25,7 @@ type DB interface {
 	GetAccount(ctx context.Context, id string) (*Account, error)
 	GetAccountByKeyID(ctx context.Context, kid string) (*Account, error)
 	UpdateAccount(ctx context.Context, acc *Account) error
+	GetAccountsByProvisionerID(ctx context.Context, provisionerID string) ([]*Account, error)
 
 	CreateExternalAccountKey(ctx context.Context, provisionerID, reference string) (*ExternalAccountKey, error)
 	GetExternalAccountKey(ctx context.Context, provisionerID, keyID string) (*ExternalAccountKey, error)
@@ -103,6 +104,8 @@ type MockDB struct {
 	MockGetAccountByKeyID func(ctx context.Context, kid string) (*Account, error)
 	MockUpdateAccount     func(ctx context.Context, acc *Account) error
 
+	MockGetAccountsByProvisionerID func(ctx context.Context, provisionerID string) ([]*Account, error)
+
 	MockCreateExternalAccountKey         func(ctx context.Context, provisionerID, reference string) (*ExternalAccountKey, error)
 	MockGetExternalAccountKey            func(ctx context.Context, provisionerID, keyID string) (*ExternalAccountKey, error)
 	MockGetExternalAccountKeys           func(ctx context.Context, provisionerID, cursor string, limit int) ([]*ExternalAccountKey, string, error)
@@ -188,6 +191,16 @@ func (m *MockDB) UpdateAccount(ctx context.Context, acc *Account) error {
 	return m.MockError
 }
 
+// GetAccountsByProvisionerID mock
+func (m *MockDB) GetAccountsByProvisionerID(ctx context.Context, provisionerID string) ([]*Account, error) {
+	if m.MockGetAccountsByProvisionerID != nil {
+		return m.MockGetAccountsByProvisionerID(ctx, provisionerID)
+	} else if m.MockError != nil {
+		return nil, m.MockError
+	}
+	return m.MockRet1.([]*Account), m.MockError
+}
+
 // CreateExternalAccountKey mock
 func (m *MockDB) CreateExternalAccountKey(ctx context.Context, provisionerID, reference string) (*ExternalAccountKey, error) {
 	if m.MockCreateExternalAccountKey != nil {
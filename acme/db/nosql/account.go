@@ -13,15 +13,18 @@ import (
 
 // dbAccount represents an ACME account.
 type dbAccount struct {
-	ID              string           `json:"id"`
-	Key             *jose.JSONWebKey `json:"key"`
-	Contact         []string         `json:"contact,omitempty"`
-	Status          acme.Status      `json:"status"`
-	LocationPrefix  string           `json:"locationPrefix"`
-	ProvisionerID   string           `json:"provisionerID,omitempty"`
-	ProvisionerName string           `json:"provisionerName"`
-	CreatedAt       time.Time        `json:"createdAt"`
-	DeactivatedAt   time.Time        `json:"deactivatedAt"`
+	ID                   string           `json:"id"`
+	Key                  *jose.JSONWebKey `json:"key"`
+	Contact              []string         `json:"contact,omitempty"`
+	Status               acme.Status      `json:"status"`
+	LocationPrefix       string           `json:"locationPrefix"`
+	ProvisionerID        string           `json:"provisionerID,omitempty"`
+	ProvisionerName      string           `json:"provisionerName"`
+	CreatedAt            time.Time        `json:"createdAt"`
+	DeactivatedAt        time.Time        `json:"deactivatedAt"`
+	Policy               *acme.Policy     `json:"policy,omitempty"`
+	RateLimitTier        string           `json:"rateLimitTier,omitempty"`
+	TermsOfServiceAgreed bool             `json:"termsOfServiceAgreed,omitempty"`
 }
 
 func (dba *dbAccount) clone() *dbAccount {
@@ -65,13 +68,16 @@ func (db *DB) GetAccount(ctx context.Context, id string) (*acme.Account, error)
 	}
 
 	return &acme.Account{
-		Status:          dbacc.Status,
-		Contact:         dbacc.Contact,
-		Key:             dbacc.Key,
-		ID:              dbacc.ID,
-		LocationPrefix:  dbacc.LocationPrefix,
-		ProvisionerID:   dbacc.ProvisionerID,
-		ProvisionerName: dbacc.ProvisionerName,
+		Status:               dbacc.Status,
+		Contact:              dbacc.Contact,
+		Key:                  dbacc.Key,
+		ID:                   dbacc.ID,
+		LocationPrefix:       dbacc.LocationPrefix,
+		ProvisionerID:        dbacc.ProvisionerID,
+		ProvisionerName:      dbacc.ProvisionerName,
+		Policy:               dbacc.Policy,
+		RateLimitTier:        dbacc.RateLimitTier,
+		TermsOfServiceAgreed: dbacc.TermsOfServiceAgreed,
 	}, nil
 }
 
@@ -84,6 +90,39 @@ func (db *DB) GetAccountByKeyID(ctx context.Context, kid string) (*acme.Account,
 	return db.GetAccount(ctx, id)
 }
 
+// GetAccountsByProvisionerID retrieves all the ACME accounts created with the
+// given provisioner.
+func (db *DB) GetAccountsByProvisionerID(_ context.Context, provisionerID string) ([]*acme.Account, error) {
+	entries, err := db.db.List(accountTable)
+	if err != nil {
+		return nil, errors.Wrap(err, "error listing accounts")
+	}
+	accs := []*acme.Account{}
+	for _, entry := range entries {
+		dbacc := new(dbAccount)
+		if err = json.Unmarshal(entry.Value, dbacc); err != nil {
+			return nil, errors.Wrapf(err, "error unmarshaling dbAccount key '%s' into dbAccount struct", string(entry.Key))
+		}
+		// Filter out all the accounts that don't belong to the provisioner.
+		if dbacc.ProvisionerID != provisionerID {
+			continue
+		}
+		accs = append(accs, &acme.Account{
+			Status:               dbacc.Status,
+			Contact:              dbacc.Contact,
+			Key:                  dbacc.Key,
+			ID:                   dbacc.ID,
+			LocationPrefix:       dbacc.LocationPrefix,
+			ProvisionerID:        dbacc.ProvisionerID,
+			ProvisionerName:      dbacc.ProvisionerName,
+			Policy:               dbacc.Policy,
+			RateLimitTier:        dbacc.RateLimitTier,
+			TermsOfServiceAgreed: dbacc.TermsOfServiceAgreed,
+		})
+	}
+	return accs, nil
+}
+
 // CreateAccount imlements the AcmeDB.CreateAccount interface.
 func (db *DB) CreateAccount(ctx context.Context, acc *acme.Account) error {
 	var err error
@@ -93,14 +132,17 @@ func (db *DB) CreateAccount(ctx context.Context, acc *acme.Account) error {
 	}
 
 	dba := &dbAccount{
-		ID:              acc.ID,
-		Key:             acc.Key,
-		Contact:         acc.Contact,
-		Status:          acc.Status,
-		CreatedAt:       clock.Now(),
-		LocationPrefix:  acc.LocationPrefix,
-		ProvisionerID:   acc.ProvisionerID,
-		ProvisionerName: acc.ProvisionerName,
+		ID:                   acc.ID,
+		Key:                  acc.Key,
+		Contact:              acc.Contact,
+		Status:               acc.Status,
+		CreatedAt:            clock.Now(),
+		LocationPrefix:       acc.LocationPrefix,
+		ProvisionerID:        acc.ProvisionerID,
+		ProvisionerName:      acc.ProvisionerName,
+		Policy:               acc.Policy,
+		RateLimitTier:        acc.RateLimitTier,
+		TermsOfServiceAgreed: acc.TermsOfServiceAgreed,
 	}
 
 	kid, err := acme.KeyToID(dba.Key)
@@ -135,11 +177,64 @@ func (db *DB) UpdateAccount(ctx context.Context, acc *acme.Account) error {
 	nu := old.clone()
 	nu.Contact = acc.Contact
 	nu.Status = acc.Status
+	nu.Policy = acc.Policy
+	nu.RateLimitTier = acc.RateLimitTier
+	nu.TermsOfServiceAgreed = acc.TermsOfServiceAgreed
 
 	// If the status has changed to 'deactivated', then set deactivatedAt timestamp.
 	if acc.Status == acme.StatusDeactivated && old.Status != acme.StatusDeactivated {
 		nu.DeactivatedAt = clock.Now()
 	}
 
+	// If the key has changed, then update the jwkID -> acme account ID index.
+	if acc.Key != nil && !keysAreEqual(acc.Key, old.Key) {
+		return db.updateAccountKey(ctx, old, nu, acc.Key)
+	}
+
 	return db.save(ctx, old.ID, nu, old, "account", accountTable)
 }
+
+// updateAccountKey stores the account with the new key, creating the index for
+// the new key and removing the index of the old one.
+func (db *DB) updateAccountKey(ctx context.Context, old, nu *dbAccount, key *jose.JSONWebKey) error {
+	oldKid, err := acme.KeyToID(old.Key)
+	if err != nil {
+		return err
+	}
+	newKid, err := acme.KeyToID(key)
+	if err != nil {
+		return err
+	}
+	newKidB := []byte(newKid)
+
+	// Set the new jwkID -> acme account ID index
+	_, swapped, err := db.db.CmpAndSwap(accountByKeyIDTable, newKidB, nil, []byte(old.ID))
+	switch {
+	case err != nil:
+		return errors.Wrap(err, "error storing keyID to accountID index")
+	case !swapped:
+		return errors.Errorf("key-id to account-id index already exists")
+	}
+
+	nu.Key = key
+	if err := db.save(ctx, old.ID, nu, old, "account", accountTable); err != nil {
+		db.db.Del(accountByKeyIDTable, newKidB)
+		return err
+	}
+	if err := db.db.Del(accountByKeyIDTable, []byte(oldKid)); err != nil {
+		return errors.Wrapf(err, "error deleting key-id to account-id index for key %s", oldKid)
+	}
+	return nil
+}
+
+func keysAreEqual(x, y *jose.JSONWebKey) bool {
+	if x == nil || y == nil {
+		return false
+	}
+	kx, errX := acme.KeyToID(x)
+	ky, errY := acme.KeyToID(y)
+	if errX != nil || errY != nil {
+		return false
+	}
+	return kx == ky
+}
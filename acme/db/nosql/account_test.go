@@ -234,6 +234,13 @@ func TestDB_GetAccount(t *testing.T) {
 				Key:             jwk,
 				LocationPrefix:  locationPrefix,
 				ProvisionerName: provisionerName,
+				Policy: &acme.Policy{
+					X509: acme.X509Policy{
+						Allowed: acme.PolicyNames{DNSNames: []string{"*.team.internal"}},
+					},
+				},
+				RateLimitTier:        "gold",
+				TermsOfServiceAgreed: true,
 			}
 			b, err := json.Marshal(dbacc)
 			assert.FatalError(t, err)
@@ -274,6 +281,9 @@ func TestDB_GetAccount(t *testing.T) {
 				assert.Equals(t, acc.Contact, tc.dbacc.Contact)
 				assert.Equals(t, acc.LocationPrefix, tc.dbacc.LocationPrefix)
 				assert.Equals(t, acc.ProvisionerName, tc.dbacc.ProvisionerName)
+				assert.Equals(t, acc.Policy, tc.dbacc.Policy)
+				assert.Equals(t, acc.RateLimitTier, tc.dbacc.RateLimitTier)
+				assert.Equals(t, acc.TermsOfServiceAgreed, tc.dbacc.TermsOfServiceAgreed)
 				assert.Equals(t, acc.Key.KeyID, tc.dbacc.Key.KeyID)
 			}
 		})
@@ -568,9 +578,10 @@ func TestDB_UpdateAccount(t *testing.T) {
 	b, err := json.Marshal(dbacc)
 	assert.FatalError(t, err)
 	type test struct {
-		db  nosql.DB
-		acc *acme.Account
-		err error
+		db    nosql.DB
+		acc   *acme.Account
+		err   error
+		check func(t *testing.T)
 	}
 	var tests = map[string]func(t *testing.T) test{
 		"fail/db.Get-error": func(t *testing.T) test {
@@ -700,11 +711,92 @@ func TestDB_UpdateAccount(t *testing.T) {
 				},
 			}
 		},
+		"fail/key-change-index-exists": func(t *testing.T) test {
+			newJWK, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+			assert.FatalError(t, err)
+			newKID, err := acme.KeyToID(newJWK)
+			assert.FatalError(t, err)
+			return test{
+				acc: &acme.Account{
+					ID:     accID,
+					Status: acme.StatusValid,
+					Key:    newJWK,
+				},
+				db: &db.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						assert.Equals(t, bucket, accountTable)
+						assert.Equals(t, string(key), accID)
+						return b, nil
+					},
+					MCmpAndSwap: func(bucket, key, old, nu []byte) ([]byte, bool, error) {
+						assert.Equals(t, bucket, accountByKeyIDTable)
+						assert.Equals(t, string(key), newKID)
+						assert.Equals(t, old, nil)
+						return []byte("otherID"), false, nil
+					},
+				},
+				err: errors.New("key-id to account-id index already exists"),
+			}
+		},
+		"ok/key-change": func(t *testing.T) test {
+			newJWK, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+			assert.FatalError(t, err)
+			oldKID, err := acme.KeyToID(jwk)
+			assert.FatalError(t, err)
+			newKID, err := acme.KeyToID(newJWK)
+			assert.FatalError(t, err)
+			var deleted bool
+			return test{
+				acc: &acme.Account{
+					ID:      accID,
+					Status:  acme.StatusDeactivated,
+					Contact: []string{"foo", "bar"},
+					Key:     newJWK,
+				},
+				db: &db.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						assert.Equals(t, bucket, accountTable)
+						assert.Equals(t, string(key), accID)
+						return b, nil
+					},
+					MCmpAndSwap: func(bucket, key, old, nu []byte) ([]byte, bool, error) {
+						switch string(bucket) {
+						case string(accountByKeyIDTable):
+							assert.Equals(t, string(key), newKID)
+							assert.Equals(t, old, nil)
+							assert.Equals(t, string(nu), accID)
+						case string(accountTable):
+							assert.Equals(t, string(key), accID)
+							assert.Equals(t, old, b)
+							dbNew := new(dbAccount)
+							assert.FatalError(t, json.Unmarshal(nu, dbNew))
+							assert.Equals(t, dbNew.Key.KeyID, newJWK.KeyID)
+							assert.True(t, keysAreEqual(dbNew.Key, newJWK))
+						default:
+							t.Errorf("unexpected bucket %s", bucket)
+						}
+						return nu, true, nil
+					},
+					MDel: func(bucket, key []byte) error {
+						assert.Equals(t, bucket, accountByKeyIDTable)
+						assert.Equals(t, string(key), oldKID)
+						deleted = true
+						return nil
+					},
+				},
+				check: func(t *testing.T) {
+					assert.True(t, deleted)
+				},
+			}
+		},
 	}
 	for name, run := range tests {
 		tc := run(t)
 		t.Run(name, func(t *testing.T) {
 			d := DB{db: tc.db}
+			if tc.check != nil {
+				defer tc.check(t)
+			}
 			if err := d.UpdateAccount(context.Background(), tc.acc); err != nil {
 				if assert.NotNil(t, tc.err) {
 					assert.HasPrefix(t, err.Error(), tc.err.Error())
@@ -715,3 +807,93 @@ func TestDB_UpdateAccount(t *testing.T) {
 		})
 	}
 }
+
+func TestDB_GetAccountsByProvisionerID(t *testing.T) {
+	jwk, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+	assert.FatalError(t, err)
+	newEntry := func(id, provisionerID string) *nosqldb.Entry {
+		b, err := json.Marshal(&dbAccount{
+			ID:            id,
+			Key:           jwk,
+			Status:        acme.StatusValid,
+			ProvisionerID: provisionerID,
+		})
+		assert.FatalError(t, err)
+		return &nosqldb.Entry{Bucket: accountTable, Key: []byte(id), Value: b}
+	}
+	type test struct {
+		db   nosql.DB
+		err  error
+		accs []string
+	}
+	var tests = map[string]func(t *testing.T) test{
+		"fail/db.List-error": func(t *testing.T) test {
+			return test{
+				db: &db.MockNoSQLDB{
+					MList: func(bucket []byte) ([]*nosqldb.Entry, error) {
+						assert.Equals(t, bucket, accountTable)
+						return nil, errors.New("force")
+					},
+				},
+				err: errors.New("error listing accounts: force"),
+			}
+		},
+		"fail/unmarshal": func(t *testing.T) test {
+			return test{
+				db: &db.MockNoSQLDB{
+					MList: func(bucket []byte) ([]*nosqldb.Entry, error) {
+						return []*nosqldb.Entry{
+							{Bucket: bucket, Key: []byte("accID"), Value: []byte("{malformed}")},
+						}, nil
+					},
+				},
+				err: errors.New("error unmarshaling dbAccount key 'accID' into dbAccount struct"),
+			}
+		},
+		"ok": func(t *testing.T) test {
+			return test{
+				db: &db.MockNoSQLDB{
+					MList: func(bucket []byte) ([]*nosqldb.Entry, error) {
+						return []*nosqldb.Entry{
+							newEntry("acc1", "provID"),
+							newEntry("acc2", "otherID"),
+							newEntry("acc3", "provID"),
+						}, nil
+					},
+				},
+				accs: []string{"acc1", "acc3"},
+			}
+		},
+		"ok/empty": func(t *testing.T) test {
+			return test{
+				db: &db.MockNoSQLDB{
+					MList: func(bucket []byte) ([]*nosqldb.Entry, error) {
+						return []*nosqldb.Entry{}, nil
+					},
+				},
+				accs: []string{},
+			}
+		},
+	}
+	for name, run := range tests {
+		tc := run(t)
+		t.Run(name, func(t *testing.T) {
+			d := DB{db: tc.db}
+			accs, err := d.GetAccountsByProvisionerID(context.Background(), "provID")
+			if err != nil {
+				if assert.NotNil(t, tc.err) {
+					assert.HasPrefix(t, err.Error(), tc.err.Error())
+				}
+				return
+			}
+			assert.Nil(t, tc.err)
+			ids := make([]string, len(accs))
+			for i, acc := range accs {
+				ids[i] = acc.ID
+				assert.Equals(t, acc.ProvisionerID, "provID")
+				assert.Equals(t, acc.Status, acme.StatusValid)
+			}
+			assert.Equals(t, ids, tc.accs)
+		})
+	}
+}
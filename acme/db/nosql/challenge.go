@@ -20,6 +20,9 @@ type dbChallenge struct {
 	Token       string             `json:"token"`
 	Value       string             `json:"value"`
 	Target      string             `json:"target,omitempty"`
+	From        string             `json:"from,omitempty"`
+	TokenPart1  string             `json:"tokenPart1,omitempty"`
+	Nonce       string             `json:"nonce,omitempty"`
 	ValidatedAt string             `json:"validatedAt"`
 	CreatedAt   time.Time          `json:"createdAt"`
 	Error       *acme.Error        `json:"error"` // TODO(hs): a bit dangerous; should become db-specific type
@@ -55,14 +58,17 @@ func (db *DB) CreateChallenge(ctx context.Context, ch *acme.Challenge) error {
 	}
 
 	dbch := &dbChallenge{
-		ID:        ch.ID,
-		AccountID: ch.AccountID,
-		Value:     ch.Value,
-		Status:    acme.StatusPending,
-		Token:     ch.Token,
-		CreatedAt: clock.Now(),
-		Type:      ch.Type,
-		Target:    ch.Target,
+		ID:         ch.ID,
+		AccountID:  ch.AccountID,
+		Value:      ch.Value,
+		Status:     acme.StatusPending,
+		Token:      ch.Token,
+		CreatedAt:  clock.Now(),
+		Type:       ch.Type,
+		Target:     ch.Target,
+		From:       ch.From,
+		TokenPart1: ch.TokenPart1,
+		Nonce:      ch.Nonce,
 	}
 
 	return db.save(ctx, ch.ID, dbch, nil, "challenge", challengeTable)
@@ -87,6 +93,9 @@ func (db *DB) GetChallenge(ctx context.Context, id, authzID string) (*acme.Chall
 		Error:       dbch.Error,
 		ValidatedAt: dbch.ValidatedAt,
 		Target:      dbch.Target,
+		From:        dbch.From,
+		TokenPart1:  dbch.TokenPart1,
+		Nonce:       dbch.Nonce,
 	}
 	return ch, nil
 }
@@ -20,13 +20,14 @@ var externalAccountKeyMutex sync.RWMutex
 var referencesByProvisionerIndexMutex sync.Mutex
 
 type dbExternalAccountKey struct {
-	ID            string    `json:"id"`
-	ProvisionerID string    `json:"provisionerID"`
-	Reference     string    `json:"reference"`
-	AccountID     string    `json:"accountID,omitempty"`
-	HmacKey       []byte    `json:"key"`
-	CreatedAt     time.Time `json:"createdAt"`
-	BoundAt       time.Time `json:"boundAt"`
+	ID            string       `json:"id"`
+	ProvisionerID string       `json:"provisionerID"`
+	Reference     string       `json:"reference"`
+	AccountID     string       `json:"accountID,omitempty"`
+	HmacKey       []byte       `json:"key"`
+	CreatedAt     time.Time    `json:"createdAt"`
+	BoundAt       time.Time    `json:"boundAt"`
+	Policy        *acme.Policy `json:"policy,omitempty"`
 }
 
 type dbExternalAccountKeyReference struct {
@@ -102,6 +103,7 @@ func (db *DB) CreateExternalAccountKey(ctx context.Context, provisionerID, refer
 		HmacKey:       dbeak.HmacKey,
 		CreatedAt:     dbeak.CreatedAt,
 		BoundAt:       dbeak.BoundAt,
+		Policy:        dbeak.Policy,
 	}, nil
 }
 
@@ -127,6 +129,7 @@ func (db *DB) GetExternalAccountKey(ctx context.Context, provisionerID, keyID st
 		HmacKey:       dbeak.HmacKey,
 		CreatedAt:     dbeak.CreatedAt,
 		BoundAt:       dbeak.BoundAt,
+		Policy:        dbeak.Policy,
 	}, nil
 }
 
@@ -148,6 +151,11 @@ func (db *DB) DeleteExternalAccountKey(ctx context.Context, provisionerID, keyID
 			return errors.Wrapf(err, "error deleting ACME EAB Key reference with Key ID %s and reference %s", keyID, dbeak.Reference)
 		}
 	}
+	if dbeak.AccountID != "" {
+		if err := db.db.Del(externalAccountKeyIDsByAccountIDTable, []byte(referenceKey(provisionerID, dbeak.AccountID))); err != nil {
+			return errors.Wrapf(err, "error deleting ACME EAB Key account index with Key ID %s and account %s", keyID, dbeak.AccountID)
+		}
+	}
 	if err := db.db.Del(externalAccountKeyTable, []byte(keyID)); err != nil {
 		return errors.Wrapf(err, "error deleting ACME EAB Key with Key ID %s", keyID)
 	}
@@ -199,6 +207,7 @@ func (db *DB) GetExternalAccountKeys(ctx context.Context, provisionerID, cursor
 			AccountID:     eak.AccountID,
 			CreatedAt:     eak.CreatedAt,
 			BoundAt:       eak.BoundAt,
+			Policy:        eak.Policy,
 		})
 	}
 
@@ -229,9 +238,19 @@ func (db *DB) GetExternalAccountKeyByReference(ctx context.Context, provisionerI
 	return db.GetExternalAccountKey(ctx, provisionerID, dbExternalAccountKeyReference.ExternalAccountKeyID)
 }
 
-func (db *DB) GetExternalAccountKeyByAccountID(context.Context, string, string) (*acme.ExternalAccountKey, error) {
-	//nolint:nilnil // legacy
-	return nil, nil
+// GetExternalAccountKeyByAccountID retrieves the External Account Binding key
+// bound to the account with the given ID. It returns nil if the account was
+// created without an External Account Binding.
+func (db *DB) GetExternalAccountKeyByAccountID(ctx context.Context, provisionerID, accountID string) (*acme.ExternalAccountKey, error) {
+	k, err := db.db.Get(externalAccountKeyIDsByAccountIDTable, []byte(referenceKey(provisionerID, accountID)))
+	if nosqlDB.IsErrNotFound(err) {
+		//nolint:nilnil // account without an EAB key
+		return nil, nil
+	} else if err != nil {
+		return nil, errors.Wrapf(err, "error loading ACME EAB key for account %s", accountID)
+	}
+
+	return db.GetExternalAccountKey(ctx, provisionerID, string(k))
 }
 
 func (db *DB) UpdateExternalAccountKey(ctx context.Context, provisionerID string, eak *acme.ExternalAccountKey) error {
@@ -263,9 +282,21 @@ func (db *DB) UpdateExternalAccountKey(ctx context.Context, provisionerID string
 		HmacKey:       eak.HmacKey,
 		CreatedAt:     eak.CreatedAt,
 		BoundAt:       eak.BoundAt,
+		Policy:        eak.Policy,
 	}
 
-	return db.save(ctx, nu.ID, nu, old, "external_account_key", externalAccountKeyTable)
+	if err := db.save(ctx, nu.ID, nu, old, "external_account_key", externalAccountKeyTable); err != nil {
+		return err
+	}
+
+	// index the key by the account it has been bound to
+	if nu.AccountID != "" && nu.AccountID != old.AccountID {
+		if err := db.db.Set(externalAccountKeyIDsByAccountIDTable, []byte(referenceKey(provisionerID, nu.AccountID)), []byte(nu.ID)); err != nil {
+			return errors.Wrapf(err, "error saving ACME EAB Key ID %s for account %s", nu.ID, nu.AccountID)
+		}
+	}
+
+	return nil
 }
 
 func (db *DB) addEAKID(ctx context.Context, provisionerID, eakID string) error {
@@ -1711,3 +1711,78 @@ func Test_removeElement(t *testing.T) {
 		})
 	}
 }
+
+func newEABMapDB(t *testing.T) nosql.DB {
+	t.Helper()
+	m := map[string][]byte{}
+	key := func(bucket, key []byte) string {
+		return string(bucket) + "/" + string(key)
+	}
+	return &certdb.MockNoSQLDB{
+		MGet: func(bucket, k []byte) ([]byte, error) {
+			if v, ok := m[key(bucket, k)]; ok {
+				return v, nil
+			}
+			return nil, nosqldb.ErrNotFound
+		},
+		MSet: func(bucket, k, value []byte) error {
+			m[key(bucket, k)] = value
+			return nil
+		},
+		MCmpAndSwap: func(bucket, k, old, nu []byte) ([]byte, bool, error) {
+			v, ok := m[key(bucket, k)]
+			if (ok || old != nil) && string(v) != string(old) {
+				return v, false, nil
+			}
+			m[key(bucket, k)] = nu
+			return nu, true, nil
+		},
+		MDel: func(bucket, k []byte) error {
+			delete(m, key(bucket, k))
+			return nil
+		},
+	}
+}
+
+func TestDB_ExternalAccountKey_boundAccount(t *testing.T) {
+	ctx := context.Background()
+	d := DB{db: newEABMapDB(t)}
+
+	eak, err := d.CreateExternalAccountKey(ctx, "provID", "tenant-1")
+	assert.FatalError(t, err)
+
+	got, err := d.GetExternalAccountKeyByAccountID(ctx, "provID", "accID")
+	assert.FatalError(t, err)
+	assert.Nil(t, got)
+
+	// Bind the key to an account and attach a policy.
+	eak.Policy = &acme.Policy{
+		X509: acme.X509Policy{
+			Allowed: acme.PolicyNames{DNSNames: []string{"*.tenant-1.example.com"}},
+		},
+	}
+	assert.FatalError(t, eak.BindTo(&acme.Account{ID: "accID"}))
+	assert.FatalError(t, d.UpdateExternalAccountKey(ctx, "provID", eak))
+
+	got, err = d.GetExternalAccountKeyByAccountID(ctx, "provID", "accID")
+	assert.FatalError(t, err)
+	assert.Equals(t, eak.ID, got.ID)
+	assert.Equals(t, "accID", got.AccountID)
+	assert.Equals(t, eak.Policy, got.Policy)
+
+	keys, _, err := d.GetExternalAccountKeys(ctx, "provID", "", 0)
+	assert.FatalError(t, err)
+	assert.Len(t, 1, keys)
+	assert.Equals(t, eak.Policy, keys[0].Policy)
+
+	// Accounts of other provisioners are not found.
+	got, err = d.GetExternalAccountKeyByAccountID(ctx, "otherProvID", "accID")
+	assert.FatalError(t, err)
+	assert.Nil(t, got)
+
+	// Deleting the key removes the account index.
+	assert.FatalError(t, d.DeleteExternalAccountKey(ctx, "provID", eak.ID))
+	got, err = d.GetExternalAccountKeyByAccountID(ctx, "provID", "accID")
+	assert.FatalError(t, err)
+	assert.Nil(t, got)
+}
@@ -0,0 +1,184 @@
+package nosql
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/acme"
+	"github.com/smallstep/nosql"
+)
+
+// DeleteExpired implements the acme.GarbageCollector interface. Orders with a
+// certificate are never removed, they are required to get the renewal
+// information of the certificate.
+func (db *DB) DeleteExpired(ctx context.Context, before time.Time) (*acme.GarbageCollectorStats, error) {
+	stats := new(acme.GarbageCollectorStats)
+	if err := db.deleteExpiredOrders(ctx, before, stats); err != nil {
+		return stats, err
+	}
+	if err := db.deleteExpiredAuthorizations(before, stats); err != nil {
+		return stats, err
+	}
+	if err := db.deleteExpiredNonces(before, stats); err != nil {
+		return stats, err
+	}
+	if err := db.deleteExpiredRateLimits(before, stats); err != nil {
+		return stats, err
+	}
+	return stats, nil
+}
+
+func (db *DB) deleteExpiredOrders(ctx context.Context, before time.Time, stats *acme.GarbageCollectorStats) error {
+	entries, err := db.db.List(orderTable)
+	if err != nil {
+		return errors.Wrap(err, "error listing orders")
+	}
+
+	deleted := make(map[string][]string)
+	for _, entry := range entries {
+		o := new(dbOrder)
+		if err := json.Unmarshal(entry.Value, o); err != nil {
+			return errors.Wrapf(err, "error unmarshaling dbOrder key '%s' into dbOrder struct", string(entry.Key))
+		}
+		if o.CertificateID != "" || o.ExpiresAt.IsZero() || !o.ExpiresAt.Before(before) {
+			continue
+		}
+		if err := db.db.Del(orderTable, entry.Key); err != nil {
+			return errors.Wrapf(err, "error deleting order %s", o.ID)
+		}
+		deleted[o.AccountID] = append(deleted[o.AccountID], o.ID)
+		stats.Orders++
+	}
+
+	// Remove the deleted orders from the orders by account index, the index
+	// of an account cannot reference an order that does not exist.
+	for accID, oids := range deleted {
+		if err := db.removeOrderIDs(ctx, accID, oids); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (db *DB) removeOrderIDs(ctx context.Context, accID string, removeOids []string) error {
+	ordersByAccountMux.Lock()
+	defer ordersByAccountMux.Unlock()
+
+	b, err := db.db.Get(ordersByAccountIDTable, []byte(accID))
+	switch {
+	case nosql.IsErrNotFound(err):
+		return nil
+	case err != nil:
+		return errors.Wrapf(err, "error loading orderIDs for account %s", accID)
+	}
+
+	var oldOids []string
+	if err := json.Unmarshal(b, &oldOids); err != nil {
+		return errors.Wrapf(err, "error unmarshaling orderIDs for account %s", accID)
+	}
+
+	removed := make(map[string]struct{}, len(removeOids))
+	for _, oid := range removeOids {
+		removed[oid] = struct{}{}
+	}
+	newOids := []string{}
+	for _, oid := range oldOids {
+		if _, ok := removed[oid]; !ok {
+			newOids = append(newOids, oid)
+		}
+	}
+	if len(newOids) == len(oldOids) {
+		return nil
+	}
+
+	var _new interface{} = newOids
+	if len(newOids) == 0 {
+		_new = nil
+	}
+	if err := db.save(ctx, accID, _new, oldOids, "orderIDsByAccountID", ordersByAccountIDTable); err != nil {
+		return errors.Wrapf(err, "error saving orderIDs index for account %s", accID)
+	}
+	return nil
+}
+
+func (db *DB) deleteExpiredAuthorizations(before time.Time, stats *acme.GarbageCollectorStats) error {
+	entries, err := db.db.List(authzTable)
+	if err != nil {
+		return errors.Wrap(err, "error listing authz")
+	}
+
+	for _, entry := range entries {
+		az := new(dbAuthz)
+		if err := json.Unmarshal(entry.Value, az); err != nil {
+			return errors.Wrapf(err, "error unmarshaling dbAuthz key '%s' into dbAuthz struct", string(entry.Key))
+		}
+		if az.ExpiresAt.IsZero() || !az.ExpiresAt.Before(before) {
+			continue
+		}
+		for _, chID := range az.ChallengeIDs {
+			err := db.db.Del(challengeTable, []byte(chID))
+			switch {
+			case nosql.IsErrNotFound(err):
+			case err != nil:
+				return errors.Wrapf(err, "error deleting challenge %s", chID)
+			default:
+				stats.Challenges++
+			}
+		}
+		if err := db.db.Del(authzTable, entry.Key); err != nil {
+			return errors.Wrapf(err, "error deleting authz %s", az.ID)
+		}
+		stats.Authorizations++
+	}
+	return nil
+}
+
+func (db *DB) deleteExpiredNonces(before time.Time, stats *acme.GarbageCollectorStats) error {
+	entries, err := db.db.List(nonceTable)
+	if err != nil {
+		return errors.Wrap(err, "error listing nonces")
+	}
+
+	for _, entry := range entries {
+		n := new(dbNonce)
+		if err := json.Unmarshal(entry.Value, n); err != nil {
+			return errors.Wrapf(err, "error unmarshaling dbNonce key '%s' into dbNonce struct", string(entry.Key))
+		}
+		if !n.CreatedAt.Before(before) {
+			continue
+		}
+		if err := db.db.Del(nonceTable, entry.Key); err != nil {
+			return errors.Wrapf(err, "error deleting nonce %s", string(entry.Key))
+		}
+		stats.Nonces++
+	}
+	return nil
+}
+
+// deleteExpiredRateLimits removes the rate limit counters whose window ended
+// before the given time. An expired counter is reset by the next event, so
+// the removal only drops the counters of accounts and identifiers that are no
+// longer used.
+func (db *DB) deleteExpiredRateLimits(before time.Time, stats *acme.GarbageCollectorStats) error {
+	entries, err := db.db.List(rateLimitTable)
+	if err != nil {
+		return errors.Wrap(err, "error listing rate limit counters")
+	}
+
+	for _, entry := range entries {
+		c := new(acme.RateLimitCounter)
+		if err := json.Unmarshal(entry.Value, c); err != nil {
+			return errors.Wrapf(err, "error unmarshaling rate limit counter %s", string(entry.Key))
+		}
+		if !c.ResetAt.Before(before) {
+			continue
+		}
+		if err := db.db.Del(rateLimitTable, entry.Key); err != nil {
+			return errors.Wrapf(err, "error deleting rate limit counter %s", string(entry.Key))
+		}
+		stats.RateLimits++
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package nosql
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/smallstep/certificates/acme"
+	"github.com/smallstep/nosql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDB_DeleteExpired(t *testing.T) {
+	rawDB, err := nosql.New("badgerv2", t.TempDir())
+	require.NoError(t, err)
+	db, err := New(rawDB)
+	require.NoError(t, err)
+
+	now := time.Now()
+	expired := now.Add(-2 * time.Hour)
+	before := now.Add(-time.Hour)
+
+	set := func(t *testing.T, table []byte, id string, v any) {
+		t.Helper()
+		b, err := json.Marshal(v)
+		require.NoError(t, err)
+		require.NoError(t, rawDB.Set(table, []byte(id), b))
+	}
+	exists := func(t *testing.T, table []byte, id string) bool {
+		t.Helper()
+		_, err := rawDB.Get(table, []byte(id))
+		if nosql.IsErrNotFound(err) {
+			return false
+		}
+		require.NoError(t, err)
+		return true
+	}
+
+	// Orders
+	set(t, orderTable, "expiredOrder", &dbOrder{ID: "expiredOrder", AccountID: "accID", Status: acme.StatusPending, ExpiresAt: expired})
+	set(t, orderTable, "validOrder", &dbOrder{ID: "validOrder", AccountID: "accID", Status: acme.StatusValid, ExpiresAt: expired, CertificateID: "certID"})
+	set(t, orderTable, "pendingOrder", &dbOrder{ID: "pendingOrder", AccountID: "accID", Status: acme.StatusPending, ExpiresAt: now.Add(time.Hour)})
+	set(t, ordersByAccountIDTable, "accID", []string{"expiredOrder", "pendingOrder"})
+
+	// Authorizations and challenges
+	set(t, authzTable, "expiredAuthz", &dbAuthz{ID: "expiredAuthz", ChallengeIDs: []string{"ch1", "ch2"}, ExpiresAt: expired})
+	set(t, authzTable, "pendingAuthz", &dbAuthz{ID: "pendingAuthz", ChallengeIDs: []string{"ch3"}, ExpiresAt: now.Add(time.Hour)})
+	set(t, challengeTable, "ch1", &dbChallenge{ID: "ch1", Status: acme.StatusPending})
+	set(t, challengeTable, "ch2", &dbChallenge{ID: "ch2", Status: acme.StatusPending})
+	set(t, challengeTable, "ch3", &dbChallenge{ID: "ch3", Status: acme.StatusPending})
+
+	// Nonces
+	set(t, nonceTable, "oldNonce", &dbNonce{ID: "oldNonce", CreatedAt: expired})
+	set(t, nonceTable, "newNonce", &dbNonce{ID: "newNonce", CreatedAt: now})
+
+	// Rate limit counters
+	set(t, rateLimitTable, "orders/prov/oldAcc", &acme.RateLimitCounter{Count: 5, ResetAt: expired})
+	set(t, rateLimitTable, "orders/prov/newAcc", &acme.RateLimitCounter{Count: 5, ResetAt: now.Add(time.Hour)})
+
+	stats, err := db.DeleteExpired(context.Background(), before)
+	require.NoError(t, err)
+	assert.Equal(t, &acme.GarbageCollectorStats{
+		Orders:         1,
+		Authorizations: 1,
+		Challenges:     2,
+		Nonces:         1,
+		RateLimits:     1,
+	}, stats)
+
+	assert.False(t, exists(t, orderTable, "expiredOrder"))
+	assert.True(t, exists(t, orderTable, "validOrder"))
+	assert.True(t, exists(t, orderTable, "pendingOrder"))
+	assert.False(t, exists(t, authzTable, "expiredAuthz"))
+	assert.True(t, exists(t, authzTable, "pendingAuthz"))
+	assert.False(t, exists(t, challengeTable, "ch1"))
+	assert.False(t, exists(t, challengeTable, "ch2"))
+	assert.True(t, exists(t, challengeTable, "ch3"))
+	assert.False(t, exists(t, nonceTable, "oldNonce"))
+	assert.True(t, exists(t, nonceTable, "newNonce"))
+	assert.False(t, exists(t, rateLimitTable, "orders/prov/oldAcc"))
+	assert.True(t, exists(t, rateLimitTable, "orders/prov/newAcc"))
+
+	b, err := rawDB.Get(ordersByAccountIDTable, []byte("accID"))
+	require.NoError(t, err)
+	var oids []string
+	require.NoError(t, json.Unmarshal(b, &oids))
+	assert.Equal(t, []string{"pendingOrder"}, oids)
+
+	// A second run does not remove anything else.
+	stats, err = db.DeleteExpired(context.Background(), before)
+	require.NoError(t, err)
+	assert.Equal(t, &acme.GarbageCollectorStats{}, stats)
+}
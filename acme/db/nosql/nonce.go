@@ -3,12 +3,12 @@ package nosql
 import (
 	"context"
 	"encoding/base64"
+	"encoding/json"
 	"time"
 
 	"github.com/pkg/errors"
 	"github.com/smallstep/certificates/acme"
 	"github.com/smallstep/nosql"
-	"github.com/smallstep/nosql/database"
 )
 
 // dbNonce contains nonce metadata used in the ACME protocol.
@@ -39,28 +39,43 @@ func (db *DB) CreateNonce(ctx context.Context) (acme.Nonce, error) {
 
 // DeleteNonce verifies that the nonce is valid (by checking if it exists),
 // and if so, consumes the nonce resource by deleting it from the database.
+//
+// The nonce is first marked as used with an atomic compare-and-swap, this way
+// a nonce can only be consumed once even if multiple instances of the CA
+// share the same database.
 func (db *DB) DeleteNonce(_ context.Context, nonce acme.Nonce) error {
-	err := db.db.Update(&database.Tx{
-		Operations: []*database.TxEntry{
-			{
-				Bucket: nonceTable,
-				Key:    []byte(nonce),
-				Cmd:    database.Get,
-			},
-			{
-				Bucket: nonceTable,
-				Key:    []byte(nonce),
-				Cmd:    database.Delete,
-			},
-		},
-	})
-
+	id := []byte(nonce)
+	b, err := db.db.Get(nonceTable, id)
 	switch {
 	case nosql.IsErrNotFound(err):
 		return acme.NewError(acme.ErrorBadNonceType, "nonce %s not found", string(nonce))
+	case err != nil:
+		return errors.Wrapf(err, "error loading nonce %s", string(nonce))
+	}
+
+	n := new(dbNonce)
+	if err := json.Unmarshal(b, n); err != nil {
+		return errors.Wrapf(err, "error unmarshaling nonce %s", string(nonce))
+	}
+	if !n.DeletedAt.IsZero() {
+		return acme.NewError(acme.ErrorBadNonceType, "nonce %s has already been used", string(nonce))
+	}
+
+	n.DeletedAt = clock.Now()
+	nu, err := json.Marshal(n)
+	if err != nil {
+		return errors.Wrapf(err, "error marshaling nonce %s", string(nonce))
+	}
+	_, swapped, err := db.db.CmpAndSwap(nonceTable, id, b, nu)
+	switch {
 	case err != nil:
 		return errors.Wrapf(err, "error deleting nonce %s", string(nonce))
-	default:
-		return nil
+	case !swapped:
+		return acme.NewError(acme.ErrorBadNonceType, "nonce %s has already been used", string(nonce))
 	}
+
+	// The nonce has been consumed, the marked record is only kept if it
+	// cannot be deleted, and it will be removed by the garbage collector.
+	_ = db.db.Del(nonceTable, id)
+	return nil
 }
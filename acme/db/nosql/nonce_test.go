@@ -3,6 +3,8 @@ package nosql
 import (
 	"context"
 	"encoding/json"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -84,6 +86,20 @@ func TestDB_CreateNonce(t *testing.T) {
 func TestDB_DeleteNonce(t *testing.T) {
 
 	nonceID := "nonceID"
+	n := &dbNonce{
+		ID:        nonceID,
+		CreatedAt: clock.Now(),
+	}
+	b, err := json.Marshal(n)
+	assert.FatalError(t, err)
+	used := &dbNonce{
+		ID:        nonceID,
+		CreatedAt: n.CreatedAt,
+		DeletedAt: clock.Now(),
+	}
+	usedB, err := json.Marshal(used)
+	assert.FatalError(t, err)
+
 	type test struct {
 		db      nosql.DB
 		err     error
@@ -93,53 +109,113 @@ func TestDB_DeleteNonce(t *testing.T) {
 		"fail/not-found": func(t *testing.T) test {
 			return test{
 				db: &db.MockNoSQLDB{
-					MUpdate: func(tx *database.Tx) error {
-						assert.Equals(t, tx.Operations[0].Bucket, nonceTable)
-						assert.Equals(t, tx.Operations[0].Key, []byte(nonceID))
-						assert.Equals(t, tx.Operations[0].Cmd, database.Get)
-
-						assert.Equals(t, tx.Operations[1].Bucket, nonceTable)
-						assert.Equals(t, tx.Operations[1].Key, []byte(nonceID))
-						assert.Equals(t, tx.Operations[1].Cmd, database.Delete)
-						return database.ErrNotFound
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						assert.Equals(t, bucket, nonceTable)
+						assert.Equals(t, key, []byte(nonceID))
+						return nil, database.ErrNotFound
 					},
 				},
 				acmeErr: acme.NewError(acme.ErrorBadNonceType, "nonce %s not found", nonceID),
 			}
 		},
-		"fail/db.Update-error": func(t *testing.T) test {
+		"fail/db.Get-error": func(t *testing.T) test {
 			return test{
 				db: &db.MockNoSQLDB{
-					MUpdate: func(tx *database.Tx) error {
-						assert.Equals(t, tx.Operations[0].Bucket, nonceTable)
-						assert.Equals(t, tx.Operations[0].Key, []byte(nonceID))
-						assert.Equals(t, tx.Operations[0].Cmd, database.Get)
-
-						assert.Equals(t, tx.Operations[1].Bucket, nonceTable)
-						assert.Equals(t, tx.Operations[1].Key, []byte(nonceID))
-						assert.Equals(t, tx.Operations[1].Cmd, database.Delete)
-						return errors.New("force")
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						return nil, errors.New("force")
+					},
+				},
+				err: errors.New("error loading nonce nonceID: force"),
+			}
+		},
+		"fail/unmarshal-error": func(t *testing.T) test {
+			return test{
+				db: &db.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						return []byte("foo"), nil
+					},
+				},
+				err: errors.New("error unmarshaling nonce nonceID"),
+			}
+		},
+		"fail/already-used": func(t *testing.T) test {
+			return test{
+				db: &db.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						return usedB, nil
+					},
+				},
+				acmeErr: acme.NewError(acme.ErrorBadNonceType, "nonce %s has already been used", nonceID),
+			}
+		},
+		"fail/db.CmpAndSwap-error": func(t *testing.T) test {
+			return test{
+				db: &db.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						return b, nil
+					},
+					MCmpAndSwap: func(bucket, key, old, nu []byte) ([]byte, bool, error) {
+						return nil, false, errors.New("force")
 					},
 				},
 				err: errors.New("error deleting nonce nonceID: force"),
 			}
 		},
+		"fail/db.CmpAndSwap-not-swapped": func(t *testing.T) test {
+			return test{
+				db: &db.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						return b, nil
+					},
+					MCmpAndSwap: func(bucket, key, old, nu []byte) ([]byte, bool, error) {
+						return usedB, false, nil
+					},
+				},
+				acmeErr: acme.NewError(acme.ErrorBadNonceType, "nonce %s has already been used", nonceID),
+			}
+		},
 		"ok": func(t *testing.T) test {
 			return test{
 				db: &db.MockNoSQLDB{
-					MUpdate: func(tx *database.Tx) error {
-						assert.Equals(t, tx.Operations[0].Bucket, nonceTable)
-						assert.Equals(t, tx.Operations[0].Key, []byte(nonceID))
-						assert.Equals(t, tx.Operations[0].Cmd, database.Get)
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						assert.Equals(t, bucket, nonceTable)
+						assert.Equals(t, key, []byte(nonceID))
+						return b, nil
+					},
+					MCmpAndSwap: func(bucket, key, old, nu []byte) ([]byte, bool, error) {
+						assert.Equals(t, bucket, nonceTable)
+						assert.Equals(t, key, []byte(nonceID))
+						assert.Equals(t, old, b)
 
-						assert.Equals(t, tx.Operations[1].Bucket, nonceTable)
-						assert.Equals(t, tx.Operations[1].Key, []byte(nonceID))
-						assert.Equals(t, tx.Operations[1].Cmd, database.Delete)
+						dbn := new(dbNonce)
+						assert.FatalError(t, json.Unmarshal(nu, dbn))
+						assert.Equals(t, dbn.ID, nonceID)
+						assert.False(t, dbn.DeletedAt.IsZero())
+						return nu, true, nil
+					},
+					MDel: func(bucket, key []byte) error {
+						assert.Equals(t, bucket, nonceTable)
+						assert.Equals(t, key, []byte(nonceID))
 						return nil
 					},
 				},
 			}
 		},
+		"ok/db.Del-error": func(t *testing.T) test {
+			return test{
+				db: &db.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						return b, nil
+					},
+					MCmpAndSwap: func(bucket, key, old, nu []byte) ([]byte, bool, error) {
+						return nu, true, nil
+					},
+					MDel: func(bucket, key []byte) error {
+						return errors.New("force")
+					},
+				},
+			}
+		},
 	}
 	for name, run := range tests {
 		tc := run(t)
@@ -166,3 +242,36 @@ func TestDB_DeleteNonce(t *testing.T) {
 		})
 	}
 }
+
+func TestDB_DeleteNonce_replay(t *testing.T) {
+	rawDB, err := nosql.New("badgerv2", t.TempDir())
+	assert.FatalError(t, err)
+	d, err := New(rawDB)
+	assert.FatalError(t, err)
+
+	nonce, err := d.CreateNonce(context.Background())
+	assert.FatalError(t, err)
+
+	// Only one of the concurrent requests using the same nonce can succeed.
+	var (
+		wg        sync.WaitGroup
+		successes atomic.Int32
+	)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := d.DeleteNonce(context.Background(), nonce); err == nil {
+				successes.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equals(t, int32(1), successes.Load())
+
+	err = d.DeleteNonce(context.Background(), nonce)
+	var ae *acme.Error
+	if assert.True(t, errors.As(err, &ae)) {
+		assert.Equals(t, acme.NewError(acme.ErrorBadNonceType, "").Type, ae.Type)
+	}
+}
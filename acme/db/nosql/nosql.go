@@ -23,8 +23,10 @@ var (
 	externalAccountKeyTable                   = []byte("acme_external_account_keys")
 	externalAccountKeyIDsByReferenceTable     = []byte("acme_external_account_keyID_reference_index")
 	externalAccountKeyIDsByProvisionerIDTable = []byte("acme_external_account_keyID_provisionerID_index")
+	externalAccountKeyIDsByAccountIDTable     = []byte("acme_external_account_keyID_accountID_index")
 	wireDpopTokenTable                        = []byte("wire_acme_dpop_token")
 	wireOidcTokenTable                        = []byte("wire_acme_oidc_token")
+	rateLimitTable                            = []byte("acme_rate_limits")
 )
 
 // DB is a struct that implements the AcmeDB interface.
@@ -38,7 +40,8 @@ func New(db nosqlDB.DB) (*DB, error) {
 		challengeTable, nonceTable, orderTable, ordersByAccountIDTable,
 		certTable, certBySerialTable, externalAccountKeyTable,
 		externalAccountKeyIDsByReferenceTable, externalAccountKeyIDsByProvisionerIDTable,
-		wireDpopTokenTable, wireOidcTokenTable,
+		externalAccountKeyIDsByAccountIDTable,
+		wireDpopTokenTable, wireOidcTokenTable, rateLimitTable,
 	}
 	for _, b := range tables {
 		if err := db.CreateTable(b); err != nil {
@@ -48,6 +51,21 @@ func New(db nosqlDB.DB) (*DB, error) {
 	return &DB{db}, nil
 }
 
+// changedSinceLastReadError is the error returned by save if the stored value
+// is not the expected one, e.g. because it has been modified concurrently.
+type changedSinceLastReadError struct {
+	typ string
+}
+
+func (e *changedSinceLastReadError) Error() string {
+	return "error saving acme " + e.typ + "; changed since last read"
+}
+
+func isChangedSinceLastRead(err error) bool {
+	var e *changedSinceLastReadError
+	return errors.As(err, &e)
+}
+
 // save writes the new data to the database, overwriting the old data if it
 // existed.
 func (db *DB) save(_ context.Context, id string, nu, old interface{}, typ string, table []byte) error {
@@ -78,7 +96,7 @@ func (db *DB) save(_ context.Context, id string, nu, old interface{}, typ string
 	case err != nil:
 		return errors.Wrapf(err, "error saving acme %s", typ)
 	case !swapped:
-		return errors.Errorf("error saving acme %s; changed since last read", typ)
+		return &changedSinceLastReadError{typ: typ}
 	default:
 		return nil
 	}
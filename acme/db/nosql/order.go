@@ -23,6 +23,7 @@ type dbOrder struct {
 	Status           acme.Status       `json:"status"`
 	NotBefore        time.Time         `json:"notBefore,omitempty"`
 	NotAfter         time.Time         `json:"notAfter,omitempty"`
+	Profile          string            `json:"profile,omitempty"`
 	CreatedAt        time.Time         `json:"createdAt"`
 	ExpiresAt        time.Time         `json:"expiresAt,omitempty"`
 	CertificateID    string            `json:"certificate,omitempty"`
@@ -66,6 +67,7 @@ func (db *DB) GetOrder(ctx context.Context, id string) (*acme.Order, error) {
 		Identifiers:      dbo.Identifiers,
 		NotBefore:        dbo.NotBefore,
 		NotAfter:         dbo.NotAfter,
+		Profile:          dbo.Profile,
 		AuthorizationIDs: dbo.AuthorizationIDs,
 		Error:            dbo.Error,
 	}
@@ -92,6 +94,7 @@ func (db *DB) CreateOrder(ctx context.Context, o *acme.Order) error {
 		Identifiers:      o.Identifiers,
 		NotBefore:        o.NotBefore,
 		NotAfter:         o.NotAfter,
+		Profile:          o.Profile,
 		AuthorizationIDs: o.AuthorizationIDs,
 	}
 	if err := db.save(ctx, o.ID, dbo, nil, "order", orderTable); err != nil {
@@ -121,10 +124,29 @@ func (db *DB) UpdateOrder(ctx context.Context, o *acme.Order) error {
 	return db.save(ctx, old.ID, nu, old, "order", orderTable)
 }
 
+// maxOrderIDsUpdateAttempts is the number of times the orders by account index
+// is read and written if it has been modified concurrently, e.g. by another
+// instance of the CA sharing the same database.
+const maxOrderIDsUpdateAttempts = 3
+
 func (db *DB) updateAddOrderIDs(ctx context.Context, accID string, includeReadyOrders bool, addOids ...string) ([]string, error) {
 	ordersByAccountMux.Lock()
 	defer ordersByAccountMux.Unlock()
 
+	var err error
+	for i := 0; i < maxOrderIDsUpdateAttempts; i++ {
+		var pendOids []string
+		pendOids, err = db.tryUpdateAddOrderIDs(ctx, accID, includeReadyOrders, addOids...)
+		if !isChangedSinceLastRead(err) {
+			return pendOids, err
+		}
+	}
+
+	db.deleteOrders(addOids)
+	return nil, err
+}
+
+func (db *DB) tryUpdateAddOrderIDs(ctx context.Context, accID string, includeReadyOrders bool, addOids ...string) ([]string, error) {
 	var oldOids []string
 	b, err := db.db.Get(ordersByAccountIDTable, []byte(accID))
 	if err != nil {
@@ -172,17 +194,25 @@ func (db *DB) updateAddOrderIDs(ctx context.Context, accID string, includeReadyO
 		_new = nil
 	}
 	if err = db.save(ctx, accID, _new, _old, "orderIDsByAccountID", ordersByAccountIDTable); err != nil {
-		// Delete all orders that may have been previously stored if orderIDsByAccountID update fails.
-		for _, oid := range addOids {
-			// Ignore error from delete -- we tried our best.
-			// TODO when we have logging w/ request ID tracking, logging this error.
-			db.db.Del(orderTable, []byte(oid))
+		// The update is retried if the index has been modified concurrently.
+		if !isChangedSinceLastRead(err) {
+			db.deleteOrders(addOids)
 		}
 		return nil, errors.Wrapf(err, "error saving orderIDs index for account %s", accID)
 	}
 	return pendOids, nil
 }
 
+// deleteOrders deletes all orders that may have been previously stored if
+// orderIDsByAccountID update fails.
+func (db *DB) deleteOrders(oids []string) {
+	for _, oid := range oids {
+		// Ignore error from delete -- we tried our best.
+		// TODO when we have logging w/ request ID tracking, logging this error.
+		db.db.Del(orderTable, []byte(oid))
+	}
+}
+
 // GetOrdersByAccountID returns a list of order IDs owned by the account.
 func (db *DB) GetOrdersByAccountID(ctx context.Context, accID string) ([]string, error) {
 	return db.updateAddOrderIDs(ctx, accID, false)
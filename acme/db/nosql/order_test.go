@@ -706,6 +706,63 @@ func TestDB_updateAddOrderIDs(t *testing.T) {
 				err:     errors.Errorf("error saving orderIDs index for account %s", accID),
 			}
 		},
+		"fail/db.save-order-changed": func(t *testing.T) test {
+			addOids := []string{"foo"}
+			casCount, delCount := 0, 0
+			return test{
+				db: &db.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						assert.Equals(t, bucket, ordersByAccountIDTable)
+						return nil, database.ErrNotFound
+					},
+					MCmpAndSwap: func(bucket, key, old, nu []byte) ([]byte, bool, error) {
+						casCount++
+						assert.Equals(t, bucket, ordersByAccountIDTable)
+						return []byte(`["bar"]`), false, nil
+					},
+					MDel: func(bucket, key []byte) error {
+						delCount++
+						assert.Equals(t, casCount, 3)
+						assert.Equals(t, delCount, 1)
+						assert.Equals(t, bucket, orderTable)
+						assert.Equals(t, key, []byte("foo"))
+						return nil
+					},
+				},
+				addOids: addOids,
+				err:     errors.Errorf("error saving orderIDs index for account %s", accID),
+			}
+		},
+		"ok/retry-changed": func(t *testing.T) test {
+			addOids := []string{"foo"}
+			b, err := json.Marshal(addOids)
+			assert.FatalError(t, err)
+			casCount := 0
+			return test{
+				db: &db.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						assert.Equals(t, bucket, ordersByAccountIDTable)
+						return nil, database.ErrNotFound
+					},
+					MCmpAndSwap: func(bucket, key, old, nu []byte) ([]byte, bool, error) {
+						casCount++
+						assert.Equals(t, bucket, ordersByAccountIDTable)
+						assert.Equals(t, nu, b)
+						if casCount == 1 {
+							// Modified by another instance.
+							return []byte(`["bar"]`), false, nil
+						}
+						return nu, true, nil
+					},
+					MDel: func(bucket, key []byte) error {
+						assert.FatalError(t, errors.New("delete should not be called"))
+						return nil
+					},
+				},
+				addOids: addOids,
+				res:     addOids,
+			}
+		},
 		"ok/no-old": func(t *testing.T) test {
 			return test{
 				db: &db.MockNoSQLDB{
@@ -0,0 +1,67 @@
+package nosql
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/nosql"
+
+	"github.com/smallstep/certificates/acme"
+)
+
+// rateLimitMaxRetries is the number of times the update of a rate limit
+// counter is retried if it is modified concurrently.
+const rateLimitMaxRetries = 10
+
+// GetRateLimitCounter retrieves the rate limit counter with the given key.
+// Implements the acme.RateLimitStore interface.
+func (db *DB) GetRateLimitCounter(_ context.Context, key string) (*acme.RateLimitCounter, error) {
+	b, err := db.db.Get(rateLimitTable, []byte(key))
+	switch {
+	case nosql.IsErrNotFound(err):
+		return nil, acme.ErrNotFound
+	case err != nil:
+		return nil, errors.Wrapf(err, "error loading rate limit counter %s", key)
+	}
+	c := new(acme.RateLimitCounter)
+	if err := json.Unmarshal(b, c); err != nil {
+		return nil, errors.Wrapf(err, "error unmarshaling rate limit counter %s", key)
+	}
+	return c, nil
+}
+
+// IncrementRateLimitCounter adds an event to the rate limit counter with the
+// given key and returns the updated counter. The counter is updated with an
+// atomic compare-and-swap, so it can be shared by multiple instances of the
+// CA. Implements the acme.RateLimitStore interface.
+func (db *DB) IncrementRateLimitCounter(_ context.Context, key string, window time.Duration) (*acme.RateLimitCounter, error) {
+	for i := 0; i < rateLimitMaxRetries; i++ {
+		var old *acme.RateLimitCounter
+		oldb, err := db.db.Get(rateLimitTable, []byte(key))
+		switch {
+		case nosql.IsErrNotFound(err):
+			// First event, the counter does not exist yet.
+		case err != nil:
+			return nil, errors.Wrapf(err, "error loading rate limit counter %s", key)
+		default:
+			old = new(acme.RateLimitCounter)
+			if err := json.Unmarshal(oldb, old); err != nil {
+				return nil, errors.Wrapf(err, "error unmarshaling rate limit counter %s", key)
+			}
+		}
+
+		c := old.Increment(clock.Now(), window)
+		b, err := json.Marshal(c)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error marshaling rate limit counter %s", key)
+		}
+		if _, swapped, err := db.db.CmpAndSwap(rateLimitTable, []byte(key), oldb, b); err != nil {
+			return nil, errors.Wrapf(err, "error saving rate limit counter %s", key)
+		} else if swapped {
+			return c, nil
+		}
+	}
+	return nil, errors.Errorf("error updating rate limit counter %s: too many concurrent updates", key)
+}
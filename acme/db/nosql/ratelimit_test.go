@@ -0,0 +1,87 @@
+package nosql
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/smallstep/assert"
+	"github.com/smallstep/certificates/acme"
+	"github.com/smallstep/certificates/db"
+	"github.com/smallstep/nosql"
+	"github.com/smallstep/nosql/database"
+)
+
+func TestDB_IncrementRateLimitCounter(t *testing.T) {
+	rawDB, err := nosql.New("badgerv2", t.TempDir())
+	assert.FatalError(t, err)
+	d, err := New(rawDB)
+	assert.FatalError(t, err)
+	ctx := context.Background()
+
+	_, err = d.GetRateLimitCounter(ctx, "orders/prov/acc")
+	assert.True(t, acme.IsErrNotFound(err))
+
+	// Concurrent increments are not lost.
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := d.IncrementRateLimitCounter(ctx, "orders/prov/acc", time.Hour)
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	c, err := d.GetRateLimitCounter(ctx, "orders/prov/acc")
+	assert.FatalError(t, err)
+	assert.Equals(t, int64(10), c.Count)
+	assert.True(t, c.ResetAt.After(time.Now().Add(59*time.Minute)))
+
+	// Expired counters are reset.
+	b, err := json.Marshal(&acme.RateLimitCounter{Count: 100, ResetAt: time.Now().Add(-time.Second)})
+	assert.FatalError(t, err)
+	assert.FatalError(t, rawDB.Set(rateLimitTable, []byte("orders/prov/acc"), b))
+	c, err = d.IncrementRateLimitCounter(ctx, "orders/prov/acc", time.Hour)
+	assert.FatalError(t, err)
+	assert.Equals(t, int64(1), c.Count)
+}
+
+func TestDB_IncrementRateLimitCounter_errors(t *testing.T) {
+	ctx := context.Background()
+	d := DB{db: &db.MockNoSQLDB{
+		MGet: func(bucket, key []byte) ([]byte, error) {
+			return nil, errors.New("force")
+		},
+	}}
+	_, err := d.GetRateLimitCounter(ctx, "key")
+	assert.Error(t, err)
+	_, err = d.IncrementRateLimitCounter(ctx, "key", time.Hour)
+	assert.Error(t, err)
+
+	d = DB{db: &db.MockNoSQLDB{
+		MGet: func(bucket, key []byte) ([]byte, error) {
+			return []byte("{"), nil
+		},
+	}}
+	_, err = d.GetRateLimitCounter(ctx, "key")
+	assert.Error(t, err)
+	_, err = d.IncrementRateLimitCounter(ctx, "key", time.Hour)
+	assert.Error(t, err)
+
+	// The counter is always modified concurrently.
+	d = DB{db: &db.MockNoSQLDB{
+		MGet: func(bucket, key []byte) ([]byte, error) {
+			return nil, database.ErrNotFound
+		},
+		MCmpAndSwap: func(bucket, key, old, nu []byte) ([]byte, bool, error) {
+			return nil, false, nil
+		},
+	}}
+	_, err = d.IncrementRateLimitCounter(ctx, "key", time.Hour)
+	assert.Error(t, err)
+}
@@ -0,0 +1,161 @@
+package acme
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+// maxCNAMEHops is the maximum number of CNAME records followed when looking up
+// the TXT records of a dns-01 challenge.
+const maxCNAMEHops = 8
+
+// dns01NameServerPort is the port used to query the authoritative name servers.
+var dns01NameServerPort = "53"
+
+// dns01Resolver looks up the TXT records of dns-01 challenges using the
+// resolvers and propagation checks configured in the provisioner.
+type dns01Resolver struct {
+	resolver         *net.Resolver
+	timeout          time.Duration
+	propagationCheck bool
+	nameServerPort   string
+}
+
+// newDNS01Resolver returns the resolver for the given options. It returns nil
+// if the options are not set.
+func newDNS01Resolver(opts *provisioner.DNS01Options) *dns01Resolver {
+	if opts == nil {
+		return nil
+	}
+	r := &dns01Resolver{
+		resolver:         net.DefaultResolver,
+		timeout:          opts.GetTimeout(),
+		propagationCheck: opts.IsPropagationCheck(),
+		nameServerPort:   dns01NameServerPort,
+	}
+	if addrs := opts.GetResolvers(); len(addrs) > 0 {
+		r.resolver = newNetResolver(addrs, r.timeout)
+	}
+	return r
+}
+
+// dns01ResolverFromContext returns the dns-01 resolver configured in the
+// provisioner in the context, or nil if none is configured.
+func dns01ResolverFromContext(ctx context.Context) *dns01Resolver {
+	p, ok := ProvisionerFromContext(ctx)
+	if !ok {
+		return nil
+	}
+	return newDNS01Resolver(p.GetOptions().GetDNS01Options())
+}
+
+// newNetResolver returns a resolver that sends the queries to the given
+// addresses. Consecutive connections rotate through the addresses, so the
+// retries of a query are sent to a different server.
+func newNetResolver(addrs []string, timeout time.Duration) *net.Resolver {
+	var next uint32
+	dialer := &net.Dialer{Timeout: timeout}
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			i := atomic.AddUint32(&next, 1) - 1
+			return dialer.DialContext(ctx, network, addrs[int(i)%len(addrs)])
+		},
+	}
+}
+
+// LookupTXT returns the TXT records of the given name. It explicitly follows
+// the CNAME records, so challenges delegated to a different zone can be
+// validated even if the resolver does not follow them.
+func (r *dns01Resolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	target := r.lookupCNAME(ctx, fqdn(name))
+	return r.resolver.LookupTXT(ctx, target)
+}
+
+// CheckPropagation returns an error if any of the authoritative name servers
+// of the given name does not return the expected TXT record.
+func (r *dns01Resolver) CheckPropagation(ctx context.Context, name, expected string) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	target := r.lookupCNAME(ctx, fqdn(name))
+	nameServers, err := r.lookupNameServers(ctx, target)
+	if err != nil {
+		return err
+	}
+
+	for _, ns := range nameServers {
+		addrs, err := r.resolver.LookupHost(ctx, ns)
+		if err != nil {
+			return fmt.Errorf("error looking up name server %s: %w", ns, err)
+		}
+		for i, addr := range addrs {
+			addrs[i] = net.JoinHostPort(addr, r.nameServerPort)
+		}
+		records, err := newNetResolver(addrs, r.timeout).LookupTXT(ctx, target)
+		if err != nil {
+			return fmt.Errorf("error looking up TXT records for %s on name server %s: %w", target, ns, err)
+		}
+		if !slices.Contains(records, expected) {
+			return fmt.Errorf("TXT record for %s has not propagated to name server %s", target, ns)
+		}
+	}
+
+	return nil
+}
+
+// lookupCNAME follows the CNAME records of the given name and returns the
+// last name in the chain.
+func (r *dns01Resolver) lookupCNAME(ctx context.Context, name string) string {
+	for i := 0; i < maxCNAMEHops; i++ {
+		cname, err := r.resolver.LookupCNAME(ctx, name)
+		if err != nil || cname == "" || strings.EqualFold(cname, name) {
+			break
+		}
+		name = cname
+	}
+	return name
+}
+
+// lookupNameServers returns the authoritative name servers of the zone
+// containing the given name.
+func (r *dns01Resolver) lookupNameServers(ctx context.Context, name string) ([]string, error) {
+	labels := strings.Split(strings.TrimSuffix(name, "."), ".")
+	for i := range labels {
+		zone := strings.Join(labels[i:], ".") + "."
+		records, err := r.resolver.LookupNS(ctx, zone)
+		if err != nil {
+			var dnsErr *net.DNSError
+			if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+				continue
+			}
+			return nil, fmt.Errorf("error looking up name servers for %s: %w", zone, err)
+		}
+		if len(records) > 0 {
+			nameServers := make([]string, len(records))
+			for j, ns := range records {
+				nameServers[j] = ns.Host
+			}
+			return nameServers, nil
+		}
+	}
+	return nil, fmt.Errorf("error looking up name servers for %s: not found", name)
+}
+
+func fqdn(name string) string {
+	if strings.HasSuffix(name, ".") {
+		return name
+	}
+	return name + "."
+}
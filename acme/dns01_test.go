@@ -0,0 +1,331 @@
+package acme
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.step.sm/crypto/jose"
+	"golang.org/x/net/dns/dnsmessage"
+
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+// testDNSZone is a set of records indexed by lower case fully qualified names.
+type testDNSZone struct {
+	a     map[string]string
+	cname map[string]string
+	ns    map[string][]string
+	txt   map[string][]string
+}
+
+func (z *testDNSZone) exists(name string) bool {
+	_, a := z.a[name]
+	_, cname := z.cname[name]
+	_, ns := z.ns[name]
+	_, txt := z.txt[name]
+	return a || cname || ns || txt
+}
+
+// answer returns the records of the given name and type, following the CNAME
+// records like a recursive resolver.
+func (z *testDNSZone) answer(q dnsmessage.Question) ([]dnsmessage.Resource, dnsmessage.RCode) {
+	var answers []dnsmessage.Resource
+	name := strings.ToLower(q.Name.String())
+	for i := 0; i < maxCNAMEHops; i++ {
+		target, ok := z.cname[name]
+		if !ok {
+			break
+		}
+		answers = append(answers, dnsmessage.Resource{
+			Header: dnsmessage.ResourceHeader{Name: dnsmessage.MustNewName(name), Type: dnsmessage.TypeCNAME, Class: dnsmessage.ClassINET, TTL: 60},
+			Body:   &dnsmessage.CNAMEResource{CNAME: dnsmessage.MustNewName(target)},
+		})
+		if q.Type == dnsmessage.TypeCNAME {
+			return answers, dnsmessage.RCodeSuccess
+		}
+		name = target
+	}
+	if !z.exists(name) {
+		return answers, dnsmessage.RCodeNameError
+	}
+
+	hdr := dnsmessage.ResourceHeader{Name: dnsmessage.MustNewName(name), Type: q.Type, Class: dnsmessage.ClassINET, TTL: 60}
+	switch q.Type {
+	case dnsmessage.TypeA:
+		if ip, ok := z.a[name]; ok {
+			var a [4]byte
+			copy(a[:], net.ParseIP(ip).To4())
+			answers = append(answers, dnsmessage.Resource{Header: hdr, Body: &dnsmessage.AResource{A: a}})
+		}
+	case dnsmessage.TypeNS:
+		for _, ns := range z.ns[name] {
+			answers = append(answers, dnsmessage.Resource{Header: hdr, Body: &dnsmessage.NSResource{NS: dnsmessage.MustNewName(ns)}})
+		}
+	case dnsmessage.TypeTXT:
+		for _, txt := range z.txt[name] {
+			answers = append(answers, dnsmessage.Resource{Header: hdr, Body: &dnsmessage.TXTResource{TXT: []string{txt}}})
+		}
+	}
+	return answers, dnsmessage.RCodeSuccess
+}
+
+// newTestDNSServer starts a UDP DNS server serving the given zone and returns
+// its address.
+func newTestDNSServer(t *testing.T, zone *testDNSZone) string {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			var req dnsmessage.Message
+			if err := req.Unpack(buf[:n]); err != nil || len(req.Questions) != 1 {
+				continue
+			}
+			answers, rcode := zone.answer(req.Questions[0])
+			resp := dnsmessage.Message{
+				Header: dnsmessage.Header{
+					ID:                 req.ID,
+					Response:           true,
+					Authoritative:      true,
+					RecursionDesired:   req.RecursionDesired,
+					RecursionAvailable: true,
+					RCode:              rcode,
+				},
+				Questions: req.Questions,
+				Answers:   answers,
+			}
+			b, err := resp.Pack()
+			if err != nil {
+				continue
+			}
+			_, _ = conn.WriteTo(b, addr)
+		}
+	}()
+
+	return conn.LocalAddr().String()
+}
+
+func newTestDNS01Resolver(t *testing.T, resolver, nameServer string) *dns01Resolver {
+	t.Helper()
+	r := newDNS01Resolver(&provisioner.DNS01Options{
+		Resolvers:        []string{resolver},
+		PropagationCheck: true,
+		Timeout:          &provisioner.Duration{Duration: 2 * time.Second},
+	})
+	if nameServer != "" {
+		_, port, err := net.SplitHostPort(nameServer)
+		require.NoError(t, err)
+		r.nameServerPort = port
+	}
+	return r
+}
+
+func Test_newDNS01Resolver(t *testing.T) {
+	assert.Nil(t, newDNS01Resolver(nil))
+
+	r := newDNS01Resolver(&provisioner.DNS01Options{})
+	assert.Equal(t, net.DefaultResolver, r.resolver)
+	assert.Equal(t, 10*time.Second, r.timeout)
+	assert.False(t, r.propagationCheck)
+	assert.Equal(t, "53", r.nameServerPort)
+
+	r = newDNS01Resolver(&provisioner.DNS01Options{
+		Resolvers:        []string{"10.0.0.53"},
+		PropagationCheck: true,
+	})
+	assert.NotEqual(t, net.DefaultResolver, r.resolver)
+	assert.True(t, r.propagationCheck)
+}
+
+func Test_dns01Resolver_LookupTXT(t *testing.T) {
+	addr := newTestDNSServer(t, &testDNSZone{
+		cname: map[string]string{
+			"_acme-challenge.delegated.example.com.": "_acme-challenge.delegated.acme.example.net.",
+		},
+		txt: map[string][]string{
+			"_acme-challenge.www.example.com.":            {"www-value"},
+			"_acme-challenge.delegated.acme.example.net.": {"delegated-value"},
+		},
+	})
+	r := newTestDNS01Resolver(t, addr, "")
+
+	tests := []struct {
+		name    string
+		want    []string
+		wantErr bool
+	}{
+		{"_acme-challenge.www.example.com", []string{"www-value"}, false},
+		{"_acme-challenge.www.example.com.", []string{"www-value"}, false},
+		{"_acme-challenge.delegated.example.com", []string{"delegated-value"}, false},
+		{"_acme-challenge.missing.example.com", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := r.LookupTXT(context.Background(), tt.name)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_dns01Resolver_CheckPropagation(t *testing.T) {
+	// The authoritative name server of example.com has the record of www,
+	// but the record of other has not been propagated yet.
+	nameServer := newTestDNSServer(t, &testDNSZone{
+		txt: map[string][]string{
+			"_acme-challenge.www.example.com.":   {"expected"},
+			"_acme-challenge.other.example.com.": {"old-value"},
+		},
+	})
+	resolver := newTestDNSServer(t, &testDNSZone{
+		a: map[string]string{
+			"ns1.example.com.": "127.0.0.1",
+		},
+		cname: map[string]string{
+			"_acme-challenge.delegated.example.org.": "_acme-challenge.www.example.com.",
+		},
+		ns: map[string][]string{
+			"example.com.": {"ns1.example.com."},
+			"example.net.": {"ns1.example.net."},
+		},
+		txt: map[string][]string{
+			"_acme-challenge.www.example.com.":   {"expected"},
+			"_acme-challenge.other.example.com.": {"expected"},
+			"_acme-challenge.www.example.net.":   {"expected"},
+		},
+	})
+	r := newTestDNS01Resolver(t, resolver, nameServer)
+
+	tests := []struct {
+		name    string
+		wantErr string
+	}{
+		{"_acme-challenge.www.example.com", ""},
+		{"_acme-challenge.delegated.example.org", ""},
+		{"_acme-challenge.other.example.com", "TXT record for _acme-challenge.other.example.com. has not propagated to name server ns1.example.com."},
+		{"_acme-challenge.www.example.net", "error looking up name server ns1.example.net."},
+		{"_acme-challenge.www.example.org", "error looking up name servers for _acme-challenge.www.example.org.: not found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := r.CheckPropagation(context.Background(), tt.name, "expected")
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestDNS01Validate_withResolvers(t *testing.T) {
+	jwk, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+	require.NoError(t, err)
+	keyAuth, err := KeyAuthorization("token", jwk)
+	require.NoError(t, err)
+	h := sha256.Sum256([]byte(keyAuth))
+	expected := base64.RawURLEncoding.EncodeToString(h[:])
+
+	nameServer := newTestDNSServer(t, &testDNSZone{
+		txt: map[string][]string{
+			"_acme-challenge.zap.internal.": {expected},
+		},
+	})
+	resolver := newTestDNSServer(t, &testDNSZone{
+		a: map[string]string{
+			"ns1.internal.": "127.0.0.1",
+		},
+		cname: map[string]string{
+			"_acme-challenge.zap.corp.": "_acme-challenge.zap.internal.",
+		},
+		ns: map[string][]string{
+			"internal.": {"ns1.internal."},
+			"corp.":     {"ns1.internal."},
+		},
+		txt: map[string][]string{
+			"_acme-challenge.zap.internal.": {expected},
+			"_acme-challenge.new.internal.": {expected},
+		},
+	})
+	_, port, err := net.SplitHostPort(nameServer)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		value      string
+		wantStatus Status
+		wantErr    *Error
+	}{
+		{"ok/wildcard", "*.zap.internal", StatusValid, nil},
+		{"ok/cname", "*.zap.corp", StatusValid, nil},
+		{"ok/not-propagated", "new.internal", StatusPending, NewError(ErrorDNSType,
+			"error checking propagation of TXT records for domain new.internal: "+
+				"TXT record for _acme-challenge.new.internal. has not propagated to name server ns1.internal.")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ch := &Challenge{
+				ID:     "chID",
+				Token:  "token",
+				Value:  tt.value,
+				Status: StatusPending,
+			}
+			prov := &MockProvisioner{
+				MgetOptions: func() *provisioner.Options {
+					return &provisioner.Options{
+						DNS01: &provisioner.DNS01Options{
+							Resolvers:        []string{resolver},
+							PropagationCheck: true,
+							Timeout:          &provisioner.Duration{Duration: 2 * time.Second},
+						},
+					}
+				},
+			}
+			db := &MockDB{
+				MockUpdateChallenge: func(ctx context.Context, updch *Challenge) error {
+					assert.Equal(t, tt.wantStatus, updch.Status)
+					if tt.wantErr == nil {
+						assert.Nil(t, updch.Error)
+					} else if assert.NotNil(t, updch.Error) {
+						assert.Equal(t, tt.wantErr.Type, updch.Error.Type)
+						assert.Equal(t, tt.wantErr.Detail, updch.Error.Detail)
+					}
+					return nil
+				},
+			}
+
+			ctx := NewProvisionerContext(context.Background(), prov)
+			ctx = NewClientContext(ctx, &mockClient{
+				lookupTxt: func(name string) ([]string, error) {
+					t.Errorf("unexpected call to LookupTxt(%s)", name)
+					return nil, nil
+				},
+			})
+
+			// Query the authoritative name servers on the test server port.
+			orig := dns01NameServerPort
+			t.Cleanup(func() { dns01NameServerPort = orig })
+			dns01NameServerPort = port
+
+			assert.NoError(t, dns01Validate(ctx, ch, db, jwk))
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package acme
+
+import (
+	"bytes"
+	"context"
+	"errors"
+
+	"go.step.sm/crypto/randutil"
+)
+
+// EmailClient is the interface used to send and verify email-reply-00
+// challenges as defined in RFC 8823.
+type EmailClient interface {
+	// SendChallenge sends the challenge email with the given subject to the
+	// given address. It returns the address used in the From header, that will
+	// be set in the challenge object.
+	SendChallenge(ctx context.Context, to, subject string) (from string, err error)
+
+	// LookupReply returns the body of the response email sent from the given
+	// address as a reply to the challenge email with the given subject. The
+	// sender of the response must be authenticated, e.g. using a DKIM
+	// signature of the domain of the address. It returns
+	// ErrEmailReplyNotFound if the response has not been received, and
+	// ErrEmailReplyNotAuthenticated if the responses received cannot be
+	// authenticated.
+	LookupReply(ctx context.Context, from, subject string) ([]byte, error)
+}
+
+// ErrEmailReplyNotFound is the error returned by an EmailClient if the
+// response email has not been received yet.
+var ErrEmailReplyNotFound = errors.New("email reply not found")
+
+// ErrEmailReplyNotAuthenticated is the error returned by an EmailClient if
+// the sender of the response emails cannot be authenticated.
+var ErrEmailReplyNotAuthenticated = errors.New("email reply not authenticated")
+
+type emailClientKey struct{}
+
+// NewEmailClientContext adds the given email client to the context.
+func NewEmailClientContext(ctx context.Context, c EmailClient) context.Context {
+	return context.WithValue(ctx, emailClientKey{}, c)
+}
+
+// EmailClientFromContext returns the current email client from the given
+// context.
+func EmailClientFromContext(ctx context.Context) (c EmailClient, ok bool) {
+	c, ok = ctx.Value(emailClientKey{}).(EmailClient)
+	return
+}
+
+const (
+	emailSubjectPrefix    = "ACME: "
+	emailResponseBegin    = "-----BEGIN ACME RESPONSE-----"
+	emailResponseEnd      = "-----END ACME RESPONSE-----"
+	emailTokenPart1Length = 32
+)
+
+// emailChallengeSubject returns the subject of the challenge email, it
+// contains the first part of the token.
+func emailChallengeSubject(tokenPart1 string) string {
+	return emailSubjectPrefix + tokenPart1
+}
+
+// parseEmailResponse extracts the base64url encoded digest of the key
+// authorization from the body of a response email.
+func parseEmailResponse(body []byte) (string, bool) {
+	_, rest, ok := bytes.Cut(body, []byte(emailResponseBegin))
+	if !ok {
+		return "", false
+	}
+	value, _, ok := bytes.Cut(rest, []byte(emailResponseEnd))
+	if !ok {
+		return "", false
+	}
+	return string(bytes.Join(bytes.Fields(value), nil)), true
+}
+
+// SendEmailChallenge generates the first part of the token of an
+// email-reply-00 challenge and sends it in the subject of the challenge email
+// to the mailbox being validated.
+func SendEmailChallenge(ctx context.Context, ch *Challenge) error {
+	ec, ok := EmailClientFromContext(ctx)
+	if !ok {
+		return NewErrorISE("email-reply-00 challenge requires an email client")
+	}
+
+	tokenPart1, err := randutil.Alphanumeric(emailTokenPart1Length)
+	if err != nil {
+		return WrapErrorISE(err, "error generating random alphanumeric token")
+	}
+
+	from, err := ec.SendChallenge(ctx, ch.Value, emailChallengeSubject(tokenPart1))
+	if err != nil {
+		return WrapError(ErrorConnectionType, err, "error sending challenge email to %s", ch.Value)
+	}
+
+	ch.From = from
+	ch.TokenPart1 = tokenPart1
+	return nil
+}
@@ -0,0 +1,360 @@
+// Package email implements an acme.EmailClient that sends the email-reply-00
+// challenges (RFC 8823) using SMTP and reads the responses from an IMAP
+// mailbox.
+package email
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-imap"
+	imapclient "github.com/emersion/go-imap/client"
+	"go.step.sm/crypto/randutil"
+
+	"github.com/smallstep/certificates/acme"
+)
+
+// defaultMailbox is the IMAP mailbox where the responses are searched by
+// default.
+const defaultMailbox = "INBOX"
+
+// defaultTimeout is the maximum time used in SMTP and IMAP connections if the
+// context does not have a deadline.
+const defaultTimeout = 30 * time.Second
+
+// Server contains the options used to connect to an SMTP or IMAP server.
+type Server struct {
+	// Address is the host and port of the server, e.g., "smtp.example.com:587".
+	Address string
+	// Username and Password are the credentials used to authenticate to the
+	// server. Authentication is skipped if the username is empty.
+	Username string
+	Password string
+	// TLS enables implicit TLS, used in the ports 465 (SMTP) and 993 (IMAP).
+	// If not set, STARTTLS is used if the server supports it.
+	TLS bool
+	// TLSConfig is the TLS configuration used to connect to the server.
+	TLSConfig *tls.Config
+}
+
+// Options are the options used to create a new Client.
+type Options struct {
+	// From is the address used to send the challenge emails. The responses
+	// are sent to this address.
+	From string
+	// SMTP is the server used to send the challenge emails.
+	SMTP Server
+	// IMAP is the server used to read the responses.
+	IMAP Server
+	// Mailbox is the IMAP mailbox where the responses are searched, it
+	// defaults to INBOX.
+	Mailbox string
+}
+
+// Client implements acme.EmailClient using SMTP and IMAP. The responses must
+// have a valid DKIM signature of the domain of the sender, or one of its
+// parent domains.
+type Client struct {
+	from      *mail.Address
+	smtp      Server
+	imap      Server
+	mailbox   string
+	dialer    *net.Dialer
+	lookupTXT lookupTXTFunc
+}
+
+// New creates a new Client with the given options.
+func New(opts Options) (*Client, error) {
+	switch {
+	case opts.From == "":
+		return nil, errors.New("email 'from' cannot be empty")
+	case opts.SMTP.Address == "":
+		return nil, errors.New("email 'smtp.address' cannot be empty")
+	case opts.IMAP.Address == "":
+		return nil, errors.New("email 'imap.address' cannot be empty")
+	}
+
+	from, err := mail.ParseAddress(opts.From)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing email 'from': %w", err)
+	}
+	mailbox := opts.Mailbox
+	if mailbox == "" {
+		mailbox = defaultMailbox
+	}
+
+	return &Client{
+		from:      from,
+		smtp:      opts.SMTP,
+		imap:      opts.IMAP,
+		mailbox:   mailbox,
+		dialer:    &net.Dialer{Timeout: defaultTimeout},
+		lookupTXT: net.DefaultResolver.LookupTXT,
+	}, nil
+}
+
+// SendChallenge implements acme.EmailClient and sends the challenge email to
+// the given address.
+func (c *Client) SendChallenge(ctx context.Context, to, subject string) (string, error) {
+	msg, err := c.challengeMessage(to, subject)
+	if err != nil {
+		return "", err
+	}
+
+	conn, err := c.dial(ctx, c.smtp)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	host, _, _ := net.SplitHostPort(c.smtp.Address)
+	sc, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return "", fmt.Errorf("error connecting to %s: %w", c.smtp.Address, err)
+	}
+	defer sc.Close()
+
+	if !c.smtp.TLS {
+		if ok, _ := sc.Extension("STARTTLS"); ok {
+			if err := sc.StartTLS(c.tlsConfig(c.smtp, host)); err != nil {
+				return "", fmt.Errorf("error starting TLS with %s: %w", c.smtp.Address, err)
+			}
+		}
+	}
+	if c.smtp.Username != "" {
+		if err := sc.Auth(smtp.PlainAuth("", c.smtp.Username, c.smtp.Password, host)); err != nil {
+			return "", fmt.Errorf("error authenticating to %s: %w", c.smtp.Address, err)
+		}
+	}
+	if err := sc.Mail(c.from.Address); err != nil {
+		return "", err
+	}
+	if err := sc.Rcpt(to); err != nil {
+		return "", err
+	}
+	w, err := sc.Data()
+	if err != nil {
+		return "", err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return "", err
+	}
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+	if err := sc.Quit(); err != nil {
+		return "", err
+	}
+
+	return c.from.Address, nil
+}
+
+// challengeMessage returns the challenge email as defined in RFC 8823,
+// section 3.
+func (c *Client) challengeMessage(to, subject string) ([]byte, error) {
+	id, err := randutil.Hex(32)
+	if err != nil {
+		return nil, fmt.Errorf("error generating message id: %w", err)
+	}
+	_, domain, _ := strings.Cut(c.from.Address, "@")
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", c.from.String())
+	fmt.Fprintf(&b, "To: %s\r\n", (&mail.Address{Address: to}).String())
+	fmt.Fprintf(&b, "Subject: %s\r\n", subject)
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&b, "Message-ID: <%s@%s>\r\n", id, domain)
+	b.WriteString("Auto-Submitted: auto-generated; type=acme\r\n")
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString("This is an automatically generated ACME challenge for the email address\r\n")
+	fmt.Fprintf(&b, "%s. If you did not request an S/MIME certificate, ignore this message.\r\n", to)
+	return b.Bytes(), nil
+}
+
+// LookupReply implements acme.EmailClient and returns the body of the last
+// response email sent from the given address with the challenge subject and
+// a valid DKIM signature aligned with the domain of the address.
+func (c *Client) LookupReply(ctx context.Context, from, subject string) ([]byte, error) {
+	conn, err := c.dial(ctx, c.imap)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	host, _, _ := net.SplitHostPort(c.imap.Address)
+	ic, err := imapclient.New(conn)
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to %s: %w", c.imap.Address, err)
+	}
+	defer ic.Logout()
+
+	if !c.imap.TLS {
+		if ok, _ := ic.SupportStartTLS(); ok {
+			if err := ic.StartTLS(c.tlsConfig(c.imap, host)); err != nil {
+				return nil, fmt.Errorf("error starting TLS with %s: %w", c.imap.Address, err)
+			}
+		}
+	}
+	if c.imap.Username != "" {
+		if err := ic.Login(c.imap.Username, c.imap.Password); err != nil {
+			return nil, fmt.Errorf("error authenticating to %s: %w", c.imap.Address, err)
+		}
+	}
+	if _, err := ic.Select(c.mailbox, true); err != nil {
+		return nil, fmt.Errorf("error selecting mailbox %s: %w", c.mailbox, err)
+	}
+
+	criteria := imap.NewSearchCriteria()
+	criteria.Header.Add("From", from)
+	criteria.Header.Add("Subject", subject)
+	seqNums, err := ic.Search(criteria)
+	if err != nil {
+		return nil, fmt.Errorf("error searching mailbox %s: %w", c.mailbox, err)
+	}
+	if len(seqNums) == 0 {
+		return nil, acme.ErrEmailReplyNotFound
+	}
+
+	seqSet := new(imap.SeqSet)
+	seqSet.AddNum(seqNums...)
+	section := &imap.BodySectionName{Peek: true}
+	messages := make(chan *imap.Message, len(seqNums))
+	if err := ic.Fetch(seqSet, []imap.FetchItem{section.FetchItem()}, messages); err != nil {
+		return nil, fmt.Errorf("error fetching messages: %w", err)
+	}
+
+	// Use the most recent authenticated response, the server search is
+	// case-insensitive and matches substrings, so the headers are checked
+	// again.
+	_, domain, _ := strings.Cut(from, "@")
+	var body []byte
+	var seqNum uint32
+	var found bool
+	var authErr error
+	for msg := range messages {
+		r := msg.GetBody(section)
+		if r == nil || msg.SeqNum < seqNum {
+			continue
+		}
+		raw, err := io.ReadAll(r)
+		if err != nil {
+			continue
+		}
+		b, ok := replyBody(bytes.NewReader(raw), from, subject)
+		if !ok {
+			continue
+		}
+		found = true
+		if err := verifyDKIM(ctx, c.lookupTXT, raw, domain); err != nil {
+			authErr = err
+			continue
+		}
+		body, seqNum = b, msg.SeqNum
+	}
+	switch {
+	case body != nil:
+		return body, nil
+	case found:
+		return nil, fmt.Errorf("%w: %w", acme.ErrEmailReplyNotAuthenticated, authErr)
+	default:
+		return nil, acme.ErrEmailReplyNotFound
+	}
+}
+
+// replyBody parses the given message and returns its decoded body if the
+// message is a response from the given address to the challenge email with
+// the given subject.
+func replyBody(r io.Reader, from, subject string) ([]byte, bool) {
+	msg, err := mail.ReadMessage(r)
+	if err != nil {
+		return nil, false
+	}
+	addr, err := mail.ParseAddress(msg.Header.Get("From"))
+	if err != nil || !equalAddress(addr.Address, from) {
+		return nil, false
+	}
+	// Replies can prefix the subject with "Re:".
+	dec := new(mime.WordDecoder)
+	s, err := dec.DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil || !strings.HasSuffix(strings.TrimSpace(s), subject) {
+		return nil, false
+	}
+
+	var body io.Reader = msg.Body
+	switch strings.ToLower(msg.Header.Get("Content-Transfer-Encoding")) {
+	case "quoted-printable":
+		body = quotedprintable.NewReader(body)
+	case "base64":
+		body = base64.NewDecoder(base64.StdEncoding, body)
+	}
+	b, err := io.ReadAll(body)
+	if err != nil {
+		return nil, false
+	}
+	return b, true
+}
+
+// equalAddress compares two email addresses. The local part is case
+// sensitive, and the domain is not.
+func equalAddress(a, b string) bool {
+	i, j := strings.LastIndex(a, "@"), strings.LastIndex(b, "@")
+	if i < 0 || j < 0 {
+		return a == b
+	}
+	return a[:i] == b[:j] && strings.EqualFold(a[i:], b[j:])
+}
+
+// dial connects to the given server using implicit TLS if configured. The
+// connection deadline is set from the context.
+func (c *Client) dial(ctx context.Context, srv Server) (net.Conn, error) {
+	conn, err := c.dialer.DialContext(ctx, "tcp", srv.Address)
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to %s: %w", srv.Address, err)
+	}
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(defaultTimeout)
+	}
+	if err := conn.SetDeadline(deadline); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if srv.TLS {
+		host, _, _ := net.SplitHostPort(srv.Address)
+		tlsConn := tls.Client(conn, c.tlsConfig(srv, host))
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("error connecting to %s: %w", srv.Address, err)
+		}
+		return tlsConn, nil
+	}
+	return conn, nil
+}
+
+// tlsConfig returns the TLS configuration used to connect to the given server.
+func (c *Client) tlsConfig(srv Server, host string) *tls.Config {
+	var config *tls.Config
+	if srv.TLSConfig != nil {
+		config = srv.TLSConfig.Clone()
+	} else {
+		config = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	if config.ServerName == "" {
+		config.ServerName = host
+	}
+	return config
+}
@@ -0,0 +1,266 @@
+package email
+
+import (
+	"bufio"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap/backend/memory"
+	imapclient "github.com/emersion/go-imap/client"
+	imapserver "github.com/emersion/go-imap/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/smallstep/certificates/acme"
+)
+
+func TestNew(t *testing.T) {
+	smtp := Server{Address: "smtp.example.com:587"}
+	imap := Server{Address: "imap.example.com:993", TLS: true}
+	tests := []struct {
+		name        string
+		opts        Options
+		wantMailbox string
+		wantErr     bool
+	}{
+		{"ok", Options{From: "acme@example.com", SMTP: smtp, IMAP: imap}, "INBOX", false},
+		{"ok/mailbox", Options{From: "ACME <acme@example.com>", SMTP: smtp, IMAP: imap, Mailbox: "ACME"}, "ACME", false},
+		{"fail/from", Options{SMTP: smtp, IMAP: imap}, "", true},
+		{"fail/from-address", Options{From: "example.com", SMTP: smtp, IMAP: imap}, "", true},
+		{"fail/smtp", Options{From: "acme@example.com", IMAP: imap}, "", true},
+		{"fail/imap", Options{From: "acme@example.com", SMTP: smtp}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := New(tt.opts)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "acme@example.com", got.from.Address)
+			assert.Equal(t, tt.wantMailbox, got.mailbox)
+		})
+	}
+}
+
+// smtpSession is the data received by the test SMTP server.
+type smtpSession struct {
+	auth string
+	from string
+	to   string
+	data string
+}
+
+// startSMTPServer starts an SMTP server that accepts a single message.
+func startSMTPServer(t *testing.T) (string, <-chan *smtpSession) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+
+	ch := make(chan *smtpSession, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		s := new(smtpSession)
+		tp := textproto.NewConn(conn)
+		tp.PrintfLine("220 localhost ESMTP")
+		for {
+			line, err := tp.ReadLine()
+			if err != nil {
+				return
+			}
+			cmd, arg, _ := strings.Cut(line, " ")
+			switch strings.ToUpper(cmd) {
+			case "EHLO":
+				tp.PrintfLine("250-localhost")
+				tp.PrintfLine("250 AUTH PLAIN")
+			case "AUTH":
+				s.auth = arg
+				tp.PrintfLine("235 2.7.0 Authentication successful")
+			case "MAIL":
+				s.from = arg
+				tp.PrintfLine("250 2.1.0 OK")
+			case "RCPT":
+				s.to = arg
+				tp.PrintfLine("250 2.1.5 OK")
+			case "DATA":
+				tp.PrintfLine("354 Go ahead")
+				b, err := tp.ReadDotBytes()
+				if err != nil {
+					return
+				}
+				s.data = string(b)
+				tp.PrintfLine("250 2.0.0 OK")
+			case "QUIT":
+				tp.PrintfLine("221 2.0.0 Bye")
+				ch <- s
+				return
+			default:
+				tp.PrintfLine("502 5.5.2 Unknown command")
+			}
+		}
+	}()
+	return ln.Addr().String(), ch
+}
+
+func TestClient_SendChallenge(t *testing.T) {
+	addr, sessions := startSMTPServer(t)
+	c, err := New(Options{
+		From: "ACME <acme@example.com>",
+		SMTP: Server{Address: addr, Username: "acme", Password: "secret"},
+		IMAP: Server{Address: "127.0.0.1:993"},
+	})
+	require.NoError(t, err)
+
+	from, err := c.SendChallenge(context.Background(), "Alice@example.org", "ACME: token")
+	require.NoError(t, err)
+	assert.Equal(t, "acme@example.com", from)
+
+	var s *smtpSession
+	select {
+	case s = <-sessions:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for the smtp session")
+	}
+	assert.Equal(t, "PLAIN "+base64.StdEncoding.EncodeToString([]byte("\x00acme\x00secret")), s.auth)
+	assert.Equal(t, "FROM:<acme@example.com>", s.from)
+	assert.Equal(t, "TO:<Alice@example.org>", s.to)
+
+	msg, err := mail.ReadMessage(strings.NewReader(s.data))
+	require.NoError(t, err)
+	assert.Equal(t, `"ACME" <acme@example.com>`, msg.Header.Get("From"))
+	assert.Equal(t, "<Alice@example.org>", msg.Header.Get("To"))
+	assert.Equal(t, "ACME: token", msg.Header.Get("Subject"))
+	assert.Equal(t, "auto-generated; type=acme", msg.Header.Get("Auto-Submitted"))
+	assert.True(t, strings.HasSuffix(msg.Header.Get("Message-ID"), "@example.com>"))
+	_, err = msg.Header.Date()
+	assert.NoError(t, err)
+
+	// The server does not respond.
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err = c.SendChallenge(ctx, "Alice@example.org", "ACME: token")
+	assert.Error(t, err)
+}
+
+// startIMAPServer starts an IMAP server with the given messages in the INBOX
+// of the user "username".
+func startIMAPServer(t *testing.T, messages ...string) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	srv := imapserver.New(memory.New())
+	srv.AllowInsecureAuth = true
+	go srv.Serve(ln)
+	t.Cleanup(func() { srv.Close() })
+
+	c, err := imapclient.Dial(ln.Addr().String())
+	require.NoError(t, err)
+	defer c.Logout()
+	require.NoError(t, c.Login("username", "password"))
+	for _, m := range messages {
+		require.NoError(t, c.Append("INBOX", nil, time.Now(), strings.NewReader(strings.ReplaceAll(m, "\n", "\r\n"))))
+	}
+	return ln.Addr().String()
+}
+
+func TestClient_LookupReply(t *testing.T) {
+	pub, key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	resolver := dkimTestResolver{
+		"mail._domainkey.example.org": {dkimKeyRecord(t, pub)},
+		"mail._domainkey.example.net": {dkimKeyRecord(t, pub)},
+	}
+	sign := func(domain, m string) string {
+		tags := "v=1; a=ed25519-sha256; c=relaxed/relaxed; s=mail; h=from:subject; d=" + domain
+		return strings.ReplaceAll(signDKIM(t, key, tags, strings.ReplaceAll(m, "\n", "\r\n")), "\r\n", "\n")
+	}
+
+	addr := startIMAPServer(t,
+		sign("example.org", "From: alice@example.org\nSubject: Re: ACME: token\n\n-----BEGIN ACME RESPONSE-----\nwrong-case\n-----END ACME RESPONSE-----\n"),
+		sign("example.org", "From: Alice <Alice@EXAMPLE.org>\nSubject: Re: ACME: token\nContent-Transfer-Encoding: quoted-printable\n\n-----BEGIN ACME RESPONSE-----\nfirst=\n-----END ACME RESPONSE-----\n"),
+		sign("example.net", "From: Mallory <mallory@example.net>\nSubject: ACME: token from Alice@example.org\n\n-----BEGIN ACME RESPONSE-----\nmallory\n-----END ACME RESPONSE-----\n"),
+		sign("example.org", "From: Alice@example.org\nSubject: Re: ACME: token\n\n-----BEGIN ACME RESPONSE-----\nsecond\n-----END ACME RESPONSE-----\n"),
+		sign("example.org", "From: Alice@example.org\nSubject: Re: ACME: other\n\n-----BEGIN ACME RESPONSE-----\nother\n-----END ACME RESPONSE-----\n"),
+		// Forged responses are ignored.
+		sign("example.net", "From: Alice@example.org\nSubject: Re: ACME: token\n\n-----BEGIN ACME RESPONSE-----\nforged\n-----END ACME RESPONSE-----\n"),
+		"From: Alice@example.org\nSubject: Re: ACME: token\n\n-----BEGIN ACME RESPONSE-----\nunsigned\n-----END ACME RESPONSE-----\n",
+		"From: Bob@example.org\nSubject: Re: ACME: token\n\n-----BEGIN ACME RESPONSE-----\nunsigned\n-----END ACME RESPONSE-----\n",
+	)
+	c, err := New(Options{
+		From: "acme@example.com",
+		SMTP: Server{Address: "127.0.0.1:25"},
+		IMAP: Server{Address: addr, Username: "username", Password: "password"},
+	})
+	require.NoError(t, err)
+	c.lookupTXT = resolver.LookupTXT
+	ctx := context.Background()
+
+	// The most recent authenticated response is used.
+	body, err := c.LookupReply(ctx, "Alice@example.org", "ACME: token")
+	require.NoError(t, err)
+	assert.Equal(t, "-----BEGIN ACME RESPONSE-----\r\nsecond\r\n-----END ACME RESPONSE-----\r\n", string(body))
+
+	_, err = c.LookupReply(ctx, "Bob@example.org", "ACME: token")
+	assert.ErrorIs(t, err, acme.ErrEmailReplyNotAuthenticated)
+
+	_, err = c.LookupReply(ctx, "Carol@example.org", "ACME: token")
+	assert.ErrorIs(t, err, acme.ErrEmailReplyNotFound)
+	_, err = c.LookupReply(ctx, "Alice@example.org", "ACME: missing")
+	assert.ErrorIs(t, err, acme.ErrEmailReplyNotFound)
+
+	// Wrong credentials.
+	c.imap.Password = "wrong"
+	_, err = c.LookupReply(ctx, "Alice@example.org", "ACME: token")
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, acme.ErrEmailReplyNotFound)
+
+	// Unknown mailbox.
+	c.imap.Password = "password"
+	c.mailbox = "ACME"
+	_, err = c.LookupReply(ctx, "Alice@example.org", "ACME: token")
+	assert.Error(t, err)
+}
+
+func Test_replyBody(t *testing.T) {
+	tests := []struct {
+		name    string
+		message string
+		want    string
+		wantOK  bool
+	}{
+		{"ok", "From: Alice@example.org\r\nSubject: ACME: token\r\n\r\nbody\r\n", "body\r\n", true},
+		{"ok/reply", "From: Alice <Alice@Example.ORG>\r\nSubject: RE: ACME: token\r\n\r\nbody\r\n", "body\r\n", true},
+		{"ok/encoded-subject", "From: Alice@example.org\r\nSubject: =?utf-8?q?Re=3A_ACME=3A_token?=\r\n\r\nbody\r\n", "body\r\n", true},
+		{"ok/quoted-printable", "From: Alice@example.org\r\nSubject: ACME: token\r\nContent-Transfer-Encoding: quoted-printable\r\n\r\nlong=\r\nbody=3D\r\n", "longbody=\r\n", true},
+		{"ok/base64", "From: Alice@example.org\r\nSubject: ACME: token\r\nContent-Transfer-Encoding: base64\r\n\r\nYm9keQ==\r\n", "body", true},
+		{"fail/from", "From: alice@example.org\r\nSubject: ACME: token\r\n\r\nbody\r\n", "", false},
+		{"fail/from-missing", "Subject: ACME: token\r\n\r\nbody\r\n", "", false},
+		{"fail/subject", "From: Alice@example.org\r\nSubject: ACME: token2\r\n\r\nbody\r\n", "", false},
+		{"fail/message", "not a message", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := replyBody(bufio.NewReader(strings.NewReader(tt.message)), "Alice@example.org", "ACME: token")
+			assert.Equal(t, tt.wantOK, ok)
+			if tt.wantOK {
+				assert.Equal(t, tt.want, string(got))
+			}
+		})
+	}
+}
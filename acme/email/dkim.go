@@ -0,0 +1,491 @@
+package email
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// maxDKIMSignatures is the maximum number of DKIM signatures verified in a
+// message, each signature requires a DNS lookup.
+const maxDKIMSignatures = 5
+
+// minDKIMRSAKeySize is the minimum size of the RSA keys used to verify DKIM
+// signatures, as required by RFC 8301.
+const minDKIMRSAKeySize = 1024
+
+// lookupTXTFunc returns the TXT records of the given name.
+type lookupTXTFunc func(ctx context.Context, name string) ([]string, error)
+
+// dkimSignature is a parsed DKIM-Signature header field as defined in RFC
+// 6376, section 3.5.
+type dkimSignature struct {
+	field       string
+	algorithm   string
+	signature   []byte
+	bodyHash    []byte
+	headerCanon string
+	bodyCanon   string
+	domain      string
+	selector    string
+	headers     []string
+	identity    string
+	expiration  time.Time
+}
+
+// dkimKey is a parsed DKIM key record as defined in RFC 6376, section 3.6.1.
+type dkimKey struct {
+	key    crypto.PublicKey
+	strict bool
+}
+
+// verifyDKIM verifies the DKIM signatures (RFC 6376) of the given message. It
+// returns nil if one of the signatures is valid and the signing domain is
+// aligned with the given domain of the From address, that is, the signing
+// domain is the same domain or one of its parent domains that is not a public
+// suffix.
+func verifyDKIM(ctx context.Context, lookupTXT lookupTXTFunc, raw []byte, domain string) error {
+	fields, body, err := splitMessage(raw)
+	if err != nil {
+		return err
+	}
+
+	// The From header must be unique, otherwise the signed header might not
+	// be the one used to identify the sender.
+	var signatures []string
+	var from int
+	for _, f := range fields {
+		switch headerName(f) {
+		case "from":
+			from++
+		case "dkim-signature":
+			signatures = append(signatures, f)
+		}
+	}
+	switch {
+	case from != 1:
+		return errors.New("message must contain exactly one From header")
+	case len(signatures) == 0:
+		return errors.New("message does not have a DKIM signature")
+	case len(signatures) > maxDKIMSignatures:
+		signatures = signatures[:maxDKIMSignatures]
+	}
+
+	for _, f := range signatures {
+		var sig *dkimSignature
+		if sig, err = parseDKIMSignature(f); err != nil {
+			continue
+		}
+		if !isAlignedDomain(domain, sig.domain) {
+			err = fmt.Errorf("dkim signing domain %s is not aligned with %s", sig.domain, domain)
+			continue
+		}
+		if err = sig.verify(ctx, lookupTXT, fields, body); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// isAlignedDomain returns true if the signing domain is the domain of the From
+// address or one of its parent domains, but not a public suffix.
+func isAlignedDomain(from, signing string) bool {
+	from = strings.ToLower(strings.TrimSuffix(from, "."))
+	signing = strings.ToLower(strings.TrimSuffix(signing, "."))
+	switch {
+	case signing == "":
+		return false
+	case from == signing:
+		return true
+	case !strings.HasSuffix(from, "."+signing):
+		return false
+	}
+	suffix, _ := publicsuffix.PublicSuffix(signing)
+	return suffix != signing
+}
+
+// parseDKIMSignature parses a DKIM-Signature header field.
+func parseDKIMSignature(field string) (*dkimSignature, error) {
+	_, value, _ := strings.Cut(field, ":")
+	tags, err := parseTagList(value)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing dkim signature: %w", err)
+	}
+
+	for _, name := range []string{"v", "a", "b", "bh", "d", "h", "s"} {
+		if _, ok := tags[name]; !ok {
+			return nil, fmt.Errorf("dkim signature is missing the %s tag", name)
+		}
+	}
+	if tags["v"] != "1" {
+		return nil, fmt.Errorf("dkim signature version %q is not supported", tags["v"])
+	}
+	// Body length limits allow to append unsigned content to the body.
+	if _, ok := tags["l"]; ok {
+		return nil, errors.New("dkim signature body length limits are not supported")
+	}
+
+	sig := &dkimSignature{
+		field:       field,
+		algorithm:   strings.ToLower(tags["a"]),
+		headerCanon: "simple",
+		bodyCanon:   "simple",
+		domain:      strings.ToLower(tags["d"]),
+		selector:    tags["s"],
+		identity:    tags["i"],
+	}
+	switch sig.algorithm {
+	case "rsa-sha256", "ed25519-sha256":
+	default:
+		return nil, fmt.Errorf("dkim signature algorithm %q is not supported", tags["a"])
+	}
+	if sig.signature, err = base64.StdEncoding.DecodeString(removeWhitespace(tags["b"])); err != nil {
+		return nil, fmt.Errorf("error decoding dkim signature: %w", err)
+	}
+	if sig.bodyHash, err = base64.StdEncoding.DecodeString(removeWhitespace(tags["bh"])); err != nil {
+		return nil, fmt.Errorf("error decoding dkim body hash: %w", err)
+	}
+	if c, ok := tags["c"]; ok {
+		h, b, found := strings.Cut(strings.ToLower(c), "/")
+		sig.headerCanon = h
+		if found {
+			sig.bodyCanon = b
+		}
+	}
+	for _, c := range []string{sig.headerCanon, sig.bodyCanon} {
+		if c != "simple" && c != "relaxed" {
+			return nil, fmt.Errorf("dkim canonicalization %q is not supported", tags["c"])
+		}
+	}
+
+	hasFrom := false
+	for _, h := range strings.Split(tags["h"], ":") {
+		h = strings.ToLower(strings.TrimSpace(h))
+		hasFrom = hasFrom || h == "from"
+		sig.headers = append(sig.headers, h)
+	}
+	if !hasFrom {
+		return nil, errors.New("dkim signature does not sign the From header")
+	}
+
+	// The identity must be in the signing domain or a subdomain of it.
+	if sig.identity != "" {
+		_, d, _ := strings.Cut(sig.identity, "@")
+		d = strings.ToLower(d)
+		if d != sig.domain && !strings.HasSuffix(d, "."+sig.domain) {
+			return nil, fmt.Errorf("dkim identity %s is not in the signing domain %s", sig.identity, sig.domain)
+		}
+	}
+
+	if x, ok := tags["x"]; ok {
+		n, err := strconv.ParseInt(x, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing dkim signature expiration: %w", err)
+		}
+		sig.expiration = time.Unix(n, 0)
+		if time.Now().After(sig.expiration) {
+			return nil, errors.New("dkim signature has expired")
+		}
+	}
+
+	return sig, nil
+}
+
+// verify verifies the body hash and the signature of the given header fields
+// using the key published by the signing domain.
+func (s *dkimSignature) verify(ctx context.Context, lookupTXT lookupTXTFunc, fields []string, body []byte) error {
+	bh := sha256.Sum256(canonicalBody(body, s.bodyCanon))
+	if !bytes.Equal(bh[:], s.bodyHash) {
+		return errors.New("dkim body hash does not match")
+	}
+
+	// The signed header fields are used from the bottom of the header. A
+	// field can be signed multiple times, and nonexistent fields are
+	// ignored.
+	h := sha256.New()
+	used := make(map[string]int)
+	for _, name := range s.headers {
+		n := used[name]
+		for i := len(fields) - 1; i >= 0; i-- {
+			if headerName(fields[i]) != name {
+				continue
+			}
+			if n == 0 {
+				h.Write([]byte(canonicalHeader(fields[i], s.headerCanon)))
+				break
+			}
+			n--
+		}
+		used[name]++
+	}
+	sigField := canonicalHeader(removeSignatureValue(s.field), s.headerCanon)
+	h.Write([]byte(strings.TrimSuffix(sigField, "\r\n")))
+	digest := h.Sum(nil)
+
+	key, err := lookupDKIMKey(ctx, lookupTXT, s.selector, s.domain)
+	if err != nil {
+		return err
+	}
+	if key.strict && s.identity != "" {
+		if _, d, _ := strings.Cut(s.identity, "@"); !strings.EqualFold(d, s.domain) {
+			return fmt.Errorf("dkim identity %s must be in the signing domain %s", s.identity, s.domain)
+		}
+	}
+
+	switch pub := key.key.(type) {
+	case *rsa.PublicKey:
+		if s.algorithm != "rsa-sha256" {
+			return fmt.Errorf("dkim key type does not match the algorithm %s", s.algorithm)
+		}
+		if err := rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest, s.signature); err != nil {
+			return errors.New("dkim signature is not valid")
+		}
+	case ed25519.PublicKey:
+		// RFC 8463 signs the SHA-256 hash of the data.
+		if s.algorithm != "ed25519-sha256" {
+			return fmt.Errorf("dkim key type does not match the algorithm %s", s.algorithm)
+		}
+		if !ed25519.Verify(pub, digest, s.signature) {
+			return errors.New("dkim signature is not valid")
+		}
+	default:
+		return fmt.Errorf("dkim key type %T is not supported", pub)
+	}
+	return nil
+}
+
+// lookupDKIMKey returns the first valid key published in the given selector
+// of the signing domain.
+func lookupDKIMKey(ctx context.Context, lookupTXT lookupTXTFunc, selector, domain string) (*dkimKey, error) {
+	name := selector + "._domainkey." + domain
+	records, err := lookupTXT(ctx, name)
+	if err != nil {
+		return nil, fmt.Errorf("error looking up dkim key %s: %w", name, err)
+	}
+	err = fmt.Errorf("dkim key %s not found", name)
+	for _, r := range records {
+		var key *dkimKey
+		if key, err = parseDKIMKey(r); err == nil {
+			return key, nil
+		}
+	}
+	return nil, err
+}
+
+// parseDKIMKey parses a DKIM key record.
+func parseDKIMKey(record string) (*dkimKey, error) {
+	tags, err := parseTagList(record)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing dkim key: %w", err)
+	}
+	if v, ok := tags["v"]; ok && v != "DKIM1" {
+		return nil, fmt.Errorf("dkim key version %q is not supported", v)
+	}
+	if h, ok := tags["h"]; ok && !containsTag(h, "sha256") {
+		return nil, errors.New("dkim key does not allow sha256")
+	}
+	if s, ok := tags["s"]; ok && !containsTag(s, "*") && !containsTag(s, "email") {
+		return nil, errors.New("dkim key cannot be used for email")
+	}
+	p, ok := tags["p"]
+	if !ok {
+		return nil, errors.New("dkim key is missing the p tag")
+	}
+	b, err := base64.StdEncoding.DecodeString(removeWhitespace(p))
+	switch {
+	case err != nil:
+		return nil, fmt.Errorf("error decoding dkim key: %w", err)
+	case len(b) == 0:
+		return nil, errors.New("dkim key has been revoked")
+	}
+
+	key := &dkimKey{
+		strict: containsTag(tags["t"], "s"),
+	}
+	switch k := tags["k"]; k {
+	case "", "rsa":
+		pub, err := x509.ParsePKIXPublicKey(b)
+		if err != nil {
+			if pub, err = x509.ParsePKCS1PublicKey(b); err != nil {
+				return nil, fmt.Errorf("error parsing dkim key: %w", err)
+			}
+		}
+		rsaKey, ok := pub.(*rsa.PublicKey)
+		if !ok {
+			return nil, errors.New("dkim key is not an RSA key")
+		}
+		if rsaKey.N.BitLen() < minDKIMRSAKeySize {
+			return nil, fmt.Errorf("dkim key size must be at least %d bits", minDKIMRSAKeySize)
+		}
+		key.key = rsaKey
+	case "ed25519":
+		if len(b) != ed25519.PublicKeySize {
+			return nil, errors.New("dkim key is not a valid Ed25519 key")
+		}
+		key.key = ed25519.PublicKey(b)
+	default:
+		return nil, fmt.Errorf("dkim key type %q is not supported", k)
+	}
+	return key, nil
+}
+
+// parseTagList parses a tag list as defined in RFC 6376, section 3.2.
+func parseTagList(s string) (map[string]string, error) {
+	tags := make(map[string]string)
+	for _, t := range strings.Split(s, ";") {
+		t = strings.TrimSpace(t)
+		if t == "" {
+			continue
+		}
+		k, v, ok := strings.Cut(t, "=")
+		if !ok {
+			return nil, fmt.Errorf("tag %q is not valid", t)
+		}
+		k = strings.TrimSpace(k)
+		if _, ok := tags[k]; ok {
+			return nil, fmt.Errorf("tag %q is duplicated", k)
+		}
+		tags[k] = strings.TrimSpace(v)
+	}
+	return tags, nil
+}
+
+// containsTag returns true if the colon separated list contains the given
+// value.
+func containsTag(list, value string) bool {
+	for _, v := range strings.Split(list, ":") {
+		if strings.TrimSpace(v) == value {
+			return true
+		}
+	}
+	return false
+}
+
+// removeSignatureValue removes the value of the b tag of a DKIM-Signature
+// header field, keeping the rest of the field unchanged.
+func removeSignatureValue(field string) string {
+	field = strings.TrimSuffix(field, "\r\n")
+	name, value, _ := strings.Cut(field, ":")
+	tags := strings.Split(value, ";")
+	for i, t := range tags {
+		if k, _, ok := strings.Cut(t, "="); ok && strings.TrimSpace(k) == "b" {
+			tags[i] = k + "="
+		}
+	}
+	return name + ":" + strings.Join(tags, ";") + "\r\n"
+}
+
+// splitMessage returns the header fields of a message, including the folded
+// lines and the final CRLF, and the body of the message.
+func splitMessage(raw []byte) ([]string, []byte, error) {
+	var fields []string
+	for len(raw) > 0 {
+		i := bytes.Index(raw, []byte("\r\n"))
+		if i < 0 {
+			return nil, nil, errors.New("message header is not valid")
+		}
+		line := string(raw[:i+2])
+		raw = raw[i+2:]
+		switch {
+		case i == 0:
+			return fields, raw, nil
+		case line[0] == ' ' || line[0] == '\t':
+			if len(fields) == 0 {
+				return nil, nil, errors.New("message header is not valid")
+			}
+			fields[len(fields)-1] += line
+		default:
+			fields = append(fields, line)
+		}
+	}
+	return fields, nil, nil
+}
+
+// headerName returns the lowercase name of a header field.
+func headerName(field string) string {
+	name, _, _ := strings.Cut(field, ":")
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+// canonicalHeader returns a header field using the given canonicalization
+// algorithm as defined in RFC 6376, section 3.4.
+func canonicalHeader(field, canon string) string {
+	if canon == "simple" {
+		return field
+	}
+	name, value, _ := strings.Cut(field, ":")
+	value = strings.ReplaceAll(value, "\r\n", "")
+	value = strings.Trim(compactWhitespace(value), " ")
+	return strings.ToLower(strings.TrimSpace(name)) + ":" + value + "\r\n"
+}
+
+// canonicalBody returns the body of a message using the given
+// canonicalization algorithm as defined in RFC 6376, section 3.4.
+func canonicalBody(body []byte, canon string) []byte {
+	if canon == "simple" {
+		for bytes.HasSuffix(body, []byte("\r\n\r\n")) {
+			body = body[:len(body)-2]
+		}
+		if !bytes.HasSuffix(body, []byte("\r\n")) {
+			body = append(body[:len(body):len(body)], "\r\n"...)
+		}
+		return body
+	}
+
+	lines := strings.Split(string(body), "\r\n")
+	for i, l := range lines {
+		lines[i] = strings.TrimRight(compactWhitespace(l), " ")
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+	return []byte(strings.Join(lines, "\r\n") + "\r\n")
+}
+
+// compactWhitespace replaces the sequences of spaces and tabs with a single
+// space.
+func compactWhitespace(s string) string {
+	var b strings.Builder
+	space := false
+	for _, r := range s {
+		if r == ' ' || r == '\t' {
+			space = true
+			continue
+		}
+		if space {
+			b.WriteByte(' ')
+			space = false
+		}
+		b.WriteRune(r)
+	}
+	if space {
+		b.WriteByte(' ')
+	}
+	return b.String()
+}
+
+// removeWhitespace removes all the whitespace in a base64 value.
+func removeWhitespace(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '\t', '\r', '\n':
+			return -1
+		}
+		return r
+	}, s)
+}
@@ -0,0 +1,205 @@
+package email
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// dkimTestResolver returns the TXT records in the map.
+type dkimTestResolver map[string][]string
+
+func (r dkimTestResolver) LookupTXT(_ context.Context, name string) ([]string, error) {
+	if records, ok := r[name]; ok {
+		return records, nil
+	}
+	return nil, errors.New("not found")
+}
+
+func dkimKeyRecord(t *testing.T, pub crypto.PublicKey) string {
+	t.Helper()
+	switch k := pub.(type) {
+	case ed25519.PublicKey:
+		return "v=DKIM1; k=ed25519; p=" + base64.StdEncoding.EncodeToString(k)
+	default:
+		b, err := x509.MarshalPKIXPublicKey(pub)
+		require.NoError(t, err)
+		return "v=DKIM1; k=rsa; p=" + base64.StdEncoding.EncodeToString(b)
+	}
+}
+
+// signDKIM prepends a DKIM-Signature header field to the given message using
+// the given tags, the b and bh tags are added to them.
+func signDKIM(t *testing.T, key crypto.Signer, tags, message string) string {
+	t.Helper()
+	fields, body, err := splitMessage([]byte(message))
+	require.NoError(t, err)
+
+	m, err := parseTagList(tags)
+	require.NoError(t, err)
+	headerCanon, bodyCanon := "simple", "simple"
+	if c, ok := m["c"]; ok {
+		headerCanon, bodyCanon, _ = strings.Cut(c, "/")
+	}
+	bh := sha256.Sum256(canonicalBody(body, bodyCanon))
+	field := "DKIM-Signature: " + tags + "; bh=" + base64.StdEncoding.EncodeToString(bh[:]) + ";\r\n\tb=\r\n"
+
+	h := sha256.New()
+	used := make(map[string]int)
+	for _, name := range strings.Split(strings.ToLower(m["h"]), ":") {
+		n := used[name]
+		for i := len(fields) - 1; i >= 0; i-- {
+			if headerName(fields[i]) == name {
+				if n == 0 {
+					h.Write([]byte(canonicalHeader(fields[i], headerCanon)))
+					break
+				}
+				n--
+			}
+		}
+		used[name]++
+	}
+	h.Write([]byte(strings.TrimSuffix(canonicalHeader(field, headerCanon), "\r\n")))
+	digest := h.Sum(nil)
+
+	var signature []byte
+	switch k := key.(type) {
+	case ed25519.PrivateKey:
+		signature = ed25519.Sign(k, digest)
+	default:
+		signature, err = key.Sign(rand.Reader, digest, crypto.SHA256)
+		require.NoError(t, err)
+	}
+	return strings.TrimSuffix(field, "\r\n") + base64.StdEncoding.EncodeToString(signature) + "\r\n" + message
+}
+
+func Test_canonicalization(t *testing.T) {
+	// Example in RFC 6376, section 3.4.6.
+	message := "A: X\r\nB : Y\t\r\n\tZ  \r\n\r\n C \r\nD \t E\r\n\r\n\r\n"
+	fields, body, err := splitMessage([]byte(message))
+	require.NoError(t, err)
+	require.Len(t, fields, 2)
+
+	assert.Equal(t, "a:X\r\n", canonicalHeader(fields[0], "relaxed"))
+	assert.Equal(t, "b:Y Z\r\n", canonicalHeader(fields[1], "relaxed"))
+	assert.Equal(t, " C\r\nD E\r\n", string(canonicalBody(body, "relaxed")))
+
+	assert.Equal(t, "A: X\r\n", canonicalHeader(fields[0], "simple"))
+	assert.Equal(t, "B : Y\t\r\n\tZ  \r\n", canonicalHeader(fields[1], "simple"))
+	assert.Equal(t, " C \r\nD \t E\r\n", string(canonicalBody(body, "simple")))
+
+	// Empty bodies.
+	assert.Equal(t, "\r\n", string(canonicalBody(nil, "simple")))
+	assert.Empty(t, canonicalBody([]byte("\r\n\r\n"), "relaxed"))
+}
+
+func Test_verifyDKIM(t *testing.T) {
+	edPub, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	_, otherKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	resolver := dkimTestResolver{
+		"ed._domainkey.example.org":      {"foo", dkimKeyRecord(t, edPub)},
+		"rsa._domainkey.example.org":     {dkimKeyRecord(t, rsaKey.Public())},
+		"revoked._domainkey.example.org": {"v=DKIM1; p="},
+		"strict._domainkey.example.org":  {"v=DKIM1; k=ed25519; t=s; p=" + base64.StdEncoding.EncodeToString(edPub)},
+	}
+	message := "From: Alice <alice@example.org>\r\nSubject: Re: ACME: token\r\n\r\nHello  \r\n\r\n"
+	ed := "v=1; a=ed25519-sha256; c=relaxed/relaxed; d=example.org; s=ed; h=from:subject"
+
+	tests := []struct {
+		name    string
+		message string
+		domain  string
+		wantErr bool
+	}{
+		{"ok/ed25519", signDKIM(t, edKey, ed, message), "example.org", false},
+		{"ok/rsa", signDKIM(t, rsaKey, "v=1; a=rsa-sha256; d=example.org; s=rsa; h=From:Subject", message), "example.org", false},
+		{"ok/subdomain", signDKIM(t, edKey, ed, strings.Replace(message, "example.org", "mail.example.org", 1)), "mail.example.org", false},
+		{"ok/folded", signDKIM(t, edKey, ed, strings.Replace(message, "Subject: Re:", "Subject:\r\n Re:", 1)), "example.org", false},
+		{"ok/identity", signDKIM(t, edKey, ed+"; i=alice@example.org", message), "example.org", false},
+		{"ok/oversigned", signDKIM(t, edKey, ed+":from", message), "example.org", false},
+		{"ok/relaxed-body", strings.Replace(signDKIM(t, edKey, ed, message), "Hello  \r\n", "Hello \r\n", 1), "example.org", false},
+		{"fail/body", strings.Replace(signDKIM(t, edKey, ed, message), "Hello", "Bye", 1), "example.org", true},
+		{"fail/from", strings.Replace(signDKIM(t, edKey, ed, message), "Alice <alice", "Alice <bob", 1), "example.org", true},
+		{"fail/subject", strings.Replace(signDKIM(t, edKey, ed, message), "token", "other", 1), "example.org", true},
+		{"fail/two-from", "From: mallory@example.net\r\n" + signDKIM(t, edKey, ed, message), "example.org", true},
+		{"fail/not-signed", message, "example.org", true},
+		{"fail/not-aligned", signDKIM(t, edKey, ed, message), "example.net", true},
+		{"fail/parent-domain", signDKIM(t, edKey, ed, message), "org", true},
+		{"fail/from-not-signed", signDKIM(t, edKey, "v=1; a=ed25519-sha256; d=example.org; s=ed; h=subject", message), "example.org", true},
+		{"fail/body-length", signDKIM(t, edKey, ed+"; l=5", message), "example.org", true},
+		{"fail/expired", signDKIM(t, edKey, ed+"; x=1", message), "example.org", true},
+		{"fail/identity", signDKIM(t, edKey, ed+"; i=alice@example.net", message), "example.org", true},
+		{"fail/strict-identity", signDKIM(t, edKey, "v=1; a=ed25519-sha256; d=example.org; s=strict; h=from; i=alice@mail.example.org", message), "example.org", true},
+		{"fail/algorithm", signDKIM(t, edKey, "v=1; a=rsa-sha256; d=example.org; s=ed; h=from", message), "example.org", true},
+		{"fail/rsa-sha1", signDKIM(t, rsaKey, "v=1; a=rsa-sha1; d=example.org; s=rsa; h=from", message), "example.org", true},
+		{"fail/revoked", signDKIM(t, edKey, "v=1; a=ed25519-sha256; d=example.org; s=revoked; h=from", message), "example.org", true},
+		{"fail/unknown-key", signDKIM(t, edKey, "v=1; a=ed25519-sha256; d=example.org; s=unknown; h=from", message), "example.org", true},
+		{"fail/wrong-key", signDKIM(t, otherKey, ed, message), "example.org", true},
+		{"fail/header", "From: alice@example.org", "example.org", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := verifyDKIM(context.Background(), resolver.LookupTXT, []byte(tt.message), tt.domain)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func Test_parseDKIMKey(t *testing.T) {
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	p := base64.StdEncoding.EncodeToString(pub)
+
+	tests := []struct {
+		name       string
+		record     string
+		wantStrict bool
+		wantErr    bool
+	}{
+		{"ok", "v=DKIM1; k=ed25519; p=" + p, false, false},
+		{"ok/flags", "k=ed25519; t=y:s; h=sha1:sha256; s=email; p=" + p, true, false},
+		{"fail/version", "v=DKIM2; k=ed25519; p=" + p, false, true},
+		{"fail/hash", "k=ed25519; h=sha1; p=" + p, false, true},
+		{"fail/service", "k=ed25519; s=other; p=" + p, false, true},
+		{"fail/missing", "v=DKIM1; k=ed25519", false, true},
+		{"fail/revoked", "v=DKIM1; k=ed25519; p=", false, true},
+		{"fail/base64", "v=DKIM1; k=ed25519; p=%%%", false, true},
+		{"fail/type", "v=DKIM1; k=dsa; p=" + p, false, true},
+		{"fail/rsa", "v=DKIM1; p=" + p, false, true},
+		{"fail/ed25519", "v=DKIM1; k=ed25519; p=AAAA", false, true},
+		{"fail/duplicated", "v=DKIM1; v=DKIM1; k=ed25519; p=" + p, false, true},
+		{"fail/tag", "v=DKIM1; k; p=" + p, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseDKIMKey(tt.record)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, ed25519.PublicKey(pub), got.key)
+			assert.Equal(t, tt.wantStrict, got.strict)
+		})
+	}
+}
@@ -0,0 +1,274 @@
+package acme
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.step.sm/crypto/jose"
+)
+
+type mockEmailClient struct {
+	sendChallenge func(ctx context.Context, to, subject string) (string, error)
+	lookupReply   func(ctx context.Context, from, subject string) ([]byte, error)
+}
+
+func (m *mockEmailClient) SendChallenge(ctx context.Context, to, subject string) (string, error) {
+	return m.sendChallenge(ctx, to, subject)
+}
+
+func (m *mockEmailClient) LookupReply(ctx context.Context, from, subject string) ([]byte, error) {
+	return m.lookupReply(ctx, from, subject)
+}
+
+func mustEmailResponse(t *testing.T, token string, jwk *jose.JSONWebKey) []byte {
+	t.Helper()
+	keyAuth, err := KeyAuthorization(token, jwk)
+	require.NoError(t, err)
+	h := sha256.Sum256([]byte(keyAuth))
+	return []byte(fmt.Sprintf("Hello,\r\n\r\n%s\r\n%s\r\n%s\r\n",
+		emailResponseBegin, base64.RawURLEncoding.EncodeToString(h[:]), emailResponseEnd))
+}
+
+func Test_parseEmailResponse(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   []byte
+		want   string
+		wantOK bool
+	}{
+		{"ok", []byte("-----BEGIN ACME RESPONSE-----\nLoqXcYV8q5ONbJQxbmR7SCTNo3tiAXDfowyjxAjEuX0\n-----END ACME RESPONSE-----\n"), "LoqXcYV8q5ONbJQxbmR7SCTNo3tiAXDfowyjxAjEuX0", true},
+		{"ok/folded", []byte("> quoted\r\n-----BEGIN ACME RESPONSE-----\r\nLoqXcYV8q5ONbJQxbmR7\r\n SCTNo3tiAXDfowyjxAjEuX0\r\n-----END ACME RESPONSE-----"), "LoqXcYV8q5ONbJQxbmR7SCTNo3tiAXDfowyjxAjEuX0", true},
+		{"fail/no-begin", []byte("LoqXcYV8q5ONbJQxbmR7SCTNo3tiAXDfowyjxAjEuX0\n-----END ACME RESPONSE-----"), "", false},
+		{"fail/no-end", []byte("-----BEGIN ACME RESPONSE-----\nLoqXcYV8q5ONbJQxbmR7SCTNo3tiAXDfowyjxAjEuX0\n"), "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseEmailResponse(tt.body)
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.wantOK, ok)
+		})
+	}
+}
+
+func TestSendEmailChallenge(t *testing.T) {
+	tests := []struct {
+		name     string
+		ec       EmailClient
+		wantFrom string
+		wantErr  bool
+	}{
+		{"ok", &mockEmailClient{
+			sendChallenge: func(ctx context.Context, to, subject string) (string, error) {
+				assert.Equal(t, "jane@example.com", to)
+				assert.Regexp(t, "^ACME: [a-zA-Z0-9]{32}$", subject)
+				return "acme@ca.example.com", nil
+			},
+		}, "acme@ca.example.com", false},
+		{"fail/no-client", nil, "", true},
+		{"fail/send", &mockEmailClient{
+			sendChallenge: func(ctx context.Context, to, subject string) (string, error) {
+				return "", errors.New("force")
+			},
+		}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.ec != nil {
+				ctx = NewEmailClientContext(ctx, tt.ec)
+			}
+			ch := &Challenge{Type: EMAILREPLY00, Value: "jane@example.com", Token: "token"}
+			err := SendEmailChallenge(ctx, ch)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantFrom, ch.From)
+			assert.Len(t, ch.TokenPart1, emailTokenPart1Length)
+		})
+	}
+}
+
+func TestEmailReply00Validate(t *testing.T) {
+	jwk, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+	require.NoError(t, err)
+
+	newChallenge := func() *Challenge {
+		return &Challenge{
+			ID:         "chID",
+			Type:       EMAILREPLY00,
+			Value:      "jane@example.com",
+			Token:      "token-part2",
+			TokenPart1: "token-part1",
+			Status:     StatusPending,
+		}
+	}
+
+	type test struct {
+		ec         EmailClient
+		ch         *Challenge
+		db         DB
+		wantStatus Status
+		wantErr    bool
+	}
+	tests := map[string]func(t *testing.T) test{
+		"ok": func(t *testing.T) test {
+			return test{
+				ch: newChallenge(),
+				ec: &mockEmailClient{
+					lookupReply: func(ctx context.Context, from, subject string) ([]byte, error) {
+						assert.Equal(t, "jane@example.com", from)
+						assert.Equal(t, "ACME: token-part1", subject)
+						return mustEmailResponse(t, "token-part1token-part2", jwk), nil
+					},
+				},
+				db: &MockDB{
+					MockUpdateChallenge: func(ctx context.Context, updch *Challenge) error {
+						assert.Equal(t, StatusValid, updch.Status)
+						assert.Nil(t, updch.Error)
+						assert.NotEmpty(t, updch.ValidatedAt)
+						return nil
+					},
+				},
+				wantStatus: StatusValid,
+			}
+		},
+		"ok/not-received": func(t *testing.T) test {
+			return test{
+				ch: newChallenge(),
+				ec: &mockEmailClient{
+					lookupReply: func(ctx context.Context, from, subject string) ([]byte, error) {
+						return nil, ErrEmailReplyNotFound
+					},
+				},
+				db: &MockDB{
+					MockUpdateChallenge: func(ctx context.Context, updch *Challenge) error {
+						assert.Equal(t, StatusPending, updch.Status)
+						assert.Equal(t, officialACMEPrefix+ErrorIncorrectResponseType.String(), updch.Error.Type)
+						return nil
+					},
+				},
+				wantStatus: StatusPending,
+			}
+		},
+		"ok/not-authenticated": func(t *testing.T) test {
+			return test{
+				ch: newChallenge(),
+				ec: &mockEmailClient{
+					lookupReply: func(ctx context.Context, from, subject string) ([]byte, error) {
+						return nil, fmt.Errorf("%w: force", ErrEmailReplyNotAuthenticated)
+					},
+				},
+				db: &MockDB{
+					MockUpdateChallenge: func(ctx context.Context, updch *Challenge) error {
+						assert.Equal(t, StatusPending, updch.Status)
+						assert.Equal(t, officialACMEPrefix+ErrorUnauthorizedType.String(), updch.Error.Type)
+						return nil
+					},
+				},
+				wantStatus: StatusPending,
+			}
+		},
+		"ok/lookup-error": func(t *testing.T) test {
+			return test{
+				ch: newChallenge(),
+				ec: &mockEmailClient{
+					lookupReply: func(ctx context.Context, from, subject string) ([]byte, error) {
+						return nil, errors.New("force")
+					},
+				},
+				db: &MockDB{
+					MockUpdateChallenge: func(ctx context.Context, updch *Challenge) error {
+						assert.Equal(t, StatusPending, updch.Status)
+						assert.Equal(t, officialACMEPrefix+ErrorConnectionType.String(), updch.Error.Type)
+						return nil
+					},
+				},
+				wantStatus: StatusPending,
+			}
+		},
+		"ok/no-response": func(t *testing.T) test {
+			return test{
+				ch: newChallenge(),
+				ec: &mockEmailClient{
+					lookupReply: func(ctx context.Context, from, subject string) ([]byte, error) {
+						return []byte("Hello"), nil
+					},
+				},
+				db: &MockDB{
+					MockUpdateChallenge: func(ctx context.Context, updch *Challenge) error {
+						assert.Equal(t, StatusInvalid, updch.Status)
+						assert.Equal(t, officialACMEPrefix+ErrorIncorrectResponseType.String(), updch.Error.Type)
+						return nil
+					},
+				},
+				wantStatus: StatusInvalid,
+			}
+		},
+		"ok/mismatch": func(t *testing.T) test {
+			return test{
+				ch: newChallenge(),
+				ec: &mockEmailClient{
+					lookupReply: func(ctx context.Context, from, subject string) ([]byte, error) {
+						return mustEmailResponse(t, "token-part2", jwk), nil
+					},
+				},
+				db: &MockDB{
+					MockUpdateChallenge: func(ctx context.Context, updch *Challenge) error {
+						assert.Equal(t, StatusInvalid, updch.Status)
+						assert.Equal(t, officialACMEPrefix+ErrorRejectedIdentifierType.String(), updch.Error.Type)
+						return nil
+					},
+				},
+				wantStatus: StatusInvalid,
+			}
+		},
+		"fail/no-client": func(t *testing.T) test {
+			return test{
+				ch:         newChallenge(),
+				wantStatus: StatusPending,
+				wantErr:    true,
+			}
+		},
+		"fail/update": func(t *testing.T) test {
+			return test{
+				ch: newChallenge(),
+				ec: &mockEmailClient{
+					lookupReply: func(ctx context.Context, from, subject string) ([]byte, error) {
+						return mustEmailResponse(t, "token-part1token-part2", jwk), nil
+					},
+				},
+				db: &MockDB{
+					MockUpdateChallenge: func(ctx context.Context, updch *Challenge) error {
+						return errors.New("force")
+					},
+				},
+				wantStatus: StatusValid,
+				wantErr:    true,
+			}
+		},
+	}
+	for name, run := range tests {
+		t.Run(name, func(t *testing.T) {
+			tc := run(t)
+			ctx := context.Background()
+			if tc.ec != nil {
+				ctx = NewEmailClientContext(ctx, tc.ec)
+			}
+			err := emailReply00Validate(ctx, tc.ch, tc.db, jwk)
+			if tc.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tc.wantStatus, tc.ch.Status)
+		})
+	}
+}
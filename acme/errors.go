@@ -4,9 +4,13 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/pkg/errors"
+
 	"github.com/smallstep/certificates/api/render"
+	"github.com/smallstep/certificates/policy"
 )
 
 // ProblemType is the type of the ACME problem.
@@ -65,6 +69,8 @@ const (
 	ErrorUserActionRequiredType
 	// ErrorNotImplementedType operation is not implemented
 	ErrorNotImplementedType
+	// ErrorInvalidProfileType the requested profile is not supported
+	ErrorInvalidProfileType
 )
 
 // String returns the string representation of the acme problem type,
@@ -121,6 +127,8 @@ func (ap ProblemType) String() string {
 		return "userActionRequired"
 	case ErrorNotImplementedType:
 		return "notImplemented"
+	case ErrorInvalidProfileType:
+		return "invalidProfile"
 	default:
 		return fmt.Sprintf("unsupported type ACME error type '%d'", int(ap))
 	}
@@ -241,6 +249,11 @@ var (
 			details: "The requested operation is not implemented",
 			status:  501,
 		},
+		ErrorInvalidProfileType: {
+			typ:     officialACMEPrefix + ErrorInvalidProfileType.String(),
+			details: "The requested profile is not supported",
+			status:  400,
+		},
 		ErrorTLSType: {
 			typ:     officialACMEPrefix + ErrorTLSType.String(),
 			details: "The server received a TLS error during validation",
@@ -277,6 +290,9 @@ type Error struct {
 	Subproblems []Subproblem `json:"subproblems,omitempty"`
 	Err         error        `json:"-"`
 	Status      int          `json:"-"`
+	// RetryAfter, if set, is the time the client should wait before retrying
+	// the request, it's sent in the Retry-After header.
+	RetryAfter time.Duration `json:"-"`
 }
 
 // Subproblem represents an ACME subproblem. It's fairly
@@ -341,6 +357,24 @@ func NewSubproblemWithIdentifier(pt ProblemType, identifier Identifier, msg stri
 	return s
 }
 
+// NewPolicySubproblem creates a new rejectedIdentifier Subproblem for an error
+// returned by a name policy. If the error identifies a DNS name, an IP address
+// or an email address, the Subproblem includes the Identifier.
+func NewPolicySubproblem(err error) Subproblem {
+	var pe *policy.NamePolicyError
+	if errors.As(err, &pe) {
+		switch pe.NameType {
+		case policy.DNSNameType:
+			return NewSubproblemWithIdentifier(ErrorRejectedIdentifierType, Identifier{Type: DNS, Value: pe.Name}, "%s", pe.Error())
+		case policy.IPNameType:
+			return NewSubproblemWithIdentifier(ErrorRejectedIdentifierType, Identifier{Type: IP, Value: pe.Name}, "%s", pe.Error())
+		case policy.EmailNameType:
+			return NewSubproblemWithIdentifier(ErrorRejectedIdentifierType, Identifier{Type: Email, Value: pe.Name}, "%s", pe.Error())
+		}
+	}
+	return NewSubproblem(ErrorRejectedIdentifierType, "%s", err.Error())
+}
+
 func newError(pt ProblemType, err error) *Error {
 	meta, ok := errorMap[pt]
 	if !ok {
@@ -426,5 +460,9 @@ func (e *Error) ToLog() (any, error) {
 // Render implements render.RenderableError for Error.
 func (e *Error) Render(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/problem+json")
+	if e.RetryAfter > 0 {
+		// Retry-After is sent in seconds, rounded up.
+		w.Header().Set("Retry-After", strconv.Itoa(int((e.RetryAfter+time.Second-1)/time.Second)))
+	}
 	render.JSONStatus(w, r, e, e.StatusCode())
 }
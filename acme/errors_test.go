@@ -2,10 +2,16 @@ package acme
 
 import (
 	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/smallstep/certificates/policy"
 )
 
 func mustJSON(t *testing.T, m map[string]interface{}) string {
@@ -52,3 +58,48 @@ func TestError_WithAdditionalErrorDetail(t *testing.T) {
 		})
 	}
 }
+
+func TestNewPolicySubproblem(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want Subproblem
+	}{
+		{"dns", &policy.NamePolicyError{Reason: policy.NotAllowed, NameType: policy.DNSNameType, Name: "www.example.com"},
+			NewSubproblemWithIdentifier(ErrorRejectedIdentifierType, Identifier{Type: DNS, Value: "www.example.com"}, `dns name "www.example.com" not allowed`)},
+		{"ip", &policy.NamePolicyError{Reason: policy.NotAllowed, NameType: policy.IPNameType, Name: "10.0.0.1"},
+			NewSubproblemWithIdentifier(ErrorRejectedIdentifierType, Identifier{Type: IP, Value: "10.0.0.1"}, `ip name "10.0.0.1" not allowed`)},
+		{"email", &policy.NamePolicyError{Reason: policy.NotAllowed, NameType: policy.EmailNameType, Name: "jane@example.com"},
+			NewSubproblemWithIdentifier(ErrorRejectedIdentifierType, Identifier{Type: Email, Value: "jane@example.com"}, `email name "jane@example.com" not allowed`)},
+		{"uri", &policy.NamePolicyError{Reason: policy.NotAllowed, NameType: policy.URINameType, Name: "spiffe://example.com"},
+			NewSubproblem(ErrorRejectedIdentifierType, `uri name "spiffe://example.com" not allowed`)},
+		{"other", errors.New("not allowed"),
+			NewSubproblem(ErrorRejectedIdentifierType, "not allowed")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, NewPolicySubproblem(tt.err))
+		})
+	}
+}
+
+func TestError_Render(t *testing.T) {
+	tests := []struct {
+		name           string
+		err            *Error
+		wantStatus     int
+		wantRetryAfter string
+	}{
+		{"malformed", NewError(ErrorMalformedType, "malformed"), 400, ""},
+		{"rate-limited", &Error{Type: "urn:ietf:params:acme:error:rateLimited", Status: 429, RetryAfter: 1500 * time.Millisecond}, 429, "2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			tt.err.Render(w, httptest.NewRequest("GET", "/", http.NoBody))
+			assert.Equal(t, tt.wantStatus, w.Code)
+			assert.Equal(t, "application/problem+json", w.Header().Get("Content-Type"))
+			assert.Equal(t, tt.wantRetryAfter, w.Header().Get("Retry-After"))
+		})
+	}
+}
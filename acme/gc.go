@@ -0,0 +1,26 @@
+package acme
+
+import (
+	"context"
+	"time"
+)
+
+// GarbageCollector is the interface implemented by the databases that can
+// remove expired ACME objects.
+type GarbageCollector interface {
+	// DeleteExpired removes the orders that expired before the given time
+	// without a certificate, the authorizations, and their challenges, that
+	// expired before the given time, the nonces created before it, and the
+	// rate limit counters whose window ended before it.
+	DeleteExpired(ctx context.Context, before time.Time) (*GarbageCollectorStats, error)
+}
+
+// GarbageCollectorStats contains the number of objects removed in a run of
+// the garbage collector.
+type GarbageCollectorStats struct {
+	Orders         int
+	Authorizations int
+	Challenges     int
+	Nonces         int
+	RateLimits     int
+}
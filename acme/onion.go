@@ -0,0 +1,223 @@
+package acme
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"go.step.sm/crypto/randutil"
+	"golang.org/x/crypto/sha3"
+)
+
+// Onion service v3 addresses are defined in the Tor rendezvous specification
+// as base32(PUBKEY | CHECKSUM | VERSION) followed by the ".onion" suffix.
+const (
+	onionSuffix          = ".onion"
+	onionV3Version       = 0x03
+	onionV3AddressLength = 56
+	onionNonceSize       = 16
+)
+
+var (
+	// oidCASigningNonce and oidApplicantSigningNonce are the CSR attributes
+	// defined by the CA/Browser Forum and used by the onion-csr-01 challenge.
+	oidCASigningNonce        = asn1.ObjectIdentifier{2, 23, 140, 41}
+	oidApplicantSigningNonce = asn1.ObjectIdentifier{2, 23, 140, 42}
+
+	onionEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+)
+
+// IsOnionName returns true if the given DNS name is a name under the .onion
+// special-use domain.
+func IsOnionName(name string) bool {
+	return strings.HasSuffix(strings.ToLower(name), onionSuffix)
+}
+
+// OnionPublicKey returns the ed25519 public key of the onion service v3
+// encoded in the given name. The name can contain labels on the left of the
+// onion service address, e.g. "www.<address>.onion" or "*.<address>.onion".
+func OnionPublicKey(name string) (ed25519.PublicKey, error) {
+	if !IsOnionName(name) {
+		return nil, errors.New("name is not an onion name")
+	}
+	labels := strings.Split(strings.ToLower(name[:len(name)-len(onionSuffix)]), ".")
+	address := labels[len(labels)-1]
+	if len(address) != onionV3AddressLength {
+		return nil, errors.New("name is not an onion service v3 address")
+	}
+	b, err := onionEncoding.DecodeString(strings.ToUpper(address))
+	if err != nil {
+		return nil, errors.New("onion service address is not base32 encoded")
+	}
+	pub, checksum, version := b[:ed25519.PublicKeySize], b[ed25519.PublicKeySize:ed25519.PublicKeySize+2], b[len(b)-1]
+	if version != onionV3Version {
+		return nil, errors.New("name is not an onion service v3 address")
+	}
+	if !bytes.Equal(checksum, onionChecksum(pub, version)) {
+		return nil, errors.New("onion service address has an invalid checksum")
+	}
+	return ed25519.PublicKey(pub), nil
+}
+
+// onionChecksum returns the two bytes checksum of an onion service v3
+// address.
+func onionChecksum(pub []byte, version byte) []byte {
+	h := sha3.New256()
+	h.Write([]byte(".onion checksum"))
+	h.Write(pub)
+	h.Write([]byte{version})
+	return h.Sum(nil)[:2]
+}
+
+// NewOnionNonce generates the nonce of an onion-csr-01 challenge. The CSR sent
+// by the client must contain it in the caSigningNonce attribute.
+func NewOnionNonce(ch *Challenge) error {
+	b, err := randutil.Salt(onionNonceSize)
+	if err != nil {
+		return WrapErrorISE(err, "error generating random onion-csr-01 nonce")
+	}
+	ch.Nonce = base64.StdEncoding.EncodeToString(b)
+	return nil
+}
+
+type onionCSRPayload struct {
+	CSR string `json:"csr"`
+}
+
+// tbsCertificateRequest is used to read the attributes of a CSR, the x509
+// package does not support attributes with values other than a set of
+// attribute type and values.
+type tbsCertificateRequest struct {
+	Raw           asn1.RawContent
+	Version       int
+	Subject       asn1.RawValue
+	PublicKey     asn1.RawValue
+	RawAttributes []asn1.RawValue `asn1:"tag:0"`
+}
+
+type csrAttribute struct {
+	Type   asn1.ObjectIdentifier
+	Values []asn1.RawValue `asn1:"set"`
+}
+
+// csrSigningNonces returns the values of the caSigningNonce and
+// applicantSigningNonce attributes of the given CSR.
+func csrSigningNonces(csr *x509.CertificateRequest) (caNonce, applicantNonce []byte, err error) {
+	var tbs tbsCertificateRequest
+	if _, err := asn1.Unmarshal(csr.RawTBSCertificateRequest, &tbs); err != nil {
+		return nil, nil, err
+	}
+	for _, rawAttr := range tbs.RawAttributes {
+		var attr csrAttribute
+		if _, err := asn1.Unmarshal(rawAttr.FullBytes, &attr); err != nil {
+			return nil, nil, err
+		}
+		var value *[]byte
+		switch {
+		case attr.Type.Equal(oidCASigningNonce):
+			value = &caNonce
+		case attr.Type.Equal(oidApplicantSigningNonce):
+			value = &applicantNonce
+		default:
+			continue
+		}
+		if len(attr.Values) != 1 {
+			return nil, nil, errors.New("signing nonce attributes must have a single value")
+		}
+		if _, err := asn1.Unmarshal(attr.Values[0].FullBytes, value); err != nil {
+			return nil, nil, err
+		}
+	}
+	return caNonce, applicantNonce, nil
+}
+
+// onionCSR01Validate validates an onion-csr-01 challenge as defined in
+// RFC 9799. The client proves the control of the onion service sending a CSR
+// signed with the key of the service that contains the nonce generated by the
+// CA.
+func onionCSR01Validate(ctx context.Context, ch *Challenge, db DB, payload []byte) error {
+	// POST-as-GET requests and empty responses do not trigger the validation.
+	var p onionCSRPayload
+	if len(bytes.TrimSpace(payload)) > 0 {
+		if err := json.Unmarshal(payload, &p); err != nil {
+			return storeError(ctx, db, ch, true, WrapError(ErrorMalformedType, err,
+				"error unmarshalling JSON"))
+		}
+	}
+	if p.CSR == "" {
+		return nil
+	}
+
+	der, err := base64.RawURLEncoding.DecodeString(p.CSR)
+	if err != nil {
+		return storeError(ctx, db, ch, true, NewError(ErrorBadCSRType,
+			"failed base64 decoding csr"))
+	}
+	csr, err := x509.ParseCertificateRequest(der)
+	if err != nil {
+		return storeError(ctx, db, ch, true, WrapError(ErrorBadCSRType, err,
+			"failed parsing csr"))
+	}
+	if err := csr.CheckSignature(); err != nil {
+		return storeError(ctx, db, ch, true, WrapError(ErrorBadCSRType, err,
+			"failed verifying csr signature"))
+	}
+
+	expectedKey, err := OnionPublicKey(ch.Value)
+	if err != nil {
+		return WrapErrorISE(err, "error parsing onion name %s", ch.Value)
+	}
+	if key, ok := csr.PublicKey.(ed25519.PublicKey); !ok || !key.Equal(expectedKey) {
+		return storeError(ctx, db, ch, true, NewError(ErrorIncorrectResponseType,
+			"csr is not signed by the key of the onion service %s", ch.Value))
+	}
+
+	var found bool
+	for _, name := range csr.DNSNames {
+		if strings.EqualFold(strings.TrimPrefix(name, "*."), ch.Value) {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return storeError(ctx, db, ch, true, NewError(ErrorIncorrectResponseType,
+			"csr does not contain the onion name %s", ch.Value))
+	}
+
+	caNonce, applicantNonce, err := csrSigningNonces(csr)
+	if err != nil {
+		return storeError(ctx, db, ch, true, WrapError(ErrorBadCSRType, err,
+			"failed parsing csr attributes"))
+	}
+	expectedNonce, err := base64.StdEncoding.DecodeString(ch.Nonce)
+	if err != nil {
+		return WrapErrorISE(err, "error decoding onion-csr-01 nonce")
+	}
+	if len(caNonce) == 0 || !bytes.Equal(caNonce, expectedNonce) {
+		return storeError(ctx, db, ch, true, NewError(ErrorIncorrectResponseType,
+			"csr caSigningNonce does not match the challenge nonce"))
+	}
+	// RFC 9799 requires at least 64 bits of entropy in the applicant nonce.
+	if len(applicantNonce) < 8 {
+		return storeError(ctx, db, ch, true, NewError(ErrorIncorrectResponseType,
+			"csr applicantSigningNonce must contain at least 64 bits"))
+	}
+
+	// Update and store the challenge.
+	ch.Status = StatusValid
+	ch.Error = nil
+	ch.ValidatedAt = clock.Now().Format(time.RFC3339)
+
+	if err := db.UpdateChallenge(ctx, ch); err != nil {
+		return WrapErrorISE(err, "error updating challenge")
+	}
+	return nil
+}
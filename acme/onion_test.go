@@ -0,0 +1,275 @@
+package acme
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func mustOnionName(t *testing.T, pub ed25519.PublicKey) string {
+	t.Helper()
+	b := append([]byte{}, pub...)
+	b = append(b, onionChecksum(pub, onionV3Version)...)
+	b = append(b, onionV3Version)
+	return strings.ToLower(onionEncoding.EncodeToString(b)) + onionSuffix
+}
+
+// mustOnionCSR creates a CSR signed by the given key with the given DNS names
+// and signing nonces. Nil nonces are not added to the CSR.
+func mustOnionCSR(t *testing.T, key ed25519.PrivateKey, dnsNames []string, caNonce, applicantNonce []byte) string {
+	t.Helper()
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		DNSNames: dnsNames,
+	}, key)
+	require.NoError(t, err)
+	csr, err := x509.ParseCertificateRequest(der)
+	require.NoError(t, err)
+
+	var tbs tbsCertificateRequest
+	_, err = asn1.Unmarshal(csr.RawTBSCertificateRequest, &tbs)
+	require.NoError(t, err)
+	tbs.Raw = nil
+	for _, attr := range []struct {
+		oid   asn1.ObjectIdentifier
+		value []byte
+	}{{oidCASigningNonce, caNonce}, {oidApplicantSigningNonce, applicantNonce}} {
+		if attr.value == nil {
+			continue
+		}
+		value, err := asn1.Marshal(attr.value)
+		require.NoError(t, err)
+		b, err := asn1.Marshal(csrAttribute{Type: attr.oid, Values: []asn1.RawValue{{FullBytes: value}}})
+		require.NoError(t, err)
+		tbs.RawAttributes = append(tbs.RawAttributes, asn1.RawValue{FullBytes: b})
+	}
+	tbsDER, err := asn1.Marshal(tbs)
+	require.NoError(t, err)
+
+	der, err = asn1.Marshal(struct {
+		TBS                asn1.RawValue
+		SignatureAlgorithm pkix.AlgorithmIdentifier
+		Signature          asn1.BitString
+	}{
+		TBS:                asn1.RawValue{FullBytes: tbsDER},
+		SignatureAlgorithm: pkix.AlgorithmIdentifier{Algorithm: asn1.ObjectIdentifier{1, 3, 101, 112}},
+		Signature:          asn1.BitString{Bytes: ed25519.Sign(key, tbsDER), BitLength: 8 * ed25519.SignatureSize},
+	})
+	require.NoError(t, err)
+	return base64.RawURLEncoding.EncodeToString(der)
+}
+
+func mustOnionPayload(t *testing.T, csr string) []byte {
+	t.Helper()
+	b, err := json.Marshal(onionCSRPayload{CSR: csr})
+	require.NoError(t, err)
+	return b
+}
+
+func TestOnionPublicKey(t *testing.T) {
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	name := mustOnionName(t, pub)
+
+	// Modify the last character of the address, the checksum will not match.
+	badChecksum := name[:10] + "a" + name[11:]
+	if badChecksum == name {
+		badChecksum = name[:10] + "b" + name[11:]
+	}
+
+	tests := []struct {
+		name    string
+		want    ed25519.PublicKey
+		wantErr bool
+	}{
+		{name, pub, false},
+		{"www." + name, pub, false},
+		{strings.ToUpper(name), pub, false},
+		{"example.com", nil, true},
+		{"expyuzz4wqqyqhjn.onion", nil, true},
+		{strings.Repeat("a", onionV3AddressLength) + onionSuffix, nil, true},
+		{strings.Repeat("1", onionV3AddressLength) + onionSuffix, nil, true},
+		{badChecksum, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := OnionPublicKey(tt.name)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestNewOnionNonce(t *testing.T) {
+	ch := &Challenge{Type: ONIONCSR01}
+	require.NoError(t, NewOnionNonce(ch))
+	b, err := base64.StdEncoding.DecodeString(ch.Nonce)
+	require.NoError(t, err)
+	assert.Len(t, b, onionNonceSize)
+}
+
+func TestOnionCSR01Validate(t *testing.T) {
+	pub, key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	_, otherKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	name := mustOnionName(t, pub)
+	caNonce := []byte("0123456789abcdef")
+	applicantNonce := []byte("fedcba9876543210")
+
+	newChallenge := func() *Challenge {
+		return &Challenge{
+			ID:     "chID",
+			Type:   ONIONCSR01,
+			Value:  name,
+			Nonce:  base64.StdEncoding.EncodeToString(caNonce),
+			Status: StatusPending,
+		}
+	}
+	invalidWith := func(t *testing.T, typ ProblemType) DB {
+		return &MockDB{
+			MockUpdateChallenge: func(ctx context.Context, updch *Challenge) error {
+				assert.Equal(t, StatusInvalid, updch.Status)
+				assert.Equal(t, officialACMEPrefix+typ.String(), updch.Error.Type)
+				return nil
+			},
+		}
+	}
+
+	type test struct {
+		payload    []byte
+		db         DB
+		wantStatus Status
+		wantErr    bool
+	}
+	tests := map[string]func(t *testing.T) test{
+		"ok": func(t *testing.T) test {
+			return test{
+				payload: mustOnionPayload(t, mustOnionCSR(t, key, []string{name}, caNonce, applicantNonce)),
+				db: &MockDB{
+					MockUpdateChallenge: func(ctx context.Context, updch *Challenge) error {
+						assert.Equal(t, StatusValid, updch.Status)
+						assert.Nil(t, updch.Error)
+						assert.NotEmpty(t, updch.ValidatedAt)
+						return nil
+					},
+				},
+				wantStatus: StatusValid,
+			}
+		},
+		"ok/wildcard": func(t *testing.T) test {
+			return test{
+				payload:    mustOnionPayload(t, mustOnionCSR(t, key, []string{"*." + name}, caNonce, applicantNonce)),
+				db:         &MockDB{MockUpdateChallenge: func(ctx context.Context, updch *Challenge) error { return nil }},
+				wantStatus: StatusValid,
+			}
+		},
+		"ok/post-as-get": func(t *testing.T) test {
+			return test{
+				payload:    nil,
+				wantStatus: StatusPending,
+			}
+		},
+		"ok/empty": func(t *testing.T) test {
+			return test{
+				payload:    []byte("{}"),
+				wantStatus: StatusPending,
+			}
+		},
+		"ok/bad-json": func(t *testing.T) test {
+			return test{
+				payload:    []byte("{"),
+				db:         invalidWith(t, ErrorMalformedType),
+				wantStatus: StatusInvalid,
+			}
+		},
+		"ok/bad-base64": func(t *testing.T) test {
+			return test{
+				payload:    mustOnionPayload(t, "!!"),
+				db:         invalidWith(t, ErrorBadCSRType),
+				wantStatus: StatusInvalid,
+			}
+		},
+		"ok/bad-csr": func(t *testing.T) test {
+			return test{
+				payload:    mustOnionPayload(t, base64.RawURLEncoding.EncodeToString([]byte("foo"))),
+				db:         invalidWith(t, ErrorBadCSRType),
+				wantStatus: StatusInvalid,
+			}
+		},
+		"ok/wrong-key": func(t *testing.T) test {
+			return test{
+				payload:    mustOnionPayload(t, mustOnionCSR(t, otherKey, []string{name}, caNonce, applicantNonce)),
+				db:         invalidWith(t, ErrorIncorrectResponseType),
+				wantStatus: StatusInvalid,
+			}
+		},
+		"ok/missing-name": func(t *testing.T) test {
+			return test{
+				payload:    mustOnionPayload(t, mustOnionCSR(t, key, []string{"example.com"}, caNonce, applicantNonce)),
+				db:         invalidWith(t, ErrorIncorrectResponseType),
+				wantStatus: StatusInvalid,
+			}
+		},
+		"ok/missing-ca-nonce": func(t *testing.T) test {
+			return test{
+				payload:    mustOnionPayload(t, mustOnionCSR(t, key, []string{name}, nil, applicantNonce)),
+				db:         invalidWith(t, ErrorIncorrectResponseType),
+				wantStatus: StatusInvalid,
+			}
+		},
+		"ok/wrong-ca-nonce": func(t *testing.T) test {
+			return test{
+				payload:    mustOnionPayload(t, mustOnionCSR(t, key, []string{name}, applicantNonce, applicantNonce)),
+				db:         invalidWith(t, ErrorIncorrectResponseType),
+				wantStatus: StatusInvalid,
+			}
+		},
+		"ok/short-applicant-nonce": func(t *testing.T) test {
+			return test{
+				payload:    mustOnionPayload(t, mustOnionCSR(t, key, []string{name}, caNonce, []byte("1234"))),
+				db:         invalidWith(t, ErrorIncorrectResponseType),
+				wantStatus: StatusInvalid,
+			}
+		},
+		"fail/update": func(t *testing.T) test {
+			return test{
+				payload: mustOnionPayload(t, mustOnionCSR(t, key, []string{name}, caNonce, applicantNonce)),
+				db: &MockDB{
+					MockUpdateChallenge: func(ctx context.Context, updch *Challenge) error {
+						return errors.New("force")
+					},
+				},
+				wantStatus: StatusValid,
+				wantErr:    true,
+			}
+		},
+	}
+	for name, run := range tests {
+		t.Run(name, func(t *testing.T) {
+			tc := run(t)
+			ch := newChallenge()
+			err := onionCSR01Validate(context.Background(), ch, tc.db, tc.payload)
+			if tc.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tc.wantStatus, ch.Status)
+		})
+	}
+}
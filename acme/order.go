@@ -7,8 +7,10 @@ import (
 	"crypto/x509"
 	"encoding/asn1"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net"
+	"net/http"
 	"net/url"
 	"sort"
 	"strings"
@@ -18,7 +20,10 @@ import (
 	"go.step.sm/crypto/x509util"
 
 	"github.com/smallstep/certificates/acme/wire"
+	"github.com/smallstep/certificates/api/render"
 	"github.com/smallstep/certificates/authority/provisioner"
+	casapi "github.com/smallstep/certificates/cas/apiv1"
+	"github.com/smallstep/certificates/policy"
 )
 
 type IdentifierType string
@@ -35,6 +40,8 @@ const (
 	WireUser IdentifierType = "wireapp-user"
 	// WireDevice is the Wire device identifier type
 	WireDevice IdentifierType = "wireapp-device"
+	// Email is the ACME email identifier type defined in RFC 8823
+	Email IdentifierType = "email"
 )
 
 // Identifier encodes the type that an order pertains to.
@@ -53,6 +60,7 @@ type Order struct {
 	Identifiers       []Identifier `json:"identifiers"`
 	NotBefore         time.Time    `json:"notBefore"`
 	NotAfter          time.Time    `json:"notAfter"`
+	Profile           string       `json:"profile,omitempty"`
 	Error             *Error       `json:"error,omitempty"`
 	AuthorizationIDs  []string     `json:"-"`
 	AuthorizationURLs []string     `json:"authorizations"`
@@ -203,7 +211,12 @@ func (o *Order) Finalize(ctx context.Context, db DB, csr *x509.CertificateReques
 	}
 
 	// canonicalize the CSR to allow for comparison
-	csr = canonicalize(csr)
+	isEmailOrder := o.containsEmailIdentifiers()
+	if isEmailOrder {
+		csr = canonicalizeEmail(csr)
+	} else {
+		csr = canonicalize(csr)
+	}
 
 	// Template data
 	data := x509util.NewTemplateData()
@@ -264,9 +277,13 @@ func (o *Order) Finalize(ctx context.Context, db DB, csr *x509.CertificateReques
 		})
 		extraOptions = append(extraOptions, provisioner.AttestationData{
 			PermanentIdentifier: permanentIdentifier,
+			Fingerprint:         fingerprint,
 		})
 	} else {
 		defaultTemplate = x509util.DefaultLeafTemplate
+		if isEmailOrder {
+			defaultTemplate = provisioner.DefaultSMIMELeafTemplate
+		}
 		sans, err := o.sans(csr)
 		if err != nil {
 			return err
@@ -289,7 +306,24 @@ func (o *Order) Finalize(ctx context.Context, db DB, csr *x509.CertificateReques
 		}
 	}
 
-	templateOptions, err := provisioner.CustomTemplateOptions(p.GetOptions(), data, defaultTemplate)
+	// The code-signing profile can require the key to be attested using the
+	// device-attest-01 challenge.
+	provOptions := p.GetOptions()
+	if o.Profile != "" {
+		profile, err := p.GetProfile(o.Profile)
+		if err != nil {
+			return WrapError(ErrorInvalidProfileType, err, "error retrieving profile for order %s", o.ID)
+		}
+		provOptions = profile.GetOptions(provOptions)
+	}
+	if cs := provOptions.GetCodeSigningOptions(); cs != nil {
+		if cs.IsAttestationRequired() && fingerprint == "" {
+			return NewError(ErrorUnauthorizedType, "order %s requires an attested key", o.ID)
+		}
+		defaultTemplate = provisioner.DefaultCodeSigningLeafTemplate
+	}
+
+	templateOptions, err := provisioner.CustomTemplateOptions(provOptions, data, defaultTemplate)
 	if err != nil {
 		return WrapErrorISE(err, "error creating template options from ACME provisioner")
 	}
@@ -297,6 +331,10 @@ func (o *Order) Finalize(ctx context.Context, db DB, csr *x509.CertificateReques
 	// Build extra signing options.
 	signOps = append(signOps, templateOptions)
 	signOps = append(signOps, extraOptions...)
+	signOps = append(signOps, provisioner.RequestMetadata{
+		Requester:   o.AccountID,
+		ACMEOrderID: o.ID,
+	})
 
 	// Sign a new certificate.
 	certChain, err := auth.SignWithContext(ctx, csr, provisioner.SignOptions{
@@ -304,7 +342,7 @@ func (o *Order) Finalize(ctx context.Context, db DB, csr *x509.CertificateReques
 		NotAfter:  provisioner.NewTimeDuration(o.NotAfter),
 	}, signOps...)
 	if err != nil {
-		return WrapErrorISE(err, "error signing certificate for order %s", o.ID)
+		return signError(o, err)
 	}
 
 	cert := &Certificate{
@@ -327,6 +365,34 @@ func (o *Order) Finalize(ctx context.Context, db DB, csr *x509.CertificateReques
 	return nil
 }
 
+// signError converts an error signing the certificate of an order to an ACME
+// error. Rate limited requests include the time to wait before retrying, and
+// the names rejected by a policy are reported as subproblems.
+func signError(o *Order, err error) *Error {
+	var tooManyErr casapi.TooManyRequestsError
+	if errors.As(err, &tooManyErr) {
+		acmeErr := NewError(ErrorRateLimitedType, "error signing certificate for order %s: %s", o.ID, tooManyErr.Error())
+		acmeErr.Status = http.StatusTooManyRequests
+		acmeErr.RetryAfter = tooManyErr.RetryAfter
+		return acmeErr
+	}
+
+	var policyErr *policy.NamePolicyError
+	if errors.As(err, &policyErr) && policyErr.Reason == policy.NotAllowed {
+		return WrapError(ErrorRejectedIdentifierType, err, "error signing certificate for order %s", o.ID).
+			AddSubproblems(NewPolicySubproblem(policyErr))
+	}
+
+	var sc render.StatusCodedError
+	if errors.As(err, &sc) && sc.StatusCode() == http.StatusForbidden {
+		acmeErr := WrapError(ErrorUnauthorizedType, err, "error signing certificate for order %s", o.ID)
+		acmeErr.Status = http.StatusForbidden
+		return acmeErr
+	}
+
+	return WrapErrorISE(err, "error signing certificate for order %s", o.ID)
+}
+
 // containsWireIdentifiers checks if [Order] contains ACME
 // identifiers for the WireUser or WireDevice types.
 func (o *Order) containsWireIdentifiers() bool {
@@ -338,6 +404,17 @@ func (o *Order) containsWireIdentifiers() bool {
 	return false
 }
 
+// containsEmailIdentifiers checks if [Order] contains ACME identifiers for
+// the Email type.
+func (o *Order) containsEmailIdentifiers() bool {
+	for _, i := range o.Identifiers {
+		if i.Type == Email {
+			return true
+		}
+	}
+	return false
+}
+
 // createWireSubject creates the subject for an [Order] with WireUser identifiers.
 func createWireSubject(o *Order, csr *x509.CertificateRequest) (subject x509util.Subject, err error) {
 	wireUserIDs, wireDeviceIDs, otherIDs := 0, 0, 0
@@ -388,7 +465,7 @@ func createWireSubject(o *Order, csr *x509.CertificateRequest) (subject x509util
 
 func (o *Order) sans(csr *x509.CertificateRequest) ([]x509util.SubjectAlternativeName, error) {
 	var sans []x509util.SubjectAlternativeName
-	if len(csr.EmailAddresses) > 0 {
+	if len(csr.EmailAddresses) > 0 && numberOfIdentifierType(Email, o.Identifiers) == 0 {
 		return sans, NewError(ErrorBadCSRType, "Only DNS names and IP addresses are allowed")
 	}
 
@@ -396,8 +473,9 @@ func (o *Order) sans(csr *x509.CertificateRequest) ([]x509util.SubjectAlternativ
 	orderNames := make([]string, numberOfIdentifierType(DNS, o.Identifiers))
 	orderIPs := make([]net.IP, numberOfIdentifierType(IP, o.Identifiers))
 	orderPIDs := make([]string, numberOfIdentifierType(PermanentIdentifier, o.Identifiers))
+	orderEmails := make([]string, numberOfIdentifierType(Email, o.Identifiers))
 	tmpOrderURIs := make([]*url.URL, numberOfIdentifierType(WireUser, o.Identifiers)+numberOfIdentifierType(WireDevice, o.Identifiers))
-	indexDNS, indexIP, indexPID, indexURI := 0, 0, 0, 0
+	indexDNS, indexIP, indexPID, indexURI, indexEmail := 0, 0, 0, 0, 0
 	for _, n := range o.Identifiers {
 		switch n.Type {
 		case DNS:
@@ -409,6 +487,9 @@ func (o *Order) sans(csr *x509.CertificateRequest) ([]x509util.SubjectAlternativ
 		case PermanentIdentifier:
 			orderPIDs[indexPID] = n.Value
 			indexPID++
+		case Email:
+			orderEmails[indexEmail] = n.Value
+			indexEmail++
 		case WireUser:
 			wireID, err := wire.ParseUserID(n.Value)
 			if err != nil {
@@ -438,8 +519,9 @@ func (o *Order) sans(csr *x509.CertificateRequest) ([]x509util.SubjectAlternativ
 	orderNames = uniqueSortedLowerNames(orderNames)
 	orderIPs = uniqueSortedIPs(orderIPs)
 	orderURIs := uniqueSortedURIStrings(tmpOrderURIs)
+	orderEmails = uniqueSortedEmails(orderEmails)
 
-	totalNumberOfSANs := len(csr.DNSNames) + len(csr.IPAddresses) + len(csr.URIs)
+	totalNumberOfSANs := len(csr.DNSNames) + len(csr.IPAddresses) + len(csr.URIs) + len(csr.EmailAddresses)
 	sans = make([]x509util.SubjectAlternativeName, totalNumberOfSANs)
 	index := 0
 
@@ -502,6 +584,23 @@ func (o *Order) sans(csr *x509.CertificateRequest) ([]x509util.SubjectAlternativ
 		index++
 	}
 
+	if len(csr.EmailAddresses) != len(orderEmails) {
+		return sans, NewError(ErrorBadCSRType, "CSR emails do not match identifiers exactly: "+
+			"CSR emails = %v, Order emails = %v", csr.EmailAddresses, orderEmails)
+	}
+
+	for i := range csr.EmailAddresses {
+		if csr.EmailAddresses[i] != orderEmails[i] {
+			return sans, NewError(ErrorBadCSRType, "CSR emails do not match identifiers exactly: "+
+				"CSR emails = %v, Order emails = %v", csr.EmailAddresses, orderEmails)
+		}
+		sans[index] = x509util.SubjectAlternativeName{
+			Type:  x509util.EmailType,
+			Value: csr.EmailAddresses[i],
+		}
+		index++
+	}
+
 	return sans, nil
 }
 
@@ -548,6 +647,21 @@ func canonicalize(csr *x509.CertificateRequest) (canonicalized *x509.Certificate
 	return canonicalized
 }
 
+// canonicalizeEmail canonicalizes a CSR with email addresses so that it can be
+// compared against an Order with email identifiers. Unlike canonicalize, the
+// Subject Common Name is not added to the DNS names, as in S/MIME certificates
+// it usually contains the name of the mailbox owner. RFC 8823 allows the
+// Common Name to be an email address; in that case it's added to the email
+// addresses.
+func canonicalizeEmail(csr *x509.CertificateRequest) (canonicalized *x509.CertificateRequest) {
+	canonicalized = csr
+	if strings.Contains(csr.Subject.CommonName, "@") {
+		canonicalized.EmailAddresses = append(canonicalized.EmailAddresses, csr.Subject.CommonName)
+	}
+	canonicalized.EmailAddresses = uniqueSortedEmails(canonicalized.EmailAddresses)
+	return canonicalized
+}
+
 // ipsAreEqual compares IPs to be equal. Nil values (i.e. invalid IPs) are
 // not considered equal. IPv6 representations of IPv4 addresses are
 // considered equal to the IPv4 address in this implementation, which is
@@ -579,6 +693,27 @@ func uniqueSortedLowerNames(names []string) (unique []string) {
 	return
 }
 
+// uniqueSortedEmails returns the set of all unique email addresses in the
+// input sorted alphabetically. Only the domain part is lowercased, the local
+// part of a mailbox is case sensitive as defined in RFC 5321, section 2.4.
+func uniqueSortedEmails(emails []string) (unique []string) {
+	emailMap := make(map[string]struct{}, len(emails))
+	for _, email := range emails {
+		if i := strings.LastIndex(email, "@"); i >= 0 {
+			email = email[:i] + strings.ToLower(email[i:])
+		}
+		emailMap[email] = struct{}{}
+	}
+	unique = make([]string, 0, len(emailMap))
+	for email := range emailMap {
+		if email != "" {
+			unique = append(unique, email)
+		}
+	}
+	sort.Strings(unique)
+	return
+}
+
 func uniqueSortedURIStrings(uris []*url.URL) (unique []string) {
 	uriMap := make(map[string]struct{}, len(uris))
 	for _, name := range uris {
@@ -9,6 +9,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net"
+	"net/http"
 	"reflect"
 	"testing"
 	"time"
@@ -18,6 +19,9 @@ import (
 	"github.com/smallstep/assert"
 	"github.com/smallstep/certificates/authority"
 	"github.com/smallstep/certificates/authority/provisioner"
+	casapi "github.com/smallstep/certificates/cas/apiv1"
+	"github.com/smallstep/certificates/errs"
+	"github.com/smallstep/certificates/policy"
 	"go.step.sm/crypto/keyutil"
 	"go.step.sm/crypto/x509util"
 )
@@ -308,6 +312,10 @@ func (m *mockSignAuth) Revoke(context.Context, *authority.RevokeOptions) error {
 	return nil
 }
 
+func (m *mockSignAuth) GetAlternateX509Chains([]*x509.Certificate) [][]*x509.Certificate {
+	return nil
+}
+
 func TestOrder_Finalize(t *testing.T) {
 	mustSigner := func(kty, crv string, size int) crypto.Signer {
 		s, err := keyutil.GenerateSigner(kty, crv, size)
@@ -544,6 +552,144 @@ func TestOrder_Finalize(t *testing.T) {
 				err: NewErrorISE("error creating template options from ACME provisioner: error unmarshaling template data: invalid character 'o' in literal false (expecting 'a')"),
 			}
 		},
+		"fail/error-profile": func(t *testing.T) test {
+			now := clock.Now()
+			o := &Order{
+				ID:               "oID",
+				AccountID:        "accID",
+				Status:           StatusReady,
+				ExpiresAt:        now.Add(5 * time.Minute),
+				AuthorizationIDs: []string{"a", "b"},
+				Identifiers: []Identifier{
+					{Type: "dns", Value: "foo.internal"},
+					{Type: "dns", Value: "bar.internal"},
+				},
+				Profile: "tlsserver",
+			}
+			csr := &x509.CertificateRequest{
+				Subject: pkix.Name{
+					CommonName: "foo.internal",
+				},
+				DNSNames: []string{"bar.internal"},
+			}
+
+			return test{
+				o:   o,
+				csr: csr,
+				prov: &MockProvisioner{
+					MauthorizeSign: func(ctx context.Context, token string) ([]provisioner.SignOption, error) {
+						assert.Equals(t, token, "")
+						return nil, nil
+					},
+					MgetOptions: func() *provisioner.Options {
+						return nil
+					},
+					MgetProfile: func(name string) (*provisioner.ACMEProfile, error) {
+						assert.Equals(t, name, "tlsserver")
+						return nil, errors.New("force")
+					},
+				},
+				db: &MockDB{
+					MockGetAuthorization: func(ctx context.Context, id string) (*Authorization, error) {
+						return &Authorization{ID: id, Status: StatusValid}, nil
+					},
+				},
+				err: NewError(ErrorInvalidProfileType, "error retrieving profile for order oID: force"),
+			}
+		},
+		"fail/error-profile-template-options": func(t *testing.T) test {
+			now := clock.Now()
+			o := &Order{
+				ID:               "oID",
+				AccountID:        "accID",
+				Status:           StatusReady,
+				ExpiresAt:        now.Add(5 * time.Minute),
+				AuthorizationIDs: []string{"a", "b"},
+				Identifiers: []Identifier{
+					{Type: "dns", Value: "foo.internal"},
+					{Type: "dns", Value: "bar.internal"},
+				},
+				Profile: "tlsserver",
+			}
+			csr := &x509.CertificateRequest{
+				Subject: pkix.Name{
+					CommonName: "foo.internal",
+				},
+				DNSNames: []string{"bar.internal"},
+			}
+
+			return test{
+				o:   o,
+				csr: csr,
+				prov: &MockProvisioner{
+					MauthorizeSign: func(ctx context.Context, token string) ([]provisioner.SignOption, error) {
+						assert.Equals(t, token, "")
+						return nil, nil
+					},
+					MgetOptions: func() *provisioner.Options {
+						return nil
+					},
+					MgetProfile: func(name string) (*provisioner.ACMEProfile, error) {
+						return &provisioner.ACMEProfile{
+							Name: name,
+							X509: &provisioner.X509Options{
+								TemplateData: json.RawMessage([]byte("fo{o")),
+							},
+						}, nil
+					},
+				},
+				db: &MockDB{
+					MockGetAuthorization: func(ctx context.Context, id string) (*Authorization, error) {
+						return &Authorization{ID: id, Status: StatusValid}, nil
+					},
+				},
+				err: NewErrorISE("error creating template options from ACME provisioner: error unmarshaling template data: invalid character 'o' in literal false (expecting 'a')"),
+			}
+		},
+		"fail/code-signing-not-attested": func(t *testing.T) test {
+			now := clock.Now()
+			o := &Order{
+				ID:               "oID",
+				AccountID:        "accID",
+				Status:           StatusReady,
+				ExpiresAt:        now.Add(5 * time.Minute),
+				AuthorizationIDs: []string{"a", "b"},
+				Identifiers: []Identifier{
+					{Type: "dns", Value: "foo.internal"},
+					{Type: "dns", Value: "bar.internal"},
+				},
+			}
+			csr := &x509.CertificateRequest{
+				Subject: pkix.Name{
+					CommonName: "foo.internal",
+				},
+				DNSNames: []string{"bar.internal"},
+			}
+
+			return test{
+				o:   o,
+				csr: csr,
+				prov: &MockProvisioner{
+					MauthorizeSign: func(ctx context.Context, token string) ([]provisioner.SignOption, error) {
+						assert.Equals(t, token, "")
+						return nil, nil
+					},
+					MgetOptions: func() *provisioner.Options {
+						return &provisioner.Options{
+							CodeSigning: &provisioner.CodeSigningOptions{
+								RequireAttestation: true,
+							},
+						}
+					},
+				},
+				db: &MockDB{
+					MockGetAuthorization: func(ctx context.Context, id string) (*Authorization, error) {
+						return &Authorization{ID: id, Status: StatusValid}, nil
+					},
+				},
+				err: NewError(ErrorUnauthorizedType, "order oID requires an attested key"),
+			}
+		},
 		"fail/error-ca-sign": func(t *testing.T) test {
 			now := clock.Now()
 			o := &Order{
@@ -1324,6 +1470,36 @@ func Test_uniqueSortedIPs(t *testing.T) {
 	}
 }
 
+func Test_uniqueSortedEmails(t *testing.T) {
+	tests := []struct {
+		name   string
+		emails []string
+		want   []string
+	}{
+		{"ok/empty", []string{}, []string{}},
+		{"ok/single", []string{"Alice@Example.COM"}, []string{"Alice@example.com"}},
+		{"ok/case-sensitive-local-part", []string{"alice@example.com", "Alice@example.com"}, []string{"Alice@example.com", "alice@example.com"}},
+		{"ok/duplicates", []string{"bob@example.com", "Alice@EXAMPLE.com", "Alice@example.com", "", "bob@Example.com"}, []string{"Alice@example.com", "bob@example.com"}},
+		{"ok/quoted-at", []string{`"a@b"@Example.com`}, []string{`"a@b"@example.com`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := uniqueSortedEmails(tt.emails)
+			if !cmp.Equal(tt.want, got) {
+				t.Errorf("uniqueSortedEmails() diff =\n%s", cmp.Diff(tt.want, got))
+			}
+		})
+	}
+}
+
+func Test_canonicalizeEmail(t *testing.T) {
+	csr := canonicalizeEmail(&x509.CertificateRequest{
+		Subject:        pkix.Name{CommonName: "Alice@Example.com"},
+		EmailAddresses: []string{"Alice@example.COM", "alice@example.com"},
+	})
+	assert.Equals(t, []string{"Alice@example.com", "alice@example.com"}, csr.EmailAddresses)
+}
+
 func Test_numberOfIdentifierType(t *testing.T) {
 	type args struct {
 		typ IdentifierType
@@ -1923,3 +2099,38 @@ func TestOrder_getAuthorizationFingerprint(t *testing.T) {
 		})
 	}
 }
+
+func Test_signError(t *testing.T) {
+	o := &Order{ID: "oID"}
+	policyErr := &policy.NamePolicyError{Reason: policy.NotAllowed, NameType: policy.DNSNameType, Name: "www.example.com"}
+
+	tests := []struct {
+		name           string
+		err            error
+		wantType       ProblemType
+		wantStatus     int
+		wantRetryAfter time.Duration
+		wantSubs       []Subproblem
+	}{
+		{"rate-limited", casapi.TooManyRequestsError{Message: "slow down", RetryAfter: 90 * time.Second},
+			ErrorRateLimitedType, http.StatusTooManyRequests, 90 * time.Second, nil},
+		{"policy", errs.ForbiddenErr(policyErr, "error creating certificate"),
+			ErrorRejectedIdentifierType, http.StatusBadRequest, 0, []Subproblem{
+				NewSubproblemWithIdentifier(ErrorRejectedIdentifierType, Identifier{Type: DNS, Value: "www.example.com"},
+					`dns name "www.example.com" not allowed`),
+			}},
+		{"forbidden", errs.ForbiddenErr(errors.New("webhook denied"), "error creating certificate"),
+			ErrorUnauthorizedType, http.StatusForbidden, 0, nil},
+		{"internal", errors.New("force"),
+			ErrorServerInternalType, http.StatusInternalServerError, 0, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := signError(o, tt.err)
+			assert.Equals(t, NewError(tt.wantType, "").Type, err.Type)
+			assert.Equals(t, tt.wantStatus, err.Status)
+			assert.Equals(t, tt.wantRetryAfter, err.RetryAfter)
+			assert.Equals(t, tt.wantSubs, err.Subproblems)
+		})
+	}
+}
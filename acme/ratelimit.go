@@ -0,0 +1,118 @@
+package acme
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// RateLimitCounter is the number of events counted in a fixed window of time.
+// The window starts with the first event and ends at ResetAt.
+type RateLimitCounter struct {
+	Count   int64     `json:"count"`
+	ResetAt time.Time `json:"resetAt"`
+}
+
+// Increment returns the counter after adding a new event at the given time.
+// The counter is reset if the window has elapsed.
+func (c *RateLimitCounter) Increment(now time.Time, window time.Duration) *RateLimitCounter {
+	if c == nil || !now.Before(c.ResetAt) {
+		return &RateLimitCounter{Count: 1, ResetAt: now.Add(window)}
+	}
+	return &RateLimitCounter{Count: c.Count + 1, ResetAt: c.ResetAt}
+}
+
+// Current returns the number of events counted in the current window.
+func (c *RateLimitCounter) Current(now time.Time) int64 {
+	if c == nil || !now.Before(c.ResetAt) {
+		return 0
+	}
+	return c.Count
+}
+
+// RateLimitStore is the interface used to keep the counters of the ACME rate
+// limits. The ACME database is used as the store if it implements this
+// interface, and a different store can be set with NewRateLimitStoreContext.
+type RateLimitStore interface {
+	// GetRateLimitCounter returns the counter with the given key. It returns
+	// ErrNotFound if the counter does not exist.
+	GetRateLimitCounter(ctx context.Context, key string) (*RateLimitCounter, error)
+	// IncrementRateLimitCounter adds an event to the counter with the given
+	// key and returns the updated counter.
+	IncrementRateLimitCounter(ctx context.Context, key string, window time.Duration) (*RateLimitCounter, error)
+}
+
+type rateLimitStoreKey struct{}
+
+// NewRateLimitStoreContext adds the given rate limit store to the context.
+func NewRateLimitStoreContext(ctx context.Context, s RateLimitStore) context.Context {
+	return context.WithValue(ctx, rateLimitStoreKey{}, s)
+}
+
+// RateLimitStoreFromContext returns the store used to keep the counters of
+// the rate limits. It returns the store in the context, or the ACME database
+// in the context if it implements RateLimitStore. Otherwise, the counters are
+// kept in memory, and they are not shared between different instances of the
+// CA.
+func RateLimitStoreFromContext(ctx context.Context) RateLimitStore {
+	if s, ok := ctx.Value(rateLimitStoreKey{}).(RateLimitStore); ok {
+		return s
+	}
+	if db, ok := DatabaseFromContext(ctx); ok {
+		if s, ok := db.(RateLimitStore); ok {
+			return s
+		}
+	}
+	return defaultRateLimitStore
+}
+
+var defaultRateLimitStore = NewMemoryRateLimitStore()
+
+// memoryRateLimitCleanupInterval is the minimum time between the removals of
+// the expired counters in a MemoryRateLimitStore.
+const memoryRateLimitCleanupInterval = time.Minute
+
+// MemoryRateLimitStore is a RateLimitStore that keeps the counters in memory.
+type MemoryRateLimitStore struct {
+	mu          sync.Mutex
+	counters    map[string]*RateLimitCounter
+	lastCleanup time.Time
+}
+
+// NewMemoryRateLimitStore creates a new RateLimitStore that keeps the counters
+// in memory.
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{
+		counters: make(map[string]*RateLimitCounter),
+	}
+}
+
+// GetRateLimitCounter implements RateLimitStore.
+func (s *MemoryRateLimitStore) GetRateLimitCounter(_ context.Context, key string) (*RateLimitCounter, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.counters[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &RateLimitCounter{Count: c.Count, ResetAt: c.ResetAt}, nil
+}
+
+// IncrementRateLimitCounter implements RateLimitStore. Expired counters are
+// removed periodically when a counter is incremented.
+func (s *MemoryRateLimitStore) IncrementRateLimitCounter(_ context.Context, key string, window time.Duration) (*RateLimitCounter, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := clock.Now()
+	if now.Sub(s.lastCleanup) >= memoryRateLimitCleanupInterval {
+		for k, c := range s.counters {
+			if !now.Before(c.ResetAt) {
+				delete(s.counters, k)
+			}
+		}
+		s.lastCleanup = now
+	}
+	c := s.counters[key].Increment(now, window)
+	s.counters[key] = c
+	return &RateLimitCounter{Count: c.Count, ResetAt: c.ResetAt}, nil
+}
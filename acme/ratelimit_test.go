@@ -0,0 +1,74 @@
+package acme
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimitCounter(t *testing.T) {
+	now := time.Now()
+	var c *RateLimitCounter
+	assert.Equal(t, int64(0), c.Current(now))
+
+	c = c.Increment(now, time.Hour)
+	assert.Equal(t, &RateLimitCounter{Count: 1, ResetAt: now.Add(time.Hour)}, c)
+	c = c.Increment(now.Add(time.Minute), time.Hour)
+	assert.Equal(t, &RateLimitCounter{Count: 2, ResetAt: now.Add(time.Hour)}, c)
+	assert.Equal(t, int64(2), c.Current(now.Add(59*time.Minute)))
+
+	// The window has elapsed.
+	assert.Equal(t, int64(0), c.Current(now.Add(time.Hour)))
+	c = c.Increment(now.Add(time.Hour), time.Hour)
+	assert.Equal(t, &RateLimitCounter{Count: 1, ResetAt: now.Add(2 * time.Hour)}, c)
+}
+
+func TestMemoryRateLimitStore(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryRateLimitStore()
+
+	_, err := s.GetRateLimitCounter(ctx, "key")
+	assert.True(t, IsErrNotFound(err))
+
+	for i := int64(1); i <= 3; i++ {
+		c, err := s.IncrementRateLimitCounter(ctx, "key", time.Hour)
+		require.NoError(t, err)
+		assert.Equal(t, i, c.Count)
+	}
+	c, err := s.GetRateLimitCounter(ctx, "key")
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), c.Count)
+
+	// Expired counters are removed.
+	s.counters["expired"] = &RateLimitCounter{Count: 10, ResetAt: time.Now().Add(-time.Second)}
+	s.lastCleanup = time.Time{}
+	_, err = s.IncrementRateLimitCounter(ctx, "other", time.Hour)
+	require.NoError(t, err)
+	_, err = s.GetRateLimitCounter(ctx, "expired")
+	assert.True(t, IsErrNotFound(err))
+}
+
+type rateLimitDB struct {
+	*MockDB
+	*MemoryRateLimitStore
+}
+
+func TestRateLimitStoreFromContext(t *testing.T) {
+	ctx := context.Background()
+	assert.Same(t, defaultRateLimitStore, RateLimitStoreFromContext(ctx))
+
+	// The database is not a store.
+	ctx = NewDatabaseContext(ctx, &MockDB{})
+	assert.Same(t, defaultRateLimitStore, RateLimitStoreFromContext(ctx))
+
+	db := &rateLimitDB{MockDB: &MockDB{}, MemoryRateLimitStore: NewMemoryRateLimitStore()}
+	ctx = NewDatabaseContext(ctx, db)
+	assert.Same(t, db, RateLimitStoreFromContext(ctx))
+
+	s := NewMemoryRateLimitStore()
+	ctx = NewRateLimitStoreContext(ctx, s)
+	assert.Same(t, s, RateLimitStoreFromContext(ctx))
+}
@@ -0,0 +1,83 @@
+package acme
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// RenewalInfo is the ACME renewal information (ARI) of a certificate, as
+// defined in RFC 9773.
+type RenewalInfo struct {
+	SuggestedWindow RenewalWindow `json:"suggestedWindow"`
+	ExplanationURL  string        `json:"explanationURL,omitempty"`
+}
+
+// RenewalWindow is the interval of time in which a certificate should be
+// renewed.
+type RenewalWindow struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// NewRenewalInfo returns the renewal information of the given certificate.
+// The suggested window starts at two thirds of the certificate lifetime and
+// ends at five sixths of it. If the renewal is forced, the window is in the
+// past, so clients will renew the certificate immediately.
+func NewRenewalInfo(cert *x509.Certificate, now time.Time, forceRenewal bool) *RenewalInfo {
+	var start, end time.Time
+	if forceRenewal {
+		start, end = now.Add(-time.Hour), now
+	} else {
+		lifetime := cert.NotAfter.Sub(cert.NotBefore)
+		start = cert.NotBefore.Add(lifetime * 2 / 3)
+		end = cert.NotBefore.Add(lifetime * 5 / 6)
+	}
+	return &RenewalInfo{
+		SuggestedWindow: RenewalWindow{
+			Start: start.UTC().Truncate(time.Second),
+			End:   end.UTC().Truncate(time.Second),
+		},
+	}
+}
+
+// RenewalInfoCertID returns the unique identifier used in the renewal
+// information resource of the given certificate. It's the base64url encoding
+// of the authority key identifier and the DER encoding of the serial number,
+// separated by a dot.
+func RenewalInfoCertID(cert *x509.Certificate) string {
+	serial := cert.SerialNumber.Bytes()
+	// Add a leading zero if the highest bit is set, so the value is not
+	// interpreted as a negative number.
+	if len(serial) == 0 || serial[0]&0x80 != 0 {
+		serial = append([]byte{0}, serial...)
+	}
+	return base64.RawURLEncoding.EncodeToString(cert.AuthorityKeyId) + "." +
+		base64.RawURLEncoding.EncodeToString(serial)
+}
+
+// ParseRenewalInfoCertID parses the unique identifier used in the renewal
+// information resource and returns the authority key identifier and the
+// serial number of the certificate.
+func ParseRenewalInfoCertID(certID string) ([]byte, *big.Int, error) {
+	parts := strings.Split(certID, ".")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return nil, nil, errors.Errorf("renewal info certificate identifier %q is not valid", certID)
+	}
+	aki, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[0], "="))
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "error decoding authority key identifier")
+	}
+	serial, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "error decoding serial number")
+	}
+	if len(serial) == 0 || serial[0]&0x80 != 0 {
+		return nil, nil, errors.New("serial number must be a positive integer")
+	}
+	return aki, new(big.Int).SetBytes(serial), nil
+}
@@ -0,0 +1,69 @@
+package acme
+
+import (
+	"crypto/x509"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenewalInfoCertID(t *testing.T) {
+	// Example from RFC 9773, section 4.1.
+	cert := &x509.Certificate{
+		AuthorityKeyId: []byte{0x69, 0x88, 0x5B, 0x6B, 0x87, 0x46, 0x40, 0x41, 0xE1, 0xB3, 0x7B, 0x84, 0x7B, 0xA0, 0xAE, 0x2C, 0xDE, 0x01, 0xC8, 0xD4},
+		SerialNumber:   big.NewInt(0x0087654321),
+	}
+	assert.Equal(t, "aYhba4dGQEHhs3uEe6CuLN4ByNQ.AIdlQyE", RenewalInfoCertID(cert))
+
+	aki, serial, err := ParseRenewalInfoCertID("aYhba4dGQEHhs3uEe6CuLN4ByNQ.AIdlQyE")
+	require.NoError(t, err)
+	assert.Equal(t, cert.AuthorityKeyId, aki)
+	assert.Equal(t, cert.SerialNumber, serial)
+
+	cert.SerialNumber = big.NewInt(0x1234)
+	aki, serial, err = ParseRenewalInfoCertID(RenewalInfoCertID(cert))
+	require.NoError(t, err)
+	assert.Equal(t, cert.AuthorityKeyId, aki)
+	assert.Equal(t, cert.SerialNumber, serial)
+}
+
+func TestParseRenewalInfoCertID_errors(t *testing.T) {
+	for _, certID := range []string{
+		"",
+		"aYhba4dGQEHhs3uEe6CuLN4ByNQ",
+		"aYhba4dGQEHhs3uEe6CuLN4ByNQ.",
+		".AIdlQyE",
+		"aYhba4dGQEHhs3uEe6CuLN4ByNQ.AIdlQyE.foo",
+		"aYhba4dGQEHhs3uEe6CuLN4ByNQ.!!!",
+		"!!!.AIdlQyE",
+		"aYhba4dGQEHhs3uEe6CuLN4ByNQ.h2VDIQ", // negative serial
+	} {
+		_, _, err := ParseRenewalInfoCertID(certID)
+		assert.Error(t, err, certID)
+	}
+}
+
+func TestNewRenewalInfo(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Second)
+	cert := &x509.Certificate{
+		NotBefore: now.Add(-time.Hour),
+		NotAfter:  now.Add(23 * time.Hour),
+	}
+
+	assert.Equal(t, &RenewalInfo{
+		SuggestedWindow: RenewalWindow{
+			Start: now.Add(15 * time.Hour),
+			End:   now.Add(19 * time.Hour),
+		},
+	}, NewRenewalInfo(cert, now, false))
+
+	assert.Equal(t, &RenewalInfo{
+		SuggestedWindow: RenewalWindow{
+			Start: now.Add(-time.Hour),
+			End:   now,
+		},
+	}, NewRenewalInfo(cert, now, true))
+}
@@ -43,6 +43,7 @@ type Authority interface {
 	GetTLSOptions() *config.TLSOptions
 	Root(shasum string) (*x509.Certificate, error)
 	SignWithContext(ctx context.Context, cr *x509.CertificateRequest, opts provisioner.SignOptions, signOpts ...provisioner.SignOption) ([]*x509.Certificate, error)
+	GetPendingCertificate(ctx context.Context, id string) ([]*x509.Certificate, error)
 	Renew(peer *x509.Certificate) ([]*x509.Certificate, error)
 	RenewContext(ctx context.Context, peer *x509.Certificate, pk crypto.PublicKey) ([]*x509.Certificate, error)
 	Rekey(peer *x509.Certificate, pk crypto.PublicKey) ([]*x509.Certificate, error)
@@ -53,9 +54,12 @@ type Authority interface {
 	GetEncryptedKey(kid string) (string, error)
 	GetRoots() ([]*x509.Certificate, error)
 	GetIntermediateCertificates() []*x509.Certificate
+	GetAlternateX509Chains(chain []*x509.Certificate) [][]*x509.Certificate
 	GetFederation() ([]*x509.Certificate, error)
 	Version() authority.Version
 	GetCertificateRevocationList() (*authority.CertificateRevocationListInfo, error)
+	GetCertificateRevocationListPartition(partition int, delta bool) (*authority.CertificateRevocationListInfo, error)
+	GetOCSPResponse(der []byte) (*authority.OCSPResponse, error)
 }
 
 // mustAuthority will be replaced on unit tests.
@@ -217,6 +221,7 @@ type VersionResponse struct {
 }
 
 // HealthResponse is the response object that returns the health of the server.
+// The status is "ok" or "degraded" if the CA backend is not healthy.
 type HealthResponse struct {
 	Status string `json:"status"`
 }
@@ -328,10 +333,16 @@ func Route(r Router) {
 	r.MethodFunc("GET", "/health", Health)
 	r.MethodFunc("GET", "/root/{sha}", Root)
 	r.MethodFunc("POST", "/sign", Sign)
+	r.MethodFunc("GET", "/sign/pending/{id}", SignPending)
 	r.MethodFunc("POST", "/renew", Renew)
 	r.MethodFunc("POST", "/rekey", Rekey)
 	r.MethodFunc("POST", "/revoke", Revoke)
 	r.MethodFunc("GET", "/crl", CRL)
+	r.MethodFunc("GET", "/crl/delta", DeltaCRL)
+	r.MethodFunc("GET", "/crl/{partition}", CRL)
+	r.MethodFunc("GET", "/crl/{partition}/delta", DeltaCRL)
+	r.MethodFunc("POST", "/ocsp", OCSP)
+	r.MethodFunc("GET", "/ocsp/*", OCSP)
 	r.MethodFunc("GET", "/provisioners", Provisioners)
 	r.MethodFunc("GET", "/provisioners/{kid}/encrypted-key", ProvisionerKey)
 	r.MethodFunc("GET", "/roots", Roots)
@@ -339,6 +350,7 @@ func Route(r Router) {
 	r.MethodFunc("GET", "/intermediates", Intermediates)
 	r.MethodFunc("GET", "/intermediates.pem", IntermediatesPEM)
 	r.MethodFunc("GET", "/federation", Federation)
+	r.MethodFunc("POST", "/saml/{provisionerName}/acs", SAMLACS)
 
 	// SSH CA
 	r.MethodFunc("POST", "/ssh/sign", SSHSign)
@@ -368,8 +380,38 @@ func Version(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-// Health is an HTTP handler that returns the status of the server.
+// healthChecker is the interface used to check the health of the CA backend.
+type healthChecker interface {
+	CheckHealth(ctx context.Context) error
+}
+
+// healthCheckerFromContext returns the health checker from the context. It
+// will be replaced on unit tests.
+var healthCheckerFromContext = func(ctx context.Context) (healthChecker, bool) {
+	a, ok := authority.FromContext(ctx)
+	if !ok {
+		return nil, false
+	}
+	return a, true
+}
+
+// healthCheckTimeout is the maximum time used to check the health of the CA
+// backend.
+const healthCheckTimeout = 5 * time.Second
+
+// Health is an HTTP handler that returns the status of the server. The status
+// is "degraded" if the CA backend, e.g., the upstream CA of an RA or a KMS, is
+// not healthy.
 func Health(w http.ResponseWriter, r *http.Request) {
+	if hc, ok := healthCheckerFromContext(r.Context()); ok {
+		ctx, cancel := context.WithTimeout(r.Context(), healthCheckTimeout)
+		defer cancel()
+		if err := hc.CheckHealth(ctx); err != nil {
+			log.Error(w, r, errors.Wrap(err, "health check failed"))
+			render.JSON(w, r, HealthResponse{Status: "degraded"})
+			return
+		}
+	}
 	render.JSON(w, r, HealthResponse{Status: "ok"})
 }
 
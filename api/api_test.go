@@ -37,6 +37,7 @@ import (
 
 	"github.com/smallstep/certificates/authority"
 	"github.com/smallstep/certificates/authority/provisioner"
+	casapi "github.com/smallstep/certificates/cas/apiv1"
 	"github.com/smallstep/certificates/errs"
 	"github.com/smallstep/certificates/logging"
 	"github.com/smallstep/certificates/templates"
@@ -198,6 +199,7 @@ type mockAuthority struct {
 	getTLSOptions                func() *authority.TLSOptions
 	root                         func(shasum string) (*x509.Certificate, error)
 	signWithContext              func(ctx context.Context, cr *x509.CertificateRequest, opts provisioner.SignOptions, signOpts ...provisioner.SignOption) ([]*x509.Certificate, error)
+	getPendingCertificate        func(ctx context.Context, id string) ([]*x509.Certificate, error)
 	renew                        func(cert *x509.Certificate) ([]*x509.Certificate, error)
 	rekey                        func(oldCert *x509.Certificate, pk crypto.PublicKey) ([]*x509.Certificate, error)
 	renewContext                 func(ctx context.Context, oldCert *x509.Certificate, pk crypto.PublicKey) ([]*x509.Certificate, error)
@@ -208,8 +210,11 @@ type mockAuthority struct {
 	getEncryptedKey              func(kid string) (string, error)
 	getRoots                     func() ([]*x509.Certificate, error)
 	getIntermediateCertificates  func() []*x509.Certificate
+	getAlternateX509Chains       func(chain []*x509.Certificate) [][]*x509.Certificate
 	getFederation                func() ([]*x509.Certificate, error)
 	getCRL                       func() (*authority.CertificateRevocationListInfo, error)
+	getCRLPartition              func(partition int, delta bool) (*authority.CertificateRevocationListInfo, error)
+	getOCSPResponse              func(der []byte) (*authority.OCSPResponse, error)
 	signSSH                      func(ctx context.Context, key ssh.PublicKey, opts provisioner.SignSSHOptions, signOpts ...provisioner.SignOption) (*ssh.Certificate, error)
 	signSSHAddUser               func(ctx context.Context, key ssh.PublicKey, cert *ssh.Certificate) (*ssh.Certificate, error)
 	renewSSH                     func(ctx context.Context, cert *ssh.Certificate) (*ssh.Certificate, error)
@@ -231,6 +236,22 @@ func (m *mockAuthority) GetCertificateRevocationList() (*authority.CertificateRe
 	return m.ret1.(*authority.CertificateRevocationListInfo), m.err
 }
 
+func (m *mockAuthority) GetCertificateRevocationListPartition(partition int, delta bool) (*authority.CertificateRevocationListInfo, error) {
+	if m.getCRLPartition != nil {
+		return m.getCRLPartition(partition, delta)
+	}
+
+	return m.ret1.(*authority.CertificateRevocationListInfo), m.err
+}
+
+func (m *mockAuthority) GetOCSPResponse(der []byte) (*authority.OCSPResponse, error) {
+	if m.getOCSPResponse != nil {
+		return m.getOCSPResponse(der)
+	}
+
+	return m.ret1.(*authority.OCSPResponse), m.err
+}
+
 // TODO: remove once Authorize is deprecated.
 func (m *mockAuthority) Authorize(ctx context.Context, ott string) ([]provisioner.SignOption, error) {
 	if m.authorize != nil {
@@ -267,6 +288,13 @@ func (m *mockAuthority) SignWithContext(ctx context.Context, cr *x509.Certificat
 	return []*x509.Certificate{m.ret1.(*x509.Certificate), m.ret2.(*x509.Certificate)}, m.err
 }
 
+func (m *mockAuthority) GetPendingCertificate(ctx context.Context, id string) ([]*x509.Certificate, error) {
+	if m.getPendingCertificate != nil {
+		return m.getPendingCertificate(ctx, id)
+	}
+	return []*x509.Certificate{m.ret1.(*x509.Certificate), m.ret2.(*x509.Certificate)}, m.err
+}
+
 func (m *mockAuthority) Renew(cert *x509.Certificate) ([]*x509.Certificate, error) {
 	if m.renew != nil {
 		return m.renew(cert)
@@ -337,6 +365,13 @@ func (m *mockAuthority) GetIntermediateCertificates() []*x509.Certificate {
 	return m.ret1.([]*x509.Certificate)
 }
 
+func (m *mockAuthority) GetAlternateX509Chains(chain []*x509.Certificate) [][]*x509.Certificate {
+	if m.getAlternateX509Chains != nil {
+		return m.getAlternateX509Chains(chain)
+	}
+	return nil
+}
+
 func (m *mockAuthority) GetFederation() ([]*x509.Certificate, error) {
 	if m.getFederation != nil {
 		return m.getFederation()
@@ -850,6 +885,53 @@ func Test_Health(t *testing.T) {
 	}
 }
 
+type mockHealthChecker struct {
+	err error
+}
+
+func (m *mockHealthChecker) CheckHealth(context.Context) error {
+	return m.err
+}
+
+func Test_Health_checker(t *testing.T) {
+	tmp := healthCheckerFromContext
+	t.Cleanup(func() {
+		healthCheckerFromContext = tmp
+	})
+
+	tests := []struct {
+		name     string
+		checker  healthChecker
+		expected []byte
+	}{
+		{"ok", &mockHealthChecker{}, []byte("{\"status\":\"ok\"}\n")},
+		{"degraded", &mockHealthChecker{err: errors.New("upstream is down")}, []byte("{\"status\":\"degraded\"}\n")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			healthCheckerFromContext = func(context.Context) (healthChecker, bool) {
+				return tt.checker, true
+			}
+			req := httptest.NewRequest("GET", "http://example.com/health", http.NoBody)
+			w := httptest.NewRecorder()
+			Health(w, req)
+
+			res := w.Result()
+			if res.StatusCode != 200 {
+				t.Errorf("caHandler.Health StatusCode = %d, wants 200", res.StatusCode)
+			}
+			body, err := io.ReadAll(res.Body)
+			res.Body.Close()
+			if err != nil {
+				t.Errorf("caHandler.Health unexpected error = %v", err)
+			}
+			if !bytes.Equal(body, tt.expected) {
+				t.Errorf("caHandler.Health Body = %s, wants %s", body, tt.expected)
+			}
+		})
+	}
+}
+
 func Test_Root(t *testing.T) {
 	tests := []struct {
 		name       string
@@ -926,7 +1008,10 @@ func Test_Sign(t *testing.T) {
 		{"json read error", "{", nil, nil, nil, nil, nil, http.StatusBadRequest, nil},
 		{"validate error", string(invalid), nil, nil, nil, nil, nil, http.StatusBadRequest, nil},
 		{"authorize error", string(valid), nil, fmt.Errorf("an error"), nil, nil, nil, http.StatusUnauthorized, nil},
+		{"authorize too many requests", string(valid), nil, errs.Wrap(http.StatusInternalServerError, casapi.TooManyRequestsError{Message: "token rate limit exceeded", RetryAfter: time.Minute}, "authority.Authorize"), nil, nil, nil, http.StatusTooManyRequests, nil},
 		{"sign error", string(valid), nil, nil, nil, nil, fmt.Errorf("an error"), http.StatusForbidden, nil},
+		{"sign pending", string(valid), nil, nil, nil, nil, casapi.PendingCertificateError{ID: "1234", RetryAfter: time.Minute}, http.StatusAccepted, []byte(`{"id":"1234","status":"pending"}`)},
+		{"sign too many requests", string(valid), nil, nil, nil, nil, casapi.TooManyRequestsError{Message: "certificate rate limit exceeded", RetryAfter: time.Minute}, http.StatusTooManyRequests, nil},
 	}
 
 	for _, tt := range tests {
@@ -963,6 +1048,134 @@ func Test_Sign(t *testing.T) {
 	}
 }
 
+func Test_SignPending(t *testing.T) {
+	expected := []byte(`{"crt":"` + strings.ReplaceAll(certPEM, "\n", `\n`) + `\n","ca":"` + strings.ReplaceAll(rootPEM, "\n", `\n`) + `\n","certChain":["` + strings.ReplaceAll(certPEM, "\n", `\n`) + `\n","` + strings.ReplaceAll(rootPEM, "\n", `\n`) + `\n"]}`)
+
+	tests := []struct {
+		name       string
+		cert       *x509.Certificate
+		root       *x509.Certificate
+		err        error
+		statusCode int
+		retryAfter string
+		expected   []byte
+	}{
+		{"ok", parseCertificate(certPEM), parseCertificate(rootPEM), nil, http.StatusOK, "", expected},
+		{"pending", nil, nil, casapi.PendingCertificateError{ID: "1234", RetryAfter: 1500 * time.Millisecond}, http.StatusAccepted, "2", []byte(`{"id":"1234","status":"pending"}`)},
+		{"pending no retry", nil, nil, casapi.PendingCertificateError{ID: "1234"}, http.StatusAccepted, "1", []byte(`{"id":"1234","status":"pending"}`)},
+		{"fail", nil, nil, errs.NotFound("not found"), http.StatusNotFound, "", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockMustAuthority(t, &mockAuthority{
+				getPendingCertificate: func(ctx context.Context, id string) ([]*x509.Certificate, error) {
+					assert.Equal(t, "1234", id)
+					if tt.err != nil {
+						return nil, tt.err
+					}
+					return []*x509.Certificate{tt.cert, tt.root}, nil
+				},
+				getTLSOptions: func() *authority.TLSOptions {
+					return nil
+				},
+			})
+
+			chiCtx := chi.NewRouteContext()
+			chiCtx.URLParams.Add("id", "1234")
+			req := httptest.NewRequest("GET", "http://example.com/sign/pending/1234", http.NoBody)
+			req = req.WithContext(context.WithValue(context.Background(), chi.RouteCtxKey, chiCtx))
+			w := httptest.NewRecorder()
+			SignPending(logging.NewResponseLogger(w), req)
+			res := w.Result()
+
+			assert.Equal(t, tt.statusCode, res.StatusCode)
+			assert.Equal(t, tt.retryAfter, res.Header.Get("Retry-After"))
+
+			body, err := io.ReadAll(res.Body)
+			res.Body.Close()
+			require.NoError(t, err)
+			if tt.statusCode < http.StatusBadRequest {
+				assert.Equal(t, tt.expected, bytes.TrimSpace(body))
+			}
+		})
+	}
+}
+
+func Test_preferredChain(t *testing.T) {
+	newCert := func(subject, issuer string) *x509.Certificate {
+		return &x509.Certificate{
+			Subject: pkix.Name{CommonName: subject},
+			Issuer:  pkix.Name{CommonName: issuer},
+		}
+	}
+
+	leaf := newCert("leaf", "Intermediate CA")
+	chain := []*x509.Certificate{leaf, newCert("Intermediate CA", "Old Root CA")}
+	alternate := []*x509.Certificate{leaf, newCert("Intermediate CA", "New Root CA"), newCert("New Root CA", "New Root CA")}
+
+	tests := []struct {
+		name       string
+		preferred  string
+		alternates [][]*x509.Certificate
+		want       []*x509.Certificate
+	}{
+		{"ok default", "Old Root CA", [][]*x509.Certificate{alternate}, chain},
+		{"ok default intermediate", "Intermediate CA", [][]*x509.Certificate{alternate}, chain},
+		{"ok alternate", "New Root CA", [][]*x509.Certificate{alternate}, alternate},
+		{"ok not found", "Other Root CA", [][]*x509.Certificate{alternate}, chain},
+		{"ok no alternates", "New Root CA", nil, chain},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, preferredChain(tt.preferred, chain, tt.alternates))
+		})
+	}
+}
+
+func Test_renderTooManyRequests(t *testing.T) {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "http://example.com/sign", http.NoBody)
+	renderTooManyRequests(logging.NewResponseLogger(w), req, casapi.TooManyRequestsError{
+		Message:    "certificate rate limit exceeded",
+		RetryAfter: 1500 * time.Millisecond,
+	})
+	res := w.Result()
+	body, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	require.NoError(t, err)
+
+	assert.Equal(t, http.StatusTooManyRequests, res.StatusCode)
+	assert.Equal(t, "2", res.Header.Get("Retry-After"))
+	assert.JSONEq(t, `{"status":429,"message":"certificate rate limit exceeded"}`, string(body))
+}
+
+func Test_renderAuthorizeError(t *testing.T) {
+	tests := []struct {
+		name           string
+		err            error
+		wantStatusCode int
+		wantRetryAfter string
+	}{
+		{"unauthorized", errors.New("an error"), http.StatusUnauthorized, ""},
+		{"too many requests", errs.Wrap(http.StatusInternalServerError, casapi.TooManyRequestsError{
+			Message:    "provisioner has exceeded its limit of tokens per minute",
+			RetryAfter: 30 * time.Second,
+		}, "authority.Authorize"), http.StatusTooManyRequests, "30"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("POST", "http://example.com/sign", http.NoBody)
+			renderAuthorizeError(logging.NewResponseLogger(w), req, tt.err)
+			res := w.Result()
+			res.Body.Close()
+			assert.Equal(t, tt.wantStatusCode, res.StatusCode)
+			assert.Equal(t, tt.wantRetryAfter, res.Header.Get("Retry-After"))
+		})
+	}
+}
+
 func Test_Renew(t *testing.T) {
 	cs := &tls.ConnectionState{
 		PeerCertificates: []*x509.Certificate{parseCertificate(certPEM)},
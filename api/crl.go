@@ -3,15 +3,46 @@ package api
 import (
 	"encoding/pem"
 	"net/http"
+	"strconv"
 	"time"
 
+	"github.com/go-chi/chi/v5"
+
 	"github.com/smallstep/certificates/api/render"
+	"github.com/smallstep/certificates/authority"
 	"github.com/smallstep/certificates/errs"
 )
 
-// CRL is an HTTP handler that returns the current CRL in DER or PEM format
+// CRL is an HTTP handler that returns the current CRL in DER or PEM format.
+// If the partition URL parameter is set, it returns the given CRL partition.
 func CRL(w http.ResponseWriter, r *http.Request) {
-	crlInfo, err := mustAuthority(r.Context()).GetCertificateRevocationList()
+	renderCRL(w, r, false)
+}
+
+// DeltaCRL is an HTTP handler that returns the current delta CRL, of the full
+// CRL or of the partition in the URL, in DER or PEM format.
+func DeltaCRL(w http.ResponseWriter, r *http.Request) {
+	renderCRL(w, r, true)
+}
+
+func renderCRL(w http.ResponseWriter, r *http.Request, delta bool) {
+	var (
+		crlInfo *authority.CertificateRevocationListInfo
+		err     error
+	)
+	partition := chi.URLParam(r, "partition")
+	if partition == "" && !delta {
+		crlInfo, err = mustAuthority(r.Context()).GetCertificateRevocationList()
+	} else {
+		var n int
+		if partition != "" {
+			if n, err = strconv.Atoi(partition); err != nil || n < 1 {
+				render.Error(w, r, errs.New(http.StatusNotFound, "CRL partition %s does not exist", partition))
+				return
+			}
+		}
+		crlInfo, err = mustAuthority(r.Context()).GetCertificateRevocationListPartition(n, delta)
+	}
 	if err != nil {
 		render.Error(w, r, err)
 		return
@@ -91,3 +91,49 @@ func Test_CRL(t *testing.T) {
 		})
 	}
 }
+
+func Test_CRL_partitions(t *testing.T) {
+	data := []byte{1, 2, 3, 4}
+	tests := []struct {
+		name          string
+		url           string
+		statusCode    int
+		wantPartition int
+		wantDelta     bool
+	}{
+		{"ok/partition", "/crl/3", http.StatusOK, 3, false},
+		{"ok/delta", "/crl/delta", http.StatusOK, 0, true},
+		{"ok/partition-delta", "/crl/3/delta", http.StatusOK, 3, true},
+		{"fail/partition-zero", "/crl/0", http.StatusNotFound, 0, false},
+		{"fail/partition-name", "/crl/foo", http.StatusNotFound, 0, false},
+		{"fail/partition-delta", "/crl/foo/delta", http.StatusNotFound, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var called bool
+			mockMustAuthority(t, &mockAuthority{getCRLPartition: func(partition int, delta bool) (*authority.CertificateRevocationListInfo, error) {
+				called = true
+				assert.Equal(t, tt.wantPartition, partition)
+				assert.Equal(t, tt.wantDelta, delta)
+				return &authority.CertificateRevocationListInfo{Data: data}, nil
+			}})
+
+			r := chi.NewRouter()
+			r.Get("/crl/delta", DeltaCRL)
+			r.Get("/crl/{partition}", CRL)
+			r.Get("/crl/{partition}/delta", DeltaCRL)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest("GET", tt.url, http.NoBody))
+			res := w.Result()
+
+			assert.Equal(t, tt.statusCode, res.StatusCode)
+			assert.Equal(t, tt.statusCode == http.StatusOK, called)
+			if tt.statusCode == http.StatusOK {
+				body, err := io.ReadAll(res.Body)
+				require.NoError(t, err)
+				assert.Equal(t, data, body)
+				assert.Equal(t, "application/pkix-crl", res.Header.Get("Content-Type"))
+			}
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package api
+
+import (
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/pkg/errors"
+
+	"github.com/smallstep/certificates/api/render"
+	"github.com/smallstep/certificates/errs"
+)
+
+// maxOCSPRequestSize is the maximum size of an OCSP request.
+const maxOCSPRequestSize = 64 * 1024
+
+// OCSP is an HTTP handler that returns the OCSP response for a DER-encoded
+// OCSP request. As defined in RFC 6960, appendix A, the request can be sent in
+// the body of a POST request, or base64 encoded in the path of a GET request.
+func OCSP(w http.ResponseWriter, r *http.Request) {
+	var (
+		der []byte
+		err error
+	)
+	if r.Method == http.MethodGet {
+		der, err = decodeOCSPRequest(chi.URLParam(r, "*"))
+	} else {
+		der, err = io.ReadAll(io.LimitReader(r.Body, maxOCSPRequestSize))
+	}
+	if err != nil {
+		render.Error(w, r, errs.BadRequestErr(err, "error reading ocsp request"))
+		return
+	}
+
+	resp, err := mustAuthority(r.Context()).GetOCSPResponse(der)
+	if err != nil {
+		render.Error(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/ocsp-response")
+	if !resp.ThisUpdate.IsZero() && !resp.NextUpdate.IsZero() {
+		maxAge := int(time.Until(resp.NextUpdate).Seconds())
+		if maxAge < 0 {
+			maxAge = 0
+		}
+		w.Header().Set("Last-Modified", resp.ThisUpdate.UTC().Format(http.TimeFormat))
+		w.Header().Set("Expires", resp.NextUpdate.UTC().Format(http.TimeFormat))
+		w.Header().Set("Cache-Control", "max-age="+strconv.Itoa(maxAge)+", public, no-transform, must-revalidate")
+	}
+	w.Write(resp.Data)
+}
+
+// decodeOCSPRequest decodes the url encoded base64 request of an OCSP GET
+// request.
+func decodeOCSPRequest(s string) ([]byte, error) {
+	s, err := url.PathUnescape(s)
+	if err != nil {
+		return nil, err
+	}
+	if s == "" {
+		return nil, errors.New("ocsp request cannot be empty")
+	}
+	return base64.StdEncoding.DecodeString(s)
+}
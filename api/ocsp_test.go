@@ -0,0 +1,93 @@
+package api
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/smallstep/certificates/authority"
+	"github.com/smallstep/certificates/errs"
+)
+
+func Test_OCSP(t *testing.T) {
+	der := []byte{0x30, 0x03, 0x02, 0x01, 0x01}
+	data := []byte{1, 2, 3, 4}
+	now := time.Now().UTC().Truncate(time.Second)
+	ok := &authority.OCSPResponse{Data: data, ThisUpdate: now, NextUpdate: now.Add(time.Hour)}
+	getURL := "/ocsp/" + url.PathEscape(base64.StdEncoding.EncodeToString(der))
+
+	tests := []struct {
+		name            string
+		method          string
+		url             string
+		body            []byte
+		resp            *authority.OCSPResponse
+		err             error
+		statusCode      int
+		expectedBody    []byte
+		expectedHeaders http.Header
+	}{
+		{"ok/post", "POST", "/ocsp", der, ok, nil, http.StatusOK, data, http.Header{
+			"Content-Type":  []string{"application/ocsp-response"},
+			"Last-Modified": []string{now.Format(http.TimeFormat)},
+			"Expires":       []string{now.Add(time.Hour).Format(http.TimeFormat)},
+		}},
+		{"ok/get", "GET", getURL, nil, ok, nil, http.StatusOK, data, http.Header{
+			"Content-Type": []string{"application/ocsp-response"},
+		}},
+		{"ok/error-response", "POST", "/ocsp", der, &authority.OCSPResponse{Data: []byte{0x30, 0x03, 0x0a, 0x01, 0x01}}, nil, http.StatusOK, []byte{0x30, 0x03, 0x0a, 0x01, 0x01}, http.Header{
+			"Content-Type": []string{"application/ocsp-response"},
+		}},
+		{"fail/get-base64", "GET", "/ocsp/%25%25%25", nil, ok, nil, http.StatusBadRequest, nil, http.Header{}},
+		{"fail/get-empty", "GET", "/ocsp/", nil, ok, nil, http.StatusBadRequest, nil, http.Header{}},
+		{"fail/not-found", "POST", "/ocsp", der, nil, errs.Wrap(http.StatusNotFound, errors.New("OCSP responder is not enabled"), "authority.GetOCSPResponse"), http.StatusNotFound, nil, http.Header{}},
+		{"fail/internal", "POST", "/ocsp", der, nil, errs.Wrap(http.StatusInternalServerError, errors.New("failure"), "authority.GetOCSPResponse"), http.StatusInternalServerError, nil, http.Header{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotDER []byte
+			mockMustAuthority(t, &mockAuthority{getOCSPResponse: func(b []byte) (*authority.OCSPResponse, error) {
+				gotDER = b
+				return tt.resp, tt.err
+			}})
+
+			r := chi.NewRouter()
+			r.Post("/ocsp", OCSP)
+			r.Get("/ocsp/*", OCSP)
+			req := httptest.NewRequest(tt.method, tt.url, bytes.NewReader(tt.body))
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			res := w.Result()
+
+			assert.Equal(t, tt.statusCode, res.StatusCode)
+			body, err := io.ReadAll(res.Body)
+			res.Body.Close()
+			require.NoError(t, err)
+			if tt.statusCode != http.StatusOK {
+				return
+			}
+
+			assert.Equal(t, der, gotDER)
+			assert.Equal(t, tt.expectedBody, body)
+			for name, values := range tt.expectedHeaders {
+				assert.Equal(t, values, res.Header[name])
+			}
+			if !tt.resp.NextUpdate.IsZero() {
+				assert.Contains(t, res.Header.Get("Cache-Control"), "max-age=")
+			} else {
+				assert.Empty(t, res.Header.Get("Cache-Control"))
+			}
+		})
+	}
+}
@@ -3,8 +3,11 @@ package api
 import (
 	"net/http"
 
+	"github.com/pkg/errors"
+
 	"github.com/smallstep/certificates/api/read"
 	"github.com/smallstep/certificates/api/render"
+	casapi "github.com/smallstep/certificates/cas/apiv1"
 	"github.com/smallstep/certificates/errs"
 )
 
@@ -47,20 +50,14 @@ func Rekey(w http.ResponseWriter, r *http.Request) {
 	a := mustAuthority(r.Context())
 	certChain, err := a.Rekey(r.TLS.PeerCertificates[0], body.CsrPEM.CertificateRequest.PublicKey)
 	if err != nil {
+		var tooManyErr casapi.TooManyRequestsError
+		if errors.As(err, &tooManyErr) {
+			renderTooManyRequests(w, r, tooManyErr)
+			return
+		}
 		render.Error(w, r, errs.Wrap(http.StatusInternalServerError, err, "cahandler.Rekey"))
 		return
 	}
-	certChainPEM := certChainToPEM(certChain)
-	var caPEM Certificate
-	if len(certChainPEM) > 1 {
-		caPEM = certChainPEM[1]
-	}
 
-	LogCertificate(w, certChain[0])
-	render.JSONStatus(w, r, &SignResponse{
-		ServerPEM:    certChainPEM[0],
-		CaPEM:        caPEM,
-		CertChainPEM: certChainPEM,
-		TLSOptions:   a.GetTLSOptions(),
-	}, http.StatusCreated)
+	renderSignResponse(w, r, a, certChain, http.StatusCreated)
 }
@@ -5,8 +5,11 @@ import (
 	"net/http"
 	"strings"
 
+	"github.com/pkg/errors"
+
 	"github.com/smallstep/certificates/api/render"
 	"github.com/smallstep/certificates/authority"
+	casapi "github.com/smallstep/certificates/cas/apiv1"
 	"github.com/smallstep/certificates/errs"
 )
 
@@ -36,22 +39,16 @@ func Renew(w http.ResponseWriter, r *http.Request) {
 	a := mustAuthority(ctx)
 	certChain, err := a.RenewContext(ctx, cert, nil)
 	if err != nil {
+		var tooManyErr casapi.TooManyRequestsError
+		if errors.As(err, &tooManyErr) {
+			renderTooManyRequests(w, r, tooManyErr)
+			return
+		}
 		render.Error(w, r, errs.Wrap(http.StatusInternalServerError, err, "cahandler.Renew"))
 		return
 	}
-	certChainPEM := certChainToPEM(certChain)
-	var caPEM Certificate
-	if len(certChainPEM) > 1 {
-		caPEM = certChainPEM[1]
-	}
 
-	LogCertificate(w, certChain[0])
-	render.JSONStatus(w, r, &SignResponse{
-		ServerPEM:    certChainPEM[0],
-		CaPEM:        caPEM,
-		CertChainPEM: certChainPEM,
-		TLSOptions:   a.GetTLSOptions(),
-	}, http.StatusCreated)
+	renderSignResponse(w, r, a, certChain, http.StatusCreated)
 }
 
 func getPeerCertificate(r *http.Request) (*x509.Certificate, string, error) {
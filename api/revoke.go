@@ -19,7 +19,12 @@ type RevokeResponse struct {
 	Status string `json:"status"`
 }
 
-// RevokeRequest is the request body for a revocation request.
+// RevokeRequest is the request body for a revocation request. The reason code
+// is one of the CRL reason codes defined in RFC 5280. Certificates revoked
+// with the certificateHold (6) reason code can be revoked again with a
+// different reason code or released from hold using removeFromCRL (8). A
+// certificate can only be released with a token of the provisioner that put
+// it on hold.
 type RevokeRequest struct {
 	Serial     string `json:"serial"`
 	OTT        string `json:"ott"`
@@ -39,7 +44,8 @@ func (r *RevokeRequest) Validate() (err error) {
 		return errs.BadRequest("'%s' is not a valid serial number - use a base 10 representation or a base 16 representation with '0x' prefix", r.Serial)
 	}
 	r.Serial = sn.String()
-	if r.ReasonCode < ocsp.Unspecified || r.ReasonCode > ocsp.AACompromise {
+	// The reason code 7 is not used.
+	if r.ReasonCode < ocsp.Unspecified || r.ReasonCode > ocsp.AACompromise || r.ReasonCode == 7 {
 		return errs.BadRequest("reasonCode out of bounds")
 	}
 	if !r.Passive {
@@ -51,9 +57,8 @@ func (r *RevokeRequest) Validate() (err error) {
 
 // Revoke supports handful of different methods that revoke a Certificate.
 //
-// NOTE: currently only Passive revocation is supported.
-//
-// TODO: Add CRL and OCSP support.
+// NOTE: currently only Passive revocation is supported. Revoked certificates
+// are reported by the CRL and OCSP endpoints if they are enabled.
 func Revoke(w http.ResponseWriter, r *http.Request) {
 	var body RevokeRequest
 	if err := read.JSON(r.Body, &body); err != nil {
@@ -81,7 +86,7 @@ func Revoke(w http.ResponseWriter, r *http.Request) {
 	if body.OTT != "" {
 		logOtt(w, body.OTT)
 		if _, err := a.Authorize(ctx, body.OTT); err != nil {
-			render.Error(w, r, errs.UnauthorizedErr(err))
+			renderAuthorizeError(w, r, err)
 			return
 		}
 		opts.OTT = body.OTT
@@ -98,9 +103,8 @@ func Revoke(w http.ResponseWriter, r *http.Request) {
 			render.Error(w, r, errs.BadRequest("serial number in client certificate different than body"))
 			return
 		}
-		// TODO: should probably be checking if the certificate was revoked here.
-		// Will need to thread that request down to the authority, so will need
-		// to add API for that.
+		// The authority checks that the certificate is not revoked or on
+		// hold.
 		LogCertificate(w, opts.Crt)
 		opts.MTLS = true
 	}
@@ -43,6 +43,14 @@ func TestRevokeRequestValidate(t *testing.T) {
 			},
 			err: &errs.Error{Err: errors.New("reasonCode out of bounds"), Status: http.StatusBadRequest},
 		},
+		"error/unused reasonCode": {
+			rr: &RevokeRequest{
+				Serial:     "10",
+				ReasonCode: 7,
+				Passive:    true,
+			},
+			err: &errs.Error{Err: errors.New("reasonCode out of bounds"), Status: http.StatusBadRequest},
+		},
 		"error/non-passive not implemented": {
 			rr: &RevokeRequest{
 				Serial:     "10",
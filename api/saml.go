@@ -0,0 +1,96 @@
+package api
+
+import (
+	"html/template"
+	"net"
+	"net/http"
+	"net/url"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/smallstep/certificates/api/render"
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/errs"
+)
+
+// SAMLResponse is the response of the assertion consumer service if the relay
+// state is not a loopback address.
+type SAMLResponse struct {
+	SAMLResponse string `json:"samlResponse"`
+}
+
+// samlRelayTemplate posts the SAML response to the loopback address of the
+// client.
+var samlRelayTemplate = template.Must(template.New("saml").Parse(`<!DOCTYPE html>
+<html>
+<body onload="document.forms[0].submit()">
+<form method="POST" action="{{ .URL }}">
+<input type="hidden" name="SAMLResponse" value="{{ .SAMLResponse }}">
+<noscript><input type="submit" value="Continue"></noscript>
+</form>
+</body>
+</html>
+`))
+
+// SAMLACS is the assertion consumer service of the SAML provisioners. It
+// validates the response posted by the identity provider, and returns it to
+// the client. If the relay state is a loopback URL, like the ones used in the
+// OIDC flow, the response is posted to it, otherwise it is returned as JSON.
+func SAMLACS(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "provisionerName")
+	p, err := mustAuthority(r.Context()).LoadProvisionerByName(name)
+	if err != nil {
+		render.Error(w, r, errs.NotFoundErr(err))
+		return
+	}
+	prov, ok := p.(*provisioner.SAML)
+	if !ok {
+		render.Error(w, r, errs.NotFound("provisioner %s is not a saml provisioner", name))
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		render.Error(w, r, errs.BadRequestErr(err, "error parsing form"))
+		return
+	}
+	response := r.PostForm.Get("SAMLResponse")
+	if response == "" {
+		render.Error(w, r, errs.BadRequest("missing SAMLResponse"))
+		return
+	}
+	if err := prov.ValidateResponse(response); err != nil {
+		render.Error(w, r, errs.UnauthorizedErr(err))
+		return
+	}
+
+	if u, ok := samlLoopbackURL(r.PostForm.Get("RelayState")); ok {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		_ = samlRelayTemplate.Execute(w, map[string]string{
+			"URL":          u,
+			"SAMLResponse": response,
+		})
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	render.JSON(w, r, &SAMLResponse{SAMLResponse: response})
+}
+
+// samlLoopbackURL returns the relay state if it is an http URL on a loopback
+// address.
+func samlLoopbackURL(relayState string) (string, bool) {
+	if relayState == "" {
+		return "", false
+	}
+	u, err := url.Parse(relayState)
+	if err != nil || u.Scheme != "http" {
+		return "", false
+	}
+	if host := u.Hostname(); host != "localhost" {
+		if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() {
+			return "", false
+		}
+	}
+	return u.String(), true
+}
@@ -0,0 +1,74 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+func TestSAMLACS(t *testing.T) {
+	tests := []struct {
+		name       string
+		prov       provisioner.Interface
+		err        error
+		form       url.Values
+		statusCode int
+	}{
+		{"fail/not-found", nil, errors.New("not found"), url.Values{"SAMLResponse": {"foo"}}, http.StatusNotFound},
+		{"fail/not-saml", &provisioner.JWK{Name: "jwk"}, nil, url.Values{"SAMLResponse": {"foo"}}, http.StatusNotFound},
+		{"fail/missing-response", &provisioner.SAML{Name: "saml"}, nil, url.Values{"RelayState": {"http://127.0.0.1:10000"}}, http.StatusBadRequest},
+		{"fail/invalid-response", &provisioner.SAML{Name: "saml"}, nil, url.Values{"SAMLResponse": {"foo"}}, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockMustAuthority(t, &mockAuthority{
+				loadProvisionerByName: func(name string) (provisioner.Interface, error) {
+					return tt.prov, tt.err
+				},
+			})
+
+			chiCtx := chi.NewRouteContext()
+			chiCtx.URLParams.Add("provisionerName", "saml")
+			req := httptest.NewRequest("POST", "http://example.com/saml/saml/acs", strings.NewReader(tt.form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req = req.WithContext(context.WithValue(context.Background(), chi.RouteCtxKey, chiCtx))
+			w := httptest.NewRecorder()
+			SAMLACS(w, req)
+			assert.Equal(t, tt.statusCode, w.Result().StatusCode)
+		})
+	}
+}
+
+func Test_samlLoopbackURL(t *testing.T) {
+	tests := []struct {
+		relayState string
+		want       bool
+	}{
+		{"http://127.0.0.1:10000/callback", true},
+		{"http://[::1]:10000", true},
+		{"http://localhost:10000", true},
+		{"", false},
+		{"https://127.0.0.1:10000", false},
+		{"http://example.com", false},
+		{"http://10.0.0.1:10000", false},
+		{"javascript:alert(1)", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.relayState, func(t *testing.T) {
+			got, ok := samlLoopbackURL(tt.relayState)
+			assert.Equal(t, tt.want, ok)
+			if ok {
+				assert.Equal(t, tt.relayState, got)
+			}
+		})
+	}
+}
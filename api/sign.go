@@ -2,13 +2,20 @@ package api
 
 import (
 	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
 	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/pkg/errors"
 
 	"github.com/smallstep/certificates/api/read"
 	"github.com/smallstep/certificates/api/render"
 	"github.com/smallstep/certificates/authority/config"
 	"github.com/smallstep/certificates/authority/provisioner"
+	casapi "github.com/smallstep/certificates/cas/apiv1"
 	"github.com/smallstep/certificates/errs"
 )
 
@@ -46,6 +53,14 @@ type SignResponse struct {
 	TLS          *tls.ConnectionState `json:"-"`
 }
 
+// SignPendingResponse is the response object of a certificate signature
+// request that has not been completed yet. The certificate can be retrieved
+// later using the id.
+type SignPendingResponse struct {
+	ID     string `json:"id"`
+	Status string `json:"status"`
+}
+
 // Sign is an HTTP handler that reads a certificate request and an
 // one-time-token (ott) from the body and creates a new certificate with the
 // information in the certificate request.
@@ -72,17 +87,61 @@ func Sign(w http.ResponseWriter, r *http.Request) {
 	a := mustAuthority(ctx)
 
 	ctx = provisioner.NewContextWithMethod(ctx, provisioner.SignMethod)
+	ctx = provisioner.NewContextWithToken(ctx, body.OTT)
 	signOpts, err := a.Authorize(ctx, body.OTT)
 	if err != nil {
-		render.Error(w, r, errs.UnauthorizedErr(err))
+		renderAuthorizeError(w, r, err)
 		return
 	}
 
 	certChain, err := a.SignWithContext(ctx, body.CsrPEM.CertificateRequest, opts, signOpts...)
 	if err != nil {
+		var pendingErr casapi.PendingCertificateError
+		if errors.As(err, &pendingErr) {
+			renderSignPending(w, r, pendingErr)
+			return
+		}
+		var tooManyErr casapi.TooManyRequestsError
+		if errors.As(err, &tooManyErr) {
+			renderTooManyRequests(w, r, tooManyErr)
+			return
+		}
 		render.Error(w, r, errs.ForbiddenErr(err, "error signing certificate"))
 		return
 	}
+
+	renderSignResponse(w, r, a, certChain, http.StatusCreated)
+}
+
+// SignPending is an HTTP handler that returns the certificate of a signature
+// request that was pending. If the certificate has not been issued yet, it
+// will respond again with a 202 Accepted status.
+func SignPending(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	a := mustAuthority(ctx)
+
+	certChain, err := a.GetPendingCertificate(ctx, chi.URLParam(r, "id"))
+	if err != nil {
+		var pendingErr casapi.PendingCertificateError
+		if errors.As(err, &pendingErr) {
+			renderSignPending(w, r, pendingErr)
+			return
+		}
+		render.Error(w, r, err)
+		return
+	}
+
+	renderSignResponse(w, r, a, certChain, http.StatusOK)
+}
+
+// renderSignResponse writes the response with the issued certificate. The
+// preferredChain query parameter can be used to select an alternate chain by
+// the common name of the root, or the issuer of the last certificate.
+func renderSignResponse(w http.ResponseWriter, r *http.Request, a Authority, certChain []*x509.Certificate, status int) {
+	if name := r.URL.Query().Get("preferredChain"); name != "" {
+		certChain = preferredChain(name, certChain, a.GetAlternateX509Chains(certChain))
+	}
+
 	certChainPEM := certChainToPEM(certChain)
 	var caPEM Certificate
 	if len(certChainPEM) > 1 {
@@ -95,5 +154,57 @@ func Sign(w http.ResponseWriter, r *http.Request) {
 		CaPEM:        caPEM,
 		CertChainPEM: certChainPEM,
 		TLSOptions:   a.GetTLSOptions(),
-	}, http.StatusCreated)
+	}, status)
+}
+
+// preferredChain returns the first chain where the last certificate has the
+// given common name, or it is issued by a certificate with that common name. If
+// none of the chains match, it returns the default chain.
+func preferredChain(name string, chain []*x509.Certificate, alternates [][]*x509.Certificate) []*x509.Certificate {
+	for _, c := range append([][]*x509.Certificate{chain}, alternates...) {
+		last := c[len(c)-1]
+		if last.Subject.CommonName == name || last.Issuer.CommonName == name {
+			return c
+		}
+	}
+	return chain
+}
+
+// renderSignPending writes a 202 Accepted response with the id of the pending
+// certificate and a Retry-After header.
+func renderSignPending(w http.ResponseWriter, r *http.Request, pendingErr casapi.PendingCertificateError) {
+	w.Header().Set("Retry-After", retryAfter(pendingErr.RetryAfter))
+	render.JSONStatus(w, r, &SignPendingResponse{
+		ID:     pendingErr.ID,
+		Status: "pending",
+	}, http.StatusAccepted)
+}
+
+// renderTooManyRequests writes a 429 Too Many Requests error with a
+// Retry-After header.
+func renderTooManyRequests(w http.ResponseWriter, r *http.Request, tooManyErr casapi.TooManyRequestsError) {
+	w.Header().Set("Retry-After", retryAfter(tooManyErr.RetryAfter))
+	render.Error(w, r, errs.NewErr(http.StatusTooManyRequests, tooManyErr, errs.WithMessage(tooManyErr.Error())))
+}
+
+// renderAuthorizeError writes a 401 Unauthorized error with the error returned
+// by the authorization of a token, or a 429 Too Many Requests error with a
+// Retry-After header if the provisioner has exceeded its rate limit.
+func renderAuthorizeError(w http.ResponseWriter, r *http.Request, err error) {
+	var tooManyErr casapi.TooManyRequestsError
+	if errors.As(err, &tooManyErr) {
+		renderTooManyRequests(w, r, tooManyErr)
+		return
+	}
+	render.Error(w, r, errs.UnauthorizedErr(err))
+}
+
+// retryAfter returns the value of a Retry-After header in seconds, rounded up
+// and with a minimum of one second.
+func retryAfter(d time.Duration) string {
+	seconds := int((d + time.Second - 1) / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+	return strconv.Itoa(seconds)
 }
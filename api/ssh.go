@@ -19,6 +19,7 @@ import (
 	"github.com/smallstep/certificates/authority"
 	"github.com/smallstep/certificates/authority/config"
 	"github.com/smallstep/certificates/authority/provisioner"
+	casapi "github.com/smallstep/certificates/cas/apiv1"
 	"github.com/smallstep/certificates/errs"
 	"github.com/smallstep/certificates/templates"
 )
@@ -297,12 +298,17 @@ func SSHSign(w http.ResponseWriter, r *http.Request) {
 	a := mustAuthority(ctx)
 	signOpts, err := a.Authorize(ctx, body.OTT)
 	if err != nil {
-		render.Error(w, r, errs.UnauthorizedErr(err))
+		renderAuthorizeError(w, r, err)
 		return
 	}
 
 	cert, err := a.SignSSH(ctx, publicKey, opts, signOpts...)
 	if err != nil {
+		var tooManyErr casapi.TooManyRequestsError
+		if errors.As(err, &tooManyErr) {
+			renderTooManyRequests(w, r, tooManyErr)
+			return
+		}
 		render.Error(w, r, errs.ForbiddenErr(err, "error signing ssh certificate"))
 		return
 	}
@@ -324,7 +330,7 @@ func SSHSign(w http.ResponseWriter, r *http.Request) {
 		ctx = provisioner.NewContextWithMethod(ctx, provisioner.SignIdentityMethod)
 		signOpts, err := a.Authorize(ctx, body.OTT)
 		if err != nil {
-			render.Error(w, r, errs.UnauthorizedErr(err))
+			renderAuthorizeError(w, r, err)
 			return
 		}
 
@@ -337,6 +343,11 @@ func SSHSign(w http.ResponseWriter, r *http.Request) {
 
 		certChain, err := a.SignWithContext(ctx, cr, provisioner.SignOptions{}, signOpts...)
 		if err != nil {
+			var tooManyErr casapi.TooManyRequestsError
+			if errors.As(err, &tooManyErr) {
+				renderTooManyRequests(w, r, tooManyErr)
+				return
+			}
 			render.Error(w, r, errs.ForbiddenErr(err, "error signing identity certificate"))
 			return
 		}
@@ -64,7 +64,7 @@ func SSHRekey(w http.ResponseWriter, r *http.Request) {
 	a := mustAuthority(ctx)
 	signOpts, err := a.Authorize(ctx, body.OTT)
 	if err != nil {
-		render.Error(w, r, errs.UnauthorizedErr(err))
+		renderAuthorizeError(w, r, err)
 		return
 	}
 	oldCert, _, err := provisioner.ExtractSSHPOPCert(body.OTT)
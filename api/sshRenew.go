@@ -56,7 +56,7 @@ func SSHRenew(w http.ResponseWriter, r *http.Request) {
 	a := mustAuthority(ctx)
 	_, err := a.Authorize(ctx, body.OTT)
 	if err != nil {
-		render.Error(w, r, errs.UnauthorizedErr(err))
+		renderAuthorizeError(w, r, err)
 		return
 	}
 	oldCert, _, err := provisioner.ExtractSSHPOPCert(body.OTT)
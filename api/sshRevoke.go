@@ -75,7 +75,7 @@ func SSHRevoke(w http.ResponseWriter, r *http.Request) {
 	logOtt(w, body.OTT)
 
 	if _, err := a.Authorize(ctx, body.OTT); err != nil {
-		render.Error(w, r, errs.UnauthorizedErr(err))
+		renderAuthorizeError(w, r, err)
 		return
 	}
 	opts.OTT = body.OTT
@@ -4,12 +4,16 @@ import (
 	"fmt"
 	"net/http"
 
+	"github.com/go-chi/chi/v5"
 	"go.step.sm/linkedca"
 	"google.golang.org/protobuf/types/known/timestamppb"
 
 	"github.com/smallstep/certificates/acme"
+	"github.com/smallstep/certificates/api"
+	"github.com/smallstep/certificates/api/read"
 	"github.com/smallstep/certificates/api/render"
 	"github.com/smallstep/certificates/authority/admin"
+	"github.com/smallstep/certificates/authority/provisioner"
 )
 
 // CreateExternalAccountKeyRequest is the type for POST /admin/acme/eab requests
@@ -31,6 +35,67 @@ type GetExternalAccountKeysResponse struct {
 	NextCursor string             `json:"nextCursor"`
 }
 
+// ACMEAccount is the representation of an ACME account in the admin API.
+type ACMEAccount struct {
+	ID          string      `json:"id"`
+	Provisioner string      `json:"provisioner"`
+	Status      acme.Status `json:"status"`
+	Contact     []string    `json:"contact,omitempty"`
+	KeyID       string      `json:"keyID"`
+	// RateLimitTier is the rate limit tier of the provisioner assigned to
+	// the account. The default limits are used if empty.
+	RateLimitTier string `json:"rateLimitTier,omitempty"`
+}
+
+// GetACMEAccountsResponse is the type for GET /admin/acme/accounts responses
+type GetACMEAccountsResponse struct {
+	Accounts []*ACMEAccount `json:"accounts"`
+}
+
+// UpdateACMEAccountStatusRequest is the type for PUT
+// /admin/acme/accounts/{provisionerName}/{id}/status requests.
+type UpdateACMEAccountStatusRequest struct {
+	Status acme.Status `json:"status"`
+}
+
+// Validate validates an update ACME account status request body. Accounts can
+// only be deactivated, and a deactivated account cannot be reactivated.
+func (r *UpdateACMEAccountStatusRequest) Validate() error {
+	if r.Status != acme.StatusDeactivated {
+		return fmt.Errorf("cannot update account status to %q, only %q is supported", r.Status, acme.StatusDeactivated)
+	}
+	return nil
+}
+
+// UpdateACMEAccountRateLimitTierRequest is the type for PUT
+// /admin/acme/accounts/{provisionerName}/{id}/rate-limit-tier requests. An
+// empty tier assigns the default limits of the provisioner.
+type UpdateACMEAccountRateLimitTierRequest struct {
+	Tier string `json:"tier"`
+}
+
+// Validate validates an update ACME account rate limit tier request body.
+// The tier must be defined in the given ACME provisioner.
+func (r *UpdateACMEAccountRateLimitTierRequest) Validate(p *provisioner.ACME) error {
+	if r.Tier != "" && !p.RateLimits.HasTier(r.Tier) {
+		return fmt.Errorf("rate limit tier %q is not defined in provisioner %s", r.Tier, p.GetName())
+	}
+	return nil
+}
+
+// requireACMEProvisioner is a middleware that ensures the provisioner loaded
+// in the context is an ACME provisioner.
+func requireACMEProvisioner(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		prov := linkedca.MustProvisionerFromContext(r.Context())
+		if prov.GetDetails().GetACME() == nil {
+			render.Error(w, r, admin.NewError(admin.ErrorBadRequestType, "provisioner '%s' is not an ACME provisioner", prov.GetName()))
+			return
+		}
+		next(w, r)
+	}
+}
+
 // requireEABEnabled is a middleware that ensures ACME EAB is enabled
 // before serving requests that act on ACME EAB credentials.
 func requireEABEnabled(next http.HandlerFunc) http.HandlerFunc {
@@ -58,6 +123,9 @@ type ACMEAdminResponder interface {
 	GetExternalAccountKeys(w http.ResponseWriter, r *http.Request)
 	CreateExternalAccountKey(w http.ResponseWriter, r *http.Request)
 	DeleteExternalAccountKey(w http.ResponseWriter, r *http.Request)
+	GetAccounts(w http.ResponseWriter, r *http.Request)
+	UpdateAccountStatus(w http.ResponseWriter, r *http.Request)
+	UpdateAccountRateLimitTier(w http.ResponseWriter, r *http.Request)
 }
 
 // acmeAdminResponder implements ACMEAdminResponder.
@@ -68,19 +136,279 @@ func NewACMEAdminResponder() ACMEAdminResponder {
 	return &acmeAdminResponder{}
 }
 
-// GetExternalAccountKeys writes the response for the EAB keys GET endpoint
+// GetExternalAccountKeys writes the response for the EAB keys GET endpoint.
+// The HMAC keys are only returned when the keys are created.
 func (h *acmeAdminResponder) GetExternalAccountKeys(w http.ResponseWriter, r *http.Request) {
-	render.Error(w, r, admin.NewError(admin.ErrorNotImplementedType, "this functionality is currently only available in Certificate Manager: https://u.step.sm/cm"))
+	ctx := r.Context()
+	prov := linkedca.MustProvisionerFromContext(ctx)
+	acmeDB := acme.MustDatabaseFromContext(ctx)
+
+	var (
+		keys       []*acme.ExternalAccountKey
+		nextCursor string
+	)
+	if reference := chi.URLParam(r, "reference"); reference != "" {
+		eak, err := acmeDB.GetExternalAccountKeyByReference(ctx, prov.GetId(), reference)
+		switch {
+		case acme.IsErrNotFound(err) || (err == nil && eak == nil):
+			render.Error(w, r, admin.NewError(admin.ErrorNotFoundType, "ACME EAB key for reference %s not found", reference))
+			return
+		case err != nil:
+			render.Error(w, r, admin.WrapErrorISE(err, "error retrieving ACME EAB key for reference %s", reference))
+			return
+		}
+		keys = []*acme.ExternalAccountKey{eak}
+	} else {
+		cursor, limit, err := api.ParseCursor(r)
+		if err != nil {
+			render.Error(w, r, admin.WrapError(admin.ErrorBadRequestType, err,
+				"error parsing cursor and limit from query params"))
+			return
+		}
+		if keys, nextCursor, err = acmeDB.GetExternalAccountKeys(ctx, prov.GetId(), cursor, limit); err != nil {
+			render.Error(w, r, admin.WrapErrorISE(err, "error retrieving ACME EAB keys"))
+			return
+		}
+	}
+
+	eaks := make([]*linkedca.EABKey, len(keys))
+	for i, k := range keys {
+		eaks[i] = eakToLinked(k)
+		eaks[i].HmacKey = nil
+	}
+
+	render.JSON(w, r, &GetExternalAccountKeysResponse{
+		EAKs:       eaks,
+		NextCursor: nextCursor,
+	})
 }
 
 // CreateExternalAccountKey writes the response for the EAB key POST endpoint
 func (h *acmeAdminResponder) CreateExternalAccountKey(w http.ResponseWriter, r *http.Request) {
-	render.Error(w, r, admin.NewError(admin.ErrorNotImplementedType, "this functionality is currently only available in Certificate Manager: https://u.step.sm/cm"))
+	ctx := r.Context()
+	prov := linkedca.MustProvisionerFromContext(ctx)
+	acmeDB := acme.MustDatabaseFromContext(ctx)
+
+	var body CreateExternalAccountKeyRequest
+	if err := read.JSON(r.Body, &body); err != nil {
+		render.Error(w, r, admin.WrapError(admin.ErrorBadRequestType, err, "error reading request body"))
+		return
+	}
+
+	if err := body.Validate(); err != nil {
+		render.Error(w, r, admin.WrapError(admin.ErrorBadRequestType, err, "error validating request body"))
+		return
+	}
+
+	// references must be unique per provisioner
+	if body.Reference != "" {
+		eak, err := acmeDB.GetExternalAccountKeyByReference(ctx, prov.GetId(), body.Reference)
+		switch {
+		case err == nil && eak != nil:
+			render.Error(w, r, admin.NewError(admin.ErrorConflictType, "an ACME EAB key for provisioner '%s' with reference '%s' already exists", prov.GetName(), body.Reference))
+			return
+		case err != nil && !acme.IsErrNotFound(err):
+			render.Error(w, r, admin.WrapErrorISE(err, "error retrieving ACME EAB key for reference %s", body.Reference))
+			return
+		}
+	}
+
+	eak, err := acmeDB.CreateExternalAccountKey(ctx, prov.GetId(), body.Reference)
+	if err != nil {
+		render.Error(w, r, admin.WrapErrorISE(err, "error creating ACME EAB key"))
+		return
+	}
+
+	render.ProtoJSONStatus(w, eakToLinked(eak), http.StatusCreated)
 }
 
-// DeleteExternalAccountKey writes the response for the EAB key DELETE endpoint
+// DeleteExternalAccountKey writes the response for the EAB key DELETE
+// endpoint. Deleting a key revokes it, and the account bound to it is
+// deactivated.
 func (h *acmeAdminResponder) DeleteExternalAccountKey(w http.ResponseWriter, r *http.Request) {
-	render.Error(w, r, admin.NewError(admin.ErrorNotImplementedType, "this functionality is currently only available in Certificate Manager: https://u.step.sm/cm"))
+	ctx := r.Context()
+	prov := linkedca.MustProvisionerFromContext(ctx)
+	acmeDB := acme.MustDatabaseFromContext(ctx)
+	keyID := chi.URLParam(r, "id")
+
+	eak, err := acmeDB.GetExternalAccountKey(ctx, prov.GetId(), keyID)
+	if err != nil {
+		if acme.IsErrNotFound(err) {
+			render.Error(w, r, admin.NewError(admin.ErrorNotFoundType, "ACME EAB key %s not found", keyID))
+			return
+		}
+		render.Error(w, r, admin.WrapErrorISE(err, "error retrieving ACME EAB key %s", keyID))
+		return
+	}
+
+	if eak.AlreadyBound() {
+		acc, err := acmeDB.GetAccount(ctx, eak.AccountID)
+		if err != nil && !acme.IsErrNotFound(err) {
+			render.Error(w, r, admin.WrapErrorISE(err, "error retrieving ACME account %s", eak.AccountID))
+			return
+		}
+		if acc != nil && acc.Status != acme.StatusDeactivated {
+			acc.Status = acme.StatusDeactivated
+			if err := acmeDB.UpdateAccount(ctx, acc); err != nil {
+				render.Error(w, r, admin.WrapErrorISE(err, "error deactivating ACME account %s", eak.AccountID))
+				return
+			}
+		}
+	}
+
+	if err := acmeDB.DeleteExternalAccountKey(ctx, prov.GetId(), keyID); err != nil {
+		render.Error(w, r, admin.WrapErrorISE(err, "error deleting ACME EAB key %s", keyID))
+		return
+	}
+
+	render.JSONStatus(w, r, DeleteResponse{Status: "ok"}, http.StatusOK)
+}
+
+// GetAccounts writes the response for the ACME accounts GET endpoint. If the
+// id parameter is present only that account is returned.
+func (h *acmeAdminResponder) GetAccounts(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	prov := linkedca.MustProvisionerFromContext(ctx)
+	acmeDB := acme.MustDatabaseFromContext(ctx)
+
+	var accs []*acme.Account
+	if id := chi.URLParam(r, "id"); id != "" {
+		acc, err := getACMEAccount(r, prov, id)
+		if err != nil {
+			render.Error(w, r, err)
+			return
+		}
+		accs = []*acme.Account{acc}
+	} else {
+		var err error
+		if accs, err = acmeDB.GetAccountsByProvisionerID(ctx, prov.GetId()); err != nil {
+			render.Error(w, r, admin.WrapErrorISE(err, "error retrieving ACME accounts"))
+			return
+		}
+	}
+
+	res := &GetACMEAccountsResponse{
+		Accounts: make([]*ACMEAccount, len(accs)),
+	}
+	for i, acc := range accs {
+		res.Accounts[i] = accountToAdmin(acc, prov)
+	}
+
+	render.JSON(w, r, res)
+}
+
+// UpdateAccountStatus writes the response for the ACME account status PUT
+// endpoint. Deactivated accounts cannot be used to create new orders or
+// to authorize any other request.
+func (h *acmeAdminResponder) UpdateAccountStatus(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	prov := linkedca.MustProvisionerFromContext(ctx)
+	acmeDB := acme.MustDatabaseFromContext(ctx)
+	id := chi.URLParam(r, "id")
+
+	var body UpdateACMEAccountStatusRequest
+	if err := read.JSON(r.Body, &body); err != nil {
+		render.Error(w, r, admin.WrapError(admin.ErrorBadRequestType, err, "error reading request body"))
+		return
+	}
+	if err := body.Validate(); err != nil {
+		render.Error(w, r, admin.WrapError(admin.ErrorBadRequestType, err, "error validating request body"))
+		return
+	}
+
+	acc, err := getACMEAccount(r, prov, id)
+	if err != nil {
+		render.Error(w, r, err)
+		return
+	}
+	if acc.Status != body.Status {
+		acc.Status = body.Status
+		if err := acmeDB.UpdateAccount(ctx, acc); err != nil {
+			render.Error(w, r, admin.WrapErrorISE(err, "error updating ACME account %s", id))
+			return
+		}
+	}
+
+	render.JSON(w, r, accountToAdmin(acc, prov))
+}
+
+// UpdateAccountRateLimitTier writes the response for the ACME account rate
+// limit tier PUT endpoint. The tier overrides the default rate limits of the
+// provisioner for the account.
+func (h *acmeAdminResponder) UpdateAccountRateLimitTier(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	prov := linkedca.MustProvisionerFromContext(ctx)
+	acmeDB := acme.MustDatabaseFromContext(ctx)
+	id := chi.URLParam(r, "id")
+
+	var body UpdateACMEAccountRateLimitTierRequest
+	if err := read.JSON(r.Body, &body); err != nil {
+		render.Error(w, r, admin.WrapError(admin.ErrorBadRequestType, err, "error reading request body"))
+		return
+	}
+
+	p, err := mustAuthority(ctx).LoadProvisionerByName(prov.GetName())
+	if err != nil {
+		render.Error(w, r, admin.WrapErrorISE(err, "error loading provisioner %s", prov.GetName()))
+		return
+	}
+	acmeProv, ok := p.(*provisioner.ACME)
+	if !ok {
+		render.Error(w, r, admin.NewError(admin.ErrorBadRequestType, "provisioner '%s' is not an ACME provisioner", prov.GetName()))
+		return
+	}
+	if err := body.Validate(acmeProv); err != nil {
+		render.Error(w, r, admin.WrapError(admin.ErrorBadRequestType, err, "error validating request body"))
+		return
+	}
+
+	acc, err := getACMEAccount(r, prov, id)
+	if err != nil {
+		render.Error(w, r, err)
+		return
+	}
+	if acc.RateLimitTier != body.Tier {
+		acc.RateLimitTier = body.Tier
+		if err := acmeDB.UpdateAccount(ctx, acc); err != nil {
+			render.Error(w, r, admin.WrapErrorISE(err, "error updating ACME account %s", id))
+			return
+		}
+	}
+
+	render.JSON(w, r, accountToAdmin(acc, prov))
+}
+
+// getACMEAccount returns the ACME account with the given id, if it belongs
+// to the provisioner.
+func getACMEAccount(r *http.Request, prov *linkedca.Provisioner, id string) (*acme.Account, error) {
+	acc, err := acme.MustDatabaseFromContext(r.Context()).GetAccount(r.Context(), id)
+	switch {
+	case acme.IsErrNotFound(err):
+		return nil, admin.NewError(admin.ErrorNotFoundType, "ACME account %s not found", id)
+	case err != nil:
+		return nil, admin.WrapErrorISE(err, "error retrieving ACME account %s", id)
+	}
+
+	// Accounts created by old versions only store the provisioner name.
+	if acc.ProvisionerID != prov.GetId() && (acc.ProvisionerID != "" || acc.ProvisionerName != prov.GetName()) {
+		return nil, admin.NewError(admin.ErrorNotFoundType, "ACME account %s not found", id)
+	}
+	return acc, nil
+}
+
+func accountToAdmin(acc *acme.Account, prov *linkedca.Provisioner) *ACMEAccount {
+	var keyID string
+	if acc.Key != nil {
+		keyID, _ = acme.KeyToID(acc.Key)
+	}
+	return &ACMEAccount{
+		ID:            acc.ID,
+		Provisioner:   prov.GetName(),
+		Status:        acc.Status,
+		Contact:       acc.Contact,
+		KeyID:         keyID,
+		RateLimitTier: acc.RateLimitTier,
+	}
 }
 
 func eakToLinked(k *acme.ExternalAccountKey) *linkedca.EABKey {
@@ -98,23 +426,34 @@ func eakToLinked(k *acme.ExternalAccountKey) *linkedca.EABKey {
 		BoundAt:     timestamppb.New(k.BoundAt),
 	}
 
-	if k.Policy != nil {
-		eak.Policy = &linkedca.Policy{
-			X509: &linkedca.X509Policy{
-				Allow: &linkedca.X509Names{},
-				Deny:  &linkedca.X509Names{},
-			},
-		}
-		eak.Policy.X509.Allow.Dns = k.Policy.X509.Allowed.DNSNames
-		eak.Policy.X509.Allow.Ips = k.Policy.X509.Allowed.IPRanges
-		eak.Policy.X509.Deny.Dns = k.Policy.X509.Denied.DNSNames
-		eak.Policy.X509.Deny.Ips = k.Policy.X509.Denied.IPRanges
-		eak.Policy.X509.AllowWildcardNames = k.Policy.X509.AllowWildcardNames
-	}
+	eak.Policy = acmePolicyToLinked(k.Policy)
 
 	return eak
 }
 
+// acmePolicyToLinked converts an ACME account level policy to a linkedca
+// policy.
+func acmePolicyToLinked(p *acme.Policy) *linkedca.Policy {
+	if p == nil {
+		return nil
+	}
+
+	lp := &linkedca.Policy{
+		X509: &linkedca.X509Policy{
+			Allow: &linkedca.X509Names{},
+			Deny:  &linkedca.X509Names{},
+		},
+	}
+	lp.X509.Allow.Dns = p.X509.Allowed.DNSNames
+	lp.X509.Allow.Ips = p.X509.Allowed.IPRanges
+	lp.X509.Allow.Uris = p.X509.Allowed.URIDomains
+	lp.X509.Deny.Dns = p.X509.Denied.DNSNames
+	lp.X509.Deny.Ips = p.X509.Denied.IPRanges
+	lp.X509.Deny.Uris = p.X509.Denied.URIDomains
+	lp.X509.AllowWildcardNames = p.X509.AllowWildcardNames
+	return lp
+}
+
 func linkedEAKToCertificates(k *linkedca.EABKey) *acme.ExternalAccountKey {
 	if k == nil {
 		return nil
@@ -130,23 +469,34 @@ func linkedEAKToCertificates(k *linkedca.EABKey) *acme.ExternalAccountKey {
 		BoundAt:       k.BoundAt.AsTime(),
 	}
 
-	if policy := k.GetPolicy(); policy != nil {
-		eak.Policy = &acme.Policy{}
-		if x509 := policy.GetX509(); x509 != nil {
-			eak.Policy.X509 = acme.X509Policy{}
-			if allow := x509.GetAllow(); allow != nil {
-				eak.Policy.X509.Allowed = acme.PolicyNames{}
-				eak.Policy.X509.Allowed.DNSNames = allow.Dns
-				eak.Policy.X509.Allowed.IPRanges = allow.Ips
-			}
-			if deny := x509.GetDeny(); deny != nil {
-				eak.Policy.X509.Denied = acme.PolicyNames{}
-				eak.Policy.X509.Denied.DNSNames = deny.Dns
-				eak.Policy.X509.Denied.IPRanges = deny.Ips
-			}
-			eak.Policy.X509.AllowWildcardNames = x509.AllowWildcardNames
-		}
-	}
+	eak.Policy = linkedPolicyToACME(k.GetPolicy())
 
 	return eak
 }
+
+// linkedPolicyToACME converts a linkedca policy to an ACME account level
+// policy. Only the X.509 DNS, IP and URI names are used.
+func linkedPolicyToACME(p *linkedca.Policy) *acme.Policy {
+	if p == nil {
+		return nil
+	}
+
+	ap := &acme.Policy{}
+	if x509 := p.GetX509(); x509 != nil {
+		ap.X509 = acme.X509Policy{}
+		if allow := x509.GetAllow(); allow != nil {
+			ap.X509.Allowed = acme.PolicyNames{}
+			ap.X509.Allowed.DNSNames = allow.Dns
+			ap.X509.Allowed.IPRanges = allow.Ips
+			ap.X509.Allowed.URIDomains = allow.Uris
+		}
+		if deny := x509.GetDeny(); deny != nil {
+			ap.X509.Denied = acme.PolicyNames{}
+			ap.X509.Denied.DNSNames = deny.Dns
+			ap.X509.Denied.IPRanges = deny.Ips
+			ap.X509.Denied.URIDomains = deny.Uris
+		}
+		ap.X509.AllowWildcardNames = x509.AllowWildcardNames
+	}
+	return ap
+}
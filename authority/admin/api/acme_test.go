@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"io"
 	"net/http"
 	"net/http/httptest"
@@ -22,6 +23,7 @@ import (
 	"github.com/smallstep/assert"
 	"github.com/smallstep/certificates/acme"
 	"github.com/smallstep/certificates/authority/admin"
+	"github.com/smallstep/certificates/authority/provisioner"
 )
 
 func readProtoJSON(r io.ReadCloser, m proto.Message) error {
@@ -198,23 +200,135 @@ func TestCreateExternalAccountKeyRequest_Validate(t *testing.T) {
 }
 
 func TestHandler_CreateExternalAccountKey(t *testing.T) {
+	prov := &linkedca.Provisioner{
+		Id:   "provID",
+		Name: "provName",
+	}
+	now := time.Now().UTC().Truncate(time.Second)
 	type test struct {
-		ctx        context.Context
+		db         acme.DB
+		body       []byte
 		statusCode int
 		err        *admin.Error
+		want       *linkedca.EABKey
 	}
 	var tests = map[string]func(t *testing.T) test{
-		"ok": func(t *testing.T) test {
-			chiCtx := chi.NewRouteContext()
-			ctx := context.WithValue(context.Background(), chi.RouteCtxKey, chiCtx)
+		"fail/read.JSON": func(t *testing.T) test {
 			return test{
-				ctx:        ctx,
-				statusCode: 501,
+				db:         &acme.MockDB{},
+				body:       []byte("{!?}"),
+				statusCode: 400,
+				err: &admin.Error{
+					Type:    admin.ErrorBadRequestType.String(),
+					Status:  http.StatusBadRequest,
+					Message: "error reading request body: error decoding json: invalid character '!' looking for beginning of object key string",
+					Detail:  "bad request",
+				},
+			}
+		},
+		"fail/validate": func(t *testing.T) test {
+			b, err := json.Marshal(&CreateExternalAccountKeyRequest{Reference: strings.Repeat("A", 257)})
+			assert.FatalError(t, err)
+			return test{
+				db:         &acme.MockDB{},
+				body:       b,
+				statusCode: 400,
+				err: &admin.Error{
+					Type:    admin.ErrorBadRequestType.String(),
+					Status:  http.StatusBadRequest,
+					Message: "error validating request body: reference length 257 exceeds the maximum (256)",
+					Detail:  "bad request",
+				},
+			}
+		},
+		"fail/reference-exists": func(t *testing.T) test {
+			b, err := json.Marshal(&CreateExternalAccountKeyRequest{Reference: "tenant-1"})
+			assert.FatalError(t, err)
+			return test{
+				db: &acme.MockDB{
+					MockGetExternalAccountKeyByReference: func(ctx context.Context, provisionerID, reference string) (*acme.ExternalAccountKey, error) {
+						assert.Equals(t, "provID", provisionerID)
+						assert.Equals(t, "tenant-1", reference)
+						return &acme.ExternalAccountKey{ID: "eakID"}, nil
+					},
+				},
+				body:       b,
+				statusCode: 409,
+				err: &admin.Error{
+					Type:    admin.ErrorConflictType.String(),
+					Status:  http.StatusConflict,
+					Message: "an ACME EAB key for provisioner 'provName' with reference 'tenant-1' already exists",
+					Detail:  "conflict",
+				},
+			}
+		},
+		"fail/GetExternalAccountKeyByReference": func(t *testing.T) test {
+			b, err := json.Marshal(&CreateExternalAccountKeyRequest{Reference: "tenant-1"})
+			assert.FatalError(t, err)
+			return test{
+				db: &acme.MockDB{
+					MockGetExternalAccountKeyByReference: func(ctx context.Context, provisionerID, reference string) (*acme.ExternalAccountKey, error) {
+						return nil, errors.New("force")
+					},
+				},
+				body:       b,
+				statusCode: 500,
+				err: &admin.Error{
+					Type:    admin.ErrorServerInternalType.String(),
+					Status:  http.StatusInternalServerError,
+					Message: "error retrieving ACME EAB key for reference tenant-1: force",
+					Detail:  "the server experienced an internal error",
+				},
+			}
+		},
+		"fail/CreateExternalAccountKey": func(t *testing.T) test {
+			b, err := json.Marshal(&CreateExternalAccountKeyRequest{})
+			assert.FatalError(t, err)
+			return test{
+				db: &acme.MockDB{
+					MockCreateExternalAccountKey: func(ctx context.Context, provisionerID, reference string) (*acme.ExternalAccountKey, error) {
+						return nil, errors.New("force")
+					},
+				},
+				body:       b,
+				statusCode: 500,
 				err: &admin.Error{
-					Type:    admin.ErrorNotImplementedType.String(),
-					Status:  http.StatusNotImplemented,
-					Message: "this functionality is currently only available in Certificate Manager: https://u.step.sm/cm",
-					Detail:  "not implemented",
+					Type:    admin.ErrorServerInternalType.String(),
+					Status:  http.StatusInternalServerError,
+					Message: "error creating ACME EAB key: force",
+					Detail:  "the server experienced an internal error",
+				},
+			}
+		},
+		"ok": func(t *testing.T) test {
+			b, err := json.Marshal(&CreateExternalAccountKeyRequest{Reference: "tenant-1"})
+			assert.FatalError(t, err)
+			return test{
+				db: &acme.MockDB{
+					MockGetExternalAccountKeyByReference: func(ctx context.Context, provisionerID, reference string) (*acme.ExternalAccountKey, error) {
+						return nil, acme.ErrNotFound
+					},
+					MockCreateExternalAccountKey: func(ctx context.Context, provisionerID, reference string) (*acme.ExternalAccountKey, error) {
+						assert.Equals(t, "provID", provisionerID)
+						assert.Equals(t, "tenant-1", reference)
+						return &acme.ExternalAccountKey{
+							ID:            "eakID",
+							ProvisionerID: "provID",
+							Reference:     "tenant-1",
+							HmacKey:       []byte{1, 3, 3, 7},
+							CreatedAt:     now,
+						}, nil
+					},
+				},
+				body:       b,
+				statusCode: 201,
+				want: &linkedca.EABKey{
+					Id:          "eakID",
+					HmacKey:     []byte{1, 3, 3, 7},
+					Provisioner: "provID",
+					Reference:   "tenant-1",
+					CreatedAt:   timestamppb.New(now),
+					BoundAt:     timestamppb.New(time.Time{}),
 				},
 			}
 		},
@@ -222,62 +336,178 @@ func TestHandler_CreateExternalAccountKey(t *testing.T) {
 	for name, prep := range tests {
 		tc := prep(t)
 		t.Run(name, func(t *testing.T) {
-
-			req := httptest.NewRequest("POST", "/foo", http.NoBody) // chi routing is prepared in test setup
-			req = req.WithContext(tc.ctx)
+			ctx := linkedca.NewContextWithProvisioner(context.Background(), prov)
+			ctx = acme.NewDatabaseContext(ctx, tc.db)
+			req := httptest.NewRequest("POST", "/foo", io.NopCloser(bytes.NewBuffer(tc.body)))
+			req = req.WithContext(ctx)
 			w := httptest.NewRecorder()
 			acmeResponder := NewACMEAdminResponder()
 			acmeResponder.CreateExternalAccountKey(w, req)
 			res := w.Result()
 			assert.Equals(t, tc.statusCode, res.StatusCode)
 
-			body, err := io.ReadAll(res.Body)
-			res.Body.Close()
-			assert.FatalError(t, err)
+			if tc.err != nil {
+				body, err := io.ReadAll(res.Body)
+				res.Body.Close()
+				assert.FatalError(t, err)
 
-			adminErr := admin.Error{}
-			assert.FatalError(t, json.Unmarshal(bytes.TrimSpace(body), &adminErr))
+				adminErr := admin.Error{}
+				assert.FatalError(t, json.Unmarshal(bytes.TrimSpace(body), &adminErr))
 
-			assert.Equals(t, tc.err.Type, adminErr.Type)
-			assert.Equals(t, tc.err.Message, adminErr.Message)
-			assert.Equals(t, tc.err.StatusCode(), res.StatusCode)
-			assert.Equals(t, tc.err.Detail, adminErr.Detail)
-			assert.Equals(t, []string{"application/json"}, res.Header["Content-Type"])
+				assert.Equals(t, tc.err.Type, adminErr.Type)
+				assert.Equals(t, tc.err.Message, adminErr.Message)
+				assert.Equals(t, tc.err.StatusCode(), res.StatusCode)
+				assert.Equals(t, tc.err.Detail, adminErr.Detail)
+				assert.Equals(t, []string{"application/json"}, res.Header["Content-Type"])
+				return
+			}
 
+			eabKey := &linkedca.EABKey{}
+			assert.FatalError(t, readProtoJSON(res.Body, eabKey))
+			assert.True(t, proto.Equal(tc.want, eabKey))
 		})
 	}
 }
 
 func TestHandler_DeleteExternalAccountKey(t *testing.T) {
+	prov := &linkedca.Provisioner{
+		Id:   "provID",
+		Name: "provName",
+	}
 	type test struct {
-		ctx        context.Context
+		db         acme.DB
 		statusCode int
 		err        *admin.Error
 	}
 	var tests = map[string]func(t *testing.T) test{
-		"ok": func(t *testing.T) test {
-			chiCtx := chi.NewRouteContext()
-			chiCtx.URLParams.Add("provisionerName", "provName")
-			chiCtx.URLParams.Add("id", "keyID")
-			ctx := context.WithValue(context.Background(), chi.RouteCtxKey, chiCtx)
+		"fail/not-found": func(t *testing.T) test {
 			return test{
-				ctx:        ctx,
-				statusCode: 501,
+				db: &acme.MockDB{
+					MockGetExternalAccountKey: func(ctx context.Context, provisionerID, keyID string) (*acme.ExternalAccountKey, error) {
+						return nil, acme.ErrNotFound
+					},
+				},
+				statusCode: 404,
+				err: &admin.Error{
+					Type:    admin.ErrorNotFoundType.String(),
+					Status:  http.StatusNotFound,
+					Message: "ACME EAB key keyID not found",
+					Detail:  "resource not found",
+				},
+			}
+		},
+		"fail/GetExternalAccountKey": func(t *testing.T) test {
+			return test{
+				db: &acme.MockDB{
+					MockGetExternalAccountKey: func(ctx context.Context, provisionerID, keyID string) (*acme.ExternalAccountKey, error) {
+						return nil, errors.New("force")
+					},
+				},
+				statusCode: 500,
 				err: &admin.Error{
-					Type:    admin.ErrorNotImplementedType.String(),
-					Status:  http.StatusNotImplemented,
-					Message: "this functionality is currently only available in Certificate Manager: https://u.step.sm/cm",
-					Detail:  "not implemented",
+					Type:    admin.ErrorServerInternalType.String(),
+					Status:  http.StatusInternalServerError,
+					Message: "error retrieving ACME EAB key keyID: force",
+					Detail:  "the server experienced an internal error",
 				},
 			}
 		},
+		"fail/UpdateAccount": func(t *testing.T) test {
+			return test{
+				db: &acme.MockDB{
+					MockGetExternalAccountKey: func(ctx context.Context, provisionerID, keyID string) (*acme.ExternalAccountKey, error) {
+						return &acme.ExternalAccountKey{ID: "keyID", AccountID: "accID", BoundAt: time.Now()}, nil
+					},
+					MockGetAccount: func(ctx context.Context, id string) (*acme.Account, error) {
+						return &acme.Account{ID: "accID", Status: acme.StatusValid}, nil
+					},
+					MockUpdateAccount: func(ctx context.Context, acc *acme.Account) error {
+						return errors.New("force")
+					},
+				},
+				statusCode: 500,
+				err: &admin.Error{
+					Type:    admin.ErrorServerInternalType.String(),
+					Status:  http.StatusInternalServerError,
+					Message: "error deactivating ACME account accID: force",
+					Detail:  "the server experienced an internal error",
+				},
+			}
+		},
+		"fail/DeleteExternalAccountKey": func(t *testing.T) test {
+			return test{
+				db: &acme.MockDB{
+					MockGetExternalAccountKey: func(ctx context.Context, provisionerID, keyID string) (*acme.ExternalAccountKey, error) {
+						return &acme.ExternalAccountKey{ID: "keyID"}, nil
+					},
+					MockDeleteExternalAccountKey: func(ctx context.Context, provisionerID, keyID string) error {
+						return errors.New("force")
+					},
+				},
+				statusCode: 500,
+				err: &admin.Error{
+					Type:    admin.ErrorServerInternalType.String(),
+					Status:  http.StatusInternalServerError,
+					Message: "error deleting ACME EAB key keyID: force",
+					Detail:  "the server experienced an internal error",
+				},
+			}
+		},
+		"ok": func(t *testing.T) test {
+			return test{
+				db: &acme.MockDB{
+					MockGetExternalAccountKey: func(ctx context.Context, provisionerID, keyID string) (*acme.ExternalAccountKey, error) {
+						assert.Equals(t, "provID", provisionerID)
+						assert.Equals(t, "keyID", keyID)
+						return &acme.ExternalAccountKey{ID: "keyID"}, nil
+					},
+					MockDeleteExternalAccountKey: func(ctx context.Context, provisionerID, keyID string) error {
+						assert.Equals(t, "provID", provisionerID)
+						assert.Equals(t, "keyID", keyID)
+						return nil
+					},
+				},
+				statusCode: 200,
+			}
+		},
+		"ok/deactivate-account": func(t *testing.T) test {
+			var deactivated bool
+			t.Cleanup(func() {
+				assert.True(t, deactivated)
+			})
+			return test{
+				db: &acme.MockDB{
+					MockGetExternalAccountKey: func(ctx context.Context, provisionerID, keyID string) (*acme.ExternalAccountKey, error) {
+						return &acme.ExternalAccountKey{ID: "keyID", AccountID: "accID", BoundAt: time.Now()}, nil
+					},
+					MockGetAccount: func(ctx context.Context, id string) (*acme.Account, error) {
+						assert.Equals(t, "accID", id)
+						return &acme.Account{ID: "accID", Status: acme.StatusValid}, nil
+					},
+					MockUpdateAccount: func(ctx context.Context, acc *acme.Account) error {
+						assert.Equals(t, acme.StatusDeactivated, acc.Status)
+						deactivated = true
+						return nil
+					},
+					MockDeleteExternalAccountKey: func(ctx context.Context, provisionerID, keyID string) error {
+						return nil
+					},
+				},
+				statusCode: 200,
+			}
+		},
 	}
 	for name, prep := range tests {
 		tc := prep(t)
 		t.Run(name, func(t *testing.T) {
-
-			req := httptest.NewRequest("DELETE", "/foo", http.NoBody) // chi routing is prepared in test setup
-			req = req.WithContext(tc.ctx)
+			chiCtx := chi.NewRouteContext()
+			chiCtx.URLParams.Add("provisionerName", "provName")
+			chiCtx.URLParams.Add("id", "keyID")
+			ctx := context.WithValue(context.Background(), chi.RouteCtxKey, chiCtx)
+			ctx = linkedca.NewContextWithProvisioner(ctx, prov)
+			ctx = acme.NewDatabaseContext(ctx, tc.db)
+			req := httptest.NewRequest("DELETE", "/foo", http.NoBody)
+			req = req.WithContext(ctx)
 			w := httptest.NewRecorder()
 			acmeResponder := NewACMEAdminResponder()
 			acmeResponder.DeleteExternalAccountKey(w, req)
@@ -288,49 +518,154 @@ func TestHandler_DeleteExternalAccountKey(t *testing.T) {
 			res.Body.Close()
 			assert.FatalError(t, err)
 
-			adminErr := admin.Error{}
-			assert.FatalError(t, json.Unmarshal(bytes.TrimSpace(body), &adminErr))
+			if tc.err != nil {
+				adminErr := admin.Error{}
+				assert.FatalError(t, json.Unmarshal(bytes.TrimSpace(body), &adminErr))
+
+				assert.Equals(t, tc.err.Type, adminErr.Type)
+				assert.Equals(t, tc.err.Message, adminErr.Message)
+				assert.Equals(t, tc.err.StatusCode(), res.StatusCode)
+				assert.Equals(t, tc.err.Detail, adminErr.Detail)
+				assert.Equals(t, []string{"application/json"}, res.Header["Content-Type"])
+				return
+			}
 
-			assert.Equals(t, tc.err.Type, adminErr.Type)
-			assert.Equals(t, tc.err.Message, adminErr.Message)
-			assert.Equals(t, tc.err.StatusCode(), res.StatusCode)
-			assert.Equals(t, tc.err.Detail, adminErr.Detail)
-			assert.Equals(t, []string{"application/json"}, res.Header["Content-Type"])
+			response := DeleteResponse{}
+			assert.FatalError(t, json.Unmarshal(bytes.TrimSpace(body), &response))
+			assert.Equals(t, "ok", response.Status)
 		})
 	}
 }
 
 func TestHandler_GetExternalAccountKeys(t *testing.T) {
+	prov := &linkedca.Provisioner{
+		Id:   "provID",
+		Name: "provName",
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+	eak := &acme.ExternalAccountKey{
+		ID:            "eakID",
+		ProvisionerID: "provID",
+		Reference:     "tenant-1",
+		HmacKey:       []byte{1, 3, 3, 7},
+		CreatedAt:     now,
+	}
 	type test struct {
-		ctx        context.Context
+		db         acme.DB
+		reference  string
+		target     string
 		statusCode int
-		req        *http.Request
 		err        *admin.Error
+		want       []string
 	}
 	var tests = map[string]func(t *testing.T) test{
-		"ok": func(t *testing.T) test {
-			chiCtx := chi.NewRouteContext()
-			chiCtx.URLParams.Add("provisionerName", "provName")
-			req := httptest.NewRequest("GET", "/foo", http.NoBody)
-			ctx := context.WithValue(context.Background(), chi.RouteCtxKey, chiCtx)
+		"fail/reference-not-found": func(t *testing.T) test {
 			return test{
-				ctx:        ctx,
-				statusCode: 501,
-				req:        req,
+				db: &acme.MockDB{
+					MockGetExternalAccountKeyByReference: func(ctx context.Context, provisionerID, reference string) (*acme.ExternalAccountKey, error) {
+						return nil, acme.ErrNotFound
+					},
+				},
+				reference:  "tenant-1",
+				statusCode: 404,
 				err: &admin.Error{
-					Type:    admin.ErrorNotImplementedType.String(),
-					Status:  http.StatusNotImplemented,
-					Message: "this functionality is currently only available in Certificate Manager: https://u.step.sm/cm",
-					Detail:  "not implemented",
+					Type:    admin.ErrorNotFoundType.String(),
+					Status:  http.StatusNotFound,
+					Message: "ACME EAB key for reference tenant-1 not found",
+					Detail:  "resource not found",
+				},
+			}
+		},
+		"fail/GetExternalAccountKeyByReference": func(t *testing.T) test {
+			return test{
+				db: &acme.MockDB{
+					MockGetExternalAccountKeyByReference: func(ctx context.Context, provisionerID, reference string) (*acme.ExternalAccountKey, error) {
+						return nil, errors.New("force")
+					},
+				},
+				reference:  "tenant-1",
+				statusCode: 500,
+				err: &admin.Error{
+					Type:    admin.ErrorServerInternalType.String(),
+					Status:  http.StatusInternalServerError,
+					Message: "error retrieving ACME EAB key for reference tenant-1: force",
+					Detail:  "the server experienced an internal error",
+				},
+			}
+		},
+		"fail/parse-cursor": func(t *testing.T) test {
+			return test{
+				db:         &acme.MockDB{},
+				target:     "/foo?limit=A",
+				statusCode: 400,
+				err: &admin.Error{
+					Type:    admin.ErrorBadRequestType.String(),
+					Status:  http.StatusBadRequest,
+					Message: "error parsing cursor and limit from query params: limit 'A' is not an integer: strconv.Atoi: parsing \"A\": invalid syntax",
+					Detail:  "bad request",
+				},
+			}
+		},
+		"fail/GetExternalAccountKeys": func(t *testing.T) test {
+			return test{
+				db: &acme.MockDB{
+					MockGetExternalAccountKeys: func(ctx context.Context, provisionerID, cursor string, limit int) ([]*acme.ExternalAccountKey, string, error) {
+						return nil, "", errors.New("force")
+					},
+				},
+				statusCode: 500,
+				err: &admin.Error{
+					Type:    admin.ErrorServerInternalType.String(),
+					Status:  http.StatusInternalServerError,
+					Message: "error retrieving ACME EAB keys: force",
+					Detail:  "the server experienced an internal error",
+				},
+			}
+		},
+		"ok/reference": func(t *testing.T) test {
+			return test{
+				db: &acme.MockDB{
+					MockGetExternalAccountKeyByReference: func(ctx context.Context, provisionerID, reference string) (*acme.ExternalAccountKey, error) {
+						assert.Equals(t, "provID", provisionerID)
+						assert.Equals(t, "tenant-1", reference)
+						return eak, nil
+					},
+				},
+				reference:  "tenant-1",
+				statusCode: 200,
+				want:       []string{"eakID"},
+			}
+		},
+		"ok": func(t *testing.T) test {
+			return test{
+				db: &acme.MockDB{
+					MockGetExternalAccountKeys: func(ctx context.Context, provisionerID, cursor string, limit int) ([]*acme.ExternalAccountKey, string, error) {
+						assert.Equals(t, "provID", provisionerID)
+						return []*acme.ExternalAccountKey{eak, {ID: "eakID2", ProvisionerID: "provID"}}, "", nil
+					},
 				},
+				statusCode: 200,
+				want:       []string{"eakID", "eakID2"},
 			}
 		},
 	}
 	for name, prep := range tests {
 		tc := prep(t)
 		t.Run(name, func(t *testing.T) {
-
-			req := tc.req.WithContext(tc.ctx)
+			chiCtx := chi.NewRouteContext()
+			chiCtx.URLParams.Add("provisionerName", "provName")
+			if tc.reference != "" {
+				chiCtx.URLParams.Add("reference", tc.reference)
+			}
+			ctx := context.WithValue(context.Background(), chi.RouteCtxKey, chiCtx)
+			ctx = linkedca.NewContextWithProvisioner(ctx, prov)
+			ctx = acme.NewDatabaseContext(ctx, tc.db)
+			target := tc.target
+			if target == "" {
+				target = "/foo"
+			}
+			req := httptest.NewRequest("GET", target, http.NoBody)
+			req = req.WithContext(ctx)
 			w := httptest.NewRecorder()
 			acmeResponder := NewACMEAdminResponder()
 			acmeResponder.GetExternalAccountKeys(w, req)
@@ -342,14 +677,27 @@ func TestHandler_GetExternalAccountKeys(t *testing.T) {
 			res.Body.Close()
 			assert.FatalError(t, err)
 
-			adminErr := admin.Error{}
-			assert.FatalError(t, json.Unmarshal(bytes.TrimSpace(body), &adminErr))
+			if tc.err != nil {
+				adminErr := admin.Error{}
+				assert.FatalError(t, json.Unmarshal(bytes.TrimSpace(body), &adminErr))
 
-			assert.Equals(t, tc.err.Type, adminErr.Type)
-			assert.Equals(t, tc.err.Message, adminErr.Message)
-			assert.Equals(t, tc.err.StatusCode(), res.StatusCode)
-			assert.Equals(t, tc.err.Detail, adminErr.Detail)
-			assert.Equals(t, []string{"application/json"}, res.Header["Content-Type"])
+				assert.Equals(t, tc.err.Type, adminErr.Type)
+				assert.Equals(t, tc.err.Message, adminErr.Message)
+				assert.Equals(t, tc.err.StatusCode(), res.StatusCode)
+				assert.Equals(t, tc.err.Detail, adminErr.Detail)
+				assert.Equals(t, []string{"application/json"}, res.Header["Content-Type"])
+				return
+			}
+
+			var response GetExternalAccountKeysResponse
+			assert.FatalError(t, json.Unmarshal(bytes.TrimSpace(body), &response))
+			ids := make([]string, len(response.EAKs))
+			for i, k := range response.EAKs {
+				ids[i] = k.Id
+				// HMAC keys are not returned
+				assert.Len(t, 0, k.HmacKey)
+			}
+			assert.Equals(t, tc.want, ids)
 		})
 	}
 }
@@ -556,3 +904,538 @@ func Test_linkedEAKToCertificates(t *testing.T) {
 		})
 	}
 }
+
+func TestHandler_requireACMEProvisioner(t *testing.T) {
+	next := func(w http.ResponseWriter, r *http.Request) {
+		w.Write(nil) // mock response with status 200
+	}
+	tests := map[string]struct {
+		prov       *linkedca.Provisioner
+		statusCode int
+		message    string
+	}{
+		"fail/not-acme": {&linkedca.Provisioner{
+			Id:   "provID",
+			Name: "provName",
+			Details: &linkedca.ProvisionerDetails{
+				Data: &linkedca.ProvisionerDetails_JWK{JWK: &linkedca.JWKProvisioner{}},
+			},
+		}, 400, "provisioner 'provName' is not an ACME provisioner"},
+		"ok": {&linkedca.Provisioner{
+			Id:   "provID",
+			Name: "provName",
+			Details: &linkedca.ProvisionerDetails{
+				Data: &linkedca.ProvisionerDetails_ACME{ACME: &linkedca.ACMEProvisioner{}},
+			},
+		}, 200, ""},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			ctx := linkedca.NewContextWithProvisioner(context.Background(), tc.prov)
+			req := httptest.NewRequest("GET", "/foo", http.NoBody).WithContext(ctx)
+			w := httptest.NewRecorder()
+			requireACMEProvisioner(next)(w, req)
+			res := w.Result()
+			assert.Equals(t, tc.statusCode, res.StatusCode)
+
+			body, err := io.ReadAll(res.Body)
+			res.Body.Close()
+			assert.FatalError(t, err)
+
+			if res.StatusCode >= 400 {
+				adminErr := admin.Error{}
+				assert.FatalError(t, json.Unmarshal(bytes.TrimSpace(body), &adminErr))
+				assert.Equals(t, admin.ErrorBadRequestType.String(), adminErr.Type)
+				assert.Equals(t, tc.message, adminErr.Message)
+			}
+		})
+	}
+}
+
+func TestHandler_GetAccounts(t *testing.T) {
+	prov := &linkedca.Provisioner{
+		Id:   "provID",
+		Name: "provName",
+	}
+	type test struct {
+		db         acme.DB
+		id         string
+		statusCode int
+		err        *admin.Error
+		want       *GetACMEAccountsResponse
+	}
+	var tests = map[string]func(t *testing.T) test{
+		"fail/GetAccountsByProvisionerID": func(t *testing.T) test {
+			return test{
+				db: &acme.MockDB{
+					MockGetAccountsByProvisionerID: func(ctx context.Context, provisionerID string) ([]*acme.Account, error) {
+						return nil, errors.New("force")
+					},
+				},
+				statusCode: 500,
+				err: &admin.Error{
+					Type:    admin.ErrorServerInternalType.String(),
+					Status:  http.StatusInternalServerError,
+					Message: "error retrieving ACME accounts: force",
+					Detail:  "the server experienced an internal error",
+				},
+			}
+		},
+		"fail/GetAccount-not-found": func(t *testing.T) test {
+			return test{
+				db: &acme.MockDB{
+					MockGetAccount: func(ctx context.Context, id string) (*acme.Account, error) {
+						return nil, acme.ErrNotFound
+					},
+				},
+				id:         "accID",
+				statusCode: 404,
+				err: &admin.Error{
+					Type:    admin.ErrorNotFoundType.String(),
+					Status:  http.StatusNotFound,
+					Message: "ACME account accID not found",
+					Detail:  "resource not found",
+				},
+			}
+		},
+		"fail/GetAccount-other-provisioner": func(t *testing.T) test {
+			return test{
+				db: &acme.MockDB{
+					MockGetAccount: func(ctx context.Context, id string) (*acme.Account, error) {
+						return &acme.Account{ID: "accID", ProvisionerID: "otherID"}, nil
+					},
+				},
+				id:         "accID",
+				statusCode: 404,
+				err: &admin.Error{
+					Type:    admin.ErrorNotFoundType.String(),
+					Status:  http.StatusNotFound,
+					Message: "ACME account accID not found",
+					Detail:  "resource not found",
+				},
+			}
+		},
+		"ok": func(t *testing.T) test {
+			return test{
+				db: &acme.MockDB{
+					MockGetAccountsByProvisionerID: func(ctx context.Context, provisionerID string) ([]*acme.Account, error) {
+						assert.Equals(t, "provID", provisionerID)
+						return []*acme.Account{
+							{ID: "acc1", ProvisionerID: "provID", Status: acme.StatusValid, Contact: []string{"mailto:jane@example.com"}},
+							{ID: "acc2", ProvisionerID: "provID", Status: acme.StatusDeactivated},
+						}, nil
+					},
+				},
+				statusCode: 200,
+				want: &GetACMEAccountsResponse{
+					Accounts: []*ACMEAccount{
+						{ID: "acc1", Provisioner: "provName", Status: acme.StatusValid, Contact: []string{"mailto:jane@example.com"}},
+						{ID: "acc2", Provisioner: "provName", Status: acme.StatusDeactivated},
+					},
+				},
+			}
+		},
+		"ok/id": func(t *testing.T) test {
+			return test{
+				db: &acme.MockDB{
+					MockGetAccount: func(ctx context.Context, id string) (*acme.Account, error) {
+						assert.Equals(t, "accID", id)
+						return &acme.Account{ID: "accID", ProvisionerName: "provName", Status: acme.StatusValid}, nil
+					},
+				},
+				id:         "accID",
+				statusCode: 200,
+				want: &GetACMEAccountsResponse{
+					Accounts: []*ACMEAccount{
+						{ID: "accID", Provisioner: "provName", Status: acme.StatusValid},
+					},
+				},
+			}
+		},
+	}
+	for name, prep := range tests {
+		tc := prep(t)
+		t.Run(name, func(t *testing.T) {
+			chiCtx := chi.NewRouteContext()
+			chiCtx.URLParams.Add("provisionerName", "provName")
+			if tc.id != "" {
+				chiCtx.URLParams.Add("id", tc.id)
+			}
+			ctx := context.WithValue(context.Background(), chi.RouteCtxKey, chiCtx)
+			ctx = linkedca.NewContextWithProvisioner(ctx, prov)
+			ctx = acme.NewDatabaseContext(ctx, tc.db)
+			req := httptest.NewRequest("GET", "/foo", http.NoBody)
+			req = req.WithContext(ctx)
+			w := httptest.NewRecorder()
+			acmeResponder := NewACMEAdminResponder()
+			acmeResponder.GetAccounts(w, req)
+			res := w.Result()
+			assert.Equals(t, tc.statusCode, res.StatusCode)
+
+			body, err := io.ReadAll(res.Body)
+			res.Body.Close()
+			assert.FatalError(t, err)
+
+			if tc.err != nil {
+				adminErr := admin.Error{}
+				assert.FatalError(t, json.Unmarshal(bytes.TrimSpace(body), &adminErr))
+
+				assert.Equals(t, tc.err.Type, adminErr.Type)
+				assert.Equals(t, tc.err.Message, adminErr.Message)
+				assert.Equals(t, tc.err.StatusCode(), res.StatusCode)
+				assert.Equals(t, tc.err.Detail, adminErr.Detail)
+				assert.Equals(t, []string{"application/json"}, res.Header["Content-Type"])
+				return
+			}
+
+			response := &GetACMEAccountsResponse{}
+			assert.FatalError(t, json.Unmarshal(bytes.TrimSpace(body), response))
+			assert.Equals(t, tc.want, response)
+		})
+	}
+}
+
+func TestHandler_UpdateAccountStatus(t *testing.T) {
+	prov := &linkedca.Provisioner{
+		Id:   "provID",
+		Name: "provName",
+	}
+	type test struct {
+		db         acme.DB
+		body       []byte
+		statusCode int
+		err        *admin.Error
+		want       *ACMEAccount
+	}
+	var tests = map[string]func(t *testing.T) test{
+		"fail/read.JSON": func(t *testing.T) test {
+			return test{
+				db:         &acme.MockDB{},
+				body:       []byte("{!?}"),
+				statusCode: 400,
+				err: &admin.Error{
+					Type:    admin.ErrorBadRequestType.String(),
+					Status:  http.StatusBadRequest,
+					Message: "error reading request body: error decoding json: invalid character '!' looking for beginning of object key string",
+					Detail:  "bad request",
+				},
+			}
+		},
+		"fail/validate": func(t *testing.T) test {
+			return test{
+				db:         &acme.MockDB{},
+				body:       []byte(`{"status":"valid"}`),
+				statusCode: 400,
+				err: &admin.Error{
+					Type:    admin.ErrorBadRequestType.String(),
+					Status:  http.StatusBadRequest,
+					Message: `error validating request body: cannot update account status to "valid", only "deactivated" is supported`,
+					Detail:  "bad request",
+				},
+			}
+		},
+		"fail/GetAccount": func(t *testing.T) test {
+			return test{
+				db: &acme.MockDB{
+					MockGetAccount: func(ctx context.Context, id string) (*acme.Account, error) {
+						return nil, errors.New("force")
+					},
+				},
+				body:       []byte(`{"status":"deactivated"}`),
+				statusCode: 500,
+				err: &admin.Error{
+					Type:    admin.ErrorServerInternalType.String(),
+					Status:  http.StatusInternalServerError,
+					Message: "error retrieving ACME account accID: force",
+					Detail:  "the server experienced an internal error",
+				},
+			}
+		},
+		"fail/UpdateAccount": func(t *testing.T) test {
+			return test{
+				db: &acme.MockDB{
+					MockGetAccount: func(ctx context.Context, id string) (*acme.Account, error) {
+						return &acme.Account{ID: "accID", ProvisionerID: "provID", Status: acme.StatusValid}, nil
+					},
+					MockUpdateAccount: func(ctx context.Context, acc *acme.Account) error {
+						return errors.New("force")
+					},
+				},
+				body:       []byte(`{"status":"deactivated"}`),
+				statusCode: 500,
+				err: &admin.Error{
+					Type:    admin.ErrorServerInternalType.String(),
+					Status:  http.StatusInternalServerError,
+					Message: "error updating ACME account accID: force",
+					Detail:  "the server experienced an internal error",
+				},
+			}
+		},
+		"ok": func(t *testing.T) test {
+			return test{
+				db: &acme.MockDB{
+					MockGetAccount: func(ctx context.Context, id string) (*acme.Account, error) {
+						return &acme.Account{ID: "accID", ProvisionerID: "provID", Status: acme.StatusValid}, nil
+					},
+					MockUpdateAccount: func(ctx context.Context, acc *acme.Account) error {
+						assert.Equals(t, "accID", acc.ID)
+						assert.Equals(t, acme.StatusDeactivated, acc.Status)
+						return nil
+					},
+				},
+				body:       []byte(`{"status":"deactivated"}`),
+				statusCode: 200,
+				want:       &ACMEAccount{ID: "accID", Provisioner: "provName", Status: acme.StatusDeactivated},
+			}
+		},
+		"ok/already-deactivated": func(t *testing.T) test {
+			return test{
+				db: &acme.MockDB{
+					MockGetAccount: func(ctx context.Context, id string) (*acme.Account, error) {
+						return &acme.Account{ID: "accID", ProvisionerID: "provID", Status: acme.StatusDeactivated}, nil
+					},
+				},
+				body:       []byte(`{"status":"deactivated"}`),
+				statusCode: 200,
+				want:       &ACMEAccount{ID: "accID", Provisioner: "provName", Status: acme.StatusDeactivated},
+			}
+		},
+	}
+	for name, prep := range tests {
+		tc := prep(t)
+		t.Run(name, func(t *testing.T) {
+			chiCtx := chi.NewRouteContext()
+			chiCtx.URLParams.Add("provisionerName", "provName")
+			chiCtx.URLParams.Add("id", "accID")
+			ctx := context.WithValue(context.Background(), chi.RouteCtxKey, chiCtx)
+			ctx = linkedca.NewContextWithProvisioner(ctx, prov)
+			ctx = acme.NewDatabaseContext(ctx, tc.db)
+			req := httptest.NewRequest("PUT", "/foo", io.NopCloser(bytes.NewBuffer(tc.body)))
+			req = req.WithContext(ctx)
+			w := httptest.NewRecorder()
+			acmeResponder := NewACMEAdminResponder()
+			acmeResponder.UpdateAccountStatus(w, req)
+			res := w.Result()
+			assert.Equals(t, tc.statusCode, res.StatusCode)
+
+			body, err := io.ReadAll(res.Body)
+			res.Body.Close()
+			assert.FatalError(t, err)
+
+			if tc.err != nil {
+				adminErr := admin.Error{}
+				assert.FatalError(t, json.Unmarshal(bytes.TrimSpace(body), &adminErr))
+
+				assert.Equals(t, tc.err.Type, adminErr.Type)
+				assert.Equals(t, tc.err.Message, adminErr.Message)
+				assert.Equals(t, tc.err.StatusCode(), res.StatusCode)
+				assert.Equals(t, tc.err.Detail, adminErr.Detail)
+				assert.Equals(t, []string{"application/json"}, res.Header["Content-Type"])
+				return
+			}
+
+			response := &ACMEAccount{}
+			assert.FatalError(t, json.Unmarshal(bytes.TrimSpace(body), response))
+			assert.Equals(t, tc.want, response)
+		})
+	}
+}
+
+func TestHandler_UpdateAccountRateLimitTier(t *testing.T) {
+	prov := &linkedca.Provisioner{
+		Id:   "provID",
+		Name: "provName",
+	}
+	acmeProv := &provisioner.ACME{
+		Name: "provName",
+		RateLimits: &provisioner.ACMERateLimits{
+			ACMERateLimit: provisioner.ACMERateLimit{OrdersPerHour: 10},
+			Tiers:         map[string]provisioner.ACMERateLimit{"gold": {OrdersPerHour: 1000}},
+		},
+	}
+	type test struct {
+		auth       adminAuthority
+		db         acme.DB
+		body       []byte
+		statusCode int
+		err        *admin.Error
+		want       *ACMEAccount
+	}
+	var tests = map[string]func(t *testing.T) test{
+		"fail/read.JSON": func(t *testing.T) test {
+			return test{
+				auth:       &mockAdminAuthority{},
+				db:         &acme.MockDB{},
+				body:       []byte("{!?}"),
+				statusCode: 400,
+				err: &admin.Error{
+					Type:    admin.ErrorBadRequestType.String(),
+					Status:  http.StatusBadRequest,
+					Message: "error reading request body: error decoding json: invalid character '!' looking for beginning of object key string",
+					Detail:  "bad request",
+				},
+			}
+		},
+		"fail/LoadProvisionerByName": func(t *testing.T) test {
+			return test{
+				auth: &mockAdminAuthority{
+					MockLoadProvisionerByName: func(name string) (provisioner.Interface, error) {
+						return nil, errors.New("force")
+					},
+				},
+				db:         &acme.MockDB{},
+				body:       []byte(`{"tier":"gold"}`),
+				statusCode: 500,
+				err: &admin.Error{
+					Type:    admin.ErrorServerInternalType.String(),
+					Status:  http.StatusInternalServerError,
+					Message: "error loading provisioner provName: force",
+					Detail:  "the server experienced an internal error",
+				},
+			}
+		},
+		"fail/not-acme": func(t *testing.T) test {
+			return test{
+				auth: &mockAdminAuthority{
+					MockLoadProvisionerByName: func(name string) (provisioner.Interface, error) {
+						return &provisioner.JWK{Name: "provName"}, nil
+					},
+				},
+				db:         &acme.MockDB{},
+				body:       []byte(`{"tier":"gold"}`),
+				statusCode: 400,
+				err: &admin.Error{
+					Type:    admin.ErrorBadRequestType.String(),
+					Status:  http.StatusBadRequest,
+					Message: "provisioner 'provName' is not an ACME provisioner",
+					Detail:  "bad request",
+				},
+			}
+		},
+		"fail/validate": func(t *testing.T) test {
+			return test{
+				auth: &mockAdminAuthority{
+					MockLoadProvisionerByName: func(name string) (provisioner.Interface, error) {
+						return acmeProv, nil
+					},
+				},
+				db:         &acme.MockDB{},
+				body:       []byte(`{"tier":"platinum"}`),
+				statusCode: 400,
+				err: &admin.Error{
+					Type:    admin.ErrorBadRequestType.String(),
+					Status:  http.StatusBadRequest,
+					Message: `error validating request body: rate limit tier "platinum" is not defined in provisioner provName`,
+					Detail:  "bad request",
+				},
+			}
+		},
+		"fail/UpdateAccount": func(t *testing.T) test {
+			return test{
+				auth: &mockAdminAuthority{
+					MockLoadProvisionerByName: func(name string) (provisioner.Interface, error) {
+						return acmeProv, nil
+					},
+				},
+				db: &acme.MockDB{
+					MockGetAccount: func(ctx context.Context, id string) (*acme.Account, error) {
+						return &acme.Account{ID: "accID", ProvisionerID: "provID", Status: acme.StatusValid}, nil
+					},
+					MockUpdateAccount: func(ctx context.Context, acc *acme.Account) error {
+						return errors.New("force")
+					},
+				},
+				body:       []byte(`{"tier":"gold"}`),
+				statusCode: 500,
+				err: &admin.Error{
+					Type:    admin.ErrorServerInternalType.String(),
+					Status:  http.StatusInternalServerError,
+					Message: "error updating ACME account accID: force",
+					Detail:  "the server experienced an internal error",
+				},
+			}
+		},
+		"ok": func(t *testing.T) test {
+			return test{
+				auth: &mockAdminAuthority{
+					MockLoadProvisionerByName: func(name string) (provisioner.Interface, error) {
+						assert.Equals(t, "provName", name)
+						return acmeProv, nil
+					},
+				},
+				db: &acme.MockDB{
+					MockGetAccount: func(ctx context.Context, id string) (*acme.Account, error) {
+						return &acme.Account{ID: "accID", ProvisionerID: "provID", Status: acme.StatusValid}, nil
+					},
+					MockUpdateAccount: func(ctx context.Context, acc *acme.Account) error {
+						assert.Equals(t, "accID", acc.ID)
+						assert.Equals(t, "gold", acc.RateLimitTier)
+						return nil
+					},
+				},
+				body:       []byte(`{"tier":"gold"}`),
+				statusCode: 200,
+				want:       &ACMEAccount{ID: "accID", Provisioner: "provName", Status: acme.StatusValid, RateLimitTier: "gold"},
+			}
+		},
+		"ok/default": func(t *testing.T) test {
+			return test{
+				auth: &mockAdminAuthority{
+					MockLoadProvisionerByName: func(name string) (provisioner.Interface, error) {
+						return acmeProv, nil
+					},
+				},
+				db: &acme.MockDB{
+					MockGetAccount: func(ctx context.Context, id string) (*acme.Account, error) {
+						return &acme.Account{ID: "accID", ProvisionerID: "provID", Status: acme.StatusValid, RateLimitTier: "gold"}, nil
+					},
+					MockUpdateAccount: func(ctx context.Context, acc *acme.Account) error {
+						assert.Equals(t, "", acc.RateLimitTier)
+						return nil
+					},
+				},
+				body:       []byte(`{"tier":""}`),
+				statusCode: 200,
+				want:       &ACMEAccount{ID: "accID", Provisioner: "provName", Status: acme.StatusValid},
+			}
+		},
+	}
+	for name, prep := range tests {
+		tc := prep(t)
+		t.Run(name, func(t *testing.T) {
+			mockMustAuthority(t, tc.auth)
+			chiCtx := chi.NewRouteContext()
+			chiCtx.URLParams.Add("provisionerName", "provName")
+			chiCtx.URLParams.Add("id", "accID")
+			ctx := context.WithValue(context.Background(), chi.RouteCtxKey, chiCtx)
+			ctx = linkedca.NewContextWithProvisioner(ctx, prov)
+			ctx = acme.NewDatabaseContext(ctx, tc.db)
+			req := httptest.NewRequest("PUT", "/foo", io.NopCloser(bytes.NewBuffer(tc.body)))
+			req = req.WithContext(ctx)
+			w := httptest.NewRecorder()
+			acmeResponder := NewACMEAdminResponder()
+			acmeResponder.UpdateAccountRateLimitTier(w, req)
+			res := w.Result()
+			assert.Equals(t, tc.statusCode, res.StatusCode)
+
+			body, err := io.ReadAll(res.Body)
+			res.Body.Close()
+			assert.FatalError(t, err)
+
+			if tc.err != nil {
+				adminErr := admin.Error{}
+				assert.FatalError(t, json.Unmarshal(bytes.TrimSpace(body), &adminErr))
+
+				assert.Equals(t, tc.err.Type, adminErr.Type)
+				assert.Equals(t, tc.err.Message, adminErr.Message)
+				assert.Equals(t, tc.err.StatusCode(), res.StatusCode)
+				assert.Equals(t, tc.err.Detail, adminErr.Detail)
+				return
+			}
+
+			response := &ACMEAccount{}
+			assert.FatalError(t, json.Unmarshal(bytes.TrimSpace(body), response))
+			assert.Equals(t, tc.want, response)
+		})
+	}
+}
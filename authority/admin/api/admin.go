@@ -2,10 +2,14 @@ package api
 
 import (
 	"context"
+	"crypto/x509"
 	"net/http"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 
+	"go.step.sm/crypto/jose"
+	kmsapi "go.step.sm/crypto/kms/apiv1"
 	"go.step.sm/linkedca"
 
 	"github.com/smallstep/certificates/api"
@@ -13,6 +17,7 @@ import (
 	"github.com/smallstep/certificates/api/render"
 	"github.com/smallstep/certificates/authority/admin"
 	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/db"
 )
 
 type adminAuthority interface {
@@ -29,10 +34,29 @@ type adminAuthority interface {
 	LoadProvisionerByID(id string) (provisioner.Interface, error)
 	UpdateProvisioner(ctx context.Context, nu *linkedca.Provisioner) error
 	RemoveProvisioner(ctx context.Context, id string) error
+	GetProvisionerKeys(ctx context.Context, prov provisioner.Interface) ([]*jose.JSONWebKey, error)
+	AddProvisionerKey(ctx context.Context, prov provisioner.Interface, key *jose.JSONWebKey, encryptedKey string, primary bool) ([]*jose.JSONWebKey, error)
+	RemoveProvisionerKey(ctx context.Context, prov provisioner.Interface, kid string) ([]*jose.JSONWebKey, error)
+	GetProvisionerState(ctx context.Context, prov provisioner.Interface) (provisioner.State, error)
+	UpdateProvisionerState(ctx context.Context, prov provisioner.Interface, state provisioner.State) error
 	GetAuthorityPolicy(ctx context.Context) (*linkedca.Policy, error)
 	CreateAuthorityPolicy(ctx context.Context, admin *linkedca.Admin, policy *linkedca.Policy) (*linkedca.Policy, error)
 	UpdateAuthorityPolicy(ctx context.Context, admin *linkedca.Admin, policy *linkedca.Policy) (*linkedca.Policy, error)
 	RemoveAuthorityPolicy(ctx context.Context) error
+	GetWebAuthnCredentials(ctx context.Context, prov provisioner.Interface) ([]*provisioner.WebAuthnCredential, error)
+	StoreWebAuthnCredential(ctx context.Context, prov provisioner.Interface, cred *provisioner.WebAuthnCredential) error
+	RemoveWebAuthnCredential(ctx context.Context, prov provisioner.Interface, credentialID string) error
+	GetSCEPChallenges(ctx context.Context, prov provisioner.Interface) ([]*provisioner.SCEPDynamicChallenge, error)
+	CreateSCEPChallenge(ctx context.Context, prov provisioner.Interface, ttl time.Duration) (string, *provisioner.SCEPDynamicChallenge, error)
+	RemoveSCEPChallenge(ctx context.Context, prov provisioner.Interface, id string) error
+	CreateX509IssuerKey(ctx context.Context, req *kmsapi.CreateKeyRequest) (*kmsapi.CreateKeyResponse, *x509.CertificateRequest, error)
+	RotateX509Issuer(ctx context.Context, chain []*x509.Certificate, key string) error
+	RotateX509IssuerKey(ctx context.Context, rootKey string, lifetime time.Duration) ([]*x509.Certificate, string, error)
+	SetCertificateStatus(ctx context.Context, serial string, status db.InventoryStatus, reason string) (*db.CertificateStatus, error)
+	GetRenewalPolicies(ctx context.Context) ([]*db.RenewalPolicy, error)
+	GetRenewalPolicy(ctx context.Context, name string) (*db.RenewalPolicy, error)
+	StoreRenewalPolicy(ctx context.Context, policy *db.RenewalPolicy) error
+	RemoveRenewalPolicy(ctx context.Context, name string) error
 }
 
 // CreateAdminRequest represents the body for a CreateAdmin request.
@@ -3,6 +3,7 @@ package api
 import (
 	"bytes"
 	"context"
+	"crypto/x509"
 	"encoding/json"
 	"errors"
 	"io"
@@ -16,11 +17,14 @@ import (
 	"github.com/google/go-cmp/cmp/cmpopts"
 	"google.golang.org/protobuf/types/known/timestamppb"
 
+	"go.step.sm/crypto/jose"
+	kmsapi "go.step.sm/crypto/kms/apiv1"
 	"go.step.sm/linkedca"
 
 	"github.com/smallstep/assert"
 	"github.com/smallstep/certificates/authority/admin"
 	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/db"
 )
 
 type mockAdminAuthority struct {
@@ -40,10 +44,36 @@ type mockAdminAuthority struct {
 	MockUpdateProvisioner     func(ctx context.Context, nu *linkedca.Provisioner) error
 	MockRemoveProvisioner     func(ctx context.Context, id string) error
 
+	MockGetProvisionerKeys   func(ctx context.Context, prov provisioner.Interface) ([]*jose.JSONWebKey, error)
+	MockAddProvisionerKey    func(ctx context.Context, prov provisioner.Interface, key *jose.JSONWebKey, encryptedKey string, primary bool) ([]*jose.JSONWebKey, error)
+	MockRemoveProvisionerKey func(ctx context.Context, prov provisioner.Interface, kid string) ([]*jose.JSONWebKey, error)
+
+	MockGetProvisionerState    func(ctx context.Context, prov provisioner.Interface) (provisioner.State, error)
+	MockUpdateProvisionerState func(ctx context.Context, prov provisioner.Interface, state provisioner.State) error
+
 	MockGetAuthorityPolicy    func(ctx context.Context) (*linkedca.Policy, error)
 	MockCreateAuthorityPolicy func(ctx context.Context, adm *linkedca.Admin, policy *linkedca.Policy) (*linkedca.Policy, error)
 	MockUpdateAuthorityPolicy func(ctx context.Context, adm *linkedca.Admin, policy *linkedca.Policy) (*linkedca.Policy, error)
 	MockRemoveAuthorityPolicy func(ctx context.Context) error
+
+	MockGetWebAuthnCredentials   func(ctx context.Context, prov provisioner.Interface) ([]*provisioner.WebAuthnCredential, error)
+	MockStoreWebAuthnCredential  func(ctx context.Context, prov provisioner.Interface, cred *provisioner.WebAuthnCredential) error
+	MockRemoveWebAuthnCredential func(ctx context.Context, prov provisioner.Interface, credentialID string) error
+
+	MockGetSCEPChallenges   func(ctx context.Context, prov provisioner.Interface) ([]*provisioner.SCEPDynamicChallenge, error)
+	MockCreateSCEPChallenge func(ctx context.Context, prov provisioner.Interface, ttl time.Duration) (string, *provisioner.SCEPDynamicChallenge, error)
+	MockRemoveSCEPChallenge func(ctx context.Context, prov provisioner.Interface, id string) error
+
+	MockCreateX509IssuerKey func(ctx context.Context, req *kmsapi.CreateKeyRequest) (*kmsapi.CreateKeyResponse, *x509.CertificateRequest, error)
+	MockRotateX509Issuer    func(ctx context.Context, chain []*x509.Certificate, key string) error
+	MockRotateX509IssuerKey func(ctx context.Context, rootKey string, lifetime time.Duration) ([]*x509.Certificate, string, error)
+
+	MockSetCertificateStatus func(ctx context.Context, serial string, status db.InventoryStatus, reason string) (*db.CertificateStatus, error)
+
+	MockGetRenewalPolicies  func(ctx context.Context) ([]*db.RenewalPolicy, error)
+	MockGetRenewalPolicy    func(ctx context.Context, name string) (*db.RenewalPolicy, error)
+	MockStoreRenewalPolicy  func(ctx context.Context, policy *db.RenewalPolicy) error
+	MockRemoveRenewalPolicy func(ctx context.Context, name string) error
 }
 
 func (m *mockAdminAuthority) IsAdminAPIEnabled() bool {
@@ -165,6 +195,139 @@ func (m *mockAdminAuthority) RemoveAuthorityPolicy(ctx context.Context) error {
 	return m.MockErr
 }
 
+func (m *mockAdminAuthority) GetWebAuthnCredentials(ctx context.Context, prov provisioner.Interface) ([]*provisioner.WebAuthnCredential, error) {
+	if m.MockGetWebAuthnCredentials != nil {
+		return m.MockGetWebAuthnCredentials(ctx, prov)
+	}
+	return m.MockRet1.([]*provisioner.WebAuthnCredential), m.MockErr
+}
+
+func (m *mockAdminAuthority) StoreWebAuthnCredential(ctx context.Context, prov provisioner.Interface, cred *provisioner.WebAuthnCredential) error {
+	if m.MockStoreWebAuthnCredential != nil {
+		return m.MockStoreWebAuthnCredential(ctx, prov, cred)
+	}
+	return m.MockErr
+}
+
+func (m *mockAdminAuthority) RemoveWebAuthnCredential(ctx context.Context, prov provisioner.Interface, credentialID string) error {
+	if m.MockRemoveWebAuthnCredential != nil {
+		return m.MockRemoveWebAuthnCredential(ctx, prov, credentialID)
+	}
+	return m.MockErr
+}
+
+func (m *mockAdminAuthority) GetSCEPChallenges(ctx context.Context, prov provisioner.Interface) ([]*provisioner.SCEPDynamicChallenge, error) {
+	if m.MockGetSCEPChallenges != nil {
+		return m.MockGetSCEPChallenges(ctx, prov)
+	}
+	return m.MockRet1.([]*provisioner.SCEPDynamicChallenge), m.MockErr
+}
+
+func (m *mockAdminAuthority) CreateSCEPChallenge(ctx context.Context, prov provisioner.Interface, ttl time.Duration) (string, *provisioner.SCEPDynamicChallenge, error) {
+	if m.MockCreateSCEPChallenge != nil {
+		return m.MockCreateSCEPChallenge(ctx, prov, ttl)
+	}
+	return "", m.MockRet1.(*provisioner.SCEPDynamicChallenge), m.MockErr
+}
+
+func (m *mockAdminAuthority) RemoveSCEPChallenge(ctx context.Context, prov provisioner.Interface, id string) error {
+	if m.MockRemoveSCEPChallenge != nil {
+		return m.MockRemoveSCEPChallenge(ctx, prov, id)
+	}
+	return m.MockErr
+}
+
+func (m *mockAdminAuthority) GetProvisionerKeys(ctx context.Context, prov provisioner.Interface) ([]*jose.JSONWebKey, error) {
+	if m.MockGetProvisionerKeys != nil {
+		return m.MockGetProvisionerKeys(ctx, prov)
+	}
+	return nil, m.MockErr
+}
+
+func (m *mockAdminAuthority) AddProvisionerKey(ctx context.Context, prov provisioner.Interface, key *jose.JSONWebKey, encryptedKey string, primary bool) ([]*jose.JSONWebKey, error) {
+	if m.MockAddProvisionerKey != nil {
+		return m.MockAddProvisionerKey(ctx, prov, key, encryptedKey, primary)
+	}
+	return nil, m.MockErr
+}
+
+func (m *mockAdminAuthority) RemoveProvisionerKey(ctx context.Context, prov provisioner.Interface, kid string) ([]*jose.JSONWebKey, error) {
+	if m.MockRemoveProvisionerKey != nil {
+		return m.MockRemoveProvisionerKey(ctx, prov, kid)
+	}
+	return nil, m.MockErr
+}
+
+func (m *mockAdminAuthority) GetProvisionerState(ctx context.Context, prov provisioner.Interface) (provisioner.State, error) {
+	if m.MockGetProvisionerState != nil {
+		return m.MockGetProvisionerState(ctx, prov)
+	}
+	return m.MockRet1.(provisioner.State), m.MockErr
+}
+
+func (m *mockAdminAuthority) UpdateProvisionerState(ctx context.Context, prov provisioner.Interface, state provisioner.State) error {
+	if m.MockUpdateProvisionerState != nil {
+		return m.MockUpdateProvisionerState(ctx, prov, state)
+	}
+	return m.MockErr
+}
+
+func (m *mockAdminAuthority) CreateX509IssuerKey(ctx context.Context, req *kmsapi.CreateKeyRequest) (*kmsapi.CreateKeyResponse, *x509.CertificateRequest, error) {
+	if m.MockCreateX509IssuerKey != nil {
+		return m.MockCreateX509IssuerKey(ctx, req)
+	}
+	return nil, nil, m.MockErr
+}
+
+func (m *mockAdminAuthority) RotateX509Issuer(ctx context.Context, chain []*x509.Certificate, key string) error {
+	if m.MockRotateX509Issuer != nil {
+		return m.MockRotateX509Issuer(ctx, chain, key)
+	}
+	return m.MockErr
+}
+
+func (m *mockAdminAuthority) RotateX509IssuerKey(ctx context.Context, rootKey string, lifetime time.Duration) ([]*x509.Certificate, string, error) {
+	if m.MockRotateX509IssuerKey != nil {
+		return m.MockRotateX509IssuerKey(ctx, rootKey, lifetime)
+	}
+	return nil, "", m.MockErr
+}
+
+func (m *mockAdminAuthority) SetCertificateStatus(ctx context.Context, serial string, status db.InventoryStatus, reason string) (*db.CertificateStatus, error) {
+	if m.MockSetCertificateStatus != nil {
+		return m.MockSetCertificateStatus(ctx, serial, status, reason)
+	}
+	return nil, m.MockErr
+}
+
+func (m *mockAdminAuthority) GetRenewalPolicies(ctx context.Context) ([]*db.RenewalPolicy, error) {
+	if m.MockGetRenewalPolicies != nil {
+		return m.MockGetRenewalPolicies(ctx)
+	}
+	return nil, m.MockErr
+}
+
+func (m *mockAdminAuthority) GetRenewalPolicy(ctx context.Context, name string) (*db.RenewalPolicy, error) {
+	if m.MockGetRenewalPolicy != nil {
+		return m.MockGetRenewalPolicy(ctx, name)
+	}
+	return nil, m.MockErr
+}
+
+func (m *mockAdminAuthority) StoreRenewalPolicy(ctx context.Context, policy *db.RenewalPolicy) error {
+	if m.MockStoreRenewalPolicy != nil {
+		return m.MockStoreRenewalPolicy(ctx, policy)
+	}
+	return m.MockErr
+}
+
+func (m *mockAdminAuthority) RemoveRenewalPolicy(ctx context.Context, name string) error {
+	if m.MockRemoveRenewalPolicy != nil {
+		return m.MockRemoveRenewalPolicy(ctx, name)
+	}
+	return m.MockErr
+}
+
 func TestCreateAdminRequest_Validate(t *testing.T) {
 	type fields struct {
 		Subject     string
@@ -70,7 +70,11 @@ func Route(r api.Router, options ...RouterOption) {
 	}
 
 	acmePolicyMiddleware := func(next http.HandlerFunc) http.HandlerFunc {
-		return authnz(disabledInStandalone(loadProvisionerByName(requireEABEnabled(loadExternalAccountKey(next)))))
+		return authnz(loadProvisionerByName(requireEABEnabled(loadExternalAccountKey(next))))
+	}
+
+	acmeAccountMiddleware := func(next http.HandlerFunc) http.HandlerFunc {
+		return authnz(loadProvisionerByName(requireACMEProvisioner(next)))
 	}
 
 	webhookMiddleware := func(next http.HandlerFunc) http.HandlerFunc {
@@ -83,6 +87,11 @@ func Route(r api.Router, options ...RouterOption) {
 	r.MethodFunc("POST", "/provisioners", authnz(CreateProvisioner))
 	r.MethodFunc("PUT", "/provisioners/{name}", authnz(UpdateProvisioner))
 	r.MethodFunc("DELETE", "/provisioners/{name}", authnz(DeleteProvisioner))
+	r.MethodFunc("GET", "/provisioners/{name}/keys", authnz(GetProvisionerKeys))
+	r.MethodFunc("POST", "/provisioners/{name}/keys", authnz(CreateProvisionerKey))
+	r.MethodFunc("DELETE", "/provisioners/{name}/keys/{kid}", authnz(DeleteProvisionerKey))
+	r.MethodFunc("GET", "/provisioners/{name}/state", authnz(GetProvisionerState))
+	r.MethodFunc("PUT", "/provisioners/{name}/state", authnz(UpdateProvisionerState))
 
 	// Admins
 	r.MethodFunc("GET", "/admins/{id}", authnz(GetAdmin))
@@ -91,6 +100,30 @@ func Route(r api.Router, options ...RouterOption) {
 	r.MethodFunc("PATCH", "/admins/{id}", authnz(UpdateAdmin))
 	r.MethodFunc("DELETE", "/admins/{id}", authnz(DeleteAdmin))
 
+	// WebAuthn credentials
+	r.MethodFunc("GET", "/provisioners/{provisionerName}/webauthn/credentials", authnz(GetWebAuthnCredentials))
+	r.MethodFunc("POST", "/provisioners/{provisionerName}/webauthn/credentials", authnz(CreateWebAuthnCredential))
+	r.MethodFunc("DELETE", "/provisioners/{provisionerName}/webauthn/credentials/{id}", authnz(DeleteWebAuthnCredential))
+
+	// SCEP dynamic challenges
+	r.MethodFunc("GET", "/provisioners/{provisionerName}/scep/challenges", authnz(GetSCEPChallenges))
+	r.MethodFunc("POST", "/provisioners/{provisionerName}/scep/challenges", authnz(CreateSCEPChallenge))
+	r.MethodFunc("DELETE", "/provisioners/{provisionerName}/scep/challenges/{id}", authnz(DeleteSCEPChallenge))
+
+	// X.509 issuer rotation
+	r.MethodFunc("POST", "/x509/issuer/keys", authnz(CreateX509IssuerKey))
+	r.MethodFunc("PUT", "/x509/issuer", authnz(RotateX509Issuer))
+	r.MethodFunc("POST", "/x509/issuer/rotate", authnz(RotateX509IssuerKey))
+
+	// Certificate inventory
+	r.MethodFunc("PUT", "/x509/certificates/{serial}/status", authnz(UpdateCertificateStatus))
+
+	// Renewal policies of deleted provisioners
+	r.MethodFunc("GET", "/renewal-policies", authnz(GetRenewalPolicies))
+	r.MethodFunc("GET", "/renewal-policies/{provisionerName}", authnz(GetRenewalPolicy))
+	r.MethodFunc("PUT", "/renewal-policies/{provisionerName}", authnz(UpdateRenewalPolicy))
+	r.MethodFunc("DELETE", "/renewal-policies/{provisionerName}", authnz(DeleteRenewalPolicy))
+
 	// ACME responder
 	if router.acmeResponder != nil {
 		// ACME External Account Binding Keys
@@ -98,6 +131,12 @@ func Route(r api.Router, options ...RouterOption) {
 		r.MethodFunc("GET", "/acme/eab/{provisionerName}", acmeEABMiddleware(router.acmeResponder.GetExternalAccountKeys))
 		r.MethodFunc("POST", "/acme/eab/{provisionerName}", acmeEABMiddleware(router.acmeResponder.CreateExternalAccountKey))
 		r.MethodFunc("DELETE", "/acme/eab/{provisionerName}/{id}", acmeEABMiddleware(router.acmeResponder.DeleteExternalAccountKey))
+
+		// ACME Accounts
+		r.MethodFunc("GET", "/acme/accounts/{provisionerName}", acmeAccountMiddleware(router.acmeResponder.GetAccounts))
+		r.MethodFunc("GET", "/acme/accounts/{provisionerName}/{id}", acmeAccountMiddleware(router.acmeResponder.GetAccounts))
+		r.MethodFunc("PUT", "/acme/accounts/{provisionerName}/{id}/status", acmeAccountMiddleware(router.acmeResponder.UpdateAccountStatus))
+		r.MethodFunc("PUT", "/acme/accounts/{provisionerName}/{id}/rate-limit-tier", acmeAccountMiddleware(router.acmeResponder.UpdateAccountRateLimitTier))
 	}
 
 	// Policy responder
@@ -123,6 +162,10 @@ func Route(r api.Router, options ...RouterOption) {
 		r.MethodFunc("PUT", "/acme/policy/{provisionerName}/key/{keyID}", acmePolicyMiddleware(router.policyResponder.UpdateACMEAccountPolicy))
 		r.MethodFunc("DELETE", "/acme/policy/{provisionerName}/reference/{reference}", acmePolicyMiddleware(router.policyResponder.DeleteACMEAccountPolicy))
 		r.MethodFunc("DELETE", "/acme/policy/{provisionerName}/key/{keyID}", acmePolicyMiddleware(router.policyResponder.DeleteACMEAccountPolicy))
+		r.MethodFunc("GET", "/acme/policy/{provisionerName}/account/{accountID}", acmeAccountMiddleware(router.policyResponder.GetACMEAccountIDPolicy))
+		r.MethodFunc("POST", "/acme/policy/{provisionerName}/account/{accountID}", acmeAccountMiddleware(router.policyResponder.CreateACMEAccountIDPolicy))
+		r.MethodFunc("PUT", "/acme/policy/{provisionerName}/account/{accountID}", acmeAccountMiddleware(router.policyResponder.UpdateACMEAccountIDPolicy))
+		r.MethodFunc("DELETE", "/acme/policy/{provisionerName}/account/{accountID}", acmeAccountMiddleware(router.policyResponder.DeleteACMEAccountIDPolicy))
 	}
 
 	if router.webhookResponder != nil {
@@ -0,0 +1,56 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/smallstep/certificates/api/read"
+	"github.com/smallstep/certificates/api/render"
+	"github.com/smallstep/certificates/authority/admin"
+	"github.com/smallstep/certificates/db"
+)
+
+// UpdateCertificateStatusRequest represents the body for an
+// UpdateCertificateStatus request.
+type UpdateCertificateStatusRequest struct {
+	// Status is the inventory status of the certificate, "active",
+	// "decommissioned" or "revoked".
+	Status db.InventoryStatus `json:"status"`
+	// Reason is an optional description of the status change.
+	Reason string `json:"reason,omitempty"`
+}
+
+// Validate validates an update-certificate-status request body.
+func (r *UpdateCertificateStatusRequest) Validate() error {
+	if err := r.Status.Validate(); err != nil {
+		return admin.WrapError(admin.ErrorBadRequestType, err, "invalid status")
+	}
+	return nil
+}
+
+// UpdateCertificateStatus sets the inventory status of a certificate.
+// Certificates that are not active cannot be renewed by provisioners with
+// the renewal inventory check enabled.
+func UpdateCertificateStatus(w http.ResponseWriter, r *http.Request) {
+	serial := chi.URLParam(r, "serial")
+
+	var body UpdateCertificateStatusRequest
+	if err := read.JSON(r.Body, &body); err != nil {
+		render.Error(w, r, admin.WrapError(admin.ErrorBadRequestType, err, "error reading request body"))
+		return
+	}
+
+	if err := body.Validate(); err != nil {
+		render.Error(w, r, err)
+		return
+	}
+
+	st, err := mustAuthority(r.Context()).SetCertificateStatus(r.Context(), serial, body.Status, body.Reason)
+	if err != nil {
+		render.Error(w, r, err)
+		return
+	}
+
+	render.JSON(w, r, st)
+}
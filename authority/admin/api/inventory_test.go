@@ -0,0 +1,103 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/smallstep/assert"
+	"github.com/smallstep/certificates/authority/admin"
+	"github.com/smallstep/certificates/db"
+)
+
+func TestUpdateCertificateStatusRequest_Validate(t *testing.T) {
+	tests := map[string]struct {
+		req     *UpdateCertificateStatusRequest
+		wantErr bool
+	}{
+		"ok/active":         {&UpdateCertificateStatusRequest{Status: db.InventoryStatusActive}, false},
+		"ok/decommissioned": {&UpdateCertificateStatusRequest{Status: db.InventoryStatusDecommissioned, Reason: "host deprovisioned"}, false},
+		"ok/revoked":        {&UpdateCertificateStatusRequest{Status: db.InventoryStatusRevoked}, false},
+		"fail/empty":        {&UpdateCertificateStatusRequest{}, true},
+		"fail/unknown":      {&UpdateCertificateStatusRequest{Status: "lost"}, true},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := tc.req.Validate()
+			assert.Equals(t, tc.wantErr, err != nil)
+		})
+	}
+}
+
+func TestHandler_UpdateCertificateStatus(t *testing.T) {
+	body := func(v any) []byte {
+		b, err := json.Marshal(v)
+		assert.FatalError(t, err)
+		return b
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	tests := map[string]struct {
+		body       []byte
+		auth       *mockAdminAuthority
+		statusCode int
+		want       *db.CertificateStatus
+	}{
+		"fail/read.JSON": {
+			body:       []byte("{!?}"),
+			auth:       &mockAdminAuthority{},
+			statusCode: 400,
+		},
+		"fail/validate": {
+			body:       body(&UpdateCertificateStatusRequest{Status: "lost"}),
+			auth:       &mockAdminAuthority{},
+			statusCode: 400,
+		},
+		"fail/auth.SetCertificateStatus": {
+			body: body(&UpdateCertificateStatusRequest{Status: db.InventoryStatusDecommissioned}),
+			auth: &mockAdminAuthority{
+				MockSetCertificateStatus: func(ctx context.Context, serial string, status db.InventoryStatus, reason string) (*db.CertificateStatus, error) {
+					return nil, admin.NewError(admin.ErrorNotImplementedType, "the configured database does not support the certificate inventory")
+				},
+			},
+			statusCode: 501,
+		},
+		"ok": {
+			body: body(&UpdateCertificateStatusRequest{Status: db.InventoryStatusDecommissioned, Reason: "host deprovisioned"}),
+			auth: &mockAdminAuthority{
+				MockSetCertificateStatus: func(ctx context.Context, serial string, status db.InventoryStatus, reason string) (*db.CertificateStatus, error) {
+					assert.Equals(t, "1234", serial)
+					assert.Equals(t, db.InventoryStatusDecommissioned, status)
+					assert.Equals(t, "host deprovisioned", reason)
+					return &db.CertificateStatus{Status: status, Reason: reason, UpdatedAt: now}, nil
+				},
+			},
+			statusCode: 200,
+			want:       &db.CertificateStatus{Status: db.InventoryStatusDecommissioned, Reason: "host deprovisioned", UpdatedAt: now},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			mockMustAuthority(t, tc.auth)
+			chiCtx := chi.NewRouteContext()
+			chiCtx.URLParams.Add("serial", "1234")
+			ctx := context.WithValue(context.Background(), chi.RouteCtxKey, chiCtx)
+			req := httptest.NewRequest("PUT", "/foo", io.NopCloser(bytes.NewBuffer(tc.body))).WithContext(ctx)
+			w := httptest.NewRecorder()
+			UpdateCertificateStatus(w, req)
+			res := w.Result()
+			assert.Equals(t, tc.statusCode, res.StatusCode)
+			if tc.want != nil {
+				var got db.CertificateStatus
+				assert.FatalError(t, json.NewDecoder(res.Body).Decode(&got))
+				assert.Equals(t, tc.want, &got)
+			}
+		})
+	}
+}
@@ -0,0 +1,228 @@
+package api
+
+import (
+	"encoding/pem"
+	"net/http"
+	"strings"
+	"time"
+
+	kmsapi "go.step.sm/crypto/kms/apiv1"
+	"go.step.sm/crypto/pemutil"
+
+	"github.com/smallstep/certificates/api/read"
+	"github.com/smallstep/certificates/api/render"
+	"github.com/smallstep/certificates/authority/admin"
+)
+
+// signatureAlgorithms maps the names of the signature algorithms accepted in
+// CreateX509IssuerKey requests to their KMS values.
+var signatureAlgorithms = map[string]kmsapi.SignatureAlgorithm{
+	"SHA256-RSA":    kmsapi.SHA256WithRSA,
+	"SHA384-RSA":    kmsapi.SHA384WithRSA,
+	"SHA512-RSA":    kmsapi.SHA512WithRSA,
+	"SHA256-RSAPSS": kmsapi.SHA256WithRSAPSS,
+	"SHA384-RSAPSS": kmsapi.SHA384WithRSAPSS,
+	"SHA512-RSAPSS": kmsapi.SHA512WithRSAPSS,
+	"ECDSA-SHA256":  kmsapi.ECDSAWithSHA256,
+	"ECDSA-SHA384":  kmsapi.ECDSAWithSHA384,
+	"ECDSA-SHA512":  kmsapi.ECDSAWithSHA512,
+	"ED25519":       kmsapi.PureEd25519,
+}
+
+// CreateX509IssuerKeyRequest represents the body for a CreateX509IssuerKey
+// request.
+type CreateX509IssuerKeyRequest struct {
+	// Name is the name of the key in the KMS, e.g., a KMS URI. If empty, the
+	// current issuer key is rotated using the same algorithm.
+	Name string `json:"name,omitempty"`
+	// SignatureAlgorithm is the type of key to create, e.g., "ECDSA-SHA256"
+	// or "SHA256-RSA". It defaults to the KMS default.
+	SignatureAlgorithm string `json:"signatureAlgorithm,omitempty"`
+	// Bits is the size of RSA keys.
+	Bits int `json:"bits,omitempty"`
+}
+
+// Validate validates a create-x509-issuer-key request body.
+func (r *CreateX509IssuerKeyRequest) Validate() error {
+	switch {
+	case r.Name == "" && (r.SignatureAlgorithm != "" || r.Bits != 0):
+		return admin.NewError(admin.ErrorBadRequestType, "name cannot be empty if signatureAlgorithm or bits are set")
+	case r.Bits < 0:
+		return admin.NewError(admin.ErrorBadRequestType, "bits cannot be negative")
+	}
+	if r.SignatureAlgorithm != "" {
+		if _, ok := signatureAlgorithms[strings.ToUpper(r.SignatureAlgorithm)]; !ok {
+			return admin.NewError(admin.ErrorBadRequestType, "signatureAlgorithm %s is not supported", r.SignatureAlgorithm)
+		}
+	}
+	return nil
+}
+
+// CreateX509IssuerKeyResponse is the type for POST /admin/x509/issuer/keys
+// responses. CSR is the PEM encoded certificate request that needs to be
+// signed by the root to create the new issuer certificate.
+type CreateX509IssuerKeyResponse struct {
+	Name string `json:"name"`
+	CSR  string `json:"csr"`
+}
+
+// RotateX509IssuerRequest represents the body for a RotateX509Issuer request.
+type RotateX509IssuerRequest struct {
+	// Certificate is the PEM encoded issuer certificate, followed by the
+	// certificates that chain it to the root.
+	Certificate string `json:"crt"`
+	// Key is the name of the key of the issuer certificate, e.g., a KMS URI.
+	Key string `json:"key"`
+}
+
+// Validate validates a rotate-x509-issuer request body.
+func (r *RotateX509IssuerRequest) Validate() error {
+	switch {
+	case r.Certificate == "":
+		return admin.NewError(admin.ErrorBadRequestType, "crt cannot be empty")
+	case r.Key == "":
+		return admin.NewError(admin.ErrorBadRequestType, "key cannot be empty")
+	}
+	return nil
+}
+
+// RotateX509IssuerResponse is the type for PUT /admin/x509/issuer responses.
+type RotateX509IssuerResponse struct {
+	Status string `json:"status"`
+}
+
+// RotateX509IssuerKeyRequest represents the body for a RotateX509IssuerKey
+// request.
+type RotateX509IssuerKeyRequest struct {
+	// RootKey is the name of the key of the root that signed the current
+	// issuer, e.g., a KMS URI.
+	RootKey string `json:"rootKey"`
+	// Lifetime is the validity period of the new issuer certificate, e.g.,
+	// "8760h". It defaults to the validity period of the current issuer.
+	Lifetime string `json:"lifetime,omitempty"`
+}
+
+// Validate validates a rotate-x509-issuer-key request body.
+func (r *RotateX509IssuerKeyRequest) Validate() error {
+	if r.RootKey == "" {
+		return admin.NewError(admin.ErrorBadRequestType, "rootKey cannot be empty")
+	}
+	if r.Lifetime != "" {
+		d, err := time.ParseDuration(r.Lifetime)
+		if err != nil {
+			return admin.WrapError(admin.ErrorBadRequestType, err, "lifetime %s is not valid", r.Lifetime)
+		}
+		if d <= 0 {
+			return admin.NewError(admin.ErrorBadRequestType, "lifetime must be positive")
+		}
+	}
+	return nil
+}
+
+// RotateX509IssuerKeyResponse is the type for POST /admin/x509/issuer/rotate
+// responses. It contains the name of the new issuer key and the PEM encoded
+// issuer certificate.
+type RotateX509IssuerKeyResponse struct {
+	Key         string `json:"key"`
+	Certificate string `json:"crt"`
+}
+
+// CreateX509IssuerKey creates a new key for the X.509 issuer in the KMS of
+// the authority, and returns a certificate request signed by it.
+func CreateX509IssuerKey(w http.ResponseWriter, r *http.Request) {
+	var body CreateX509IssuerKeyRequest
+	if err := read.JSON(r.Body, &body); err != nil {
+		render.Error(w, r, admin.WrapError(admin.ErrorBadRequestType, err, "error reading request body"))
+		return
+	}
+
+	if err := body.Validate(); err != nil {
+		render.Error(w, r, err)
+		return
+	}
+
+	key, csr, err := mustAuthority(r.Context()).CreateX509IssuerKey(r.Context(), &kmsapi.CreateKeyRequest{
+		Name:               body.Name,
+		SignatureAlgorithm: signatureAlgorithms[strings.ToUpper(body.SignatureAlgorithm)],
+		Bits:               body.Bits,
+	})
+	if err != nil {
+		render.Error(w, r, admin.WrapErrorISE(err, "error creating x509 issuer key"))
+		return
+	}
+
+	render.JSONStatus(w, r, &CreateX509IssuerKeyResponse{
+		Name: key.Name,
+		CSR: string(pem.EncodeToMemory(&pem.Block{
+			Type:  "CERTIFICATE REQUEST",
+			Bytes: csr.Raw,
+		})),
+	}, http.StatusCreated)
+}
+
+// RotateX509Issuer replaces the certificate and key used to sign X.509
+// certificates.
+func RotateX509Issuer(w http.ResponseWriter, r *http.Request) {
+	var body RotateX509IssuerRequest
+	if err := read.JSON(r.Body, &body); err != nil {
+		render.Error(w, r, admin.WrapError(admin.ErrorBadRequestType, err, "error reading request body"))
+		return
+	}
+
+	if err := body.Validate(); err != nil {
+		render.Error(w, r, err)
+		return
+	}
+
+	chain, err := pemutil.ParseCertificateBundle([]byte(body.Certificate))
+	if err != nil {
+		render.Error(w, r, admin.WrapError(admin.ErrorBadRequestType, err, "error parsing crt"))
+		return
+	}
+
+	if err := mustAuthority(r.Context()).RotateX509Issuer(r.Context(), chain, body.Key); err != nil {
+		render.Error(w, r, admin.WrapErrorISE(err, "error rotating x509 issuer"))
+		return
+	}
+
+	render.JSON(w, r, &RotateX509IssuerResponse{Status: "ok"})
+}
+
+// RotateX509IssuerKey rotates the key of the X.509 issuer, re-issues the issuer
+// certificate with the new key, and starts using them to sign certificates.
+func RotateX509IssuerKey(w http.ResponseWriter, r *http.Request) {
+	var body RotateX509IssuerKeyRequest
+	if err := read.JSON(r.Body, &body); err != nil {
+		render.Error(w, r, admin.WrapError(admin.ErrorBadRequestType, err, "error reading request body"))
+		return
+	}
+
+	if err := body.Validate(); err != nil {
+		render.Error(w, r, err)
+		return
+	}
+
+	var lifetime time.Duration
+	if body.Lifetime != "" {
+		lifetime, _ = time.ParseDuration(body.Lifetime)
+	}
+
+	chain, key, err := mustAuthority(r.Context()).RotateX509IssuerKey(r.Context(), body.RootKey, lifetime)
+	if err != nil {
+		render.Error(w, r, admin.WrapErrorISE(err, "error rotating x509 issuer key"))
+		return
+	}
+
+	var crt []byte
+	for _, c := range chain {
+		crt = append(crt, pem.EncodeToMemory(&pem.Block{
+			Type:  "CERTIFICATE",
+			Bytes: c.Raw,
+		})...)
+	}
+
+	render.JSON(w, r, &RotateX509IssuerKeyResponse{
+		Key:         key,
+		Certificate: string(crt),
+	})
+}
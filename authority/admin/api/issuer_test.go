@@ -0,0 +1,277 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	kmsapi "go.step.sm/crypto/kms/apiv1"
+	"go.step.sm/crypto/minica"
+
+	"github.com/smallstep/assert"
+	"github.com/smallstep/certificates/authority/admin"
+)
+
+func TestCreateX509IssuerKeyRequest_Validate(t *testing.T) {
+	tests := map[string]struct {
+		req     *CreateX509IssuerKeyRequest
+		wantErr bool
+	}{
+		"ok":                          {&CreateX509IssuerKeyRequest{Name: "cloudkms:key"}, false},
+		"ok/signatureAlgorithm":       {&CreateX509IssuerKeyRequest{Name: "cloudkms:key", SignatureAlgorithm: "ecdsa-sha384"}, false},
+		"ok/rsa":                      {&CreateX509IssuerKeyRequest{Name: "cloudkms:key", SignatureAlgorithm: "SHA256-RSA", Bits: 3072}, false},
+		"ok/rotate":                   {&CreateX509IssuerKeyRequest{}, false},
+		"fail/name":                   {&CreateX509IssuerKeyRequest{SignatureAlgorithm: "ECDSA-SHA256"}, true},
+		"fail/name-bits":              {&CreateX509IssuerKeyRequest{Bits: 2048}, true},
+		"fail/bits":                   {&CreateX509IssuerKeyRequest{Name: "cloudkms:key", Bits: -1}, true},
+		"fail/signatureAlgorithm":     {&CreateX509IssuerKeyRequest{Name: "cloudkms:key", SignatureAlgorithm: "DSA"}, true},
+		"fail/signatureAlgorithm-int": {&CreateX509IssuerKeyRequest{Name: "cloudkms:key", SignatureAlgorithm: "7"}, true},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := tc.req.Validate()
+			assert.Equals(t, tc.wantErr, err != nil)
+		})
+	}
+}
+
+func TestHandler_CreateX509IssuerKey(t *testing.T) {
+	body := func(v any) []byte {
+		b, err := json.Marshal(v)
+		assert.FatalError(t, err)
+		return b
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: "Intermediate CA"},
+	}, key)
+	assert.FatalError(t, err)
+	csr, err := x509.ParseCertificateRequest(der)
+	assert.FatalError(t, err)
+
+	tests := map[string]struct {
+		body       []byte
+		auth       *mockAdminAuthority
+		statusCode int
+		want       *CreateX509IssuerKeyResponse
+	}{
+		"fail/read.JSON": {
+			body:       []byte("{!?}"),
+			auth:       &mockAdminAuthority{},
+			statusCode: 400,
+		},
+		"fail/validate": {
+			body:       body(&CreateX509IssuerKeyRequest{SignatureAlgorithm: "ECDSA-SHA256"}),
+			auth:       &mockAdminAuthority{},
+			statusCode: 400,
+		},
+		"fail/auth.CreateX509IssuerKey": {
+			body: body(&CreateX509IssuerKeyRequest{Name: "cloudkms:key"}),
+			auth: &mockAdminAuthority{
+				MockCreateX509IssuerKey: func(ctx context.Context, req *kmsapi.CreateKeyRequest) (*kmsapi.CreateKeyResponse, *x509.CertificateRequest, error) {
+					return nil, nil, admin.NewError(admin.ErrorNotImplementedType, "the configured certificate authority service does not support issuer rotation")
+				},
+			},
+			statusCode: 501,
+		},
+		"ok": {
+			body: body(&CreateX509IssuerKeyRequest{Name: "cloudkms:key", SignatureAlgorithm: "ecdsa-sha256"}),
+			auth: &mockAdminAuthority{
+				MockCreateX509IssuerKey: func(ctx context.Context, req *kmsapi.CreateKeyRequest) (*kmsapi.CreateKeyResponse, *x509.CertificateRequest, error) {
+					assert.Equals(t, &kmsapi.CreateKeyRequest{
+						Name:               "cloudkms:key",
+						SignatureAlgorithm: kmsapi.ECDSAWithSHA256,
+					}, req)
+					return &kmsapi.CreateKeyResponse{
+						Name:      "cloudkms:key/cryptoKeyVersions/2",
+						PublicKey: key.Public(),
+					}, csr, nil
+				},
+			},
+			statusCode: 201,
+			want: &CreateX509IssuerKeyResponse{
+				Name: "cloudkms:key/cryptoKeyVersions/2",
+				CSR:  string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der})),
+			},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			mockMustAuthority(t, tc.auth)
+			req := httptest.NewRequest("POST", "/foo", io.NopCloser(bytes.NewBuffer(tc.body)))
+			w := httptest.NewRecorder()
+			CreateX509IssuerKey(w, req)
+			res := w.Result()
+			assert.Equals(t, tc.statusCode, res.StatusCode)
+			if tc.want != nil {
+				var got CreateX509IssuerKeyResponse
+				assert.FatalError(t, json.NewDecoder(res.Body).Decode(&got))
+				assert.Equals(t, tc.want, &got)
+			}
+		})
+	}
+}
+
+func TestHandler_RotateX509Issuer(t *testing.T) {
+	body := func(v any) []byte {
+		b, err := json.Marshal(v)
+		assert.FatalError(t, err)
+		return b
+	}
+
+	ca, err := minica.New()
+	assert.FatalError(t, err)
+	bundle := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Intermediate.Raw})) +
+		string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Root.Raw}))
+
+	tests := map[string]struct {
+		body       []byte
+		auth       *mockAdminAuthority
+		statusCode int
+	}{
+		"fail/read.JSON": {
+			body:       []byte("{!?}"),
+			auth:       &mockAdminAuthority{},
+			statusCode: 400,
+		},
+		"fail/validate": {
+			body:       body(&RotateX509IssuerRequest{Certificate: bundle}),
+			auth:       &mockAdminAuthority{},
+			statusCode: 400,
+		},
+		"fail/parse": {
+			body:       body(&RotateX509IssuerRequest{Certificate: "not a certificate", Key: "cloudkms:key"}),
+			auth:       &mockAdminAuthority{},
+			statusCode: 400,
+		},
+		"fail/auth.RotateX509Issuer": {
+			body: body(&RotateX509IssuerRequest{Certificate: bundle, Key: "cloudkms:key"}),
+			auth: &mockAdminAuthority{
+				MockRotateX509Issuer: func(ctx context.Context, chain []*x509.Certificate, key string) error {
+					return admin.NewError(admin.ErrorBadRequestType, "key does not match the certificate")
+				},
+			},
+			statusCode: 400,
+		},
+		"ok": {
+			body: body(&RotateX509IssuerRequest{Certificate: bundle, Key: "cloudkms:key"}),
+			auth: &mockAdminAuthority{
+				MockRotateX509Issuer: func(ctx context.Context, chain []*x509.Certificate, key string) error {
+					assert.Equals(t, []*x509.Certificate{ca.Intermediate, ca.Root}, chain)
+					assert.Equals(t, "cloudkms:key", key)
+					return nil
+				},
+			},
+			statusCode: 200,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			mockMustAuthority(t, tc.auth)
+			req := httptest.NewRequest("PUT", "/foo", io.NopCloser(bytes.NewBuffer(tc.body)))
+			w := httptest.NewRecorder()
+			RotateX509Issuer(w, req)
+			res := w.Result()
+			assert.Equals(t, tc.statusCode, res.StatusCode)
+		})
+	}
+}
+
+func TestRotateX509IssuerKeyRequest_Validate(t *testing.T) {
+	tests := map[string]struct {
+		req     *RotateX509IssuerKeyRequest
+		wantErr bool
+	}{
+		"ok":                {&RotateX509IssuerKeyRequest{RootKey: "cloudkms:root"}, false},
+		"ok/lifetime":       {&RotateX509IssuerKeyRequest{RootKey: "cloudkms:root", Lifetime: "8760h"}, false},
+		"fail/rootKey":      {&RotateX509IssuerKeyRequest{Lifetime: "8760h"}, true},
+		"fail/lifetime":     {&RotateX509IssuerKeyRequest{RootKey: "cloudkms:root", Lifetime: "1y"}, true},
+		"fail/lifetime-neg": {&RotateX509IssuerKeyRequest{RootKey: "cloudkms:root", Lifetime: "-1h"}, true},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := tc.req.Validate()
+			assert.Equals(t, tc.wantErr, err != nil)
+		})
+	}
+}
+
+func TestHandler_RotateX509IssuerKey(t *testing.T) {
+	body := func(v any) []byte {
+		b, err := json.Marshal(v)
+		assert.FatalError(t, err)
+		return b
+	}
+
+	ca, err := minica.New()
+	assert.FatalError(t, err)
+
+	tests := map[string]struct {
+		body       []byte
+		auth       *mockAdminAuthority
+		statusCode int
+		want       *RotateX509IssuerKeyResponse
+	}{
+		"fail/read.JSON": {
+			body:       []byte("{!?}"),
+			auth:       &mockAdminAuthority{},
+			statusCode: 400,
+		},
+		"fail/validate": {
+			body:       body(&RotateX509IssuerKeyRequest{Lifetime: "24h"}),
+			auth:       &mockAdminAuthority{},
+			statusCode: 400,
+		},
+		"fail/auth.RotateX509IssuerKey": {
+			body: body(&RotateX509IssuerKeyRequest{RootKey: "root.key"}),
+			auth: &mockAdminAuthority{
+				MockRotateX509IssuerKey: func(ctx context.Context, rootKey string, lifetime time.Duration) ([]*x509.Certificate, string, error) {
+					return nil, "", admin.NewError(admin.ErrorNotImplementedType, "the configured kms does not support key rotation")
+				},
+			},
+			statusCode: 501,
+		},
+		"ok": {
+			body: body(&RotateX509IssuerKeyRequest{RootKey: "cloudkms:root", Lifetime: "24h"}),
+			auth: &mockAdminAuthority{
+				MockRotateX509IssuerKey: func(ctx context.Context, rootKey string, lifetime time.Duration) ([]*x509.Certificate, string, error) {
+					assert.Equals(t, "cloudkms:root", rootKey)
+					assert.Equals(t, 24*time.Hour, lifetime)
+					return []*x509.Certificate{ca.Intermediate}, "cloudkms:intermediate", nil
+				},
+			},
+			statusCode: 200,
+			want: &RotateX509IssuerKeyResponse{
+				Key:         "cloudkms:intermediate",
+				Certificate: string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Intermediate.Raw})),
+			},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			mockMustAuthority(t, tc.auth)
+			req := httptest.NewRequest("POST", "/foo", io.NopCloser(bytes.NewBuffer(tc.body)))
+			w := httptest.NewRecorder()
+			RotateX509IssuerKey(w, req)
+			res := w.Result()
+			assert.Equals(t, tc.statusCode, res.StatusCode)
+			if tc.want != nil {
+				var got RotateX509IssuerKeyResponse
+				assert.FatalError(t, json.NewDecoder(res.Body).Decode(&got))
+				assert.Equals(t, tc.want, &got)
+			}
+		})
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"net/http"
 
+	"github.com/go-chi/chi/v5"
 	"go.step.sm/linkedca"
 
 	"github.com/smallstep/certificates/acme"
@@ -30,6 +31,10 @@ type PolicyAdminResponder interface {
 	CreateACMEAccountPolicy(w http.ResponseWriter, r *http.Request)
 	UpdateACMEAccountPolicy(w http.ResponseWriter, r *http.Request)
 	DeleteACMEAccountPolicy(w http.ResponseWriter, r *http.Request)
+	GetACMEAccountIDPolicy(w http.ResponseWriter, r *http.Request)
+	CreateACMEAccountIDPolicy(w http.ResponseWriter, r *http.Request)
+	UpdateACMEAccountIDPolicy(w http.ResponseWriter, r *http.Request)
+	DeleteACMEAccountIDPolicy(w http.ResponseWriter, r *http.Request)
 }
 
 // policyAdminResponder implements PolicyAdminResponder.
@@ -453,6 +458,140 @@ func (par *policyAdminResponder) DeleteACMEAccountPolicy(w http.ResponseWriter,
 	render.JSONStatus(w, r, DeleteResponse{Status: "ok"}, http.StatusOK)
 }
 
+// GetACMEAccountIDPolicy handles the GET /admin/acme/policy/{provisionerName}/account/{accountID} request
+func (par *policyAdminResponder) GetACMEAccountIDPolicy(w http.ResponseWriter, r *http.Request) {
+	if err := blockLinkedCA(r.Context()); err != nil {
+		render.Error(w, r, err)
+		return
+	}
+
+	prov := linkedca.MustProvisionerFromContext(r.Context())
+	acc, err := getACMEAccount(r, prov, chi.URLParam(r, "accountID"))
+	if err != nil {
+		render.Error(w, r, err)
+		return
+	}
+	if acc.Policy == nil {
+		render.Error(w, r, admin.NewError(admin.ErrorNotFoundType, "ACME account policy does not exist"))
+		return
+	}
+
+	render.ProtoJSONStatus(w, acmePolicyToLinked(acc.Policy), http.StatusOK)
+}
+
+// CreateACMEAccountIDPolicy handles the POST /admin/acme/policy/{provisionerName}/account/{accountID} request
+func (par *policyAdminResponder) CreateACMEAccountIDPolicy(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if err := blockLinkedCA(ctx); err != nil {
+		render.Error(w, r, err)
+		return
+	}
+
+	prov := linkedca.MustProvisionerFromContext(ctx)
+	acc, err := getACMEAccount(r, prov, chi.URLParam(r, "accountID"))
+	if err != nil {
+		render.Error(w, r, err)
+		return
+	}
+	if acc.Policy != nil {
+		render.Error(w, r, admin.NewError(admin.ErrorConflictType, "ACME account %s already has a policy", acc.ID))
+		return
+	}
+
+	newPolicy, err := readACMEAccountPolicy(r)
+	if err != nil {
+		render.Error(w, r, err)
+		return
+	}
+
+	acc.Policy = linkedPolicyToACME(newPolicy)
+	if err := acme.MustDatabaseFromContext(ctx).UpdateAccount(ctx, acc); err != nil {
+		render.Error(w, r, admin.WrapErrorISE(err, "error creating ACME account policy"))
+		return
+	}
+
+	render.ProtoJSONStatus(w, acmePolicyToLinked(acc.Policy), http.StatusCreated)
+}
+
+// UpdateACMEAccountIDPolicy handles the PUT /admin/acme/policy/{provisionerName}/account/{accountID} request
+func (par *policyAdminResponder) UpdateACMEAccountIDPolicy(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if err := blockLinkedCA(ctx); err != nil {
+		render.Error(w, r, err)
+		return
+	}
+
+	prov := linkedca.MustProvisionerFromContext(ctx)
+	acc, err := getACMEAccount(r, prov, chi.URLParam(r, "accountID"))
+	if err != nil {
+		render.Error(w, r, err)
+		return
+	}
+	if acc.Policy == nil {
+		render.Error(w, r, admin.NewError(admin.ErrorNotFoundType, "ACME account policy does not exist"))
+		return
+	}
+
+	newPolicy, err := readACMEAccountPolicy(r)
+	if err != nil {
+		render.Error(w, r, err)
+		return
+	}
+
+	acc.Policy = linkedPolicyToACME(newPolicy)
+	if err := acme.MustDatabaseFromContext(ctx).UpdateAccount(ctx, acc); err != nil {
+		render.Error(w, r, admin.WrapErrorISE(err, "error updating ACME account policy"))
+		return
+	}
+
+	render.ProtoJSONStatus(w, acmePolicyToLinked(acc.Policy), http.StatusOK)
+}
+
+// DeleteACMEAccountIDPolicy handles the DELETE /admin/acme/policy/{provisionerName}/account/{accountID} request
+func (par *policyAdminResponder) DeleteACMEAccountIDPolicy(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if err := blockLinkedCA(ctx); err != nil {
+		render.Error(w, r, err)
+		return
+	}
+
+	prov := linkedca.MustProvisionerFromContext(ctx)
+	acc, err := getACMEAccount(r, prov, chi.URLParam(r, "accountID"))
+	if err != nil {
+		render.Error(w, r, err)
+		return
+	}
+	if acc.Policy == nil {
+		render.Error(w, r, admin.NewError(admin.ErrorNotFoundType, "ACME account policy does not exist"))
+		return
+	}
+
+	// remove the policy
+	acc.Policy = nil
+	if err := acme.MustDatabaseFromContext(ctx).UpdateAccount(ctx, acc); err != nil {
+		render.Error(w, r, admin.WrapErrorISE(err, "error deleting ACME account policy"))
+		return
+	}
+
+	render.JSONStatus(w, r, DeleteResponse{Status: "ok"}, http.StatusOK)
+}
+
+// readACMEAccountPolicy reads and validates the policy in the body of an
+// ACME account policy request.
+func readACMEAccountPolicy(r *http.Request) (*linkedca.Policy, error) {
+	var newPolicy = new(linkedca.Policy)
+	if err := read.ProtoJSON(r.Body, newPolicy); err != nil {
+		return nil, err
+	}
+
+	newPolicy.Deduplicate()
+
+	if err := validatePolicy(newPolicy); err != nil {
+		return nil, admin.WrapError(admin.ErrorBadRequestType, err, "error validating ACME account policy")
+	}
+	return newPolicy, nil
+}
+
 // blockLinkedCA blocks all API operations on linked deployments
 func blockLinkedCA(ctx context.Context) error {
 	// temporary blocking linked deployments
@@ -11,6 +11,7 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/go-chi/chi/v5"
 	"github.com/stretchr/testify/assert"
 	"google.golang.org/protobuf/encoding/protojson"
 
@@ -2773,3 +2774,150 @@ func Test_validatePolicy(t *testing.T) {
 		})
 	}
 }
+
+func TestPolicyAdminResponder_ACMEAccountIDPolicy(t *testing.T) {
+	prov := &linkedca.Provisioner{
+		Id:   "provID",
+		Name: "provName",
+		Details: &linkedca.ProvisionerDetails{
+			Data: &linkedca.ProvisionerDetails_ACME{ACME: &linkedca.ACMEProvisioner{}},
+		},
+	}
+	accPolicy := &acme.Policy{
+		X509: acme.X509Policy{
+			Allowed: acme.PolicyNames{
+				DNSNames:   []string{"*.team.internal"},
+				URIDomains: []string{"*.team.internal"},
+			},
+		},
+	}
+	body := []byte(`{"x509": {"allow": {"dns": ["*.other.internal"], "uris": ["*.other.internal"]}}}`)
+	otherPolicy := &acme.Policy{
+		X509: acme.X509Policy{
+			Allowed: acme.PolicyNames{
+				DNSNames:   []string{"*.other.internal"},
+				URIDomains: []string{"*.other.internal"},
+			},
+		},
+	}
+
+	type test struct {
+		handler    func(par PolicyAdminResponder) http.HandlerFunc
+		policy     *acme.Policy
+		body       []byte
+		updateErr  error
+		statusCode int
+		wantUpdate bool
+		wantPolicy *acme.Policy
+		response   *testPolicyResponse
+	}
+	tests := map[string]test{
+		"ok/get": {
+			handler:    func(par PolicyAdminResponder) http.HandlerFunc { return par.GetACMEAccountIDPolicy },
+			policy:     accPolicy,
+			statusCode: 200,
+			response: &testPolicyResponse{X509: &testX509Policy{
+				Allow: &testX509Names{DNSDomains: []string{"*.team.internal"}, URIDomains: []string{"*.team.internal"}},
+				Deny:  &testX509Names{},
+			}},
+		},
+		"fail/get-not-found": {
+			handler:    func(par PolicyAdminResponder) http.HandlerFunc { return par.GetACMEAccountIDPolicy },
+			statusCode: 404,
+		},
+		"ok/create": {
+			handler:    func(par PolicyAdminResponder) http.HandlerFunc { return par.CreateACMEAccountIDPolicy },
+			body:       body,
+			statusCode: 201,
+			wantUpdate: true,
+			wantPolicy: otherPolicy,
+			response: &testPolicyResponse{X509: &testX509Policy{
+				Allow: &testX509Names{DNSDomains: []string{"*.other.internal"}, URIDomains: []string{"*.other.internal"}},
+				Deny:  &testX509Names{},
+			}},
+		},
+		"fail/create-existing": {
+			handler:    func(par PolicyAdminResponder) http.HandlerFunc { return par.CreateACMEAccountIDPolicy },
+			policy:     accPolicy,
+			body:       body,
+			statusCode: 409,
+		},
+		"fail/create-validate": {
+			handler:    func(par PolicyAdminResponder) http.HandlerFunc { return par.CreateACMEAccountIDPolicy },
+			body:       []byte(`{"x509": {"allow": {"uris": ["https://example.com"]}}}`),
+			statusCode: 400,
+		},
+		"fail/create-update-error": {
+			handler:    func(par PolicyAdminResponder) http.HandlerFunc { return par.CreateACMEAccountIDPolicy },
+			body:       body,
+			updateErr:  errors.New("force"),
+			statusCode: 500,
+			wantUpdate: true,
+			wantPolicy: otherPolicy,
+		},
+		"ok/update": {
+			handler:    func(par PolicyAdminResponder) http.HandlerFunc { return par.UpdateACMEAccountIDPolicy },
+			policy:     accPolicy,
+			body:       body,
+			statusCode: 200,
+			wantUpdate: true,
+			wantPolicy: otherPolicy,
+			response: &testPolicyResponse{X509: &testX509Policy{
+				Allow: &testX509Names{DNSDomains: []string{"*.other.internal"}, URIDomains: []string{"*.other.internal"}},
+				Deny:  &testX509Names{},
+			}},
+		},
+		"fail/update-not-found": {
+			handler:    func(par PolicyAdminResponder) http.HandlerFunc { return par.UpdateACMEAccountIDPolicy },
+			body:       body,
+			statusCode: 404,
+		},
+		"ok/delete": {
+			handler:    func(par PolicyAdminResponder) http.HandlerFunc { return par.DeleteACMEAccountIDPolicy },
+			policy:     accPolicy,
+			statusCode: 200,
+			wantUpdate: true,
+		},
+		"fail/delete-not-found": {
+			handler:    func(par PolicyAdminResponder) http.HandlerFunc { return par.DeleteACMEAccountIDPolicy },
+			statusCode: 404,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var updated bool
+			acmeDB := &acme.MockDB{
+				MockGetAccount: func(ctx context.Context, id string) (*acme.Account, error) {
+					assert.Equal(t, "accID", id)
+					return &acme.Account{ID: id, ProvisionerID: "provID", Policy: tc.policy}, nil
+				},
+				MockUpdateAccount: func(ctx context.Context, acc *acme.Account) error {
+					updated = true
+					assert.Equal(t, tc.wantPolicy, acc.Policy)
+					return tc.updateErr
+				},
+			}
+
+			chiCtx := chi.NewRouteContext()
+			chiCtx.URLParams.Add("accountID", "accID")
+			ctx := context.WithValue(context.Background(), chi.RouteCtxKey, chiCtx)
+			ctx = linkedca.NewContextWithProvisioner(ctx, prov)
+			ctx = admin.NewContext(ctx, &admin.MockDB{})
+			ctx = acme.NewDatabaseContext(ctx, acmeDB)
+
+			req := httptest.NewRequest("POST", "/foo", io.NopCloser(bytes.NewBuffer(tc.body)))
+			w := httptest.NewRecorder()
+			tc.handler(NewPolicyAdminResponder())(w, req.WithContext(ctx))
+			res := w.Result()
+			defer res.Body.Close()
+
+			assert.Equal(t, tc.statusCode, res.StatusCode)
+			assert.Equal(t, tc.wantUpdate, updated)
+			if tc.response != nil {
+				p := &testPolicyResponse{}
+				assert.NoError(t, json.NewDecoder(res.Body).Decode(p))
+				assert.Equal(t, tc.response, p)
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"go.step.sm/crypto/jose"
+
+	"github.com/smallstep/certificates/api/read"
+	"github.com/smallstep/certificates/api/render"
+	"github.com/smallstep/certificates/authority/admin"
+)
+
+// ProvisionerKeysResponse is the type for GetProvisionerKeys,
+// CreateProvisionerKey and DeleteProvisionerKey responses. The first key is
+// the main key of the provisioner.
+type ProvisionerKeysResponse struct {
+	Keys []*jose.JSONWebKey `json:"keys"`
+}
+
+// CreateProvisionerKeyRequest represents the body for a CreateProvisionerKey
+// request.
+type CreateProvisionerKeyRequest struct {
+	Key *jose.JSONWebKey `json:"key"`
+	// EncryptedKey is the JWE encrypted private key, it is only used if the
+	// key becomes the main key of the provisioner.
+	EncryptedKey string `json:"encryptedKey,omitempty"`
+	// Primary makes the key the main key of the provisioner, the previous
+	// main key is kept as an additional key.
+	Primary bool `json:"primary,omitempty"`
+}
+
+// Validate validates a new-provisioner-key request body.
+func (r *CreateProvisionerKeyRequest) Validate() error {
+	switch {
+	case r.Key == nil:
+		return admin.NewError(admin.ErrorBadRequestType, "key cannot be empty")
+	case r.Key.KeyID == "":
+		return admin.NewError(admin.ErrorBadRequestType, "key id cannot be empty")
+	case !r.Key.IsPublic():
+		return admin.NewError(admin.ErrorBadRequestType, "key must be a public key")
+	case r.EncryptedKey != "" && !r.Primary:
+		return admin.NewError(admin.ErrorBadRequestType, "encryptedKey can only be set on primary keys")
+	case r.EncryptedKey == "" && r.Primary:
+		return admin.NewError(admin.ErrorBadRequestType, "encryptedKey cannot be empty on primary keys")
+	}
+	return nil
+}
+
+// GetProvisionerKeys returns the public keys of a JWK provisioner.
+func GetProvisionerKeys(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	name := chi.URLParam(r, "name")
+	auth := mustAuthority(ctx)
+
+	p, err := auth.LoadProvisionerByName(name)
+	if err != nil {
+		render.Error(w, r, admin.WrapError(admin.ErrorNotFoundType, err, "provisioner %s not found", name))
+		return
+	}
+
+	keys, err := auth.GetProvisionerKeys(ctx, p)
+	if err != nil {
+		render.Error(w, r, err)
+		return
+	}
+	render.JSON(w, r, &ProvisionerKeysResponse{Keys: keys})
+}
+
+// CreateProvisionerKey adds a key to a JWK provisioner. It allows to roll the
+// keys of a provisioner without changing its name.
+func CreateProvisionerKey(w http.ResponseWriter, r *http.Request) {
+	var body CreateProvisionerKeyRequest
+	if err := read.JSON(r.Body, &body); err != nil {
+		render.Error(w, r, admin.WrapError(admin.ErrorBadRequestType, err, "error reading request body"))
+		return
+	}
+
+	if err := body.Validate(); err != nil {
+		render.Error(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	name := chi.URLParam(r, "name")
+	auth := mustAuthority(ctx)
+
+	p, err := auth.LoadProvisionerByName(name)
+	if err != nil {
+		render.Error(w, r, admin.WrapError(admin.ErrorNotFoundType, err, "provisioner %s not found", name))
+		return
+	}
+
+	keys, err := auth.AddProvisionerKey(ctx, p, body.Key, body.EncryptedKey, body.Primary)
+	if err != nil {
+		render.Error(w, r, err)
+		return
+	}
+	render.JSONStatus(w, r, &ProvisionerKeysResponse{Keys: keys}, http.StatusCreated)
+}
+
+// DeleteProvisionerKey retires an additional key of a JWK provisioner.
+func DeleteProvisionerKey(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	name := chi.URLParam(r, "name")
+	kid := chi.URLParam(r, "kid")
+	auth := mustAuthority(ctx)
+
+	p, err := auth.LoadProvisionerByName(name)
+	if err != nil {
+		render.Error(w, r, admin.WrapError(admin.ErrorNotFoundType, err, "provisioner %s not found", name))
+		return
+	}
+
+	keys, err := auth.RemoveProvisionerKey(ctx, p, kid)
+	if err != nil {
+		render.Error(w, r, err)
+		return
+	}
+	render.JSON(w, r, &ProvisionerKeysResponse{Keys: keys})
+}
@@ -0,0 +1,235 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"go.step.sm/crypto/jose"
+
+	"github.com/smallstep/assert"
+	"github.com/smallstep/certificates/authority/admin"
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+func provisionerKeyContext(name, kid string) context.Context {
+	chiCtx := chi.NewRouteContext()
+	chiCtx.URLParams.Add("name", name)
+	if kid != "" {
+		chiCtx.URLParams.Add("kid", kid)
+	}
+	return context.WithValue(context.Background(), chi.RouteCtxKey, chiCtx)
+}
+
+func provisionerKeyLoadProvisioner(name string) (provisioner.Interface, error) {
+	if name == "jwk" {
+		return &provisioner.JWK{Name: "jwk", Type: "JWK"}, nil
+	}
+	return nil, admin.NewError(admin.ErrorNotFoundType, "provisioner %s not found", name)
+}
+
+func TestHandler_GetProvisionerKeys(t *testing.T) {
+	newKey := func(kid string) *jose.JSONWebKey {
+		key, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", kid, 0)
+		assert.FatalError(t, err)
+		pub := key.Public()
+		return &pub
+	}
+
+	tests := map[string]struct {
+		ctx        context.Context
+		auth       *mockAdminAuthority
+		statusCode int
+		keys       []string
+	}{
+		"fail/not-found": {
+			ctx:        provisionerKeyContext("foo", ""),
+			auth:       &mockAdminAuthority{MockLoadProvisionerByName: provisionerKeyLoadProvisioner},
+			statusCode: 404,
+		},
+		"fail/auth.GetProvisionerKeys": {
+			ctx: provisionerKeyContext("jwk", ""),
+			auth: &mockAdminAuthority{
+				MockLoadProvisionerByName: provisionerKeyLoadProvisioner,
+				MockGetProvisionerKeys: func(ctx context.Context, prov provisioner.Interface) ([]*jose.JSONWebKey, error) {
+					return nil, admin.NewError(admin.ErrorNotImplementedType, "not implemented")
+				},
+			},
+			statusCode: 501,
+		},
+		"ok": {
+			ctx: provisionerKeyContext("jwk", ""),
+			auth: &mockAdminAuthority{
+				MockLoadProvisionerByName: provisionerKeyLoadProvisioner,
+				MockGetProvisionerKeys: func(ctx context.Context, prov provisioner.Interface) ([]*jose.JSONWebKey, error) {
+					assert.Equals(t, "jwk", prov.GetName())
+					return []*jose.JSONWebKey{newKey("main"), newKey("next")}, nil
+				},
+			},
+			statusCode: 200,
+			keys:       []string{"main", "next"},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			mockMustAuthority(t, tc.auth)
+			req := httptest.NewRequest("GET", "/foo", http.NoBody).WithContext(tc.ctx)
+			w := httptest.NewRecorder()
+			GetProvisionerKeys(w, req)
+			res := w.Result()
+			assert.Equals(t, tc.statusCode, res.StatusCode)
+			if res.StatusCode < 400 {
+				var resp struct {
+					Keys []struct {
+						KeyID string `json:"kid"`
+					} `json:"keys"`
+				}
+				assert.FatalError(t, json.NewDecoder(res.Body).Decode(&resp))
+				var kids []string
+				for _, k := range resp.Keys {
+					kids = append(kids, k.KeyID)
+				}
+				assert.Equals(t, tc.keys, kids)
+			}
+		})
+	}
+}
+
+func TestHandler_CreateProvisionerKey(t *testing.T) {
+	key, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+	assert.FatalError(t, err)
+	pub := key.Public()
+	body := func(v any) []byte {
+		b, err := json.Marshal(v)
+		assert.FatalError(t, err)
+		return b
+	}
+
+	tests := map[string]struct {
+		ctx        context.Context
+		body       []byte
+		auth       *mockAdminAuthority
+		statusCode int
+	}{
+		"fail/read.JSON": {
+			ctx:        provisionerKeyContext("jwk", ""),
+			body:       []byte("{!?}"),
+			auth:       &mockAdminAuthority{},
+			statusCode: 400,
+		},
+		"fail/validate-empty": {
+			ctx:        provisionerKeyContext("jwk", ""),
+			body:       body(&CreateProvisionerKeyRequest{}),
+			auth:       &mockAdminAuthority{},
+			statusCode: 400,
+		},
+		"fail/validate-private": {
+			ctx:        provisionerKeyContext("jwk", ""),
+			body:       body(&CreateProvisionerKeyRequest{Key: key}),
+			auth:       &mockAdminAuthority{},
+			statusCode: 400,
+		},
+		"fail/validate-encrypted-key": {
+			ctx:        provisionerKeyContext("jwk", ""),
+			body:       body(&CreateProvisionerKeyRequest{Key: &pub, EncryptedKey: "foo"}),
+			auth:       &mockAdminAuthority{},
+			statusCode: 400,
+		},
+		"fail/validate-primary": {
+			ctx:        provisionerKeyContext("jwk", ""),
+			body:       body(&CreateProvisionerKeyRequest{Key: &pub, Primary: true}),
+			auth:       &mockAdminAuthority{},
+			statusCode: 400,
+		},
+		"fail/not-found": {
+			ctx:        provisionerKeyContext("foo", ""),
+			body:       body(&CreateProvisionerKeyRequest{Key: &pub}),
+			auth:       &mockAdminAuthority{MockLoadProvisionerByName: provisionerKeyLoadProvisioner},
+			statusCode: 404,
+		},
+		"fail/auth.AddProvisionerKey": {
+			ctx:  provisionerKeyContext("jwk", ""),
+			body: body(&CreateProvisionerKeyRequest{Key: &pub}),
+			auth: &mockAdminAuthority{
+				MockLoadProvisionerByName: provisionerKeyLoadProvisioner,
+				MockAddProvisionerKey: func(ctx context.Context, prov provisioner.Interface, key *jose.JSONWebKey, encryptedKey string, primary bool) ([]*jose.JSONWebKey, error) {
+					return nil, admin.NewError(admin.ErrorBadRequestType, "key already exists")
+				},
+			},
+			statusCode: 400,
+		},
+		"ok": {
+			ctx:  provisionerKeyContext("jwk", ""),
+			body: body(&CreateProvisionerKeyRequest{Key: &pub, EncryptedKey: "foo", Primary: true}),
+			auth: &mockAdminAuthority{
+				MockLoadProvisionerByName: provisionerKeyLoadProvisioner,
+				MockAddProvisionerKey: func(ctx context.Context, prov provisioner.Interface, key *jose.JSONWebKey, encryptedKey string, primary bool) ([]*jose.JSONWebKey, error) {
+					assert.Equals(t, "jwk", prov.GetName())
+					assert.Equals(t, pub.KeyID, key.KeyID)
+					assert.Equals(t, "foo", encryptedKey)
+					assert.True(t, primary)
+					return []*jose.JSONWebKey{&pub}, nil
+				},
+			},
+			statusCode: 201,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			mockMustAuthority(t, tc.auth)
+			req := httptest.NewRequest("POST", "/foo", bytes.NewReader(tc.body)).WithContext(tc.ctx)
+			w := httptest.NewRecorder()
+			CreateProvisionerKey(w, req)
+			assert.Equals(t, tc.statusCode, w.Result().StatusCode)
+		})
+	}
+}
+
+func TestHandler_DeleteProvisionerKey(t *testing.T) {
+	tests := map[string]struct {
+		ctx        context.Context
+		auth       *mockAdminAuthority
+		statusCode int
+	}{
+		"fail/not-found": {
+			ctx:        provisionerKeyContext("foo", "kid"),
+			auth:       &mockAdminAuthority{MockLoadProvisionerByName: provisionerKeyLoadProvisioner},
+			statusCode: 404,
+		},
+		"fail/auth.RemoveProvisionerKey": {
+			ctx: provisionerKeyContext("jwk", "kid"),
+			auth: &mockAdminAuthority{
+				MockLoadProvisionerByName: provisionerKeyLoadProvisioner,
+				MockRemoveProvisionerKey: func(ctx context.Context, prov provisioner.Interface, kid string) ([]*jose.JSONWebKey, error) {
+					return nil, admin.NewError(admin.ErrorNotFoundType, "key %s not found", kid)
+				},
+			},
+			statusCode: 404,
+		},
+		"ok": {
+			ctx: provisionerKeyContext("jwk", "kid"),
+			auth: &mockAdminAuthority{
+				MockLoadProvisionerByName: provisionerKeyLoadProvisioner,
+				MockRemoveProvisionerKey: func(ctx context.Context, prov provisioner.Interface, kid string) ([]*jose.JSONWebKey, error) {
+					assert.Equals(t, "jwk", prov.GetName())
+					assert.Equals(t, "kid", kid)
+					return []*jose.JSONWebKey{}, nil
+				},
+			},
+			statusCode: 200,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			mockMustAuthority(t, tc.auth)
+			req := httptest.NewRequest("DELETE", "/foo", http.NoBody).WithContext(tc.ctx)
+			w := httptest.NewRecorder()
+			DeleteProvisionerKey(w, req)
+			assert.Equals(t, tc.statusCode, w.Result().StatusCode)
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/smallstep/certificates/api/read"
+	"github.com/smallstep/certificates/api/render"
+	"github.com/smallstep/certificates/authority/admin"
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+// ProvisionerStateResponse is the type for GetProvisionerState and
+// UpdateProvisionerState responses.
+type ProvisionerStateResponse struct {
+	State provisioner.State `json:"state"`
+}
+
+// UpdateProvisionerStateRequest represents the body for an
+// UpdateProvisionerState request.
+type UpdateProvisionerStateRequest struct {
+	State provisioner.State `json:"state"`
+}
+
+// Validate validates an update-provisioner-state request body.
+func (r *UpdateProvisionerStateRequest) Validate() error {
+	if r.State == "" {
+		return admin.NewError(admin.ErrorBadRequestType, "state cannot be empty")
+	}
+	if err := r.State.Validate(); err != nil {
+		return admin.WrapError(admin.ErrorBadRequestType, err, "invalid state")
+	}
+	return nil
+}
+
+// GetProvisionerState returns the lifecycle state of a provisioner.
+func GetProvisionerState(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	name := chi.URLParam(r, "name")
+	auth := mustAuthority(ctx)
+
+	p, err := auth.LoadProvisionerByName(name)
+	if err != nil {
+		render.Error(w, r, admin.WrapError(admin.ErrorNotFoundType, err, "provisioner %s not found", name))
+		return
+	}
+
+	state, err := auth.GetProvisionerState(ctx, p)
+	if err != nil {
+		render.Error(w, r, err)
+		return
+	}
+	render.JSON(w, r, &ProvisionerStateResponse{State: state})
+}
+
+// UpdateProvisionerState sets the lifecycle state of a provisioner. It allows
+// to drain a provisioner, first with the renew-only state and then with the
+// disabled one, before removing it.
+func UpdateProvisionerState(w http.ResponseWriter, r *http.Request) {
+	var body UpdateProvisionerStateRequest
+	if err := read.JSON(r.Body, &body); err != nil {
+		render.Error(w, r, admin.WrapError(admin.ErrorBadRequestType, err, "error reading request body"))
+		return
+	}
+
+	if err := body.Validate(); err != nil {
+		render.Error(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	name := chi.URLParam(r, "name")
+	auth := mustAuthority(ctx)
+
+	p, err := auth.LoadProvisionerByName(name)
+	if err != nil {
+		render.Error(w, r, admin.WrapError(admin.ErrorNotFoundType, err, "provisioner %s not found", name))
+		return
+	}
+
+	if err := auth.UpdateProvisionerState(ctx, p, body.State); err != nil {
+		render.Error(w, r, err)
+		return
+	}
+	render.JSON(w, r, &ProvisionerStateResponse{State: body.State})
+}
@@ -0,0 +1,138 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/smallstep/assert"
+	"github.com/smallstep/certificates/authority/admin"
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+func TestHandler_GetProvisionerState(t *testing.T) {
+	tests := map[string]struct {
+		ctx        context.Context
+		auth       *mockAdminAuthority
+		statusCode int
+		state      provisioner.State
+	}{
+		"fail/not-found": {
+			ctx:        provisionerKeyContext("foo", ""),
+			auth:       &mockAdminAuthority{MockLoadProvisionerByName: provisionerKeyLoadProvisioner},
+			statusCode: 404,
+		},
+		"fail/auth.GetProvisionerState": {
+			ctx: provisionerKeyContext("jwk", ""),
+			auth: &mockAdminAuthority{
+				MockLoadProvisionerByName: provisionerKeyLoadProvisioner,
+				MockGetProvisionerState: func(ctx context.Context, prov provisioner.Interface) (provisioner.State, error) {
+					return "", admin.NewError(admin.ErrorNotImplementedType, "not implemented")
+				},
+			},
+			statusCode: 501,
+		},
+		"ok": {
+			ctx: provisionerKeyContext("jwk", ""),
+			auth: &mockAdminAuthority{
+				MockLoadProvisionerByName: provisionerKeyLoadProvisioner,
+				MockGetProvisionerState: func(ctx context.Context, prov provisioner.Interface) (provisioner.State, error) {
+					assert.Equals(t, "jwk", prov.GetName())
+					return provisioner.StateRenewOnly, nil
+				},
+			},
+			statusCode: 200,
+			state:      provisioner.StateRenewOnly,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			mockMustAuthority(t, tc.auth)
+			req := httptest.NewRequest("GET", "/foo", http.NoBody).WithContext(tc.ctx)
+			w := httptest.NewRecorder()
+			GetProvisionerState(w, req)
+			assert.Equals(t, tc.statusCode, w.Result().StatusCode)
+			if tc.statusCode == 200 {
+				var resp ProvisionerStateResponse
+				assert.FatalError(t, json.NewDecoder(w.Body).Decode(&resp))
+				assert.Equals(t, tc.state, resp.State)
+			}
+		})
+	}
+}
+
+func TestHandler_UpdateProvisionerState(t *testing.T) {
+	body := func(v any) []byte {
+		b, err := json.Marshal(v)
+		assert.FatalError(t, err)
+		return b
+	}
+
+	tests := map[string]struct {
+		ctx        context.Context
+		body       []byte
+		auth       *mockAdminAuthority
+		statusCode int
+	}{
+		"fail/read.JSON": {
+			ctx:        provisionerKeyContext("jwk", ""),
+			body:       []byte("{!?}"),
+			auth:       &mockAdminAuthority{},
+			statusCode: 400,
+		},
+		"fail/validate-empty": {
+			ctx:        provisionerKeyContext("jwk", ""),
+			body:       body(&UpdateProvisionerStateRequest{}),
+			auth:       &mockAdminAuthority{},
+			statusCode: 400,
+		},
+		"fail/validate-state": {
+			ctx:        provisionerKeyContext("jwk", ""),
+			body:       body(&UpdateProvisionerStateRequest{State: "draining"}),
+			auth:       &mockAdminAuthority{},
+			statusCode: 400,
+		},
+		"fail/not-found": {
+			ctx:        provisionerKeyContext("foo", ""),
+			body:       body(&UpdateProvisionerStateRequest{State: provisioner.StateDisabled}),
+			auth:       &mockAdminAuthority{MockLoadProvisionerByName: provisionerKeyLoadProvisioner},
+			statusCode: 404,
+		},
+		"fail/auth.UpdateProvisionerState": {
+			ctx:  provisionerKeyContext("jwk", ""),
+			body: body(&UpdateProvisionerStateRequest{State: provisioner.StateDisabled}),
+			auth: &mockAdminAuthority{
+				MockLoadProvisionerByName: provisionerKeyLoadProvisioner,
+				MockUpdateProvisionerState: func(ctx context.Context, prov provisioner.Interface, state provisioner.State) error {
+					return admin.NewErrorISE("force")
+				},
+			},
+			statusCode: 500,
+		},
+		"ok": {
+			ctx:  provisionerKeyContext("jwk", ""),
+			body: body(&UpdateProvisionerStateRequest{State: provisioner.StateRenewOnly}),
+			auth: &mockAdminAuthority{
+				MockLoadProvisionerByName: provisionerKeyLoadProvisioner,
+				MockUpdateProvisionerState: func(ctx context.Context, prov provisioner.Interface, state provisioner.State) error {
+					assert.Equals(t, "jwk", prov.GetName())
+					assert.Equals(t, provisioner.StateRenewOnly, state)
+					return nil
+				},
+			},
+			statusCode: 200,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			mockMustAuthority(t, tc.auth)
+			req := httptest.NewRequest("PUT", "/foo", bytes.NewReader(tc.body)).WithContext(tc.ctx)
+			w := httptest.NewRecorder()
+			UpdateProvisionerState(w, req)
+			assert.Equals(t, tc.statusCode, w.Result().StatusCode)
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/smallstep/certificates/api/read"
+	"github.com/smallstep/certificates/api/render"
+	"github.com/smallstep/certificates/authority/admin"
+	"github.com/smallstep/certificates/db"
+)
+
+// UpdateRenewalPolicyRequest represents the body for an UpdateRenewalPolicy
+// request.
+type UpdateRenewalPolicyRequest struct {
+	// Action is the action taken on renewals after the provisioner is
+	// deleted, "deny", "sunset" or "migrate".
+	Action db.RenewalPolicyAction `json:"action"`
+	// SunsetAt is the time when renewals stop being allowed with the sunset
+	// action.
+	SunsetAt time.Time `json:"sunsetAt,omitempty"`
+	// MigrateTo is the name of the provisioner used to renew the certificates
+	// with the migrate action.
+	MigrateTo string `json:"migrateTo,omitempty"`
+}
+
+// GetRenewalPoliciesResponse is the type for GET /admin/renewal-policies
+// responses.
+type GetRenewalPoliciesResponse struct {
+	Policies []*db.RenewalPolicy `json:"policies"`
+}
+
+// GetRenewalPolicies returns the renewal policies of the deleted
+// provisioners.
+func GetRenewalPolicies(w http.ResponseWriter, r *http.Request) {
+	policies, err := mustAuthority(r.Context()).GetRenewalPolicies(r.Context())
+	if err != nil {
+		render.Error(w, r, err)
+		return
+	}
+	render.JSON(w, r, &GetRenewalPoliciesResponse{Policies: policies})
+}
+
+// GetRenewalPolicy returns the renewal policy of a provisioner.
+func GetRenewalPolicy(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "provisionerName")
+	policy, err := mustAuthority(r.Context()).GetRenewalPolicy(r.Context(), name)
+	if err != nil {
+		render.Error(w, r, err)
+		return
+	}
+	render.JSON(w, r, policy)
+}
+
+// UpdateRenewalPolicy creates or replaces the renewal policy of a
+// provisioner. The policy defines how the certificates signed by the
+// provisioner are renewed once the provisioner is deleted.
+func UpdateRenewalPolicy(w http.ResponseWriter, r *http.Request) {
+	var body UpdateRenewalPolicyRequest
+	if err := read.JSON(r.Body, &body); err != nil {
+		render.Error(w, r, admin.WrapError(admin.ErrorBadRequestType, err, "error reading request body"))
+		return
+	}
+
+	policy := &db.RenewalPolicy{
+		Provisioner: chi.URLParam(r, "provisionerName"),
+		Action:      body.Action,
+		SunsetAt:    body.SunsetAt,
+		MigrateTo:   body.MigrateTo,
+	}
+	if err := policy.Validate(); err != nil {
+		render.Error(w, r, admin.WrapError(admin.ErrorBadRequestType, err, "invalid renewal policy"))
+		return
+	}
+
+	if err := mustAuthority(r.Context()).StoreRenewalPolicy(r.Context(), policy); err != nil {
+		render.Error(w, r, err)
+		return
+	}
+
+	render.JSON(w, r, policy)
+}
+
+// DeleteRenewalPolicy deletes the renewal policy of a provisioner.
+func DeleteRenewalPolicy(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "provisionerName")
+	if err := mustAuthority(r.Context()).RemoveRenewalPolicy(r.Context(), name); err != nil {
+		render.Error(w, r, err)
+		return
+	}
+	render.JSON(w, r, &DeleteResponse{Status: "ok"})
+}
@@ -0,0 +1,191 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/smallstep/assert"
+	"github.com/smallstep/certificates/authority/admin"
+	"github.com/smallstep/certificates/db"
+)
+
+func newRenewalPolicyRequest(method string, body []byte) *http.Request {
+	chiCtx := chi.NewRouteContext()
+	chiCtx.URLParams.Add("provisionerName", "deleted")
+	ctx := context.WithValue(context.Background(), chi.RouteCtxKey, chiCtx)
+	return httptest.NewRequest(method, "/foo", io.NopCloser(bytes.NewBuffer(body))).WithContext(ctx)
+}
+
+func TestHandler_GetRenewalPolicies(t *testing.T) {
+	policy := &db.RenewalPolicy{Provisioner: "deleted", Action: db.RenewalPolicyDeny}
+	tests := map[string]struct {
+		auth       *mockAdminAuthority
+		statusCode int
+		want       *GetRenewalPoliciesResponse
+	}{
+		"fail": {
+			auth:       &mockAdminAuthority{MockErr: admin.NewError(admin.ErrorNotImplementedType, "not implemented")},
+			statusCode: 501,
+		},
+		"ok": {
+			auth: &mockAdminAuthority{
+				MockGetRenewalPolicies: func(ctx context.Context) ([]*db.RenewalPolicy, error) {
+					return []*db.RenewalPolicy{policy}, nil
+				},
+			},
+			statusCode: 200,
+			want:       &GetRenewalPoliciesResponse{Policies: []*db.RenewalPolicy{policy}},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			mockMustAuthority(t, tc.auth)
+			w := httptest.NewRecorder()
+			GetRenewalPolicies(w, newRenewalPolicyRequest("GET", nil))
+			res := w.Result()
+			assert.Equals(t, tc.statusCode, res.StatusCode)
+			if tc.want != nil {
+				var got GetRenewalPoliciesResponse
+				assert.FatalError(t, json.NewDecoder(res.Body).Decode(&got))
+				assert.Equals(t, tc.want, &got)
+			}
+		})
+	}
+}
+
+func TestHandler_GetRenewalPolicy(t *testing.T) {
+	policy := &db.RenewalPolicy{Provisioner: "deleted", Action: db.RenewalPolicyMigrate, MigrateTo: "new"}
+	tests := map[string]struct {
+		auth       *mockAdminAuthority
+		statusCode int
+		want       *db.RenewalPolicy
+	}{
+		"fail/not-found": {
+			auth:       &mockAdminAuthority{MockErr: admin.NewError(admin.ErrorNotFoundType, "renewal policy for provisioner deleted not found")},
+			statusCode: 404,
+		},
+		"ok": {
+			auth: &mockAdminAuthority{
+				MockGetRenewalPolicy: func(ctx context.Context, name string) (*db.RenewalPolicy, error) {
+					assert.Equals(t, "deleted", name)
+					return policy, nil
+				},
+			},
+			statusCode: 200,
+			want:       policy,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			mockMustAuthority(t, tc.auth)
+			w := httptest.NewRecorder()
+			GetRenewalPolicy(w, newRenewalPolicyRequest("GET", nil))
+			res := w.Result()
+			assert.Equals(t, tc.statusCode, res.StatusCode)
+			if tc.want != nil {
+				var got db.RenewalPolicy
+				assert.FatalError(t, json.NewDecoder(res.Body).Decode(&got))
+				assert.Equals(t, tc.want, &got)
+			}
+		})
+	}
+}
+
+func TestHandler_UpdateRenewalPolicy(t *testing.T) {
+	body := func(v any) []byte {
+		b, err := json.Marshal(v)
+		assert.FatalError(t, err)
+		return b
+	}
+
+	sunsetAt := time.Now().UTC().Add(24 * time.Hour).Truncate(time.Second)
+	tests := map[string]struct {
+		body       []byte
+		auth       *mockAdminAuthority
+		statusCode int
+		want       *db.RenewalPolicy
+	}{
+		"fail/read.JSON": {
+			body:       []byte("{!?}"),
+			auth:       &mockAdminAuthority{},
+			statusCode: 400,
+		},
+		"fail/validate": {
+			body:       body(&UpdateRenewalPolicyRequest{Action: db.RenewalPolicySunset}),
+			auth:       &mockAdminAuthority{},
+			statusCode: 400,
+		},
+		"fail/auth.StoreRenewalPolicy": {
+			body: body(&UpdateRenewalPolicyRequest{Action: db.RenewalPolicyMigrate, MigrateTo: "missing"}),
+			auth: &mockAdminAuthority{
+				MockStoreRenewalPolicy: func(ctx context.Context, policy *db.RenewalPolicy) error {
+					return admin.NewError(admin.ErrorBadRequestType, "provisioner missing not found")
+				},
+			},
+			statusCode: 400,
+		},
+		"ok": {
+			body: body(&UpdateRenewalPolicyRequest{Action: db.RenewalPolicySunset, SunsetAt: sunsetAt}),
+			auth: &mockAdminAuthority{
+				MockStoreRenewalPolicy: func(ctx context.Context, policy *db.RenewalPolicy) error {
+					assert.Equals(t, &db.RenewalPolicy{Provisioner: "deleted", Action: db.RenewalPolicySunset, SunsetAt: sunsetAt}, policy)
+					return nil
+				},
+			},
+			statusCode: 200,
+			want:       &db.RenewalPolicy{Provisioner: "deleted", Action: db.RenewalPolicySunset, SunsetAt: sunsetAt},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			mockMustAuthority(t, tc.auth)
+			w := httptest.NewRecorder()
+			UpdateRenewalPolicy(w, newRenewalPolicyRequest("PUT", tc.body))
+			res := w.Result()
+			assert.Equals(t, tc.statusCode, res.StatusCode)
+			if tc.want != nil {
+				var got db.RenewalPolicy
+				assert.FatalError(t, json.NewDecoder(res.Body).Decode(&got))
+				assert.Equals(t, tc.want, &got)
+			}
+		})
+	}
+}
+
+func TestHandler_DeleteRenewalPolicy(t *testing.T) {
+	tests := map[string]struct {
+		auth       *mockAdminAuthority
+		statusCode int
+	}{
+		"fail": {
+			auth:       &mockAdminAuthority{MockErr: admin.NewErrorISE("force")},
+			statusCode: 500,
+		},
+		"ok": {
+			auth: &mockAdminAuthority{
+				MockRemoveRenewalPolicy: func(ctx context.Context, name string) error {
+					assert.Equals(t, "deleted", name)
+					return nil
+				},
+			},
+			statusCode: 200,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			mockMustAuthority(t, tc.auth)
+			w := httptest.NewRecorder()
+			DeleteRenewalPolicy(w, newRenewalPolicyRequest("DELETE", nil))
+			res := w.Result()
+			assert.Equals(t, tc.statusCode, res.StatusCode)
+		})
+	}
+}
@@ -0,0 +1,139 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/smallstep/certificates/api/read"
+	"github.com/smallstep/certificates/api/render"
+	"github.com/smallstep/certificates/authority/admin"
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+// CreateSCEPChallengeRequest represents the body for a CreateSCEPChallenge
+// request.
+type CreateSCEPChallengeRequest struct {
+	// TTL is the lifetime of the challenge, e.g., "30m". It defaults to the
+	// ttl configured in the provisioner.
+	TTL string `json:"ttl,omitempty"`
+}
+
+// Validate validates a new-scep-challenge request body.
+func (r *CreateSCEPChallengeRequest) Validate() error {
+	if r.TTL != "" {
+		d, err := time.ParseDuration(r.TTL)
+		if err != nil {
+			return admin.WrapError(admin.ErrorBadRequestType, err, "ttl %s is not valid", r.TTL)
+		}
+		if d <= 0 {
+			return admin.NewError(admin.ErrorBadRequestType, "ttl must be positive")
+		}
+	}
+	return nil
+}
+
+// CreateSCEPChallengeResponse is the type for POST
+// /admin/provisioners/{provisionerName}/scep/challenges responses. It
+// contains the challenge password, which cannot be retrieved again.
+type CreateSCEPChallengeResponse struct {
+	*provisioner.SCEPDynamicChallenge
+	Challenge string `json:"challenge"`
+}
+
+// GetSCEPChallengesResponse is the type for GET
+// /admin/provisioners/{provisionerName}/scep/challenges responses.
+type GetSCEPChallengesResponse struct {
+	Challenges []*provisioner.SCEPDynamicChallenge `json:"challenges"`
+}
+
+// loadSCEPProvisioner returns the SCEP provisioner in the request path.
+func loadSCEPProvisioner(r *http.Request) (provisioner.Interface, error) {
+	name := chi.URLParam(r, "provisionerName")
+	p, err := mustAuthority(r.Context()).LoadProvisionerByName(name)
+	if err != nil {
+		return nil, admin.WrapError(admin.ErrorNotFoundType, err, "provisioner %s not found", name)
+	}
+	if p.GetType() != provisioner.TypeSCEP {
+		return nil, admin.NewError(admin.ErrorBadRequestType, "provisioner %s is not a scep provisioner", name)
+	}
+	return p, nil
+}
+
+// GetSCEPChallenges returns the dynamic challenges of a SCEP provisioner.
+// The challenge passwords are not included.
+func GetSCEPChallenges(w http.ResponseWriter, r *http.Request) {
+	p, err := loadSCEPProvisioner(r)
+	if err != nil {
+		render.Error(w, r, err)
+		return
+	}
+
+	challenges, err := mustAuthority(r.Context()).GetSCEPChallenges(r.Context(), p)
+	if err != nil {
+		render.Error(w, r, admin.WrapErrorISE(err, "error retrieving scep challenges"))
+		return
+	}
+	if challenges == nil {
+		challenges = []*provisioner.SCEPDynamicChallenge{}
+	}
+	render.JSON(w, r, &GetSCEPChallengesResponse{
+		Challenges: challenges,
+	})
+}
+
+// CreateSCEPChallenge generates a single-use challenge password for a SCEP
+// provisioner.
+func CreateSCEPChallenge(w http.ResponseWriter, r *http.Request) {
+	var body CreateSCEPChallengeRequest
+	if err := read.JSON(r.Body, &body); err != nil {
+		render.Error(w, r, admin.WrapError(admin.ErrorBadRequestType, err, "error reading request body"))
+		return
+	}
+
+	if err := body.Validate(); err != nil {
+		render.Error(w, r, err)
+		return
+	}
+
+	p, err := loadSCEPProvisioner(r)
+	if err != nil {
+		render.Error(w, r, err)
+		return
+	}
+
+	var ttl time.Duration
+	if body.TTL != "" {
+		ttl, _ = time.ParseDuration(body.TTL)
+	}
+
+	challenge, ch, err := mustAuthority(r.Context()).CreateSCEPChallenge(r.Context(), p, ttl)
+	if err != nil {
+		render.Error(w, r, admin.WrapErrorISE(err, "error creating scep challenge"))
+		return
+	}
+
+	render.JSONStatus(w, r, &CreateSCEPChallengeResponse{
+		SCEPDynamicChallenge: ch,
+		Challenge:            challenge,
+	}, http.StatusCreated)
+}
+
+// DeleteSCEPChallenge removes a dynamic challenge of a SCEP provisioner.
+func DeleteSCEPChallenge(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	p, err := loadSCEPProvisioner(r)
+	if err != nil {
+		render.Error(w, r, err)
+		return
+	}
+
+	if err := mustAuthority(r.Context()).RemoveSCEPChallenge(r.Context(), p, id); err != nil {
+		render.Error(w, r, admin.WrapErrorISE(err, "error deleting scep challenge %s", id))
+		return
+	}
+
+	render.JSON(w, r, &DeleteResponse{Status: "ok"})
+}
@@ -0,0 +1,214 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/smallstep/assert"
+	"github.com/smallstep/certificates/authority/admin"
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+func scepLoadProvisioner() func(name string) (provisioner.Interface, error) {
+	return func(name string) (provisioner.Interface, error) {
+		switch name {
+		case "scep":
+			return &provisioner.SCEP{Name: "scep", Type: "SCEP", DynamicChallenges: &provisioner.SCEPDynamicChallengeOptions{}}, nil
+		case "jwk":
+			return &provisioner.JWK{Name: "jwk", Type: "JWK"}, nil
+		default:
+			return nil, admin.NewError(admin.ErrorNotFoundType, "provisioner %s not found", name)
+		}
+	}
+}
+
+func TestHandler_GetSCEPChallenges(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Second)
+	challenges := []*provisioner.SCEPDynamicChallenge{
+		{ID: "id1", ProvisionerID: "scep/scep", CreatedAt: now, ExpiresAt: now.Add(time.Hour)},
+	}
+	tests := map[string]struct {
+		ctx        context.Context
+		auth       *mockAdminAuthority
+		statusCode int
+	}{
+		"fail/not-found": {
+			ctx:        webAuthnContext("foo", ""),
+			auth:       &mockAdminAuthority{MockLoadProvisionerByName: scepLoadProvisioner()},
+			statusCode: 404,
+		},
+		"fail/not-scep": {
+			ctx:        webAuthnContext("jwk", ""),
+			auth:       &mockAdminAuthority{MockLoadProvisionerByName: scepLoadProvisioner()},
+			statusCode: 400,
+		},
+		"fail/auth.GetSCEPChallenges": {
+			ctx: webAuthnContext("scep", ""),
+			auth: &mockAdminAuthority{
+				MockLoadProvisionerByName: scepLoadProvisioner(),
+				MockGetSCEPChallenges: func(ctx context.Context, prov provisioner.Interface) ([]*provisioner.SCEPDynamicChallenge, error) {
+					return nil, errors.New("force")
+				},
+			},
+			statusCode: 500,
+		},
+		"ok": {
+			ctx: webAuthnContext("scep", ""),
+			auth: &mockAdminAuthority{
+				MockLoadProvisionerByName: scepLoadProvisioner(),
+				MockGetSCEPChallenges: func(ctx context.Context, prov provisioner.Interface) ([]*provisioner.SCEPDynamicChallenge, error) {
+					assert.Equals(t, "scep", prov.GetName())
+					return challenges, nil
+				},
+			},
+			statusCode: 200,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			mockMustAuthority(t, tc.auth)
+			req := httptest.NewRequest("GET", "/foo", http.NoBody).WithContext(tc.ctx)
+			w := httptest.NewRecorder()
+			GetSCEPChallenges(w, req)
+			res := w.Result()
+			assert.Equals(t, tc.statusCode, res.StatusCode)
+
+			body, err := io.ReadAll(res.Body)
+			res.Body.Close()
+			assert.FatalError(t, err)
+			if res.StatusCode < 400 {
+				var response GetSCEPChallengesResponse
+				assert.FatalError(t, json.Unmarshal(bytes.TrimSpace(body), &response))
+				assert.Equals(t, challenges, response.Challenges)
+			}
+		})
+	}
+}
+
+func TestHandler_CreateSCEPChallenge(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Second)
+	ch := &provisioner.SCEPDynamicChallenge{ID: "id1", ProvisionerID: "scep/scep", CreatedAt: now, ExpiresAt: now.Add(30 * time.Minute)}
+
+	tests := map[string]struct {
+		ctx        context.Context
+		body       []byte
+		auth       *mockAdminAuthority
+		statusCode int
+	}{
+		"fail/read.JSON": {
+			ctx:        webAuthnContext("scep", ""),
+			body:       []byte("{!?}"),
+			auth:       &mockAdminAuthority{},
+			statusCode: 400,
+		},
+		"fail/validate": {
+			ctx:        webAuthnContext("scep", ""),
+			body:       []byte(`{"ttl":"-1m"}`),
+			auth:       &mockAdminAuthority{},
+			statusCode: 400,
+		},
+		"fail/not-scep": {
+			ctx:        webAuthnContext("jwk", ""),
+			body:       []byte(`{}`),
+			auth:       &mockAdminAuthority{MockLoadProvisionerByName: scepLoadProvisioner()},
+			statusCode: 400,
+		},
+		"fail/auth.CreateSCEPChallenge": {
+			ctx:  webAuthnContext("scep", ""),
+			body: []byte(`{}`),
+			auth: &mockAdminAuthority{
+				MockLoadProvisionerByName: scepLoadProvisioner(),
+				MockCreateSCEPChallenge: func(ctx context.Context, prov provisioner.Interface, ttl time.Duration) (string, *provisioner.SCEPDynamicChallenge, error) {
+					return "", nil, admin.NewError(admin.ErrorNotImplementedType, "the configured database does not support scep dynamic challenges")
+				},
+			},
+			statusCode: 501,
+		},
+		"ok": {
+			ctx:  webAuthnContext("scep", ""),
+			body: []byte(`{"ttl":"30m"}`),
+			auth: &mockAdminAuthority{
+				MockLoadProvisionerByName: scepLoadProvisioner(),
+				MockCreateSCEPChallenge: func(ctx context.Context, prov provisioner.Interface, ttl time.Duration) (string, *provisioner.SCEPDynamicChallenge, error) {
+					assert.Equals(t, "scep", prov.GetName())
+					assert.Equals(t, 30*time.Minute, ttl)
+					return "the-challenge", ch, nil
+				},
+			},
+			statusCode: 201,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			mockMustAuthority(t, tc.auth)
+			req := httptest.NewRequest("POST", "/foo", io.NopCloser(bytes.NewBuffer(tc.body))).WithContext(tc.ctx)
+			w := httptest.NewRecorder()
+			CreateSCEPChallenge(w, req)
+			res := w.Result()
+			assert.Equals(t, tc.statusCode, res.StatusCode)
+
+			body, err := io.ReadAll(res.Body)
+			res.Body.Close()
+			assert.FatalError(t, err)
+			if res.StatusCode < 400 {
+				var response CreateSCEPChallengeResponse
+				assert.FatalError(t, json.Unmarshal(bytes.TrimSpace(body), &response))
+				assert.Equals(t, "the-challenge", response.Challenge)
+				assert.Equals(t, ch, response.SCEPDynamicChallenge)
+			}
+		})
+	}
+}
+
+func TestHandler_DeleteSCEPChallenge(t *testing.T) {
+	tests := map[string]struct {
+		ctx        context.Context
+		auth       *mockAdminAuthority
+		statusCode int
+	}{
+		"fail/not-scep": {
+			ctx:        webAuthnContext("jwk", "id1"),
+			auth:       &mockAdminAuthority{MockLoadProvisionerByName: scepLoadProvisioner()},
+			statusCode: 400,
+		},
+		"fail/auth.RemoveSCEPChallenge": {
+			ctx: webAuthnContext("scep", "id1"),
+			auth: &mockAdminAuthority{
+				MockLoadProvisionerByName: scepLoadProvisioner(),
+				MockRemoveSCEPChallenge: func(ctx context.Context, prov provisioner.Interface, id string) error {
+					return errors.New("force")
+				},
+			},
+			statusCode: 500,
+		},
+		"ok": {
+			ctx: webAuthnContext("scep", "id1"),
+			auth: &mockAdminAuthority{
+				MockLoadProvisionerByName: scepLoadProvisioner(),
+				MockRemoveSCEPChallenge: func(ctx context.Context, prov provisioner.Interface, id string) error {
+					assert.Equals(t, "scep", prov.GetName())
+					assert.Equals(t, "id1", id)
+					return nil
+				},
+			},
+			statusCode: 200,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			mockMustAuthority(t, tc.auth)
+			req := httptest.NewRequest("DELETE", "/foo", http.NoBody).WithContext(tc.ctx)
+			w := httptest.NewRecorder()
+			DeleteSCEPChallenge(w, req)
+			res := w.Result()
+			assert.Equals(t, tc.statusCode, res.StatusCode)
+		})
+	}
+}
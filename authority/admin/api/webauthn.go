@@ -0,0 +1,132 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/smallstep/certificates/api/read"
+	"github.com/smallstep/certificates/api/render"
+	"github.com/smallstep/certificates/authority/admin"
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+// CreateWebAuthnCredentialRequest represents the body for a
+// CreateWebAuthnCredential request.
+type CreateWebAuthnCredentialRequest struct {
+	// ID is the base64url encoded credential id.
+	ID         string   `json:"id"`
+	Subject    string   `json:"subject"`
+	Principals []string `json:"principals,omitempty"`
+	// PublicKey is the PKIX, ASN.1 DER credential public key.
+	PublicKey []byte `json:"publicKey"`
+}
+
+// Validate validates a new-webauthn-credential request body.
+func (r *CreateWebAuthnCredentialRequest) Validate() error {
+	switch {
+	case r.ID == "":
+		return admin.NewError(admin.ErrorBadRequestType, "id cannot be empty")
+	case r.Subject == "":
+		return admin.NewError(admin.ErrorBadRequestType, "subject cannot be empty")
+	case len(r.PublicKey) == 0:
+		return admin.NewError(admin.ErrorBadRequestType, "publicKey cannot be empty")
+	}
+	return nil
+}
+
+// GetWebAuthnCredentialsResponse is the type for GET
+// /admin/provisioners/{provisionerName}/webauthn/credentials responses.
+type GetWebAuthnCredentialsResponse struct {
+	Credentials []*provisioner.WebAuthnCredential `json:"credentials"`
+}
+
+// loadWebAuthnProvisioner returns the WebAuthn provisioner in the request
+// path. WebAuthn provisioners can be defined in the ca.json, so they are not
+// loaded from the admin database.
+func loadWebAuthnProvisioner(r *http.Request) (provisioner.Interface, error) {
+	name := chi.URLParam(r, "provisionerName")
+	p, err := mustAuthority(r.Context()).LoadProvisionerByName(name)
+	if err != nil {
+		return nil, admin.WrapError(admin.ErrorNotFoundType, err, "provisioner %s not found", name)
+	}
+	if p.GetType() != provisioner.TypeWebAuthn {
+		return nil, admin.NewError(admin.ErrorBadRequestType, "provisioner %s is not a webauthn provisioner", name)
+	}
+	return p, nil
+}
+
+// GetWebAuthnCredentials returns the WebAuthn credentials registered for a
+// provisioner.
+func GetWebAuthnCredentials(w http.ResponseWriter, r *http.Request) {
+	p, err := loadWebAuthnProvisioner(r)
+	if err != nil {
+		render.Error(w, r, err)
+		return
+	}
+
+	creds, err := mustAuthority(r.Context()).GetWebAuthnCredentials(r.Context(), p)
+	if err != nil {
+		render.Error(w, r, admin.WrapErrorISE(err, "error retrieving webauthn credentials"))
+		return
+	}
+	if creds == nil {
+		creds = []*provisioner.WebAuthnCredential{}
+	}
+	render.JSON(w, r, &GetWebAuthnCredentialsResponse{
+		Credentials: creds,
+	})
+}
+
+// CreateWebAuthnCredential registers a new WebAuthn credential, a security
+// key or a passkey, for a provisioner.
+func CreateWebAuthnCredential(w http.ResponseWriter, r *http.Request) {
+	var body CreateWebAuthnCredentialRequest
+	if err := read.JSON(r.Body, &body); err != nil {
+		render.Error(w, r, admin.WrapError(admin.ErrorBadRequestType, err, "error reading request body"))
+		return
+	}
+
+	if err := body.Validate(); err != nil {
+		render.Error(w, r, err)
+		return
+	}
+
+	p, err := loadWebAuthnProvisioner(r)
+	if err != nil {
+		render.Error(w, r, err)
+		return
+	}
+
+	cred := &provisioner.WebAuthnCredential{
+		ID:         body.ID,
+		Subject:    body.Subject,
+		Principals: body.Principals,
+		PublicKey:  body.PublicKey,
+	}
+	if err := mustAuthority(r.Context()).StoreWebAuthnCredential(r.Context(), p, cred); err != nil {
+		render.Error(w, r, admin.WrapErrorISE(err, "error storing webauthn credential"))
+		return
+	}
+
+	render.JSONStatus(w, r, cred, http.StatusCreated)
+}
+
+// DeleteWebAuthnCredential removes a WebAuthn credential registered for a
+// provisioner.
+func DeleteWebAuthnCredential(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	p, err := loadWebAuthnProvisioner(r)
+	if err != nil {
+		render.Error(w, r, err)
+		return
+	}
+
+	if err := mustAuthority(r.Context()).RemoveWebAuthnCredential(r.Context(), p, id); err != nil {
+		render.Error(w, r, admin.WrapErrorISE(err, "error deleting webauthn credential %s", id))
+		return
+	}
+
+	render.JSON(w, r, &DeleteResponse{Status: "ok"})
+}
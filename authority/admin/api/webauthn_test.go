@@ -0,0 +1,228 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/smallstep/assert"
+	"github.com/smallstep/certificates/authority/admin"
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+func webAuthnContext(provisionerName, id string) context.Context {
+	chiCtx := chi.NewRouteContext()
+	chiCtx.URLParams.Add("provisionerName", provisionerName)
+	if id != "" {
+		chiCtx.URLParams.Add("id", id)
+	}
+	return context.WithValue(context.Background(), chi.RouteCtxKey, chiCtx)
+}
+
+func webAuthnLoadProvisioner() func(name string) (provisioner.Interface, error) {
+	return func(name string) (provisioner.Interface, error) {
+		switch name {
+		case "webauthn":
+			return &provisioner.WebAuthn{Name: "webauthn", Type: "WebAuthn"}, nil
+		case "jwk":
+			return &provisioner.JWK{Name: "jwk", Type: "JWK"}, nil
+		default:
+			return nil, admin.NewError(admin.ErrorNotFoundType, "provisioner %s not found", name)
+		}
+	}
+}
+
+func TestHandler_GetWebAuthnCredentials(t *testing.T) {
+	creds := []*provisioner.WebAuthnCredential{
+		{ID: "Y3JlZDE", ProvisionerID: "webauthn/webauthn", Subject: "jane", PublicKey: []byte("key")},
+	}
+	tests := map[string]struct {
+		ctx        context.Context
+		auth       *mockAdminAuthority
+		statusCode int
+	}{
+		"fail/not-found": {
+			ctx:        webAuthnContext("foo", ""),
+			auth:       &mockAdminAuthority{MockLoadProvisionerByName: webAuthnLoadProvisioner()},
+			statusCode: 404,
+		},
+		"fail/not-webauthn": {
+			ctx:        webAuthnContext("jwk", ""),
+			auth:       &mockAdminAuthority{MockLoadProvisionerByName: webAuthnLoadProvisioner()},
+			statusCode: 400,
+		},
+		"fail/auth.GetWebAuthnCredentials": {
+			ctx: webAuthnContext("webauthn", ""),
+			auth: &mockAdminAuthority{
+				MockLoadProvisionerByName: webAuthnLoadProvisioner(),
+				MockGetWebAuthnCredentials: func(ctx context.Context, prov provisioner.Interface) ([]*provisioner.WebAuthnCredential, error) {
+					return nil, errors.New("force")
+				},
+			},
+			statusCode: 500,
+		},
+		"ok": {
+			ctx: webAuthnContext("webauthn", ""),
+			auth: &mockAdminAuthority{
+				MockLoadProvisionerByName: webAuthnLoadProvisioner(),
+				MockGetWebAuthnCredentials: func(ctx context.Context, prov provisioner.Interface) ([]*provisioner.WebAuthnCredential, error) {
+					assert.Equals(t, "webauthn", prov.GetName())
+					return creds, nil
+				},
+			},
+			statusCode: 200,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			mockMustAuthority(t, tc.auth)
+			req := httptest.NewRequest("GET", "/foo", http.NoBody).WithContext(tc.ctx)
+			w := httptest.NewRecorder()
+			GetWebAuthnCredentials(w, req)
+			res := w.Result()
+			assert.Equals(t, tc.statusCode, res.StatusCode)
+
+			body, err := io.ReadAll(res.Body)
+			res.Body.Close()
+			assert.FatalError(t, err)
+			if res.StatusCode < 400 {
+				var response GetWebAuthnCredentialsResponse
+				assert.FatalError(t, json.Unmarshal(bytes.TrimSpace(body), &response))
+				assert.Equals(t, creds, response.Credentials)
+			}
+		})
+	}
+}
+
+func TestHandler_CreateWebAuthnCredential(t *testing.T) {
+	body := func(v any) []byte {
+		b, err := json.Marshal(v)
+		assert.FatalError(t, err)
+		return b
+	}
+	valid := &CreateWebAuthnCredentialRequest{ID: "Y3JlZDE", Subject: "jane", Principals: []string{"root"}, PublicKey: []byte("key")}
+
+	tests := map[string]struct {
+		ctx        context.Context
+		body       []byte
+		auth       *mockAdminAuthority
+		statusCode int
+	}{
+		"fail/read.JSON": {
+			ctx:        webAuthnContext("webauthn", ""),
+			body:       []byte("{!?}"),
+			auth:       &mockAdminAuthority{},
+			statusCode: 400,
+		},
+		"fail/validate": {
+			ctx:        webAuthnContext("webauthn", ""),
+			body:       body(&CreateWebAuthnCredentialRequest{ID: "Y3JlZDE", PublicKey: []byte("key")}),
+			auth:       &mockAdminAuthority{},
+			statusCode: 400,
+		},
+		"fail/not-webauthn": {
+			ctx:        webAuthnContext("jwk", ""),
+			body:       body(valid),
+			auth:       &mockAdminAuthority{MockLoadProvisionerByName: webAuthnLoadProvisioner()},
+			statusCode: 400,
+		},
+		"fail/auth.StoreWebAuthnCredential": {
+			ctx:  webAuthnContext("webauthn", ""),
+			body: body(valid),
+			auth: &mockAdminAuthority{
+				MockLoadProvisionerByName: webAuthnLoadProvisioner(),
+				MockStoreWebAuthnCredential: func(ctx context.Context, prov provisioner.Interface, cred *provisioner.WebAuthnCredential) error {
+					return admin.NewError(admin.ErrorConflictType, "webauthn credential %s already exists", cred.ID)
+				},
+			},
+			statusCode: 409,
+		},
+		"ok": {
+			ctx:  webAuthnContext("webauthn", ""),
+			body: body(valid),
+			auth: &mockAdminAuthority{
+				MockLoadProvisionerByName: webAuthnLoadProvisioner(),
+				MockStoreWebAuthnCredential: func(ctx context.Context, prov provisioner.Interface, cred *provisioner.WebAuthnCredential) error {
+					assert.Equals(t, "webauthn", prov.GetName())
+					assert.Equals(t, &provisioner.WebAuthnCredential{
+						ID: "Y3JlZDE", Subject: "jane", Principals: []string{"root"}, PublicKey: []byte("key"),
+					}, cred)
+					return nil
+				},
+			},
+			statusCode: 201,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			mockMustAuthority(t, tc.auth)
+			req := httptest.NewRequest("POST", "/foo", io.NopCloser(bytes.NewBuffer(tc.body))).WithContext(tc.ctx)
+			w := httptest.NewRecorder()
+			CreateWebAuthnCredential(w, req)
+			res := w.Result()
+			assert.Equals(t, tc.statusCode, res.StatusCode)
+		})
+	}
+}
+
+func TestHandler_DeleteWebAuthnCredential(t *testing.T) {
+	tests := map[string]struct {
+		ctx        context.Context
+		auth       *mockAdminAuthority
+		statusCode int
+	}{
+		"fail/not-webauthn": {
+			ctx:        webAuthnContext("jwk", "Y3JlZDE"),
+			auth:       &mockAdminAuthority{MockLoadProvisionerByName: webAuthnLoadProvisioner()},
+			statusCode: 400,
+		},
+		"fail/auth.RemoveWebAuthnCredential": {
+			ctx: webAuthnContext("webauthn", "Y3JlZDE"),
+			auth: &mockAdminAuthority{
+				MockLoadProvisionerByName: webAuthnLoadProvisioner(),
+				MockRemoveWebAuthnCredential: func(ctx context.Context, prov provisioner.Interface, credentialID string) error {
+					return admin.NewError(admin.ErrorNotFoundType, "webauthn credential %s not found", credentialID)
+				},
+			},
+			statusCode: 404,
+		},
+		"ok": {
+			ctx: webAuthnContext("webauthn", "Y3JlZDE"),
+			auth: &mockAdminAuthority{
+				MockLoadProvisionerByName: webAuthnLoadProvisioner(),
+				MockRemoveWebAuthnCredential: func(ctx context.Context, prov provisioner.Interface, credentialID string) error {
+					assert.Equals(t, "webauthn", prov.GetName())
+					assert.Equals(t, "Y3JlZDE", credentialID)
+					return nil
+				},
+			},
+			statusCode: 200,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			mockMustAuthority(t, tc.auth)
+			req := httptest.NewRequest("DELETE", "/foo", http.NoBody).WithContext(tc.ctx)
+			w := httptest.NewRecorder()
+			DeleteWebAuthnCredential(w, req)
+			res := w.Result()
+			assert.Equals(t, tc.statusCode, res.StatusCode)
+
+			if res.StatusCode < 400 {
+				body, err := io.ReadAll(res.Body)
+				res.Body.Close()
+				assert.FatalError(t, err)
+				var response DeleteResponse
+				assert.FatalError(t, json.Unmarshal(bytes.TrimSpace(body), &response))
+				assert.Equals(t, "ok", response.Status)
+			}
+		})
+	}
+}
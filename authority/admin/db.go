@@ -76,6 +76,25 @@ type DB interface {
 	DeleteAuthorityPolicy(ctx context.Context) error
 }
 
+// ProvisionerStateDB is the interface implemented by the admin databases that
+// store the lifecycle state of the provisioners. The state is not part of the
+// linkedca provisioner, it is stored and updated separately, and it is kept
+// when the provisioner is updated. An empty state is the default one.
+type ProvisionerStateDB interface {
+	GetProvisionerState(ctx context.Context, id string) (string, error)
+	UpdateProvisionerState(ctx context.Context, id, state string) error
+}
+
+// ProvisionerKeysDB is the interface implemented by the admin databases that
+// store the additional public keys of the JWK provisioners. The keys, each one
+// encoded as a JWK, are not part of the linkedca provisioner, the main key is
+// stored in its PublicKey field. They are stored and updated separately, and
+// they are kept when the provisioner is updated.
+type ProvisionerKeysDB interface {
+	GetProvisionerKeys(ctx context.Context, id string) ([][]byte, error)
+	UpdateProvisionerKeys(ctx context.Context, id string, keys [][]byte) error
+}
+
 type dbKey struct{}
 
 // NewContext adds the given admin database to the context.
@@ -122,6 +141,11 @@ type MockDB struct {
 	MockUpdateAuthorityPolicy func(ctx context.Context, policy *linkedca.Policy) error
 	MockDeleteAuthorityPolicy func(ctx context.Context) error
 
+	MockGetProvisionerState    func(ctx context.Context, id string) (string, error)
+	MockUpdateProvisionerState func(ctx context.Context, id, state string) error
+	MockGetProvisionerKeys     func(ctx context.Context, id string) ([][]byte, error)
+	MockUpdateProvisionerKeys  func(ctx context.Context, id string, keys [][]byte) error
+
 	MockError error
 	MockRet1  interface{}
 }
@@ -247,3 +271,35 @@ func (m *MockDB) DeleteAuthorityPolicy(ctx context.Context) error {
 	}
 	return m.MockError
 }
+
+// GetProvisionerState mock
+func (m *MockDB) GetProvisionerState(ctx context.Context, id string) (string, error) {
+	if m.MockGetProvisionerState != nil {
+		return m.MockGetProvisionerState(ctx, id)
+	}
+	return "", m.MockError
+}
+
+// UpdateProvisionerState mock
+func (m *MockDB) UpdateProvisionerState(ctx context.Context, id, state string) error {
+	if m.MockUpdateProvisionerState != nil {
+		return m.MockUpdateProvisionerState(ctx, id, state)
+	}
+	return m.MockError
+}
+
+// GetProvisionerKeys mock
+func (m *MockDB) GetProvisionerKeys(ctx context.Context, id string) ([][]byte, error) {
+	if m.MockGetProvisionerKeys != nil {
+		return m.MockGetProvisionerKeys(ctx, id)
+	}
+	return nil, m.MockError
+}
+
+// UpdateProvisionerKeys mock
+func (m *MockDB) UpdateProvisionerKeys(ctx context.Context, id string, keys [][]byte) error {
+	if m.MockUpdateProvisionerKeys != nil {
+		return m.MockUpdateProvisionerKeys(ctx, id, keys)
+	}
+	return m.MockError
+}
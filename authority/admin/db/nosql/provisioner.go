@@ -19,7 +19,9 @@ type dbProvisioner struct {
 	Type         linkedca.Provisioner_Type `json:"type"`
 	Name         string                    `json:"name"`
 	Claims       *linkedca.Claims          `json:"claims"`
+	State        string                    `json:"state,omitempty"`
 	Details      []byte                    `json:"details"`
+	JWKKeys      [][]byte                  `json:"jwkKeys,omitempty"`
 	X509Template *linkedca.Template        `json:"x509Template"`
 	SSHTemplate  *linkedca.Template        `json:"sshTemplate"`
 	CreatedAt    time.Time                 `json:"createdAt"`
@@ -216,6 +218,55 @@ func (db *DB) UpdateProvisioner(ctx context.Context, prov *linkedca.Provisioner)
 	return db.save(ctx, prov.Id, nu, old, "provisioner", provisionersTable)
 }
 
+// GetProvisionerState returns the lifecycle state of a provisioner.
+func (db *DB) GetProvisionerState(ctx context.Context, id string) (string, error) {
+	dbp, err := db.getDBProvisioner(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	return dbp.State, nil
+}
+
+// UpdateProvisionerState saves the lifecycle state of a provisioner to the
+// database. The state is not modified by UpdateProvisioner.
+func (db *DB) UpdateProvisionerState(ctx context.Context, id, state string) error {
+	old, err := db.getDBProvisioner(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	nu := old.clone()
+	nu.State = state
+
+	return db.save(ctx, old.ID, nu, old, "provisioner", provisionersTable)
+}
+
+// GetProvisionerKeys returns the additional public keys of a JWK provisioner.
+func (db *DB) GetProvisionerKeys(ctx context.Context, id string) ([][]byte, error) {
+	dbp, err := db.getDBProvisioner(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return dbp.JWKKeys, nil
+}
+
+// UpdateProvisionerKeys saves the additional public keys of a JWK provisioner
+// to the database. The keys are not modified by UpdateProvisioner.
+func (db *DB) UpdateProvisionerKeys(ctx context.Context, id string, keys [][]byte) error {
+	old, err := db.getDBProvisioner(ctx, id)
+	if err != nil {
+		return err
+	}
+	if old.Type != linkedca.Provisioner_JWK {
+		return admin.NewError(admin.ErrorBadRequestType, "provisioner %s is not a JWK provisioner", old.Name)
+	}
+
+	nu := old.clone()
+	nu.JWKKeys = keys
+
+	return db.save(ctx, old.ID, nu, old, "provisioner", provisionersTable)
+}
+
 // DeleteProvisioner saves an updated admin to the database.
 func (db *DB) DeleteProvisioner(ctx context.Context, id string) error {
 	old, err := db.getDBProvisioner(ctx, id)
@@ -13,6 +13,7 @@ import (
 	"github.com/smallstep/nosql"
 	nosqldb "github.com/smallstep/nosql/database"
 	"go.step.sm/linkedca"
+	"google.golang.org/protobuf/proto"
 )
 
 func TestDB_getDBProvisionerBytes(t *testing.T) {
@@ -403,6 +404,16 @@ func TestDB_unmarshalProvisioner(t *testing.T) {
 				dbp: dbp,
 			}
 		},
+		"ok/state": func(t *testing.T) test {
+			dbp := defaultDBP(t)
+			dbp.State = "renew-only"
+			data, err := json.Marshal(dbp)
+			assert.FatalError(t, err)
+			return test{
+				in:  data,
+				dbp: dbp,
+			}
+		},
 	}
 	for name, run := range tests {
 		tc := run(t)
@@ -428,7 +439,7 @@ func TestDB_unmarshalProvisioner(t *testing.T) {
 				assert.Equals(t, prov.AuthorityId, tc.dbp.AuthorityID)
 				assert.Equals(t, prov.Type, tc.dbp.Type)
 				assert.Equals(t, prov.Name, tc.dbp.Name)
-				assert.Equals(t, prov.Claims, tc.dbp.Claims)
+				assert.True(t, proto.Equal(prov.Claims, tc.dbp.Claims))
 				assert.Equals(t, prov.X509Template, tc.dbp.X509Template)
 				assert.Equals(t, prov.SshTemplate, tc.dbp.SSHTemplate)
 				assert.Equals(t, prov.Webhooks, dbWebhooksToLinkedca(tc.dbp.Webhooks))
@@ -910,7 +921,7 @@ func TestDB_CreateProvisioner(t *testing.T) {
 						assert.Equals(t, _dbp.AuthorityID, prov.AuthorityId)
 						assert.Equals(t, _dbp.Type, prov.Type)
 						assert.Equals(t, _dbp.Name, prov.Name)
-						assert.Equals(t, _dbp.Claims, prov.Claims)
+						assert.True(t, proto.Equal(_dbp.Claims, prov.Claims))
 						assert.Equals(t, _dbp.X509Template, prov.X509Template)
 						assert.Equals(t, _dbp.SSHTemplate, prov.SshTemplate)
 						assert.Equals(t, _dbp.Webhooks, linkedcaWebhooksToDB(prov.Webhooks))
@@ -948,7 +959,7 @@ func TestDB_CreateProvisioner(t *testing.T) {
 						assert.Equals(t, _dbp.AuthorityID, prov.AuthorityId)
 						assert.Equals(t, _dbp.Type, prov.Type)
 						assert.Equals(t, _dbp.Name, prov.Name)
-						assert.Equals(t, _dbp.Claims, prov.Claims)
+						assert.True(t, proto.Equal(_dbp.Claims, prov.Claims))
 						assert.Equals(t, _dbp.X509Template, prov.X509Template)
 						assert.Equals(t, _dbp.SSHTemplate, prov.SshTemplate)
 						assert.Equals(t, _dbp.Webhooks, linkedcaWebhooksToDB(prov.Webhooks))
@@ -1097,7 +1108,7 @@ func TestDB_UpdateProvisioner(t *testing.T) {
 						assert.Equals(t, _dbp.AuthorityID, prov.AuthorityId)
 						assert.Equals(t, _dbp.Type, prov.Type)
 						assert.Equals(t, _dbp.Name, prov.Name)
-						assert.Equals(t, _dbp.Claims, prov.Claims)
+						assert.True(t, proto.Equal(_dbp.Claims, prov.Claims))
 						assert.Equals(t, _dbp.X509Template, prov.X509Template)
 						assert.Equals(t, _dbp.SSHTemplate, prov.SshTemplate)
 						assert.Equals(t, _dbp.Webhooks, linkedcaWebhooksToDB(prov.Webhooks))
@@ -1118,6 +1129,8 @@ func TestDB_UpdateProvisioner(t *testing.T) {
 		},
 		"ok": func(t *testing.T) test {
 			dbp := defaultDBP(t)
+			dbp.State = "renew-only"
+			dbp.JWKKeys = [][]byte{[]byte(`{"kid":"next"}`)}
 
 			prov, err := dbp.convert2linkedca()
 			assert.FatalError(t, err)
@@ -1192,7 +1205,9 @@ func TestDB_UpdateProvisioner(t *testing.T) {
 						assert.Equals(t, _dbp.AuthorityID, prov.AuthorityId)
 						assert.Equals(t, _dbp.Type, prov.Type)
 						assert.Equals(t, _dbp.Name, prov.Name)
-						assert.Equals(t, _dbp.Claims, prov.Claims)
+						assert.True(t, proto.Equal(_dbp.Claims, prov.Claims))
+						assert.Equals(t, _dbp.State, "renew-only")
+						assert.Equals(t, _dbp.JWKKeys, [][]byte{[]byte(`{"kid":"next"}`)})
 						assert.Equals(t, _dbp.X509Template, prov.X509Template)
 						assert.Equals(t, _dbp.SSHTemplate, prov.SshTemplate)
 						assert.Equals(t, _dbp.Webhooks, linkedcaWebhooksToDB(prov.Webhooks))
@@ -1235,6 +1250,235 @@ func TestDB_UpdateProvisioner(t *testing.T) {
 	}
 }
 
+func TestDB_GetProvisionerState(t *testing.T) {
+	dbp := defaultDBP(t)
+	dbp.State = "disabled"
+	data, err := json.Marshal(dbp)
+	assert.FatalError(t, err)
+
+	type test struct {
+		db    nosql.DB
+		state string
+		err   error
+	}
+	var tests = map[string]test{
+		"fail/db.Get-error": {
+			db: &db.MockNoSQLDB{
+				MGet: func(bucket, key []byte) ([]byte, error) {
+					return nil, errors.New("force")
+				},
+			},
+			err: errors.New("error loading provisioner provID: force"),
+		},
+		"ok": {
+			db: &db.MockNoSQLDB{
+				MGet: func(bucket, key []byte) ([]byte, error) {
+					assert.Equals(t, bucket, provisionersTable)
+					assert.Equals(t, string(key), "provID")
+					return data, nil
+				},
+			},
+			state: "disabled",
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			d := DB{db: tc.db, authorityID: admin.DefaultAuthorityID}
+			state, err := d.GetProvisionerState(context.Background(), "provID")
+			if tc.err != nil {
+				if assert.NotNil(t, err) {
+					assert.HasPrefix(t, err.Error(), tc.err.Error())
+				}
+			} else if assert.Nil(t, err) {
+				assert.Equals(t, tc.state, state)
+			}
+		})
+	}
+}
+
+func TestDB_UpdateProvisionerState(t *testing.T) {
+	data, err := json.Marshal(defaultDBP(t))
+	assert.FatalError(t, err)
+
+	type test struct {
+		db  nosql.DB
+		err error
+	}
+	var tests = map[string]test{
+		"fail/db.Get-error": {
+			db: &db.MockNoSQLDB{
+				MGet: func(bucket, key []byte) ([]byte, error) {
+					return nil, errors.New("force")
+				},
+			},
+			err: errors.New("error loading provisioner provID: force"),
+		},
+		"fail/save-error": {
+			db: &db.MockNoSQLDB{
+				MGet: func(bucket, key []byte) ([]byte, error) {
+					return data, nil
+				},
+				MCmpAndSwap: func(bucket, key, old, nu []byte) ([]byte, bool, error) {
+					return nil, false, errors.New("force")
+				},
+			},
+			err: errors.New("error saving authority provisioner: force"),
+		},
+		"ok": {
+			db: &db.MockNoSQLDB{
+				MGet: func(bucket, key []byte) ([]byte, error) {
+					return data, nil
+				},
+				MCmpAndSwap: func(bucket, key, old, nu []byte) ([]byte, bool, error) {
+					assert.Equals(t, bucket, provisionersTable)
+					assert.Equals(t, string(key), "provID")
+					assert.Equals(t, string(old), string(data))
+
+					var _dbp = new(dbProvisioner)
+					assert.FatalError(t, json.Unmarshal(nu, _dbp))
+					assert.Equals(t, "renew-only", _dbp.State)
+					assert.True(t, proto.Equal(_dbp.Claims, defaultDBP(t).Claims))
+					return nu, true, nil
+				},
+			},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			d := DB{db: tc.db, authorityID: admin.DefaultAuthorityID}
+			err := d.UpdateProvisionerState(context.Background(), "provID", "renew-only")
+			if tc.err != nil {
+				if assert.NotNil(t, err) {
+					assert.HasPrefix(t, err.Error(), tc.err.Error())
+				}
+			} else {
+				assert.Nil(t, err)
+			}
+		})
+	}
+}
+
+func TestDB_GetProvisionerKeys(t *testing.T) {
+	dbp := defaultDBP(t)
+	dbp.Type = linkedca.Provisioner_JWK
+	dbp.JWKKeys = [][]byte{[]byte(`{"kid":"next"}`)}
+	data, err := json.Marshal(dbp)
+	assert.FatalError(t, err)
+
+	type test struct {
+		db   nosql.DB
+		keys [][]byte
+		err  error
+	}
+	var tests = map[string]test{
+		"fail/db.Get-error": {
+			db: &db.MockNoSQLDB{
+				MGet: func(bucket, key []byte) ([]byte, error) {
+					return nil, errors.New("force")
+				},
+			},
+			err: errors.New("error loading provisioner provID: force"),
+		},
+		"ok": {
+			db: &db.MockNoSQLDB{
+				MGet: func(bucket, key []byte) ([]byte, error) {
+					assert.Equals(t, bucket, provisionersTable)
+					assert.Equals(t, string(key), "provID")
+					return data, nil
+				},
+			},
+			keys: [][]byte{[]byte(`{"kid":"next"}`)},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			d := DB{db: tc.db, authorityID: admin.DefaultAuthorityID}
+			keys, err := d.GetProvisionerKeys(context.Background(), "provID")
+			if tc.err != nil {
+				if assert.NotNil(t, err) {
+					assert.HasPrefix(t, err.Error(), tc.err.Error())
+				}
+			} else if assert.Nil(t, err) {
+				assert.Equals(t, tc.keys, keys)
+			}
+		})
+	}
+}
+
+func TestDB_UpdateProvisionerKeys(t *testing.T) {
+	acme, err := json.Marshal(defaultDBP(t))
+	assert.FatalError(t, err)
+	dbp := defaultDBP(t)
+	dbp.Type = linkedca.Provisioner_JWK
+	data, err := json.Marshal(dbp)
+	assert.FatalError(t, err)
+
+	type test struct {
+		db  nosql.DB
+		err error
+	}
+	var tests = map[string]test{
+		"fail/db.Get-error": {
+			db: &db.MockNoSQLDB{
+				MGet: func(bucket, key []byte) ([]byte, error) {
+					return nil, errors.New("force")
+				},
+			},
+			err: errors.New("error loading provisioner provID: force"),
+		},
+		"fail/not-jwk": {
+			db: &db.MockNoSQLDB{
+				MGet: func(bucket, key []byte) ([]byte, error) {
+					return acme, nil
+				},
+			},
+			err: errors.New("provisioner provName is not a JWK provisioner"),
+		},
+		"fail/save-error": {
+			db: &db.MockNoSQLDB{
+				MGet: func(bucket, key []byte) ([]byte, error) {
+					return data, nil
+				},
+				MCmpAndSwap: func(bucket, key, old, nu []byte) ([]byte, bool, error) {
+					return nil, false, errors.New("force")
+				},
+			},
+			err: errors.New("error saving authority provisioner: force"),
+		},
+		"ok": {
+			db: &db.MockNoSQLDB{
+				MGet: func(bucket, key []byte) ([]byte, error) {
+					return data, nil
+				},
+				MCmpAndSwap: func(bucket, key, old, nu []byte) ([]byte, bool, error) {
+					assert.Equals(t, bucket, provisionersTable)
+					assert.Equals(t, string(key), "provID")
+					assert.Equals(t, string(old), string(data))
+
+					var _dbp = new(dbProvisioner)
+					assert.FatalError(t, json.Unmarshal(nu, _dbp))
+					assert.Equals(t, [][]byte{[]byte(`{"kid":"next"}`)}, _dbp.JWKKeys)
+					assert.Equals(t, dbp.Details, _dbp.Details)
+					return nu, true, nil
+				},
+			},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			d := DB{db: tc.db, authorityID: admin.DefaultAuthorityID}
+			err := d.UpdateProvisionerKeys(context.Background(), "provID", [][]byte{[]byte(`{"kid":"next"}`)})
+			if tc.err != nil {
+				if assert.NotNil(t, err) {
+					assert.HasPrefix(t, err.Error(), tc.err.Error())
+				}
+			} else {
+				assert.Nil(t, err)
+			}
+		})
+	}
+}
+
 func Test_linkedcaWebhooksToDB(t *testing.T) {
 	type test struct {
 		in   []*linkedca.Webhook
@@ -32,7 +32,10 @@ import (
 	"github.com/smallstep/certificates/authority/provisioner"
 	"github.com/smallstep/certificates/cas"
 	casapi "github.com/smallstep/certificates/cas/apiv1"
+	"github.com/smallstep/certificates/cas/ratelimit"
+	"github.com/smallstep/certificates/cas/softcas"
 	"github.com/smallstep/certificates/db"
+	"github.com/smallstep/certificates/export"
 	"github.com/smallstep/certificates/scep"
 	"github.com/smallstep/certificates/templates"
 	"github.com/smallstep/nosql"
@@ -55,10 +58,16 @@ type Authority struct {
 	password              []byte
 	issuerPassword        []byte
 	x509CAService         cas.CertificateAuthorityService
+	x509CAServices        map[string]cas.CertificateAuthorityService
+	x509CAServiceRoutes   map[string]string
+	x509CALimiters        map[string]cas.CertificateAuthorityService
 	rootX509Certs         []*x509.Certificate
 	rootX509CertPool      *x509.CertPool
 	federatedX509Certs    []*x509.Certificate
 	intermediateX509Certs []*x509.Certificate
+	x509Issuer            *x509Issuer
+	x509IssuerMutex       sync.RWMutex
+	alternateX509Chains   [][]*x509.Certificate
 	certificates          *sync.Map
 	x509Enforcers         []provisioner.CertificateEnforcer
 
@@ -79,9 +88,19 @@ type Authority struct {
 	sshCAHostFederatedCerts []ssh.PublicKey
 
 	// CRL vars
-	crlTicker  *time.Ticker
-	crlStopper chan struct{}
-	crlMutex   sync.Mutex
+	crlTicker      *time.Ticker
+	crlDeltaTicker *time.Ticker
+	crlStopper     chan struct{}
+	crlMutex       sync.Mutex
+	crlSigner      *crlSigner
+
+	// OCSP vars
+	ocspResponder *ocspResponder
+	ocspCache     map[string]*ocspCacheEntry
+	ocspMutex     sync.Mutex
+
+	// Export pipeline
+	exporter *export.Exporter
 
 	// If true, do not re-initialize
 	initOnce  bool
@@ -224,6 +243,33 @@ func MustFromContext(ctx context.Context) *Authority {
 	return a
 }
 
+// ReloadProvisioners atomically replaces the provisioners and admins with the
+// ones in the given configuration, keeping the rest of the authority intact.
+// If the admin API is enabled, provisioners and admins are managed in the
+// database, and they are just reloaded from there.
+func (a *Authority) ReloadProvisioners(ctx context.Context, cfg *config.Config) error {
+	if cfg == nil || cfg.AuthorityConfig == nil {
+		return errors.New("error reloading provisioners: authority configuration cannot be nil")
+	}
+
+	a.adminMutex.Lock()
+	defer a.adminMutex.Unlock()
+
+	if a.config.AuthorityConfig.EnableAdmin {
+		return a.ReloadAdminResources(ctx)
+	}
+
+	provList, adminList := a.config.AuthorityConfig.Provisioners, a.config.AuthorityConfig.Admins
+	a.config.AuthorityConfig.Provisioners = cfg.AuthorityConfig.Provisioners
+	a.config.AuthorityConfig.Admins = cfg.AuthorityConfig.Admins
+	if err := a.ReloadAdminResources(ctx); err != nil {
+		a.config.AuthorityConfig.Provisioners = provList
+		a.config.AuthorityConfig.Admins = adminList
+		return errors.Wrap(err, "error reloading provisioners")
+	}
+	return nil
+}
+
 // ReloadAdminResources reloads admins and provisioners from the DB.
 func (a *Authority) ReloadAdminResources(ctx context.Context) error {
 	var (
@@ -235,7 +281,7 @@ func (a *Authority) ReloadAdminResources(ctx context.Context) error {
 		if err != nil {
 			return admin.WrapErrorISE(err, "error getting provisioners to initialize authority")
 		}
-		provList, err = provisionerListToCertificates(provs)
+		provList, err = a.provisionerListToCertificates(ctx, provs)
 		if err != nil {
 			return admin.WrapErrorISE(err, "error converting provisioner list to certificates")
 		}
@@ -253,6 +299,9 @@ func (a *Authority) ReloadAdminResources(ctx context.Context) error {
 		return admin.WrapErrorISE(err, "error generating provisioner config")
 	}
 
+	// Drop the templates compiled with the previous configuration.
+	provisioner.ResetTemplateCache()
+
 	// Create provisioner collection.
 	provClxn := provisioner.NewCollection(provisionerConfig.Audiences)
 	for _, p := range provList {
@@ -323,6 +372,11 @@ func (a *Authority) init() error {
 	if configPassword != nil && a.password == nil {
 		a.password = configPassword
 	}
+	if a.config.EncryptedPassword != nil && a.password == nil {
+		if a.password, err = decryptPassword(ctx, a.config.EncryptedPassword); err != nil {
+			return err
+		}
+	}
 	if a.sshHostPassword == nil {
 		a.sshHostPassword = a.password
 	}
@@ -354,6 +408,20 @@ func (a *Authority) init() error {
 			return err
 		}
 
+		// Add support for keys encrypted with scrypt.
+		if typ, err := options.GetType(); err == nil && kmsapi.SoftKMS == kmsapi.Type(strings.ToLower(string(typ))) {
+			a.keyManager = softcas.NewKeyManager(a.keyManager)
+		}
+
+		// Limit the number of concurrent signatures if configured.
+		if p := a.config.SigningPool; p != nil {
+			var timeout time.Duration
+			if p.QueueTimeout != nil {
+				timeout = p.QueueTimeout.Duration
+			}
+			a.keyManager = newPooledKeyManager(a.keyManager, newSigningPool(p.MaxConcurrency, timeout))
+		}
+
 		a.keyManager = newInstrumentedKeyManager(a.keyManager, a.meter)
 	}
 
@@ -436,6 +504,15 @@ func (a *Authority) init() error {
 			if len(a.intermediateX509Certs) == 0 {
 				a.intermediateX509Certs = append(a.intermediateX509Certs, options.CertificateChain...)
 			}
+			// Sign using the current issuer, so it can be rotated with
+			// RotateX509Issuer.
+			a.x509Issuer = &x509Issuer{
+				chain:  options.CertificateChain,
+				signer: options.Signer,
+			}
+			options.CertificateSigner = a.getX509Issuer
+			// Use the KMS of the authority to rotate the issuer key.
+			options.KeyManager = a.keyManager
 		}
 		a.x509CAService, err = cas.New(ctx, options)
 		if err != nil {
@@ -466,6 +543,48 @@ func (a *Authority) init() error {
 			a.rootX509Certs = append(a.rootX509Certs, crts...)
 		}
 	}
+
+	// Initialize the additional X.509 CA Services used by provisioners.
+	if len(a.config.AuthorityConfig.CASRoutes) > 0 && a.x509CAServices == nil {
+		a.x509CAServices = make(map[string]cas.CertificateAuthorityService)
+		a.x509CAServiceRoutes = make(map[string]string)
+		for provName, name := range a.config.AuthorityConfig.CASRoutes {
+			a.x509CAServiceRoutes[provName] = name
+			if _, ok := a.x509CAServices[name]; ok {
+				continue
+			}
+			o, ok := a.config.AuthorityConfig.CASBackends[name]
+			if !ok || o == nil {
+				return errors.Errorf("error initializing cas backend %s: backend is not defined", name)
+			}
+			options := *o
+			options.AuthorityID = a.config.AuthorityConfig.AuthorityID
+			srv, err := cas.New(ctx, options)
+			if err != nil {
+				return errors.Wrapf(err, "error initializing cas backend %s", name)
+			}
+			// Get root certificate from CAS.
+			if getter, ok := srv.(casapi.CertificateAuthorityGetter); ok {
+				resp, err := getter.GetCertificateAuthority(&casapi.GetCertificateAuthorityRequest{
+					Name: options.CertificateAuthority,
+				})
+				if err != nil {
+					return errors.Wrapf(err, "error initializing cas backend %s", name)
+				}
+				if !containsCertificate(a.rootX509Certs, resp.RootCertificate) {
+					a.rootX509Certs = append(a.rootX509Certs, resp.RootCertificate)
+				}
+				a.intermediateX509Certs = append(a.intermediateX509Certs, resp.IntermediateCertificates...)
+			}
+			a.x509CAServices[name] = srv
+		}
+	}
+
+	// Apply the rate limits and circuit breakers of the X.509 CA Services.
+	if err := a.initX509CALimiters(); err != nil {
+		return err
+	}
+
 	for _, crt := range a.rootX509Certs {
 		sum := sha256.Sum256(crt.Raw)
 		a.certificates.Store(hex.EncodeToString(sum[:]), crt)
@@ -492,6 +611,18 @@ func (a *Authority) init() error {
 		a.certificates.Store(hex.EncodeToString(sum[:]), crt)
 	}
 
+	// Read alternate chains, e.g., the intermediates cross-signed by a new
+	// root.
+	if len(a.alternateX509Chains) == 0 {
+		for _, path := range a.config.AlternateChains {
+			crts, err := pemutil.ReadCertificateBundle(path)
+			if err != nil {
+				return err
+			}
+			a.alternateX509Chains = append(a.alternateX509Chains, crts)
+		}
+	}
+
 	// Initialize HTTPClient with all root certs
 	clientRoots := make([]*x509.Certificate, 0, len(a.rootX509Certs)+len(a.federatedX509Certs))
 	clientRoots = append(clientRoots, a.rootX509Certs...)
@@ -635,6 +766,12 @@ func (a *Authority) init() error {
 					if err := a.adminDB.CreateProvisioner(ctx, lp); err != nil {
 						return admin.WrapErrorISE(err, "error creating provisioner %q while migrating", p.GetName())
 					}
+					if err := a.migrateProvisionerState(ctx, p, lp.Id); err != nil {
+						return admin.WrapErrorISE(err, "error migrating state of provisioner %q", p.GetName())
+					}
+					if err := a.migrateProvisionerKeys(ctx, p, lp.Id); err != nil {
+						return admin.WrapErrorISE(err, "error migrating keys of provisioner %q", p.GetName())
+					}
 
 					// Mark the first JWK provisioner, so that it can be used for administration purposes
 					if firstJWKProvisioner == nil && lp.Type == linkedca.Provisioner_JWK {
@@ -820,12 +957,36 @@ func (a *Authority) init() error {
 		if v := a.config.CRL.CacheDuration; v == nil || v.Duration <= 0 {
 			a.config.CRL.CacheDuration = config.DefaultCRLCacheDuration
 		}
+		if d := a.config.CRL.Delta; d.IsEnabled() && (d.CacheDuration == nil || d.CacheDuration.Duration <= 0) {
+			d.CacheDuration = config.DefaultDeltaCRLCacheDuration
+		}
+		// Load the CRL signing delegate
+		if err := a.initCRLSigner(); err != nil {
+			return err
+		}
 		// Start CRL generator
 		if err := a.startCRLGenerator(); err != nil {
 			return err
 		}
 	}
 
+	// Initialize the OCSP responder.
+	if a.config.OCSP.IsEnabled() {
+		if v := a.config.OCSP.CacheDuration; v == nil || v.Duration <= 0 {
+			a.config.OCSP.CacheDuration = config.DefaultOCSPCacheDuration
+		}
+		if err := a.initOCSP(); err != nil {
+			return err
+		}
+	}
+
+	// Start the export pipeline.
+	if a.config.Export != nil && a.exporter == nil {
+		if a.exporter, err = export.New(ctx, a.config.Export); err != nil {
+			return err
+		}
+	}
+
 	// JWT numeric dates are seconds.
 	a.startTime = time.Now().Truncate(time.Second)
 	// Set flag indicating that initialization has been completed, and should
@@ -868,6 +1029,96 @@ func (a *Authority) GetConfig() *config.Config {
 	return a.config
 }
 
+// CheckHealth returns an error if the service used to sign X.509 certificates
+// reports that it is not healthy, e.g., if the upstream CA in an RA or the KMS
+// is not reachable.
+func (a *Authority) CheckHealth(ctx context.Context) error {
+	if hc, ok := a.x509CAService.(casapi.HealthChecker); ok {
+		if err := hc.CheckHealth(ctx); err != nil {
+			return err
+		}
+	}
+	// Check also the CAS backends used by provisioners.
+	for name, srv := range a.x509CAServices {
+		if hc, ok := srv.(casapi.HealthChecker); ok {
+			if err := hc.CheckHealth(ctx); err != nil {
+				return errors.Wrapf(err, "cas backend %s is not healthy", name)
+			}
+		}
+	}
+	return nil
+}
+
+// containsCertificate returns true if the given certificate is in the list.
+func containsCertificate(certs []*x509.Certificate, cert *x509.Certificate) bool {
+	for _, crt := range certs {
+		if crt.Equal(cert) {
+			return true
+		}
+	}
+	return false
+}
+
+// getX509CAService returns the X.509 CA Service used to sign certificates
+// authorized by the given provisioner. It returns the default service if the
+// provisioner is not routed to a different CAS backend.
+func (a *Authority) getX509CAService(p provisioner.Interface) cas.CertificateAuthorityService {
+	name := a.getX509CAServiceName(p)
+	if srv, ok := a.x509CALimiters[name]; ok {
+		return srv
+	}
+	if name != "" {
+		return a.x509CAServices[name]
+	}
+	return a.x509CAService
+}
+
+// initX509CALimiters wraps the X.509 CA Services that define a rate limit or a
+// circuit breaker. The wrapped services are only used to sign and renew
+// certificates, the optional interfaces are still accessed using the original
+// ones. The default service uses the empty name.
+func (a *Authority) initX509CALimiters() error {
+	a.x509CALimiters = make(map[string]cas.CertificateAuthorityService)
+	add := func(name string, srv cas.CertificateAuthorityService, o *casapi.Options) error {
+		if srv == nil || o == nil || (o.RateLimit == nil && o.CircuitBreaker == nil) {
+			return nil
+		}
+		limiter, err := ratelimit.New(srv, o.RateLimit, o.CircuitBreaker)
+		if err != nil {
+			if name == "" {
+				return errors.Wrap(err, "error initializing cas")
+			}
+			return errors.Wrapf(err, "error initializing cas backend %s", name)
+		}
+		a.x509CALimiters[name] = limiter
+		return nil
+	}
+
+	if err := add("", a.x509CAService, a.config.AuthorityConfig.Options); err != nil {
+		return err
+	}
+	for name, srv := range a.x509CAServices {
+		if err := add(name, srv, a.config.AuthorityConfig.CASBackends[name]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getX509CAServiceName returns the name of the CAS backend used to sign
+// certificates authorized by the given provisioner. It returns an empty string
+// if the default service is used.
+func (a *Authority) getX509CAServiceName(p provisioner.Interface) string {
+	if p != nil {
+		if name, ok := a.x509CAServiceRoutes[p.GetName()]; ok {
+			if _, ok := a.x509CAServices[name]; ok {
+				return name
+			}
+		}
+	}
+	return ""
+}
+
 // GetInfo returns information about the authority.
 func (a *Authority) GetInfo() Info {
 	ai := Info{
@@ -894,12 +1145,16 @@ func (a *Authority) IsAdminAPIEnabled() bool {
 func (a *Authority) Shutdown() error {
 	if a.crlTicker != nil {
 		a.crlTicker.Stop()
+		if a.crlDeltaTicker != nil {
+			a.crlDeltaTicker.Stop()
+		}
 		close(a.crlStopper)
 	}
 
 	if err := a.keyManager.Close(); err != nil {
 		log.Printf("error closing the key manager: %v", err)
 	}
+	a.closeExporter()
 	return a.db.Shutdown()
 }
 
@@ -907,6 +1162,9 @@ func (a *Authority) Shutdown() error {
 func (a *Authority) CloseForReload() {
 	if a.crlTicker != nil {
 		a.crlTicker.Stop()
+		if a.crlDeltaTicker != nil {
+			a.crlDeltaTicker.Stop()
+		}
 		close(a.crlStopper)
 	}
 
@@ -916,6 +1174,7 @@ func (a *Authority) CloseForReload() {
 	if client, ok := a.adminDB.(*linkedCaClient); ok {
 		client.Stop()
 	}
+	a.closeExporter()
 }
 
 // IsRevoked returns whether or not a certificate has been
@@ -966,10 +1225,18 @@ func (a *Authority) startCRLGenerator() error {
 
 	// Check that there is a valid CRL in the DB right now. If it doesn't exist
 	// or is expired, generate one now
-	_, ok := a.db.(db.CertificateRevocationListDB)
+	crlDB, ok := a.db.(db.CertificateRevocationListDB)
 	if !ok {
 		return errors.Errorf("CRL Generation requested, but database does not support CRL generation")
 	}
+	if a.crlPartitions() > 0 || a.config.CRL.Delta.IsEnabled() {
+		if _, ok := a.db.(db.CertificateRevocationListsDB); !ok {
+			return errors.Errorf("Partitioned or delta CRL generation requested, but database does not support it")
+		}
+	}
+	if err := a.checkCRLPartitions(crlDB); err != nil {
+		return err
+	}
 
 	// Always create a new CRL on startup in case the CA has been down and the
 	// time to next expected CRL update is less than the cache duration.
@@ -980,6 +1247,14 @@ func (a *Authority) startCRLGenerator() error {
 	a.crlStopper = make(chan struct{}, 1)
 	a.crlTicker = time.NewTicker(a.config.CRL.TickerDuration())
 
+	// The delta ticker channel is nil, and never ready, if delta CRLs are not
+	// enabled.
+	var deltaC <-chan time.Time
+	if a.config.CRL.Delta.IsEnabled() {
+		a.crlDeltaTicker = time.NewTicker(a.config.CRL.Delta.TickerDuration())
+		deltaC = a.crlDeltaTicker.C
+	}
+
 	go func() {
 		for {
 			select {
@@ -988,6 +1263,10 @@ func (a *Authority) startCRLGenerator() error {
 				if err := a.GenerateCertificateRevocationList(); err != nil {
 					log.Printf("error regenerating the CRL: %v", err)
 				}
+			case <-deltaC:
+				if err := a.GenerateDeltaCertificateRevocationList(); err != nil {
+					log.Printf("error regenerating the delta CRL: %v", err)
+				}
 			case <-a.crlStopper:
 				return
 			}
@@ -19,6 +19,8 @@ import (
 	"github.com/smallstep/assert"
 	"github.com/smallstep/certificates/authority/config"
 	"github.com/smallstep/certificates/authority/provisioner"
+	casapi "github.com/smallstep/certificates/cas/apiv1"
+	"github.com/smallstep/certificates/cas/ratelimit"
 	"github.com/smallstep/certificates/db"
 	"go.step.sm/crypto/jose"
 	"go.step.sm/crypto/minica"
@@ -464,6 +466,142 @@ func TestAuthority_CloseForReload(t *testing.T) {
 	}
 }
 
+type mockHealthCAS struct {
+	casapi.CertificateAuthorityService
+	err error
+}
+
+func (m *mockHealthCAS) CheckHealth(context.Context) error {
+	return m.err
+}
+
+func TestAuthority_CheckHealth(t *testing.T) {
+	a := testAuthority(t)
+	assert.NoError(t, a.CheckHealth(context.Background()))
+
+	a.x509CAService = &mockHealthCAS{}
+	assert.NoError(t, a.CheckHealth(context.Background()))
+
+	a.x509CAService = &mockHealthCAS{err: errors.New("force")}
+	assert.Error(t, a.CheckHealth(context.Background()))
+
+	a.x509CAService = &mockHealthCAS{}
+	a.x509CAServices = map[string]casapi.CertificateAuthorityService{
+		"routed": &mockHealthCAS{err: errors.New("force")},
+	}
+	assert.Error(t, a.CheckHealth(context.Background()))
+}
+
+type mockRoutedCAS struct {
+	mockHealthCAS
+	root *x509.Certificate
+}
+
+func (m *mockRoutedCAS) GetCertificateAuthority(*casapi.GetCertificateAuthorityRequest) (*casapi.GetCertificateAuthorityResponse, error) {
+	return &casapi.GetCertificateAuthorityResponse{
+		RootCertificate: m.root,
+	}, nil
+}
+
+func TestAuthority_casRoutes(t *testing.T) {
+	ca, err := minica.New()
+	assert.FatalError(t, err)
+	routed := &mockRoutedCAS{root: ca.Root}
+	casapi.Register("routedcas", func(context.Context, casapi.Options) (casapi.CertificateAuthorityService, error) {
+		return routed, nil
+	})
+
+	maxjwk, err := jose.ReadKey("testdata/secrets/max_pub.jwk")
+	assert.FatalError(t, err)
+	clijwk, err := jose.ReadKey("testdata/secrets/step_cli_key_pub.jwk")
+	assert.FatalError(t, err)
+	c := &Config{
+		Address:          "127.0.0.1:443",
+		Root:             []string{"testdata/certs/root_ca.crt"},
+		IntermediateCert: "testdata/certs/intermediate_ca.crt",
+		IntermediateKey:  "testdata/secrets/intermediate_ca_key",
+		DNSNames:         []string{"example.com"},
+		Password:         "pass",
+		AuthorityConfig: &AuthConfig{
+			Provisioners: provisioner.List{
+				&provisioner.JWK{Name: "Max", Type: "JWK", Key: maxjwk},
+				&provisioner.JWK{Name: "step-cli", Type: "JWK", Key: clijwk},
+			},
+			CASBackends: map[string]*casapi.Options{
+				"routed": {Type: "routedcas"},
+			},
+			CASRoutes: map[string]string{
+				"step-cli": "routed",
+			},
+		},
+	}
+	a, err := New(c)
+	assert.FatalError(t, err)
+
+	// The root of the routed CAS is added to the configured roots.
+	assert.Len(t, 2, a.rootX509Certs)
+	assert.Equals(t, ca.Root, a.rootX509Certs[1])
+
+	p, err := a.LoadProvisionerByName("Max")
+	assert.FatalError(t, err)
+	assert.True(t, a.getX509CAService(p) == a.x509CAService)
+	p, err = a.LoadProvisionerByName("step-cli")
+	assert.FatalError(t, err)
+	assert.True(t, a.getX509CAService(p) == routed)
+	assert.True(t, a.getX509CAService(nil) == a.x509CAService)
+
+	assert.NoError(t, a.CheckHealth(context.Background()))
+	routed.err = errors.New("force")
+	assert.Error(t, a.CheckHealth(context.Background()))
+}
+
+func TestAuthority_initX509CALimiters(t *testing.T) {
+	defaultCAS := &mockHealthCAS{}
+	routed := &mockHealthCAS{}
+	other := &mockHealthCAS{}
+	a := &Authority{
+		config: &Config{
+			AuthorityConfig: &AuthConfig{
+				Options: &casapi.Options{
+					RateLimit: &casapi.RateLimitOptions{
+						RateLimit: casapi.RateLimit{Requests: 10},
+					},
+				},
+				CASBackends: map[string]*casapi.Options{
+					"routed": {Type: "routedcas", CircuitBreaker: &casapi.CircuitBreakerOptions{}},
+					"other":  {Type: "routedcas"},
+				},
+			},
+		},
+		x509CAService: defaultCAS,
+		x509CAServices: map[string]casapi.CertificateAuthorityService{
+			"routed": routed,
+			"other":  other,
+		},
+		x509CAServiceRoutes: map[string]string{
+			"step-cli": "routed",
+			"Max":      "other",
+		},
+	}
+	assert.FatalError(t, a.initX509CALimiters())
+
+	srv, ok := a.getX509CAService(nil).(*ratelimit.CertificateAuthorityService)
+	if assert.True(t, ok) {
+		assert.True(t, srv.Unwrap() == defaultCAS)
+	}
+	srv, ok = a.getX509CAService(&provisioner.JWK{Name: "step-cli"}).(*ratelimit.CertificateAuthorityService)
+	if assert.True(t, ok) {
+		assert.True(t, srv.Unwrap() == routed)
+	}
+	assert.True(t, a.getX509CAService(&provisioner.JWK{Name: "Max"}) == other)
+
+	// Invalid options
+	a.config.AuthorityConfig.CASBackends["other"].RateLimit = &casapi.RateLimitOptions{
+		RateLimit: casapi.RateLimit{Requests: 1, Period: "foo"},
+	}
+	assert.Error(t, a.initX509CALimiters())
+}
+
 func testScepAuthority(t *testing.T, opts ...Option) *Authority {
 	p := provisioner.List{
 		&provisioner.SCEP{
@@ -587,3 +725,40 @@ func TestAuthority_GetID(t *testing.T) {
 		})
 	}
 }
+
+func TestAuthority_ReloadProvisioners(t *testing.T) {
+	a := testAuthority(t)
+	key, err := jose.ReadKey("testdata/secrets/max_pub.jwk")
+	assert.FatalError(t, err)
+
+	// Fails with an invalid configuration.
+	assert.Error(t, a.ReloadProvisioners(context.Background(), &config.Config{}))
+
+	// Fails with duplicated provisioners, keeping the original ones.
+	err = a.ReloadProvisioners(context.Background(), &config.Config{
+		AuthorityConfig: &config.AuthConfig{
+			Provisioners: provisioner.List{
+				&provisioner.JWK{Name: "new", Type: "JWK", Key: key},
+				&provisioner.JWK{Name: "new", Type: "JWK", Key: key},
+			},
+		},
+	})
+	assert.Error(t, err)
+	_, err = a.LoadProvisionerByName("Max")
+	assert.FatalError(t, err)
+	assert.Equals(t, 6, len(a.config.AuthorityConfig.Provisioners))
+
+	// Replaces the provisioners.
+	assert.FatalError(t, a.ReloadProvisioners(context.Background(), &config.Config{
+		AuthorityConfig: &config.AuthConfig{
+			Provisioners: provisioner.List{
+				&provisioner.JWK{Name: "new", Type: "JWK", Key: key},
+			},
+		},
+	}))
+	_, err = a.LoadProvisionerByName("new")
+	assert.FatalError(t, err)
+	_, err = a.LoadProvisionerByName("Max")
+	assert.Error(t, err)
+	assert.Equals(t, 1, len(a.config.AuthorityConfig.Provisioners))
+}
@@ -259,6 +259,9 @@ func (a *Authority) authorizeSign(ctx context.Context, token string) ([]provisio
 	if err != nil {
 		return nil, errs.Wrap(http.StatusInternalServerError, err, "authority.authorizeSign")
 	}
+	if err := a.checkTokenRateLimit(ctx, p); err != nil {
+		return nil, err
+	}
 	return signOpts, nil
 }
 
@@ -282,12 +285,17 @@ func (a *Authority) authorizeRevoke(ctx context.Context, token string) error {
 	if err := p.AuthorizeRevoke(ctx, token); err != nil {
 		return errs.Wrap(http.StatusInternalServerError, err, "authority.authorizeRevoke")
 	}
+	if err := a.checkTokenRateLimit(ctx, p); err != nil {
+		return err
+	}
 	return nil
 }
 
 // authorizeRenew locates the provisioner (using the provisioner extension in the cert), and checks
 // if for the configured provisioner, the renewal is enabled or not. If the
-// extra extension cannot be found, authorize the renewal by default.
+// extra extension cannot be found, authorize the renewal by default. If the
+// provisioner requires it, the certificate must also be active in the
+// certificate inventory.
 //
 // TODO(mariano): should we authorize by default?
 func (a *Authority) authorizeRenew(ctx context.Context, cert *x509.Certificate) (provisioner.Interface, error) {
@@ -309,9 +317,16 @@ func (a *Authority) authorizeRenew(ctx context.Context, cert *x509.Certificate)
 		// returns the noop provisioner if this happens, and it allows
 		// certificate renewals.
 		if p, ok = a.provisioners.LoadByCertificate(cert); !ok {
-			return nil, errs.Unauthorized("authority.authorizeRenew: provisioner not found", opts...)
+			// The provisioner has been deleted, its renewal policy defines
+			// if the certificate can be renewed.
+			if p, err = a.loadDeletedProvisioner(cert); err != nil {
+				return nil, err
+			}
 		}
 	}
+	if err := a.checkRenewalInventory(p, serial); err != nil {
+		return nil, err
+	}
 	if err := p.AuthorizeRenew(ctx, cert); err != nil {
 		return nil, errs.Wrap(http.StatusInternalServerError, err, "authority.authorizeRenew", opts...)
 	}
@@ -352,6 +367,9 @@ func (a *Authority) authorizeSSHSign(ctx context.Context, token string) ([]provi
 	if err != nil {
 		return nil, errs.Wrap(http.StatusUnauthorized, err, "authority.authorizeSSHSign")
 	}
+	if err := a.checkTokenRateLimit(ctx, p); err != nil {
+		return nil, err
+	}
 	return signOpts, nil
 }
 
@@ -366,6 +384,9 @@ func (a *Authority) authorizeSSHRenew(ctx context.Context, token string) (*ssh.C
 	if err != nil {
 		return nil, errs.Wrap(http.StatusInternalServerError, err, "authority.authorizeSSHRenew")
 	}
+	if err := a.checkTokenRateLimit(ctx, p); err != nil {
+		return nil, err
+	}
 	return cert, nil
 }
 
@@ -380,6 +401,9 @@ func (a *Authority) authorizeSSHRekey(ctx context.Context, token string) (*ssh.C
 	if err != nil {
 		return nil, nil, errs.Wrap(http.StatusInternalServerError, err, "authority.authorizeSSHRekey")
 	}
+	if err := a.checkTokenRateLimit(ctx, p); err != nil {
+		return nil, nil, err
+	}
 	return cert, signOpts, nil
 }
 
@@ -393,6 +417,9 @@ func (a *Authority) authorizeSSHRevoke(ctx context.Context, token string) error
 	if err = p.AuthorizeSSHRevoke(ctx, token); err != nil {
 		return errs.Wrap(http.StatusInternalServerError, err, "authority.authorizeSSHRevoke")
 	}
+	if err := a.checkTokenRateLimit(ctx, p); err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -2,9 +2,12 @@ package config
 
 import (
 	"bytes"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"net"
+	"net/mail"
+	"net/url"
 	"os"
 	"time"
 
@@ -17,11 +20,15 @@ import (
 	"github.com/smallstep/certificates/authority/provisioner"
 	cas "github.com/smallstep/certificates/cas/apiv1"
 	"github.com/smallstep/certificates/db"
+	"github.com/smallstep/certificates/export"
 	"github.com/smallstep/certificates/templates"
 )
 
 const (
 	legacyAuthority = "step-certificate-authority"
+
+	// MaxCRLPartitions is the maximum number of CRL partitions.
+	MaxCRLPartitions = 1024
 )
 
 var (
@@ -41,9 +48,20 @@ var (
 	DefaultDisableSmallstepExtensions = false
 	// DefaultCRLCacheDuration is the default cache duration for the CRL.
 	DefaultCRLCacheDuration = &provisioner.Duration{Duration: 24 * time.Hour}
+	// DefaultDeltaCRLCacheDuration is the default cache duration for the
+	// delta CRLs.
+	DefaultDeltaCRLCacheDuration = &provisioner.Duration{Duration: time.Hour}
 	// DefaultCRLExpiredDuration is the default duration in which expired
 	// certificates will remain in the CRL after expiration.
 	DefaultCRLExpiredDuration = time.Hour
+	// DefaultOCSPCacheDuration is the default validity of the OCSP responses.
+	DefaultOCSPCacheDuration = &provisioner.Duration{Duration: time.Hour}
+	// DefaultACMEGCInterval is the default time between two runs of the ACME
+	// garbage collector.
+	DefaultACMEGCInterval = time.Hour
+	// DefaultACMEGCRetention is the default time expired ACME objects are kept
+	// before being removed by the garbage collector.
+	DefaultACMEGCRetention = 24 * time.Hour
 	// GlobalProvisionerClaims is the default duration that expired certificates
 	// remain in the CRL after expiration.
 	GlobalProvisionerClaims = provisioner.Claims{
@@ -65,31 +83,75 @@ var (
 
 // Config represents the CA configuration and it's mapped to a JSON object.
 type Config struct {
-	Root             multiString          `json:"root"`
-	FederatedRoots   []string             `json:"federatedRoots"`
-	IntermediateCert string               `json:"crt"`
-	IntermediateKey  string               `json:"key"`
-	Address          string               `json:"address"`
-	InsecureAddress  string               `json:"insecureAddress"`
-	DNSNames         []string             `json:"dnsNames"`
-	KMS              *kms.Options         `json:"kms,omitempty"`
-	SSH              *SSHConfig           `json:"ssh,omitempty"`
-	Logger           json.RawMessage      `json:"logger,omitempty"`
-	DB               *db.Config           `json:"db,omitempty"`
-	Monitoring       json.RawMessage      `json:"monitoring,omitempty"`
-	AuthorityConfig  *AuthConfig          `json:"authority,omitempty"`
-	TLS              *TLSOptions          `json:"tls,omitempty"`
-	Password         string               `json:"password,omitempty"`
-	Templates        *templates.Templates `json:"templates,omitempty"`
-	CommonName       string               `json:"commonName,omitempty"`
-	CRL              *CRLConfig           `json:"crl,omitempty"`
-	MetricsAddress   string               `json:"metricsAddress,omitempty"`
-	SkipValidation   bool                 `json:"-"`
+	Root              multiString           `json:"root"`
+	FederatedRoots    []string              `json:"federatedRoots"`
+	IntermediateCert  string                `json:"crt"`
+	IntermediateKey   string                `json:"key"`
+	AlternateChains   []string              `json:"alternateChains,omitempty"`
+	Address           string                `json:"address"`
+	InsecureAddress   string                `json:"insecureAddress"`
+	DNSNames          []string              `json:"dnsNames"`
+	KMS               *kms.Options          `json:"kms,omitempty"`
+	SigningPool       *SigningPoolConfig    `json:"signingPool,omitempty"`
+	Reload            *ReloadConfig         `json:"reload,omitempty"`
+	SSH               *SSHConfig            `json:"ssh,omitempty"`
+	Logger            json.RawMessage       `json:"logger,omitempty"`
+	DB                *db.Config            `json:"db,omitempty"`
+	Monitoring        json.RawMessage       `json:"monitoring,omitempty"`
+	AuthorityConfig   *AuthConfig           `json:"authority,omitempty"`
+	TLS               *TLSOptions           `json:"tls,omitempty"`
+	Password          string                `json:"password,omitempty"`
+	EncryptedPassword *EncryptedPassword    `json:"encryptedPassword,omitempty"`
+	Templates         *templates.Templates  `json:"templates,omitempty"`
+	CommonName        string                `json:"commonName,omitempty"`
+	CRL               *CRLConfig            `json:"crl,omitempty"`
+	OCSP              *OCSPConfig           `json:"ocsp,omitempty"`
+	ACMEGC            *ACMEGCConfig         `json:"acmeGC,omitempty"`
+	ACMEValidation    *ACMEValidationConfig `json:"acmeValidation,omitempty"`
+	ACMEEmail         *ACMEEmailConfig      `json:"acmeEmail,omitempty"`
+	Export            *export.Config        `json:"export,omitempty"`
+	MetricsAddress    string                `json:"metricsAddress,omitempty"`
+	SkipValidation    bool                  `json:"-"`
 
 	// Keeps record of the filename the Config is read from
 	loadedFromFilepath string
 }
 
+// EncryptedPassword represents a password encrypted with an RSA key in a KMS,
+// e.g., CloudKMS or a PKCS #11 module. The password is decrypted at startup
+// and used to decrypt the intermediate and SSH keys, this way software keys
+// can be kept encrypted at rest without storing the password on disk.
+//
+// The password must be encrypted using RSA-OAEP with SHA-256, and encoded
+// using standard base64. In CloudKMS, the key must use one of the
+// RSA_DECRYPT_OAEP_*_SHA256 algorithms.
+type EncryptedPassword struct {
+	// KMS is the configuration of the KMS with the decryption key. If it's
+	// not set, the KMS is derived from the key URI, or softkms is used if the
+	// key is a file.
+	KMS *kms.Options `json:"kms,omitempty"`
+	// Key is the name of the decryption key, e.g., a KMS URI.
+	Key string `json:"key"`
+	// Ciphertext is the base64 encoded encrypted password.
+	Ciphertext string `json:"ciphertext"`
+}
+
+// Validate validates the encrypted password configuration.
+func (p *EncryptedPassword) Validate() error {
+	switch {
+	case p == nil:
+		return nil
+	case p.Key == "":
+		return errors.New("encryptedPassword.key cannot be empty")
+	case p.Ciphertext == "":
+		return errors.New("encryptedPassword.ciphertext cannot be empty")
+	}
+	if _, err := base64.StdEncoding.DecodeString(p.Ciphertext); err != nil {
+		return errors.Wrap(err, "error decoding encryptedPassword.ciphertext")
+	}
+	return p.KMS.Validate()
+}
+
 // CRLConfig represents config options for CRL generation
 type CRLConfig struct {
 	Enabled          bool                  `json:"enabled"`
@@ -97,6 +159,52 @@ type CRLConfig struct {
 	CacheDuration    *provisioner.Duration `json:"cacheDuration,omitempty"`
 	RenewPeriod      *provisioner.Duration `json:"renewPeriod,omitempty"`
 	IDPurl           string                `json:"idpURL,omitempty"`
+	// Certificate is the path to the certificate of a CRL signing delegate.
+	// It must be issued by the CA intermediate and have the cRLSign key
+	// usage. If it's not set, CRLs are signed by the intermediate.
+	Certificate string `json:"crt,omitempty"`
+	// Key is the private key of the CRL signing delegate. It can be a file or
+	// a KMS URI.
+	Key string `json:"key,omitempty"`
+	// Partitions is the number of CRL partitions. If it's greater than 1,
+	// the revoked certificates are distributed by serial number in the
+	// partitions, served in /crl/<n>, and each certificate points to the
+	// partition that includes it. The full CRL is still served in /crl.
+	// Partitions can be enabled on an existing CA, but the number cannot be
+	// changed once the partitioned CRLs have been generated.
+	Partitions int `json:"partitions,omitempty"`
+	// Delta configures the generation of delta CRLs.
+	Delta *DeltaCRLConfig `json:"delta,omitempty"`
+}
+
+// DeltaCRLConfig configures the delta CRLs. A delta CRL only contains the
+// certificates revoked after its base CRL was generated, and it's served in
+// /crl/delta, or /crl/<n>/delta for partitions. Delta CRLs are generated
+// periodically and after each revocation if crl.generateOnRevoke is set, in
+// which case the base CRLs are only generated periodically.
+type DeltaCRLConfig struct {
+	Enabled       bool                  `json:"enabled"`
+	CacheDuration *provisioner.Duration `json:"cacheDuration,omitempty"`
+	RenewPeriod   *provisioner.Duration `json:"renewPeriod,omitempty"`
+}
+
+// IsEnabled returns if the delta CRLs are enabled.
+func (c *DeltaCRLConfig) IsEnabled() bool {
+	return c != nil && c.Enabled
+}
+
+// TickerDuration returns the renewal ticker duration of the delta CRLs. This
+// is set by renewPeriod, if it is not set is ~2/3 of cacheDuration.
+func (c *DeltaCRLConfig) TickerDuration() time.Duration {
+	if !c.IsEnabled() {
+		return 0
+	}
+
+	if c.RenewPeriod != nil && c.RenewPeriod.Duration > 0 {
+		return c.RenewPeriod.Duration
+	}
+
+	return (c.CacheDuration.Duration / 3) * 2
 }
 
 // IsEnabled returns if the CRL is enabled.
@@ -123,9 +231,284 @@ func (c *CRLConfig) Validate() error {
 		return errors.New("crl.cacheDuration must be greater than or equal to crl.renewPeriod")
 	}
 
+	if c.Certificate != "" && c.Key == "" {
+		return errors.New("crl.key cannot be empty if crl.crt is set")
+	}
+
+	if c.Certificate == "" && c.Key != "" {
+		return errors.New("crl.crt cannot be empty if crl.key is set")
+	}
+
+	if c.Partitions < 0 || c.Partitions > MaxCRLPartitions {
+		return errors.Errorf("crl.partitions must be between 0 and %d", MaxCRLPartitions)
+	}
+
+	if d := c.Delta; d != nil {
+		if d.CacheDuration != nil && d.CacheDuration.Duration < 0 {
+			return errors.New("crl.delta.cacheDuration must be greater than or equal to 0")
+		}
+
+		if d.RenewPeriod != nil && d.RenewPeriod.Duration < 0 {
+			return errors.New("crl.delta.renewPeriod must be greater than or equal to 0")
+		}
+
+		if d.RenewPeriod != nil && d.CacheDuration != nil &&
+			d.RenewPeriod.Duration > d.CacheDuration.Duration {
+			return errors.New("crl.delta.cacheDuration must be greater than or equal to crl.delta.renewPeriod")
+		}
+
+		if d.CacheDuration != nil && c.CacheDuration != nil &&
+			d.CacheDuration.Duration > c.CacheDuration.Duration {
+			return errors.New("crl.cacheDuration must be greater than or equal to crl.delta.cacheDuration")
+		}
+	}
+
+	return nil
+}
+
+// OCSPConfig configures the built-in OCSP responder. The responses are signed
+// with a dedicated responder certificate issued by the CA intermediate. If a
+// certificate and key are not configured, the CA generates a responder
+// certificate and rotates it before it expires.
+type OCSPConfig struct {
+	Enabled bool `json:"enabled"`
+	// URL is the responder URL added to the authority information access
+	// extension of the issued certificates. It defaults to the /1.0/ocsp
+	// endpoint of the CA.
+	URL string `json:"url,omitempty"`
+	// Certificate is the path to the responder certificate. It must be issued
+	// by the CA intermediate and include the OCSPSigning extended key usage.
+	Certificate string `json:"crt,omitempty"`
+	// Key is the responder private key. It can be a file or a KMS URI, and
+	// it must be an RSA or ECDSA key.
+	Key string `json:"key,omitempty"`
+	// CacheDuration is the validity of the responses, it defaults to 1h.
+	// Responses without a nonce are cached for half of this time. Each
+	// instance of the CA has its own cache, and cached responses are checked
+	// against the revocations in the database.
+	CacheDuration *provisioner.Duration `json:"cacheDuration,omitempty"`
+}
+
+// IsEnabled returns if the OCSP responder is enabled.
+func (c *OCSPConfig) IsEnabled() bool {
+	return c != nil && c.Enabled
+}
+
+// Validate validates the OCSP configuration.
+func (c *OCSPConfig) Validate() error {
+	switch {
+	case c == nil:
+		return nil
+	case c.CacheDuration != nil && c.CacheDuration.Duration < 0:
+		return errors.New("ocsp.cacheDuration must be greater than or equal to 0")
+	case c.Certificate != "" && c.Key == "":
+		return errors.New("ocsp.key cannot be empty if ocsp.crt is set")
+	case c.Certificate == "" && c.Key != "":
+		return errors.New("ocsp.crt cannot be empty if ocsp.key is set")
+	}
+	if c.URL != "" {
+		u, err := url.Parse(c.URL)
+		if err != nil {
+			return errors.Wrap(err, "error parsing ocsp.url")
+		}
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return errors.Errorf("ocsp.url %s is not a valid http or https URL", c.URL)
+		}
+	}
+	return nil
+}
+
+// ACMEGCConfig configures the garbage collector of ACME objects. When enabled,
+// the orders that expired without a certificate, the expired authorizations
+// with their challenges, the old nonces, and the expired rate limit counters
+// are periodically removed from the database.
+type ACMEGCConfig struct {
+	Enabled bool `json:"enabled"`
+	// Interval is the time between two runs of the garbage collector, it
+	// defaults to 1h.
+	Interval *provisioner.Duration `json:"interval,omitempty"`
+	// Retention is the time the expired objects are kept before being
+	// removed, it defaults to 24h. Nonces are removed after this time since
+	// their creation.
+	Retention *provisioner.Duration `json:"retention,omitempty"`
+}
+
+// IsEnabled returns if the ACME garbage collector is enabled.
+func (c *ACMEGCConfig) IsEnabled() bool {
+	return c != nil && c.Enabled
+}
+
+// GetInterval returns the time between two runs of the garbage collector.
+func (c *ACMEGCConfig) GetInterval() time.Duration {
+	if c == nil || c.Interval == nil || c.Interval.Duration == 0 {
+		return DefaultACMEGCInterval
+	}
+	return c.Interval.Duration
+}
+
+// GetRetention returns the time the expired objects are kept before being
+// removed.
+func (c *ACMEGCConfig) GetRetention() time.Duration {
+	if c == nil || c.Retention == nil || c.Retention.Duration == 0 {
+		return DefaultACMEGCRetention
+	}
+	return c.Retention.Duration
+}
+
+// Validate validates the ACME garbage collector configuration.
+func (c *ACMEGCConfig) Validate() error {
+	switch {
+	case c == nil:
+		return nil
+	case c.Interval != nil && c.Interval.Duration < 0:
+		return errors.New("acmeGC.interval must be greater than or equal to 0")
+	case c.Retention != nil && c.Retention.Duration < 0:
+		return errors.New("acmeGC.retention must be greater than or equal to 0")
+	default:
+		return nil
+	}
+}
+
+// ACMEValidationConfig configures the connections used to validate the
+// http-01 and tls-alpn-01 ACME challenges. It allows to validate challenges in
+// segmented networks, where the targets are not directly reachable on the
+// standard ports 80 and 443.
+type ACMEValidationConfig struct {
+	// SourceAddress is the local IP address used to connect to the challenge
+	// targets or to the proxy.
+	SourceAddress string `json:"sourceAddress,omitempty"`
+	// HTTP01Port is the port used to validate http-01 challenges, it defaults
+	// to 80.
+	HTTP01Port int `json:"http01Port,omitempty"`
+	// TLSALPN01Port is the port used to validate tls-alpn-01 challenges, it
+	// defaults to 443.
+	TLSALPN01Port int `json:"tlsALPN01Port,omitempty"`
+	// Proxy is the URL of the HTTP, HTTPS or SOCKS5 proxy used to reach the
+	// challenge targets, e.g., "socks5://proxy.internal:1080". If not set, the
+	// proxy in the environment is used for http-01 challenges.
+	Proxy string `json:"proxy,omitempty"`
+}
+
+// Validate validates the ACME validation configuration.
+func (c *ACMEValidationConfig) Validate() error {
+	if c == nil {
+		return nil
+	}
+	if c.SourceAddress != "" && net.ParseIP(c.SourceAddress) == nil {
+		return errors.Errorf("acmeValidation.sourceAddress %q is not a valid IP address", c.SourceAddress)
+	}
+	if c.HTTP01Port < 0 || c.HTTP01Port > 65535 {
+		return errors.Errorf("acmeValidation.http01Port %d is not a valid port", c.HTTP01Port)
+	}
+	if c.TLSALPN01Port < 0 || c.TLSALPN01Port > 65535 {
+		return errors.Errorf("acmeValidation.tlsALPN01Port %d is not a valid port", c.TLSALPN01Port)
+	}
+	if c.Proxy != "" {
+		u, err := url.Parse(c.Proxy)
+		if err != nil {
+			return errors.Wrap(err, "error parsing acmeValidation.proxy")
+		}
+		switch u.Scheme {
+		case "http", "https", "socks5", "socks5h":
+		default:
+			return errors.Errorf("acmeValidation.proxy scheme %q is not supported", u.Scheme)
+		}
+		if u.Host == "" {
+			return errors.New("acmeValidation.proxy host cannot be empty")
+		}
+	}
+	return nil
+}
+
+// ACMEEmailConfig configures the mailbox used in the email-reply-00 ACME
+// challenges (RFC 8823). The challenge emails are sent from the From address
+// using the SMTP server, and the responses, sent to the same address, are read
+// from the IMAP server.
+type ACMEEmailConfig struct {
+	From    string             `json:"from"`
+	SMTP    *EmailServerConfig `json:"smtp"`
+	IMAP    *EmailServerConfig `json:"imap"`
+	Mailbox string             `json:"mailbox,omitempty"`
+}
+
+// EmailServerConfig configures the connection to an SMTP or IMAP server. If
+// TLS is not set, STARTTLS is used if the server supports it.
+type EmailServerConfig struct {
+	Address  string `json:"address"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	TLS      bool   `json:"tls,omitempty"`
+}
+
+// Validate validates the ACME email configuration.
+func (c *ACMEEmailConfig) Validate() error {
+	if c == nil {
+		return nil
+	}
+	if _, err := mail.ParseAddress(c.From); err != nil {
+		return errors.Wrap(err, "error parsing acmeEmail.from")
+	}
+	if err := c.SMTP.validate("acmeEmail.smtp"); err != nil {
+		return err
+	}
+	return c.IMAP.validate("acmeEmail.imap")
+}
+
+func (c *EmailServerConfig) validate(name string) error {
+	if c == nil {
+		return errors.Errorf("%s cannot be empty", name)
+	}
+	if _, _, err := net.SplitHostPort(c.Address); err != nil {
+		return errors.Wrapf(err, "%s.address %q is not valid", name, c.Address)
+	}
 	return nil
 }
 
+// SigningPoolConfig limits the number of concurrent signatures made with the
+// keys in the KMS. Requests wait for a free slot for at most QueueTimeout, and
+// fail if none is available, this way a slow KMS cannot accumulate an
+// unbounded number of blocked requests.
+type SigningPoolConfig struct {
+	MaxConcurrency int                   `json:"maxConcurrency"`
+	QueueTimeout   *provisioner.Duration `json:"queueTimeout,omitempty"`
+}
+
+// Validate validates the signing pool configuration.
+func (c *SigningPoolConfig) Validate() error {
+	switch {
+	case c == nil:
+		return nil
+	case c.MaxConcurrency <= 0:
+		return errors.New("signingPool.maxConcurrency must be greater than 0")
+	case c.QueueTimeout != nil && c.QueueTimeout.Duration < 0:
+		return errors.New("signingPool.queueTimeout must be greater than or equal to 0")
+	default:
+		return nil
+	}
+}
+
+// ReloadConfig configures how the CA applies changes in the configuration
+// file. By default a SIGHUP re-initializes the whole CA. With ProvisionersOnly,
+// a SIGHUP only rebuilds the provisioners and admins, keeping the servers, the
+// keys and the ACME state intact. With Watch, the provisioners are also
+// reloaded when the configuration file changes on disk.
+type ReloadConfig struct {
+	ProvisionersOnly bool `json:"provisionersOnly,omitempty"`
+	Watch            bool `json:"watch,omitempty"`
+}
+
+// IsProvisionersOnly returns true if a SIGHUP should only reload the
+// provisioners.
+func (c *ReloadConfig) IsProvisionersOnly() bool {
+	return c != nil && c.ProvisionersOnly
+}
+
+// IsWatchEnabled returns true if the configuration file should be watched for
+// changes.
+func (c *ReloadConfig) IsWatchEnabled() bool {
+	return c != nil && c.Watch
+}
+
 // TickerDuration the renewal ticker duration. This is set by renewPeriod, of it
 // is not set is ~2/3 of cacheDuration.
 func (c *CRLConfig) TickerDuration() time.Duration {
@@ -169,6 +552,13 @@ type AuthConfig struct {
 	Backdate             *provisioner.Duration `json:"backdate,omitempty"`
 	EnableAdmin          bool                  `json:"enableAdmin,omitempty"`
 	DisableGetSSHHosts   bool                  `json:"disableGetSSHHosts,omitempty"`
+	// CASBackends are additional named RA/CAS backends that can be used to
+	// sign X.509 certificates instead of the default one.
+	CASBackends map[string]*cas.Options `json:"casBackends,omitempty"`
+	// CASRoutes maps provisioner names to the name of the backend in
+	// CASBackends used to sign the certificates they authorize. Provisioners
+	// not present in the map will use the default RA/CAS.
+	CASRoutes map[string]string `json:"casRoutes,omitempty"`
 }
 
 // init initializes the required fields in the AuthConfig if they are not
@@ -211,6 +601,26 @@ func (c *AuthConfig) Validate(provisioner.Audiences) error {
 		return errors.New("authority.backdate cannot be less than 0")
 	}
 
+	// Validate the RA/CAS backends and the provisioners routed to them. The
+	// default CAS requires the root, crt and key, and it cannot be used as an
+	// additional backend.
+	for name, o := range c.CASBackends {
+		switch {
+		case o == nil:
+			return errors.Errorf("authority.casBackends %s cannot be empty", name)
+		case o.Is(cas.SoftCAS):
+			return errors.Errorf("authority.casBackends %s cannot be of type softcas", name)
+		}
+		if err := o.Validate(); err != nil {
+			return errors.Wrapf(err, "authority.casBackends %s is not valid", name)
+		}
+	}
+	for prov, name := range c.CASRoutes {
+		if _, ok := c.CASBackends[name]; !ok {
+			return errors.Errorf("authority.casRoutes %s uses an undefined backend %s", prov, name)
+		}
+	}
+
 	return nil
 }
 
@@ -255,6 +665,12 @@ func (c *Config) Init() {
 	if c.CRL != nil && c.CRL.Enabled && c.CRL.CacheDuration == nil {
 		c.CRL.CacheDuration = DefaultCRLCacheDuration
 	}
+	if c.CRL.IsEnabled() && c.CRL.Delta.IsEnabled() && c.CRL.Delta.CacheDuration == nil {
+		c.CRL.Delta.CacheDuration = DefaultDeltaCRLCacheDuration
+	}
+	if c.OCSP != nil && c.OCSP.Enabled && c.OCSP.CacheDuration == nil {
+		c.OCSP.CacheDuration = DefaultOCSPCacheDuration
+	}
 	c.AuthorityConfig.init()
 }
 
@@ -357,6 +773,19 @@ func (c *Config) Validate() error {
 		return err
 	}
 
+	// Validate the signing pool, nil is ok.
+	if err := c.SigningPool.Validate(); err != nil {
+		return err
+	}
+
+	// Validate the encrypted password, nil is ok.
+	if c.Password != "" && c.EncryptedPassword != nil {
+		return errors.New("password and encryptedPassword cannot be used together")
+	}
+	if err := c.EncryptedPassword.Validate(); err != nil {
+		return err
+	}
+
 	// Validate RA/CAS options, nil is ok.
 	if err := ra.Validate(); err != nil {
 		return err
@@ -377,6 +806,31 @@ func (c *Config) Validate() error {
 		return err
 	}
 
+	// Validate ocsp config: nil is ok
+	if err := c.OCSP.Validate(); err != nil {
+		return err
+	}
+
+	// Validate ACME garbage collector config: nil is ok
+	if err := c.ACMEGC.Validate(); err != nil {
+		return err
+	}
+
+	// Validate ACME validation config: nil is ok
+	if err := c.ACMEValidation.Validate(); err != nil {
+		return err
+	}
+
+	// Validate ACME email config: nil is ok
+	if err := c.ACMEEmail.Validate(); err != nil {
+		return err
+	}
+
+	// Validate export config: nil is ok
+	if err := c.Export.Validate(); err != nil {
+		return err
+	}
+
 	return c.AuthorityConfig.Validate(c.GetAudiences())
 }
 
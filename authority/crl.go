@@ -0,0 +1,362 @@
+package authority
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/nosql/database"
+	kmsapi "go.step.sm/crypto/kms/apiv1"
+	"go.step.sm/crypto/pemutil"
+
+	casapi "github.com/smallstep/certificates/cas/apiv1"
+	"github.com/smallstep/certificates/db"
+)
+
+var (
+	oidExtensionCRLDistributionPoints = asn1.ObjectIdentifier{2, 5, 29, 31}
+	oidExtensionCertificateIssuer     = asn1.ObjectIdentifier{2, 5, 29, 29}
+	oidExtensionDeltaCRLIndicator     = asn1.ObjectIdentifier{2, 5, 29, 27}
+	oidExtensionFreshestCRL           = asn1.ObjectIdentifier{2, 5, 29, 46}
+	oidExtensionReasonCode            = asn1.ObjectIdentifier{2, 5, 29, 21}
+)
+
+// crlSigner is the certificate and signer of a CRL signing delegate.
+type crlSigner struct {
+	cert   *x509.Certificate
+	signer crypto.Signer
+	issuer *x509.Certificate
+}
+
+// CreateCRL signs the given revocation list with the delegate. It implements
+// the apiv1.CertificateAuthorityCRLGenerator interface.
+func (s *crlSigner) CreateCRL(req *casapi.CreateCRLRequest) (*casapi.CreateCRLResponse, error) {
+	der, err := x509.CreateRevocationList(rand.Reader, req.RevocationList, s.cert, s.signer)
+	if err != nil {
+		return nil, err
+	}
+	return &casapi.CreateCRLResponse{CRL: der}, nil
+}
+
+// RFC 5280, 4.2.1.13
+type crlDistributionPoint struct {
+	DistributionPoint distributionPointName `asn1:"optional,tag:0"`
+	Reasons           asn1.BitString        `asn1:"optional,tag:1"`
+	CRLIssuer         asn1.RawValue         `asn1:"optional,tag:2"`
+}
+
+// initCRLSigner loads and validates the CRL signing delegate if one is
+// configured.
+func (a *Authority) initCRLSigner() error {
+	if a.config.CRL.Certificate == "" {
+		a.crlSigner = nil
+		return nil
+	}
+
+	cert, err := pemutil.ReadCertificate(a.config.CRL.Certificate)
+	if err != nil {
+		return errors.Wrap(err, "error reading crl.crt")
+	}
+	signer, err := a.keyManager.CreateSigner(&kmsapi.CreateSignerRequest{
+		SigningKey: a.config.CRL.Key,
+		Password:   a.password,
+	})
+	if err != nil {
+		return errors.Wrap(err, "error creating crl signer")
+	}
+
+	issuer := a.GetIntermediateCertificate()
+	switch {
+	case issuer == nil:
+		return errors.New("CRL signing delegate requires the intermediate certificate")
+	case cert.CheckSignatureFrom(issuer) != nil:
+		return errors.New("crl.crt is not issued by the intermediate certificate")
+	case cert.KeyUsage&x509.KeyUsageCRLSign == 0:
+		return errors.New("crl.crt does not have the cRLSign key usage")
+	case len(cert.SubjectKeyId) == 0:
+		return errors.New("crl.crt does not have a subject key identifier")
+	}
+	if pub, ok := cert.PublicKey.(interface{ Equal(crypto.PublicKey) bool }); !ok || !pub.Equal(signer.Public()) {
+		return errors.New("crl.key does not match crl.crt")
+	}
+
+	a.crlSigner = &crlSigner{
+		cert:   cert,
+		signer: signer,
+		issuer: issuer,
+	}
+	return nil
+}
+
+// crlURL returns the URL of the CRL, used in the issuing distribution point of
+// the CRL and in the distribution points of the issued certificates.
+func (a *Authority) crlURL() string {
+	if a.config.CRL.IDPurl != "" {
+		return a.config.CRL.IDPurl
+	}
+	return a.config.Audience("/1.0/crl")[0]
+}
+
+// crlPartitionURL returns the URL of the given CRL partition, or of its delta
+// CRL. The partition 0 is the full CRL.
+func (a *Authority) crlPartitionURL(partition int, delta bool) string {
+	u := a.crlURL()
+	if partition > 0 {
+		u += "/" + strconv.Itoa(partition)
+	}
+	if delta {
+		u += "/delta"
+	}
+	return u
+}
+
+// crlPartitions returns the number of CRL partitions, 0 if the CRL is not
+// partitioned.
+func (a *Authority) crlPartitions() int {
+	if n := a.config.CRL.Partitions; n > 1 {
+		return n
+	}
+	return 0
+}
+
+// crlPartition returns the partition, from 1 to n, of the given serial number.
+func crlPartition(sn *big.Int, n int) int {
+	return int(new(big.Int).Mod(sn, big.NewInt(int64(n))).Int64()) + 1
+}
+
+// crlPartitionOf returns the CRL partition the given certificate points to, 0
+// if it does not point to a partition. The partition is assigned when the
+// certificate is issued.
+func (a *Authority) crlPartitionOf(cert *x509.Certificate) int {
+	if !a.config.CRL.IsEnabled() || a.crlPartitions() == 0 {
+		return 0
+	}
+	prefix := a.crlURL() + "/"
+	for _, u := range cert.CRLDistributionPoints {
+		if s, ok := strings.CutPrefix(u, prefix); ok {
+			if partition, err := strconv.Atoi(s); err == nil && partition > 0 {
+				return partition
+			}
+		}
+	}
+	return 0
+}
+
+// revokedCertificatePartition returns the CRL partition of a revoked
+// certificate. It is the partition stored on revocation, or, if it is not
+// known, the partition of its serial number.
+func (a *Authority) revokedCertificatePartition(rci *db.RevokedCertificateInfo, sn *big.Int) int {
+	if rci.CRLPartition > 0 {
+		return rci.CRLPartition
+	}
+	return crlPartition(sn, a.crlPartitions())
+}
+
+// checkCRLPartitions returns an error if the number of CRL partitions has
+// changed since the full CRL was generated. The issued certificates point to
+// their partitions, and the revoked ones would be listed in a different one,
+// or in one that no longer exists.
+func (a *Authority) checkCRLPartitions(crlDB db.CertificateRevocationListDB) error {
+	crlInfo, err := a.getCRLInfo(crlDB, 0, false)
+	if err != nil {
+		return err
+	}
+	if crlInfo != nil && crlInfo.Partitions > 0 && crlInfo.Partitions != a.crlPartitions() {
+		return errors.Errorf("crl.partitions cannot be changed from %d to %d: issued certificates point to the existing partitions", crlInfo.Partitions, a.crlPartitions())
+	}
+	return nil
+}
+
+// crlID returns the id used to store the given CRL partition or delta CRL in
+// the database.
+func crlID(partition int, delta bool) string {
+	switch {
+	case partition == 0 && delta:
+		return "delta"
+	case delta:
+		return strconv.Itoa(partition) + "/delta"
+	default:
+		return strconv.Itoa(partition)
+	}
+}
+
+// getCRLInfo returns the stored CRL of the given partition, or its delta CRL.
+// It returns nil if the CRL has not been generated yet.
+func (a *Authority) getCRLInfo(crlDB db.CertificateRevocationListDB, partition int, delta bool) (*db.CertificateRevocationListInfo, error) {
+	var (
+		crlInfo *db.CertificateRevocationListInfo
+		err     error
+	)
+	if partition == 0 && !delta {
+		crlInfo, err = crlDB.GetCRL()
+	} else {
+		crlsDB, ok := a.db.(db.CertificateRevocationListsDB)
+		if !ok {
+			return nil, errors.New("Database does not support partitioned or delta CRL generation")
+		}
+		crlInfo, err = crlsDB.GetCRLByID(crlID(partition, delta))
+	}
+	switch {
+	case err != nil && database.IsErrNotFound(err):
+		return nil, nil
+	case err != nil:
+		return nil, errors.Wrap(err, "could not retrieve CRL from database")
+	default:
+		return crlInfo, nil
+	}
+}
+
+// storeCRLInfo stores the CRL of the given partition, or its delta CRL.
+func (a *Authority) storeCRLInfo(crlDB db.CertificateRevocationListDB, partition int, delta bool, crlInfo *db.CertificateRevocationListInfo) error {
+	if partition == 0 && !delta {
+		return crlDB.StoreCRL(crlInfo)
+	}
+	crlsDB, ok := a.db.(db.CertificateRevocationListsDB)
+	if !ok {
+		return errors.New("Database does not support partitioned or delta CRL generation")
+	}
+	return crlsDB.StoreCRLByID(crlID(partition, delta), crlInfo)
+}
+
+// marshalCRLDistributionPoints returns the value of a CRL distribution points
+// or freshest CRL extension with the given URL. If the CRL is signed by a
+// delegate, the distribution point includes it as the CRL issuer.
+func (a *Authority) marshalCRLDistributionPoints(fullName string) ([]byte, error) {
+	dp := crlDistributionPoint{
+		DistributionPoint: distributionPointName{
+			FullName: []asn1.RawValue{
+				{Class: 2, Tag: 6, Bytes: []byte(fullName)},
+			},
+		},
+	}
+	if a.crlSigner != nil {
+		crlIssuer, err := marshalDirectoryName(a.crlSigner.cert.RawSubject)
+		if err != nil {
+			return nil, err
+		}
+		dp.CRLIssuer = asn1.RawValue{Class: 2, Tag: 2, IsCompound: true, Bytes: crlIssuer}
+	}
+	b, err := asn1.Marshal([]crlDistributionPoint{dp})
+	if err != nil {
+		return nil, errors.Wrap(err, "error marshaling crl distribution points")
+	}
+	return b, nil
+}
+
+// addCRLDistributionPoint adds the CRL distribution point to a certificate if
+// it does not have one. If the CRL is partitioned, the certificate gets a
+// serial number, if it does not have one, and points to its partition. If
+// delta CRLs are enabled, the freshest CRL extension is also added.
+func (a *Authority) addCRLDistributionPoint(cert *x509.Certificate) error {
+	if hasCRLDistributionPoint(cert) {
+		return nil
+	}
+
+	var partition int
+	if n := a.crlPartitions(); n > 0 {
+		if cert.SerialNumber == nil {
+			sn, err := generateSerialNumber()
+			if err != nil {
+				return err
+			}
+			cert.SerialNumber = sn
+		}
+		partition = crlPartition(cert.SerialNumber, n)
+	}
+
+	if a.crlSigner == nil {
+		cert.CRLDistributionPoints = []string{a.crlPartitionURL(partition, false)}
+	} else {
+		b, err := a.marshalCRLDistributionPoints(a.crlPartitionURL(partition, false))
+		if err != nil {
+			return err
+		}
+		cert.ExtraExtensions = append(cert.ExtraExtensions, pkix.Extension{
+			Id:    oidExtensionCRLDistributionPoints,
+			Value: b,
+		})
+	}
+
+	if a.config.CRL.Delta.IsEnabled() && !slices.ContainsFunc(cert.ExtraExtensions, func(ext pkix.Extension) bool {
+		return ext.Id.Equal(oidExtensionFreshestCRL)
+	}) {
+		b, err := a.marshalCRLDistributionPoints(a.crlPartitionURL(partition, true))
+		if err != nil {
+			return err
+		}
+		cert.ExtraExtensions = append(cert.ExtraExtensions, pkix.Extension{
+			Id:    oidExtensionFreshestCRL,
+			Value: b,
+		})
+	}
+	return nil
+}
+
+// resetCRLDistributionPoint replaces the CRL distribution point of a renewed
+// certificate if it points to a CRL partition, the renewed certificate will
+// have a new serial number, and it might be in a different partition.
+func (a *Authority) resetCRLDistributionPoint(cert *x509.Certificate) error {
+	prefix := a.crlURL() + "/"
+	if !slices.ContainsFunc(cert.CRLDistributionPoints, func(u string) bool {
+		return strings.HasPrefix(u, prefix)
+	}) {
+		return nil
+	}
+	cert.CRLDistributionPoints = nil
+	cert.ExtraExtensions = slices.DeleteFunc(cert.ExtraExtensions, func(ext pkix.Extension) bool {
+		return ext.Id.Equal(oidExtensionCRLDistributionPoints) || ext.Id.Equal(oidExtensionFreshestCRL)
+	})
+	return a.addCRLDistributionPoint(cert)
+}
+
+func hasCRLDistributionPoint(cert *x509.Certificate) bool {
+	return len(cert.CRLDistributionPoints) > 0 || slices.ContainsFunc(cert.ExtraExtensions, func(ext pkix.Extension) bool {
+		return ext.Id.Equal(oidExtensionCRLDistributionPoints)
+	})
+}
+
+// generateSerialNumber returns a random 128-bit serial number.
+func generateSerialNumber() (*big.Int, error) {
+	sn, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, errors.Wrap(err, "error generating serial number")
+	}
+	return sn, nil
+}
+
+// marshalCertificateIssuer returns the certificate issuer CRL entry extension
+// used in indirect CRLs.
+func marshalCertificateIssuer(rawSubject []byte) (pkix.Extension, error) {
+	name, err := marshalDirectoryName(rawSubject)
+	if err != nil {
+		return pkix.Extension{}, err
+	}
+	b, err := asn1.Marshal(asn1.RawValue{Class: 0, Tag: asn1.TagSequence, IsCompound: true, Bytes: name})
+	if err != nil {
+		return pkix.Extension{}, err
+	}
+	return pkix.Extension{Id: oidExtensionCertificateIssuer, Critical: true, Value: b}, nil
+}
+
+// marshalDirectoryName returns the DER-encoded directoryName general name of
+// the given subject.
+func marshalDirectoryName(rawSubject []byte) ([]byte, error) {
+	return asn1.Marshal(asn1.RawValue{Class: 2, Tag: 4, IsCompound: true, Bytes: rawSubject})
+}
+
+// marshalReasonCode returns the reasonCode CRL entry extension, as defined in
+// RFC 5280, section 5.3.1.
+func marshalReasonCode(reasonCode int) (pkix.Extension, error) {
+	b, err := asn1.Marshal(asn1.Enumerated(reasonCode))
+	if err != nil {
+		return pkix.Extension{}, errors.Wrap(err, "error marshaling reason code")
+	}
+	return pkix.Extension{Id: oidExtensionReasonCode, Value: b}, nil
+}
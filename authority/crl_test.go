@@ -0,0 +1,489 @@
+package authority
+
+import (
+	"crypto"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/smallstep/nosql/database"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.step.sm/crypto/keyutil"
+	"go.step.sm/crypto/minica"
+	"go.step.sm/crypto/pemutil"
+	"golang.org/x/crypto/ocsp"
+
+	"github.com/smallstep/certificates/authority/config"
+	"github.com/smallstep/certificates/db"
+)
+
+// mustCRLDelegate creates a CRL signing delegate issued by the given CA and
+// returns the paths to the certificate and key.
+func mustCRLDelegate(t *testing.T, ca *minica.CA, keyUsage x509.KeyUsage, skid []byte) (string, string, crypto.Signer) {
+	t.Helper()
+	signer, err := keyutil.GenerateDefaultSigner()
+	require.NoError(t, err)
+	crt, err := ca.Sign(&x509.Certificate{
+		Subject:      pkix.Name{CommonName: "CRL Signer"},
+		PublicKey:    signer.Public(),
+		KeyUsage:     keyUsage,
+		SubjectKeyId: skid,
+	})
+	require.NoError(t, err)
+	dir := t.TempDir()
+	crtFile := filepath.Join(dir, "crl.crt")
+	require.NoError(t, os.WriteFile(crtFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: crt.Raw}), 0o600))
+	keyFile := filepath.Join(dir, "crl.key")
+	_, err = pemutil.Serialize(signer, pemutil.ToFile(keyFile, 0o600))
+	require.NoError(t, err)
+	return crtFile, keyFile, signer
+}
+
+func TestAuthority_initCRLSigner(t *testing.T) {
+	a, ca := testIssuerAuthority(t)
+	okCrt, okKey, _ := mustCRLDelegate(t, ca, x509.KeyUsageCRLSign, []byte{1, 2, 3, 4})
+	noCRLSignCrt, noCRLSignKey, _ := mustCRLDelegate(t, ca, x509.KeyUsageDigitalSignature, []byte{1, 2, 3, 4})
+	_, otherKey, _ := mustCRLDelegate(t, ca, x509.KeyUsageCRLSign, []byte{1, 2, 3, 4})
+
+	tests := []struct {
+		name       string
+		crt, key   string
+		wantSigner bool
+		wantErr    bool
+	}{
+		{"ok", okCrt, okKey, true, false},
+		{"ok/no-delegate", "", "", false, false},
+		{"fail/crl-sign", noCRLSignCrt, noCRLSignKey, false, true},
+		{"fail/key", okCrt, otherKey, false, true},
+		{"fail/crt", "testdata/missing.crt", okKey, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a.crlSigner = nil
+			a.config = &config.Config{
+				CRL: &config.CRLConfig{Enabled: true, Certificate: tt.crt, Key: tt.key},
+			}
+			err := a.initCRLSigner()
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.wantSigner, a.crlSigner != nil)
+		})
+	}
+}
+
+func TestAuthority_GenerateCertificateRevocationList_delegate(t *testing.T) {
+	a, ca := testIssuerAuthority(t)
+	crtFile, keyFile, _ := mustCRLDelegate(t, ca, x509.KeyUsageCRLSign, []byte{1, 2, 3, 4})
+	delegate, err := pemutil.ReadCertificate(crtFile)
+	require.NoError(t, err)
+
+	var stored *db.CertificateRevocationListInfo
+	a.db = &db.MockAuthDB{
+		MGetCRL: func() (*db.CertificateRevocationListInfo, error) {
+			return nil, database.ErrNotFound
+		},
+		MGetRevokedCertificates: func() (*[]db.RevokedCertificateInfo, error) {
+			return &[]db.RevokedCertificateInfo{
+				{Serial: "1", RevokedAt: time.Now()},
+				{Serial: "2", RevokedAt: time.Now()},
+			}, nil
+		},
+		MStoreCRL: func(info *db.CertificateRevocationListInfo) error {
+			stored = info
+			return nil
+		},
+	}
+	a.config = &config.Config{
+		CRL: &config.CRLConfig{
+			Enabled:     true,
+			IDPurl:      "http://ca.example.com/crl",
+			Certificate: crtFile,
+			Key:         keyFile,
+		},
+	}
+	require.NoError(t, a.initCRLSigner())
+	require.NoError(t, a.GenerateCertificateRevocationList())
+	require.NotNil(t, stored)
+
+	crl, err := x509.ParseRevocationList(stored.DER)
+	require.NoError(t, err)
+	// The delegate is not a CA, so CheckSignatureFrom cannot be used.
+	assert.NoError(t, delegate.CheckSignature(crl.SignatureAlgorithm, crl.RawTBSRevocationList, crl.Signature))
+	assert.Equal(t, delegate.RawSubject, crl.RawIssuer)
+	assert.Equal(t, delegate.SubjectKeyId, crl.AuthorityKeyId)
+
+	// The issuing distribution point is an indirect CRL.
+	var idp distributionPoint
+	for _, ext := range crl.Extensions {
+		if ext.Id.Equal(oidExtensionIssuingDistributionPoint) {
+			_, err := asn1.Unmarshal(ext.Value, &idp)
+			require.NoError(t, err)
+		}
+	}
+	assert.True(t, idp.IndirectCRL)
+	assert.True(t, idp.OnlyContainsUserCerts)
+
+	// Only the first entry has the certificate issuer.
+	require.Len(t, crl.RevokedCertificateEntries, 2)
+	require.Len(t, crl.RevokedCertificateEntries[0].Extensions, 1)
+	ext := crl.RevokedCertificateEntries[0].Extensions[0]
+	assert.Equal(t, oidExtensionCertificateIssuer, ext.Id)
+	assert.True(t, ext.Critical)
+	var names []asn1.RawValue
+	_, err = asn1.Unmarshal(ext.Value, &names)
+	require.NoError(t, err)
+	require.Len(t, names, 1)
+	assert.Equal(t, 4, names[0].Tag)
+	assert.Equal(t, ca.Intermediate.RawSubject, names[0].Bytes)
+	assert.Empty(t, crl.RevokedCertificateEntries[1].Extensions)
+}
+
+func TestAuthority_addCRLDistributionPoint(t *testing.T) {
+	a, ca := testIssuerAuthority(t)
+	a.config = &config.Config{
+		CRL: &config.CRLConfig{Enabled: true, IDPurl: "http://ca.example.com/crl"},
+	}
+	signer, err := keyutil.GenerateDefaultSigner()
+	require.NoError(t, err)
+
+	// Without a delegate.
+	cert := &x509.Certificate{}
+	require.NoError(t, a.addCRLDistributionPoint(cert))
+	assert.Equal(t, []string{"http://ca.example.com/crl"}, cert.CRLDistributionPoints)
+
+	// Distribution points in the template are not modified.
+	cert = &x509.Certificate{CRLDistributionPoints: []string{"http://crl.example.com"}}
+	require.NoError(t, a.addCRLDistributionPoint(cert))
+	assert.Equal(t, []string{"http://crl.example.com"}, cert.CRLDistributionPoints)
+	cert = &x509.Certificate{ExtraExtensions: []pkix.Extension{{Id: oidExtensionCRLDistributionPoints, Value: []byte{0x30, 0x00}}}}
+	require.NoError(t, a.addCRLDistributionPoint(cert))
+	assert.Len(t, cert.ExtraExtensions, 1)
+
+	// With a delegate the CRL issuer is added.
+	crtFile, keyFile, _ := mustCRLDelegate(t, ca, x509.KeyUsageCRLSign, []byte{1, 2, 3, 4})
+	a.config.CRL.Certificate, a.config.CRL.Key = crtFile, keyFile
+	require.NoError(t, a.initCRLSigner())
+	cert = &x509.Certificate{
+		Subject:   pkix.Name{CommonName: "leaf"},
+		PublicKey: signer.Public(),
+	}
+	require.NoError(t, a.addCRLDistributionPoint(cert))
+	require.Len(t, cert.ExtraExtensions, 1)
+	leaf, err := ca.Sign(cert)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"http://ca.example.com/crl"}, leaf.CRLDistributionPoints)
+
+	var dps []crlDistributionPoint
+	_, err = asn1.Unmarshal(cert.ExtraExtensions[0].Value, &dps)
+	require.NoError(t, err)
+	require.Len(t, dps, 1)
+	var crlIssuer asn1.RawValue
+	_, err = asn1.Unmarshal(dps[0].CRLIssuer.Bytes, &crlIssuer)
+	require.NoError(t, err)
+	assert.Equal(t, a.crlSigner.cert.RawSubject, crlIssuer.Bytes)
+}
+
+// testCRLDB returns a database that stores the CRLs in memory.
+func testCRLDB(revoked *[]db.RevokedCertificateInfo) (*db.MockAuthDB, map[string]*db.CertificateRevocationListInfo) {
+	crls := make(map[string]*db.CertificateRevocationListInfo)
+	get := func(id string) (*db.CertificateRevocationListInfo, error) {
+		if info, ok := crls[id]; ok {
+			return info, nil
+		}
+		return nil, database.ErrNotFound
+	}
+	return &db.MockAuthDB{
+		MGetRevokedCertificates: func() (*[]db.RevokedCertificateInfo, error) {
+			return revoked, nil
+		},
+		MGetCRL: func() (*db.CertificateRevocationListInfo, error) {
+			return get("")
+		},
+		MStoreCRL: func(info *db.CertificateRevocationListInfo) error {
+			crls[""] = info
+			return nil
+		},
+		MGetCRLByID: get,
+		MStoreCRLByID: func(id string, info *db.CertificateRevocationListInfo) error {
+			crls[id] = info
+			return nil
+		},
+	}, crls
+}
+
+func crlSerials(t *testing.T, crl *x509.RevocationList) []string {
+	t.Helper()
+	var serials []string
+	for _, e := range crl.RevokedCertificateEntries {
+		serials = append(serials, e.SerialNumber.String())
+	}
+	return serials
+}
+
+func crlExtension(crl *x509.RevocationList, oid asn1.ObjectIdentifier) *pkix.Extension {
+	for _, ext := range crl.Extensions {
+		if ext.Id.Equal(oid) {
+			return &ext
+		}
+	}
+	return nil
+}
+
+func TestAuthority_GenerateCertificateRevocationList_partitions(t *testing.T) {
+	a, ca := testIssuerAuthority(t)
+	revoked := []db.RevokedCertificateInfo{}
+	for i := 1; i <= 9; i++ {
+		revoked = append(revoked, db.RevokedCertificateInfo{Serial: strconv.Itoa(i), RevokedAt: time.Now()})
+	}
+	// The partition stored on revocation is used instead of the serial number.
+	revoked = append(revoked, db.RevokedCertificateInfo{Serial: "10", RevokedAt: time.Now(), CRLPartition: 3})
+	mdb, crls := testCRLDB(&revoked)
+	a.db = mdb
+	a.config = &config.Config{
+		CRL: &config.CRLConfig{
+			Enabled:       true,
+			IDPurl:        "http://ca.example.com/crl",
+			CacheDuration: config.DefaultCRLCacheDuration,
+			Partitions:    3,
+		},
+	}
+	require.NoError(t, a.GenerateCertificateRevocationList())
+	require.Len(t, crls, 4)
+
+	want := map[string][]string{
+		"":  {"1", "2", "3", "4", "5", "6", "7", "8", "9", "10"},
+		"1": {"3", "6", "9"},
+		"2": {"1", "4", "7"},
+		"3": {"2", "5", "8", "10"},
+	}
+	for id, serials := range want {
+		crl, err := x509.ParseRevocationList(crls[id].DER)
+		require.NoError(t, err)
+		assert.NoError(t, crl.CheckSignatureFrom(ca.Intermediate))
+		assert.Equal(t, serials, crlSerials(t, crl))
+
+		var idp distributionPoint
+		ext := crlExtension(crl, oidExtensionIssuingDistributionPoint)
+		require.NotNil(t, ext)
+		_, err = asn1.Unmarshal(ext.Value, &idp)
+		require.NoError(t, err)
+		url := "http://ca.example.com/crl"
+		if id != "" {
+			url += "/" + id
+		}
+		assert.Equal(t, url, string(idp.DistributionPoint.FullName[0].Bytes))
+		assert.Nil(t, crlExtension(crl, oidExtensionFreshestCRL))
+	}
+
+	info, err := a.GetCertificateRevocationListPartition(2, false)
+	require.NoError(t, err)
+	assert.Equal(t, crls["2"].DER, info.Data)
+	_, err = a.GetCertificateRevocationListPartition(4, false)
+	assert.Error(t, err)
+	_, err = a.GetCertificateRevocationListPartition(1, true)
+	assert.Error(t, err)
+
+	// The number of partitions cannot be changed.
+	assert.Equal(t, 3, crls[""].Partitions)
+	assert.NoError(t, a.checkCRLPartitions(mdb))
+	a.config.CRL.Partitions = 4
+	assert.Error(t, a.checkCRLPartitions(mdb))
+	a.config.CRL.Partitions = 0
+	assert.Error(t, a.checkCRLPartitions(mdb))
+
+	// Partitions can be enabled on an existing CRL.
+	crls[""].Partitions = 0
+	a.config.CRL.Partitions = 4
+	assert.NoError(t, a.checkCRLPartitions(mdb))
+}
+
+func TestAuthority_GenerateDeltaCertificateRevocationList(t *testing.T) {
+	a, ca := testIssuerAuthority(t)
+	revoked := []db.RevokedCertificateInfo{
+		{Serial: "1", RevokedAt: time.Now().Add(-time.Hour)},
+		{Serial: "2", RevokedAt: time.Now().Add(-time.Hour)},
+	}
+	mdb, crls := testCRLDB(&revoked)
+	a.db = mdb
+	a.config = &config.Config{
+		CRL: &config.CRLConfig{
+			Enabled:       true,
+			IDPurl:        "http://ca.example.com/crl",
+			CacheDuration: config.DefaultCRLCacheDuration,
+			Partitions:    2,
+			Delta: &config.DeltaCRLConfig{
+				Enabled:       true,
+				CacheDuration: config.DefaultDeltaCRLCacheDuration,
+			},
+		},
+	}
+	parse := func(id string) *x509.RevocationList {
+		crl, err := x509.ParseRevocationList(crls[id].DER)
+		require.NoError(t, err)
+		require.NoError(t, crl.CheckSignatureFrom(ca.Intermediate))
+		return crl
+	}
+	deltaIndicator := func(crl *x509.RevocationList) int64 {
+		ext := crlExtension(crl, oidExtensionDeltaCRLIndicator)
+		require.NotNil(t, ext)
+		assert.True(t, ext.Critical)
+		var n int64
+		_, err := asn1.Unmarshal(ext.Value, &n)
+		require.NoError(t, err)
+		return n
+	}
+
+	// Base and delta CRLs are generated together.
+	require.NoError(t, a.GenerateCertificateRevocationList())
+	require.Len(t, crls, 6)
+	base, delta := parse(""), parse("delta")
+	assert.Equal(t, []string{"1", "2"}, crlSerials(t, base))
+	assert.Empty(t, crlSerials(t, delta))
+	assert.Equal(t, base.Number.Int64(), deltaIndicator(delta))
+	assert.Equal(t, base.Number.Int64()+1, delta.Number.Int64())
+	assert.Equal(t, crlExtension(base, oidExtensionIssuingDistributionPoint), crlExtension(delta, oidExtensionIssuingDistributionPoint))
+	assert.Equal(t, time.Hour, delta.NextUpdate.Sub(delta.ThisUpdate))
+
+	var freshest []crlDistributionPoint
+	ext := crlExtension(base, oidExtensionFreshestCRL)
+	require.NotNil(t, ext)
+	_, err := asn1.Unmarshal(ext.Value, &freshest)
+	require.NoError(t, err)
+	assert.Equal(t, "http://ca.example.com/crl/delta", string(freshest[0].DistributionPoint.FullName[0].Bytes))
+	ext = crlExtension(parse("1"), oidExtensionFreshestCRL)
+	require.NotNil(t, ext)
+	_, err = asn1.Unmarshal(ext.Value, &freshest)
+	require.NoError(t, err)
+	assert.Equal(t, "http://ca.example.com/crl/1/delta", string(freshest[0].DistributionPoint.FullName[0].Bytes))
+
+	// Delta CRLs only include new revocations.
+	baseNumber := base.Number.Int64()
+	revoked = append(revoked, db.RevokedCertificateInfo{Serial: "3", RevokedAt: time.Now().Add(time.Second)})
+	require.NoError(t, a.GenerateDeltaCertificateRevocationList())
+	delta = parse("delta")
+	assert.Equal(t, []string{"3"}, crlSerials(t, delta))
+	assert.Equal(t, baseNumber, deltaIndicator(delta))
+	assert.Equal(t, baseNumber+2, delta.Number.Int64())
+	assert.Equal(t, []string{"3"}, crlSerials(t, parse("2/delta")))
+	assert.Empty(t, crlSerials(t, parse("1/delta")))
+	assert.Equal(t, baseNumber, parse("").Number.Int64())
+
+	// The numbers of the base CRLs continue after the delta CRLs.
+	require.NoError(t, a.GenerateCertificateRevocationList())
+	base, delta = parse(""), parse("delta")
+	assert.Equal(t, []string{"1", "2", "3"}, crlSerials(t, base))
+	assert.Equal(t, baseNumber+3, base.Number.Int64())
+	assert.Equal(t, base.Number.Int64(), deltaIndicator(delta))
+
+	info, err := a.GetCertificateRevocationListPartition(2, true)
+	require.NoError(t, err)
+	assert.Equal(t, crls["2/delta"].DER, info.Data)
+}
+
+func TestAuthority_GenerateCertificateRevocationList_reasonCodes(t *testing.T) {
+	a, _ := testIssuerAuthority(t)
+	revoked := []db.RevokedCertificateInfo{
+		{Serial: "1", RevokedAt: time.Now().Add(-time.Hour)},
+		{Serial: "2", ReasonCode: ocsp.KeyCompromise, RevokedAt: time.Now().Add(-time.Hour)},
+		{Serial: "3", ReasonCode: ocsp.CertificateHold, RevokedAt: time.Now().Add(-time.Hour)},
+		{Serial: "4", ReasonCode: ocsp.RemoveFromCRL, RevokedAt: time.Now().Add(-time.Hour)},
+	}
+	mdb, crls := testCRLDB(&revoked)
+	a.db = mdb
+	a.config = &config.Config{
+		CRL: &config.CRLConfig{
+			Enabled:       true,
+			CacheDuration: config.DefaultCRLCacheDuration,
+			Delta: &config.DeltaCRLConfig{
+				Enabled:       true,
+				CacheDuration: config.DefaultDeltaCRLCacheDuration,
+			},
+		},
+	}
+	reasonCodes := func(id string) map[string]int {
+		crl, err := x509.ParseRevocationList(crls[id].DER)
+		require.NoError(t, err)
+		m := make(map[string]int)
+		for _, e := range crl.RevokedCertificateEntries {
+			m[e.SerialNumber.String()] = e.ReasonCode
+			for _, ext := range e.Extensions {
+				if ext.Id.Equal(oidExtensionReasonCode) {
+					assert.NotZero(t, e.ReasonCode)
+					assert.False(t, ext.Critical)
+				}
+			}
+		}
+		return m
+	}
+
+	// Unrevoked certificates are not included in the base CRL.
+	require.NoError(t, a.GenerateCertificateRevocationList())
+	assert.Equal(t, map[string]int{"1": 0, "2": ocsp.KeyCompromise, "3": ocsp.CertificateHold}, reasonCodes(""))
+	assert.Empty(t, reasonCodes("delta"))
+
+	// Certificates released from hold are included in the delta CRL.
+	revoked[2] = db.RevokedCertificateInfo{Serial: "3", ReasonCode: ocsp.RemoveFromCRL, RevokedAt: time.Now().Add(time.Second)}
+	require.NoError(t, a.GenerateDeltaCertificateRevocationList())
+	assert.Equal(t, map[string]int{"3": ocsp.RemoveFromCRL}, reasonCodes("delta"))
+
+	require.NoError(t, a.GenerateCertificateRevocationList())
+	assert.Equal(t, map[string]int{"1": 0, "2": ocsp.KeyCompromise}, reasonCodes(""))
+}
+
+func TestAuthority_addCRLDistributionPoint_partitions(t *testing.T) {
+	a, _ := testIssuerAuthority(t)
+	a.config = &config.Config{
+		CRL: &config.CRLConfig{
+			Enabled:    true,
+			IDPurl:     "http://ca.example.com/crl",
+			Partitions: 4,
+			Delta:      &config.DeltaCRLConfig{Enabled: true},
+		},
+	}
+
+	cert := &x509.Certificate{SerialNumber: big.NewInt(6)}
+	require.NoError(t, a.addCRLDistributionPoint(cert))
+	assert.Equal(t, []string{"http://ca.example.com/crl/3"}, cert.CRLDistributionPoints)
+	require.Len(t, cert.ExtraExtensions, 1)
+	assert.Equal(t, oidExtensionFreshestCRL, cert.ExtraExtensions[0].Id)
+	var freshest []crlDistributionPoint
+	_, err := asn1.Unmarshal(cert.ExtraExtensions[0].Value, &freshest)
+	require.NoError(t, err)
+	assert.Equal(t, "http://ca.example.com/crl/3/delta", string(freshest[0].DistributionPoint.FullName[0].Bytes))
+	assert.Equal(t, 3, a.crlPartitionOf(cert))
+	assert.Equal(t, 0, a.crlPartitionOf(&x509.Certificate{CRLDistributionPoints: []string{"http://ca.example.com/crl"}}))
+	assert.Equal(t, 0, a.crlPartitionOf(&x509.Certificate{CRLDistributionPoints: []string{"http://crl.example.com/3"}}))
+
+	// A serial number is generated to select the partition.
+	cert = &x509.Certificate{}
+	require.NoError(t, a.addCRLDistributionPoint(cert))
+	require.NotNil(t, cert.SerialNumber)
+	assert.Equal(t, []string{a.crlPartitionURL(crlPartition(cert.SerialNumber, 4), false)}, cert.CRLDistributionPoints)
+
+	// Renewed certificates get the new partition.
+	renewed := &x509.Certificate{
+		CRLDistributionPoints: cert.CRLDistributionPoints,
+		ExtraExtensions:       cert.ExtraExtensions,
+	}
+	require.NoError(t, a.resetCRLDistributionPoint(renewed))
+	require.NotNil(t, renewed.SerialNumber)
+	assert.Equal(t, []string{a.crlPartitionURL(crlPartition(renewed.SerialNumber, 4), false)}, renewed.CRLDistributionPoints)
+	assert.Len(t, renewed.ExtraExtensions, 1)
+
+	// Other distribution points are not modified.
+	renewed = &x509.Certificate{CRLDistributionPoints: []string{"http://crl.example.com/1"}}
+	require.NoError(t, a.resetCRLDistributionPoint(renewed))
+	assert.Nil(t, renewed.SerialNumber)
+	assert.Equal(t, []string{"http://crl.example.com/1"}, renewed.CRLDistributionPoints)
+}
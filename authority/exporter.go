@@ -0,0 +1,86 @@
+package authority
+
+import (
+	"context"
+	"crypto/x509"
+	"log"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/db"
+	"github.com/smallstep/certificates/export"
+)
+
+// exporterCloseTimeout is the maximum time to wait for the delivery of the
+// queued records when the authority is shut down.
+const exporterCloseTimeout = 30 * time.Second
+
+// exportX509 sends the record of an issued or renewed X.509 certificate to the
+// configured export sinks. Errors are logged, they never fail the request.
+func (a *Authority) exportX509(ctx context.Context, kind export.Kind, prov provisioner.Interface, cert, previous *x509.Certificate) {
+	if a.exporter == nil {
+		return
+	}
+	r := export.NewX509Record(kind, cert, previous)
+	r.Provisioner = exportProvisioner(prov)
+	a.exportRecord(ctx, r)
+}
+
+// exportSSH sends the record of an issued or renewed SSH certificate to the
+// configured export sinks.
+func (a *Authority) exportSSH(ctx context.Context, kind export.Kind, prov provisioner.Interface, cert, previous *ssh.Certificate) {
+	if a.exporter == nil {
+		return
+	}
+	r := export.NewSSHRecord(kind, cert, previous)
+	r.Provisioner = exportProvisioner(prov)
+	a.exportRecord(ctx, r)
+}
+
+// exportRevocation sends the record of a revoked certificate to the configured
+// export sinks.
+func (a *Authority) exportRevocation(ctx context.Context, typ export.CertificateType, rci *db.RevokedCertificateInfo) {
+	if a.exporter == nil {
+		return
+	}
+	r := export.NewRevocationRecord(typ, rci.Serial, rci.ReasonCode, rci.Reason)
+	r.Timestamp = rci.RevokedAt
+	if rci.ProvisionerID != "" {
+		if p, ok := a.provisioners.Load(rci.ProvisionerID); ok {
+			r.Provisioner = exportProvisioner(p)
+		} else {
+			r.Provisioner = &export.Provisioner{ID: rci.ProvisionerID}
+		}
+	}
+	a.exportRecord(ctx, r)
+}
+
+func (a *Authority) exportRecord(ctx context.Context, r *export.Record) {
+	if err := a.exporter.Export(ctx, r); err != nil {
+		log.Printf("error exporting %s record for certificate %s: %v", r.Kind, r.SerialNumber, err)
+	}
+}
+
+func (a *Authority) closeExporter() {
+	if a.exporter == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), exporterCloseTimeout)
+	defer cancel()
+	if err := a.exporter.Close(ctx); err != nil {
+		log.Printf("error closing the exporter: %v", err)
+	}
+}
+
+func exportProvisioner(p provisioner.Interface) *export.Provisioner {
+	if p == nil {
+		return nil
+	}
+	return &export.Provisioner{
+		ID:   p.GetID(),
+		Name: p.GetName(),
+		Type: p.GetType().String(),
+	}
+}
@@ -0,0 +1,64 @@
+package authority
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/smallstep/certificates/authority/admin"
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/db"
+	"github.com/smallstep/certificates/errs"
+)
+
+// getRenewalOptions returns the renewal options configured for the given
+// provisioner, if any.
+func getRenewalOptions(p provisioner.Interface) *provisioner.RenewalOptions {
+	if o, ok := p.(interface{ GetOptions() *provisioner.Options }); ok {
+		return o.GetOptions().GetRenewalOptions()
+	}
+	return nil
+}
+
+// checkRenewalInventory returns an error if the provisioner requires an
+// inventory check on renewals and the certificate with the given serial
+// number is not active in the inventory.
+func (a *Authority) checkRenewalInventory(p provisioner.Interface, serial string) error {
+	if !getRenewalOptions(p).IsCheckInventory() {
+		return nil
+	}
+	opts := []interface{}{errs.WithKeyVal("serialNumber", serial)}
+	idb, ok := a.db.(db.InventoryDB)
+	if !ok {
+		return errs.NotImplemented("authority.authorizeRenew: the configured database does not support the certificate inventory", opts...)
+	}
+	st, err := idb.GetCertificateStatus(serial)
+	if err != nil {
+		return errs.Wrap(http.StatusInternalServerError, err, "authority.authorizeRenew", opts...)
+	}
+	if st.Status != db.InventoryStatusActive {
+		return errs.Unauthorized("authority.authorizeRenew: certificate is %s in the inventory", st.Status, opts[0])
+	}
+	return nil
+}
+
+// SetCertificateStatus updates the inventory status of the certificate with
+// the given serial number.
+func (a *Authority) SetCertificateStatus(_ context.Context, serial string, status db.InventoryStatus, reason string) (*db.CertificateStatus, error) {
+	if err := status.Validate(); err != nil {
+		return nil, admin.WrapError(admin.ErrorBadRequestType, err, "error updating certificate %s", serial)
+	}
+	idb, ok := a.db.(db.InventoryDB)
+	if !ok {
+		return nil, admin.NewError(admin.ErrorNotImplementedType, "the configured database does not support the certificate inventory")
+	}
+	st := &db.CertificateStatus{
+		Status:    status,
+		Reason:    reason,
+		UpdatedAt: time.Now().UTC(),
+	}
+	if err := idb.SetCertificateStatus(serial, st); err != nil {
+		return nil, admin.WrapErrorISE(err, "error updating certificate %s", serial)
+	}
+	return st, nil
+}
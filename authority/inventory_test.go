@@ -0,0 +1,132 @@
+package authority
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.step.sm/crypto/pemutil"
+
+	"github.com/smallstep/certificates/api/render"
+	"github.com/smallstep/certificates/authority/admin"
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/db"
+)
+
+type mockInventoryDB struct {
+	*db.MockAuthDB
+	status map[string]*db.CertificateStatus
+	err    error
+}
+
+func (m *mockInventoryDB) GetCertificateStatus(serial string) (*db.CertificateStatus, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	if st, ok := m.status[serial]; ok {
+		return st, nil
+	}
+	return &db.CertificateStatus{Status: db.InventoryStatusActive}, nil
+}
+
+func (m *mockInventoryDB) SetCertificateStatus(serial string, st *db.CertificateStatus) error {
+	if m.err != nil {
+		return m.err
+	}
+	m.status[serial] = st
+	return nil
+}
+
+func TestAuthority_authorizeRenew_inventory(t *testing.T) {
+	fooCrt, err := pemutil.ReadCertificate("testdata/certs/foo.crt")
+	require.NoError(t, err)
+	fooCrt.NotAfter = time.Now().Add(time.Hour)
+	serial := fooCrt.SerialNumber.String()
+
+	a := testAuthority(t)
+	mdb := &mockInventoryDB{
+		MockAuthDB: &db.MockAuthDB{
+			MIsRevoked: func(string) (bool, error) { return false, nil },
+		},
+		status: map[string]*db.CertificateStatus{},
+	}
+	a.db = mdb
+
+	p, err := a.LoadProvisionerByCertificate(fooCrt)
+	require.NoError(t, err)
+	jwk, ok := p.(*provisioner.JWK)
+	require.True(t, ok)
+
+	// Decommissioned certificates are renewed if the check is not enabled.
+	mdb.status[serial] = &db.CertificateStatus{Status: db.InventoryStatusDecommissioned}
+	_, err = a.authorizeRenew(context.Background(), fooCrt)
+	assert.NoError(t, err)
+
+	jwk.Options = &provisioner.Options{
+		Renewal: &provisioner.RenewalOptions{CheckInventory: true},
+	}
+	for _, status := range []db.InventoryStatus{db.InventoryStatusDecommissioned, db.InventoryStatusRevoked} {
+		mdb.status[serial] = &db.CertificateStatus{Status: status}
+		_, err = a.authorizeRenew(context.Background(), fooCrt)
+		var sc render.StatusCodedError
+		require.True(t, errors.As(err, &sc))
+		assert.Equal(t, http.StatusUnauthorized, sc.StatusCode())
+		assert.EqualError(t, err, "authority.authorizeRenew: certificate is "+string(status)+" in the inventory")
+	}
+
+	// Active and unknown certificates are renewed.
+	mdb.status[serial] = &db.CertificateStatus{Status: db.InventoryStatusActive}
+	_, err = a.authorizeRenew(context.Background(), fooCrt)
+	assert.NoError(t, err)
+	delete(mdb.status, serial)
+	_, err = a.authorizeRenew(context.Background(), fooCrt)
+	assert.NoError(t, err)
+
+	// Database errors.
+	mdb.err = errors.New("force")
+	_, err = a.authorizeRenew(context.Background(), fooCrt)
+	var sc render.StatusCodedError
+	require.True(t, errors.As(err, &sc))
+	assert.Equal(t, http.StatusInternalServerError, sc.StatusCode())
+
+	// Databases without support for the inventory.
+	a.db = mdb.MockAuthDB
+	_, err = a.authorizeRenew(context.Background(), fooCrt)
+	require.True(t, errors.As(err, &sc))
+	assert.Equal(t, http.StatusNotImplemented, sc.StatusCode())
+}
+
+func TestAuthority_SetCertificateStatus(t *testing.T) {
+	a := testAuthority(t)
+	mdb := &mockInventoryDB{
+		MockAuthDB: &db.MockAuthDB{},
+		status:     map[string]*db.CertificateStatus{},
+	}
+	a.db = mdb
+
+	st, err := a.SetCertificateStatus(context.Background(), "1234", db.InventoryStatusDecommissioned, "host deprovisioned")
+	require.NoError(t, err)
+	assert.Equal(t, db.InventoryStatusDecommissioned, st.Status)
+	assert.Equal(t, "host deprovisioned", st.Reason)
+	assert.False(t, st.UpdatedAt.IsZero())
+	assert.Equal(t, st, mdb.status["1234"])
+
+	var adminErr *admin.Error
+	_, err = a.SetCertificateStatus(context.Background(), "1234", "lost", "")
+	require.True(t, errors.As(err, &adminErr))
+	assert.Equal(t, http.StatusBadRequest, adminErr.StatusCode())
+
+	mdb.err = errors.New("force")
+	_, err = a.SetCertificateStatus(context.Background(), "1234", db.InventoryStatusActive, "")
+	require.True(t, errors.As(err, &adminErr))
+	assert.Equal(t, http.StatusInternalServerError, adminErr.StatusCode())
+
+	a.db = mdb.MockAuthDB
+	_, err = a.SetCertificateStatus(context.Background(), "1234", db.InventoryStatusActive, "")
+	require.True(t, errors.As(err, &adminErr))
+	assert.Equal(t, http.StatusNotImplemented, adminErr.StatusCode())
+}
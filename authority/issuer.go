@@ -0,0 +1,334 @@
+package authority
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	"go.step.sm/crypto/keyutil"
+	kmsapi "go.step.sm/crypto/kms/apiv1"
+
+	"github.com/smallstep/certificates/authority/admin"
+	casapi "github.com/smallstep/certificates/cas/apiv1"
+	"github.com/smallstep/certificates/kms"
+)
+
+// x509Issuer is the certificate chain and signer used to sign X.509
+// certificates with the default CAS. It can be replaced without restarting
+// the CA using RotateX509Issuer.
+type x509Issuer struct {
+	chain  []*x509.Certificate
+	signer crypto.Signer
+}
+
+// currentX509Issuer returns the current issuer, or nil if the default CAS is
+// not used.
+func (a *Authority) currentX509Issuer() *x509Issuer {
+	a.x509IssuerMutex.RLock()
+	defer a.x509IssuerMutex.RUnlock()
+	return a.x509Issuer
+}
+
+// getX509Issuer is the certificate signer function used in the default CAS.
+func (a *Authority) getX509Issuer() ([]*x509.Certificate, crypto.Signer, error) {
+	iss := a.currentX509Issuer()
+	return iss.chain, iss.signer, nil
+}
+
+// CreateX509IssuerKey creates a new key in the KMS configured in the authority
+// and returns it with a certificate request signed by the new key, using the
+// subject of the current issuer. The certificate request can be signed by the
+// root to create the new issuer used in RotateX509Issuer. If the name of the
+// key is empty, the current issuer key is rotated, see kms.RotateKey.
+func (a *Authority) CreateX509IssuerKey(_ context.Context, req *kmsapi.CreateKeyRequest) (*kmsapi.CreateKeyResponse, *x509.CertificateRequest, error) {
+	iss := a.currentX509Issuer()
+	if iss == nil || a.keyManager == nil {
+		return nil, nil, admin.NewError(admin.ErrorNotImplementedType, "the configured certificate authority service does not support issuer rotation")
+	}
+
+	var resp *kmsapi.CreateKeyResponse
+	var err error
+	if req.Name == "" {
+		if resp, err = a.rotateX509IssuerKey(); err != nil {
+			return nil, nil, err
+		}
+	} else if resp, err = a.keyManager.CreateKey(req); err != nil {
+		return nil, nil, admin.WrapErrorISE(err, "error creating key %s", req.Name)
+	}
+	signer, err := a.keyManager.CreateSigner(&resp.CreateSignerRequest)
+	if err != nil {
+		return nil, nil, admin.WrapErrorISE(err, "error creating signer for key %s", resp.Name)
+	}
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject: iss.chain[0].Subject,
+	}, signer)
+	if err != nil {
+		return nil, nil, admin.WrapErrorISE(err, "error creating certificate request")
+	}
+	csr, err := x509.ParseCertificateRequest(der)
+	if err != nil {
+		return nil, nil, admin.WrapErrorISE(err, "error parsing certificate request")
+	}
+
+	return resp, csr, nil
+}
+
+// rotateX509IssuerKey creates a new key that replaces the key of the current
+// issuer configured in the ca.json.
+func (a *Authority) rotateX509IssuerKey() (*kmsapi.CreateKeyResponse, error) {
+	var name string
+	if a.config != nil {
+		name = a.config.IntermediateKey
+	}
+	if name == "" {
+		return nil, admin.NewError(admin.ErrorBadRequestType, "key name cannot be empty")
+	}
+	resp, err := kms.RotateKey(a.keyManager, &kms.RotateKeyRequest{
+		Name:     name,
+		Password: a.password,
+	})
+	if err != nil {
+		var nie kmsapi.NotImplementedError
+		if errors.As(err, &nie) {
+			return nil, admin.WrapError(admin.ErrorNotImplementedType, err, "the configured kms does not support key rotation")
+		}
+		return nil, admin.WrapErrorISE(err, "error rotating key %s", name)
+	}
+	return resp, nil
+}
+
+// RotateX509IssuerKey rotates the key of the X.509 issuer and re-issues the
+// issuer certificate with the new key. The certificate is created by the
+// certificate authority service, and it is signed by the root that signed the
+// current issuer, using the given root key, a KMS URI or a file. The subject,
+// extensions and, if lifetime is 0, the validity period of the current issuer
+// are kept.
+//
+// The new issuer is used from the next certificate signed, and it is persisted
+// like in RotateX509Issuer.
+func (a *Authority) RotateX509IssuerKey(_ context.Context, rootKey string, lifetime time.Duration) ([]*x509.Certificate, string, error) {
+	iss := a.currentX509Issuer()
+	creator, ok := a.x509CAService.(casapi.CertificateAuthorityCreator)
+	if iss == nil || a.keyManager == nil || !ok {
+		return nil, "", admin.NewError(admin.ErrorNotImplementedType, "the configured certificate authority service does not support issuer rotation")
+	}
+	switch {
+	case rootKey == "":
+		return nil, "", admin.NewError(admin.ErrorBadRequestType, "root key cannot be empty")
+	case lifetime < 0:
+		return nil, "", admin.NewError(admin.ErrorBadRequestType, "lifetime cannot be negative")
+	case a.config == nil || a.config.IntermediateKey == "":
+		return nil, "", admin.NewError(admin.ErrorBadRequestType, "the issuer key is not configured")
+	}
+
+	current := iss.chain[0]
+	var root *x509.Certificate
+	for _, crt := range a.rootX509Certs {
+		if current.CheckSignatureFrom(crt) == nil {
+			root = crt
+			break
+		}
+	}
+	if root == nil {
+		return nil, "", admin.NewError(admin.ErrorBadRequestType, "the current issuer is not signed by a root certificate")
+	}
+
+	rootSigner, err := a.keyManager.CreateSigner(&kmsapi.CreateSignerRequest{
+		SigningKey: rootKey,
+		Password:   a.password,
+	})
+	if err != nil {
+		return nil, "", admin.WrapError(admin.ErrorBadRequestType, err, "error creating signer for key %s", rootKey)
+	}
+	if !keyutil.Equal(rootSigner.Public(), root.PublicKey) {
+		return nil, "", admin.NewError(admin.ErrorBadRequestType, "root key does not match the root certificate")
+	}
+
+	if lifetime == 0 {
+		lifetime = current.NotAfter.Sub(current.NotBefore)
+	}
+	resp, err := creator.CreateCertificateAuthority(&casapi.CreateCertificateAuthorityRequest{
+		Type:              casapi.IntermediateCA,
+		Template:          reissueTemplate(current),
+		Lifetime:          lifetime,
+		RotateKey:         a.config.IntermediateKey,
+		RotateKeyPassword: a.password,
+		Parent: &casapi.CreateCertificateAuthorityResponse{
+			Certificate: root,
+			Signer:      rootSigner,
+		},
+	})
+	if err != nil {
+		var nie kmsapi.NotImplementedError
+		if errors.As(err, &nie) {
+			return nil, "", admin.WrapError(admin.ErrorNotImplementedType, err, "the configured kms does not support key rotation")
+		}
+		return nil, "", admin.WrapErrorISE(err, "error creating issuer certificate")
+	}
+
+	chain := []*x509.Certificate{resp.Certificate}
+	if err := a.switchX509Issuer(chain, resp.Signer, resp.KeyName); err != nil {
+		return nil, "", err
+	}
+	return chain, resp.KeyName, nil
+}
+
+// reissueTemplate returns the template used to re-issue the given issuer
+// certificate with a new key.
+func reissueTemplate(crt *x509.Certificate) *x509.Certificate {
+	return &x509.Certificate{
+		RawSubject:                  crt.RawSubject,
+		KeyUsage:                    crt.KeyUsage,
+		ExtKeyUsage:                 crt.ExtKeyUsage,
+		UnknownExtKeyUsage:          crt.UnknownExtKeyUsage,
+		BasicConstraintsValid:       crt.BasicConstraintsValid,
+		IsCA:                        crt.IsCA,
+		MaxPathLen:                  crt.MaxPathLen,
+		MaxPathLenZero:              crt.MaxPathLenZero,
+		Policies:                    crt.Policies,
+		PolicyIdentifiers:           crt.PolicyIdentifiers,
+		CRLDistributionPoints:       crt.CRLDistributionPoints,
+		IssuingCertificateURL:       crt.IssuingCertificateURL,
+		OCSPServer:                  crt.OCSPServer,
+		PermittedDNSDomainsCritical: crt.PermittedDNSDomainsCritical,
+		PermittedDNSDomains:         crt.PermittedDNSDomains,
+		ExcludedDNSDomains:          crt.ExcludedDNSDomains,
+		PermittedIPRanges:           crt.PermittedIPRanges,
+		ExcludedIPRanges:            crt.ExcludedIPRanges,
+		PermittedEmailAddresses:     crt.PermittedEmailAddresses,
+		ExcludedEmailAddresses:      crt.ExcludedEmailAddresses,
+		PermittedURIDomains:         crt.PermittedURIDomains,
+		ExcludedURIDomains:          crt.ExcludedURIDomains,
+	}
+}
+
+// RotateX509Issuer replaces the certificate and key used to sign X.509
+// certificates. The first certificate in the chain must be a CA certificate
+// that chains to one of the roots of the authority, and the key, a KMS URI or
+// a file, must match it. The new issuer is used from the next certificate
+// signed, and it is also returned as the intermediate certificates if these
+// were not configured explicitly.
+//
+// The chain is written to the intermediate certificate file, and the key is
+// saved in the ca.json if the configuration was loaded from a file, so the new
+// issuer is also used after a restart. Other services that use the
+// intermediate key, like SCEP, will use the new key after a restart.
+func (a *Authority) RotateX509Issuer(_ context.Context, chain []*x509.Certificate, key string) error {
+	if a.currentX509Issuer() == nil || a.keyManager == nil {
+		return admin.NewError(admin.ErrorNotImplementedType, "the configured certificate authority service does not support issuer rotation")
+	}
+	switch {
+	case len(chain) == 0:
+		return admin.NewError(admin.ErrorBadRequestType, "certificate chain cannot be empty")
+	case key == "":
+		return admin.NewError(admin.ErrorBadRequestType, "key cannot be empty")
+	case !chain[0].BasicConstraintsValid || !chain[0].IsCA:
+		return admin.NewError(admin.ErrorBadRequestType, "certificate is not a certificate authority")
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, crt := range chain[1:] {
+		intermediates.AddCert(crt)
+	}
+	if _, err := chain[0].Verify(x509.VerifyOptions{
+		Roots:         a.rootX509CertPool,
+		Intermediates: intermediates,
+		CurrentTime:   time.Now(),
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}); err != nil {
+		return admin.WrapError(admin.ErrorBadRequestType, err, "certificate is not signed by the root certificate")
+	}
+
+	signer, err := a.keyManager.CreateSigner(&kmsapi.CreateSignerRequest{
+		SigningKey: key,
+		Password:   a.password,
+	})
+	if err != nil {
+		return admin.WrapError(admin.ErrorBadRequestType, err, "error creating signer for key %s", key)
+	}
+	if !keyutil.Equal(signer.Public(), chain[0].PublicKey) {
+		return admin.NewError(admin.ErrorBadRequestType, "key does not match the certificate")
+	}
+
+	return a.switchX509Issuer(chain, signer, key)
+}
+
+// switchX509Issuer persists the new issuer and replaces the current one. If
+// the new issuer cannot be persisted, the current one is kept.
+func (a *Authority) switchX509Issuer(chain []*x509.Certificate, signer crypto.Signer, key string) error {
+	a.x509IssuerMutex.Lock()
+	defer a.x509IssuerMutex.Unlock()
+
+	if err := a.persistX509Issuer(chain, key); err != nil {
+		return admin.WrapErrorISE(err, "error saving the x509 issuer")
+	}
+	if len(a.intermediateX509Certs) > 0 && a.intermediateX509Certs[0].Equal(a.x509Issuer.chain[0]) {
+		a.intermediateX509Certs = chain
+	}
+	a.x509Issuer = &x509Issuer{
+		chain:  chain,
+		signer: signer,
+	}
+	return nil
+}
+
+// persistX509Issuer writes the issuer chain to the intermediate certificate
+// file, and the issuer key to the ca.json. If the configuration cannot be
+// saved, the previous certificate file is restored.
+func (a *Authority) persistX509Issuer(chain []*x509.Certificate, key string) error {
+	if a.config == nil || a.config.IntermediateCert == "" {
+		return nil
+	}
+
+	filename := a.config.IntermediateCert
+	previous, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	var b []byte
+	for _, crt := range chain {
+		b = append(b, pem.EncodeToMemory(&pem.Block{
+			Type:  "CERTIFICATE",
+			Bytes: crt.Raw,
+		})...)
+	}
+	if err := writeFileAtomic(filename, b); err != nil {
+		return err
+	}
+
+	if !a.config.WasLoadedFromFile() {
+		a.config.IntermediateKey = key
+		return nil
+	}
+	previousKey := a.config.IntermediateKey
+	a.config.IntermediateKey = key
+	if err := a.config.Commit(); err != nil {
+		a.config.IntermediateKey = previousKey
+		return errors.Join(err, writeFileAtomic(filename, previous))
+	}
+	return nil
+}
+
+// writeFileAtomic replaces the contents of the given file writing them first to
+// a temporary file in the same directory.
+func writeFileAtomic(filename string, data []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(filename), filepath.Base(filename)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), filename)
+}
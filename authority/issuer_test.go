@@ -0,0 +1,348 @@
+package authority
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	kmsapi "go.step.sm/crypto/kms/apiv1"
+	"go.step.sm/crypto/kms/softkms"
+	"go.step.sm/crypto/minica"
+	"go.step.sm/crypto/pemutil"
+
+	"github.com/smallstep/certificates/authority/admin"
+	"github.com/smallstep/certificates/authority/config"
+	casapi "github.com/smallstep/certificates/cas/apiv1"
+	"github.com/smallstep/certificates/cas/softcas"
+	"github.com/smallstep/certificates/kms"
+)
+
+func testIssuerAuthority(t *testing.T) (*Authority, *minica.CA) {
+	t.Helper()
+	ca, err := minica.New()
+	require.NoError(t, err)
+	km, err := softkms.New(context.Background(), kmsapi.Options{})
+	require.NoError(t, err)
+
+	a := &Authority{
+		keyManager:            km,
+		rootX509Certs:         []*x509.Certificate{ca.Root},
+		rootX509CertPool:      x509.NewCertPool(),
+		intermediateX509Certs: []*x509.Certificate{ca.Intermediate},
+		x509Issuer: &x509Issuer{
+			chain:  []*x509.Certificate{ca.Intermediate},
+			signer: ca.Signer,
+		},
+	}
+	a.rootX509CertPool.AddCert(ca.Root)
+	a.x509CAService, err = softcas.New(context.Background(), casapi.Options{
+		CertificateSigner: a.getX509Issuer,
+	})
+	require.NoError(t, err)
+	return a, ca
+}
+
+// mustIssuer creates a new CA certificate signed by the given parent and
+// writes its key to a file.
+func mustIssuer(t *testing.T, parent *x509.Certificate, parentSigner crypto.Signer, isCA bool) (*x509.Certificate, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: "Rotated Intermediate CA"},
+		NotBefore:             time.Now().Add(-time.Minute),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  isCA,
+	}, parent, key.Public(), parentSigner)
+	require.NoError(t, err)
+	crt, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	b, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	filename := filepath.Join(t.TempDir(), "issuer.key")
+	require.NoError(t, os.WriteFile(filename, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: b}), 0o600))
+	return crt, filename
+}
+
+func TestAuthority_RotateX509Issuer(t *testing.T) {
+	a, ca := testIssuerAuthority(t)
+	crt, keyFile := mustIssuer(t, ca.Root, ca.RootSigner, true)
+	leaf, leafKey := mustIssuer(t, ca.Root, ca.RootSigner, false)
+	otherCA, err := minica.New()
+	require.NoError(t, err)
+	other, otherKey := mustIssuer(t, otherCA.Root, otherCA.RootSigner, true)
+	_, wrongKey := mustIssuer(t, ca.Root, ca.RootSigner, true)
+	ctx := context.Background()
+
+	assertError := func(t *testing.T, err error, status int, msg string) {
+		t.Helper()
+		var adminErr *admin.Error
+		require.ErrorAs(t, err, &adminErr)
+		assert.Equal(t, status, adminErr.StatusCode())
+		assert.Contains(t, err.Error(), msg)
+	}
+
+	assertError(t, a.RotateX509Issuer(ctx, nil, keyFile), 400, "certificate chain cannot be empty")
+	assertError(t, a.RotateX509Issuer(ctx, []*x509.Certificate{crt}, ""), 400, "key cannot be empty")
+	assertError(t, a.RotateX509Issuer(ctx, []*x509.Certificate{leaf}, leafKey), 400, "certificate is not a certificate authority")
+	assertError(t, a.RotateX509Issuer(ctx, []*x509.Certificate{other}, otherKey), 400, "certificate is not signed by the root certificate")
+	assertError(t, a.RotateX509Issuer(ctx, []*x509.Certificate{crt}, filepath.Join(t.TempDir(), "missing.key")), 400, "error creating signer for key")
+	assertError(t, a.RotateX509Issuer(ctx, []*x509.Certificate{crt}, wrongKey), 400, "key does not match the certificate")
+
+	// Nothing has changed yet
+	assert.Equal(t, ca.Intermediate, a.GetIntermediateCertificate())
+
+	require.NoError(t, a.RotateX509Issuer(ctx, []*x509.Certificate{crt}, keyFile))
+	assert.Equal(t, crt, a.GetIntermediateCertificate())
+	assert.Equal(t, []*x509.Certificate{crt}, a.GetIntermediateCertificates())
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	resp, err := a.x509CAService.CreateCertificate(&casapi.CreateCertificateRequest{
+		Template: &x509.Certificate{
+			Subject:   pkix.Name{CommonName: "leaf"},
+			PublicKey: key.Public(),
+		},
+		Lifetime: time.Hour,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []*x509.Certificate{crt}, resp.CertificateChain)
+	assert.NoError(t, resp.Certificate.CheckSignatureFrom(crt))
+
+	// Explicit intermediates are not replaced.
+	explicit, explicitKey := mustIssuer(t, ca.Root, ca.RootSigner, true)
+	a.intermediateX509Certs = []*x509.Certificate{ca.Intermediate}
+	require.NoError(t, a.RotateX509Issuer(ctx, []*x509.Certificate{explicit}, explicitKey))
+	assert.Equal(t, []*x509.Certificate{ca.Intermediate}, a.GetIntermediateCertificates())
+
+	// Not supported without the default CAS.
+	a.x509Issuer = nil
+	assertError(t, a.RotateX509Issuer(ctx, []*x509.Certificate{crt}, keyFile), 501, "does not support issuer rotation")
+}
+
+func TestAuthority_CreateX509IssuerKey(t *testing.T) {
+	a, ca := testIssuerAuthority(t)
+	ctx := context.Background()
+
+	_, _, err := a.CreateX509IssuerKey(ctx, &kmsapi.CreateKeyRequest{})
+	var adminErr *admin.Error
+	require.ErrorAs(t, err, &adminErr)
+	assert.Equal(t, 400, adminErr.StatusCode())
+
+	resp, csr, err := a.CreateX509IssuerKey(ctx, &kmsapi.CreateKeyRequest{
+		Name:               "issuer-2",
+		SignatureAlgorithm: kmsapi.ECDSAWithSHA384,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "issuer-2", resp.Name)
+	assert.NoError(t, csr.CheckSignature())
+	assert.Equal(t, ca.Intermediate.Subject.String(), csr.Subject.String())
+	assert.Equal(t, resp.PublicKey, csr.PublicKey)
+	assert.Equal(t, elliptic.P384(), csr.PublicKey.(*ecdsa.PublicKey).Curve)
+
+	a.x509Issuer = nil
+	_, _, err = a.CreateX509IssuerKey(ctx, &kmsapi.CreateKeyRequest{Name: "issuer-3"})
+	require.ErrorAs(t, err, &adminErr)
+	assert.Equal(t, 501, adminErr.StatusCode())
+}
+
+func TestAuthority_CreateX509IssuerKey_rotateFile(t *testing.T) {
+	a, ca := testIssuerAuthority(t)
+	ctx := context.Background()
+
+	// The authority wraps the key manager to support modern PKCS #8 keys, to
+	// limit the concurrent signatures and to collect metrics.
+	a.keyManager = newInstrumentedKeyManager(newPooledKeyManager(softcas.NewKeyManager(a.keyManager), newSigningPool(1, 0)), &noopMeter{})
+	a.password = []byte("password")
+	block, err := softcas.EncryptPKCS8PrivateKey(ca.Signer, a.password, softcas.ScryptKDF)
+	require.NoError(t, err)
+	keyFile := filepath.Join(t.TempDir(), "intermediate_ca_key")
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(block), 0o600))
+	testIssuerConfig(t, a, ca, keyFile)
+
+	resp, csr, err := a.CreateX509IssuerKey(ctx, &kmsapi.CreateKeyRequest{})
+	require.NoError(t, err)
+	assert.NotEqual(t, keyFile, resp.Name)
+	assert.NoError(t, csr.CheckSignature())
+	assert.Equal(t, resp.PublicKey, csr.PublicKey)
+
+	// The new key is encrypted with the authority password.
+	data, err := os.ReadFile(resp.Name)
+	require.NoError(t, err)
+	b, _ := pem.Decode(data)
+	assert.True(t, softcas.IsModernPKCS8(b))
+	key, err := softcas.ParsePrivateKey(data, a.password)
+	require.NoError(t, err)
+	assert.Equal(t, resp.PublicKey, key.(crypto.Signer).Public())
+}
+
+// rotatorKeyManager is a softkms key manager that rotates keys in memory.
+type rotatorKeyManager struct {
+	kmsapi.KeyManager
+	rotated []string
+}
+
+func (m *rotatorKeyManager) RotateKey(req *kms.RotateKeyRequest) (*kmsapi.CreateKeyResponse, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	m.rotated = append(m.rotated, req.Name)
+	return &kmsapi.CreateKeyResponse{
+		Name:       fmt.Sprintf("%s-%d", req.Name, len(m.rotated)),
+		PublicKey:  key.Public(),
+		PrivateKey: key,
+		CreateSignerRequest: kmsapi.CreateSignerRequest{
+			Signer: key,
+		},
+	}, nil
+}
+
+// testIssuerConfig writes the intermediate of the given CA to a file and
+// configures the authority with a ca.json that uses it.
+func testIssuerConfig(t *testing.T, a *Authority, ca *minica.CA, key string) string {
+	t.Helper()
+	dir := t.TempDir()
+	crtFile := filepath.Join(dir, "intermediate_ca.crt")
+	require.NoError(t, os.WriteFile(crtFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Intermediate.Raw}), 0o600))
+	b, err := json.Marshal(map[string]any{
+		"crt": crtFile,
+		"key": key,
+	})
+	require.NoError(t, err)
+	cfgFile := filepath.Join(dir, "ca.json")
+	require.NoError(t, os.WriteFile(cfgFile, b, 0o600))
+	a.config, err = config.LoadConfiguration(cfgFile)
+	require.NoError(t, err)
+	return cfgFile
+}
+
+func TestAuthority_RotateX509Issuer_persist(t *testing.T) {
+	a, ca := testIssuerAuthority(t)
+	cfgFile := testIssuerConfig(t, a, ca, "intermediate_ca_key")
+	crt, keyFile := mustIssuer(t, ca.Root, ca.RootSigner, true)
+
+	require.NoError(t, a.RotateX509Issuer(context.Background(), []*x509.Certificate{crt, ca.Root}, keyFile))
+
+	chain, err := pemutil.ReadCertificateBundle(a.config.IntermediateCert)
+	require.NoError(t, err)
+	assert.Equal(t, []*x509.Certificate{crt, ca.Root}, chain)
+	cfg, err := config.LoadConfiguration(cfgFile)
+	require.NoError(t, err)
+	assert.Equal(t, keyFile, cfg.IntermediateKey)
+
+	// The issuer is not replaced if it cannot be persisted.
+	other, otherKey := mustIssuer(t, ca.Root, ca.RootSigner, true)
+	require.NoError(t, os.Remove(a.config.IntermediateCert))
+	var adminErr *admin.Error
+	require.ErrorAs(t, a.RotateX509Issuer(context.Background(), []*x509.Certificate{other}, otherKey), &adminErr)
+	assert.Equal(t, 500, adminErr.StatusCode())
+	assert.Equal(t, crt, a.GetIntermediateCertificate())
+}
+
+func TestAuthority_RotateX509IssuerKey(t *testing.T) {
+	a, ca := testIssuerAuthority(t)
+	ctx := context.Background()
+
+	assertError := func(t *testing.T, err error, status int, msg string) {
+		t.Helper()
+		var adminErr *admin.Error
+		require.ErrorAs(t, err, &adminErr)
+		assert.Equal(t, status, adminErr.StatusCode())
+		assert.Contains(t, err.Error(), msg)
+	}
+
+	b, err := x509.MarshalPKCS8PrivateKey(ca.RootSigner)
+	require.NoError(t, err)
+	rootKey := filepath.Join(t.TempDir(), "root_ca.key")
+	require.NoError(t, os.WriteFile(rootKey, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: b}), 0o600))
+	_, wrongKey := mustIssuer(t, ca.Root, ca.RootSigner, true)
+
+	// The key in the configuration is a file, softkms cannot rotate it.
+	cfgFile := testIssuerConfig(t, a, ca, "intermediate_ca_key")
+	_, _, err = a.RotateX509IssuerKey(ctx, rootKey, 0)
+	assertError(t, err, 501, "does not support key rotation")
+	assert.Equal(t, ca.Intermediate, a.GetIntermediateCertificate())
+
+	km := &rotatorKeyManager{KeyManager: a.keyManager}
+	a.keyManager = km
+	a.x509CAService.(*softcas.SoftCAS).KeyManager = km
+
+	_, _, err = a.RotateX509IssuerKey(ctx, "", 0)
+	assertError(t, err, 400, "root key cannot be empty")
+	_, _, err = a.RotateX509IssuerKey(ctx, rootKey, -time.Hour)
+	assertError(t, err, 400, "lifetime cannot be negative")
+	_, _, err = a.RotateX509IssuerKey(ctx, wrongKey, 0)
+	assertError(t, err, 400, "root key does not match the root certificate")
+	_, _, err = a.RotateX509IssuerKey(ctx, filepath.Join(t.TempDir(), "missing.key"), 0)
+	assertError(t, err, 400, "error creating signer for key")
+
+	chain, key, err := a.RotateX509IssuerKey(ctx, rootKey, 0)
+	require.NoError(t, err)
+	assert.Equal(t, "intermediate_ca_key-1", key)
+	assert.Equal(t, []string{"intermediate_ca_key"}, km.rotated)
+	require.Len(t, chain, 1)
+	assert.NoError(t, chain[0].CheckSignatureFrom(ca.Root))
+	assert.Equal(t, ca.Intermediate.RawSubject, chain[0].RawSubject)
+	assert.True(t, chain[0].IsCA)
+	assert.Equal(t, ca.Intermediate.MaxPathLen, chain[0].MaxPathLen)
+	assert.Equal(t, ca.Intermediate.NotAfter.Sub(ca.Intermediate.NotBefore), chain[0].NotAfter.Sub(chain[0].NotBefore))
+	assert.NotEqual(t, ca.Intermediate.PublicKey, chain[0].PublicKey)
+
+	// The new issuer is used to sign certificates.
+	assert.Equal(t, chain[0], a.GetIntermediateCertificate())
+	leafKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	resp, err := a.x509CAService.CreateCertificate(&casapi.CreateCertificateRequest{
+		Template: &x509.Certificate{
+			Subject:   pkix.Name{CommonName: "leaf"},
+			PublicKey: leafKey.Public(),
+		},
+		Lifetime: time.Hour,
+	})
+	require.NoError(t, err)
+	assert.NoError(t, resp.Certificate.CheckSignatureFrom(chain[0]))
+
+	// The new issuer is persisted.
+	saved, err := pemutil.ReadCertificateBundle(a.config.IntermediateCert)
+	require.NoError(t, err)
+	assert.Equal(t, chain, saved)
+	cfg, err := config.LoadConfiguration(cfgFile)
+	require.NoError(t, err)
+	assert.Equal(t, "intermediate_ca_key-1", cfg.IntermediateKey)
+
+	// Rotate again with an explicit lifetime.
+	chain, key, err = a.RotateX509IssuerKey(ctx, rootKey, 24*time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, "intermediate_ca_key-1-2", key)
+	assert.Equal(t, 24*time.Hour, chain[0].NotAfter.Sub(chain[0].NotBefore))
+
+	// CreateX509IssuerKey rotates the current key if no name is given.
+	created, csr, err := a.CreateX509IssuerKey(ctx, &kmsapi.CreateKeyRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, "intermediate_ca_key-1-2-3", created.Name)
+	assert.Equal(t, created.PublicKey, csr.PublicKey)
+
+	// Not supported without the default CAS.
+	a.x509Issuer = nil
+	_, _, err = a.RotateX509IssuerKey(ctx, rootKey, 0)
+	assertError(t, err, 501, "does not support issuer rotation")
+}
@@ -8,6 +8,7 @@ import (
 	kmsapi "go.step.sm/crypto/kms/apiv1"
 
 	"github.com/smallstep/certificates/authority/provisioner"
+	certkms "github.com/smallstep/certificates/kms"
 )
 
 // Meter wraps the set of defined callbacks for metrics gatherers.
@@ -90,6 +91,16 @@ func (i *instrumentedKeyManager) CreateSigner(req *kmsapi.CreateSignerRequest) (
 	return
 }
 
+// RotateKey implements kms.KeyRotator using the wrapped key manager.
+func (i *instrumentedKeyManager) RotateKey(req *certkms.RotateKeyRequest) (*kmsapi.CreateKeyResponse, error) {
+	return certkms.RotateKey(i.KeyManager, req)
+}
+
+// RotateKey implements kms.KeyRotator using the wrapped key manager.
+func (i *instrumentedKeyAndDecrypterManager) RotateKey(req *certkms.RotateKeyRequest) (*kmsapi.CreateKeyResponse, error) {
+	return certkms.RotateKey(i.KeyManager, req)
+}
+
 func (i *instrumentedKeyAndDecrypterManager) CreateDecrypter(req *kmsapi.CreateDecrypterRequest) (s crypto.Decrypter, err error) {
 	return i.decrypter.CreateDecrypter(req)
 }
@@ -0,0 +1,458 @@
+package authority
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"math/big"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/nosql"
+	"go.step.sm/crypto/keyutil"
+	kmsapi "go.step.sm/crypto/kms/apiv1"
+	"go.step.sm/crypto/pemutil"
+	"golang.org/x/crypto/ocsp"
+
+	casapi "github.com/smallstep/certificates/cas/apiv1"
+	"github.com/smallstep/certificates/db"
+	"github.com/smallstep/certificates/errs"
+)
+
+var (
+	oidOCSPNonce   = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 48, 1, 2}
+	oidOCSPNoCheck = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 48, 1, 5}
+)
+
+const (
+	// ocspResponderLifetime is the lifetime of the generated responder
+	// certificates. They are rotated in the last third of their lifetime.
+	ocspResponderLifetime = 24 * time.Hour
+	// ocspMaxNonceLength is the maximum length of a nonce, RFC 8954.
+	ocspMaxNonceLength = 32
+	// ocspMaxCacheEntries is the maximum number of responses in the cache.
+	ocspMaxCacheEntries = 10000
+)
+
+// OCSPResponse contains a DER-encoded OCSP response and its validity. The
+// dates are not set in error responses.
+type OCSPResponse struct {
+	Data       []byte
+	ThisUpdate time.Time
+	NextUpdate time.Time
+}
+
+// ocspResponder is the certificate and signer used to sign OCSP responses for
+// the certificates issued by issuer.
+type ocspResponder struct {
+	cert   *x509.Certificate
+	signer crypto.Signer
+	issuer *x509.Certificate
+}
+
+type ocspCacheEntry struct {
+	response  *OCSPResponse
+	revoked   bool
+	expiresAt time.Time
+}
+
+// ocspRequest is used to parse the parts of an OCSP request not available in
+// ocsp.Request.
+type ocspRequest struct {
+	TBSRequest struct {
+		Version       int           `asn1:"explicit,tag:0,default:0,optional"`
+		RequestorName asn1.RawValue `asn1:"explicit,tag:1,optional"`
+		RequestList   []struct {
+			CertID     asn1.RawValue
+			Extensions []pkix.Extension `asn1:"explicit,tag:0,optional"`
+		}
+		Extensions []pkix.Extension `asn1:"explicit,tag:2,optional"`
+	}
+	OptionalSignature asn1.RawValue `asn1:"explicit,tag:0,optional"`
+}
+
+// initOCSP initializes the OCSP responder. The configured responder
+// certificate is validated, otherwise a new one is generated.
+func (a *Authority) initOCSP() error {
+	if _, ok := a.db.(db.RevokedCertificateDB); !ok {
+		return errors.New("OCSP responder requested, but database does not support it")
+	}
+	if a.config.OCSP.Certificate == "" {
+		_, err := a.getOCSPResponder()
+		return err
+	}
+
+	cert, err := pemutil.ReadCertificate(a.config.OCSP.Certificate)
+	if err != nil {
+		return errors.Wrap(err, "error reading ocsp.crt")
+	}
+	signer, err := a.keyManager.CreateSigner(&kmsapi.CreateSignerRequest{
+		SigningKey: a.config.OCSP.Key,
+		Password:   a.password,
+	})
+	if err != nil {
+		return errors.Wrap(err, "error creating ocsp signer")
+	}
+
+	issuer := a.GetIntermediateCertificate()
+	if issuer == nil {
+		return errors.New("OCSP responder requires the intermediate certificate")
+	}
+	if pub, ok := cert.PublicKey.(interface{ Equal(crypto.PublicKey) bool }); !ok || !pub.Equal(signer.Public()) {
+		return errors.New("ocsp.key does not match ocsp.crt")
+	}
+	if err := validateOCSPResponder(cert, issuer, time.Now()); err != nil {
+		return err
+	}
+
+	a.ocspResponder = &ocspResponder{
+		cert:   cert,
+		signer: signer,
+		issuer: issuer,
+	}
+	return nil
+}
+
+// validateOCSPResponder checks that a configured responder certificate can
+// sign OCSP responses for the certificates issued by the given issuer.
+func validateOCSPResponder(cert, issuer *x509.Certificate, now time.Time) error {
+	switch {
+	case cert.CheckSignatureFrom(issuer) != nil:
+		return errors.New("ocsp.crt is not issued by the intermediate certificate")
+	case !slices.Contains(cert.ExtKeyUsage, x509.ExtKeyUsageOCSPSigning):
+		return errors.New("ocsp.crt does not have the OCSPSigning extended key usage")
+	case now.Before(cert.NotBefore) || now.After(cert.NotAfter):
+		return errors.New("ocsp.crt is not valid at this time")
+	}
+	// OCSP responses can only be signed with RSA and ECDSA keys.
+	switch k := cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+	case *ecdsa.PublicKey:
+		if k.Curve != elliptic.P256() && k.Curve != elliptic.P384() && k.Curve != elliptic.P521() {
+			return errors.New("ocsp.key curve is not supported")
+		}
+	default:
+		return errors.Errorf("ocsp.key type %T is not supported", k)
+	}
+	return nil
+}
+
+// getOCSPResponder returns the responder used to sign OCSP responses. A new
+// responder certificate is generated if the CA does not use a configured one
+// and the current one is in the last third of its lifetime, or it was issued
+// by a previous intermediate. A configured responder certificate is validated
+// again if the intermediate changes.
+func (a *Authority) getOCSPResponder() (*ocspResponder, error) {
+	a.ocspMutex.Lock()
+	defer a.ocspMutex.Unlock()
+
+	now := time.Now()
+	if r := a.ocspResponder; r != nil && a.config.OCSP.Certificate != "" {
+		issuer := a.GetIntermediateCertificate()
+		if issuer == nil || issuer.Equal(r.issuer) {
+			if now.After(r.cert.NotAfter) {
+				return nil, errors.New("ocsp.crt has expired")
+			}
+			return r, nil
+		}
+		if err := validateOCSPResponder(r.cert, issuer, now); err != nil {
+			return nil, errors.Wrap(err, "error validating ocsp.crt with the current intermediate")
+		}
+		r = &ocspResponder{
+			cert:   r.cert,
+			signer: r.signer,
+			issuer: issuer,
+		}
+		a.ocspResponder = r
+		a.ocspCache = nil
+		return r, nil
+	}
+	if r := a.ocspResponder; r != nil && !a.shouldRotateOCSPResponder(r, now) {
+		return r, nil
+	}
+
+	r, err := a.newOCSPResponder()
+	if err != nil {
+		return nil, err
+	}
+	a.ocspResponder = r
+	a.ocspCache = nil
+	return r, nil
+}
+
+func (a *Authority) shouldRotateOCSPResponder(r *ocspResponder, now time.Time) bool {
+	if issuer := a.GetIntermediateCertificate(); issuer != nil && !issuer.Equal(r.issuer) {
+		return true
+	}
+	return now.Add(ocspResponderLifetime / 3).After(r.cert.NotAfter)
+}
+
+// newOCSPResponder generates a new key and a responder certificate signed by
+// the CA.
+func (a *Authority) newOCSPResponder() (*ocspResponder, error) {
+	signer, err := keyutil.GenerateDefaultSigner()
+	if err != nil {
+		return nil, errors.Wrap(err, "error generating ocsp key")
+	}
+
+	resp, err := a.x509CAService.CreateCertificate(&casapi.CreateCertificateRequest{
+		Template: &x509.Certificate{
+			Subject:     pkix.Name{CommonName: a.config.CommonName + " OCSP Responder"},
+			PublicKey:   signer.Public(),
+			KeyUsage:    x509.KeyUsageDigitalSignature,
+			ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageOCSPSigning},
+			ExtraExtensions: []pkix.Extension{
+				{Id: oidOCSPNoCheck, Value: asn1.NullBytes},
+			},
+		},
+		Lifetime: ocspResponderLifetime,
+		Backdate: time.Minute,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating ocsp responder certificate")
+	}
+
+	issuer := a.GetIntermediateCertificate()
+	if len(resp.CertificateChain) > 0 {
+		issuer = resp.CertificateChain[0]
+	}
+	if issuer == nil {
+		return nil, errors.New("OCSP responder requires the intermediate certificate")
+	}
+
+	return &ocspResponder{
+		cert:   resp.Certificate,
+		signer: signer,
+		issuer: issuer,
+	}, nil
+}
+
+// GetOCSPResponse returns the signed OCSP response for the given DER-encoded
+// OCSP request. Only the first certificate in the request is checked.
+// Malformed requests or requests for certificates issued by other CAs return
+// an unsigned OCSP error response. Responses to requests without a nonce are
+// cached for half of their validity, the cache is local to this instance of
+// the CA, so a cached good response is only used if the certificate has not
+// been revoked in the database.
+func (a *Authority) GetOCSPResponse(der []byte) (*OCSPResponse, error) {
+	if !a.config.OCSP.IsEnabled() {
+		return nil, errs.Wrap(http.StatusNotFound, errors.Errorf("OCSP responder is not enabled"), "authority.GetOCSPResponse")
+	}
+
+	req, err := ocsp.ParseRequest(der)
+	if err != nil {
+		return &OCSPResponse{Data: ocsp.MalformedRequestErrorResponse}, nil
+	}
+	nonce, err := parseOCSPNonce(der)
+	if err != nil {
+		return &OCSPResponse{Data: ocsp.MalformedRequestErrorResponse}, nil
+	}
+
+	r, err := a.getOCSPResponder()
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "authority.GetOCSPResponse")
+	}
+	if !ocspIssuerMatches(r.issuer, req) {
+		return &OCSPResponse{Data: ocsp.UnauthorizedErrorResponse}, nil
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	cacheKey := fmt.Sprintf("%d/%s", req.HashAlgorithm, req.SerialNumber)
+	if nonce == nil {
+		resp, err := a.getCachedOCSPResponse(cacheKey, req.SerialNumber, now)
+		if err != nil {
+			return nil, errs.Wrap(http.StatusInternalServerError, err, "authority.GetOCSPResponse")
+		}
+		if resp != nil {
+			return resp, nil
+		}
+	}
+
+	template, err := a.ocspStatus(r, req.SerialNumber)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "authority.GetOCSPResponse")
+	}
+	template.IssuerHash = req.HashAlgorithm
+	template.Certificate = r.cert
+	template.ThisUpdate = now
+	template.NextUpdate = now.Add(a.config.OCSP.CacheDuration.Duration)
+	if template.NextUpdate.After(r.cert.NotAfter) {
+		template.NextUpdate = r.cert.NotAfter.UTC()
+	}
+	// The nonce is echoed in the single response extensions, the only ones
+	// supported by ocsp.CreateResponse.
+	if nonce != nil {
+		template.ExtraExtensions = []pkix.Extension{{Id: oidOCSPNonce, Value: nonce}}
+	}
+
+	data, err := ocsp.CreateResponse(r.issuer, r.cert, template, r.signer)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, errors.Wrap(err, "error signing ocsp response"), "authority.GetOCSPResponse")
+	}
+
+	resp := &OCSPResponse{
+		Data:       data,
+		ThisUpdate: template.ThisUpdate,
+		NextUpdate: template.NextUpdate,
+	}
+	if nonce == nil {
+		a.cacheOCSPResponse(cacheKey, resp, template.Status == ocsp.Revoked, now.Add(template.NextUpdate.Sub(now)/2))
+	}
+	return resp, nil
+}
+
+// ocspStatus returns the template of a response with the status of the
+// certificate with the given serial number. Certificates not issued by the
+// issuer of the responder have an unknown status.
+func (a *Authority) ocspStatus(r *ocspResponder, serialNumber *big.Int) (ocsp.Response, error) {
+	template := ocsp.Response{
+		SerialNumber: serialNumber,
+	}
+	sn := serialNumber.String()
+
+	rci, err := a.getOCSPRevocation(sn)
+	if err != nil {
+		return template, err
+	}
+	if rci != nil {
+		template.Status = ocsp.Revoked
+		template.RevokedAt = rci.RevokedAt.UTC()
+		template.RevocationReason = rci.ReasonCode
+		return template, nil
+	}
+
+	cert, err := a.db.GetCertificate(sn)
+	switch {
+	case err != nil && nosql.IsErrNotFound(errors.Cause(err)):
+		template.Status = ocsp.Unknown
+	case err != nil:
+		return template, err
+	case !bytes.Equal(cert.RawIssuer, r.issuer.RawSubject):
+		template.Status = ocsp.Unknown
+	default:
+		template.Status = ocsp.Good
+	}
+	return template, nil
+}
+
+// getOCSPRevocation returns the revocation of the certificate with the given
+// serial number, or nil if it's not revoked.
+func (a *Authority) getOCSPRevocation(sn string) (*db.RevokedCertificateInfo, error) {
+	rdb, ok := a.db.(db.RevokedCertificateDB)
+	if !ok {
+		return nil, errors.New("database does not support OCSP")
+	}
+	return rdb.GetRevokedCertificate(sn)
+}
+
+// getCachedOCSPResponse returns the cached response with the given key. A
+// cached response of a certificate that was not revoked is discarded if the
+// certificate has been revoked since, possibly by another instance of the CA.
+func (a *Authority) getCachedOCSPResponse(key string, serialNumber *big.Int, now time.Time) (*OCSPResponse, error) {
+	a.ocspMutex.Lock()
+	e, ok := a.ocspCache[key]
+	a.ocspMutex.Unlock()
+	if !ok || !now.Before(e.expiresAt) {
+		return nil, nil
+	}
+	if e.revoked {
+		return e.response, nil
+	}
+	rci, err := a.getOCSPRevocation(serialNumber.String())
+	if err != nil || rci != nil {
+		return nil, err
+	}
+	return e.response, nil
+}
+
+func (a *Authority) cacheOCSPResponse(key string, resp *OCSPResponse, revoked bool, expiresAt time.Time) {
+	a.ocspMutex.Lock()
+	defer a.ocspMutex.Unlock()
+	if len(a.ocspCache) >= ocspMaxCacheEntries {
+		now := time.Now()
+		for k, e := range a.ocspCache {
+			if !now.Before(e.expiresAt) {
+				delete(a.ocspCache, k)
+			}
+		}
+		if len(a.ocspCache) >= ocspMaxCacheEntries {
+			a.ocspCache = nil
+		}
+	}
+	if a.ocspCache == nil {
+		a.ocspCache = make(map[string]*ocspCacheEntry)
+	}
+	a.ocspCache[key] = &ocspCacheEntry{
+		response:  resp,
+		revoked:   revoked,
+		expiresAt: expiresAt,
+	}
+}
+
+// resetOCSPCache removes all the cached OCSP responses. It's called after a
+// revocation. It only resets the cache of this instance of the CA, the other
+// instances detect the revocation in the database when they use their cached
+// responses.
+func (a *Authority) resetOCSPCache() {
+	a.ocspMutex.Lock()
+	a.ocspCache = nil
+	a.ocspMutex.Unlock()
+}
+
+// ocspURL returns the OCSP URL added to the issued certificates.
+func (a *Authority) ocspURL() string {
+	if a.config.OCSP.URL != "" {
+		return a.config.OCSP.URL
+	}
+	return a.config.Audience("/1.0/ocsp")[0]
+}
+
+// ocspIssuerMatches returns true if the request is for a certificate issued by
+// the given issuer.
+func ocspIssuerMatches(issuer *x509.Certificate, req *ocsp.Request) bool {
+	var spki struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}
+	if _, err := asn1.Unmarshal(issuer.RawSubjectPublicKeyInfo, &spki); err != nil {
+		return false
+	}
+	h := req.HashAlgorithm.New()
+	h.Write(issuer.RawSubject)
+	nameHash := h.Sum(nil)
+	h.Reset()
+	h.Write(spki.PublicKey.RightAlign())
+	keyHash := h.Sum(nil)
+	return bytes.Equal(nameHash, req.IssuerNameHash) && bytes.Equal(keyHash, req.IssuerKeyHash)
+}
+
+// parseOCSPNonce returns the value of the nonce extension of an OCSP request,
+// if present.
+func parseOCSPNonce(der []byte) ([]byte, error) {
+	var req ocspRequest
+	if _, err := asn1.Unmarshal(der, &req); err != nil {
+		return nil, err
+	}
+	for _, ext := range req.TBSRequest.Extensions {
+		if !ext.Id.Equal(oidOCSPNonce) {
+			continue
+		}
+		var nonce []byte
+		if rest, err := asn1.Unmarshal(ext.Value, &nonce); err != nil || len(rest) > 0 {
+			return nil, errors.New("ocsp nonce is not valid")
+		}
+		if len(nonce) == 0 || len(nonce) > ocspMaxNonceLength {
+			return nil, errors.Errorf("ocsp nonce length must be between 1 and %d bytes", ocspMaxNonceLength)
+		}
+		return ext.Value, nil
+	}
+	return nil, nil
+}
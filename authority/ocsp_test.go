@@ -0,0 +1,353 @@
+package authority
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/smallstep/nosql/database"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.step.sm/crypto/keyutil"
+	"go.step.sm/crypto/minica"
+	"go.step.sm/crypto/pemutil"
+	"golang.org/x/crypto/ocsp"
+
+	"github.com/smallstep/certificates/authority/config"
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/db"
+)
+
+func testOCSPAuthority(t *testing.T, certs map[string]*x509.Certificate, revoked map[string]*db.RevokedCertificateInfo) (*Authority, *minica.CA) {
+	t.Helper()
+	a, ca := testIssuerAuthority(t)
+	a.config = &config.Config{
+		CommonName: "Test CA",
+		OCSP: &config.OCSPConfig{
+			Enabled:       true,
+			CacheDuration: &provisioner.Duration{Duration: time.Hour},
+		},
+	}
+	a.db = &db.MockAuthDB{
+		MGetRevokedCertificate: func(serialNumber string) (*db.RevokedCertificateInfo, error) {
+			return revoked[serialNumber], nil
+		},
+		MGetCertificate: func(serialNumber string) (*x509.Certificate, error) {
+			if crt, ok := certs[serialNumber]; ok {
+				return crt, nil
+			}
+			return nil, database.ErrNotFound
+		},
+	}
+	require.NoError(t, a.initOCSP())
+	return a, ca
+}
+
+func mustOCSPLeaf(t *testing.T, ca *minica.CA, sn int64) *x509.Certificate {
+	t.Helper()
+	signer, err := keyutil.GenerateDefaultSigner()
+	require.NoError(t, err)
+	crt, err := ca.Sign(&x509.Certificate{
+		SerialNumber: big.NewInt(sn),
+		Subject:      pkix.Name{CommonName: "leaf"},
+		PublicKey:    signer.Public(),
+	})
+	require.NoError(t, err)
+	return crt
+}
+
+// withOCSPNonce adds a nonce extension to an OCSP request.
+func withOCSPNonce(t *testing.T, der, nonce []byte) []byte {
+	t.Helper()
+	var req ocspRequest
+	_, err := asn1.Unmarshal(der, &req)
+	require.NoError(t, err)
+	value, err := asn1.Marshal(nonce)
+	require.NoError(t, err)
+	req.TBSRequest.Extensions = []pkix.Extension{{Id: oidOCSPNonce, Value: value}}
+	der, err = asn1.Marshal(req)
+	require.NoError(t, err)
+	return der
+}
+
+// ocspResponseNonce returns the nonce in the response extensions.
+func ocspResponseNonce(t *testing.T, der []byte) []byte {
+	t.Helper()
+	resp, err := ocsp.ParseResponse(der, nil)
+	require.NoError(t, err)
+	for _, ext := range resp.Extensions {
+		if ext.Id.Equal(oidOCSPNonce) {
+			var nonce []byte
+			_, err := asn1.Unmarshal(ext.Value, &nonce)
+			require.NoError(t, err)
+			return nonce
+		}
+	}
+	return nil
+}
+
+func TestAuthority_GetOCSPResponse(t *testing.T) {
+	certs := map[string]*x509.Certificate{}
+	revoked := map[string]*db.RevokedCertificateInfo{}
+	a, ca := testOCSPAuthority(t, certs, revoked)
+
+	good := mustOCSPLeaf(t, ca, 1)
+	certs["1"] = good
+	revokedCrt := mustOCSPLeaf(t, ca, 2)
+	certs["2"] = revokedCrt
+	revokedAt := time.Now().Add(-time.Hour).UTC().Truncate(time.Second)
+	revoked["2"] = &db.RevokedCertificateInfo{Serial: "2", ReasonCode: ocsp.KeyCompromise, RevokedAt: revokedAt}
+	unknown := mustOCSPLeaf(t, ca, 3)
+
+	other, err := minica.New()
+	require.NoError(t, err)
+	otherCrt := mustOCSPLeaf(t, other, 4)
+
+	mustRequest := func(crt, issuer *x509.Certificate) []byte {
+		der, err := ocsp.CreateRequest(crt, issuer, &ocsp.RequestOptions{Hash: crypto.SHA256})
+		require.NoError(t, err)
+		return der
+	}
+
+	t.Run("good", func(t *testing.T) {
+		resp, err := a.GetOCSPResponse(mustRequest(good, ca.Intermediate))
+		require.NoError(t, err)
+		r, err := ocsp.ParseResponseForCert(resp.Data, good, ca.Intermediate)
+		require.NoError(t, err)
+		assert.Equal(t, ocsp.Good, r.Status)
+		assert.Equal(t, resp.ThisUpdate, r.ThisUpdate)
+		assert.Equal(t, resp.NextUpdate, r.NextUpdate)
+		assert.Equal(t, time.Hour, r.NextUpdate.Sub(r.ThisUpdate))
+		assert.Equal(t, "Test CA OCSP Responder", r.Certificate.Subject.CommonName)
+		assert.Nil(t, ocspResponseNonce(t, resp.Data))
+	})
+
+	t.Run("revoked", func(t *testing.T) {
+		resp, err := a.GetOCSPResponse(mustRequest(revokedCrt, ca.Intermediate))
+		require.NoError(t, err)
+		r, err := ocsp.ParseResponseForCert(resp.Data, revokedCrt, ca.Intermediate)
+		require.NoError(t, err)
+		assert.Equal(t, ocsp.Revoked, r.Status)
+		assert.Equal(t, ocsp.KeyCompromise, r.RevocationReason)
+		assert.Equal(t, revokedAt, r.RevokedAt)
+	})
+
+	t.Run("unknown", func(t *testing.T) {
+		resp, err := a.GetOCSPResponse(mustRequest(unknown, ca.Intermediate))
+		require.NoError(t, err)
+		r, err := ocsp.ParseResponseForCert(resp.Data, unknown, ca.Intermediate)
+		require.NoError(t, err)
+		assert.Equal(t, ocsp.Unknown, r.Status)
+	})
+
+	t.Run("nonce", func(t *testing.T) {
+		nonce := []byte("0123456789abcdef")
+		resp, err := a.GetOCSPResponse(withOCSPNonce(t, mustRequest(good, ca.Intermediate), nonce))
+		require.NoError(t, err)
+		r, err := ocsp.ParseResponseForCert(resp.Data, good, ca.Intermediate)
+		require.NoError(t, err)
+		assert.Equal(t, ocsp.Good, r.Status)
+		assert.Equal(t, nonce, ocspResponseNonce(t, resp.Data))
+	})
+
+	t.Run("fail/nonce", func(t *testing.T) {
+		for _, nonce := range [][]byte{{}, make([]byte, ocspMaxNonceLength+1)} {
+			resp, err := a.GetOCSPResponse(withOCSPNonce(t, mustRequest(good, ca.Intermediate), nonce))
+			require.NoError(t, err)
+			assert.Equal(t, ocsp.MalformedRequestErrorResponse, resp.Data)
+		}
+	})
+
+	t.Run("fail/malformed", func(t *testing.T) {
+		resp, err := a.GetOCSPResponse([]byte("foo"))
+		require.NoError(t, err)
+		assert.Equal(t, ocsp.MalformedRequestErrorResponse, resp.Data)
+		assert.True(t, resp.ThisUpdate.IsZero())
+	})
+
+	t.Run("fail/unauthorized", func(t *testing.T) {
+		resp, err := a.GetOCSPResponse(mustRequest(otherCrt, other.Intermediate))
+		require.NoError(t, err)
+		assert.Equal(t, ocsp.UnauthorizedErrorResponse, resp.Data)
+	})
+
+	t.Run("fail/disabled", func(t *testing.T) {
+		a := &Authority{config: &config.Config{}}
+		_, err := a.GetOCSPResponse(mustRequest(good, ca.Intermediate))
+		assert.Error(t, err)
+	})
+}
+
+func TestAuthority_GetOCSPResponse_cache(t *testing.T) {
+	certs := map[string]*x509.Certificate{}
+	revoked := map[string]*db.RevokedCertificateInfo{}
+	a, ca := testOCSPAuthority(t, certs, revoked)
+	crt := mustOCSPLeaf(t, ca, 1)
+	certs["1"] = crt
+	req, err := ocsp.CreateRequest(crt, ca.Intermediate, nil)
+	require.NoError(t, err)
+
+	resp1, err := a.GetOCSPResponse(req)
+	require.NoError(t, err)
+	resp2, err := a.GetOCSPResponse(req)
+	require.NoError(t, err)
+	assert.Same(t, resp1, resp2)
+
+	// Requests with a nonce are not cached.
+	resp3, err := a.GetOCSPResponse(withOCSPNonce(t, req, []byte("nonce")))
+	require.NoError(t, err)
+	assert.NotSame(t, resp1, resp3)
+
+	// Revocations done by other instances of the CA discard the cached good
+	// responses without resetting the cache.
+	revoked["1"] = &db.RevokedCertificateInfo{Serial: "1", RevokedAt: time.Now()}
+	resp4, err := a.GetOCSPResponse(req)
+	require.NoError(t, err)
+	r, err := ocsp.ParseResponseForCert(resp4.Data, crt, ca.Intermediate)
+	require.NoError(t, err)
+	assert.Equal(t, ocsp.Revoked, r.Status)
+	assert.Equal(t, ocsp.Unspecified, r.RevocationReason)
+
+	// Revoked responses are cached.
+	resp5, err := a.GetOCSPResponse(req)
+	require.NoError(t, err)
+	assert.Same(t, resp4, resp5)
+
+	// Revocations reset the cache.
+	a.resetOCSPCache()
+	resp6, err := a.GetOCSPResponse(req)
+	require.NoError(t, err)
+	assert.NotSame(t, resp4, resp6)
+}
+
+func TestAuthority_getOCSPResponder_rotate(t *testing.T) {
+	a, ca := testOCSPAuthority(t, nil, nil)
+	r1, err := a.getOCSPResponder()
+	require.NoError(t, err)
+	assert.Contains(t, r1.cert.ExtKeyUsage, x509.ExtKeyUsageOCSPSigning)
+	assert.Equal(t, ca.Intermediate, r1.issuer)
+
+	r2, err := a.getOCSPResponder()
+	require.NoError(t, err)
+	assert.Same(t, r1, r2)
+
+	// Rotate in the last third of the lifetime.
+	r1.cert.NotAfter = time.Now().Add(ocspResponderLifetime / 4)
+	r3, err := a.getOCSPResponder()
+	require.NoError(t, err)
+	assert.NotSame(t, r1, r3)
+}
+
+func TestAuthority_initOCSP(t *testing.T) {
+	a, ca := testIssuerAuthority(t)
+	signer, err := keyutil.GenerateDefaultSigner()
+	require.NoError(t, err)
+
+	mustResponder := func(t *testing.T, eku []x509.ExtKeyUsage, pub crypto.PublicKey) string {
+		crt, err := ca.Sign(&x509.Certificate{
+			Subject:     pkix.Name{CommonName: "OCSP Responder"},
+			PublicKey:   pub,
+			ExtKeyUsage: eku,
+		})
+		require.NoError(t, err)
+		fn := filepath.Join(t.TempDir(), "ocsp.crt")
+		require.NoError(t, os.WriteFile(fn, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: crt.Raw}), 0o600))
+		return fn
+	}
+	keyFile := filepath.Join(t.TempDir(), "ocsp.key")
+	_, err = pemutil.Serialize(signer, pemutil.ToFile(keyFile, 0o600))
+	require.NoError(t, err)
+	otherSigner, err := keyutil.GenerateDefaultSigner()
+	require.NoError(t, err)
+	edSigner, err := keyutil.GenerateSigner("OKP", "Ed25519", 0)
+	require.NoError(t, err)
+	edKeyFile := filepath.Join(t.TempDir(), "ocsp.key")
+	_, err = pemutil.Serialize(edSigner, pemutil.ToFile(edKeyFile, 0o600))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		crt     string
+		key     string
+		db      db.AuthDB
+		wantErr bool
+	}{
+		{"ok", mustResponder(t, []x509.ExtKeyUsage{x509.ExtKeyUsageOCSPSigning}, signer.Public()), keyFile, &db.MockAuthDB{}, false},
+		{"fail/db", mustResponder(t, []x509.ExtKeyUsage{x509.ExtKeyUsageOCSPSigning}, signer.Public()), keyFile, &db.SimpleDB{}, true},
+		{"fail/eku", mustResponder(t, []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}, signer.Public()), keyFile, &db.MockAuthDB{}, true},
+		{"fail/key", mustResponder(t, []x509.ExtKeyUsage{x509.ExtKeyUsageOCSPSigning}, otherSigner.Public()), keyFile, &db.MockAuthDB{}, true},
+		{"fail/key-type", mustResponder(t, []x509.ExtKeyUsage{x509.ExtKeyUsageOCSPSigning}, edSigner.Public()), edKeyFile, &db.MockAuthDB{}, true},
+		{"fail/crt", "testdata/missing.crt", keyFile, &db.MockAuthDB{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a.db = tt.db
+			a.ocspResponder = nil
+			a.config = &config.Config{
+				OCSP: &config.OCSPConfig{Enabled: true, Certificate: tt.crt, Key: tt.key},
+			}
+			err := a.initOCSP()
+			if tt.wantErr {
+				assert.Error(t, err)
+				assert.Nil(t, a.ocspResponder)
+				return
+			}
+			require.NoError(t, err)
+			require.NotNil(t, a.ocspResponder)
+			r, err := a.getOCSPResponder()
+			require.NoError(t, err)
+			assert.Same(t, a.ocspResponder, r)
+		})
+	}
+}
+
+func TestAuthority_getOCSPResponder_configuredIssuerRotation(t *testing.T) {
+	a, ca := testIssuerAuthority(t)
+	signer, err := keyutil.GenerateDefaultSigner()
+	require.NoError(t, err)
+	crt, err := ca.Sign(&x509.Certificate{
+		Subject:     pkix.Name{CommonName: "OCSP Responder"},
+		PublicKey:   signer.Public(),
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageOCSPSigning},
+	})
+	require.NoError(t, err)
+	crtFile := filepath.Join(t.TempDir(), "ocsp.crt")
+	require.NoError(t, os.WriteFile(crtFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: crt.Raw}), 0o600))
+	keyFile := filepath.Join(t.TempDir(), "ocsp.key")
+	_, err = pemutil.Serialize(signer, pemutil.ToFile(keyFile, 0o600))
+	require.NoError(t, err)
+
+	a.db = &db.MockAuthDB{}
+	a.config = &config.Config{
+		OCSP: &config.OCSPConfig{Enabled: true, Certificate: crtFile, Key: keyFile},
+	}
+	require.NoError(t, a.initOCSP())
+
+	// An intermediate renewed with the same key keeps the responder.
+	tmpl := *ca.Intermediate
+	tmpl.SerialNumber = big.NewInt(1234)
+	der, err := x509.CreateCertificate(rand.Reader, &tmpl, ca.Root, ca.Intermediate.PublicKey, ca.RootSigner)
+	require.NoError(t, err)
+	renewed, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	a.intermediateX509Certs = []*x509.Certificate{renewed}
+	r, err := a.getOCSPResponder()
+	require.NoError(t, err)
+	assert.Equal(t, crt, r.cert)
+	assert.Equal(t, renewed, r.issuer)
+
+	// The responder cannot be used with a new intermediate.
+	other, err := minica.New()
+	require.NoError(t, err)
+	a.intermediateX509Certs = []*x509.Certificate{other.Intermediate}
+	_, err = a.getOCSPResponder()
+	assert.Error(t, err)
+}
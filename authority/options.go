@@ -288,6 +288,17 @@ func WithX509FederatedCerts(certs ...*x509.Certificate) Option {
 	}
 }
 
+// WithX509AlternateChains is an option that allows to define alternate
+// intermediate chains, for example, an intermediate cross-signed by a
+// different root. Each chain starts with the certificate that issues the
+// leaf. This option will replace any alternate chain defined before.
+func WithX509AlternateChains(chains ...[]*x509.Certificate) Option {
+	return func(a *Authority) error {
+		a.alternateX509Chains = chains
+		return nil
+	}
+}
+
 // WithX509IntermediateCerts is an option that allows to define the list of
 // intermediate certificates that the CA will be using. This option will replace
 // any intermediate certificate defined before.
@@ -0,0 +1,60 @@
+package authority
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+
+	"github.com/pkg/errors"
+	"go.step.sm/crypto/kms"
+	kmsapi "go.step.sm/crypto/kms/apiv1"
+
+	"github.com/smallstep/certificates/authority/config"
+)
+
+// decryptPassword decrypts the password used in the intermediate and SSH keys
+// using the decryption key in a KMS. The password must be encrypted using
+// RSA-OAEP with SHA-256.
+func decryptPassword(ctx context.Context, p *config.EncryptedPassword) ([]byte, error) {
+	// If the KMS is not configured, the key is either a KMS URI or a file.
+	var options kmsapi.Options
+	if p.KMS != nil {
+		options = *p.KMS
+	} else if typ, err := kmsapi.TypeOf(p.Key); err == nil {
+		options.Type = typ
+		options.URI = p.Key
+	} else {
+		options.Type = kmsapi.SoftKMS
+	}
+
+	km, err := kms.New(ctx, options)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating kms for encryptedPassword")
+	}
+	defer km.Close()
+
+	d, ok := km.(kmsapi.Decrypter)
+	if !ok {
+		return nil, errors.Errorf("kms %s does not support decryption", options.Type)
+	}
+	decrypter, err := d.CreateDecrypter(&kmsapi.CreateDecrypterRequest{
+		DecryptionKey: p.Key,
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "error creating decrypter for key %s", p.Key)
+	}
+
+	ciphertext, err := base64.StdEncoding.DecodeString(p.Ciphertext)
+	if err != nil {
+		return nil, errors.Wrap(err, "error decoding encryptedPassword ciphertext")
+	}
+	password, err := decrypter.Decrypt(rand.Reader, ciphertext, &rsa.OAEPOptions{
+		Hash: crypto.SHA256,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "error decrypting encryptedPassword")
+	}
+	return password, nil
+}
@@ -0,0 +1,72 @@
+package authority
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	kmsapi "go.step.sm/crypto/kms/apiv1"
+	_ "go.step.sm/crypto/kms/softkms"
+
+	"github.com/smallstep/certificates/authority/config"
+)
+
+func Test_decryptPassword(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	keyFile := filepath.Join(t.TempDir(), "unseal.key")
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(key),
+	}), 0o600))
+
+	encrypt := func(t *testing.T, hash crypto.Hash) string {
+		t.Helper()
+		b, err := rsa.EncryptOAEP(hash.New(), rand.Reader, &key.PublicKey, []byte("password"), nil)
+		require.NoError(t, err)
+		return base64.StdEncoding.EncodeToString(b)
+	}
+
+	tests := []struct {
+		name    string
+		p       *config.EncryptedPassword
+		want    []byte
+		wantErr bool
+	}{
+		{"ok", &config.EncryptedPassword{Key: keyFile, Ciphertext: encrypt(t, crypto.SHA256)}, []byte("password"), false},
+		{"ok kms", &config.EncryptedPassword{
+			KMS:        &kmsapi.Options{Type: kmsapi.SoftKMS},
+			Key:        "softkms:path=" + keyFile,
+			Ciphertext: encrypt(t, crypto.SHA256),
+		}, []byte("password"), false},
+		{"ok uri", &config.EncryptedPassword{Key: "softkms:path=" + keyFile, Ciphertext: encrypt(t, crypto.SHA256)}, []byte("password"), false},
+		{"fail kms", &config.EncryptedPassword{
+			KMS:        &kmsapi.Options{Type: "foo"},
+			Key:        keyFile,
+			Ciphertext: encrypt(t, crypto.SHA256),
+		}, nil, true},
+		{"fail missing key", &config.EncryptedPassword{Key: filepath.Join(t.TempDir(), "missing.key"), Ciphertext: encrypt(t, crypto.SHA256)}, nil, true},
+		{"fail base64", &config.EncryptedPassword{Key: keyFile, Ciphertext: "not-base64!"}, nil, true},
+		{"fail hash", &config.EncryptedPassword{Key: keyFile, Ciphertext: encrypt(t, crypto.SHA1)}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decryptPassword(context.Background(), tt.p)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -6,11 +6,13 @@ import (
 	"encoding/pem"
 	"fmt"
 	"net"
+	"net/url"
 	"strings"
 	"time"
 
 	"github.com/pkg/errors"
 	"github.com/smallstep/certificates/acme/wire"
+	"go.step.sm/crypto/x509util"
 	"go.step.sm/linkedca"
 )
 
@@ -31,6 +33,10 @@ const (
 	WIREOIDC_01 ACMEChallenge = "wire-oidc-01"
 	// WIREDPOP_01 is the Wire DPoP challenge.
 	WIREDPOP_01 ACMEChallenge = "wire-dpop-01"
+	// EMAIL_REPLY_00 is the email-reply-00 ACME challenge.
+	EMAIL_REPLY_00 ACMEChallenge = "email-reply-00"
+	// ONION_CSR_01 is the onion-csr-01 ACME challenge.
+	ONION_CSR_01 ACMEChallenge = "onion-csr-01"
 )
 
 // String returns a normalized version of the challenge.
@@ -41,7 +47,7 @@ func (c ACMEChallenge) String() string {
 // Validate returns an error if the acme challenge is not a valid one.
 func (c ACMEChallenge) Validate() error {
 	switch ACMEChallenge(c.String()) {
-	case HTTP_01, DNS_01, TLS_ALPN_01, DEVICE_ATTEST_01, WIREOIDC_01, WIREDPOP_01:
+	case HTTP_01, DNS_01, TLS_ALPN_01, DEVICE_ATTEST_01, WIREOIDC_01, WIREDPOP_01, EMAIL_REPLY_00, ONION_CSR_01:
 		return nil
 	default:
 		return fmt.Errorf("acme challenge %q is not supported", c)
@@ -90,7 +96,8 @@ type ACME struct {
 	Name    string `json:"name"`
 	ForceCN bool   `json:"forceCN,omitempty"`
 	// TermsOfService contains a URL pointing to the ACME server's
-	// terms of service. Defaults to empty.
+	// terms of service. If set, clients must agree to the terms of service
+	// to create a new account. Defaults to empty.
 	TermsOfService string `json:"termsOfService,omitempty"`
 	// Website contains an URL pointing to more information about
 	// the ACME server. Defaults to empty.
@@ -105,10 +112,14 @@ type ACME struct {
 	// EAB will be verified. If set to false and an EAB is provided, it is
 	// not verified. Defaults to false.
 	RequireEAB bool `json:"requireEAB,omitempty"`
+	// EnablePreAuthorization enables the newAuthz resource, allowing clients
+	// to authorize identifiers before creating an order. Valid authorizations
+	// of an account are reused in its new orders. Defaults to false.
+	EnablePreAuthorization bool `json:"enablePreAuthorization,omitempty"`
 	// Challenges contains the enabled challenges for this provisioner. If this
 	// value is not set the default http-01, dns-01 and tls-alpn-01 challenges
-	// will be enabled, device-attest-01, wire-oidc-01 and wire-dpop-01 will be
-	// disabled.
+	// will be enabled, device-attest-01, wire-oidc-01, wire-dpop-01,
+	// email-reply-00 and onion-csr-01 will be disabled.
 	Challenges []ACMEChallenge `json:"challenges,omitempty"`
 	// AttestationFormats contains the enabled attestation formats for this
 	// provisioner. If this value is not set the default apple, step and tpm
@@ -117,9 +128,29 @@ type ACME struct {
 	// AttestationRoots contains a bundle of root certificates in PEM format
 	// that will be used to verify the attestation certificates. If provided,
 	// this bundle will be used even for well-known CAs like Apple and Yubico.
-	AttestationRoots    []byte   `json:"attestationRoots,omitempty"`
-	Claims              *Claims  `json:"claims,omitempty"`
-	Options             *Options `json:"options,omitempty"`
+	AttestationRoots []byte `json:"attestationRoots,omitempty"`
+	// PermanentIdentifiers contains the policy used to authorize the
+	// permanent-identifier identifiers validated using the device-attest-01
+	// challenge. If this value is not set all of them are allowed.
+	PermanentIdentifiers *ACMEPermanentIdentifierPolicy `json:"permanentIdentifiers,omitempty"`
+	// Wildcards contains the policy used to authorize wildcard identifiers.
+	// Wildcards always require the dns-01 challenge, and if this value is not
+	// set they are allowed in any zone permitted by the X.509 policy.
+	Wildcards *ACMEWildcardPolicy `json:"wildcards,omitempty"`
+	// RenewalInfo contains the options used in the ACME Renewal Information
+	// resource, e.g. to request the early renewal of certificates.
+	RenewalInfo *ACMERenewalInfo `json:"renewalInfo,omitempty"`
+	// RateLimits contains the limits of orders, duplicate certificates and
+	// failed validations enforced for each account. Accounts can be assigned
+	// to one of the tiers defined here using the admin API.
+	RateLimits *ACMERateLimits `json:"rateLimits,omitempty"`
+	// Profiles contains the certificate profiles that clients can select in
+	// new orders. DefaultProfile is the profile used if an order does not
+	// select one, if empty the provisioner options are used.
+	Profiles            []ACMEProfile `json:"profiles,omitempty"`
+	DefaultProfile      string        `json:"defaultProfile,omitempty"`
+	Claims              *Claims       `json:"claims,omitempty"`
+	Options             *Options      `json:"options,omitempty"`
 	attestationRootPool *x509.CertPool
 	ctl                 *Controller
 }
@@ -212,12 +243,69 @@ func (p *ACME) Init(config Config) (err error) {
 		}
 	}
 
+	if err := p.Wildcards.Validate(); err != nil {
+		return err
+	}
+
+	if err := p.RenewalInfo.Validate(); err != nil {
+		return err
+	}
+
+	if err := p.RateLimits.Validate(); err != nil {
+		return err
+	}
+
+	if err := p.validateMeta(); err != nil {
+		return err
+	}
+
+	if err := p.PermanentIdentifiers.Validate(); err != nil {
+		return err
+	}
+
+	if err := p.Options.GetDNS01Options().Validate(); err != nil {
+		return err
+	}
+
 	if err := p.initializeWireOptions(); err != nil {
 		return fmt.Errorf("failed initializing Wire options: %w", err)
 	}
 
-	p.ctl, err = NewController(p, p.Claims, config, p.Options)
-	return
+	// Key attestation is only available with the device-attest-01 challenge.
+	if p.Options.GetCodeSigningOptions().IsAttestationRequired() && !p.IsChallengeEnabled(context.Background(), DEVICE_ATTEST_01) {
+		return errors.New("codeSigning requireAttestation requires the device-attest-01 challenge")
+	}
+
+	if p.ctl, err = NewController(p, p.Claims, config, p.Options); err != nil {
+		return err
+	}
+
+	return p.validateProfiles()
+}
+
+// validateMeta validates the fields exposed in the meta object of the ACME
+// directory.
+func (p *ACME) validateMeta() error {
+	for name, value := range map[string]string{
+		"termsOfService": p.TermsOfService,
+		"website":        p.Website,
+	} {
+		if value == "" {
+			continue
+		}
+		if u, err := url.Parse(value); err != nil || !u.IsAbs() || u.Host == "" {
+			return errors.Errorf("acme %s %q is not a valid URL", name, value)
+		}
+	}
+	for _, id := range p.CaaIdentities {
+		if id == "" || strings.Contains(id, "*") {
+			return errors.Errorf("acme caaIdentity %q is not valid", id)
+		}
+		if _, err := x509util.SanitizeName(id); err != nil {
+			return errors.Errorf("acme caaIdentity %q is not valid", id)
+		}
+	}
+	return nil
 }
 
 // initializeWireOptions initializes the options for the ACME Wire
@@ -268,6 +356,10 @@ const (
 	WireUser ACMEIdentifierType = "wireapp-user"
 	// WireDevice is the Wire device identifier type
 	WireDevice ACMEIdentifierType = "wireapp-device"
+	// Email is the ACME email identifier type
+	Email ACMEIdentifierType = "email"
+	// PermanentIdentifier is the ACME permanent-identifier identifier type
+	PermanentIdentifier ACMEIdentifierType = "permanent-identifier"
 )
 
 // ACMEIdentifier encodes ACME Order Identifiers
@@ -278,7 +370,19 @@ type ACMEIdentifier struct {
 
 // AuthorizeOrderIdentifier verifies the provisioner is allowed to issue a
 // certificate for an ACME Order Identifier.
-func (p *ACME) AuthorizeOrderIdentifier(_ context.Context, identifier ACMEIdentifier) error {
+func (p *ACME) AuthorizeOrderIdentifier(ctx context.Context, identifier ACMEIdentifier) error {
+	if err := p.ctl.AuthorizeIssuance(); err != nil {
+		return err
+	}
+	if identifier.Type == DNS && strings.HasPrefix(identifier.Value, "*.") {
+		if err := p.authorizeWildcard(ctx, identifier.Value); err != nil {
+			return err
+		}
+	}
+	// permanent identifiers are not supported by the X.509 name policies
+	if identifier.Type == PermanentIdentifier {
+		return p.PermanentIdentifiers.IsAllowed(identifier.Value)
+	}
 	x509Policy := p.ctl.getPolicy().getX509()
 
 	// identifier is allowed if no policy is configured
@@ -293,6 +397,8 @@ func (p *ACME) AuthorizeOrderIdentifier(_ context.Context, identifier ACMEIdenti
 		err = x509Policy.IsIPAllowed(net.ParseIP(identifier.Value))
 	case DNS:
 		err = x509Policy.IsDNSAllowed(identifier.Value)
+	case Email:
+		err = x509Policy.AreSANsAllowed([]string{identifier.Value})
 	case WireUser:
 		var wireID wire.UserID
 		if wireID, err = wire.ParseUserID(identifier.Value); err != nil {
@@ -316,6 +422,9 @@ func (p *ACME) AuthorizeOrderIdentifier(_ context.Context, identifier ACMEIdenti
 // in the ACME protocol. This method returns a list of modifiers / constraints
 // on the resulting certificate.
 func (p *ACME) AuthorizeSign(context.Context, string) ([]SignOption, error) {
+	if err := p.ctl.AuthorizeIssuance(); err != nil {
+		return nil, err
+	}
 	opts := []SignOption{
 		p,
 		// modifiers / withOptions
@@ -323,12 +432,16 @@ func (p *ACME) AuthorizeSign(context.Context, string) ([]SignOption, error) {
 		newForceCNOption(p.ForceCN),
 		profileDefaultDuration(p.ctl.Claimer.DefaultTLSCertDuration()),
 		// validators
-		defaultPublicKeyValidator{},
-		newValidityValidator(p.ctl.Claimer.MinTLSCertDuration(), p.ctl.Claimer.MaxTLSCertDuration()),
+		defaultPublicKeyValidator{keys: p.ctl.Claimer.KeyClaims()},
+		newClaimsValidityValidator(p.ctl.Claimer),
 		newX509NamePolicyValidator(p.ctl.getPolicy().getX509()),
 		p.ctl.newWebhookController(nil, linkedca.Webhook_X509),
 	}
 
+	if cs := p.Options.GetCodeSigningOptions(); cs != nil {
+		opts = append(opts, newCodeSigningOptions(cs, p.ctl.Claimer.MaxTLSCertDuration())...)
+	}
+
 	return opts, nil
 }
 
@@ -0,0 +1,66 @@
+package provisioner
+
+import (
+	"path"
+
+	"github.com/pkg/errors"
+)
+
+// ACMEPermanentIdentifierPolicy contains the rules used by an ACME provisioner
+// to authorize permanent-identifier identifiers, the device serial numbers and
+// identifiers validated using the device-attest-01 challenge. The X.509 name
+// policies cannot be used with these identifiers.
+//
+// The rules are shell patterns like "C02*" or "ABC?123", matched against the
+// whole identifier. Denied identifiers take precedence over the allowed ones.
+type ACMEPermanentIdentifierPolicy struct {
+	// Allow is the list of allowed identifiers. If empty, all the identifiers
+	// not denied are allowed.
+	Allow []string `json:"allow,omitempty"`
+	// Deny is the list of denied identifiers.
+	Deny []string `json:"deny,omitempty"`
+}
+
+// Validate validates the permanent identifier policy.
+func (p *ACMEPermanentIdentifierPolicy) Validate() error {
+	if p == nil {
+		return nil
+	}
+	for _, pattern := range append(append([]string{}, p.Allow...), p.Deny...) {
+		if pattern == "" {
+			return errors.New("acme permanent identifier pattern cannot be empty")
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return errors.Errorf("acme permanent identifier pattern %q is not valid", pattern)
+		}
+	}
+	return nil
+}
+
+// IsAllowed returns an error if the given permanent identifier is not allowed
+// by the policy.
+func (p *ACMEPermanentIdentifierPolicy) IsAllowed(value string) error {
+	if p == nil {
+		return nil
+	}
+	if value == "" {
+		return errors.New("permanent identifier cannot be empty")
+	}
+	if matchAnyPattern(p.Deny, value) {
+		return errors.Errorf("permanent identifier %q is not allowed", value)
+	}
+	if len(p.Allow) > 0 && !matchAnyPattern(p.Allow, value) {
+		return errors.Errorf("permanent identifier %q is not allowed", value)
+	}
+	return nil
+}
+
+func matchAnyPattern(patterns []string, value string) bool {
+	for _, pattern := range patterns {
+		// Patterns are validated on initialization.
+		if ok, _ := path.Match(pattern, value); ok {
+			return true
+		}
+	}
+	return false
+}
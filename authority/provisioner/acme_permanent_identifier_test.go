@@ -0,0 +1,91 @@
+package provisioner
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/smallstep/certificates/authority/policy"
+)
+
+func TestACMEPermanentIdentifierPolicy_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  *ACMEPermanentIdentifierPolicy
+		wantErr bool
+	}{
+		{"ok/nil", nil, false},
+		{"ok/empty", &ACMEPermanentIdentifierPolicy{}, false},
+		{"ok/patterns", &ACMEPermanentIdentifierPolicy{Allow: []string{"C02*", "12345678"}, Deny: []string{"C02?BAD*"}}, false},
+		{"fail/empty-allow", &ACMEPermanentIdentifierPolicy{Allow: []string{""}}, true},
+		{"fail/empty-deny", &ACMEPermanentIdentifierPolicy{Deny: []string{""}}, true},
+		{"fail/bad-pattern", &ACMEPermanentIdentifierPolicy{Allow: []string{"C02[*"}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.wantErr {
+				assert.Error(t, tt.policy.Validate())
+			} else {
+				assert.NoError(t, tt.policy.Validate())
+			}
+		})
+	}
+}
+
+func TestACMEPermanentIdentifierPolicy_IsAllowed(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  *ACMEPermanentIdentifierPolicy
+		value   string
+		wantErr bool
+	}{
+		{"ok/nil", nil, "C02XYZ", false},
+		{"ok/empty", &ACMEPermanentIdentifierPolicy{}, "C02XYZ", false},
+		{"ok/allowed", &ACMEPermanentIdentifierPolicy{Allow: []string{"C02*"}}, "C02XYZ", false},
+		{"ok/not-denied", &ACMEPermanentIdentifierPolicy{Deny: []string{"C03*"}}, "C02XYZ", false},
+		{"fail/empty-value", &ACMEPermanentIdentifierPolicy{}, "", true},
+		{"fail/not-allowed", &ACMEPermanentIdentifierPolicy{Allow: []string{"C02*"}}, "C03XYZ", true},
+		{"fail/denied", &ACMEPermanentIdentifierPolicy{Allow: []string{"C02*"}, Deny: []string{"C02X?Z"}}, "C02XYZ", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.wantErr {
+				assert.Error(t, tt.policy.IsAllowed(tt.value))
+			} else {
+				assert.NoError(t, tt.policy.IsAllowed(tt.value))
+			}
+		})
+	}
+}
+
+func TestACME_AuthorizeOrderIdentifier_permanentIdentifiers(t *testing.T) {
+	// The X.509 name policy does not apply to permanent identifiers.
+	p := &ACME{
+		Type:       "ACME",
+		Name:       "acme",
+		Challenges: []ACMEChallenge{DEVICE_ATTEST_01},
+		Options: &Options{
+			X509: &X509Options{
+				AllowedNames: &policy.X509NameOptions{
+					DNSDomains: []string{"*.example.com"},
+				},
+			},
+		},
+		PermanentIdentifiers: &ACMEPermanentIdentifierPolicy{
+			Allow: []string{"C02*"},
+		},
+	}
+	require.NoError(t, p.Init(Config{
+		Claims:    globalProvisionerClaims,
+		Audiences: testAudiences,
+	}))
+
+	ctx := context.Background()
+	assert.NoError(t, p.AuthorizeOrderIdentifier(ctx, ACMEIdentifier{Type: PermanentIdentifier, Value: "C02XYZ"}))
+	assert.EqualError(t, p.AuthorizeOrderIdentifier(ctx, ACMEIdentifier{Type: PermanentIdentifier, Value: "C03XYZ"}),
+		`permanent identifier "C03XYZ" is not allowed`)
+	assert.NoError(t, p.AuthorizeOrderIdentifier(ctx, ACMEIdentifier{Type: DNS, Value: "www.example.com"}))
+	assert.Error(t, p.AuthorizeOrderIdentifier(ctx, ACMEIdentifier{Type: DNS, Value: "www.example.org"}))
+}
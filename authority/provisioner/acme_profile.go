@@ -0,0 +1,112 @@
+package provisioner
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ACMEProfile is a named certificate profile that ACME clients can select in
+// new orders, as defined in the ACME profiles extension. A profile can define
+// its own X.509 template and certificate lifetimes, e.g. to issue server TLS,
+// client mTLS and short-lived certificates from the same provisioner.
+type ACMEProfile struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	// X509 contains the template used by the profile. If not set, the
+	// template of the provisioner is used.
+	X509 *X509Options `json:"x509,omitempty"`
+	// DefaultTLSCertDuration is the lifetime of the certificates if the order
+	// does not define one. If not set, the provisioner default is used.
+	DefaultTLSCertDuration *Duration `json:"defaultTLSCertDuration,omitempty"`
+	// MaxTLSCertDuration is the maximum lifetime of the certificates. If not
+	// set, the provisioner maximum is used.
+	MaxTLSCertDuration *Duration `json:"maxTLSCertDuration,omitempty"`
+}
+
+// GetOptions returns the provisioner options to use with the profile. The
+// X.509 options of the profile replace the ones of the provisioner.
+func (p *ACMEProfile) GetOptions(o *Options) *Options {
+	if p == nil || p.X509 == nil {
+		return o
+	}
+	var opts Options
+	if o != nil {
+		opts = *o
+	}
+	opts.X509 = p.X509
+	return &opts
+}
+
+// GetDefaultTLSCertDuration returns the default lifetime of the certificates
+// of the profile. If the profile does not define one, it returns the given
+// default, limited by the maximum lifetime of the profile.
+func (p *ACMEProfile) GetDefaultTLSCertDuration(def time.Duration) time.Duration {
+	switch {
+	case p == nil:
+		return def
+	case p.DefaultTLSCertDuration != nil && p.DefaultTLSCertDuration.Duration != 0:
+		return p.DefaultTLSCertDuration.Duration
+	case p.MaxTLSCertDuration != nil && p.MaxTLSCertDuration.Duration != 0 && p.MaxTLSCertDuration.Duration < def:
+		return p.MaxTLSCertDuration.Duration
+	default:
+		return def
+	}
+}
+
+// GetMaxTLSCertDuration returns the maximum lifetime of the certificates of
+// the profile, or the given default if the profile does not define one.
+func (p *ACMEProfile) GetMaxTLSCertDuration(def time.Duration) time.Duration {
+	if p == nil || p.MaxTLSCertDuration == nil || p.MaxTLSCertDuration.Duration == 0 {
+		return def
+	}
+	return p.MaxTLSCertDuration.Duration
+}
+
+// GetProfile returns the profile with the given name. If the name is empty it
+// returns the default profile, or nil if the provisioner does not have one.
+func (p *ACME) GetProfile(name string) (*ACMEProfile, error) {
+	if name == "" {
+		if p.DefaultProfile == "" {
+			//nolint:nilnil // no profile is used
+			return nil, nil
+		}
+		name = p.DefaultProfile
+	}
+	for i := range p.Profiles {
+		if p.Profiles[i].Name == name {
+			return &p.Profiles[i], nil
+		}
+	}
+	return nil, errors.Errorf("acme profile %q is not supported", name)
+}
+
+// validateProfiles validates the profiles of the provisioner. It must be
+// called after the initialization of the controller.
+func (p *ACME) validateProfiles() error {
+	names := make(map[string]bool, len(p.Profiles))
+	for _, profile := range p.Profiles {
+		if profile.Name == "" {
+			return errors.New("acme profile name cannot be empty")
+		}
+		if names[profile.Name] {
+			return errors.Errorf("acme profile %q is duplicated", profile.Name)
+		}
+		names[profile.Name] = true
+
+		minDur := p.ctl.Claimer.MinTLSCertDuration()
+		maxDur := p.ctl.Claimer.MaxTLSCertDuration()
+		profileDef := profile.GetDefaultTLSCertDuration(p.ctl.Claimer.DefaultTLSCertDuration())
+		profileMax := profile.GetMaxTLSCertDuration(maxDur)
+		switch {
+		case profileMax < minDur || profileMax > maxDur:
+			return errors.Errorf("acme profile %q maxTLSCertDuration must be between %s and %s", profile.Name, minDur, maxDur)
+		case profileDef < minDur || profileDef > profileMax:
+			return errors.Errorf("acme profile %q defaultTLSCertDuration must be between %s and %s", profile.Name, minDur, profileMax)
+		}
+	}
+	if p.DefaultProfile != "" && !names[p.DefaultProfile] {
+		return errors.Errorf("acme default profile %q is not defined", p.DefaultProfile)
+	}
+	return nil
+}
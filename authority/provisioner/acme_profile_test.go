@@ -0,0 +1,124 @@
+package provisioner
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestACMEProfile_GetOptions(t *testing.T) {
+	x509Opts := &X509Options{Template: `{"subject": {{ toJson .Subject }}}`}
+	profileX509Opts := &X509Options{Template: `{"sans": {{ toJson .SANs }}}`}
+	opts := &Options{X509: x509Opts, DNS01: &DNS01Options{PropagationCheck: true}}
+
+	var p *ACMEProfile
+	assert.Equal(t, opts, p.GetOptions(opts))
+	assert.Equal(t, opts, (&ACMEProfile{Name: "tlsserver"}).GetOptions(opts))
+
+	p = &ACMEProfile{Name: "tlsserver", X509: profileX509Opts}
+	assert.Equal(t, &Options{X509: profileX509Opts, DNS01: opts.DNS01}, p.GetOptions(opts))
+	assert.Equal(t, &Options{X509: profileX509Opts}, p.GetOptions(nil))
+	// The options of the provisioner are not modified.
+	assert.Equal(t, x509Opts, opts.X509)
+}
+
+func TestACMEProfile_GetTLSCertDuration(t *testing.T) {
+	tests := []struct {
+		name        string
+		profile     *ACMEProfile
+		wantDefault time.Duration
+		wantMax     time.Duration
+	}{
+		{"nil", nil, 24 * time.Hour, 48 * time.Hour},
+		{"empty", &ACMEProfile{Name: "tlsserver"}, 24 * time.Hour, 48 * time.Hour},
+		{"default", &ACMEProfile{Name: "tlsserver", DefaultTLSCertDuration: &Duration{Duration: time.Hour}}, time.Hour, 48 * time.Hour},
+		{"max", &ACMEProfile{Name: "shortlived", MaxTLSCertDuration: &Duration{Duration: time.Hour}}, time.Hour, time.Hour},
+		{"max greater than default", &ACMEProfile{Name: "tlsserver", MaxTLSCertDuration: &Duration{Duration: 36 * time.Hour}}, 24 * time.Hour, 36 * time.Hour},
+		{"both", &ACMEProfile{
+			Name:                   "tlsclient",
+			DefaultTLSCertDuration: &Duration{Duration: 2 * time.Hour},
+			MaxTLSCertDuration:     &Duration{Duration: 4 * time.Hour},
+		}, 2 * time.Hour, 4 * time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.wantDefault, tt.profile.GetDefaultTLSCertDuration(24*time.Hour))
+			assert.Equal(t, tt.wantMax, tt.profile.GetMaxTLSCertDuration(48*time.Hour))
+		})
+	}
+}
+
+func TestACME_GetProfile(t *testing.T) {
+	p := &ACME{
+		Profiles: []ACMEProfile{
+			{Name: "tlsserver"},
+			{Name: "shortlived", MaxTLSCertDuration: &Duration{Duration: time.Hour}},
+		},
+	}
+
+	profile, err := p.GetProfile("")
+	require.NoError(t, err)
+	assert.Nil(t, profile)
+
+	profile, err = p.GetProfile("shortlived")
+	require.NoError(t, err)
+	assert.Equal(t, &p.Profiles[1], profile)
+
+	_, err = p.GetProfile("tlsclient")
+	assert.EqualError(t, err, `acme profile "tlsclient" is not supported`)
+
+	p.DefaultProfile = "tlsserver"
+	profile, err = p.GetProfile("")
+	require.NoError(t, err)
+	assert.Equal(t, &p.Profiles[0], profile)
+}
+
+func TestACME_validateProfiles(t *testing.T) {
+	tests := []struct {
+		name           string
+		profiles       []ACMEProfile
+		defaultProfile string
+		wantErr        string
+	}{
+		{"ok/empty", nil, "", ""},
+		{"ok", []ACMEProfile{
+			{Name: "tlsserver"},
+			{Name: "shortlived", MaxTLSCertDuration: &Duration{Duration: time.Hour}},
+		}, "tlsserver", ""},
+		{"fail/empty-name", []ACMEProfile{{}}, "", "acme profile name cannot be empty"},
+		{"fail/duplicated", []ACMEProfile{{Name: "tlsserver"}, {Name: "tlsserver"}}, "", `acme profile "tlsserver" is duplicated`},
+		{"fail/max-too-long", []ACMEProfile{
+			{Name: "tlsserver", MaxTLSCertDuration: &Duration{Duration: 48 * time.Hour}},
+		}, "", `acme profile "tlsserver" maxTLSCertDuration must be between 5m0s and 24h0m0s`},
+		{"fail/max-too-short", []ACMEProfile{
+			{Name: "tlsserver", MaxTLSCertDuration: &Duration{Duration: time.Minute}},
+		}, "", `acme profile "tlsserver" maxTLSCertDuration must be between 5m0s and 24h0m0s`},
+		{"fail/default-greater-than-max", []ACMEProfile{{
+			Name:                   "tlsserver",
+			DefaultTLSCertDuration: &Duration{Duration: 2 * time.Hour},
+			MaxTLSCertDuration:     &Duration{Duration: time.Hour},
+		}}, "", `acme profile "tlsserver" defaultTLSCertDuration must be between 5m0s and 1h0m0s`},
+		{"fail/default-profile", []ACMEProfile{{Name: "tlsserver"}}, "tlsclient", `acme default profile "tlsclient" is not defined`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &ACME{
+				Name:           "foo",
+				Type:           "ACME",
+				Profiles:       tt.profiles,
+				DefaultProfile: tt.defaultProfile,
+			}
+			err := p.Init(Config{
+				Claims:    globalProvisionerClaims,
+				Audiences: testAudiences,
+			})
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package provisioner
+
+import (
+	"github.com/pkg/errors"
+)
+
+// ACMERateLimit contains the limits enforced for each account of an ACME
+// provisioner. Limits with a zero value are not enforced.
+type ACMERateLimit struct {
+	// OrdersPerHour is the maximum number of orders that an account can
+	// create in an hour.
+	OrdersPerHour int `json:"ordersPerHour,omitempty"`
+	// DuplicateCertificatesPerWeek is the maximum number of certificates with
+	// the same set of identifiers that can be issued in a week.
+	DuplicateCertificatesPerWeek int `json:"duplicateCertificatesPerWeek,omitempty"`
+	// FailedValidationsPerHour is the maximum number of challenge validations
+	// that can fail in an hour. Once reached, the validation of new challenges
+	// is rejected until the window ends.
+	FailedValidationsPerHour int `json:"failedValidationsPerHour,omitempty"`
+}
+
+// Validate returns an error if the limits are negative.
+func (l *ACMERateLimit) Validate() error {
+	switch {
+	case l.OrdersPerHour < 0:
+		return errors.Errorf("ordersPerHour %d cannot be negative", l.OrdersPerHour)
+	case l.DuplicateCertificatesPerWeek < 0:
+		return errors.Errorf("duplicateCertificatesPerWeek %d cannot be negative", l.DuplicateCertificatesPerWeek)
+	case l.FailedValidationsPerHour < 0:
+		return errors.Errorf("failedValidationsPerHour %d cannot be negative", l.FailedValidationsPerHour)
+	default:
+		return nil
+	}
+}
+
+// ACMERateLimits contains the rate limits of an ACME provisioner. The
+// embedded limits apply to all the accounts, and Tiers defines alternative
+// limits that can be assigned to an account using the admin API.
+type ACMERateLimits struct {
+	ACMERateLimit
+	Tiers map[string]ACMERateLimit `json:"tiers,omitempty"`
+}
+
+// Validate validates the default limits and the tiers.
+func (o *ACMERateLimits) Validate() error {
+	if o == nil {
+		return nil
+	}
+	if err := o.ACMERateLimit.Validate(); err != nil {
+		return errors.Wrap(err, "acme rateLimits")
+	}
+	for name, tier := range o.Tiers {
+		if name == "" {
+			return errors.New("acme rateLimits tiers cannot contain an empty name")
+		}
+		if err := tier.Validate(); err != nil {
+			return errors.Wrapf(err, "acme rateLimits tier %s", name)
+		}
+	}
+	return nil
+}
+
+// HasTier returns true if a tier with the given name is defined.
+func (o *ACMERateLimits) HasTier(name string) bool {
+	if o == nil {
+		return false
+	}
+	_, ok := o.Tiers[name]
+	return ok
+}
+
+// GetLimit returns the limits of the given tier. The default limits are
+// returned if the tier is empty or does not exist, e.g. because it has been
+// removed after being assigned to an account. It returns nil if no rate
+// limits are configured.
+func (o *ACMERateLimits) GetLimit(tier string) *ACMERateLimit {
+	if o == nil {
+		return nil
+	}
+	if l, ok := o.Tiers[tier]; ok && tier != "" {
+		return &l
+	}
+	return &o.ACMERateLimit
+}
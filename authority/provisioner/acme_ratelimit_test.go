@@ -0,0 +1,52 @@
+package provisioner
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestACMERateLimits_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		limits  *ACMERateLimits
+		wantErr bool
+	}{
+		{"ok/nil", nil, false},
+		{"ok/empty", &ACMERateLimits{}, false},
+		{"ok/full", &ACMERateLimits{
+			ACMERateLimit: ACMERateLimit{OrdersPerHour: 10, DuplicateCertificatesPerWeek: 5, FailedValidationsPerHour: 5},
+			Tiers:         map[string]ACMERateLimit{"gold": {OrdersPerHour: 1000}},
+		}, false},
+		{"fail/ordersPerHour", &ACMERateLimits{ACMERateLimit: ACMERateLimit{OrdersPerHour: -1}}, true},
+		{"fail/duplicateCertificatesPerWeek", &ACMERateLimits{ACMERateLimit: ACMERateLimit{DuplicateCertificatesPerWeek: -1}}, true},
+		{"fail/failedValidationsPerHour", &ACMERateLimits{ACMERateLimit: ACMERateLimit{FailedValidationsPerHour: -1}}, true},
+		{"fail/tier", &ACMERateLimits{Tiers: map[string]ACMERateLimit{"gold": {OrdersPerHour: -1}}}, true},
+		{"fail/tier-name", &ACMERateLimits{Tiers: map[string]ACMERateLimit{"": {OrdersPerHour: 1}}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.wantErr {
+				assert.Error(t, tt.limits.Validate())
+			} else {
+				assert.NoError(t, tt.limits.Validate())
+			}
+		})
+	}
+}
+
+func TestACMERateLimits_GetLimit(t *testing.T) {
+	var limits *ACMERateLimits
+	assert.Nil(t, limits.GetLimit(""))
+	assert.False(t, limits.HasTier("gold"))
+
+	limits = &ACMERateLimits{
+		ACMERateLimit: ACMERateLimit{OrdersPerHour: 10},
+		Tiers:         map[string]ACMERateLimit{"gold": {OrdersPerHour: 1000}},
+	}
+	assert.Equal(t, &ACMERateLimit{OrdersPerHour: 10}, limits.GetLimit(""))
+	assert.Equal(t, &ACMERateLimit{OrdersPerHour: 1000}, limits.GetLimit("gold"))
+	assert.Equal(t, &ACMERateLimit{OrdersPerHour: 10}, limits.GetLimit("removed"))
+	assert.True(t, limits.HasTier("gold"))
+	assert.False(t, limits.HasTier("removed"))
+}
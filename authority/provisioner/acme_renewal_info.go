@@ -0,0 +1,62 @@
+package provisioner
+
+import (
+	"crypto/x509"
+	"net/url"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ACMERenewalInfo contains the options used by an ACME provisioner in the
+// ACME Renewal Information (ARI) resource.
+type ACMERenewalInfo struct {
+	// RenewIssuedBefore requests the immediate renewal of all the certificates
+	// issued before the given time, e.g. after a mass-revocation event.
+	RenewIssuedBefore *time.Time `json:"renewIssuedBefore,omitempty"`
+	// ExplanationURL is a page with the reason of the early renewal. It's only
+	// returned to clients if the renewal is forced.
+	ExplanationURL string `json:"explanationURL,omitempty"`
+	// RetryAfter is the time clients should wait before fetching the renewal
+	// information again. It defaults to 6h.
+	RetryAfter *Duration `json:"retryAfter,omitempty"`
+}
+
+// Validate validates the renewal information options.
+func (o *ACMERenewalInfo) Validate() error {
+	if o == nil {
+		return nil
+	}
+	if o.ExplanationURL != "" {
+		if u, err := url.Parse(o.ExplanationURL); err != nil || !u.IsAbs() {
+			return errors.Errorf("acme renewalInfo explanationURL %q is not valid", o.ExplanationURL)
+		}
+	}
+	if o.RetryAfter != nil && o.RetryAfter.Duration < 0 {
+		return errors.New("acme renewalInfo retryAfter cannot be negative")
+	}
+	return nil
+}
+
+// ShouldRenew returns true if the given certificate must be renewed
+// immediately.
+func (o *ACMERenewalInfo) ShouldRenew(cert *x509.Certificate) bool {
+	return o != nil && o.RenewIssuedBefore != nil && cert.NotBefore.Before(*o.RenewIssuedBefore)
+}
+
+// GetExplanationURL returns the URL with the reason of the early renewals.
+func (o *ACMERenewalInfo) GetExplanationURL() string {
+	if o == nil {
+		return ""
+	}
+	return o.ExplanationURL
+}
+
+// GetRetryAfter returns the time clients should wait before fetching the
+// renewal information again.
+func (o *ACMERenewalInfo) GetRetryAfter() time.Duration {
+	if o == nil || o.RetryAfter == nil || o.RetryAfter.Duration == 0 {
+		return 6 * time.Hour
+	}
+	return o.RetryAfter.Duration
+}
@@ -0,0 +1,56 @@
+package provisioner
+
+import (
+	"crypto/x509"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestACMERenewalInfo_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		info    *ACMERenewalInfo
+		wantErr bool
+	}{
+		{"ok/nil", nil, false},
+		{"ok/empty", &ACMERenewalInfo{}, false},
+		{"ok/full", &ACMERenewalInfo{ExplanationURL: "https://status.example.com/", RetryAfter: &Duration{Duration: time.Hour}}, false},
+		{"fail/explanationURL", &ACMERenewalInfo{ExplanationURL: "status.example.com"}, true},
+		{"fail/retryAfter", &ACMERenewalInfo{RetryAfter: &Duration{Duration: -time.Hour}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.wantErr {
+				assert.Error(t, tt.info.Validate())
+			} else {
+				assert.NoError(t, tt.info.Validate())
+			}
+		})
+	}
+}
+
+func TestACMERenewalInfo_ShouldRenew(t *testing.T) {
+	now := time.Now()
+	before := now.Add(-time.Hour)
+	cert := &x509.Certificate{NotBefore: now.Add(-2 * time.Hour)}
+
+	var info *ACMERenewalInfo
+	assert.False(t, info.ShouldRenew(cert))
+	assert.Empty(t, info.GetExplanationURL())
+	assert.Equal(t, 6*time.Hour, info.GetRetryAfter())
+
+	info = &ACMERenewalInfo{}
+	assert.False(t, info.ShouldRenew(cert))
+
+	info = &ACMERenewalInfo{
+		RenewIssuedBefore: &before,
+		ExplanationURL:    "https://status.example.com/",
+		RetryAfter:        &Duration{Duration: time.Hour},
+	}
+	assert.True(t, info.ShouldRenew(cert))
+	assert.False(t, info.ShouldRenew(&x509.Certificate{NotBefore: now}))
+	assert.Equal(t, "https://status.example.com/", info.GetExplanationURL())
+	assert.Equal(t, time.Hour, info.GetRetryAfter())
+}
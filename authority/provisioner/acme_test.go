@@ -130,12 +130,56 @@ MCowBQYDK2VwAyEA5c+4NKZSNQcR1T8qN6SjwgdPZQ0Ge12Ylx/YeGAJ35k=
 				err: errors.New("acme challenge \"zar\" is not supported"),
 			}
 		},
+		"fail/bad-wildcard-zone": func(t *testing.T) ProvisionerValidateTest {
+			return ProvisionerValidateTest{
+				p:   &ACME{Name: "foo", Type: "ACME", Wildcards: &ACMEWildcardPolicy{AllowedZones: []string{"*.example.com"}}},
+				err: errors.New("acme wildcard zone \"*.example.com\" is not valid"),
+			}
+		},
+		"fail/bad-terms-of-service": func(t *testing.T) ProvisionerValidateTest {
+			return ProvisionerValidateTest{
+				p:   &ACME{Name: "foo", Type: "ACME", TermsOfService: "/terms"},
+				err: errors.New("acme termsOfService \"/terms\" is not a valid URL"),
+			}
+		},
+		"fail/bad-website": func(t *testing.T) ProvisionerValidateTest {
+			return ProvisionerValidateTest{
+				p:   &ACME{Name: "foo", Type: "ACME", Website: "ca.example.com"},
+				err: errors.New("acme website \"ca.example.com\" is not a valid URL"),
+			}
+		},
+		"fail/bad-caa-identity": func(t *testing.T) ProvisionerValidateTest {
+			return ProvisionerValidateTest{
+				p:   &ACME{Name: "foo", Type: "ACME", CaaIdentities: []string{"ca.example.com", "*.example.com"}},
+				err: errors.New("acme caaIdentity \"*.example.com\" is not valid"),
+			}
+		},
+		"fail/bad-permanent-identifier": func(t *testing.T) ProvisionerValidateTest {
+			return ProvisionerValidateTest{
+				p:   &ACME{Name: "foo", Type: "ACME", PermanentIdentifiers: &ACMEPermanentIdentifierPolicy{Allow: []string{"C02[*"}}},
+				err: errors.New("acme permanent identifier pattern \"C02[*\" is not valid"),
+			}
+		},
+		"fail/bad-dns01-resolver": func(t *testing.T) ProvisionerValidateTest {
+			return ProvisionerValidateTest{
+				p:   &ACME{Name: "foo", Type: "ACME", Options: &Options{DNS01: &DNS01Options{Resolvers: []string{""}}}},
+				err: errors.New("dns01 resolver cannot be empty"),
+			}
+		},
 		"fail/bad-attestation-format": func(t *testing.T) ProvisionerValidateTest {
 			return ProvisionerValidateTest{
 				p:   &ACME{Name: "foo", Type: "ACME", AttestationFormats: []ACMEAttestationFormat{APPLE, "zar"}},
 				err: errors.New("acme attestation format \"zar\" is not supported"),
 			}
 		},
+		"fail/code-signing-attestation": func(t *testing.T) ProvisionerValidateTest {
+			return ProvisionerValidateTest{
+				p: &ACME{Name: "foo", Type: "ACME", Options: &Options{
+					CodeSigning: &CodeSigningOptions{RequireAttestation: true},
+				}},
+				err: errors.New("codeSigning requireAttestation requires the device-attest-01 challenge"),
+			}
+		},
 		"fail/parse-attestation-roots": func(t *testing.T) ProvisionerValidateTest {
 			return ProvisionerValidateTest{
 				p:   &ACME{Name: "foo", Type: "ACME", AttestationRoots: []byte("-----BEGIN CERTIFICATE-----\nZm9v\n-----END CERTIFICATE-----")},
@@ -192,6 +236,18 @@ MCowBQYDK2VwAyEA5c+4NKZSNQcR1T8qN6SjwgdPZQ0Ge12Ylx/YeGAJ35k=
 				p: &ACME{Name: "foo", Type: "ACME"},
 			}
 		},
+		"ok/meta": func(t *testing.T) ProvisionerValidateTest {
+			return ProvisionerValidateTest{
+				p: &ACME{
+					Name:           "foo",
+					Type:           "ACME",
+					TermsOfService: "https://ca.example.com/terms",
+					Website:        "https://ca.example.com",
+					CaaIdentities:  []string{"ca.example.com"},
+					RequireEAB:     true,
+				},
+			}
+		},
 		"ok/attestation": func(t *testing.T) ProvisionerValidateTest {
 			return ProvisionerValidateTest{
 				p: &ACME{
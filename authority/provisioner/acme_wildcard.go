@@ -0,0 +1,83 @@
+package provisioner
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	"go.step.sm/crypto/x509util"
+)
+
+// ACMEWildcardPolicy contains the rules used by an ACME provisioner to
+// authorize wildcard identifiers.
+type ACMEWildcardPolicy struct {
+	// Disable rejects all the wildcard identifiers.
+	Disable bool `json:"disable,omitempty"`
+	// AllowedZones is the list of DNS zones where wildcard identifiers are
+	// allowed. A zone allows the wildcards of the zone and all its
+	// subdomains, e.g. "example.com" allows "*.example.com" and
+	// "*.internal.example.com". If empty, wildcards are allowed in all zones.
+	AllowedZones []string `json:"allowedZones,omitempty"`
+}
+
+// ACMEWildcardError is the error returned when the wildcard policy of an ACME
+// provisioner does not allow a wildcard identifier.
+type ACMEWildcardError struct {
+	Identifier string
+	Reason     string
+}
+
+// Error implements the error interface.
+func (e *ACMEWildcardError) Error() string {
+	return fmt.Sprintf("wildcard identifier %q is not allowed: %s", e.Identifier, e.Reason)
+}
+
+// Validate validates the wildcard policy.
+func (p *ACMEWildcardPolicy) Validate() error {
+	if p == nil {
+		return nil
+	}
+	for _, zone := range p.AllowedZones {
+		if zone == "" || strings.Contains(zone, "*") {
+			return errors.Errorf("acme wildcard zone %q is not valid", zone)
+		}
+		if _, err := x509util.SanitizeName(strings.TrimSuffix(zone, ".")); err != nil {
+			return errors.Errorf("acme wildcard zone %q is not valid", zone)
+		}
+	}
+	return nil
+}
+
+// isZoneAllowed returns true if the given domain is one of the allowed zones
+// or a subdomain of them.
+func (p *ACMEWildcardPolicy) isZoneAllowed(domain string) bool {
+	if len(p.AllowedZones) == 0 {
+		return true
+	}
+	domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+	for _, zone := range p.AllowedZones {
+		zone = strings.ToLower(strings.TrimSuffix(zone, "."))
+		if domain == zone || strings.HasSuffix(domain, "."+zone) {
+			return true
+		}
+	}
+	return false
+}
+
+// authorizeWildcard verifies that the wildcard policy allows the given
+// wildcard identifier. Wildcards can only be validated using the dns-01
+// challenge, so they are always rejected if the challenge is not enabled.
+func (p *ACME) authorizeWildcard(ctx context.Context, value string) error {
+	domain := strings.TrimPrefix(value, "*.")
+	switch {
+	case p.Wildcards != nil && p.Wildcards.Disable:
+		return &ACMEWildcardError{Identifier: value, Reason: "wildcards are disabled"}
+	case !p.IsChallengeEnabled(ctx, DNS_01):
+		return &ACMEWildcardError{Identifier: value, Reason: "dns-01 challenge is not enabled"}
+	case p.Wildcards != nil && !p.Wildcards.isZoneAllowed(domain):
+		return &ACMEWildcardError{Identifier: value, Reason: fmt.Sprintf("zone %q is not in the allowed zones", domain)}
+	default:
+		return nil
+	}
+}
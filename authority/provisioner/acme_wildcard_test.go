@@ -0,0 +1,75 @@
+package provisioner
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestACMEWildcardPolicy_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  *ACMEWildcardPolicy
+		wantErr bool
+	}{
+		{"ok/nil", nil, false},
+		{"ok/empty", &ACMEWildcardPolicy{}, false},
+		{"ok/zones", &ACMEWildcardPolicy{AllowedZones: []string{"example.com", "internal", "corp.example.org."}}, false},
+		{"fail/empty-zone", &ACMEWildcardPolicy{AllowedZones: []string{""}}, true},
+		{"fail/wildcard-zone", &ACMEWildcardPolicy{AllowedZones: []string{"*.example.com"}}, true},
+		{"fail/bad-zone", &ACMEWildcardPolicy{AllowedZones: []string{"exa mple.com"}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.wantErr {
+				assert.Error(t, tt.policy.Validate())
+			} else {
+				assert.NoError(t, tt.policy.Validate())
+			}
+		})
+	}
+}
+
+func TestACME_AuthorizeOrderIdentifier_wildcards(t *testing.T) {
+	newACME := func(t *testing.T, policy *ACMEWildcardPolicy, challenges ...ACMEChallenge) *ACME {
+		p, err := generateACME()
+		require.NoError(t, err)
+		p.Wildcards = policy
+		p.Challenges = challenges
+		return p
+	}
+
+	tests := []struct {
+		name       string
+		p          *ACME
+		identifier string
+		wantReason string
+	}{
+		{"ok/no-policy", newACME(t, nil), "*.example.com", ""},
+		{"ok/no-wildcard", newACME(t, &ACMEWildcardPolicy{Disable: true}), "www.example.com", ""},
+		{"ok/zone", newACME(t, &ACMEWildcardPolicy{AllowedZones: []string{"example.com"}}), "*.example.com", ""},
+		{"ok/subdomain", newACME(t, &ACMEWildcardPolicy{AllowedZones: []string{"Example.com."}}), "*.internal.EXAMPLE.com", ""},
+		{"ok/dns-01", newACME(t, nil, DNS_01), "*.example.com", ""},
+		{"fail/disabled", newACME(t, &ACMEWildcardPolicy{Disable: true}), "*.example.com", "wildcards are disabled"},
+		{"fail/zone", newACME(t, &ACMEWildcardPolicy{AllowedZones: []string{"example.com"}}), "*.example.org", `zone "example.org" is not in the allowed zones`},
+		{"fail/suffix", newACME(t, &ACMEWildcardPolicy{AllowedZones: []string{"example.com"}}), "*.badexample.com", `zone "badexample.com" is not in the allowed zones`},
+		{"fail/no-dns-01", newACME(t, nil, HTTP_01, TLS_ALPN_01), "*.example.com", "dns-01 challenge is not enabled"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.p.AuthorizeOrderIdentifier(context.Background(), ACMEIdentifier{Type: DNS, Value: tt.identifier})
+			if tt.wantReason == "" {
+				assert.NoError(t, err)
+				return
+			}
+			var wErr *ACMEWildcardError
+			if assert.True(t, errors.As(err, &wErr)) {
+				assert.Equal(t, tt.identifier, wErr.Identifier)
+				assert.Equal(t, tt.wantReason, wErr.Reason)
+			}
+		})
+	}
+}
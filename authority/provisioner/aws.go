@@ -13,6 +13,7 @@ import (
 	"net"
 	"net/http"
 	"os"
+	"regexp"
 	"strings"
 	"time"
 
@@ -68,6 +69,9 @@ type awsConfig struct {
 	tokenTTL           string
 	certificates       []*x509.Certificate
 	signatureAlgorithm x509.SignatureAlgorithm
+	stsURL             string
+	stsRegion          string
+	stsHostRegexp      *regexp.Regexp
 }
 
 func newAWSConfig(certPath string) (*awsConfig, error) {
@@ -103,6 +107,14 @@ func newAWSConfig(certPath string) (*awsConfig, error) {
 		return nil, errors.New("error parsing AWS IID certificate: no certificates found")
 	}
 
+	// Use the regional STS endpoint if a region is configured.
+	stsURL, stsRegion := awsSTSURL, "us-east-1"
+	if region := os.Getenv("AWS_REGION"); region != "" {
+		stsURL, stsRegion = "https://sts."+region+".amazonaws.com/", region
+	} else if region := os.Getenv("AWS_DEFAULT_REGION"); region != "" {
+		stsURL, stsRegion = "https://sts."+region+".amazonaws.com/", region
+	}
+
 	return &awsConfig{
 		identityURL:        awsIdentityURL,
 		signatureURL:       awsSignatureURL,
@@ -110,14 +122,19 @@ func newAWSConfig(certPath string) (*awsConfig, error) {
 		tokenTTL:           awsAPITokenTTL,
 		certificates:       certs,
 		signatureAlgorithm: awsSignatureAlgorithm,
+		stsURL:             stsURL,
+		stsRegion:          stsRegion,
+		stsHostRegexp:      awsSTSHostRegexp,
 	}, nil
 }
 
 type awsPayload struct {
 	jose.Claims
 	Amazon   awsAmazonPayload `json:"amazon"`
+	IAM      *awsIAMPayload   `json:"iam,omitempty"`
 	SANs     []string         `json:"sans"`
 	document awsInstanceIdentityDocument
+	identity *awsCallerIdentity
 }
 
 type awsAmazonPayload struct {
@@ -158,6 +175,13 @@ type awsInstanceIdentityDocument struct {
 // IIDRoots can be used to specify a path to the certificates used to verify the
 // identity certificate signature.
 //
+// If IAMPrincipals is set, the provisioner will also accept tokens with a signed
+// sts:GetCallerIdentity request, so any IAM identity, like ECS tasks or Lambda
+// functions, can get a certificate. The request is sent to AWS by the CA, and
+// the ARN of the caller must match one of the given patterns, e.g.
+// "arn:aws:sts::123456789012:assumed-role/my-role/*". With DisableCustomSANs,
+// the subject of the token and the only SAN must be the ARN.
+//
 // Amazon Identity docs are available at
 // https://docs.aws.amazon.com/AWSEC2/latest/UserGuide/instance-identity-documents.html
 type AWS struct {
@@ -171,6 +195,7 @@ type AWS struct {
 	IMDSVersions           []string `json:"imdsVersions"`
 	InstanceAge            Duration `json:"instanceAge,omitempty"`
 	IIDRoots               string   `json:"iidRoots,omitempty"`
+	IAMPrincipals          []string `json:"iamPrincipals,omitempty"`
 	Claims                 *Claims  `json:"claims,omitempty"`
 	Options                *Options `json:"options,omitempty"`
 	config                 *awsConfig
@@ -197,6 +222,13 @@ func (p *AWS) GetTokenID(token string) (string, error) {
 	if err != nil {
 		return "", err
 	}
+	// IAM requests are signed with a timestamp, use the signature as the
+	// identifier, so the request cannot be reused.
+	if payload.identity != nil {
+		sum := sha256.Sum256([]byte(payload.IAM.Headers.Get("Authorization")))
+		return strings.ToLower(hex.EncodeToString(sum[:])), nil
+	}
+
 	// If TOFU is disabled create an ID for the token, so it cannot be reused.
 	// The timestamps, document and signatures should be mostly unique.
 	if p.DisableTrustOnFirstUse {
@@ -225,13 +257,22 @@ func (p *AWS) GetEncryptedKey() (kid, key string, ok bool) {
 	return "", "", false
 }
 
+// GetOptions returns the configured provisioner options.
+func (p *AWS) GetOptions() *Options {
+	return p.Options
+}
+
 // GetIdentityToken retrieves the identity document and it's signature and
-// generates a token with them.
+// generates a token with them. If IAM principals are configured, it generates
+// a token with a signed sts:GetCallerIdentity request instead.
 func (p *AWS) GetIdentityToken(subject, caURL string) (string, error) {
 	// Initialize the config if this method is used from the cli.
 	if err := p.assertConfig(); err != nil {
 		return "", err
 	}
+	if len(p.IAMPrincipals) > 0 {
+		return p.getIAMIdentityToken(subject, caURL)
+	}
 
 	var idoc awsInstanceIdentityDocument
 	doc, err := p.readURL(p.config.identityURL)
@@ -329,6 +370,10 @@ func (p *AWS) Init(config Config) (err error) {
 		}
 	}
 
+	if err := validatePatterns(p.IAMPrincipals); err != nil {
+		return err
+	}
+
 	config.Audiences = config.Audiences.WithFragment(p.GetIDForToken())
 	p.ctl, err = NewController(p, p.Claims, config, p.Options)
 	return
@@ -337,10 +382,16 @@ func (p *AWS) Init(config Config) (err error) {
 // AuthorizeSign validates the given token and returns the sign options that
 // will be used on certificate creation.
 func (p *AWS) AuthorizeSign(ctx context.Context, token string) ([]SignOption, error) {
+	if err := p.ctl.AuthorizeIssuance(); err != nil {
+		return nil, err
+	}
 	payload, err := p.authorizeToken(token)
 	if err != nil {
 		return nil, errs.Wrap(http.StatusInternalServerError, err, "aws.AuthorizeSign")
 	}
+	if payload.identity != nil {
+		return p.authorizeIAMSign(ctx, token, payload)
+	}
 
 	doc := payload.document
 
@@ -382,9 +433,9 @@ func (p *AWS) AuthorizeSign(ctx context.Context, token string) ([]SignOption, er
 		newProvisionerExtensionOption(TypeAWS, p.Name, doc.AccountID, "InstanceID", doc.InstanceID).WithControllerOptions(p.ctl),
 		profileDefaultDuration(p.ctl.Claimer.DefaultTLSCertDuration()),
 		// validators
-		defaultPublicKeyValidator{},
+		defaultPublicKeyValidator{keys: p.ctl.Claimer.KeyClaims()},
 		commonNameValidator(payload.Claims.Subject),
-		newValidityValidator(p.ctl.Claimer.MinTLSCertDuration(), p.ctl.Claimer.MaxTLSCertDuration()),
+		newClaimsValidityValidator(p.ctl.Claimer),
 		newX509NamePolicyValidator(p.ctl.getPolicy().getX509()),
 		p.ctl.newWebhookController(
 			data,
@@ -536,6 +587,9 @@ func (p *AWS) authorizeToken(token string) (*awsPayload, error) {
 	if err := jwt.UnsafeClaimsWithoutVerification(&unsafeClaims); err != nil {
 		return nil, errs.Wrap(http.StatusUnauthorized, err, "aws.authorizeToken; error unmarshaling claims")
 	}
+	if unsafeClaims.IAM != nil {
+		return p.authorizeIAMToken(jwt, &unsafeClaims)
+	}
 
 	var payload awsPayload
 	if err := jwt.Claims(unsafeClaims.Amazon.Signature, &payload); err != nil {
@@ -614,6 +668,9 @@ func (p *AWS) authorizeToken(token string) (*awsPayload, error) {
 
 // AuthorizeSSHSign returns the list of SignOption for a SignSSH request.
 func (p *AWS) AuthorizeSSHSign(_ context.Context, token string) ([]SignOption, error) {
+	if err := p.ctl.AuthorizeIssuance(); err != nil {
+		return nil, err
+	}
 	if !p.ctl.Claimer.IsSSHCAEnabled() {
 		return nil, errs.Unauthorized("aws.AuthorizeSSHSign; ssh ca is disabled for aws provisioner '%s'", p.GetName())
 	}
@@ -621,6 +678,9 @@ func (p *AWS) AuthorizeSSHSign(_ context.Context, token string) ([]SignOption, e
 	if err != nil {
 		return nil, errs.Wrap(http.StatusInternalServerError, err, "aws.AuthorizeSSHSign")
 	}
+	if claims.identity != nil {
+		return nil, errs.Unauthorized("aws.AuthorizeSSHSign; ssh host certificates are not supported for aws iam identities")
+	}
 
 	doc := claims.document
 	signOptions := []SignOption{}
@@ -665,7 +725,7 @@ func (p *AWS) AuthorizeSSHSign(_ context.Context, token string) ([]SignOption, e
 		// Set the validity bounds if not set.
 		&sshDefaultDuration{p.ctl.Claimer},
 		// Validate public key
-		&sshDefaultPublicKeyValidator{},
+		&sshDefaultPublicKeyValidator{keys: p.ctl.Claimer.KeyClaims()},
 		// Validate the validity period.
 		&sshCertValidityValidator{p.ctl.Claimer},
 		// Require all the fields in the SSH certificate
@@ -0,0 +1,348 @@
+package provisioner
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/pkg/errors"
+
+	"go.step.sm/crypto/jose"
+	"go.step.sm/crypto/x509util"
+	"go.step.sm/linkedca"
+
+	"github.com/smallstep/certificates/errs"
+	"github.com/smallstep/certificates/webhook"
+)
+
+// awsIAMIssuer is the string used as issuer in the tokens generated using an
+// IAM identity.
+const awsIAMIssuer = "sts.amazonaws.com"
+
+// awsIAMAudienceHeader is the header used to bind a signed GetCallerIdentity
+// request to the CA. It must be part of the signed headers.
+const awsIAMAudienceHeader = "X-Step-Audience"
+
+// awsSTSURL is the global endpoint of the AWS Security Token Service.
+const awsSTSURL = "https://sts.amazonaws.com/"
+
+// awsSTSRequestBody is the body of a GetCallerIdentity request.
+const awsSTSRequestBody = "Action=GetCallerIdentity&Version=2011-06-15"
+
+// awsSTSService is the name of the AWS Security Token Service used in the
+// signature scope.
+const awsSTSService = "sts"
+
+// awsSTSHostRegexp matches the global, regional, and FIPS endpoints of the AWS
+// Security Token Service.
+var awsSTSHostRegexp = regexp.MustCompile(`^sts(-fips)?(\.[a-z0-9-]+)?\.amazonaws\.com(\.cn)?$`)
+
+type awsIAMPayload struct {
+	Method  string      `json:"method"`
+	URL     string      `json:"url"`
+	Headers http.Header `json:"headers"`
+	Body    []byte      `json:"body"`
+}
+
+type awsCallerIdentity struct {
+	Arn     string `xml:"GetCallerIdentityResult>Arn"`
+	UserID  string `xml:"GetCallerIdentityResult>UserId"`
+	Account string `xml:"GetCallerIdentityResult>Account"`
+}
+
+// getIAMIdentityToken creates a token with a signed sts:GetCallerIdentity
+// request using the credentials found by the default AWS credential chain.
+func (p *AWS) getIAMIdentityToken(subject, caURL string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	creds, err := getIAMCredentials(ctx)
+	if err != nil {
+		return "", errors.Wrap(err, "error retrieving aws credentials:\n  Are AWS credentials configured in the environment or in the shared credentials file?\n  Is an IAM role attached to the task or instance?")
+	}
+
+	audience, err := generateSignAudience(caURL, p.GetIDForToken())
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, p.config.stsURL, strings.NewReader(awsSTSRequestBody))
+	if err != nil {
+		return "", errors.Wrap(err, "error creating sts request")
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+	req.Header.Set(awsIAMAudienceHeader, audience)
+	if err := signAWSRequest(ctx, req, []byte(awsSTSRequestBody), creds, p.config.stsRegion, time.Now()); err != nil {
+		return "", errors.Wrap(err, "error signing sts request")
+	}
+
+	signer, err := jose.NewSigner(
+		jose.SigningKey{Algorithm: jose.HS256, Key: []byte(req.Header.Get("Authorization"))},
+		new(jose.SignerOptions).WithType("JWT"),
+	)
+	if err != nil {
+		return "", errors.Wrap(err, "error creating signer")
+	}
+
+	now := time.Now()
+	payload := awsPayload{
+		Claims: jose.Claims{
+			Issuer:    awsIAMIssuer,
+			Subject:   subject,
+			Audience:  []string{audience},
+			Expiry:    jose.NewNumericDate(now.Add(5 * time.Minute)),
+			NotBefore: jose.NewNumericDate(now),
+			IssuedAt:  jose.NewNumericDate(now),
+		},
+		IAM: &awsIAMPayload{
+			Method:  req.Method,
+			URL:     req.URL.String(),
+			Headers: req.Header,
+			Body:    []byte(awsSTSRequestBody),
+		},
+	}
+
+	tok, err := jose.Signed(signer).Claims(payload).CompactSerialize()
+	if err != nil {
+		return "", errors.Wrap(err, "error serializing token")
+	}
+
+	return tok, nil
+}
+
+// getIAMCredentials returns the AWS credentials found by the default AWS
+// credential chain: the environment, the shared configuration and credentials
+// files, web identity tokens, the ECS container credentials endpoint, and the
+// role attached to an EC2 instance.
+func getIAMCredentials(ctx context.Context) (aws.Credentials, error) {
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return aws.Credentials{}, err
+	}
+	if cfg.Credentials == nil {
+		return aws.Credentials{}, errors.New("no aws credentials found")
+	}
+	return cfg.Credentials.Retrieve(ctx)
+}
+
+// authorizeIAMToken validates a token with a signed sts:GetCallerIdentity
+// request. The request is sent to AWS and the returned caller identity must
+// match one of the configured IAM principals.
+func (p *AWS) authorizeIAMToken(jwt *jose.JSONWebToken, unsafeClaims *awsPayload) (*awsPayload, error) {
+	if len(p.IAMPrincipals) == 0 {
+		return nil, errs.Unauthorized("aws.authorizeToken; aws iam authentication is not enabled")
+	}
+
+	iam := unsafeClaims.IAM
+	authorization := iam.Headers.Get("Authorization")
+	if authorization == "" {
+		return nil, errs.Unauthorized("aws.authorizeToken; aws iam request is not signed")
+	}
+
+	var payload awsPayload
+	if err := jwt.Claims([]byte(authorization), &payload); err != nil {
+		return nil, errs.Wrap(http.StatusUnauthorized, err, "aws.authorizeToken; error verifying claims")
+	}
+
+	// According to "rfc7519 JSON Web Token" acceptable skew should be no
+	// more than a few minutes.
+	if err := payload.ValidateWithLeeway(jose.Expected{
+		Issuer: awsIAMIssuer,
+		Time:   time.Now().UTC(),
+	}, time.Minute); err != nil {
+		return nil, errs.Wrapf(http.StatusUnauthorized, err, "aws.authorizeToken; invalid aws token")
+	}
+
+	// validate audiences with the defaults
+	if !matchesAudience(payload.Audience, p.ctl.Audiences.Sign) {
+		return nil, errs.Unauthorized("aws.authorizeToken; invalid token - invalid audience claim (aud)")
+	}
+
+	if err := p.validateIAMRequest(payload.IAM); err != nil {
+		return nil, errs.Wrap(http.StatusUnauthorized, err, "aws.authorizeToken; invalid aws iam request")
+	}
+
+	identity, err := p.getCallerIdentity(payload.IAM)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusUnauthorized, err, "aws.authorizeToken; error validating aws iam request")
+	}
+
+	switch {
+	case identity.Arn == "":
+		return nil, errs.Unauthorized("aws.authorizeToken; aws caller identity arn cannot be empty")
+	case identity.Account == "":
+		return nil, errs.Unauthorized("aws.authorizeToken; aws caller identity account cannot be empty")
+	}
+
+	// Validate subject, it has to be the ARN if disableCustomSANs is enabled
+	if p.DisableCustomSANs && payload.Subject != identity.Arn {
+		return nil, errs.Unauthorized("aws.authorizeToken; invalid token - invalid subject claim (sub)")
+	}
+
+	// validate accounts
+	if len(p.Accounts) > 0 && !containsString(p.Accounts, identity.Account) {
+		return nil, errs.Unauthorized("aws.authorizeToken; invalid aws caller identity - account is not valid")
+	}
+
+	// validate principals
+	if !matchesPatterns(p.IAMPrincipals, identity.Arn) {
+		return nil, errs.Unauthorized("aws.authorizeToken; invalid aws caller identity - arn %s is not allowed", identity.Arn)
+	}
+
+	payload.identity = identity
+	return &payload, nil
+}
+
+// validateIAMRequest checks that the request is a GetCallerIdentity request to
+// an STS endpoint, bound to one of the audiences of the provisioner.
+func (p *AWS) validateIAMRequest(iam *awsIAMPayload) error {
+	if iam.Method != http.MethodPost {
+		return errors.Errorf("unsupported method %s", iam.Method)
+	}
+
+	u, err := url.Parse(iam.URL)
+	if err != nil {
+		return errors.Wrap(err, "error parsing url")
+	}
+	if u.Scheme != "https" || !p.config.stsHostRegexp.MatchString(u.Host) || (u.Path != "" && u.Path != "/") || u.RawQuery != "" {
+		return errors.Errorf("url %s is not a valid sts endpoint", iam.URL)
+	}
+
+	values, err := url.ParseQuery(string(iam.Body))
+	if err != nil {
+		return errors.Wrap(err, "error parsing body")
+	}
+	for k, v := range values {
+		switch {
+		case k == "Action" && len(v) == 1 && v[0] == "GetCallerIdentity":
+		case k == "Version" && len(v) == 1:
+		default:
+			return errors.Errorf("body parameter %s is not allowed", k)
+		}
+	}
+	if values.Get("Action") == "" {
+		return errors.New("body does not contain a GetCallerIdentity action")
+	}
+
+	if !matchesAudience([]string{iam.Headers.Get(awsIAMAudienceHeader)}, p.ctl.Audiences.Sign) {
+		return errors.Errorf("header %s is not valid", awsIAMAudienceHeader)
+	}
+	if !containsString(signedHeaders(iam.Headers.Get("Authorization")), strings.ToLower(awsIAMAudienceHeader)) {
+		return errors.Errorf("header %s is not signed", awsIAMAudienceHeader)
+	}
+
+	return nil
+}
+
+// getCallerIdentity sends the signed GetCallerIdentity request to AWS and
+// returns the identity in the response.
+func (p *AWS) getCallerIdentity(iam *awsIAMPayload) (*awsCallerIdentity, error) {
+	req, err := http.NewRequest(iam.Method, iam.URL, bytes.NewReader(iam.Body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header = iam.Headers.Clone()
+
+	resp, err := p.ctl.GetHTTPClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("sts request returned status code %d", resp.StatusCode)
+	}
+
+	var identity awsCallerIdentity
+	if err := xml.Unmarshal(b, &identity); err != nil {
+		return nil, errors.Wrap(err, "error unmarshaling sts response")
+	}
+	return &identity, nil
+}
+
+// authorizeIAMSign returns the sign options for a token with an IAM identity.
+func (p *AWS) authorizeIAMSign(ctx context.Context, token string, payload *awsPayload) ([]SignOption, error) {
+	identity := payload.identity
+
+	// Template options
+	data := x509util.NewTemplateData()
+	data.SetCommonName(payload.Claims.Subject)
+	if v, err := unsafeParseSigned(token); err == nil {
+		data.SetToken(v)
+	}
+
+	// Enforce the ARN as the only SAN if configured. By default we'll accept
+	// the CN and SANs in the CSR.
+	var so []SignOption
+	if p.DisableCustomSANs {
+		arn, err := url.Parse(identity.Arn)
+		if err != nil {
+			return nil, errs.Wrap(http.StatusInternalServerError, err, "aws.AuthorizeSign")
+		}
+		so = append(so,
+			dnsNamesValidator(nil),
+			ipAddressesValidator(nil),
+			emailAddressesValidator(nil),
+			newURIsValidator(ctx, []*url.URL{arn}),
+		)
+
+		// Template options
+		data.SetSANs([]string{identity.Arn})
+	}
+
+	templateOptions, err := CustomTemplateOptions(p.Options, data, x509util.DefaultLeafTemplate)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "aws.AuthorizeSign")
+	}
+
+	return append(so,
+		p,
+		templateOptions,
+		// modifiers / withOptions
+		newProvisionerExtensionOption(TypeAWS, p.Name, identity.Account, "ARN", identity.Arn).WithControllerOptions(p.ctl),
+		profileDefaultDuration(p.ctl.Claimer.DefaultTLSCertDuration()),
+		// validators
+		defaultPublicKeyValidator{keys: p.ctl.Claimer.KeyClaims()},
+		commonNameValidator(payload.Claims.Subject),
+		newClaimsValidityValidator(p.ctl.Claimer),
+		newX509NamePolicyValidator(p.ctl.getPolicy().getX509()),
+		p.ctl.newWebhookController(
+			data,
+			linkedca.Webhook_X509,
+			webhook.WithAuthorizationPrincipal(identity.Arn),
+		),
+	), nil
+}
+
+// signedHeaders returns the list of signed headers in an AWS Signature Version
+// 4 authorization header.
+func signedHeaders(authorization string) []string {
+	for _, part := range strings.Split(authorization, ",") {
+		part = strings.TrimSpace(part)
+		if i := strings.Index(part, "SignedHeaders="); i >= 0 {
+			return strings.Split(part[i+len("SignedHeaders="):], ";")
+		}
+	}
+	return nil
+}
+
+// signAWSRequest signs the given sts request using AWS Signature Version 4.
+func signAWSRequest(ctx context.Context, req *http.Request, body []byte, creds aws.Credentials, region string, now time.Time) error {
+	sum := sha256.Sum256(body)
+	return v4.NewSigner().SignHTTP(ctx, creds, req, hex.EncodeToString(sum[:]), awsSTSService, region, now)
+}
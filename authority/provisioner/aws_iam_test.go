@@ -0,0 +1,309 @@
+package provisioner
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.step.sm/crypto/jose"
+
+	"github.com/smallstep/certificates/api/render"
+)
+
+var awsTestCredentials = aws.Credentials{
+	AccessKeyID:     "AKIDEXAMPLE",
+	SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+	SessionToken:    "session-token",
+}
+
+// generateSTSServer returns a fake STS server that verifies the signature of
+// GetCallerIdentity requests and responds with the given ARN.
+func generateSTSServer(t *testing.T, arn string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		now, err := time.Parse("20060102T150405Z", r.Header.Get("X-Amz-Date"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// Sign a copy of the request with the same headers.
+		u := *r.URL
+		u.Scheme, u.Host = "https", r.Host
+		req, err := http.NewRequest(r.Method, u.String(), http.NoBody)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		for _, k := range []string{"Content-Type", awsIAMAudienceHeader} {
+			req.Header.Set(k, r.Header.Get(k))
+		}
+		req.ContentLength = r.ContentLength
+		if err := signAWSRequest(r.Context(), req, body, awsTestCredentials, "us-east-1", now); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if r.Header.Get("Authorization") != req.Header.Get("Authorization") {
+			http.Error(w, "SignatureDoesNotMatch", http.StatusForbidden)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/xml")
+		fmt.Fprintf(w, `<GetCallerIdentityResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+  <GetCallerIdentityResult>
+    <Arn>%s</Arn>
+    <UserId>AROAEXAMPLE:my-session</UserId>
+    <Account>123456789012</Account>
+  </GetCallerIdentityResult>
+  <ResponseMetadata>
+    <RequestId>01234567-89ab-cdef-0123-456789abcdef</RequestId>
+  </ResponseMetadata>
+</GetCallerIdentityResponse>`, arn)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func generateAWSIAM(t *testing.T, srv *httptest.Server) *AWS {
+	t.Helper()
+	p := &AWS{
+		Type:          "AWS",
+		Name:          "iam",
+		Accounts:      []string{"123456789012"},
+		IAMPrincipals: []string{"arn:aws:sts::123456789012:assumed-role/my-role/*"},
+	}
+	require.NoError(t, p.Init(Config{Claims: globalProvisionerClaims, Audiences: testAudiences, HTTPClient: srv.Client()}))
+	u, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+	p.config.stsURL = srv.URL + "/"
+	p.config.stsRegion = "us-east-1"
+	p.config.stsHostRegexp = regexp.MustCompile("^" + regexp.QuoteMeta(u.Host) + "$")
+	return p
+}
+
+// generateAWSIAMToken creates a token with a signed GetCallerIdentity request
+// and allows to modify the request before signing it.
+func generateAWSIAMToken(t *testing.T, p *AWS, sub string, modify func(req *http.Request, body *string)) string {
+	t.Helper()
+	aud := testAudiences.Sign[0] + "#" + p.GetIDForToken()
+	body := awsSTSRequestBody
+	req, err := http.NewRequest(http.MethodPost, p.config.stsURL, http.NoBody)
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+	req.Header.Set(awsIAMAudienceHeader, aud)
+	if modify != nil {
+		modify(req, &body)
+	}
+	req.ContentLength = int64(len(body))
+	require.NoError(t, signAWSRequest(context.Background(), req, []byte(body), awsTestCredentials, "us-east-1", time.Now()))
+
+	signer, err := jose.NewSigner(
+		jose.SigningKey{Algorithm: jose.HS256, Key: []byte(req.Header.Get("Authorization"))},
+		new(jose.SignerOptions).WithType("JWT"),
+	)
+	require.NoError(t, err)
+	now := time.Now()
+	tok, err := jose.Signed(signer).Claims(awsPayload{
+		Claims: jose.Claims{
+			Issuer:    awsIAMIssuer,
+			Subject:   sub,
+			Audience:  []string{aud},
+			Expiry:    jose.NewNumericDate(now.Add(5 * time.Minute)),
+			NotBefore: jose.NewNumericDate(now),
+			IssuedAt:  jose.NewNumericDate(now),
+		},
+		IAM: &awsIAMPayload{
+			Method:  req.Method,
+			URL:     req.URL.String(),
+			Headers: req.Header,
+			Body:    []byte(body),
+		},
+	}).CompactSerialize()
+	require.NoError(t, err)
+	return tok
+}
+
+func TestAWS_GetIdentityToken_iam(t *testing.T) {
+	arn := "arn:aws:sts::123456789012:assumed-role/my-role/my-session"
+	srv := generateSTSServer(t, arn)
+	p := generateAWSIAM(t, srv)
+
+	t.Setenv("AWS_ACCESS_KEY_ID", awsTestCredentials.AccessKeyID)
+	t.Setenv("AWS_SECRET_ACCESS_KEY", awsTestCredentials.SecretAccessKey)
+	t.Setenv("AWS_SESSION_TOKEN", awsTestCredentials.SessionToken)
+
+	token, err := p.GetIdentityToken("foo.internal", "https://ca.smallstep.com")
+	require.NoError(t, err)
+
+	payload, err := p.authorizeToken(token)
+	require.NoError(t, err)
+	assert.Equal(t, "foo.internal", payload.Subject)
+	assert.Equal(t, &awsCallerIdentity{
+		Arn:     arn,
+		UserID:  "AROAEXAMPLE:my-session",
+		Account: "123456789012",
+	}, payload.identity)
+	assert.Equal(t, "session-token", payload.IAM.Headers.Get("X-Amz-Security-Token"))
+}
+
+func TestAWS_authorizeToken_iam(t *testing.T) {
+	srv := generateSTSServer(t, "arn:aws:sts::123456789012:assumed-role/my-role/my-session")
+	p := generateAWSIAM(t, srv)
+
+	disabled := generateAWSIAM(t, srv)
+	disabled.IAMPrincipals = nil
+
+	otherRole := generateAWSIAM(t, srv)
+	otherRole.IAMPrincipals = []string{"arn:aws:sts::123456789012:assumed-role/other-role/*"}
+
+	otherAccount := generateAWSIAM(t, srv)
+	otherAccount.Accounts = []string{"210987654321"}
+
+	noCustomSANs := generateAWSIAM(t, srv)
+	noCustomSANs.DisableCustomSANs = true
+
+	tests := []struct {
+		name    string
+		p       *AWS
+		token   string
+		wantErr bool
+	}{
+		{"ok", p, generateAWSIAMToken(t, p, "foo", nil), false},
+		{"ok disableCustomSANs", noCustomSANs, generateAWSIAMToken(t, noCustomSANs, "arn:aws:sts::123456789012:assumed-role/my-role/my-session", nil), false},
+		{"fail not enabled", disabled, generateAWSIAMToken(t, disabled, "foo", nil), true},
+		{"fail principal", otherRole, generateAWSIAMToken(t, otherRole, "foo", nil), true},
+		{"fail account", otherAccount, generateAWSIAMToken(t, otherAccount, "foo", nil), true},
+		{"fail disableCustomSANs", noCustomSANs, generateAWSIAMToken(t, noCustomSANs, "foo", nil), true},
+		{"fail signature", p, generateAWSIAMToken(t, p, "foo", func(req *http.Request, body *string) {
+			req.Header.Set("X-Foo", "bar")
+		}), true},
+		{"fail method", p, generateAWSIAMToken(t, p, "foo", func(req *http.Request, body *string) {
+			req.Method = http.MethodGet
+		}), true},
+		{"fail host", p, generateAWSIAMToken(t, p, "foo", func(req *http.Request, body *string) {
+			req.URL.Host = "sts.example.com"
+		}), true},
+		{"fail path", p, generateAWSIAMToken(t, p, "foo", func(req *http.Request, body *string) {
+			req.URL.Path = "/foo"
+		}), true},
+		{"fail action", p, generateAWSIAMToken(t, p, "foo", func(req *http.Request, body *string) {
+			*body = "Action=AssumeRole&Version=2011-06-15"
+		}), true},
+		{"fail extra parameter", p, generateAWSIAMToken(t, p, "foo", func(req *http.Request, body *string) {
+			*body += "&RoleArn=foo"
+		}), true},
+		{"fail audience header", p, generateAWSIAMToken(t, p, "foo", func(req *http.Request, body *string) {
+			req.Header.Set(awsIAMAudienceHeader, "https://other.smallstep.com/1.0/sign#aws/iam")
+		}), true},
+		{"fail missing audience header", p, generateAWSIAMToken(t, p, "foo", func(req *http.Request, body *string) {
+			req.Header.Del(awsIAMAudienceHeader)
+		}), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.p.authorizeToken(tt.token)
+			if tt.wantErr {
+				var sc render.StatusCodedError
+				require.ErrorAs(t, err, &sc)
+				assert.Equal(t, http.StatusUnauthorized, sc.StatusCode())
+				assert.Nil(t, got)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "123456789012", got.identity.Account)
+		})
+	}
+}
+
+func TestAWS_AuthorizeSign_iam(t *testing.T) {
+	arn := "arn:aws:sts::123456789012:assumed-role/my-role/my-session"
+	srv := generateSTSServer(t, arn)
+	p := generateAWSIAM(t, srv)
+
+	opts, err := p.AuthorizeSign(context.Background(), generateAWSIAMToken(t, p, "foo", nil))
+	require.NoError(t, err)
+	assert.Len(t, opts, 9)
+	for _, o := range opts {
+		switch v := o.(type) {
+		case *AWS:
+		case certificateOptionsFunc:
+		case *provisionerExtensionOption:
+			assert.Equal(t, TypeAWS, v.Type)
+			assert.Equal(t, "iam", v.Name)
+			assert.Equal(t, "123456789012", v.CredentialID)
+			assert.Equal(t, []string{"ARN", arn}, v.KeyValuePairs)
+		case profileDefaultDuration:
+		case defaultPublicKeyValidator:
+		case commonNameValidator:
+			assert.Equal(t, commonNameValidator("foo"), v)
+		case *validityValidator:
+		case *x509NamePolicyValidator:
+		case *WebhookController:
+			assert.Empty(t, v.webhooks)
+		default:
+			assert.FailNow(t, "unexpected sign option", "%T", v)
+		}
+	}
+
+	_, err = p.AuthorizeSSHSign(context.Background(), generateAWSIAMToken(t, p, "foo", nil))
+	assert.Error(t, err)
+}
+
+func Test_getIAMCredentials(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(dir, "config"))
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(dir, "credentials"))
+	t.Setenv("AWS_EC2_METADATA_DISABLED", "true")
+	t.Setenv("AWS_ACCESS_KEY_ID", "")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "")
+	t.Setenv("AWS_SESSION_TOKEN", "")
+	t.Setenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI", "")
+
+	// ECS task credentials.
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "container-token", r.Header.Get("Authorization"))
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"AccessKeyId":"ASIAEXAMPLE","SecretAccessKey":"secret","Token":"token","Expiration":%q}`,
+			time.Now().Add(time.Hour).UTC().Format(time.RFC3339))
+	}))
+	t.Cleanup(srv.Close)
+	t.Setenv("AWS_CONTAINER_CREDENTIALS_FULL_URI", srv.URL+"/credentials")
+	t.Setenv("AWS_CONTAINER_AUTHORIZATION_TOKEN", "container-token")
+
+	ctx := context.Background()
+	creds, err := getIAMCredentials(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "ASIAEXAMPLE", creds.AccessKeyID)
+	assert.Equal(t, "secret", creds.SecretAccessKey)
+	assert.Equal(t, "token", creds.SessionToken)
+
+	// Environment credentials take precedence.
+	t.Setenv("AWS_ACCESS_KEY_ID", awsTestCredentials.AccessKeyID)
+	t.Setenv("AWS_SECRET_ACCESS_KEY", awsTestCredentials.SecretAccessKey)
+	creds, err = getIAMCredentials(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, awsTestCredentials.AccessKeyID, creds.AccessKeyID)
+	assert.Empty(t, creds.SessionToken)
+
+	// No credentials.
+	t.Setenv("AWS_ACCESS_KEY_ID", "")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "")
+	t.Setenv("AWS_CONTAINER_CREDENTIALS_FULL_URI", "")
+	_, err = getIAMCredentials(ctx)
+	assert.Error(t, err)
+}
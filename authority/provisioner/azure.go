@@ -8,6 +8,8 @@ import (
 	"encoding/json"
 	"io"
 	"net/http"
+	"os"
+	"path/filepath"
 	"regexp"
 	"strings"
 	"time"
@@ -31,6 +33,14 @@ const azureIdentityTokenURL = "http://169.254.169.254/metadata/identity/oauth2/t
 
 const azureIdentityTokenAPIVersion = "2018-02-01"
 
+// azureAppServiceIdentityTokenAPIVersion is the API version used to get the
+// identity token in App Service and Azure Functions.
+const azureAppServiceIdentityTokenAPIVersion = "2019-08-01"
+
+// azureArcIdentityTokenAPIVersion is the API version used to get the identity
+// token in Azure Arc-enabled servers.
+const azureArcIdentityTokenAPIVersion = "2020-06-01"
+
 // azureInstanceComputeURL is the URL to get the instance compute metadata.
 const azureInstanceComputeURL = "http://169.254.169.254/metadata/instance/compute/azEnvironment"
 
@@ -39,7 +49,36 @@ const azureDefaultAudience = "https://management.azure.com/"
 
 // azureXMSMirIDRegExp is the regular expression used to parse the xms_mirid claim.
 // Using case insensitive as resourceGroups appears as resourcegroups.
-var azureXMSMirIDRegExp = regexp.MustCompile(`(?i)^/subscriptions/([^/]+)/resourceGroups/([^/]+)/providers/Microsoft.(Compute/virtualMachines|ManagedIdentity/userAssignedIdentities)/([^/]+)$`)
+var azureXMSMirIDRegExp = regexp.MustCompile(`(?i)^/subscriptions/([^/]+)/resourceGroups/([^/]+)/providers/(Microsoft\.[^/]+/[^/]+)/([^/]+)(?:/slots/([^/]+))?$`)
+
+// Azure resource types of the managed identities supported by the Azure
+// provisioner.
+const (
+	// AzureVirtualMachine is the resource type of virtual machines.
+	AzureVirtualMachine = "Microsoft.Compute/virtualMachines"
+	// AzureVirtualMachineScaleSet is the resource type of virtual machine scale
+	// sets.
+	AzureVirtualMachineScaleSet = "Microsoft.Compute/virtualMachineScaleSets"
+	// AzureArcMachine is the resource type of Azure Arc-enabled servers.
+	AzureArcMachine = "Microsoft.HybridCompute/machines"
+	// AzureAppService is the resource type of App Service and Azure Functions
+	// apps.
+	AzureAppService = "Microsoft.Web/sites"
+	// AzureUserAssignedIdentity is the resource type of user-assigned managed
+	// identities.
+	AzureUserAssignedIdentity = "Microsoft.ManagedIdentity/userAssignedIdentities"
+)
+
+// azureResourceTypes is the list of supported resource types.
+var azureResourceTypes = []string{
+	AzureVirtualMachine, AzureVirtualMachineScaleSet, AzureArcMachine,
+	AzureAppService, AzureUserAssignedIdentity,
+}
+
+// azureDefaultResourceTypes is the list of resource types allowed by default.
+var azureDefaultResourceTypes = []string{
+	AzureVirtualMachine, AzureUserAssignedIdentity,
+}
 
 // azureEnvironments is the list of all Azure environments.
 var azureEnvironments = map[string]string{
@@ -55,6 +94,11 @@ type azureConfig struct {
 	oidcDiscoveryURL   string
 	identityTokenURL   string
 	instanceComputeURL string
+	// identityEndpoint, identityHeader and imdsEndpoint are set in App Service,
+	// Azure Functions, and Azure Arc-enabled servers.
+	identityEndpoint string
+	identityHeader   string
+	imdsEndpoint     string
 }
 
 func newAzureConfig(tenantID string) *azureConfig {
@@ -62,6 +106,9 @@ func newAzureConfig(tenantID string) *azureConfig {
 		oidcDiscoveryURL:   azureOIDCBaseURL + "/" + tenantID + "/.well-known/openid-configuration",
 		identityTokenURL:   azureIdentityTokenURL,
 		instanceComputeURL: azureInstanceComputeURL,
+		identityEndpoint:   os.Getenv("IDENTITY_ENDPOINT"),
+		identityHeader:     os.Getenv("IDENTITY_HEADER"),
+		imdsEndpoint:       os.Getenv("IMDS_ENDPOINT"),
 	}
 }
 
@@ -93,6 +140,12 @@ type azurePayload struct {
 //
 // The default audience is "https://management.azure.com/".
 //
+// By default, only the managed identities of virtual machines and
+// user-assigned identities are accepted. ResourceTypes can enable other
+// resources, like virtual machine scale sets, Azure Arc-enabled servers, or
+// App Service and Azure Functions apps. The resource group, subscription, and
+// object id filters apply to all of them.
+//
 // If DisableCustomSANs is true, only the internal DNS and IP will be added as a
 // SAN. By default it will accept any SAN in the CSR.
 //
@@ -112,6 +165,7 @@ type Azure struct {
 	ResourceGroups         []string `json:"resourceGroups"`
 	SubscriptionIDs        []string `json:"subscriptionIDs"`
 	ObjectIDs              []string `json:"objectIDs"`
+	ResourceTypes          []string `json:"resourceTypes,omitempty"`
 	Audience               string   `json:"audience,omitempty"`
 	DisableCustomSANs      bool     `json:"disableCustomSANs"`
 	DisableTrustOnFirstUse bool     `json:"disableTrustOnFirstUse"`
@@ -180,6 +234,11 @@ func (p *Azure) GetEncryptedKey() (kid, key string, ok bool) {
 	return "", "", false
 }
 
+// GetOptions returns the configured provisioner options.
+func (p *Azure) GetOptions() *Options {
+	return p.Options
+}
+
 // GetIdentityToken retrieves from the metadata service the identity token and
 // returns it.
 func (p *Azure) GetIdentityToken(subject, caURL string) (string, error) {
@@ -188,6 +247,13 @@ func (p *Azure) GetIdentityToken(subject, caURL string) (string, error) {
 	// Initialize the config if this method is used from the cli.
 	p.assertConfig()
 
+	switch {
+	case p.config.identityEndpoint != "" && p.config.identityHeader != "":
+		return p.getAppServiceIdentityToken()
+	case p.config.identityEndpoint != "" && p.config.imdsEndpoint != "":
+		return p.getArcIdentityToken()
+	}
+
 	// default to AzurePublicCloud to keep existing behavior
 	identityTokenResource := azureEnvironments["AzurePublicCloud"]
 
@@ -216,6 +282,93 @@ func (p *Azure) GetIdentityToken(subject, caURL string) (string, error) {
 	if err != nil {
 		return "", errors.Wrap(err, "error getting identity token, are you in a Azure VM?")
 	}
+
+	return readAzureIdentityToken(resp)
+}
+
+// getAppServiceIdentityToken retrieves the identity token from the identity
+// endpoint of App Service and Azure Functions.
+func (p *Azure) getAppServiceIdentityToken() (string, error) {
+	req, err := p.newIdentityTokenRequest(azureAppServiceIdentityTokenAPIVersion)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-IDENTITY-HEADER", p.config.identityHeader)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", errors.Wrap(err, "error getting identity token from the app service identity endpoint")
+	}
+
+	return readAzureIdentityToken(resp)
+}
+
+// getArcIdentityToken retrieves the identity token from the identity endpoint
+// of Azure Arc-enabled servers. The first request returns a challenge with the
+// path of a file that only privileged users can read, and the content of the
+// file is used to authenticate the second request.
+func (p *Azure) getArcIdentityToken() (string, error) {
+	req, err := p.newIdentityTokenRequest(azureArcIdentityTokenAPIVersion)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Metadata", "true")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", errors.Wrap(err, "error getting identity token, are you in an Azure Arc-enabled server?")
+	}
+	if resp.StatusCode != http.StatusUnauthorized {
+		return readAzureIdentityToken(resp)
+	}
+	resp.Body.Close()
+
+	challenge := resp.Header.Get("WWW-Authenticate")
+	keyFile, ok := strings.CutPrefix(challenge, "Basic realm=")
+	if !ok || filepath.Ext(keyFile) != ".key" {
+		return "", errors.Errorf("error getting identity token: invalid challenge %q", challenge)
+	}
+	secret, err := os.ReadFile(keyFile)
+	if err != nil {
+		return "", errors.Wrap(err, "error reading identity token challenge")
+	}
+
+	if req, err = p.newIdentityTokenRequest(azureArcIdentityTokenAPIVersion); err != nil {
+		return "", err
+	}
+	req.Header.Set("Metadata", "true")
+	req.Header.Set("Authorization", "Basic "+string(secret))
+
+	if resp, err = http.DefaultClient.Do(req); err != nil {
+		return "", errors.Wrap(err, "error getting identity token, are you in an Azure Arc-enabled server?")
+	}
+
+	return readAzureIdentityToken(resp)
+}
+
+// newIdentityTokenRequest creates a request to the identity endpoint of App
+// Service, Azure Functions, or Azure Arc-enabled servers.
+func (p *Azure) newIdentityTokenRequest(apiVersion string) (*http.Request, error) {
+	resource := p.Audience
+	if resource == "" {
+		resource = azureDefaultAudience
+	}
+
+	req, err := http.NewRequest("GET", p.config.identityEndpoint, http.NoBody)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating request")
+	}
+
+	query := req.URL.Query()
+	query.Add("resource", resource)
+	query.Add("api-version", apiVersion)
+	req.URL.RawQuery = query.Encode()
+	return req, nil
+}
+
+// readAzureIdentityToken reads the identity token from the response and closes
+// its body.
+func readAzureIdentityToken(resp *http.Response) (string, error) {
 	defer resp.Body.Close()
 
 	b, err := io.ReadAll(resp.Body)
@@ -247,6 +400,13 @@ func (p *Azure) Init(config Config) (err error) {
 		p.Audience = azureDefaultAudience
 	}
 
+	// Validate the resource types
+	for _, typ := range p.ResourceTypes {
+		if !containsFold(azureResourceTypes, typ) {
+			return errors.Errorf("provisioner resourceTypes %q is not supported", typ)
+		}
+	}
+
 	// Initialize config
 	p.assertConfig()
 
@@ -303,20 +463,37 @@ func (p *Azure) authorizeToken(token string) (*azurePayload, string, string, str
 	}
 
 	re := azureXMSMirIDRegExp.FindStringSubmatch(claims.XMSMirID)
-	if len(re) != 5 {
+	if len(re) != 6 || (re[5] != "" && !strings.EqualFold(re[3], AzureAppService)) {
 		return nil, "", "", "", "", errs.Unauthorized("azure.authorizeToken; error parsing xms_mirid claim - %s", claims.XMSMirID)
 	}
 
+	// Validate the resource type
+	resourceTypes := p.ResourceTypes
+	if len(resourceTypes) == 0 {
+		resourceTypes = azureDefaultResourceTypes
+	}
+	if !containsFold(resourceTypes, re[3]) {
+		return nil, "", "", "", "", errs.Unauthorized("azure.authorizeToken; azure token validation failed - resource type %s is not allowed", re[3])
+	}
+
 	var subscription, group, name string
 	identityObjectID := claims.ObjectID
 	subscription, group, name = re[1], re[2], re[4]
 
+	// The host name of an App Service deployment slot is <app>-<slot>.
+	if re[5] != "" {
+		name += "-" + re[5]
+	}
+
 	return &claims, name, group, subscription, identityObjectID, nil
 }
 
 // AuthorizeSign validates the given token and returns the sign options that
 // will be used on certificate creation.
 func (p *Azure) AuthorizeSign(ctx context.Context, token string) ([]SignOption, error) {
+	if err := p.ctl.AuthorizeIssuance(); err != nil {
+		return nil, err
+	}
 	_, name, group, subscription, identityObjectID, err := p.authorizeToken(token)
 	if err != nil {
 		return nil, errs.Wrap(http.StatusInternalServerError, err, "azure.AuthorizeSign")
@@ -401,8 +578,8 @@ func (p *Azure) AuthorizeSign(ctx context.Context, token string) ([]SignOption,
 		newProvisionerExtensionOption(TypeAzure, p.Name, p.TenantID).WithControllerOptions(p.ctl),
 		profileDefaultDuration(p.ctl.Claimer.DefaultTLSCertDuration()),
 		// validators
-		defaultPublicKeyValidator{},
-		newValidityValidator(p.ctl.Claimer.MinTLSCertDuration(), p.ctl.Claimer.MaxTLSCertDuration()),
+		defaultPublicKeyValidator{keys: p.ctl.Claimer.KeyClaims()},
+		newClaimsValidityValidator(p.ctl.Claimer),
 		newX509NamePolicyValidator(p.ctl.getPolicy().getX509()),
 		p.ctl.newWebhookController(
 			data,
@@ -422,6 +599,9 @@ func (p *Azure) AuthorizeRenew(ctx context.Context, cert *x509.Certificate) erro
 
 // AuthorizeSSHSign returns the list of SignOption for a SignSSH request.
 func (p *Azure) AuthorizeSSHSign(_ context.Context, token string) ([]SignOption, error) {
+	if err := p.ctl.AuthorizeIssuance(); err != nil {
+		return nil, err
+	}
 	if !p.ctl.Claimer.IsSSHCAEnabled() {
 		return nil, errs.Unauthorized("azure.AuthorizeSSHSign; sshCA is disabled for provisioner '%s'", p.GetName())
 	}
@@ -470,7 +650,7 @@ func (p *Azure) AuthorizeSSHSign(_ context.Context, token string) ([]SignOption,
 		// Set the validity bounds if not set.
 		&sshDefaultDuration{p.ctl.Claimer},
 		// Validate public key
-		&sshDefaultPublicKeyValidator{},
+		&sshDefaultPublicKeyValidator{keys: p.ctl.Claimer.KeyClaims()},
 		// Validate the validity period.
 		&sshCertValidityValidator{p.ctl.Claimer},
 		// Require all the fields in the SSH certificate
@@ -486,6 +666,17 @@ func (p *Azure) AuthorizeSSHSign(_ context.Context, token string) ([]SignOption,
 	), nil
 }
 
+// containsFold returns true if the list contains the given value, ignoring the
+// case.
+func containsFold(list []string, value string) bool {
+	for _, s := range list {
+		if strings.EqualFold(s, value) {
+			return true
+		}
+	}
+	return false
+}
+
 // assertConfig initializes the config if it has not been initialized
 func (p *Azure) assertConfig() {
 	if p.config == nil {
@@ -12,6 +12,8 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
@@ -752,3 +754,140 @@ func TestAzure_assertConfig(t *testing.T) {
 		})
 	}
 }
+
+func TestAzure_authorizeToken_resourceTypes(t *testing.T) {
+	p, srv, err := generateAzureWithServer()
+	assert.FatalError(t, err)
+	defer srv.Close()
+
+	// Validate resource types on Init
+	pi := &Azure{Type: p.Type, Name: p.Name, TenantID: p.TenantID, config: p.config}
+	pi.ResourceTypes = []string{AzureAppService, "microsoft.compute/virtualmachinescalesets"}
+	assert.FatalError(t, pi.Init(Config{Claims: globalProvisionerClaims}))
+	pi.ResourceTypes = []string{"Microsoft.Storage/storageAccounts"}
+	assert.Error(t, pi.Init(Config{Claims: globalProvisionerClaims}))
+
+	key := &p.keyStore.keySet.Keys[0]
+	issuer := p.oidcConfig.Issuer
+	token := func(name, resourceType string) string {
+		tok, err := generateAzureToken("subject", issuer, azureDefaultAudience,
+			p.TenantID, "subscriptionID", "resourceGroup", name, resourceType,
+			time.Now(), key)
+		assert.FatalError(t, err)
+		return tok
+	}
+	tests := []struct {
+		name          string
+		resourceTypes []string
+		token         string
+		wantName      string
+		wantErr       bool
+	}{
+		{"ok default vm", nil, token("virtualMachine", "vm"), "virtualMachine", false},
+		{"ok default uai", nil, token("identity", "uai"), "identity", false},
+		{"ok vmss", []string{AzureVirtualMachineScaleSet}, token("scaleSet", "vmss"), "scaleSet", false},
+		{"ok arc", []string{AzureArcMachine}, token("arcMachine", "arc"), "arcMachine", false},
+		{"ok app service", []string{AzureAppService}, token("myapp", "app"), "myapp", false},
+		{"ok app service slot", []string{AzureAppService}, token("myapp", "slot"), "myapp-staging", false},
+		{"ok case insensitive", []string{"microsoft.web/sites"}, token("myapp", "app"), "myapp", false},
+		{"fail default vmss", nil, token("scaleSet", "vmss"), "", true},
+		{"fail default arc", nil, token("arcMachine", "arc"), "", true},
+		{"fail default app service", nil, token("myapp", "app"), "", true},
+		{"fail vm", []string{AzureAppService}, token("virtualMachine", "vm"), "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p.ResourceTypes = tt.resourceTypes
+			_, name, group, subscriptionID, _, err := p.authorizeToken(tt.token)
+			if tt.wantErr {
+				var sc render.StatusCodedError
+				assert.Fatal(t, errors.As(err, &sc), "error does not implement StatusCodedError interface")
+				assert.Equals(t, http.StatusUnauthorized, sc.StatusCode())
+				return
+			}
+			assert.FatalError(t, err)
+			assert.Equals(t, tt.wantName, name)
+			assert.Equals(t, "resourceGroup", group)
+			assert.Equals(t, "subscriptionID", subscriptionID)
+		})
+	}
+}
+
+func TestAzure_GetIdentityToken_identityEndpoint(t *testing.T) {
+	p, err := generateAzure()
+	assert.FatalError(t, err)
+
+	tok, err := generateAzureToken("subject", p.oidcConfig.Issuer, azureDefaultAudience,
+		p.TenantID, "subscriptionID", "resourceGroup", "myapp", "app",
+		time.Now(), &p.keyStore.keySet.Keys[0])
+	assert.FatalError(t, err)
+
+	keyFile := filepath.Join(t.TempDir(), "arc.key")
+	assert.FatalError(t, os.WriteFile(keyFile, []byte("the-secret"), 0600))
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("resource") != azureDefaultAudience {
+			http.Error(w, "bad resource", http.StatusBadRequest)
+			return
+		}
+		switch r.URL.Path {
+		case "/app-service":
+			if r.Header.Get("X-IDENTITY-HEADER") != "the-header" || r.URL.Query().Get("api-version") != azureAppServiceIdentityTokenAPIVersion {
+				http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+				return
+			}
+		case "/arc", "/arc-bad-challenge":
+			if r.Header.Get("Metadata") != "true" || r.URL.Query().Get("api-version") != azureArcIdentityTokenAPIVersion {
+				http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+				return
+			}
+			switch {
+			case r.URL.Path == "/arc-bad-challenge":
+				w.Header().Set("WWW-Authenticate", "Basic realm=/etc/passwd")
+				http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+				return
+			case r.Header.Get("Authorization") == "":
+				w.Header().Set("WWW-Authenticate", "Basic realm="+keyFile)
+				http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+				return
+			case r.Header.Get("Authorization") != "Basic the-secret":
+				http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+				return
+			}
+		default:
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Add("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"access_token":"%s"}`, tok)
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		name             string
+		identityEndpoint string
+		identityHeader   string
+		imdsEndpoint     string
+		want             string
+		wantErr          bool
+	}{
+		{"ok app service", srv.URL + "/app-service", "the-header", "", tok, false},
+		{"ok arc", srv.URL + "/arc", "", "http://localhost:40342", tok, false},
+		{"fail app service", srv.URL + "/app-service", "bad-header", "", "", true},
+		{"fail arc challenge", srv.URL + "/arc-bad-challenge", "", "http://localhost:40342", "", true},
+		{"fail connect", "foobarzar", "the-header", "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p.config.identityEndpoint = tt.identityEndpoint
+			p.config.identityHeader = tt.identityHeader
+			p.config.imdsEndpoint = tt.imdsEndpoint
+			got, err := p.GetIdentityToken("subject", "caURL")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Azure.GetIdentityToken() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			assert.Equals(t, tt.want, got)
+		})
+	}
+}
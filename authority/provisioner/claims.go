@@ -1,18 +1,30 @@
 package provisioner
 
 import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/pkg/errors"
+	"go.step.sm/crypto/keyutil"
 	"golang.org/x/crypto/ssh"
 )
 
 // Claims so that individual provisioners can override global claims.
 type Claims struct {
 	// TLS CA properties
-	MinTLSDur     *Duration `json:"minTLSCertDuration,omitempty"`
-	MaxTLSDur     *Duration `json:"maxTLSCertDuration,omitempty"`
-	DefaultTLSDur *Duration `json:"defaultTLSCertDuration,omitempty"`
+	MinTLSDur     *Duration     `json:"minTLSCertDuration,omitempty"`
+	MaxTLSDur     *Duration     `json:"maxTLSCertDuration,omitempty"`
+	DefaultTLSDur *Duration     `json:"defaultTLSCertDuration,omitempty"`
+	TLSLifetimes  []TLSLifetime `json:"tlsCertLifetimes,omitempty"`
+
+	// Key properties
+	Keys *KeyClaims `json:"keys,omitempty"`
 
 	// SSH CA properties
 	MinUserSSHDur     *Duration `json:"minUserSSHCertDuration,omitempty"`
@@ -29,6 +41,168 @@ type Claims struct {
 
 	// Other properties
 	DisableSmallstepExtensions *bool `json:"disableSmallstepExtensions,omitempty"`
+
+	// Lifecycle properties
+	State State `json:"state,omitempty"`
+}
+
+// State is the lifecycle state of a provisioner. It allows to drain a
+// provisioner before removing it.
+type State string
+
+const (
+	// StateActive is the default state, the provisioner can issue and renew
+	// certificates.
+	StateActive State = "active"
+	// StateRenewOnly is the state of a provisioner that cannot issue new
+	// certificates, but it still allows to renew the existing ones.
+	StateRenewOnly State = "renew-only"
+	// StateDisabled is the state of a provisioner that cannot issue nor renew
+	// certificates. Revocation is still allowed.
+	StateDisabled State = "disabled"
+)
+
+// Validate returns an error if the state is not supported.
+func (s State) Validate() error {
+	switch s {
+	case "", StateActive, StateRenewOnly, StateDisabled:
+		return nil
+	default:
+		return errors.Errorf("claims: state %q is not supported", s)
+	}
+}
+
+// CertificateCategory is a category of X.509 certificates that can have its
+// own maximum duration.
+type CertificateCategory string
+
+const (
+	// CategoryServer matches certificates with the server authentication
+	// extended key usage.
+	CategoryServer CertificateCategory = "server"
+	// CategoryClient matches certificates with the client authentication
+	// extended key usage.
+	CategoryClient CertificateCategory = "client"
+	// CategoryWildcard matches certificates with at least one wildcard DNS
+	// name.
+	CategoryWildcard CertificateCategory = "wildcard"
+	// CategorySingleHost matches certificates with exactly one DNS name or IP
+	// address and no wildcards.
+	CategorySingleHost CertificateCategory = "single-host"
+)
+
+// Validate returns an error if the category is not supported.
+func (c CertificateCategory) Validate() error {
+	switch c {
+	case CategoryServer, CategoryClient, CategoryWildcard, CategorySingleHost:
+		return nil
+	default:
+		return errors.Errorf("claims: certificate category %q is not supported", c)
+	}
+}
+
+// Match returns true if the given certificate belongs to the category.
+func (c CertificateCategory) Match(cert *x509.Certificate) bool {
+	switch c {
+	case CategoryServer:
+		return hasExtKeyUsage(cert, x509.ExtKeyUsageServerAuth)
+	case CategoryClient:
+		return hasExtKeyUsage(cert, x509.ExtKeyUsageClientAuth)
+	case CategoryWildcard:
+		for _, name := range cert.DNSNames {
+			if strings.HasPrefix(name, "*.") {
+				return true
+			}
+		}
+		return false
+	case CategorySingleHost:
+		if len(cert.DNSNames)+len(cert.IPAddresses) != 1 {
+			return false
+		}
+		return !CategoryWildcard.Match(cert)
+	default:
+		return false
+	}
+}
+
+func hasExtKeyUsage(cert *x509.Certificate, eku x509.ExtKeyUsage) bool {
+	for _, u := range cert.ExtKeyUsage {
+		if u == eku {
+			return true
+		}
+	}
+	return false
+}
+
+// TLSLifetime limits the maximum duration of the X.509 certificates of a
+// category. A certificate matching multiple categories is limited by the
+// shortest of them.
+type TLSLifetime struct {
+	Category  CertificateCategory `json:"category"`
+	MaxTLSDur *Duration           `json:"maxTLSCertDuration"`
+}
+
+// KeyClaims restricts the public keys that can be certified by a provisioner.
+// Key types use the JWK names "EC", "RSA" and "OKP", and curves the names
+// "P-256", "P-384", "P-521" and "Ed25519".
+type KeyClaims struct {
+	MinRSABits      int      `json:"minRSABits,omitempty"`
+	AllowedKeyTypes []string `json:"allowedKeyTypes,omitempty"`
+	AllowedCurves   []string `json:"allowedCurves,omitempty"`
+}
+
+// Validate returns an error if the key claims are not valid.
+func (k *KeyClaims) Validate() error {
+	if k == nil {
+		return nil
+	}
+	if k.MinRSABits != 0 && k.MinRSABits < 8*keyutil.MinRSAKeyBytes {
+		return errors.Errorf("claims: minRSABits cannot be less than %d", 8*keyutil.MinRSAKeyBytes)
+	}
+	for _, kty := range k.AllowedKeyTypes {
+		switch kty {
+		case "EC", "RSA", "OKP":
+		default:
+			return errors.Errorf("claims: key type %q is not supported", kty)
+		}
+	}
+	for _, crv := range k.AllowedCurves {
+		switch crv {
+		case "P-256", "P-384", "P-521", "Ed25519":
+		default:
+			return errors.Errorf("claims: curve %q is not supported", crv)
+		}
+	}
+	return nil
+}
+
+// Check returns an error if the given public key is not allowed by the key
+// claims.
+func (k *KeyClaims) Check(pub crypto.PublicKey) error {
+	if k == nil {
+		return nil
+	}
+	var kty, crv string
+	switch key := pub.(type) {
+	case *rsa.PublicKey:
+		kty = "RSA"
+		if k.MinRSABits > 0 && key.N.BitLen() < k.MinRSABits {
+			return errors.Errorf("RSA key must be at least %d bits", k.MinRSABits)
+		}
+	case *ecdsa.PublicKey:
+		kty, crv = "EC", key.Curve.Params().Name
+	case ed25519.PublicKey:
+		kty, crv = "OKP", "Ed25519"
+	default:
+		return errors.Errorf("key of type %T is not supported", pub)
+	}
+	if len(k.AllowedKeyTypes) > 0 && !slices.Contains(k.AllowedKeyTypes, kty) {
+		return errors.Errorf("key type %s is not allowed", kty)
+	}
+	if crv != "" && len(k.AllowedCurves) > 0 && !slices.Contains(k.AllowedCurves, crv) {
+		return errors.Errorf("curve %s is not allowed", crv)
+	}
+	return nil
 }
 
 // Claimer is the type that controls claims. It provides an interface around the
@@ -56,6 +230,8 @@ func (c *Claimer) Claims() Claims {
 		MinTLSDur:                  &Duration{c.MinTLSCertDuration()},
 		MaxTLSDur:                  &Duration{c.MaxTLSCertDuration()},
 		DefaultTLSDur:              &Duration{c.DefaultTLSCertDuration()},
+		TLSLifetimes:               c.TLSCertLifetimes(),
+		Keys:                       c.KeyClaims(),
 		MinUserSSHDur:              &Duration{c.MinUserSSHCertDuration()},
 		MaxUserSSHDur:              &Duration{c.MaxUserSSHCertDuration()},
 		DefaultUserSSHDur:          &Duration{c.DefaultUserSSHCertDuration()},
@@ -66,6 +242,7 @@ func (c *Claimer) Claims() Claims {
 		DisableRenewal:             &disableRenewal,
 		AllowRenewalAfterExpiry:    &allowRenewalAfterExpiry,
 		DisableSmallstepExtensions: &disableSmallstepExtensions,
+		State:                      c.State(),
 	}
 }
 
@@ -105,6 +282,26 @@ func (c *Claimer) MaxTLSCertDuration() time.Duration {
 	return c.claims.MaxTLSDur.Duration
 }
 
+// TLSCertLifetimes returns the per-category maximum TLS cert durations for the
+// provisioner. If they are not set within the provisioner, then the global
+// values from the authority configuration will be used.
+func (c *Claimer) TLSCertLifetimes() []TLSLifetime {
+	if c.claims == nil || c.claims.TLSLifetimes == nil {
+		return c.global.TLSLifetimes
+	}
+	return c.claims.TLSLifetimes
+}
+
+// KeyClaims returns the public key restrictions for the provisioner. If they
+// are not set within the provisioner, then the global value from the authority
+// configuration will be used.
+func (c *Claimer) KeyClaims() *KeyClaims {
+	if c.claims == nil || c.claims.Keys == nil {
+		return c.global.Keys
+	}
+	return c.claims.Keys
+}
+
 // IsDisableRenewal returns if the renewal flow is disabled for the
 // provisioner. If the property is not set within the provisioner, then the
 // global value from the authority configuration will be used.
@@ -221,6 +418,21 @@ func (c *Claimer) MaxHostSSHCertDuration() time.Duration {
 	return c.claims.MaxHostSSHDur.Duration
 }
 
+// State returns the lifecycle state of the provisioner. If the property is
+// not set within the provisioner, then the global value from the authority
+// configuration will be used, and if that is not set the provisioner will be
+// active.
+func (c *Claimer) State() State {
+	switch {
+	case c.claims != nil && c.claims.State != "":
+		return c.claims.State
+	case c.global.State != "":
+		return c.global.State
+	default:
+		return StateActive
+	}
+}
+
 // IsSSHCAEnabled returns if the SSH CA is enabled for the provisioner. If the
 // property is not set within the provisioner, then the global value from the
 // authority configuration will be used.
@@ -238,7 +450,15 @@ func (c *Claimer) Validate() error {
 		maxDur = c.MaxTLSCertDuration()
 		defDur = c.DefaultTLSCertDuration()
 	)
+	var state State
+	if c.claims != nil {
+		state = c.claims.State
+	}
 	switch {
+	case state.Validate() != nil:
+		return state.Validate()
+	case c.global.State.Validate() != nil:
+		return c.global.State.Validate()
 	case minDur <= 0:
 		return errors.Errorf("claims: MinTLSCertDuration must be greater than 0")
 	case maxDur <= 0:
@@ -252,7 +472,14 @@ func (c *Claimer) Validate() error {
 		return errors.Errorf("claims: DefaultCertDuration cannot be less than MinCertDuration: DefaultCertDuration - %v, MinCertDuration - %v", defDur, minDur)
 	case maxDur < defDur:
 		return errors.Errorf("claims: MaxCertDuration cannot be less than DefaultCertDuration: MaxCertDuration - %v, DefaultCertDuration - %v", maxDur, defDur)
-	default:
-		return nil
 	}
+	for _, l := range c.TLSCertLifetimes() {
+		if err := l.Category.Validate(); err != nil {
+			return err
+		}
+		if l.MaxTLSDur == nil || l.MaxTLSDur.Duration < minDur {
+			return errors.Errorf("claims: MaxTLSCertDuration for %s certificates cannot be less than MinCertDuration - %v", l.Category, minDur)
+		}
+	}
+	return c.KeyClaims().Validate()
 }
@@ -1,6 +1,13 @@
 package provisioner
 
 import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"net"
 	"testing"
 	"time"
 
@@ -49,3 +56,153 @@ func TestClaimer_DefaultSSHCertDuration(t *testing.T) {
 		})
 	}
 }
+
+func TestClaimer_State(t *testing.T) {
+	globalRenewOnly := globalProvisionerClaims
+	globalRenewOnly.State = StateRenewOnly
+	tests := []struct {
+		name   string
+		global Claims
+		claims *Claims
+		want   State
+	}{
+		{"default", globalProvisionerClaims, nil, StateActive},
+		{"default empty", globalProvisionerClaims, &Claims{}, StateActive},
+		{"renew-only", globalProvisionerClaims, &Claims{State: StateRenewOnly}, StateRenewOnly},
+		{"disabled", globalProvisionerClaims, &Claims{State: StateDisabled}, StateDisabled},
+		{"global", globalRenewOnly, nil, StateRenewOnly},
+		{"override global", globalRenewOnly, &Claims{State: StateActive}, StateActive},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Claimer{
+				global: tt.global,
+				claims: tt.claims,
+			}
+			if got := c.State(); got != tt.want {
+				t.Errorf("Claimer.State() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClaimer_Validate_state(t *testing.T) {
+	globalInvalid := globalProvisionerClaims
+	globalInvalid.State = "draining"
+	if _, err := NewClaimer(&Claims{State: StateRenewOnly}, globalProvisionerClaims); err != nil {
+		t.Errorf("NewClaimer() error = %v", err)
+	}
+	if _, err := NewClaimer(&Claims{State: "draining"}, globalProvisionerClaims); err == nil {
+		t.Error("NewClaimer() error = nil, want error")
+	}
+	if _, err := NewClaimer(nil, globalInvalid); err == nil {
+		t.Error("NewClaimer() error = nil, want error")
+	}
+}
+
+func TestClaimer_Validate_lifetimesAndKeys(t *testing.T) {
+	hour := &Duration{Duration: time.Hour}
+	tests := []struct {
+		name    string
+		claims  *Claims
+		wantErr bool
+	}{
+		{"ok", &Claims{TLSLifetimes: []TLSLifetime{{CategoryWildcard, hour}}, Keys: &KeyClaims{MinRSABits: 3072, AllowedKeyTypes: []string{"EC", "RSA"}, AllowedCurves: []string{"P-256"}}}, false},
+		{"fail category", &Claims{TLSLifetimes: []TLSLifetime{{"codeSigning", hour}}}, true},
+		{"fail missing duration", &Claims{TLSLifetimes: []TLSLifetime{{CategoryClient, nil}}}, true},
+		{"fail duration less than min", &Claims{TLSLifetimes: []TLSLifetime{{CategoryClient, &Duration{Duration: time.Minute}}}}, true},
+		{"fail rsa bits", &Claims{Keys: &KeyClaims{MinRSABits: 1024}}, true},
+		{"fail key type", &Claims{Keys: &KeyClaims{AllowedKeyTypes: []string{"DSA"}}}, true},
+		{"fail curve", &Claims{Keys: &KeyClaims{AllowedCurves: []string{"P-224"}}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewClaimer(tt.claims, globalProvisionerClaims); (err != nil) != tt.wantErr {
+				t.Errorf("NewClaimer() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestClaimer_KeyClaims(t *testing.T) {
+	global := globalProvisionerClaims
+	global.Keys = &KeyClaims{MinRSABits: 3072}
+	keys := &KeyClaims{AllowedKeyTypes: []string{"OKP"}}
+	if got := (&Claimer{global: global}).KeyClaims(); got != global.Keys {
+		t.Errorf("Claimer.KeyClaims() = %v, want %v", got, global.Keys)
+	}
+	if got := (&Claimer{global: global, claims: &Claims{Keys: keys}}).KeyClaims(); got != keys {
+		t.Errorf("Claimer.KeyClaims() = %v, want %v", got, keys)
+	}
+}
+
+func TestCertificateCategory_Match(t *testing.T) {
+	server := &x509.Certificate{DNSNames: []string{"foo.example.com"}, ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}}
+	client := &x509.Certificate{EmailAddresses: []string{"jane@example.com"}, ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}}
+	wildcard := &x509.Certificate{DNSNames: []string{"*.example.com"}}
+	multiple := &x509.Certificate{DNSNames: []string{"foo.example.com"}, IPAddresses: []net.IP{net.ParseIP("127.0.0.1")}}
+	tests := []struct {
+		category CertificateCategory
+		cert     *x509.Certificate
+		want     bool
+	}{
+		{CategoryServer, server, true},
+		{CategoryServer, client, false},
+		{CategoryClient, client, true},
+		{CategoryClient, server, false},
+		{CategoryWildcard, wildcard, true},
+		{CategoryWildcard, server, false},
+		{CategorySingleHost, server, true},
+		{CategorySingleHost, wildcard, false},
+		{CategorySingleHost, multiple, false},
+		{CategorySingleHost, client, false},
+		{"unknown", server, false},
+	}
+	for _, tt := range tests {
+		if got := tt.category.Match(tt.cert); got != tt.want {
+			t.Errorf("CertificateCategory(%q).Match() = %v, want %v", tt.category, got, tt.want)
+		}
+	}
+}
+
+func TestKeyClaims_Check(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p256, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p384, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edPub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		keys    *KeyClaims
+		pub     any
+		wantErr bool
+	}{
+		{"nil", nil, &rsaKey.PublicKey, false},
+		{"ok rsa", &KeyClaims{MinRSABits: 2048}, &rsaKey.PublicKey, false},
+		{"ok curve", &KeyClaims{AllowedCurves: []string{"P-256"}}, &p256.PublicKey, false},
+		{"ok curve ignores rsa", &KeyClaims{AllowedCurves: []string{"P-256"}}, &rsaKey.PublicKey, false},
+		{"ok ed25519", &KeyClaims{AllowedKeyTypes: []string{"OKP"}}, edPub, false},
+		{"fail rsa bits", &KeyClaims{MinRSABits: 3072}, &rsaKey.PublicKey, true},
+		{"fail key type", &KeyClaims{AllowedKeyTypes: []string{"EC"}}, &rsaKey.PublicKey, true},
+		{"fail curve", &KeyClaims{AllowedCurves: []string{"P-256"}}, &p384.PublicKey, true},
+		{"fail unsupported", &KeyClaims{}, "foo", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.keys.Check(tt.pub); (err != nil) != tt.wantErr {
+				t.Errorf("KeyClaims.Check() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package provisioner
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"slices"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// clientCertificateTrust restricts the certificates that can authenticate the
+// EST and CMP enrollments of a provisioner. Besides chaining to the CA roots,
+// the certificates must chain to one of the configured roots, if any, and
+// must have been issued by one of the configured provisioners, if any.
+type clientCertificateTrust struct {
+	roots        []*x509.Certificate
+	provisioners []string
+}
+
+// newClientCertificateTrust parses the PEM encoded roots and returns the
+// trust of the client certificates. Roots or provisioners are required.
+func newClientCertificateTrust(typ string, roots []byte, provisioners []string) (*clientCertificateTrust, error) {
+	if len(roots) == 0 && len(provisioners) == 0 {
+		return nil, errors.Errorf("%s clientCertificates requires clientCertificateRoots or clientCertificateProvisioners", typ)
+	}
+	t := &clientCertificateTrust{
+		provisioners: provisioners,
+	}
+	for rest := roots; len(rest) > 0; {
+		var block *pem.Block
+		if block, rest = pem.Decode(rest); block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" || len(block.Headers) != 0 {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error parsing %s clientCertificateRoots", typ)
+		}
+		t.roots = append(t.roots, cert)
+	}
+	if len(roots) > 0 && len(t.roots) == 0 {
+		return nil, errors.Errorf("%s clientCertificateRoots does not contain any certificate", typ)
+	}
+	return t, nil
+}
+
+// authorize validates a client certificate and the certificate request it
+// authenticates. The chains are the verified chains of the certificate, and
+// the request must have the same subject and contain only names in the
+// certificate.
+func (t *clientCertificateTrust) authorize(chains [][]*x509.Certificate, csr *x509.CertificateRequest) error {
+	if len(chains) == 0 || len(chains[0]) == 0 {
+		return errors.New("client certificate has not been verified")
+	}
+	cert := chains[0][0]
+	now := time.Now()
+	if now.Before(cert.NotBefore) || !now.Before(cert.NotAfter) {
+		return errors.New("client certificate is not valid at this time")
+	}
+	if len(t.roots) > 0 && !slices.ContainsFunc(chains, t.isTrusted) {
+		return errors.New("client certificate does not chain to a trusted root")
+	}
+	if len(t.provisioners) > 0 {
+		ext, ok := GetProvisionerExtension(cert)
+		if !ok || !slices.Contains(t.provisioners, ext.Name) {
+			return errors.New("client certificate was not issued by a trusted provisioner")
+		}
+	}
+	return checkRenewalSubject(csr, cert)
+}
+
+// isTrusted returns true if one of the issuers in the chain is a configured
+// root.
+func (t *clientCertificateTrust) isTrusted(chain []*x509.Certificate) bool {
+	for _, c := range chain[1:] {
+		if slices.ContainsFunc(t.roots, c.Equal) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,207 @@
+package provisioner
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/x509"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"go.step.sm/linkedca"
+)
+
+// CMP is the provisioner used by the CMP (RFC 4210 and RFC 9483) endpoints.
+// Initial and certification requests are authenticated with a password-based
+// MAC using the shared secret, or signed with a certificate issued by the CA.
+// Key update and revocation requests are signed with the certificate to
+// update or revoke.
+type CMP struct {
+	*base
+	ID      string `json:"-"`
+	Type    string `json:"type"`
+	Name    string `json:"name"`
+	ForceCN bool   `json:"forceCN,omitempty"`
+	// SharedSecret enables the MAC-based protection of the requests.
+	SharedSecret string `json:"sharedSecret,omitempty"`
+	// SharedSecretKeyID is the reference of the shared secret sent by the
+	// clients in the senderKID. If empty, any reference is accepted.
+	SharedSecretKeyID string `json:"sharedSecretKeyID,omitempty"`
+	// ClientCertificates enables the signature-based protection of initial
+	// and certification requests using a certificate issued by the CA, e.g.,
+	// a manufacturer installed certificate. The certificates must chain to one
+	// of the PEM encoded ClientCertificateRoots, or must have been issued by
+	// one of the ClientCertificateProvisioners, and the requests can only
+	// contain the subject and names in the certificate.
+	ClientCertificates            bool     `json:"clientCertificates,omitempty"`
+	ClientCertificateRoots        []byte   `json:"clientCertificateRoots,omitempty"`
+	ClientCertificateProvisioners []string `json:"clientCertificateProvisioners,omitempty"`
+	// MinimumPublicKeyLength is the minimum length for public keys in
+	// requests.
+	MinimumPublicKeyLength int      `json:"minimumPublicKeyLength,omitempty"`
+	Claims                 *Claims  `json:"claims,omitempty"`
+	Options                *Options `json:"options,omitempty"`
+	ctl                    *Controller
+	clientCertificateTrust *clientCertificateTrust
+}
+
+// GetID returns the provisioner unique identifier.
+func (p *CMP) GetID() string {
+	if p.ID != "" {
+		return p.ID
+	}
+	return p.GetIDForToken()
+}
+
+// GetIDForToken returns an identifier that will be used to load the provisioner
+// from a token.
+func (p *CMP) GetIDForToken() string {
+	return "cmp/" + p.Name
+}
+
+// GetName returns the name of the provisioner.
+func (p *CMP) GetName() string {
+	return p.Name
+}
+
+// GetType returns the type of provisioner.
+func (p *CMP) GetType() Type {
+	return TypeCMP
+}
+
+// GetEncryptedKey returns the base provisioner encrypted key if it's defined.
+func (p *CMP) GetEncryptedKey() (string, string, bool) {
+	return "", "", false
+}
+
+// GetTokenID returns the identifier of the token.
+func (p *CMP) GetTokenID(string) (string, error) {
+	return "", errors.New("cmp provisioner does not implement GetTokenID")
+}
+
+// GetOptions returns the configured provisioner options.
+func (p *CMP) GetOptions() *Options {
+	return p.Options
+}
+
+// DefaultTLSCertDuration returns the default TLS cert duration enforced by
+// the provisioner.
+func (p *CMP) DefaultTLSCertDuration() time.Duration {
+	return p.ctl.Claimer.DefaultTLSCertDuration()
+}
+
+// Init initializes and validates the fields of a CMP type.
+func (p *CMP) Init(config Config) (err error) {
+	switch {
+	case p.Type == "":
+		return errors.New("provisioner type cannot be empty")
+	case p.Name == "":
+		return errors.New("provisioner name cannot be empty")
+	case p.SharedSecret == "" && !p.ClientCertificates:
+		return errors.New("cmp provisioner must enable sharedSecret or clientCertificates")
+	case p.SharedSecretKeyID != "" && p.SharedSecret == "":
+		return errors.New("cmp sharedSecretKeyID cannot be used without a sharedSecret")
+	}
+
+	// Default to 2048 bits minimum public key length if not set
+	if p.MinimumPublicKeyLength == 0 {
+		p.MinimumPublicKeyLength = 2048
+	}
+	if p.MinimumPublicKeyLength%8 != 0 {
+		return errors.Errorf("%d bits is not exactly divisible by 8", p.MinimumPublicKeyLength)
+	}
+
+	if p.ClientCertificates {
+		if p.clientCertificateTrust, err = newClientCertificateTrust("cmp", p.ClientCertificateRoots, p.ClientCertificateProvisioners); err != nil {
+			return err
+		}
+	}
+
+	p.ctl, err = NewController(p, p.Claims, config, p.Options)
+	return
+}
+
+// GetSharedSecret returns the shared secret used to verify MAC-protected
+// requests with the given sender key identifier.
+func (p *CMP) GetSharedSecret(_ context.Context, keyID []byte) ([]byte, error) {
+	if p.SharedSecret == "" {
+		return nil, errors.Errorf("provisioner %q does not allow mac-based protection", p.Name)
+	}
+	if p.SharedSecretKeyID != "" && subtle.ConstantTimeCompare([]byte(p.SharedSecretKeyID), keyID) != 1 {
+		return nil, errors.Errorf("unknown sender key identifier %q", keyID)
+	}
+	return []byte(p.SharedSecret), nil
+}
+
+// AuthorizeClientCertificate validates the certificate used to sign an
+// initial or certification request. The chains are the verified chains of the
+// certificate, and the request can only contain the subject and names in the
+// certificate.
+func (p *CMP) AuthorizeClientCertificate(_ context.Context, chains [][]*x509.Certificate, csr *x509.CertificateRequest) error {
+	if !p.ClientCertificates || p.clientCertificateTrust == nil {
+		return errors.Errorf("provisioner %q does not allow signature-based protection", p.Name)
+	}
+	return p.clientCertificateTrust.authorize(chains, csr)
+}
+
+// AuthorizeKeyUpdate validates a key update request signed with the given
+// certificate, which must have been verified by the caller. The certificate
+// must have been issued by this provisioner and it must be renewable, and the
+// request must have the same subject and contain only names in the
+// certificate.
+func (p *CMP) AuthorizeKeyUpdate(ctx context.Context, csr *x509.CertificateRequest, cert *x509.Certificate) error {
+	ext, ok := GetProvisionerExtension(cert)
+	if !ok || ext.Type != TypeCMP || ext.Name != p.Name {
+		return errors.Errorf("certificate was not issued by provisioner %q", p.Name)
+	}
+	if err := p.ctl.AuthorizeRenew(ctx, cert); err != nil {
+		return err
+	}
+	return checkRenewalSubject(csr, cert)
+}
+
+// AuthorizeRevocation validates a revocation request signed with the
+// certificate to revoke, which must have been verified by the caller.
+func (p *CMP) AuthorizeRevocation(_ context.Context, cert *x509.Certificate) error {
+	return p.checkIssued(cert)
+}
+
+// checkIssued returns an error if the certificate was not issued by this
+// provisioner or if it is not valid at this time.
+func (p *CMP) checkIssued(cert *x509.Certificate) error {
+	ext, ok := GetProvisionerExtension(cert)
+	if !ok || ext.Type != TypeCMP || ext.Name != p.Name {
+		return errors.Errorf("certificate was not issued by provisioner %q", p.Name)
+	}
+	now := time.Now()
+	switch {
+	case now.Before(cert.NotBefore):
+		return errors.New("certificate is not yet valid")
+	case !now.Before(cert.NotAfter):
+		return errors.New("certificate has expired")
+	}
+	return nil
+}
+
+// AuthorizeSign returns the list of modifiers and validators of the
+// certificates signed with a CMP request. The authentication and the
+// verification of the proof of possession are performed by the CMP endpoint,
+// CMP certificate requests are not signed.
+func (p *CMP) AuthorizeSign(context.Context, string) ([]SignOption, error) {
+	if err := p.ctl.AuthorizeIssuance(); err != nil {
+		return nil, err
+	}
+	return []SignOption{
+		p,
+		proofOfPossessionVerified{},
+		// modifiers / withOptions
+		newProvisionerExtensionOption(TypeCMP, p.Name, "").WithControllerOptions(p.ctl),
+		newForceCNOption(p.ForceCN),
+		profileDefaultDuration(p.ctl.Claimer.DefaultTLSCertDuration()),
+		// validators
+		newPublicKeyMinimumLengthValidator(p.MinimumPublicKeyLength),
+		newClaimsValidityValidator(p.ctl.Claimer),
+		newX509NamePolicyValidator(p.ctl.getPolicy().getX509()),
+		p.ctl.newWebhookController(nil, linkedca.Webhook_X509),
+	}, nil
+}
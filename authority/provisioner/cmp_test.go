@@ -0,0 +1,211 @@
+package provisioner
+
+import (
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.step.sm/crypto/keyutil"
+	"go.step.sm/crypto/minica"
+)
+
+func generateCMP(t *testing.T) *CMP {
+	t.Helper()
+	p := &CMP{
+		Type:                          "CMP",
+		Name:                          "cmp",
+		SharedSecret:                  "password",
+		SharedSecretKeyID:             "key-id",
+		ClientCertificates:            true,
+		ClientCertificateProvisioners: []string{"manufacturing"},
+	}
+	require.NoError(t, p.Init(Config{Claims: globalProvisionerClaims}))
+	return p
+}
+
+func TestCMP_Getters(t *testing.T) {
+	p := generateCMP(t)
+	assert.Equal(t, "cmp/cmp", p.GetID())
+	assert.Equal(t, "cmp/cmp", p.GetIDForToken())
+	assert.Equal(t, "cmp", p.GetName())
+	assert.Equal(t, TypeCMP, p.GetType())
+	assert.Equal(t, "CMP", p.GetType().String())
+	kid, key, ok := p.GetEncryptedKey()
+	assert.Empty(t, kid)
+	assert.Empty(t, key)
+	assert.False(t, ok)
+}
+
+func TestCMP_Init(t *testing.T) {
+	ca, err := minica.New()
+	require.NoError(t, err)
+	roots := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Root.Raw})
+	tests := []struct {
+		name    string
+		p       *CMP
+		wantErr bool
+	}{
+		{"ok sharedSecret", &CMP{Type: "CMP", Name: "cmp", SharedSecret: "password"}, false},
+		{"ok sharedSecretKeyID", &CMP{Type: "CMP", Name: "cmp", SharedSecret: "password", SharedSecretKeyID: "key-id"}, false},
+		{"ok clientCertificateRoots", &CMP{Type: "CMP", Name: "cmp", ClientCertificates: true, ClientCertificateRoots: roots}, false},
+		{"ok clientCertificateProvisioners", &CMP{Type: "CMP", Name: "cmp", ClientCertificates: true, ClientCertificateProvisioners: []string{"manufacturing"}}, false},
+		{"fail type", &CMP{Name: "cmp", SharedSecret: "password"}, true},
+		{"fail name", &CMP{Type: "CMP", SharedSecret: "password"}, true},
+		{"fail no auth", &CMP{Type: "CMP", Name: "cmp"}, true},
+		{"fail clientCertificates", &CMP{Type: "CMP", Name: "cmp", ClientCertificates: true}, true},
+		{"fail clientCertificateRoots", &CMP{Type: "CMP", Name: "cmp", ClientCertificates: true, ClientCertificateRoots: []byte("foo")}, true},
+		{"fail sharedSecretKeyID", &CMP{Type: "CMP", Name: "cmp", SharedSecretKeyID: "key-id", ClientCertificates: true, ClientCertificateRoots: roots}, true},
+		{"fail minimumPublicKeyLength", &CMP{Type: "CMP", Name: "cmp", SharedSecret: "password", MinimumPublicKeyLength: 2047}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.p.Init(Config{Claims: globalProvisionerClaims})
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestCMP_GetSharedSecret(t *testing.T) {
+	ctx := context.Background()
+	p := generateCMP(t)
+	secret, err := p.GetSharedSecret(ctx, []byte("key-id"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("password"), secret)
+	_, err = p.GetSharedSecret(ctx, []byte("other"))
+	assert.Error(t, err)
+	_, err = p.GetSharedSecret(ctx, nil)
+	assert.Error(t, err)
+
+	p.SharedSecretKeyID = ""
+	secret, err = p.GetSharedSecret(ctx, []byte("other"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("password"), secret)
+
+	p.SharedSecret = ""
+	_, err = p.GetSharedSecret(ctx, nil)
+	assert.Error(t, err)
+}
+
+func TestCMP_AuthorizeClientCertificate(t *testing.T) {
+	ctx := context.Background()
+	ca, err := minica.New()
+	require.NoError(t, err)
+	otherCA, err := minica.New()
+	require.NoError(t, err)
+	signer, err := keyutil.GenerateDefaultSigner()
+	require.NoError(t, err)
+
+	newChain := func(ca *minica.CA, name string, notAfter time.Time) [][]*x509.Certificate {
+		ext, err := (&Extension{Type: TypeJWK, Name: name}).ToExtension()
+		require.NoError(t, err)
+		cert, err := ca.Sign(&x509.Certificate{
+			Subject:         pkix.Name{CommonName: "device"},
+			DNSNames:        []string{"device.example.com"},
+			PublicKey:       signer.Public(),
+			NotBefore:       time.Now().Add(-2 * time.Hour),
+			NotAfter:        notAfter,
+			ExtraExtensions: []pkix.Extension{ext},
+		})
+		require.NoError(t, err)
+		return [][]*x509.Certificate{{cert, ca.Intermediate, ca.Root}}
+	}
+
+	csr := &x509.CertificateRequest{Subject: pkix.Name{CommonName: "device"}, DNSNames: []string{"device.example.com"}}
+	otherCSR := &x509.CertificateRequest{Subject: pkix.Name{CommonName: "device"}, DNSNames: []string{"other.example.com"}}
+	notAfter := time.Now().Add(time.Hour)
+
+	p := generateCMP(t)
+	assert.NoError(t, p.AuthorizeClientCertificate(ctx, newChain(ca, "manufacturing", notAfter), csr))
+	assert.Error(t, p.AuthorizeClientCertificate(ctx, newChain(ca, "other", notAfter), csr))
+	assert.Error(t, p.AuthorizeClientCertificate(ctx, newChain(ca, "manufacturing", time.Now().Add(-time.Minute)), csr))
+	assert.Error(t, p.AuthorizeClientCertificate(ctx, newChain(ca, "manufacturing", notAfter), otherCSR))
+
+	p = &CMP{
+		Type:                   "CMP",
+		Name:                   "cmp",
+		ClientCertificates:     true,
+		ClientCertificateRoots: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Root.Raw}),
+	}
+	require.NoError(t, p.Init(Config{Claims: globalProvisionerClaims}))
+	assert.NoError(t, p.AuthorizeClientCertificate(ctx, newChain(ca, "other", notAfter), csr))
+	assert.Error(t, p.AuthorizeClientCertificate(ctx, newChain(otherCA, "other", notAfter), csr))
+
+	p.ClientCertificates = false
+	assert.Error(t, p.AuthorizeClientCertificate(ctx, newChain(ca, "other", notAfter), csr))
+}
+
+func TestCMP_AuthorizeKeyUpdate(t *testing.T) {
+	ctx := context.Background()
+	p := generateCMP(t)
+	ca, err := minica.New()
+	require.NoError(t, err)
+	signer, err := keyutil.GenerateDefaultSigner()
+	require.NoError(t, err)
+
+	newCert := func(typ Type, name string, notAfter time.Time) *x509.Certificate {
+		ext, err := (&Extension{Type: typ, Name: name}).ToExtension()
+		require.NoError(t, err)
+		cert, err := ca.Sign(&x509.Certificate{
+			Subject:         pkix.Name{CommonName: "device"},
+			DNSNames:        []string{"device.example.com"},
+			PublicKey:       signer.Public(),
+			NotBefore:       time.Now().Add(-2 * time.Hour),
+			NotAfter:        notAfter,
+			ExtraExtensions: []pkix.Extension{ext},
+		})
+		require.NoError(t, err)
+		return cert
+	}
+
+	csr := &x509.CertificateRequest{Subject: pkix.Name{CommonName: "device"}, DNSNames: []string{"device.example.com"}}
+	assert.NoError(t, p.AuthorizeKeyUpdate(ctx, csr, newCert(TypeCMP, "cmp", time.Now().Add(time.Hour))))
+	assert.Error(t, p.AuthorizeKeyUpdate(ctx, csr, newCert(TypeCMP, "other", time.Now().Add(time.Hour))))
+	assert.Error(t, p.AuthorizeKeyUpdate(ctx, csr, newCert(TypeEST, "cmp", time.Now().Add(time.Hour))))
+	assert.Error(t, p.AuthorizeKeyUpdate(ctx, csr, newCert(TypeCMP, "cmp", time.Now().Add(-time.Hour))))
+	assert.Error(t, p.AuthorizeKeyUpdate(ctx, &x509.CertificateRequest{Subject: pkix.Name{CommonName: "other"}}, newCert(TypeCMP, "cmp", time.Now().Add(time.Hour))))
+
+	assert.NoError(t, p.AuthorizeRevocation(ctx, newCert(TypeCMP, "cmp", time.Now().Add(time.Hour))))
+	assert.Error(t, p.AuthorizeRevocation(ctx, newCert(TypeCMP, "other", time.Now().Add(time.Hour))))
+	assert.Error(t, p.AuthorizeRevocation(ctx, newCert(TypeCMP, "cmp", time.Now().Add(-time.Hour))))
+
+	disableRenewal := true
+	p.Claims = &Claims{DisableRenewal: &disableRenewal}
+	require.NoError(t, p.Init(Config{Claims: globalProvisionerClaims}))
+	assert.Error(t, p.AuthorizeKeyUpdate(ctx, csr, newCert(TypeCMP, "cmp", time.Now().Add(time.Hour))))
+	assert.NoError(t, p.AuthorizeRevocation(ctx, newCert(TypeCMP, "cmp", time.Now().Add(time.Hour))))
+}
+
+func TestCMP_AuthorizeSign(t *testing.T) {
+	p := generateCMP(t)
+	opts, err := p.AuthorizeSign(context.Background(), "")
+	require.NoError(t, err)
+	assert.Len(t, opts, 9)
+	for _, o := range opts {
+		switch v := o.(type) {
+		case *CMP:
+		case proofOfPossessionVerified:
+		case *provisionerExtensionOption:
+			assert.Equal(t, TypeCMP, v.Type)
+			assert.Equal(t, "cmp", v.Name)
+		case *forceCNOption:
+		case profileDefaultDuration:
+		case publicKeyMinimumLengthValidator:
+			assert.Equal(t, 2048, v.length)
+		case *validityValidator:
+		case *x509NamePolicyValidator:
+		case *WebhookController:
+		default:
+			t.Errorf("unexpected sign option of type %T", v)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package provisioner
+
+import (
+	"crypto"
+	"crypto/subtle"
+	"crypto/x509"
+	"time"
+
+	"go.step.sm/crypto/keyutil"
+
+	"github.com/smallstep/certificates/errs"
+)
+
+// DefaultCodeSigningLeafTemplate is the template used by default to issue
+// code-signing certificates.
+const DefaultCodeSigningLeafTemplate = `{
+	"subject": {{ toJson .Subject }},
+	"sans": {{ toJson .SANs }},
+	"keyUsage": ["digitalSignature"],
+	"extKeyUsage": ["codeSigning"]
+}`
+
+// CodeSigningOptions contains the options used to issue code-signing
+// certificates.
+type CodeSigningOptions struct {
+	// MaxDuration is the maximum validity of a code-signing certificate. If
+	// not set, the maximum duration of the provisioner is used.
+	MaxDuration *Duration `json:"maxDuration,omitempty"`
+
+	// RequireAttestation requires a proof that the key is stored in a hardware
+	// device, like a YubiKey or a TPM, before issuing the certificate. With
+	// ACME, this requires a valid device-attest-01 challenge. Other
+	// provisioners cannot attest keys, and they cannot issue code-signing
+	// certificates if it is set.
+	RequireAttestation bool `json:"requireAttestation,omitempty"`
+}
+
+// GetCodeSigningOptions returns the code-signing options.
+func (o *Options) GetCodeSigningOptions() *CodeSigningOptions {
+	if o == nil {
+		return nil
+	}
+	return o.CodeSigning
+}
+
+// IsAttestationRequired returns true if the code-signing profile requires an
+// attested key.
+func (o *CodeSigningOptions) IsAttestationRequired() bool {
+	return o != nil && o.RequireAttestation
+}
+
+// newCodeSigningOptions returns the sign options that enforce the
+// code-signing profile. The maximum duration of the certificate is the
+// lower value of the configured one and the given default.
+func newCodeSigningOptions(o *CodeSigningOptions, maxDur time.Duration) []SignOption {
+	if o.MaxDuration != nil && o.MaxDuration.Duration > 0 && o.MaxDuration.Duration < maxDur {
+		maxDur = o.MaxDuration.Duration
+	}
+	opts := []SignOption{
+		codeSigningProfileModifier{},
+		newValidityValidator(0, maxDur),
+	}
+	if o.IsAttestationRequired() {
+		opts = append(opts, attestedKeyValidator{})
+	}
+	return opts
+}
+
+// attestedKeyValidator is an AttestationValidator that requires the key in the
+// certificate request to be the attested key.
+type attestedKeyValidator struct{}
+
+// ValidAttestation validates that the key in the certificate request has been
+// attested.
+func (attestedKeyValidator) ValidAttestation(att *AttestationData, csr *x509.CertificateRequest) error {
+	return ValidateAttestedKey(att, csr.PublicKey)
+}
+
+// ValidateAttestedKey returns an error if the given attestation data does not
+// attest the given public key.
+func ValidateAttestedKey(att *AttestationData, pub crypto.PublicKey) error {
+	if att == nil || att.Fingerprint == "" {
+		return errs.Forbidden("certificate requires an attested key")
+	}
+	fp, err := keyutil.Fingerprint(pub)
+	if err != nil {
+		return errs.BadRequestErr(err, "error calculating key fingerprint")
+	}
+	if subtle.ConstantTimeCompare([]byte(att.Fingerprint), []byte(fp)) == 0 {
+		return errs.Forbidden("certificate request key does not match the attested key")
+	}
+	return nil
+}
+
+// codeSigningProfileModifier is a CertificateModifier that sets the key usage
+// and extended key usage of a code-signing certificate.
+type codeSigningProfileModifier struct{}
+
+// Modify restricts the certificate to be used only to sign code.
+func (codeSigningProfileModifier) Modify(cert *x509.Certificate, _ SignOptions) error {
+	cert.KeyUsage = x509.KeyUsageDigitalSignature
+	cert.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning}
+	cert.UnknownExtKeyUsage = nil
+	return nil
+}
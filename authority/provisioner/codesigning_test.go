@@ -0,0 +1,91 @@
+package provisioner
+
+import (
+	"crypto/x509"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.step.sm/crypto/keyutil"
+)
+
+func TestCodeSigningOptions_IsAttestationRequired(t *testing.T) {
+	var nilOptions *CodeSigningOptions
+	assert.False(t, nilOptions.IsAttestationRequired())
+	assert.False(t, (&CodeSigningOptions{}).IsAttestationRequired())
+	assert.True(t, (&CodeSigningOptions{RequireAttestation: true}).IsAttestationRequired())
+}
+
+func Test_newCodeSigningOptions(t *testing.T) {
+	tests := []struct {
+		name    string
+		options *CodeSigningOptions
+		maxDur  time.Duration
+		want    []SignOption
+	}{
+		{"ok", &CodeSigningOptions{}, 24 * time.Hour, []SignOption{
+			codeSigningProfileModifier{}, newValidityValidator(0, 24*time.Hour),
+		}},
+		{"ok/maxDuration", &CodeSigningOptions{MaxDuration: &Duration{Duration: time.Hour}}, 24 * time.Hour, []SignOption{
+			codeSigningProfileModifier{}, newValidityValidator(0, time.Hour),
+		}},
+		{"ok/maxDuration-greater", &CodeSigningOptions{MaxDuration: &Duration{Duration: 48 * time.Hour}}, 24 * time.Hour, []SignOption{
+			codeSigningProfileModifier{}, newValidityValidator(0, 24*time.Hour),
+		}},
+		{"ok/requireAttestation", &CodeSigningOptions{RequireAttestation: true}, 24 * time.Hour, []SignOption{
+			codeSigningProfileModifier{}, newValidityValidator(0, 24*time.Hour), attestedKeyValidator{},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, newCodeSigningOptions(tt.options, tt.maxDur))
+		})
+	}
+}
+
+func Test_codeSigningProfileModifier_Modify(t *testing.T) {
+	cert := &x509.Certificate{
+		KeyUsage:           x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:        []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		UnknownExtKeyUsage: nil,
+	}
+	assert.NoError(t, codeSigningProfileModifier{}.Modify(cert, SignOptions{}))
+	assert.Equal(t, &x509.Certificate{
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+	}, cert)
+}
+
+func Test_attestedKeyValidator_ValidAttestation(t *testing.T) {
+	key, err := keyutil.GenerateDefaultSigner()
+	require.NoError(t, err)
+	otherKey, err := keyutil.GenerateDefaultSigner()
+	require.NoError(t, err)
+	csr := &x509.CertificateRequest{PublicKey: key.Public()}
+	other := &x509.CertificateRequest{PublicKey: otherKey.Public()}
+	fp, err := keyutil.Fingerprint(csr.PublicKey)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		att     *AttestationData
+		csr     *x509.CertificateRequest
+		wantErr bool
+	}{
+		{"ok", &AttestationData{PermanentIdentifier: "1234", Fingerprint: fp}, csr, false},
+		{"fail/nil", nil, csr, true},
+		{"fail/fingerprint", &AttestationData{PermanentIdentifier: "1234"}, csr, true},
+		{"fail/key", &AttestationData{PermanentIdentifier: "1234", Fingerprint: fp}, other, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := attestedKeyValidator{}.ValidAttestation(tt.att, tt.csr)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
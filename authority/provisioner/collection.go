@@ -42,6 +42,21 @@ type loadByTokenPayload struct {
 	TenantID        string `json:"tid"`   // Microsoft Azure tenant id
 }
 
+// tokenIDsGetter is implemented by provisioners that can be loaded by more
+// than one token identifier, e.g., a JWK provisioner with multiple keys.
+type tokenIDsGetter interface {
+	GetIDsForToken() []string
+}
+
+// getIDsForToken returns all the token identifiers of a provisioner.
+func getIDsForToken(p Interface) []string {
+	ids := []string{p.GetIDForToken()}
+	if g, ok := p.(tokenIDsGetter); ok {
+		ids = append(ids, g.GetIDsForToken()...)
+	}
+	return ids
+}
+
 // Collection is a memory map of provisioners.
 type Collection struct {
 	byID      *sync.Map
@@ -192,11 +207,17 @@ func (c *Collection) Store(p Interface) error {
 			"cannot add multiple provisioners with the same name")
 	}
 	// Store provisioner always by ID presented in token.
-	if _, loaded := c.byTokenID.LoadOrStore(p.GetIDForToken(), p); loaded {
-		c.byID.Delete(p.GetID())
-		c.byName.Delete(p.GetName())
-		return admin.NewError(admin.ErrorBadRequestType,
-			"cannot add multiple provisioners with the same token identifier")
+	tokenIDs := getIDsForToken(p)
+	for i, id := range tokenIDs {
+		if _, loaded := c.byTokenID.LoadOrStore(id, p); loaded {
+			c.byID.Delete(p.GetID())
+			c.byName.Delete(p.GetName())
+			for _, stored := range tokenIDs[:i] {
+				c.byTokenID.Delete(stored)
+			}
+			return admin.NewError(admin.ErrorBadRequestType,
+				"cannot add multiple provisioners with the same token identifier")
+		}
 	}
 
 	// Store provisioner in byKey if EncryptedKey is defined.
@@ -245,7 +266,9 @@ func (c *Collection) Remove(id string) error {
 
 	c.byID.Delete(id)
 	c.byName.Delete(prov.GetName())
-	c.byTokenID.Delete(prov.GetIDForToken())
+	for _, tokenID := range getIDsForToken(prov) {
+		c.byTokenID.Delete(tokenID)
+	}
 	if kid, _, ok := prov.GetEncryptedKey(); ok {
 		c.byKey.Delete(kid)
 	}
@@ -266,10 +289,10 @@ func (c *Collection) Update(nu Interface) error {
 				"provisioner with name %s already exists", nu.GetName())
 		}
 	}
-	if old.GetIDForToken() != nu.GetIDForToken() {
-		if _, ok := c.LoadByTokenID(nu.GetIDForToken()); ok {
+	for _, tokenID := range getIDsForToken(nu) {
+		if p, ok := c.LoadByTokenID(tokenID); ok && p.GetID() != old.GetID() {
 			return admin.NewError(admin.ErrorBadRequestType,
-				"provisioner with Token ID %s already exists", nu.GetIDForToken())
+				"provisioner with Token ID %s already exists", tokenID)
 		}
 	}
 
@@ -295,6 +295,37 @@ func TestCollection_Store(t *testing.T) {
 	}
 }
 
+func TestCollection_Store_multipleKeys(t *testing.T) {
+	c := NewCollection(testAudiences)
+	p1, err := generateJWK()
+	assert.FatalError(t, err)
+	key, err := generateJSONWebKey()
+	assert.FatalError(t, err)
+	pub := key.Public()
+	p1.Keys = []*jose.JSONWebKey{&pub}
+	assert.FatalError(t, c.Store(p1))
+
+	p, ok := c.LoadByTokenID(p1.Name + ":" + pub.KeyID)
+	assert.True(t, ok)
+	assert.Equals(t, p1, p)
+
+	// Replace the additional key.
+	p2 := *p1
+	p2.Keys = []*jose.JSONWebKey{{KeyID: "other"}}
+	assert.FatalError(t, c.Update(&p2))
+	_, ok = c.LoadByTokenID(p1.Name + ":" + pub.KeyID)
+	assert.False(t, ok)
+	p, ok = c.LoadByTokenID(p1.Name + ":other")
+	assert.True(t, ok)
+	assert.Equals(t, &p2, p)
+
+	assert.FatalError(t, c.Remove(p2.GetID()))
+	_, ok = c.LoadByTokenID(p1.Name + ":other")
+	assert.False(t, ok)
+	_, ok = c.LoadByTokenID(p1.GetIDForToken())
+	assert.False(t, ok)
+}
+
 func TestCollection_Find(t *testing.T) {
 	c, err := generateCollection(10, 10)
 	assert.FatalError(t, err)
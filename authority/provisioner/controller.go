@@ -4,12 +4,15 @@ import (
 	"context"
 	"crypto/x509"
 	"net/http"
+	"slices"
 	"strings"
 	"time"
 
 	"github.com/pkg/errors"
 	"github.com/smallstep/certificates/errs"
 	"github.com/smallstep/certificates/webhook"
+	"go.step.sm/crypto/sshutil"
+	"go.step.sm/crypto/x509util"
 	"go.step.sm/linkedca"
 	"golang.org/x/crypto/ssh"
 )
@@ -39,6 +42,15 @@ func NewController(p Interface, claims *Claims, config Config, options *Options)
 	if err != nil {
 		return nil, err
 	}
+	if err := options.GetVPNOptions().Validate(); err != nil {
+		return nil, err
+	}
+	if err := options.GetRateLimitOptions().Validate(); err != nil {
+		return nil, err
+	}
+	if err := validateSMIMEOptions(p.GetType(), options.GetSMIMEOptions()); err != nil {
+		return nil, err
+	}
 	return &Controller{
 		Interface:             p,
 		Audiences:             &config.Audiences,
@@ -70,22 +82,114 @@ func (c *Controller) GetIdentity(ctx context.Context, email string) (*Identity,
 	return DefaultIdentityFunc(ctx, c.Interface, email)
 }
 
+// AuthorizeIssuance returns an error if the provisioner cannot be used to issue
+// new certificates, this is, if its state is renew-only or disabled.
+func (c *Controller) AuthorizeIssuance() error {
+	switch c.Claimer.State() {
+	case StateRenewOnly:
+		return stateError("provisioner '%s' is in renew-only mode and cannot issue new certificates", c.GetName())
+	case StateDisabled:
+		return stateError("provisioner '%s' is disabled", c.GetName())
+	default:
+		return nil
+	}
+}
+
+// authorizeRenewal returns an error if the provisioner cannot be used to renew
+// certificates, this is, if its state is disabled.
+func (c *Controller) authorizeRenewal() error {
+	if c.Claimer.State() == StateDisabled {
+		return stateError("provisioner '%s' is disabled", c.GetName())
+	}
+	return nil
+}
+
+// stateError returns an unauthorized error with a message that is also
+// returned to the client, so the reason of the rejection is clear.
+func stateError(format, name string) error {
+	return errs.Unauthorized(format, name, errs.WithMessage(format, name))
+}
+
 // AuthorizeRenew returns nil if the given cert can be renewed, returns an error
 // otherwise.
 func (c *Controller) AuthorizeRenew(ctx context.Context, cert *x509.Certificate) error {
+	if err := c.authorizeRenewal(); err != nil {
+		return err
+	}
 	if c.AuthorizeRenewFunc != nil {
-		return c.AuthorizeRenewFunc(ctx, c, cert)
+		if err := c.AuthorizeRenewFunc(ctx, c, cert); err != nil {
+			return err
+		}
+	} else if err := DefaultAuthorizeRenew(ctx, c, cert); err != nil {
+		return err
 	}
-	return DefaultAuthorizeRenew(ctx, c, cert)
+	return c.authorizeRenewWebhooks(ctx, linkedca.Webhook_X509, func(rb *webhook.RequestBody) error {
+		crt, err := x509util.NewCertificateFromX509(cert)
+		if err != nil {
+			return err
+		}
+		return webhook.WithX509Certificate(crt, cert)(rb)
+	})
 }
 
 // AuthorizeSSHRenew returns nil if the given cert can be renewed, returns an
 // error otherwise.
 func (c *Controller) AuthorizeSSHRenew(ctx context.Context, cert *ssh.Certificate) error {
+	if err := c.authorizeRenewal(); err != nil {
+		return err
+	}
 	if c.AuthorizeSSHRenewFunc != nil {
-		return c.AuthorizeSSHRenewFunc(ctx, c, cert)
+		if err := c.AuthorizeSSHRenewFunc(ctx, c, cert); err != nil {
+			return err
+		}
+	} else if err := DefaultAuthorizeSSHRenew(ctx, c, cert); err != nil {
+		return err
+	}
+	return c.authorizeRenewWebhooks(ctx, linkedca.Webhook_SSH,
+		webhook.WithSSHCertificate(newSSHCertificate(cert), cert),
+	)
+}
+
+// authorizeRenewWebhooks calls the authorizing webhooks of the provisioner with
+// the certificate to renew.
+func (c *Controller) authorizeRenewWebhooks(ctx context.Context, certType linkedca.Webhook_CertType, opt webhook.RequestBodyOption) error {
+	if !slices.ContainsFunc(c.webhooks, func(wh *Webhook) bool {
+		return wh.Kind == linkedca.Webhook_AUTHORIZING.String()
+	}) {
+		return nil
+	}
+	req, err := webhook.NewRequestBody(webhook.WithOperation(webhook.OperationRenew), opt)
+	if err != nil {
+		return errs.Wrap(http.StatusInternalServerError, err, "error creating webhook request")
+	}
+	if err := c.newWebhookController(nil, certType).Authorize(ctx, req); err != nil {
+		return errs.ForbiddenErr(err, "renewal not authorized by webhook")
+	}
+	return nil
+}
+
+// newSSHCertificate returns the sshutil.Certificate representation of the
+// given SSH certificate sent to webhooks.
+func newSSHCertificate(cert *ssh.Certificate) *sshutil.Certificate {
+	certType := sshutil.UserCert
+	if cert.CertType == ssh.HostCert {
+		certType = sshutil.HostCert
+	}
+	return &sshutil.Certificate{
+		Nonce:           cert.Nonce,
+		Key:             cert.Key,
+		Serial:          cert.Serial,
+		Type:            certType,
+		KeyID:           cert.KeyId,
+		Principals:      cert.ValidPrincipals,
+		ValidAfter:      time.Unix(int64(cert.ValidAfter), 0),  //nolint:gosec // validated before
+		ValidBefore:     time.Unix(int64(cert.ValidBefore), 0), //nolint:gosec // validated before
+		CriticalOptions: cert.CriticalOptions,
+		Extensions:      cert.Extensions,
+		Reserved:        cert.Reserved,
+		SignatureKey:    cert.SignatureKey,
+		Signature:       cert.Signature,
 	}
-	return DefaultAuthorizeSSHRenew(ctx, c, cert)
 }
 
 func (c *Controller) newWebhookController(templateData WebhookSetter, certType linkedca.Webhook_CertType, opts ...webhook.RequestBodyOption) *WebhookController {
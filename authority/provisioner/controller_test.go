@@ -3,15 +3,20 @@ package provisioner
 import (
 	"context"
 	"crypto/x509"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"net/http/httptest"
 	"reflect"
 	"testing"
 	"time"
 
+	"github.com/smallstep/certificates/api/render"
 	"github.com/smallstep/certificates/authority/policy"
 	"github.com/smallstep/certificates/webhook"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"go.step.sm/crypto/pemutil"
 	"go.step.sm/crypto/x509util"
 	"go.step.sm/linkedca"
@@ -120,6 +125,12 @@ func TestNewController(t *testing.T) {
 			Claims:    globalProvisionerClaims,
 			Audiences: testAudiences,
 		}, nil}, nil, true},
+		{"fail smime options", args{&JWK{}, nil, Config{
+			Claims:    globalProvisionerClaims,
+			Audiences: testAudiences,
+		}, &Options{
+			SMIME: &SMIMEOptions{},
+		}}, nil, true},
 		{"fail options", args{&JWK{}, &Claims{
 			DisableRenewal: &defaultDisableRenewal,
 		}, Config{
@@ -225,6 +236,37 @@ func TestController_GetIdentity(t *testing.T) {
 	}
 }
 
+func TestController_AuthorizeIssuance(t *testing.T) {
+	tests := []struct {
+		name    string
+		claimer *Claimer
+		wantErr bool
+	}{
+		{"ok", mustClaimer(t, nil, globalProvisionerClaims), false},
+		{"ok active", mustClaimer(t, &Claims{State: StateActive}, globalProvisionerClaims), false},
+		{"fail renew-only", mustClaimer(t, &Claims{State: StateRenewOnly}, globalProvisionerClaims), true},
+		{"fail disabled", mustClaimer(t, &Claims{State: StateDisabled}, globalProvisionerClaims), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Controller{
+				Interface: &JWK{Name: "jwk"},
+				Claimer:   tt.claimer,
+			}
+			err := c.AuthorizeIssuance()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Controller.AuthorizeIssuance() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				var sc render.StatusCodedError
+				if assert.True(t, errors.As(err, &sc)) {
+					assert.Equal(t, http.StatusUnauthorized, sc.StatusCode())
+				}
+			}
+		})
+	}
+}
+
 func TestController_AuthorizeRenew(t *testing.T) {
 	ctx := context.Background()
 	now := time.Now().Truncate(time.Second)
@@ -267,6 +309,16 @@ func TestController_AuthorizeRenew(t *testing.T) {
 			NotBefore: now,
 			NotAfter:  now.Add(time.Hour),
 		}}, true},
+		{"ok renew-only", fields{&JWK{}, mustClaimer(t, &Claims{State: StateRenewOnly}, globalProvisionerClaims), nil}, args{ctx, &x509.Certificate{
+			NotBefore: now,
+			NotAfter:  now.Add(time.Hour),
+		}}, false},
+		{"fail state disabled", fields{&JWK{}, mustClaimer(t, &Claims{State: StateDisabled}, globalProvisionerClaims), func(ctx context.Context, p *Controller, cert *x509.Certificate) error {
+			return nil
+		}}, args{ctx, &x509.Certificate{
+			NotBefore: now,
+			NotAfter:  now.Add(time.Hour),
+		}}, true},
 		{"fail not yet valid", fields{&JWK{}, mustClaimer(t, nil, globalProvisionerClaims), nil}, args{ctx, &x509.Certificate{
 			NotBefore: now.Add(time.Hour),
 			NotAfter:  now.Add(2 * time.Hour),
@@ -338,6 +390,16 @@ func TestController_AuthorizeSSHRenew(t *testing.T) {
 			ValidAfter:  uint64(now.Unix()),
 			ValidBefore: uint64(now.Add(time.Hour).Unix()),
 		}}, true},
+		{"ok renew-only", fields{&JWK{}, mustClaimer(t, &Claims{State: StateRenewOnly}, globalProvisionerClaims), nil}, args{ctx, &ssh.Certificate{
+			ValidAfter:  uint64(now.Unix()),
+			ValidBefore: uint64(now.Add(time.Hour).Unix()),
+		}}, false},
+		{"fail state disabled", fields{&JWK{}, mustClaimer(t, &Claims{State: StateDisabled}, globalProvisionerClaims), func(ctx context.Context, p *Controller, cert *ssh.Certificate) error {
+			return nil
+		}}, args{ctx, &ssh.Certificate{
+			ValidAfter:  uint64(now.Unix()),
+			ValidBefore: uint64(now.Add(time.Hour).Unix()),
+		}}, true},
 		{"fail not yet valid", fields{&JWK{}, mustClaimer(t, nil, globalProvisionerClaims), nil}, args{ctx, &ssh.Certificate{
 			ValidAfter:  uint64(now.Add(time.Hour).Unix()),
 			ValidBefore: uint64(now.Add(2 * time.Hour).Unix()),
@@ -367,6 +429,70 @@ func TestController_AuthorizeSSHRenew(t *testing.T) {
 	}
 }
 
+func TestController_AuthorizeRenew_webhooks(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	cert, err := pemutil.ReadCertificate("testdata/certs/foo.crt")
+	require.NoError(t, err)
+	cert.NotBefore, cert.NotAfter = now, now.Add(time.Hour)
+	pub, err := pemutil.Read("testdata/certs/foo.pub")
+	require.NoError(t, err)
+	sshPub, err := ssh.NewPublicKey(pub)
+	require.NoError(t, err)
+	sshCert := &ssh.Certificate{
+		Key:             sshPub,
+		CertType:        ssh.HostCert,
+		KeyId:           "foo.example.com",
+		ValidPrincipals: []string{"foo.example.com"},
+		ValidAfter:      uint64(now.Unix()),
+		ValidBefore:     uint64(now.Add(time.Hour).Unix()),
+	}
+
+	tests := []struct {
+		name    string
+		kind    string
+		allow   bool
+		wantErr bool
+	}{
+		{"ok", "AUTHORIZING", true, false},
+		{"ok enriching", "ENRICHING", false, false},
+		{"fail denied", "AUTHORIZING", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls []*webhook.RequestBody
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				req := new(webhook.RequestBody)
+				require.NoError(t, json.NewDecoder(r.Body).Decode(req))
+				calls = append(calls, req)
+				require.NoError(t, json.NewEncoder(w).Encode(webhook.ResponseBody{Allow: tt.allow}))
+			}))
+			defer ts.Close()
+
+			c := &Controller{
+				Interface: &JWK{},
+				Claimer:   mustClaimer(t, nil, globalProvisionerClaims),
+				webhooks: []*Webhook{{
+					Name: "inventory", Kind: tt.kind, URL: ts.URL,
+				}},
+			}
+			err := c.AuthorizeRenew(context.Background(), cert)
+			assert.Equal(t, tt.wantErr, err != nil)
+			err = c.AuthorizeSSHRenew(context.Background(), sshCert)
+			assert.Equal(t, tt.wantErr, err != nil)
+
+			if tt.kind == "AUTHORIZING" {
+				require.Len(t, calls, 2)
+				assert.Equal(t, webhook.OperationRenew, calls[0].Operation)
+				assert.Equal(t, x509util.MultiString(cert.DNSNames), calls[0].X509Certificate.DNSNames)
+				assert.Equal(t, webhook.OperationRenew, calls[1].Operation)
+				assert.Equal(t, sshCert.ValidPrincipals, calls[1].SSHCertificate.Principals)
+			} else {
+				assert.Empty(t, calls)
+			}
+		})
+	}
+}
+
 func TestDefaultAuthorizeRenew(t *testing.T) {
 	ctx := context.Background()
 	now := time.Now().Truncate(time.Second)
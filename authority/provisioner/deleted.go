@@ -0,0 +1,73 @@
+package provisioner
+
+import (
+	"context"
+	"crypto/x509"
+	"time"
+
+	"github.com/smallstep/certificates/errs"
+)
+
+// Deleted represents a provisioner that no longer exists. It's used to renew
+// the certificates signed by the deleted provisioner until the sunset date of
+// its renewal policy. All the other operations are denied.
+type Deleted struct {
+	*base
+	Name     string
+	Type     Type
+	SunsetAt time.Time
+}
+
+// NewDeleted returns a provisioner representing the deleted provisioner in
+// the given extension, that allows renewals until the given time.
+func NewDeleted(ext *Extension, sunsetAt time.Time) *Deleted {
+	return &Deleted{
+		base:     &base{},
+		Name:     ext.Name,
+		Type:     ext.Type,
+		SunsetAt: sunsetAt,
+	}
+}
+
+// GetID returns the provisioner name, deleted provisioners do not have an id.
+func (p *Deleted) GetID() string {
+	return p.Name
+}
+
+// GetIDForToken returns the provisioner name.
+func (p *Deleted) GetIDForToken() string {
+	return p.Name
+}
+
+// GetTokenID returns an empty id, deleted provisioners do not accept tokens.
+func (p *Deleted) GetTokenID(string) (string, error) {
+	return "", nil
+}
+
+// GetName returns the name of the deleted provisioner.
+func (p *Deleted) GetName() string {
+	return p.Name
+}
+
+// GetType returns the type of the deleted provisioner.
+func (p *Deleted) GetType() Type {
+	return p.Type
+}
+
+// GetEncryptedKey returns false, deleted provisioners do not have keys.
+func (p *Deleted) GetEncryptedKey() (kid, key string, ok bool) {
+	return "", "", false
+}
+
+// Init does nothing.
+func (p *Deleted) Init(Config) error {
+	return nil
+}
+
+// AuthorizeRenew returns an error if the sunset date has passed.
+func (p *Deleted) AuthorizeRenew(_ context.Context, _ *x509.Certificate) error {
+	if !time.Now().Before(p.SunsetAt) {
+		return errs.Unauthorized("renewal of certificates of deleted provisioner '%s' ended on %s", p.Name, p.SunsetAt.Format(time.RFC3339))
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package provisioner
+
+import (
+	"context"
+	"crypto/x509"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeleted(t *testing.T) {
+	p := NewDeleted(&Extension{Type: TypeJWK, Name: "deleted", CredentialID: "kid"}, time.Now().Add(time.Hour))
+	assert.Equal(t, "deleted", p.GetID())
+	assert.Equal(t, "deleted", p.GetIDForToken())
+	assert.Equal(t, "deleted", p.GetName())
+	assert.Equal(t, TypeJWK, p.GetType())
+	_, _, ok := p.GetEncryptedKey()
+	assert.False(t, ok)
+	assert.NoError(t, p.Init(Config{}))
+
+	ctx := context.Background()
+	assert.NoError(t, p.AuthorizeRenew(ctx, &x509.Certificate{}))
+
+	// Other operations are not allowed.
+	_, err := p.AuthorizeSign(ctx, "token")
+	assert.Error(t, err)
+	assert.Error(t, p.AuthorizeRevoke(ctx, "token"))
+	_, err = p.AuthorizeSSHSign(ctx, "token")
+	assert.Error(t, err)
+	_, err = p.AuthorizeSSHRenew(ctx, "token")
+	assert.Error(t, err)
+
+	p.SunsetAt = time.Now().Add(-time.Minute)
+	assert.Error(t, p.AuthorizeRenew(ctx, &x509.Certificate{}))
+}
@@ -0,0 +1,95 @@
+package provisioner
+
+import (
+	"net"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DNS01Options contains the options used by ACME provisioners to validate
+// dns-01 challenges.
+type DNS01Options struct {
+	// Resolvers is the list of recursive resolvers, in the form host[:port],
+	// used to look up the TXT records. If empty, the system resolvers are
+	// used.
+	Resolvers []string `json:"resolvers,omitempty"`
+	// PropagationCheck requires the TXT record to be present in all the
+	// authoritative name servers of the zone before validating the challenge.
+	PropagationCheck bool `json:"propagationCheck,omitempty"`
+	// Timeout is the maximum time to wait for a DNS response. It defaults to
+	// 10s.
+	Timeout *Duration `json:"timeout,omitempty"`
+}
+
+// GetDNS01Options returns the dns-01 options.
+func (o *Options) GetDNS01Options() *DNS01Options {
+	if o == nil {
+		return nil
+	}
+	return o.DNS01
+}
+
+// Validate validates the dns-01 options.
+func (o *DNS01Options) Validate() error {
+	if o == nil {
+		return nil
+	}
+	for _, r := range o.Resolvers {
+		if _, err := o.resolverAddress(r); err != nil {
+			return err
+		}
+	}
+	if o.Timeout != nil && o.Timeout.Duration < 0 {
+		return errors.New("dns01 timeout cannot be negative")
+	}
+	return nil
+}
+
+// GetResolvers returns the addresses of the configured resolvers. If a
+// resolver does not have a port, the default DNS port is used.
+func (o *DNS01Options) GetResolvers() []string {
+	if o == nil {
+		return nil
+	}
+	addrs := make([]string, 0, len(o.Resolvers))
+	for _, r := range o.Resolvers {
+		if addr, err := o.resolverAddress(r); err == nil {
+			addrs = append(addrs, addr)
+		}
+	}
+	return addrs
+}
+
+// IsPropagationCheck returns true if the TXT records must be present in all
+// the authoritative name servers.
+func (o *DNS01Options) IsPropagationCheck() bool {
+	return o != nil && o.PropagationCheck
+}
+
+// GetTimeout returns the timeout of the DNS queries.
+func (o *DNS01Options) GetTimeout() time.Duration {
+	if o == nil || o.Timeout == nil || o.Timeout.Duration == 0 {
+		return 10 * time.Second
+	}
+	return o.Timeout.Duration
+}
+
+func (o *DNS01Options) resolverAddress(s string) (string, error) {
+	if s == "" {
+		return "", errors.New("dns01 resolver cannot be empty")
+	}
+	host, port, err := net.SplitHostPort(s)
+	if err != nil {
+		// Address without a port, IPv6 addresses might be enclosed in
+		// brackets.
+		host, port = s, "53"
+		if len(host) > 2 && host[0] == '[' && host[len(host)-1] == ']' {
+			host = host[1 : len(host)-1]
+		}
+	}
+	if host == "" || port == "" {
+		return "", errors.Errorf("dns01 resolver %q is not valid", s)
+	}
+	return net.JoinHostPort(host, port), nil
+}
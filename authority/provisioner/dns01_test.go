@@ -0,0 +1,50 @@
+package provisioner
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDNS01Options_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    *DNS01Options
+		wantErr bool
+	}{
+		{"ok/nil", nil, false},
+		{"ok/empty", &DNS01Options{}, false},
+		{"ok/resolvers", &DNS01Options{Resolvers: []string{"10.0.0.53", "10.0.1.53:5353", "[2001:db8::53]", "dns.internal"}}, false},
+		{"ok/timeout", &DNS01Options{Timeout: &Duration{Duration: time.Second}}, false},
+		{"fail/empty-resolver", &DNS01Options{Resolvers: []string{""}}, true},
+		{"fail/empty-port", &DNS01Options{Resolvers: []string{"10.0.0.53:"}}, true},
+		{"fail/negative-timeout", &DNS01Options{Timeout: &Duration{Duration: -time.Second}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.wantErr {
+				assert.Error(t, tt.opts.Validate())
+			} else {
+				assert.NoError(t, tt.opts.Validate())
+			}
+		})
+	}
+}
+
+func TestDNS01Options_getters(t *testing.T) {
+	var o *Options
+	assert.Nil(t, o.GetDNS01Options())
+	assert.Nil(t, o.GetDNS01Options().GetResolvers())
+	assert.False(t, o.GetDNS01Options().IsPropagationCheck())
+	assert.Equal(t, 10*time.Second, o.GetDNS01Options().GetTimeout())
+
+	o = &Options{DNS01: &DNS01Options{
+		Resolvers:        []string{"10.0.0.53", "10.0.1.53:5353", "[2001:db8::53]"},
+		PropagationCheck: true,
+		Timeout:          &Duration{Duration: 5 * time.Second},
+	}}
+	assert.Equal(t, []string{"10.0.0.53:53", "10.0.1.53:5353", "[2001:db8::53]:53"}, o.GetDNS01Options().GetResolvers())
+	assert.True(t, o.GetDNS01Options().IsPropagationCheck())
+	assert.Equal(t, 5*time.Second, o.GetDNS01Options().GetTimeout())
+}
@@ -0,0 +1,260 @@
+package provisioner
+
+import (
+	"context"
+	"crypto"
+	"crypto/subtle"
+	"crypto/x509"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"go.step.sm/crypto/keyutil"
+	"go.step.sm/linkedca"
+)
+
+// EST is the provisioner used by the EST (RFC 7030) endpoints. EST clients
+// authenticate the enrollment requests using HTTP Basic authentication or a
+// TLS client certificate issued by the CA, and re-enroll using the
+// certificate to renew.
+type EST struct {
+	*base
+	ID      string `json:"-"`
+	Type    string `json:"type"`
+	Name    string `json:"name"`
+	ForceCN bool   `json:"forceCN,omitempty"`
+	// BasicAuth enables HTTP Basic authentication with the given credentials.
+	BasicAuth *ESTBasicAuth `json:"basicAuth,omitempty"`
+	// ClientCertificates enables the authentication of enrollment requests
+	// using a TLS client certificate issued by the CA, e.g., a manufacturer
+	// installed certificate. The certificates must chain to one of the PEM
+	// encoded ClientCertificateRoots, or must have been issued by one of the
+	// ClientCertificateProvisioners, and the requests can only contain the
+	// subject and names in the certificate.
+	ClientCertificates            bool     `json:"clientCertificates,omitempty"`
+	ClientCertificateRoots        []byte   `json:"clientCertificateRoots,omitempty"`
+	ClientCertificateProvisioners []string `json:"clientCertificateProvisioners,omitempty"`
+	// ServerKeyGen enables the serverkeygen operation, where the CA generates
+	// the private key of the certificate.
+	ServerKeyGen *ESTServerKeyGenOptions `json:"serverKeyGen,omitempty"`
+	// MinimumPublicKeyLength is the minimum length for public keys in CSRs.
+	MinimumPublicKeyLength int      `json:"minimumPublicKeyLength,omitempty"`
+	Claims                 *Claims  `json:"claims,omitempty"`
+	Options                *Options `json:"options,omitempty"`
+	ctl                    *Controller
+	clientCertificateTrust *clientCertificateTrust
+}
+
+// ESTBasicAuth are the credentials used by EST clients with HTTP Basic
+// authentication.
+type ESTBasicAuth struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// ESTServerKeyGenOptions are the options of the keys generated by the CA in
+// the serverkeygen operation.
+type ESTServerKeyGenOptions struct {
+	// KeyType is the type of the key, EC, RSA or OKP. Defaults to EC.
+	KeyType string `json:"keyType,omitempty"`
+	// KeyCurve is the curve of EC and OKP keys. Defaults to P-256 and
+	// Ed25519.
+	KeyCurve string `json:"keyCurve,omitempty"`
+	// KeySize is the size of RSA keys. Defaults to 2048.
+	KeySize int `json:"keySize,omitempty"`
+}
+
+// Validate returns an error if the key options are not valid.
+func (o *ESTServerKeyGenOptions) Validate() error {
+	if o == nil {
+		return nil
+	}
+	switch o.KeyType {
+	case "", "EC", "OKP":
+		if o.KeySize != 0 {
+			return errors.New("est serverKeyGen keySize can only be used with RSA keys")
+		}
+	case "RSA":
+		if o.KeyCurve != "" {
+			return errors.New("est serverKeyGen keyCurve cannot be used with RSA keys")
+		}
+		if o.KeySize != 0 && o.KeySize < 2048 {
+			return errors.Errorf("est serverKeyGen keySize %d must be at least 2048", o.KeySize)
+		}
+	default:
+		return errors.Errorf("est serverKeyGen keyType %q is not supported", o.KeyType)
+	}
+	return nil
+}
+
+// GenerateKey generates a new key with the configured options.
+func (o *ESTServerKeyGenOptions) GenerateKey() (crypto.Signer, error) {
+	kty, crv, size := "EC", "P-256", 0
+	if o != nil {
+		switch o.KeyType {
+		case "RSA":
+			kty, crv, size = "RSA", "", 2048
+			if o.KeySize != 0 {
+				size = o.KeySize
+			}
+		case "OKP":
+			kty, crv = "OKP", "Ed25519"
+		}
+		if o.KeyCurve != "" {
+			crv = o.KeyCurve
+		}
+	}
+	key, err := keyutil.GenerateSigner(kty, crv, size)
+	if err != nil {
+		return nil, errors.Wrap(err, "error generating key")
+	}
+	return key, nil
+}
+
+// GetID returns the provisioner unique identifier.
+func (p *EST) GetID() string {
+	if p.ID != "" {
+		return p.ID
+	}
+	return p.GetIDForToken()
+}
+
+// GetIDForToken returns an identifier that will be used to load the provisioner
+// from a token.
+func (p *EST) GetIDForToken() string {
+	return "est/" + p.Name
+}
+
+// GetName returns the name of the provisioner.
+func (p *EST) GetName() string {
+	return p.Name
+}
+
+// GetType returns the type of provisioner.
+func (p *EST) GetType() Type {
+	return TypeEST
+}
+
+// GetEncryptedKey returns the base provisioner encrypted key if it's defined.
+func (p *EST) GetEncryptedKey() (string, string, bool) {
+	return "", "", false
+}
+
+// GetTokenID returns the identifier of the token.
+func (p *EST) GetTokenID(string) (string, error) {
+	return "", errors.New("est provisioner does not implement GetTokenID")
+}
+
+// GetOptions returns the configured provisioner options.
+func (p *EST) GetOptions() *Options {
+	return p.Options
+}
+
+// DefaultTLSCertDuration returns the default TLS cert duration enforced by
+// the provisioner.
+func (p *EST) DefaultTLSCertDuration() time.Duration {
+	return p.ctl.Claimer.DefaultTLSCertDuration()
+}
+
+// Init initializes and validates the fields of an EST type.
+func (p *EST) Init(config Config) (err error) {
+	switch {
+	case p.Type == "":
+		return errors.New("provisioner type cannot be empty")
+	case p.Name == "":
+		return errors.New("provisioner name cannot be empty")
+	case p.BasicAuth == nil && !p.ClientCertificates:
+		return errors.New("est provisioner must enable basicAuth or clientCertificates")
+	case p.BasicAuth != nil && (p.BasicAuth.Username == "" || p.BasicAuth.Password == ""):
+		return errors.New("est basicAuth username and password cannot be empty")
+	}
+
+	// Default to 2048 bits minimum public key length (for CSRs) if not set
+	if p.MinimumPublicKeyLength == 0 {
+		p.MinimumPublicKeyLength = 2048
+	}
+	if p.MinimumPublicKeyLength%8 != 0 {
+		return errors.Errorf("%d bits is not exactly divisible by 8", p.MinimumPublicKeyLength)
+	}
+
+	if err := p.ServerKeyGen.Validate(); err != nil {
+		return err
+	}
+
+	if p.ClientCertificates {
+		if p.clientCertificateTrust, err = newClientCertificateTrust("est", p.ClientCertificateRoots, p.ClientCertificateProvisioners); err != nil {
+			return err
+		}
+	}
+
+	p.ctl, err = NewController(p, p.Claims, config, p.Options)
+	return
+}
+
+// AuthorizeBasicAuth validates the credentials of an HTTP Basic
+// authentication.
+func (p *EST) AuthorizeBasicAuth(_ context.Context, username, password string) error {
+	if p.BasicAuth == nil {
+		return errors.Errorf("provisioner %q does not allow basic authentication", p.Name)
+	}
+	u := subtle.ConstantTimeCompare([]byte(p.BasicAuth.Username), []byte(username))
+	w := subtle.ConstantTimeCompare([]byte(p.BasicAuth.Password), []byte(password))
+	if u&w != 1 {
+		return errors.New("invalid username or password")
+	}
+	return nil
+}
+
+// AuthorizeClientCertificate validates the TLS client certificate used to
+// authenticate an enrollment request. The chains are the verified chains of
+// the certificate, and the request can only contain the subject and names in
+// the certificate.
+func (p *EST) AuthorizeClientCertificate(_ context.Context, chains [][]*x509.Certificate, csr *x509.CertificateRequest) error {
+	if !p.ClientCertificates || p.clientCertificateTrust == nil {
+		return errors.Errorf("provisioner %q does not allow client certificate authentication", p.Name)
+	}
+	return p.clientCertificateTrust.authorize(chains, csr)
+}
+
+// AuthorizeReenroll validates a simplereenroll request authenticated with the
+// given certificate, which must have been verified by the caller. The
+// certificate must have been issued by this provisioner and it must be
+// renewable, and the request must have the same subject and contain only
+// names in the certificate.
+func (p *EST) AuthorizeReenroll(ctx context.Context, csr *x509.CertificateRequest, cert *x509.Certificate) error {
+	ext, ok := GetProvisionerExtension(cert)
+	if !ok || ext.Type != TypeEST || ext.Name != p.Name {
+		return errors.Errorf("certificate was not issued by provisioner %q", p.Name)
+	}
+	if err := p.ctl.AuthorizeRenew(ctx, cert); err != nil {
+		return err
+	}
+	return checkRenewalSubject(csr, cert)
+}
+
+// IsServerKeyGenEnabled returns true if the serverkeygen operation is
+// enabled.
+func (p *EST) IsServerKeyGenEnabled() bool {
+	return p.ServerKeyGen != nil
+}
+
+// AuthorizeSign returns the list of modifiers and validators of the
+// certificates signed with an EST request. The authentication is performed
+// by the EST endpoints.
+func (p *EST) AuthorizeSign(context.Context, string) ([]SignOption, error) {
+	if err := p.ctl.AuthorizeIssuance(); err != nil {
+		return nil, err
+	}
+	return []SignOption{
+		p,
+		// modifiers / withOptions
+		newProvisionerExtensionOption(TypeEST, p.Name, "").WithControllerOptions(p.ctl),
+		newForceCNOption(p.ForceCN),
+		profileDefaultDuration(p.ctl.Claimer.DefaultTLSCertDuration()),
+		// validators
+		newPublicKeyMinimumLengthValidator(p.MinimumPublicKeyLength),
+		newClaimsValidityValidator(p.ctl.Claimer),
+		newX509NamePolicyValidator(p.ctl.getPolicy().getX509()),
+		p.ctl.newWebhookController(nil, linkedca.Webhook_X509),
+	}, nil
+}
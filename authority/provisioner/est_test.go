@@ -0,0 +1,206 @@
+package provisioner
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.step.sm/crypto/keyutil"
+	"go.step.sm/crypto/minica"
+)
+
+func generateEST(t *testing.T) *EST {
+	t.Helper()
+	p := &EST{
+		Type:                          "EST",
+		Name:                          "est",
+		BasicAuth:                     &ESTBasicAuth{Username: "user", Password: "pass"},
+		ClientCertificates:            true,
+		ClientCertificateProvisioners: []string{"manufacturing"},
+	}
+	require.NoError(t, p.Init(Config{Claims: globalProvisionerClaims}))
+	return p
+}
+
+func TestEST_Getters(t *testing.T) {
+	p := generateEST(t)
+	assert.Equal(t, "est/est", p.GetID())
+	assert.Equal(t, "est/est", p.GetIDForToken())
+	assert.Equal(t, "est", p.GetName())
+	assert.Equal(t, TypeEST, p.GetType())
+	assert.Equal(t, "EST", p.GetType().String())
+	kid, key, ok := p.GetEncryptedKey()
+	assert.Empty(t, kid)
+	assert.Empty(t, key)
+	assert.False(t, ok)
+	assert.False(t, p.IsServerKeyGenEnabled())
+}
+
+func TestEST_Init(t *testing.T) {
+	basic := &ESTBasicAuth{Username: "user", Password: "pass"}
+	ca, err := minica.New()
+	require.NoError(t, err)
+	roots := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Root.Raw})
+	tests := []struct {
+		name    string
+		p       *EST
+		wantErr bool
+	}{
+		{"ok basicAuth", &EST{Type: "EST", Name: "est", BasicAuth: basic}, false},
+		{"ok clientCertificateRoots", &EST{Type: "EST", Name: "est", ClientCertificates: true, ClientCertificateRoots: roots}, false},
+		{"ok clientCertificateProvisioners", &EST{Type: "EST", Name: "est", ClientCertificates: true, ClientCertificateProvisioners: []string{"manufacturing"}}, false},
+		{"ok serverKeyGen", &EST{Type: "EST", Name: "est", BasicAuth: basic, ServerKeyGen: &ESTServerKeyGenOptions{KeyType: "RSA", KeySize: 3072}}, false},
+		{"fail type", &EST{Name: "est", BasicAuth: basic}, true},
+		{"fail name", &EST{Type: "EST", BasicAuth: basic}, true},
+		{"fail no auth", &EST{Type: "EST", Name: "est"}, true},
+		{"fail clientCertificates", &EST{Type: "EST", Name: "est", ClientCertificates: true}, true},
+		{"fail clientCertificateRoots", &EST{Type: "EST", Name: "est", ClientCertificates: true, ClientCertificateRoots: []byte("foo")}, true},
+		{"fail basicAuth password", &EST{Type: "EST", Name: "est", BasicAuth: &ESTBasicAuth{Username: "user"}}, true},
+		{"fail minimumPublicKeyLength", &EST{Type: "EST", Name: "est", BasicAuth: basic, MinimumPublicKeyLength: 2047}, true},
+		{"fail serverKeyGen keyType", &EST{Type: "EST", Name: "est", BasicAuth: basic, ServerKeyGen: &ESTServerKeyGenOptions{KeyType: "DSA"}}, true},
+		{"fail serverKeyGen keySize", &EST{Type: "EST", Name: "est", BasicAuth: basic, ServerKeyGen: &ESTServerKeyGenOptions{KeyType: "RSA", KeySize: 1024}}, true},
+		{"fail serverKeyGen keyCurve", &EST{Type: "EST", Name: "est", BasicAuth: basic, ServerKeyGen: &ESTServerKeyGenOptions{KeyType: "RSA", KeyCurve: "P-256"}}, true},
+		{"fail serverKeyGen EC keySize", &EST{Type: "EST", Name: "est", BasicAuth: basic, ServerKeyGen: &ESTServerKeyGenOptions{KeySize: 2048}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.p.Init(Config{Claims: globalProvisionerClaims})
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestESTServerKeyGenOptions_GenerateKey(t *testing.T) {
+	var o *ESTServerKeyGenOptions
+	key, err := o.GenerateKey()
+	require.NoError(t, err)
+	if assert.IsType(t, &ecdsa.PrivateKey{}, key) {
+		assert.Equal(t, elliptic.P256(), key.(*ecdsa.PrivateKey).Curve)
+	}
+
+	key, err = (&ESTServerKeyGenOptions{KeyCurve: "P-384"}).GenerateKey()
+	require.NoError(t, err)
+	if assert.IsType(t, &ecdsa.PrivateKey{}, key) {
+		assert.Equal(t, elliptic.P384(), key.(*ecdsa.PrivateKey).Curve)
+	}
+
+	key, err = (&ESTServerKeyGenOptions{KeyType: "RSA"}).GenerateKey()
+	require.NoError(t, err)
+	if assert.IsType(t, &rsa.PrivateKey{}, key) {
+		assert.Equal(t, 2048, key.(*rsa.PrivateKey).N.BitLen())
+	}
+
+	key, err = (&ESTServerKeyGenOptions{KeyType: "OKP"}).GenerateKey()
+	require.NoError(t, err)
+	assert.IsType(t, ed25519.PrivateKey{}, key)
+}
+
+func TestEST_AuthorizeBasicAuth(t *testing.T) {
+	ctx := context.Background()
+	p := generateEST(t)
+	assert.NoError(t, p.AuthorizeBasicAuth(ctx, "user", "pass"))
+	assert.Error(t, p.AuthorizeBasicAuth(ctx, "user", "bad"))
+	assert.Error(t, p.AuthorizeBasicAuth(ctx, "bad", "pass"))
+
+	p.BasicAuth = nil
+	assert.Error(t, p.AuthorizeBasicAuth(ctx, "user", "pass"))
+}
+
+func TestEST_AuthorizeClientCertificate(t *testing.T) {
+	ctx := context.Background()
+	ca, err := minica.New()
+	require.NoError(t, err)
+	otherCA, err := minica.New()
+	require.NoError(t, err)
+	signer, err := keyutil.GenerateDefaultSigner()
+	require.NoError(t, err)
+
+	newChain := func(ca *minica.CA, name string, notAfter time.Time) [][]*x509.Certificate {
+		ext, err := (&Extension{Type: TypeJWK, Name: name}).ToExtension()
+		require.NoError(t, err)
+		cert, err := ca.Sign(&x509.Certificate{
+			Subject:         pkix.Name{CommonName: "device"},
+			DNSNames:        []string{"device.example.com"},
+			PublicKey:       signer.Public(),
+			NotBefore:       time.Now().Add(-2 * time.Hour),
+			NotAfter:        notAfter,
+			ExtraExtensions: []pkix.Extension{ext},
+		})
+		require.NoError(t, err)
+		return [][]*x509.Certificate{{cert, ca.Intermediate, ca.Root}}
+	}
+
+	csr := &x509.CertificateRequest{Subject: pkix.Name{CommonName: "device"}, DNSNames: []string{"device.example.com"}}
+	otherCSR := &x509.CertificateRequest{Subject: pkix.Name{CommonName: "device"}, DNSNames: []string{"other.example.com"}}
+	notAfter := time.Now().Add(time.Hour)
+
+	p := generateEST(t)
+	assert.NoError(t, p.AuthorizeClientCertificate(ctx, newChain(ca, "manufacturing", notAfter), csr))
+	assert.Error(t, p.AuthorizeClientCertificate(ctx, newChain(ca, "other", notAfter), csr))
+	assert.Error(t, p.AuthorizeClientCertificate(ctx, newChain(ca, "manufacturing", time.Now().Add(-time.Minute)), csr))
+	assert.Error(t, p.AuthorizeClientCertificate(ctx, newChain(ca, "manufacturing", notAfter), otherCSR))
+	assert.Error(t, p.AuthorizeClientCertificate(ctx, nil, csr))
+
+	p = &EST{
+		Type:                   "EST",
+		Name:                   "est",
+		ClientCertificates:     true,
+		ClientCertificateRoots: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Root.Raw}),
+	}
+	require.NoError(t, p.Init(Config{Claims: globalProvisionerClaims}))
+	assert.NoError(t, p.AuthorizeClientCertificate(ctx, newChain(ca, "other", notAfter), csr))
+	assert.Error(t, p.AuthorizeClientCertificate(ctx, newChain(otherCA, "other", notAfter), csr))
+
+	p.ClientCertificates = false
+	assert.Error(t, p.AuthorizeClientCertificate(ctx, newChain(ca, "other", notAfter), csr))
+}
+
+func TestEST_AuthorizeReenroll(t *testing.T) {
+	ctx := context.Background()
+	p := generateEST(t)
+	ca, err := minica.New()
+	require.NoError(t, err)
+	signer, err := keyutil.GenerateDefaultSigner()
+	require.NoError(t, err)
+
+	newCert := func(typ Type, name string, notAfter time.Time) *x509.Certificate {
+		ext, err := (&Extension{Type: typ, Name: name}).ToExtension()
+		require.NoError(t, err)
+		cert, err := ca.Sign(&x509.Certificate{
+			Subject:         pkix.Name{CommonName: "device"},
+			DNSNames:        []string{"device.example.com"},
+			PublicKey:       signer.Public(),
+			NotBefore:       time.Now().Add(-2 * time.Hour),
+			NotAfter:        notAfter,
+			ExtraExtensions: []pkix.Extension{ext},
+		})
+		require.NoError(t, err)
+		return cert
+	}
+
+	csr := &x509.CertificateRequest{Subject: pkix.Name{CommonName: "device"}, DNSNames: []string{"device.example.com"}}
+	assert.NoError(t, p.AuthorizeReenroll(ctx, csr, newCert(TypeEST, "est", time.Now().Add(time.Hour))))
+	assert.Error(t, p.AuthorizeReenroll(ctx, csr, newCert(TypeEST, "other", time.Now().Add(time.Hour))))
+	assert.Error(t, p.AuthorizeReenroll(ctx, csr, newCert(TypeSCEP, "est", time.Now().Add(time.Hour))))
+	assert.Error(t, p.AuthorizeReenroll(ctx, csr, newCert(TypeEST, "est", time.Now().Add(-time.Hour))))
+	assert.Error(t, p.AuthorizeReenroll(ctx, &x509.CertificateRequest{Subject: pkix.Name{CommonName: "other"}}, newCert(TypeEST, "est", time.Now().Add(time.Hour))))
+
+	disableRenewal := true
+	p.Claims = &Claims{DisableRenewal: &disableRenewal}
+	require.NoError(t, p.Init(Config{Claims: globalProvisionerClaims}))
+	assert.Error(t, p.AuthorizeReenroll(ctx, csr, newCert(TypeEST, "est", time.Now().Add(time.Hour))))
+}
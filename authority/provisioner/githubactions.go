@@ -0,0 +1,290 @@
+package provisioner
+
+import (
+	"context"
+	"crypto/x509"
+	"net/http"
+	"net/url"
+	"path"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"go.step.sm/crypto/jose"
+	"go.step.sm/crypto/x509util"
+	"go.step.sm/linkedca"
+
+	"github.com/smallstep/certificates/errs"
+	"github.com/smallstep/certificates/webhook"
+)
+
+// GitHubActionsIssuer is the issuer of the OIDC tokens of GitHub Actions.
+const GitHubActionsIssuer = "https://token.actions.githubusercontent.com"
+
+// githubActionsPayload represents the fields of a GitHub Actions OIDC token.
+// See https://docs.github.com/en/actions/security-for-github-actions/security-hardening-your-deployments/about-security-hardening-with-openid-connect
+type githubActionsPayload struct {
+	jose.Claims
+	Repository      string `json:"repository"`
+	RepositoryOwner string `json:"repository_owner"`
+	Ref             string `json:"ref"`
+	RefType         string `json:"ref_type"`
+	SHA             string `json:"sha"`
+	Environment     string `json:"environment"`
+	Workflow        string `json:"workflow"`
+	JobWorkflowRef  string `json:"job_workflow_ref"`
+	EventName       string `json:"event_name"`
+	Actor           string `json:"actor"`
+	RunID           string `json:"run_id"`
+}
+
+// GitHubActions is a provisioner that authorizes GitHub Actions jobs using the
+// OIDC tokens issued by GitHub, this way workflows can get short-lived
+// certificates without storing long-lived secrets.
+//
+// The token audience must be the sign URL of the CA with the fragment
+// "github/<name>", e.g., https://ca.example.com/1.0/sign#github/actions.
+//
+// Only tokens from the given repositories are accepted, and they can be
+// restricted to some refs, environments, or reusable workflows. The patterns
+// use the syntax of path.Match, e.g., "octo-org/*" or "refs/tags/v*".
+//
+// The default certificate uses the repository as the common name, and the URI
+// of the workflow, e.g.,
+// https://github.com/octo-org/octo-repo/.github/workflows/ci.yml@refs/heads/main,
+// as the SAN. The SANs in the certificate request are ignored, templates can
+// use the token claims in {{ .Token }} to map them to other names, and the
+// policies of the provisioner are enforced on the final names.
+type GitHubActions struct {
+	*base
+	ID   string `json:"-"`
+	Type string `json:"type"`
+	Name string `json:"name"`
+	// Issuer is the issuer of the tokens, it defaults to GitHubActionsIssuer.
+	// It must be set in GitHub Enterprise Server, or if the enterprise uses a
+	// custom issuer.
+	Issuer string `json:"issuer,omitempty"`
+	// Repositories is the list of repositories, "owner/repo", allowed.
+	Repositories []string `json:"repositories"`
+	// Refs is the list of git refs allowed, e.g., "refs/heads/main".
+	Refs []string `json:"refs,omitempty"`
+	// Environments is the list of deployment environments allowed.
+	Environments []string `json:"environments,omitempty"`
+	// Workflows is the list of job workflow refs allowed, e.g.,
+	// "octo-org/octo-automation/.github/workflows/deploy.yml@refs/heads/main".
+	Workflows []string `json:"workflows,omitempty"`
+	Claims    *Claims  `json:"claims,omitempty"`
+	Options   *Options `json:"options,omitempty"`
+	serverURL string
+	keyStore  *keyStore
+	ctl       *Controller
+}
+
+// GetID returns the provisioner unique identifier.
+func (p *GitHubActions) GetID() string {
+	if p.ID != "" {
+		return p.ID
+	}
+	return p.GetIDForToken()
+}
+
+// GetIDForToken returns an identifier that will be used to load the provisioner
+// from a token.
+func (p *GitHubActions) GetIDForToken() string {
+	return "github/" + p.Name
+}
+
+// GetTokenID returns the identifier of the token, GitHub tokens include a
+// unique jti claim.
+func (p *GitHubActions) GetTokenID(token string) (string, error) {
+	jwt, err := jose.ParseSigned(token)
+	if err != nil {
+		return "", errors.Wrap(err, "error parsing token")
+	}
+	var claims jose.Claims
+	if err := jwt.UnsafeClaimsWithoutVerification(&claims); err != nil {
+		return "", errors.Wrap(err, "error verifying claims")
+	}
+	return claims.ID, nil
+}
+
+// GetName returns the name of the provisioner.
+func (p *GitHubActions) GetName() string {
+	return p.Name
+}
+
+// GetType returns the type of provisioner.
+func (p *GitHubActions) GetType() Type {
+	return TypeGitHubActions
+}
+
+// GetEncryptedKey is not available in a GitHubActions provisioner.
+func (p *GitHubActions) GetEncryptedKey() (kid, key string, ok bool) {
+	return "", "", false
+}
+
+// GetOptions returns the configured provisioner options.
+func (p *GitHubActions) GetOptions() *Options {
+	return p.Options
+}
+
+// Init validates and initializes the GitHubActions provisioner.
+func (p *GitHubActions) Init(config Config) (err error) {
+	switch {
+	case p.Type == "":
+		return errors.New("provisioner type cannot be empty")
+	case p.Name == "":
+		return errors.New("provisioner name cannot be empty")
+	case len(p.Repositories) == 0:
+		return errors.New("provisioner repositories cannot be empty")
+	}
+	for _, patterns := range [][]string{p.Repositories, p.Refs, p.Environments, p.Workflows} {
+		if err := validatePatterns(patterns); err != nil {
+			return err
+		}
+	}
+
+	if p.Issuer == "" {
+		p.Issuer = GitHubActionsIssuer
+	}
+	u, err := url.Parse(p.Issuer)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return errors.Errorf("provisioner issuer %q is not a valid URL", p.Issuer)
+	}
+
+	// Workflow URIs point to github.com, or to the GitHub Enterprise Server.
+	p.serverURL = "https://github.com"
+	if u.Host != "token.actions.githubusercontent.com" {
+		p.serverURL = u.Scheme + "://" + u.Host
+	}
+
+	config.Audiences = config.Audiences.WithFragment(p.GetIDForToken())
+	if p.ctl, err = NewController(p, p.Claims, config, p.Options); err != nil {
+		return
+	}
+
+	p.keyStore, err = newIssuerKeyStore(p.ctl.GetHTTPClient(), p.Issuer)
+	return
+}
+
+// authorizeToken validates the token signature and claims, and returns the
+// claims.
+func (p *GitHubActions) authorizeToken(token string, audiences []string) (*githubActionsPayload, error) {
+	jwt, err := jose.ParseSigned(token)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusUnauthorized, err, "githubactions.authorizeToken; error parsing token")
+	}
+	if len(jwt.Headers) == 0 {
+		return nil, errs.Unauthorized("githubactions.authorizeToken; error parsing token - header is missing")
+	}
+
+	var found bool
+	var claims githubActionsPayload
+	kid := jwt.Headers[0].KeyID
+	for _, key := range p.keyStore.Get(kid) {
+		if err := jwt.Claims(key, &claims); err == nil {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return nil, errs.Unauthorized("githubactions.authorizeToken; cannot validate token - cannot find key for kid %s", kid)
+	}
+
+	// According to "rfc7519 JSON Web Token" acceptable skew should be no
+	// more than a few minutes.
+	if err := claims.ValidateWithLeeway(jose.Expected{
+		Issuer: p.Issuer,
+		Time:   time.Now().UTC(),
+	}, time.Minute); err != nil {
+		return nil, errs.Wrap(http.StatusUnauthorized, err, "githubactions.authorizeToken; invalid token claims")
+	}
+	if !matchesAudience(claims.Audience, audiences) {
+		return nil, errs.Unauthorized("githubactions.authorizeToken; invalid token audience claim (aud)")
+	}
+
+	switch {
+	case claims.Repository == "":
+		return nil, errs.Unauthorized("githubactions.authorizeToken; token repository cannot be empty")
+	case claims.JobWorkflowRef == "":
+		return nil, errs.Unauthorized("githubactions.authorizeToken; token job_workflow_ref cannot be empty")
+	case !matchesPatterns(p.Repositories, claims.Repository):
+		return nil, errs.Unauthorized("githubactions.authorizeToken; repository %s is not allowed", claims.Repository)
+	case len(p.Refs) > 0 && !matchesPatterns(p.Refs, claims.Ref):
+		return nil, errs.Unauthorized("githubactions.authorizeToken; ref %s is not allowed", claims.Ref)
+	case len(p.Environments) > 0 && !matchesPatterns(p.Environments, claims.Environment):
+		return nil, errs.Unauthorized("githubactions.authorizeToken; environment %q is not allowed", claims.Environment)
+	case len(p.Workflows) > 0 && !matchesPatterns(p.Workflows, claims.JobWorkflowRef):
+		return nil, errs.Unauthorized("githubactions.authorizeToken; workflow %s is not allowed", claims.JobWorkflowRef)
+	}
+
+	return &claims, nil
+}
+
+// AuthorizeSign validates the given token and returns the sign options that
+// will be used on certificate creation.
+func (p *GitHubActions) AuthorizeSign(_ context.Context, token string) ([]SignOption, error) {
+	if err := p.ctl.AuthorizeIssuance(); err != nil {
+		return nil, err
+	}
+	claims, err := p.authorizeToken(token, p.ctl.Audiences.Sign)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "githubactions.AuthorizeSign")
+	}
+
+	// Certificate templates
+	data := x509util.CreateTemplateData(claims.Repository, []string{
+		p.serverURL + "/" + claims.JobWorkflowRef,
+	})
+	if v, err := unsafeParseSigned(token); err == nil {
+		data.SetToken(v)
+	}
+
+	templateOptions, err := CustomTemplateOptions(p.Options, data, x509util.DefaultLeafTemplate)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "githubactions.AuthorizeSign")
+	}
+
+	return []SignOption{
+		p,
+		templateOptions,
+		// modifiers / withOptions
+		newProvisionerExtensionOption(TypeGitHubActions, p.Name, claims.Subject,
+			"Repository", claims.Repository, "Ref", claims.Ref, "SHA", claims.SHA).WithControllerOptions(p.ctl),
+		profileDefaultDuration(p.ctl.Claimer.DefaultTLSCertDuration()),
+		// validators
+		defaultPublicKeyValidator{keys: p.ctl.Claimer.KeyClaims()},
+		newClaimsValidityValidator(p.ctl.Claimer),
+		newX509NamePolicyValidator(p.ctl.getPolicy().getX509()),
+		p.ctl.newWebhookController(
+			data,
+			linkedca.Webhook_X509,
+			webhook.WithAuthorizationPrincipal(claims.Repository),
+		),
+	}, nil
+}
+
+// AuthorizeRenew returns an error if the renewal is disabled.
+func (p *GitHubActions) AuthorizeRenew(ctx context.Context, cert *x509.Certificate) error {
+	return p.ctl.AuthorizeRenew(ctx, cert)
+}
+
+// validatePatterns returns an error if one of the patterns is not valid.
+func validatePatterns(patterns []string) error {
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return errors.Errorf("pattern %q is not valid", pattern)
+		}
+	}
+	return nil
+}
+
+// matchesPatterns returns true if the value matches one of the patterns.
+func matchesPatterns(patterns []string, value string) bool {
+	for _, pattern := range patterns {
+		if ok, err := path.Match(pattern, value); err == nil && ok {
+			return true
+		}
+	}
+	return false
+}
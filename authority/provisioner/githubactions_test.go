@@ -0,0 +1,215 @@
+package provisioner
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.step.sm/crypto/jose"
+
+	"github.com/smallstep/certificates/api/render"
+)
+
+func generateGitHubActions(issuer string) *GitHubActions {
+	return &GitHubActions{
+		Type:         "GitHubActions",
+		Name:         "actions",
+		Issuer:       issuer,
+		Repositories: []string{"octo-org/octo-repo", "octo-org/infra-*"},
+		Refs:         []string{"refs/heads/main", "refs/tags/v*"},
+	}
+}
+
+func generateGitHubActionsToken(t *testing.T, p *GitHubActions, jwk *jose.JSONWebKey, claims map[string]any) string {
+	t.Helper()
+	c := map[string]any{
+		"repository":       "octo-org/octo-repo",
+		"repository_owner": "octo-org",
+		"ref":              "refs/heads/main",
+		"ref_type":         "branch",
+		"sha":              "e2b3c4d5",
+		"job_workflow_ref": "octo-org/octo-repo/.github/workflows/ci.yml@refs/heads/main",
+	}
+	for k, v := range claims {
+		c[k] = v
+	}
+	tok, err := generateCustomToken("repo:octo-org/octo-repo:ref:refs/heads/main", p.Issuer,
+		testAudiences.Sign[0]+"#"+p.GetIDForToken(), jwk, nil, c)
+	require.NoError(t, err)
+	return tok
+}
+
+func TestGitHubActions_Getters(t *testing.T) {
+	p := generateGitHubActions("")
+	assert.Equal(t, "github/actions", p.GetID())
+	assert.Equal(t, "github/actions", p.GetIDForToken())
+	assert.Equal(t, "actions", p.GetName())
+	assert.Equal(t, TypeGitHubActions, p.GetType())
+	assert.Equal(t, "GitHubActions", p.GetType().String())
+	kid, key, ok := p.GetEncryptedKey()
+	assert.Empty(t, kid)
+	assert.Empty(t, key)
+	assert.False(t, ok)
+
+	p.ID = "the-id"
+	assert.Equal(t, "the-id", p.GetID())
+}
+
+func TestGitHubActions_Init(t *testing.T) {
+	srv := generateJWKServer(2)
+	defer srv.Close()
+
+	config := Config{Claims: globalProvisionerClaims, Audiences: testAudiences}
+	tests := []struct {
+		name    string
+		p       *GitHubActions
+		wantErr bool
+	}{
+		{"ok", generateGitHubActions(srv.URL), false},
+		{"fail type", &GitHubActions{Name: "actions", Issuer: srv.URL, Repositories: []string{"octo-org/*"}}, true},
+		{"fail name", &GitHubActions{Type: "GitHubActions", Issuer: srv.URL, Repositories: []string{"octo-org/*"}}, true},
+		{"fail repositories", &GitHubActions{Type: "GitHubActions", Name: "actions", Issuer: srv.URL}, true},
+		{"fail pattern", &GitHubActions{Type: "GitHubActions", Name: "actions", Issuer: srv.URL, Repositories: []string{"octo-org/["}}, true},
+		{"fail issuer", &GitHubActions{Type: "GitHubActions", Name: "actions", Issuer: "octo-org", Repositories: []string{"octo-org/*"}}, true},
+		{"fail openid-configuration", &GitHubActions{Type: "GitHubActions", Name: "actions", Issuer: srv.URL + "/error", Repositories: []string{"octo-org/*"}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.p.Init(config)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, srv.URL, tt.p.serverURL)
+			assert.Equal(t, []string{
+				"https://ca.smallstep.com/1.0/sign#github/actions",
+				"https://ca.smallstep.com/sign#github/actions",
+			}, tt.p.ctl.Audiences.Sign)
+		})
+	}
+}
+
+func TestGitHubActions_authorizeToken(t *testing.T) {
+	srv := generateJWKServer(2)
+	defer srv.Close()
+
+	var keys jose.JSONWebKeySet
+	require.NoError(t, getAndDecode(srv.Client(), srv.URL+"/private", &keys))
+
+	p := generateGitHubActions(srv.URL)
+	require.NoError(t, p.Init(Config{Claims: globalProvisionerClaims, Audiences: testAudiences}))
+
+	pw := generateGitHubActions(srv.URL)
+	pw.Environments = []string{"production"}
+	pw.Workflows = []string{"octo-org/octo-automation/.github/workflows/*@refs/heads/main"}
+	require.NoError(t, pw.Init(Config{Claims: globalProvisionerClaims, Audiences: testAudiences}))
+
+	otherIssuer, err := generateCustomToken("subject", "https://other.example.com", testAudiences.Sign[0]+"#github/actions", &keys.Keys[0], nil, map[string]any{
+		"repository":       "octo-org/octo-repo",
+		"job_workflow_ref": "octo-org/octo-repo/.github/workflows/ci.yml@refs/heads/main",
+	})
+	require.NoError(t, err)
+	otherKey, err := generateJSONWebKey()
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		p       *GitHubActions
+		token   string
+		wantErr bool
+	}{
+		{"ok", p, generateGitHubActionsToken(t, p, &keys.Keys[0], nil), false},
+		{"ok repository pattern", p, generateGitHubActionsToken(t, p, &keys.Keys[1], map[string]any{"repository": "octo-org/infra-dns"}), false},
+		{"ok ref pattern", p, generateGitHubActionsToken(t, p, &keys.Keys[0], map[string]any{"ref": "refs/tags/v1.2.3"}), false},
+		{"ok workflow", pw, generateGitHubActionsToken(t, pw, &keys.Keys[0], map[string]any{
+			"environment":      "production",
+			"job_workflow_ref": "octo-org/octo-automation/.github/workflows/deploy.yml@refs/heads/main",
+		}), false},
+		{"fail token", p, "foo", true},
+		{"fail key", p, generateGitHubActionsToken(t, p, otherKey, nil), true},
+		{"fail issuer", p, otherIssuer, true},
+		{"fail audience", p, func() string {
+			tok, err := generateCustomToken("subject", p.Issuer, testAudiences.Sign[0]+"#github/other", &keys.Keys[0], nil, nil)
+			require.NoError(t, err)
+			return tok
+		}(), true},
+		{"fail empty repository", p, generateGitHubActionsToken(t, p, &keys.Keys[0], map[string]any{"repository": ""}), true},
+		{"fail empty job_workflow_ref", p, generateGitHubActionsToken(t, p, &keys.Keys[0], map[string]any{"job_workflow_ref": ""}), true},
+		{"fail repository", p, generateGitHubActionsToken(t, p, &keys.Keys[0], map[string]any{"repository": "evil-org/octo-repo"}), true},
+		{"fail repository pattern", p, generateGitHubActionsToken(t, p, &keys.Keys[0], map[string]any{"repository": "octo-org/infra-dns/../octo-repo"}), true},
+		{"fail ref", p, generateGitHubActionsToken(t, p, &keys.Keys[0], map[string]any{"ref": "refs/heads/feature"}), true},
+		{"fail environment", pw, generateGitHubActionsToken(t, pw, &keys.Keys[0], map[string]any{
+			"environment":      "staging",
+			"job_workflow_ref": "octo-org/octo-automation/.github/workflows/deploy.yml@refs/heads/main",
+		}), true},
+		{"fail workflow", pw, generateGitHubActionsToken(t, pw, &keys.Keys[0], map[string]any{
+			"environment": "production",
+		}), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.p.authorizeToken(tt.token, tt.p.ctl.Audiences.Sign)
+			if tt.wantErr {
+				var sc render.StatusCodedError
+				require.ErrorAs(t, err, &sc)
+				assert.Equal(t, http.StatusUnauthorized, sc.StatusCode())
+				assert.Nil(t, got)
+				return
+			}
+			require.NoError(t, err)
+			assert.NotEmpty(t, got.Repository)
+			assert.Equal(t, tt.p.Issuer, got.Issuer)
+		})
+	}
+}
+
+func TestGitHubActions_AuthorizeSign(t *testing.T) {
+	srv := generateJWKServer(1)
+	defer srv.Close()
+
+	var keys jose.JSONWebKeySet
+	require.NoError(t, getAndDecode(srv.Client(), srv.URL+"/private", &keys))
+
+	p := generateGitHubActions(srv.URL)
+	require.NoError(t, p.Init(Config{Claims: globalProvisionerClaims, Audiences: testAudiences}))
+
+	t.Run("ok", func(t *testing.T) {
+		opts, err := p.AuthorizeSign(context.Background(), generateGitHubActionsToken(t, p, &keys.Keys[0], nil))
+		require.NoError(t, err)
+		assert.Len(t, opts, 8)
+		for _, o := range opts {
+			switch v := o.(type) {
+			case *GitHubActions:
+			case certificateOptionsFunc:
+			case *provisionerExtensionOption:
+				assert.Equal(t, TypeGitHubActions, v.Type)
+				assert.Equal(t, "actions", v.Name)
+				assert.Equal(t, "repo:octo-org/octo-repo:ref:refs/heads/main", v.CredentialID)
+				assert.Equal(t, []string{"Repository", "octo-org/octo-repo", "Ref", "refs/heads/main", "SHA", "e2b3c4d5"}, v.KeyValuePairs)
+			case profileDefaultDuration:
+				assert.Equal(t, p.ctl.Claimer.DefaultTLSCertDuration(), time.Duration(v))
+			case defaultPublicKeyValidator:
+			case *validityValidator:
+				assert.Equal(t, p.ctl.Claimer.MinTLSCertDuration(), v.min)
+				assert.Equal(t, p.ctl.Claimer.MaxTLSCertDuration(), v.max)
+			case *x509NamePolicyValidator:
+				assert.Nil(t, v.policyEngine)
+			case *WebhookController:
+				assert.Empty(t, v.webhooks)
+			default:
+				assert.FailNow(t, "unexpected sign option", "%T", v)
+			}
+		}
+	})
+
+	t.Run("fail", func(t *testing.T) {
+		_, err := p.AuthorizeSign(context.Background(), generateGitHubActionsToken(t, p, &keys.Keys[0], map[string]any{"repository": "evil-org/octo-repo"}))
+		var sc render.StatusCodedError
+		require.ErrorAs(t, err, &sc)
+		assert.Equal(t, http.StatusUnauthorized, sc.StatusCode())
+	})
+}
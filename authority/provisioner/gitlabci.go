@@ -0,0 +1,267 @@
+package provisioner
+
+import (
+	"context"
+	"crypto/x509"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"go.step.sm/crypto/jose"
+	"go.step.sm/crypto/x509util"
+	"go.step.sm/linkedca"
+
+	"github.com/smallstep/certificates/errs"
+	"github.com/smallstep/certificates/webhook"
+)
+
+// GitLabIssuer is the issuer of the ID tokens of GitLab.com.
+const GitLabIssuer = "https://gitlab.com"
+
+// gitLabCIPayload represents the fields of a GitLab CI/CD ID token.
+// See https://docs.gitlab.com/ee/ci/secrets/id_token_authentication.html
+type gitLabCIPayload struct {
+	jose.Claims
+	NamespaceID          string `json:"namespace_id"`
+	NamespacePath        string `json:"namespace_path"`
+	ProjectID            string `json:"project_id"`
+	ProjectPath          string `json:"project_path"`
+	UserLogin            string `json:"user_login"`
+	PipelineID           string `json:"pipeline_id"`
+	PipelineSource       string `json:"pipeline_source"`
+	JobID                string `json:"job_id"`
+	Ref                  string `json:"ref"`
+	RefType              string `json:"ref_type"`
+	RefProtected         string `json:"ref_protected"`
+	Environment          string `json:"environment"`
+	EnvironmentProtected string `json:"environment_protected"`
+	CIConfigRefURI       string `json:"ci_config_ref_uri"`
+	SHA                  string `json:"sha"`
+}
+
+// GitLabCI is a provisioner that authorizes GitLab CI/CD jobs using the ID
+// tokens, or the deprecated CI_JOB_JWT, issued by GitLab for each job.
+//
+// The token audience must be the sign URL of the CA with the fragment
+// "gitlab/<name>", e.g., https://ca.example.com/1.0/sign#gitlab/ci. In the
+// .gitlab-ci.yml:
+//
+//	id_tokens:
+//	  STEP_TOKEN:
+//	    aud: https://ca.example.com/1.0/sign#gitlab/ci
+//
+// Only tokens from the given projects are accepted, and they can be restricted
+// to some refs and environments, or to protected refs and environments. The
+// patterns use the syntax of path.Match, e.g., "my-group/*".
+//
+// The default certificate uses the project path as the common name, and the
+// URI of the project, e.g., https://gitlab.com/my-group/my-project, as the
+// SAN. The SANs in the certificate request are ignored, templates can map
+// other claims, e.g., {{ .Token.environment }}, to SANs.
+type GitLabCI struct {
+	*base
+	ID   string `json:"-"`
+	Type string `json:"type"`
+	Name string `json:"name"`
+	// Issuer is the URL of the GitLab instance, it defaults to GitLabIssuer.
+	Issuer string `json:"issuer,omitempty"`
+	// Projects is the list of project paths, "group/project", allowed.
+	Projects []string `json:"projects"`
+	// Refs is the list of git refs allowed, e.g., "main" or "v*".
+	Refs []string `json:"refs,omitempty"`
+	// Environments is the list of deployment environments allowed.
+	Environments []string `json:"environments,omitempty"`
+	// ProtectedRefsOnly requires the job to run on a protected branch or tag.
+	ProtectedRefsOnly bool `json:"protectedRefsOnly,omitempty"`
+	// ProtectedEnvironmentsOnly requires the job to deploy to a protected
+	// environment.
+	ProtectedEnvironmentsOnly bool     `json:"protectedEnvironmentsOnly,omitempty"`
+	Claims                    *Claims  `json:"claims,omitempty"`
+	Options                   *Options `json:"options,omitempty"`
+	keyStore                  *keyStore
+	ctl                       *Controller
+}
+
+// GetID returns the provisioner unique identifier.
+func (p *GitLabCI) GetID() string {
+	if p.ID != "" {
+		return p.ID
+	}
+	return p.GetIDForToken()
+}
+
+// GetIDForToken returns an identifier that will be used to load the provisioner
+// from a token.
+func (p *GitLabCI) GetIDForToken() string {
+	return "gitlab/" + p.Name
+}
+
+// GetTokenID returns the identifier of the token, GitLab tokens include a
+// unique jti claim.
+func (p *GitLabCI) GetTokenID(token string) (string, error) {
+	jwt, err := jose.ParseSigned(token)
+	if err != nil {
+		return "", errors.Wrap(err, "error parsing token")
+	}
+	var claims jose.Claims
+	if err := jwt.UnsafeClaimsWithoutVerification(&claims); err != nil {
+		return "", errors.Wrap(err, "error verifying claims")
+	}
+	return claims.ID, nil
+}
+
+// GetName returns the name of the provisioner.
+func (p *GitLabCI) GetName() string {
+	return p.Name
+}
+
+// GetType returns the type of provisioner.
+func (p *GitLabCI) GetType() Type {
+	return TypeGitLabCI
+}
+
+// GetEncryptedKey is not available in a GitLabCI provisioner.
+func (p *GitLabCI) GetEncryptedKey() (kid, key string, ok bool) {
+	return "", "", false
+}
+
+// GetOptions returns the configured provisioner options.
+func (p *GitLabCI) GetOptions() *Options {
+	return p.Options
+}
+
+// Init validates and initializes the GitLabCI provisioner.
+func (p *GitLabCI) Init(config Config) (err error) {
+	switch {
+	case p.Type == "":
+		return errors.New("provisioner type cannot be empty")
+	case p.Name == "":
+		return errors.New("provisioner name cannot be empty")
+	case len(p.Projects) == 0:
+		return errors.New("provisioner projects cannot be empty")
+	}
+	for _, patterns := range [][]string{p.Projects, p.Refs, p.Environments} {
+		if err := validatePatterns(patterns); err != nil {
+			return err
+		}
+	}
+
+	if p.Issuer == "" {
+		p.Issuer = GitLabIssuer
+	}
+	if u, err := url.Parse(p.Issuer); err != nil || u.Scheme == "" || u.Host == "" {
+		return errors.Errorf("provisioner issuer %q is not a valid URL", p.Issuer)
+	}
+
+	config.Audiences = config.Audiences.WithFragment(p.GetIDForToken())
+	if p.ctl, err = NewController(p, p.Claims, config, p.Options); err != nil {
+		return
+	}
+
+	p.keyStore, err = newIssuerKeyStore(p.ctl.GetHTTPClient(), p.Issuer)
+	return
+}
+
+// authorizeToken validates the token signature and claims, and returns the
+// claims.
+func (p *GitLabCI) authorizeToken(token string, audiences []string) (*gitLabCIPayload, error) {
+	jwt, err := jose.ParseSigned(token)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusUnauthorized, err, "gitlabci.authorizeToken; error parsing token")
+	}
+	if len(jwt.Headers) == 0 {
+		return nil, errs.Unauthorized("gitlabci.authorizeToken; error parsing token - header is missing")
+	}
+
+	var found bool
+	var claims gitLabCIPayload
+	kid := jwt.Headers[0].KeyID
+	for _, key := range p.keyStore.Get(kid) {
+		if err := jwt.Claims(key, &claims); err == nil {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return nil, errs.Unauthorized("gitlabci.authorizeToken; cannot validate token - cannot find key for kid %s", kid)
+	}
+
+	// According to "rfc7519 JSON Web Token" acceptable skew should be no
+	// more than a few minutes.
+	if err := claims.ValidateWithLeeway(jose.Expected{
+		Issuer: p.Issuer,
+		Time:   time.Now().UTC(),
+	}, time.Minute); err != nil {
+		return nil, errs.Wrap(http.StatusUnauthorized, err, "gitlabci.authorizeToken; invalid token claims")
+	}
+	if !matchesAudience(claims.Audience, audiences) {
+		return nil, errs.Unauthorized("gitlabci.authorizeToken; invalid token audience claim (aud)")
+	}
+
+	switch {
+	case claims.ProjectPath == "":
+		return nil, errs.Unauthorized("gitlabci.authorizeToken; token project_path cannot be empty")
+	case !matchesPatterns(p.Projects, claims.ProjectPath):
+		return nil, errs.Unauthorized("gitlabci.authorizeToken; project %s is not allowed", claims.ProjectPath)
+	case len(p.Refs) > 0 && !matchesPatterns(p.Refs, claims.Ref):
+		return nil, errs.Unauthorized("gitlabci.authorizeToken; ref %s is not allowed", claims.Ref)
+	case p.ProtectedRefsOnly && claims.RefProtected != "true":
+		return nil, errs.Unauthorized("gitlabci.authorizeToken; ref %s is not protected", claims.Ref)
+	case len(p.Environments) > 0 && !matchesPatterns(p.Environments, claims.Environment):
+		return nil, errs.Unauthorized("gitlabci.authorizeToken; environment %q is not allowed", claims.Environment)
+	case p.ProtectedEnvironmentsOnly && claims.EnvironmentProtected != "true":
+		return nil, errs.Unauthorized("gitlabci.authorizeToken; environment %q is not protected", claims.Environment)
+	}
+
+	return &claims, nil
+}
+
+// AuthorizeSign validates the given token and returns the sign options that
+// will be used on certificate creation.
+func (p *GitLabCI) AuthorizeSign(_ context.Context, token string) ([]SignOption, error) {
+	if err := p.ctl.AuthorizeIssuance(); err != nil {
+		return nil, err
+	}
+	claims, err := p.authorizeToken(token, p.ctl.Audiences.Sign)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "gitlabci.AuthorizeSign")
+	}
+
+	// Certificate templates
+	data := x509util.CreateTemplateData(claims.ProjectPath, []string{
+		p.Issuer + "/" + claims.ProjectPath,
+	})
+	if v, err := unsafeParseSigned(token); err == nil {
+		data.SetToken(v)
+	}
+
+	templateOptions, err := CustomTemplateOptions(p.Options, data, x509util.DefaultLeafTemplate)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "gitlabci.AuthorizeSign")
+	}
+
+	return []SignOption{
+		p,
+		templateOptions,
+		// modifiers / withOptions
+		newProvisionerExtensionOption(TypeGitLabCI, p.Name, claims.Subject,
+			"Project", claims.ProjectPath, "Ref", claims.Ref, "SHA", claims.SHA).WithControllerOptions(p.ctl),
+		profileDefaultDuration(p.ctl.Claimer.DefaultTLSCertDuration()),
+		// validators
+		defaultPublicKeyValidator{keys: p.ctl.Claimer.KeyClaims()},
+		newClaimsValidityValidator(p.ctl.Claimer),
+		newX509NamePolicyValidator(p.ctl.getPolicy().getX509()),
+		p.ctl.newWebhookController(
+			data,
+			linkedca.Webhook_X509,
+			webhook.WithAuthorizationPrincipal(claims.ProjectPath),
+		),
+	}, nil
+}
+
+// AuthorizeRenew returns an error if the renewal is disabled.
+func (p *GitLabCI) AuthorizeRenew(ctx context.Context, cert *x509.Certificate) error {
+	return p.ctl.AuthorizeRenew(ctx, cert)
+}
@@ -0,0 +1,207 @@
+package provisioner
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.step.sm/crypto/jose"
+
+	"github.com/smallstep/certificates/api/render"
+)
+
+func generateGitLabCI(issuer string) *GitLabCI {
+	return &GitLabCI{
+		Type:     "GitLabCI",
+		Name:     "ci",
+		Issuer:   issuer,
+		Projects: []string{"my-group/my-project", "my-group/infra/*"},
+	}
+}
+
+func generateGitLabCIToken(t *testing.T, p *GitLabCI, jwk *jose.JSONWebKey, claims map[string]any) string {
+	t.Helper()
+	c := map[string]any{
+		"namespace_id":          "72",
+		"namespace_path":        "my-group",
+		"project_id":            "20",
+		"project_path":          "my-group/my-project",
+		"ref":                   "main",
+		"ref_type":              "branch",
+		"ref_protected":         "true",
+		"environment":           "production",
+		"environment_protected": "true",
+		"sha":                   "714a629c",
+	}
+	for k, v := range claims {
+		c[k] = v
+	}
+	tok, err := generateCustomToken("project_path:my-group/my-project:ref_type:branch:ref:main", p.Issuer,
+		testAudiences.Sign[0]+"#"+p.GetIDForToken(), jwk, nil, c)
+	require.NoError(t, err)
+	return tok
+}
+
+func TestGitLabCI_Getters(t *testing.T) {
+	p := generateGitLabCI("")
+	assert.Equal(t, "gitlab/ci", p.GetID())
+	assert.Equal(t, "gitlab/ci", p.GetIDForToken())
+	assert.Equal(t, "ci", p.GetName())
+	assert.Equal(t, TypeGitLabCI, p.GetType())
+	assert.Equal(t, "GitLabCI", p.GetType().String())
+	kid, key, ok := p.GetEncryptedKey()
+	assert.Empty(t, kid)
+	assert.Empty(t, key)
+	assert.False(t, ok)
+}
+
+func TestGitLabCI_Init(t *testing.T) {
+	srv := generateJWKServer(2)
+	defer srv.Close()
+
+	config := Config{Claims: globalProvisionerClaims, Audiences: testAudiences}
+	tests := []struct {
+		name    string
+		p       *GitLabCI
+		wantErr bool
+	}{
+		{"ok", generateGitLabCI(srv.URL), false},
+		{"fail type", &GitLabCI{Name: "ci", Issuer: srv.URL, Projects: []string{"my-group/*"}}, true},
+		{"fail name", &GitLabCI{Type: "GitLabCI", Issuer: srv.URL, Projects: []string{"my-group/*"}}, true},
+		{"fail projects", &GitLabCI{Type: "GitLabCI", Name: "ci", Issuer: srv.URL}, true},
+		{"fail pattern", &GitLabCI{Type: "GitLabCI", Name: "ci", Issuer: srv.URL, Projects: []string{"my-group/*"}, Refs: []string{"v[1"}}, true},
+		{"fail issuer", &GitLabCI{Type: "GitLabCI", Name: "ci", Issuer: "gitlab", Projects: []string{"my-group/*"}}, true},
+		{"fail openid-configuration", &GitLabCI{Type: "GitLabCI", Name: "ci", Issuer: srv.URL + "/error", Projects: []string{"my-group/*"}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.p.Init(config)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, []string{
+				"https://ca.smallstep.com/1.0/sign#gitlab/ci",
+				"https://ca.smallstep.com/sign#gitlab/ci",
+			}, tt.p.ctl.Audiences.Sign)
+		})
+	}
+}
+
+func TestGitLabCI_authorizeToken(t *testing.T) {
+	srv := generateJWKServer(2)
+	defer srv.Close()
+
+	var keys jose.JSONWebKeySet
+	require.NoError(t, getAndDecode(srv.Client(), srv.URL+"/private", &keys))
+
+	p := generateGitLabCI(srv.URL)
+	require.NoError(t, p.Init(Config{Claims: globalProvisionerClaims, Audiences: testAudiences}))
+
+	pp := generateGitLabCI(srv.URL)
+	pp.Refs = []string{"main", "v*"}
+	pp.Environments = []string{"production"}
+	pp.ProtectedRefsOnly = true
+	pp.ProtectedEnvironmentsOnly = true
+	require.NoError(t, pp.Init(Config{Claims: globalProvisionerClaims, Audiences: testAudiences}))
+
+	otherIssuer, err := generateCustomToken("subject", "https://gitlab.example.com", testAudiences.Sign[0]+"#gitlab/ci", &keys.Keys[0], nil, map[string]any{
+		"project_path": "my-group/my-project",
+	})
+	require.NoError(t, err)
+	otherAudience, err := generateCustomToken("subject", p.Issuer, testAudiences.Sign[0]+"#gitlab/other", &keys.Keys[0], nil, map[string]any{
+		"project_path": "my-group/my-project",
+	})
+	require.NoError(t, err)
+	otherKey, err := generateJSONWebKey()
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		p       *GitLabCI
+		token   string
+		wantErr bool
+	}{
+		{"ok", p, generateGitLabCIToken(t, p, &keys.Keys[0], nil), false},
+		{"ok project pattern", p, generateGitLabCIToken(t, p, &keys.Keys[1], map[string]any{"project_path": "my-group/infra/dns"}), false},
+		{"ok unprotected", p, generateGitLabCIToken(t, p, &keys.Keys[0], map[string]any{"ref": "feature", "ref_protected": "false"}), false},
+		{"ok protected", pp, generateGitLabCIToken(t, pp, &keys.Keys[0], map[string]any{"ref": "v1.0.0", "ref_type": "tag"}), false},
+		{"fail token", p, "foo", true},
+		{"fail key", p, generateGitLabCIToken(t, p, otherKey, nil), true},
+		{"fail issuer", p, otherIssuer, true},
+		{"fail audience", p, otherAudience, true},
+		{"fail empty project_path", p, generateGitLabCIToken(t, p, &keys.Keys[0], map[string]any{"project_path": ""}), true},
+		{"fail project", p, generateGitLabCIToken(t, p, &keys.Keys[0], map[string]any{"project_path": "other-group/my-project"}), true},
+		{"fail project pattern", p, generateGitLabCIToken(t, p, &keys.Keys[0], map[string]any{"project_path": "my-group/infra/dns/sub"}), true},
+		{"fail ref", pp, generateGitLabCIToken(t, pp, &keys.Keys[0], map[string]any{"ref": "feature"}), true},
+		{"fail ref protected", pp, generateGitLabCIToken(t, pp, &keys.Keys[0], map[string]any{"ref_protected": "false"}), true},
+		{"fail environment", pp, generateGitLabCIToken(t, pp, &keys.Keys[0], map[string]any{"environment": "staging"}), true},
+		{"fail environment protected", pp, generateGitLabCIToken(t, pp, &keys.Keys[0], map[string]any{"environment_protected": "false"}), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.p.authorizeToken(tt.token, tt.p.ctl.Audiences.Sign)
+			if tt.wantErr {
+				var sc render.StatusCodedError
+				require.ErrorAs(t, err, &sc)
+				assert.Equal(t, http.StatusUnauthorized, sc.StatusCode())
+				assert.Nil(t, got)
+				return
+			}
+			require.NoError(t, err)
+			assert.NotEmpty(t, got.ProjectPath)
+			assert.Equal(t, tt.p.Issuer, got.Issuer)
+		})
+	}
+}
+
+func TestGitLabCI_AuthorizeSign(t *testing.T) {
+	srv := generateJWKServer(1)
+	defer srv.Close()
+
+	var keys jose.JSONWebKeySet
+	require.NoError(t, getAndDecode(srv.Client(), srv.URL+"/private", &keys))
+
+	p := generateGitLabCI(srv.URL)
+	require.NoError(t, p.Init(Config{Claims: globalProvisionerClaims, Audiences: testAudiences}))
+
+	t.Run("ok", func(t *testing.T) {
+		opts, err := p.AuthorizeSign(context.Background(), generateGitLabCIToken(t, p, &keys.Keys[0], nil))
+		require.NoError(t, err)
+		assert.Len(t, opts, 8)
+		for _, o := range opts {
+			switch v := o.(type) {
+			case *GitLabCI:
+			case certificateOptionsFunc:
+			case *provisionerExtensionOption:
+				assert.Equal(t, TypeGitLabCI, v.Type)
+				assert.Equal(t, "ci", v.Name)
+				assert.Equal(t, "project_path:my-group/my-project:ref_type:branch:ref:main", v.CredentialID)
+				assert.Equal(t, []string{"Project", "my-group/my-project", "Ref", "main", "SHA", "714a629c"}, v.KeyValuePairs)
+			case profileDefaultDuration:
+				assert.Equal(t, p.ctl.Claimer.DefaultTLSCertDuration(), time.Duration(v))
+			case defaultPublicKeyValidator:
+			case *validityValidator:
+				assert.Equal(t, p.ctl.Claimer.MinTLSCertDuration(), v.min)
+				assert.Equal(t, p.ctl.Claimer.MaxTLSCertDuration(), v.max)
+			case *x509NamePolicyValidator:
+				assert.Nil(t, v.policyEngine)
+			case *WebhookController:
+				assert.Empty(t, v.webhooks)
+			default:
+				assert.FailNow(t, "unexpected sign option", "%T", v)
+			}
+		}
+	})
+
+	t.Run("fail", func(t *testing.T) {
+		_, err := p.AuthorizeSign(context.Background(), generateGitLabCIToken(t, p, &keys.Keys[0], map[string]any{"project_path": "other-group/my-project"}))
+		var sc render.StatusCodedError
+		require.ErrorAs(t, err, &sc)
+		assert.Equal(t, http.StatusUnauthorized, sc.StatusCode())
+	})
+}
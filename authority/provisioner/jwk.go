@@ -42,9 +42,13 @@ type JWK struct {
 	Name         string           `json:"name"`
 	Key          *jose.JSONWebKey `json:"key"`
 	EncryptedKey string           `json:"encryptedKey,omitempty"`
-	Claims       *Claims          `json:"claims,omitempty"`
-	Options      *Options         `json:"options,omitempty"`
-	ctl          *Controller
+	// Keys are additional public keys that can sign tokens, they are
+	// selected using the kid header of the token. They allow rolling the
+	// provisioner key without changing the provisioner name.
+	Keys    []*jose.JSONWebKey `json:"keys,omitempty"`
+	Claims  *Claims            `json:"claims,omitempty"`
+	Options *Options           `json:"options,omitempty"`
+	ctl     *Controller
 }
 
 // GetID returns the provisioner unique identifier. The name and credential id
@@ -62,6 +66,27 @@ func (p *JWK) GetIDForToken() string {
 	return p.Name + ":" + p.Key.KeyID
 }
 
+// GetIDsForToken returns the identifiers of the additional keys that will be
+// used to load the provisioner from a token.
+func (p *JWK) GetIDsForToken() []string {
+	ids := make([]string, 0, len(p.Keys))
+	for _, k := range p.Keys {
+		ids = append(ids, p.Name+":"+k.KeyID)
+	}
+	return ids
+}
+
+// getKey returns the key with the given key id. It returns the main key if
+// the key id is not one of the additional keys.
+func (p *JWK) getKey(kid string) *jose.JSONWebKey {
+	for _, k := range p.Keys {
+		if k.KeyID == kid {
+			return k
+		}
+	}
+	return p.Key
+}
+
 // GetTokenID returns the identifier of the token.
 func (p *JWK) GetTokenID(ott string) (string, error) {
 	// Validate payload
@@ -95,6 +120,11 @@ func (p *JWK) GetEncryptedKey() (string, string, bool) {
 	return p.Key.KeyID, p.EncryptedKey, p.EncryptedKey != ""
 }
 
+// GetOptions returns the configured provisioner options.
+func (p *JWK) GetOptions() *Options {
+	return p.Options
+}
+
 // Init initializes and validates the fields of a JWK type.
 func (p *JWK) Init(config Config) (err error) {
 	switch {
@@ -106,6 +136,21 @@ func (p *JWK) Init(config Config) (err error) {
 		return errors.New("provisioner key cannot be empty")
 	}
 
+	kids := map[string]bool{p.Key.KeyID: true}
+	for _, k := range p.Keys {
+		switch {
+		case k == nil:
+			return errors.New("provisioner keys cannot contain empty keys")
+		case k.KeyID == "":
+			return errors.New("provisioner keys must have a key id")
+		case kids[k.KeyID]:
+			return errors.Errorf("provisioner keys cannot contain duplicated key id %s", k.KeyID)
+		case !k.IsPublic():
+			return errors.Errorf("provisioner key %s must be a public key", k.KeyID)
+		}
+		kids[k.KeyID] = true
+	}
+
 	p.ctl, err = NewController(p, p.Claims, config, p.Options)
 	return
 }
@@ -120,7 +165,7 @@ func (p *JWK) authorizeToken(token string, audiences []string) (*jwtPayload, err
 	}
 
 	var claims jwtPayload
-	if err = jwt.Claims(p.Key, &claims); err != nil {
+	if err = jwt.Claims(p.getKey(jwt.Headers[0].KeyID), &claims); err != nil {
 		return nil, errs.Wrap(http.StatusUnauthorized, err, "jwk.authorizeToken; error parsing jwk claims")
 	}
 
@@ -156,6 +201,9 @@ func (p *JWK) AuthorizeRevoke(_ context.Context, token string) error {
 
 // AuthorizeSign validates the given token.
 func (p *JWK) AuthorizeSign(ctx context.Context, token string) ([]SignOption, error) {
+	if err := p.ctl.AuthorizeIssuance(); err != nil {
+		return nil, err
+	}
 	claims, err := p.authorizeToken(token, p.ctl.Audiences.Sign)
 	if err != nil {
 		return nil, errs.Wrap(http.StatusInternalServerError, err, "jwk.AuthorizeSign")
@@ -203,9 +251,9 @@ func (p *JWK) AuthorizeSign(ctx context.Context, token string) ([]SignOption, er
 		// validators
 		csrFingerprintValidator(fingerprint),
 		commonNameSliceValidator(append([]string{claims.Subject}, claims.SANs...)),
-		defaultPublicKeyValidator{},
+		defaultPublicKeyValidator{keys: p.ctl.Claimer.KeyClaims()},
 		newDefaultSANsValidator(ctx, claims.SANs),
-		newValidityValidator(p.ctl.Claimer.MinTLSCertDuration(), p.ctl.Claimer.MaxTLSCertDuration()),
+		newClaimsValidityValidator(p.ctl.Claimer),
 		newX509NamePolicyValidator(p.ctl.getPolicy().getX509()),
 		p.ctl.newWebhookController(data, linkedca.Webhook_X509),
 	}, nil
@@ -222,6 +270,9 @@ func (p *JWK) AuthorizeRenew(ctx context.Context, cert *x509.Certificate) error
 
 // AuthorizeSSHSign returns the list of SignOption for a SignSSH request.
 func (p *JWK) AuthorizeSSHSign(_ context.Context, token string) ([]SignOption, error) {
+	if err := p.ctl.AuthorizeIssuance(); err != nil {
+		return nil, err
+	}
 	if !p.ctl.Claimer.IsSSHCAEnabled() {
 		return nil, errs.Unauthorized("jwk.AuthorizeSSHSign; sshCA is disabled for jwk provisioner '%s'", p.GetName())
 	}
@@ -285,7 +336,7 @@ func (p *JWK) AuthorizeSSHSign(_ context.Context, token string) ([]SignOption, e
 		// Set the validity bounds if not set.
 		&sshDefaultDuration{p.ctl.Claimer},
 		// Validate public key
-		&sshDefaultPublicKeyValidator{},
+		&sshDefaultPublicKeyValidator{keys: p.ctl.Claimer.KeyClaims()},
 		// Validate the validity period.
 		&sshCertValidityValidator{p.ctl.Claimer},
 		// Require and validate all the default fields in the SSH certificate.
@@ -46,6 +46,15 @@ func TestJWK_Getters(t *testing.T) {
 	}
 }
 
+func TestJWK_GetIDsForToken(t *testing.T) {
+	p, err := generateJWK()
+	assert.FatalError(t, err)
+	assert.Equals(t, []string{}, p.GetIDsForToken())
+
+	p.Keys = []*jose.JSONWebKey{{KeyID: "foo"}, {KeyID: "bar"}}
+	assert.Equals(t, []string{p.Name + ":foo", p.Name + ":bar"}, p.GetIDsForToken())
+}
+
 func TestJWK_Init(t *testing.T) {
 	type ProvisionerValidateTest struct {
 		p   *JWK
@@ -84,11 +93,48 @@ func TestJWK_Init(t *testing.T) {
 				err: errors.New("claims: MinTLSCertDuration must be greater than 0"),
 			}
 		},
+		"fail-keys-empty": func(t *testing.T) ProvisionerValidateTest {
+			return ProvisionerValidateTest{
+				p:   &JWK{Name: "foo", Type: "bar", Key: &jose.JSONWebKey{}, Keys: []*jose.JSONWebKey{nil}},
+				err: errors.New("provisioner keys cannot contain empty keys"),
+			}
+		},
+		"fail-keys-kid": func(t *testing.T) ProvisionerValidateTest {
+			return ProvisionerValidateTest{
+				p:   &JWK{Name: "foo", Type: "bar", Key: &jose.JSONWebKey{}, Keys: []*jose.JSONWebKey{{}}},
+				err: errors.New("provisioner keys must have a key id"),
+			}
+		},
+		"fail-keys-duplicated": func(t *testing.T) ProvisionerValidateTest {
+			key, err := generateJSONWebKey()
+			assert.FatalError(t, err)
+			pub := key.Public()
+			return ProvisionerValidateTest{
+				p:   &JWK{Name: "foo", Type: "bar", Key: &pub, Keys: []*jose.JSONWebKey{&pub}},
+				err: fmt.Errorf("provisioner keys cannot contain duplicated key id %s", pub.KeyID),
+			}
+		},
+		"fail-keys-private": func(t *testing.T) ProvisionerValidateTest {
+			key, err := generateJSONWebKey()
+			assert.FatalError(t, err)
+			return ProvisionerValidateTest{
+				p:   &JWK{Name: "foo", Type: "bar", Key: &jose.JSONWebKey{}, Keys: []*jose.JSONWebKey{key}},
+				err: fmt.Errorf("provisioner key %s must be a public key", key.KeyID),
+			}
+		},
 		"ok": func(t *testing.T) ProvisionerValidateTest {
 			return ProvisionerValidateTest{
 				p: &JWK{Name: "foo", Type: "bar", Key: &jose.JSONWebKey{}},
 			}
 		},
+		"ok-keys": func(t *testing.T) ProvisionerValidateTest {
+			key, err := generateJSONWebKey()
+			assert.FatalError(t, err)
+			pub := key.Public()
+			return ProvisionerValidateTest{
+				p: &JWK{Name: "foo", Type: "bar", Key: &jose.JSONWebKey{}, Keys: []*jose.JSONWebKey{&pub}},
+			}
+		},
 	}
 
 	config := Config{
@@ -160,6 +206,15 @@ func TestJWK_authorizeToken(t *testing.T) {
 	// Remove encrypted key for p2
 	p2.EncryptedKey = ""
 
+	// p3 has an additional key
+	key4, err := generateJSONWebKey()
+	assert.FatalError(t, err)
+	pub4 := key4.Public()
+	p3 := *p1
+	p3.Keys = []*jose.JSONWebKey{&pub4}
+	t4, err := generateSimpleToken(p1.Name, testAudiences.Sign[0], key4)
+	assert.FatalError(t, err)
+
 	type args struct {
 		token string
 	}
@@ -182,6 +237,9 @@ func TestJWK_authorizeToken(t *testing.T) {
 		{"ok", p1, args{t1}, http.StatusOK, nil},
 		{"ok-no-encrypted-key", p2, args{t2}, http.StatusOK, nil},
 		{"ok-no-sans", p1, args{t3}, http.StatusOK, nil},
+		{"ok-additional-key", &p3, args{t4}, http.StatusOK, nil},
+		{"ok-main-key-with-additional-keys", &p3, args{t1}, http.StatusOK, nil},
+		{"fail-additional-key", p1, args{t4}, http.StatusUnauthorized, errors.New("jwk.authorizeToken; error parsing jwk claims")},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -255,6 +313,18 @@ func TestJWK_AuthorizeSign(t *testing.T) {
 	// invalid signature
 	failSig := t1[0 : len(t1)-2]
 
+	// renew-only provisioner
+	p2, err := generateJWK()
+	assert.FatalError(t, err)
+	renewOnly := globalProvisionerClaims
+	renewOnly.State = StateRenewOnly
+	p2.ctl, err = NewController(p2, &renewOnly, Config{Audiences: testAudiences}, nil)
+	assert.FatalError(t, err)
+	key2, err := decryptJSONWebKey(p2.EncryptedKey)
+	assert.FatalError(t, err)
+	t4, err := generateToken("subject", p2.Name, testAudiences.Sign[0], "name@smallstep.com", []string{}, time.Now(), key2)
+	assert.FatalError(t, err)
+
 	type args struct {
 		token string
 	}
@@ -274,6 +344,13 @@ func TestJWK_AuthorizeSign(t *testing.T) {
 			code: http.StatusUnauthorized,
 			err:  errors.New("jwk.AuthorizeSign: jwk.authorizeToken; error parsing jwk claims: go-jose/go-jose: error in cryptographic primitive"),
 		},
+		{
+			name: "fail-renew-only",
+			prov: p2,
+			args: args{t4},
+			code: http.StatusUnauthorized,
+			err:  fmt.Errorf("provisioner '%s' is in renew-only mode and cannot issue new certificates", p2.Name),
+		},
 		{
 			name: "ok-sans",
 			prov: p1,
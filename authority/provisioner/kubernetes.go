@@ -0,0 +1,376 @@
+package provisioner
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"go.step.sm/crypto/jose"
+	"go.step.sm/crypto/x509util"
+	"go.step.sm/linkedca"
+
+	"github.com/smallstep/certificates/errs"
+	"github.com/smallstep/certificates/webhook"
+)
+
+const (
+	// KubernetesDefaultTrustDomain is the trust domain used in the default
+	// SPIFFE ID of the Kubernetes provisioner.
+	KubernetesDefaultTrustDomain = "cluster.local"
+	// kubernetesTokenFile is the token of the service account of a pod.
+	kubernetesTokenFile = "/var/run/secrets/kubernetes.io/serviceaccount/token" //nolint:gosec // path to the token
+	// kubernetesTokenReviewPath is the path of the TokenReview API.
+	kubernetesTokenReviewPath = "/apis/authentication.k8s.io/v1/tokenreviews"
+)
+
+// kubernetesPayload represents the fields of a bound service account token.
+type kubernetesPayload struct {
+	jose.Claims
+	Kubernetes struct {
+		Namespace      string `json:"namespace"`
+		ServiceAccount struct {
+			Name string `json:"name"`
+			UID  string `json:"uid"`
+		} `json:"serviceaccount"`
+		Pod struct {
+			Name string `json:"name"`
+			UID  string `json:"uid"`
+		} `json:"pod"`
+	} `json:"kubernetes.io"`
+}
+
+// kubernetesTokenReview is the request and response of the TokenReview API.
+type kubernetesTokenReview struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Spec       struct {
+		Token     string   `json:"token"`
+		Audiences []string `json:"audiences,omitempty"`
+	} `json:"spec"`
+	Status struct {
+		Authenticated bool `json:"authenticated"`
+		User          struct {
+			Username string `json:"username"`
+		} `json:"user"`
+		Audiences []string `json:"audiences"`
+		Error     string   `json:"error"`
+	} `json:"status"`
+}
+
+// Kubernetes is a provisioner that authorizes Kubernetes workloads using bound
+// service account tokens. Unlike K8sSA, it does not require the service
+// account signing key, and multiple provisioners can be used, one per cluster.
+//
+// Tokens are validated using the TokenReview API of the cluster, if apiServer
+// is set, or using the OIDC discovery document of the cluster, if issuer is
+// set.
+//
+// The token audience must be the sign URL of the CA with the fragment
+// "kubernetes/<name>", e.g., https://ca.example.com/1.0/sign#kubernetes/prod,
+// and it can be requested using a projected volume in the pod.
+//
+// The default certificate uses the service account name as the common name,
+// and the SPIFFE ID spiffe://<trustDomain>/ns/<namespace>/sa/<name> as the
+// SAN. The SANs in the certificate request are ignored.
+//
+// Bound tokens are reused by the pods until they are rotated, so, like in the
+// K8sSA provisioner, the same token can be used multiple times.
+type Kubernetes struct {
+	*base
+	ID   string `json:"-"`
+	Type string `json:"type"`
+	Name string `json:"name"`
+	// Issuer is the service account issuer of the cluster, the keys are read
+	// from its OpenID configuration.
+	Issuer string `json:"issuer,omitempty"`
+	// APIServer is the URL of the Kubernetes API server used to review the
+	// tokens.
+	APIServer string `json:"apiServer,omitempty"`
+	// Roots are the PEM encoded certificates used to verify the API server.
+	Roots []byte `json:"roots,omitempty"`
+	// TokenFile is the file with the token used to authenticate against the
+	// API server, it defaults to the service account token of the pod. The
+	// service account must be allowed to create tokenreviews.
+	TokenFile string `json:"tokenFile,omitempty"`
+	// ServiceAccounts is the list of service accounts, "namespace/name",
+	// allowed.
+	ServiceAccounts []string `json:"serviceAccounts"`
+	// TrustDomain is the trust domain used in the default SPIFFE ID, it
+	// defaults to KubernetesDefaultTrustDomain.
+	TrustDomain string   `json:"trustDomain,omitempty"`
+	Claims      *Claims  `json:"claims,omitempty"`
+	Options     *Options `json:"options,omitempty"`
+	httpClient  *http.Client
+	keyStore    *keyStore
+	ctl         *Controller
+}
+
+// GetID returns the provisioner unique identifier.
+func (p *Kubernetes) GetID() string {
+	if p.ID != "" {
+		return p.ID
+	}
+	return p.GetIDForToken()
+}
+
+// GetIDForToken returns an identifier that will be used to load the provisioner
+// from a token.
+func (p *Kubernetes) GetIDForToken() string {
+	return "kubernetes/" + p.Name
+}
+
+// GetTokenID returns an unimplemented error, bound service account tokens are
+// reused until they are rotated.
+func (p *Kubernetes) GetTokenID(string) (string, error) {
+	return "", errors.New("not implemented")
+}
+
+// GetName returns the name of the provisioner.
+func (p *Kubernetes) GetName() string {
+	return p.Name
+}
+
+// GetType returns the type of provisioner.
+func (p *Kubernetes) GetType() Type {
+	return TypeKubernetes
+}
+
+// GetEncryptedKey is not available in a Kubernetes provisioner.
+func (p *Kubernetes) GetEncryptedKey() (kid, key string, ok bool) {
+	return "", "", false
+}
+
+// GetOptions returns the configured provisioner options.
+func (p *Kubernetes) GetOptions() *Options {
+	return p.Options
+}
+
+// Init validates and initializes the Kubernetes provisioner.
+func (p *Kubernetes) Init(config Config) (err error) {
+	switch {
+	case p.Type == "":
+		return errors.New("provisioner type cannot be empty")
+	case p.Name == "":
+		return errors.New("provisioner name cannot be empty")
+	case p.Issuer == "" && p.APIServer == "":
+		return errors.New("provisioner issuer or apiServer must be set")
+	case p.Issuer != "" && p.APIServer != "":
+		return errors.New("provisioner issuer and apiServer cannot be used together")
+	case len(p.ServiceAccounts) == 0:
+		return errors.New("provisioner serviceAccounts cannot be empty")
+	}
+	if err := validatePatterns(p.ServiceAccounts); err != nil {
+		return err
+	}
+	if p.TrustDomain == "" {
+		p.TrustDomain = KubernetesDefaultTrustDomain
+	}
+
+	config.Audiences = config.Audiences.WithFragment(p.GetIDForToken())
+	if p.ctl, err = NewController(p, p.Claims, config, p.Options); err != nil {
+		return
+	}
+
+	if p.Issuer != "" {
+		p.keyStore, err = newIssuerKeyStore(p.ctl.GetHTTPClient(), p.Issuer)
+		return
+	}
+
+	if u, err := url.Parse(p.APIServer); err != nil || u.Scheme != "https" || u.Host == "" {
+		return errors.Errorf("provisioner apiServer %q is not a valid URL", p.APIServer)
+	}
+	if p.TokenFile == "" {
+		p.TokenFile = kubernetesTokenFile
+	}
+	p.httpClient = p.ctl.GetHTTPClient()
+	if len(p.Roots) > 0 {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(p.Roots) {
+			return errors.New("error parsing provisioner roots: no certificates found")
+		}
+		p.httpClient = &http.Client{
+			Transport: &http.Transport{
+				Proxy: http.ProxyFromEnvironment,
+				TLSClientConfig: &tls.Config{
+					RootCAs:    pool,
+					MinVersion: tls.VersionTLS12,
+				},
+			},
+		}
+	}
+	return nil
+}
+
+// reviewToken validates the token using the TokenReview API and returns the
+// username of the service account.
+func (p *Kubernetes) reviewToken(ctx context.Context, token string, audiences []string) (string, error) {
+	bearer, err := os.ReadFile(p.TokenFile)
+	if err != nil {
+		return "", errors.Wrapf(err, "error reading %s", p.TokenFile)
+	}
+
+	review := kubernetesTokenReview{
+		APIVersion: "authentication.k8s.io/v1",
+		Kind:       "TokenReview",
+	}
+	review.Spec.Token = token
+	review.Spec.Audiences = audiences
+	body, err := json.Marshal(review)
+	if err != nil {
+		return "", errors.Wrap(err, "error marshaling token review")
+	}
+
+	uri := strings.TrimSuffix(p.APIServer, "/") + kubernetesTokenReviewPath
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, uri, bytes.NewReader(body))
+	if err != nil {
+		return "", errors.Wrap(err, "error creating token review request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+string(bytes.TrimSpace(bearer)))
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to connect to %s", uri)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		return "", errors.Errorf("error creating token review: %s responded with status code %d", uri, resp.StatusCode)
+	}
+
+	var result kubernetesTokenReview
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", errors.Wrapf(err, "error reading %s", uri)
+	}
+	switch {
+	case result.Status.Error != "":
+		return "", errors.Errorf("error reviewing token: %s", result.Status.Error)
+	case !result.Status.Authenticated:
+		return "", errors.New("error reviewing token: token is not authenticated")
+	case len(result.Status.Audiences) == 0:
+		return "", errors.New("error reviewing token: token audiences are not valid")
+	}
+	return result.Status.User.Username, nil
+}
+
+// authorizeToken validates the token, using the TokenReview API or the keys of
+// the issuer, and returns the claims.
+func (p *Kubernetes) authorizeToken(ctx context.Context, token string, audiences []string) (*kubernetesPayload, error) {
+	jwt, err := jose.ParseSigned(token)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusUnauthorized, err, "kubernetes.authorizeToken; error parsing token")
+	}
+	if len(jwt.Headers) == 0 {
+		return nil, errs.Unauthorized("kubernetes.authorizeToken; error parsing token - header is missing")
+	}
+
+	var claims kubernetesPayload
+	if p.keyStore != nil {
+		var found bool
+		kid := jwt.Headers[0].KeyID
+		for _, key := range p.keyStore.Get(kid) {
+			if err := jwt.Claims(key, &claims); err == nil {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, errs.Unauthorized("kubernetes.authorizeToken; cannot validate token - cannot find key for kid %s", kid)
+		}
+		// According to "rfc7519 JSON Web Token" acceptable skew should be no
+		// more than a few minutes.
+		if err := claims.ValidateWithLeeway(jose.Expected{
+			Issuer: p.Issuer,
+			Time:   time.Now().UTC(),
+		}, time.Minute); err != nil {
+			return nil, errs.Wrap(http.StatusUnauthorized, err, "kubernetes.authorizeToken; invalid token claims")
+		}
+		if !matchesAudience(claims.Audience, audiences) {
+			return nil, errs.Unauthorized("kubernetes.authorizeToken; invalid token audience claim (aud)")
+		}
+	} else {
+		// The claims are trusted once the API server has reviewed the token.
+		if err := jwt.UnsafeClaimsWithoutVerification(&claims); err != nil {
+			return nil, errs.Wrap(http.StatusUnauthorized, err, "kubernetes.authorizeToken; error parsing token claims")
+		}
+		if !matchesAudience(claims.Audience, audiences) {
+			return nil, errs.Unauthorized("kubernetes.authorizeToken; invalid token audience claim (aud)")
+		}
+		username, err := p.reviewToken(ctx, token, audiences)
+		if err != nil {
+			return nil, errs.Wrap(http.StatusUnauthorized, err, "kubernetes.authorizeToken; invalid token")
+		}
+		if username != claims.Subject {
+			return nil, errs.Unauthorized("kubernetes.authorizeToken; token subject %s does not match the user %s", claims.Subject, username)
+		}
+	}
+
+	namespace, name := claims.Kubernetes.Namespace, claims.Kubernetes.ServiceAccount.Name
+	switch {
+	case namespace == "" || name == "":
+		return nil, errs.Unauthorized("kubernetes.authorizeToken; token is not a bound service account token")
+	case claims.Subject != "system:serviceaccount:"+namespace+":"+name:
+		return nil, errs.Unauthorized("kubernetes.authorizeToken; token subject %s is not valid", claims.Subject)
+	case !matchesPatterns(p.ServiceAccounts, namespace+"/"+name):
+		return nil, errs.Unauthorized("kubernetes.authorizeToken; service account %s/%s is not allowed", namespace, name)
+	}
+
+	return &claims, nil
+}
+
+// AuthorizeSign validates the given token and returns the sign options that
+// will be used on certificate creation.
+func (p *Kubernetes) AuthorizeSign(ctx context.Context, token string) ([]SignOption, error) {
+	if err := p.ctl.AuthorizeIssuance(); err != nil {
+		return nil, err
+	}
+	claims, err := p.authorizeToken(ctx, token, p.ctl.Audiences.Sign)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "kubernetes.AuthorizeSign")
+	}
+
+	// Certificate templates
+	namespace, name := claims.Kubernetes.Namespace, claims.Kubernetes.ServiceAccount.Name
+	data := x509util.CreateTemplateData(name, []string{
+		"spiffe://" + p.TrustDomain + "/ns/" + namespace + "/sa/" + name,
+	})
+	if v, err := unsafeParseSigned(token); err == nil {
+		data.SetToken(v)
+	}
+
+	templateOptions, err := CustomTemplateOptions(p.Options, data, x509util.DefaultLeafTemplate)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "kubernetes.AuthorizeSign")
+	}
+
+	return []SignOption{
+		p,
+		templateOptions,
+		// modifiers / withOptions
+		newProvisionerExtensionOption(TypeKubernetes, p.Name, claims.Kubernetes.ServiceAccount.UID,
+			"Namespace", namespace, "ServiceAccount", name).WithControllerOptions(p.ctl),
+		profileDefaultDuration(p.ctl.Claimer.DefaultTLSCertDuration()),
+		// validators
+		defaultPublicKeyValidator{keys: p.ctl.Claimer.KeyClaims()},
+		newClaimsValidityValidator(p.ctl.Claimer),
+		newX509NamePolicyValidator(p.ctl.getPolicy().getX509()),
+		p.ctl.newWebhookController(
+			data,
+			linkedca.Webhook_X509,
+			webhook.WithAuthorizationPrincipal(claims.Subject),
+		),
+	}, nil
+}
+
+// AuthorizeRenew returns an error if the renewal is disabled.
+func (p *Kubernetes) AuthorizeRenew(ctx context.Context, cert *x509.Certificate) error {
+	return p.ctl.AuthorizeRenew(ctx, cert)
+}
@@ -0,0 +1,251 @@
+package provisioner
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.step.sm/crypto/jose"
+
+	"github.com/smallstep/certificates/api/render"
+)
+
+func generateKubernetesToken(t *testing.T, p *Kubernetes, iss string, jwk *jose.JSONWebKey, namespace, name string) string {
+	t.Helper()
+	tok, err := generateCustomToken("system:serviceaccount:"+namespace+":"+name, iss,
+		testAudiences.Sign[0]+"#"+p.GetIDForToken(), jwk, nil, map[string]any{
+			"kubernetes.io": map[string]any{
+				"namespace": namespace,
+				"serviceaccount": map[string]any{
+					"name": name,
+					"uid":  "c0c1c2c3-d4d5-e6e7-f8f9-000102030405",
+				},
+				"pod": map[string]any{
+					"name": name + "-7d4b9c",
+					"uid":  "a0a1a2a3-b4b5-c6c7-d8d9-e0e1e2e3e4e5",
+				},
+			},
+		})
+	require.NoError(t, err)
+	return tok
+}
+
+// generateTokenReviewServer returns an API server that authenticates the
+// tokens in the authenticated map.
+func generateTokenReviewServer(t *testing.T, bearer string, authenticated map[string]string) *httptest.Server {
+	t.Helper()
+	return httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != kubernetesTokenReviewPath || r.Method != http.MethodPost {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer "+bearer {
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		var review kubernetesTokenReview
+		if err := json.NewDecoder(r.Body).Decode(&review); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if username, ok := authenticated[review.Spec.Token]; ok {
+			review.Status.Authenticated = true
+			review.Status.User.Username = username
+			review.Status.Audiences = review.Spec.Audiences
+		} else {
+			review.Status.Error = "invalid bearer token"
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(review)
+	}))
+}
+
+func TestKubernetes_Getters(t *testing.T) {
+	p := &Kubernetes{Type: "Kubernetes", Name: "prod"}
+	assert.Equal(t, "kubernetes/prod", p.GetID())
+	assert.Equal(t, "kubernetes/prod", p.GetIDForToken())
+	assert.Equal(t, "prod", p.GetName())
+	assert.Equal(t, TypeKubernetes, p.GetType())
+	assert.Equal(t, "Kubernetes", p.GetType().String())
+	kid, key, ok := p.GetEncryptedKey()
+	assert.Empty(t, kid)
+	assert.Empty(t, key)
+	assert.False(t, ok)
+	_, err := p.GetTokenID("token")
+	assert.Error(t, err)
+}
+
+func TestKubernetes_Init(t *testing.T) {
+	srv := generateJWKServer(2)
+	defer srv.Close()
+
+	config := Config{Claims: globalProvisionerClaims, Audiences: testAudiences}
+	sas := []string{"default/*"}
+	tests := []struct {
+		name    string
+		p       *Kubernetes
+		wantErr bool
+	}{
+		{"ok issuer", &Kubernetes{Type: "Kubernetes", Name: "prod", Issuer: srv.URL, ServiceAccounts: sas}, false},
+		{"ok apiServer", &Kubernetes{Type: "Kubernetes", Name: "prod", APIServer: "https://10.0.0.1", ServiceAccounts: sas}, false},
+		{"fail type", &Kubernetes{Name: "prod", Issuer: srv.URL, ServiceAccounts: sas}, true},
+		{"fail name", &Kubernetes{Type: "Kubernetes", Issuer: srv.URL, ServiceAccounts: sas}, true},
+		{"fail no issuer", &Kubernetes{Type: "Kubernetes", Name: "prod", ServiceAccounts: sas}, true},
+		{"fail both", &Kubernetes{Type: "Kubernetes", Name: "prod", Issuer: srv.URL, APIServer: "https://10.0.0.1", ServiceAccounts: sas}, true},
+		{"fail serviceAccounts", &Kubernetes{Type: "Kubernetes", Name: "prod", Issuer: srv.URL}, true},
+		{"fail pattern", &Kubernetes{Type: "Kubernetes", Name: "prod", Issuer: srv.URL, ServiceAccounts: []string{"default/["}}, true},
+		{"fail openid-configuration", &Kubernetes{Type: "Kubernetes", Name: "prod", Issuer: srv.URL + "/error", ServiceAccounts: sas}, true},
+		{"fail apiServer", &Kubernetes{Type: "Kubernetes", Name: "prod", APIServer: "http://10.0.0.1", ServiceAccounts: sas}, true},
+		{"fail roots", &Kubernetes{Type: "Kubernetes", Name: "prod", APIServer: "https://10.0.0.1", Roots: []byte("foo"), ServiceAccounts: sas}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.p.Init(config)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, KubernetesDefaultTrustDomain, tt.p.TrustDomain)
+			assert.Equal(t, []string{
+				"https://ca.smallstep.com/1.0/sign#kubernetes/prod",
+				"https://ca.smallstep.com/sign#kubernetes/prod",
+			}, tt.p.ctl.Audiences.Sign)
+		})
+	}
+}
+
+func TestKubernetes_authorizeToken(t *testing.T) {
+	srv := generateJWKServer(2)
+	defer srv.Close()
+
+	var keys jose.JSONWebKeySet
+	require.NoError(t, getAndDecode(srv.Client(), srv.URL+"/private", &keys))
+	otherKey, err := generateJSONWebKey()
+	require.NoError(t, err)
+
+	config := Config{Claims: globalProvisionerClaims, Audiences: testAudiences}
+	sas := []string{"default/*", "kube-system/cert-manager"}
+
+	// Validation using the OIDC discovery document.
+	pi := &Kubernetes{Type: "Kubernetes", Name: "prod", Issuer: srv.URL, ServiceAccounts: sas}
+	require.NoError(t, pi.Init(config))
+
+	// Validation using the TokenReview API.
+	pa := &Kubernetes{Type: "Kubernetes", Name: "prod", ServiceAccounts: sas}
+	okToken := generateKubernetesToken(t, pa, "https://kubernetes.default.svc", otherKey, "default", "app")
+	forbiddenToken := generateKubernetesToken(t, pa, "https://kubernetes.default.svc", otherKey, "other", "app")
+	mismatchToken := generateKubernetesToken(t, pa, "https://kubernetes.default.svc", otherKey, "default", "app2")
+	apiSrv := generateTokenReviewServer(t, "reviewer-token", map[string]string{
+		okToken:        "system:serviceaccount:default:app",
+		forbiddenToken: "system:serviceaccount:other:app",
+		mismatchToken:  "system:serviceaccount:default:app",
+	})
+	defer apiSrv.Close()
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, os.WriteFile(tokenFile, []byte("reviewer-token\n"), 0600))
+	pa.APIServer = apiSrv.URL
+	pa.TokenFile = tokenFile
+	pa.Roots = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: apiSrv.Certificate().Raw})
+	require.NoError(t, pa.Init(config))
+
+	badBearer := &Kubernetes{Type: "Kubernetes", Name: "prod", APIServer: apiSrv.URL, ServiceAccounts: sas, Roots: pa.Roots}
+	badBearer.TokenFile = filepath.Join(t.TempDir(), "token")
+	require.NoError(t, os.WriteFile(badBearer.TokenFile, []byte("foo"), 0600))
+	require.NoError(t, badBearer.Init(config))
+
+	otherAudience, err := generateCustomToken("system:serviceaccount:default:app", srv.URL, testAudiences.Sign[0]+"#kubernetes/other", &keys.Keys[0], nil, nil)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		p       *Kubernetes
+		token   string
+		wantErr bool
+	}{
+		{"ok issuer", pi, generateKubernetesToken(t, pi, srv.URL, &keys.Keys[0], "default", "app"), false},
+		{"ok issuer exact", pi, generateKubernetesToken(t, pi, srv.URL, &keys.Keys[1], "kube-system", "cert-manager"), false},
+		{"ok apiServer", pa, okToken, false},
+		{"fail token", pi, "foo", true},
+		{"fail issuer key", pi, generateKubernetesToken(t, pi, srv.URL, otherKey, "default", "app"), true},
+		{"fail issuer iss", pi, generateKubernetesToken(t, pi, "https://other.example.com", &keys.Keys[0], "default", "app"), true},
+		{"fail issuer audience", pi, otherAudience, true},
+		{"fail issuer not bound", pi, func() string {
+			tok, err := generateCustomToken("system:serviceaccount:default:app", srv.URL, testAudiences.Sign[0]+"#kubernetes/prod", &keys.Keys[0], nil, nil)
+			require.NoError(t, err)
+			return tok
+		}(), true},
+		{"fail issuer service account", pi, generateKubernetesToken(t, pi, srv.URL, &keys.Keys[0], "kube-system", "default"), true},
+		{"fail apiServer not authenticated", pa, generateKubernetesToken(t, pa, "https://kubernetes.default.svc", otherKey, "default", "other"), true},
+		{"fail apiServer service account", pa, forbiddenToken, true},
+		{"fail apiServer username", pa, mismatchToken, true},
+		{"fail apiServer bearer", badBearer, okToken, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.p.authorizeToken(context.Background(), tt.token, tt.p.ctl.Audiences.Sign)
+			if tt.wantErr {
+				var sc render.StatusCodedError
+				require.ErrorAs(t, err, &sc)
+				assert.Equal(t, http.StatusUnauthorized, sc.StatusCode())
+				assert.Nil(t, got)
+				return
+			}
+			require.NoError(t, err)
+			assert.NotEmpty(t, got.Kubernetes.Namespace)
+			assert.NotEmpty(t, got.Kubernetes.ServiceAccount.Name)
+		})
+	}
+}
+
+func TestKubernetes_AuthorizeSign(t *testing.T) {
+	srv := generateJWKServer(1)
+	defer srv.Close()
+
+	var keys jose.JSONWebKeySet
+	require.NoError(t, getAndDecode(srv.Client(), srv.URL+"/private", &keys))
+
+	p := &Kubernetes{Type: "Kubernetes", Name: "prod", Issuer: srv.URL, ServiceAccounts: []string{"default/*"}, TrustDomain: "prod.example.com"}
+	require.NoError(t, p.Init(Config{Claims: globalProvisionerClaims, Audiences: testAudiences}))
+
+	t.Run("ok", func(t *testing.T) {
+		opts, err := p.AuthorizeSign(context.Background(), generateKubernetesToken(t, p, srv.URL, &keys.Keys[0], "default", "app"))
+		require.NoError(t, err)
+		assert.Len(t, opts, 8)
+		for _, o := range opts {
+			switch v := o.(type) {
+			case *Kubernetes:
+			case certificateOptionsFunc:
+			case *provisionerExtensionOption:
+				assert.Equal(t, TypeKubernetes, v.Type)
+				assert.Equal(t, "prod", v.Name)
+				assert.Equal(t, "c0c1c2c3-d4d5-e6e7-f8f9-000102030405", v.CredentialID)
+				assert.Equal(t, []string{"Namespace", "default", "ServiceAccount", "app"}, v.KeyValuePairs)
+			case profileDefaultDuration:
+			case defaultPublicKeyValidator:
+			case *validityValidator:
+			case *x509NamePolicyValidator:
+			case *WebhookController:
+				assert.Empty(t, v.webhooks)
+			default:
+				assert.FailNow(t, "unexpected sign option", "%T", v)
+			}
+		}
+	})
+
+	t.Run("fail", func(t *testing.T) {
+		_, err := p.AuthorizeSign(context.Background(), generateKubernetesToken(t, p, srv.URL, &keys.Keys[0], "kube-system", "app"))
+		var sc render.StatusCodedError
+		require.ErrorAs(t, err, &sc)
+		assert.Equal(t, http.StatusUnauthorized, sc.StatusCode())
+	})
+}
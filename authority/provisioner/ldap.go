@@ -0,0 +1,600 @@
+package provisioner
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/pkg/errors"
+
+	"go.step.sm/crypto/jose"
+	"go.step.sm/crypto/sshutil"
+	"go.step.sm/crypto/x509util"
+	"go.step.sm/linkedca"
+
+	"github.com/smallstep/certificates/errs"
+)
+
+// LDAPHeader is the name of the token header that contains the password of
+// the user.
+const LDAPHeader = "ldap"
+
+// ldapUsernamePlaceholder is replaced in the user filter and the user DN
+// template with the username.
+const ldapUsernamePlaceholder = "{username}"
+
+// ldapTimeout is the timeout used in the connections to the LDAP server.
+const ldapTimeout = 10 * time.Second
+
+// ldapEntry contains the attributes of an authenticated LDAP user.
+type ldapEntry struct {
+	DN         string
+	Attributes map[string][]string
+}
+
+// claims returns the attributes of the entry in the format expected by the
+// claim rules.
+func (e *ldapEntry) claims() map[string]any {
+	m := make(map[string]any, len(e.Attributes))
+	for k, values := range e.Attributes {
+		vs := make([]any, len(values))
+		for i, v := range values {
+			vs[i] = v
+		}
+		m[k] = vs
+	}
+	return m
+}
+
+// values returns the values of the given attributes.
+func (e *ldapEntry) values(attributes []string) []string {
+	var ret []string
+	for _, name := range attributes {
+		ret = appendUnique(ret, e.Attributes[name]...)
+	}
+	return ret
+}
+
+// ldapPayload extends jwtPayload with the LDAP entry of the user.
+type ldapPayload struct {
+	jwtPayload
+	entry  *ldapEntry
+	grants oidcClaimGrants
+}
+
+// LDAP is a provisioner that authorizes the issuance of certificates to users
+// of an LDAP directory, like Active Directory, by binding to the directory
+// with the user credentials.
+//
+// An LDAP token is a JWT signed by an ephemeral key included in the "jwk"
+// header. The subject of the token is the username, and the "ldap" header
+// contains the password of the user, so the token must only be sent to the
+// CA, and it can be used only once.
+//
+// If BindDN is set, the provisioner binds with it to search the user using the
+// UserFilter, and then binds with the DN of the user. Otherwise it binds with
+// the UserDNTemplate and searches the user entry with the user credentials.
+//
+// The username is the subject of the certificates, the values of the
+// attributes in SANAttributes and PrincipalAttributes are added as SANs and SSH
+// principals, and AttributeRules can map other attributes, like the memberOf
+// groups, to admin rights, SANs and principals. The names in the token must be
+// a subset of those, if the token doesn't have names, all of them are used.
+type LDAP struct {
+	*base
+	ID   string `json:"-"`
+	Type string `json:"type"`
+	Name string `json:"name"`
+	// URL is the URL of the LDAP server, e.g. ldaps://ldap.example.com, or
+	// ldap://ldap.example.com if StartTLS is used.
+	URL string `json:"url"`
+	// StartTLS upgrades ldap:// connections to TLS. Plain text connections
+	// are not allowed.
+	StartTLS bool `json:"startTLS,omitempty"`
+	// Roots are the PEM encoded roots used to verify the LDAP server, it
+	// defaults to the system roots.
+	Roots []byte `json:"roots,omitempty"`
+	// BindDN and BindPassword are the credentials used to search users.
+	BindDN       string `json:"bindDN,omitempty"`
+	BindPassword string `json:"bindPassword,omitempty"`
+	// UserDNTemplate is the DN used to bind if BindDN is not set, the string
+	// "{username}" is replaced with the username, e.g.
+	// "uid={username},ou=people,dc=example,dc=com" or "{username}@example.com"
+	// in Active Directory. It defaults to "{username}".
+	UserDNTemplate string `json:"userDNTemplate,omitempty"`
+	// BaseDN is the base of the user search.
+	BaseDN string `json:"baseDN"`
+	// UserFilter is the filter used to search the user, it defaults to
+	// "(uid={username})", e.g. "(sAMAccountName={username})" in Active
+	// Directory.
+	UserFilter string `json:"userFilter,omitempty"`
+	// SANAttributes are the names of the attributes mapped to certificate
+	// SANs, e.g. "mail".
+	SANAttributes []string `json:"sanAttributes,omitempty"`
+	// PrincipalAttributes are the names of the attributes mapped to SSH
+	// principals.
+	PrincipalAttributes []string `json:"principalAttributes,omitempty"`
+	// MailAttributes are the names of the attributes that contain the
+	// mailboxes of the user verified by the directory. If the smime options
+	// are set, these mailboxes are allowed in the certificates and they are
+	// considered verified. It defaults to "mail".
+	MailAttributes []string `json:"mailAttributes,omitempty"`
+	// AttributeRules maps attribute values to admin rights, SANs and
+	// principals, the Claim of a rule is the name of an attribute.
+	AttributeRules []OIDCClaimRule `json:"attributeRules,omitempty"`
+	Claims         *Claims         `json:"claims,omitempty"`
+	Options        *Options        `json:"options,omitempty"`
+	ctl            *Controller
+	tlsConfig      *tls.Config
+	dial           func() (ldap.Client, error)
+}
+
+// GetID returns the provisioner unique identifier.
+func (p *LDAP) GetID() string {
+	if p.ID != "" {
+		return p.ID
+	}
+	return p.GetIDForToken()
+}
+
+// GetIDForToken returns an identifier that will be used to load the provisioner
+// from a token.
+func (p *LDAP) GetIDForToken() string {
+	return "ldap/" + p.Name
+}
+
+// GetTokenID returns the identifier of the token.
+func (p *LDAP) GetTokenID(ott string) (string, error) {
+	token, err := jose.ParseSigned(ott)
+	if err != nil {
+		return "", errors.Wrap(err, "error parsing token")
+	}
+	var claims jose.Claims
+	if err = token.UnsafeClaimsWithoutVerification(&claims); err != nil {
+		return "", errors.Wrap(err, "error verifying claims")
+	}
+	return claims.ID, nil
+}
+
+// GetName returns the name of the provisioner.
+func (p *LDAP) GetName() string {
+	return p.Name
+}
+
+// GetType returns the type of provisioner.
+func (p *LDAP) GetType() Type {
+	return TypeLDAP
+}
+
+// GetEncryptedKey is not available in an LDAP provisioner.
+func (p *LDAP) GetEncryptedKey() (string, string, bool) {
+	return "", "", false
+}
+
+// GetOptions returns the configured provisioner options.
+func (p *LDAP) GetOptions() *Options {
+	return p.Options
+}
+
+// Init validates and initializes the LDAP provisioner.
+func (p *LDAP) Init(config Config) (err error) {
+	switch {
+	case p.Type == "":
+		return errors.New("provisioner type cannot be empty")
+	case p.Name == "":
+		return errors.New("provisioner name cannot be empty")
+	case p.URL == "":
+		return errors.New("provisioner url cannot be empty")
+	case p.BaseDN == "":
+		return errors.New("provisioner baseDN cannot be empty")
+	case p.BindDN != "" && p.BindPassword == "":
+		return errors.New("provisioner bindPassword cannot be empty if bindDN is set")
+	}
+
+	u, err := url.Parse(p.URL)
+	if err != nil || u.Host == "" {
+		return errors.Errorf("provisioner url %q is not valid", p.URL)
+	}
+	switch {
+	case u.Scheme == "ldaps":
+	case u.Scheme == "ldap" && p.StartTLS:
+	case u.Scheme == "ldap":
+		return errors.Errorf("provisioner url %q requires startTLS", p.URL)
+	default:
+		return errors.Errorf("provisioner url %q is not an ldaps or ldap url", p.URL)
+	}
+
+	if p.UserDNTemplate == "" {
+		p.UserDNTemplate = ldapUsernamePlaceholder
+	}
+	if p.UserFilter == "" {
+		p.UserFilter = "(uid=" + ldapUsernamePlaceholder + ")"
+	}
+	if len(p.MailAttributes) == 0 && p.Options.GetSMIMEOptions() != nil {
+		p.MailAttributes = []string{"mail"}
+	}
+	if _, err := ldap.CompileFilter(strings.ReplaceAll(p.UserFilter, ldapUsernamePlaceholder, "username")); err != nil {
+		return errors.Wrapf(err, "provisioner userFilter %q is not valid", p.UserFilter)
+	}
+	for i := range p.AttributeRules {
+		if err := p.AttributeRules[i].Validate(); err != nil {
+			return errors.Wrap(err, "provisioner attributeRules are not valid")
+		}
+	}
+
+	p.tlsConfig = &tls.Config{
+		ServerName: u.Hostname(),
+		MinVersion: tls.VersionTLS12,
+	}
+	if len(p.Roots) > 0 {
+		certs, err := parseX5CRoots(p.Roots)
+		if err != nil {
+			return errors.Wrap(err, "error parsing roots")
+		}
+		if len(certs) == 0 {
+			return errors.Errorf("no x509 certificates found in roots attribute for provisioner '%s'", p.GetName())
+		}
+		p.tlsConfig.RootCAs = x509.NewCertPool()
+		for _, crt := range certs {
+			p.tlsConfig.RootCAs.AddCert(crt)
+		}
+	}
+	p.dial = p.dialLDAP
+
+	config.Audiences = config.Audiences.WithFragment(p.GetIDForToken())
+	p.ctl, err = NewController(p, p.Claims, config, p.Options)
+	return
+}
+
+// dialLDAP connects to the LDAP server using TLS.
+func (p *LDAP) dialLDAP() (ldap.Client, error) {
+	conn, err := ldap.DialURL(p.URL,
+		ldap.DialWithDialer(&net.Dialer{Timeout: ldapTimeout}),
+		ldap.DialWithTLSConfig(p.tlsConfig))
+	if err != nil {
+		return nil, err
+	}
+	conn.SetTimeout(ldapTimeout)
+	if p.StartTLS {
+		if err := conn.StartTLS(p.tlsConfig); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+// attributes returns the list of attributes requested in the user search.
+func (p *LDAP) attributes() []string {
+	attrs := append([]string{}, p.SANAttributes...)
+	attrs = appendUnique(attrs, p.PrincipalAttributes...)
+	if p.Options.GetSMIMEOptions() != nil {
+		attrs = appendUnique(attrs, p.MailAttributes...)
+	}
+	for _, r := range p.AttributeRules {
+		// Nested claims are not supported, the attribute is the first part
+		// of the path.
+		name, _, _ := strings.Cut(r.Claim, ".")
+		attrs = appendUnique(attrs, name)
+	}
+	if len(attrs) == 0 {
+		return []string{"dn"}
+	}
+	return attrs
+}
+
+// authenticate binds to the directory with the given credentials and returns
+// the entry of the user.
+func (p *LDAP) authenticate(username, password string) (*ldapEntry, error) {
+	// An empty password is an unauthenticated bind, it always succeeds.
+	if username == "" || password == "" {
+		return nil, errors.New("username and password cannot be empty")
+	}
+
+	conn, err := p.dial()
+	if err != nil {
+		return nil, errors.Wrapf(err, "error connecting to %s", p.URL)
+	}
+	defer conn.Close()
+
+	bindDN := strings.ReplaceAll(p.UserDNTemplate, ldapUsernamePlaceholder, ldap.EscapeDN(username))
+	if p.BindDN != "" {
+		if err := conn.Bind(p.BindDN, p.BindPassword); err != nil {
+			return nil, errors.Wrap(err, "error binding with bindDN")
+		}
+	} else if err := conn.Bind(bindDN, password); err != nil {
+		return nil, errors.Wrap(err, "error binding with user credentials")
+	}
+
+	res, err := conn.Search(ldap.NewSearchRequest(
+		p.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, int(ldapTimeout.Seconds()), false,
+		strings.ReplaceAll(p.UserFilter, ldapUsernamePlaceholder, ldap.EscapeFilter(username)),
+		p.attributes(), nil,
+	))
+	if err != nil {
+		return nil, errors.Wrap(err, "error searching user")
+	}
+	if len(res.Entries) != 1 {
+		return nil, errors.Errorf("user %s not found or not unique", username)
+	}
+
+	entry := res.Entries[0]
+	if p.BindDN != "" {
+		if err := conn.Bind(entry.DN, password); err != nil {
+			return nil, errors.Wrap(err, "error binding with user credentials")
+		}
+	}
+
+	e := &ldapEntry{
+		DN:         entry.DN,
+		Attributes: make(map[string][]string, len(entry.Attributes)),
+	}
+	for _, attr := range entry.Attributes {
+		e.Attributes[attr.Name] = attr.Values
+	}
+	return e, nil
+}
+
+// authorizeToken validates the token and the credentials of the user.
+func (p *LDAP) authorizeToken(token string, audiences []string) (*ldapPayload, error) {
+	jwt, err := jose.ParseSigned(token)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusUnauthorized, err, "ldap.authorizeToken; error parsing ldap token")
+	}
+	if len(jwt.Headers) == 0 || jwt.Headers[0].JSONWebKey == nil {
+		return nil, errs.Unauthorized("ldap.authorizeToken; ldap token missing jwk header")
+	}
+	password, err := extractLDAPPassword(jwt)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusUnauthorized, err, "ldap.authorizeToken; error extracting ldap header from token")
+	}
+
+	var claims ldapPayload
+	if err = jwt.Claims(jwt.Headers[0].JSONWebKey, &claims.jwtPayload); err != nil {
+		return nil, errs.Wrap(http.StatusUnauthorized, err, "ldap.authorizeToken; error parsing ldap claims")
+	}
+
+	// According to "rfc7519 JSON Web Token" acceptable skew should be no
+	// more than a few minutes.
+	if err = claims.ValidateWithLeeway(jose.Expected{
+		Issuer: p.Name,
+		Time:   time.Now().UTC(),
+	}, time.Minute); err != nil {
+		return nil, errs.Wrapf(http.StatusUnauthorized, err, "ldap.authorizeToken; invalid ldap claims")
+	}
+	if !matchesAudience(claims.Audience, audiences) {
+		return nil, errs.Unauthorized("ldap.authorizeToken; invalid ldap token audience claim (aud); want %s, but got %s",
+			audiences, claims.Audience)
+	}
+	if claims.ID == "" {
+		return nil, errs.Unauthorized("ldap.authorizeToken; ldap token must contain a jti claim")
+	}
+
+	if claims.entry, err = p.authenticate(claims.Subject, password); err != nil {
+		return nil, errs.Wrap(http.StatusUnauthorized, err, "ldap.authorizeToken; error authenticating user")
+	}
+	claims.grants = evaluateClaimRules(p.AttributeRules, claims.entry.claims())
+	return &claims, nil
+}
+
+// AuthorizeRevoke returns an error if the token is not valid.
+func (p *LDAP) AuthorizeRevoke(_ context.Context, token string) error {
+	claims, err := p.authorizeToken(token, p.ctl.Audiences.Revoke)
+	if err != nil {
+		return errs.Wrap(http.StatusInternalServerError, err, "ldap.AuthorizeRevoke")
+	}
+	if !claims.grants.admin {
+		return errs.Unauthorized("ldap.AuthorizeRevoke; ldap user %s is not an admin", claims.Subject)
+	}
+	return nil
+}
+
+// AuthorizeSign validates the given token and returns the sign options that
+// will be used on certificate creation.
+func (p *LDAP) AuthorizeSign(ctx context.Context, token string) ([]SignOption, error) {
+	if err := p.ctl.AuthorizeIssuance(); err != nil {
+		return nil, err
+	}
+	claims, err := p.authorizeToken(token, p.ctl.Audiences.Sign)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "ldap.AuthorizeSign")
+	}
+
+	// The mailboxes of the user are only used in S/MIME certificates.
+	var mailboxes []string
+	smimeOptions := p.Options.GetSMIMEOptions()
+	if smimeOptions != nil {
+		mailboxes = claims.entry.values(p.MailAttributes)
+	}
+
+	allowed := appendUnique(claims.entry.values(p.SANAttributes), claims.grants.sans...)
+	allowed = appendUnique(allowed, mailboxes...)
+	sans := claims.SANs
+	if len(sans) == 0 {
+		sans = allowed
+	}
+	if !claims.grants.admin {
+		for _, san := range sans {
+			if !containsString(allowed, san) {
+				return nil, errs.Unauthorized("ldap.AuthorizeSign; name %q is not allowed for user %s", san, claims.Subject)
+			}
+		}
+	}
+
+	// Certificate templates
+	data := x509util.CreateTemplateData(claims.Subject, sans)
+	if v, err := unsafeParseSigned(token); err == nil {
+		data.SetToken(v)
+	}
+
+	// Use the default template unless no-templates are configured and the
+	// user is an admin, in that case we will use the CR template.
+	defaultTemplate := x509util.DefaultLeafTemplate
+	switch {
+	case smimeOptions != nil:
+		defaultTemplate = DefaultSMIMELeafTemplate
+	case !p.Options.GetX509Options().HasTemplate() && claims.grants.admin:
+		defaultTemplate = x509util.DefaultAdminLeafTemplate
+	}
+	templateOptions, err := CustomTemplateOptions(p.Options, data, defaultTemplate)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "ldap.AuthorizeSign")
+	}
+
+	// Check the fingerprint of the certificate request if given.
+	var fingerprint string
+	if claims.Confirmation != nil {
+		fingerprint = claims.Confirmation.Fingerprint
+	}
+
+	signOptions := []SignOption{
+		p,
+		templateOptions,
+		// modifiers / withOptions
+		newProvisionerExtensionOption(TypeLDAP, p.Name, claims.entry.DN).WithControllerOptions(p.ctl),
+		profileDefaultDuration(p.ctl.Claimer.DefaultTLSCertDuration()),
+		// validators
+		csrFingerprintValidator(fingerprint),
+		defaultPublicKeyValidator{keys: p.ctl.Claimer.KeyClaims()},
+		newClaimsValidityValidator(p.ctl.Claimer),
+		newX509NamePolicyValidator(p.ctl.getPolicy().getX509()),
+		p.ctl.newWebhookController(data, linkedca.Webhook_X509),
+	}
+	if !claims.grants.admin {
+		signOptions = append(signOptions,
+			commonNameSliceValidator(append([]string{claims.Subject}, sans...)),
+			newDefaultSANsValidator(ctx, sans),
+		)
+	}
+
+	// Enforce the S/MIME profile, the mailboxes in the mail attributes of
+	// the user are verified by the directory.
+	if smimeOptions != nil {
+		signOptions = append(signOptions,
+			newSMIMEProfileModifier(smimeOptions),
+			newSMIMEMailboxValidator(smimeOptions, mailboxes...),
+		)
+	}
+	return signOptions, nil
+}
+
+// AuthorizeRenew returns an error if the renewal is disabled.
+func (p *LDAP) AuthorizeRenew(ctx context.Context, cert *x509.Certificate) error {
+	return p.ctl.AuthorizeRenew(ctx, cert)
+}
+
+// AuthorizeSSHSign returns the list of SignOption for a SignSSH request. Only
+// user certificates can be signed by an LDAP provisioner.
+func (p *LDAP) AuthorizeSSHSign(_ context.Context, token string) ([]SignOption, error) {
+	if err := p.ctl.AuthorizeIssuance(); err != nil {
+		return nil, err
+	}
+	if !p.ctl.Claimer.IsSSHCAEnabled() {
+		return nil, errs.Unauthorized("ldap.AuthorizeSSHSign; sshCA is disabled for ldap provisioner '%s'", p.GetName())
+	}
+	claims, err := p.authorizeToken(token, p.ctl.Audiences.SSHSign)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "ldap.AuthorizeSSHSign")
+	}
+
+	opts := SignSSHOptions{}
+	if claims.Step != nil && claims.Step.SSH != nil {
+		opts = *claims.Step.SSH
+	}
+	if opts.CertType != "" && opts.CertType != SSHUserCert {
+		return nil, errs.Forbidden("ldap.AuthorizeSSHSign; ldap provisioner can only sign user certificates")
+	}
+
+	allowed := appendUnique([]string{claims.Subject}, claims.entry.values(p.PrincipalAttributes)...)
+	allowed = appendUnique(allowed, claims.grants.principals...)
+	principals := allowed
+	if len(opts.Principals) > 0 {
+		principals = opts.Principals
+	}
+	for _, principal := range principals {
+		if !containsString(allowed, principal) {
+			return nil, errs.Unauthorized("ldap.AuthorizeSSHSign; principal %q is not allowed for user %s", principal, claims.Subject)
+		}
+	}
+
+	signOptions := []SignOption{
+		// validates user's SignSSHOptions with the ones in the token
+		sshCertOptionsValidator(opts),
+		// validate users's KeyID is the token subject.
+		sshCertOptionsValidator(SignSSHOptions{KeyID: claims.Subject}),
+	}
+
+	// Certificate templates.
+	data := sshutil.CreateTemplateData(sshutil.UserCert, claims.Subject, principals)
+	if v, err := unsafeParseSigned(token); err == nil {
+		data.SetToken(v)
+	}
+
+	templateOptions, err := TemplateSSHOptions(p.Options, data)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "ldap.AuthorizeSSHSign")
+	}
+	signOptions = append(signOptions, templateOptions)
+
+	// Add modifiers from custom claims
+	t := now()
+	if !opts.ValidAfter.IsZero() {
+		signOptions = append(signOptions, sshCertValidAfterModifier(opts.ValidAfter.RelativeTime(t).Unix()))
+	}
+	if !opts.ValidBefore.IsZero() {
+		signOptions = append(signOptions, sshCertValidBeforeModifier(opts.ValidBefore.RelativeTime(t).Unix()))
+	}
+
+	return append(signOptions,
+		p,
+		// Set the validity bounds if not set.
+		&sshDefaultDuration{p.ctl.Claimer},
+		// Validate public key
+		&sshDefaultPublicKeyValidator{keys: p.ctl.Claimer.KeyClaims()},
+		// Validate the validity period.
+		&sshCertValidityValidator{p.ctl.Claimer},
+		// Require and validate all the default fields in the SSH certificate.
+		&sshCertDefaultValidator{},
+		// Ensure that all principal names are allowed
+		newSSHNamePolicyValidator(p.ctl.getPolicy().getSSHHost(), p.ctl.getPolicy().getSSHUser()),
+		// Call webhooks
+		p.ctl.newWebhookController(data, linkedca.Webhook_SSH),
+	), nil
+}
+
+// AuthorizeSSHRevoke returns nil if the token is valid and the user is an
+// admin.
+func (p *LDAP) AuthorizeSSHRevoke(_ context.Context, token string) error {
+	claims, err := p.authorizeToken(token, p.ctl.Audiences.SSHRevoke)
+	if err != nil {
+		return errs.Wrap(http.StatusInternalServerError, err, "ldap.AuthorizeSSHRevoke")
+	}
+	if !claims.grants.admin {
+		return errs.Unauthorized("ldap.AuthorizeSSHRevoke; ldap user %s is not an admin", claims.Subject)
+	}
+	return nil
+}
+
+// extractLDAPPassword returns the password in the token header.
+func extractLDAPPassword(jwt *jose.JSONWebToken) (string, error) {
+	v, ok := jwt.Headers[0].ExtraHeaders[LDAPHeader]
+	if !ok {
+		return "", errors.New("token missing ldap header")
+	}
+	var s string
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", errors.Wrap(err, "error marshaling ldap header")
+	}
+	if err := json.Unmarshal(b, &s); err != nil || s == "" {
+		return "", errors.New("ldap header is not valid")
+	}
+	return s, nil
+}
@@ -0,0 +1,357 @@
+package provisioner
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.step.sm/crypto/jose"
+
+	"github.com/smallstep/certificates/api/render"
+)
+
+// ldapTestDirectory is an ldap.Client with a fixed set of users.
+type ldapTestDirectory struct {
+	ldap.Client
+	passwords map[string]string
+	entries   []*ldap.Entry
+	bound     string
+	searches  []*ldap.SearchRequest
+}
+
+func (d *ldapTestDirectory) Bind(username, password string) error {
+	if pw, ok := d.passwords[username]; !ok || pw != password || password == "" {
+		return ldap.NewError(ldap.LDAPResultInvalidCredentials, errors.New("invalid credentials"))
+	}
+	d.bound = username
+	return nil
+}
+
+func (d *ldapTestDirectory) Search(req *ldap.SearchRequest) (*ldap.SearchResult, error) {
+	if d.bound == "" {
+		return nil, ldap.NewError(ldap.LDAPResultInsufficientAccessRights, errors.New("bind required"))
+	}
+	d.searches = append(d.searches, req)
+	var res ldap.SearchResult
+	for _, e := range d.entries {
+		if req.Filter == "(uid="+e.GetAttributeValue("uid")+")" {
+			res.Entries = append(res.Entries, ldap.NewEntry(e.DN, map[string][]string{
+				"uid":      e.GetAttributeValues("uid"),
+				"mail":     e.GetAttributeValues("mail"),
+				"memberOf": e.GetAttributeValues("memberOf"),
+			}))
+		}
+	}
+	return &res, nil
+}
+
+func (d *ldapTestDirectory) Close() error {
+	d.bound = ""
+	return nil
+}
+
+func newLDAPTestDirectory() *ldapTestDirectory {
+	return &ldapTestDirectory{
+		passwords: map[string]string{
+			"cn=admin,dc=example,dc=com":           "admin-password",
+			"uid=jane,ou=people,dc=example,dc=com": "jane-password",
+			"uid=joe,ou=people,dc=example,dc=com":  "joe-password",
+		},
+		entries: []*ldap.Entry{
+			ldap.NewEntry("uid=jane,ou=people,dc=example,dc=com", map[string][]string{
+				"uid":      {"jane"},
+				"mail":     {"jane@example.com"},
+				"memberOf": {"cn=ops,ou=groups,dc=example,dc=com", "cn=ca-admins,ou=groups,dc=example,dc=com"},
+			}),
+			ldap.NewEntry("uid=joe,ou=people,dc=example,dc=com", map[string][]string{
+				"uid":      {"joe"},
+				"mail":     {"joe@example.com"},
+				"memberOf": {"cn=web,ou=groups,dc=example,dc=com"},
+			}),
+		},
+	}
+}
+
+func generateLDAPToken(t *testing.T, password string, claims any) string {
+	t.Helper()
+	payload, err := json.Marshal(claims)
+	require.NoError(t, err)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	so := new(jose.SignerOptions)
+	so.WithType("JWT")
+	so.WithHeader(LDAPHeader, password)
+	so.EmbedJWK = true
+	sig, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.ES256, Key: key}, so)
+	require.NoError(t, err)
+	jws, err := sig.Sign(payload)
+	require.NoError(t, err)
+	tok, err := jws.CompactSerialize()
+	require.NoError(t, err)
+	return tok
+}
+
+func generateLDAP(t *testing.T, dir *ldapTestDirectory) *LDAP {
+	t.Helper()
+	p := &LDAP{
+		Type:                "LDAP",
+		Name:                "ldap",
+		URL:                 "ldaps://ldap.example.com",
+		BindDN:              "cn=admin,dc=example,dc=com",
+		BindPassword:        "admin-password",
+		BaseDN:              "ou=people,dc=example,dc=com",
+		SANAttributes:       []string{"mail"},
+		PrincipalAttributes: []string{"uid"},
+		AttributeRules: []OIDCClaimRule{
+			{Claim: "memberOf", Values: []string{"cn=ca-admins,*"}, Admin: true},
+			{Claim: "memberOf", Values: []string{"cn=web,ou=groups,dc=example,dc=com"}, SANs: []string{"web.example.com"}, Principals: []string{"web"}},
+			{Claim: "memberOf", Values: []string{"cn=ops,ou=groups,dc=example,dc=com"}, SANs: []string{"ops.example.com"}, Principals: []string{"ops"}},
+		},
+	}
+	require.NoError(t, p.Init(Config{Claims: globalProvisionerClaims, Audiences: testAudiences}))
+	p.dial = func() (ldap.Client, error) {
+		return dir, nil
+	}
+	return p
+}
+
+func TestLDAP_Getters(t *testing.T) {
+	p := generateLDAP(t, newLDAPTestDirectory())
+	assert.Equal(t, "ldap/ldap", p.GetID())
+	assert.Equal(t, "ldap/ldap", p.GetIDForToken())
+	assert.Equal(t, "ldap", p.GetName())
+	assert.Equal(t, TypeLDAP, p.GetType())
+	assert.Equal(t, "LDAP", p.GetType().String())
+	kid, key, ok := p.GetEncryptedKey()
+	assert.Empty(t, kid)
+	assert.Empty(t, key)
+	assert.False(t, ok)
+	assert.Equal(t, "(uid={username})", p.UserFilter)
+	assert.Equal(t, "{username}", p.UserDNTemplate)
+	assert.Equal(t, "ldap.example.com", p.tlsConfig.ServerName)
+}
+
+func TestLDAP_Init(t *testing.T) {
+	config := Config{Claims: globalProvisionerClaims, Audiences: testAudiences}
+	tests := []struct {
+		name    string
+		p       *LDAP
+		wantErr bool
+	}{
+		{"ok ldaps", &LDAP{Type: "LDAP", Name: "ldap", URL: "ldaps://ldap.example.com", BaseDN: "dc=example,dc=com"}, false},
+		{"ok startTLS", &LDAP{Type: "LDAP", Name: "ldap", URL: "ldap://ldap.example.com:389", StartTLS: true, BaseDN: "dc=example,dc=com"}, false},
+		{"ok bindDN", &LDAP{Type: "LDAP", Name: "ldap", URL: "ldaps://ldap.example.com", BaseDN: "dc=example,dc=com", BindDN: "cn=admin", BindPassword: "password"}, false},
+		{"ok roots", &LDAP{Type: "LDAP", Name: "ldap", URL: "ldaps://ldap.example.com", BaseDN: "dc=example,dc=com", Roots: []byte(awsTestCertificate)}, false},
+		{"fail type", &LDAP{Name: "ldap", URL: "ldaps://ldap.example.com", BaseDN: "dc=example,dc=com"}, true},
+		{"fail name", &LDAP{Type: "LDAP", URL: "ldaps://ldap.example.com", BaseDN: "dc=example,dc=com"}, true},
+		{"fail url", &LDAP{Type: "LDAP", Name: "ldap", BaseDN: "dc=example,dc=com"}, true},
+		{"fail url scheme", &LDAP{Type: "LDAP", Name: "ldap", URL: "https://ldap.example.com", BaseDN: "dc=example,dc=com"}, true},
+		{"fail url plain text", &LDAP{Type: "LDAP", Name: "ldap", URL: "ldap://ldap.example.com", BaseDN: "dc=example,dc=com"}, true},
+		{"fail baseDN", &LDAP{Type: "LDAP", Name: "ldap", URL: "ldaps://ldap.example.com"}, true},
+		{"fail bindPassword", &LDAP{Type: "LDAP", Name: "ldap", URL: "ldaps://ldap.example.com", BaseDN: "dc=example,dc=com", BindDN: "cn=admin"}, true},
+		{"fail userFilter", &LDAP{Type: "LDAP", Name: "ldap", URL: "ldaps://ldap.example.com", BaseDN: "dc=example,dc=com", UserFilter: "(uid={username}"}, true},
+		{"fail roots", &LDAP{Type: "LDAP", Name: "ldap", URL: "ldaps://ldap.example.com", BaseDN: "dc=example,dc=com", Roots: []byte("foo")}, true},
+		{"fail attributeRules", &LDAP{Type: "LDAP", Name: "ldap", URL: "ldaps://ldap.example.com", BaseDN: "dc=example,dc=com", AttributeRules: []OIDCClaimRule{
+			{Claim: "memberOf", Values: []string{"cn=ops,*"}},
+		}}, true},
+		{"fail smime", &LDAP{Type: "LDAP", Name: "ldap", URL: "ldaps://ldap.example.com", BaseDN: "dc=example,dc=com", Options: &Options{
+			SMIME: &SMIMEOptions{Capabilities: []string{"des-cbc"}},
+		}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.p.Init(config)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestLDAP_authorizeToken(t *testing.T) {
+	dir := newLDAPTestDirectory()
+	p := generateLDAP(t, dir)
+	aud := p.ctl.Audiences.Sign[0]
+
+	tests := []struct {
+		name       string
+		token      string
+		wantDN     string
+		wantGrants oidcClaimGrants
+		wantErr    bool
+	}{
+		{"ok jane", generateLDAPToken(t, "jane-password", webAuthnClaims("jane", p.Name, aud, nil, nil)), "uid=jane,ou=people,dc=example,dc=com", oidcClaimGrants{
+			admin:      true,
+			sans:       []string{"ops.example.com"},
+			principals: []string{"ops"},
+		}, false},
+		{"ok joe", generateLDAPToken(t, "joe-password", webAuthnClaims("joe", p.Name, aud, nil, nil)), "uid=joe,ou=people,dc=example,dc=com", oidcClaimGrants{
+			sans:       []string{"web.example.com"},
+			principals: []string{"web"},
+		}, false},
+		{"fail token", "foo", "", oidcClaimGrants{}, true},
+		{"fail password", generateLDAPToken(t, "joe-password", webAuthnClaims("jane", p.Name, aud, nil, nil)), "", oidcClaimGrants{}, true},
+		{"fail empty password", generateLDAPToken(t, "", webAuthnClaims("jane", p.Name, aud, nil, nil)), "", oidcClaimGrants{}, true},
+		{"fail user", generateLDAPToken(t, "jane-password", webAuthnClaims("root", p.Name, aud, nil, nil)), "", oidcClaimGrants{}, true},
+		{"fail filter injection", generateLDAPToken(t, "jane-password", webAuthnClaims("*", p.Name, aud, nil, nil)), "", oidcClaimGrants{}, true},
+		{"fail issuer", generateLDAPToken(t, "jane-password", webAuthnClaims("jane", "foo", aud, nil, nil)), "", oidcClaimGrants{}, true},
+		{"fail audience", generateLDAPToken(t, "jane-password", webAuthnClaims("jane", p.Name, "foo", nil, nil)), "", oidcClaimGrants{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := p.authorizeToken(tt.token, p.ctl.Audiences.Sign)
+			if tt.wantErr {
+				var sc render.StatusCodedError
+				require.ErrorAs(t, err, &sc)
+				assert.Equal(t, http.StatusUnauthorized, sc.StatusCode())
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantDN, got.entry.DN)
+			assert.Equal(t, tt.wantGrants, got.grants)
+		})
+	}
+
+	// The user filter is escaped.
+	assert.Equal(t, "(uid=\\2a)", dir.searches[len(dir.searches)-1].Filter)
+}
+
+func TestLDAP_authenticate_userDNTemplate(t *testing.T) {
+	dir := newLDAPTestDirectory()
+	p := generateLDAP(t, dir)
+	p.BindDN, p.BindPassword = "", ""
+	p.UserDNTemplate = "uid={username},ou=people,dc=example,dc=com"
+
+	e, err := p.authenticate("jane", "jane-password")
+	require.NoError(t, err)
+	assert.Equal(t, "uid=jane,ou=people,dc=example,dc=com", e.DN)
+	assert.Equal(t, []string{"jane@example.com"}, e.Attributes["mail"])
+
+	_, err = p.authenticate("jane", "joe-password")
+	assert.Error(t, err)
+	_, err = p.authenticate("jane", "")
+	assert.Error(t, err)
+}
+
+func TestLDAP_AuthorizeSign(t *testing.T) {
+	p := generateLDAP(t, newLDAPTestDirectory())
+	aud := p.ctl.Audiences.Sign[0]
+
+	tests := []struct {
+		name    string
+		token   string
+		wantLen int
+		wantErr bool
+	}{
+		{"ok", generateLDAPToken(t, "joe-password", webAuthnClaims("joe", p.Name, aud, nil, nil)), 11, false},
+		{"ok sans", generateLDAPToken(t, "joe-password", webAuthnClaims("joe", p.Name, aud, []string{"joe@example.com", "web.example.com"}, nil)), 11, false},
+		{"ok admin", generateLDAPToken(t, "jane-password", webAuthnClaims("jane", p.Name, aud, []string{"anything.example.com"}, nil)), 9, false},
+		{"fail sans", generateLDAPToken(t, "joe-password", webAuthnClaims("joe", p.Name, aud, []string{"ops.example.com"}, nil)), 0, true},
+		{"fail token", "foo", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := p.AuthorizeSign(context.Background(), tt.token)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Len(t, got, tt.wantLen)
+		})
+	}
+}
+
+func TestLDAP_AuthorizeSign_smime(t *testing.T) {
+	p := &LDAP{
+		Type:         "LDAP",
+		Name:         "ldap",
+		URL:          "ldaps://ldap.example.com",
+		BindDN:       "cn=admin,dc=example,dc=com",
+		BindPassword: "admin-password",
+		BaseDN:       "ou=people,dc=example,dc=com",
+		Options: &Options{
+			SMIME: &SMIMEOptions{RequireVerifiedMailbox: true},
+		},
+	}
+	require.NoError(t, p.Init(Config{Claims: globalProvisionerClaims, Audiences: testAudiences}))
+	assert.Equal(t, []string{"mail"}, p.MailAttributes)
+	assert.Equal(t, []string{"mail"}, p.attributes())
+
+	dir := newLDAPTestDirectory()
+	p.dial = func() (ldap.Client, error) {
+		return dir, nil
+	}
+	aud := p.ctl.Audiences.Sign[0]
+
+	got, err := p.AuthorizeSign(context.Background(), generateLDAPToken(t, "joe-password", webAuthnClaims("joe", p.Name, aud, nil, nil)))
+	require.NoError(t, err)
+
+	var validator *smimeMailboxValidator
+	for _, o := range got {
+		if v, ok := o.(*smimeMailboxValidator); ok {
+			validator = v
+		}
+	}
+	require.NotNil(t, validator)
+	assert.True(t, validator.requireVerified)
+	assert.Equal(t, []string{"joe@example.com"}, validator.verified)
+
+	_, err = p.AuthorizeSign(context.Background(), generateLDAPToken(t, "joe-password", webAuthnClaims("joe", p.Name, aud, []string{"jane@example.com"}, nil)))
+	assert.Error(t, err)
+}
+
+func TestLDAP_AuthorizeSSHSign(t *testing.T) {
+	p := generateLDAP(t, newLDAPTestDirectory())
+	aud := p.ctl.Audiences.SSHSign[0]
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	signer, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name           string
+		token          string
+		wantPrincipals []string
+		wantErr        bool
+	}{
+		{"ok", generateLDAPToken(t, "joe-password", webAuthnClaims("joe", p.Name, aud, nil, nil)), []string{"joe", "web"}, false},
+		{"ok principals", generateLDAPToken(t, "joe-password", webAuthnClaims("joe", p.Name, aud, nil, &SignSSHOptions{Principals: []string{"web"}})), []string{"web"}, false},
+		{"fail principals", generateLDAPToken(t, "joe-password", webAuthnClaims("joe", p.Name, aud, nil, &SignSSHOptions{Principals: []string{"root"}})), nil, true},
+		{"fail host", generateLDAPToken(t, "joe-password", webAuthnClaims("joe", p.Name, aud, nil, &SignSSHOptions{CertType: SSHHostCert})), nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts, err := p.AuthorizeSSHSign(context.Background(), tt.token)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			cert, err := signSSHCertificate(key.Public(), SignSSHOptions{}, opts, signer)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantPrincipals, cert.ValidPrincipals)
+			assert.Equal(t, "joe", cert.KeyId)
+		})
+	}
+}
+
+func TestLDAP_AuthorizeRevoke(t *testing.T) {
+	p := generateLDAP(t, newLDAPTestDirectory())
+	assert.NoError(t, p.AuthorizeRevoke(context.Background(),
+		generateLDAPToken(t, "jane-password", webAuthnClaims("jane", p.Name, p.ctl.Audiences.Revoke[0], nil, nil))))
+	assert.Error(t, p.AuthorizeRevoke(context.Background(),
+		generateLDAPToken(t, "joe-password", webAuthnClaims("joe", p.Name, p.ctl.Audiences.Revoke[0], nil, nil))))
+}
@@ -50,6 +50,7 @@ type openIDPayload struct {
 	Hd              string   `json:"hd"`
 	Nonce           string   `json:"nonce"`
 	Groups          []string `json:"groups"`
+	raw             map[string]any
 }
 
 func (o *openIDPayload) IsAdmin(admins []string) bool {
@@ -78,23 +79,28 @@ func (o *openIDPayload) IsAdmin(admins []string) bool {
 // OIDC represents an OAuth 2.0 OpenID Connect provider.
 //
 // ClientSecret is mandatory, but it can be an empty string.
+//
+// ClaimRules can be used to grant admin rights, SANs, and SSH principals based
+// on arbitrary claims in the token, e.g. groups or roles, in addition to the
+// Admins list.
 type OIDC struct {
 	*base
-	ID                    string   `json:"-"`
-	Type                  string   `json:"type"`
-	Name                  string   `json:"name"`
-	ClientID              string   `json:"clientID"`
-	ClientSecret          string   `json:"clientSecret"`
-	ConfigurationEndpoint string   `json:"configurationEndpoint"`
-	TenantID              string   `json:"tenantID,omitempty"`
-	Admins                []string `json:"admins,omitempty"`
-	Domains               []string `json:"domains,omitempty"`
-	Groups                []string `json:"groups,omitempty"`
-	ListenAddress         string   `json:"listenAddress,omitempty"`
-	Claims                *Claims  `json:"claims,omitempty"`
-	Options               *Options `json:"options,omitempty"`
-	Scopes                []string `json:"scopes,omitempty"`
-	AuthParams            []string `json:"authParams,omitempty"`
+	ID                    string          `json:"-"`
+	Type                  string          `json:"type"`
+	Name                  string          `json:"name"`
+	ClientID              string          `json:"clientID"`
+	ClientSecret          string          `json:"clientSecret"`
+	ConfigurationEndpoint string          `json:"configurationEndpoint"`
+	TenantID              string          `json:"tenantID,omitempty"`
+	Admins                []string        `json:"admins,omitempty"`
+	Domains               []string        `json:"domains,omitempty"`
+	Groups                []string        `json:"groups,omitempty"`
+	ListenAddress         string          `json:"listenAddress,omitempty"`
+	Claims                *Claims         `json:"claims,omitempty"`
+	Options               *Options        `json:"options,omitempty"`
+	Scopes                []string        `json:"scopes,omitempty"`
+	AuthParams            []string        `json:"authParams,omitempty"`
+	ClaimRules            []OIDCClaimRule `json:"claimRules,omitempty"`
 	configuration         openIDConfiguration
 	keyStore              *keyStore
 	ctl                   *Controller
@@ -156,6 +162,11 @@ func (o *OIDC) GetEncryptedKey() (kid, key string, ok bool) {
 	return "", "", false
 }
 
+// GetOptions returns the configured provisioner options.
+func (o *OIDC) GetOptions() *Options {
+	return o.Options
+}
+
 // Init validates and initializes the OIDC provider.
 func (o *OIDC) Init(config Config) (err error) {
 	switch {
@@ -176,6 +187,13 @@ func (o *OIDC) Init(config Config) (err error) {
 		}
 	}
 
+	// Validate claim rules
+	for i := range o.ClaimRules {
+		if err := o.ClaimRules[i].Validate(); err != nil {
+			return errors.Wrap(err, "error validating claimRules")
+		}
+	}
+
 	// Decode and validate openid-configuration endpoint
 	u, err := url.Parse(o.ConfigurationEndpoint)
 	if err != nil {
@@ -228,7 +246,7 @@ func (o *OIDC) ValidatePayload(p openIDPayload) error {
 	}
 
 	// Validate domains (case-insensitive)
-	if p.Email != "" && len(o.Domains) > 0 && !p.IsAdmin(o.Admins) {
+	if p.Email != "" && len(o.Domains) > 0 && !o.isAdmin(&p) {
 		email := sanitizeEmail(p.Email)
 		var found bool
 		for _, d := range o.Domains {
@@ -281,7 +299,7 @@ func (o *OIDC) authorizeToken(token string) (*openIDPayload, error) {
 	kid := jwt.Headers[0].KeyID
 	keys := o.keyStore.Get(kid)
 	for _, key := range keys {
-		if err := jwt.Claims(key, &claims); err == nil {
+		if err := jwt.Claims(key, &claims, &claims.raw); err == nil {
 			found = true
 			break
 		}
@@ -307,7 +325,7 @@ func (o *OIDC) AuthorizeRevoke(_ context.Context, token string) error {
 	}
 
 	// Only admins can revoke certificates.
-	if claims.IsAdmin(o.Admins) {
+	if o.isAdmin(claims) {
 		return nil
 	}
 
@@ -316,10 +334,14 @@ func (o *OIDC) AuthorizeRevoke(_ context.Context, token string) error {
 
 // AuthorizeSign validates the given token.
 func (o *OIDC) AuthorizeSign(_ context.Context, token string) ([]SignOption, error) {
+	if err := o.ctl.AuthorizeIssuance(); err != nil {
+		return nil, err
+	}
 	claims, err := o.authorizeToken(token)
 	if err != nil {
 		return nil, errs.Wrap(http.StatusInternalServerError, err, "oidc.AuthorizeSign")
 	}
+	grants := evaluateClaimRules(o.ClaimRules, claims.raw)
 
 	// Certificate templates
 	sans := []string{}
@@ -327,17 +349,22 @@ func (o *OIDC) AuthorizeSign(_ context.Context, token string) ([]SignOption, err
 		sans = append(sans, claims.Email)
 	}
 
-	// Add uri SAN with iss#sub if issuer is a URL with schema.
+	// Add uri SAN with iss#sub if issuer is a URL with schema. S/MIME
+	// certificates only contain email addresses.
 	//
 	// According to https://openid.net/specs/openid-connect-core-1_0.html the
 	// iss value is a case sensitive URL using the https scheme that contains
 	// scheme, host, and optionally, port number and path components and no
 	// query or fragment components.
-	if iss, err := url.Parse(claims.Issuer); err == nil && iss.Scheme != "" {
+	smimeOptions := o.Options.GetSMIMEOptions()
+	if iss, err := url.Parse(claims.Issuer); err == nil && iss.Scheme != "" && smimeOptions == nil {
 		iss.Fragment = claims.Subject
 		sans = append(sans, iss.String())
 	}
 
+	// Add the SANs granted by the claim rules.
+	sans = appendUnique(sans, grants.sans...)
+
 	data := x509util.CreateTemplateData(claims.Subject, sans)
 	if v, err := unsafeParseSigned(token); err == nil {
 		data.SetToken(v)
@@ -346,7 +373,10 @@ func (o *OIDC) AuthorizeSign(_ context.Context, token string) ([]SignOption, err
 	// Use the default template unless no-templates are configured and email is
 	// an admin, in that case we will use the CR template.
 	defaultTemplate := x509util.DefaultLeafTemplate
-	if !o.Options.GetX509Options().HasTemplate() && claims.IsAdmin(o.Admins) {
+	switch {
+	case smimeOptions != nil:
+		defaultTemplate = DefaultSMIMELeafTemplate
+	case !o.Options.GetX509Options().HasTemplate() && (claims.IsAdmin(o.Admins) || grants.admin):
 		defaultTemplate = x509util.DefaultAdminLeafTemplate
 	}
 
@@ -355,19 +385,34 @@ func (o *OIDC) AuthorizeSign(_ context.Context, token string) ([]SignOption, err
 		return nil, errs.Wrap(http.StatusInternalServerError, err, "oidc.AuthorizeSign")
 	}
 
-	return []SignOption{
+	signOptions := []SignOption{
 		o,
 		templateOptions,
 		// modifiers / withOptions
 		newProvisionerExtensionOption(TypeOIDC, o.Name, o.ClientID).WithControllerOptions(o.ctl),
 		profileDefaultDuration(o.ctl.Claimer.DefaultTLSCertDuration()),
 		// validators
-		defaultPublicKeyValidator{},
-		newValidityValidator(o.ctl.Claimer.MinTLSCertDuration(), o.ctl.Claimer.MaxTLSCertDuration()),
+		defaultPublicKeyValidator{keys: o.ctl.Claimer.KeyClaims()},
+		newClaimsValidityValidator(o.ctl.Claimer),
 		newX509NamePolicyValidator(o.ctl.getPolicy().getX509()),
 		// webhooks
 		o.ctl.newWebhookController(data, linkedca.Webhook_X509),
-	}, nil
+	}
+
+	// Enforce the S/MIME profile, the mailbox is verified if the IdP asserts
+	// it using the email_verified claim.
+	if smimeOptions != nil {
+		var verified []string
+		if claims.Email != "" && claims.EmailVerified {
+			verified = append(verified, claims.Email)
+		}
+		signOptions = append(signOptions,
+			newSMIMEProfileModifier(smimeOptions),
+			newSMIMEMailboxValidator(smimeOptions, verified...),
+		)
+	}
+
+	return signOptions, nil
 }
 
 // AuthorizeRenew returns an error if the renewal is disabled.
@@ -380,6 +425,9 @@ func (o *OIDC) AuthorizeRenew(ctx context.Context, cert *x509.Certificate) error
 
 // AuthorizeSSHSign returns the list of SignOption for a SignSSH request.
 func (o *OIDC) AuthorizeSSHSign(ctx context.Context, token string) ([]SignOption, error) {
+	if err := o.ctl.AuthorizeIssuance(); err != nil {
+		return nil, err
+	}
 	if !o.ctl.Claimer.IsSSHCAEnabled() {
 		return nil, errs.Unauthorized("oidc.AuthorizeSSHSign; sshCA is disabled for oidc provisioner '%s'", o.GetName())
 	}
@@ -392,11 +440,13 @@ func (o *OIDC) AuthorizeSSHSign(ctx context.Context, token string) ([]SignOption
 		return nil, errs.Unauthorized("oidc.AuthorizeSSHSign: failed to validate oidc token payload: subject not found")
 	}
 
+	grants := evaluateClaimRules(o.ClaimRules, claims.raw)
+
 	var data sshutil.TemplateData
 	if claims.Email == "" {
 		// If email is empty, use the Subject claim instead to create minimal
 		// data for the template to use.
-		data = sshutil.CreateTemplateData(sshutil.UserCert, claims.Subject, nil)
+		data = sshutil.CreateTemplateData(sshutil.UserCert, claims.Subject, grants.principals)
 		if v, err := unsafeParseSigned(token); err == nil {
 			data.SetToken(v)
 		}
@@ -409,8 +459,13 @@ func (o *OIDC) AuthorizeSSHSign(ctx context.Context, token string) ([]SignOption
 			return nil, errs.Wrap(http.StatusInternalServerError, err, "oidc.AuthorizeSSHSign")
 		}
 
-		// Certificate templates.
-		data = sshutil.CreateTemplateData(sshutil.UserCert, claims.Email, iden.Usernames)
+		// Certificate templates, including the principals granted by the
+		// claim rules.
+		principals := iden.Usernames
+		if len(grants.principals) > 0 {
+			principals = appendUnique(append([]string{}, iden.Usernames...), grants.principals...)
+		}
+		data = sshutil.CreateTemplateData(sshutil.UserCert, claims.Email, principals)
 		if v, err := unsafeParseSigned(token); err == nil {
 			data.SetToken(v)
 		}
@@ -426,7 +481,7 @@ func (o *OIDC) AuthorizeSSHSign(ctx context.Context, token string) ([]SignOption
 
 	// Use the default template unless no-templates are configured and email is
 	// an admin, in that case we will use the parameters in the request.
-	isAdmin := claims.IsAdmin(o.Admins)
+	isAdmin := claims.IsAdmin(o.Admins) || grants.admin
 	defaultTemplate := sshutil.DefaultTemplate
 	if isAdmin && !o.Options.GetSSHOptions().HasTemplate() {
 		defaultTemplate = sshutil.DefaultAdminTemplate
@@ -458,7 +513,7 @@ func (o *OIDC) AuthorizeSSHSign(ctx context.Context, token string) ([]SignOption
 		// Set the validity bounds if not set.
 		&sshDefaultDuration{o.ctl.Claimer},
 		// Validate public key
-		&sshDefaultPublicKeyValidator{},
+		&sshDefaultPublicKeyValidator{keys: o.ctl.Claimer.KeyClaims()},
 		// Validate the validity period.
 		&sshCertValidityValidator{o.ctl.Claimer},
 		// Require all the fields in the SSH certificate
@@ -478,13 +533,19 @@ func (o *OIDC) AuthorizeSSHRevoke(_ context.Context, token string) error {
 	}
 
 	// Only admins can revoke certificates.
-	if claims.IsAdmin(o.Admins) {
+	if o.isAdmin(claims) {
 		return nil
 	}
 
 	return errs.Unauthorized("oidc.AuthorizeSSHRevoke; cannot revoke with non-admin oidc token")
 }
 
+// isAdmin returns true if the token belongs to an admin, either using the list
+// of admins or the claim rules.
+func (o *OIDC) isAdmin(claims *openIDPayload) bool {
+	return claims.IsAdmin(o.Admins) || evaluateClaimRules(o.ClaimRules, claims.raw).admin
+}
+
 func getAndDecode(client *http.Client, uri string, v interface{}) error {
 	resp, err := client.Get(uri)
 	if err != nil {
@@ -496,3 +557,16 @@ func getAndDecode(client *http.Client, uri string, v interface{}) error {
 	}
 	return nil
 }
+
+// newIssuerKeyStore returns the key store of the given issuer, the JWK set URI
+// is read from the OpenID configuration of the issuer.
+func newIssuerKeyStore(client *http.Client, issuer string) (*keyStore, error) {
+	var configuration openIDConfiguration
+	if err := getAndDecode(client, strings.TrimSuffix(issuer, "/")+"/.well-known/openid-configuration", &configuration); err != nil {
+		return nil, err
+	}
+	if err := configuration.Validate(); err != nil {
+		return nil, errors.Wrapf(err, "error parsing openid-configuration of %s", issuer)
+	}
+	return newKeyStore(client, configuration.JWKSetURI)
+}
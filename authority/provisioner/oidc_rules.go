@@ -0,0 +1,166 @@
+package provisioner
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// oidcRuleValuePlaceholder is replaced in the SANs and principals of a rule
+// with the claim value that matched the rule.
+const oidcRuleValuePlaceholder = "${value}"
+
+// OIDCClaimRule maps the values of a token claim to admin rights, SANs and SSH
+// principals.
+//
+// Claim is the name of the claim, nested claims can be accessed using a dotted
+// path, e.g. "realm_access.roles". The claim can be a string, a number, a
+// boolean, or an array of them. The rule matches if one of the values of the
+// claim matches one of the Values, by default Values are glob patterns, if
+// Regex is true they are regular expressions that must match the full value.
+//
+// If a rule matches, the token is considered an admin token if Admin is true,
+// the SANs are added to the X.509 certificate, and the Principals are added to
+// the SSH user certificate. In SANs and Principals, the string "${value}" is
+// replaced with the claim value that matched the rule.
+type OIDCClaimRule struct {
+	Claim      string   `json:"claim"`
+	Values     []string `json:"values"`
+	Regex      bool     `json:"regex,omitempty"`
+	Admin      bool     `json:"admin,omitempty"`
+	SANs       []string `json:"sans,omitempty"`
+	Principals []string `json:"principals,omitempty"`
+	regexps    []*regexp.Regexp
+}
+
+// Validate validates and initializes the rule.
+func (r *OIDCClaimRule) Validate() error {
+	switch {
+	case r.Claim == "":
+		return errors.New("claim cannot be empty")
+	case len(r.Values) == 0:
+		return errors.Errorf("rule for claim %q: values cannot be empty", r.Claim)
+	case !r.Admin && len(r.SANs) == 0 && len(r.Principals) == 0:
+		return errors.Errorf("rule for claim %q: admin, sans, or principals must be set", r.Claim)
+	}
+
+	if !r.Regex {
+		if err := validatePatterns(r.Values); err != nil {
+			return errors.Wrapf(err, "rule for claim %q", r.Claim)
+		}
+		return nil
+	}
+
+	r.regexps = make([]*regexp.Regexp, len(r.Values))
+	for i, v := range r.Values {
+		re, err := regexp.Compile("^(?:" + v + ")$")
+		if err != nil {
+			return errors.Errorf("rule for claim %q: regular expression %q is not valid", r.Claim, v)
+		}
+		r.regexps[i] = re
+	}
+	return nil
+}
+
+// matches returns the claim values that match the rule.
+func (r *OIDCClaimRule) matches(claims map[string]any) []string {
+	var matched []string
+	for _, v := range lookupClaim(claims, r.Claim) {
+		if r.Regex {
+			for _, re := range r.regexps {
+				if re.MatchString(v) {
+					matched = append(matched, v)
+					break
+				}
+			}
+		} else if matchesPatterns(r.Values, v) {
+			matched = append(matched, v)
+		}
+	}
+	return matched
+}
+
+// oidcClaimGrants contains the rights granted by the matching claim rules.
+type oidcClaimGrants struct {
+	admin      bool
+	sans       []string
+	principals []string
+}
+
+// evaluateClaimRules returns the rights granted by the rules matching the given
+// claims.
+func evaluateClaimRules(rules []OIDCClaimRule, claims map[string]any) oidcClaimGrants {
+	var grants oidcClaimGrants
+	for i := range rules {
+		values := rules[i].matches(claims)
+		if len(values) == 0 {
+			continue
+		}
+		grants.admin = grants.admin || rules[i].Admin
+		for _, v := range values {
+			grants.sans = appendUnique(grants.sans, expandRuleValues(rules[i].SANs, v)...)
+			grants.principals = appendUnique(grants.principals, expandRuleValues(rules[i].Principals, v)...)
+		}
+	}
+	return grants
+}
+
+// lookupClaim returns the string values of the given claim. The name is first
+// looked up as is, as claim names can contain dots, e.g. namespaced claims, and
+// then as a dotted path of nested claims.
+func lookupClaim(claims map[string]any, name string) []string {
+	if v, ok := claims[name]; ok {
+		return claimValues(v)
+	}
+	parts := strings.Split(name, ".")
+	var v any = claims
+	for _, p := range parts {
+		m, ok := v.(map[string]any)
+		if !ok {
+			return nil
+		}
+		if v, ok = m[p]; !ok {
+			return nil
+		}
+	}
+	return claimValues(v)
+}
+
+// claimValues returns the string representation of a claim value.
+func claimValues(v any) []string {
+	switch v := v.(type) {
+	case string:
+		return []string{v}
+	case bool:
+		return []string{strconv.FormatBool(v)}
+	case float64:
+		return []string{strconv.FormatFloat(v, 'f', -1, 64)}
+	case []any:
+		var values []string
+		for _, vv := range v {
+			values = append(values, claimValues(vv)...)
+		}
+		return values
+	default:
+		return nil
+	}
+}
+
+func expandRuleValues(templates []string, value string) []string {
+	values := make([]string, len(templates))
+	for i, s := range templates {
+		values[i] = strings.ReplaceAll(s, oidcRuleValuePlaceholder, value)
+	}
+	return values
+}
+
+func appendUnique(list []string, values ...string) []string {
+	for _, v := range values {
+		if v != "" && !containsString(list, v) {
+			list = append(list, v)
+		}
+	}
+	return list
+}
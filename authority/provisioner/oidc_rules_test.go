@@ -0,0 +1,180 @@
+package provisioner
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.step.sm/crypto/jose"
+	"go.step.sm/crypto/x509util"
+)
+
+func TestOIDCClaimRule_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    OIDCClaimRule
+		wantErr bool
+	}{
+		{"ok glob", OIDCClaimRule{Claim: "groups", Values: []string{"admin-*"}, Admin: true}, false},
+		{"ok regex", OIDCClaimRule{Claim: "groups", Values: []string{"eng-(dev|ops)"}, Regex: true, Principals: []string{"${value}"}}, false},
+		{"fail claim", OIDCClaimRule{Values: []string{"admin"}, Admin: true}, true},
+		{"fail values", OIDCClaimRule{Claim: "groups", Admin: true}, true},
+		{"fail no grants", OIDCClaimRule{Claim: "groups", Values: []string{"admin"}}, true},
+		{"fail glob", OIDCClaimRule{Claim: "groups", Values: []string{"admin-["}, Admin: true}, true},
+		{"fail regex", OIDCClaimRule{Claim: "groups", Values: []string{"admin-("}, Regex: true, Admin: true}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.rule.Validate()
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func Test_lookupClaim(t *testing.T) {
+	claims := map[string]any{
+		"email":                     "jane@example.com",
+		"groups":                    []any{"eng", "ops", 42.0, true, map[string]any{"foo": "bar"}},
+		"https://example.com/roles": []any{"admin"},
+		"realm_access": map[string]any{
+			"roles": []any{"offline_access", "ssh"},
+		},
+		"uid": 1000.0,
+	}
+	tests := []struct {
+		name string
+		want []string
+	}{
+		{"email", []string{"jane@example.com"}},
+		{"groups", []string{"eng", "ops", "42", "true"}},
+		{"https://example.com/roles", []string{"admin"}},
+		{"realm_access.roles", []string{"offline_access", "ssh"}},
+		{"uid", []string{"1000"}},
+		{"realm_access", nil},
+		{"email.domain", nil},
+		{"missing", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, lookupClaim(claims, tt.name))
+		})
+	}
+}
+
+func Test_evaluateClaimRules(t *testing.T) {
+	rules := []OIDCClaimRule{
+		{Claim: "groups", Values: []string{"ca-admins"}, Admin: true},
+		{Claim: "groups", Values: []string{"team-*"}, SANs: []string{"${value}.example.com"}},
+		{Claim: "realm_access.roles", Values: []string{"ssh-(.+)"}, Regex: true, Principals: []string{"${value}", "deploy"}},
+	}
+	for i := range rules {
+		require.NoError(t, rules[i].Validate())
+	}
+
+	tests := []struct {
+		name   string
+		claims map[string]any
+		want   oidcClaimGrants
+	}{
+		{"admin", map[string]any{"groups": []any{"ca-admins"}}, oidcClaimGrants{admin: true}},
+		{"sans", map[string]any{"groups": []any{"team-a", "team-b", "other"}}, oidcClaimGrants{
+			sans: []string{"team-a.example.com", "team-b.example.com"},
+		}},
+		{"principals", map[string]any{"realm_access": map[string]any{"roles": []any{"ssh-web", "ssh-db", "ssh-"}}}, oidcClaimGrants{
+			principals: []string{"ssh-web", "deploy", "ssh-db"},
+		}},
+		{"none", map[string]any{"groups": "team"}, oidcClaimGrants{}},
+		{"nil", nil, oidcClaimGrants{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, evaluateClaimRules(rules, tt.claims))
+		})
+	}
+}
+
+func TestOIDC_claimRules(t *testing.T) {
+	srv := generateJWKServer(1)
+	defer srv.Close()
+
+	var keys jose.JSONWebKeySet
+	require.NoError(t, getAndDecode(srv.Client(), srv.URL+"/private", &keys))
+
+	p, err := generateOIDC()
+	require.NoError(t, err)
+	p.ConfigurationEndpoint = srv.URL + "/.well-known/openid-configuration"
+	p.Domains = []string{"example.com"}
+	p.ClaimRules = []OIDCClaimRule{
+		{Claim: "groups", Values: []string{"ca-admins"}, Admin: true},
+		{Claim: "groups", Values: []string{"team-*"}, SANs: []string{"${value}.example.com"}, Principals: []string{"${value}"}},
+	}
+	require.NoError(t, p.Init(Config{Claims: globalProvisionerClaims}))
+
+	newToken := func(t *testing.T, email string, groups ...any) string {
+		t.Helper()
+		tok, err := generateCustomToken("subject", "the-issuer", p.ClientID, &keys.Keys[0], nil, map[string]any{
+			"email":  email,
+			"groups": groups,
+		})
+		require.NoError(t, err)
+		return tok
+	}
+
+	t.Run("sans", func(t *testing.T) {
+		opts, err := p.AuthorizeSign(context.Background(), newToken(t, "jane@example.com", "team-web"))
+		require.NoError(t, err)
+
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		require.NoError(t, err)
+		der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{}, key)
+		require.NoError(t, err)
+		csr, err := x509.ParseCertificateRequest(der)
+		require.NoError(t, err)
+
+		var certOpts []x509util.Option
+		for _, o := range opts {
+			if co, ok := o.(CertificateOptions); ok {
+				certOpts = append(certOpts, co.Options(SignOptions{})...)
+			}
+		}
+		cert, err := x509util.NewCertificate(csr, certOpts...)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"team-web.example.com"}, cert.GetCertificate().DNSNames)
+		assert.Equal(t, []string{"jane@example.com"}, cert.GetCertificate().EmailAddresses)
+	})
+
+	t.Run("admin", func(t *testing.T) {
+		// Admins are not restricted by domains and can revoke certificates.
+		tok := newToken(t, "root@other.com", "ca-admins")
+		assert.NoError(t, p.AuthorizeRevoke(context.Background(), tok))
+		_, err := p.AuthorizeSign(context.Background(), tok)
+		assert.NoError(t, err)
+
+		tok = newToken(t, "jane@example.com", "team-web")
+		assert.Error(t, p.AuthorizeRevoke(context.Background(), tok))
+		_, err = p.AuthorizeSign(context.Background(), newToken(t, "root@other.com", "team-web"))
+		assert.Error(t, err)
+	})
+
+	t.Run("principals", func(t *testing.T) {
+		opts, err := p.AuthorizeSSHSign(context.Background(), newToken(t, "jane@example.com", "team-web", "team-db"))
+		require.NoError(t, err)
+
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		require.NoError(t, err)
+		signer, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		require.NoError(t, err)
+		cert, err := signSSHCertificate(key.Public(), SignSSHOptions{CertType: SSHUserCert}, opts, signer)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"jane", "jane@example.com", "team-web", "team-db"}, cert.ValidPrincipals)
+	})
+}
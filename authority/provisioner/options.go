@@ -35,6 +35,19 @@ type Options struct {
 	Webhooks []*Webhook `json:"webhooks,omitempty"`
 	// Wire holds the options used for the ACME Wire integration
 	Wire *wire.Options `json:"wire,omitempty"`
+	// SMIME holds the options used to issue S/MIME certificates
+	SMIME *SMIMEOptions `json:"smime,omitempty"`
+	// CodeSigning holds the options used to issue code-signing certificates
+	CodeSigning *CodeSigningOptions `json:"codeSigning,omitempty"`
+	// VPN holds the options used to issue VPN and Wi-Fi authentication
+	// certificates
+	VPN *VPNOptions `json:"vpn,omitempty"`
+	// RateLimit holds the rate limits and quotas enforced for the provisioner
+	RateLimit *RateLimitOptions `json:"rateLimit,omitempty"`
+	// Renewal holds the checks done before renewing a certificate
+	Renewal *RenewalOptions `json:"renewal,omitempty"`
+	// DNS01 holds the options used to validate ACME dns-01 challenges
+	DNS01 *DNS01Options `json:"dns01,omitempty"`
 }
 
 // GetX509Options returns the X.509 options.
@@ -154,11 +167,19 @@ func CustomTemplateOptions(o *Options, data x509util.TemplateData, defaultTempla
 		}
 	}
 
+	// Use the VPN profile template by default.
+	if vpn := o.GetVPNOptions(); vpn != nil {
+		if err := vpn.setTemplateData(data); err != nil {
+			return nil, err
+		}
+		defaultTemplate = vpn.template()
+	}
+
 	return certificateOptionsFunc(func(so SignOptions) []x509util.Option {
 		// We're not provided user data without custom templates.
 		if !opts.HasTemplate() {
 			return []x509util.Option{
-				x509util.WithTemplate(defaultTemplate, data),
+				withX509Template(defaultTemplate, data),
 			}
 		}
 
@@ -175,7 +196,7 @@ func CustomTemplateOptions(o *Options, data x509util.TemplateData, defaultTempla
 		// Load a template from a file if Template is not defined.
 		if opts.Template == "" && opts.TemplateFile != "" {
 			return []x509util.Option{
-				x509util.WithTemplateFile(step.Abs(opts.TemplateFile), data),
+				withX509TemplateFile(step.Abs(opts.TemplateFile), data),
 			}
 		}
 
@@ -184,12 +205,12 @@ func CustomTemplateOptions(o *Options, data x509util.TemplateData, defaultTempla
 		template := strings.TrimSpace(opts.Template)
 		if strings.HasPrefix(template, "{") {
 			return []x509util.Option{
-				x509util.WithTemplate(template, data),
+				withX509Template(template, data),
 			}
 		}
 		// 2. As a base64 encoded JSON.
 		return []x509util.Option{
-			x509util.WithTemplateBase64(template, data),
+			withX509TemplateBase64(template, data),
 		}
 	}), nil
 }
@@ -257,6 +257,27 @@ func TestCustomTemplateOptions(t *testing.T) {
 	"keyUsage": ["digitalSignature"],
 	"extKeyUsage": ["serverAuth", "clientAuth"]
 }`)}, false},
+		{"okVPN", args{&Options{VPN: &VPNOptions{UPNSuffix: "corp.example.com"}}, x509util.TemplateData{
+			x509util.SubjectKey: x509util.Subject{CommonName: "foobar"},
+			x509util.SANsKey:    []x509util.SubjectAlternativeName{{Type: "dns", Value: "foo.com"}},
+		}, x509util.DefaultLeafTemplate, SignOptions{}}, x509util.Options{
+			CertBuffer: bytes.NewBufferString(`{
+	"subject": {"commonName":"foobar"},
+	"sans": [{"type":"dns","value":"foo.com"},{"type":"userPrincipalName","value":"foobar@corp.example.com"}],
+	"keyUsage": ["digitalSignature"],
+	"extKeyUsage": ["clientAuth"]
+}`)}, false},
+		{"okVPNIKEv2", args{&Options{VPN: &VPNOptions{Profile: "ikev2"}}, data, x509util.DefaultLeafTemplate, SignOptions{}}, x509util.Options{
+			CertBuffer: bytes.NewBufferString(`{
+	"subject": {"commonName":"foobar"},
+	"sans": [{"type":"dns","value":"foo.com"}],
+	"keyUsage": ["digitalSignature"],
+	"extKeyUsage": ["serverAuth", "clientAuth"],
+	"unknownExtKeyUsage": ["1.3.6.1.5.5.7.3.17", "1.3.6.1.5.5.8.2.2"]
+}`)}, false},
+		{"failVPNOtherSuffix", args{&Options{VPN: &VPNOptions{UPNSuffix: "corp.example.com"}}, x509util.TemplateData{
+			x509util.SubjectKey: x509util.Subject{CommonName: "administrator@corp.example"},
+		}, x509util.DefaultLeafTemplate, SignOptions{}}, x509util.Options{}, true},
 		{"fail", args{&Options{X509: &X509Options{TemplateData: []byte(`{"badJSON`)}}, data, x509util.DefaultLeafTemplate, SignOptions{}}, x509util.Options{}, true},
 		{"failTemplateData", args{&Options{X509: &X509Options{TemplateData: []byte(`{"badJSON}`)}}, data, x509util.DefaultLeafTemplate, SignOptions{}}, x509util.Options{}, true},
 	}
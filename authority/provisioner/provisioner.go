@@ -194,6 +194,28 @@ const (
 	TypeSCEP Type = 10
 	// TypeNebula is used to indicate the Nebula provisioners
 	TypeNebula Type = 11
+	// TypeWebAuthn is used to indicate the WebAuthn provisioners
+	TypeWebAuthn Type = 12
+	// TypeGitHubActions is used to indicate the GitHub Actions provisioners
+	TypeGitHubActions Type = 13
+	// TypeGitLabCI is used to indicate the GitLab CI provisioners
+	TypeGitLabCI Type = 14
+	// TypeKubernetes is used to indicate the Kubernetes provisioners
+	TypeKubernetes Type = 15
+	// TypeSPIFFE is used to indicate the SPIFFE provisioners
+	TypeSPIFFE Type = 16
+	// TypeSAML is used to indicate the SAML provisioners
+	TypeSAML Type = 17
+	// TypeLDAP is used to indicate the LDAP provisioners
+	TypeLDAP Type = 18
+	// TypeTPM is used to indicate the TPM provisioners
+	TypeTPM Type = 19
+	// TypeEST is used to indicate the EST provisioners
+	TypeEST Type = 20
+	// TypeCMP is used to indicate the CMP provisioners
+	TypeCMP Type = 21
+	// TypeWSTEP is used to indicate the WSTEP provisioners
+	TypeWSTEP Type = 22
 )
 
 // String returns the string representation of the type.
@@ -221,6 +243,28 @@ func (t Type) String() string {
 		return "SCEP"
 	case TypeNebula:
 		return "Nebula"
+	case TypeWebAuthn:
+		return "WebAuthn"
+	case TypeGitHubActions:
+		return "GitHubActions"
+	case TypeGitLabCI:
+		return "GitLabCI"
+	case TypeKubernetes:
+		return "Kubernetes"
+	case TypeSPIFFE:
+		return "SPIFFE"
+	case TypeSAML:
+		return "SAML"
+	case TypeLDAP:
+		return "LDAP"
+	case TypeTPM:
+		return "TPM"
+	case TypeEST:
+		return "EST"
+	case TypeCMP:
+		return "CMP"
+	case TypeWSTEP:
+		return "WSTEP"
 	default:
 		return ""
 	}
@@ -257,6 +301,15 @@ type Config struct {
 	// AuthorizeSSHRenewFunc is a function that returns nil if a given SSH
 	// certificate can be renewed.
 	AuthorizeSSHRenewFunc AuthorizeSSHRenewFunc
+	// GetWebAuthnCredentialFunc is a function that returns a WebAuthn
+	// credential registered using the admin API.
+	GetWebAuthnCredentialFunc GetWebAuthnCredentialFunc
+	// UpdateWebAuthnSignCountFunc is a function that stores the signature
+	// counter of a WebAuthn credential registered using the admin API.
+	UpdateWebAuthnSignCountFunc UpdateWebAuthnSignCountFunc
+	// ConsumeSCEPChallengeFunc is a function that validates and consumes a
+	// dynamic SCEP challenge password generated using the admin API.
+	ConsumeSCEPChallengeFunc ConsumeSCEPChallengeFunc
 	// WebhookClient is an HTTP client used when performing webhook requests.
 	WebhookClient *http.Client
 	// SCEPKeyManager, if defined, is the interface used by SCEP provisioners.
@@ -311,6 +364,28 @@ func (l *List) UnmarshalJSON(data []byte) error {
 			p = &SCEP{}
 		case "nebula":
 			p = &Nebula{}
+		case "webauthn":
+			p = &WebAuthn{}
+		case "githubactions":
+			p = &GitHubActions{}
+		case "gitlabci":
+			p = &GitLabCI{}
+		case "kubernetes":
+			p = &Kubernetes{}
+		case "spiffe":
+			p = &SPIFFE{}
+		case "saml":
+			p = &SAML{}
+		case "ldap":
+			p = &LDAP{}
+		case "tpm":
+			p = &TPMDevice{}
+		case "est":
+			p = &EST{}
+		case "cmp":
+			p = &CMP{}
+		case "wstep":
+			p = &WSTEP{}
 		default:
 			// Skip unsupported provisioners. A client using this method may be
 			// compiled with a version of smallstep/certificates that does not
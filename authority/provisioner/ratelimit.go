@@ -0,0 +1,39 @@
+package provisioner
+
+import (
+	"fmt"
+)
+
+// RateLimitOptions contains the rate limits and quotas enforced by the
+// authority for a provisioner. Limits with a zero value are not enforced.
+type RateLimitOptions struct {
+	// TokensPerMinute is the maximum number of tokens that the provisioner can
+	// authorize in a minute.
+	TokensPerMinute int `json:"tokensPerMinute,omitempty"`
+
+	// CertificatesPerDay is the maximum number of X.509 and SSH certificates
+	// that can be signed using the provisioner in a day.
+	CertificatesPerDay int `json:"certificatesPerDay,omitempty"`
+}
+
+// GetRateLimitOptions returns the rate limit options.
+func (o *Options) GetRateLimitOptions() *RateLimitOptions {
+	if o == nil {
+		return nil
+	}
+	return o.RateLimit
+}
+
+// Validate returns an error if the rate limit options are not valid.
+func (o *RateLimitOptions) Validate() error {
+	if o == nil {
+		return nil
+	}
+	if o.TokensPerMinute < 0 {
+		return fmt.Errorf("rateLimit tokensPerMinute %d cannot be negative", o.TokensPerMinute)
+	}
+	if o.CertificatesPerDay < 0 {
+		return fmt.Errorf("rateLimit certificatesPerDay %d cannot be negative", o.CertificatesPerDay)
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package provisioner
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimitOptions_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		options *RateLimitOptions
+		wantErr bool
+	}{
+		{"ok/nil", nil, false},
+		{"ok/empty", &RateLimitOptions{}, false},
+		{"ok", &RateLimitOptions{TokensPerMinute: 60, CertificatesPerDay: 1000}, false},
+		{"fail/tokensPerMinute", &RateLimitOptions{TokensPerMinute: -1}, true},
+		{"fail/certificatesPerDay", &RateLimitOptions{CertificatesPerDay: -1}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.options.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("RateLimitOptions.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestOptions_GetRateLimitOptions(t *testing.T) {
+	var o *Options
+	assert.Nil(t, o.GetRateLimitOptions())
+	o = &Options{RateLimit: &RateLimitOptions{TokensPerMinute: 10}}
+	assert.Equal(t, &RateLimitOptions{TokensPerMinute: 10}, o.GetRateLimitOptions())
+}
+
+func TestNewController_rateLimit(t *testing.T) {
+	_, err := NewController(&JWK{}, nil, Config{Claims: globalProvisionerClaims}, &Options{
+		RateLimit: &RateLimitOptions{TokensPerMinute: -1},
+	})
+	assert.Error(t, err)
+}
@@ -0,0 +1,24 @@
+package provisioner
+
+// RenewalOptions contains the checks done by the authority before renewing a
+// certificate signed by a provisioner.
+type RenewalOptions struct {
+	// CheckInventory requires the certificate to be active in the certificate
+	// inventory. Certificates marked as decommissioned or revoked cannot be
+	// renewed, even if they are still valid.
+	CheckInventory bool `json:"checkInventory,omitempty"`
+}
+
+// GetRenewalOptions returns the renewal options.
+func (o *Options) GetRenewalOptions() *RenewalOptions {
+	if o == nil {
+		return nil
+	}
+	return o.Renewal
+}
+
+// IsCheckInventory returns true if renewals require an active certificate in
+// the inventory.
+func (o *RenewalOptions) IsCheckInventory() bool {
+	return o != nil && o.CheckInventory
+}
@@ -0,0 +1,19 @@
+package provisioner
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenewalOptions_IsCheckInventory(t *testing.T) {
+	var o *Options
+	assert.Nil(t, o.GetRenewalOptions())
+	assert.False(t, o.GetRenewalOptions().IsCheckInventory())
+
+	o = &Options{Renewal: &RenewalOptions{}}
+	assert.False(t, o.GetRenewalOptions().IsCheckInventory())
+
+	o.Renewal.CheckInventory = true
+	assert.True(t, o.GetRenewalOptions().IsCheckInventory())
+}
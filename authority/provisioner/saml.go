@@ -0,0 +1,716 @@
+package provisioner
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/beevik/etree"
+	"github.com/pkg/errors"
+	dsig "github.com/russellhaering/goxmldsig"
+	"github.com/russellhaering/goxmldsig/etreeutils"
+
+	"go.step.sm/crypto/jose"
+	"go.step.sm/crypto/sshutil"
+	"go.step.sm/crypto/x509util"
+	"go.step.sm/linkedca"
+
+	"github.com/smallstep/certificates/errs"
+)
+
+// SAMLHeader is the name of the token header that contains the base64 encoded
+// SAML response.
+const SAMLHeader = "saml"
+
+// SAML namespaces and values used to validate a response.
+const (
+	samlProtocolNamespace  = "urn:oasis:names:tc:SAML:2.0:protocol"
+	samlAssertionNamespace = "urn:oasis:names:tc:SAML:2.0:assertion"
+	samlStatusSuccess      = "urn:oasis:names:tc:SAML:2.0:status:Success"
+	samlBearerMethod       = "urn:oasis:names:tc:SAML:2.0:cm:bearer"
+)
+
+// maxSAMLMetadataSize is the maximum size of the IdP metadata.
+const maxSAMLMetadataSize = 1 << 20
+
+// samlAssertion contains the validated fields of a SAML assertion.
+type samlAssertion struct {
+	ID         string
+	Issuer     string
+	NameID     string
+	Attributes map[string][]string
+}
+
+// samlPayload extends jwtPayload with the SAML assertion in the token.
+type samlPayload struct {
+	jwtPayload
+	assertion *samlAssertion
+}
+
+// samlEntityDescriptor contains the fields of the IdP metadata used by the
+// SAML provisioner.
+type samlEntityDescriptor struct {
+	EntityID         string `xml:"entityID,attr"`
+	IDPSSODescriptor struct {
+		KeyDescriptors []struct {
+			Use          string   `xml:"use,attr"`
+			Certificates []string `xml:"KeyInfo>X509Data>X509Certificate"`
+		} `xml:"KeyDescriptor"`
+	} `xml:"IDPSSODescriptor"`
+}
+
+// SAML is a provisioner that authorizes the issuance of certificates to users
+// authenticated by a SAML 2.0 identity provider.
+//
+// The IdP posts the signed response to the assertion consumer service (ACS) of
+// the provisioner, /saml/<name>/acs, which validates it and returns it to the
+// client. A SAML token is a JWT signed by an ephemeral key included in the
+// "jwk" header, and the "saml" header contains the base64 encoded response.
+// Each assertion can be used only once.
+//
+// The NameID of the assertion is the subject of the certificates. If it is an
+// email address it is also added as a SAN and, like in OIDC, the local part
+// and the email are used as SSH principals. The values of the attributes in
+// SANAttributes and PrincipalAttributes are added as SANs and SSH principals.
+// The names in the token must be a subset of those, if the token doesn't have
+// names, all of them are used.
+type SAML struct {
+	*base
+	ID   string `json:"-"`
+	Type string `json:"type"`
+	Name string `json:"name"`
+	// EntityID is the entity id of the service provider, the assertions must
+	// contain it in the audience restrictions.
+	EntityID string `json:"entityID"`
+	// ACSURLs are the URLs of the assertion consumer service allowed in the
+	// response destination and recipient. They default to the ACS of the
+	// provisioner on the DNS names of the CA.
+	ACSURLs []string `json:"acsURLs,omitempty"`
+	// IdPMetadataURL is the URL of the metadata of the identity provider, the
+	// entity id and signing certificates of the IdP are read from it.
+	IdPMetadataURL string `json:"idpMetadataURL,omitempty"`
+	// IdPEntityID is the entity id of the identity provider, it must match the
+	// issuer of the assertions.
+	IdPEntityID string `json:"idpEntityID,omitempty"`
+	// IdPCertificates are the PEM encoded certificates used by the identity
+	// provider to sign the responses.
+	IdPCertificates []byte `json:"idpCertificates,omitempty"`
+	// SANAttributes are the names of the attributes mapped to certificate
+	// SANs.
+	SANAttributes []string `json:"sanAttributes,omitempty"`
+	// PrincipalAttributes are the names of the attributes mapped to SSH
+	// principals.
+	PrincipalAttributes []string `json:"principalAttributes,omitempty"`
+	Claims              *Claims  `json:"claims,omitempty"`
+	Options             *Options `json:"options,omitempty"`
+	ctl                 *Controller
+	certStore           *dsig.MemoryX509CertificateStore
+}
+
+// GetID returns the provisioner unique identifier.
+func (p *SAML) GetID() string {
+	if p.ID != "" {
+		return p.ID
+	}
+	return p.GetIDForToken()
+}
+
+// GetIDForToken returns an identifier that will be used to load the provisioner
+// from a token.
+func (p *SAML) GetIDForToken() string {
+	return "saml/" + p.Name
+}
+
+// GetTokenID returns the identifier of the token. The id of the assertion is
+// used, so the same assertion cannot be used in different tokens.
+func (p *SAML) GetTokenID(ott string) (string, error) {
+	token, err := jose.ParseSigned(ott)
+	if err != nil {
+		return "", errors.Wrap(err, "error parsing token")
+	}
+	response, err := extractSAMLResponse(token)
+	if err != nil {
+		return "", err
+	}
+	doc, err := parseSAMLResponse(response)
+	if err != nil {
+		return "", err
+	}
+	el := doc.Root().FindElement("./Assertion")
+	if el == nil {
+		return "", errors.New("error parsing saml response: assertion not found")
+	}
+	id := el.SelectAttrValue("ID", "")
+	if id == "" {
+		return "", errors.New("error parsing saml response: assertion ID not found")
+	}
+	return id, nil
+}
+
+// GetName returns the name of the provisioner.
+func (p *SAML) GetName() string {
+	return p.Name
+}
+
+// GetType returns the type of provisioner.
+func (p *SAML) GetType() Type {
+	return TypeSAML
+}
+
+// GetEncryptedKey is not available in a SAML provisioner.
+func (p *SAML) GetEncryptedKey() (string, string, bool) {
+	return "", "", false
+}
+
+// GetOptions returns the configured provisioner options.
+func (p *SAML) GetOptions() *Options {
+	return p.Options
+}
+
+// Init validates and initializes the SAML provisioner.
+func (p *SAML) Init(config Config) (err error) {
+	switch {
+	case p.Type == "":
+		return errors.New("provisioner type cannot be empty")
+	case p.Name == "":
+		return errors.New("provisioner name cannot be empty")
+	case p.EntityID == "":
+		return errors.New("provisioner entityID cannot be empty")
+	case p.IdPMetadataURL == "" && len(p.IdPCertificates) == 0:
+		return errors.New("provisioner idpMetadataURL or idpCertificates are required")
+	}
+
+	if len(p.ACSURLs) == 0 {
+		p.ACSURLs = samlACSURLs(config.Audiences.Sign, p.Name)
+	}
+
+	config.Audiences = config.Audiences.WithFragment(p.GetIDForToken())
+	if p.ctl, err = NewController(p, p.Claims, config, p.Options); err != nil {
+		return
+	}
+
+	var certs []*x509.Certificate
+	if len(p.IdPCertificates) > 0 {
+		if certs, err = parseX5CRoots(p.IdPCertificates); err != nil {
+			return errors.Wrap(err, "error parsing idpCertificates")
+		}
+		if len(certs) == 0 {
+			return errors.Errorf("no x509 certificates found in idpCertificates for provisioner '%s'", p.GetName())
+		}
+	}
+	if p.IdPMetadataURL != "" {
+		md, err := p.getIdPMetadata()
+		if err != nil {
+			return err
+		}
+		if p.IdPEntityID == "" {
+			p.IdPEntityID = md.EntityID
+		}
+		mdCerts, err := md.signingCertificates()
+		if err != nil {
+			return errors.Wrapf(err, "error reading %s", p.IdPMetadataURL)
+		}
+		certs = append(certs, mdCerts...)
+	}
+
+	p.certStore = &dsig.MemoryX509CertificateStore{Roots: certs}
+	return nil
+}
+
+// getIdPMetadata downloads and parses the IdP metadata.
+func (p *SAML) getIdPMetadata() (*samlEntityDescriptor, error) {
+	resp, err := p.ctl.GetHTTPClient().Get(p.IdPMetadataURL)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to connect to %s", p.IdPMetadataURL)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return nil, errors.Errorf("error reading %s: status code %d", p.IdPMetadataURL, resp.StatusCode)
+	}
+	b, err := io.ReadAll(io.LimitReader(resp.Body, maxSAMLMetadataSize))
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading %s", p.IdPMetadataURL)
+	}
+	var md samlEntityDescriptor
+	if err := xml.Unmarshal(b, &md); err != nil {
+		return nil, errors.Wrapf(err, "error parsing %s", p.IdPMetadataURL)
+	}
+	return &md, nil
+}
+
+// signingCertificates returns the certificates in the key descriptors used for
+// signing.
+func (md *samlEntityDescriptor) signingCertificates() ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for _, kd := range md.IDPSSODescriptor.KeyDescriptors {
+		if kd.Use != "" && kd.Use != "signing" {
+			continue
+		}
+		for _, s := range kd.Certificates {
+			der, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(s), ""))
+			if err != nil {
+				return nil, errors.Wrap(err, "error decoding certificate")
+			}
+			cert, err := x509.ParseCertificate(der)
+			if err != nil {
+				return nil, errors.Wrap(err, "error parsing certificate")
+			}
+			certs = append(certs, cert)
+		}
+	}
+	if len(certs) == 0 {
+		return nil, errors.New("signing certificates not found")
+	}
+	return certs, nil
+}
+
+// ValidateResponse validates the signature and conditions of a base64 encoded
+// SAML response. It is used by the assertion consumer service.
+func (p *SAML) ValidateResponse(response string) error {
+	_, err := p.validateResponse(response)
+	return err
+}
+
+// validateResponse validates a base64 encoded SAML response and returns the
+// assertion in it. Only the elements covered by a signature are used.
+func (p *SAML) validateResponse(response string) (*samlAssertion, error) {
+	doc, err := parseSAMLResponse(response)
+	if err != nil {
+		return nil, err
+	}
+
+	el := doc.Root()
+	if el.Tag != "Response" || el.NamespaceURI() != samlProtocolNamespace {
+		return nil, errors.New("error validating saml response: root element is not a response")
+	}
+	if dest := el.SelectAttrValue("Destination", ""); dest != "" && !containsString(p.ACSURLs, dest) {
+		return nil, errors.Errorf("error validating saml response: destination %s is not allowed", dest)
+	}
+	if status := el.FindElement("./Status/StatusCode"); status == nil || status.SelectAttrValue("Value", "") != samlStatusSuccess {
+		return nil, errors.New("error validating saml response: response status is not success")
+	}
+	if el.FindElement("./EncryptedAssertion") != nil {
+		return nil, errors.New("error validating saml response: encrypted assertions are not supported")
+	}
+
+	// The assertion must be signed, or be part of a signed response.
+	var signed bool
+	if el.FindElement("./Signature") != nil {
+		if el, err = p.validateSignature(el); err != nil {
+			return nil, errors.Wrap(err, "error validating saml response signature")
+		}
+		signed = true
+	}
+	assertions := el.FindElements("./Assertion")
+	if len(assertions) != 1 {
+		return nil, errors.New("error validating saml response: response must contain exactly one assertion")
+	}
+	el = assertions[0]
+	if !signed || el.FindElement("./Signature") != nil {
+		if el, err = p.validateSignature(el); err != nil {
+			return nil, errors.Wrap(err, "error validating saml assertion signature")
+		}
+	}
+	if el.NamespaceURI() != samlAssertionNamespace {
+		return nil, errors.New("error validating saml response: invalid assertion")
+	}
+
+	return p.validateAssertion(el, time.Now().UTC())
+}
+
+// validateSignature validates the enveloped signature of the given element and
+// returns the signed element.
+func (p *SAML) validateSignature(el *etree.Element) (*etree.Element, error) {
+	// Declare the namespaces of the parents in the element, they are required
+	// to canonicalize it.
+	ctx, err := etreeutils.NSBuildParentContext(el)
+	if err != nil {
+		return nil, err
+	}
+	if ctx, err = ctx.SubContext(el); err != nil {
+		return nil, err
+	}
+	if el, err = etreeutils.NSDetatch(ctx, el); err != nil {
+		return nil, err
+	}
+	return dsig.NewDefaultValidationContext(p.certStore).Validate(el)
+}
+
+// validateAssertion validates the issuer, subject confirmation and conditions
+// of a signed assertion.
+func (p *SAML) validateAssertion(el *etree.Element, now time.Time) (*samlAssertion, error) {
+	a := &samlAssertion{
+		ID:         el.SelectAttrValue("ID", ""),
+		Attributes: make(map[string][]string),
+	}
+	if a.ID == "" {
+		return nil, errors.New("error validating saml assertion: ID cannot be empty")
+	}
+	if issuer := el.FindElement("./Issuer"); issuer != nil {
+		a.Issuer = strings.TrimSpace(issuer.Text())
+	}
+	if p.IdPEntityID != "" && a.Issuer != p.IdPEntityID {
+		return nil, errors.Errorf("error validating saml assertion: issuer %s is not valid", a.Issuer)
+	}
+	if nameID := el.FindElement("./Subject/NameID"); nameID != nil {
+		a.NameID = strings.TrimSpace(nameID.Text())
+	}
+	if a.NameID == "" {
+		return nil, errors.New("error validating saml assertion: NameID cannot be empty")
+	}
+
+	// According to the Web Browser SSO profile, a bearer subject confirmation
+	// with the ACS URL as the recipient and a NotOnOrAfter attribute is
+	// required.
+	var confirmed bool
+	for _, sc := range el.FindElements("./Subject/SubjectConfirmation") {
+		if sc.SelectAttrValue("Method", "") != samlBearerMethod {
+			continue
+		}
+		data := sc.FindElement("./SubjectConfirmationData")
+		if data == nil || !containsString(p.ACSURLs, data.SelectAttrValue("Recipient", "")) {
+			continue
+		}
+		if data.SelectAttrValue("NotOnOrAfter", "") == "" {
+			continue
+		}
+		if err := validateSAMLTimes(data, now); err != nil {
+			continue
+		}
+		confirmed = true
+		break
+	}
+	if !confirmed {
+		return nil, errors.New("error validating saml assertion: valid bearer subject confirmation not found")
+	}
+
+	conditions := el.FindElement("./Conditions")
+	if conditions == nil {
+		return nil, errors.New("error validating saml assertion: conditions not found")
+	}
+	if err := validateSAMLTimes(conditions, now); err != nil {
+		return nil, errors.Wrap(err, "error validating saml assertion conditions")
+	}
+	restrictions := conditions.FindElements("./AudienceRestriction")
+	if len(restrictions) == 0 {
+		return nil, errors.New("error validating saml assertion: audience restriction not found")
+	}
+	for _, ar := range restrictions {
+		var found bool
+		for _, aud := range ar.FindElements("./Audience") {
+			if strings.TrimSpace(aud.Text()) == p.EntityID {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, errors.Errorf("error validating saml assertion: audience %s not found", p.EntityID)
+		}
+	}
+
+	for _, attr := range el.FindElements("./AttributeStatement/Attribute") {
+		name := attr.SelectAttrValue("Name", "")
+		for _, v := range attr.FindElements("./AttributeValue") {
+			if s := strings.TrimSpace(v.Text()); s != "" {
+				a.Attributes[name] = append(a.Attributes[name], s)
+			}
+		}
+	}
+
+	return a, nil
+}
+
+// validateSAMLTimes validates the NotBefore and NotOnOrAfter attributes of an
+// element. Like in JWTs, a leeway of one minute is allowed.
+func validateSAMLTimes(el *etree.Element, now time.Time) error {
+	if v := el.SelectAttrValue("NotBefore", ""); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return errors.Wrapf(err, "error parsing NotBefore")
+		}
+		if now.Add(time.Minute).Before(t) {
+			return errors.New("assertion is not valid yet")
+		}
+	}
+	if v := el.SelectAttrValue("NotOnOrAfter", ""); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return errors.Wrapf(err, "error parsing NotOnOrAfter")
+		}
+		if !now.Add(-time.Minute).Before(t) {
+			return errors.New("assertion has expired")
+		}
+	}
+	return nil
+}
+
+// authorizeToken validates the token signature and claims, and the SAML
+// response in the token.
+func (p *SAML) authorizeToken(token string, audiences []string) (*samlPayload, error) {
+	jwt, err := jose.ParseSigned(token)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusUnauthorized, err, "saml.authorizeToken; error parsing saml token")
+	}
+	if len(jwt.Headers) == 0 || jwt.Headers[0].JSONWebKey == nil {
+		return nil, errs.Unauthorized("saml.authorizeToken; saml token missing jwk header")
+	}
+	response, err := extractSAMLResponse(jwt)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusUnauthorized, err, "saml.authorizeToken; error extracting saml header from token")
+	}
+
+	var claims samlPayload
+	if err = jwt.Claims(jwt.Headers[0].JSONWebKey, &claims.jwtPayload); err != nil {
+		return nil, errs.Wrap(http.StatusUnauthorized, err, "saml.authorizeToken; error parsing saml claims")
+	}
+
+	// According to "rfc7519 JSON Web Token" acceptable skew should be no
+	// more than a few minutes.
+	if err = claims.ValidateWithLeeway(jose.Expected{
+		Issuer: p.Name,
+		Time:   time.Now().UTC(),
+	}, time.Minute); err != nil {
+		return nil, errs.Wrapf(http.StatusUnauthorized, err, "saml.authorizeToken; invalid saml claims")
+	}
+	if !matchesAudience(claims.Audience, audiences) {
+		return nil, errs.Unauthorized("saml.authorizeToken; invalid saml token audience claim (aud); want %s, but got %s",
+			audiences, claims.Audience)
+	}
+
+	if claims.assertion, err = p.validateResponse(response); err != nil {
+		return nil, errs.Wrap(http.StatusUnauthorized, err, "saml.authorizeToken")
+	}
+	return &claims, nil
+}
+
+// sans returns the SANs granted by the assertion.
+func (a *samlAssertion) sans(attributes []string) []string {
+	var sans []string
+	if strings.Contains(a.NameID, "@") {
+		sans = append(sans, a.NameID)
+	}
+	for _, name := range attributes {
+		sans = appendUnique(sans, a.Attributes[name]...)
+	}
+	return sans
+}
+
+// principals returns the SSH principals granted by the assertion.
+func (a *samlAssertion) principals(attributes []string) []string {
+	principals := []string{a.NameID}
+	if i := strings.LastIndex(a.NameID, "@"); i > 0 {
+		principals = []string{a.NameID[:i], a.NameID}
+	}
+	for _, name := range attributes {
+		principals = appendUnique(principals, a.Attributes[name]...)
+	}
+	return principals
+}
+
+// AuthorizeRevoke returns an error if the token is not valid.
+func (p *SAML) AuthorizeRevoke(_ context.Context, token string) error {
+	_, err := p.authorizeToken(token, p.ctl.Audiences.Revoke)
+	return errs.Wrap(http.StatusInternalServerError, err, "saml.AuthorizeRevoke")
+}
+
+// AuthorizeSign validates the given token and returns the sign options that
+// will be used on certificate creation.
+func (p *SAML) AuthorizeSign(ctx context.Context, token string) ([]SignOption, error) {
+	if err := p.ctl.AuthorizeIssuance(); err != nil {
+		return nil, err
+	}
+	claims, err := p.authorizeToken(token, p.ctl.Audiences.Sign)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "saml.AuthorizeSign")
+	}
+
+	subject := claims.assertion.NameID
+	allowed := claims.assertion.sans(p.SANAttributes)
+	sans := claims.SANs
+	if len(sans) == 0 {
+		sans = allowed
+	}
+	for _, san := range sans {
+		if !containsString(allowed, san) {
+			return nil, errs.Unauthorized("saml.AuthorizeSign; name %q is not allowed for subject %s", san, subject)
+		}
+	}
+
+	// Certificate templates
+	data := x509util.CreateTemplateData(subject, sans)
+	if v, err := unsafeParseSigned(token); err == nil {
+		data.SetToken(v)
+	}
+
+	templateOptions, err := TemplateOptions(p.Options, data)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "saml.AuthorizeSign")
+	}
+
+	// Check the fingerprint of the certificate request if given.
+	var fingerprint string
+	if claims.Confirmation != nil {
+		fingerprint = claims.Confirmation.Fingerprint
+	}
+
+	return []SignOption{
+		p,
+		templateOptions,
+		// modifiers / withOptions
+		newProvisionerExtensionOption(TypeSAML, p.Name, subject).WithControllerOptions(p.ctl),
+		profileDefaultDuration(p.ctl.Claimer.DefaultTLSCertDuration()),
+		// validators
+		csrFingerprintValidator(fingerprint),
+		commonNameSliceValidator(append([]string{subject}, sans...)),
+		defaultPublicKeyValidator{keys: p.ctl.Claimer.KeyClaims()},
+		newDefaultSANsValidator(ctx, sans),
+		newClaimsValidityValidator(p.ctl.Claimer),
+		newX509NamePolicyValidator(p.ctl.getPolicy().getX509()),
+		p.ctl.newWebhookController(data, linkedca.Webhook_X509),
+	}, nil
+}
+
+// AuthorizeRenew returns an error if the renewal is disabled.
+func (p *SAML) AuthorizeRenew(ctx context.Context, cert *x509.Certificate) error {
+	return p.ctl.AuthorizeRenew(ctx, cert)
+}
+
+// AuthorizeSSHSign returns the list of SignOption for a SignSSH request. Only
+// user certificates can be signed by a SAML provisioner.
+func (p *SAML) AuthorizeSSHSign(_ context.Context, token string) ([]SignOption, error) {
+	if err := p.ctl.AuthorizeIssuance(); err != nil {
+		return nil, err
+	}
+	if !p.ctl.Claimer.IsSSHCAEnabled() {
+		return nil, errs.Unauthorized("saml.AuthorizeSSHSign; sshCA is disabled for saml provisioner '%s'", p.GetName())
+	}
+	claims, err := p.authorizeToken(token, p.ctl.Audiences.SSHSign)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "saml.AuthorizeSSHSign")
+	}
+
+	opts := SignSSHOptions{}
+	if claims.Step != nil && claims.Step.SSH != nil {
+		opts = *claims.Step.SSH
+	}
+	if opts.CertType != "" && opts.CertType != SSHUserCert {
+		return nil, errs.Forbidden("saml.AuthorizeSSHSign; saml provisioner can only sign user certificates")
+	}
+
+	subject := claims.assertion.NameID
+	allowed := claims.assertion.principals(p.PrincipalAttributes)
+	principals := allowed
+	if len(opts.Principals) > 0 {
+		principals = opts.Principals
+	}
+	for _, principal := range principals {
+		if !containsString(allowed, principal) {
+			return nil, errs.Unauthorized("saml.AuthorizeSSHSign; principal %q is not allowed for subject %s", principal, subject)
+		}
+	}
+
+	signOptions := []SignOption{
+		// validates user's SignSSHOptions with the ones in the token
+		sshCertOptionsValidator(opts),
+		// validate users's KeyID is the assertion subject.
+		sshCertOptionsValidator(SignSSHOptions{KeyID: subject}),
+	}
+
+	// Certificate templates.
+	data := sshutil.CreateTemplateData(sshutil.UserCert, subject, principals)
+	if v, err := unsafeParseSigned(token); err == nil {
+		data.SetToken(v)
+	}
+
+	templateOptions, err := TemplateSSHOptions(p.Options, data)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "saml.AuthorizeSSHSign")
+	}
+	signOptions = append(signOptions, templateOptions)
+
+	// Add modifiers from custom claims
+	t := now()
+	if !opts.ValidAfter.IsZero() {
+		signOptions = append(signOptions, sshCertValidAfterModifier(opts.ValidAfter.RelativeTime(t).Unix()))
+	}
+	if !opts.ValidBefore.IsZero() {
+		signOptions = append(signOptions, sshCertValidBeforeModifier(opts.ValidBefore.RelativeTime(t).Unix()))
+	}
+
+	return append(signOptions,
+		p,
+		// Set the validity bounds if not set.
+		&sshDefaultDuration{p.ctl.Claimer},
+		// Validate public key
+		&sshDefaultPublicKeyValidator{keys: p.ctl.Claimer.KeyClaims()},
+		// Validate the validity period.
+		&sshCertValidityValidator{p.ctl.Claimer},
+		// Require and validate all the default fields in the SSH certificate.
+		&sshCertDefaultValidator{},
+		// Ensure that all principal names are allowed
+		newSSHNamePolicyValidator(p.ctl.getPolicy().getSSHHost(), p.ctl.getPolicy().getSSHUser()),
+		// Call webhooks
+		p.ctl.newWebhookController(data, linkedca.Webhook_SSH),
+	), nil
+}
+
+// AuthorizeSSHRevoke returns nil if the token is valid, false otherwise.
+func (p *SAML) AuthorizeSSHRevoke(_ context.Context, token string) error {
+	_, err := p.authorizeToken(token, p.ctl.Audiences.SSHRevoke)
+	return errs.Wrap(http.StatusInternalServerError, err, "saml.AuthorizeSSHRevoke")
+}
+
+// samlACSURLs returns the URLs of the assertion consumer service of the
+// provisioner with the given name, using the sign audiences of the CA.
+func samlACSURLs(audiences []string, name string) []string {
+	var urls []string
+	for _, aud := range audiences {
+		u, err := url.Parse(aud)
+		if err != nil || u.Scheme != "https" || !strings.HasSuffix(u.Path, "/sign") || strings.HasSuffix(u.Path, "/ssh/sign") {
+			continue
+		}
+		u.Path = strings.TrimSuffix(u.Path, "/sign") + "/saml/" + url.PathEscape(name) + "/acs"
+		urls = appendUnique(urls, u.String())
+	}
+	return urls
+}
+
+// extractSAMLResponse returns the SAML response in the token header.
+func extractSAMLResponse(jwt *jose.JSONWebToken) (string, error) {
+	v, ok := jwt.Headers[0].ExtraHeaders[SAMLHeader]
+	if !ok {
+		return "", errors.New("token missing saml header")
+	}
+	var s string
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", errors.Wrap(err, "error marshaling saml header")
+	}
+	if err := json.Unmarshal(b, &s); err != nil || s == "" {
+		return "", errors.New("saml header is not valid")
+	}
+	return s, nil
+}
+
+// parseSAMLResponse decodes and parses a base64 encoded SAML response.
+func parseSAMLResponse(response string) (*etree.Document, error) {
+	b, err := base64.StdEncoding.DecodeString(response)
+	if err != nil {
+		return nil, errors.Wrap(err, "error decoding saml response")
+	}
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(b); err != nil {
+		return nil, errors.Wrap(err, "error parsing saml response")
+	}
+	if doc.Root() == nil {
+		return nil, errors.New("error parsing saml response: root element not found")
+	}
+	return doc, nil
+}
@@ -0,0 +1,417 @@
+package provisioner
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/beevik/etree"
+	dsig "github.com/russellhaering/goxmldsig"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.step.sm/crypto/jose"
+
+	"github.com/smallstep/certificates/api/render"
+)
+
+const samlTestIdP = "https://idp.example.com"
+
+type samlTestIdentityProvider struct {
+	key  *rsa.PrivateKey
+	cert *x509.Certificate
+}
+
+func newSAMLTestIdentityProvider(t *testing.T) *samlTestIdentityProvider {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "IdP"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return &samlTestIdentityProvider{key: key, cert: cert}
+}
+
+func (idp *samlTestIdentityProvider) pem() []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: idp.cert.Raw})
+}
+
+// samlTestAssertion contains the values used to generate a SAML response.
+type samlTestAssertion struct {
+	id            string
+	issuer        string
+	nameID        string
+	destination   string
+	recipient     string
+	audience      string
+	status        string
+	notOnOrAfter  time.Time
+	noExpiration  bool
+	signResponse  bool
+	signAssertion bool
+}
+
+func (idp *samlTestIdentityProvider) response(t *testing.T, a samlTestAssertion) string {
+	t.Helper()
+	now := time.Now().UTC()
+	if a.notOnOrAfter.IsZero() {
+		a.notOnOrAfter = now.Add(5 * time.Minute)
+	}
+	if a.status == "" {
+		a.status = samlStatusSuccess
+	}
+	xml := fmt.Sprintf(`<samlp:Response xmlns:samlp="urn:oasis:names:tc:SAML:2.0:protocol" xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion" ID="_response" Version="2.0" IssueInstant="%[1]s" Destination="%[2]s">
+<saml:Issuer>%[3]s</saml:Issuer>
+<samlp:Status><samlp:StatusCode Value="%[4]s"/></samlp:Status>
+<saml:Assertion xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion" ID="%[5]s" Version="2.0" IssueInstant="%[1]s">
+<saml:Issuer>%[3]s</saml:Issuer>
+<saml:Subject>
+<saml:NameID Format="urn:oasis:names:tc:SAML:1.1:nameid-format:emailAddress">%[6]s</saml:NameID>
+<saml:SubjectConfirmation Method="urn:oasis:names:tc:SAML:2.0:cm:bearer">
+<saml:SubjectConfirmationData NotOnOrAfter="%[7]s" Recipient="%[8]s"/>
+</saml:SubjectConfirmation>
+</saml:Subject>
+<saml:Conditions NotBefore="%[1]s" NotOnOrAfter="%[7]s">
+<saml:AudienceRestriction><saml:Audience>%[9]s</saml:Audience></saml:AudienceRestriction>
+</saml:Conditions>
+<saml:AttributeStatement>
+<saml:Attribute Name="hosts"><saml:AttributeValue>jane.example.com</saml:AttributeValue><saml:AttributeValue>10.0.0.1</saml:AttributeValue></saml:Attribute>
+<saml:Attribute Name="groups"><saml:AttributeValue>ops</saml:AttributeValue><saml:AttributeValue> </saml:AttributeValue></saml:Attribute>
+</saml:AttributeStatement>
+</saml:Assertion>
+</samlp:Response>`, now.Format(time.RFC3339), a.destination, a.issuer, a.status, a.id, a.nameID,
+		a.notOnOrAfter.Format(time.RFC3339), a.recipient, a.audience)
+
+	doc := etree.NewDocument()
+	require.NoError(t, doc.ReadFromString(xml))
+	ctx, err := dsig.NewSigningContext(idp.key, [][]byte{idp.cert.Raw})
+	require.NoError(t, err)
+	ctx.Canonicalizer = dsig.MakeC14N10ExclusiveCanonicalizerWithPrefixList("")
+
+	root := doc.Root()
+	if a.noExpiration {
+		root.FindElement("./Assertion/Subject/SubjectConfirmation/SubjectConfirmationData").RemoveAttr("NotOnOrAfter")
+	}
+	if a.signAssertion {
+		el := root.FindElement("./Assertion")
+		signed, err := ctx.SignEnveloped(el)
+		require.NoError(t, err)
+		root.RemoveChild(el)
+		root.AddChild(signed)
+	}
+	if a.signResponse {
+		signed, err := ctx.SignEnveloped(root)
+		require.NoError(t, err)
+		doc.SetRoot(signed)
+	}
+	b, err := doc.WriteToBytes()
+	require.NoError(t, err)
+	return base64.StdEncoding.EncodeToString(b)
+}
+
+func generateSAMLToken(t *testing.T, response string, claims any) string {
+	t.Helper()
+	payload, err := json.Marshal(claims)
+	require.NoError(t, err)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	so := new(jose.SignerOptions)
+	so.WithType("JWT")
+	so.WithHeader(SAMLHeader, response)
+	so.EmbedJWK = true
+	sig, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.ES256, Key: key}, so)
+	require.NoError(t, err)
+	jws, err := sig.Sign(payload)
+	require.NoError(t, err)
+	tok, err := jws.CompactSerialize()
+	require.NoError(t, err)
+	return tok
+}
+
+func generateSAML(t *testing.T, idp *samlTestIdentityProvider) *SAML {
+	t.Helper()
+	p := &SAML{
+		Type:                "SAML",
+		Name:                "saml",
+		EntityID:            "https://ca.smallstep.com/saml",
+		IdPEntityID:         samlTestIdP,
+		IdPCertificates:     idp.pem(),
+		SANAttributes:       []string{"hosts"},
+		PrincipalAttributes: []string{"groups"},
+	}
+	require.NoError(t, p.Init(Config{Claims: globalProvisionerClaims, Audiences: testAudiences}))
+	return p
+}
+
+func validSAMLTestAssertion(p *SAML) samlTestAssertion {
+	return samlTestAssertion{
+		id:            "_assertion",
+		issuer:        samlTestIdP,
+		nameID:        "jane@example.com",
+		destination:   p.ACSURLs[0],
+		recipient:     p.ACSURLs[0],
+		audience:      p.EntityID,
+		signAssertion: true,
+	}
+}
+
+func TestSAML_Getters(t *testing.T) {
+	p := generateSAML(t, newSAMLTestIdentityProvider(t))
+	assert.Equal(t, "saml/saml", p.GetID())
+	assert.Equal(t, "saml/saml", p.GetIDForToken())
+	assert.Equal(t, "saml", p.GetName())
+	assert.Equal(t, TypeSAML, p.GetType())
+	assert.Equal(t, "SAML", p.GetType().String())
+	kid, key, ok := p.GetEncryptedKey()
+	assert.Empty(t, kid)
+	assert.Empty(t, key)
+	assert.False(t, ok)
+	assert.Equal(t, []string{
+		"https://ca.smallstep.com/1.0/saml/saml/acs",
+		"https://ca.smallstep.com/saml/saml/acs",
+	}, p.ACSURLs)
+}
+
+func TestSAML_Init(t *testing.T) {
+	idp := newSAMLTestIdentityProvider(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/metadata":
+			fmt.Fprintf(w, `<EntityDescriptor xmlns="urn:oasis:names:tc:SAML:2.0:metadata" entityID="%s">
+<IDPSSODescriptor protocolSupportEnumeration="urn:oasis:names:tc:SAML:2.0:protocol">
+<KeyDescriptor use="signing"><KeyInfo xmlns="http://www.w3.org/2000/09/xmldsig#"><X509Data><X509Certificate>
+%s
+</X509Certificate></X509Data></KeyInfo></KeyDescriptor>
+</IDPSSODescriptor>
+</EntityDescriptor>`, samlTestIdP, base64.StdEncoding.EncodeToString(idp.cert.Raw))
+		case "/empty":
+			fmt.Fprintf(w, `<EntityDescriptor xmlns="urn:oasis:names:tc:SAML:2.0:metadata" entityID="%s"/>`, samlTestIdP)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	config := Config{Claims: globalProvisionerClaims, Audiences: testAudiences}
+	tests := []struct {
+		name    string
+		p       *SAML
+		wantErr bool
+	}{
+		{"ok idpCertificates", &SAML{Type: "SAML", Name: "saml", EntityID: "sp", IdPCertificates: idp.pem()}, false},
+		{"ok idpMetadataURL", &SAML{Type: "SAML", Name: "saml", EntityID: "sp", IdPMetadataURL: srv.URL + "/metadata"}, false},
+		{"fail type", &SAML{Name: "saml", EntityID: "sp", IdPCertificates: idp.pem()}, true},
+		{"fail name", &SAML{Type: "SAML", EntityID: "sp", IdPCertificates: idp.pem()}, true},
+		{"fail entityID", &SAML{Type: "SAML", Name: "saml", IdPCertificates: idp.pem()}, true},
+		{"fail idp", &SAML{Type: "SAML", Name: "saml", EntityID: "sp"}, true},
+		{"fail idpCertificates", &SAML{Type: "SAML", Name: "saml", EntityID: "sp", IdPCertificates: []byte("foo")}, true},
+		{"fail idpMetadataURL", &SAML{Type: "SAML", Name: "saml", EntityID: "sp", IdPMetadataURL: srv.URL + "/missing"}, true},
+		{"fail idpMetadataURL certificates", &SAML{Type: "SAML", Name: "saml", EntityID: "sp", IdPMetadataURL: srv.URL + "/empty"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.p.Init(config)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Len(t, tt.p.certStore.Roots, 1)
+		})
+	}
+
+	p := &SAML{Type: "SAML", Name: "saml", EntityID: "sp", IdPMetadataURL: srv.URL + "/metadata"}
+	require.NoError(t, p.Init(config))
+	assert.Equal(t, samlTestIdP, p.IdPEntityID)
+}
+
+func TestSAML_validateResponse(t *testing.T) {
+	idp := newSAMLTestIdentityProvider(t)
+	p := generateSAML(t, idp)
+
+	other := newSAMLTestIdentityProvider(t)
+	modified := func(fn func(a *samlTestAssertion)) samlTestAssertion {
+		a := validSAMLTestAssertion(p)
+		fn(&a)
+		return a
+	}
+
+	tests := []struct {
+		name     string
+		idp      *samlTestIdentityProvider
+		response samlTestAssertion
+		wantErr  bool
+	}{
+		{"ok signed assertion", idp, validSAMLTestAssertion(p), false},
+		{"ok signed response", idp, modified(func(a *samlTestAssertion) { a.signAssertion, a.signResponse = false, true }), false},
+		{"ok signed both", idp, modified(func(a *samlTestAssertion) { a.signResponse = true }), false},
+		{"fail unsigned", idp, modified(func(a *samlTestAssertion) { a.signAssertion = false }), true},
+		{"fail signature", other, validSAMLTestAssertion(p), true},
+		{"fail status", idp, modified(func(a *samlTestAssertion) { a.status = "urn:oasis:names:tc:SAML:2.0:status:Requester" }), true},
+		{"fail destination", idp, modified(func(a *samlTestAssertion) { a.destination = "https://evil.com/acs" }), true},
+		{"fail recipient", idp, modified(func(a *samlTestAssertion) { a.recipient = "https://evil.com/acs" }), true},
+		{"fail audience", idp, modified(func(a *samlTestAssertion) { a.audience = "https://evil.com" }), true},
+		{"fail issuer", idp, modified(func(a *samlTestAssertion) { a.issuer = "https://evil.com" }), true},
+		{"fail nameID", idp, modified(func(a *samlTestAssertion) { a.nameID = "" }), true},
+		{"fail expired", idp, modified(func(a *samlTestAssertion) { a.notOnOrAfter = time.Now().Add(-2 * time.Minute) }), true},
+		{"fail confirmation without expiration", idp, modified(func(a *samlTestAssertion) { a.noExpiration = true }), true},
+		{"fail confirmation without expiration signed response", idp, modified(func(a *samlTestAssertion) { a.noExpiration, a.signAssertion, a.signResponse = true, false, true }), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := p.validateResponse(tt.idp.response(t, tt.response))
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, &samlAssertion{
+				ID:     "_assertion",
+				Issuer: samlTestIdP,
+				NameID: "jane@example.com",
+				Attributes: map[string][]string{
+					"hosts":  {"jane.example.com", "10.0.0.1"},
+					"groups": {"ops"},
+				},
+			}, got)
+		})
+	}
+
+	t.Run("fail modified", func(t *testing.T) {
+		b, err := base64.StdEncoding.DecodeString(idp.response(t, validSAMLTestAssertion(p)))
+		require.NoError(t, err)
+		doc := etree.NewDocument()
+		require.NoError(t, doc.ReadFromBytes(b))
+		doc.Root().FindElement("./Assertion/Subject/NameID").SetText("root@example.com")
+		b, err = doc.WriteToBytes()
+		require.NoError(t, err)
+		assert.Error(t, p.ValidateResponse(base64.StdEncoding.EncodeToString(b)))
+	})
+
+	t.Run("fail not base64", func(t *testing.T) {
+		assert.Error(t, p.ValidateResponse("not base64"))
+	})
+}
+
+func TestSAML_authorizeToken(t *testing.T) {
+	idp := newSAMLTestIdentityProvider(t)
+	p := generateSAML(t, idp)
+	aud := p.ctl.Audiences.Sign[0]
+	response := idp.response(t, validSAMLTestAssertion(p))
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr bool
+	}{
+		{"ok", generateSAMLToken(t, response, webAuthnClaims("", p.Name, aud, nil, nil)), false},
+		{"fail token", "foo", true},
+		{"fail issuer", generateSAMLToken(t, response, webAuthnClaims("", "foo", aud, nil, nil)), true},
+		{"fail audience", generateSAMLToken(t, response, webAuthnClaims("", p.Name, "foo", nil, nil)), true},
+		{"fail response", generateSAMLToken(t, idp.response(t, samlTestAssertion{id: "_assertion"}), webAuthnClaims("", p.Name, aud, nil, nil)), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := p.authorizeToken(tt.token, p.ctl.Audiences.Sign)
+			if tt.wantErr {
+				var sc render.StatusCodedError
+				require.ErrorAs(t, err, &sc)
+				assert.Equal(t, http.StatusUnauthorized, sc.StatusCode())
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "jane@example.com", got.assertion.NameID)
+
+			id, err := p.GetTokenID(tt.token)
+			require.NoError(t, err)
+			assert.Equal(t, "_assertion", id)
+		})
+	}
+}
+
+func TestSAML_AuthorizeSign(t *testing.T) {
+	idp := newSAMLTestIdentityProvider(t)
+	p := generateSAML(t, idp)
+	aud := p.ctl.Audiences.Sign[0]
+	response := idp.response(t, validSAMLTestAssertion(p))
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr bool
+	}{
+		{"ok", generateSAMLToken(t, response, webAuthnClaims("", p.Name, aud, nil, nil)), false},
+		{"ok sans", generateSAMLToken(t, response, webAuthnClaims("", p.Name, aud, []string{"jane@example.com", "10.0.0.1"}, nil)), false},
+		{"fail sans", generateSAMLToken(t, response, webAuthnClaims("", p.Name, aud, []string{"joe.example.com"}, nil)), true},
+		{"fail token", "foo", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := p.AuthorizeSign(context.Background(), tt.token)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Len(t, got, 11)
+		})
+	}
+}
+
+func TestSAML_AuthorizeSSHSign(t *testing.T) {
+	idp := newSAMLTestIdentityProvider(t)
+	p := generateSAML(t, idp)
+	aud := p.ctl.Audiences.SSHSign[0]
+	response := idp.response(t, validSAMLTestAssertion(p))
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	signer, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name           string
+		token          string
+		wantPrincipals []string
+		wantErr        bool
+	}{
+		{"ok", generateSAMLToken(t, response, webAuthnClaims("", p.Name, aud, nil, nil)), []string{"jane", "jane@example.com", "ops"}, false},
+		{"ok principals", generateSAMLToken(t, response, webAuthnClaims("", p.Name, aud, nil, &SignSSHOptions{Principals: []string{"ops"}})), []string{"ops"}, false},
+		{"fail principals", generateSAMLToken(t, response, webAuthnClaims("", p.Name, aud, nil, &SignSSHOptions{Principals: []string{"root"}})), nil, true},
+		{"fail host", generateSAMLToken(t, response, webAuthnClaims("", p.Name, aud, nil, &SignSSHOptions{CertType: SSHHostCert})), nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts, err := p.AuthorizeSSHSign(context.Background(), tt.token)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			cert, err := signSSHCertificate(key.Public(), SignSSHOptions{}, opts, signer)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantPrincipals, cert.ValidPrincipals)
+			assert.Equal(t, "jane@example.com", cert.KeyId)
+		})
+	}
+}
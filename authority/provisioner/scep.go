@@ -7,8 +7,11 @@ import (
 	"crypto/subtle"
 	"crypto/x509"
 	"encoding/pem"
+	stderrors "errors"
 	"fmt"
 	"net/http"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/pkg/errors"
@@ -31,6 +34,23 @@ type SCEP struct {
 	ChallengePassword string   `json:"challenge,omitempty"`
 	Capabilities      []string `json:"capabilities,omitempty"`
 
+	// DynamicChallenges enables single-use challenge passwords generated
+	// using the admin API. If a static challenge password is also set, it is
+	// accepted too.
+	DynamicChallenges *SCEPDynamicChallengeOptions `json:"dynamicChallenges,omitempty"`
+
+	// Renewal enables the renewal of certificates using RenewalReq messages
+	// signed with the certificate to renew, without a challenge password.
+	Renewal *SCEPRenewalOptions `json:"renewal,omitempty"`
+
+	// Intune enables the validation of SCEP requests using the Microsoft
+	// Intune SCEP validation API.
+	Intune *SCEPIntuneOptions `json:"intune,omitempty"`
+
+	// RA enables a dedicated RA certificate and decryption key generated and
+	// rotated by the CA. It cannot be used with a configured decrypter.
+	RA *SCEPRAOptions `json:"ra,omitempty"`
+
 	// IncludeRoot makes the provisioner return the CA root in addition to the
 	// intermediate in the GetCACerts response
 	IncludeRoot bool `json:"includeRoot,omitempty"`
@@ -50,13 +70,16 @@ type SCEP struct {
 
 	// Numerical identifier for the ContentEncryptionAlgorithm as defined in github.com/mozilla-services/pkcs7
 	// at https://github.com/mozilla-services/pkcs7/blob/33d05740a3526e382af6395d3513e73d4e66d1cb/encrypt.go#L63
-	// Defaults to 0, being DES-CBC
+	// Defaults to 0, which uses the algorithm of the request if it's advertised
+	// in the capabilities, and DES-CBC otherwise. Other values are always used.
 	EncryptionAlgorithmIdentifier int      `json:"encryptionAlgorithmIdentifier,omitempty"`
 	Options                       *Options `json:"options,omitempty"`
 	Claims                        *Claims  `json:"claims,omitempty"`
 	ctl                           *Controller
 	encryptionAlgorithm           int
 	challengeValidationController *challengeValidationController
+	consumeChallenge              ConsumeSCEPChallengeFunc
+	intuneValidator               *intuneValidator
 	notificationController        *notificationController
 	keyManager                    SCEPKeyManager
 	decrypter                     crypto.Decrypter
@@ -255,12 +278,36 @@ func (s *SCEP) Init(config Config) (err error) {
 		return errors.New("only encryption algorithm identifiers from 0 to 4 are valid")
 	}
 
+	if err := s.validateCapabilities(); err != nil {
+		return err
+	}
+
 	// Prepare the SCEP challenge validator
 	s.challengeValidationController = newChallengeValidationController(
 		config.WebhookClient,
 		s.GetOptions().GetWebhooks(),
 	)
 
+	if err := s.DynamicChallenges.Validate(); err != nil {
+		return err
+	}
+	if err := s.Renewal.Validate(); err != nil {
+		return err
+	}
+	if err := s.Intune.Validate(); err != nil {
+		return err
+	}
+	if s.Intune != nil {
+		s.intuneValidator = newIntuneValidator(config.HTTPClient, s.Intune)
+	}
+	if err := s.RA.Validate(); err != nil {
+		return err
+	}
+	if s.RA != nil && (len(s.DecrypterCertificate) > 0 || len(s.DecrypterKeyPEM) > 0 || s.DecrypterKeyURI != "") {
+		return errors.New("scep ra cannot be used with a decrypter certificate or key")
+	}
+	s.consumeChallenge = config.ConsumeSCEPChallengeFunc
+
 	// Prepare the SCEP notification controller
 	s.notificationController = newNotificationController(
 		config.WebhookClient,
@@ -395,6 +442,9 @@ func (s *SCEP) Init(config Config) (err error) {
 // in the SCEP protocol. This method returns a list of modifiers / constraints
 // on the resulting certificate.
 func (s *SCEP) AuthorizeSign(context.Context, string) ([]SignOption, error) {
+	if err := s.ctl.AuthorizeIssuance(); err != nil {
+		return nil, err
+	}
 	return []SignOption{
 		s,
 		// modifiers / withOptions
@@ -403,12 +453,48 @@ func (s *SCEP) AuthorizeSign(context.Context, string) ([]SignOption, error) {
 		profileDefaultDuration(s.ctl.Claimer.DefaultTLSCertDuration()),
 		// validators
 		newPublicKeyMinimumLengthValidator(s.MinimumPublicKeyLength),
-		newValidityValidator(s.ctl.Claimer.MinTLSCertDuration(), s.ctl.Claimer.MaxTLSCertDuration()),
+		newClaimsValidityValidator(s.ctl.Claimer),
 		newX509NamePolicyValidator(s.ctl.getPolicy().getX509()),
 		s.ctl.newWebhookController(nil, linkedca.Webhook_X509),
 	}, nil
 }
 
+// GetRAOptions returns the options of the RA certificates generated by the
+// CA for the provisioner. It returns nil if they are not enabled.
+func (s *SCEP) GetRAOptions() *SCEPRAOptions {
+	return s.RA
+}
+
+// scepCapabilities are the capabilities supported in the GetCACaps response.
+var scepCapabilities = []string{
+	"AES", "DES3", "POSTPKIOperation", "Renewal", "SHA-1", "SHA-256", "SHA-512", "SCEPStandard",
+}
+
+// validateCapabilities validates and normalizes the configured capabilities.
+// Capabilities are case-insensitive, but some clients only recognize them
+// using the case defined in RFC 8894.
+func (s *SCEP) validateCapabilities() error {
+	if len(s.Capabilities) == 0 {
+		return nil
+	}
+	for i, c := range s.Capabilities {
+		j := slices.IndexFunc(scepCapabilities, func(v string) bool {
+			return strings.EqualFold(v, c)
+		})
+		if j == -1 {
+			return errors.Errorf("scep capability %q is not supported", c)
+		}
+		s.Capabilities[i] = scepCapabilities[j]
+	}
+	switch {
+	case s.Renewal != nil && !slices.Contains(s.Capabilities, "Renewal"):
+		return errors.New("scep renewal requires the Renewal capability")
+	case s.EncryptionAlgorithmIdentifier != 0 && !slices.Contains(s.Capabilities, "AES"):
+		return errors.New("scep encryptionAlgorithmIdentifier requires the AES capability")
+	}
+	return nil
+}
+
 // GetCapabilities returns the CA capabilities
 func (s *SCEP) GetCapabilities() []string {
 	return s.Capabilities
@@ -447,6 +533,22 @@ func (s *SCEP) ValidateChallenge(ctx context.Context, csr *x509.CertificateReque
 	switch s.selectValidationMethod() {
 	case validationMethodWebhook:
 		return s.challengeValidationController.Validate(ctx, csr, s.Name, challenge, transactionID)
+	case validationMethodIntune:
+		if s.intuneValidator == nil {
+			return fmt.Errorf("provisioner %q wasn't initialized", s.Name)
+		}
+		return s.intuneValidator.Validate(ctx, csr, transactionID)
+	case validationMethodDynamic:
+		if s.ChallengePassword != "" && subtle.ConstantTimeCompare([]byte(s.ChallengePassword), []byte(challenge)) == 1 {
+			return nil
+		}
+		if s.consumeChallenge == nil {
+			return fmt.Errorf("provisioner %q does not support dynamic challenges", s.Name)
+		}
+		if err := s.consumeChallenge(ctx, s, challenge); err != nil {
+			return fmt.Errorf("invalid challenge password provided: %w", err)
+		}
+		return nil
 	default:
 		if subtle.ConstantTimeCompare([]byte(s.ChallengePassword), []byte(challenge)) == 0 {
 			return errors.New("invalid challenge password provided")
@@ -455,18 +557,32 @@ func (s *SCEP) ValidateChallenge(ctx context.Context, csr *x509.CertificateReque
 	}
 }
 
+// NotifySuccess notifies the issuance of a certificate to the configured
+// notification webhooks. If the request was validated by Intune, the
+// certificate is reported to Intune too.
 func (s *SCEP) NotifySuccess(ctx context.Context, csr *x509.CertificateRequest, cert *x509.Certificate, transactionID string) error {
 	if s.notificationController == nil {
 		return fmt.Errorf("provisioner %q wasn't initialized", s.Name)
 	}
-	return s.notificationController.Success(ctx, csr, cert, transactionID)
+	var intuneErr error
+	if s.selectValidationMethod() == validationMethodIntune && s.intuneValidator != nil {
+		intuneErr = s.intuneValidator.NotifySuccess(ctx, csr, cert, transactionID)
+	}
+	return stderrors.Join(intuneErr, s.notificationController.Success(ctx, csr, cert, transactionID))
 }
 
+// NotifyFailure notifies a failed request to the configured notification
+// webhooks. If the request was validated by Intune, the failure is reported to
+// Intune too.
 func (s *SCEP) NotifyFailure(ctx context.Context, csr *x509.CertificateRequest, transactionID string, errorCode int, errorDescription string) error {
 	if s.notificationController == nil {
 		return fmt.Errorf("provisioner %q wasn't initialized", s.Name)
 	}
-	return s.notificationController.Failure(ctx, csr, transactionID, errorCode, errorDescription)
+	var intuneErr error
+	if s.selectValidationMethod() == validationMethodIntune && s.intuneValidator != nil {
+		intuneErr = s.intuneValidator.NotifyFailure(ctx, csr, transactionID, errorCode, errorDescription)
+	}
+	return stderrors.Join(intuneErr, s.notificationController.Failure(ctx, csr, transactionID, errorCode, errorDescription))
 }
 
 type validationMethod string
@@ -475,16 +591,26 @@ const (
 	validationMethodNone    validationMethod = "none"
 	validationMethodStatic  validationMethod = "static"
 	validationMethodWebhook validationMethod = "webhook"
+	validationMethodDynamic validationMethod = "dynamic"
+	validationMethodIntune  validationMethod = "intune"
 )
 
 // selectValidationMethod returns the method to validate SCEP
 // challenges. If a webhook is configured with kind `SCEPCHALLENGE`,
-// the webhook method will be used. If a challenge password is set,
-// the static method is used. It will default to the `none` method.
+// the webhook method will be used. If the Intune integration is enabled,
+// the intune method is used. If dynamic challenges are enabled,
+// the dynamic method is used. If a challenge password is set, the
+// static method is used. It will default to the `none` method.
 func (s *SCEP) selectValidationMethod() validationMethod {
 	if len(s.challengeValidationController.webhooks) > 0 {
 		return validationMethodWebhook
 	}
+	if s.Intune != nil {
+		return validationMethodIntune
+	}
+	if s.DynamicChallenges != nil {
+		return validationMethodDynamic
+	}
 	if s.ChallengePassword != "" {
 		return validationMethodStatic
 	}
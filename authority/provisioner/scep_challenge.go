@@ -0,0 +1,78 @@
+package provisioner
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultSCEPDynamicChallengeTTL is the default lifetime of the SCEP dynamic
+// challenges.
+const DefaultSCEPDynamicChallengeTTL = time.Hour
+
+// SCEPDynamicChallengeOptions enables single-use challenge passwords in a
+// SCEP provisioner. The challenges are generated using the admin API, and
+// they are consumed by the first enrollment that uses them.
+type SCEPDynamicChallengeOptions struct {
+	// TTL is the default lifetime of the challenges. Defaults to 1h.
+	TTL *Duration `json:"ttl,omitempty"`
+}
+
+// Validate returns an error if the lifetime of the challenges is negative.
+func (o *SCEPDynamicChallengeOptions) Validate() error {
+	if o != nil && o.TTL != nil && o.TTL.Duration < 0 {
+		return errors.Errorf("scep dynamicChallenges ttl %s cannot be negative", o.TTL)
+	}
+	return nil
+}
+
+// GetTTL returns the default lifetime of the challenges.
+func (o *SCEPDynamicChallengeOptions) GetTTL() time.Duration {
+	if o == nil || o.TTL == nil || o.TTL.Duration == 0 {
+		return DefaultSCEPDynamicChallengeTTL
+	}
+	return o.TTL.Duration
+}
+
+// SCEPDynamicChallenge is a single-use challenge password of a SCEP
+// provisioner. The challenge password itself is not stored, the ID is the
+// hex encoded SHA-256 digest of it.
+type SCEPDynamicChallenge struct {
+	// ID is the hex encoded SHA-256 digest of the challenge password.
+	ID string `json:"id"`
+	// ProvisionerID is the id of the provisioner the challenge belongs to.
+	ProvisionerID string `json:"provisionerID"`
+	// CreatedAt is the time the challenge was generated.
+	CreatedAt time.Time `json:"createdAt"`
+	// ExpiresAt is the time the challenge stops being valid.
+	ExpiresAt time.Time `json:"expiresAt"`
+	// UsedAt is the time the challenge was consumed by an enrollment.
+	UsedAt time.Time `json:"usedAt,omitempty"`
+}
+
+// Validate returns an error if the challenge cannot be used at the given
+// time.
+func (c *SCEPDynamicChallenge) Validate(now time.Time) error {
+	switch {
+	case !c.UsedAt.IsZero():
+		return errors.New("challenge password has already been used")
+	case !now.Before(c.ExpiresAt):
+		return errors.New("challenge password has expired")
+	default:
+		return nil
+	}
+}
+
+// SCEPDynamicChallengeID returns the id of the given challenge password.
+func SCEPDynamicChallengeID(challenge string) string {
+	sum := sha256.Sum256([]byte(challenge))
+	return hex.EncodeToString(sum[:])
+}
+
+// ConsumeSCEPChallengeFunc is a function that validates a dynamic challenge
+// password of the given provisioner and marks it as used. It must fail if the
+// challenge does not exist, has expired or has already been used.
+type ConsumeSCEPChallengeFunc func(ctx context.Context, p Interface, challenge string) error
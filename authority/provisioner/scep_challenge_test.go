@@ -0,0 +1,53 @@
+package provisioner
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSCEPDynamicChallengeOptions_GetTTL(t *testing.T) {
+	var o *SCEPDynamicChallengeOptions
+	assert.Equal(t, DefaultSCEPDynamicChallengeTTL, o.GetTTL())
+	assert.NoError(t, o.Validate())
+
+	o = &SCEPDynamicChallengeOptions{}
+	assert.Equal(t, DefaultSCEPDynamicChallengeTTL, o.GetTTL())
+	assert.NoError(t, o.Validate())
+
+	o = &SCEPDynamicChallengeOptions{TTL: &Duration{Duration: 10 * time.Minute}}
+	assert.Equal(t, 10*time.Minute, o.GetTTL())
+	assert.NoError(t, o.Validate())
+
+	o = &SCEPDynamicChallengeOptions{TTL: &Duration{Duration: -time.Minute}}
+	assert.EqualError(t, o.Validate(), "scep dynamicChallenges ttl -1m0s cannot be negative")
+}
+
+func TestSCEPDynamicChallenge_Validate(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name      string
+		challenge *SCEPDynamicChallenge
+		wantErr   string
+	}{
+		{"ok", &SCEPDynamicChallenge{ExpiresAt: now.Add(time.Minute)}, ""},
+		{"fail/expired", &SCEPDynamicChallenge{ExpiresAt: now}, "challenge password has expired"},
+		{"fail/used", &SCEPDynamicChallenge{ExpiresAt: now.Add(time.Minute), UsedAt: now}, "challenge password has already been used"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.challenge.Validate(now)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestSCEPDynamicChallengeID(t *testing.T) {
+	assert.Equal(t, "2bb80d537b1da3e38bd30361aa855686bde0eacd7162fef6a25fe97bf527a25b", SCEPDynamicChallengeID("secret"))
+	assert.NotEqual(t, SCEPDynamicChallengeID("secret"), SCEPDynamicChallengeID("Secret"))
+}
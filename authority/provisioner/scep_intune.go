@@ -0,0 +1,327 @@
+package provisioner
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1" //nolint:gosec // used for certificate thumbprints
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+const (
+	defaultIntuneLoginURL = "https://login.microsoftonline.com"
+	defaultIntuneGraphURL = "https://graph.microsoft.com"
+	// intuneResource is the Azure AD resource of the Intune API.
+	intuneResource = "https://api.manage.microsoft.com/"
+	// intuneAppID is the application id of the Intune service principal.
+	intuneAppID = "0000000a-0000-0000-c000-000000000000"
+	// intuneValidationProvider is the name of the Intune service endpoint used
+	// to validate SCEP requests.
+	intuneValidationProvider = "ScepRequestValidationFQDN"
+	intuneAPIVersion         = "2018-02-20"
+	intuneCallerInfo         = "step-ca"
+	// intuneDefaultHResult is the HRESULT reported to Intune when a request
+	// fails without a specific error code, E_FAIL.
+	intuneDefaultHResult int64 = 0x80004005
+)
+
+// ErrSCEPIntuneRequestInvalid is the error returned when Intune does not
+// accept a SCEP request.
+var ErrSCEPIntuneRequestInvalid = errors.New("intune did not allow request")
+
+// SCEPIntuneOptions enables the validation of SCEP requests using the
+// Microsoft Intune SCEP validation API. The request is sent to Intune,
+// which verifies that the challenge and the CSR match the ones it issued to
+// the device. The application must be registered in Azure AD with the
+// scep_challenge_provider permission of the Intune API.
+type SCEPIntuneOptions struct {
+	// TenantID is the Azure AD tenant id or domain.
+	TenantID string `json:"tenantID"`
+	// ClientID is the application (client) id of the Azure AD application.
+	ClientID string `json:"clientID"`
+	// ClientSecret is the secret of the Azure AD application.
+	ClientSecret string `json:"clientSecret"`
+	// LoginURL is the Azure AD login endpoint. Defaults to
+	// https://login.microsoftonline.com.
+	LoginURL string `json:"loginURL,omitempty"`
+	// GraphURL is the Microsoft Graph endpoint used to discover the Intune
+	// validation service. Defaults to https://graph.microsoft.com.
+	GraphURL string `json:"graphURL,omitempty"`
+}
+
+// Validate returns an error if the Intune options are not valid.
+func (o *SCEPIntuneOptions) Validate() error {
+	if o == nil {
+		return nil
+	}
+	switch {
+	case o.TenantID == "":
+		return errors.New("scep intune tenantID cannot be empty")
+	case o.ClientID == "":
+		return errors.New("scep intune clientID cannot be empty")
+	case o.ClientSecret == "":
+		return errors.New("scep intune clientSecret cannot be empty")
+	}
+	for name, v := range map[string]string{"loginURL": o.LoginURL, "graphURL": o.GraphURL} {
+		if v == "" {
+			continue
+		}
+		if u, err := url.Parse(v); err != nil || u.Scheme == "" || u.Host == "" {
+			return errors.Errorf("scep intune %s %q is not a valid URL", name, v)
+		}
+	}
+	return nil
+}
+
+func (o *SCEPIntuneOptions) getLoginURL() string {
+	if o.LoginURL == "" {
+		return defaultIntuneLoginURL
+	}
+	return strings.TrimSuffix(o.LoginURL, "/")
+}
+
+func (o *SCEPIntuneOptions) getGraphURL() string {
+	if o.GraphURL == "" {
+		return defaultIntuneGraphURL
+	}
+	return strings.TrimSuffix(o.GraphURL, "/")
+}
+
+// intuneValidator validates SCEP requests using the Intune API.
+type intuneValidator struct {
+	client      *http.Client
+	graphURL    string
+	graphToken  oauth2.TokenSource
+	intuneToken oauth2.TokenSource
+	mu          sync.Mutex
+	endpoint    string
+}
+
+// newIntuneValidator creates an intuneValidator with the given options. The
+// access tokens are cached and refreshed when they expire.
+func newIntuneValidator(client *http.Client, o *SCEPIntuneOptions) *intuneValidator {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, client)
+	newTokenSource := func(scope string) oauth2.TokenSource {
+		cfg := &clientcredentials.Config{
+			ClientID:     o.ClientID,
+			ClientSecret: o.ClientSecret,
+			TokenURL:     o.getLoginURL() + "/" + url.PathEscape(o.TenantID) + "/oauth2/v2.0/token",
+			Scopes:       []string{scope},
+		}
+		return cfg.TokenSource(ctx)
+	}
+	graphURL := o.getGraphURL()
+	return &intuneValidator{
+		client:      client,
+		graphURL:    graphURL,
+		graphToken:  newTokenSource(graphURL + "/.default"),
+		intuneToken: newTokenSource(intuneResource + "/.default"),
+	}
+}
+
+type intuneServiceEndpoints struct {
+	Value []struct {
+		ProviderName string `json:"providerName"`
+		URI          string `json:"uri"`
+	} `json:"value"`
+}
+
+type intuneValidationRequest struct {
+	Request intuneValidationRequestBody `json:"request"`
+}
+
+type intuneValidationRequestBody struct {
+	TransactionID      string `json:"transactionId"`
+	CertificateRequest string `json:"certificateRequest"`
+	CallerInfo         string `json:"callerInfo"`
+}
+
+type intuneNotificationRequest struct {
+	Notification any `json:"notification"`
+}
+
+type intuneSuccessNotification struct {
+	TransactionID                string `json:"transactionId"`
+	CertificateRequest           string `json:"certificateRequest"`
+	CertificateThumbprint        string `json:"certificateThumbprint"`
+	CertificateSerialNumber      string `json:"certificateSerialNumber"`
+	CertificateExpirationDateUtc string `json:"certificateExpirationDateUtc"`
+	IssuingCertificateAuthority  string `json:"issuingCertificateAuthority"`
+	CallerInfo                   string `json:"callerInfo"`
+}
+
+type intuneFailureNotification struct {
+	TransactionID      string `json:"transactionId"`
+	CertificateRequest string `json:"certificateRequest"`
+	HResult            int64  `json:"hResult"`
+	ErrorDescription   string `json:"errorDescription"`
+	CallerInfo         string `json:"callerInfo"`
+}
+
+type intuneValidationResponse struct {
+	Code             string `json:"code"`
+	ErrorDescription string `json:"errorDescription"`
+}
+
+// Validate sends the CSR and the transaction id to Intune. It returns nil if
+// Intune accepts the request. The CSR contains the challenge password.
+func (v *intuneValidator) Validate(ctx context.Context, csr *x509.CertificateRequest, transactionID string) error {
+	endpoint, err := v.getEndpoint(ctx)
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(intuneValidationRequest{
+		Request: intuneValidationRequestBody{
+			TransactionID:      transactionID,
+			CertificateRequest: base64.StdEncoding.EncodeToString(csr.Raw),
+			CallerInfo:         intuneCallerInfo,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed marshaling intune request: %w", err)
+	}
+
+	var resp intuneValidationResponse
+	if err := v.do(ctx, http.MethodPost, endpoint+"/ScepActions/validateRequest?api-version="+intuneAPIVersion, v.intuneToken, body, &resp); err != nil {
+		return fmt.Errorf("failed validating request with intune: %w", err)
+	}
+	if resp.Code != "Success" {
+		if resp.ErrorDescription != "" {
+			return fmt.Errorf("%w: %s: %s", ErrSCEPIntuneRequestInvalid, resp.Code, resp.ErrorDescription)
+		}
+		return fmt.Errorf("%w: %s", ErrSCEPIntuneRequestInvalid, resp.Code)
+	}
+	return nil
+}
+
+// NotifySuccess reports to Intune the certificate issued for a request
+// previously validated by Intune.
+func (v *intuneValidator) NotifySuccess(ctx context.Context, csr *x509.CertificateRequest, cert *x509.Certificate, transactionID string) error {
+	thumbprint := sha1.Sum(cert.Raw) //nolint:gosec // Intune identifies certificates by their SHA-1 thumbprint
+	return v.notify(ctx, "successNotification", intuneSuccessNotification{
+		TransactionID:                transactionID,
+		CertificateRequest:           base64.StdEncoding.EncodeToString(csr.Raw),
+		CertificateThumbprint:        strings.ToUpper(hex.EncodeToString(thumbprint[:])),
+		CertificateSerialNumber:      strings.ToUpper(cert.SerialNumber.Text(16)),
+		CertificateExpirationDateUtc: cert.NotAfter.UTC().Format(time.RFC3339),
+		IssuingCertificateAuthority:  cert.Issuer.String(),
+		CallerInfo:                   intuneCallerInfo,
+	})
+}
+
+// NotifyFailure reports to Intune that a request previously validated by
+// Intune failed. An errorCode of 0 is reported as E_FAIL.
+func (v *intuneValidator) NotifyFailure(ctx context.Context, csr *x509.CertificateRequest, transactionID string, errorCode int, errorDescription string) error {
+	hResult := int64(errorCode)
+	if hResult == 0 {
+		hResult = intuneDefaultHResult
+	}
+	return v.notify(ctx, "failureNotification", intuneFailureNotification{
+		TransactionID:      transactionID,
+		CertificateRequest: base64.StdEncoding.EncodeToString(csr.Raw),
+		HResult:            hResult,
+		ErrorDescription:   errorDescription,
+		CallerInfo:         intuneCallerInfo,
+	})
+}
+
+// notify sends a notification to the given Intune SCEP action.
+func (v *intuneValidator) notify(ctx context.Context, action string, notification any) error {
+	endpoint, err := v.getEndpoint(ctx)
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(intuneNotificationRequest{Notification: notification})
+	if err != nil {
+		return fmt.Errorf("failed marshaling intune notification: %w", err)
+	}
+
+	var resp intuneValidationResponse
+	if err := v.do(ctx, http.MethodPost, endpoint+"/ScepActions/"+action+"?api-version="+intuneAPIVersion, v.intuneToken, body, &resp); err != nil {
+		return fmt.Errorf("failed sending %s to intune: %w", action, err)
+	}
+	if resp.Code != "Success" {
+		if resp.ErrorDescription != "" {
+			return fmt.Errorf("intune did not accept %s: %s: %s", action, resp.Code, resp.ErrorDescription)
+		}
+		return fmt.Errorf("intune did not accept %s: %s", action, resp.Code)
+	}
+	return nil
+}
+
+// getEndpoint returns the URL of the Intune validation service, discovering
+// it using Microsoft Graph the first time.
+func (v *intuneValidator) getEndpoint(ctx context.Context) (string, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.endpoint != "" {
+		return v.endpoint, nil
+	}
+
+	var endpoints intuneServiceEndpoints
+	if err := v.do(ctx, http.MethodGet, v.graphURL+"/v1.0/servicePrincipals/appId="+intuneAppID+"/endpoints", v.graphToken, nil, &endpoints); err != nil {
+		return "", fmt.Errorf("failed discovering intune endpoint: %w", err)
+	}
+	for _, e := range endpoints.Value {
+		if e.ProviderName == intuneValidationProvider && e.URI != "" {
+			v.endpoint = strings.TrimSuffix(e.URI, "/")
+			return v.endpoint, nil
+		}
+	}
+	return "", fmt.Errorf("failed discovering intune endpoint: %s not found", intuneValidationProvider)
+}
+
+// do performs an authenticated request and decodes the JSON response in v.
+func (v *intuneValidator) do(ctx context.Context, method, u string, ts oauth2.TokenSource, body []byte, resp any) error {
+	tok, err := ts.Token()
+	if err != nil {
+		return fmt.Errorf("failed getting access token: %w", err)
+	}
+
+	var r io.Reader
+	if body != nil {
+		r = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, r)
+	if err != nil {
+		return err
+	}
+	tok.SetAuthHeader(req)
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("client-request-id", uuid.NewString())
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	res, err := v.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= 400 {
+		return fmt.Errorf("%s %s failed with status code %d", method, req.URL.Redacted(), res.StatusCode)
+	}
+	if err := json.NewDecoder(res.Body).Decode(resp); err != nil {
+		return fmt.Errorf("failed decoding response: %w", err)
+	}
+	return nil
+}
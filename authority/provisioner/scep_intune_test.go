@@ -0,0 +1,282 @@
+package provisioner
+
+import (
+	"context"
+	"crypto/sha1" //nolint:gosec // used for certificate thumbprints
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSCEPIntuneOptions_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		o       *SCEPIntuneOptions
+		wantErr string
+	}{
+		{"ok/nil", nil, ""},
+		{"ok", &SCEPIntuneOptions{TenantID: "tenant", ClientID: "client", ClientSecret: "secret", LoginURL: "https://login.example.com", GraphURL: "https://graph.example.com"}, ""},
+		{"fail/tenantID", &SCEPIntuneOptions{ClientID: "client", ClientSecret: "secret"}, "scep intune tenantID cannot be empty"},
+		{"fail/clientID", &SCEPIntuneOptions{TenantID: "tenant", ClientSecret: "secret"}, "scep intune clientID cannot be empty"},
+		{"fail/clientSecret", &SCEPIntuneOptions{TenantID: "tenant", ClientID: "client"}, "scep intune clientSecret cannot be empty"},
+		{"fail/loginURL", &SCEPIntuneOptions{TenantID: "tenant", ClientID: "client", ClientSecret: "secret", LoginURL: "login"}, `scep intune loginURL "login" is not a valid URL`},
+		{"fail/graphURL", &SCEPIntuneOptions{TenantID: "tenant", ClientID: "client", ClientSecret: "secret", GraphURL: "graph"}, `scep intune graphURL "graph" is not a valid URL`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.o.Validate()
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func Test_intuneValidator_Validate(t *testing.T) {
+	csr := &x509.CertificateRequest{Raw: []byte("csr")}
+
+	var srv *httptest.Server
+	var discoveries, validations int
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/tenant/oauth2/v2.0/token":
+			require.NoError(t, r.ParseForm())
+			assert.Equal(t, "client_credentials", r.Form.Get("grant_type"))
+			token := "graph-token"
+			if r.Form.Get("scope") == intuneResource+"/.default" {
+				token = "intune-token"
+			}
+			json.NewEncoder(w).Encode(map[string]any{
+				"access_token": token, "token_type": "Bearer", "expires_in": 3600,
+			})
+		case "/v1.0/servicePrincipals/appId=" + intuneAppID + "/endpoints":
+			discoveries++
+			assert.Equal(t, "Bearer graph-token", r.Header.Get("Authorization"))
+			json.NewEncoder(w).Encode(map[string]any{
+				"value": []map[string]string{
+					{"providerName": "OtherProvider", "uri": "https://other.example.com"},
+					{"providerName": intuneValidationProvider, "uri": srv.URL + "/intune/"},
+				},
+			})
+		case "/intune/ScepActions/validateRequest":
+			validations++
+			assert.Equal(t, intuneAPIVersion, r.URL.Query().Get("api-version"))
+			assert.Equal(t, "Bearer intune-token", r.Header.Get("Authorization"))
+			assert.NotEmpty(t, r.Header.Get("client-request-id"))
+			var req intuneValidationRequest
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+			assert.Equal(t, base64.StdEncoding.EncodeToString(csr.Raw), req.Request.CertificateRequest)
+			assert.Equal(t, intuneCallerInfo, req.Request.CallerInfo)
+			switch req.Request.TransactionID {
+			case "ok":
+				json.NewEncoder(w).Encode(intuneValidationResponse{Code: "Success"})
+			case "error":
+				w.WriteHeader(http.StatusInternalServerError)
+			default:
+				json.NewEncoder(w).Encode(intuneValidationResponse{Code: "ChallengeExpired", ErrorDescription: "the challenge has expired"})
+			}
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	v := newIntuneValidator(srv.Client(), &SCEPIntuneOptions{
+		TenantID:     "tenant",
+		ClientID:     "client",
+		ClientSecret: "secret",
+		LoginURL:     srv.URL,
+		GraphURL:     srv.URL,
+	})
+
+	ctx := context.Background()
+	assert.NoError(t, v.Validate(ctx, csr, "ok"))
+
+	err := v.Validate(ctx, csr, "expired")
+	assert.ErrorIs(t, err, ErrSCEPIntuneRequestInvalid)
+	assert.EqualError(t, err, "intune did not allow request: ChallengeExpired: the challenge has expired")
+
+	err = v.Validate(ctx, csr, "error")
+	assert.ErrorContains(t, err, "failed validating request with intune: POST")
+	assert.ErrorContains(t, err, "failed with status code 500")
+
+	// The endpoint is only discovered once.
+	assert.Equal(t, 1, discoveries)
+	assert.Equal(t, 3, validations)
+
+	// Discovery fails if the validation service is not found.
+	v = newIntuneValidator(srv.Client(), &SCEPIntuneOptions{
+		TenantID:     "tenant",
+		ClientID:     "client",
+		ClientSecret: "secret",
+		LoginURL:     srv.URL,
+		GraphURL:     srv.URL + "/missing",
+	})
+	assert.ErrorContains(t, v.Validate(ctx, csr, "ok"), "failed discovering intune endpoint")
+}
+
+func Test_intuneValidator_notifications(t *testing.T) {
+	csr := &x509.CertificateRequest{Raw: []byte("csr")}
+	cert := &x509.Certificate{
+		Raw:          []byte("cert"),
+		SerialNumber: big.NewInt(0xabcdef),
+		NotAfter:     time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC),
+		Issuer:       pkix.Name{CommonName: "Intermediate CA"},
+	}
+	thumbprint := sha1.Sum(cert.Raw) //nolint:gosec // test thumbprint
+
+	var srv *httptest.Server
+	var successes, failures int
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/tenant/oauth2/v2.0/token":
+			json.NewEncoder(w).Encode(map[string]any{
+				"access_token": "intune-token", "token_type": "Bearer", "expires_in": 3600,
+			})
+		case "/v1.0/servicePrincipals/appId=" + intuneAppID + "/endpoints":
+			json.NewEncoder(w).Encode(map[string]any{
+				"value": []map[string]string{
+					{"providerName": intuneValidationProvider, "uri": srv.URL + "/intune"},
+				},
+			})
+		case "/intune/ScepActions/successNotification":
+			successes++
+			assert.Equal(t, intuneAPIVersion, r.URL.Query().Get("api-version"))
+			assert.Equal(t, "Bearer intune-token", r.Header.Get("Authorization"))
+			var req struct {
+				Notification intuneSuccessNotification `json:"notification"`
+			}
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+			assert.Equal(t, intuneSuccessNotification{
+				TransactionID:                req.Notification.TransactionID,
+				CertificateRequest:           base64.StdEncoding.EncodeToString(csr.Raw),
+				CertificateThumbprint:        strings.ToUpper(hex.EncodeToString(thumbprint[:])),
+				CertificateSerialNumber:      "ABCDEF",
+				CertificateExpirationDateUtc: "2030-01-02T03:04:05Z",
+				IssuingCertificateAuthority:  "CN=Intermediate CA",
+				CallerInfo:                   intuneCallerInfo,
+			}, req.Notification)
+			if req.Notification.TransactionID == "ok" {
+				json.NewEncoder(w).Encode(intuneValidationResponse{Code: "Success"})
+			} else {
+				json.NewEncoder(w).Encode(intuneValidationResponse{Code: "ChallengeNotFound", ErrorDescription: "unknown transaction"})
+			}
+		case "/intune/ScepActions/failureNotification":
+			failures++
+			var req struct {
+				Notification intuneFailureNotification `json:"notification"`
+			}
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+			assert.Equal(t, base64.StdEncoding.EncodeToString(csr.Raw), req.Notification.CertificateRequest)
+			assert.Equal(t, "signing failed", req.Notification.ErrorDescription)
+			assert.Equal(t, intuneCallerInfo, req.Notification.CallerInfo)
+			switch req.Notification.TransactionID {
+			case "default":
+				assert.Equal(t, intuneDefaultHResult, req.Notification.HResult)
+			default:
+				assert.Equal(t, int64(42), req.Notification.HResult)
+			}
+			if req.Notification.TransactionID == "error" {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			json.NewEncoder(w).Encode(intuneValidationResponse{Code: "Success"})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	v := newIntuneValidator(srv.Client(), &SCEPIntuneOptions{
+		TenantID:     "tenant",
+		ClientID:     "client",
+		ClientSecret: "secret",
+		LoginURL:     srv.URL,
+		GraphURL:     srv.URL,
+	})
+
+	ctx := context.Background()
+	assert.NoError(t, v.NotifySuccess(ctx, csr, cert, "ok"))
+	assert.EqualError(t, v.NotifySuccess(ctx, csr, cert, "unknown"), "intune did not accept successNotification: ChallengeNotFound: unknown transaction")
+	assert.NoError(t, v.NotifyFailure(ctx, csr, "default", 0, "signing failed"))
+	assert.NoError(t, v.NotifyFailure(ctx, csr, "code", 42, "signing failed"))
+	err := v.NotifyFailure(ctx, csr, "error", 42, "signing failed")
+	assert.ErrorContains(t, err, "failed sending failureNotification to intune: POST")
+	assert.ErrorContains(t, err, "failed with status code 500")
+
+	assert.Equal(t, 2, successes)
+	assert.Equal(t, 3, failures)
+}
+
+func TestSCEP_Notify_intune(t *testing.T) {
+	csr := &x509.CertificateRequest{Raw: []byte("csr")}
+	cert := &x509.Certificate{Raw: []byte("cert"), SerialNumber: big.NewInt(1)}
+
+	var srv *httptest.Server
+	var notifications []string
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/tenant/oauth2/v2.0/token":
+			json.NewEncoder(w).Encode(map[string]any{
+				"access_token": "token", "token_type": "Bearer", "expires_in": 3600,
+			})
+		case "/v1.0/servicePrincipals/appId=" + intuneAppID + "/endpoints":
+			json.NewEncoder(w).Encode(map[string]any{
+				"value": []map[string]string{
+					{"providerName": intuneValidationProvider, "uri": srv.URL + "/intune"},
+				},
+			})
+		case "/intune/ScepActions/successNotification", "/intune/ScepActions/failureNotification":
+			notifications = append(notifications, r.URL.Path)
+			json.NewEncoder(w).Encode(intuneValidationResponse{Code: "Success"})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	p := &SCEP{
+		Name: "SCEP",
+		Type: "SCEP",
+		Intune: &SCEPIntuneOptions{
+			TenantID:     "tenant",
+			ClientID:     "client",
+			ClientSecret: "secret",
+			LoginURL:     srv.URL,
+			GraphURL:     srv.URL,
+		},
+	}
+	require.NoError(t, p.Init(Config{Claims: globalProvisionerClaims, HTTPClient: srv.Client()}))
+
+	ctx := context.Background()
+	assert.NoError(t, p.NotifySuccess(ctx, csr, cert, "transaction"))
+	assert.NoError(t, p.NotifyFailure(ctx, csr, "transaction", 0, "signing failed"))
+	assert.Equal(t, []string{
+		"/intune/ScepActions/successNotification",
+		"/intune/ScepActions/failureNotification",
+	}, notifications)
+
+	// Intune is not notified if it is not used to validate the requests.
+	notifications = nil
+	p.Intune = nil
+	require.NoError(t, p.Init(Config{Claims: globalProvisionerClaims, HTTPClient: srv.Client()}))
+	assert.NoError(t, p.NotifySuccess(ctx, csr, cert, "transaction"))
+	assert.NoError(t, p.NotifyFailure(ctx, csr, "transaction", 0, "signing failed"))
+	assert.Empty(t, notifications)
+}
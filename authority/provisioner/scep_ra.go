@@ -0,0 +1,80 @@
+package provisioner
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultSCEPRALifetime is the default validity period of the RA
+	// certificates generated for a SCEP provisioner.
+	DefaultSCEPRALifetime = 30 * 24 * time.Hour
+	// defaultSCEPRAKeySize is the default size of the RSA keys of the RA
+	// certificates.
+	defaultSCEPRAKeySize = 2048
+)
+
+// SCEPRAOptions enables a dedicated RA certificate and decryption key for a
+// SCEP provisioner. The key and certificate are generated by the CA and
+// signed by the issuing intermediate, and they are rotated automatically
+// before they expire. During a rotation both the previous and the new RA
+// certificates are returned by GetCACert, and messages encrypted to any of
+// them can be decrypted.
+//
+// The RA keys are only kept in memory, they are generated again when the CA
+// starts.
+type SCEPRAOptions struct {
+	// Lifetime is the validity period of the RA certificates. Defaults to
+	// 720h.
+	Lifetime *Duration `json:"lifetime,omitempty"`
+	// RenewBefore is the period before the expiration of the RA certificate
+	// in which a new one is generated. Defaults to a third of the lifetime.
+	RenewBefore *Duration `json:"renewBefore,omitempty"`
+	// KeySize is the size of the RSA keys. Defaults to 2048.
+	KeySize int `json:"keySize,omitempty"`
+}
+
+// Validate returns an error if the RA options are not valid.
+func (o *SCEPRAOptions) Validate() error {
+	if o == nil {
+		return nil
+	}
+	switch {
+	case o.Lifetime != nil && o.Lifetime.Duration < 0:
+		return errors.Errorf("scep ra lifetime %s cannot be negative", o.Lifetime)
+	case o.RenewBefore != nil && o.RenewBefore.Duration < 0:
+		return errors.Errorf("scep ra renewBefore %s cannot be negative", o.RenewBefore)
+	case o.RenewBefore != nil && o.RenewBefore.Duration >= o.GetLifetime():
+		return errors.Errorf("scep ra renewBefore %s must be lower than the lifetime", o.RenewBefore)
+	case o.KeySize != 0 && o.KeySize < 2048:
+		return errors.Errorf("scep ra keySize %d must be at least 2048", o.KeySize)
+	default:
+		return nil
+	}
+}
+
+// GetLifetime returns the validity period of the RA certificates.
+func (o *SCEPRAOptions) GetLifetime() time.Duration {
+	if o == nil || o.Lifetime == nil || o.Lifetime.Duration == 0 {
+		return DefaultSCEPRALifetime
+	}
+	return o.Lifetime.Duration
+}
+
+// GetRenewBefore returns the period before the expiration of an RA
+// certificate in which it is rotated.
+func (o *SCEPRAOptions) GetRenewBefore() time.Duration {
+	if o == nil || o.RenewBefore == nil || o.RenewBefore.Duration == 0 {
+		return o.GetLifetime() / 3
+	}
+	return o.RenewBefore.Duration
+}
+
+// GetKeySize returns the size of the RSA keys of the RA certificates.
+func (o *SCEPRAOptions) GetKeySize() int {
+	if o == nil || o.KeySize == 0 {
+		return defaultSCEPRAKeySize
+	}
+	return o.KeySize
+}
@@ -0,0 +1,51 @@
+package provisioner
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSCEPRAOptions(t *testing.T) {
+	var o *SCEPRAOptions
+	assert.NoError(t, o.Validate())
+	assert.Equal(t, DefaultSCEPRALifetime, o.GetLifetime())
+	assert.Equal(t, DefaultSCEPRALifetime/3, o.GetRenewBefore())
+	assert.Equal(t, 2048, o.GetKeySize())
+
+	o = &SCEPRAOptions{
+		Lifetime:    &Duration{Duration: 24 * time.Hour},
+		RenewBefore: &Duration{Duration: time.Hour},
+		KeySize:     3072,
+	}
+	assert.NoError(t, o.Validate())
+	assert.Equal(t, 24*time.Hour, o.GetLifetime())
+	assert.Equal(t, time.Hour, o.GetRenewBefore())
+	assert.Equal(t, 3072, o.GetKeySize())
+
+	tests := []struct {
+		name    string
+		o       *SCEPRAOptions
+		wantErr string
+	}{
+		{"lifetime", &SCEPRAOptions{Lifetime: &Duration{Duration: -time.Hour}}, "scep ra lifetime -1h0m0s cannot be negative"},
+		{"renewBefore", &SCEPRAOptions{RenewBefore: &Duration{Duration: -time.Hour}}, "scep ra renewBefore -1h0m0s cannot be negative"},
+		{"renewBefore-lifetime", &SCEPRAOptions{Lifetime: &Duration{Duration: time.Hour}, RenewBefore: &Duration{Duration: time.Hour}}, "scep ra renewBefore 1h0m0s must be lower than the lifetime"},
+		{"keySize", &SCEPRAOptions{KeySize: 1024}, "scep ra keySize 1024 must be at least 2048"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.EqualError(t, tt.o.Validate(), tt.wantErr)
+		})
+	}
+}
+
+func TestSCEP_Init_ra(t *testing.T) {
+	p := &SCEP{Name: "scep", Type: "SCEP", RA: &SCEPRAOptions{}}
+	assert.NoError(t, p.Init(Config{Claims: globalProvisionerClaims}))
+	assert.Equal(t, &SCEPRAOptions{}, p.GetRAOptions())
+
+	p = &SCEP{Name: "scep", Type: "SCEP", RA: &SCEPRAOptions{}, DecrypterKeyURI: "softkms:path=key.pem"}
+	assert.EqualError(t, p.Init(Config{Claims: globalProvisionerClaims}), "scep ra cannot be used with a decrypter certificate or key")
+}
@@ -0,0 +1,102 @@
+package provisioner
+
+import (
+	"context"
+	"crypto/x509"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// SCEPRenewalOptions enables the renewal of certificates using a SCEP
+// RenewalReq message signed with the certificate to renew, instead of a
+// challenge password.
+type SCEPRenewalOptions struct {
+	// RenewalWindow is the period before the expiration of the certificate in
+	// which it can be renewed. Defaults to the whole validity period.
+	RenewalWindow *Duration `json:"renewalWindow,omitempty"`
+	// AllowSubjectChange allows the renewal request to contain a subject or
+	// subject alternative names that are not in the certificate. By default,
+	// the common name must match and the names must be included in the
+	// certificate.
+	AllowSubjectChange bool `json:"allowSubjectChange,omitempty"`
+}
+
+// Validate returns an error if the renewal window is negative.
+func (o *SCEPRenewalOptions) Validate() error {
+	if o != nil && o.RenewalWindow != nil && o.RenewalWindow.Duration < 0 {
+		return errors.Errorf("scep renewal renewalWindow %s cannot be negative", o.RenewalWindow)
+	}
+	return nil
+}
+
+// IsRenewalEnabled returns true if the certificates signed by the provisioner
+// can be renewed using the certificate to authenticate the request.
+func (s *SCEP) IsRenewalEnabled() bool {
+	return s.Renewal != nil
+}
+
+// AuthorizeRenewal validates a renewal request authenticated with the given
+// certificate, which must have been verified by the caller. The certificate
+// must have been issued by this provisioner, be in the renewal window, and,
+// unless subject changes are allowed, contain the names in the request.
+func (s *SCEP) AuthorizeRenewal(_ context.Context, csr *x509.CertificateRequest, cert *x509.Certificate) error {
+	if s.Renewal == nil {
+		return errors.Errorf("provisioner %q does not allow renewals", s.Name)
+	}
+
+	ext, ok := GetProvisionerExtension(cert)
+	if !ok || ext.Type != TypeSCEP || ext.Name != s.Name {
+		return errors.Errorf("certificate was not issued by provisioner %q", s.Name)
+	}
+
+	now := time.Now()
+	switch {
+	case now.Before(cert.NotBefore):
+		return errors.New("certificate is not yet valid")
+	case !now.Before(cert.NotAfter):
+		return errors.New("certificate has expired")
+	}
+	if w := s.Renewal.RenewalWindow; w != nil && w.Duration > 0 && cert.NotAfter.Sub(now) > w.Duration {
+		return errors.Errorf("certificate cannot be renewed until %s", cert.NotAfter.Add(-w.Duration).UTC().Format(time.RFC3339))
+	}
+
+	if !s.Renewal.AllowSubjectChange {
+		if err := checkRenewalSubject(csr, cert); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkRenewalSubject returns an error if the request contains a common name
+// different than the certificate one, or a subject alternative name that is
+// not in the certificate.
+func checkRenewalSubject(csr *x509.CertificateRequest, cert *x509.Certificate) error {
+	if csr.Subject.CommonName != cert.Subject.CommonName {
+		return errors.Errorf("certificate request common name %q does not match the certificate", csr.Subject.CommonName)
+	}
+	for _, name := range csr.DNSNames {
+		if !slices.Contains(cert.DNSNames, name) {
+			return errors.Errorf("certificate request dns name %q is not in the certificate", name)
+		}
+	}
+	for _, email := range csr.EmailAddresses {
+		if !slices.Contains(cert.EmailAddresses, email) {
+			return errors.Errorf("certificate request email address %q is not in the certificate", email)
+		}
+	}
+	for _, ip := range csr.IPAddresses {
+		if !slices.ContainsFunc(cert.IPAddresses, ip.Equal) {
+			return errors.Errorf("certificate request ip address %q is not in the certificate", ip)
+		}
+	}
+	for _, u := range csr.URIs {
+		if !slices.ContainsFunc(cert.URIs, func(v *url.URL) bool { return v.String() == u.String() }) {
+			return errors.Errorf("certificate request uri %q is not in the certificate", u)
+		}
+	}
+	return nil
+}
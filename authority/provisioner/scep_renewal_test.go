@@ -0,0 +1,76 @@
+package provisioner
+
+import (
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSCEP_AuthorizeRenewal(t *testing.T) {
+	now := time.Now()
+	newCert := func(name string, notAfter time.Time) *x509.Certificate {
+		ext, err := (&Extension{Type: TypeSCEP, Name: name}).ToExtension()
+		require.NoError(t, err)
+		return &x509.Certificate{
+			Subject:     pkix.Name{CommonName: "device"},
+			DNSNames:    []string{"device.example.com"},
+			IPAddresses: []net.IP{net.ParseIP("10.0.0.1")},
+			NotBefore:   now.Add(-time.Hour),
+			NotAfter:    notAfter,
+			Extensions:  []pkix.Extension{ext},
+		}
+	}
+	csr := &x509.CertificateRequest{
+		Subject:     pkix.Name{CommonName: "device"},
+		DNSNames:    []string{"device.example.com"},
+		IPAddresses: []net.IP{net.ParseIP("10.0.0.1")},
+	}
+	otherCSR := &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: "device"},
+		DNSNames: []string{"other.example.com"},
+	}
+
+	tests := []struct {
+		name    string
+		renewal *SCEPRenewalOptions
+		csr     *x509.CertificateRequest
+		cert    *x509.Certificate
+		wantErr string
+	}{
+		{"ok", &SCEPRenewalOptions{}, csr, newCert("scep", now.Add(24*time.Hour)), ""},
+		{"ok/renewal-window", &SCEPRenewalOptions{RenewalWindow: &Duration{Duration: 48 * time.Hour}}, csr, newCert("scep", now.Add(24*time.Hour)), ""},
+		{"ok/allow-subject-change", &SCEPRenewalOptions{AllowSubjectChange: true}, otherCSR, newCert("scep", now.Add(24*time.Hour)), ""},
+		{"fail/disabled", nil, csr, newCert("scep", now.Add(24*time.Hour)), `provisioner "scep" does not allow renewals`},
+		{"fail/other-provisioner", &SCEPRenewalOptions{}, csr, newCert("other", now.Add(24*time.Hour)), `certificate was not issued by provisioner "scep"`},
+		{"fail/expired", &SCEPRenewalOptions{}, csr, newCert("scep", now.Add(-time.Minute)), "certificate has expired"},
+		{"fail/renewal-window", &SCEPRenewalOptions{RenewalWindow: &Duration{Duration: time.Hour}}, csr, newCert("scep", now.Add(24*time.Hour)), "certificate cannot be renewed until"},
+		{"fail/subject", &SCEPRenewalOptions{}, otherCSR, newCert("scep", now.Add(24*time.Hour)), `certificate request dns name "other.example.com" is not in the certificate`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &SCEP{Name: "scep", Type: "SCEP", Renewal: tt.renewal}
+			assert.Equal(t, tt.renewal != nil, p.IsRenewalEnabled())
+			err := p.AuthorizeRenewal(context.Background(), tt.csr, tt.cert)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestSCEPRenewalOptions_Validate(t *testing.T) {
+	var o *SCEPRenewalOptions
+	assert.NoError(t, o.Validate())
+	assert.NoError(t, (&SCEPRenewalOptions{}).Validate())
+	assert.NoError(t, (&SCEPRenewalOptions{RenewalWindow: &Duration{Duration: time.Hour}}).Validate())
+	assert.EqualError(t, (&SCEPRenewalOptions{RenewalWindow: &Duration{Duration: -time.Hour}}).Validate(),
+		"scep renewal renewalWindow -1h0m0s cannot be negative")
+}
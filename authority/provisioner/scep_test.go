@@ -219,6 +219,22 @@ func Test_selectValidationMethod(t *testing.T) {
 			},
 			ChallengePassword: "pass",
 		}, "static"},
+		{"dynamic", &SCEP{
+			Name:              "SCEP",
+			Type:              "SCEP",
+			ChallengePassword: "pass",
+			DynamicChallenges: &SCEPDynamicChallengeOptions{},
+		}, "dynamic"},
+		{"intune", &SCEP{
+			Name:              "SCEP",
+			Type:              "SCEP",
+			DynamicChallenges: &SCEPDynamicChallengeOptions{},
+			Intune: &SCEPIntuneOptions{
+				TenantID:     "tenant",
+				ClientID:     "client",
+				ClientSecret: "secret",
+			},
+		}, "intune"},
 		{"none", &SCEP{
 			Name: "SCEP",
 			Type: "SCEP",
@@ -273,6 +289,13 @@ func TestSCEP_ValidateChallenge(t *testing.T) {
 		w.WriteHeader(200)
 		w.Write(b)
 	}))
+	consumeChallenge := func(ctx context.Context, p Interface, challenge string) error {
+		assert.Equal(t, "SCEP", p.GetName())
+		if challenge != "dynamic-challenge" {
+			return errors.New("challenge password not found")
+		}
+		return nil
+	}
 	type args struct {
 		challenge     string
 		transactionID string
@@ -336,6 +359,32 @@ func TestSCEP_ValidateChallenge(t *testing.T) {
 		}, nil, args{"the-wrong-challenge-secret", "static-transaction-1"},
 			errors.New("invalid challenge password provided"),
 		},
+		{"ok/dynamic-challenge", &SCEP{
+			Name:              "SCEP",
+			Type:              "SCEP",
+			Options:           &Options{},
+			DynamicChallenges: &SCEPDynamicChallengeOptions{},
+		}, nil, args{"dynamic-challenge", "dynamic-transaction-1"},
+			nil,
+		},
+		{"ok/dynamic-and-static-challenge", &SCEP{
+			Name:              "SCEP",
+			Type:              "SCEP",
+			Options:           &Options{},
+			ChallengePassword: "secret-static-challenge",
+			DynamicChallenges: &SCEPDynamicChallengeOptions{},
+		}, nil, args{"secret-static-challenge", "dynamic-transaction-1"},
+			nil,
+		},
+		{"fail/wrong-dynamic-challenge", &SCEP{
+			Name:              "SCEP",
+			Type:              "SCEP",
+			Options:           &Options{},
+			ChallengePassword: "secret-static-challenge",
+			DynamicChallenges: &SCEPDynamicChallengeOptions{},
+		}, nil, args{"the-wrong-challenge-secret", "dynamic-transaction-1"},
+			errors.New("invalid challenge password provided: challenge password not found"),
+		},
 		{"ok/no-challenge", &SCEP{
 			Name:              "SCEP",
 			Type:              "SCEP",
@@ -360,7 +409,7 @@ func TestSCEP_ValidateChallenge(t *testing.T) {
 				defer tt.server.Close()
 			}
 
-			err := tt.p.Init(Config{Claims: globalProvisionerClaims, WebhookClient: http.DefaultClient})
+			err := tt.p.Init(Config{Claims: globalProvisionerClaims, WebhookClient: http.DefaultClient, ConsumeSCEPChallengeFunc: consumeChallenge})
 			require.NoError(t, err)
 			ctx := context.Background()
 
@@ -493,6 +542,30 @@ func TestSCEP_Init(t *testing.T) {
 			DecrypterKeyPassword:          "",
 			EncryptionAlgorithmIdentifier: 0,
 		}, args{Config{Claims: globalProvisionerClaims}}, false},
+		{"ok capabilities", &SCEP{
+			Type:                          "SCEP",
+			Name:                          "scep",
+			Capabilities:                  []string{"renewal", "SHA-256", "aes", "POSTPKIOperation"},
+			Renewal:                       &SCEPRenewalOptions{},
+			EncryptionAlgorithmIdentifier: 2,
+		}, args{Config{Claims: globalProvisionerClaims}}, false},
+		{"fail capabilities", &SCEP{
+			Type:         "SCEP",
+			Name:         "scep",
+			Capabilities: []string{"SHA-256", "GetNextCACert"},
+		}, args{Config{Claims: globalProvisionerClaims}}, true},
+		{"fail capabilities renewal", &SCEP{
+			Type:         "SCEP",
+			Name:         "scep",
+			Capabilities: []string{"SHA-256", "AES"},
+			Renewal:      &SCEPRenewalOptions{},
+		}, args{Config{Claims: globalProvisionerClaims}}, true},
+		{"fail capabilities encryptionAlgorithmIdentifier", &SCEP{
+			Type:                          "SCEP",
+			Name:                          "scep",
+			Capabilities:                  []string{"SHA-256", "DES3"},
+			EncryptionAlgorithmIdentifier: 1,
+		}, args{Config{Claims: globalProvisionerClaims}}, true},
 		{"fail type", &SCEP{
 			Type:                          "",
 			Name:                          "scep",
@@ -641,3 +714,13 @@ func TestSCEP_Init(t *testing.T) {
 		})
 	}
 }
+
+func TestSCEP_Init_capabilities(t *testing.T) {
+	p := &SCEP{
+		Type:         "SCEP",
+		Name:         "scep",
+		Capabilities: []string{"sha-256", "aes", "postpkioperation", "SCEPStandard"},
+	}
+	require.NoError(t, p.Init(Config{Claims: globalProvisionerClaims}))
+	assert.Equal(t, []string{"SHA-256", "AES", "POSTPKIOperation", "SCEPStandard"}, p.GetCapabilities())
+}
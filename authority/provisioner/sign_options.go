@@ -82,13 +82,45 @@ func (fn CertificateEnforcerFunc) Enforce(cert *x509.Certificate) error {
 }
 
 // AttestationData is a SignOption used to pass attestation information to the
-// sign methods.
+// sign methods. Fingerprint is the fingerprint of the attested key.
 type AttestationData struct {
 	PermanentIdentifier string
+	Fingerprint         string
+}
+
+// AttestationValidator is a SignOption used to validate the attestation data
+// of a certificate request. The attestation data is nil if the request does
+// not include it.
+type AttestationValidator interface {
+	SignOption
+	ValidAttestation(att *AttestationData, csr *x509.CertificateRequest) error
+}
+
+// RequestMetadata is a SignOption used to pass information about the request
+// to the sign methods. This information is forwarded to the CAS backends.
+type RequestMetadata struct {
+	Requester   string
+	ACMEOrderID string
+}
+
+// proofOfPossessionVerified is a SignOption used when the certificate request
+// is not signed because the possession of the private key has been verified by
+// other means, like the signature in a CMP certificate request message. It can
+// only be added by the provisioners of those protocols.
+type proofOfPossessionVerified struct{}
+
+// IsProofOfPossessionVerified returns true if the sign option indicates that
+// the possession of the private key has been verified by the provisioner, and
+// the signature of the certificate request must not be checked.
+func IsProofOfPossessionVerified(o SignOption) bool {
+	_, ok := o.(proofOfPossessionVerified)
+	return ok
 }
 
 // defaultPublicKeyValidator validates the public key of a certificate request.
-type defaultPublicKeyValidator struct{}
+type defaultPublicKeyValidator struct {
+	keys *KeyClaims
+}
 
 // Valid checks that certificate request common name matches the one configured.
 func (v defaultPublicKeyValidator) Valid(req *x509.CertificateRequest) error {
@@ -102,6 +134,9 @@ func (v defaultPublicKeyValidator) Valid(req *x509.CertificateRequest) error {
 	default:
 		return errs.BadRequest("certificate request key of type '%T' is not supported", k)
 	}
+	if err := v.keys.Check(req.PublicKey); err != nil {
+		return errs.Forbidden("certificate request %s", err)
+	}
 	return nil
 }
 
@@ -378,8 +413,9 @@ func (v profileLimitDuration) Modify(cert *x509.Certificate, so SignOptions) err
 
 // validityValidator validates the certificate validity settings.
 type validityValidator struct {
-	min time.Duration
-	max time.Duration
+	min       time.Duration
+	max       time.Duration
+	lifetimes []TLSLifetime
 }
 
 // newValidityValidator return a new validity validator.
@@ -387,6 +423,16 @@ func newValidityValidator(minDur, maxDur time.Duration) *validityValidator {
 	return &validityValidator{min: minDur, max: maxDur}
 }
 
+// newClaimsValidityValidator returns a new validity validator that enforces
+// the TLS durations of the given claimer, including the per-category ones.
+func newClaimsValidityValidator(c *Claimer) *validityValidator {
+	return &validityValidator{
+		min:       c.MinTLSCertDuration(),
+		max:       c.MaxTLSCertDuration(),
+		lifetimes: c.TLSCertLifetimes(),
+	}
+}
+
 // Valid validates the certificate validity settings (notBefore/notAfter) and
 // total duration.
 func (v *validityValidator) Valid(cert *x509.Certificate, o SignOptions) error {
@@ -414,6 +460,14 @@ func (v *validityValidator) Valid(cert *x509.Certificate, o SignOptions) error {
 	if d > v.max+o.Backdate {
 		return errs.Forbidden("requested duration of %v is more than the authorized maximum certificate duration of %v", d, v.max+o.Backdate)
 	}
+	for _, l := range v.lifetimes {
+		if l.MaxTLSDur == nil || !l.Category.Match(cert) {
+			continue
+		}
+		if maxDur := l.MaxTLSDur.Duration + o.Backdate; d > maxDur {
+			return errs.Forbidden("requested duration of %v is more than the authorized maximum %s certificate duration of %v", d, l.Category, maxDur)
+		}
+	}
 	return nil
 }
 
@@ -81,6 +81,17 @@ func Test_defaultPublicKeyValidator_Valid(t *testing.T) {
 			}
 		})
 	}
+
+	v = defaultPublicKeyValidator{keys: &KeyClaims{AllowedKeyTypes: []string{"EC"}, AllowedCurves: []string{"P-256"}}}
+	assert.NoError(t, v.Valid(ecdsaCSR))
+	err = v.Valid(rsaCSR)
+	if assert.NotNil(t, err) {
+		assert.HasPrefix(t, err.Error(), "certificate request key type RSA is not allowed")
+	}
+	err = v.Valid(ed25519CSR)
+	if assert.NotNil(t, err) {
+		assert.HasPrefix(t, err.Error(), "certificate request key type OKP is not allowed")
+	}
 }
 
 func Test_commonNameValidator_Valid(t *testing.T) {
@@ -359,7 +370,7 @@ func Test_validityValidator_Valid(t *testing.T) {
 	tests := map[string]func() test{
 		"fail/notAfter-past": func() test {
 			return test{
-				vv:   &validityValidator{5 * time.Minute, 24 * time.Hour},
+				vv:   newValidityValidator(5*time.Minute, 24*time.Hour),
 				cert: &x509.Certificate{NotAfter: time.Now().Add(-5 * time.Minute)},
 				opts: SignOptions{},
 				err:  errors.New("notAfter cannot be in the past"),
@@ -367,7 +378,7 @@ func Test_validityValidator_Valid(t *testing.T) {
 		},
 		"fail/notBefore-after-notAfter": func() test {
 			return test{
-				vv: &validityValidator{5 * time.Minute, 24 * time.Hour},
+				vv: newValidityValidator(5*time.Minute, 24*time.Hour),
 				cert: &x509.Certificate{NotBefore: time.Now().Add(10 * time.Minute),
 					NotAfter: time.Now().Add(5 * time.Minute)},
 				opts: SignOptions{},
@@ -377,7 +388,7 @@ func Test_validityValidator_Valid(t *testing.T) {
 		"fail/duration-too-short": func() test {
 			n := now()
 			return test{
-				vv: &validityValidator{5 * time.Minute, 24 * time.Hour},
+				vv: newValidityValidator(5*time.Minute, 24*time.Hour),
 				cert: &x509.Certificate{NotBefore: n,
 					NotAfter: n.Add(3 * time.Minute)},
 				opts: SignOptions{},
@@ -387,7 +398,7 @@ func Test_validityValidator_Valid(t *testing.T) {
 		"ok/duration-exactly-min": func() test {
 			n := now()
 			return test{
-				vv: &validityValidator{5 * time.Minute, 24 * time.Hour},
+				vv: newValidityValidator(5*time.Minute, 24*time.Hour),
 				cert: &x509.Certificate{NotBefore: n,
 					NotAfter: n.Add(5 * time.Minute)},
 				opts: SignOptions{},
@@ -396,16 +407,37 @@ func Test_validityValidator_Valid(t *testing.T) {
 		"fail/duration-too-great": func() test {
 			n := now()
 			return test{
-				vv: &validityValidator{5 * time.Minute, 24 * time.Hour},
+				vv: newValidityValidator(5*time.Minute, 24*time.Hour),
 				cert: &x509.Certificate{NotBefore: n,
 					NotAfter: n.Add(24*time.Hour + time.Second)},
 				err: errors.New("is more than the authorized maximum certificate duration of "),
 			}
 		},
+		"fail/category-duration-too-great": func() test {
+			n := now()
+			vv := newValidityValidator(5*time.Minute, 24*time.Hour)
+			vv.lifetimes = []TLSLifetime{{CategoryWildcard, &Duration{Duration: time.Hour}}}
+			return test{
+				vv: vv,
+				cert: &x509.Certificate{NotBefore: n, NotAfter: n.Add(2 * time.Hour),
+					DNSNames: []string{"*.example.com"}},
+				err: errors.New("is more than the authorized maximum wildcard certificate duration of "),
+			}
+		},
+		"ok/category-not-matching": func() test {
+			n := now()
+			vv := newValidityValidator(5*time.Minute, 24*time.Hour)
+			vv.lifetimes = []TLSLifetime{{CategoryWildcard, &Duration{Duration: time.Hour}}}
+			return test{
+				vv: vv,
+				cert: &x509.Certificate{NotBefore: n, NotAfter: n.Add(2 * time.Hour),
+					DNSNames: []string{"foo.example.com"}},
+			}
+		},
 		"ok/duration-exactly-max": func() test {
 			n := time.Now()
 			return test{
-				vv: &validityValidator{5 * time.Minute, 24 * time.Hour},
+				vv: newValidityValidator(5*time.Minute, 24*time.Hour),
 				cert: &x509.Certificate{NotBefore: n,
 					NotAfter: n.Add(24 * time.Hour)},
 			}
@@ -415,7 +447,7 @@ func Test_validityValidator_Valid(t *testing.T) {
 			cert := &x509.Certificate{NotBefore: now, NotAfter: now.Add(5 * time.Minute)}
 			time.Sleep(time.Second)
 			return test{
-				vv:   &validityValidator{5 * time.Minute, 24 * time.Hour},
+				vv:   newValidityValidator(5*time.Minute, 24*time.Hour),
 				cert: cert,
 				opts: SignOptions{Backdate: time.Second},
 			}
@@ -426,7 +458,7 @@ func Test_validityValidator_Valid(t *testing.T) {
 			cert := &x509.Certificate{NotBefore: now, NotAfter: now.Add(24*time.Hour + backdate)}
 			time.Sleep(backdate)
 			return test{
-				vv:   &validityValidator{5 * time.Minute, 24 * time.Hour},
+				vv:   newValidityValidator(5*time.Minute, 24*time.Hour),
 				cert: cert,
 				opts: SignOptions{Backdate: backdate},
 			}
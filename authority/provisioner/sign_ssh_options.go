@@ -346,7 +346,9 @@ func (v *sshCertDefaultValidator) Valid(cert *ssh.Certificate, _ SignSSHOptions)
 }
 
 // sshDefaultPublicKeyValidator implements a validator for the certificate key.
-type sshDefaultPublicKeyValidator struct{}
+type sshDefaultPublicKeyValidator struct {
+	keys *KeyClaims
+}
 
 // Valid checks that certificate request common name matches the one configured.
 //
@@ -371,12 +373,20 @@ func (v sshDefaultPublicKeyValidator) Valid(cert *ssh.Certificate, _ SignSSHOpti
 			return errs.Forbidden("ssh certificate key must be at least %d bits (%d bytes)",
 				8*keyutil.MinRSAKeyBytes, keyutil.MinRSAKeyBytes)
 		}
-		return nil
 	case ssh.KeyAlgoDSA:
 		return errs.BadRequest("ssh certificate key algorithm (DSA) is not supported")
-	default:
+	}
+	if v.keys == nil {
 		return nil
 	}
+	cpk, ok := cert.Key.(ssh.CryptoPublicKey)
+	if !ok {
+		return errs.BadRequest("ssh certificate key of type %s is not supported", cert.Key.Type())
+	}
+	if err := v.keys.Check(cpk.CryptoPublicKey()); err != nil {
+		return errs.Forbidden("ssh certificate %s", err)
+	}
+	return nil
 }
 
 // sshNamePolicyValidator validates that the certificate (to be signed)
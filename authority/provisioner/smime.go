@@ -0,0 +1,206 @@
+package provisioner
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"strings"
+
+	"github.com/smallstep/certificates/errs"
+)
+
+// DefaultSMIMELeafTemplate is the template used by default to issue S/MIME
+// certificates. Following RFC 8550, the certificates only contain email
+// addresses as subject alternative names and the emailProtection extended key
+// usage.
+const DefaultSMIMELeafTemplate = `{
+	"subject": {{ toJson .Subject }},
+	"sans": {{ toJson .SANs }},
+{{- if typeIs "*rsa.PublicKey" .Insecure.CR.PublicKey }}
+	"keyUsage": ["keyEncipherment", "digitalSignature"],
+{{- else }}
+	"keyUsage": ["digitalSignature"],
+{{- end }}
+	"extKeyUsage": ["emailProtection"]
+}`
+
+// oidSMIMECapabilities is the SMIMECapabilities extension defined in RFC 8551,
+// section 2.5.2, and RFC 4262.
+var oidSMIMECapabilities = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 15}
+
+// smimeCapabilities are the supported content encryption algorithms that can
+// be announced in the SMIMECapabilities extension.
+var smimeCapabilities = map[string]asn1.ObjectIdentifier{
+	"aes128-cbc": {2, 16, 840, 1, 101, 3, 4, 1, 2},
+	"aes192-cbc": {2, 16, 840, 1, 101, 3, 4, 1, 22},
+	"aes256-cbc": {2, 16, 840, 1, 101, 3, 4, 1, 42},
+	"aes128-gcm": {2, 16, 840, 1, 101, 3, 4, 1, 6},
+	"aes256-gcm": {2, 16, 840, 1, 101, 3, 4, 1, 46},
+}
+
+// defaultSMIMECapabilities is the list of capabilities, in order of
+// preference, used if none is configured.
+var defaultSMIMECapabilities = []string{"aes256-gcm", "aes128-gcm", "aes256-cbc", "aes128-cbc"}
+
+// SMIMEOptions contains the options used to issue S/MIME certificates.
+type SMIMEOptions struct {
+	// Capabilities is the list of content encryption algorithms, in order of
+	// preference, announced in the SMIMECapabilities extension. Supported
+	// values are aes128-cbc, aes192-cbc, aes256-cbc, aes128-gcm and
+	// aes256-gcm. Defaults to aes256-gcm, aes128-gcm, aes256-cbc and
+	// aes128-cbc.
+	Capabilities []string `json:"capabilities,omitempty"`
+
+	// RequireVerifiedMailbox requires the email addresses in the certificate
+	// to be verified by the provisioner, using the email_verified claim in an
+	// OIDC token, or the mail attributes of the user in an LDAP directory.
+	RequireVerifiedMailbox bool `json:"requireVerifiedMailbox,omitempty"`
+}
+
+// GetSMIMEOptions returns the S/MIME options.
+func (o *Options) GetSMIMEOptions() *SMIMEOptions {
+	if o == nil {
+		return nil
+	}
+	return o.SMIME
+}
+
+// Validate returns an error if the S/MIME options are not valid.
+func (o *SMIMEOptions) Validate() error {
+	if o == nil {
+		return nil
+	}
+	for _, c := range o.Capabilities {
+		if _, ok := smimeCapabilities[strings.ToLower(c)]; !ok {
+			return fmt.Errorf("smime capability %q is not supported", c)
+		}
+	}
+	return nil
+}
+
+// validateSMIMEOptions returns an error if the S/MIME options are not valid or
+// if the given provisioner type cannot issue S/MIME certificates. Only the OIDC
+// and LDAP provisioners apply the S/MIME options, the other provisioners would
+// silently ignore them.
+func validateSMIMEOptions(typ Type, o *SMIMEOptions) error {
+	if o == nil {
+		return nil
+	}
+	switch typ {
+	case TypeOIDC, TypeLDAP:
+		return o.Validate()
+	default:
+		return fmt.Errorf("smime options are not supported by %s provisioners", typ)
+	}
+}
+
+type smimeCapability struct {
+	CapabilityID asn1.ObjectIdentifier
+}
+
+// smimeProfileModifier is a CertificateModifier that adds the extensions
+// required in S/MIME certificates.
+type smimeProfileModifier struct {
+	capabilities []string
+}
+
+func newSMIMEProfileModifier(o *SMIMEOptions) *smimeProfileModifier {
+	capabilities := defaultSMIMECapabilities
+	if o != nil && len(o.Capabilities) > 0 {
+		capabilities = o.Capabilities
+	}
+	return &smimeProfileModifier{
+		capabilities: capabilities,
+	}
+}
+
+// Modify sets the key usage and the emailProtection extended key usage as
+// defined in RFC 8550, section 4.4, and adds the SMIMECapabilities extension
+// if it's not already present.
+func (m *smimeProfileModifier) Modify(cert *x509.Certificate, _ SignOptions) error {
+	cert.KeyUsage |= x509.KeyUsageDigitalSignature
+	if _, ok := cert.PublicKey.(*rsa.PublicKey); ok {
+		cert.KeyUsage |= x509.KeyUsageKeyEncipherment
+	}
+
+	hasEmailProtection := false
+	for _, eku := range cert.ExtKeyUsage {
+		if eku == x509.ExtKeyUsageEmailProtection {
+			hasEmailProtection = true
+			break
+		}
+	}
+	if !hasEmailProtection {
+		cert.ExtKeyUsage = append(cert.ExtKeyUsage, x509.ExtKeyUsageEmailProtection)
+	}
+
+	for _, ext := range cert.ExtraExtensions {
+		if ext.Id.Equal(oidSMIMECapabilities) {
+			return nil
+		}
+	}
+
+	caps := make([]smimeCapability, len(m.capabilities))
+	for i, c := range m.capabilities {
+		oid, ok := smimeCapabilities[strings.ToLower(c)]
+		if !ok {
+			return errs.InternalServer("smime capability %q is not supported", c)
+		}
+		caps[i] = smimeCapability{CapabilityID: oid}
+	}
+	b, err := asn1.Marshal(caps)
+	if err != nil {
+		return errs.InternalServerErr(err, errs.WithMessage("error marshaling smime capabilities"))
+	}
+	cert.ExtraExtensions = append(cert.ExtraExtensions, pkix.Extension{
+		Id:    oidSMIMECapabilities,
+		Value: b,
+	})
+	return nil
+}
+
+// smimeMailboxValidator is a CertificateValidator that checks that a
+// certificate can be used as an S/MIME certificate, and if configured, that
+// all the email addresses in it have been verified by the provisioner.
+type smimeMailboxValidator struct {
+	requireVerified bool
+	verified        []string
+}
+
+func newSMIMEMailboxValidator(o *SMIMEOptions, verified ...string) *smimeMailboxValidator {
+	return &smimeMailboxValidator{
+		requireVerified: o != nil && o.RequireVerifiedMailbox,
+		verified:        verified,
+	}
+}
+
+// Valid implements the CertificateValidator interface.
+func (v *smimeMailboxValidator) Valid(cert *x509.Certificate, _ SignOptions) error {
+	switch {
+	case len(cert.EmailAddresses) == 0:
+		return errs.Forbidden("smime certificates must contain at least one email address")
+	case len(cert.DNSNames) > 0 || len(cert.IPAddresses) > 0:
+		return errs.Forbidden("smime certificates cannot contain DNS names or IP addresses")
+	case !v.requireVerified:
+		return nil
+	}
+
+	for _, email := range cert.EmailAddresses {
+		if !v.isVerified(email) {
+			return errs.Forbidden("smime certificate email address %q has not been verified", email)
+		}
+	}
+	return nil
+}
+
+func (v *smimeMailboxValidator) isVerified(email string) bool {
+	email = sanitizeEmail(email)
+	for _, e := range v.verified {
+		if email == sanitizeEmail(e) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,146 @@
+package provisioner
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSMIMEOptions_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		options *SMIMEOptions
+		wantErr bool
+	}{
+		{"ok/nil", nil, false},
+		{"ok/empty", &SMIMEOptions{}, false},
+		{"ok/capabilities", &SMIMEOptions{Capabilities: []string{"AES256-GCM", "aes128-cbc"}}, false},
+		{"fail/capabilities", &SMIMEOptions{Capabilities: []string{"aes256-gcm", "des-ede3-cbc"}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.options.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("SMIMEOptions.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_smimeProfileModifier_Modify(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	mustCapabilities := func(names ...string) []byte {
+		caps := make([]smimeCapability, len(names))
+		for i, name := range names {
+			caps[i] = smimeCapability{CapabilityID: smimeCapabilities[name]}
+		}
+		b, err := asn1.Marshal(caps)
+		require.NoError(t, err)
+		return b
+	}
+
+	existing := pkix.Extension{Id: oidSMIMECapabilities, Value: []byte("existing")}
+
+	tests := []struct {
+		name      string
+		modifier  *smimeProfileModifier
+		cert      *x509.Certificate
+		want      *x509.Certificate
+		assertion assert.ErrorAssertionFunc
+	}{
+		{"ok/ec", newSMIMEProfileModifier(nil), &x509.Certificate{
+			PublicKey: ecKey.Public(),
+		}, &x509.Certificate{
+			PublicKey:   ecKey.Public(),
+			KeyUsage:    x509.KeyUsageDigitalSignature,
+			ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageEmailProtection},
+			ExtraExtensions: []pkix.Extension{
+				{Id: oidSMIMECapabilities, Value: mustCapabilities("aes256-gcm", "aes128-gcm", "aes256-cbc", "aes128-cbc")},
+			},
+		}, assert.NoError},
+		{"ok/rsa", newSMIMEProfileModifier(&SMIMEOptions{Capabilities: []string{"aes256-cbc"}}), &x509.Certificate{
+			PublicKey:   rsaKey.Public(),
+			ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageEmailProtection},
+		}, &x509.Certificate{
+			PublicKey:   rsaKey.Public(),
+			KeyUsage:    x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+			ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageEmailProtection},
+			ExtraExtensions: []pkix.Extension{
+				{Id: oidSMIMECapabilities, Value: mustCapabilities("aes256-cbc")},
+			},
+		}, assert.NoError},
+		{"ok/existing-capabilities", newSMIMEProfileModifier(nil), &x509.Certificate{
+			PublicKey:       ecKey.Public(),
+			ExtraExtensions: []pkix.Extension{existing},
+		}, &x509.Certificate{
+			PublicKey:       ecKey.Public(),
+			KeyUsage:        x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:     []x509.ExtKeyUsage{x509.ExtKeyUsageEmailProtection},
+			ExtraExtensions: []pkix.Extension{existing},
+		}, assert.NoError},
+		{"fail/capability", &smimeProfileModifier{capabilities: []string{"des-ede3-cbc"}}, &x509.Certificate{
+			PublicKey: ecKey.Public(),
+		}, &x509.Certificate{
+			PublicKey:   ecKey.Public(),
+			KeyUsage:    x509.KeyUsageDigitalSignature,
+			ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageEmailProtection},
+		}, assert.Error},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.assertion(t, tt.modifier.Modify(tt.cert, SignOptions{}))
+			assert.Equal(t, tt.want, tt.cert)
+		})
+	}
+}
+
+func Test_smimeMailboxValidator_Valid(t *testing.T) {
+	required := &SMIMEOptions{RequireVerifiedMailbox: true}
+	tests := []struct {
+		name      string
+		validator *smimeMailboxValidator
+		cert      *x509.Certificate
+		wantErr   bool
+	}{
+		{"ok", newSMIMEMailboxValidator(nil), &x509.Certificate{
+			EmailAddresses: []string{"jane@example.com"},
+		}, false},
+		{"ok/verified", newSMIMEMailboxValidator(required, "jane@example.com"), &x509.Certificate{
+			EmailAddresses: []string{"jane@EXAMPLE.com"},
+		}, false},
+		{"fail/no-emails", newSMIMEMailboxValidator(nil), &x509.Certificate{}, true},
+		{"fail/dns", newSMIMEMailboxValidator(nil), &x509.Certificate{
+			EmailAddresses: []string{"jane@example.com"},
+			DNSNames:       []string{"example.com"},
+		}, true},
+		{"fail/ip", newSMIMEMailboxValidator(nil), &x509.Certificate{
+			EmailAddresses: []string{"jane@example.com"},
+			IPAddresses:    []net.IP{net.ParseIP("127.0.0.1")},
+		}, true},
+		{"fail/not-verified", newSMIMEMailboxValidator(required), &x509.Certificate{
+			EmailAddresses: []string{"jane@example.com"},
+		}, true},
+		{"fail/other-email", newSMIMEMailboxValidator(required, "jane@example.com"), &x509.Certificate{
+			EmailAddresses: []string{"jane@example.com", "john@example.com"},
+		}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.validator.Valid(tt.cert, SignOptions{}); (err != nil) != tt.wantErr {
+				t.Errorf("smimeMailboxValidator.Valid() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
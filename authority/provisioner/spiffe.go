@@ -0,0 +1,327 @@
+package provisioner
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"go.step.sm/crypto/jose"
+	"go.step.sm/crypto/x509util"
+	"go.step.sm/linkedca"
+
+	"github.com/smallstep/certificates/errs"
+	"github.com/smallstep/certificates/webhook"
+)
+
+const (
+	// spiffeJWTSVIDUse is the use of the JWT-SVID keys in a SPIFFE bundle.
+	spiffeJWTSVIDUse = "jwt-svid"
+	// spiffeX509SVIDUse is the use of the X.509-SVID authorities in a SPIFFE
+	// bundle.
+	spiffeX509SVIDUse = "x509-svid"
+)
+
+// SPIFFE is a provisioner that authorizes workloads attested by SPIRE, or
+// other SPIFFE implementations, using their SVIDs. The token can be:
+//
+//   - A JWT-SVID, validated with the JWT authorities of the trust bundle.
+//   - A JWT signed with the key of an X.509-SVID, and the SVID chain in the x5c
+//     header, validated with the X.509 authorities of the trust bundle.
+//
+// The token audience must be the sign URL of the CA with the fragment
+// "spiffe/<name>", e.g., https://ca.example.com/1.0/sign#spiffe/spire, and
+// the subject must be the SPIFFE ID of the workload.
+//
+// The trust bundle is read from the SPIFFE bundle endpoint of the trust
+// domain, using Web PKI authentication, or it can be set in the configuration.
+//
+// Only the SPIFFE IDs matching one of the configured patterns are allowed,
+// e.g., spiffe://example.org/ns/prod/*. The default certificate uses the
+// SPIFFE ID as the common name and the URI SAN, other SANs can be added using
+// templates.
+type SPIFFE struct {
+	*base
+	ID   string `json:"-"`
+	Type string `json:"type"`
+	Name string `json:"name"`
+	// TrustDomain is the trust domain of the SPIFFE IDs, e.g., example.org.
+	TrustDomain string `json:"trustDomain"`
+	// BundleEndpoint is the https URL of the SPIFFE bundle endpoint.
+	BundleEndpoint string `json:"bundleEndpoint,omitempty"`
+	// Bundle is the SPIFFE bundle, a JWK set, of the trust domain.
+	Bundle json.RawMessage `json:"bundle,omitempty"`
+	// IDs is the list of SPIFFE IDs allowed. The patterns use the syntax of
+	// path.Match.
+	IDs      []string `json:"ids"`
+	Claims   *Claims  `json:"claims,omitempty"`
+	Options  *Options `json:"options,omitempty"`
+	bundle   *jose.JSONWebKeySet
+	keyStore *keyStore
+	ctl      *Controller
+}
+
+// GetID returns the provisioner unique identifier.
+func (p *SPIFFE) GetID() string {
+	if p.ID != "" {
+		return p.ID
+	}
+	return p.GetIDForToken()
+}
+
+// GetIDForToken returns an identifier that will be used to load the provisioner
+// from a token.
+func (p *SPIFFE) GetIDForToken() string {
+	return "spiffe/" + p.Name
+}
+
+// GetTokenID returns the identifier of the token.
+func (p *SPIFFE) GetTokenID(token string) (string, error) {
+	jwt, err := jose.ParseSigned(token)
+	if err != nil {
+		return "", errors.Wrap(err, "error parsing token")
+	}
+	var claims jose.Claims
+	if err := jwt.UnsafeClaimsWithoutVerification(&claims); err != nil {
+		return "", errors.Wrap(err, "error verifying claims")
+	}
+	return claims.ID, nil
+}
+
+// GetName returns the name of the provisioner.
+func (p *SPIFFE) GetName() string {
+	return p.Name
+}
+
+// GetType returns the type of provisioner.
+func (p *SPIFFE) GetType() Type {
+	return TypeSPIFFE
+}
+
+// GetEncryptedKey is not available in a SPIFFE provisioner.
+func (p *SPIFFE) GetEncryptedKey() (kid, key string, ok bool) {
+	return "", "", false
+}
+
+// GetOptions returns the configured provisioner options.
+func (p *SPIFFE) GetOptions() *Options {
+	return p.Options
+}
+
+// Init validates and initializes the SPIFFE provisioner.
+func (p *SPIFFE) Init(config Config) (err error) {
+	switch {
+	case p.Type == "":
+		return errors.New("provisioner type cannot be empty")
+	case p.Name == "":
+		return errors.New("provisioner name cannot be empty")
+	case p.TrustDomain == "":
+		return errors.New("provisioner trustDomain cannot be empty")
+	case p.BundleEndpoint == "" && len(p.Bundle) == 0:
+		return errors.New("provisioner bundleEndpoint or bundle must be set")
+	case p.BundleEndpoint != "" && len(p.Bundle) > 0:
+		return errors.New("provisioner bundleEndpoint and bundle cannot be used together")
+	case len(p.IDs) == 0:
+		return errors.New("provisioner ids cannot be empty")
+	}
+	if err := validatePatterns(p.IDs); err != nil {
+		return err
+	}
+
+	config.Audiences = config.Audiences.WithFragment(p.GetIDForToken())
+	if p.ctl, err = NewController(p, p.Claims, config, p.Options); err != nil {
+		return
+	}
+
+	if len(p.Bundle) > 0 {
+		p.bundle = new(jose.JSONWebKeySet)
+		if err := json.Unmarshal(p.Bundle, p.bundle); err != nil {
+			return errors.Wrap(err, "error parsing provisioner bundle")
+		}
+		return nil
+	}
+
+	if u, err := url.Parse(p.BundleEndpoint); err != nil || u.Scheme != "https" || u.Host == "" {
+		return errors.Errorf("provisioner bundleEndpoint %q is not a valid URL", p.BundleEndpoint)
+	}
+	p.keyStore, err = newKeyStore(p.ctl.GetHTTPClient(), p.BundleEndpoint)
+	return
+}
+
+// getAuthorities returns the keys in the trust bundle with the given use.
+func (p *SPIFFE) getAuthorities(use string) []jose.JSONWebKey {
+	var keys []jose.JSONWebKey
+	if p.keyStore != nil {
+		keys = p.keyStore.Keys()
+	} else {
+		keys = p.bundle.Keys
+	}
+
+	var authorities []jose.JSONWebKey
+	for _, k := range keys {
+		if k.Use == use {
+			authorities = append(authorities, k)
+		}
+	}
+	return authorities
+}
+
+// getJWTAuthorities returns the JWT authorities in the trust bundle with the
+// given key id.
+func (p *SPIFFE) getJWTAuthorities(kid string) []jose.JSONWebKey {
+	if kid == "" {
+		return nil
+	}
+	var keys []jose.JSONWebKey
+	for _, k := range p.getAuthorities(spiffeJWTSVIDUse) {
+		if k.KeyID == kid {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+// validateID returns an error if the SPIFFE ID is not valid or it does not
+// belong to the configured trust domain.
+func (p *SPIFFE) validateID(id string) error {
+	u, err := url.Parse(id)
+	switch {
+	case err != nil:
+		return errors.Wrapf(err, "error parsing SPIFFE ID %s", id)
+	case u.Scheme != "spiffe" || u.Opaque != "" || u.User != nil || u.RawQuery != "" || u.Fragment != "":
+		return errors.Errorf("%s is not a valid SPIFFE ID", id)
+	case u.Host != p.TrustDomain:
+		return errors.Errorf("SPIFFE ID %s does not belong to the trust domain %s", id, p.TrustDomain)
+	default:
+		return nil
+	}
+}
+
+// authorizeToken validates the JWT-SVID or the x5c token signed by an
+// X.509-SVID, and returns the claims.
+func (p *SPIFFE) authorizeToken(token string, audiences []string) (*jose.Claims, error) {
+	jwt, err := jose.ParseSigned(token)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusUnauthorized, err, "spiffe.authorizeToken; error parsing token")
+	}
+	if len(jwt.Headers) == 0 {
+		return nil, errs.Unauthorized("spiffe.authorizeToken; error parsing token - header is missing")
+	}
+
+	var claims jose.Claims
+	kid := jwt.Headers[0].KeyID
+	if keys := p.getJWTAuthorities(kid); len(keys) > 0 {
+		// JWT-SVID
+		var found bool
+		for _, key := range keys {
+			if err := jwt.Claims(key, &claims); err == nil {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, errs.Unauthorized("spiffe.authorizeToken; cannot validate token - invalid signature for kid %s", kid)
+		}
+	} else {
+		// Token signed by an X.509-SVID
+		roots := x509.NewCertPool()
+		for _, key := range p.getAuthorities(spiffeX509SVIDUse) {
+			for _, crt := range key.Certificates {
+				roots.AddCert(crt)
+			}
+		}
+		chains, err := jwt.Headers[0].Certificates(x509.VerifyOptions{
+			Roots:     roots,
+			KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		})
+		if err != nil {
+			return nil, errs.Wrap(http.StatusUnauthorized, err, "spiffe.authorizeToken; cannot validate token - cannot find key for kid %s or verify the x5c certificate chain", kid)
+		}
+		leaf := chains[0][0]
+		if leaf.KeyUsage&x509.KeyUsageDigitalSignature == 0 {
+			return nil, errs.Unauthorized("spiffe.authorizeToken; certificate used to sign the token cannot be used for digital signature")
+		}
+		if len(leaf.URIs) != 1 {
+			return nil, errs.Unauthorized("spiffe.authorizeToken; certificate used to sign the token is not an X.509-SVID")
+		}
+		if err := jwt.Claims(leaf.PublicKey, &claims); err != nil {
+			return nil, errs.Wrap(http.StatusUnauthorized, err, "spiffe.authorizeToken; error parsing token claims")
+		}
+		if claims.Subject != leaf.URIs[0].String() {
+			return nil, errs.Unauthorized("spiffe.authorizeToken; token subject %s does not match the SPIFFE ID %s", claims.Subject, leaf.URIs[0])
+		}
+	}
+
+	// JWT-SVIDs do not require an issuer, but they must have an expiration.
+	if claims.Expiry == nil {
+		return nil, errs.Unauthorized("spiffe.authorizeToken; invalid token claims: exp cannot be empty")
+	}
+	// According to "rfc7519 JSON Web Token" acceptable skew should be no
+	// more than a few minutes.
+	if err := claims.ValidateWithLeeway(jose.Expected{
+		Time: time.Now().UTC(),
+	}, time.Minute); err != nil {
+		return nil, errs.Wrap(http.StatusUnauthorized, err, "spiffe.authorizeToken; invalid token claims")
+	}
+	if !matchesAudience(claims.Audience, audiences) {
+		return nil, errs.Unauthorized("spiffe.authorizeToken; invalid token audience claim (aud)")
+	}
+
+	if err := p.validateID(claims.Subject); err != nil {
+		return nil, errs.Wrap(http.StatusUnauthorized, err, "spiffe.authorizeToken; invalid token subject")
+	}
+	if !matchesPatterns(p.IDs, claims.Subject) {
+		return nil, errs.Unauthorized("spiffe.authorizeToken; SPIFFE ID %s is not allowed", claims.Subject)
+	}
+
+	return &claims, nil
+}
+
+// AuthorizeSign validates the given token and returns the sign options that
+// will be used on certificate creation.
+func (p *SPIFFE) AuthorizeSign(_ context.Context, token string) ([]SignOption, error) {
+	if err := p.ctl.AuthorizeIssuance(); err != nil {
+		return nil, err
+	}
+	claims, err := p.authorizeToken(token, p.ctl.Audiences.Sign)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "spiffe.AuthorizeSign")
+	}
+
+	// Certificate templates
+	data := x509util.CreateTemplateData(claims.Subject, []string{claims.Subject})
+	if v, err := unsafeParseSigned(token); err == nil {
+		data.SetToken(v)
+	}
+
+	templateOptions, err := CustomTemplateOptions(p.Options, data, x509util.DefaultLeafTemplate)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "spiffe.AuthorizeSign")
+	}
+
+	return []SignOption{
+		p,
+		templateOptions,
+		// modifiers / withOptions
+		newProvisionerExtensionOption(TypeSPIFFE, p.Name, claims.Subject).WithControllerOptions(p.ctl),
+		profileDefaultDuration(p.ctl.Claimer.DefaultTLSCertDuration()),
+		// validators
+		defaultPublicKeyValidator{keys: p.ctl.Claimer.KeyClaims()},
+		newClaimsValidityValidator(p.ctl.Claimer),
+		newX509NamePolicyValidator(p.ctl.getPolicy().getX509()),
+		p.ctl.newWebhookController(
+			data,
+			linkedca.Webhook_X509,
+			webhook.WithAuthorizationPrincipal(claims.Subject),
+		),
+	}, nil
+}
+
+// AuthorizeRenew returns an error if the renewal is disabled.
+func (p *SPIFFE) AuthorizeRenew(ctx context.Context, cert *x509.Certificate) error {
+	return p.ctl.AuthorizeRenew(ctx, cert)
+}
@@ -0,0 +1,209 @@
+package provisioner
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.step.sm/crypto/jose"
+	"go.step.sm/crypto/minica"
+
+	"github.com/smallstep/certificates/api/render"
+)
+
+type spiffeTestBundle struct {
+	ca     *minica.CA
+	jwtKey *jose.JSONWebKey
+	bundle []byte
+}
+
+func generateSPIFFEBundle(t *testing.T) *spiffeTestBundle {
+	t.Helper()
+	ca, err := minica.New()
+	require.NoError(t, err)
+	jwtKey, err := generateJSONWebKey()
+	require.NoError(t, err)
+
+	jwtAuthority := jwtKey.Public()
+	jwtAuthority.Use = spiffeJWTSVIDUse
+	b, err := json.Marshal(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{
+		jwtAuthority,
+		{Key: ca.Root.PublicKey, Certificates: []*x509.Certificate{ca.Root}, Use: spiffeX509SVIDUse},
+	}})
+	require.NoError(t, err)
+	return &spiffeTestBundle{ca: ca, jwtKey: jwtKey, bundle: b}
+}
+
+// x509SVIDToken returns a token signed by a new X.509-SVID with the given
+// SPIFFE ID.
+func (b *spiffeTestBundle) x509SVIDToken(t *testing.T, id, sub, aud string) string {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	u, err := url.Parse(id)
+	require.NoError(t, err)
+	leaf, err := b.ca.Sign(&x509.Certificate{
+		PublicKey:   key.Public(),
+		URIs:        []*url.URL{u},
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	})
+	require.NoError(t, err)
+	tok, err := generateCustomToken(sub, "", aud, &jose.JSONWebKey{Key: key}, map[string]any{
+		"x5c": []string{
+			base64.StdEncoding.EncodeToString(leaf.Raw),
+			base64.StdEncoding.EncodeToString(b.ca.Intermediate.Raw),
+		},
+	}, nil)
+	require.NoError(t, err)
+	return tok
+}
+
+func TestSPIFFE_Getters(t *testing.T) {
+	p := &SPIFFE{Type: "SPIFFE", Name: "spire"}
+	assert.Equal(t, "spiffe/spire", p.GetID())
+	assert.Equal(t, "spiffe/spire", p.GetIDForToken())
+	assert.Equal(t, "spire", p.GetName())
+	assert.Equal(t, TypeSPIFFE, p.GetType())
+	assert.Equal(t, "SPIFFE", p.GetType().String())
+	kid, key, ok := p.GetEncryptedKey()
+	assert.Empty(t, kid)
+	assert.Empty(t, key)
+	assert.False(t, ok)
+}
+
+func TestSPIFFE_Init(t *testing.T) {
+	b := generateSPIFFEBundle(t)
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(b.bundle)
+	}))
+	defer srv.Close()
+
+	config := Config{Claims: globalProvisionerClaims, Audiences: testAudiences, HTTPClient: srv.Client()}
+	ids := []string{"spiffe://example.org/*"}
+	tests := []struct {
+		name    string
+		p       *SPIFFE
+		wantErr bool
+	}{
+		{"ok bundle", &SPIFFE{Type: "SPIFFE", Name: "spire", TrustDomain: "example.org", Bundle: b.bundle, IDs: ids}, false},
+		{"ok bundleEndpoint", &SPIFFE{Type: "SPIFFE", Name: "spire", TrustDomain: "example.org", BundleEndpoint: srv.URL, IDs: ids}, false},
+		{"fail type", &SPIFFE{Name: "spire", TrustDomain: "example.org", Bundle: b.bundle, IDs: ids}, true},
+		{"fail name", &SPIFFE{Type: "SPIFFE", TrustDomain: "example.org", Bundle: b.bundle, IDs: ids}, true},
+		{"fail trustDomain", &SPIFFE{Type: "SPIFFE", Name: "spire", Bundle: b.bundle, IDs: ids}, true},
+		{"fail no bundle", &SPIFFE{Type: "SPIFFE", Name: "spire", TrustDomain: "example.org", IDs: ids}, true},
+		{"fail both", &SPIFFE{Type: "SPIFFE", Name: "spire", TrustDomain: "example.org", BundleEndpoint: srv.URL, Bundle: b.bundle, IDs: ids}, true},
+		{"fail ids", &SPIFFE{Type: "SPIFFE", Name: "spire", TrustDomain: "example.org", Bundle: b.bundle}, true},
+		{"fail pattern", &SPIFFE{Type: "SPIFFE", Name: "spire", TrustDomain: "example.org", Bundle: b.bundle, IDs: []string{"spiffe://example.org/["}}, true},
+		{"fail bundle", &SPIFFE{Type: "SPIFFE", Name: "spire", TrustDomain: "example.org", Bundle: json.RawMessage(`"foo"`), IDs: ids}, true},
+		{"fail bundleEndpoint", &SPIFFE{Type: "SPIFFE", Name: "spire", TrustDomain: "example.org", BundleEndpoint: "http://example.org", IDs: ids}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.p.Init(config)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Len(t, tt.p.getAuthorities(spiffeJWTSVIDUse), 1)
+			assert.Len(t, tt.p.getAuthorities(spiffeX509SVIDUse), 1)
+		})
+	}
+}
+
+func TestSPIFFE_authorizeToken(t *testing.T) {
+	b := generateSPIFFEBundle(t)
+	other := generateSPIFFEBundle(t)
+
+	p := &SPIFFE{
+		Type: "SPIFFE", Name: "spire", TrustDomain: "example.org", Bundle: b.bundle,
+		IDs: []string{"spiffe://example.org/ns/prod/*", "spiffe://example.org/db"},
+	}
+	require.NoError(t, p.Init(Config{Claims: globalProvisionerClaims, Audiences: testAudiences}))
+	aud := testAudiences.Sign[0] + "#spiffe/spire"
+
+	jwtSVID := func(sub, aud string, jwk *jose.JSONWebKey) string {
+		tok, err := generateCustomToken(sub, "", aud, jwk, nil, nil)
+		require.NoError(t, err)
+		return tok
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		wantSub string
+		wantErr bool
+	}{
+		{"ok jwt-svid", jwtSVID("spiffe://example.org/ns/prod/web", aud, b.jwtKey), "spiffe://example.org/ns/prod/web", false},
+		{"ok x509-svid", b.x509SVIDToken(t, "spiffe://example.org/db", "spiffe://example.org/db", aud), "spiffe://example.org/db", false},
+		{"fail token", "foo", "", true},
+		{"fail jwt-svid key", jwtSVID("spiffe://example.org/ns/prod/web", aud, other.jwtKey), "", true},
+		{"fail jwt-svid audience", jwtSVID("spiffe://example.org/ns/prod/web", testAudiences.Sign[0], b.jwtKey), "", true},
+		{"fail jwt-svid trust domain", jwtSVID("spiffe://other.org/ns/prod/web", aud, b.jwtKey), "", true},
+		{"fail jwt-svid not spiffe", jwtSVID("https://example.org/ns/prod/web", aud, b.jwtKey), "", true},
+		{"fail jwt-svid not allowed", jwtSVID("spiffe://example.org/ns/dev/web", aud, b.jwtKey), "", true},
+		{"fail jwt-svid not allowed path", jwtSVID("spiffe://example.org/ns/prod/web/sub", aud, b.jwtKey), "", true},
+		{"fail x509-svid authority", other.x509SVIDToken(t, "spiffe://example.org/db", "spiffe://example.org/db", aud), "", true},
+		{"fail x509-svid subject", b.x509SVIDToken(t, "spiffe://example.org/db", "spiffe://example.org/ns/prod/web", aud), "", true},
+		{"fail x509-svid not allowed", b.x509SVIDToken(t, "spiffe://example.org/cache", "spiffe://example.org/cache", aud), "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := p.authorizeToken(tt.token, p.ctl.Audiences.Sign)
+			if tt.wantErr {
+				var sc render.StatusCodedError
+				require.ErrorAs(t, err, &sc)
+				assert.Equal(t, http.StatusUnauthorized, sc.StatusCode())
+				assert.Nil(t, got)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantSub, got.Subject)
+		})
+	}
+}
+
+func TestSPIFFE_AuthorizeSign(t *testing.T) {
+	b := generateSPIFFEBundle(t)
+	p := &SPIFFE{
+		Type: "SPIFFE", Name: "spire", TrustDomain: "example.org", Bundle: b.bundle,
+		IDs: []string{"spiffe://example.org/*"},
+	}
+	require.NoError(t, p.Init(Config{Claims: globalProvisionerClaims, Audiences: testAudiences}))
+
+	token, err := generateCustomToken("spiffe://example.org/web", "", testAudiences.Sign[0]+"#spiffe/spire", b.jwtKey, nil, nil)
+	require.NoError(t, err)
+	opts, err := p.AuthorizeSign(context.Background(), token)
+	require.NoError(t, err)
+	assert.Len(t, opts, 8)
+	for _, o := range opts {
+		switch v := o.(type) {
+		case *SPIFFE:
+		case certificateOptionsFunc:
+		case *provisionerExtensionOption:
+			assert.Equal(t, TypeSPIFFE, v.Type)
+			assert.Equal(t, "spire", v.Name)
+			assert.Equal(t, "spiffe://example.org/web", v.CredentialID)
+		case profileDefaultDuration:
+		case defaultPublicKeyValidator:
+		case *validityValidator:
+		case *x509NamePolicyValidator:
+		case *WebhookController:
+			assert.Empty(t, v.webhooks)
+		default:
+			assert.FailNow(t, "unexpected sign option", "%T", v)
+		}
+	}
+}
@@ -128,7 +128,7 @@ func CustomSSHTemplateOptions(o *Options, data sshutil.TemplateData, defaultTemp
 		// We're not provided user data without custom templates.
 		if !opts.HasTemplate() {
 			return []sshutil.Option{
-				sshutil.WithTemplate(defaultTemplate, data),
+				withSSHTemplate(defaultTemplate, data),
 			}
 		}
 
@@ -145,7 +145,7 @@ func CustomSSHTemplateOptions(o *Options, data sshutil.TemplateData, defaultTemp
 		// Load a template from a file if Template is not defined.
 		if opts.Template == "" && opts.TemplateFile != "" {
 			return []sshutil.Option{
-				sshutil.WithTemplateFile(step.Abs(opts.TemplateFile), data),
+				withSSHTemplateFile(step.Abs(opts.TemplateFile), data),
 			}
 		}
 
@@ -154,12 +154,12 @@ func CustomSSHTemplateOptions(o *Options, data sshutil.TemplateData, defaultTemp
 		template := strings.TrimSpace(opts.Template)
 		if strings.HasPrefix(template, "{") {
 			return []sshutil.Option{
-				sshutil.WithTemplate(template, data),
+				withSSHTemplate(template, data),
 			}
 		}
 		// 2. As a base64 encoded JSON.
 		return []sshutil.Option{
-			sshutil.WithTemplateBase64(template, data),
+			withSSHTemplateBase64(template, data),
 		}
 	}), nil
 }
@@ -0,0 +1,189 @@
+package provisioner
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/base64"
+	"os"
+	"sync"
+	"text/template"
+
+	"github.com/pkg/errors"
+	"go.step.sm/crypto/sshutil"
+	"go.step.sm/crypto/x509util"
+)
+
+// maxCachedTemplates is the maximum number of compiled templates kept in each
+// cache. If it's reached the cache is emptied.
+const maxCachedTemplates = 1024
+
+// templateCache caches the compiled templates by their text, so templates
+// configured in the provisioners are only parsed once instead of on every
+// issuance.
+type templateCache struct {
+	mu        sync.RWMutex
+	funcMap   func() template.FuncMap
+	templates map[string]*template.Template
+}
+
+func newTemplateCache(funcMap func() template.FuncMap) *templateCache {
+	return &templateCache{
+		funcMap:   funcMap,
+		templates: make(map[string]*template.Template),
+	}
+}
+
+var (
+	x509TemplateCache = newTemplateCache(x509util.GetFuncMap)
+	sshTemplateCache  = newTemplateCache(sshutil.GetFuncMap)
+)
+
+// ResetTemplateCache removes all the compiled templates from the cache. It's
+// called when the provisioners are reloaded.
+func ResetTemplateCache() {
+	x509TemplateCache.reset()
+	sshTemplateCache.reset()
+}
+
+func (c *templateCache) reset() {
+	c.mu.Lock()
+	c.templates = make(map[string]*template.Template)
+	c.mu.Unlock()
+}
+
+// get returns the compiled template for the given text, parsing and storing it
+// if it's not in the cache.
+func (c *templateCache) get(text string) (*template.Template, error) {
+	c.mu.RLock()
+	tmpl, ok := c.templates[text]
+	c.mu.RUnlock()
+	if ok {
+		return tmpl, nil
+	}
+
+	tmpl, err := template.New("template").Funcs(c.funcMap()).Parse(text)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error parsing template")
+	}
+
+	c.mu.Lock()
+	if len(c.templates) >= maxCachedTemplates {
+		c.templates = make(map[string]*template.Template)
+	}
+	c.templates[text] = tmpl
+	c.mu.Unlock()
+	return tmpl, nil
+}
+
+// execute executes the compiled template for the given text with the given
+// data. The "fail" function is replaced on a copy of the template so the
+// message is reported in the returned string.
+func (c *templateCache) execute(text string, data any) (*bytes.Buffer, string, error) {
+	tmpl, err := c.get(text)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var failMessage string
+	tmpl, err = tmpl.Clone()
+	if err != nil {
+		return nil, "", errors.Wrapf(err, "error parsing template")
+	}
+	tmpl.Funcs(template.FuncMap{
+		"fail": func(msg string) (string, error) {
+			failMessage = msg
+			return "", errors.New(msg)
+		},
+	})
+
+	buf := new(bytes.Buffer)
+	if err := tmpl.Execute(buf, data); err != nil {
+		if failMessage != "" {
+			return nil, failMessage, err
+		}
+		return nil, "", errors.Wrapf(err, "error executing template")
+	}
+	return buf, "", nil
+}
+
+// withX509Template is an x509util.Option that behaves like
+// x509util.WithTemplate but uses the cache of compiled templates.
+func withX509Template(text string, data x509util.TemplateData) x509util.Option {
+	return func(cr *x509.CertificateRequest, o *x509util.Options) error {
+		data.SetCertificateRequest(cr)
+		buf, failMessage, err := x509TemplateCache.execute(text, data)
+		switch {
+		case failMessage != "":
+			return &x509util.TemplateError{Message: failMessage}
+		case err != nil:
+			return err
+		}
+		o.CertBuffer = buf
+		return nil
+	}
+}
+
+// withX509TemplateBase64 is an x509util.Option that behaves like
+// x509util.WithTemplateBase64 but uses the cache of compiled templates.
+func withX509TemplateBase64(s string, data x509util.TemplateData) x509util.Option {
+	return func(cr *x509.CertificateRequest, o *x509util.Options) error {
+		b, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			return errors.Wrap(err, "error decoding template")
+		}
+		return withX509Template(string(b), data)(cr, o)
+	}
+}
+
+// withX509TemplateFile is an x509util.Option that behaves like
+// x509util.WithTemplateFile but uses the cache of compiled templates.
+func withX509TemplateFile(path string, data x509util.TemplateData) x509util.Option {
+	return func(cr *x509.CertificateRequest, o *x509util.Options) error {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return errors.Wrapf(err, "error reading %s", path)
+		}
+		return withX509Template(string(b), data)(cr, o)
+	}
+}
+
+// withSSHTemplate is an sshutil.Option that behaves like sshutil.WithTemplate
+// but uses the cache of compiled templates.
+func withSSHTemplate(text string, data sshutil.TemplateData) sshutil.Option {
+	return func(cr sshutil.CertificateRequest, o *sshutil.Options) error {
+		data.SetCertificateRequest(cr)
+		buf, failMessage, err := sshTemplateCache.execute(text, data)
+		switch {
+		case failMessage != "":
+			return &sshutil.TemplateError{Message: failMessage}
+		case err != nil:
+			return err
+		}
+		o.CertBuffer = buf
+		return nil
+	}
+}
+
+// withSSHTemplateBase64 is an sshutil.Option that behaves like
+// sshutil.WithTemplateBase64 but uses the cache of compiled templates.
+func withSSHTemplateBase64(s string, data sshutil.TemplateData) sshutil.Option {
+	return func(cr sshutil.CertificateRequest, o *sshutil.Options) error {
+		b, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			return errors.Wrap(err, "error decoding template")
+		}
+		return withSSHTemplate(string(b), data)(cr, o)
+	}
+}
+
+// withSSHTemplateFile is an sshutil.Option that behaves like
+// sshutil.WithTemplateFile but uses the cache of compiled templates.
+func withSSHTemplateFile(path string, data sshutil.TemplateData) sshutil.Option {
+	return func(cr sshutil.CertificateRequest, o *sshutil.Options) error {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return errors.Wrapf(err, "error reading %s", path)
+		}
+		return withSSHTemplate(string(b), data)(cr, o)
+	}
+}
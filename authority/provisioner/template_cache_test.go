@@ -0,0 +1,80 @@
+package provisioner
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.step.sm/crypto/sshutil"
+	"go.step.sm/crypto/x509util"
+)
+
+func Test_templateCache_get(t *testing.T) {
+	c := newTemplateCache(x509util.GetFuncMap)
+
+	t1, err := c.get(`{"subject": {{ toJson .Subject }}}`)
+	require.NoError(t, err)
+	t2, err := c.get(`{"subject": {{ toJson .Subject }}}`)
+	require.NoError(t, err)
+	assert.Same(t, t1, t2)
+	assert.Len(t, c.templates, 1)
+
+	_, err = c.get(`{{ fail }`)
+	assert.Error(t, err)
+	assert.Len(t, c.templates, 1)
+
+	c.reset()
+	assert.Empty(t, c.templates)
+	t3, err := c.get(`{"subject": {{ toJson .Subject }}}`)
+	require.NoError(t, err)
+	assert.NotSame(t, t1, t3)
+}
+
+func Test_withX509Template(t *testing.T) {
+	cr := &x509.CertificateRequest{Subject: pkix.Name{CommonName: "foo"}}
+	data := x509util.NewTemplateData()
+	data.SetCommonName("foo")
+
+	tests := []struct {
+		name      string
+		fn        x509util.Option
+		want      string
+		assertion assert.ErrorAssertionFunc
+	}{
+		{"ok", withX509Template(`{"subject": {{ toJson .Subject }}}`, data), `{"subject": {"commonName":"foo"}}`, assert.NoError},
+		{"ok/base64", withX509TemplateBase64(base64.StdEncoding.EncodeToString([]byte(`{"cn": "{{ .Insecure.CR.Subject.CommonName }}"}`)), data), `{"cn": "foo"}`, assert.NoError},
+		{"ok/file", withX509TemplateFile("./testdata/templates/cr.tpl", data), "", assert.NoError},
+		{"fail/fail", withX509Template(`{{ fail "not allowed" }}`, data), "", func(tt assert.TestingT, err error, i ...interface{}) bool {
+			return assert.EqualError(tt, err, "not allowed") && assert.IsType(tt, &x509util.TemplateError{}, err)
+		}},
+		{"fail/parse", withX509Template(`{{ foo }}`, data), "", assert.Error},
+		{"fail/base64", withX509TemplateBase64("%%%", data), "", assert.Error},
+		{"fail/file", withX509TemplateFile("./testdata/templates/missing.tpl", data), "", assert.Error},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var o x509util.Options
+			err := tt.fn(cr, &o)
+			tt.assertion(t, err)
+			if err == nil && tt.want != "" {
+				assert.Equal(t, tt.want, o.CertBuffer.String())
+			}
+		})
+	}
+}
+
+func Test_withSSHTemplate(t *testing.T) {
+	cr := sshutil.CertificateRequest{KeyID: "foo"}
+	data := sshutil.CreateTemplateData(sshutil.UserCert, "foo", []string{"foo"})
+
+	var o sshutil.Options
+	require.NoError(t, withSSHTemplate(`{"keyId": "{{ .Insecure.CR.KeyID }}"}`, data)(cr, &o))
+	assert.Equal(t, `{"keyId": "foo"}`, o.CertBuffer.String())
+
+	err := withSSHTemplate(`{{ fail "not allowed" }}`, data)(cr, &o)
+	assert.EqualError(t, err, "not allowed")
+	assert.IsType(t, &sshutil.TemplateError{}, err)
+}
@@ -0,0 +1,490 @@
+package provisioner
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/google/go-tpm/legacy/tpm2"
+	"github.com/pkg/errors"
+	"github.com/smallstep/go-attestation/attest"
+
+	"go.step.sm/crypto/jose"
+	"go.step.sm/crypto/x509util"
+	"go.step.sm/linkedca"
+
+	"github.com/smallstep/certificates/errs"
+	"github.com/smallstep/certificates/webhook"
+)
+
+// TPMHeader is the name of the token header that contains the TPM attestation
+// of the key used to sign the token.
+const TPMHeader = "tpm"
+
+var (
+	oidExtensionSubjectAltName   = asn1.ObjectIdentifier{2, 5, 29, 17}
+	oidExtensionExtendedKeyUsage = asn1.ObjectIdentifier{2, 5, 29, 37}
+	oidTCGKpAIKCertificate       = asn1.ObjectIdentifier{2, 23, 133, 8, 3}
+)
+
+// tpmAttestation is the content of the "tpm" header of a TPM token. The binary
+// fields are encoded using standard base64.
+type tpmAttestation struct {
+	// AKChain is the certificate chain of the attestation key, starting with
+	// the AK certificate.
+	AKChain [][]byte `json:"akChain"`
+	// EKChain is the certificate chain of the endorsement key, starting with
+	// the EK certificate.
+	EKChain [][]byte `json:"ekChain,omitempty"`
+	// Public is the TPMT_PUBLIC structure of the attested key.
+	Public []byte `json:"pubArea"`
+	// CertInfo is the TPMS_ATTEST structure generated by TPM2_Certify.
+	CertInfo []byte `json:"certInfo"`
+	// Signature is the TPMT_SIGNATURE of the AK over CertInfo.
+	Signature []byte `json:"sig"`
+}
+
+// tpmPayload extends jwt.Claims with the attested key and certificates.
+type tpmPayload struct {
+	jose.Claims
+	permanentIdentifier string
+	key                 crypto.PublicKey
+	akCert              *x509.Certificate
+	ekCert              *x509.Certificate
+}
+
+// TPMDevice is a provisioner that authorizes the issuance of X.509
+// certificates to keys that are bound to a TPM, so machines can enroll
+// identities tied to their hardware without using ACME.
+//
+// A TPM token is a JWT signed with the attested key, with the attestation in
+// the "tpm" header. The attestation key (AK) certificate chain must be signed
+// by one of the AttestationRoots, usually an attestation CA that has verified
+// the endorsement key (EK) of the TPM, and the AK must certify that the key
+// signing the token was created by the TPM and cannot be exported. If EKRoots
+// is set, the EK certificate chain of the TPM is also required, it must be
+// signed by one of the EKRoots, and its TPM hardware details must match the
+// ones in the AK certificate.
+//
+// The subject of the token must be the permanent identifier in the AK
+// certificate, the certificate is issued for that identifier and the key in
+// the certificate request must be the attested key.
+type TPMDevice struct {
+	*base
+	ID               string   `json:"-"`
+	Type             string   `json:"type"`
+	Name             string   `json:"name"`
+	AttestationRoots []byte   `json:"attestationRoots"`
+	EKRoots          []byte   `json:"ekRoots,omitempty"`
+	Claims           *Claims  `json:"claims,omitempty"`
+	Options          *Options `json:"options,omitempty"`
+	ctl              *Controller
+	attestationPool  *x509.CertPool
+	ekPool           *x509.CertPool
+}
+
+// GetID returns the provisioner unique identifier.
+func (p *TPMDevice) GetID() string {
+	if p.ID != "" {
+		return p.ID
+	}
+	return p.GetIDForToken()
+}
+
+// GetIDForToken returns an identifier that will be used to load the provisioner
+// from a token.
+func (p *TPMDevice) GetIDForToken() string {
+	return "tpm/" + p.Name
+}
+
+// GetTokenID returns the identifier of the token.
+func (p *TPMDevice) GetTokenID(ott string) (string, error) {
+	token, err := jose.ParseSigned(ott)
+	if err != nil {
+		return "", errors.Wrap(err, "error parsing token")
+	}
+	var claims jose.Claims
+	if err = token.UnsafeClaimsWithoutVerification(&claims); err != nil {
+		return "", errors.Wrap(err, "error verifying claims")
+	}
+	return claims.ID, nil
+}
+
+// GetName returns the name of the provisioner.
+func (p *TPMDevice) GetName() string {
+	return p.Name
+}
+
+// GetType returns the type of provisioner.
+func (p *TPMDevice) GetType() Type {
+	return TypeTPM
+}
+
+// GetEncryptedKey returns the base provisioner encrypted key if it's defined.
+func (p *TPMDevice) GetEncryptedKey() (string, string, bool) {
+	return "", "", false
+}
+
+// GetOptions returns the configured provisioner options.
+func (p *TPMDevice) GetOptions() *Options {
+	return p.Options
+}
+
+// Init initializes and validates the fields of a TPMDevice type.
+func (p *TPMDevice) Init(config Config) (err error) {
+	switch {
+	case p.Type == "":
+		return errors.New("provisioner type cannot be empty")
+	case p.Name == "":
+		return errors.New("provisioner name cannot be empty")
+	case len(p.AttestationRoots) == 0:
+		return errors.New("provisioner attestationRoots cannot be empty")
+	}
+
+	if p.attestationPool, err = newTPMCertPool(p.AttestationRoots); err != nil {
+		return errors.Wrap(err, "error parsing attestationRoots")
+	}
+	if len(p.EKRoots) > 0 {
+		if p.ekPool, err = newTPMCertPool(p.EKRoots); err != nil {
+			return errors.Wrap(err, "error parsing ekRoots")
+		}
+	}
+
+	config.Audiences = config.Audiences.WithFragment(p.GetIDForToken())
+	p.ctl, err = NewController(p, p.Claims, config, p.Options)
+	return
+}
+
+// newTPMCertPool returns a pool with the certificates in the given PEM bundle.
+func newTPMCertPool(b []byte) (*x509.CertPool, error) {
+	certs, err := parseX5CRoots(b)
+	if err != nil {
+		return nil, err
+	}
+	if len(certs) == 0 {
+		return nil, errors.New("no x509 certificates found")
+	}
+	pool := x509.NewCertPool()
+	for _, crt := range certs {
+		pool.AddCert(crt)
+	}
+	return pool, nil
+}
+
+// authorizeToken verifies the attestation in the token, and the token
+// signature with the attested key, and returns the claims of the token.
+func (p *TPMDevice) authorizeToken(token string, audiences []string) (*tpmPayload, error) {
+	jwt, err := jose.ParseSigned(token)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusUnauthorized, err, "tpm.authorizeToken; error parsing tpm token")
+	}
+	if len(jwt.Headers) == 0 {
+		return nil, errs.Unauthorized("tpm.authorizeToken; tpm token missing headers")
+	}
+	att, err := extractTPMAttestation(jwt)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusUnauthorized, err, "tpm.authorizeToken; error extracting tpm header from token")
+	}
+
+	var claims tpmPayload
+	if claims.akCert, err = p.verifyAKChain(att.AKChain); err != nil {
+		return nil, errs.Wrap(http.StatusUnauthorized, err, "tpm.authorizeToken; error verifying AK certificate")
+	}
+	if claims.key, err = verifyTPMKeyCertification(att, claims.akCert.PublicKey); err != nil {
+		return nil, errs.Wrap(http.StatusUnauthorized, err, "tpm.authorizeToken; error verifying key attestation")
+	}
+	if p.ekPool != nil {
+		if claims.ekCert, err = p.verifyEKChain(att.EKChain, claims.akCert); err != nil {
+			return nil, errs.Wrap(http.StatusUnauthorized, err, "tpm.authorizeToken; error verifying EK certificate")
+		}
+	}
+
+	// Using the attested key to validate the claims asserts that the token
+	// has been signed by the TPM.
+	if err = jwt.Claims(claims.key, &claims.Claims); err != nil {
+		return nil, errs.Wrap(http.StatusUnauthorized, err, "tpm.authorizeToken; error parsing tpm claims")
+	}
+
+	if err = claims.ValidateWithLeeway(jose.Expected{
+		Issuer: p.Name,
+		Time:   time.Now().UTC(),
+	}, time.Minute); err != nil {
+		return nil, errs.Wrapf(http.StatusUnauthorized, err, "tpm.authorizeToken; invalid tpm claims")
+	}
+	if !matchesAudience(claims.Audience, audiences) {
+		return nil, errs.Unauthorized("tpm.authorizeToken; invalid tpm token audience claim (aud); want %s, but got %s",
+			audiences, claims.Audience)
+	}
+	if claims.ID == "" {
+		return nil, errs.Unauthorized("tpm.authorizeToken; tpm token must contain a jti claim")
+	}
+
+	sans, err := x509util.ParseSubjectAlternativeNames(claims.akCert)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusUnauthorized, err, "tpm.authorizeToken; error parsing AK certificate SANs")
+	}
+	for _, pi := range sans.PermanentIdentifiers {
+		if pi.Identifier == claims.Subject {
+			claims.permanentIdentifier = pi.Identifier
+			break
+		}
+	}
+	if claims.permanentIdentifier == "" {
+		return nil, errs.Unauthorized("tpm.authorizeToken; tpm token subject %q does not match the AK certificate permanent identifier", claims.Subject)
+	}
+	return &claims, nil
+}
+
+// verifyAKChain verifies the AK certificate chain with the attestation roots
+// and returns the AK certificate.
+func (p *TPMDevice) verifyAKChain(chain [][]byte) (*x509.Certificate, error) {
+	akCert, err := verifyTPMChain(chain, p.attestationPool)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateTPMAKCertificate(akCert); err != nil {
+		return nil, err
+	}
+	return akCert, nil
+}
+
+// verifyEKChain verifies the EK certificate chain with the EK roots and
+// returns the EK certificate. The TPM hardware details in the EK certificate
+// must match the ones in the AK certificate.
+func (p *TPMDevice) verifyEKChain(chain [][]byte, akCert *x509.Certificate) (*x509.Certificate, error) {
+	ekCert, err := verifyTPMChain(chain, p.ekPool)
+	if err != nil {
+		return nil, err
+	}
+	ekSANs, err := x509util.ParseSubjectAlternativeNames(ekCert)
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing EK certificate SANs")
+	}
+	akSANs, err := x509util.ParseSubjectAlternativeNames(akCert)
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing AK certificate SANs")
+	}
+	if ekSANs.TPMHardwareDetails != akSANs.TPMHardwareDetails {
+		return nil, errors.New("EK certificate TPM details do not match the AK certificate")
+	}
+	return ekCert, nil
+}
+
+// verifyTPMChain verifies the given DER certificate chain with the roots in
+// the pool and returns the leaf.
+func verifyTPMChain(chain [][]byte, roots *x509.CertPool) (*x509.Certificate, error) {
+	if len(chain) == 0 {
+		return nil, errors.New("certificate chain is empty")
+	}
+	certs := make([]*x509.Certificate, len(chain))
+	for i, der := range chain {
+		crt, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, errors.Wrap(err, "error parsing certificate chain")
+		}
+		certs[i] = crt
+	}
+
+	// TPM certificates with an empty subject have a critical Subject
+	// Alternative Name extension with the TPM details, that is not handled by
+	// the standard library.
+	leaf := certs[0]
+	if len(leaf.UnhandledCriticalExtensions) > 0 {
+		unhandled := leaf.UnhandledCriticalExtensions[:0]
+		for _, oid := range leaf.UnhandledCriticalExtensions {
+			if !oid.Equal(oidExtensionSubjectAltName) {
+				unhandled = append(unhandled, oid)
+			}
+		}
+		leaf.UnhandledCriticalExtensions = unhandled
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, crt := range certs[1:] {
+		intermediates.AddCert(crt)
+	}
+	if _, err := leaf.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   time.Now().Truncate(time.Second),
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}); err != nil {
+		return nil, err
+	}
+	return leaf, nil
+}
+
+// validateTPMAKCertificate validates the requirements of an AK certificate
+// defined in https://www.w3.org/TR/webauthn-2/#sctn-tpm-cert-requirements.
+func validateTPMAKCertificate(c *x509.Certificate) error {
+	switch {
+	case c.Version != 3:
+		return errors.Errorf("AK certificate has invalid version %d; only version 3 is allowed", c.Version)
+	case c.Subject.String() != "":
+		return errors.Errorf("AK certificate subject must be empty; got %q", c.Subject)
+	case c.IsCA:
+		return errors.New("AK certificate must not be a CA")
+	}
+
+	var hasEKU bool
+	for _, ext := range c.Extensions {
+		if ext.Id.Equal(oidExtensionExtendedKeyUsage) {
+			var ekus []asn1.ObjectIdentifier
+			if _, err := asn1.Unmarshal(ext.Value, &ekus); err != nil || len(ekus) == 0 || !ekus[0].Equal(oidTCGKpAIKCertificate) {
+				return errors.New("AK certificate is missing Extended Key Usage value tcg-kp-AIKCertificate (2.23.133.8.3)")
+			}
+			hasEKU = true
+		}
+	}
+	if !hasEKU {
+		return errors.New("AK certificate is missing Extended Key Usage extension")
+	}
+
+	sans, err := x509util.ParseSubjectAlternativeNames(c)
+	if err != nil {
+		return errors.Wrap(err, "error parsing AK certificate SANs")
+	}
+	switch details := sans.TPMHardwareDetails; {
+	case details.Manufacturer == "":
+		return errors.New("missing TPM manufacturer")
+	case details.Model == "":
+		return errors.New("missing TPM model")
+	case details.Version == "":
+		return errors.New("missing TPM version")
+	}
+	return nil
+}
+
+// verifyTPMKeyCertification verifies that the attested key has been created by
+// the TPM, certified by the AK, and returns it.
+func verifyTPMKeyCertification(att *tpmAttestation, akPub crypto.PublicKey) (crypto.PublicKey, error) {
+	if len(att.Public) == 0 || len(att.CertInfo) == 0 || len(att.Signature) == 0 {
+		return nil, errors.New("pubArea, certInfo and sig cannot be empty")
+	}
+	sig, err := tpm2.DecodeSignature(bytes.NewBuffer(att.Signature))
+	if err != nil {
+		return nil, errors.Wrap(err, "error decoding sig")
+	}
+	var hashAlg tpm2.Algorithm
+	switch {
+	case sig.RSA != nil:
+		hashAlg = sig.RSA.HashAlg
+	case sig.ECC != nil:
+		hashAlg = sig.ECC.HashAlg
+	default:
+		return nil, errors.New("sig algorithm is not supported")
+	}
+	hash, err := hashAlg.Hash()
+	if err != nil {
+		return nil, errors.Wrap(err, "sig hash algorithm is not supported")
+	}
+
+	params := &attest.CertificationParameters{
+		Public:            att.Public,
+		CreateAttestation: att.CertInfo,
+		CreateSignature:   att.Signature,
+	}
+	if err := params.Verify(attest.VerifyOpts{
+		Public: akPub,
+		Hash:   hash,
+	}); err != nil {
+		return nil, err
+	}
+
+	pub, err := tpm2.DecodePublic(att.Public)
+	if err != nil {
+		return nil, errors.Wrap(err, "error decoding pubArea")
+	}
+	return pub.Key()
+}
+
+// AuthorizeSign validates the given token and returns the sign options used
+// to issue a certificate for the permanent identifier of the TPM.
+func (p *TPMDevice) AuthorizeSign(_ context.Context, token string) ([]SignOption, error) {
+	if err := p.ctl.AuthorizeIssuance(); err != nil {
+		return nil, err
+	}
+	claims, err := p.authorizeToken(token, p.ctl.Audiences.Sign)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "tpm.AuthorizeSign")
+	}
+
+	data := x509util.CreateTemplateData(claims.permanentIdentifier, nil)
+	data.SetSubjectAlternativeNames(x509util.SubjectAlternativeName{
+		Type:  x509util.PermanentIdentifierType,
+		Value: claims.permanentIdentifier,
+	})
+	if v, err := unsafeParseSigned(token); err == nil {
+		data.SetToken(v)
+	}
+
+	// The AK certificate will be available using the template variable
+	// AuthorizationCrt.
+	data.SetAuthorizationCertificate(claims.akCert)
+
+	templateOptions, err := CustomTemplateOptions(p.Options, data, x509util.DefaultAttestedLeafTemplate)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "tpm.AuthorizeSign")
+	}
+
+	return []SignOption{
+		p,
+		templateOptions,
+		AttestationData{PermanentIdentifier: claims.permanentIdentifier},
+		// modifiers / withOptions
+		newProvisionerExtensionOption(TypeTPM, p.Name, claims.permanentIdentifier).WithControllerOptions(p.ctl),
+		profileDefaultDuration(p.ctl.Claimer.DefaultTLSCertDuration()),
+		// validators
+		tpmPublicKeyValidator{key: claims.key},
+		defaultPublicKeyValidator{keys: p.ctl.Claimer.KeyClaims()},
+		newClaimsValidityValidator(p.ctl.Claimer),
+		newX509NamePolicyValidator(p.ctl.getPolicy().getX509()),
+		p.ctl.newWebhookController(
+			data,
+			linkedca.Webhook_X509,
+			webhook.WithAuthorizationPrincipal(claims.permanentIdentifier),
+		),
+	}, nil
+}
+
+// AuthorizeRenew returns an error if the renewal is disabled.
+func (p *TPMDevice) AuthorizeRenew(ctx context.Context, cert *x509.Certificate) error {
+	return p.ctl.AuthorizeRenew(ctx, cert)
+}
+
+// tpmPublicKeyValidator validates that the key in the certificate request is
+// the attested key.
+type tpmPublicKeyValidator struct {
+	key crypto.PublicKey
+}
+
+// Valid implements the CertificateRequestValidator interface.
+func (v tpmPublicKeyValidator) Valid(cr *x509.CertificateRequest) error {
+	if k, ok := v.key.(interface{ Equal(crypto.PublicKey) bool }); !ok || !k.Equal(cr.PublicKey) {
+		return errs.Forbidden("certificate request public key does not match the attested key")
+	}
+	return nil
+}
+
+// extractTPMAttestation returns the attestation in the "tpm" header of the
+// token.
+func extractTPMAttestation(jwt *jose.JSONWebToken) (*tpmAttestation, error) {
+	v, ok := jwt.Headers[0].ExtraHeaders[TPMHeader]
+	if !ok {
+		return nil, errors.New("token missing tpm header")
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, errors.Wrap(err, "error marshaling tpm header")
+	}
+	var att tpmAttestation
+	if err := json.Unmarshal(b, &att); err != nil {
+		return nil, errors.Wrap(err, "tpm header is not valid")
+	}
+	return &att, nil
+}
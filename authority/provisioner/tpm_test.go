@@ -0,0 +1,355 @@
+package provisioner
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/go-tpm/legacy/tpm2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.step.sm/crypto/jose"
+	"go.step.sm/crypto/minica"
+	"go.step.sm/crypto/x509util"
+
+	"github.com/smallstep/certificates/api/render"
+)
+
+var (
+	oidTPMManufacturer = asn1.ObjectIdentifier{2, 23, 133, 2, 1}
+	oidTPMModel        = asn1.ObjectIdentifier{2, 23, 133, 2, 2}
+	oidTPMVersion      = asn1.ObjectIdentifier{2, 23, 133, 2, 3}
+)
+
+// tpmTestDevice contains the keys and certificates of a fake TPM.
+type tpmTestDevice struct {
+	ca     *minica.CA
+	ekCA   *minica.CA
+	key    *ecdsa.PrivateKey
+	att    *tpmAttestation
+	akCert *x509.Certificate
+}
+
+// newTPMTestCertificate returns a certificate with an empty subject and the
+// TPM details in the SANs, like AK and EK certificates.
+func newTPMTestCertificate(t *testing.T, ca *minica.CA, pub crypto.PublicKey, model, permanentIdentifier string, ekus ...asn1.ObjectIdentifier) *x509.Certificate {
+	t.Helper()
+	dirName, err := x509util.SubjectAlternativeName{
+		Type: x509util.DirectoryNameType,
+		ASN1Value: []byte(fmt.Sprintf(`{"extraNames":[{"type": %q, "value": %q},{"type": %q, "value": %q},{"type": %q, "value": %q}]}`,
+			oidTPMManufacturer, "1414747215", oidTPMModel, model, oidTPMVersion, "7.55")),
+	}.RawValue()
+	require.NoError(t, err)
+	values := []asn1.RawValue{dirName}
+	if permanentIdentifier != "" {
+		pi, err := x509util.SubjectAlternativeName{
+			Type:  x509util.PermanentIdentifierType,
+			Value: permanentIdentifier,
+		}.RawValue()
+		require.NoError(t, err)
+		values = append(values, pi)
+	}
+	sans, err := asn1.Marshal(values)
+	require.NoError(t, err)
+
+	crt, err := ca.Sign(&x509.Certificate{
+		PublicKey:          pub,
+		UnknownExtKeyUsage: ekus,
+		ExtraExtensions: []pkix.Extension{
+			{Id: oidExtensionSubjectAltName, Critical: true, Value: sans},
+		},
+	})
+	require.NoError(t, err)
+	return crt
+}
+
+// newTPMTestDevice creates the certification of an ECDSA key by an RSA AK in
+// the same way a TPM does it.
+func newTPMTestDevice(t *testing.T, permanentIdentifier string) *tpmTestDevice {
+	t.Helper()
+	ca, err := minica.New(minica.WithName("Attestation"))
+	require.NoError(t, err)
+	ekCA, err := minica.New(minica.WithName("TPM Manufacturer"))
+	require.NoError(t, err)
+
+	ak, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ek, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	akCert := newTPMTestCertificate(t, ca, ak.Public(), "SLB 9670 TPM2.0", permanentIdentifier, oidTCGKpAIKCertificate)
+	ekCert := newTPMTestCertificate(t, ekCA, ek.Public(), "SLB 9670 TPM2.0", "")
+
+	pub := tpm2.Public{
+		Type:       tpm2.AlgECC,
+		NameAlg:    tpm2.AlgSHA256,
+		Attributes: tpm2.FlagFixedTPM | tpm2.FlagFixedParent | tpm2.FlagSensitiveDataOrigin | tpm2.FlagUserWithAuth | tpm2.FlagSign,
+		ECCParameters: &tpm2.ECCParams{
+			Sign:    &tpm2.SigScheme{Alg: tpm2.AlgECDSA, Hash: tpm2.AlgSHA256},
+			CurveID: tpm2.CurveNISTP256,
+			Point: tpm2.ECPoint{
+				XRaw: key.X.FillBytes(make([]byte, 32)),
+				YRaw: key.Y.FillBytes(make([]byte, 32)),
+			},
+		},
+	}
+	pubArea, err := pub.Encode()
+	require.NoError(t, err)
+	name, err := pub.Name()
+	require.NoError(t, err)
+
+	certInfo, err := tpm2.AttestationData{
+		Magic:               0xff544347,
+		Type:                tpm2.TagAttestCertify,
+		QualifiedSigner:     name,
+		AttestedCertifyInfo: &tpm2.CertifyInfo{Name: name, QualifiedName: name},
+	}.Encode()
+	require.NoError(t, err)
+	digest := sha256.Sum256(certInfo)
+	rsaSig, err := rsa.SignPKCS1v15(rand.Reader, ak, crypto.SHA256, digest[:])
+	require.NoError(t, err)
+	sig, err := tpm2.Signature{
+		Alg: tpm2.AlgRSASSA,
+		RSA: &tpm2.SignatureRSA{HashAlg: tpm2.AlgSHA256, Signature: rsaSig},
+	}.Encode()
+	require.NoError(t, err)
+
+	return &tpmTestDevice{
+		ca:   ca,
+		ekCA: ekCA,
+		key:  key,
+		att: &tpmAttestation{
+			AKChain:   [][]byte{akCert.Raw, ca.Intermediate.Raw},
+			EKChain:   [][]byte{ekCert.Raw, ekCA.Intermediate.Raw},
+			Public:    pubArea,
+			CertInfo:  certInfo,
+			Signature: sig,
+		},
+		akCert: akCert,
+	}
+}
+
+func (d *tpmTestDevice) roots() []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: d.ca.Root.Raw})
+}
+
+func (d *tpmTestDevice) ekRoots() []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: d.ekCA.Root.Raw})
+}
+
+func generateTPMToken(t *testing.T, key crypto.Signer, att *tpmAttestation, sub, iss, aud string) string {
+	t.Helper()
+	now := time.Now()
+	payload, err := json.Marshal(jose.Claims{
+		ID:        "the-jti",
+		Subject:   sub,
+		Issuer:    iss,
+		IssuedAt:  jose.NewNumericDate(now),
+		NotBefore: jose.NewNumericDate(now),
+		Expiry:    jose.NewNumericDate(now.Add(5 * time.Minute)),
+		Audience:  []string{aud},
+	})
+	require.NoError(t, err)
+
+	so := new(jose.SignerOptions)
+	so.WithType("JWT")
+	so.WithHeader(TPMHeader, att)
+	sig, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.ES256, Key: key}, so)
+	require.NoError(t, err)
+	jws, err := sig.Sign(payload)
+	require.NoError(t, err)
+	tok, err := jws.CompactSerialize()
+	require.NoError(t, err)
+	return tok
+}
+
+func generateTPMDevice(t *testing.T, d *tpmTestDevice) *TPMDevice {
+	t.Helper()
+	p := &TPMDevice{
+		Type:             "TPM",
+		Name:             "tpm",
+		AttestationRoots: d.roots(),
+	}
+	require.NoError(t, p.Init(Config{Claims: globalProvisionerClaims, Audiences: testAudiences}))
+	return p
+}
+
+func TestTPMDevice_Getters(t *testing.T) {
+	p := generateTPMDevice(t, newTPMTestDevice(t, "device-1234"))
+	assert.Equal(t, "tpm/tpm", p.GetID())
+	assert.Equal(t, "tpm/tpm", p.GetIDForToken())
+	assert.Equal(t, "tpm", p.GetName())
+	assert.Equal(t, TypeTPM, p.GetType())
+	assert.Equal(t, "TPM", p.GetType().String())
+	kid, key, ok := p.GetEncryptedKey()
+	assert.Empty(t, kid)
+	assert.Empty(t, key)
+	assert.False(t, ok)
+}
+
+func TestTPMDevice_Init(t *testing.T) {
+	d := newTPMTestDevice(t, "device-1234")
+	config := Config{Claims: globalProvisionerClaims, Audiences: testAudiences}
+	tests := []struct {
+		name    string
+		p       *TPMDevice
+		wantErr bool
+	}{
+		{"ok", &TPMDevice{Type: "TPM", Name: "tpm", AttestationRoots: d.roots()}, false},
+		{"ok ekRoots", &TPMDevice{Type: "TPM", Name: "tpm", AttestationRoots: d.roots(), EKRoots: d.ekRoots()}, false},
+		{"fail type", &TPMDevice{Name: "tpm", AttestationRoots: d.roots()}, true},
+		{"fail name", &TPMDevice{Type: "TPM", AttestationRoots: d.roots()}, true},
+		{"fail attestationRoots", &TPMDevice{Type: "TPM", Name: "tpm"}, true},
+		{"fail attestationRoots parse", &TPMDevice{Type: "TPM", Name: "tpm", AttestationRoots: []byte("foo")}, true},
+		{"fail ekRoots parse", &TPMDevice{Type: "TPM", Name: "tpm", AttestationRoots: d.roots(), EKRoots: []byte("foo")}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.p.Init(config)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestTPMDevice_authorizeToken(t *testing.T) {
+	d := newTPMTestDevice(t, "device-1234")
+	p := generateTPMDevice(t, d)
+	aud := p.ctl.Audiences.Sign[0]
+
+	other := newTPMTestDevice(t, "device-1234")
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	withAtt := func(fn func(att *tpmAttestation)) *tpmAttestation {
+		att := *d.att
+		fn(&att)
+		return &att
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr bool
+	}{
+		{"ok", generateTPMToken(t, d.key, d.att, "device-1234", p.Name, aud), false},
+		{"fail token", "foo", true},
+		{"fail no header", generateTPMToken(t, d.key, nil, "device-1234", p.Name, aud), true},
+		{"fail untrusted AK", generateTPMToken(t, other.key, other.att, "device-1234", p.Name, aud), true},
+		{"fail empty AK chain", generateTPMToken(t, d.key, withAtt(func(att *tpmAttestation) {
+			att.AKChain = nil
+		}), "device-1234", p.Name, aud), true},
+		{"fail AK certification", generateTPMToken(t, d.key, withAtt(func(att *tpmAttestation) {
+			att.Signature = other.att.Signature
+		}), "device-1234", p.Name, aud), true},
+		{"fail other key", generateTPMToken(t, otherKey, d.att, "device-1234", p.Name, aud), true},
+		{"fail subject", generateTPMToken(t, d.key, d.att, "device-5678", p.Name, aud), true},
+		{"fail issuer", generateTPMToken(t, d.key, d.att, "device-1234", "foo", aud), true},
+		{"fail audience", generateTPMToken(t, d.key, d.att, "device-1234", p.Name, "foo"), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := p.authorizeToken(tt.token, p.ctl.Audiences.Sign)
+			if tt.wantErr {
+				var sc render.StatusCodedError
+				require.ErrorAs(t, err, &sc)
+				assert.Equal(t, http.StatusUnauthorized, sc.StatusCode())
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "device-1234", got.permanentIdentifier)
+			assert.Equal(t, d.akCert.Raw, got.akCert.Raw)
+			assert.True(t, d.key.PublicKey.Equal(got.key))
+		})
+	}
+}
+
+func TestTPMDevice_authorizeToken_ekRoots(t *testing.T) {
+	d := newTPMTestDevice(t, "device-1234")
+	p := &TPMDevice{
+		Type:             "TPM",
+		Name:             "tpm",
+		AttestationRoots: d.roots(),
+		EKRoots:          d.ekRoots(),
+	}
+	require.NoError(t, p.Init(Config{Claims: globalProvisionerClaims, Audiences: testAudiences}))
+	aud := p.ctl.Audiences.Sign[0]
+
+	ek, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	otherModel := newTPMTestCertificate(t, d.ekCA, ek.Public(), "ST33TPHF2ESPI", "")
+
+	got, err := p.authorizeToken(generateTPMToken(t, d.key, d.att, "device-1234", p.Name, aud), p.ctl.Audiences.Sign)
+	require.NoError(t, err)
+	assert.Equal(t, d.att.EKChain[0], got.ekCert.Raw)
+
+	att := *d.att
+	att.EKChain = nil
+	_, err = p.authorizeToken(generateTPMToken(t, d.key, &att, "device-1234", p.Name, aud), p.ctl.Audiences.Sign)
+	assert.Error(t, err)
+
+	att.EKChain = [][]byte{otherModel.Raw, d.ekCA.Intermediate.Raw}
+	_, err = p.authorizeToken(generateTPMToken(t, d.key, &att, "device-1234", p.Name, aud), p.ctl.Audiences.Sign)
+	assert.Error(t, err)
+
+	att.EKChain = d.att.AKChain
+	_, err = p.authorizeToken(generateTPMToken(t, d.key, &att, "device-1234", p.Name, aud), p.ctl.Audiences.Sign)
+	assert.Error(t, err)
+}
+
+func TestTPMDevice_AuthorizeSign(t *testing.T) {
+	d := newTPMTestDevice(t, "device-1234")
+	p := generateTPMDevice(t, d)
+	aud := p.ctl.Audiences.Sign[0]
+
+	opts, err := p.AuthorizeSign(context.Background(), generateTPMToken(t, d.key, d.att, "device-1234", p.Name, aud))
+	require.NoError(t, err)
+	assert.Len(t, opts, 10)
+
+	var validator tpmPublicKeyValidator
+	for _, o := range opts {
+		switch v := o.(type) {
+		case AttestationData:
+			assert.Equal(t, "device-1234", v.PermanentIdentifier)
+		case tpmPublicKeyValidator:
+			validator = v
+		}
+	}
+
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	assert.NoError(t, validator.Valid(&x509.CertificateRequest{PublicKey: d.key.Public()}))
+	assert.Error(t, validator.Valid(&x509.CertificateRequest{PublicKey: otherKey.Public()}))
+
+	_, err = p.AuthorizeSign(context.Background(), "foo")
+	assert.Error(t, err)
+}
+
+func TestTPMDevice_AuthorizeRenew(t *testing.T) {
+	p := generateTPMDevice(t, newTPMTestDevice(t, "device-1234"))
+	now := time.Now().Truncate(time.Second)
+	assert.NoError(t, p.AuthorizeRenew(context.Background(), &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    now,
+		NotAfter:     now.Add(time.Hour),
+	}))
+}
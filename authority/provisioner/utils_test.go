@@ -1047,6 +1047,14 @@ func generateAzureToken(sub, iss, aud, tenantID, subscriptionID, resourceGroup,
 		xmsMirID = fmt.Sprintf("/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Compute/virtualMachines/%s", subscriptionID, resourceGroup, resourceName)
 	} else if resourceType == "uai" {
 		xmsMirID = fmt.Sprintf("/subscriptions/%s/resourceGroups/%s/providers/Microsoft.ManagedIdentity/userAssignedIdentities/%s", subscriptionID, resourceGroup, resourceName)
+	} else if resourceType == "vmss" {
+		xmsMirID = fmt.Sprintf("/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Compute/virtualMachineScaleSets/%s", subscriptionID, resourceGroup, resourceName)
+	} else if resourceType == "arc" {
+		xmsMirID = fmt.Sprintf("/subscriptions/%s/resourcegroups/%s/providers/Microsoft.HybridCompute/machines/%s", subscriptionID, resourceGroup, resourceName)
+	} else if resourceType == "app" {
+		xmsMirID = fmt.Sprintf("/subscriptions/%s/resourcegroups/%s/providers/Microsoft.Web/sites/%s", subscriptionID, resourceGroup, resourceName)
+	} else if resourceType == "slot" {
+		xmsMirID = fmt.Sprintf("/subscriptions/%s/resourcegroups/%s/providers/Microsoft.Web/sites/%s/slots/staging", subscriptionID, resourceGroup, resourceName)
 	}
 
 	claims := azurePayload{
@@ -0,0 +1,160 @@
+package provisioner
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+	"go.step.sm/crypto/x509util"
+)
+
+// VPN profiles supported by the VPNOptions.
+const (
+	// VPNProfileEAPTLS is the profile used to issue client certificates for
+	// EAP-TLS authentication, e.g. 802.1X Wi-Fi and wired networks.
+	VPNProfileEAPTLS = "eap-tls"
+	// VPNProfileIKEv2 is the profile used to issue certificates for IKEv2
+	// IPsec VPN gateways and clients.
+	VPNProfileIKEv2 = "ikev2"
+)
+
+// DefaultEAPTLSLeafTemplate is the template used by default to issue EAP-TLS
+// client certificates.
+const DefaultEAPTLSLeafTemplate = `{
+	"subject": {{ toJson .Subject }},
+	"sans": {{ toJson .SANs }},
+{{- if typeIs "*rsa.PublicKey" .Insecure.CR.PublicKey }}
+	"keyUsage": ["keyEncipherment", "digitalSignature"],
+{{- else }}
+	"keyUsage": ["digitalSignature"],
+{{- end }}
+	"extKeyUsage": ["clientAuth"]
+}`
+
+// DefaultIKEv2LeafTemplate is the template used by default to issue IKEv2
+// certificates. Besides the serverAuth and clientAuth extended key usages, it
+// includes the id-kp-ipsecIKE key purpose defined in RFC 4945 and the IP
+// security IKE intermediate key purpose required by Windows clients.
+const DefaultIKEv2LeafTemplate = `{
+	"subject": {{ toJson .Subject }},
+	"sans": {{ toJson .SANs }},
+{{- if typeIs "*rsa.PublicKey" .Insecure.CR.PublicKey }}
+	"keyUsage": ["keyEncipherment", "digitalSignature"],
+{{- else }}
+	"keyUsage": ["digitalSignature"],
+{{- end }}
+	"extKeyUsage": ["serverAuth", "clientAuth"],
+	"unknownExtKeyUsage": ["1.3.6.1.5.5.7.3.17", "1.3.6.1.5.5.8.2.2"]
+}`
+
+// VPNOptions contains the options used to issue VPN and Wi-Fi authentication
+// certificates.
+type VPNOptions struct {
+	// Profile is the VPN profile to use, eap-tls or ikev2. Defaults to
+	// eap-tls.
+	Profile string `json:"profile,omitempty"`
+
+	// UPNSuffix, if set, adds a user principal name subject alternative name
+	// to the certificate, built from the common name and this suffix, e.g.
+	// "jane@corp.example.com" for the common name "jane" and the suffix
+	// "corp.example.com".
+	UPNSuffix string `json:"upnSuffix,omitempty"`
+}
+
+// GetVPNOptions returns the VPN options.
+func (o *Options) GetVPNOptions() *VPNOptions {
+	if o == nil {
+		return nil
+	}
+	return o.VPN
+}
+
+// Validate returns an error if the VPN options are not valid.
+func (o *VPNOptions) Validate() error {
+	if o == nil {
+		return nil
+	}
+	switch strings.ToLower(o.Profile) {
+	case "", VPNProfileEAPTLS, VPNProfileIKEv2:
+	default:
+		return fmt.Errorf("vpn profile %q is not supported", o.Profile)
+	}
+	if o.UPNSuffix != "" {
+		if strings.ContainsAny(o.UPNSuffix, "@ \t") {
+			return fmt.Errorf("vpn upnSuffix %q is not valid", o.UPNSuffix)
+		}
+	}
+	return nil
+}
+
+// template returns the default template of the configured profile.
+func (o *VPNOptions) template() string {
+	if strings.EqualFold(o.Profile, VPNProfileIKEv2) {
+		return DefaultIKEv2LeafTemplate
+	}
+	return DefaultEAPTLSLeafTemplate
+}
+
+// setTemplateData adds the user principal name to the subject alternative
+// names in the template data if a UPN suffix is configured. It returns an
+// error if the common name cannot be used as a user principal name with the
+// configured suffix.
+func (o *VPNOptions) setTemplateData(data x509util.TemplateData) error {
+	if o.UPNSuffix == "" {
+		return nil
+	}
+	subject, _ := data[x509util.SubjectKey].(x509util.Subject)
+	if subject.CommonName == "" {
+		return nil
+	}
+	upn, err := NewUserPrincipalName(subject.CommonName, o.UPNSuffix)
+	if err != nil {
+		return err
+	}
+	sans, _ := data[x509util.SANsKey].([]x509util.SubjectAlternativeName)
+	for _, san := range sans {
+		if san.Type == upn.Type && strings.EqualFold(san.Value, upn.Value) {
+			return nil
+		}
+	}
+	data.SetSubjectAlternativeNames(append(sans, upn)...)
+	return nil
+}
+
+// NewUserPrincipalName returns a user principal name subject alternative name
+// for the given user and suffix. If the user already contains a suffix, it
+// must be equal to the given one, a user cannot choose the domain of the
+// account the certificate will be mapped to.
+func NewUserPrincipalName(user, suffix string) (x509util.SubjectAlternativeName, error) {
+	value := user
+	if _, userSuffix, ok := strings.Cut(user, "@"); ok {
+		if suffix != "" && !strings.EqualFold(userSuffix, suffix) {
+			return x509util.SubjectAlternativeName{}, errors.Errorf("user principal name %q does not match the suffix %q", user, suffix)
+		}
+	} else {
+		if suffix == "" {
+			return x509util.SubjectAlternativeName{}, errors.Errorf("user principal name %q does not have a suffix", user)
+		}
+		value = user + "@" + suffix
+	}
+	if err := validateUserPrincipalName(value); err != nil {
+		return x509util.SubjectAlternativeName{}, err
+	}
+	return x509util.SubjectAlternativeName{
+		Type:  x509util.UserPrincipalNameType,
+		Value: value,
+	}, nil
+}
+
+func validateUserPrincipalName(upn string) error {
+	name, suffix, ok := strings.Cut(upn, "@")
+	switch {
+	case !ok || name == "" || suffix == "" || strings.Contains(suffix, "@"):
+		return errors.Errorf("user principal name %q is not valid", upn)
+	case !utf8.ValidString(upn) || strings.ContainsAny(upn, " \t\r\n"):
+		return errors.Errorf("user principal name %q is not valid", upn)
+	default:
+		return nil
+	}
+}
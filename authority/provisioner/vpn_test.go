@@ -0,0 +1,66 @@
+package provisioner
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.step.sm/crypto/x509util"
+)
+
+func TestVPNOptions_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		options *VPNOptions
+		wantErr bool
+	}{
+		{"ok/nil", nil, false},
+		{"ok/empty", &VPNOptions{}, false},
+		{"ok/eap-tls", &VPNOptions{Profile: "eap-tls", UPNSuffix: "corp.example.com"}, false},
+		{"ok/ikev2", &VPNOptions{Profile: "IKEv2"}, false},
+		{"fail/profile", &VPNOptions{Profile: "openvpn"}, true},
+		{"fail/upnSuffix", &VPNOptions{UPNSuffix: "@corp.example.com"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.options.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("VPNOptions.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNewUserPrincipalName(t *testing.T) {
+	tests := []struct {
+		name      string
+		user      string
+		suffix    string
+		want      x509util.SubjectAlternativeName
+		assertion assert.ErrorAssertionFunc
+	}{
+		{"ok", "jane", "corp.example.com", x509util.SubjectAlternativeName{
+			Type: x509util.UserPrincipalNameType, Value: "jane@corp.example.com",
+		}, assert.NoError},
+		{"ok/with-suffix", "jane@corp.example.com", "corp.example.com", x509util.SubjectAlternativeName{
+			Type: x509util.UserPrincipalNameType, Value: "jane@corp.example.com",
+		}, assert.NoError},
+		{"ok/with-suffix-case", "jane@CORP.example.com", "corp.example.com", x509util.SubjectAlternativeName{
+			Type: x509util.UserPrincipalNameType, Value: "jane@CORP.example.com",
+		}, assert.NoError},
+		{"ok/with-suffix-no-config", "jane@example.com", "", x509util.SubjectAlternativeName{
+			Type: x509util.UserPrincipalNameType, Value: "jane@example.com",
+		}, assert.NoError},
+		{"fail/other-suffix", "administrator@corp.example", "corp.example.com", x509util.SubjectAlternativeName{}, assert.Error},
+		{"fail/sub-suffix", "administrator@evil.corp.example.com", "corp.example.com", x509util.SubjectAlternativeName{}, assert.Error},
+		{"fail/double-at", "administrator@corp.example@corp.example.com", "corp.example.com", x509util.SubjectAlternativeName{}, assert.Error},
+		{"fail/no-suffix", "jane", "", x509util.SubjectAlternativeName{}, assert.Error},
+		{"fail/spaces", "jane doe", "corp.example.com", x509util.SubjectAlternativeName{}, assert.Error},
+		{"fail/empty-name", "@corp.example.com", "", x509util.SubjectAlternativeName{}, assert.Error},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewUserPrincipalName(tt.user, tt.suffix)
+			tt.assertion(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,654 @@
+package provisioner
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"go.step.sm/crypto/jose"
+	"go.step.sm/crypto/sshutil"
+	"go.step.sm/crypto/x509util"
+	"go.step.sm/linkedca"
+
+	"github.com/smallstep/certificates/errs"
+)
+
+// WebAuthnHeader is the name of the token header that contains the WebAuthn
+// assertion.
+const WebAuthnHeader = "webauthn"
+
+// WebAuthn authenticator data flags.
+const (
+	webAuthnFlagUserPresent  = 0x01
+	webAuthnFlagUserVerified = 0x04
+)
+
+// WebAuthnCredential is a public key credential registered for a user of a
+// WebAuthn provisioner.
+type WebAuthnCredential struct {
+	// ID is the base64url encoded credential id.
+	ID string `json:"id"`
+	// ProvisionerID is the id of the provisioner the credential is registered
+	// with.
+	ProvisionerID string `json:"provisionerID,omitempty"`
+	// Subject is the user the credential belongs to. It is also used as the
+	// default name in certificates.
+	Subject string `json:"subject"`
+	// Principals are other names, besides the subject, that the user can
+	// request in a certificate.
+	Principals []string `json:"principals,omitempty"`
+	// PublicKey is the credential public key in PKIX, ASN.1 DER form, as
+	// returned by AuthenticatorAttestationResponse.getPublicKey().
+	PublicKey []byte `json:"publicKey"`
+	// SignCount is the signature counter of the last assertion made with the
+	// credential. Authenticators that do not implement a counter always
+	// report 0.
+	SignCount uint32 `json:"signCount,omitempty"`
+	// CreatedAt is the time the credential was registered.
+	CreatedAt time.Time `json:"createdAt,omitempty"`
+}
+
+// Validate validates the credential attributes.
+func (c *WebAuthnCredential) Validate() error {
+	switch {
+	case c.ID == "":
+		return errors.New("credential id cannot be empty")
+	case c.Subject == "":
+		return errors.New("credential subject cannot be empty")
+	case len(c.PublicKey) == 0:
+		return errors.New("credential publicKey cannot be empty")
+	}
+	if _, err := base64.RawURLEncoding.DecodeString(c.ID); err != nil {
+		return errors.Wrap(err, "credential id is not base64url encoded")
+	}
+	if _, err := parseWebAuthnPublicKey(c.PublicKey); err != nil {
+		return err
+	}
+	return nil
+}
+
+// CheckSignCount returns an error if the given signature counter does not
+// increase the one stored in the credential. A counter that does not increase
+// is a signal that the authenticator might have been cloned. Counters are
+// ignored if both are 0.
+func (c *WebAuthnCredential) CheckSignCount(signCount uint32) error {
+	if (signCount != 0 || c.SignCount != 0) && signCount <= c.SignCount {
+		return errors.Errorf("authenticatorData signCount %d is not greater than %d, the authenticator might be cloned", signCount, c.SignCount)
+	}
+	return nil
+}
+
+// GetWebAuthnCredentialFunc is a function that returns the WebAuthn credential
+// with the given id registered for the given provisioner.
+type GetWebAuthnCredentialFunc func(ctx context.Context, p Interface, credentialID string) (*WebAuthnCredential, error)
+
+// UpdateWebAuthnSignCountFunc is a function that stores the signature counter
+// of a WebAuthn credential registered for the given provisioner. It must fail
+// if the counter does not increase the stored one.
+type UpdateWebAuthnSignCountFunc func(ctx context.Context, p Interface, credentialID string, signCount uint32) error
+
+// webAuthnAssertion is the content of the webauthn header. All the fields are
+// base64url encoded.
+type webAuthnAssertion struct {
+	CredentialID      string `json:"credentialId"`
+	AuthenticatorData string `json:"authenticatorData"`
+	ClientDataJSON    string `json:"clientDataJSON"`
+	Signature         string `json:"signature"`
+}
+
+type webAuthnClientData struct {
+	Type      string `json:"type"`
+	Challenge string `json:"challenge"`
+	Origin    string `json:"origin"`
+}
+
+// webAuthnPayload extends jwtPayload with the credential used to sign the
+// token.
+type webAuthnPayload struct {
+	jwtPayload
+	credential *WebAuthnCredential
+}
+
+// WebAuthn is a provisioner that authorizes the issuance of certificates to
+// users that prove the possession of a WebAuthn credential, like a security
+// key or a passkey.
+//
+// A WebAuthn token is a JWT signed by an ephemeral key included in the "jwk"
+// header. The "webauthn" header contains a WebAuthn assertion for a challenge
+// that is the base64url encoded SHA-256 digest of the token payload.
+type WebAuthn struct {
+	*base
+	ID   string `json:"-"`
+	Type string `json:"type"`
+	Name string `json:"name"`
+	// RPID is the WebAuthn relying party id, the domain name used to register
+	// the credentials.
+	RPID string `json:"rpID"`
+	// Origins is the list of origins allowed in the client data. It defaults
+	// to https://<rpID>.
+	Origins []string `json:"origins,omitempty"`
+	// DisableUserVerification allows assertions without the user verified
+	// flag.
+	DisableUserVerification bool `json:"disableUserVerification,omitempty"`
+	// Credentials is a list of credentials defined in the configuration.
+	// Credentials can also be registered using the admin API.
+	Credentials     []*WebAuthnCredential `json:"credentials,omitempty"`
+	Claims          *Claims               `json:"claims,omitempty"`
+	Options         *Options              `json:"options,omitempty"`
+	ctl             *Controller
+	rpIDHash        [32]byte
+	getCredential   GetWebAuthnCredentialFunc
+	updateSignCount UpdateWebAuthnSignCountFunc
+	signCountMutex  sync.Mutex
+}
+
+// GetID returns the provisioner unique identifier.
+func (p *WebAuthn) GetID() string {
+	if p.ID != "" {
+		return p.ID
+	}
+	return p.GetIDForToken()
+}
+
+// GetIDForToken returns an identifier that will be used to load the provisioner
+// from a token.
+func (p *WebAuthn) GetIDForToken() string {
+	return "webauthn/" + p.Name
+}
+
+// GetTokenID returns the identifier of the token.
+func (p *WebAuthn) GetTokenID(ott string) (string, error) {
+	token, err := jose.ParseSigned(ott)
+	if err != nil {
+		return "", errors.Wrap(err, "error parsing token")
+	}
+	var claims jose.Claims
+	if err = token.UnsafeClaimsWithoutVerification(&claims); err != nil {
+		return "", errors.Wrap(err, "error verifying claims")
+	}
+	return claims.ID, nil
+}
+
+// GetName returns the name of the provisioner.
+func (p *WebAuthn) GetName() string {
+	return p.Name
+}
+
+// GetType returns the type of provisioner.
+func (p *WebAuthn) GetType() Type {
+	return TypeWebAuthn
+}
+
+// GetEncryptedKey returns the base provisioner encrypted key if it's defined.
+func (p *WebAuthn) GetEncryptedKey() (string, string, bool) {
+	return "", "", false
+}
+
+// GetOptions returns the configured provisioner options.
+func (p *WebAuthn) GetOptions() *Options {
+	return p.Options
+}
+
+// Init initializes and validates the fields of a WebAuthn type.
+func (p *WebAuthn) Init(config Config) (err error) {
+	switch {
+	case p.Type == "":
+		return errors.New("provisioner type cannot be empty")
+	case p.Name == "":
+		return errors.New("provisioner name cannot be empty")
+	case p.RPID == "":
+		return errors.New("provisioner rpID cannot be empty")
+	}
+	for _, c := range p.Credentials {
+		if err := c.Validate(); err != nil {
+			return errors.Wrapf(err, "provisioner %s has an invalid credential", p.Name)
+		}
+	}
+	if len(p.Origins) == 0 {
+		p.Origins = []string{"https://" + p.RPID}
+	}
+
+	p.rpIDHash = sha256.Sum256([]byte(p.RPID))
+	p.getCredential = config.GetWebAuthnCredentialFunc
+	p.updateSignCount = config.UpdateWebAuthnSignCountFunc
+
+	config.Audiences = config.Audiences.WithFragment(p.GetIDForToken())
+	p.ctl, err = NewController(p, p.Claims, config, p.Options)
+	return
+}
+
+// loadCredential returns the credential with the given id. Credentials in the
+// configuration take precedence over the registered ones.
+func (p *WebAuthn) loadCredential(ctx context.Context, id string) (*WebAuthnCredential, error) {
+	if c := p.configCredential(id); c != nil {
+		p.signCountMutex.Lock()
+		defer p.signCountMutex.Unlock()
+		cred := *c
+		return &cred, nil
+	}
+	if p.getCredential == nil {
+		return nil, errors.Errorf("credential %s not found", id)
+	}
+	return p.getCredential(ctx, p, id)
+}
+
+// configCredential returns the credential with the given id defined in the
+// configuration.
+func (p *WebAuthn) configCredential(id string) *WebAuthnCredential {
+	for _, c := range p.Credentials {
+		if c.ID == id {
+			return c
+		}
+	}
+	return nil
+}
+
+// storeSignCount stores the signature counter of the given credential. The
+// counters of the credentials in the configuration are only kept in memory.
+func (p *WebAuthn) storeSignCount(ctx context.Context, cred *WebAuthnCredential, signCount uint32) error {
+	if signCount == 0 && cred.SignCount == 0 {
+		return nil
+	}
+	if c := p.configCredential(cred.ID); c != nil {
+		p.signCountMutex.Lock()
+		defer p.signCountMutex.Unlock()
+		if err := c.CheckSignCount(signCount); err != nil {
+			return err
+		}
+		c.SignCount = signCount
+		return nil
+	}
+	if p.updateSignCount == nil {
+		return nil
+	}
+	return p.updateSignCount(ctx, p, cred.ID, signCount)
+}
+
+// authorizeToken performs common jwt authorization actions and returns the
+// claims for case specific downstream parsing.
+func (p *WebAuthn) authorizeToken(ctx context.Context, token string, audiences []string) (*webAuthnPayload, error) {
+	jwt, err := jose.ParseSigned(token)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusUnauthorized, err, "webauthn.authorizeToken; error parsing webauthn token")
+	}
+	if len(jwt.Headers) == 0 || jwt.Headers[0].JSONWebKey == nil {
+		return nil, errs.Unauthorized("webauthn.authorizeToken; webauthn token missing jwk header")
+	}
+	assertion, err := extractWebAuthnAssertion(jwt)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusUnauthorized, err, "webauthn.authorizeToken; error extracting webauthn header from token")
+	}
+
+	// The token signature binds the ephemeral key to the payload, the
+	// WebAuthn assertion binds the payload to the credential.
+	var claims webAuthnPayload
+	if err = jwt.Claims(jwt.Headers[0].JSONWebKey, &claims.jwtPayload); err != nil {
+		return nil, errs.Wrap(http.StatusUnauthorized, err, "webauthn.authorizeToken; error parsing webauthn claims")
+	}
+	payload, err := unsafeTokenPayload(token)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusUnauthorized, err, "webauthn.authorizeToken; error parsing webauthn token")
+	}
+
+	cred, err := p.loadCredential(ctx, assertion.CredentialID)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusUnauthorized, err, "webauthn.authorizeToken; error loading webauthn credential")
+	}
+	signCount, err := p.verifyAssertion(assertion, cred, payload)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusUnauthorized, err, "webauthn.authorizeToken; error verifying webauthn assertion")
+	}
+
+	// According to "rfc7519 JSON Web Token" acceptable skew should be no
+	// more than a few minutes.
+	if err = claims.ValidateWithLeeway(jose.Expected{
+		Issuer: p.Name,
+		Time:   time.Now().UTC(),
+	}, time.Minute); err != nil {
+		return nil, errs.Wrapf(http.StatusUnauthorized, err, "webauthn.authorizeToken; invalid webauthn claims")
+	}
+
+	// validate audiences with the defaults
+	if !matchesAudience(claims.Audience, audiences) {
+		return nil, errs.Unauthorized("webauthn.authorizeToken; invalid webauthn token audience claim (aud); want %s, but got %s",
+			audiences, claims.Audience)
+	}
+
+	if claims.Subject != cred.Subject {
+		return nil, errs.Unauthorized("webauthn.authorizeToken; webauthn token subject does not match the credential subject")
+	}
+
+	// The counter is stored after all the validations, it fails if another
+	// request has used the same or a greater counter.
+	if err := p.storeSignCount(ctx, cred, signCount); err != nil {
+		return nil, errs.Wrap(http.StatusUnauthorized, err, "webauthn.authorizeToken; error storing webauthn signCount")
+	}
+	cred.SignCount = signCount
+
+	claims.credential = cred
+	return &claims, nil
+}
+
+// verifyAssertion verifies the WebAuthn assertion as described in the section
+// 7.2 of the Web Authentication Level 2 specification and returns the
+// signature counter of the assertion.
+func (p *WebAuthn) verifyAssertion(a *webAuthnAssertion, cred *WebAuthnCredential, payload []byte) (uint32, error) {
+	authData, err := base64.RawURLEncoding.DecodeString(a.AuthenticatorData)
+	if err != nil {
+		return 0, errors.Wrap(err, "error decoding authenticatorData")
+	}
+	clientDataJSON, err := base64.RawURLEncoding.DecodeString(a.ClientDataJSON)
+	if err != nil {
+		return 0, errors.Wrap(err, "error decoding clientDataJSON")
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(a.Signature)
+	if err != nil {
+		return 0, errors.Wrap(err, "error decoding signature")
+	}
+
+	var clientData webAuthnClientData
+	if err := json.Unmarshal(clientDataJSON, &clientData); err != nil {
+		return 0, errors.Wrap(err, "error unmarshaling clientDataJSON")
+	}
+	if clientData.Type != "webauthn.get" {
+		return 0, errors.Errorf("unexpected client data type %q", clientData.Type)
+	}
+	sum := sha256.Sum256(payload)
+	challenge := base64.RawURLEncoding.EncodeToString(sum[:])
+	if subtle.ConstantTimeCompare([]byte(clientData.Challenge), []byte(challenge)) != 1 {
+		return 0, errors.New("client data challenge does not match the token payload")
+	}
+	if !containsString(p.Origins, clientData.Origin) {
+		return 0, errors.Errorf("client data origin %q is not allowed", clientData.Origin)
+	}
+
+	// authenticatorData is rpIdHash (32) || flags (1) || signCount (4) || ...
+	if len(authData) < 37 {
+		return 0, errors.New("authenticatorData is too short")
+	}
+	if !bytes.Equal(authData[:32], p.rpIDHash[:]) {
+		return 0, errors.New("authenticatorData rpIdHash does not match the provisioner rpID")
+	}
+	flags := authData[32]
+	if flags&webAuthnFlagUserPresent == 0 {
+		return 0, errors.New("authenticatorData user present flag is not set")
+	}
+	if !p.DisableUserVerification && flags&webAuthnFlagUserVerified == 0 {
+		return 0, errors.New("authenticatorData user verified flag is not set")
+	}
+
+	pub, err := parseWebAuthnPublicKey(cred.PublicKey)
+	if err != nil {
+		return 0, err
+	}
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	signed := make([]byte, 0, len(authData)+len(clientDataHash))
+	signed = append(signed, authData...)
+	signed = append(signed, clientDataHash[:]...)
+	if err := verifyWebAuthnSignature(pub, signed, sig); err != nil {
+		return 0, err
+	}
+
+	signCount := binary.BigEndian.Uint32(authData[33:37])
+	if err := cred.CheckSignCount(signCount); err != nil {
+		return 0, err
+	}
+	return signCount, nil
+}
+
+// AuthorizeRevoke returns an error if the provisioner does not have rights to
+// revoke the certificate with serial number in the `sub` property.
+func (p *WebAuthn) AuthorizeRevoke(ctx context.Context, token string) error {
+	_, err := p.authorizeToken(ctx, token, p.ctl.Audiences.Revoke)
+	return errs.Wrap(http.StatusInternalServerError, err, "webauthn.AuthorizeRevoke")
+}
+
+// AuthorizeSign validates the given token.
+func (p *WebAuthn) AuthorizeSign(ctx context.Context, token string) ([]SignOption, error) {
+	if err := p.ctl.AuthorizeIssuance(); err != nil {
+		return nil, err
+	}
+	claims, err := p.authorizeToken(ctx, token, p.ctl.Audiences.Sign)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "webauthn.AuthorizeSign")
+	}
+
+	if len(claims.SANs) == 0 {
+		claims.SANs = []string{claims.Subject}
+	}
+	if err := claims.credential.authorizeNames(claims.SANs); err != nil {
+		return nil, errs.Wrap(http.StatusUnauthorized, err, "webauthn.AuthorizeSign")
+	}
+
+	// Certificate templates
+	data := x509util.CreateTemplateData(claims.Subject, claims.SANs)
+	if v, err := unsafeParseSigned(token); err == nil {
+		data.SetToken(v)
+	}
+
+	templateOptions, err := TemplateOptions(p.Options, data)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "webauthn.AuthorizeSign")
+	}
+
+	// Check the fingerprint of the certificate request if given.
+	var fingerprint string
+	if claims.Confirmation != nil {
+		fingerprint = claims.Confirmation.Fingerprint
+	}
+
+	return []SignOption{
+		p,
+		templateOptions,
+		// modifiers / withOptions
+		newProvisionerExtensionOption(TypeWebAuthn, p.Name, claims.credential.ID).WithControllerOptions(p.ctl),
+		profileDefaultDuration(p.ctl.Claimer.DefaultTLSCertDuration()),
+		// validators
+		csrFingerprintValidator(fingerprint),
+		commonNameSliceValidator(append([]string{claims.Subject}, claims.SANs...)),
+		defaultPublicKeyValidator{keys: p.ctl.Claimer.KeyClaims()},
+		newDefaultSANsValidator(ctx, claims.SANs),
+		newClaimsValidityValidator(p.ctl.Claimer),
+		newX509NamePolicyValidator(p.ctl.getPolicy().getX509()),
+		p.ctl.newWebhookController(data, linkedca.Webhook_X509),
+	}, nil
+}
+
+// AuthorizeRenew returns an error if the renewal is disabled.
+func (p *WebAuthn) AuthorizeRenew(ctx context.Context, cert *x509.Certificate) error {
+	return p.ctl.AuthorizeRenew(ctx, cert)
+}
+
+// AuthorizeSSHSign returns the list of SignOption for a SignSSH request. Only
+// user certificates can be signed by a WebAuthn provisioner.
+func (p *WebAuthn) AuthorizeSSHSign(ctx context.Context, token string) ([]SignOption, error) {
+	if err := p.ctl.AuthorizeIssuance(); err != nil {
+		return nil, err
+	}
+	if !p.ctl.Claimer.IsSSHCAEnabled() {
+		return nil, errs.Unauthorized("webauthn.AuthorizeSSHSign; sshCA is disabled for webauthn provisioner '%s'", p.GetName())
+	}
+	claims, err := p.authorizeToken(ctx, token, p.ctl.Audiences.SSHSign)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "webauthn.AuthorizeSSHSign")
+	}
+	if claims.Step == nil || claims.Step.SSH == nil {
+		return nil, errs.Unauthorized("webauthn.AuthorizeSSHSign; webauthn token must be an SSH provisioning token")
+	}
+
+	opts := claims.Step.SSH
+	if opts.CertType != "" && opts.CertType != SSHUserCert {
+		return nil, errs.Forbidden("webauthn.AuthorizeSSHSign; webauthn provisioner can only sign user certificates")
+	}
+	principals := []string{claims.Subject}
+	if len(opts.Principals) > 0 {
+		principals = opts.Principals
+	}
+	if err := claims.credential.authorizeNames(principals); err != nil {
+		return nil, errs.Wrap(http.StatusUnauthorized, err, "webauthn.AuthorizeSSHSign")
+	}
+
+	signOptions := []SignOption{
+		// validates user's SignSSHOptions with the ones in the token
+		sshCertOptionsValidator(*opts),
+		// validate users's KeyID is the token subject.
+		sshCertOptionsValidator(SignSSHOptions{KeyID: claims.Subject}),
+	}
+
+	// Certificate templates.
+	data := sshutil.CreateTemplateData(sshutil.UserCert, claims.Subject, principals)
+	if v, err := unsafeParseSigned(token); err == nil {
+		data.SetToken(v)
+	}
+
+	templateOptions, err := TemplateSSHOptions(p.Options, data)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "webauthn.AuthorizeSSHSign")
+	}
+	signOptions = append(signOptions, templateOptions)
+
+	// Add modifiers from custom claims
+	t := now()
+	if !opts.ValidAfter.IsZero() {
+		signOptions = append(signOptions, sshCertValidAfterModifier(opts.ValidAfter.RelativeTime(t).Unix()))
+	}
+	if !opts.ValidBefore.IsZero() {
+		signOptions = append(signOptions, sshCertValidBeforeModifier(opts.ValidBefore.RelativeTime(t).Unix()))
+	}
+
+	return append(signOptions,
+		p,
+		// Set the validity bounds if not set.
+		&sshDefaultDuration{p.ctl.Claimer},
+		// Validate public key
+		&sshDefaultPublicKeyValidator{keys: p.ctl.Claimer.KeyClaims()},
+		// Validate the validity period.
+		&sshCertValidityValidator{p.ctl.Claimer},
+		// Require and validate all the default fields in the SSH certificate.
+		&sshCertDefaultValidator{},
+		// Ensure that all principal names are allowed
+		newSSHNamePolicyValidator(p.ctl.getPolicy().getSSHHost(), p.ctl.getPolicy().getSSHUser()),
+		// Call webhooks
+		p.ctl.newWebhookController(data, linkedca.Webhook_SSH),
+	), nil
+}
+
+// AuthorizeSSHRevoke returns nil if the token is valid, false otherwise.
+func (p *WebAuthn) AuthorizeSSHRevoke(ctx context.Context, token string) error {
+	_, err := p.authorizeToken(ctx, token, p.ctl.Audiences.SSHRevoke)
+	return errs.Wrap(http.StatusInternalServerError, err, "webauthn.AuthorizeSSHRevoke")
+}
+
+// authorizeNames returns an error if any of the given names is not the
+// credential subject or one of its principals.
+func (c *WebAuthnCredential) authorizeNames(names []string) error {
+	for _, name := range names {
+		if name != c.Subject && !containsString(c.Principals, name) {
+			return errors.Errorf("name %q is not allowed for credential subject %s", name, c.Subject)
+		}
+	}
+	return nil
+}
+
+func extractWebAuthnAssertion(jwt *jose.JSONWebToken) (*webAuthnAssertion, error) {
+	v, ok := jwt.Headers[0].ExtraHeaders[WebAuthnHeader]
+	if !ok {
+		return nil, errors.New("token missing webauthn header")
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, errors.Wrap(err, "error marshaling webauthn header")
+	}
+	var a webAuthnAssertion
+	if err := json.Unmarshal(b, &a); err != nil {
+		return nil, errors.Wrap(err, "error unmarshaling webauthn header")
+	}
+	if a.CredentialID == "" || a.AuthenticatorData == "" || a.ClientDataJSON == "" || a.Signature == "" {
+		return nil, errors.New("webauthn header is missing required fields")
+	}
+	return &a, nil
+}
+
+// unsafeTokenPayload returns the decoded payload of a compact serialized
+// token.
+func unsafeTokenPayload(token string) ([]byte, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("token is not in compact serialization")
+	}
+	return base64.RawURLEncoding.DecodeString(parts[1])
+}
+
+func parseWebAuthnPublicKey(der []byte) (crypto.PublicKey, error) {
+	pub, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing credential publicKey")
+	}
+	switch pub.(type) {
+	case *ecdsa.PublicKey, *rsa.PublicKey, ed25519.PublicKey:
+		return pub, nil
+	default:
+		return nil, errors.Errorf("unsupported credential publicKey type %T", pub)
+	}
+}
+
+// verifyWebAuthnSignature verifies the signature of a WebAuthn assertion. It
+// supports the COSE algorithms ES256, ES384, ES512, EdDSA and RS256.
+func verifyWebAuthnSignature(pub crypto.PublicKey, data, sig []byte) error {
+	var ok bool
+	switch k := pub.(type) {
+	case *ecdsa.PublicKey:
+		var digest []byte
+		switch k.Curve {
+		case elliptic.P256():
+			sum := sha256.Sum256(data)
+			digest = sum[:]
+		case elliptic.P384():
+			sum := sha512.Sum384(data)
+			digest = sum[:]
+		case elliptic.P521():
+			sum := sha512.Sum512(data)
+			digest = sum[:]
+		default:
+			return errors.New("unsupported credential publicKey curve")
+		}
+		ok = ecdsa.VerifyASN1(k, digest, sig)
+	case ed25519.PublicKey:
+		ok = ed25519.Verify(k, data, sig)
+	case *rsa.PublicKey:
+		sum := sha256.Sum256(data)
+		ok = rsa.VerifyPKCS1v15(k, crypto.SHA256, sum[:], sig) == nil
+	default:
+		return errors.Errorf("unsupported credential publicKey type %T", pub)
+	}
+	if !ok {
+		return errors.New("invalid webauthn assertion signature")
+	}
+	return nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
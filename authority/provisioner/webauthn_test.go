@@ -0,0 +1,493 @@
+package provisioner
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.step.sm/crypto/jose"
+	"go.step.sm/crypto/randutil"
+
+	"github.com/smallstep/certificates/api/render"
+)
+
+type webAuthnTestAuthenticator struct {
+	credentialID string
+	signer       crypto.Signer
+	rpID         string
+	origin       string
+	flags        byte
+	clientType   string
+	challenge    string
+	// signCount is shared by the copies of the authenticator, it is
+	// incremented in each assertion unless it is 0.
+	signCount *uint32
+}
+
+func newWebAuthnTestAuthenticator(t *testing.T, signer crypto.Signer) *webAuthnTestAuthenticator {
+	t.Helper()
+	id, err := randutil.Alphanumeric(16)
+	require.NoError(t, err)
+	signCount := uint32(1)
+	return &webAuthnTestAuthenticator{
+		credentialID: base64.RawURLEncoding.EncodeToString([]byte(id)),
+		signer:       signer,
+		rpID:         "ca.smallstep.com",
+		origin:       "https://ca.smallstep.com",
+		flags:        webAuthnFlagUserPresent | webAuthnFlagUserVerified,
+		clientType:   "webauthn.get",
+		signCount:    &signCount,
+	}
+}
+
+func (a *webAuthnTestAuthenticator) credential(t *testing.T, subject string, principals ...string) *WebAuthnCredential {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(a.signer.Public())
+	require.NoError(t, err)
+	return &WebAuthnCredential{
+		ID:         a.credentialID,
+		Subject:    subject,
+		Principals: principals,
+		PublicKey:  der,
+	}
+}
+
+// assert returns the webauthn header for the given token payload.
+func (a *webAuthnTestAuthenticator) assert(t *testing.T, payload []byte) map[string]string {
+	t.Helper()
+	sum := sha256.Sum256(payload)
+	challenge := base64.RawURLEncoding.EncodeToString(sum[:])
+	if a.challenge != "" {
+		challenge = a.challenge
+	}
+	clientDataJSON, err := json.Marshal(webAuthnClientData{
+		Type:      a.clientType,
+		Challenge: challenge,
+		Origin:    a.origin,
+	})
+	require.NoError(t, err)
+	rpIDHash := sha256.Sum256([]byte(a.rpID))
+	authData := append(rpIDHash[:], a.flags)
+	authData = binary.BigEndian.AppendUint32(authData, *a.signCount)
+	if *a.signCount > 0 {
+		*a.signCount++
+	}
+
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	signed := append(append([]byte{}, authData...), clientDataHash[:]...)
+	var sig []byte
+	switch k := a.signer.(type) {
+	case *ecdsa.PrivateKey:
+		digest := sha256.Sum256(signed)
+		sig, err = ecdsa.SignASN1(rand.Reader, k, digest[:])
+	case ed25519.PrivateKey:
+		sig = ed25519.Sign(k, signed)
+	case *rsa.PrivateKey:
+		digest := sha256.Sum256(signed)
+		sig, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:])
+	}
+	require.NoError(t, err)
+
+	return map[string]string{
+		"credentialId":      a.credentialID,
+		"authenticatorData": base64.RawURLEncoding.EncodeToString(authData),
+		"clientDataJSON":    base64.RawURLEncoding.EncodeToString(clientDataJSON),
+		"signature":         base64.RawURLEncoding.EncodeToString(sig),
+	}
+}
+
+func generateWebAuthnToken(t *testing.T, a *webAuthnTestAuthenticator, claims any) string {
+	t.Helper()
+	payload, err := json.Marshal(claims)
+	require.NoError(t, err)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	so := new(jose.SignerOptions)
+	so.WithType("JWT")
+	so.WithHeader(WebAuthnHeader, a.assert(t, payload))
+	so.EmbedJWK = true
+	sig, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.ES256, Key: key}, so)
+	require.NoError(t, err)
+	jws, err := sig.Sign(payload)
+	require.NoError(t, err)
+	tok, err := jws.CompactSerialize()
+	require.NoError(t, err)
+	return tok
+}
+
+func webAuthnClaims(sub, iss, aud string, sans []string, sshOpts *SignSSHOptions) *jwtPayload {
+	now := time.Now()
+	claims := &jwtPayload{
+		Claims: jose.Claims{
+			ID:        "the-jti",
+			Subject:   sub,
+			Issuer:    iss,
+			IssuedAt:  jose.NewNumericDate(now),
+			NotBefore: jose.NewNumericDate(now),
+			Expiry:    jose.NewNumericDate(now.Add(5 * time.Minute)),
+			Audience:  []string{aud},
+		},
+		SANs: sans,
+	}
+	if sshOpts != nil {
+		claims.Step = &stepPayload{SSH: sshOpts}
+	}
+	return claims
+}
+
+func generateWebAuthn(t *testing.T, credentials ...*WebAuthnCredential) *WebAuthn {
+	t.Helper()
+	name, err := randutil.Alphanumeric(10)
+	require.NoError(t, err)
+	p := &WebAuthn{
+		Name:        name,
+		Type:        "WebAuthn",
+		RPID:        "ca.smallstep.com",
+		Credentials: credentials,
+	}
+	require.NoError(t, p.Init(Config{
+		Claims:    globalProvisionerClaims,
+		Audiences: testAudiences,
+	}))
+	return p
+}
+
+func TestWebAuthn_Getters(t *testing.T) {
+	p := generateWebAuthn(t)
+	assert.Equal(t, "webauthn/"+p.Name, p.GetID())
+	assert.Equal(t, "webauthn/"+p.Name, p.GetIDForToken())
+	assert.Equal(t, p.Name, p.GetName())
+	assert.Equal(t, TypeWebAuthn, p.GetType())
+	assert.Equal(t, "WebAuthn", p.GetType().String())
+	kid, key, ok := p.GetEncryptedKey()
+	assert.Empty(t, kid)
+	assert.Empty(t, key)
+	assert.False(t, ok)
+	assert.Equal(t, []string{"https://ca.smallstep.com"}, p.Origins)
+	assert.Equal(t, []string{"https://ca.smallstep.com/1.0/sign#webauthn/" + p.Name}, p.ctl.Audiences.Sign[:1])
+}
+
+func TestWebAuthn_Init(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	cred := newWebAuthnTestAuthenticator(t, key).credential(t, "jane@smallstep.com")
+
+	config := Config{Claims: globalProvisionerClaims, Audiences: testAudiences}
+	tests := []struct {
+		name    string
+		p       *WebAuthn
+		wantErr bool
+	}{
+		{"ok", &WebAuthn{Type: "WebAuthn", Name: "webauthn", RPID: "ca.smallstep.com"}, false},
+		{"ok/credentials", &WebAuthn{Type: "WebAuthn", Name: "webauthn", RPID: "ca.smallstep.com", Credentials: []*WebAuthnCredential{cred}}, false},
+		{"fail/type", &WebAuthn{Name: "webauthn", RPID: "ca.smallstep.com"}, true},
+		{"fail/name", &WebAuthn{Type: "WebAuthn", RPID: "ca.smallstep.com"}, true},
+		{"fail/rpID", &WebAuthn{Type: "WebAuthn", Name: "webauthn"}, true},
+		{"fail/credential-id", &WebAuthn{Type: "WebAuthn", Name: "webauthn", RPID: "ca.smallstep.com", Credentials: []*WebAuthnCredential{
+			{ID: "not+base64url", Subject: cred.Subject, PublicKey: cred.PublicKey},
+		}}, true},
+		{"fail/credential-key", &WebAuthn{Type: "WebAuthn", Name: "webauthn", RPID: "ca.smallstep.com", Credentials: []*WebAuthnCredential{
+			{ID: cred.ID, Subject: cred.Subject, PublicKey: []byte("foo")},
+		}}, true},
+		{"fail/credential-subject", &WebAuthn{Type: "WebAuthn", Name: "webauthn", RPID: "ca.smallstep.com", Credentials: []*WebAuthnCredential{
+			{ID: cred.ID, PublicKey: cred.PublicKey},
+		}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.p.Init(config)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestWebAuthn_authorizeToken(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	ec := newWebAuthnTestAuthenticator(t, ecKey)
+	ed := newWebAuthnTestAuthenticator(t, edKey)
+	rsaAuth := newWebAuthnTestAuthenticator(t, rsaKey)
+	registered := newWebAuthnTestAuthenticator(t, ecKey)
+	unknown := newWebAuthnTestAuthenticator(t, ecKey)
+
+	p := generateWebAuthn(t, ec.credential(t, "jane@smallstep.com"), ed.credential(t, "jane@smallstep.com"), rsaAuth.credential(t, "jane@smallstep.com"))
+	p.getCredential = func(_ context.Context, _ Interface, id string) (*WebAuthnCredential, error) {
+		if id == registered.credentialID {
+			return registered.credential(t, "joe@smallstep.com"), nil
+		}
+		return nil, errors.New("not found")
+	}
+	aud := p.ctl.Audiences.Sign[0]
+
+	modified := func(fn func(a *webAuthnTestAuthenticator)) *webAuthnTestAuthenticator {
+		a := *ec
+		fn(&a)
+		return &a
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		wantSub string
+		wantErr bool
+	}{
+		{"ok/ecdsa", generateWebAuthnToken(t, ec, webAuthnClaims("jane@smallstep.com", p.Name, aud, nil, nil)), "jane@smallstep.com", false},
+		{"ok/ed25519", generateWebAuthnToken(t, ed, webAuthnClaims("jane@smallstep.com", p.Name, aud, nil, nil)), "jane@smallstep.com", false},
+		{"ok/rsa", generateWebAuthnToken(t, rsaAuth, webAuthnClaims("jane@smallstep.com", p.Name, aud, nil, nil)), "jane@smallstep.com", false},
+		{"ok/registered", generateWebAuthnToken(t, registered, webAuthnClaims("joe@smallstep.com", p.Name, aud, nil, nil)), "joe@smallstep.com", false},
+		{"fail/token", "foo", "", true},
+		{"fail/unknown-credential", generateWebAuthnToken(t, unknown, webAuthnClaims("jane@smallstep.com", p.Name, aud, nil, nil)), "", true},
+		{"fail/subject", generateWebAuthnToken(t, ec, webAuthnClaims("joe@smallstep.com", p.Name, aud, nil, nil)), "", true},
+		{"fail/issuer", generateWebAuthnToken(t, ec, webAuthnClaims("jane@smallstep.com", "foo", aud, nil, nil)), "", true},
+		{"fail/audience", generateWebAuthnToken(t, ec, webAuthnClaims("jane@smallstep.com", p.Name, "foo", nil, nil)), "", true},
+		{"fail/type", generateWebAuthnToken(t, modified(func(a *webAuthnTestAuthenticator) { a.clientType = "webauthn.create" }), webAuthnClaims("jane@smallstep.com", p.Name, aud, nil, nil)), "", true},
+		{"fail/challenge", generateWebAuthnToken(t, modified(func(a *webAuthnTestAuthenticator) { a.challenge = "foo" }), webAuthnClaims("jane@smallstep.com", p.Name, aud, nil, nil)), "", true},
+		{"fail/origin", generateWebAuthnToken(t, modified(func(a *webAuthnTestAuthenticator) { a.origin = "https://evil.com" }), webAuthnClaims("jane@smallstep.com", p.Name, aud, nil, nil)), "", true},
+		{"fail/rpID", generateWebAuthnToken(t, modified(func(a *webAuthnTestAuthenticator) { a.rpID = "evil.com" }), webAuthnClaims("jane@smallstep.com", p.Name, aud, nil, nil)), "", true},
+		{"fail/user-present", generateWebAuthnToken(t, modified(func(a *webAuthnTestAuthenticator) { a.flags = webAuthnFlagUserVerified }), webAuthnClaims("jane@smallstep.com", p.Name, aud, nil, nil)), "", true},
+		{"fail/user-verified", generateWebAuthnToken(t, modified(func(a *webAuthnTestAuthenticator) { a.flags = webAuthnFlagUserPresent }), webAuthnClaims("jane@smallstep.com", p.Name, aud, nil, nil)), "", true},
+		{"fail/signature", generateWebAuthnToken(t, modified(func(a *webAuthnTestAuthenticator) { a.signer = rsaKey }), webAuthnClaims("jane@smallstep.com", p.Name, aud, nil, nil)), "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := p.authorizeToken(context.Background(), tt.token, p.ctl.Audiences.Sign)
+			if tt.wantErr {
+				var sc render.StatusCodedError
+				require.True(t, errors.As(err, &sc))
+				assert.Equal(t, http.StatusUnauthorized, sc.StatusCode())
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantSub, got.Subject)
+			assert.Equal(t, tt.wantSub, got.credential.Subject)
+		})
+	}
+
+	// User verification can be disabled.
+	p.DisableUserVerification = true
+	_, err = p.authorizeToken(context.Background(), generateWebAuthnToken(t, modified(func(a *webAuthnTestAuthenticator) {
+		a.flags = webAuthnFlagUserPresent
+	}), webAuthnClaims("jane@smallstep.com", p.Name, aud, nil, nil)), p.ctl.Audiences.Sign)
+	assert.NoError(t, err)
+}
+
+func TestWebAuthn_authorizeToken_signCount(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	withSignCount := func(a *webAuthnTestAuthenticator, n uint32) *webAuthnTestAuthenticator {
+		b := *a
+		b.signCount = &n
+		return &b
+	}
+
+	t.Run("config", func(t *testing.T) {
+		a := newWebAuthnTestAuthenticator(t, key)
+		p := generateWebAuthn(t, a.credential(t, "jane"))
+		aud := p.ctl.Audiences.Sign[0]
+
+		tok := generateWebAuthnToken(t, withSignCount(a, 10), webAuthnClaims("jane", p.Name, aud, nil, nil))
+		got, err := p.authorizeToken(ctx, tok, p.ctl.Audiences.Sign)
+		require.NoError(t, err)
+		assert.Equal(t, uint32(10), got.credential.SignCount)
+		assert.Equal(t, uint32(10), p.Credentials[0].SignCount)
+
+		// Replayed, equal and decreasing counters.
+		_, err = p.authorizeToken(ctx, tok, p.ctl.Audiences.Sign)
+		assert.Error(t, err)
+		_, err = p.authorizeToken(ctx, generateWebAuthnToken(t, withSignCount(a, 10), webAuthnClaims("jane", p.Name, aud, nil, nil)), p.ctl.Audiences.Sign)
+		assert.Error(t, err)
+		_, err = p.authorizeToken(ctx, generateWebAuthnToken(t, withSignCount(a, 5), webAuthnClaims("jane", p.Name, aud, nil, nil)), p.ctl.Audiences.Sign)
+		assert.Error(t, err)
+		_, err = p.authorizeToken(ctx, generateWebAuthnToken(t, withSignCount(a, 0), webAuthnClaims("jane", p.Name, aud, nil, nil)), p.ctl.Audiences.Sign)
+		assert.Error(t, err)
+		assert.Equal(t, uint32(10), p.Credentials[0].SignCount)
+
+		_, err = p.authorizeToken(ctx, generateWebAuthnToken(t, withSignCount(a, 11), webAuthnClaims("jane", p.Name, aud, nil, nil)), p.ctl.Audiences.Sign)
+		assert.NoError(t, err)
+		assert.Equal(t, uint32(11), p.Credentials[0].SignCount)
+	})
+
+	t.Run("config/zero", func(t *testing.T) {
+		a := withSignCount(newWebAuthnTestAuthenticator(t, key), 0)
+		p := generateWebAuthn(t, a.credential(t, "jane"))
+		aud := p.ctl.Audiences.Sign[0]
+
+		// Authenticators without a counter always use 0.
+		for i := 0; i < 2; i++ {
+			_, err := p.authorizeToken(ctx, generateWebAuthnToken(t, a, webAuthnClaims("jane", p.Name, aud, nil, nil)), p.ctl.Audiences.Sign)
+			assert.NoError(t, err)
+		}
+		assert.Equal(t, uint32(0), p.Credentials[0].SignCount)
+	})
+
+	t.Run("registered", func(t *testing.T) {
+		a := newWebAuthnTestAuthenticator(t, key)
+		cred := a.credential(t, "jane")
+		cred.SignCount = 10
+		p := generateWebAuthn(t)
+		p.getCredential = func(_ context.Context, _ Interface, id string) (*WebAuthnCredential, error) {
+			c := *cred
+			return &c, nil
+		}
+		var updateErr error
+		p.updateSignCount = func(_ context.Context, _ Interface, id string, signCount uint32) error {
+			if updateErr != nil {
+				return updateErr
+			}
+			assert.Equal(t, cred.ID, id)
+			if err := cred.CheckSignCount(signCount); err != nil {
+				return err
+			}
+			cred.SignCount = signCount
+			return nil
+		}
+		aud := p.ctl.Audiences.Sign[0]
+
+		_, err := p.authorizeToken(ctx, generateWebAuthnToken(t, withSignCount(a, 11), webAuthnClaims("jane", p.Name, aud, nil, nil)), p.ctl.Audiences.Sign)
+		assert.NoError(t, err)
+		assert.Equal(t, uint32(11), cred.SignCount)
+
+		_, err = p.authorizeToken(ctx, generateWebAuthnToken(t, withSignCount(a, 11), webAuthnClaims("jane", p.Name, aud, nil, nil)), p.ctl.Audiences.Sign)
+		assert.Error(t, err)
+
+		// The counter is not increased if the token is not valid.
+		_, err = p.authorizeToken(ctx, generateWebAuthnToken(t, withSignCount(a, 12), webAuthnClaims("joe", p.Name, aud, nil, nil)), p.ctl.Audiences.Sign)
+		assert.Error(t, err)
+		assert.Equal(t, uint32(11), cred.SignCount)
+
+		// Concurrent requests fail in the update.
+		updateErr = errors.New("force")
+		_, err = p.authorizeToken(ctx, generateWebAuthnToken(t, withSignCount(a, 12), webAuthnClaims("jane", p.Name, aud, nil, nil)), p.ctl.Audiences.Sign)
+		assert.Error(t, err)
+	})
+}
+
+func Test_WebAuthnCredential_CheckSignCount(t *testing.T) {
+	tests := []struct {
+		name      string
+		stored    uint32
+		signCount uint32
+		wantErr   bool
+	}{
+		{"ok", 1, 2, false},
+		{"ok/zero", 0, 0, false},
+		{"ok/first", 0, 1, false},
+		{"fail/equal", 2, 2, true},
+		{"fail/decreasing", 2, 1, true},
+		{"fail/zero", 2, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &WebAuthnCredential{SignCount: tt.stored}
+			if tt.wantErr {
+				assert.Error(t, c.CheckSignCount(tt.signCount))
+			} else {
+				assert.NoError(t, c.CheckSignCount(tt.signCount))
+			}
+		})
+	}
+}
+
+func TestWebAuthn_AuthorizeSign(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	a := newWebAuthnTestAuthenticator(t, key)
+	p := generateWebAuthn(t, a.credential(t, "jane", "jane@smallstep.com"))
+	aud := p.ctl.Audiences.Sign[0]
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr bool
+	}{
+		{"ok", generateWebAuthnToken(t, a, webAuthnClaims("jane", p.Name, aud, nil, nil)), false},
+		{"ok/principals", generateWebAuthnToken(t, a, webAuthnClaims("jane", p.Name, aud, []string{"jane", "jane@smallstep.com"}, nil)), false},
+		{"fail/sans", generateWebAuthnToken(t, a, webAuthnClaims("jane", p.Name, aud, []string{"joe@smallstep.com"}, nil)), true},
+		{"fail/token", "foo", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := p.AuthorizeSign(context.Background(), tt.token)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Len(t, got, 11)
+		})
+	}
+}
+
+func TestWebAuthn_AuthorizeSSHSign(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	a := newWebAuthnTestAuthenticator(t, key)
+	p := generateWebAuthn(t, a.credential(t, "jane", "root"))
+	aud := p.ctl.Audiences.SSHSign[0]
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr bool
+	}{
+		{"ok", generateWebAuthnToken(t, a, webAuthnClaims("jane", p.Name, aud, nil, &SignSSHOptions{})), false},
+		{"ok/principals", generateWebAuthnToken(t, a, webAuthnClaims("jane", p.Name, aud, nil, &SignSSHOptions{
+			CertType: "user", Principals: []string{"jane", "root"},
+		})), false},
+		{"fail/host", generateWebAuthnToken(t, a, webAuthnClaims("jane", p.Name, aud, nil, &SignSSHOptions{CertType: "host"})), true},
+		{"fail/principals", generateWebAuthnToken(t, a, webAuthnClaims("jane", p.Name, aud, nil, &SignSSHOptions{
+			Principals: []string{"admin"},
+		})), true},
+		{"fail/not-ssh", generateWebAuthnToken(t, a, webAuthnClaims("jane", p.Name, aud, nil, nil)), true},
+		{"fail/audience", generateWebAuthnToken(t, a, webAuthnClaims("jane", p.Name, p.ctl.Audiences.Sign[0], nil, &SignSSHOptions{})), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := p.AuthorizeSSHSign(context.Background(), tt.token)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestWebAuthn_AuthorizeRevoke(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	a := newWebAuthnTestAuthenticator(t, key)
+	p := generateWebAuthn(t, a.credential(t, "jane"))
+
+	assert.NoError(t, p.AuthorizeRevoke(context.Background(), generateWebAuthnToken(t, a, webAuthnClaims("jane", p.Name, p.ctl.Audiences.Revoke[0], nil, nil))))
+	assert.Error(t, p.AuthorizeRevoke(context.Background(), generateWebAuthnToken(t, a, webAuthnClaims("jane", p.Name, p.ctl.Audiences.Sign[0], nil, nil))))
+	assert.NoError(t, p.AuthorizeSSHRevoke(context.Background(), generateWebAuthnToken(t, a, webAuthnClaims("jane", p.Name, p.ctl.Audiences.SSHRevoke[0], nil, nil))))
+}
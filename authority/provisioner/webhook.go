@@ -11,6 +11,7 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"slices"
 	"text/template"
 	"time"
 
@@ -74,17 +75,30 @@ func (wc *WebhookController) Enrich(ctx context.Context, req *webhook.RequestBod
 
 // Authorize checks that all remote servers allow the request
 func (wc *WebhookController) Authorize(ctx context.Context, req *webhook.RequestBody) error {
+	_, err := wc.AuthorizeSANs(ctx, req)
+	return err
+}
+
+// AuthorizeSANs checks that all remote servers allow the request and returns
+// the SANs allowed by them. If more than one server returns a list of allowed
+// SANs, the intersection of them is returned. A nil slice means that the
+// servers did not restrict the SANs.
+//
+// Errors calling a webhook configured with failOpen are logged and ignored,
+// but an explicit denial is always honored.
+func (wc *WebhookController) AuthorizeSANs(ctx context.Context, req *webhook.RequestBody) ([]string, error) {
 	if wc == nil {
-		return nil
+		return nil, nil
 	}
 
 	// Apply extra options in the webhook controller
 	for _, fn := range wc.options {
 		if err := fn(req); err != nil {
-			return err
+			return nil, err
 		}
 	}
 
+	var allowedSANs []string
 	for _, wh := range wc.webhooks {
 		if wh.Kind != linkedca.Webhook_AUTHORIZING.String() {
 			continue
@@ -98,13 +112,50 @@ func (wc *WebhookController) Authorize(ctx context.Context, req *webhook.Request
 
 		resp, err := wh.DoWithContext(whCtx, wc.client, req, wc.TemplateData)
 		if err != nil {
-			return err
+			if wh.FailOpen {
+				log.Printf("ignoring error calling webhook %s: %v", wh.Name, err)
+				continue
+			}
+			return nil, err
 		}
 		if !resp.Allow {
-			return ErrWebhookDenied
+			return nil, ErrWebhookDenied
+		}
+		if resp.AllowedSANs != nil {
+			allowedSANs = intersectSANs(allowedSANs, resp.AllowedSANs)
 		}
 	}
-	return nil
+	return allowedSANs, nil
+}
+
+// intersectSANs returns the SANs in b that are also in a. A nil a means that
+// all the SANs are allowed. The returned slice is never nil.
+func intersectSANs(a, b []string) []string {
+	if a == nil {
+		return append([]string{}, b...)
+	}
+	ret := []string{}
+	for _, s := range b {
+		if slices.Contains(a, s) {
+			ret = append(ret, s)
+		}
+	}
+	return ret
+}
+
+// NewWebhookController returns a WebhookController for the webhooks in the
+// given options. It is used to call the authorizing webhooks of a provisioner
+// outside the authorization methods, e.g. when a certificate is revoked.
+func NewWebhookController(client *http.Client, options *Options, certType linkedca.Webhook_CertType, opts ...webhook.RequestBodyOption) *WebhookController {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &WebhookController{
+		client:   client,
+		webhooks: options.GetWebhooks(),
+		certType: certType,
+		options:  opts,
+	}
 }
 
 func (wc *WebhookController) isCertTypeOK(wh *Webhook) bool {
@@ -124,9 +175,13 @@ type Webhook struct {
 	Kind                 string `json:"kind"`
 	DisableTLSClientAuth bool   `json:"disableTLSClientAuth,omitempty"`
 	CertType             string `json:"certType"`
-	Secret               string `json:"-"`
-	BearerToken          string `json:"-"`
-	BasicAuth            struct {
+	// FailOpen allows the request if an authorizing webhook cannot be
+	// reached or fails, by default these errors deny the request. This option
+	// is only available in the configuration file.
+	FailOpen    bool   `json:"failOpen,omitempty"`
+	Secret      string `json:"-"`
+	BearerToken string `json:"-"`
+	BasicAuth   struct {
 		Username string
 		Password string
 	} `json:"-"`
@@ -282,6 +282,7 @@ func TestWebhookController_Authorize(t *testing.T) {
 		req           *webhook.RequestBody
 		responses     []*webhook.ResponseBody
 		expectErr     bool
+		expectSANs    []string
 		assertRequest func(t *testing.T, req *webhook.RequestBody)
 	}
 	tests := map[string]test{
@@ -337,6 +338,50 @@ func TestWebhookController_Authorize(t *testing.T) {
 				}, req.X5CCertificate)
 			},
 		},
+		"ok/allowed sans": {
+			ctl: &WebhookController{
+				client:   http.DefaultClient,
+				webhooks: []*Webhook{{Name: "people", Kind: "AUTHORIZING"}, {Name: "inventory", Kind: "AUTHORIZING"}},
+			},
+			ctx: withRequestID(t, context.Background(), "reqID"),
+			req: &webhook.RequestBody{},
+			responses: []*webhook.ResponseBody{
+				{Allow: true, AllowedSANs: []string{"foo.example.com", "bar.example.com"}},
+				{Allow: true, AllowedSANs: []string{"bar.example.com", "10.0.0.1"}},
+			},
+			expectErr:  false,
+			expectSANs: []string{"bar.example.com"},
+		},
+		"ok/fail open": {
+			ctl: &WebhookController{
+				client:   http.DefaultClient,
+				webhooks: []*Webhook{{Name: "people", Kind: "AUTHORIZING", FailOpen: true}},
+			},
+			ctx:       withRequestID(t, context.Background(), "reqID"),
+			req:       &webhook.RequestBody{},
+			responses: []*webhook.ResponseBody{nil},
+			expectErr: false,
+		},
+		"deny/fail open": {
+			ctl: &WebhookController{
+				client:   http.DefaultClient,
+				webhooks: []*Webhook{{Name: "people", Kind: "AUTHORIZING", FailOpen: true}},
+			},
+			ctx:       withRequestID(t, context.Background(), "reqID"),
+			req:       &webhook.RequestBody{},
+			responses: []*webhook.ResponseBody{{Allow: false}},
+			expectErr: true,
+		},
+		"fail/fail closed": {
+			ctl: &WebhookController{
+				client:   http.DefaultClient,
+				webhooks: []*Webhook{{Name: "people", Kind: "AUTHORIZING"}},
+			},
+			ctx:       withRequestID(t, context.Background(), "reqID"),
+			req:       &webhook.RequestBody{},
+			responses: []*webhook.ResponseBody{nil},
+			expectErr: true,
+		},
 		"deny": {
 			ctl: &WebhookController{
 				client:   http.DefaultClient,
@@ -368,6 +413,10 @@ func TestWebhookController_Authorize(t *testing.T) {
 				ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 					assert.Equal(t, "reqID", r.Header.Get("X-Request-ID"))
 
+					if test.responses[j] == nil {
+						w.WriteHeader(http.StatusForbidden)
+						return
+					}
 					err := json.NewEncoder(w).Encode(test.responses[j])
 					require.NoError(t, err)
 				}))
@@ -376,10 +425,11 @@ func TestWebhookController_Authorize(t *testing.T) {
 				wh.URL = ts.URL
 			}
 
-			err := test.ctl.Authorize(test.ctx, test.req)
+			sans, err := test.ctl.AuthorizeSANs(test.ctx, test.req)
 			if (err != nil) != test.expectErr {
 				t.Fatalf("Got err %v, want %v", err, test.expectErr)
 			}
+			assert.Equal(t, test.expectSANs, sans)
 			if test.assertRequest != nil {
 				test.assertRequest(t, test.req)
 			}
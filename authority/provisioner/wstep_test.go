@@ -0,0 +1,237 @@
+package provisioner
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/asn1"
+	"testing"
+	"time"
+
+	"github.com/jcmturner/gokrb5/v8/client"
+	"github.com/jcmturner/gokrb5/v8/config"
+	"github.com/jcmturner/gokrb5/v8/gssapi"
+	"github.com/jcmturner/gokrb5/v8/iana/nametype"
+	"github.com/jcmturner/gokrb5/v8/keytab"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/spnego"
+	"github.com/jcmturner/gokrb5/v8/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func generateKeytab(t *testing.T) (*keytab.Keytab, []byte) {
+	t.Helper()
+	kt := keytab.New()
+	require.NoError(t, kt.AddEntry("HTTP/ca.example.com", "EXAMPLE.COM", "password", time.Now(), 1, 18))
+	b, err := kt.Marshal()
+	require.NoError(t, err)
+	return kt, b
+}
+
+// generateKerberosToken returns a SPNEGO token with an AP_REQ for the given
+// user using a ticket encrypted with the service key in the keytab.
+func generateKerberosToken(t *testing.T, kt *keytab.Keytab, username, realm string, spnegoWrap bool) []byte {
+	t.Helper()
+	now := time.Now().UTC()
+	cname := types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, username)
+	sname := types.NewPrincipalName(nametype.KRB_NT_SRV_INST, "HTTP/ca.example.com")
+	tkt, sessionKey, err := messages.NewTicket(cname, realm, sname, "EXAMPLE.COM", types.NewKrbFlags(), kt, 18, 1, now, now, now.Add(time.Hour), now.Add(time.Hour))
+	require.NoError(t, err)
+
+	cl := client.NewWithKeytab(username, realm, keytab.New(), config.New())
+	if spnegoWrap {
+		init, err := spnego.NewNegTokenInitKRB5(cl, tkt, sessionKey)
+		require.NoError(t, err)
+		b, err := (&spnego.SPNEGOToken{Init: true, NegTokenInit: init}).Marshal()
+		require.NoError(t, err)
+		return b
+	}
+	k5t, err := spnego.NewKRB5TokenAPREQ(cl, tkt, sessionKey, []int{gssapi.ContextFlagInteg, gssapi.ContextFlagConf}, []int{})
+	require.NoError(t, err)
+	b, err := k5t.Marshal()
+	require.NoError(t, err)
+	return b
+}
+
+func generateWSTEP(t *testing.T) (*WSTEP, *keytab.Keytab) {
+	t.Helper()
+	kt, b := generateKeytab(t)
+	p := &WSTEP{
+		Type:   "WSTEP",
+		Name:   "wstep",
+		Keytab: b,
+	}
+	require.NoError(t, p.Init(Config{Claims: globalProvisionerClaims}))
+	return p, kt
+}
+
+func TestWSTEP_Getters(t *testing.T) {
+	p, _ := generateWSTEP(t)
+	assert.Equal(t, "wstep/wstep", p.GetID())
+	assert.Equal(t, "wstep/wstep", p.GetIDForToken())
+	assert.Equal(t, "wstep", p.GetName())
+	assert.Equal(t, TypeWSTEP, p.GetType())
+	assert.Equal(t, "WSTEP", p.GetType().String())
+	kid, key, ok := p.GetEncryptedKey()
+	assert.Empty(t, kid)
+	assert.Empty(t, key)
+	assert.False(t, ok)
+	major, minor := p.GetTemplateVersion()
+	assert.Equal(t, 100, major)
+	assert.Equal(t, 0, minor)
+}
+
+func TestWSTEP_Init(t *testing.T) {
+	_, kt := generateKeytab(t)
+
+	tests := []struct {
+		name    string
+		p       *WSTEP
+		wantErr bool
+	}{
+		{"ok", &WSTEP{Type: "WSTEP", Name: "wstep", Keytab: kt}, false},
+		{"ok servicePrincipal", &WSTEP{Type: "WSTEP", Name: "wstep", Keytab: kt, ServicePrincipal: "HTTP/ca.example.com"}, false},
+		{"ok templateOID", &WSTEP{Type: "WSTEP", Name: "wstep", Keytab: kt, TemplateOID: "1.3.6.1.4.1.311.21.8.1.2"}, false},
+		{"fail type", &WSTEP{Name: "wstep", Keytab: kt}, true},
+		{"fail name", &WSTEP{Type: "WSTEP", Keytab: kt}, true},
+		{"fail keytab", &WSTEP{Type: "WSTEP", Name: "wstep"}, true},
+		{"fail keytab parse", &WSTEP{Type: "WSTEP", Name: "wstep", Keytab: []byte("foo")}, true},
+		{"fail servicePrincipal", &WSTEP{Type: "WSTEP", Name: "wstep", Keytab: kt, ServicePrincipal: "HTTP/other.example.com"}, true},
+		{"fail templateOID", &WSTEP{Type: "WSTEP", Name: "wstep", Keytab: kt, TemplateOID: "1.3.foo"}, true},
+		{"fail minimumPublicKeyLength", &WSTEP{Type: "WSTEP", Name: "wstep", Keytab: kt, MinimumPublicKeyLength: 2047}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.p.Init(Config{Claims: globalProvisionerClaims})
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestWSTEP_Init_defaults(t *testing.T) {
+	p, _ := generateWSTEP(t)
+	assert.Equal(t, []string{"EXAMPLE.COM"}, p.Realms)
+	assert.Equal(t, "wstep", p.TemplateName)
+	assert.Equal(t, 2048, p.MinimumPublicKeyLength)
+	oid := p.GetTemplateOID()
+	assert.Len(t, oid, 15)
+	assert.True(t, oid[:9].Equal(asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 21, 8}))
+	assert.Equal(t, deriveTemplateOID("wstep"), oid)
+	assert.NotEqual(t, deriveTemplateOID("other"), oid)
+
+	_, kt := generateKeytab(t)
+	p = &WSTEP{Type: "WSTEP", Name: "wstep", Keytab: kt, TemplateOID: "1.3.6.1.4.1.311.21.8.1.2"}
+	require.NoError(t, p.Init(Config{Claims: globalProvisionerClaims}))
+	assert.Equal(t, asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 21, 8, 1, 2}, p.GetTemplateOID())
+}
+
+func TestWSTEP_AuthorizeKerberos(t *testing.T) {
+	ctx := context.Background()
+	p, kt := generateWSTEP(t)
+
+	withOptions := func(fn func(p *WSTEP)) *WSTEP {
+		_, b := generateKeytab(t)
+		p := &WSTEP{Type: "WSTEP", Name: "wstep", Keytab: b}
+		fn(p)
+		require.NoError(t, p.Init(Config{Claims: globalProvisionerClaims}))
+		return p
+	}
+
+	tests := []struct {
+		name    string
+		p       *WSTEP
+		token   []byte
+		want    *WSTEPIdentity
+		wantErr bool
+	}{
+		{"ok spnego", p, generateKerberosToken(t, kt, "WS01$", "EXAMPLE.COM", true), &WSTEPIdentity{
+			Username: "WS01$", Realm: "EXAMPLE.COM", DNSName: "ws01.example.com",
+		}, false},
+		{"ok krb5", p, generateKerberosToken(t, kt, "WS02$", "EXAMPLE.COM", false), &WSTEPIdentity{
+			Username: "WS02$", Realm: "EXAMPLE.COM", DNSName: "ws02.example.com",
+		}, false},
+		{"ok dnsDomain", withOptions(func(p *WSTEP) { p.DNSDomain = "Corp.Example.COM." }), generateKerberosToken(t, kt, "WS03$", "EXAMPLE.COM", true), &WSTEPIdentity{
+			Username: "WS03$", Realm: "EXAMPLE.COM", DNSName: "ws03.corp.example.com",
+		}, false},
+		{"fail user account", p, generateKerberosToken(t, kt, "jane", "EXAMPLE.COM", true), nil, true},
+		{"fail hostname", p, generateKerberosToken(t, kt, "WS_01$", "EXAMPLE.COM", true), nil, true},
+		{"fail realm", withOptions(func(p *WSTEP) { p.Realms = []string{"OTHER.COM"} }), generateKerberosToken(t, kt, "WS04$", "EXAMPLE.COM", true), nil, true},
+		{"fail groupSIDs", withOptions(func(p *WSTEP) { p.GroupSIDs = []string{"S-1-5-21-1-2-3-515"} }), generateKerberosToken(t, kt, "WS05$", "EXAMPLE.COM", true), nil, true},
+		{"fail key", p, generateKerberosToken(t, func() *keytab.Keytab { kt, _ := generateKeytab(t); kt.Entries[0].Key.KeyValue[0] ^= 0xff; return kt }(), "WS06$", "EXAMPLE.COM", true), nil, true},
+		{"fail token", p, []byte("foo"), nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.p.AuthorizeKerberos(ctx, tt.token, "192.168.1.10:49152")
+			if tt.wantErr {
+				assert.Error(t, err)
+				assert.Nil(t, got)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want.Username, got.Username)
+			assert.Equal(t, tt.want.Realm, got.Realm)
+			assert.Equal(t, tt.want.DNSName, got.DNSName)
+		})
+	}
+}
+
+func TestWSTEP_AuthorizeSign(t *testing.T) {
+	p, _ := generateWSTEP(t)
+	opts, err := p.AuthorizeSign(context.Background(), "")
+	require.NoError(t, err)
+	assert.Len(t, opts, 8)
+	for _, o := range opts {
+		switch v := o.(type) {
+		case *WSTEP:
+		case *provisionerExtensionOption:
+			assert.Equal(t, TypeWSTEP, v.Type)
+			assert.Equal(t, "wstep", v.Name)
+		case certificateTemplateOption:
+			assert.Equal(t, p.GetTemplateOID(), v.oid)
+			assert.Equal(t, 100, v.majorVersion)
+		case profileDefaultDuration:
+			assert.Equal(t, time.Duration(p.ctl.Claimer.DefaultTLSCertDuration()), time.Duration(v))
+		case publicKeyMinimumLengthValidator:
+			assert.Equal(t, 2048, v.length)
+		case *validityValidator:
+		case *x509NamePolicyValidator:
+		case *WebhookController:
+		default:
+			assert.FailNow(t, "unexpected sign option", "%T", v)
+		}
+	}
+}
+
+func Test_certificateTemplateOption_Modify(t *testing.T) {
+	oid := asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 21, 8, 1, 2}
+	o := certificateTemplateOption{oid: oid, majorVersion: 100}
+
+	cert := &x509.Certificate{}
+	require.NoError(t, o.Modify(cert, SignOptions{}))
+	require.Len(t, cert.ExtraExtensions, 1)
+	assert.True(t, cert.ExtraExtensions[0].Id.Equal(oidCertificateTemplate))
+
+	var v struct {
+		TemplateID   asn1.ObjectIdentifier
+		MajorVersion int
+		MinorVersion int
+	}
+	_, err := asn1.Unmarshal(cert.ExtraExtensions[0].Value, &v)
+	require.NoError(t, err)
+	assert.Equal(t, oid, v.TemplateID)
+	assert.Equal(t, 100, v.MajorVersion)
+	assert.Equal(t, 0, v.MinorVersion)
+
+	// The extension is replaced.
+	o.minorVersion = 1
+	require.NoError(t, o.Modify(cert, SignOptions{}))
+	require.Len(t, cert.ExtraExtensions, 1)
+	_, err = asn1.Unmarshal(cert.ExtraExtensions[0].Value, &v)
+	require.NoError(t, err)
+	assert.Equal(t, 1, v.MinorVersion)
+}
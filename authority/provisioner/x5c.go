@@ -3,8 +3,8 @@ package provisioner
 import (
 	"context"
 	"crypto/x509"
-	"encoding/pem"
 	"net/http"
+	"net/url"
 	"time"
 
 	"github.com/pkg/errors"
@@ -29,16 +29,29 @@ type x5cPayload struct {
 
 // X5C is the default provisioner, an entity that can sign tokens necessary for
 // signature requests.
+//
+// The trusted roots can be given inline using Roots, or loaded from a PEM
+// bundle in RootsURL or from the PEM files in RootsDirectory. Roots loaded from
+// a URL or a directory are reloaded every RootsReloadInterval, one hour by
+// default, so the provisioner can follow the trust bundle of a partner PKI.
+//
+// ChainPolicy can be used to add requirements to the certificate chain in the
+// token.
 type X5C struct {
 	*base
-	ID       string   `json:"-"`
-	Type     string   `json:"type"`
-	Name     string   `json:"name"`
-	Roots    []byte   `json:"roots"`
-	Claims   *Claims  `json:"claims,omitempty"`
-	Options  *Options `json:"options,omitempty"`
-	ctl      *Controller
-	rootPool *x509.CertPool
+	ID                  string          `json:"-"`
+	Type                string          `json:"type"`
+	Name                string          `json:"name"`
+	Roots               []byte          `json:"roots"`
+	RootsURL            string          `json:"rootsURL,omitempty"`
+	RootsDirectory      string          `json:"rootsDirectory,omitempty"`
+	RootsReloadInterval *Duration       `json:"rootsReloadInterval,omitempty"`
+	ChainPolicy         *X5CChainPolicy `json:"chainPolicy,omitempty"`
+	Claims              *Claims         `json:"claims,omitempty"`
+	Options             *Options        `json:"options,omitempty"`
+	ctl                 *Controller
+	rootPool            *x509.CertPool
+	roots               *x5cRootsLoader
 }
 
 // GetID returns the provisioner unique identifier. The name and credential id
@@ -89,6 +102,11 @@ func (p *X5C) GetEncryptedKey() (string, string, bool) {
 	return "", "", false
 }
 
+// GetOptions returns the configured provisioner options.
+func (p *X5C) GetOptions() *Options {
+	return p.Options
+}
+
 // Init initializes and validates the fields of a X5C type.
 func (p *X5C) Init(config Config) (err error) {
 	switch {
@@ -96,38 +114,40 @@ func (p *X5C) Init(config Config) (err error) {
 		return errors.New("provisioner type cannot be empty")
 	case p.Name == "":
 		return errors.New("provisioner name cannot be empty")
-	case len(p.Roots) == 0:
+	case len(p.Roots) == 0 && p.RootsURL == "" && p.RootsDirectory == "":
 		return errors.New("provisioner root(s) cannot be empty")
+	case p.RootsReloadInterval != nil && p.RootsReloadInterval.Value() < 0:
+		return errors.New("provisioner rootsReloadInterval cannot be negative")
 	}
 
-	p.rootPool = x509.NewCertPool()
-
-	var (
-		block *pem.Block
-		rest  = p.Roots
-		count int
-	)
-	for rest != nil {
-		block, rest = pem.Decode(rest)
-		if block == nil {
-			break
-		}
-		cert, err := x509.ParseCertificate(block.Bytes)
-		if err != nil {
-			return errors.Wrap(err, "error parsing x509 certificate from PEM block")
+	if p.RootsURL != "" {
+		u, err := url.Parse(p.RootsURL)
+		if err != nil || u.Scheme != "https" || u.Host == "" {
+			return errors.Errorf("provisioner rootsURL %q is not a valid https url", p.RootsURL)
 		}
-		count++
-		p.rootPool.AddCert(cert)
 	}
 
-	// Verify that at least one root was found.
-	if count == 0 {
-		return errors.Errorf("no x509 certificates found in roots attribute for provisioner '%s'", p.GetName())
+	if err := p.ChainPolicy.init(); err != nil {
+		return errors.Wrap(err, "error validating chainPolicy")
 	}
 
 	config.Audiences = config.Audiences.WithFragment(p.GetIDForToken())
-	p.ctl, err = NewController(p, p.Claims, config, p.Options)
-	return
+	if p.ctl, err = NewController(p, p.Claims, config, p.Options); err != nil {
+		return err
+	}
+
+	p.roots = &x5cRootsLoader{
+		interval: defaultX5CRootsReloadInterval,
+	}
+	if p.RootsReloadInterval != nil && p.RootsReloadInterval.Value() > 0 {
+		p.roots.interval = p.RootsReloadInterval.Value()
+	}
+	p.rootPool, err = p.loadRoots()
+	if err != nil {
+		return err
+	}
+	p.roots.expiry = time.Now().Add(p.roots.interval)
+	return nil
 }
 
 // authorizeToken performs common jwt authorization actions and returns the
@@ -140,8 +160,8 @@ func (p *X5C) authorizeToken(token string, audiences []string) (*x5cPayload, err
 	}
 
 	verifiedChains, err := jwt.Headers[0].Certificates(x509.VerifyOptions{
-		Roots:     p.rootPool,
-		KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		Roots:     p.getRootPool(),
+		KeyUsages: p.ChainPolicy.getExtKeyUsages(),
 	})
 	if err != nil {
 		return nil, errs.Wrap(http.StatusUnauthorized, err,
@@ -153,6 +173,11 @@ func (p *X5C) authorizeToken(token string, audiences []string) (*x5cPayload, err
 		return nil, errs.Unauthorized("x5c.authorizeToken; certificate used to sign x5c token cannot be used for digital signature")
 	}
 
+	if err := p.ChainPolicy.validate(leaf); err != nil {
+		return nil, errs.Wrap(http.StatusUnauthorized, err,
+			"x5c.authorizeToken; certificate used to sign x5c token is not allowed")
+	}
+
 	// Using the leaf certificates key to validate the claims accomplishes two
 	// things:
 	//   1. Asserts that the private key used to sign the token corresponds
@@ -196,6 +221,9 @@ func (p *X5C) AuthorizeRevoke(_ context.Context, token string) error {
 
 // AuthorizeSign validates the given token.
 func (p *X5C) AuthorizeSign(ctx context.Context, token string) ([]SignOption, error) {
+	if err := p.ctl.AuthorizeIssuance(); err != nil {
+		return nil, err
+	}
 	claims, err := p.authorizeToken(token, p.ctl.Audiences.Sign)
 	if err != nil {
 		return nil, errs.Wrap(http.StatusInternalServerError, err, "x5c.AuthorizeSign")
@@ -253,8 +281,8 @@ func (p *X5C) AuthorizeSign(ctx context.Context, token string) ([]SignOption, er
 		csrFingerprintValidator(fingerprint),
 		commonNameValidator(claims.Subject),
 		newDefaultSANsValidator(ctx, claims.SANs),
-		defaultPublicKeyValidator{},
-		newValidityValidator(p.ctl.Claimer.MinTLSCertDuration(), p.ctl.Claimer.MaxTLSCertDuration()),
+		defaultPublicKeyValidator{keys: p.ctl.Claimer.KeyClaims()},
+		newClaimsValidityValidator(p.ctl.Claimer),
 		newX509NamePolicyValidator(p.ctl.getPolicy().getX509()),
 		p.ctl.newWebhookController(
 			data,
@@ -272,6 +300,9 @@ func (p *X5C) AuthorizeRenew(ctx context.Context, cert *x509.Certificate) error
 
 // AuthorizeSSHSign returns the list of SignOption for a SignSSH request.
 func (p *X5C) AuthorizeSSHSign(_ context.Context, token string) ([]SignOption, error) {
+	if err := p.ctl.AuthorizeIssuance(); err != nil {
+		return nil, err
+	}
 	if !p.ctl.Claimer.IsSSHCAEnabled() {
 		return nil, errs.Unauthorized("x5c.AuthorizeSSHSign; sshCA is disabled for x5c provisioner '%s'", p.GetName())
 	}
@@ -343,7 +374,7 @@ func (p *X5C) AuthorizeSSHSign(_ context.Context, token string) ([]SignOption, e
 		// Checks the validity bounds, and set the validity if has not been set.
 		&sshLimitDuration{p.ctl.Claimer, x5cLeaf.NotAfter},
 		// Validate public key.
-		&sshDefaultPublicKeyValidator{},
+		&sshDefaultPublicKeyValidator{keys: p.ctl.Claimer.KeyClaims()},
 		// Validate the validity period.
 		&sshCertValidityValidator{p.ctl.Claimer},
 		// Require all the fields in the SSH certificate
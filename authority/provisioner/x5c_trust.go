@@ -0,0 +1,261 @@
+package provisioner
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"go.step.sm/crypto/x509util"
+
+	"github.com/smallstep/certificates/authority/policy"
+)
+
+// defaultX5CRootsReloadInterval is the default interval used to reload the
+// roots from a URL or a directory.
+const defaultX5CRootsReloadInterval = time.Hour
+
+// maxX5CRootsSize is the maximum size of a trust bundle downloaded from a URL.
+const maxX5CRootsSize = 10 << 20
+
+// X5CChainPolicy contains additional requirements for the certificate chain
+// used to sign an X5C token.
+//
+// ExtKeyUsages are the acceptable extended key usages of the chain, if empty
+// only clientAuth is accepted. AllowedNames and DeniedNames are the name
+// constraints enforced in the leaf certificate, and CertificatePolicies is the
+// list of policy OIDs accepted, if set the leaf must assert at least one of
+// them.
+type X5CChainPolicy struct {
+	ExtKeyUsages        x509util.ExtKeyUsage       `json:"extKeyUsages,omitempty"`
+	AllowedNames        *policy.X509NameOptions    `json:"allow,omitempty"`
+	DeniedNames         *policy.X509NameOptions    `json:"deny,omitempty"`
+	AllowWildcardNames  bool                       `json:"allowWildcardNames,omitempty"`
+	CertificatePolicies x509util.PolicyIdentifiers `json:"certificatePolicies,omitempty"`
+	engine              policy.X509Policy
+}
+
+// GetAllowedNameOptions returns the names allowed in the leaf certificate.
+func (c *X5CChainPolicy) GetAllowedNameOptions() *policy.X509NameOptions {
+	if c == nil {
+		return nil
+	}
+	return c.AllowedNames
+}
+
+// GetDeniedNameOptions returns the names not allowed in the leaf certificate.
+func (c *X5CChainPolicy) GetDeniedNameOptions() *policy.X509NameOptions {
+	if c == nil {
+		return nil
+	}
+	return c.DeniedNames
+}
+
+// AreWildcardNamesAllowed returns if literal wildcard names are allowed in the
+// leaf certificate.
+func (c *X5CChainPolicy) AreWildcardNamesAllowed() bool {
+	if c == nil {
+		return false
+	}
+	return c.AllowWildcardNames
+}
+
+// init initializes the name policy engine.
+func (c *X5CChainPolicy) init() (err error) {
+	if c == nil {
+		return nil
+	}
+	c.engine, err = policy.NewX509PolicyEngine(c)
+	return
+}
+
+// getExtKeyUsages returns the acceptable extended key usages.
+func (c *X5CChainPolicy) getExtKeyUsages() []x509.ExtKeyUsage {
+	if c == nil || len(c.ExtKeyUsages) == 0 {
+		return []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+	}
+	return c.ExtKeyUsages
+}
+
+// validate checks the name constraints and certificate policies of the leaf.
+func (c *X5CChainPolicy) validate(leaf *x509.Certificate) error {
+	if c == nil {
+		return nil
+	}
+	if c.engine != nil {
+		if err := c.engine.IsX509CertificateAllowed(leaf); err != nil {
+			return err
+		}
+	}
+	if len(c.CertificatePolicies) > 0 {
+		for _, want := range c.CertificatePolicies {
+			for _, got := range leaf.PolicyIdentifiers {
+				if want.Equal(got) {
+					return nil
+				}
+			}
+		}
+		return errors.New("certificate does not contain any of the required certificate policies")
+	}
+	return nil
+}
+
+// x5cRootsLoader keeps track of when the roots of an X5C provisioner must be
+// reloaded.
+type x5cRootsLoader struct {
+	sync.RWMutex
+	interval time.Duration
+	expiry   time.Time
+}
+
+// getRootPool returns the pool of trusted roots. If the roots are loaded from
+// a URL or a directory, and they have expired, they will be reloaded. If the
+// reload fails, the current roots are used until the next attempt.
+func (p *X5C) getRootPool() *x509.CertPool {
+	if p.roots == nil || (p.RootsURL == "" && p.RootsDirectory == "") {
+		return p.rootPool
+	}
+
+	p.roots.RLock()
+	pool, expired := p.rootPool, time.Now().After(p.roots.expiry)
+	p.roots.RUnlock()
+	if !expired {
+		return pool
+	}
+
+	p.roots.Lock()
+	defer p.roots.Unlock()
+	if time.Now().After(p.roots.expiry) {
+		if newPool, err := p.loadRoots(); err == nil {
+			p.rootPool = newPool
+		}
+		p.roots.expiry = time.Now().Add(p.roots.interval)
+	}
+	return p.rootPool
+}
+
+// loadRoots creates a pool with the roots in the Roots attribute, the RootsURL
+// and the RootsDirectory.
+func (p *X5C) loadRoots() (*x509.CertPool, error) {
+	pool := x509.NewCertPool()
+
+	if len(p.Roots) > 0 {
+		certs, err := parseX5CRoots(p.Roots)
+		if err != nil {
+			return nil, err
+		}
+		// Verify that at least one root was found.
+		if len(certs) == 0 {
+			return nil, errors.Errorf("no x509 certificates found in roots attribute for provisioner '%s'", p.GetName())
+		}
+		for _, crt := range certs {
+			pool.AddCert(crt)
+		}
+	}
+
+	if p.RootsURL != "" {
+		certs, err := p.getRootsFromURL()
+		if err != nil {
+			return nil, err
+		}
+		for _, crt := range certs {
+			pool.AddCert(crt)
+		}
+	}
+
+	if p.RootsDirectory != "" {
+		certs, err := getRootsFromDirectory(p.RootsDirectory)
+		if err != nil {
+			return nil, err
+		}
+		for _, crt := range certs {
+			pool.AddCert(crt)
+		}
+	}
+
+	return pool, nil
+}
+
+func (p *X5C) getRootsFromURL() ([]*x509.Certificate, error) {
+	resp, err := p.ctl.GetHTTPClient().Get(p.RootsURL)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to connect to %s", p.RootsURL)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return nil, errors.Errorf("error reading %s: status code %d", p.RootsURL, resp.StatusCode)
+	}
+	b, err := io.ReadAll(io.LimitReader(resp.Body, maxX5CRootsSize))
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading %s", p.RootsURL)
+	}
+	certs, err := parseX5CRoots(b)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading %s", p.RootsURL)
+	}
+	if len(certs) == 0 {
+		return nil, errors.Errorf("no x509 certificates found in %s", p.RootsURL)
+	}
+	return certs, nil
+}
+
+// getRootsFromDirectory reads the roots in the files with extension .pem, .crt
+// or .cer in the given directory.
+func getRootsFromDirectory(dir string) ([]*x509.Certificate, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading %s", dir)
+	}
+	var certs []*x509.Certificate
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		switch strings.ToLower(filepath.Ext(e.Name())) {
+		case ".pem", ".crt", ".cer":
+		default:
+			continue
+		}
+		filename := filepath.Join(dir, e.Name())
+		b, err := os.ReadFile(filename)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error reading %s", filename)
+		}
+		crts, err := parseX5CRoots(b)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error reading %s", filename)
+		}
+		certs = append(certs, crts...)
+	}
+	if len(certs) == 0 {
+		return nil, errors.Errorf("no x509 certificates found in %s", dir)
+	}
+	return certs, nil
+}
+
+// parseX5CRoots parses all the PEM encoded certificates in the given data.
+func parseX5CRoots(b []byte) ([]*x509.Certificate, error) {
+	var (
+		block *pem.Block
+		rest  = b
+		certs []*x509.Certificate
+	)
+	for rest != nil {
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, errors.Wrap(err, "error parsing x509 certificate from PEM block")
+		}
+		certs = append(certs, cert)
+	}
+	return certs, nil
+}
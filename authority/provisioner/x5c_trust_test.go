@@ -0,0 +1,207 @@
+package provisioner
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.step.sm/crypto/jose"
+	"go.step.sm/crypto/minica"
+	"go.step.sm/crypto/x509util"
+
+	"github.com/smallstep/certificates/api/render"
+	"github.com/smallstep/certificates/authority/policy"
+)
+
+func x5cTestRoot(t *testing.T, ca *minica.CA) []byte {
+	t.Helper()
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Root.Raw})
+}
+
+// x5cTestToken returns a token signed by a new leaf certificate created with
+// the given template.
+func x5cTestToken(t *testing.T, ca *minica.CA, p *X5C, tmpl *x509.Certificate) string {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl.PublicKey = key.Public()
+	if tmpl.KeyUsage == 0 {
+		tmpl.KeyUsage = x509.KeyUsageDigitalSignature
+	}
+	if tmpl.ExtKeyUsage == nil {
+		tmpl.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+	}
+	leaf, err := ca.Sign(tmpl)
+	require.NoError(t, err)
+	tok, err := generateCustomToken("foo.example.com", p.Name, testAudiences.Sign[0]+"#"+p.GetIDForToken(), &jose.JSONWebKey{Key: key}, map[string]any{
+		"x5c": []string{
+			base64.StdEncoding.EncodeToString(leaf.Raw),
+			base64.StdEncoding.EncodeToString(ca.Intermediate.Raw),
+		},
+	}, nil)
+	require.NoError(t, err)
+	return tok
+}
+
+func TestX5C_Init_roots(t *testing.T) {
+	ca, err := minica.New()
+	require.NoError(t, err)
+	root := x5cTestRoot(t, ca)
+
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/roots.pem" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(root)
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "root.crt"), root, 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "README"), []byte("not a certificate"), 0600))
+	emptyDir := t.TempDir()
+
+	config := Config{Claims: globalProvisionerClaims, Audiences: testAudiences, HTTPClient: srv.Client()}
+	tests := []struct {
+		name    string
+		p       *X5C
+		wantErr bool
+	}{
+		{"ok rootsURL", &X5C{Type: "X5C", Name: "x5c", RootsURL: srv.URL + "/roots.pem"}, false},
+		{"ok rootsDirectory", &X5C{Type: "X5C", Name: "x5c", RootsDirectory: dir}, false},
+		{"ok all", &X5C{Type: "X5C", Name: "x5c", Roots: root, RootsURL: srv.URL + "/roots.pem", RootsDirectory: dir, RootsReloadInterval: &Duration{time.Minute}}, false},
+		{"ok chainPolicy", &X5C{Type: "X5C", Name: "x5c", Roots: root, ChainPolicy: &X5CChainPolicy{
+			AllowedNames: &policy.X509NameOptions{DNSDomains: []string{"*.example.com"}},
+		}}, false},
+		{"fail rootsURL scheme", &X5C{Type: "X5C", Name: "x5c", RootsURL: "http://example.com/roots.pem"}, true},
+		{"fail rootsURL not found", &X5C{Type: "X5C", Name: "x5c", RootsURL: srv.URL + "/missing.pem"}, true},
+		{"fail rootsDirectory missing", &X5C{Type: "X5C", Name: "x5c", RootsDirectory: filepath.Join(dir, "missing")}, true},
+		{"fail rootsDirectory empty", &X5C{Type: "X5C", Name: "x5c", RootsDirectory: emptyDir}, true},
+		{"fail rootsReloadInterval", &X5C{Type: "X5C", Name: "x5c", Roots: root, RootsReloadInterval: &Duration{-time.Minute}}, true},
+		{"fail chainPolicy", &X5C{Type: "X5C", Name: "x5c", Roots: root, ChainPolicy: &X5CChainPolicy{
+			AllowedNames: &policy.X509NameOptions{DNSDomains: []string{"*.*.example.com"}},
+		}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.p.Init(config)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			tok := x5cTestToken(t, ca, tt.p, &x509.Certificate{DNSNames: []string{"foo.example.com"}})
+			_, err = tt.p.authorizeToken(tok, tt.p.ctl.Audiences.Sign)
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestX5C_getRootPool_reload(t *testing.T) {
+	ca1, err := minica.New()
+	require.NoError(t, err)
+	ca2, err := minica.New()
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "ca1.pem"), x5cTestRoot(t, ca1), 0600))
+
+	p := &X5C{Type: "X5C", Name: "x5c", RootsDirectory: dir}
+	require.NoError(t, p.Init(Config{Claims: globalProvisionerClaims, Audiences: testAudiences}))
+
+	tok1 := x5cTestToken(t, ca1, p, &x509.Certificate{})
+	tok2 := x5cTestToken(t, ca2, p, &x509.Certificate{})
+	_, err = p.authorizeToken(tok1, p.ctl.Audiences.Sign)
+	require.NoError(t, err)
+	_, err = p.authorizeToken(tok2, p.ctl.Audiences.Sign)
+	require.Error(t, err)
+
+	// Roots are not reloaded until they expire.
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "ca2.pem"), x5cTestRoot(t, ca2), 0600))
+	_, err = p.authorizeToken(tok2, p.ctl.Audiences.Sign)
+	require.Error(t, err)
+
+	p.roots.expiry = time.Now().Add(-time.Second)
+	_, err = p.authorizeToken(tok2, p.ctl.Audiences.Sign)
+	require.NoError(t, err)
+
+	// Current roots are kept if the reload fails.
+	require.NoError(t, os.RemoveAll(dir))
+	p.roots.expiry = time.Now().Add(-time.Second)
+	_, err = p.authorizeToken(tok1, p.ctl.Audiences.Sign)
+	require.NoError(t, err)
+	assert.True(t, p.roots.expiry.After(time.Now()))
+}
+
+func TestX5C_authorizeToken_chainPolicy(t *testing.T) {
+	ca, err := minica.New()
+	require.NoError(t, err)
+	root := x5cTestRoot(t, ca)
+
+	newX5C := func(t *testing.T, cp *X5CChainPolicy) *X5C {
+		t.Helper()
+		p := &X5C{Type: "X5C", Name: "x5c", Roots: root, ChainPolicy: cp}
+		require.NoError(t, p.Init(Config{Claims: globalProvisionerClaims, Audiences: testAudiences}))
+		return p
+	}
+
+	partnerPolicy := asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 99999, 1}
+	otherPolicy := asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 99999, 2}
+
+	noPolicy := newX5C(t, nil)
+	serverAuth := newX5C(t, &X5CChainPolicy{
+		ExtKeyUsages: x509util.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	})
+	names := newX5C(t, &X5CChainPolicy{
+		AllowedNames: &policy.X509NameOptions{DNSDomains: []string{"*.partner.com"}},
+		DeniedNames:  &policy.X509NameOptions{DNSDomains: []string{"internal.partner.com"}},
+	})
+	policies := newX5C(t, &X5CChainPolicy{
+		CertificatePolicies: x509util.PolicyIdentifiers{partnerPolicy},
+	})
+
+	tests := []struct {
+		name       string
+		p          *X5C
+		tmpl       *x509.Certificate
+		wantStatus int
+	}{
+		{"ok no policy", noPolicy, &x509.Certificate{DNSNames: []string{"foo.example.com"}}, 0},
+		{"ok serverAuth", serverAuth, &x509.Certificate{ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}}, 0},
+		{"ok names", names, &x509.Certificate{DNSNames: []string{"foo.partner.com"}}, 0},
+		{"ok policies", policies, &x509.Certificate{PolicyIdentifiers: []asn1.ObjectIdentifier{otherPolicy, partnerPolicy}}, 0},
+		{"fail serverAuth", noPolicy, &x509.Certificate{ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}}, http.StatusUnauthorized},
+		{"fail codeSigning", serverAuth, &x509.Certificate{ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning}}, http.StatusUnauthorized},
+		{"fail names allowed", names, &x509.Certificate{DNSNames: []string{"foo.example.com"}}, http.StatusForbidden},
+		{"fail names denied", names, &x509.Certificate{DNSNames: []string{"internal.partner.com"}}, http.StatusForbidden},
+		{"fail policies", policies, &x509.Certificate{PolicyIdentifiers: []asn1.ObjectIdentifier{otherPolicy}}, http.StatusUnauthorized},
+		{"fail no policies", policies, &x509.Certificate{}, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.p.authorizeToken(x5cTestToken(t, ca, tt.p, tt.tmpl), tt.p.ctl.Audiences.Sign)
+			if tt.wantStatus != 0 {
+				var sc render.StatusCodedError
+				require.ErrorAs(t, err, &sc)
+				assert.Equal(t, tt.wantStatus, sc.StatusCode())
+				assert.Nil(t, got)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "foo.example.com", got.Subject)
+		})
+	}
+}
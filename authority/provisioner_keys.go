@@ -0,0 +1,218 @@
+package authority
+
+import (
+	"context"
+	"encoding/json"
+
+	"go.step.sm/crypto/jose"
+	"go.step.sm/linkedca"
+
+	"github.com/smallstep/certificates/authority/admin"
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+// GetProvisionerKeys returns the public keys of a JWK provisioner, the main
+// key first, followed by the additional keys.
+func (a *Authority) GetProvisionerKeys(ctx context.Context, p provisioner.Interface) ([]*jose.JSONWebKey, error) {
+	if p.GetType() != provisioner.TypeJWK {
+		return nil, admin.NewError(admin.ErrorBadRequestType, "provisioner %s is not a JWK provisioner", p.GetName())
+	}
+	db, err := a.provisionerKeysDB()
+	if err != nil {
+		return nil, err
+	}
+
+	prov, err := a.adminDB.GetProvisioner(ctx, p.GetID())
+	if err != nil {
+		return nil, admin.WrapErrorISE(err, "error loading provisioner %s", p.GetName())
+	}
+	main, keys, err := getProvisionerKeys(ctx, db, prov)
+	if err != nil {
+		return nil, admin.WrapErrorISE(err, "error loading keys of provisioner %s", p.GetName())
+	}
+	return append([]*jose.JSONWebKey{main}, keys...), nil
+}
+
+// AddProvisionerKey adds a public key to a JWK provisioner. If primary is true,
+// the key and the given encrypted private key become the main key of the
+// provisioner, and the previous main key is kept as an additional key, so the
+// tokens signed with it are still accepted until the key is removed.
+func (a *Authority) AddProvisionerKey(ctx context.Context, p provisioner.Interface, key *jose.JSONWebKey, encryptedKey string, primary bool) ([]*jose.JSONWebKey, error) {
+	return a.updateProvisionerKeys(ctx, p, func(jwk *linkedca.JWKProvisioner, main *jose.JSONWebKey, keys []*jose.JSONWebKey) (*jose.JSONWebKey, []*jose.JSONWebKey, error) {
+		if main.KeyID == key.KeyID {
+			return nil, nil, admin.NewError(admin.ErrorBadRequestType, "key %s already exists", key.KeyID)
+		}
+		for _, k := range keys {
+			if k.KeyID == key.KeyID {
+				return nil, nil, admin.NewError(admin.ErrorBadRequestType, "key %s already exists", key.KeyID)
+			}
+		}
+		if !primary {
+			return main, append(keys, key), nil
+		}
+		// The encrypted private key is used by clients to sign tokens with the
+		// main key.
+		if encryptedKey == "" {
+			return nil, nil, admin.NewError(admin.ErrorBadRequestType, "encryptedKey cannot be empty on primary keys")
+		}
+		jwk.EncryptedPrivateKey = []byte(encryptedKey)
+		return key, append(keys, main), nil
+	})
+}
+
+// RemoveProvisionerKey removes an additional public key from a JWK
+// provisioner. The main key of the provisioner cannot be removed, a new main
+// key must be added first.
+func (a *Authority) RemoveProvisionerKey(ctx context.Context, p provisioner.Interface, kid string) ([]*jose.JSONWebKey, error) {
+	return a.updateProvisionerKeys(ctx, p, func(_ *linkedca.JWKProvisioner, main *jose.JSONWebKey, keys []*jose.JSONWebKey) (*jose.JSONWebKey, []*jose.JSONWebKey, error) {
+		if main.KeyID == kid {
+			return nil, nil, admin.NewError(admin.ErrorBadRequestType, "cannot remove the main key %s of provisioner %s", kid, p.GetName())
+		}
+		for i, k := range keys {
+			if k.KeyID == kid {
+				return main, append(keys[:i:i], keys[i+1:]...), nil
+			}
+		}
+		return nil, nil, admin.NewError(admin.ErrorNotFoundType, "key %s not found in provisioner %s", kid, p.GetName())
+	})
+}
+
+type updateKeysFunc func(jwk *linkedca.JWKProvisioner, main *jose.JSONWebKey, keys []*jose.JSONWebKey) (*jose.JSONWebKey, []*jose.JSONWebKey, error)
+
+// updateProvisionerKeys loads the given JWK provisioner and its additional
+// keys from the admin database, updates the keys with the given function, and
+// stores them back. The main key is stored in the provisioner, the additional
+// keys are stored separately. It returns the new keys, the main key first.
+func (a *Authority) updateProvisionerKeys(ctx context.Context, p provisioner.Interface, fn updateKeysFunc) ([]*jose.JSONWebKey, error) {
+	a.adminMutex.Lock()
+	defer a.adminMutex.Unlock()
+
+	if p.GetType() != provisioner.TypeJWK {
+		return nil, admin.NewError(admin.ErrorBadRequestType, "provisioner %s is not a JWK provisioner", p.GetName())
+	}
+	db, err := a.provisionerKeysDB()
+	if err != nil {
+		return nil, err
+	}
+
+	prov, err := a.adminDB.GetProvisioner(ctx, p.GetID())
+	if err != nil {
+		return nil, admin.WrapErrorISE(err, "error loading provisioner %s", p.GetName())
+	}
+	main, keys, err := getProvisionerKeys(ctx, db, prov)
+	if err != nil {
+		return nil, admin.WrapErrorISE(err, "error loading keys of provisioner %s", p.GetName())
+	}
+	jwk := prov.GetDetails().GetJWK()
+	if main, keys, err = fn(jwk, main, keys); err != nil {
+		return nil, err
+	}
+
+	if jwk.PublicKey, err = json.Marshal(main); err != nil {
+		return nil, admin.WrapErrorISE(err, "error updating provisioner %s", p.GetName())
+	}
+	data, err := marshalJWKProvisionerKeys(keys)
+	if err != nil {
+		return nil, admin.WrapErrorISE(err, "error updating provisioner %s", p.GetName())
+	}
+
+	state, err := a.loadProvisionerState(ctx, prov.Id)
+	if err != nil {
+		return nil, admin.WrapErrorISE(err, "error loading state of provisioner %s", p.GetName())
+	}
+	certProv, err := provisionerToCertificates(prov, state, keys)
+	if err != nil {
+		return nil, admin.WrapErrorISE(err,
+			"error converting to certificates provisioner from linkedca provisioner")
+	}
+	provisionerConfig, err := a.generateProvisionerConfig(ctx)
+	if err != nil {
+		return nil, admin.WrapErrorISE(err, "error generating provisioner config")
+	}
+	if err := certProv.Init(provisionerConfig); err != nil {
+		return nil, admin.WrapErrorISE(err, "error initializing provisioner %s", prov.Name)
+	}
+
+	// The additional keys are stored first, so a new main key is never
+	// stored without the previous one.
+	if err := db.UpdateProvisionerKeys(ctx, prov.Id, data); err != nil {
+		return nil, admin.WrapErrorISE(err, "error updating keys of provisioner %s", prov.Name)
+	}
+	if err := a.adminDB.UpdateProvisioner(ctx, prov); err != nil {
+		if err := a.ReloadAdminResources(ctx); err != nil {
+			return nil, admin.WrapErrorISE(err, "error reloading admin resources on failed provisioner update")
+		}
+		return nil, admin.WrapErrorISE(err, "error updating provisioner '%s'", prov.Name)
+	}
+	if err := a.provisioners.Update(certProv); err != nil {
+		if err := a.ReloadAdminResources(ctx); err != nil {
+			return nil, admin.WrapErrorISE(err, "error reloading admin resources on failed provisioner update")
+		}
+		return nil, admin.WrapErrorISE(err, "error updating provisioner '%s' in authority cache", prov.Name)
+	}
+	return append([]*jose.JSONWebKey{main}, keys...), nil
+}
+
+// provisionerKeysDB returns the admin database as a ProvisionerKeysDB. The
+// linked CA does not store the additional keys of the JWK provisioners.
+func (a *Authority) provisionerKeysDB() (admin.ProvisionerKeysDB, error) {
+	if db, ok := a.adminDB.(admin.ProvisionerKeysDB); ok {
+		return db, nil
+	}
+	return nil, admin.NewError(admin.ErrorNotImplementedType, "provisioner keys are not supported by the admin database")
+}
+
+// getProvisionerKeys returns the main key and the additional keys of the given
+// JWK provisioner.
+func getProvisionerKeys(ctx context.Context, db admin.ProvisionerKeysDB, prov *linkedca.Provisioner) (*jose.JSONWebKey, []*jose.JSONWebKey, error) {
+	jwk := prov.GetDetails().GetJWK()
+	if jwk == nil {
+		return nil, nil, admin.NewErrorISE("provisioner %s does not have JWK details", prov.Name)
+	}
+	main := new(jose.JSONWebKey)
+	if err := json.Unmarshal(jwk.PublicKey, main); err != nil {
+		return nil, nil, err
+	}
+	data, err := db.GetProvisionerKeys(ctx, prov.Id)
+	if err != nil {
+		return nil, nil, err
+	}
+	keys, err := unmarshalJWKProvisionerKeys(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	return main, keys, nil
+}
+
+// loadProvisionerKeys returns the additional keys of a JWK provisioner stored
+// in the admin database, or no keys if the provisioner is not a JWK
+// provisioner or the admin database does not store them.
+func (a *Authority) loadProvisionerKeys(ctx context.Context, p *linkedca.Provisioner) ([]*jose.JSONWebKey, error) {
+	db, ok := a.adminDB.(admin.ProvisionerKeysDB)
+	if !ok || p.Id == "" || p.Type != linkedca.Provisioner_JWK {
+		return nil, nil
+	}
+	data, err := db.GetProvisionerKeys(ctx, p.Id)
+	if err != nil {
+		return nil, err
+	}
+	return unmarshalJWKProvisionerKeys(data)
+}
+
+// migrateProvisionerKeys stores the additional keys configured in a JWK
+// provisioner migrated from the configuration to the admin database.
+func (a *Authority) migrateProvisionerKeys(ctx context.Context, p provisioner.Interface, id string) error {
+	jwk, ok := p.(*provisioner.JWK)
+	if !ok || len(jwk.Keys) == 0 {
+		return nil
+	}
+	db, err := a.provisionerKeysDB()
+	if err != nil {
+		return err
+	}
+	data, err := marshalJWKProvisionerKeys(jwk.Keys)
+	if err != nil {
+		return err
+	}
+	return db.UpdateProvisionerKeys(ctx, id, data)
+}
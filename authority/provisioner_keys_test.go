@@ -0,0 +1,227 @@
+package authority
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.step.sm/crypto/jose"
+	"go.step.sm/linkedca"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/smallstep/certificates/authority/admin"
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+func mustJSONWebKey(t *testing.T) *jose.JSONWebKey {
+	t.Helper()
+	key, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+	require.NoError(t, err)
+	pub := key.Public()
+	return &pub
+}
+
+func TestAuthority_AddRemoveProvisionerKey(t *testing.T) {
+	ctx := context.Background()
+	a := testAuthority(t)
+	p, err := a.LoadProvisionerByName("Max")
+	require.NoError(t, err)
+	jwk := p.(*provisioner.JWK)
+
+	publicKey, err := json.Marshal(jwk.Key)
+	require.NoError(t, err)
+	stored := &linkedca.Provisioner{
+		Id:   p.GetID(),
+		Type: linkedca.Provisioner_JWK,
+		Name: p.GetName(),
+		Details: &linkedca.ProvisionerDetails{
+			Data: &linkedca.ProvisionerDetails_JWK{
+				JWK: &linkedca.JWKProvisioner{
+					PublicKey: publicKey,
+				},
+			},
+		},
+	}
+	var storedKeys [][]byte
+	a.adminDB = &admin.MockDB{
+		MockGetProvisioner: func(ctx context.Context, id string) (*linkedca.Provisioner, error) {
+			assert.Equal(t, p.GetID(), id)
+			return proto.Clone(stored).(*linkedca.Provisioner), nil
+		},
+		MockUpdateProvisioner: func(ctx context.Context, prov *linkedca.Provisioner) error {
+			stored = prov
+			return nil
+		},
+		MockGetProvisionerKeys: func(ctx context.Context, id string) ([][]byte, error) {
+			assert.Equal(t, p.GetID(), id)
+			return storedKeys, nil
+		},
+		MockUpdateProvisionerKeys: func(ctx context.Context, id string, keys [][]byte) error {
+			assert.Equal(t, p.GetID(), id)
+			storedKeys = keys
+			return nil
+		},
+		MockGetProvisionerState: func(ctx context.Context, id string) (string, error) {
+			return "", nil
+		},
+	}
+	kids := func(keys []*jose.JSONWebKey) []string {
+		var ret []string
+		for _, k := range keys {
+			ret = append(ret, k.KeyID)
+		}
+		return ret
+	}
+
+	// Add an additional key.
+	next := mustJSONWebKey(t)
+	keys, err := a.AddProvisionerKey(ctx, p, next, "", false)
+	require.NoError(t, err)
+	assert.Equal(t, []string{jwk.Key.KeyID, next.KeyID}, kids(keys))
+	assert.Equal(t, publicKey, stored.GetDetails().GetJWK().PublicKey)
+	assert.Len(t, storedKeys, 1)
+	_, ok := a.provisioners.LoadByTokenID("Max:" + next.KeyID)
+	assert.True(t, ok)
+
+	// Keys must be unique.
+	_, err = a.AddProvisionerKey(ctx, p, next, "", false)
+	assert.Error(t, err)
+
+	// Rotate the main key, the encrypted private key is required.
+	primary := mustJSONWebKey(t)
+	_, err = a.AddProvisionerKey(ctx, p, primary, "", true)
+	assert.Error(t, err)
+	keys, err = a.AddProvisionerKey(ctx, p, primary, "encrypted-key", true)
+	require.NoError(t, err)
+	assert.Equal(t, []string{primary.KeyID, next.KeyID, jwk.Key.KeyID}, kids(keys))
+	main := new(jose.JSONWebKey)
+	require.NoError(t, json.Unmarshal(stored.GetDetails().GetJWK().PublicKey, main))
+	assert.Equal(t, primary.KeyID, main.KeyID)
+	assert.Equal(t, []byte("encrypted-key"), stored.GetDetails().GetJWK().EncryptedPrivateKey)
+	assert.Len(t, storedKeys, 2)
+	p, err = a.LoadProvisionerByName("Max")
+	require.NoError(t, err)
+	assert.Equal(t, primary.KeyID, p.(*provisioner.JWK).Key.KeyID)
+
+	keys, err = a.GetProvisionerKeys(ctx, p)
+	require.NoError(t, err)
+	assert.Equal(t, []string{primary.KeyID, next.KeyID, jwk.Key.KeyID}, kids(keys))
+
+	// The main key cannot be removed.
+	_, err = a.RemoveProvisionerKey(ctx, p, primary.KeyID)
+	assert.Error(t, err)
+	_, err = a.RemoveProvisionerKey(ctx, p, "missing")
+	assert.Error(t, err)
+
+	// Retire the previous key.
+	keys, err = a.RemoveProvisionerKey(ctx, p, jwk.Key.KeyID)
+	require.NoError(t, err)
+	assert.Equal(t, []string{primary.KeyID, next.KeyID}, kids(keys))
+	assert.Len(t, storedKeys, 1)
+	_, ok = a.provisioners.LoadByTokenID("Max:" + jwk.Key.KeyID)
+	assert.False(t, ok)
+
+	// The keys are kept when the provisioner is updated.
+	require.NoError(t, a.UpdateProvisioner(ctx, proto.Clone(stored).(*linkedca.Provisioner)))
+	_, ok = a.provisioners.LoadByTokenID("Max:" + next.KeyID)
+	assert.True(t, ok)
+
+	// Only JWK provisioners have keys.
+	sshpop, err := a.LoadProvisionerByName("sshpop")
+	require.NoError(t, err)
+	_, err = a.RemoveProvisionerKey(ctx, sshpop, next.KeyID)
+	assert.Error(t, err)
+	_, err = a.GetProvisionerKeys(ctx, sshpop)
+	assert.Error(t, err)
+}
+
+func TestAuthority_AddProvisionerKey_notImplemented(t *testing.T) {
+	a := testAuthority(t)
+	p, err := a.LoadProvisionerByName("Max")
+	require.NoError(t, err)
+	a.adminDB = &linkedCaClient{}
+
+	var ae *admin.Error
+	_, err = a.AddProvisionerKey(context.Background(), p, mustJSONWebKey(t), "", false)
+	if assert.ErrorAs(t, err, &ae) {
+		assert.True(t, ae.IsType(admin.ErrorNotImplementedType))
+	}
+	_, err = a.GetProvisionerKeys(context.Background(), p)
+	if assert.ErrorAs(t, err, &ae) {
+		assert.True(t, ae.IsType(admin.ErrorNotImplementedType))
+	}
+}
+
+func Test_unmarshalJWKProvisionerKeys(t *testing.T) {
+	key := mustJSONWebKey(t)
+	other := mustJSONWebKey(t)
+
+	b, err := marshalJWKProvisionerKeys(nil)
+	require.NoError(t, err)
+	assert.Nil(t, b)
+	keys, err := unmarshalJWKProvisionerKeys(b)
+	require.NoError(t, err)
+	assert.Nil(t, keys)
+
+	b, err = marshalJWKProvisionerKeys([]*jose.JSONWebKey{key, other})
+	require.NoError(t, err)
+	assert.Len(t, b, 2)
+	keys, err = unmarshalJWKProvisionerKeys(b)
+	require.NoError(t, err)
+	if assert.Len(t, keys, 2) {
+		assert.Equal(t, key.KeyID, keys[0].KeyID)
+		assert.Equal(t, other.KeyID, keys[1].KeyID)
+	}
+
+	_, err = unmarshalJWKProvisionerKeys([][]byte{[]byte("foo")})
+	assert.Error(t, err)
+}
+
+func TestAuthority_migrateProvisionerKeys(t *testing.T) {
+	ctx := context.Background()
+	key := mustJSONWebKey(t)
+	other := mustJSONWebKey(t)
+	p := &provisioner.JWK{
+		Type:         "JWK",
+		Name:         "jwk",
+		Key:          key,
+		EncryptedKey: "encrypted-key",
+		Keys:         []*jose.JSONWebKey{other},
+	}
+
+	lp, err := ProvisionerToLinkedca(p)
+	require.NoError(t, err)
+	lp.Id = "prov-id"
+
+	var storedKeys [][]byte
+	a := &Authority{
+		adminDB: &admin.MockDB{
+			MockGetProvisionerKeys: func(ctx context.Context, id string) ([][]byte, error) {
+				assert.Equal(t, "prov-id", id)
+				return storedKeys, nil
+			},
+			MockUpdateProvisionerKeys: func(ctx context.Context, id string, keys [][]byte) error {
+				assert.Equal(t, "prov-id", id)
+				storedKeys = keys
+				return nil
+			},
+			MockGetProvisionerState: func(ctx context.Context, id string) (string, error) {
+				return "", nil
+			},
+		},
+	}
+	require.NoError(t, a.migrateProvisionerKeys(ctx, p, lp.Id))
+	assert.Len(t, storedKeys, 1)
+
+	// The keys are loaded with the provisioner.
+	got, err := a.linkedcaToCertificates(ctx, lp)
+	require.NoError(t, err)
+	jp := got.(*provisioner.JWK)
+	assert.Equal(t, key.KeyID, jp.Key.KeyID)
+	assert.Equal(t, "encrypted-key", jp.EncryptedKey)
+	if assert.Len(t, jp.Keys, 1) {
+		assert.Equal(t, other.KeyID, jp.Keys[0].KeyID)
+	}
+}
@@ -0,0 +1,142 @@
+package authority
+
+import (
+	"context"
+
+	"github.com/smallstep/certificates/authority/admin"
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+// GetProvisionerState returns the lifecycle state of a provisioner stored in
+// the admin database.
+func (a *Authority) GetProvisionerState(ctx context.Context, p provisioner.Interface) (provisioner.State, error) {
+	db, err := a.provisionerStateDB()
+	if err != nil {
+		return "", err
+	}
+	state, err := db.GetProvisionerState(ctx, p.GetID())
+	if err != nil {
+		return "", admin.WrapErrorISE(err, "error loading state of provisioner %s", p.GetName())
+	}
+	if state == "" {
+		return provisioner.StateActive, nil
+	}
+	return provisioner.State(state), nil
+}
+
+// UpdateProvisionerState sets the lifecycle state of a provisioner. The state
+// is stored in the admin database, separately from the provisioner, and it
+// applies to the provisioner immediately.
+func (a *Authority) UpdateProvisionerState(ctx context.Context, p provisioner.Interface, state provisioner.State) error {
+	a.adminMutex.Lock()
+	defer a.adminMutex.Unlock()
+
+	db, err := a.provisionerStateDB()
+	if err != nil {
+		return err
+	}
+	if err := state.Validate(); err != nil {
+		return admin.WrapError(admin.ErrorBadRequestType, err, "invalid state for provisioner %s", p.GetName())
+	}
+
+	prov, err := a.adminDB.GetProvisioner(ctx, p.GetID())
+	if err != nil {
+		return admin.WrapErrorISE(err, "error loading provisioner %s", p.GetName())
+	}
+	keys, err := a.loadProvisionerKeys(ctx, prov)
+	if err != nil {
+		return admin.WrapErrorISE(err, "error loading keys of provisioner %s", prov.Name)
+	}
+	certProv, err := provisionerToCertificates(prov, state, keys)
+	if err != nil {
+		return admin.WrapErrorISE(err,
+			"error converting to certificates provisioner from linkedca provisioner")
+	}
+	provisionerConfig, err := a.generateProvisionerConfig(ctx)
+	if err != nil {
+		return admin.WrapErrorISE(err, "error generating provisioner config")
+	}
+	if err := certProv.Init(provisionerConfig); err != nil {
+		return admin.WrapErrorISE(err, "error initializing provisioner %s", prov.Name)
+	}
+
+	if err := db.UpdateProvisionerState(ctx, prov.Id, string(state)); err != nil {
+		return admin.WrapErrorISE(err, "error updating state of provisioner %s", prov.Name)
+	}
+	if err := a.provisioners.Update(certProv); err != nil {
+		if err := a.ReloadAdminResources(ctx); err != nil {
+			return admin.WrapErrorISE(err, "error reloading admin resources on failed provisioner update")
+		}
+		return admin.WrapErrorISE(err, "error updating provisioner '%s' in authority cache", prov.Name)
+	}
+	return nil
+}
+
+// provisionerStateDB returns the admin database as a ProvisionerStateDB. The
+// linked CA does not store the lifecycle state of the provisioners.
+func (a *Authority) provisionerStateDB() (admin.ProvisionerStateDB, error) {
+	if db, ok := a.adminDB.(admin.ProvisionerStateDB); ok {
+		return db, nil
+	}
+	return nil, admin.NewError(admin.ErrorNotImplementedType, "provisioner states are not supported by the admin database")
+}
+
+// loadProvisionerState returns the lifecycle state of a provisioner stored in
+// the admin database, or an empty state if the admin database does not store
+// it.
+func (a *Authority) loadProvisionerState(ctx context.Context, id string) (provisioner.State, error) {
+	db, ok := a.adminDB.(admin.ProvisionerStateDB)
+	if !ok || id == "" {
+		return "", nil
+	}
+	state, err := db.GetProvisionerState(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	return provisioner.State(state), nil
+}
+
+// migrateProvisionerState stores the lifecycle state configured in the claims
+// of a provisioner migrated from the configuration to the admin database.
+func (a *Authority) migrateProvisionerState(ctx context.Context, p provisioner.Interface, id string) error {
+	c := provisionerClaims(p)
+	if c == nil || c.State == "" {
+		return nil
+	}
+	db, err := a.provisionerStateDB()
+	if err != nil {
+		return err
+	}
+	return db.UpdateProvisionerState(ctx, id, string(c.State))
+}
+
+// provisionerClaims returns the claims of the provisioners that can be
+// converted to linkedca provisioners.
+func provisionerClaims(p provisioner.Interface) *provisioner.Claims {
+	switch p := p.(type) {
+	case *provisioner.JWK:
+		return p.Claims
+	case *provisioner.OIDC:
+		return p.Claims
+	case *provisioner.GCP:
+		return p.Claims
+	case *provisioner.AWS:
+		return p.Claims
+	case *provisioner.Azure:
+		return p.Claims
+	case *provisioner.ACME:
+		return p.Claims
+	case *provisioner.X5C:
+		return p.Claims
+	case *provisioner.K8sSA:
+		return p.Claims
+	case *provisioner.SSHPOP:
+		return p.Claims
+	case *provisioner.SCEP:
+		return p.Claims
+	case *provisioner.Nebula:
+		return p.Claims
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,88 @@
+package authority
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.step.sm/linkedca"
+
+	"github.com/smallstep/certificates/authority/admin"
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+func TestAuthority_UpdateProvisionerState(t *testing.T) {
+	ctx := context.Background()
+	a := testAuthority(t)
+	p, err := a.LoadProvisionerByName("step-cli")
+	require.NoError(t, err)
+	lp, err := ProvisionerToLinkedca(p)
+	require.NoError(t, err)
+	lp.Id = p.GetID()
+
+	var state string
+	a.adminDB = &admin.MockDB{
+		MockGetProvisioner: func(ctx context.Context, id string) (*linkedca.Provisioner, error) {
+			assert.Equal(t, p.GetID(), id)
+			return lp, nil
+		},
+		MockGetProvisionerState: func(ctx context.Context, id string) (string, error) {
+			assert.Equal(t, p.GetID(), id)
+			return state, nil
+		},
+		MockUpdateProvisionerState: func(ctx context.Context, id, s string) error {
+			assert.Equal(t, p.GetID(), id)
+			state = s
+			return nil
+		},
+	}
+
+	got, err := a.GetProvisionerState(ctx, p)
+	require.NoError(t, err)
+	assert.Equal(t, provisioner.StateActive, got)
+
+	// The state applies to the provisioner in the authority.
+	require.NoError(t, a.UpdateProvisionerState(ctx, p, provisioner.StateDisabled))
+	assert.Equal(t, "disabled", state)
+	got, err = a.GetProvisionerState(ctx, p)
+	require.NoError(t, err)
+	assert.Equal(t, provisioner.StateDisabled, got)
+	p, err = a.LoadProvisionerByName("step-cli")
+	require.NoError(t, err)
+	_, err = p.AuthorizeSign(ctx, "token")
+	assert.ErrorContains(t, err, "disabled")
+
+	// The state is kept on provisioner updates.
+	require.NoError(t, a.UpdateProvisioner(ctx, lp))
+	p, err = a.LoadProvisionerByName("step-cli")
+	require.NoError(t, err)
+	_, err = p.AuthorizeSign(ctx, "token")
+	assert.ErrorContains(t, err, "disabled")
+
+	assert.Error(t, a.UpdateProvisionerState(ctx, p, "draining"))
+
+	a.adminDB.(*admin.MockDB).MockUpdateProvisionerState = func(ctx context.Context, id, s string) error {
+		return errors.New("force")
+	}
+	assert.Error(t, a.UpdateProvisionerState(ctx, p, provisioner.StateActive))
+}
+
+func TestAuthority_UpdateProvisionerState_notImplemented(t *testing.T) {
+	ctx := context.Background()
+	a := testAuthority(t)
+	p, err := a.LoadProvisionerByName("step-cli")
+	require.NoError(t, err)
+	a.adminDB = &linkedCaClient{}
+
+	var ae *admin.Error
+	_, err = a.GetProvisionerState(ctx, p)
+	if assert.ErrorAs(t, err, &ae) {
+		assert.True(t, ae.IsType(admin.ErrorNotImplementedType))
+	}
+	err = a.UpdateProvisionerState(ctx, p, provisioner.StateDisabled)
+	if assert.ErrorAs(t, err, &ae) {
+		assert.True(t, ae.IsType(admin.ErrorNotImplementedType))
+	}
+}
@@ -197,12 +197,15 @@ func (a *Authority) generateProvisionerConfig(ctx context.Context) (provisioner.
 			UserKeys: sshKeys.UserKeys,
 			HostKeys: sshKeys.HostKeys,
 		},
-		GetIdentityFunc:       a.getIdentityFunc,
-		AuthorizeRenewFunc:    a.authorizeRenewFunc,
-		AuthorizeSSHRenewFunc: a.authorizeSSHRenewFunc,
-		WebhookClient:         a.webhookClient,
-		HTTPClient:            a.httpClient,
-		SCEPKeyManager:        a.scepKeyManager,
+		GetIdentityFunc:             a.getIdentityFunc,
+		AuthorizeRenewFunc:          a.authorizeRenewFunc,
+		AuthorizeSSHRenewFunc:       a.authorizeSSHRenewFunc,
+		GetWebAuthnCredentialFunc:   a.getWebAuthnCredential,
+		UpdateWebAuthnSignCountFunc: a.updateWebAuthnSignCount,
+		ConsumeSCEPChallengeFunc:    a.consumeSCEPChallenge,
+		WebhookClient:               a.webhookClient,
+		HTTPClient:                  a.httpClient,
+		SCEPKeyManager:              a.scepKeyManager,
 	}, nil
 }
 
@@ -269,7 +272,9 @@ func (a *Authority) UpdateProvisioner(ctx context.Context, nu *linkedca.Provisio
 	a.adminMutex.Lock()
 	defer a.adminMutex.Unlock()
 
-	certProv, err := ProvisionerToCertificates(nu)
+	// The lifecycle state and the additional JWK keys are stored separately
+	// and they are kept.
+	certProv, err := a.linkedcaToCertificates(ctx, nu)
 	if err != nil {
 		return admin.WrapErrorISE(err,
 			"error converting to certificates provisioner from linkedca provisioner")
@@ -473,10 +478,10 @@ func ValidateDurations(d *linkedca.Durations) error {
 	return nil
 }
 
-func provisionerListToCertificates(l []*linkedca.Provisioner) (provisioner.List, error) {
+func (a *Authority) provisionerListToCertificates(ctx context.Context, l []*linkedca.Provisioner) (provisioner.List, error) {
 	var nu provisioner.List
 	for _, p := range l {
-		certProv, err := ProvisionerToCertificates(p)
+		certProv, err := a.linkedcaToCertificates(ctx, p)
 		if err != nil {
 			return nil, err
 		}
@@ -485,6 +490,21 @@ func provisionerListToCertificates(l []*linkedca.Provisioner) (provisioner.List,
 	return nu, nil
 }
 
+// linkedcaToCertificates converts the linkedca provisioner type to the
+// certificates provisioner interface, with the lifecycle state and the
+// additional JWK keys stored separately in the admin database.
+func (a *Authority) linkedcaToCertificates(ctx context.Context, p *linkedca.Provisioner) (provisioner.Interface, error) {
+	state, err := a.loadProvisionerState(ctx, p.Id)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := a.loadProvisionerKeys(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	return provisionerToCertificates(p, state, keys)
+}
+
 func optionsToCertificates(p *linkedca.Provisioner) *provisioner.Options {
 	ops := &provisioner.Options{
 		X509: &provisioner.X509Options{},
@@ -639,9 +659,13 @@ func durationsToLinkedca(d *provisioner.Duration) string {
 }
 
 // claimsToCertificates converts the linkedca provisioner claims type to the
-// certifictes claims type.
-func claimsToCertificates(c *linkedca.Claims) (*provisioner.Claims, error) {
+// certifictes claims type. The lifecycle state of the provisioner is not part
+// of the linkedca claims.
+func claimsToCertificates(c *linkedca.Claims, state provisioner.State) (*provisioner.Claims, error) {
 	if c == nil {
+		if state != "" {
+			return &provisioner.Claims{State: state}, nil
+		}
 		//nolint:nilnil // nil claims do not pose an issue.
 		return nil, nil
 	}
@@ -650,6 +674,7 @@ func claimsToCertificates(c *linkedca.Claims) (*provisioner.Claims, error) {
 		DisableRenewal:             &c.DisableRenewal,
 		AllowRenewalAfterExpiry:    &c.AllowRenewalAfterExpiry,
 		DisableSmallstepExtensions: &c.DisableSmallstepExtensions,
+		State:                      state,
 	}
 
 	var err error
@@ -822,7 +847,14 @@ func provisionerPEMToCertificates(bs [][]byte) []byte {
 // ProvisionerToCertificates converts the linkedca provisioner type to the certificates provisioner
 // interface.
 func ProvisionerToCertificates(p *linkedca.Provisioner) (provisioner.Interface, error) {
-	claims, err := claimsToCertificates(p.Claims)
+	return provisionerToCertificates(p, "", nil)
+}
+
+// provisionerToCertificates converts the linkedca provisioner type to the
+// certificates provisioner interface with the given lifecycle state and, on
+// JWK provisioners, the given additional keys.
+func provisionerToCertificates(p *linkedca.Provisioner, state provisioner.State, keys []*jose.JSONWebKey) (provisioner.Interface, error) {
+	claims, err := claimsToCertificates(p.Claims, state)
 	if err != nil {
 		return nil, err
 	}
@@ -846,6 +878,7 @@ func ProvisionerToCertificates(p *linkedca.Provisioner) (provisioner.Interface,
 			Name:         p.Name,
 			Key:          jwk,
 			EncryptedKey: string(d.JWK.EncryptedPrivateKey),
+			Keys:         keys,
 			Claims:       claims,
 			Options:      options,
 		}, nil
@@ -1379,3 +1412,31 @@ func attestationFormatsToLinkedca(formats []provisioner.ACMEAttestationFormat) [
 	}
 	return ret
 }
+
+// marshalJWKProvisionerKeys marshals the additional keys of a JWK
+// provisioner, each one as a JWK.
+func marshalJWKProvisionerKeys(keys []*jose.JSONWebKey) ([][]byte, error) {
+	var ret [][]byte
+	for _, k := range keys {
+		b, err := json.Marshal(k)
+		if err != nil {
+			return nil, errors.Wrap(err, "error marshaling key")
+		}
+		ret = append(ret, b)
+	}
+	return ret, nil
+}
+
+// unmarshalJWKProvisionerKeys unmarshals the additional keys of a JWK
+// provisioner.
+func unmarshalJWKProvisionerKeys(data [][]byte) ([]*jose.JSONWebKey, error) {
+	var keys []*jose.JSONWebKey
+	for _, b := range data {
+		key := new(jose.JSONWebKey)
+		if err := json.Unmarshal(b, key); err != nil {
+			return nil, errors.Wrap(err, "error unmarshaling public key")
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
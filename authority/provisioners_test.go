@@ -390,3 +390,34 @@ func Test_isRAProvisioner(t *testing.T) {
 		})
 	}
 }
+
+func Test_claimsState(t *testing.T) {
+	tests := []struct {
+		name  string
+		state provisioner.State
+	}{
+		{"empty", ""},
+		{"active", provisioner.StateActive},
+		{"renew-only", provisioner.StateRenewOnly},
+		{"disabled", provisioner.StateDisabled},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The state is not part of the linkedca claims.
+			lc := claimsToLinkedca(&provisioner.Claims{State: tt.state})
+			require.Empty(t, lc.ProtoReflect().GetUnknown())
+
+			pc, err := claimsToCertificates(lc, tt.state)
+			require.NoError(t, err)
+			require.Equal(t, tt.state, pc.State)
+
+			pc, err = claimsToCertificates(nil, tt.state)
+			require.NoError(t, err)
+			if tt.state == "" {
+				require.Nil(t, pc)
+			} else {
+				require.Equal(t, &provisioner.Claims{State: tt.state}, pc)
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package authority
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/smallstep/certificates/authority/provisioner"
+	casapi "github.com/smallstep/certificates/cas/apiv1"
+	"github.com/smallstep/certificates/db"
+	"github.com/smallstep/certificates/errs"
+)
+
+const (
+	// tokenRateLimitWindow is the window of the tokensPerMinute rate limit.
+	tokenRateLimitWindow = time.Minute
+	// certificateRateLimitWindow is the window of the certificatesPerDay
+	// quota.
+	certificateRateLimitWindow = 24 * time.Hour
+)
+
+// getRateLimitOptions returns the rate limits configured for the given
+// provisioner, if any.
+func getRateLimitOptions(p provisioner.Interface) *provisioner.RateLimitOptions {
+	if o, ok := p.(interface{ GetOptions() *provisioner.Options }); ok {
+		return o.GetOptions().GetRateLimitOptions()
+	}
+	return nil
+}
+
+// checkTokenRateLimit counts a token authorized by the given provisioner and
+// returns a casapi.TooManyRequestsError if the tokensPerMinute limit of the
+// provisioner has been exceeded. Tokens authorized again, with the token reuse
+// check disabled, are not counted.
+func (a *Authority) checkTokenRateLimit(ctx context.Context, p provisioner.Interface) error {
+	if SkipTokenReuseFromContext(ctx) {
+		return nil
+	}
+	if o := getRateLimitOptions(p); o != nil && o.TokensPerMinute > 0 {
+		return a.checkRateLimit("tokens/"+p.GetID(), o.TokensPerMinute, tokenRateLimitWindow,
+			"provisioner "+p.GetName()+" has exceeded its limit of tokens per minute")
+	}
+	return nil
+}
+
+// checkCertificateRateLimit counts a certificate signed by the given
+// provisioner and returns a casapi.TooManyRequestsError if the
+// certificatesPerDay quota of the provisioner has been exceeded.
+func (a *Authority) checkCertificateRateLimit(p provisioner.Interface) error {
+	if p == nil {
+		return nil
+	}
+	if o := getRateLimitOptions(p); o != nil && o.CertificatesPerDay > 0 {
+		return a.checkRateLimit("certs/"+p.GetID(), o.CertificatesPerDay, certificateRateLimitWindow,
+			"provisioner "+p.GetName()+" has exceeded its quota of certificates per day")
+	}
+	return nil
+}
+
+func (a *Authority) checkRateLimit(key string, limit int, window time.Duration, msg string) error {
+	rdb, ok := a.db.(db.RateLimitDB)
+	if !ok {
+		return errs.NotImplemented("the configured database does not support rate limits")
+	}
+	c, err := rdb.IncrementRateLimitCounter(key, window)
+	if err != nil {
+		return errs.Wrap(http.StatusInternalServerError, err, "error updating rate limit counter")
+	}
+	if c.Count > int64(limit) {
+		return casapi.TooManyRequestsError{
+			Message:    msg,
+			RetryAfter: time.Until(c.ResetAt),
+		}
+	}
+	return nil
+}
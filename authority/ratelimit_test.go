@@ -0,0 +1,98 @@
+package authority
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.step.sm/crypto/jose"
+
+	"github.com/smallstep/certificates/api/render"
+	"github.com/smallstep/certificates/authority/provisioner"
+	casapi "github.com/smallstep/certificates/cas/apiv1"
+	"github.com/smallstep/certificates/db"
+)
+
+func TestAuthority_Authorize_rateLimit(t *testing.T) {
+	a := testAuthority(t)
+	p, err := a.LoadProvisionerByName("step-cli")
+	require.NoError(t, err)
+	p.(*provisioner.JWK).Options = &provisioner.Options{
+		RateLimit: &provisioner.RateLimitOptions{TokensPerMinute: 2},
+	}
+
+	jwk, err := jose.ReadKey("testdata/secrets/step_cli_key_priv.jwk", jose.WithPassword([]byte("pass")))
+	require.NoError(t, err)
+	sig, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.ES256, Key: jwk.Key},
+		(&jose.SignerOptions{}).WithType("JWT").WithHeader("kid", jwk.KeyID))
+	require.NoError(t, err)
+
+	now := time.Now().UTC()
+	newToken := func(id string) string {
+		raw, err := jose.Signed(sig).Claims(jose.Claims{
+			Subject:   "test.smallstep.com",
+			Issuer:    "step-cli",
+			NotBefore: jose.NewNumericDate(now),
+			Expiry:    jose.NewNumericDate(now.Add(time.Minute)),
+			Audience:  []string{"https://example.com/sign"},
+			ID:        id,
+		}).CompactSerialize()
+		require.NoError(t, err)
+		return raw
+	}
+
+	ctx := provisioner.NewContextWithMethod(context.Background(), provisioner.SignMethod)
+	for _, id := range []string{"1", "2"} {
+		_, err := a.Authorize(ctx, newToken(id))
+		require.NoError(t, err)
+	}
+
+	_, err = a.Authorize(ctx, newToken("3"))
+	var tooManyErr casapi.TooManyRequestsError
+	require.True(t, errors.As(err, &tooManyErr))
+	assert.Equal(t, "provisioner step-cli has exceeded its limit of tokens per minute", tooManyErr.Message)
+	assert.True(t, tooManyErr.RetryAfter > 0 && tooManyErr.RetryAfter <= time.Minute)
+	var sc render.StatusCodedError
+	require.True(t, errors.As(err, &sc))
+	assert.Equal(t, http.StatusTooManyRequests, sc.StatusCode())
+
+	// Tokens authorized again are not counted.
+	_, err = a.Authorize(NewContextWithSkipTokenReuse(ctx), newToken("2"))
+	assert.NoError(t, err)
+
+	// Other provisioners are not limited.
+	p.(*provisioner.JWK).Options = nil
+	_, err = a.Authorize(ctx, newToken("4"))
+	assert.NoError(t, err)
+}
+
+func TestAuthority_checkCertificateRateLimit(t *testing.T) {
+	a := testAuthority(t)
+	p, err := a.LoadProvisionerByName("step-cli")
+	require.NoError(t, err)
+
+	// Nil provisioners and provisioners without limits are not limited.
+	assert.NoError(t, a.checkCertificateRateLimit(nil))
+	assert.NoError(t, a.checkCertificateRateLimit(p))
+
+	p.(*provisioner.JWK).Options = &provisioner.Options{
+		RateLimit: &provisioner.RateLimitOptions{CertificatesPerDay: 1},
+	}
+	assert.NoError(t, a.checkCertificateRateLimit(p))
+	err = a.checkCertificateRateLimit(p)
+	var tooManyErr casapi.TooManyRequestsError
+	require.True(t, errors.As(err, &tooManyErr))
+	assert.Equal(t, "provisioner step-cli has exceeded its quota of certificates per day", tooManyErr.Message)
+	assert.True(t, tooManyErr.RetryAfter > 23*time.Hour && tooManyErr.RetryAfter <= 24*time.Hour)
+
+	// Databases without support for rate limits.
+	a.db = &db.MockAuthDB{}
+	err = a.checkCertificateRateLimit(p)
+	var sc render.StatusCodedError
+	require.True(t, errors.As(err, &sc))
+	assert.Equal(t, http.StatusNotImplemented, sc.StatusCode())
+}
@@ -0,0 +1,140 @@
+package authority
+
+import (
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+
+	"github.com/smallstep/certificates/authority/admin"
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/db"
+	"github.com/smallstep/certificates/errs"
+)
+
+// migratedProvisioner is the provisioner used to renew the certificates of a
+// deleted provisioner with a migrate renewal policy.
+type migratedProvisioner struct {
+	provisioner.Interface
+	from string
+}
+
+// toExtension returns the provisioner extension added to the renewed
+// certificates, replacing the extension of the deleted provisioner.
+func (p *migratedProvisioner) toExtension() (pkix.Extension, error) {
+	kid, _, _ := p.GetEncryptedKey()
+	return (&provisioner.Extension{
+		Type:         p.GetType(),
+		Name:         p.GetName(),
+		CredentialID: kid,
+	}).ToExtension()
+}
+
+// loadDeletedProvisioner returns the provisioner used to renew a certificate
+// signed by a provisioner that no longer exists, following the renewal
+// policy of the deleted provisioner. Certificates without a policy cannot be
+// renewed.
+func (a *Authority) loadDeletedProvisioner(cert *x509.Certificate) (provisioner.Interface, error) {
+	opts := []interface{}{errs.WithKeyVal("serialNumber", cert.SerialNumber.String())}
+	ext, ok := provisioner.GetProvisionerExtension(cert)
+	if !ok {
+		return nil, errs.Unauthorized("authority.authorizeRenew: provisioner not found", opts...)
+	}
+	rdb, ok := a.db.(db.RenewalPolicyDB)
+	if !ok {
+		return nil, errs.Unauthorized("authority.authorizeRenew: provisioner not found", opts...)
+	}
+	policy, err := rdb.GetRenewalPolicy(ext.Name)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "authority.authorizeRenew", opts...)
+	}
+	if policy == nil {
+		return nil, errs.Unauthorized("authority.authorizeRenew: provisioner not found", opts...)
+	}
+
+	switch policy.Action {
+	case db.RenewalPolicySunset:
+		return provisioner.NewDeleted(ext, policy.SunsetAt), nil
+	case db.RenewalPolicyMigrate:
+		p, ok := a.provisioners.LoadByName(policy.MigrateTo)
+		if !ok {
+			return nil, errs.Unauthorized("authority.authorizeRenew: provisioner '%s' not found", policy.MigrateTo, opts[0])
+		}
+		return &migratedProvisioner{Interface: p, from: ext.Name}, nil
+	default:
+		return nil, errs.Unauthorized("authority.authorizeRenew: renewal of certificates of deleted provisioner '%s' is denied", ext.Name, opts[0])
+	}
+}
+
+// GetRenewalPolicies returns the renewal policies of the deleted
+// provisioners.
+func (a *Authority) GetRenewalPolicies(context.Context) ([]*db.RenewalPolicy, error) {
+	rdb, err := a.renewalPolicyDB()
+	if err != nil {
+		return nil, err
+	}
+	policies, err := rdb.GetRenewalPolicies()
+	if err != nil {
+		return nil, admin.WrapErrorISE(err, "error retrieving renewal policies")
+	}
+	return policies, nil
+}
+
+// GetRenewalPolicy returns the renewal policy of the provisioner with the
+// given name.
+func (a *Authority) GetRenewalPolicy(_ context.Context, name string) (*db.RenewalPolicy, error) {
+	rdb, err := a.renewalPolicyDB()
+	if err != nil {
+		return nil, err
+	}
+	policy, err := rdb.GetRenewalPolicy(name)
+	if err != nil {
+		return nil, admin.WrapErrorISE(err, "error retrieving renewal policy for provisioner %s", name)
+	}
+	if policy == nil {
+		return nil, admin.NewError(admin.ErrorNotFoundType, "renewal policy for provisioner %s not found", name)
+	}
+	return policy, nil
+}
+
+// StoreRenewalPolicy stores the renewal policy of a provisioner. The policy
+// is only used after the provisioner is deleted, so it can be created before
+// or after the deletion.
+func (a *Authority) StoreRenewalPolicy(_ context.Context, policy *db.RenewalPolicy) error {
+	if err := policy.Validate(); err != nil {
+		return admin.WrapError(admin.ErrorBadRequestType, err, "invalid renewal policy")
+	}
+	if policy.Action == db.RenewalPolicyMigrate {
+		if _, ok := a.provisioners.LoadByName(policy.MigrateTo); !ok {
+			return admin.NewError(admin.ErrorBadRequestType, "provisioner %s not found", policy.MigrateTo)
+		}
+	}
+	rdb, err := a.renewalPolicyDB()
+	if err != nil {
+		return err
+	}
+	if err := rdb.StoreRenewalPolicy(policy); err != nil {
+		return admin.WrapErrorISE(err, "error storing renewal policy for provisioner %s", policy.Provisioner)
+	}
+	return nil
+}
+
+// RemoveRenewalPolicy deletes the renewal policy of the provisioner with the
+// given name.
+func (a *Authority) RemoveRenewalPolicy(_ context.Context, name string) error {
+	rdb, err := a.renewalPolicyDB()
+	if err != nil {
+		return err
+	}
+	if err := rdb.DeleteRenewalPolicy(name); err != nil {
+		return admin.WrapErrorISE(err, "error deleting renewal policy for provisioner %s", name)
+	}
+	return nil
+}
+
+func (a *Authority) renewalPolicyDB() (db.RenewalPolicyDB, error) {
+	if rdb, ok := a.db.(db.RenewalPolicyDB); ok {
+		return rdb, nil
+	}
+	return nil, admin.NewError(admin.ErrorNotImplementedType, "the configured database does not support renewal policies")
+}
@@ -0,0 +1,206 @@
+package authority
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/smallstep/certificates/api/render"
+	"github.com/smallstep/certificates/authority/admin"
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/db"
+)
+
+type mockRenewalPolicyDB struct {
+	*db.MockAuthDB
+	policies map[string]*db.RenewalPolicy
+	stored   []*x509.Certificate
+	err      error
+}
+
+func newMockRenewalPolicyDB() *mockRenewalPolicyDB {
+	m := &mockRenewalPolicyDB{policies: map[string]*db.RenewalPolicy{}}
+	m.MockAuthDB = &db.MockAuthDB{
+		MIsRevoked: func(string) (bool, error) { return false, nil },
+		MStoreCertificate: func(crt *x509.Certificate) error {
+			m.stored = append(m.stored, crt)
+			return nil
+		},
+	}
+	return m
+}
+
+func (m *mockRenewalPolicyDB) GetRenewalPolicy(name string) (*db.RenewalPolicy, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	return m.policies[name], nil
+}
+
+func (m *mockRenewalPolicyDB) GetRenewalPolicies() ([]*db.RenewalPolicy, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	var policies []*db.RenewalPolicy
+	for _, p := range m.policies {
+		policies = append(policies, p)
+	}
+	return policies, nil
+}
+
+func (m *mockRenewalPolicyDB) StoreRenewalPolicy(p *db.RenewalPolicy) error {
+	if m.err != nil {
+		return m.err
+	}
+	m.policies[p.Provisioner] = p
+	return nil
+}
+
+func (m *mockRenewalPolicyDB) DeleteRenewalPolicy(name string) error {
+	if m.err != nil {
+		return m.err
+	}
+	delete(m.policies, name)
+	return nil
+}
+
+func TestAuthority_Renew_deletedProvisioner(t *testing.T) {
+	a := testAuthority(t)
+	mdb := newMockRenewalPolicyDB()
+	a.db = mdb
+
+	now := time.Now().UTC()
+	cert := generateCertificate(t, "renew", []string{"test.smallstep.com"},
+		withNotBeforeNotAfter(now.Add(-time.Minute), now.Add(time.Hour)),
+		withProvisionerOID("deleted", "deleted-kid"),
+		withSigner(getDefaultIssuer(a), getDefaultSigner(a)))
+
+	assertUnauthorized := func(t *testing.T, err error, msg string) {
+		t.Helper()
+		var sc render.StatusCodedError
+		require.True(t, errors.As(err, &sc), "unexpected error %v", err)
+		assert.Equal(t, http.StatusUnauthorized, sc.StatusCode())
+		assert.ErrorContains(t, err, msg)
+	}
+
+	t.Run("fail/no-policy", func(t *testing.T) {
+		_, err := a.Renew(cert)
+		assertUnauthorized(t, err, "provisioner not found")
+	})
+
+	t.Run("fail/deny", func(t *testing.T) {
+		mdb.policies["deleted"] = &db.RenewalPolicy{Provisioner: "deleted", Action: db.RenewalPolicyDeny}
+		_, err := a.Renew(cert)
+		assertUnauthorized(t, err, "renewal of certificates of deleted provisioner 'deleted' is denied")
+	})
+
+	t.Run("fail/sunset", func(t *testing.T) {
+		mdb.policies["deleted"] = &db.RenewalPolicy{Provisioner: "deleted", Action: db.RenewalPolicySunset, SunsetAt: now.Add(-time.Minute)}
+		_, err := a.Renew(cert)
+		assertUnauthorized(t, err, "renewal of certificates of deleted provisioner 'deleted' ended on")
+	})
+
+	t.Run("ok/sunset", func(t *testing.T) {
+		mdb.policies["deleted"] = &db.RenewalPolicy{Provisioner: "deleted", Action: db.RenewalPolicySunset, SunsetAt: now.Add(time.Hour)}
+		chain, err := a.Renew(cert)
+		require.NoError(t, err)
+		ext, ok := provisioner.GetProvisionerExtension(chain[0])
+		require.True(t, ok)
+		assert.Equal(t, "deleted", ext.Name)
+	})
+
+	t.Run("fail/migrate-not-found", func(t *testing.T) {
+		mdb.policies["deleted"] = &db.RenewalPolicy{Provisioner: "deleted", Action: db.RenewalPolicyMigrate, MigrateTo: "missing"}
+		_, err := a.Renew(cert)
+		assertUnauthorized(t, err, "provisioner 'missing' not found")
+	})
+
+	t.Run("fail/migrate-renew-disabled", func(t *testing.T) {
+		mdb.policies["deleted"] = &db.RenewalPolicy{Provisioner: "deleted", Action: db.RenewalPolicyMigrate, MigrateTo: "dev"}
+		_, err := a.Renew(cert)
+		assertUnauthorized(t, err, "renew is disabled for provisioner 'dev'")
+	})
+
+	t.Run("ok/migrate", func(t *testing.T) {
+		mdb.policies["deleted"] = &db.RenewalPolicy{Provisioner: "deleted", Action: db.RenewalPolicyMigrate, MigrateTo: "step-cli"}
+		mdb.stored = nil
+		chain, err := a.Renew(cert)
+		require.NoError(t, err)
+		ext, ok := provisioner.GetProvisionerExtension(chain[0])
+		require.True(t, ok)
+		p, err := a.LoadProvisionerByName("step-cli")
+		require.NoError(t, err)
+		kid, _, _ := p.GetEncryptedKey()
+		assert.Equal(t, &provisioner.Extension{Type: provisioner.TypeJWK, Name: "step-cli", CredentialID: kid}, ext)
+		assert.Equal(t, []*x509.Certificate{chain[0]}, mdb.stored)
+
+		// The renewed certificate is renewed by the new provisioner.
+		delete(mdb.policies, "deleted")
+		_, err = a.Renew(chain[0])
+		require.NoError(t, err)
+	})
+
+	t.Run("fail/database", func(t *testing.T) {
+		mdb.err = errors.New("force")
+		defer func() { mdb.err = nil }()
+		_, err := a.Renew(cert)
+		var sc render.StatusCodedError
+		require.True(t, errors.As(err, &sc))
+		assert.Equal(t, http.StatusInternalServerError, sc.StatusCode())
+	})
+}
+
+func TestAuthority_RenewalPolicies(t *testing.T) {
+	ctx := context.Background()
+	a := testAuthority(t)
+	mdb := newMockRenewalPolicyDB()
+	a.db = mdb
+
+	assertAdminError := func(t *testing.T, err error, code int) {
+		t.Helper()
+		var adminErr *admin.Error
+		require.True(t, errors.As(err, &adminErr), "unexpected error %v", err)
+		assert.Equal(t, code, adminErr.StatusCode())
+	}
+
+	_, err := a.GetRenewalPolicy(ctx, "deleted")
+	assertAdminError(t, err, http.StatusNotFound)
+
+	policy := &db.RenewalPolicy{Provisioner: "deleted", Action: db.RenewalPolicyMigrate, MigrateTo: "step-cli"}
+	require.NoError(t, a.StoreRenewalPolicy(ctx, policy))
+	got, err := a.GetRenewalPolicy(ctx, "deleted")
+	require.NoError(t, err)
+	assert.Equal(t, policy, got)
+	policies, err := a.GetRenewalPolicies(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []*db.RenewalPolicy{policy}, policies)
+
+	assertAdminError(t, a.StoreRenewalPolicy(ctx, &db.RenewalPolicy{Provisioner: "deleted", Action: "allow"}), http.StatusBadRequest)
+	assertAdminError(t, a.StoreRenewalPolicy(ctx, &db.RenewalPolicy{Provisioner: "deleted", Action: db.RenewalPolicyMigrate, MigrateTo: "missing"}), http.StatusBadRequest)
+
+	require.NoError(t, a.RemoveRenewalPolicy(ctx, "deleted"))
+	_, err = a.GetRenewalPolicy(ctx, "deleted")
+	assertAdminError(t, err, http.StatusNotFound)
+
+	mdb.err = errors.New("force")
+	_, err = a.GetRenewalPolicies(ctx)
+	assertAdminError(t, err, http.StatusInternalServerError)
+	_, err = a.GetRenewalPolicy(ctx, "deleted")
+	assertAdminError(t, err, http.StatusInternalServerError)
+	assertAdminError(t, a.StoreRenewalPolicy(ctx, policy), http.StatusInternalServerError)
+	assertAdminError(t, a.RemoveRenewalPolicy(ctx, "deleted"), http.StatusInternalServerError)
+
+	a.db = mdb.MockAuthDB
+	_, err = a.GetRenewalPolicies(ctx)
+	assertAdminError(t, err, http.StatusNotImplemented)
+	_, err = a.GetRenewalPolicy(ctx, "deleted")
+	assertAdminError(t, err, http.StatusNotImplemented)
+	assertAdminError(t, a.StoreRenewalPolicy(ctx, policy), http.StatusNotImplemented)
+	assertAdminError(t, a.RemoveRenewalPolicy(ctx, "deleted"), http.StatusNotImplemented)
+}
@@ -1,6 +1,7 @@
 package authority
 
 import (
+	"bytes"
 	"crypto/x509"
 
 	"github.com/smallstep/certificates/errs"
@@ -65,6 +66,8 @@ func (a *Authority) GetFederation() (federation []*x509.Certificate, err error)
 // Authority Service (CAS) that does not implement the
 // CertificateAuthorityGetter interface.
 func (a *Authority) GetIntermediateCertificate() *x509.Certificate {
+	a.x509IssuerMutex.RLock()
+	defer a.x509IssuerMutex.RUnlock()
 	if len(a.intermediateX509Certs) > 0 {
 		return a.intermediateX509Certs[0]
 	}
@@ -78,5 +81,40 @@ func (a *Authority) GetIntermediateCertificate() *x509.Certificate {
 // Certificate Authority Service (CAS) that does not implement the
 // CertificateAuthorityGetter interface.
 func (a *Authority) GetIntermediateCertificates() []*x509.Certificate {
+	a.x509IssuerMutex.RLock()
+	defer a.x509IssuerMutex.RUnlock()
 	return a.intermediateX509Certs
 }
+
+// GetAlternateX509Chains returns the alternate chains configured for the given
+// certificate chain, where the first certificate is the leaf. Each alternate
+// chain returned contains the leaf followed by the alternate intermediates.
+// Alternate chains whose issuer does not match the leaf, or that are the same
+// as the given one, are skipped.
+func (a *Authority) GetAlternateX509Chains(chain []*x509.Certificate) [][]*x509.Certificate {
+	if len(chain) == 0 {
+		return nil
+	}
+
+	leaf := chain[0]
+	var alternates [][]*x509.Certificate
+	for _, alt := range a.alternateX509Chains {
+		if len(alt) == 0 || !isIssuedBy(leaf, alt[0]) {
+			continue
+		}
+		if len(chain) > 1 && bytes.Equal(chain[1].Raw, alt[0].Raw) {
+			continue
+		}
+		alternates = append(alternates, append([]*x509.Certificate{leaf}, alt...))
+	}
+	return alternates
+}
+
+// isIssuedBy returns true if the issuer and authority key identifier of the
+// certificate match the subject and subject key identifier of the issuer.
+func isIssuedBy(cert, issuer *x509.Certificate) bool {
+	if !bytes.Equal(cert.RawIssuer, issuer.RawSubject) {
+		return false
+	}
+	return len(cert.AuthorityKeyId) == 0 || bytes.Equal(cert.AuthorityKeyId, issuer.SubjectKeyId)
+}
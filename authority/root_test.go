@@ -14,6 +14,7 @@ import (
 	"go.step.sm/crypto/keyutil"
 	"go.step.sm/crypto/minica"
 	"go.step.sm/crypto/pemutil"
+	"go.step.sm/crypto/x509util"
 )
 
 func TestRoot(t *testing.T) {
@@ -215,3 +216,61 @@ func TestAuthority_GetIntermediateCertificate(t *testing.T) {
 		})
 	}
 }
+
+func TestAuthority_GetAlternateX509Chains(t *testing.T) {
+	ca, err := minica.New()
+	require.NoError(t, err)
+	newCA, err := minica.New(minica.WithName("New"))
+	require.NoError(t, err)
+
+	// Cross-sign the intermediate with the new root.
+	crossSigned, err := x509util.CreateCertificate(&x509.Certificate{
+		RawSubject:            ca.Intermediate.RawSubject,
+		SubjectKeyId:          ca.Intermediate.SubjectKeyId,
+		NotBefore:             ca.Intermediate.NotBefore,
+		NotAfter:              ca.Intermediate.NotAfter,
+		KeyUsage:              ca.Intermediate.KeyUsage,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}, newCA.Root, ca.Intermediate.PublicKey, newCA.RootSigner)
+	require.NoError(t, err)
+
+	signer, err := keyutil.GenerateDefaultSigner()
+	require.NoError(t, err)
+	leaf, err := ca.Sign(&x509.Certificate{
+		Subject:   pkix.Name{CommonName: "leaf"},
+		PublicKey: signer.Public(),
+	})
+	require.NoError(t, err)
+
+	alternateChains := [][]*x509.Certificate{
+		{newCA.Intermediate, newCA.Root},
+		{crossSigned, newCA.Root},
+		{ca.Intermediate, ca.Root},
+		{},
+	}
+	tests := []struct {
+		name                string
+		alternateX509Chains [][]*x509.Certificate
+		chain               []*x509.Certificate
+		want                [][]*x509.Certificate
+	}{
+		{"ok", alternateChains, []*x509.Certificate{leaf, ca.Intermediate}, [][]*x509.Certificate{
+			{leaf, crossSigned, newCA.Root},
+		}},
+		{"ok leaf only", alternateChains, []*x509.Certificate{leaf}, [][]*x509.Certificate{
+			{leaf, crossSigned, newCA.Root},
+			{leaf, ca.Intermediate, ca.Root},
+		}},
+		{"ok no alternate chains", nil, []*x509.Certificate{leaf, ca.Intermediate}, nil},
+		{"ok no chain", alternateChains, nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &Authority{
+				alternateX509Chains: tt.alternateX509Chains,
+			}
+			assert.Equals(t, tt.want, a.GetAlternateX509Chains(tt.chain))
+		})
+	}
+}
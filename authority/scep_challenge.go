@@ -0,0 +1,121 @@
+package authority
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.step.sm/crypto/randutil"
+
+	"github.com/smallstep/certificates/authority/admin"
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/db"
+)
+
+// scepChallengeLength is the number of characters of the SCEP dynamic
+// challenges.
+const scepChallengeLength = 32
+
+func (a *Authority) scepChallengeDB() (db.SCEPChallengeDB, error) {
+	if sdb, ok := a.db.(db.SCEPChallengeDB); ok {
+		return sdb, nil
+	}
+	return nil, admin.NewError(admin.ErrorNotImplementedType, "the configured database does not support scep dynamic challenges")
+}
+
+// consumeSCEPChallenge is the provisioner.ConsumeSCEPChallengeFunc used by
+// SCEP provisioners to validate the dynamic challenges generated with the
+// admin API.
+func (a *Authority) consumeSCEPChallenge(_ context.Context, p provisioner.Interface, challenge string) error {
+	if challenge == "" {
+		return errors.New("challenge password cannot be empty")
+	}
+	sdb, err := a.scepChallengeDB()
+	if err != nil {
+		return err
+	}
+	return sdb.ConsumeSCEPChallenge(p.GetID(), provisioner.SCEPDynamicChallengeID(challenge), time.Now().UTC())
+}
+
+// loadSCEPDynamicProvisioner returns the given provisioner as a SCEP
+// provisioner with dynamic challenges enabled.
+func loadSCEPDynamicProvisioner(p provisioner.Interface) (*provisioner.SCEP, error) {
+	sp, ok := p.(*provisioner.SCEP)
+	if !ok {
+		return nil, admin.NewError(admin.ErrorBadRequestType, "provisioner %s is not a scep provisioner", p.GetName())
+	}
+	if sp.DynamicChallenges == nil {
+		return nil, admin.NewError(admin.ErrorBadRequestType, "provisioner %s does not have dynamic challenges enabled", p.GetName())
+	}
+	return sp, nil
+}
+
+// CreateSCEPChallenge generates a new single-use challenge password for the
+// given SCEP provisioner. If ttl is 0, the default lifetime of the
+// provisioner is used. The challenge password is only returned here, the
+// database only keeps a digest of it.
+func (a *Authority) CreateSCEPChallenge(_ context.Context, p provisioner.Interface, ttl time.Duration) (string, *provisioner.SCEPDynamicChallenge, error) {
+	sp, err := loadSCEPDynamicProvisioner(p)
+	if err != nil {
+		return "", nil, err
+	}
+	if ttl < 0 {
+		return "", nil, admin.NewError(admin.ErrorBadRequestType, "ttl cannot be negative")
+	}
+	if ttl == 0 {
+		ttl = sp.DynamicChallenges.GetTTL()
+	}
+	sdb, err := a.scepChallengeDB()
+	if err != nil {
+		return "", nil, err
+	}
+
+	challenge, err := randutil.Alphanumeric(scepChallengeLength)
+	if err != nil {
+		return "", nil, admin.WrapErrorISE(err, "error generating scep challenge")
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+	ch := &provisioner.SCEPDynamicChallenge{
+		ID:            provisioner.SCEPDynamicChallengeID(challenge),
+		ProvisionerID: sp.GetID(),
+		CreatedAt:     now,
+		ExpiresAt:     now.Add(ttl),
+	}
+	if err := sdb.StoreSCEPChallenge(ch); err != nil {
+		return "", nil, admin.WrapErrorISE(err, "error storing scep challenge")
+	}
+	return challenge, ch, nil
+}
+
+// GetSCEPChallenges returns the dynamic challenges of the given SCEP
+// provisioner.
+func (a *Authority) GetSCEPChallenges(_ context.Context, p provisioner.Interface) ([]*provisioner.SCEPDynamicChallenge, error) {
+	if _, err := loadSCEPDynamicProvisioner(p); err != nil {
+		return nil, err
+	}
+	sdb, err := a.scepChallengeDB()
+	if err != nil {
+		return nil, err
+	}
+	challenges, err := sdb.GetSCEPChallenges(p.GetID())
+	if err != nil {
+		return nil, admin.WrapErrorISE(err, "error loading scep challenges")
+	}
+	return challenges, nil
+}
+
+// RemoveSCEPChallenge removes a dynamic challenge of the given SCEP
+// provisioner, revoking it if it has not been used yet.
+func (a *Authority) RemoveSCEPChallenge(_ context.Context, p provisioner.Interface, id string) error {
+	if _, err := loadSCEPDynamicProvisioner(p); err != nil {
+		return err
+	}
+	sdb, err := a.scepChallengeDB()
+	if err != nil {
+		return err
+	}
+	if err := sdb.DeleteSCEPChallenge(p.GetID(), id); err != nil {
+		return admin.WrapErrorISE(err, "error deleting scep challenge")
+	}
+	return nil
+}
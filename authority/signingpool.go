@@ -0,0 +1,104 @@
+package authority
+
+import (
+	"crypto"
+	"io"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.step.sm/crypto/kms"
+	kmsapi "go.step.sm/crypto/kms/apiv1"
+
+	certkms "github.com/smallstep/certificates/kms"
+)
+
+// signingPool limits the number of concurrent signatures made with the
+// signers of a KMS. All the signers created by the same key manager share the
+// pool.
+type signingPool struct {
+	slots   chan struct{}
+	timeout time.Duration
+}
+
+func newSigningPool(maxConcurrency int, timeout time.Duration) *signingPool {
+	return &signingPool{
+		slots:   make(chan struct{}, maxConcurrency),
+		timeout: timeout,
+	}
+}
+
+// sign waits for a free slot and signs the digest with the given signer. If
+// the pool has a timeout and no slot is available before it expires, it
+// returns an error without calling the signer.
+func (p *signingPool) sign(s crypto.Signer, rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	var expired <-chan time.Time
+	if p.timeout > 0 {
+		t := time.NewTimer(p.timeout)
+		defer t.Stop()
+		expired = t.C
+	}
+
+	select {
+	case p.slots <- struct{}{}:
+	case <-expired:
+		return nil, errors.Errorf("timeout waiting for the kms after %s", p.timeout)
+	}
+	defer func() { <-p.slots }()
+
+	return s.Sign(rand, digest, opts)
+}
+
+type pooledKeyManager struct {
+	kms.KeyManager
+	pool *signingPool
+}
+
+type pooledKeyAndDecrypterManager struct {
+	kms.KeyManager
+	decrypter kmsapi.Decrypter
+}
+
+func newPooledKeyManager(k kms.KeyManager, pool *signingPool) kms.KeyManager {
+	decrypter, isDecrypter := k.(kmsapi.Decrypter)
+	switch {
+	case isDecrypter:
+		return &pooledKeyAndDecrypterManager{&pooledKeyManager{k, pool}, decrypter}
+	default:
+		return &pooledKeyManager{k, pool}
+	}
+}
+
+func (p *pooledKeyManager) CreateSigner(req *kmsapi.CreateSignerRequest) (s crypto.Signer, err error) {
+	if s, err = p.KeyManager.CreateSigner(req); err == nil {
+		s = &pooledSigner{s, p.pool}
+	}
+
+	return
+}
+
+// RotateKey implements kms.KeyRotator using the wrapped key manager.
+func (p *pooledKeyManager) RotateKey(req *certkms.RotateKeyRequest) (*kmsapi.CreateKeyResponse, error) {
+	return certkms.RotateKey(p.KeyManager, req)
+}
+
+// RotateKey implements kms.KeyRotator using the wrapped key manager.
+func (p *pooledKeyAndDecrypterManager) RotateKey(req *certkms.RotateKeyRequest) (*kmsapi.CreateKeyResponse, error) {
+	return certkms.RotateKey(p.KeyManager, req)
+}
+
+func (p *pooledKeyAndDecrypterManager) CreateDecrypter(req *kmsapi.CreateDecrypterRequest) (crypto.Decrypter, error) {
+	return p.decrypter.CreateDecrypter(req)
+}
+
+type pooledSigner struct {
+	crypto.Signer
+	pool *signingPool
+}
+
+func (p *pooledSigner) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	return p.pool.sign(p.Signer, rand, digest, opts)
+}
+
+var _ kms.KeyManager = (*pooledKeyManager)(nil)
+var _ kms.KeyManager = (*pooledKeyAndDecrypterManager)(nil)
+var _ kmsapi.Decrypter = (*pooledKeyAndDecrypterManager)(nil)
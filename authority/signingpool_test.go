@@ -0,0 +1,114 @@
+package authority
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"io"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	kmsapi "go.step.sm/crypto/kms/apiv1"
+	"go.step.sm/crypto/kms/softkms"
+)
+
+// slowSigner is a signer that blocks until release is closed, and records the
+// maximum number of concurrent signatures.
+type slowSigner struct {
+	crypto.Signer
+	release chan struct{}
+	current atomic.Int32
+	max     atomic.Int32
+}
+
+func (s *slowSigner) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	n := s.current.Add(1)
+	defer s.current.Add(-1)
+	for {
+		m := s.max.Load()
+		if n <= m || s.max.CompareAndSwap(m, n) {
+			break
+		}
+	}
+	<-s.release
+	return s.Signer.Sign(rand, digest, opts)
+}
+
+func Test_signingPool(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	digest := sha256.Sum256([]byte("message"))
+
+	t.Run("maxConcurrency", func(t *testing.T) {
+		s := &slowSigner{Signer: key, release: make(chan struct{})}
+		pool := newSigningPool(2, 0)
+
+		var wg sync.WaitGroup
+		for i := 0; i < 5; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				sig, err := pool.sign(s, rand.Reader, digest[:], crypto.SHA256)
+				assert.NoError(t, err)
+				assert.True(t, ecdsa.VerifyASN1(&key.PublicKey, digest[:], sig))
+			}()
+		}
+		require.Eventually(t, func() bool {
+			return s.current.Load() == 2
+		}, time.Second, time.Millisecond)
+		close(s.release)
+		wg.Wait()
+		assert.Equal(t, int32(2), s.max.Load())
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		s := &slowSigner{Signer: key, release: make(chan struct{})}
+		pool := newSigningPool(1, 10*time.Millisecond)
+
+		done := make(chan error)
+		go func() {
+			_, err := pool.sign(s, rand.Reader, digest[:], crypto.SHA256)
+			done <- err
+		}()
+		require.Eventually(t, func() bool {
+			return s.current.Load() == 1
+		}, time.Second, time.Millisecond)
+
+		_, err := pool.sign(s, rand.Reader, digest[:], crypto.SHA256)
+		assert.ErrorContains(t, err, "timeout waiting for the kms")
+
+		close(s.release)
+		assert.NoError(t, <-done)
+	})
+}
+
+func Test_newPooledKeyManager(t *testing.T) {
+	km, err := softkms.New(context.Background(), kmsapi.Options{})
+	require.NoError(t, err)
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	k := newPooledKeyManager(km, newSigningPool(1, 0))
+	_, ok := k.(kmsapi.Decrypter)
+	assert.True(t, ok)
+
+	signer, err := k.CreateSigner(&kmsapi.CreateSignerRequest{Signer: key})
+	require.NoError(t, err)
+	assert.IsType(t, &pooledSigner{}, signer)
+	assert.Equal(t, key.Public(), signer.Public())
+
+	digest := sha256.Sum256([]byte("message"))
+	sig, err := signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+	require.NoError(t, err)
+	assert.True(t, ecdsa.VerifyASN1(&key.PublicKey, digest[:], sig))
+
+	_, err = k.CreateSigner(&kmsapi.CreateSignerRequest{SigningKey: "missing.key"})
+	assert.Error(t, err)
+}
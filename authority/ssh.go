@@ -19,6 +19,7 @@ import (
 	"github.com/smallstep/certificates/authority/provisioner"
 	"github.com/smallstep/certificates/db"
 	"github.com/smallstep/certificates/errs"
+	"github.com/smallstep/certificates/export"
 	"github.com/smallstep/certificates/templates"
 	"github.com/smallstep/certificates/webhook"
 )
@@ -308,6 +309,11 @@ func (a *Authority) signSSH(ctx context.Context, key ssh.PublicKey, opts provisi
 		)
 	}
 
+	// Enforce the daily quota of the provisioner.
+	if err := a.checkCertificateRateLimit(prov); err != nil {
+		return nil, prov, err
+	}
+
 	// Sign certificate.
 	cert, err := sshutil.CreateCertificate(certTpl, signer)
 	if err != nil {
@@ -325,6 +331,8 @@ func (a *Authority) signSSH(ctx context.Context, key ssh.PublicKey, opts provisi
 		return nil, prov, errs.Wrap(http.StatusInternalServerError, err, "authority.SignSSH: error storing certificate in db")
 	}
 
+	a.exportSSH(ctx, export.Issued, prov, cert, nil)
+
 	return cert, prov, nil
 }
 
@@ -401,6 +409,8 @@ func (a *Authority) renewSSH(ctx context.Context, oldCert *ssh.Certificate) (*ss
 		return nil, prov, errs.Wrap(http.StatusInternalServerError, err, "renewSSH: error storing certificate in db")
 	}
 
+	a.exportSSH(ctx, export.Renewed, prov, cert, oldCert)
+
 	return cert, prov, nil
 }
 
@@ -489,6 +499,8 @@ func (a *Authority) rekeySSH(ctx context.Context, oldCert *ssh.Certificate, pub
 		return nil, prov, errs.Wrap(http.StatusInternalServerError, err, "rekeySSH; error storing certificate in db")
 	}
 
+	a.exportSSH(ctx, export.Renewed, prov, cert, oldCert)
+
 	return cert, prov, nil
 }
 
@@ -625,6 +637,8 @@ func (a *Authority) SignSSHAddUser(ctx context.Context, key ssh.PublicKey, subje
 		return nil, errs.Wrap(http.StatusInternalServerError, err, "signSSHAddUser: error storing certificate in db")
 	}
 
+	a.exportSSH(ctx, export.Issued, prov, cert, nil)
+
 	return cert, nil
 }
 
@@ -713,6 +727,7 @@ func (a *Authority) callAuthorizingWebhooksSSH(ctx context.Context, prov provisi
 
 	var whAuthBody *webhook.RequestBody
 	if whAuthBody, err = webhook.NewRequestBody(
+		webhook.WithOperation(webhook.OperationSign),
 		webhook.WithSSHCertificate(cert, certTpl),
 	); err == nil {
 		err = webhookCtl.Authorize(ctx, whAuthBody)
@@ -14,6 +14,7 @@ import (
 	"math/big"
 	"net"
 	"net/http"
+	"slices"
 	"strings"
 	"time"
 
@@ -24,14 +25,15 @@ import (
 	"go.step.sm/crypto/keyutil"
 	"go.step.sm/crypto/pemutil"
 	"go.step.sm/crypto/x509util"
+	"go.step.sm/linkedca"
 
 	"github.com/smallstep/certificates/authority/config"
 	"github.com/smallstep/certificates/authority/provisioner"
 	casapi "github.com/smallstep/certificates/cas/apiv1"
 	"github.com/smallstep/certificates/db"
 	"github.com/smallstep/certificates/errs"
+	"github.com/smallstep/certificates/export"
 	"github.com/smallstep/certificates/webhook"
-	"github.com/smallstep/nosql/database"
 )
 
 type tokenKey struct{}
@@ -56,6 +58,7 @@ var (
 	oidAuthorityKeyIdentifier            = asn1.ObjectIdentifier{2, 5, 29, 35}
 	oidSubjectKeyIdentifier              = asn1.ObjectIdentifier{2, 5, 29, 14}
 	oidExtensionIssuingDistributionPoint = asn1.ObjectIdentifier{2, 5, 29, 28}
+	oidExtensionSubjectAltName           = asn1.ObjectIdentifier{2, 5, 29, 17}
 )
 
 func withDefaultASN1DN(def *config.ASN1DN) provisioner.CertificateModifierFunc {
@@ -128,14 +131,18 @@ func (a *Authority) signX509(ctx context.Context, csr *x509.CertificateRequest,
 		certValidators []provisioner.CertificateValidator
 		certModifiers  []provisioner.CertificateModifier
 		certEnforcers  []provisioner.CertificateEnforcer
+		attValidators  []provisioner.AttestationValidator
 	)
 
 	opts := []any{errs.WithKeyVal("csr", csr), errs.WithKeyVal("signOptions", signOpts)}
-	if err := csr.CheckSignature(); err != nil {
-		return nil, nil, errs.ApplyOptions(
-			errs.BadRequestErr(err, "invalid certificate request"),
-			opts...,
-		)
+	popVerified := slices.ContainsFunc(extraOpts, provisioner.IsProofOfPossessionVerified)
+	if !popVerified {
+		if err := csr.CheckSignature(); err != nil {
+			return nil, nil, errs.ApplyOptions(
+				errs.BadRequestErr(err, "invalid certificate request"),
+				opts...,
+			)
+		}
 	}
 
 	// Set backdate with the configured value
@@ -145,6 +152,7 @@ func (a *Authority) signX509(ctx context.Context, csr *x509.CertificateRequest,
 		prov       provisioner.Interface
 		pInfo      *casapi.ProvisionerInfo
 		attData    *provisioner.AttestationData
+		reqData    *provisioner.RequestMetadata
 		webhookCtl webhookController
 	)
 	for _, op := range extraOpts {
@@ -186,15 +194,36 @@ func (a *Authority) signX509(ctx context.Context, csr *x509.CertificateRequest,
 		case provisioner.AttestationData:
 			attData = &k
 
+		// Validates the attestation data, if any.
+		case provisioner.AttestationValidator:
+			attValidators = append(attValidators, k)
+
+		// Extra information about the request.
+		case provisioner.RequestMetadata:
+			reqData = &k
+
 		// Capture the provisioner's webhook controller
 		case webhookController:
 			webhookCtl = k
 
 		default:
+			// The proof of possession was verified by the provisioner.
+			if provisioner.IsProofOfPossessionVerified(k) {
+				continue
+			}
 			return nil, prov, errs.InternalServer("authority.Sign; invalid extra option type %T", append([]any{k}, opts...)...)
 		}
 	}
 
+	for _, v := range attValidators {
+		if err := v.ValidAttestation(attData, csr); err != nil {
+			return nil, prov, errs.ApplyOptions(
+				errs.ForbiddenErr(err, "error validating attestation"),
+				opts...,
+			)
+		}
+	}
+
 	if err := a.callEnrichingWebhooksX509(ctx, prov, webhookCtl, attData, csr); err != nil {
 		return nil, prov, errs.ApplyOptions(
 			errs.ForbiddenErr(err, err.Error()), //nolint:govet // allow non-constant error messages
@@ -203,7 +232,24 @@ func (a *Authority) signX509(ctx context.Context, csr *x509.CertificateRequest,
 		)
 	}
 
-	crt, err := x509util.NewCertificate(csr, certOptions...)
+	var (
+		crt *x509util.Certificate
+		err error
+	)
+	if popVerified {
+		crt, err = x509util.NewCertificateFromX509(&x509.Certificate{
+			PublicKey:          csr.PublicKey,
+			PublicKeyAlgorithm: csr.PublicKeyAlgorithm,
+			Subject:            csr.Subject,
+			DNSNames:           csr.DNSNames,
+			EmailAddresses:     csr.EmailAddresses,
+			IPAddresses:        csr.IPAddresses,
+			URIs:               csr.URIs,
+			ExtraExtensions:    csr.Extensions,
+		}, certOptions...)
+	} else {
+		crt, err = x509util.NewCertificate(csr, certOptions...)
+	}
 	if err != nil {
 		var te *x509util.TemplateError
 		switch {
@@ -236,6 +282,19 @@ func (a *Authority) signX509(ctx context.Context, csr *x509.CertificateRequest,
 		)
 	}
 
+	// Add the OCSP responder URL if it's not set by the template.
+	if a.config.OCSP.IsEnabled() && len(leaf.OCSPServer) == 0 {
+		leaf.OCSPServer = []string{a.ocspURL()}
+	}
+
+	// Add the CRL distribution point if it's not set by the template. The CRL
+	// only includes the certificates issued by the default CAS.
+	if a.config.CRL.IsEnabled() && a.getX509CAServiceName(prov) == "" {
+		if err := a.addCRLDistributionPoint(leaf); err != nil {
+			return nil, prov, errs.Wrap(http.StatusInternalServerError, err, "authority.Sign", opts...)
+		}
+	}
+
 	for _, m := range certModifiers {
 		if err := m.Modify(leaf, signOpts); err != nil {
 			return nil, prov, errs.ApplyOptions(
@@ -275,6 +334,17 @@ func (a *Authority) signX509(ctx context.Context, csr *x509.CertificateRequest,
 		}
 	}
 
+	// Code-signing certificates that require an attested key are only issued
+	// with a matching attestation, whatever the provisioner or the template.
+	if requiresAttestedKey(prov, leaf) {
+		if err := provisioner.ValidateAttestedKey(attData, csr.PublicKey); err != nil {
+			return nil, prov, errs.ApplyOptions(
+				errs.ForbiddenErr(err, "error validating attestation"),
+				opts...,
+			)
+		}
+	}
+
 	// Check if authority is allowed to sign the certificate
 	if err = a.isAllowedToSignX509Certificate(leaf); err != nil {
 		var ee *errs.Error
@@ -296,17 +366,36 @@ func (a *Authority) signX509(ctx context.Context, csr *x509.CertificateRequest,
 		)
 	}
 
+	// Enforce the daily quota of the provisioner.
+	if err := a.checkCertificateRateLimit(prov); err != nil {
+		return nil, prov, err
+	}
+
 	// Sign certificate
 	lifetime := leaf.NotAfter.Sub(leaf.NotBefore.Add(signOpts.Backdate))
 
-	resp, err := a.x509CAService.CreateCertificate(&casapi.CreateCertificateRequest{
+	resp, err := a.getX509CAService(prov).CreateCertificate(&casapi.CreateCertificateRequest{
 		Template:    leaf,
 		CSR:         csr,
 		Lifetime:    lifetime,
 		Backdate:    signOpts.Backdate,
 		Provisioner: pInfo,
+		Metadata:    requestMetadata(ctx, prov, reqData),
 	})
 	if err != nil {
+		// Asynchronous backends might not issue the certificate immediately.
+		var pendingErr casapi.PendingCertificateError
+		if errors.As(err, &pendingErr) {
+			if name := a.getX509CAServiceName(prov); name != "" {
+				pendingErr.ID = name + ":" + pendingErr.ID
+			}
+			return nil, prov, pendingErr
+		}
+		// Rate limited requests can be retried later.
+		var tooManyErr casapi.TooManyRequestsError
+		if errors.As(err, &tooManyErr) {
+			return nil, prov, tooManyErr
+		}
 		return nil, prov, errs.Wrap(http.StatusInternalServerError, err, "authority.Sign; error creating certificate", opts...)
 	}
 
@@ -322,9 +411,91 @@ func (a *Authority) signX509(ctx context.Context, csr *x509.CertificateRequest,
 		return nil, prov, errs.Wrap(http.StatusInternalServerError, err, "authority.Sign; error storing certificate in db", opts...)
 	}
 
+	a.exportX509(ctx, export.Issued, prov, resp.Certificate, nil)
+
 	return chain, prov, nil
 }
 
+// GetPendingCertificate returns the certificate chain of a sign request that
+// was pending in the CAS. It returns a [casapi.PendingCertificateError] if the
+// certificate has not been issued yet.
+//
+// The provisioner that authorized the request is not known at this point, so
+// the certificate is stored without it.
+func (a *Authority) GetPendingCertificate(ctx context.Context, id string) ([]*x509.Certificate, error) {
+	srv, casID := a.x509CAService, id
+	if name, rest, ok := strings.Cut(id, ":"); ok {
+		if s, ok := a.x509CAServices[name]; ok {
+			srv, casID = s, rest
+		}
+	}
+
+	getter, ok := srv.(casapi.CertificateAuthorityPendingGetter)
+	if !ok {
+		return nil, errs.NotFound("authority.GetPendingCertificate; pending certificate %s was not found", id)
+	}
+
+	resp, err := getter.GetPendingCertificate(&casapi.GetPendingCertificateRequest{
+		ID: casID,
+	})
+	if err != nil {
+		var pendingErr casapi.PendingCertificateError
+		if errors.As(err, &pendingErr) {
+			pendingErr.ID = id
+			return nil, pendingErr
+		}
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "authority.GetPendingCertificate; error getting certificate")
+	}
+
+	chain := append([]*x509.Certificate{resp.Certificate}, resp.CertificateChain...)
+
+	if err := a.storeCertificate(nil, chain); err != nil && !errors.Is(err, db.ErrNotImplemented) {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "authority.GetPendingCertificate; error storing certificate in db")
+	}
+
+	a.exportX509(ctx, export.Issued, nil, resp.Certificate, nil)
+
+	return chain, nil
+}
+
+// requestMetadata returns the metadata sent to the CAS with a sign request. It
+// includes the provisioner used, the template configured in it, and the
+// requester, either the one in the given request data or the subject of the
+// token in the context.
+func requestMetadata(ctx context.Context, prov provisioner.Interface, reqData *provisioner.RequestMetadata) map[string]string {
+	md := make(map[string]string)
+	if prov != nil {
+		md[casapi.MetadataProvisionerID] = prov.GetID()
+		md[casapi.MetadataProvisionerName] = prov.GetName()
+		md[casapi.MetadataProvisionerType] = prov.GetType().String()
+		if p, ok := prov.(interface{ GetOptions() *provisioner.Options }); ok {
+			if o := p.GetOptions(); o != nil && o.X509 != nil && o.X509.TemplateFile != "" {
+				md[casapi.MetadataTemplate] = o.X509.TemplateFile
+			}
+		}
+	}
+	if reqData != nil {
+		if reqData.Requester != "" {
+			md[casapi.MetadataRequester] = reqData.Requester
+		}
+		if reqData.ACMEOrderID != "" {
+			md[casapi.MetadataACMEOrderID] = reqData.ACMEOrderID
+		}
+	}
+	if _, ok := md[casapi.MetadataRequester]; !ok {
+		// The token has already been validated by the provisioner.
+		if token, ok := provisioner.TokenFromContext(ctx); ok {
+			if jwt, err := jose.ParseSigned(token); err == nil {
+				var claims jose.Claims
+				if err := jwt.UnsafeClaimsWithoutVerification(&claims); err == nil && claims.Subject != "" {
+					md[casapi.MetadataRequester] = claims.Subject
+				}
+			}
+		}
+	}
+	return md
+}
+
 // isAllowedToSignX509Certificate checks if the Authority is allowed
 // to sign the X.509 certificate.
 func (a *Authority) isAllowedToSignX509Certificate(cert *x509.Certificate) error {
@@ -428,6 +599,10 @@ func (a *Authority) renewContext(ctx context.Context, oldCert *x509.Certificate,
 	}
 
 	if isRekey {
+		// A new key cannot be used without a new attestation.
+		if requiresAttestedKey(prov, oldCert) {
+			return nil, prov, errs.StatusCodeError(http.StatusForbidden, errors.New("certificate requires an attested key"), opts...)
+		}
 		newCert.PublicKey = pk
 	} else {
 		newCert.PublicKey = oldCert.PublicKey
@@ -442,6 +617,10 @@ func (a *Authority) renewContext(ctx context.Context, oldCert *x509.Certificate,
 	//  2. Subject Key Identifier, if rekey - For rekey, SubjectKeyIdentifier
 	//  extension will be calculated for the new public key by
 	//  x509util.CreateCertificate()
+	//
+	//  3. Provisioner, if the certificate is migrated from a deleted
+	//  provisioner - It is replaced by the extension of the new provisioner.
+	migrated, isMigrated := prov.(*migratedProvisioner)
 	for _, ext := range oldCert.Extensions {
 		if ext.Id.Equal(oidAuthorityKeyIdentifier) {
 			continue
@@ -450,9 +629,22 @@ func (a *Authority) renewContext(ctx context.Context, oldCert *x509.Certificate,
 			newCert.SubjectKeyId = nil
 			continue
 		}
+		if ext.Id.Equal(provisioner.StepOIDProvisioner) && isMigrated {
+			if ext, err = migrated.toExtension(); err != nil {
+				return nil, prov, errs.StatusCodeError(http.StatusInternalServerError, err, opts...)
+			}
+		}
 		newCert.ExtraExtensions = append(newCert.ExtraExtensions, ext)
 	}
 
+	// Renewed certificates in a partitioned CRL might be in a different
+	// partition.
+	if a.config.CRL.IsEnabled() && a.crlPartitions() > 0 && a.getX509CAServiceName(prov) == "" {
+		if err := a.resetCRLDistributionPoint(newCert); err != nil {
+			return nil, prov, errs.StatusCodeError(http.StatusInternalServerError, err, opts...)
+		}
+	}
+
 	// Check if the certificate is allowed to be renewed, name constraints might
 	// change over time.
 	//
@@ -475,22 +667,34 @@ func (a *Authority) renewContext(ctx context.Context, oldCert *x509.Certificate,
 	// mode, this can be used to renew a certificate.
 	token, _ := TokenFromContext(ctx)
 
-	resp, err := a.x509CAService.RenewCertificate(&casapi.RenewCertificateRequest{
+	resp, err := a.getX509CAService(prov).RenewCertificate(&casapi.RenewCertificateRequest{
 		Template: newCert,
 		Lifetime: lifetime,
 		Backdate: backdate,
 		Token:    token,
 	})
 	if err != nil {
+		var tooManyErr casapi.TooManyRequestsError
+		if errors.As(err, &tooManyErr) {
+			return nil, prov, tooManyErr
+		}
 		return nil, prov, errs.StatusCodeError(http.StatusInternalServerError, err, opts...)
 	}
 
 	chain := append([]*x509.Certificate{resp.Certificate}, resp.CertificateChain...)
 
-	if err = a.storeRenewedCertificate(oldCert, chain); err != nil && !errors.Is(err, db.ErrNotImplemented) {
+	// Migrated certificates are stored with the data of the new provisioner.
+	if isMigrated {
+		err = a.storeCertificate(migrated.Interface, chain)
+	} else {
+		err = a.storeRenewedCertificate(oldCert, chain)
+	}
+	if err != nil && !errors.Is(err, db.ErrNotImplemented) {
 		return nil, prov, errs.StatusCodeError(http.StatusInternalServerError, err, opts...)
 	}
 
+	a.exportX509(ctx, export.Renewed, prov, resp.Certificate, oldCert)
+
 	return chain, prov, nil
 }
 
@@ -554,6 +758,21 @@ func (a *Authority) storeRenewedCertificate(oldCert *x509.Certificate, fullchain
 	}
 }
 
+// requiresAttestedKey returns true if the given certificate has been issued
+// using a code-signing profile that requires an attested key.
+func requiresAttestedKey(prov provisioner.Interface, cert *x509.Certificate) bool {
+	p, ok := prov.(interface{ GetOptions() *provisioner.Options })
+	if !ok || !p.GetOptions().GetCodeSigningOptions().IsAttestationRequired() {
+		return false
+	}
+	for _, eku := range cert.ExtKeyUsage {
+		if eku == x509.ExtKeyUsageCodeSigning {
+			return true
+		}
+	}
+	return false
+}
+
 // RevokeOptions are the options for the Revoke API.
 type RevokeOptions struct {
 	Serial      string
@@ -569,9 +788,13 @@ type RevokeOptions struct {
 // Revoke revokes a certificate.
 //
 // NOTE: Only supports passive revocation - prevent existing certificates from
-// being renewed.
+// being renewed. Revoked certificates are also reported by the CRL and OCSP
+// endpoints if they are enabled.
 //
-// TODO: Add OCSP and CRL support.
+// Certificates revoked with the certificateHold reason code can be revoked
+// again with a different reason, or released from hold using the
+// removeFromCRL reason code. Releasing a certificate only updates the
+// database, it is not sent to the CAS.
 func (a *Authority) Revoke(ctx context.Context, revokeOpts *RevokeOptions) error {
 	opts := []interface{}{
 		errs.WithKeyVal("serialNumber", revokeOpts.Serial),
@@ -603,13 +826,41 @@ func (a *Authority) Revoke(ctx context.Context, revokeOpts *RevokeOptions) error
 			cert, err := a.db.GetCertificate(revokeOpts.Serial)
 			if err == nil {
 				rci.ExpiresAt = cert.NotAfter
+				rci.CRLPartition = a.crlPartitionOf(cert)
 			}
 		} else {
 			rci.ExpiresAt = revokeOpts.Crt.NotAfter
+			rci.CRLPartition = a.crlPartitionOf(revokeOpts.Crt)
+		}
+	}
+
+	// Certificates on hold can only be released by requests authorized by a
+	// provisioner, not by the holder of the certificate.
+	unrevoke := rci.ReasonCode == db.ReasonCodeRemoveFromCRL
+	if unrevoke && (revokeOpts.MTLS || revokeOpts.ACME) {
+		return errs.ApplyOptions(
+			errs.Forbidden("certificates on hold cannot be released using the certificate"),
+			opts...,
+		)
+	}
+
+	// Revocations authenticated with the certificate require a valid
+	// certificate, certificates revoked or on hold cannot be used.
+	if revokeOpts.MTLS {
+		isRevoked, err := a.IsRevoked(revokeOpts.Serial)
+		if err != nil {
+			return errs.Wrap(http.StatusInternalServerError, err, "authority.Revoke", opts...)
+		}
+		if isRevoked {
+			return errs.ApplyOptions(
+				errs.Unauthorized("authority.Revoke: certificate has been revoked"),
+				opts...,
+			)
 		}
 	}
 
 	// If not mTLS nor ACME, then get the TokenID of the token.
+	var prov provisioner.Interface
 	if !(revokeOpts.MTLS || revokeOpts.ACME) {
 		token, err := jose.ParseSigned(revokeOpts.OTT)
 		if err != nil {
@@ -636,10 +887,20 @@ func (a *Authority) Revoke(ctx context.Context, revokeOpts *RevokeOptions) error
 			errs.WithKeyVal("provisionerID", rci.ProvisionerID),
 			errs.WithKeyVal("tokenID", rci.TokenID),
 		)
+		prov = p
 	} else if p, err := a.LoadProvisionerByCertificate(revokeOpts.Crt); err == nil {
 		// Load the Certificate provisioner if one exists.
 		rci.ProvisionerID = p.GetID()
 		opts = append(opts, errs.WithKeyVal("provisionerID", rci.ProvisionerID))
+		prov = p
+	}
+
+	// Send the revocation to webhooks for authorization
+	if err := a.callAuthorizingWebhooksRevoke(ctx, prov, revokeOpts); err != nil {
+		return errs.ApplyOptions(
+			errs.ForbiddenErr(err, "error revoking certificate"),
+			opts...,
+		)
 	}
 
 	failRevoke := func(err error) error {
@@ -651,15 +912,32 @@ func (a *Authority) Revoke(ctx context.Context, revokeOpts *RevokeOptions) error
 				errs.BadRequest("certificate with serial number '%s' is already revoked", rci.Serial),
 				opts...,
 			)
+		case errors.Is(err, db.ErrNotOnHold):
+			return errs.ApplyOptions(
+				errs.BadRequest("certificate with serial number '%s' is not on hold", rci.Serial),
+				opts...,
+			)
+		case errors.Is(err, errReleaseNotAuthorized):
+			return errs.ApplyOptions(
+				errs.Forbidden("certificate with serial number '%s' was put on hold by a different provisioner", rci.Serial),
+				opts...,
+			)
 		default:
 			return errs.Wrap(http.StatusInternalServerError, err, "authority.Revoke", opts...)
 		}
 	}
 
 	if provisioner.MethodFromContext(ctx) == provisioner.SSHRevokeMethod {
+		if unrevoke {
+			return errs.ApplyOptions(
+				errs.BadRequest("reason code %d is not supported for ssh certificates", rci.ReasonCode),
+				opts...,
+			)
+		}
 		if err := a.revokeSSH(nil, rci); err != nil {
 			return failRevoke(err)
 		}
+		a.exportRevocation(ctx, export.SSH, rci)
 	} else {
 		// Revoke an X.509 certificate using CAS. If the certificate is not
 		// provided we will try to read it from the db. If the read fails we
@@ -672,28 +950,58 @@ func (a *Authority) Revoke(ctx context.Context, revokeOpts *RevokeOptions) error
 			revokedCert, _ = a.db.GetCertificate(rci.Serial)
 		}
 
-		// CAS operation, note that SoftCAS (default) is a noop.
-		// The revoke happens when this is stored in the db.
-		_, err := a.x509CAService.RevokeCertificate(&casapi.RevokeCertificateRequest{
-			Certificate:  revokedCert,
-			SerialNumber: rci.Serial,
-			Reason:       rci.Reason,
-			ReasonCode:   rci.ReasonCode,
-			PassiveOnly:  revokeOpts.PassiveOnly,
-		})
-		if err != nil {
-			return errs.Wrap(http.StatusInternalServerError, err, "authority.Revoke", opts...)
+		// Use the CAS that issued the certificate if the provisioner is routed
+		// to a different CAS backend.
+		x509CAService := a.x509CAService
+		if revokedCert != nil && len(a.x509CAServices) > 0 {
+			if p, err := a.LoadProvisionerByCertificate(revokedCert); err == nil {
+				x509CAService = a.getX509CAService(p)
+			}
 		}
 
-		// Save as revoked in the Db.
-		if err := a.revoke(revokedCert, rci); err != nil {
-			return failRevoke(err)
+		if unrevoke {
+			// Release the certificate from hold in the db.
+			if err := a.unrevoke(rci); err != nil {
+				return failRevoke(err)
+			}
+		} else {
+			// CAS operation, note that SoftCAS (default) is a noop.
+			// The revoke happens when this is stored in the db.
+			_, err := x509CAService.RevokeCertificate(&casapi.RevokeCertificateRequest{
+				Certificate:  revokedCert,
+				SerialNumber: rci.Serial,
+				Reason:       rci.Reason,
+				ReasonCode:   rci.ReasonCode,
+				PassiveOnly:  revokeOpts.PassiveOnly,
+			})
+			if err != nil {
+				return errs.Wrap(http.StatusInternalServerError, err, "authority.Revoke", opts...)
+			}
+
+			// Save as revoked in the Db.
+			if err := a.revoke(revokedCert, rci); err != nil {
+				return failRevoke(err)
+			}
+		}
+		if !unrevoke {
+			a.exportRevocation(ctx, export.X509, rci)
+		}
+
+		// Remove the cached OCSP responses, so the revocation is visible in
+		// the next response.
+		if a.config.OCSP.IsEnabled() {
+			a.resetOCSPCache()
 		}
 
 		// Generate a new CRL so CRL requesters will always get an up-to-date
-		// CRL whenever they request it.
+		// CRL whenever they request it. If delta CRLs are enabled, only the
+		// delta CRLs are generated.
 		if a.config.CRL.IsEnabled() && a.config.CRL.GenerateOnRevoke {
-			if err := a.GenerateCertificateRevocationList(); err != nil {
+			generate := a.GenerateCertificateRevocationList
+			if a.config.CRL.Delta.IsEnabled() {
+				generate = a.GenerateDeltaCertificateRevocationList
+			}
+			if err := generate(); err != nil {
 				return errs.Wrap(http.StatusInternalServerError, err, "authority.Revoke", opts...)
 			}
 		}
@@ -711,6 +1019,35 @@ func (a *Authority) revoke(crt *x509.Certificate, rci *db.RevokedCertificateInfo
 	return a.db.Revoke(rci)
 }
 
+// errReleaseNotAuthorized is returned if a certificate on hold is released
+// by a provisioner other than the one that put it on hold.
+var errReleaseNotAuthorized = errors.New("certificate was put on hold by a different provisioner")
+
+// unrevoke releases a certificate on hold. It's not supported by linked CAs.
+// The request must be authorized by the provisioner that put the certificate
+// on hold.
+func (a *Authority) unrevoke(rci *db.RevokedCertificateInfo) error {
+	if _, ok := a.adminDB.(interface {
+		Revoke(*x509.Certificate, *db.RevokedCertificateInfo) error
+	}); ok {
+		return db.ErrNotImplemented
+	}
+	udb, ok := a.db.(db.UnrevokeDB)
+	if !ok {
+		return db.ErrNotImplemented
+	}
+	if rdb, ok := a.db.(db.RevokedCertificateDB); ok {
+		hold, err := rdb.GetRevokedCertificate(rci.Serial)
+		if err != nil {
+			return err
+		}
+		if hold != nil && hold.ProvisionerID != "" && hold.ProvisionerID != rci.ProvisionerID {
+			return errReleaseNotAuthorized
+		}
+	}
+	return udb.Unrevoke(rci.Serial, rci.RevokedAt)
+}
+
 func (a *Authority) revokeSSH(crt *ssh.Certificate, rci *db.RevokedCertificateInfo) error {
 	if lca, ok := a.adminDB.(interface {
 		RevokeSSH(*ssh.Certificate, *db.RevokedCertificateInfo) error
@@ -753,21 +1090,72 @@ func (a *Authority) GetCertificateRevocationList() (*CertificateRevocationListIn
 	}, nil
 }
 
+// GetCertificateRevocationListPartition returns the CRL of the given
+// partition, or its delta CRL if delta is true. The partition 0 is the full
+// CRL, and partitions go from 1 to crl.partitions.
+func (a *Authority) GetCertificateRevocationListPartition(partition int, delta bool) (*CertificateRevocationListInfo, error) {
+	switch {
+	case !a.config.CRL.IsEnabled():
+		return nil, errs.Wrap(http.StatusNotFound, errors.Errorf("Certificate Revocation Lists are not enabled"), "authority.GetCertificateRevocationListPartition")
+	case partition < 0 || partition > a.crlPartitions():
+		return nil, errs.Wrap(http.StatusNotFound, errors.Errorf("Certificate Revocation List partition %d does not exist", partition), "authority.GetCertificateRevocationListPartition")
+	case delta && !a.config.CRL.Delta.IsEnabled():
+		return nil, errs.Wrap(http.StatusNotFound, errors.Errorf("Delta Certificate Revocation Lists are not enabled"), "authority.GetCertificateRevocationListPartition")
+	case partition == 0 && !delta:
+		return a.GetCertificateRevocationList()
+	}
+
+	crlsDB, ok := a.db.(db.CertificateRevocationListsDB)
+	if !ok {
+		return nil, errs.Wrap(http.StatusNotImplemented, errors.Errorf("Database does not support partitioned or delta Certificate Revocation Lists"), "authority.GetCertificateRevocationListPartition")
+	}
+
+	crlInfo, err := crlsDB.GetCRLByID(crlID(partition, delta))
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "authority.GetCertificateRevocationListPartition")
+	}
+
+	return &CertificateRevocationListInfo{
+		Number:    crlInfo.Number,
+		ExpiresAt: crlInfo.ExpiresAt,
+		Duration:  crlInfo.Duration,
+		Data:      crlInfo.DER,
+	}, nil
+}
+
 // GenerateCertificateRevocationList generates a DER representation of a signed CRL and stores it in the
-// database. Returns nil if CRL generation has been disabled in the config
+// database. Returns nil if CRL generation has been disabled in the config. If
+// they are configured, it also generates the CRL partitions and the delta
+// CRLs.
 func (a *Authority) GenerateCertificateRevocationList() error {
 	if !a.config.CRL.IsEnabled() {
 		return nil
 	}
+	return a.generateCertificateRevocationLists(false)
+}
+
+// GenerateDeltaCertificateRevocationList generates the delta CRLs of the full
+// CRL and its partitions. Returns nil if delta CRLs have been disabled in the
+// config.
+func (a *Authority) GenerateDeltaCertificateRevocationList() error {
+	if !a.config.CRL.IsEnabled() || !a.config.CRL.Delta.IsEnabled() {
+		return nil
+	}
+	return a.generateCertificateRevocationLists(true)
+}
 
+func (a *Authority) generateCertificateRevocationLists(deltaOnly bool) error {
 	crlDB, ok := a.db.(db.CertificateRevocationListDB)
 	if !ok {
 		return errors.Errorf("Database does not support CRL generation")
 	}
 
-	// some CAS may not implement the CRLGenerator interface, so check before we proceed
+	// some CAS may not implement the CRLGenerator interface, so check before we
+	// proceed, CRLs signed by a delegate are created by the authority
 	caCRLGenerator, ok := a.x509CAService.(casapi.CertificateAuthorityCRLGenerator)
-	if !ok {
+	if a.crlSigner != nil {
+		caCRLGenerator = a.crlSigner
+	} else if !ok {
 		return errors.Errorf("CA does not support CRL Generation")
 	}
 
@@ -776,48 +1164,108 @@ func (a *Authority) GenerateCertificateRevocationList() error {
 	a.crlMutex.Lock()
 	defer a.crlMutex.Unlock()
 
-	crlInfo, err := crlDB.GetCRL()
-	if err != nil && !database.IsErrNotFound(err) {
-		return errors.Wrap(err, "could not retrieve CRL from database")
-	}
-
 	now := time.Now().Truncate(time.Second).UTC()
 	revokedList, err := crlDB.GetRevokedCertificates()
 	if err != nil {
 		return errors.Wrap(err, "could not retrieve revoked certificates list from database")
 	}
 
+	// Base CRLs are generated before the delta CRLs that reference them.
+	var scopes []bool
+	if !deltaOnly {
+		scopes = append(scopes, false)
+	}
+	if a.config.CRL.Delta.IsEnabled() {
+		scopes = append(scopes, true)
+	}
+	for _, delta := range scopes {
+		for partition := 0; partition <= a.crlPartitions(); partition++ {
+			if err := a.generateCertificateRevocationList(crlDB, caCRLGenerator, *revokedList, partition, delta, now); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// generateCertificateRevocationList generates and stores the CRL of the given
+// partition, or its delta CRL.
+func (a *Authority) generateCertificateRevocationList(crlDB db.CertificateRevocationListDB, caCRLGenerator casapi.CertificateAuthorityCRLGenerator, revokedList []db.RevokedCertificateInfo, partition int, delta bool, now time.Time) error {
+	crlInfo, err := a.getCRLInfo(crlDB, partition, false)
+	if err != nil {
+		return err
+	}
+	var deltaInfo *db.CertificateRevocationListInfo
+	if a.config.CRL.Delta.IsEnabled() {
+		if deltaInfo, err = a.getCRLInfo(crlDB, partition, true); err != nil {
+			return err
+		}
+	}
+	if delta && crlInfo == nil {
+		return errors.Errorf("could not create delta CRL: base CRL %q not found", crlID(partition, false))
+	}
+
 	// Number is a monotonically increasing integer (essentially the CRL version
 	// number) that we need to keep track of and increase every time we generate
-	// a new CRL
+	// a new CRL. Delta CRLs share the sequence with their base CRL.
 	var bn big.Int
 	if crlInfo != nil {
 		bn.SetInt64(crlInfo.Number + 1)
 	}
+	if deltaInfo != nil && deltaInfo.Number >= bn.Int64() {
+		bn.SetInt64(deltaInfo.Number + 1)
+	}
 
 	// Convert our database db.RevokedCertificateInfo types into the pkix
-	// representation ready for the CAS to sign it
+	// representation ready for the CAS to sign it. Partitions only include
+	// their serial numbers, and delta CRLs the certificates revoked since
+	// their base CRL. Certificates released from hold are only listed, with
+	// the removeFromCRL reason, in the delta CRLs.
 	var revokedCertificates []pkix.RevokedCertificate
 	skipExpiredTime := now.Add(-config.DefaultCRLExpiredDuration)
-	for _, revokedCert := range *revokedList {
+	for _, revokedCert := range revokedList {
 		// skip expired certificates
 		if !revokedCert.ExpiresAt.IsZero() && revokedCert.ExpiresAt.Before(skipExpiredTime) {
 			continue
 		}
+		if delta && revokedCert.RevokedAt.Before(crlInfo.ThisUpdate) {
+			continue
+		}
+		if !delta && revokedCert.ReasonCode == db.ReasonCodeRemoveFromCRL {
+			continue
+		}
 
 		var sn big.Int
 		sn.SetString(revokedCert.Serial, 10)
+		if partition > 0 && a.revokedCertificatePartition(&revokedCert, &sn) != partition {
+			continue
+		}
+
+		// The unspecified reason code should not be used, RFC 5280 requires
+		// to omit the extension instead.
+		var extensions []pkix.Extension
+		if revokedCert.ReasonCode != 0 {
+			ext, err := marshalReasonCode(revokedCert.ReasonCode)
+			if err != nil {
+				return errors.Wrap(err, "could not create CRL")
+			}
+			extensions = append(extensions, ext)
+		}
 		revokedCertificates = append(revokedCertificates, pkix.RevokedCertificate{
 			SerialNumber:   &sn,
 			RevocationTime: revokedCert.RevokedAt,
-			Extensions:     nil,
+			Extensions:     extensions,
 		})
 	}
 
 	var updateDuration time.Duration
-	if a.config.CRL.CacheDuration != nil {
+	switch {
+	case delta:
+		updateDuration = a.config.CRL.Delta.CacheDuration.Duration
+	case a.config.CRL.CacheDuration != nil:
 		updateDuration = a.config.CRL.CacheDuration.Duration
-	} else if crlInfo != nil {
+	case crlInfo != nil:
 		updateDuration = crlInfo.Duration
 	}
 
@@ -831,22 +1279,46 @@ func (a *Authority) GenerateCertificateRevocationList() error {
 		NextUpdate:          now.Add(updateDuration),
 	}
 
-	// Set CRL IDP to config item, otherwise, leave as default
-	var fullName string
-	if a.config.CRL.IDPurl != "" {
-		fullName = a.config.CRL.IDPurl
-	} else {
-		fullName = a.config.Audience("/1.0/crl")[0]
-	}
-
-	// Add distribution point.
+	// Add distribution point, using the CRL IDP config item or the default
+	// one. Delta CRLs have the same distribution point as their base CRL. CRLs
+	// signed by a delegate are indirect CRLs, and the first entry must include
+	// the issuer of the revoked certificates.
 	//
 	// Note that this is currently using the port 443 by default.
-	if b, err := marshalDistributionPoint(fullName, false); err == nil {
+	indirect := a.crlSigner != nil
+	if b, err := marshalDistributionPoint(a.crlPartitionURL(partition, false), false, indirect); err == nil {
 		revocationList.ExtraExtensions = []pkix.Extension{
 			{Id: oidExtensionIssuingDistributionPoint, Critical: true, Value: b},
 		}
 	}
+	if indirect && len(revocationList.RevokedCertificates) > 0 {
+		ext, err := marshalCertificateIssuer(a.crlSigner.issuer.RawSubject)
+		if err != nil {
+			return errors.Wrap(err, "could not create CRL")
+		}
+		revocationList.RevokedCertificates[0].Extensions = append(revocationList.RevokedCertificates[0].Extensions, ext)
+	}
+
+	// Delta CRLs reference the number of their base CRL, and base CRLs point
+	// to their delta CRL.
+	switch {
+	case delta:
+		b, err := asn1.Marshal(big.NewInt(crlInfo.Number))
+		if err != nil {
+			return errors.Wrap(err, "could not create CRL")
+		}
+		revocationList.ExtraExtensions = append(revocationList.ExtraExtensions, pkix.Extension{
+			Id: oidExtensionDeltaCRLIndicator, Critical: true, Value: b,
+		})
+	case a.config.CRL.Delta.IsEnabled():
+		b, err := a.marshalCRLDistributionPoints(a.crlPartitionURL(partition, true))
+		if err != nil {
+			return errors.Wrap(err, "could not create CRL")
+		}
+		revocationList.ExtraExtensions = append(revocationList.ExtraExtensions, pkix.Extension{
+			Id: oidExtensionFreshestCRL, Value: b,
+		})
+	}
 
 	certificateRevocationList, err := caCRLGenerator.CreateCRL(&casapi.CreateCRLRequest{RevocationList: &revocationList})
 	if err != nil {
@@ -856,15 +1328,18 @@ func (a *Authority) GenerateCertificateRevocationList() error {
 	// Create a new db.CertificateRevocationListInfo, which stores the new Number we just generated, the
 	// expiry time, duration, and the DER-encoded CRL
 	newCRLInfo := db.CertificateRevocationListInfo{
-		Number:    bn.Int64(),
-		ExpiresAt: revocationList.NextUpdate,
-		DER:       certificateRevocationList.CRL,
-		Duration:  updateDuration,
+		Number:     bn.Int64(),
+		ThisUpdate: revocationList.ThisUpdate,
+		ExpiresAt:  revocationList.NextUpdate,
+		DER:        certificateRevocationList.CRL,
+		Duration:   updateDuration,
+	}
+	if partition == 0 && !delta {
+		newCRLInfo.Partitions = a.crlPartitions()
 	}
 
 	// Store the CRL in the database ready for retrieval by api endpoints
-	err = crlDB.StoreCRL(&newCRLInfo)
-	if err != nil {
+	if err := a.storeCRLInfo(crlDB, partition, delta, &newCRLInfo); err != nil {
 		return errors.Wrap(err, "could not store CRL in database")
 	}
 
@@ -988,7 +1463,7 @@ type distributionPointName struct {
 	RelativeName pkix.RDNSequence `asn1:"optional,tag:1"`
 }
 
-func marshalDistributionPoint(fullName string, isCA bool) ([]byte, error) {
+func marshalDistributionPoint(fullName string, isCA, indirect bool) ([]byte, error) {
 	return asn1.Marshal(distributionPoint{
 		DistributionPoint: distributionPointName{
 			FullName: []asn1.RawValue{
@@ -997,6 +1472,7 @@ func marshalDistributionPoint(fullName string, isCA bool) ([]byte, error) {
 		},
 		OnlyContainsUserCerts: !isCA,
 		OnlyContainsCACerts:   isCA,
+		IndirectCRL:           indirect,
 	})
 }
 
@@ -1058,11 +1534,45 @@ func (a *Authority) callAuthorizingWebhooksX509(ctx context.Context, prov provis
 
 	var whAuthBody *webhook.RequestBody
 	if whAuthBody, err = webhook.NewRequestBody(
+		webhook.WithOperation(webhook.OperationSign),
 		webhook.WithX509Certificate(cert, leaf),
 		webhook.WithAttestationData(attested),
 	); err == nil {
-		err = webhookCtl.Authorize(ctx, whAuthBody)
+		var allowedSANs []string
+		if allowedSANs, err = webhookCtl.AuthorizeSANs(ctx, whAuthBody); err == nil {
+			err = restrictSANs(leaf, allowedSANs)
+		}
 	}
 
 	return
 }
+
+func (a *Authority) callAuthorizingWebhooksRevoke(ctx context.Context, prov provisioner.Interface, revokeOpts *RevokeOptions) error {
+	o, ok := prov.(interface{ GetOptions() *provisioner.Options })
+	if !ok || len(o.GetOptions().GetWebhooks()) == 0 {
+		return nil
+	}
+
+	certType := linkedca.Webhook_X509
+	if provisioner.MethodFromContext(ctx) == provisioner.SSHRevokeMethod {
+		certType = linkedca.Webhook_SSH
+	}
+
+	whOpts := []webhook.RequestBodyOption{
+		webhook.WithOperation(webhook.OperationRevoke),
+		webhook.WithRevocation(revokeOpts.Serial, revokeOpts.ReasonCode, revokeOpts.Reason),
+	}
+	if revokeOpts.Crt != nil {
+		cert, err := x509util.NewCertificateFromX509(revokeOpts.Crt)
+		if err != nil {
+			return err
+		}
+		whOpts = append(whOpts, webhook.WithX509Certificate(cert, revokeOpts.Crt))
+	}
+
+	whAuthBody, err := webhook.NewRequestBody(whOpts...)
+	if err != nil {
+		return err
+	}
+	return provisioner.NewWebhookController(a.webhookClient, o.GetOptions(), certType).Authorize(ctx, whAuthBody)
+}
@@ -15,6 +15,7 @@ import (
 	"fmt"
 	"net/http"
 	"reflect"
+	"slices"
 	"strings"
 	"testing"
 	"time"
@@ -31,6 +32,7 @@ import (
 	"github.com/smallstep/certificates/authority/policy"
 	"github.com/smallstep/certificates/authority/provisioner"
 	"github.com/smallstep/certificates/cas/apiv1"
+	"github.com/smallstep/certificates/cas/ratelimit"
 	"github.com/smallstep/certificates/cas/softcas"
 	"github.com/smallstep/certificates/db"
 	"github.com/smallstep/certificates/errs"
@@ -73,11 +75,12 @@ func (d *certificateChainDB) StoreCertificateChain(p provisioner.Interface, cert
 }
 
 func getDefaultIssuer(a *Authority) *x509.Certificate {
-	return a.x509CAService.(*softcas.SoftCAS).CertificateChain[len(a.x509CAService.(*softcas.SoftCAS).CertificateChain)-1]
+	chain := a.currentX509Issuer().chain
+	return chain[len(chain)-1]
 }
 
 func getDefaultSigner(a *Authority) crypto.Signer {
-	return a.x509CAService.(*softcas.SoftCAS).Signer
+	return a.currentX509Issuer().signer
 }
 
 func generateCertificate(t *testing.T, commonName string, sans []string, opts ...interface{}) *x509.Certificate {
@@ -329,7 +332,7 @@ func TestAuthority_SignWithContext(t *testing.T) {
 		},
 		"fail create cert": func(t *testing.T) *signTest {
 			_a := testAuthority(t)
-			_a.x509CAService.(*softcas.SoftCAS).Signer = nil
+			_a.x509Issuer.signer = nil
 			csr := getCSR(t, priv)
 			return &signTest{
 				auth:      _a,
@@ -658,6 +661,25 @@ ZYtQ9Ot36qc=
 				extensionsCount: 6,
 			}
 		},
+		"ok with proof of possession verified": func(t *testing.T) *signTest {
+			csr := getCSR(t, priv)
+			csr.Signature = []byte("foo")
+			cmp := &provisioner.CMP{Type: "CMP", Name: "cmp", SharedSecret: "secret"}
+			require.NoError(t, cmp.Init(provisioner.Config{Claims: config.GlobalProvisionerClaims}))
+			cmpOpts, err := cmp.AuthorizeSign(context.Background(), "")
+			require.NoError(t, err)
+			i := slices.IndexFunc(cmpOpts, provisioner.IsProofOfPossessionVerified)
+			require.GreaterOrEqual(t, i, 0)
+			return &signTest{
+				auth:            a,
+				csr:             csr,
+				extraOpts:       append(extraOpts, cmpOpts[i]),
+				signOpts:        signOpts,
+				notBefore:       signOpts.NotBefore.Time().Truncate(time.Second),
+				notAfter:        signOpts.NotAfter.Time().Truncate(time.Second),
+				extensionsCount: 6,
+			}
+		},
 		"ok with enforced modifier": func(t *testing.T) *signTest {
 			bcExt := pkix.Extension{}
 			bcExt.Id = asn1.ObjectIdentifier{2, 5, 29, 19}
@@ -1071,7 +1093,7 @@ func TestAuthority_Renew(t *testing.T) {
 	tests := map[string]func() (*renewTest, error){
 		"fail/create-cert": func() (*renewTest, error) {
 			_a := testAuthority(t)
-			_a.x509CAService.(*softcas.SoftCAS).Signer = nil
+			_a.x509Issuer.signer = nil
 			return &renewTest{
 				auth: _a,
 				cert: cert,
@@ -1116,8 +1138,7 @@ func TestAuthority_Renew(t *testing.T) {
 			intCert, intSigner := generateIntermidiateCertificate(t, rootCert, rootSigner)
 
 			_a := testAuthority(t)
-			_a.x509CAService.(*softcas.SoftCAS).CertificateChain = []*x509.Certificate{intCert}
-			_a.x509CAService.(*softcas.SoftCAS).Signer = intSigner
+			_a.x509Issuer = &x509Issuer{chain: []*x509.Certificate{intCert}, signer: intSigner}
 			return &renewTest{
 				auth: _a,
 				cert: cert,
@@ -1128,6 +1149,7 @@ func TestAuthority_Renew(t *testing.T) {
 				return nil
 			}))
 			aa.x509CAService = a.x509CAService
+			aa.x509Issuer = a.x509Issuer
 			aa.config.AuthorityConfig.Template = a.config.AuthorityConfig.Template
 			return &renewTest{
 				auth: aa,
@@ -1298,7 +1320,7 @@ func TestAuthority_Rekey(t *testing.T) {
 	tests := map[string]func() (*renewTest, error){
 		"fail/create-cert": func() (*renewTest, error) {
 			_a := testAuthority(t)
-			_a.x509CAService.(*softcas.SoftCAS).Signer = nil
+			_a.x509Issuer.signer = nil
 			return &renewTest{
 				auth: _a,
 				cert: cert,
@@ -1331,8 +1353,7 @@ func TestAuthority_Rekey(t *testing.T) {
 			intCert, intSigner := generateIntermidiateCertificate(t, rootCert, rootSigner)
 
 			_a := testAuthority(t)
-			_a.x509CAService.(*softcas.SoftCAS).CertificateChain = []*x509.Certificate{intCert}
-			_a.x509CAService.(*softcas.SoftCAS).Signer = intSigner
+			_a.x509Issuer = &x509Issuer{chain: []*x509.Certificate{intCert}, signer: intSigner}
 			return &renewTest{
 				auth: _a,
 				cert: cert,
@@ -1684,7 +1705,11 @@ func TestAuthority_Revoke(t *testing.T) {
 			}
 		},
 		"ok/mTLS": func() test {
-			_a := testAuthority(t, WithDatabase(&db.MockAuthDB{}))
+			_a := testAuthority(t, WithDatabase(&db.MockAuthDB{
+				MIsRevoked: func(sn string) (bool, error) {
+					return false, nil
+				},
+			}))
 
 			crt, err := pemutil.ReadCertificate("./testdata/certs/foo.crt")
 			require.NoError(t, err)
@@ -1702,7 +1727,11 @@ func TestAuthority_Revoke(t *testing.T) {
 			}
 		},
 		"ok/mTLS-no-provisioner": func() test {
-			_a := testAuthority(t, WithDatabase(&db.MockAuthDB{}))
+			_a := testAuthority(t, WithDatabase(&db.MockAuthDB{
+				MIsRevoked: func(sn string) (bool, error) {
+					return false, nil
+				},
+			}))
 
 			crt, err := pemutil.ReadCertificate("./testdata/certs/foo.crt")
 			require.NoError(t, err)
@@ -1744,6 +1773,201 @@ func TestAuthority_Revoke(t *testing.T) {
 				},
 			}
 		},
+		"ok/unrevoke": func() test {
+			_a := testAuthority(t, WithDatabase(&db.MockAuthDB{
+				MUseToken: func(id, tok string) (bool, error) {
+					return true, nil
+				},
+				MGetCertificate: func(sn string) (*x509.Certificate, error) {
+					return nil, errors.New("not found")
+				},
+				MRevoke: func(rci *db.RevokedCertificateInfo) error {
+					return errors.New("Revoke was called")
+				},
+				MGetRevokedCertificate: func(sn string) (*db.RevokedCertificateInfo, error) {
+					return &db.RevokedCertificateInfo{
+						Serial:        "sn",
+						ReasonCode:    db.ReasonCodeCertificateHold,
+						ProvisionerID: "step-cli:4UELJx8e0aS9m0CH3fZ0EB7D5aUPICb759zALHFejvc",
+					}, nil
+				},
+				MUnrevoke: func(serialNumber string, unrevokedAt time.Time) error {
+					assert.Equal(t, "sn", serialNumber)
+					assert.False(t, unrevokedAt.IsZero())
+					return nil
+				},
+			}))
+
+			cl := jose.Claims{
+				Subject:   "sn",
+				Issuer:    validIssuer,
+				NotBefore: jose.NewNumericDate(now),
+				Expiry:    jose.NewNumericDate(now.Add(time.Minute)),
+				Audience:  validAudience,
+				ID:        "44",
+			}
+			raw, err := jose.Signed(sig).Claims(cl).CompactSerialize()
+			require.NoError(t, err)
+			return test{
+				auth: _a,
+				ctx:  tlsRevokeCtx,
+				opts: &RevokeOptions{
+					Serial:     "sn",
+					ReasonCode: db.ReasonCodeRemoveFromCRL,
+					OTT:        raw,
+				},
+			}
+		},
+		"fail/unrevoke-other-provisioner": func() test {
+			_a := testAuthority(t, WithDatabase(&db.MockAuthDB{
+				MUseToken: func(id, tok string) (bool, error) {
+					return true, nil
+				},
+				MGetCertificate: func(sn string) (*x509.Certificate, error) {
+					return nil, errors.New("not found")
+				},
+				MGetRevokedCertificate: func(sn string) (*db.RevokedCertificateInfo, error) {
+					return &db.RevokedCertificateInfo{
+						Serial:        "sn",
+						ReasonCode:    db.ReasonCodeCertificateHold,
+						ProvisionerID: "other",
+					}, nil
+				},
+				MUnrevoke: func(serialNumber string, unrevokedAt time.Time) error {
+					return errors.New("Unrevoke was called")
+				},
+			}))
+
+			cl := jose.Claims{
+				Subject:   "sn",
+				Issuer:    validIssuer,
+				NotBefore: jose.NewNumericDate(now),
+				Expiry:    jose.NewNumericDate(now.Add(time.Minute)),
+				Audience:  validAudience,
+				ID:        "44",
+			}
+			raw, err := jose.Signed(sig).Claims(cl).CompactSerialize()
+			require.NoError(t, err)
+			return test{
+				auth: _a,
+				ctx:  tlsRevokeCtx,
+				opts: &RevokeOptions{
+					Serial:     "sn",
+					ReasonCode: db.ReasonCodeRemoveFromCRL,
+					OTT:        raw,
+				},
+				err:  errors.New("certificate with serial number 'sn' was put on hold by a different provisioner"),
+				code: http.StatusForbidden,
+			}
+		},
+		"fail/unrevoke-not-on-hold": func() test {
+			_a := testAuthority(t, WithDatabase(&db.MockAuthDB{
+				MUseToken: func(id, tok string) (bool, error) {
+					return true, nil
+				},
+				MGetCertificate: func(sn string) (*x509.Certificate, error) {
+					return nil, errors.New("not found")
+				},
+				MUnrevoke: func(serialNumber string, unrevokedAt time.Time) error {
+					return db.ErrNotOnHold
+				},
+			}))
+
+			cl := jose.Claims{
+				Subject:   "sn",
+				Issuer:    validIssuer,
+				NotBefore: jose.NewNumericDate(now),
+				Expiry:    jose.NewNumericDate(now.Add(time.Minute)),
+				Audience:  validAudience,
+				ID:        "44",
+			}
+			raw, err := jose.Signed(sig).Claims(cl).CompactSerialize()
+			require.NoError(t, err)
+			return test{
+				auth: _a,
+				ctx:  tlsRevokeCtx,
+				opts: &RevokeOptions{
+					Serial:     "sn",
+					ReasonCode: db.ReasonCodeRemoveFromCRL,
+					OTT:        raw,
+				},
+				err:  errors.New("certificate with serial number 'sn' is not on hold"),
+				code: http.StatusBadRequest,
+			}
+		},
+		"fail/unrevoke-mTLS": func() test {
+			_a := testAuthority(t, WithDatabase(&db.MockAuthDB{
+				MUnrevoke: func(serialNumber string, unrevokedAt time.Time) error {
+					return errors.New("Unrevoke was called")
+				},
+			}))
+
+			crt, err := pemutil.ReadCertificate("./testdata/certs/foo.crt")
+			require.NoError(t, err)
+
+			return test{
+				auth: _a,
+				ctx:  tlsRevokeCtx,
+				opts: &RevokeOptions{
+					Crt:        crt,
+					Serial:     "102012593071130646873265215610956555026",
+					ReasonCode: db.ReasonCodeRemoveFromCRL,
+					MTLS:       true,
+				},
+				err:  errors.New("certificates on hold cannot be released using the certificate"),
+				code: http.StatusForbidden,
+			}
+		},
+		"fail/mTLS-revoked": func() test {
+			_a := testAuthority(t, WithDatabase(&db.MockAuthDB{
+				MIsRevoked: func(sn string) (bool, error) {
+					return true, nil
+				},
+				MRevoke: func(rci *db.RevokedCertificateInfo) error {
+					return errors.New("Revoke was called")
+				},
+			}))
+
+			crt, err := pemutil.ReadCertificate("./testdata/certs/foo.crt")
+			require.NoError(t, err)
+
+			return test{
+				auth: _a,
+				ctx:  tlsRevokeCtx,
+				opts: &RevokeOptions{
+					Crt:        crt,
+					Serial:     "102012593071130646873265215610956555026",
+					ReasonCode: reasonCode,
+					Reason:     reason,
+					MTLS:       true,
+				},
+				err:  errors.New("authority.Revoke: certificate has been revoked"),
+				code: http.StatusUnauthorized,
+			}
+		},
+		"fail/ssh-unrevoke": func() test {
+			cl := jose.Claims{
+				Subject:   "sn",
+				Issuer:    validIssuer,
+				NotBefore: jose.NewNumericDate(now),
+				Expiry:    jose.NewNumericDate(now.Add(time.Minute)),
+				Audience:  validAudience,
+				ID:        "44",
+			}
+			raw, err := jose.Signed(sig).Claims(cl).CompactSerialize()
+			require.NoError(t, err)
+			return test{
+				auth: testAuthority(t, WithDatabase(&db.MockAuthDB{})),
+				ctx:  provisioner.NewContextWithMethod(context.Background(), provisioner.SSHRevokeMethod),
+				opts: &RevokeOptions{
+					Serial:     "sn",
+					ReasonCode: db.ReasonCodeRemoveFromCRL,
+					OTT:        raw,
+				},
+				err:  errors.New("reason code 8 is not supported for ssh certificates"),
+				code: http.StatusBadRequest,
+			}
+		},
 		"ok/ssh": func() test {
 			a := testAuthority(t, WithDatabase(&db.MockAuthDB{
 				MRevoke: func(rci *db.RevokedCertificateInfo) error {
@@ -1792,7 +2016,7 @@ func TestAuthority_Revoke(t *testing.T) {
 					assert.Equal(t, tc.opts.ReasonCode, ctxErr.Details["reasonCode"])
 					assert.Equal(t, tc.opts.Reason, ctxErr.Details["reason"])
 					assert.Equal(t, tc.opts.MTLS, ctxErr.Details["MTLS"])
-					assert.Equal(t, provisioner.RevokeMethod.String(), ctxErr.Details["context"])
+					assert.Equal(t, provisioner.MethodFromContext(tc.ctx).String(), ctxErr.Details["context"])
 
 					if tc.checkErrDetails != nil {
 						tc.checkErrDetails(ctxErr)
@@ -2066,3 +2290,278 @@ func TestAuthority_GetX509Signer(t *testing.T) {
 		})
 	}
 }
+
+func Test_requestMetadata(t *testing.T) {
+	key, err := jose.ReadKey("testdata/secrets/step_cli_key_priv.jwk", jose.WithPassword([]byte("pass")))
+	require.NoError(t, err)
+	token, err := generateToken("smallstep test", "step-cli", testAudiences.Sign[0], []string{"test.smallstep.com"}, time.Now(), key)
+	require.NoError(t, err)
+
+	jwk := &provisioner.JWK{
+		ID:   "jwk-id",
+		Name: "step-cli",
+		Type: "JWK",
+		Options: &provisioner.Options{
+			X509: &provisioner.X509Options{TemplateFile: "templates/leaf.tpl"},
+		},
+	}
+	acme := &provisioner.ACME{ID: "acme-id", Name: "acme", Type: "ACME"}
+
+	type args struct {
+		ctx     context.Context
+		prov    provisioner.Interface
+		reqData *provisioner.RequestMetadata
+	}
+	tests := []struct {
+		name string
+		args args
+		want map[string]string
+	}{
+		{"ok token", args{provisioner.NewContextWithToken(context.Background(), token), jwk, nil}, map[string]string{
+			apiv1.MetadataProvisionerID:   "jwk-id",
+			apiv1.MetadataProvisionerName: "step-cli",
+			apiv1.MetadataProvisionerType: "JWK",
+			apiv1.MetadataTemplate:        "templates/leaf.tpl",
+			apiv1.MetadataRequester:       "smallstep test",
+		}},
+		{"ok acme", args{context.Background(), acme, &provisioner.RequestMetadata{Requester: "account-id", ACMEOrderID: "order-id"}}, map[string]string{
+			apiv1.MetadataProvisionerID:   "acme-id",
+			apiv1.MetadataProvisionerName: "acme",
+			apiv1.MetadataProvisionerType: "ACME",
+			apiv1.MetadataRequester:       "account-id",
+			apiv1.MetadataACMEOrderID:     "order-id",
+		}},
+		{"ok bad token", args{provisioner.NewContextWithToken(context.Background(), "not-a-token"), nil, nil}, map[string]string{}},
+		{"ok empty", args{context.Background(), nil, nil}, map[string]string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, requestMetadata(tt.args.ctx, tt.args.prov, tt.args.reqData))
+		})
+	}
+}
+
+type pendingCAS struct {
+	notImplementedCAS
+	chain []*x509.Certificate
+	err   error
+}
+
+func (c *pendingCAS) GetPendingCertificate(req *apiv1.GetPendingCertificateRequest) (*apiv1.GetPendingCertificateResponse, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	return &apiv1.GetPendingCertificateResponse{
+		Certificate:      c.chain[0],
+		CertificateChain: c.chain[1:],
+	}, nil
+}
+
+func TestAuthority_GetPendingCertificate(t *testing.T) {
+	ca, err := minica.New()
+	require.NoError(t, err)
+	signer, err := keyutil.GenerateDefaultSigner()
+	require.NoError(t, err)
+	leaf, err := ca.Sign(&x509.Certificate{
+		Subject:   pkix.Name{CommonName: "test.smallstep.com"},
+		PublicKey: signer.Public(),
+	})
+	require.NoError(t, err)
+	chain := []*x509.Certificate{leaf, ca.Intermediate}
+
+	var stored *x509.Certificate
+	newAuthority := func(defaultCAS, routedCAS apiv1.CertificateAuthorityService) *Authority {
+		a := testAuthority(t, WithX509CAService(defaultCAS))
+		a.x509CAServices = map[string]apiv1.CertificateAuthorityService{
+			"routed": routedCAS,
+		}
+		a.db = &db.MockAuthDB{
+			MStoreCertificate: func(crt *x509.Certificate) error {
+				stored = crt
+				return nil
+			},
+		}
+		return a
+	}
+
+	pendingErr := apiv1.PendingCertificateError{ID: "1234", RetryAfter: time.Minute}
+
+	tests := []struct {
+		name      string
+		authority *Authority
+		id        string
+		want      []*x509.Certificate
+		wantErr   error
+	}{
+		{"ok", newAuthority(&pendingCAS{chain: chain}, notImplementedCAS{}), "1234", chain, nil},
+		{"ok routed", newAuthority(notImplementedCAS{}, &pendingCAS{chain: chain}), "routed:1234", chain, nil},
+		{"ok not routed", newAuthority(&pendingCAS{chain: chain}, notImplementedCAS{}), "other:1234", chain, nil},
+		{"pending", newAuthority(&pendingCAS{err: pendingErr}, notImplementedCAS{}), "1234", nil, pendingErr},
+		{"pending routed", newAuthority(notImplementedCAS{}, &pendingCAS{err: pendingErr}), "routed:1234", nil, apiv1.PendingCertificateError{ID: "routed:1234", RetryAfter: time.Minute}},
+		{"fail not implemented", newAuthority(notImplementedCAS{}, notImplementedCAS{}), "1234", nil, errs.NotFound("authority.GetPendingCertificate; pending certificate 1234 was not found")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stored = nil
+			got, err := tt.authority.GetPendingCertificate(context.Background(), tt.id)
+			if tt.wantErr != nil {
+				assert.Equal(t, tt.wantErr, err)
+				assert.Nil(t, stored)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, leaf, stored)
+		})
+	}
+
+	t.Run("fail cas", func(t *testing.T) {
+		a := newAuthority(&pendingCAS{err: errors.New("force")}, notImplementedCAS{})
+		_, err := a.GetPendingCertificate(context.Background(), "1234")
+		var sc render.StatusCodedError
+		if assert.ErrorAs(t, err, &sc) {
+			assert.Equal(t, http.StatusInternalServerError, sc.StatusCode())
+		}
+	})
+}
+
+func TestAuthority_SignWithContext_rateLimit(t *testing.T) {
+	_, priv, err := keyutil.GenerateDefaultKeyPair()
+	require.NoError(t, err)
+
+	a := testAuthority(t)
+	limiter, err := ratelimit.New(a.x509CAService, &apiv1.RateLimitOptions{
+		Provisioners: map[string]apiv1.RateLimit{
+			"step-cli": {Requests: 1, Period: "1h"},
+		},
+	}, nil)
+	require.NoError(t, err)
+	a.x509CALimiters = map[string]apiv1.CertificateAuthorityService{"": limiter}
+
+	key, err := jose.ReadKey("testdata/secrets/step_cli_key_priv.jwk", jose.WithPassword([]byte("pass")))
+	require.NoError(t, err)
+	token, err := generateToken("smallstep test", "step-cli", testAudiences.Sign[0], []string{"test.smallstep.com"}, time.Now(), key)
+	require.NoError(t, err)
+	ctx := provisioner.NewContextWithMethod(context.Background(), provisioner.SignMethod)
+	extraOpts, err := a.Authorize(ctx, token)
+	require.NoError(t, err)
+
+	nb := time.Now()
+	signOpts := provisioner.SignOptions{
+		NotBefore: provisioner.NewTimeDuration(nb),
+		NotAfter:  provisioner.NewTimeDuration(nb.Add(5 * time.Minute)),
+	}
+	_, err = a.SignWithContext(ctx, getCSR(t, priv), signOpts, extraOpts...)
+	require.NoError(t, err)
+
+	_, err = a.SignWithContext(ctx, getCSR(t, priv), signOpts, extraOpts...)
+	var tooManyErr apiv1.TooManyRequestsError
+	if assert.ErrorAs(t, err, &tooManyErr) {
+		assert.Equal(t, "certificate rate limit exceeded for provisioner step-cli", tooManyErr.Message)
+	}
+}
+
+func TestAuthority_Sign_attestedKey(t *testing.T) {
+	ctx := context.Background()
+	a := testAuthority(t)
+	p := &provisioner.ACME{
+		Type:       "ACME",
+		Name:       "code-signing",
+		Challenges: []provisioner.ACMEChallenge{provisioner.DEVICE_ATTEST_01},
+		Options: &provisioner.Options{
+			CodeSigning: &provisioner.CodeSigningOptions{RequireAttestation: true},
+		},
+	}
+	config, err := a.generateProvisionerConfig(ctx)
+	require.NoError(t, err)
+	require.NoError(t, p.Init(config))
+	require.NoError(t, a.provisioners.Store(p))
+
+	key, err := keyutil.GenerateDefaultSigner()
+	require.NoError(t, err)
+	fp, err := keyutil.Fingerprint(key.Public())
+	require.NoError(t, err)
+	csr := getCSR(t, key)
+	now := time.Now()
+	signOpts := provisioner.SignOptions{
+		NotBefore: provisioner.NewTimeDuration(now),
+		NotAfter:  provisioner.NewTimeDuration(now.Add(time.Hour)),
+	}
+	opts, err := p.AuthorizeSign(ctx, "")
+	require.NoError(t, err)
+
+	assertForbidden := func(t *testing.T, err error) {
+		t.Helper()
+		var sc render.StatusCodedError
+		if assert.ErrorAs(t, err, &sc) {
+			assert.Equal(t, http.StatusForbidden, sc.StatusCode())
+		}
+	}
+
+	// The key must be attested, by any sign method.
+	_, err = a.SignWithContext(ctx, csr, signOpts, opts...)
+	assertForbidden(t, err)
+	_, err = a.SignWithContext(ctx, csr, signOpts, append(opts, provisioner.AttestationData{
+		PermanentIdentifier: "1234",
+	})...)
+	assertForbidden(t, err)
+	other, err := keyutil.GenerateDefaultSigner()
+	require.NoError(t, err)
+	_, err = a.SignWithContext(ctx, getCSR(t, other), signOpts, append(opts, provisioner.AttestationData{
+		PermanentIdentifier: "1234",
+		Fingerprint:         fp,
+	})...)
+	assertForbidden(t, err)
+
+	chain, err := a.SignWithContext(ctx, csr, signOpts, append(opts, provisioner.AttestationData{
+		PermanentIdentifier: "1234",
+		Fingerprint:         fp,
+	})...)
+	require.NoError(t, err)
+	assert.Equal(t, []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning}, chain[0].ExtKeyUsage)
+
+	// The certificate can be renewed with the same key, but not rekeyed.
+	_, err = a.RenewContext(ctx, chain[0], nil)
+	assert.NoError(t, err)
+	_, err = a.RenewContext(ctx, chain[0], other.Public())
+	assertForbidden(t, err)
+}
+
+func TestAuthority_Sign_attestedKeyOtherProvisioner(t *testing.T) {
+	ctx := context.Background()
+	a := testAuthority(t)
+	p := &provisioner.JWK{
+		ID:   "code-signing-id",
+		Type: "JWK",
+		Name: "code-signing",
+		Options: &provisioner.Options{
+			CodeSigning: &provisioner.CodeSigningOptions{RequireAttestation: true},
+		},
+	}
+
+	key, err := keyutil.GenerateDefaultSigner()
+	require.NoError(t, err)
+	csr := getCSR(t, key)
+	now := time.Now()
+	signOpts := provisioner.SignOptions{
+		NotBefore: provisioner.NewTimeDuration(now),
+		NotAfter:  provisioner.NewTimeDuration(now.Add(time.Hour)),
+	}
+	codeSigning := provisioner.CertificateModifierFunc(func(cert *x509.Certificate, _ provisioner.SignOptions) error {
+		cert.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning}
+		return nil
+	})
+
+	// Provisioners without key attestation cannot issue code-signing
+	// certificates.
+	_, err = a.SignWithContext(ctx, csr, signOpts, p, codeSigning)
+	var sc render.StatusCodedError
+	if assert.ErrorAs(t, err, &sc) {
+		assert.Equal(t, http.StatusForbidden, sc.StatusCode())
+	}
+
+	// Other certificates are not affected.
+	chain, err := a.SignWithContext(ctx, csr, signOpts, p)
+	require.NoError(t, err)
+	assert.NotContains(t, chain[0].ExtKeyUsage, x509.ExtKeyUsageCodeSigning)
+}
@@ -0,0 +1,100 @@
+package authority
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/smallstep/certificates/authority/admin"
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/db"
+	"github.com/smallstep/nosql/database"
+)
+
+func (a *Authority) webAuthnCredentialDB() (db.WebAuthnCredentialDB, error) {
+	if wdb, ok := a.db.(db.WebAuthnCredentialDB); ok {
+		return wdb, nil
+	}
+	return nil, admin.NewError(admin.ErrorNotImplementedType, "the configured database does not support webauthn credentials")
+}
+
+// getWebAuthnCredential is the provisioner.GetWebAuthnCredentialFunc used by
+// WebAuthn provisioners to load the credentials registered with the admin API.
+func (a *Authority) getWebAuthnCredential(_ context.Context, p provisioner.Interface, credentialID string) (*provisioner.WebAuthnCredential, error) {
+	wdb, err := a.webAuthnCredentialDB()
+	if err != nil {
+		return nil, err
+	}
+	return wdb.GetWebAuthnCredential(p.GetID(), credentialID)
+}
+
+// updateWebAuthnSignCount is the provisioner.UpdateWebAuthnSignCountFunc used
+// by WebAuthn provisioners to store the signature counter of the credentials
+// registered with the admin API.
+func (a *Authority) updateWebAuthnSignCount(_ context.Context, p provisioner.Interface, credentialID string, signCount uint32) error {
+	wdb, err := a.webAuthnCredentialDB()
+	if err != nil {
+		return err
+	}
+	return wdb.UpdateWebAuthnCredentialSignCount(p.GetID(), credentialID, signCount)
+}
+
+// GetWebAuthnCredentials returns the WebAuthn credentials registered for the
+// given provisioner.
+func (a *Authority) GetWebAuthnCredentials(_ context.Context, p provisioner.Interface) ([]*provisioner.WebAuthnCredential, error) {
+	wdb, err := a.webAuthnCredentialDB()
+	if err != nil {
+		return nil, err
+	}
+	creds, err := wdb.GetWebAuthnCredentials(p.GetID())
+	if err != nil {
+		return nil, admin.WrapErrorISE(err, "error loading webauthn credentials")
+	}
+	return creds, nil
+}
+
+// StoreWebAuthnCredential registers a WebAuthn credential for the given
+// provisioner.
+func (a *Authority) StoreWebAuthnCredential(_ context.Context, p provisioner.Interface, cred *provisioner.WebAuthnCredential) error {
+	wdb, err := a.webAuthnCredentialDB()
+	if err != nil {
+		return err
+	}
+	if p.GetType() != provisioner.TypeWebAuthn {
+		return admin.NewError(admin.ErrorBadRequestType, "provisioner %s is not a webauthn provisioner", p.GetName())
+	}
+	if err := cred.Validate(); err != nil {
+		return admin.WrapError(admin.ErrorBadRequestType, err, "invalid webauthn credential")
+	}
+
+	cred.ProvisionerID = p.GetID()
+	if cred.CreatedAt.IsZero() {
+		cred.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	}
+	if err := wdb.StoreWebAuthnCredential(cred); err != nil {
+		if errors.Is(err, db.ErrAlreadyExists) {
+			return admin.NewError(admin.ErrorConflictType, "webauthn credential %s already exists", cred.ID)
+		}
+		return admin.WrapErrorISE(err, "error storing webauthn credential")
+	}
+	return nil
+}
+
+// RemoveWebAuthnCredential removes a WebAuthn credential registered for the
+// given provisioner.
+func (a *Authority) RemoveWebAuthnCredential(_ context.Context, p provisioner.Interface, credentialID string) error {
+	wdb, err := a.webAuthnCredentialDB()
+	if err != nil {
+		return err
+	}
+	if _, err := wdb.GetWebAuthnCredential(p.GetID(), credentialID); err != nil {
+		if database.IsErrNotFound(err) {
+			return admin.NewError(admin.ErrorNotFoundType, "webauthn credential %s not found", credentialID)
+		}
+		return admin.WrapErrorISE(err, "error loading webauthn credential")
+	}
+	if err := wdb.DeleteWebAuthnCredential(p.GetID(), credentialID); err != nil {
+		return admin.WrapErrorISE(err, "error deleting webauthn credential")
+	}
+	return nil
+}
@@ -2,6 +2,12 @@ package authority
 
 import (
 	"context"
+	"crypto/x509"
+	"net"
+	"net/url"
+	"slices"
+
+	"github.com/pkg/errors"
 
 	"github.com/smallstep/certificates/webhook"
 )
@@ -9,4 +15,38 @@ import (
 type webhookController interface {
 	Enrich(context.Context, *webhook.RequestBody) error
 	Authorize(context.Context, *webhook.RequestBody) error
+	AuthorizeSANs(context.Context, *webhook.RequestBody) ([]string, error)
+}
+
+// restrictSANs removes from the given certificate the SANs that are not in the
+// list of SANs allowed by the authorizing webhooks. A nil list does not modify
+// the certificate.
+func restrictSANs(leaf *x509.Certificate, allowed []string) error {
+	if allowed == nil {
+		return nil
+	}
+	for _, ext := range leaf.ExtraExtensions {
+		if ext.Id.Equal(oidExtensionSubjectAltName) {
+			return errors.New("webhook cannot restrict the SANs of a certificate with a custom subject alternative name extension")
+		}
+	}
+
+	total := len(leaf.DNSNames) + len(leaf.EmailAddresses) + len(leaf.IPAddresses) + len(leaf.URIs)
+	leaf.DNSNames = slices.DeleteFunc(leaf.DNSNames, func(s string) bool {
+		return !slices.Contains(allowed, s)
+	})
+	leaf.EmailAddresses = slices.DeleteFunc(leaf.EmailAddresses, func(s string) bool {
+		return !slices.Contains(allowed, s)
+	})
+	leaf.IPAddresses = slices.DeleteFunc(leaf.IPAddresses, func(ip net.IP) bool {
+		return !slices.Contains(allowed, ip.String())
+	})
+	leaf.URIs = slices.DeleteFunc(leaf.URIs, func(u *url.URL) bool {
+		return !slices.Contains(allowed, u.String())
+	})
+
+	if total > 0 && len(leaf.DNSNames)+len(leaf.EmailAddresses)+len(leaf.IPAddresses)+len(leaf.URIs) == 0 {
+		return errors.New("webhook did not allow any of the certificate SANs")
+	}
+	return nil
 }
@@ -2,6 +2,17 @@ package authority
 
 import (
 	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/smallstep/certificates/authority/provisioner"
 	"github.com/smallstep/certificates/webhook"
@@ -10,6 +21,7 @@ import (
 type mockWebhookController struct {
 	enrichErr    error
 	authorizeErr error
+	allowedSANs  []string
 	templateData provisioner.WebhookSetter
 	respData     map[string]any
 }
@@ -27,3 +39,94 @@ func (wc *mockWebhookController) Enrich(context.Context, *webhook.RequestBody) e
 func (wc *mockWebhookController) Authorize(context.Context, *webhook.RequestBody) error {
 	return wc.authorizeErr
 }
+
+func (wc *mockWebhookController) AuthorizeSANs(context.Context, *webhook.RequestBody) ([]string, error) {
+	return wc.allowedSANs, wc.authorizeErr
+}
+
+func Test_restrictSANs(t *testing.T) {
+	mustURL := func(s string) *url.URL {
+		u, err := url.Parse(s)
+		require.NoError(t, err)
+		return u
+	}
+	newLeaf := func() *x509.Certificate {
+		return &x509.Certificate{
+			DNSNames:       []string{"foo.example.com", "bar.example.com"},
+			EmailAddresses: []string{"jane@example.com"},
+			IPAddresses:    []net.IP{net.ParseIP("10.0.0.1")},
+			URIs:           []*url.URL{mustURL("spiffe://example.com/foo")},
+		}
+	}
+	tests := []struct {
+		name    string
+		leaf    *x509.Certificate
+		allowed []string
+		want    *x509.Certificate
+		wantErr bool
+	}{
+		{"ok nil", newLeaf(), nil, newLeaf(), false},
+		{"ok all", newLeaf(), []string{"foo.example.com", "bar.example.com", "jane@example.com", "10.0.0.1", "spiffe://example.com/foo"}, newLeaf(), false},
+		{"ok some", newLeaf(), []string{"bar.example.com", "10.0.0.1"}, &x509.Certificate{
+			DNSNames:       []string{"bar.example.com"},
+			EmailAddresses: []string{},
+			IPAddresses:    []net.IP{net.ParseIP("10.0.0.1")},
+			URIs:           []*url.URL{},
+		}, false},
+		{"ok no sans", &x509.Certificate{}, []string{}, &x509.Certificate{}, false},
+		{"fail none", newLeaf(), []string{}, nil, true},
+		{"fail custom extension", &x509.Certificate{
+			ExtraExtensions: []pkix.Extension{{Id: oidExtensionSubjectAltName}},
+		}, []string{"foo.example.com"}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := restrictSANs(tt.leaf, tt.allowed)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, tt.leaf)
+		})
+	}
+}
+
+func TestAuthority_callAuthorizingWebhooksRevoke(t *testing.T) {
+	var got *webhook.RequestBody
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = new(webhook.RequestBody)
+		require.NoError(t, json.NewDecoder(r.Body).Decode(got))
+		allow := got.Revocation.ReasonCode != 1
+		require.NoError(t, json.NewEncoder(w).Encode(webhook.ResponseBody{Allow: allow}))
+	}))
+	defer ts.Close()
+
+	a := testAuthority(t)
+	prov := &provisioner.JWK{
+		Name: "inventory",
+		Type: "JWK",
+		Options: &provisioner.Options{
+			Webhooks: []*provisioner.Webhook{{Name: "inventory", Kind: "AUTHORIZING", URL: ts.URL}},
+		},
+	}
+	ctx := provisioner.NewContextWithMethod(context.Background(), provisioner.RevokeMethod)
+
+	require.NoError(t, a.callAuthorizingWebhooksRevoke(ctx, prov, &RevokeOptions{
+		Serial: "1234", ReasonCode: 4, Reason: "superseded",
+	}))
+	assert.Equal(t, webhook.OperationRevoke, got.Operation)
+	assert.Equal(t, &webhook.Revocation{SerialNumber: "1234", ReasonCode: 4, Reason: "superseded"}, got.Revocation)
+
+	err := a.callAuthorizingWebhooksRevoke(ctx, prov, &RevokeOptions{
+		Serial: "1234", ReasonCode: 1, Reason: "key compromise",
+	})
+	assert.ErrorIs(t, err, provisioner.ErrWebhookDenied)
+
+	// Provisioners without webhooks are not checked.
+	got = nil
+	require.NoError(t, a.callAuthorizingWebhooksRevoke(ctx, &provisioner.JWK{Name: "foo"}, &RevokeOptions{
+		Serial: "1234", ReasonCode: 1,
+	}))
+	assert.Nil(t, got)
+}
@@ -21,13 +21,16 @@ import (
 	"github.com/smallstep/certificates/acme"
 	acmeAPI "github.com/smallstep/certificates/acme/api"
 	acmeNoSQL "github.com/smallstep/certificates/acme/db/nosql"
+	"github.com/smallstep/certificates/acme/email"
 	"github.com/smallstep/certificates/api"
 	"github.com/smallstep/certificates/authority"
 	"github.com/smallstep/certificates/authority/admin"
 	adminAPI "github.com/smallstep/certificates/authority/admin/api"
 	"github.com/smallstep/certificates/authority/config"
 	"github.com/smallstep/certificates/cas/apiv1"
+	cmpAPI "github.com/smallstep/certificates/cmp/api"
 	"github.com/smallstep/certificates/db"
+	estAPI "github.com/smallstep/certificates/est/api"
 	"github.com/smallstep/certificates/internal/metrix"
 	"github.com/smallstep/certificates/logging"
 	"github.com/smallstep/certificates/middleware/requestid"
@@ -35,6 +38,7 @@ import (
 	"github.com/smallstep/certificates/scep"
 	scepAPI "github.com/smallstep/certificates/scep/api"
 	"github.com/smallstep/certificates/server"
+	wstepAPI "github.com/smallstep/certificates/wstep/api"
 	"github.com/smallstep/nosql"
 	"go.step.sm/cli-utils/step"
 	"go.step.sm/crypto/x509util"
@@ -51,6 +55,8 @@ type options struct {
 	database        db.AuthDB
 	x509CAService   apiv1.CertificateAuthorityService
 	tlsConfig       *tls.Config
+	acmeEmailClient acme.EmailClient
+	acmeRateLimits  acme.RateLimitStore
 }
 
 func (o *options) apply(opts []Option) {
@@ -131,6 +137,22 @@ func WithLinkedCAToken(token string) Option {
 	}
 }
 
+// WithACMEEmailClient sets the client used to send and verify the ACME
+// email-reply-00 challenges.
+func WithACMEEmailClient(c acme.EmailClient) Option {
+	return func(o *options) {
+		o.acmeEmailClient = c
+	}
+}
+
+// WithACMERateLimitStore sets the store used to keep the counters of the ACME
+// rate limits. By default, the ACME database is used if it supports them.
+func WithACMERateLimitStore(s acme.RateLimitStore) Option {
+	return func(o *options) {
+		o.acmeRateLimits = s
+	}
+}
+
 // WithQuiet sets the quiet flag.
 func WithQuiet(quiet bool) Option {
 	return func(o *options) {
@@ -148,7 +170,11 @@ type CA struct {
 	metricsSrv  *server.Server
 	opts        *options
 	renewer     *TLSRenewer
+	meter       *metrix.Meter
+	acmeDB      acme.DB
 	compactStop chan struct{}
+	acmeGCStop  chan struct{}
+	watchStop   chan struct{}
 }
 
 // New creates and initializes the CA with the given configuration and options.
@@ -157,6 +183,8 @@ func New(cfg *config.Config, opts ...Option) (*CA, error) {
 		config:      cfg,
 		opts:        new(options),
 		compactStop: make(chan struct{}),
+		acmeGCStop:  make(chan struct{}),
+		watchStop:   make(chan struct{}),
 	}
 	ca.opts.apply(opts)
 	return ca.Init(cfg)
@@ -193,6 +221,7 @@ func (ca *CA) Init(cfg *config.Config) (*CA, error) {
 		meter = metrix.New()
 		opts = append(opts, authority.WithMeter(meter))
 	}
+	ca.meter = meter
 
 	webhookTransport := http.DefaultTransport.(*http.Transport).Clone()
 	opts = append(opts, authority.WithWebhookClient(&http.Client{Transport: webhookTransport}))
@@ -241,6 +270,18 @@ func (ca *CA) Init(cfg *config.Config) (*CA, error) {
 	// Mount the CRL to the insecure mux
 	insecureMux.Get("/crl", api.CRL)
 	insecureMux.Get("/1.0/crl", api.CRL)
+	insecureMux.Get("/crl/delta", api.DeltaCRL)
+	insecureMux.Get("/1.0/crl/delta", api.DeltaCRL)
+	insecureMux.Get("/crl/{partition}", api.CRL)
+	insecureMux.Get("/1.0/crl/{partition}", api.CRL)
+	insecureMux.Get("/crl/{partition}/delta", api.DeltaCRL)
+	insecureMux.Get("/1.0/crl/{partition}/delta", api.DeltaCRL)
+
+	// Mount the OCSP responder to the insecure mux
+	insecureMux.Post("/ocsp", api.OCSP)
+	insecureMux.Get("/ocsp/*", api.OCSP)
+	insecureMux.Post("/1.0/ocsp", api.OCSP)
+	insecureMux.Get("/1.0/ocsp/*", api.OCSP)
 
 	// Add ACME api endpoints in /acme and /1.0/acme
 	dns := cfg.DNSNames[0]
@@ -262,6 +303,7 @@ func (ca *CA) Init(cfg *config.Config) (*CA, error) {
 			return nil, errors.Wrap(err, "error configuring ACME DB interface")
 		}
 		acmeLinker = acme.NewLinker(dns, "acme")
+		ca.acmeDB = acmeDB
 		mux.Route("/acme", func(r chi.Router) {
 			acmeAPI.Route(r)
 		})
@@ -315,6 +357,28 @@ func (ca *CA) Init(cfg *config.Config) (*CA, error) {
 		})
 	}
 
+	// EST operations require TLS, they are only available in the secure mux.
+	// The label in the path is the name of an EST provisioner.
+	mux.Route("/.well-known/est", func(r chi.Router) {
+		estAPI.Route(r)
+	})
+
+	// CMP messages are protected, so like SCEP, they are available over HTTP
+	// and HTTPS. The label in the path is the name of a CMP provisioner.
+	insecureMux.Route("/.well-known/cmp", func(r chi.Router) {
+		cmpAPI.Route(r)
+	})
+	mux.Route("/.well-known/cmp", func(r chi.Router) {
+		cmpAPI.Route(r)
+	})
+
+	// The Windows enrollment web services use Kerberos authentication over
+	// TLS, they are only available in the secure mux. The label in the path
+	// is the name of a WSTEP provisioner.
+	mux.Route("/wstep", func(r chi.Router) {
+		wstepAPI.Route(r)
+	})
+
 	// helpful routine for logging all routes
 	//dumpRoutes(mux)
 	//dumpRoutes(insecureMux)
@@ -347,6 +411,21 @@ func (ca *CA) Init(cfg *config.Config) (*CA, error) {
 
 	// Create context with all the necessary values.
 	baseContext := buildContext(auth, scepAuthority, acmeDB, acmeLinker)
+	emailClient := ca.opts.acmeEmailClient
+	if acmeDB != nil && emailClient == nil && cfg.ACMEEmail != nil {
+		if emailClient, err = newACMEEmailClient(cfg.ACMEEmail); err != nil {
+			return nil, err
+		}
+	}
+	if acmeDB != nil && emailClient != nil {
+		baseContext = acme.NewEmailClientContext(baseContext, emailClient)
+	}
+	if acmeDB != nil && ca.opts.acmeRateLimits != nil {
+		baseContext = acme.NewRateLimitStoreContext(baseContext, ca.opts.acmeRateLimits)
+	}
+	if acmeDB != nil && cfg.ACMEValidation != nil {
+		baseContext = acme.NewClientContext(baseContext, acme.NewClient(acmeClientOptions(cfg.ACMEValidation)...))
+	}
 
 	ca.srv = server.New(cfg.Address, handler, tlsConfig)
 	ca.srv.BaseContext = func(net.Listener) context.Context {
@@ -379,7 +458,7 @@ func (ca *CA) Init(cfg *config.Config) (*CA, error) {
 // shouldServeInsecureServer returns whether or not the insecure
 // server should also be started. This is (currently) only the case
 // if the insecure address has been configured AND when a SCEP
-// provisioner is configured or when a CRL is configured.
+// provisioner is configured or when a CRL or the OCSP responder is configured.
 func (ca *CA) shouldServeInsecureServer() bool {
 	switch {
 	case ca.config.InsecureAddress == "":
@@ -388,11 +467,48 @@ func (ca *CA) shouldServeInsecureServer() bool {
 		return true
 	case ca.config.CRL.IsEnabled():
 		return true
+	case ca.config.OCSP.IsEnabled():
+		return true
 	default:
 		return false
 	}
 }
 
+// acmeClientOptions returns the options used to create the client that
+// validates the ACME challenges. The configuration is already validated.
+func acmeClientOptions(c *config.ACMEValidationConfig) []acme.ClientOption {
+	opts := []acme.ClientOption{
+		acme.WithHTTP01Port(c.HTTP01Port),
+		acme.WithTLSALPN01Port(c.TLSALPN01Port),
+	}
+	if ip := net.ParseIP(c.SourceAddress); ip != nil {
+		opts = append(opts, acme.WithSourceAddress(ip))
+	}
+	if u, err := url.Parse(c.Proxy); err == nil && u.Host != "" {
+		opts = append(opts, acme.WithProxy(u))
+	}
+	return opts
+}
+
+// newACMEEmailClient creates the client used in the email-reply-00 challenges
+// from the acmeEmail configuration.
+func newACMEEmailClient(c *config.ACMEEmailConfig) (acme.EmailClient, error) {
+	server := func(s *config.EmailServerConfig) email.Server {
+		return email.Server{
+			Address:  s.Address,
+			Username: s.Username,
+			Password: s.Password,
+			TLS:      s.TLS,
+		}
+	}
+	return email.New(email.Options{
+		From:    c.From,
+		SMTP:    server(c.SMTP),
+		IMAP:    server(c.IMAP),
+		Mailbox: c.Mailbox,
+	})
+}
+
 // buildContext builds the server base context.
 func buildContext(a *authority.Authority, scepAuthority *scep.Authority, acmeDB acme.DB, acmeLinker acme.Linker) context.Context {
 	ctx := authority.NewContext(context.Background(), a)
@@ -451,6 +567,28 @@ func (ca *CA) Run() error {
 		ca.runCompactJob()
 	}()
 
+	if ca.config.ACMEGC.IsEnabled() {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ca.runACMEGarbageCollector()
+		}()
+	}
+
+	if ca.config.Reload.IsWatchEnabled() && ca.opts.configFile != "" {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := watchFile(ca.opts.configFile, ca.watchStop, func() {
+				if err := ca.ReloadProvisioners(); err != nil {
+					log.Printf("error reloading provisioners: %+v", err)
+				}
+			}); err != nil {
+				log.Printf("error watching configuration file: %+v", err)
+			}
+		}()
+	}
+
 	if ca.insecureSrv != nil {
 		wg.Add(1)
 		go func() {
@@ -498,6 +636,8 @@ func (ca *CA) Run() error {
 // Stop stops the CA calling to the server Shutdown method.
 func (ca *CA) Stop() error {
 	close(ca.compactStop)
+	close(ca.acmeGCStop)
+	close(ca.watchStop)
 	if ca.renewer != nil {
 		ca.renewer.Stop()
 	}
@@ -519,8 +659,13 @@ func (ca *CA) Stop() error {
 }
 
 // Reload reloads the configuration of the CA and calls to the server Reload
-// method.
+// method. If the reload is configured to only apply to provisioners, it will
+// just call ReloadProvisioners.
 func (ca *CA) Reload() error {
+	if ca.config.Reload.IsProvisionersOnly() {
+		return ca.ReloadProvisioners()
+	}
+
 	cfg, err := config.LoadConfiguration(ca.opts.configFile)
 	if err != nil {
 		return errors.Wrap(err, "error reloading ca configuration")
@@ -547,6 +692,8 @@ func (ca *CA) Reload() error {
 		WithQuiet(ca.opts.quiet),
 		WithConfigFile(ca.opts.configFile),
 		WithDatabase(ca.auth.GetDatabase()),
+		WithACMEEmailClient(ca.opts.acmeEmailClient),
+		WithACMERateLimitStore(ca.opts.acmeRateLimits),
 	)
 	if err != nil {
 		logContinue("Reload failed because the CA with new configuration could not be initialized.")
@@ -588,6 +735,27 @@ func (ca *CA) Reload() error {
 	return nil
 }
 
+// ReloadProvisioners reloads the provisioners and admins from the configuration
+// file, keeping the servers, the keys, and the ACME and nonce state intact.
+func (ca *CA) ReloadProvisioners() error {
+	if ca.opts.configFile == "" {
+		return errors.New("error reloading provisioners: configuration file is not set")
+	}
+	cfg, err := config.LoadConfiguration(ca.opts.configFile)
+	if err != nil {
+		return errors.Wrap(err, "error reloading ca configuration")
+	}
+	if err := ca.auth.ReloadProvisioners(context.Background(), cfg); err != nil {
+		log.Println("Reload failed because the provisioners could not be loaded.")
+		log.Println("Continuing to run with the original provisioners.")
+		return err
+	}
+	if !ca.opts.quiet {
+		log.Println("Provisioners reloaded.")
+	}
+	return nil
+}
+
 // get TLSConfig returns separate TLSConfigs for server and client with the
 // same self-renewing certificate.
 func (ca *CA) getTLSConfig(auth *authority.Authority) (*tls.Config, *tls.Config, error) {
@@ -729,3 +897,47 @@ func runCompact(c nosql.Compactor) {
 		err = c.Compact(0.7)
 	}
 }
+
+// runACMEGarbageCollector periodically removes the expired ACME objects if the
+// ACME database supports it.
+func (ca *CA) runACMEGarbageCollector() {
+	gc, ok := ca.acmeDB.(acme.GarbageCollector)
+	if !ok {
+		return
+	}
+
+	interval := ca.config.ACMEGC.GetInterval()
+	retention := ca.config.ACMEGC.GetRetention()
+
+	// Run the garbage collector at start.
+	ca.runACMEGarbageCollection(gc, retention)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ca.acmeGCStop:
+			return
+		case <-ticker.C:
+			ca.runACMEGarbageCollection(gc, retention)
+		}
+	}
+}
+
+// runACMEGarbageCollection removes the ACME objects that expired before the
+// retention time, and records the number of objects removed.
+func (ca *CA) runACMEGarbageCollection(gc acme.GarbageCollector, retention time.Duration) {
+	stats, err := gc.DeleteExpired(context.Background(), time.Now().Add(-retention))
+	if err != nil {
+		log.Printf("error removing expired ACME objects: %v", err)
+	}
+	if stats == nil || ca.meter == nil {
+		return
+	}
+	ca.meter.ACMEGarbageCollected("orders", stats.Orders)
+	ca.meter.ACMEGarbageCollected("authorizations", stats.Authorizations)
+	ca.meter.ACMEGarbageCollected("challenges", stats.Challenges)
+	ca.meter.ACMEGarbageCollected("nonces", stats.Nonces)
+	ca.meter.ACMEGarbageCollected("rate_limits", stats.RateLimits)
+}
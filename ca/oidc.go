@@ -0,0 +1,220 @@
+package ca
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"golang.org/x/oauth2"
+
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+// oidcConfiguration contains the OAuth 2.0 endpoints in the
+// `/.well-known/openid-configuration` document of an OIDC provider.
+type oidcConfiguration struct {
+	Issuer                      string `json:"issuer"`
+	TokenEndpoint               string `json:"token_endpoint"`
+	DeviceAuthorizationEndpoint string `json:"device_authorization_endpoint"`
+}
+
+// OIDCTokenSource generates OpenID Connect ID tokens for an OIDC provisioner
+// without a browser. The first token is obtained using the OAuth 2.0 device
+// authorization grant (RFC 8628), and the following ones using the refresh
+// token, so a headless server can enroll once and get new tokens to sign or
+// renew certificates later on.
+//
+// The CA only accepts an ID token once, so every call to Token returns a new
+// one. The refresh token can be persisted using RefreshToken and restored
+// using SetRefreshToken.
+type OIDCTokenSource struct {
+	name       string
+	config     *oauth2.Config
+	authParams []oauth2.AuthCodeOption
+	httpClient *http.Client
+	mu         sync.Mutex
+	idToken    string
+	token      *oauth2.Token
+}
+
+// NewOIDCTokenSource creates a token source for the OIDC provisioner with the
+// given name. The provisioner is loaded from the CA, and the OAuth 2.0
+// endpoints from the configuration endpoint of the provisioner.
+func NewOIDCTokenSource(name, caURL string, opts ...ClientOption) (*OIDCTokenSource, error) {
+	client, err := NewClient(caURL, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	provisioners, err := getProvisioners(client)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range provisioners {
+		if o, ok := p.(*provisioner.OIDC); ok && o.GetName() == name {
+			return newOIDCTokenSource(o, http.DefaultClient)
+		}
+	}
+	return nil, errors.Errorf("oidc provisioner %q not found", name)
+}
+
+func newOIDCTokenSource(p *provisioner.OIDC, httpClient *http.Client) (*OIDCTokenSource, error) {
+	u, err := url.Parse(p.ConfigurationEndpoint)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error parsing %s", p.ConfigurationEndpoint)
+	}
+	if !strings.Contains(u.Path, "/.well-known/openid-configuration") {
+		u.Path = path.Join(u.Path, "/.well-known/openid-configuration")
+	}
+
+	resp, err := httpClient.Get(u.String())
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to connect to %s", u)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return nil, errors.Errorf("error reading %s: status code %d", u, resp.StatusCode)
+	}
+	var conf oidcConfiguration
+	if err := json.NewDecoder(resp.Body).Decode(&conf); err != nil {
+		return nil, errors.Wrapf(err, "error reading %s", u)
+	}
+	if conf.TokenEndpoint == "" {
+		return nil, errors.Errorf("error parsing %s: token_endpoint cannot be empty", u)
+	}
+
+	// The offline_access scope is required to get a refresh token.
+	scopes := p.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{"openid", "email"}
+	}
+	if !containsString(scopes, "offline_access") {
+		scopes = append(scopes[:len(scopes):len(scopes)], "offline_access")
+	}
+
+	var authParams []oauth2.AuthCodeOption
+	for _, kv := range p.AuthParams {
+		if k, v, ok := strings.Cut(kv, "="); ok {
+			authParams = append(authParams, oauth2.SetAuthURLParam(k, v))
+		}
+	}
+
+	return &OIDCTokenSource{
+		name: p.GetName(),
+		config: &oauth2.Config{
+			ClientID:     p.ClientID,
+			ClientSecret: p.ClientSecret,
+			Scopes:       scopes,
+			Endpoint: oauth2.Endpoint{
+				TokenURL:      conf.TokenEndpoint,
+				DeviceAuthURL: conf.DeviceAuthorizationEndpoint,
+			},
+		},
+		authParams: authParams,
+		httpClient: httpClient,
+	}, nil
+}
+
+// DeviceAuthorization runs the OAuth 2.0 device authorization grant. The
+// prompt function is called with the verification uri and the user code that
+// the user has to enter in a browser, possibly on another device. The method
+// blocks until the user completes the flow, the code expires, or the context
+// is done.
+func (s *OIDCTokenSource) DeviceAuthorization(ctx context.Context, prompt func(verificationURI, userCode string)) error {
+	if s.config.Endpoint.DeviceAuthURL == "" {
+		return errors.Errorf("oidc provisioner %q does not support the device authorization grant", s.name)
+	}
+
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, s.httpClient)
+	da, err := s.config.DeviceAuth(ctx, s.authParams...)
+	if err != nil {
+		return errors.Wrap(err, "error starting device authorization")
+	}
+	if da.VerificationURIComplete != "" {
+		prompt(da.VerificationURIComplete, da.UserCode)
+	} else {
+		prompt(da.VerificationURI, da.UserCode)
+	}
+
+	tok, err := s.config.DeviceAccessToken(ctx, da)
+	if err != nil {
+		return errors.Wrap(err, "error completing device authorization")
+	}
+	return s.setToken(tok)
+}
+
+// SetRefreshToken sets the refresh token used to get new ID tokens, e.g. one
+// persisted from a previous run.
+func (s *OIDCTokenSource) SetRefreshToken(refreshToken string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.idToken = ""
+	s.token = &oauth2.Token{RefreshToken: refreshToken}
+}
+
+// RefreshToken returns the current refresh token, it can be empty if the
+// provider did not return one.
+func (s *OIDCTokenSource) RefreshToken() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.token == nil {
+		return ""
+	}
+	return s.token.RefreshToken
+}
+
+// Token returns a new ID token that can be used with the OIDC provisioner.
+func (s *OIDCTokenSource) Token(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Use the token from the device authorization if it was not used yet.
+	if s.idToken != "" {
+		tok := s.idToken
+		s.idToken = ""
+		return tok, nil
+	}
+
+	if s.token == nil || s.token.RefreshToken == "" {
+		return "", errors.New("error getting oidc token: a refresh token is not available, device authorization is required")
+	}
+
+	// Force a refresh, ID tokens cannot be reused.
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, s.httpClient)
+	tok, err := s.config.TokenSource(ctx, &oauth2.Token{RefreshToken: s.token.RefreshToken}).Token()
+	if err != nil {
+		return "", errors.Wrap(err, "error refreshing oidc token")
+	}
+	idToken, ok := tok.Extra("id_token").(string)
+	if !ok || idToken == "" {
+		return "", errors.New("error refreshing oidc token: id_token not found")
+	}
+	s.token = tok
+	return idToken, nil
+}
+
+func (s *OIDCTokenSource) setToken(tok *oauth2.Token) error {
+	idToken, ok := tok.Extra("id_token").(string)
+	if !ok || idToken == "" {
+		return errors.New("error getting oidc token: id_token not found")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.idToken = idToken
+	s.token = tok
+	return nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,148 @@
+package ca
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+// newTestIdP returns a fake OIDC provider that supports the device
+// authorization and refresh token grants.
+func newTestIdP(t *testing.T, deviceAuth bool) *httptest.Server {
+	t.Helper()
+	var pending, count atomic.Int32
+	pending.Store(1)
+
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	writeJSON := func(w http.ResponseWriter, code int, v any) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		json.NewEncoder(w).Encode(v)
+	}
+
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		conf := map[string]string{
+			"issuer":         srv.URL,
+			"token_endpoint": srv.URL + "/token",
+		}
+		if deviceAuth {
+			conf["device_authorization_endpoint"] = srv.URL + "/device"
+		}
+		writeJSON(w, http.StatusOK, conf)
+	})
+	mux.HandleFunc("/device", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("client_id") != "client-id" || r.FormValue("scope") != "openid email offline_access" {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{
+			"device_code":      "device-code",
+			"user_code":        "ABCD-EFGH",
+			"verification_uri": srv.URL + "/activate",
+			"expires_in":       60,
+			"interval":         1,
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		switch r.FormValue("grant_type") {
+		case "urn:ietf:params:oauth:grant-type:device_code":
+			if r.FormValue("device_code") != "device-code" {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+				return
+			}
+			// Require one poll before the user completes the flow.
+			if pending.Add(-1) >= 0 {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": "authorization_pending"})
+				return
+			}
+		case "refresh_token":
+			if r.FormValue("refresh_token") != "refresh-token" {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+				return
+			}
+		default:
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "unsupported_grant_type"})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{
+			"access_token":  "access-token",
+			"token_type":    "Bearer",
+			"expires_in":    3600,
+			"refresh_token": "refresh-token",
+			"id_token":      fmt.Sprintf("id-token-%d", count.Add(1)),
+		})
+	})
+	return srv
+}
+
+func TestOIDCTokenSource(t *testing.T) {
+	srv := newTestIdP(t, true)
+	s, err := newOIDCTokenSource(&provisioner.OIDC{
+		Type:                  "OIDC",
+		Name:                  "idp",
+		ClientID:              "client-id",
+		ConfigurationEndpoint: srv.URL,
+	}, srv.Client())
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	_, err = s.Token(ctx)
+	assert.Error(t, err)
+
+	var prompted string
+	require.NoError(t, s.DeviceAuthorization(ctx, func(verificationURI, userCode string) {
+		prompted = verificationURI + " " + userCode
+	}))
+	assert.Equal(t, srv.URL+"/activate ABCD-EFGH", prompted)
+	assert.Equal(t, "refresh-token", s.RefreshToken())
+
+	// The first token comes from the device authorization, the next ones are
+	// refreshed.
+	for _, want := range []string{"id-token-1", "id-token-2", "id-token-3"} {
+		tok, err := s.Token(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, want, tok)
+	}
+
+	s.SetRefreshToken("bad-token")
+	_, err = s.Token(ctx)
+	assert.Error(t, err)
+
+	s.SetRefreshToken("refresh-token")
+	tok, err := s.Token(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "id-token-4", tok)
+}
+
+func TestOIDCTokenSource_noDeviceAuthorization(t *testing.T) {
+	srv := newTestIdP(t, false)
+	s, err := newOIDCTokenSource(&provisioner.OIDC{
+		Type:                  "OIDC",
+		Name:                  "idp",
+		ClientID:              "client-id",
+		ConfigurationEndpoint: srv.URL + "/.well-known/openid-configuration",
+		Scopes:                []string{"openid", "email", "offline_access"},
+	}, srv.Client())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"openid", "email", "offline_access"}, s.config.Scopes)
+	assert.Error(t, s.DeviceAuthorization(context.Background(), func(string, string) {
+		t.Fatal("unexpected prompt")
+	}))
+
+	_, err = newOIDCTokenSource(&provisioner.OIDC{
+		ConfigurationEndpoint: srv.URL + "/missing",
+	}, srv.Client())
+	assert.Error(t, err)
+}
@@ -0,0 +1,74 @@
+package ca
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/pkg/errors"
+)
+
+// configWatchDelay is the time to wait after the last change in the
+// configuration directory before reloading, editors usually generate multiple
+// events for a single save.
+var configWatchDelay = 500 * time.Millisecond
+
+// watchFile calls fn every time the content of the given file changes, until
+// the stop channel is closed. It watches the parent directory so that files
+// replaced with a rename, or symlinks updated like in Kubernetes ConfigMaps,
+// are also detected.
+func watchFile(filename string, stop <-chan struct{}, fn func()) error {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return errors.Wrap(err, "error creating file watcher")
+	}
+	defer w.Close()
+
+	if err := w.Add(filepath.Dir(filename)); err != nil {
+		return errors.Wrapf(err, "error watching %s", filename)
+	}
+
+	last := fileHash(filename)
+	timer := time.NewTimer(configWatchDelay)
+	timer.Stop()
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return nil
+		case _, ok := <-w.Events:
+			if !ok {
+				return nil
+			}
+			timer.Reset(configWatchDelay)
+		case err, ok := <-w.Errors:
+			if !ok {
+				return nil
+			}
+			log.Printf("error watching %s: %v", filename, err)
+		case <-timer.C:
+			// Files can be changed without changing their content, or the
+			// event can be about a different file in the directory.
+			if h := fileHash(filename); h != nil && !bytes.Equal(h, last) {
+				last = h
+				fn()
+			}
+		}
+	}
+}
+
+// fileHash returns the SHA-256 of the given file, or nil if the file cannot be
+// read.
+func fileHash(filename string) []byte {
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return nil
+	}
+	sum := sha256.Sum256(b)
+	return sum[:]
+}
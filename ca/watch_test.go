@@ -0,0 +1,63 @@
+package ca
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_watchFile(t *testing.T) {
+	delay := configWatchDelay
+	configWatchDelay = 10 * time.Millisecond
+	t.Cleanup(func() { configWatchDelay = delay })
+
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "ca.json")
+	require.NoError(t, os.WriteFile(filename, []byte(`{}`), 0600))
+
+	calls := make(chan struct{}, 10)
+	stop := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		done <- watchFile(filename, stop, func() {
+			calls <- struct{}{}
+		})
+	}()
+
+	// Give the watcher time to start.
+	time.Sleep(100 * time.Millisecond)
+
+	// Other files and identical content do not trigger a reload.
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "other.json"), []byte(`{"foo":"bar"}`), 0600))
+	require.NoError(t, os.WriteFile(filename, []byte(`{}`), 0600))
+	select {
+	case <-calls:
+		t.Fatal("unexpected reload")
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	// Changes in the file trigger a reload.
+	require.NoError(t, os.WriteFile(filename, []byte(`{"address":":443"}`), 0600))
+	select {
+	case <-calls:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected reload")
+	}
+
+	// Replacing the file with a rename triggers a reload.
+	tmp := filepath.Join(dir, "ca.json.tmp")
+	require.NoError(t, os.WriteFile(tmp, []byte(`{"address":":8443"}`), 0600))
+	require.NoError(t, os.Rename(tmp, filename))
+	select {
+	case <-calls:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected reload")
+	}
+
+	close(stop)
+	assert.NoError(t, <-done)
+}
@@ -0,0 +1,341 @@
+package acmecas
+
+import (
+	"context"
+	"crypto"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"go.step.sm/crypto/pemutil"
+	"golang.org/x/crypto/acme"
+
+	"github.com/smallstep/certificates/cas/apiv1"
+)
+
+func init() {
+	apiv1.Register(apiv1.ACMECAS, func(ctx context.Context, opts apiv1.Options) (apiv1.CertificateAuthorityService, error) {
+		return New(ctx, opts)
+	})
+}
+
+// Options are the ACMECAS options, they are set in the config property of the
+// CAS options.
+type Options struct {
+	// AccountKey is the path to the PEM encoded private key of the ACME
+	// account.
+	AccountKey         string `json:"accountKey"`
+	AccountKeyPassword string `json:"accountKeyPassword,omitempty"`
+	// Contact is the list of contact URLs of the account, e.g.
+	// "mailto:admin@example.com".
+	Contact []string `json:"contact,omitempty"`
+	// EAB is the external account binding used to register the account.
+	EAB *EABOptions `json:"eab,omitempty"`
+	// Root is the path to a PEM bundle used to verify the TLS connection to
+	// the upstream server. If empty, the system roots are used.
+	Root string `json:"root,omitempty"`
+	// HTTP01Address, if set, is the address where the http-01 challenges of
+	// pending authorizations are served. If not set, the upstream must
+	// consider the authorizations of the account valid.
+	HTTP01Address string `json:"http01Address,omitempty"`
+}
+
+// EABOptions contains the external account binding credentials.
+type EABOptions struct {
+	KeyID string `json:"kid"`
+	// HMACKey is the base64url encoded MAC key.
+	HMACKey string `json:"hmacKey"`
+}
+
+// ACMECAS implements a CertificateAuthorityService that issues certificates
+// using an upstream ACME server.
+type ACMECAS struct {
+	client *acme.Client
+	http01 *http01Solver
+}
+
+// New creates a new CertificateAuthorityService implementation that forwards
+// certificate requests to an upstream ACME server. The certificate authority
+// must be the URL of the ACME directory.
+func New(ctx context.Context, opts apiv1.Options) (*ACMECAS, error) {
+	if opts.CertificateAuthority == "" {
+		return nil, errors.New("acmecas 'certificateAuthority' cannot be empty")
+	}
+
+	var o Options
+	if opts.Config != nil {
+		if err := json.Unmarshal(opts.Config, &o); err != nil {
+			return nil, fmt.Errorf("error decoding acmecas config: %w", err)
+		}
+	}
+	if o.AccountKey == "" {
+		return nil, errors.New("acmecas 'accountKey' cannot be empty")
+	}
+
+	var pemOpts []pemutil.Options
+	if o.AccountKeyPassword != "" {
+		pemOpts = append(pemOpts, pemutil.WithPassword([]byte(o.AccountKeyPassword)))
+	}
+	v, err := pemutil.Read(o.AccountKey, pemOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("error reading acmecas accountKey: %w", err)
+	}
+	key, ok := v.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("error reading acmecas accountKey: key is not a private key")
+	}
+
+	httpClient := &http.Client{Timeout: 30 * time.Second}
+	if o.Root != "" {
+		b, err := os.ReadFile(o.Root)
+		if err != nil {
+			return nil, fmt.Errorf("error reading acmecas root: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(b) {
+			return nil, errors.New("error reading acmecas root: no certificates found")
+		}
+		tr := http.DefaultTransport.(*http.Transport).Clone()
+		tr.TLSClientConfig = &tls.Config{
+			RootCAs:    pool,
+			MinVersion: tls.VersionTLS12,
+		}
+		httpClient.Transport = tr
+	}
+
+	client := &acme.Client{
+		Key:          key,
+		DirectoryURL: opts.CertificateAuthority,
+		HTTPClient:   httpClient,
+		UserAgent:    "step-ca",
+	}
+
+	acct := &acme.Account{Contact: o.Contact}
+	if o.EAB != nil {
+		hmacKey, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(o.EAB.HMACKey, "="))
+		if err != nil {
+			return nil, fmt.Errorf("error decoding acmecas eab hmacKey: %w", err)
+		}
+		acct.ExternalAccountBinding = &acme.ExternalAccountBinding{
+			KID: o.EAB.KeyID,
+			Key: hmacKey,
+		}
+	}
+
+	rctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	if _, err := client.Register(rctx, acct, acme.AcceptTOS); err != nil && !errors.Is(err, acme.ErrAccountAlreadyExists) {
+		return nil, fmt.Errorf("error registering acme account: %w", err)
+	}
+
+	ca := &ACMECAS{client: client}
+	if o.HTTP01Address != "" {
+		if ca.http01, err = newHTTP01Solver(o.HTTP01Address); err != nil {
+			return nil, err
+		}
+	}
+	return ca, nil
+}
+
+// Type returns the type of this CertificateAuthorityService.
+func (c *ACMECAS) Type() apiv1.Type {
+	return apiv1.ACMECAS
+}
+
+// CreateCertificate sends the certificate request to the upstream ACME server.
+// The identifiers of the order are the DNS names and IP addresses in the CSR.
+func (c *ACMECAS) CreateCertificate(req *apiv1.CreateCertificateRequest) (*apiv1.CreateCertificateResponse, error) {
+	if req.CSR == nil {
+		return nil, errors.New("createCertificateRequest `csr` cannot be nil")
+	}
+
+	cert, chain, err := c.createCertificate(req.CSR)
+	if err != nil {
+		return nil, err
+	}
+
+	return &apiv1.CreateCertificateResponse{
+		Certificate:      cert,
+		CertificateChain: chain,
+	}, nil
+}
+
+// RenewCertificate sends the certificate request to the upstream ACME server.
+// ACME only signs certificate requests, so renewals without a CSR will return
+// a non-implemented error.
+func (c *ACMECAS) RenewCertificate(req *apiv1.RenewCertificateRequest) (*apiv1.RenewCertificateResponse, error) {
+	if req.CSR == nil {
+		return nil, apiv1.NotImplementedError{Message: "acmecas does not support renewals without a certificate request"}
+	}
+
+	cert, chain, err := c.createCertificate(req.CSR)
+	if err != nil {
+		return nil, err
+	}
+
+	return &apiv1.RenewCertificateResponse{
+		Certificate:      cert,
+		CertificateChain: chain,
+	}, nil
+}
+
+// RevokeCertificate revokes the certificate in the upstream ACME server using
+// the account key.
+func (c *ACMECAS) RevokeCertificate(req *apiv1.RevokeCertificateRequest) (*apiv1.RevokeCertificateResponse, error) {
+	if req.Certificate == nil {
+		return nil, errors.New("revokeCertificateRequest `certificate` cannot be nil")
+	}
+
+	ctx, cancel := defaultContext()
+	defer cancel()
+
+	if err := c.client.RevokeCert(ctx, nil, req.Certificate.Raw, acme.CRLReasonCode(req.ReasonCode)); err != nil {
+		return nil, fmt.Errorf("error revoking certificate: %w", err)
+	}
+
+	return &apiv1.RevokeCertificateResponse{
+		Certificate: req.Certificate,
+	}, nil
+}
+
+func (c *ACMECAS) createCertificate(cr *x509.CertificateRequest) (*x509.Certificate, []*x509.Certificate, error) {
+	ids := acme.DomainIDs(cr.DNSNames...)
+	for _, ip := range cr.IPAddresses {
+		ids = append(ids, acme.IPIDs(ip.String())...)
+	}
+	if len(ids) == 0 {
+		return nil, nil, errors.New("error creating certificate: certificate request does not contain DNS names or IP addresses")
+	}
+
+	ctx, cancel := defaultContext()
+	defer cancel()
+
+	order, err := c.client.AuthorizeOrder(ctx, ids)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error creating acme order: %w", err)
+	}
+	for _, u := range order.AuthzURLs {
+		if err := c.authorize(ctx, u); err != nil {
+			return nil, nil, err
+		}
+	}
+	if order, err = c.client.WaitOrder(ctx, order.URI); err != nil {
+		return nil, nil, fmt.Errorf("error waiting for acme order: %w", err)
+	}
+
+	ders, _, err := c.client.CreateOrderCert(ctx, order.FinalizeURL, cr.Raw, true)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error finalizing acme order: %w", err)
+	}
+	certs := make([]*x509.Certificate, len(ders))
+	for i, der := range ders {
+		if certs[i], err = x509.ParseCertificate(der); err != nil {
+			return nil, nil, fmt.Errorf("error parsing certificate: %w", err)
+		}
+	}
+	if len(certs) == 0 {
+		return nil, nil, errors.New("error finalizing acme order: response does not contain a certificate")
+	}
+
+	return certs[0], certs[1:], nil
+}
+
+// authorize completes a pending authorization using the http-01 challenge.
+func (c *ACMECAS) authorize(ctx context.Context, u string) error {
+	authz, err := c.client.GetAuthorization(ctx, u)
+	if err != nil {
+		return fmt.Errorf("error getting acme authorization: %w", err)
+	}
+	switch authz.Status {
+	case acme.StatusValid:
+		return nil
+	case acme.StatusPending:
+	default:
+		return fmt.Errorf("acme authorization for %s is %s", authz.Identifier.Value, authz.Status)
+	}
+
+	if c.http01 == nil {
+		return fmt.Errorf("acme authorization for %s is pending and http01Address is not configured", authz.Identifier.Value)
+	}
+	var chal *acme.Challenge
+	for _, ch := range authz.Challenges {
+		if ch.Type == "http-01" {
+			chal = ch
+			break
+		}
+	}
+	if chal == nil {
+		return fmt.Errorf("acme authorization for %s does not support the http-01 challenge", authz.Identifier.Value)
+	}
+
+	keyAuth, err := c.client.HTTP01ChallengeResponse(chal.Token)
+	if err != nil {
+		return fmt.Errorf("error creating http-01 challenge response: %w", err)
+	}
+	c.http01.add(chal.Token, keyAuth)
+	defer c.http01.remove(chal.Token)
+
+	if _, err := c.client.Accept(ctx, chal); err != nil {
+		return fmt.Errorf("error accepting acme challenge: %w", err)
+	}
+	if _, err := c.client.WaitAuthorization(ctx, u); err != nil {
+		return fmt.Errorf("error waiting for acme authorization: %w", err)
+	}
+	return nil
+}
+
+// http01Solver serves the responses of the http-01 challenges.
+type http01Solver struct {
+	listener net.Listener
+	tokens   sync.Map
+}
+
+func newHTTP01Solver(address string) (*http01Solver, error) {
+	ln, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, fmt.Errorf("error listening on %s: %w", address, err)
+	}
+	s := &http01Solver{listener: ln}
+	srv := &http.Server{
+		Handler:           s,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go srv.Serve(ln) //nolint:errcheck // the server runs until the process exits
+	return s, nil
+}
+
+func (s *http01Solver) add(token, keyAuth string) {
+	s.tokens.Store(token, keyAuth)
+}
+
+func (s *http01Solver) remove(token string) {
+	s.tokens.Delete(token)
+}
+
+func (s *http01Solver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	token, ok := strings.CutPrefix(r.URL.Path, "/.well-known/acme-challenge/")
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	v, ok := s.tokens.Load(token)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain")
+	w.Write([]byte(v.(string)))
+}
+
+func defaultContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), 2*time.Minute)
+}
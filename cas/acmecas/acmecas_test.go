@@ -0,0 +1,334 @@
+package acmecas
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.step.sm/crypto/pemutil"
+
+	"github.com/smallstep/certificates/cas/apiv1"
+)
+
+// testACMEServer is a minimal ACME server that issues certificates for the
+// CSRs in the finalize requests.
+type testACMEServer struct {
+	*httptest.Server
+	t           *testing.T
+	ca          *x509.Certificate
+	caKey       *ecdsa.PrivateKey
+	mu          sync.Mutex
+	authzStatus string
+	http01URL   string
+	eab         bool
+	issued      *x509.Certificate
+	revoked     bool
+}
+
+func newTestACMEServer(t *testing.T, authzStatus string) *testACMEServer {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Upstream CA"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	require.NoError(t, err)
+	ca, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	s := &testACMEServer{t: t, ca: ca, caKey: key, authzStatus: authzStatus}
+	s.Server = httptest.NewServer(s)
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *testACMEServer) payload(r *http.Request) []byte {
+	var jws struct {
+		Payload string `json:"payload"`
+	}
+	body, err := io.ReadAll(r.Body)
+	require.NoError(s.t, err)
+	require.NoError(s.t, json.Unmarshal(body, &jws))
+	b, err := base64.RawURLEncoding.DecodeString(jws.Payload)
+	require.NoError(s.t, err)
+	return b
+}
+
+func (s *testACMEServer) writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func (s *testACMEServer) order(status string) map[string]any {
+	o := map[string]any{
+		"status":         status,
+		"identifiers":    []map[string]string{{"type": "dns", "value": "test.example.com"}},
+		"authorizations": []string{s.URL + "/authz/1"},
+		"finalize":       s.URL + "/order/1/finalize",
+	}
+	if status == "valid" {
+		o["certificate"] = s.URL + "/cert/1"
+	}
+	return o
+}
+
+func (s *testACMEServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	w.Header().Set("Replay-Nonce", "nonce-"+time.Now().Format(time.RFC3339Nano))
+	switch r.URL.Path {
+	case "/directory":
+		s.writeJSON(w, http.StatusOK, map[string]string{
+			"newNonce":   s.URL + "/nonce",
+			"newAccount": s.URL + "/new-account",
+			"newOrder":   s.URL + "/new-order",
+			"revokeCert": s.URL + "/revoke",
+		})
+	case "/nonce":
+		w.WriteHeader(http.StatusOK)
+	case "/new-account":
+		var acct struct {
+			EAB json.RawMessage `json:"externalAccountBinding"`
+		}
+		assert.NoError(s.t, json.Unmarshal(s.payload(r), &acct))
+		s.eab = len(acct.EAB) > 0
+		w.Header().Set("Location", s.URL+"/account/1")
+		s.writeJSON(w, http.StatusCreated, map[string]string{"status": "valid"})
+	case "/new-order":
+		w.Header().Set("Location", s.URL+"/order/1")
+		s.writeJSON(w, http.StatusCreated, s.order("pending"))
+	case "/authz/1":
+		s.writeJSON(w, http.StatusOK, map[string]any{
+			"status":     s.authzStatus,
+			"identifier": map[string]string{"type": "dns", "value": "test.example.com"},
+			"challenges": []map[string]string{{"type": "http-01", "url": s.URL + "/chall/1", "token": "token", "status": "pending"}},
+		})
+	case "/chall/1":
+		// Validate the http-01 challenge.
+		resp, err := http.Get(s.http01URL + "/.well-known/acme-challenge/token")
+		if assert.NoError(s.t, err) {
+			b, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if assert.Equal(s.t, http.StatusOK, resp.StatusCode) && assert.True(s.t, strings.HasPrefix(string(b), "token.")) {
+				s.authzStatus = "valid"
+			}
+		}
+		s.writeJSON(w, http.StatusOK, map[string]string{"type": "http-01", "url": s.URL + "/chall/1", "token": "token", "status": "processing"})
+	case "/order/1":
+		if s.issued != nil {
+			s.writeJSON(w, http.StatusOK, s.order("valid"))
+		} else {
+			s.writeJSON(w, http.StatusOK, s.order("ready"))
+		}
+	case "/order/1/finalize":
+		var req struct {
+			CSR string `json:"csr"`
+		}
+		assert.NoError(s.t, json.Unmarshal(s.payload(r), &req))
+		der, err := base64.RawURLEncoding.DecodeString(req.CSR)
+		require.NoError(s.t, err)
+		csr, err := x509.ParseCertificateRequest(der)
+		require.NoError(s.t, err)
+		der, err = x509.CreateCertificate(rand.Reader, &x509.Certificate{
+			SerialNumber: big.NewInt(1234),
+			Subject:      csr.Subject,
+			DNSNames:     csr.DNSNames,
+			NotBefore:    time.Now(),
+			NotAfter:     time.Now().Add(time.Hour),
+		}, s.ca, csr.PublicKey, s.caKey)
+		require.NoError(s.t, err)
+		s.issued, err = x509.ParseCertificate(der)
+		require.NoError(s.t, err)
+		s.writeJSON(w, http.StatusOK, s.order("valid"))
+	case "/cert/1":
+		w.Header().Set("Content-Type", "application/pem-certificate-chain")
+		pem.Encode(w, &pem.Block{Type: "CERTIFICATE", Bytes: s.issued.Raw})
+		pem.Encode(w, &pem.Block{Type: "CERTIFICATE", Bytes: s.ca.Raw})
+	case "/revoke":
+		s.revoked = true
+		w.WriteHeader(http.StatusOK)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func writeAccountKey(t *testing.T) string {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	block, err := pemutil.Serialize(key)
+	require.NoError(t, err)
+	fn := filepath.Join(t.TempDir(), "account.key")
+	require.NoError(t, os.WriteFile(fn, pem.EncodeToMemory(block), 0600))
+	return fn
+}
+
+func mustCSR(t *testing.T, dnsNames ...string) *x509.CertificateRequest {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: "test.example.com"},
+		DNSNames: dnsNames,
+	}, key)
+	require.NoError(t, err)
+	cr, err := x509.ParseCertificateRequest(der)
+	require.NoError(t, err)
+	return cr
+}
+
+func TestNew(t *testing.T) {
+	srv := newTestACMEServer(t, "valid")
+	keyFile := writeAccountKey(t)
+
+	ca, err := New(context.Background(), apiv1.Options{
+		Type:                 "acmecas",
+		CertificateAuthority: srv.URL + "/directory",
+		Config:               []byte(`{"accountKey":"` + keyFile + `","eab":{"kid":"kid","hmacKey":"c2VjcmV0LWtleQ"}}`),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, apiv1.ACMECAS, string(ca.Type()))
+	assert.True(t, srv.eab)
+	assert.Nil(t, ca.http01)
+
+	tests := []struct {
+		name string
+		opts apiv1.Options
+	}{
+		{"fail certificateAuthority", apiv1.Options{Config: []byte(`{"accountKey":"` + keyFile + `"}`)}},
+		{"fail config", apiv1.Options{CertificateAuthority: srv.URL + "/directory", Config: []byte(`{`)}},
+		{"fail accountKey", apiv1.Options{CertificateAuthority: srv.URL + "/directory", Config: []byte(`{}`)}},
+		{"fail missing accountKey", apiv1.Options{CertificateAuthority: srv.URL + "/directory", Config: []byte(`{"accountKey":"testdata/missing.key"}`)}},
+		{"fail eab", apiv1.Options{CertificateAuthority: srv.URL + "/directory", Config: []byte(`{"accountKey":"` + keyFile + `","eab":{"kid":"kid","hmacKey":"%%%"}}`)}},
+		{"fail directory", apiv1.Options{CertificateAuthority: srv.URL + "/missing", Config: []byte(`{"accountKey":"` + keyFile + `"}`)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New(context.Background(), tt.opts)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestACMECAS_CreateCertificate(t *testing.T) {
+	srv := newTestACMEServer(t, "valid")
+	ca, err := New(context.Background(), apiv1.Options{
+		CertificateAuthority: srv.URL + "/directory",
+		Config:               []byte(`{"accountKey":"` + writeAccountKey(t) + `"}`),
+	})
+	require.NoError(t, err)
+
+	resp, err := ca.CreateCertificate(&apiv1.CreateCertificateRequest{
+		CSR:      mustCSR(t, "test.example.com"),
+		Lifetime: time.Hour,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, srv.issued, resp.Certificate)
+	assert.Equal(t, []*x509.Certificate{srv.ca}, resp.CertificateChain)
+
+	_, err = ca.CreateCertificate(&apiv1.CreateCertificateRequest{Lifetime: time.Hour})
+	assert.Error(t, err)
+	_, err = ca.CreateCertificate(&apiv1.CreateCertificateRequest{CSR: mustCSR(t), Lifetime: time.Hour})
+	assert.Error(t, err)
+}
+
+func TestACMECAS_CreateCertificate_http01(t *testing.T) {
+	srv := newTestACMEServer(t, "pending")
+	ca, err := New(context.Background(), apiv1.Options{
+		CertificateAuthority: srv.URL + "/directory",
+		Config:               []byte(`{"accountKey":"` + writeAccountKey(t) + `","http01Address":"127.0.0.1:0"}`),
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { ca.http01.listener.Close() })
+	srv.http01URL = "http://" + ca.http01.listener.Addr().(*net.TCPAddr).String()
+
+	resp, err := ca.CreateCertificate(&apiv1.CreateCertificateRequest{
+		CSR:      mustCSR(t, "test.example.com"),
+		Lifetime: time.Hour,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, srv.issued, resp.Certificate)
+	assert.Equal(t, "valid", srv.authzStatus)
+}
+
+func TestACMECAS_CreateCertificate_pending(t *testing.T) {
+	srv := newTestACMEServer(t, "pending")
+	ca, err := New(context.Background(), apiv1.Options{
+		CertificateAuthority: srv.URL + "/directory",
+		Config:               []byte(`{"accountKey":"` + writeAccountKey(t) + `"}`),
+	})
+	require.NoError(t, err)
+
+	_, err = ca.CreateCertificate(&apiv1.CreateCertificateRequest{
+		CSR:      mustCSR(t, "test.example.com"),
+		Lifetime: time.Hour,
+	})
+	assert.ErrorContains(t, err, "http01Address is not configured")
+}
+
+func TestACMECAS_RenewCertificate(t *testing.T) {
+	srv := newTestACMEServer(t, "valid")
+	ca, err := New(context.Background(), apiv1.Options{
+		CertificateAuthority: srv.URL + "/directory",
+		Config:               []byte(`{"accountKey":"` + writeAccountKey(t) + `"}`),
+	})
+	require.NoError(t, err)
+
+	resp, err := ca.RenewCertificate(&apiv1.RenewCertificateRequest{
+		CSR:      mustCSR(t, "test.example.com"),
+		Lifetime: time.Hour,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, srv.issued, resp.Certificate)
+
+	_, err = ca.RenewCertificate(&apiv1.RenewCertificateRequest{Template: srv.issued, Lifetime: time.Hour})
+	assert.ErrorAs(t, err, &apiv1.NotImplementedError{})
+}
+
+func TestACMECAS_RevokeCertificate(t *testing.T) {
+	srv := newTestACMEServer(t, "valid")
+	ca, err := New(context.Background(), apiv1.Options{
+		CertificateAuthority: srv.URL + "/directory",
+		Config:               []byte(`{"accountKey":"` + writeAccountKey(t) + `"}`),
+	})
+	require.NoError(t, err)
+
+	resp, err := ca.RevokeCertificate(&apiv1.RevokeCertificateRequest{
+		Certificate: srv.ca,
+		ReasonCode:  1,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, srv.ca, resp.Certificate)
+	assert.True(t, srv.revoked)
+
+	_, err = ca.RevokeCertificate(&apiv1.RevokeCertificateRequest{SerialNumber: "1234"})
+	assert.Error(t, err)
+}
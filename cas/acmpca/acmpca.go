@@ -0,0 +1,426 @@
+package acmpca
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	pca "github.com/aws/aws-sdk-go-v2/service/acmpca"
+	"github.com/aws/aws-sdk-go-v2/service/acmpca/types"
+
+	"github.com/smallstep/certificates/cas/apiv1"
+)
+
+func init() {
+	apiv1.Register(apiv1.ACMPCA, func(ctx context.Context, opts apiv1.Options) (apiv1.CertificateAuthorityService, error) {
+		return New(ctx, opts)
+	})
+}
+
+var now = time.Now
+
+// pollInterval is the time between GetCertificate requests while the
+// certificate is being issued.
+var pollInterval = time.Second
+
+// Options are the AWS Private CA options, they are set in the config property
+// of the CAS options.
+type Options struct {
+	// Region is the AWS region of the certificate authority, by default it is
+	// the region in the certificate authority ARN.
+	Region string `json:"region,omitempty"`
+	// Endpoint overwrites the default endpoint of the AWS Private CA API.
+	Endpoint string `json:"endpoint,omitempty"`
+	// TemplateARN is the ARN of the template used to issue certificates, by
+	// default the EndEntityCertificate/V1 template is used.
+	TemplateARN string `json:"templateArn,omitempty"`
+	// ProvisionerTemplateARNs maps provisioner names to the template used to
+	// issue certificates authorized by them.
+	ProvisionerTemplateARNs map[string]string `json:"provisionerTemplateArns,omitempty"`
+	// SigningAlgorithm is the algorithm used by the certificate authority,
+	// e.g. SHA256WITHECDSA or SHA256WITHRSA. By default it is derived from the
+	// key of the certificate authority.
+	SigningAlgorithm string `json:"signingAlgorithm,omitempty"`
+	// AccessKeyID, SecretAccessKey and SessionToken are static credentials.
+	// If not set, the credentials are loaded using the default chain of the
+	// AWS SDK: the environment, the shared configuration files, or the ECS
+	// task or EC2 instance role.
+	AccessKeyID     string `json:"accessKeyID,omitempty"`
+	SecretAccessKey string `json:"secretAccessKey,omitempty"`
+	SessionToken    string `json:"sessionToken,omitempty"`
+	// RoleARN, if set, is the IAM role assumed to access the certificate
+	// authority.
+	RoleARN         string `json:"roleArn,omitempty"`
+	RoleSessionName string `json:"roleSessionName,omitempty"`
+}
+
+// revocationReasonMap maps revocation reason codes from RFC 5280 to AWS
+// Private CA revocation reasons. Reasons 6 (certificateHold) and 8
+// (removeFromCRL) are not supported.
+var revocationReasonMap = map[int]types.RevocationReason{
+	0:  types.RevocationReasonUnspecified,
+	1:  types.RevocationReasonKeyCompromise,
+	2:  types.RevocationReasonCertificateAuthorityCompromise,
+	3:  types.RevocationReasonAffiliationChanged,
+	4:  types.RevocationReasonSuperseded,
+	5:  types.RevocationReasonCessationOfOperation,
+	9:  types.RevocationReasonPrivilegeWithdrawn,
+	10: types.RevocationReasonAACompromise,
+}
+
+// ACMPCA implements a CertificateAuthorityService using AWS Private CA.
+type ACMPCA struct {
+	client           Client
+	arn              string
+	partition        string
+	fingerprint      string
+	signingAlgorithm string
+	options          Options
+}
+
+// newClient creates the AWS Private CA client. This function is used for
+// testing purposes.
+var newClient = func(ctx context.Context, region string, o *Options) (Client, error) {
+	cfg, err := loadConfig(ctx, region, o)
+	if err != nil {
+		return nil, err
+	}
+	return pca.NewFromConfig(cfg, func(po *pca.Options) {
+		if o.Endpoint != "" {
+			po.BaseEndpoint = aws.String(o.Endpoint)
+		}
+	}), nil
+}
+
+// New creates a new CertificateAuthorityService implementation using AWS
+// Private CA. The certificate authority must be the ARN of the AWS Private CA,
+// e.g. arn:aws:acm-pca:us-east-1:123456789012:certificate-authority/<id>.
+func New(ctx context.Context, opts apiv1.Options) (*ACMPCA, error) {
+	// arn:partition:acm-pca:region:account:certificate-authority/id
+	parts := strings.SplitN(opts.CertificateAuthority, ":", 6)
+	if len(parts) != 6 || parts[0] != "arn" || parts[2] != "acm-pca" || !strings.HasPrefix(parts[5], "certificate-authority/") {
+		return nil, errors.New("acmpca 'certificateAuthority' is not a valid certificate authority ARN")
+	}
+
+	var o Options
+	if opts.Config != nil {
+		if err := json.Unmarshal(opts.Config, &o); err != nil {
+			return nil, fmt.Errorf("error decoding acmpca config: %w", err)
+		}
+	}
+	region := o.Region
+	if region == "" {
+		region = parts[3]
+	}
+
+	client, err := newClient(ctx, region, &o)
+	if err != nil {
+		return nil, err
+	}
+
+	ca := &ACMPCA{
+		client:           client,
+		arn:              opts.CertificateAuthority,
+		partition:        parts[1],
+		fingerprint:      opts.CertificateAuthorityFingerprint,
+		signingAlgorithm: o.SigningAlgorithm,
+		options:          o,
+	}
+
+	// Derive the signing algorithm from the key of the certificate authority.
+	if ca.signingAlgorithm == "" {
+		cert, _, err := ca.getCertificateAuthorityCertificate()
+		if err != nil {
+			return nil, err
+		}
+		if ca.signingAlgorithm, err = signingAlgorithm(cert); err != nil {
+			return nil, err
+		}
+	}
+
+	return ca, nil
+}
+
+// Type returns the type of this CertificateAuthorityService.
+func (c *ACMPCA) Type() apiv1.Type {
+	return apiv1.ACMPCA
+}
+
+// GetCertificateAuthority returns the root certificate and the intermediates
+// of the certificate authority. If a fingerprint is configured, the root
+// certificate must match it.
+func (c *ACMPCA) GetCertificateAuthority(*apiv1.GetCertificateAuthorityRequest) (*apiv1.GetCertificateAuthorityResponse, error) {
+	cert, chain, err := c.getCertificateAuthorityCertificate()
+	if err != nil {
+		return nil, err
+	}
+
+	// The chain is empty if the certificate authority is a root.
+	var root *x509.Certificate
+	var intermediates []*x509.Certificate
+	if len(chain) == 0 {
+		root = cert
+	} else {
+		root = chain[len(chain)-1]
+		intermediates = append([]*x509.Certificate{cert}, chain[:len(chain)-1]...)
+	}
+
+	if c.fingerprint != "" {
+		sum := sha256.Sum256(root.Raw)
+		if !strings.EqualFold(c.fingerprint, hex.EncodeToString(sum[:])) {
+			return nil, errors.New("error verifying acmpca root: fingerprint does not match")
+		}
+	}
+
+	return &apiv1.GetCertificateAuthorityResponse{
+		RootCertificate:          root,
+		IntermediateCertificates: intermediates,
+		Metadata:                 apiv1.NewCertificateAuthorityMetadata(cert),
+	}, nil
+}
+
+// CreateCertificate signs a new certificate using AWS Private CA.
+func (c *ACMPCA) CreateCertificate(req *apiv1.CreateCertificateRequest) (*apiv1.CreateCertificateResponse, error) {
+	switch {
+	case req.CSR == nil:
+		return nil, errors.New("createCertificateRequest `csr` cannot be nil")
+	case req.Lifetime == 0:
+		return nil, errors.New("createCertificateRequest `lifetime` cannot be 0")
+	}
+
+	cert, chain, err := c.issueCertificate(req.CSR, req.Lifetime, req.Backdate, c.templateARN(req.Provisioner), req.RequestID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &apiv1.CreateCertificateResponse{
+		Certificate:      cert,
+		CertificateChain: chain,
+	}, nil
+}
+
+// RenewCertificate signs the CSR in the request using AWS Private CA. AWS
+// Private CA only signs certificate requests, so renewals without a CSR will
+// return a non-implemented error.
+func (c *ACMPCA) RenewCertificate(req *apiv1.RenewCertificateRequest) (*apiv1.RenewCertificateResponse, error) {
+	switch {
+	case req.CSR == nil:
+		return nil, apiv1.NotImplementedError{Message: "acmpca does not support renewals without a certificate request"}
+	case req.Lifetime == 0:
+		return nil, errors.New("renewCertificateRequest `lifetime` cannot be 0")
+	}
+
+	cert, chain, err := c.issueCertificate(req.CSR, req.Lifetime, req.Backdate, c.templateARN(nil), req.RequestID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &apiv1.RenewCertificateResponse{
+		Certificate:      cert,
+		CertificateChain: chain,
+	}, nil
+}
+
+// RevokeCertificate revokes a certificate using AWS Private CA.
+func (c *ACMPCA) RevokeCertificate(req *apiv1.RevokeCertificateRequest) (*apiv1.RevokeCertificateResponse, error) {
+	reason, ok := revocationReasonMap[req.ReasonCode]
+	switch {
+	case !ok:
+		return nil, fmt.Errorf("revokeCertificateRequest 'reasonCode=%d' is invalid or not supported", req.ReasonCode)
+	case req.SerialNumber == "" && req.Certificate == nil:
+		return nil, errors.New("revokeCertificateRequest `serialNumber` or `certificate` are required")
+	}
+
+	var sn *big.Int
+	if req.Certificate != nil {
+		sn = req.Certificate.SerialNumber
+	} else {
+		if sn, ok = new(big.Int).SetString(req.SerialNumber, 10); !ok {
+			return nil, fmt.Errorf("error parsing serialNumber: %v cannot be converted to big.Int", req.SerialNumber)
+		}
+	}
+
+	ctx, cancel := defaultContext()
+	defer cancel()
+
+	if _, err := c.client.RevokeCertificate(ctx, &pca.RevokeCertificateInput{
+		CertificateAuthorityArn: aws.String(c.arn),
+		CertificateSerial:       aws.String(formatSerialNumber(sn)),
+		RevocationReason:        reason,
+	}); err != nil {
+		return nil, fmt.Errorf("acmpca RevokeCertificate failed: %w", err)
+	}
+
+	return &apiv1.RevokeCertificateResponse{
+		Certificate: req.Certificate,
+	}, nil
+}
+
+// templateARN returns the template used for the given provisioner.
+func (c *ACMPCA) templateARN(p *apiv1.ProvisionerInfo) string {
+	if p != nil {
+		if arn, ok := c.options.ProvisionerTemplateARNs[p.Name]; ok {
+			return arn
+		}
+	}
+	if c.options.TemplateARN != "" {
+		return c.options.TemplateARN
+	}
+	return "arn:" + c.partition + ":acm-pca:::template/EndEntityCertificate/V1"
+}
+
+func (c *ACMPCA) issueCertificate(cr *x509.CertificateRequest, lifetime, backdate time.Duration, templateARN, requestID string) (*x509.Certificate, []*x509.Certificate, error) {
+	t := now()
+	input := &pca.IssueCertificateInput{
+		CertificateAuthorityArn: aws.String(c.arn),
+		Csr: pem.EncodeToMemory(&pem.Block{
+			Type:  "CERTIFICATE REQUEST",
+			Bytes: cr.Raw,
+		}),
+		SigningAlgorithm: types.SigningAlgorithm(c.signingAlgorithm),
+		TemplateArn:      aws.String(templateARN),
+		Validity: &types.Validity{
+			Type:  types.ValidityPeriodTypeAbsolute,
+			Value: aws.Int64(t.Add(lifetime).Unix()),
+		},
+	}
+	if backdate > 0 {
+		input.ValidityNotBefore = &types.Validity{
+			Type:  types.ValidityPeriodTypeAbsolute,
+			Value: aws.Int64(t.Add(-backdate).Unix()),
+		}
+	}
+	// The idempotency token has a maximum length of 36 characters.
+	if len(requestID) > 36 {
+		requestID = requestID[:36]
+	}
+	if requestID != "" {
+		input.IdempotencyToken = aws.String(requestID)
+	}
+
+	ctx, cancel := defaultContext()
+	defer cancel()
+
+	out, err := c.client.IssueCertificate(ctx, input)
+	if err != nil {
+		return nil, nil, fmt.Errorf("acmpca IssueCertificate failed: %w", err)
+	}
+
+	// Certificates are issued asynchronously, wait until it is available.
+	for {
+		resp, err := c.client.GetCertificate(ctx, &pca.GetCertificateInput{
+			CertificateAuthorityArn: aws.String(c.arn),
+			CertificateArn:          out.CertificateArn,
+		})
+		if err == nil {
+			return parseCertificateAndChain(aws.ToString(resp.Certificate), aws.ToString(resp.CertificateChain))
+		}
+
+		var e *types.RequestInProgressException
+		if !errors.As(err, &e) {
+			return nil, nil, fmt.Errorf("acmpca GetCertificate failed: %w", err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil, nil, fmt.Errorf("acmpca GetCertificate failed: %w", ctx.Err())
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+func (c *ACMPCA) getCertificateAuthorityCertificate() (*x509.Certificate, []*x509.Certificate, error) {
+	ctx, cancel := defaultContext()
+	defer cancel()
+
+	resp, err := c.client.GetCertificateAuthorityCertificate(ctx, &pca.GetCertificateAuthorityCertificateInput{
+		CertificateAuthorityArn: aws.String(c.arn),
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("acmpca GetCertificateAuthorityCertificate failed: %w", err)
+	}
+	return parseCertificateAndChain(aws.ToString(resp.Certificate), aws.ToString(resp.CertificateChain))
+}
+
+func parseCertificateAndChain(certPEM, chainPEM string) (*x509.Certificate, []*x509.Certificate, error) {
+	certs, err := parseCertificates(certPEM)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(certs) != 1 {
+		return nil, nil, errors.New("error parsing certificate: response does not contain a certificate")
+	}
+	chain, err := parseCertificates(chainPEM)
+	if err != nil {
+		return nil, nil, err
+	}
+	return certs[0], chain, nil
+}
+
+func parseCertificates(s string) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	rest := []byte(s)
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			return certs, nil
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing certificate: %w", err)
+		}
+		certs = append(certs, cert)
+	}
+}
+
+// signingAlgorithm returns the AWS Private CA signing algorithm for the key of
+// the given certificate.
+func signingAlgorithm(cert *x509.Certificate) (string, error) {
+	switch pub := cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		return "SHA256WITHRSA", nil
+	case *ecdsa.PublicKey:
+		switch pub.Curve {
+		case elliptic.P256():
+			return "SHA256WITHECDSA", nil
+		case elliptic.P384():
+			return "SHA384WITHECDSA", nil
+		case elliptic.P521():
+			return "SHA512WITHECDSA", nil
+		}
+	}
+	return "", fmt.Errorf("unsupported certificate authority key type %T", cert.PublicKey)
+}
+
+// formatSerialNumber returns the serial number as colon separated hexadecimal
+// bytes, the format used by AWS Private CA.
+func formatSerialNumber(sn *big.Int) string {
+	b := sn.Bytes()
+	if len(b) == 0 {
+		b = []byte{0}
+	}
+	parts := make([]string, len(b))
+	for i, v := range b {
+		parts[i] = hex.EncodeToString([]byte{v})
+	}
+	return strings.Join(parts, ":")
+}
+
+func defaultContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), 60*time.Second)
+}
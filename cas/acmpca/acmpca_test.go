@@ -0,0 +1,401 @@
+package acmpca
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	pca "github.com/aws/aws-sdk-go-v2/service/acmpca"
+	"github.com/aws/aws-sdk-go-v2/service/acmpca/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/smallstep/certificates/cas/apiv1"
+)
+
+const testARN = "arn:aws:acm-pca:us-east-1:123456789012:certificate-authority/11111111-2222-3333-4444-555555555555"
+
+type testPKI struct {
+	root, intermediate *x509.Certificate
+	intermediateKey    crypto.Signer
+}
+
+func newTestPKI(t *testing.T) *testPKI {
+	t.Helper()
+	rootKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	root := mustCreateCertificate(t, &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Root CA"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, nil, rootKey.Public(), rootKey)
+
+	intKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	require.NoError(t, err)
+	intermediate := mustCreateCertificate(t, &x509.Certificate{
+		SerialNumber:          big.NewInt(2),
+		Subject:               pkix.Name{CommonName: "Intermediate CA"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, root, intKey.Public(), rootKey)
+
+	return &testPKI{root: root, intermediate: intermediate, intermediateKey: intKey}
+}
+
+func mustCreateCertificate(t *testing.T, template, parent *x509.Certificate, pub crypto.PublicKey, signer crypto.Signer) *x509.Certificate {
+	t.Helper()
+	if parent == nil {
+		parent = template
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, pub, signer)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return cert
+}
+
+func mustCSR(t *testing.T) *x509.CertificateRequest {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: "test.example.com"},
+		DNSNames: []string{"test.example.com"},
+	}, key)
+	require.NoError(t, err)
+	cr, err := x509.ParseCertificateRequest(der)
+	require.NoError(t, err)
+	return cr
+}
+
+func encodePEM(certs ...*x509.Certificate) string {
+	var s string
+	for _, c := range certs {
+		s += string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.Raw}))
+	}
+	return s
+}
+
+type mockClient struct {
+	issueCertificate                   func(*pca.IssueCertificateInput) (*pca.IssueCertificateOutput, error)
+	getCertificate                     func(*pca.GetCertificateInput) (*pca.GetCertificateOutput, error)
+	revokeCertificate                  func(*pca.RevokeCertificateInput) error
+	getCertificateAuthorityCertificate func(*pca.GetCertificateAuthorityCertificateInput) (*pca.GetCertificateAuthorityCertificateOutput, error)
+}
+
+func (m *mockClient) IssueCertificate(_ context.Context, input *pca.IssueCertificateInput, _ ...func(*pca.Options)) (*pca.IssueCertificateOutput, error) {
+	return m.issueCertificate(input)
+}
+
+func (m *mockClient) GetCertificate(_ context.Context, input *pca.GetCertificateInput, _ ...func(*pca.Options)) (*pca.GetCertificateOutput, error) {
+	return m.getCertificate(input)
+}
+
+func (m *mockClient) RevokeCertificate(_ context.Context, input *pca.RevokeCertificateInput, _ ...func(*pca.Options)) (*pca.RevokeCertificateOutput, error) {
+	if err := m.revokeCertificate(input); err != nil {
+		return nil, err
+	}
+	return &pca.RevokeCertificateOutput{}, nil
+}
+
+func (m *mockClient) GetCertificateAuthorityCertificate(_ context.Context, input *pca.GetCertificateAuthorityCertificateInput, _ ...func(*pca.Options)) (*pca.GetCertificateAuthorityCertificateOutput, error) {
+	return m.getCertificateAuthorityCertificate(input)
+}
+
+func TestNew(t *testing.T) {
+	pki := newTestPKI(t)
+	tmp := newClient
+	t.Cleanup(func() { newClient = tmp })
+
+	var region string
+	newClient = func(_ context.Context, r string, _ *Options) (Client, error) {
+		region = r
+		return &mockClient{
+			getCertificateAuthorityCertificate: func(input *pca.GetCertificateAuthorityCertificateInput) (*pca.GetCertificateAuthorityCertificateOutput, error) {
+				assert.Equal(t, testARN, aws.ToString(input.CertificateAuthorityArn))
+				return &pca.GetCertificateAuthorityCertificateOutput{
+					Certificate:      aws.String(encodePEM(pki.intermediate)),
+					CertificateChain: aws.String(encodePEM(pki.root)),
+				}, nil
+			},
+		}, nil
+	}
+
+	ca, err := New(context.Background(), apiv1.Options{
+		Type:                 "acmpca",
+		CertificateAuthority: testARN,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "us-east-1", region)
+	assert.Equal(t, "SHA384WITHECDSA", ca.signingAlgorithm)
+	assert.Equal(t, apiv1.ACMPCA, string(ca.Type()))
+
+	ca, err = New(context.Background(), apiv1.Options{
+		Type:                 "acmpca",
+		CertificateAuthority: testARN,
+		Config:               []byte(`{"region":"eu-west-1","signingAlgorithm":"SHA256WITHRSA","templateArn":"arn:aws:acm-pca:::template/EndEntityServerAuthCertificate/V1"}`),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "eu-west-1", region)
+	assert.Equal(t, "SHA256WITHRSA", ca.signingAlgorithm)
+	assert.Equal(t, "arn:aws:acm-pca:::template/EndEntityServerAuthCertificate/V1", ca.options.TemplateARN)
+
+	for _, arn := range []string{"", "arn:aws:kms:us-east-1:123456789012:key/id", "arn:aws:acm-pca:us-east-1:123456789012:certificate/id"} {
+		_, err := New(context.Background(), apiv1.Options{CertificateAuthority: arn})
+		assert.Error(t, err, arn)
+	}
+
+	_, err = New(context.Background(), apiv1.Options{CertificateAuthority: testARN, Config: []byte(`{`)})
+	assert.Error(t, err)
+}
+
+func TestACMPCA_CreateCertificate(t *testing.T) {
+	pki := newTestPKI(t)
+	tmp, tmpPoll := now, pollInterval
+	t.Cleanup(func() { now, pollInterval = tmp, tmpPoll })
+	fixedNow := time.Unix(1700000000, 0)
+	now = func() time.Time { return fixedNow }
+	pollInterval = time.Millisecond
+
+	leaf := mustCreateCertificate(t, &x509.Certificate{
+		SerialNumber: big.NewInt(1234),
+		Subject:      pkix.Name{CommonName: "test.example.com"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}, pki.intermediate, pki.intermediateKey.Public(), pki.intermediateKey)
+
+	var pending int
+	client := &mockClient{
+		issueCertificate: func(input *pca.IssueCertificateInput) (*pca.IssueCertificateOutput, error) {
+			assert.Equal(t, testARN, aws.ToString(input.CertificateAuthorityArn))
+			assert.Equal(t, types.SigningAlgorithmSha384withecdsa, input.SigningAlgorithm)
+			assert.Equal(t, &types.Validity{Type: types.ValidityPeriodTypeAbsolute, Value: aws.Int64(fixedNow.Add(time.Hour).Unix())}, input.Validity)
+			assert.Equal(t, &types.Validity{Type: types.ValidityPeriodTypeAbsolute, Value: aws.Int64(fixedNow.Add(-time.Minute).Unix())}, input.ValidityNotBefore)
+			block, _ := pem.Decode(input.Csr)
+			if assert.NotNil(t, block) {
+				assert.Equal(t, "CERTIFICATE REQUEST", block.Type)
+			}
+			switch aws.ToString(input.IdempotencyToken) {
+			case "fail":
+				return nil, &types.LimitExceededException{Message: aws.String("limit exceeded")}
+			case "provisioner":
+				assert.Equal(t, "arn:aws:acm-pca:::template/CodeSigningCertificate/V1", aws.ToString(input.TemplateArn))
+			default:
+				assert.Equal(t, "arn:aws:acm-pca:::template/EndEntityCertificate/V1", aws.ToString(input.TemplateArn))
+			}
+			return &pca.IssueCertificateOutput{CertificateArn: aws.String(testARN + "/certificate/1234")}, nil
+		},
+		getCertificate: func(input *pca.GetCertificateInput) (*pca.GetCertificateOutput, error) {
+			assert.Equal(t, testARN+"/certificate/1234", aws.ToString(input.CertificateArn))
+			// The first request is still in progress.
+			if pending++; pending == 1 {
+				return nil, &types.RequestInProgressException{Message: aws.String("in progress")}
+			}
+			return &pca.GetCertificateOutput{
+				Certificate:      aws.String(encodePEM(leaf)),
+				CertificateChain: aws.String(encodePEM(pki.intermediate, pki.root)),
+			}, nil
+		},
+	}
+
+	ca := &ACMPCA{
+		client:           client,
+		arn:              testARN,
+		partition:        "aws",
+		signingAlgorithm: "SHA384WITHECDSA",
+		options: Options{
+			ProvisionerTemplateARNs: map[string]string{
+				"codesign": "arn:aws:acm-pca:::template/CodeSigningCertificate/V1",
+			},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		req     *apiv1.CreateCertificateRequest
+		want    *apiv1.CreateCertificateResponse
+		wantErr bool
+	}{
+		{"ok", &apiv1.CreateCertificateRequest{
+			CSR: mustCSR(t), Lifetime: time.Hour, Backdate: time.Minute,
+		}, &apiv1.CreateCertificateResponse{
+			Certificate: leaf, CertificateChain: []*x509.Certificate{pki.intermediate, pki.root},
+		}, false},
+		{"ok provisioner template", &apiv1.CreateCertificateRequest{
+			CSR: mustCSR(t), Lifetime: time.Hour, Backdate: time.Minute, RequestID: "provisioner",
+			Provisioner: &apiv1.ProvisionerInfo{Name: "codesign"},
+		}, &apiv1.CreateCertificateResponse{
+			Certificate: leaf, CertificateChain: []*x509.Certificate{pki.intermediate, pki.root},
+		}, false},
+		{"fail csr", &apiv1.CreateCertificateRequest{Lifetime: time.Hour}, nil, true},
+		{"fail lifetime", &apiv1.CreateCertificateRequest{CSR: mustCSR(t)}, nil, true},
+		{"fail issue", &apiv1.CreateCertificateRequest{
+			CSR: mustCSR(t), Lifetime: time.Hour, Backdate: time.Minute, RequestID: "fail",
+		}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pending = 0
+			got, err := ca.CreateCertificate(tt.req)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestACMPCA_RenewCertificate(t *testing.T) {
+	pki := newTestPKI(t)
+	ca := &ACMPCA{
+		client: &mockClient{
+			issueCertificate: func(input *pca.IssueCertificateInput) (*pca.IssueCertificateOutput, error) {
+				assert.Nil(t, input.ValidityNotBefore)
+				assert.Nil(t, input.IdempotencyToken)
+				return &pca.IssueCertificateOutput{CertificateArn: aws.String("arn")}, nil
+			},
+			getCertificate: func(*pca.GetCertificateInput) (*pca.GetCertificateOutput, error) {
+				return &pca.GetCertificateOutput{
+					Certificate:      aws.String(encodePEM(pki.intermediate)),
+					CertificateChain: aws.String(encodePEM(pki.root)),
+				}, nil
+			},
+		},
+		arn:              testARN,
+		partition:        "aws",
+		signingAlgorithm: "SHA256WITHECDSA",
+	}
+
+	got, err := ca.RenewCertificate(&apiv1.RenewCertificateRequest{CSR: mustCSR(t), Lifetime: time.Hour})
+	require.NoError(t, err)
+	assert.Equal(t, &apiv1.RenewCertificateResponse{
+		Certificate: pki.intermediate, CertificateChain: []*x509.Certificate{pki.root},
+	}, got)
+
+	_, err = ca.RenewCertificate(&apiv1.RenewCertificateRequest{Template: pki.intermediate, Lifetime: time.Hour})
+	assert.ErrorAs(t, err, &apiv1.NotImplementedError{})
+
+	_, err = ca.RenewCertificate(&apiv1.RenewCertificateRequest{CSR: mustCSR(t)})
+	assert.Error(t, err)
+}
+
+func TestACMPCA_RevokeCertificate(t *testing.T) {
+	pki := newTestPKI(t)
+	var serial, reason string
+	ca := &ACMPCA{
+		client: &mockClient{
+			revokeCertificate: func(input *pca.RevokeCertificateInput) error {
+				assert.Equal(t, testARN, aws.ToString(input.CertificateAuthorityArn))
+				if aws.ToString(input.CertificateSerial) == "ff" {
+					return errors.New("an error")
+				}
+				serial, reason = aws.ToString(input.CertificateSerial), string(input.RevocationReason)
+				return nil
+			},
+		},
+		arn: testARN,
+	}
+
+	tests := []struct {
+		name       string
+		req        *apiv1.RevokeCertificateRequest
+		wantSerial string
+		wantReason string
+		wantErr    bool
+	}{
+		{"ok certificate", &apiv1.RevokeCertificateRequest{Certificate: pki.intermediate, ReasonCode: 1}, "02", "KEY_COMPROMISE", false},
+		{"ok serial", &apiv1.RevokeCertificateRequest{SerialNumber: "1000000", ReasonCode: 4}, "0f:42:40", "SUPERSEDED", false},
+		{"fail reason", &apiv1.RevokeCertificateRequest{SerialNumber: "1", ReasonCode: 6}, "", "", true},
+		{"fail empty", &apiv1.RevokeCertificateRequest{}, "", "", true},
+		{"fail serial", &apiv1.RevokeCertificateRequest{SerialNumber: "foo"}, "", "", true},
+		{"fail client", &apiv1.RevokeCertificateRequest{SerialNumber: "255"}, "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			serial, reason = "", ""
+			got, err := ca.RevokeCertificate(tt.req)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.req.Certificate, got.Certificate)
+			assert.Equal(t, tt.wantSerial, serial)
+			assert.Equal(t, tt.wantReason, reason)
+		})
+	}
+}
+
+func TestACMPCA_GetCertificateAuthority(t *testing.T) {
+	pki := newTestPKI(t)
+	sum := sha256.Sum256(pki.root.Raw)
+	fingerprint := hex.EncodeToString(sum[:])
+
+	subordinate := &mockClient{
+		getCertificateAuthorityCertificate: func(*pca.GetCertificateAuthorityCertificateInput) (*pca.GetCertificateAuthorityCertificateOutput, error) {
+			return &pca.GetCertificateAuthorityCertificateOutput{
+				Certificate:      aws.String(encodePEM(pki.intermediate)),
+				CertificateChain: aws.String(encodePEM(pki.root)),
+			}, nil
+		},
+	}
+	root := &mockClient{
+		getCertificateAuthorityCertificate: func(*pca.GetCertificateAuthorityCertificateInput) (*pca.GetCertificateAuthorityCertificateOutput, error) {
+			return &pca.GetCertificateAuthorityCertificateOutput{Certificate: aws.String(encodePEM(pki.root))}, nil
+		},
+	}
+
+	tests := []struct {
+		name    string
+		ca      *ACMPCA
+		want    *apiv1.GetCertificateAuthorityResponse
+		wantErr bool
+	}{
+		{"ok subordinate", &ACMPCA{client: subordinate, fingerprint: fingerprint}, &apiv1.GetCertificateAuthorityResponse{
+			RootCertificate: pki.root, IntermediateCertificates: []*x509.Certificate{pki.intermediate},
+			Metadata: apiv1.NewCertificateAuthorityMetadata(pki.intermediate),
+		}, false},
+		{"ok root", &ACMPCA{client: root}, &apiv1.GetCertificateAuthorityResponse{
+			RootCertificate: pki.root,
+			Metadata:        apiv1.NewCertificateAuthorityMetadata(pki.root),
+		}, false},
+		{"fail fingerprint", &ACMPCA{client: subordinate, fingerprint: "0123"}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.ca.GetCertificateAuthority(&apiv1.GetCertificateAuthorityRequest{})
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_formatSerialNumber(t *testing.T) {
+	assert.Equal(t, "00", formatSerialNumber(big.NewInt(0)))
+	assert.Equal(t, "01:00", formatSerialNumber(big.NewInt(256)))
+}
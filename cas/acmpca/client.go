@@ -0,0 +1,52 @@
+package acmpca
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	pca "github.com/aws/aws-sdk-go-v2/service/acmpca"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+// Client is the interface of the AWS Private CA client used by ACMPCA. It is
+// implemented by the client in github.com/aws/aws-sdk-go-v2/service/acmpca.
+type Client interface {
+	IssueCertificate(ctx context.Context, params *pca.IssueCertificateInput, optFns ...func(*pca.Options)) (*pca.IssueCertificateOutput, error)
+	GetCertificate(ctx context.Context, params *pca.GetCertificateInput, optFns ...func(*pca.Options)) (*pca.GetCertificateOutput, error)
+	RevokeCertificate(ctx context.Context, params *pca.RevokeCertificateInput, optFns ...func(*pca.Options)) (*pca.RevokeCertificateOutput, error)
+	GetCertificateAuthorityCertificate(ctx context.Context, params *pca.GetCertificateAuthorityCertificateInput, optFns ...func(*pca.Options)) (*pca.GetCertificateAuthorityCertificateOutput, error)
+}
+
+// loadConfig returns the AWS configuration for the given region and options.
+// Static credentials are used if configured, otherwise the default credential
+// chain of the AWS SDK is used. If a role is configured, it is assumed using
+// those credentials.
+func loadConfig(ctx context.Context, region string, o *Options) (aws.Config, error) {
+	opts := []func(*awsconfig.LoadOptions) error{
+		awsconfig.WithRegion(region),
+	}
+	if o.AccessKeyID != "" {
+		opts = append(opts, awsconfig.WithCredentialsProvider(
+			credentials.NewStaticCredentialsProvider(o.AccessKeyID, o.SecretAccessKey, o.SessionToken),
+		))
+	}
+	cfg, err := awsconfig.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return aws.Config{}, fmt.Errorf("error loading aws configuration: %w", err)
+	}
+
+	if o.RoleARN != "" {
+		provider := stscreds.NewAssumeRoleProvider(sts.NewFromConfig(cfg), o.RoleARN, func(ao *stscreds.AssumeRoleOptions) {
+			if o.RoleSessionName != "" {
+				ao.RoleSessionName = o.RoleSessionName
+			}
+		})
+		cfg.Credentials = aws.NewCredentialsCache(provider)
+	}
+
+	return cfg, nil
+}
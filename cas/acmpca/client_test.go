@@ -0,0 +1,88 @@
+package acmpca
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	pca "github.com/aws/aws-sdk-go-v2/service/acmpca"
+	"github.com/aws/aws-sdk-go-v2/service/acmpca/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_newClient(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "application/x-amz-json-1.1", r.Header.Get("Content-Type"))
+		assert.True(t, strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=key/"))
+		assert.Contains(t, r.Header.Get("Authorization"), "/us-east-1/acm-pca/aws4_request")
+		assert.Equal(t, "token", r.Header.Get("X-Amz-Security-Token"))
+
+		var body map[string]any
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		assert.Equal(t, testARN, body["CertificateAuthorityArn"])
+
+		w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+		switch r.Header.Get("X-Amz-Target") {
+		case "ACMPrivateCA.IssueCertificate":
+			assert.Equal(t, "SHA256WITHECDSA", body["SigningAlgorithm"])
+			w.Write([]byte(`{"CertificateArn":"arn:certificate"}`))
+		case "ACMPrivateCA.GetCertificate":
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"__type":"com.amazonaws.acmpca#RequestInProgressException","message":"in progress"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	c, err := newClient(ctx, "us-east-1", &Options{
+		Endpoint:        srv.URL,
+		AccessKeyID:     "key",
+		SecretAccessKey: "secret",
+		SessionToken:    "token",
+	})
+	require.NoError(t, err)
+
+	out, err := c.IssueCertificate(ctx, &pca.IssueCertificateInput{
+		CertificateAuthorityArn: aws.String(testARN),
+		Csr:                     []byte("csr"),
+		SigningAlgorithm:        types.SigningAlgorithmSha256withecdsa,
+		Validity:                &types.Validity{Type: types.ValidityPeriodTypeDays, Value: aws.Int64(1)},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "arn:certificate", aws.ToString(out.CertificateArn))
+
+	_, err = c.GetCertificate(ctx, &pca.GetCertificateInput{
+		CertificateAuthorityArn: aws.String(testARN),
+		CertificateArn:          aws.String("arn:certificate"),
+	})
+	var e *types.RequestInProgressException
+	require.ErrorAs(t, err, &e)
+	assert.Equal(t, "in progress", e.ErrorMessage())
+}
+
+func Test_loadConfig(t *testing.T) {
+	ctx := context.Background()
+	cfg, err := loadConfig(ctx, "eu-west-1", &Options{AccessKeyID: "key", SecretAccessKey: "secret"})
+	require.NoError(t, err)
+	assert.Equal(t, "eu-west-1", cfg.Region)
+	creds, err := cfg.Credentials.Retrieve(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "key", creds.AccessKeyID)
+	assert.Equal(t, "secret", creds.SecretAccessKey)
+
+	// The role is assumed with the configured credentials.
+	cfg, err = loadConfig(ctx, "eu-west-1", &Options{
+		AccessKeyID: "key", SecretAccessKey: "secret",
+		RoleARN: "arn:aws:iam::123456789012:role/step-ca", RoleSessionName: "step-ca",
+	})
+	require.NoError(t, err)
+	assert.IsType(t, &aws.CredentialsCache{}, cfg.Credentials)
+}
@@ -24,15 +24,56 @@ type Options struct {
 	// In StepCAS the value is the CA url, e.g., "https://ca.smallstep.com:9000".
 	// In CloudCAS the format is "projects/*/locations/*/certificateAuthorities/*".
 	// In VaultCAS the value is the url, e.g., "https://vault.smallstep.com".
+	// In ACMPCA the value is the ARN of the certificate authority, e.g.,
+	// "arn:aws:acm-pca:us-east-1:123456789012:certificate-authority/<id>".
+	// In ACMECAS the value is the ACME directory URL, e.g.,
+	// "https://acme.example.com/directory".
+	// In DigiCertCAS the value is the optional URL of the CertCentral API,
+	// e.g., "https://www.digicert.com/services/v2".
+	// In EntrustCAS the value is the URL of the CA in the CA Gateway, e.g.,
+	// "https://gateway.example.com/cagw/v1/certificate-authorities/<id>".
+	// In AzureKeyVaultCAS the value is the Key Vault certificate identifier,
+	// e.g., "https://my-vault.vault.azure.net/certificates/my-ca".
+	// In KMIPCAS the value is the address of the KMIP server, e.g.,
+	// "kmip.example.com:5696".
 	CertificateAuthority string `json:"certificateAuthority,omitempty"`
 
 	// CertificateAuthorityFingerprint is the root fingerprint used to
 	// authenticate the connection to the CA when using StepCAS.
 	CertificateAuthorityFingerprint string `json:"certificateAuthorityFingerprint,omitempty"`
 
+	// CertificateAuthorityFingerprints is a list of root fingerprints accepted
+	// in StepCAS in addition to CertificateAuthorityFingerprint. It allows the
+	// use of multiple roots, e.g., during a root rotation. The fingerprints can
+	// be SHA-256 or SHA-512 hex-encoded digests.
+	CertificateAuthorityFingerprints []string `json:"certificateAuthorityFingerprints,omitempty"`
+
 	// CertificateIssuer contains the configuration used in StepCAS.
 	CertificateIssuer *CertificateIssuer `json:"certificateIssuer,omitempty"`
 
+	// ClientCertificate is the certificate used to authenticate the TLS
+	// connection to the upstream CA in StepCAS. It is independent of the
+	// certificate issuer credentials used to sign the tokens.
+	ClientCertificate *ClientCertificate `json:"clientCertificate,omitempty"`
+
+	// Retry configures the retries of the requests to the upstream CA in
+	// StepCAS. If not set, the requests are not retried.
+	Retry *RetryOptions `json:"retry,omitempty"`
+
+	// Failover configures additional upstream CAs in StepCAS that are used if
+	// the connection to the CertificateAuthority fails. If not set, only the
+	// CertificateAuthority is used.
+	Failover *FailoverOptions `json:"failover,omitempty"`
+
+	// RateLimit limits the number of certificates issued by the CAS, globally
+	// and by provisioner. If not set, the number of certificates is not
+	// limited.
+	RateLimit *RateLimitOptions `json:"rateLimit,omitempty"`
+
+	// CircuitBreaker stops sending requests to the CAS after a number of
+	// consecutive failures. If not set, requests are always sent.
+	CircuitBreaker *CircuitBreakerOptions `json:"circuitBreaker,omitempty"`
+
 	// Path to the credentials file used in CloudCAS. If not defined the default
 	// authentication mechanism provided by Google SDK will be used. See
 	// https://cloud.google.com/docs/authentication.
@@ -53,6 +94,12 @@ type Options struct {
 	// certificates in SoftCAS.
 	CertificateSigner func() ([]*x509.Certificate, crypto.Signer, error) `json:"-"`
 
+	// SignatureAlgorithm is the signature algorithm used in SoftCAS to sign
+	// certificates and CRLs with an RSA issuer key, e.g., "SHA256-RSAPSS" to
+	// use RSASSA-PSS signatures. By default, the algorithm used to sign the
+	// issuer certificate is used.
+	SignatureAlgorithm string `json:"signatureAlgorithm,omitempty"`
+
 	// IsCreator is set to true when we're creating a certificate authority. It
 	// is used to skip some validations when initializing a
 	// CertificateAuthority. This option is used on SoftCAS and CloudCAS.
@@ -91,6 +138,81 @@ type CertificateIssuer struct {
 	Password    string `json:"password,omitempty"`
 }
 
+// ClientCertificate contains the properties of the certificate used in the TLS
+// connection with an upstream certificate authority. The key can be the path
+// to a PEM file or a KMS URI.
+type ClientCertificate struct {
+	Certificate string `json:"crt"`
+	Key         string `json:"key"`
+	Password    string `json:"password,omitempty"`
+}
+
+// RetryOptions contains the properties used to retry the requests to an
+// upstream certificate authority. Only network errors and server errors are
+// retried, using an exponential backoff with jitter. The durations use the
+// time.ParseDuration format, e.g., "500ms".
+type RetryOptions struct {
+	// MaxAttempts is the maximum number of attempts, including the first one.
+	// It defaults to 3.
+	MaxAttempts int `json:"maxAttempts,omitempty"`
+	// InitialBackoff is the maximum wait time before the first retry. It
+	// doubles after each retry until MaxBackoff. It defaults to 500ms.
+	InitialBackoff string `json:"initialBackoff,omitempty"`
+	// MaxBackoff is the maximum wait time between retries. It defaults to 10s.
+	MaxBackoff string `json:"maxBackoff,omitempty"`
+	// Timeout is the timeout of each attempt. If not set, the default timeout
+	// of the client is used.
+	Timeout string `json:"timeout,omitempty"`
+}
+
+// FailoverOptions contains the additional upstream CAs used in StepCAS. All the
+// CAs must share the same root certificates, and requests are sent to the next
+// CA only on connection errors.
+type FailoverOptions struct {
+	// CertificateAuthorities is the list of additional upstream CA URLs, e.g.,
+	// "https://ca-2.smallstep.com:9000".
+	CertificateAuthorities []string `json:"certificateAuthorities"`
+	// Policy is the strategy used to select the upstream CA. With
+	// "active-passive" the CAs are always tried in order, starting with the
+	// CertificateAuthority, and with "round-robin" each request starts with
+	// the next CA. It defaults to "active-passive".
+	Policy string `json:"policy,omitempty"`
+}
+
+// RateLimit defines the number of certificates that can be issued in a period
+// of time. The period uses the time.ParseDuration format, e.g., "1h".
+type RateLimit struct {
+	// Requests is the number of certificates allowed in a period.
+	Requests int `json:"requests"`
+	// Period is the length of the period. It defaults to 1s.
+	Period string `json:"period,omitempty"`
+	// Burst is the maximum number of certificates that can be issued at once.
+	// It defaults to Requests.
+	Burst int `json:"burst,omitempty"`
+}
+
+// RateLimitOptions contains the limits applied to the certificates issued by a
+// CAS. The global limit is applied to all certificates, and the limits in
+// Provisioners are applied in addition to the global one to the certificates
+// authorized by the provisioner with that name.
+type RateLimitOptions struct {
+	RateLimit
+	Provisioners map[string]RateLimit `json:"provisioners,omitempty"`
+}
+
+// CircuitBreakerOptions contains the properties used to stop sending requests
+// to a CAS that is failing. After FailureThreshold consecutive server errors,
+// requests are rejected during OpenTimeout, and then a single request is sent
+// to check if the CAS has recovered.
+type CircuitBreakerOptions struct {
+	// FailureThreshold is the number of consecutive failures that stops the
+	// requests. It defaults to 5.
+	FailureThreshold int `json:"failureThreshold,omitempty"`
+	// OpenTimeout is the time requests are rejected. It uses the
+	// time.ParseDuration format and it defaults to 30s.
+	OpenTimeout string `json:"openTimeout,omitempty"`
+}
+
 // Validate checks the fields in Options.
 func (o *Options) Validate() error {
 	var typ Type
@@ -59,8 +59,29 @@ type CreateCertificateRequest struct {
 	RequestID      string
 	Provisioner    *ProvisionerInfo
 	IsCAServerCert bool
+	Metadata       map[string]string
 }
 
+// Keys used in the metadata of a CreateCertificateRequest. Backends can use
+// these values to annotate the certificates they issue upstream and to
+// correlate the records of the CA with the ones of the authority.
+const (
+	// MetadataProvisionerID is the id of the provisioner used.
+	MetadataProvisionerID = "provisioner-id"
+	// MetadataProvisionerName is the name of the provisioner used.
+	MetadataProvisionerName = "provisioner-name"
+	// MetadataProvisionerType is the type of the provisioner used.
+	MetadataProvisionerType = "provisioner-type"
+	// MetadataRequester is the identity that requested the certificate, the
+	// subject of a token or an ACME account id.
+	MetadataRequester = "requester"
+	// MetadataACMEOrderID is the id of the ACME order being finalized.
+	MetadataACMEOrderID = "acme-order-id"
+	// MetadataTemplate is the name of the template used to render the
+	// certificate.
+	MetadataTemplate = "template"
+)
+
 // ProvisionerInfo contains information of the provisioner used to authorize a
 // certificate.
 type ProvisionerInfo struct {
@@ -75,6 +96,19 @@ type CreateCertificateResponse struct {
 	CertificateChain []*x509.Certificate
 }
 
+// GetPendingCertificateRequest is the request used to get a certificate that
+// was pending when it was requested.
+type GetPendingCertificateRequest struct {
+	ID string
+}
+
+// GetPendingCertificateResponse is the response to a get pending certificate
+// request.
+type GetPendingCertificateResponse struct {
+	Certificate      *x509.Certificate
+	CertificateChain []*x509.Certificate
+}
+
 // RenewCertificateRequest is the request used to re-sign a certificate.
 type RenewCertificateRequest struct {
 	Template  *x509.Certificate
@@ -113,11 +147,37 @@ type GetCertificateAuthorityRequest struct {
 	Name string
 }
 
-// GetCertificateAuthorityResponse is the response that contains
-// the root certificate.
+// GetCertificateAuthorityResponse is the response that contains the root
+// certificate, the intermediate certificates, and optional metadata of the
+// certificate authority.
 type GetCertificateAuthorityResponse struct {
 	RootCertificate          *x509.Certificate
 	IntermediateCertificates []*x509.Certificate
+	Metadata                 *CertificateAuthorityMetadata
+}
+
+// CertificateAuthorityMetadata contains information about the certificate
+// authority used by a CAS to sign certificates. It can be used to know when
+// the issuing certificate needs to be rotated.
+type CertificateAuthorityMetadata struct {
+	// NotBefore and NotAfter are the validity of the issuing certificate.
+	NotBefore time.Time
+	NotAfter  time.Time
+	// State is the state of the certificate authority in the CAS, e.g.,
+	// "ENABLED". It is empty if the CAS does not provide it.
+	State string
+}
+
+// NewCertificateAuthorityMetadata returns the metadata with the validity of the
+// given issuing certificate.
+func NewCertificateAuthorityMetadata(cert *x509.Certificate) *CertificateAuthorityMetadata {
+	if cert == nil {
+		return nil
+	}
+	return &CertificateAuthorityMetadata{
+		NotBefore: cert.NotBefore,
+		NotAfter:  cert.NotAfter,
+	}
 }
 
 // CreateKeyRequest is the request used to generate a new key using a KMS.
@@ -142,6 +202,29 @@ type CreateCertificateAuthorityRequest struct {
 	// CertificateAuthority. If CreateKey is nil, a default algorithm will be
 	// used.
 	CreateKey *CreateKeyRequest
+
+	// RotateKey is the name of an existing key in the KMS, e.g., the key of
+	// the CertificateAuthority that is being replaced. If set, the key of the
+	// new CertificateAuthority is created rotating it, with the same
+	// algorithm, and CreateKey is ignored. It is only supported by SoftCAS.
+	RotateKey string
+
+	// RotateKeyPassword is the password used to decrypt the key in RotateKey
+	// and to encrypt the new key, if the KMS stores the keys in files.
+	RotateKeyPassword []byte
+
+	// KeyAlgorithm is an experimental option used to create the key of the
+	// new CertificateAuthority with an algorithm not supported by the KMS,
+	// e.g., "ML-DSA-65". If set, CreateKey is ignored. It is only supported by
+	// SoftCAS built with the mldsa tag.
+	KeyAlgorithm string
+
+	// CrossSign is an existing intermediate certificate that will be signed
+	// by Parent. If set, no new key is created and the new certificate uses
+	// the public key of CrossSign. If Template is nil, the subject, extensions
+	// and validity period of CrossSign will be used. CrossSign can only be
+	// used with the IntermediateCA type, and it is only supported by SoftCAS.
+	CrossSign *x509.Certificate
 }
 
 // CreateCertificateAuthorityResponse is the response for
@@ -1,10 +1,13 @@
 package apiv1
 
 import (
+	"context"
 	"crypto"
 	"crypto/x509"
+	"fmt"
 	"net/http"
 	"strings"
+	"time"
 )
 
 // CertificateAuthorityService is the interface implemented to support external
@@ -41,6 +44,22 @@ type CertificateAuthoritySigner interface {
 	GetSigner() (crypto.Signer, error)
 }
 
+// CertificateAuthorityPendingGetter is an optional interface implemented by a
+// CertificateAuthorityService that issues certificates asynchronously. The
+// CreateCertificate method of these services can return a
+// PendingCertificateError, and the certificate can be retrieved later using
+// the id in the error.
+type CertificateAuthorityPendingGetter interface {
+	GetPendingCertificate(req *GetPendingCertificateRequest) (*GetPendingCertificateResponse, error)
+}
+
+// HealthChecker is an optional interface implemented by a
+// CertificateAuthorityService that can check if its backend, e.g., an upstream
+// CA or a KMS, is reachable and able to issue certificates.
+type HealthChecker interface {
+	CheckHealth(ctx context.Context) error
+}
+
 // SignatureAlgorithmGetter is an optional implementation in a crypto.Signer
 // that returns the SignatureAlgorithm to use.
 type SignatureAlgorithmGetter interface {
@@ -63,6 +82,23 @@ const (
 	VaultCAS = "vaultcas"
 	// ExternalCAS is a CertificateAuthorityService using an external injected CA implementation
 	ExternalCAS = "externalcas"
+	// GRPCCAS is a CertificateAuthorityService using an out-of-process plugin
+	// over gRPC.
+	GRPCCAS = "grpccas"
+	// ACMPCA is a CertificateAuthorityService using AWS Private CA.
+	ACMPCA = "acmpca"
+	// ACMECAS is a CertificateAuthorityService using an upstream ACME server.
+	ACMECAS = "acmecas"
+	// DigiCertCAS is a CertificateAuthorityService using DigiCert CertCentral.
+	DigiCertCAS = "digicert"
+	// EntrustCAS is a CertificateAuthorityService using the Entrust CA Gateway.
+	EntrustCAS = "entrust"
+	// AzureKeyVaultCAS is a CertificateAuthorityService using a certificate
+	// and key stored in Azure Key Vault.
+	AzureKeyVaultCAS = "azurekvcas"
+	// KMIPCAS is a CertificateAuthorityService using a key stored in a KMIP
+	// server.
+	KMIPCAS = "kmipcas"
 )
 
 // String returns a string from the type. It will always return the lower case
@@ -121,3 +157,45 @@ func (e ValidationError) Error() string {
 func (e ValidationError) StatusCode() int {
 	return http.StatusBadRequest
 }
+
+// TooManyRequestsError is the type of error returned if a request is rejected
+// because a rate limit has been exceeded, or because the service is not
+// available. RetryAfter is the suggested time to wait before trying again.
+type TooManyRequestsError struct {
+	Message    string
+	RetryAfter time.Duration
+}
+
+// Error implements the error interface.
+func (e TooManyRequestsError) Error() string {
+	if e.Message != "" {
+		return e.Message
+	}
+	return "too many requests"
+}
+
+// StatusCode implements the StatusCoder interface and returns the HTTP 429
+// error.
+func (e TooManyRequestsError) StatusCode() int {
+	return http.StatusTooManyRequests
+}
+
+// PendingCertificateError is the type of error returned if a certificate has
+// been requested but it has not been issued yet. The ID identifies the request
+// and can be used to get the certificate once it is issued, RetryAfter is the
+// suggested time to wait before trying again.
+type PendingCertificateError struct {
+	ID         string
+	RetryAfter time.Duration
+}
+
+// Error implements the error interface.
+func (e PendingCertificateError) Error() string {
+	return fmt.Sprintf("certificate %s is pending", e.ID)
+}
+
+// StatusCode implements the StatusCoder interface and returns the HTTP 202
+// status code.
+func (e PendingCertificateError) StatusCode() int {
+	return http.StatusAccepted
+}
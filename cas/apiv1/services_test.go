@@ -2,6 +2,7 @@ package apiv1
 
 import (
 	"testing"
+	"time"
 )
 
 type simpleCAS struct{}
@@ -159,3 +160,42 @@ func TestValidationError_StatusCode(t *testing.T) {
 		})
 	}
 }
+
+func TestPendingCertificateError_Error(t *testing.T) {
+	e := PendingCertificateError{ID: "1234", RetryAfter: time.Minute}
+	if got := e.Error(); got != "certificate 1234 is pending" {
+		t.Errorf("PendingCertificateError.Error() = %v, want %v", got, "certificate 1234 is pending")
+	}
+}
+
+func TestPendingCertificateError_StatusCode(t *testing.T) {
+	e := PendingCertificateError{ID: "1234", RetryAfter: time.Minute}
+	if got := e.StatusCode(); got != 202 {
+		t.Errorf("PendingCertificateError.StatusCode() = %v, want %v", got, 202)
+	}
+}
+
+func TestTooManyRequestsError_Error(t *testing.T) {
+	tests := []struct {
+		name string
+		err  TooManyRequestsError
+		want string
+	}{
+		{"default", TooManyRequestsError{}, "too many requests"},
+		{"with message", TooManyRequestsError{Message: "rate limit exceeded", RetryAfter: time.Second}, "rate limit exceeded"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.err.Error(); got != tt.want {
+				t.Errorf("TooManyRequestsError.Error() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTooManyRequestsError_StatusCode(t *testing.T) {
+	e := TooManyRequestsError{RetryAfter: time.Second}
+	if got := e.StatusCode(); got != 429 {
+		t.Errorf("TooManyRequestsError.StatusCode() = %v, want %v", got, 429)
+	}
+}
@@ -0,0 +1,514 @@
+package azurekvcas
+
+import (
+	"context"
+	"crypto"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"go.step.sm/crypto/keyutil"
+	"go.step.sm/crypto/kms"
+	kmsapi "go.step.sm/crypto/kms/apiv1"
+	"go.step.sm/crypto/kms/uri"
+	"go.step.sm/crypto/pemutil"
+	"go.step.sm/crypto/x509util"
+
+	"github.com/smallstep/certificates/cas/apiv1"
+	"github.com/smallstep/certificates/cas/softcas"
+)
+
+func init() {
+	apiv1.Register(apiv1.AzureKeyVaultCAS, func(ctx context.Context, opts apiv1.Options) (apiv1.CertificateAuthorityService, error) {
+		return New(ctx, opts)
+	})
+}
+
+var now = time.Now
+
+// newKeyManager creates the Azure Key Vault KMS used to sign with the key of
+// the certificate. This function is used for testing purposes.
+var newKeyManager = kms.New
+
+// nameRegexp matches the valid Key Vault certificate names.
+var nameRegexp = regexp.MustCompile("^[0-9a-zA-Z-]{1,127}$")
+
+// vaultEnvironments maps the DNS suffix of a key vault to the Azure cloud
+// environment used by azurekms.
+var vaultEnvironments = map[string]string{
+	"vault.azure.net":         "public",
+	"vault.usgovcloudapi.net": "usgov",
+	"vault.azure.cn":          "china",
+	"vault.microsoftazure.de": "german",
+}
+
+// Options are the Azure Key Vault options, they are set in the config
+// property of the CAS options.
+type Options struct {
+	// TenantID, ClientID and ClientSecret are the client credentials used to
+	// access Key Vault. If they are not set, the default Azure credentials are
+	// used, e.g., environment variables, workload identity, or managed
+	// identity.
+	TenantID     string `json:"tenantID,omitempty"`
+	ClientID     string `json:"clientID,omitempty"`
+	ClientSecret string `json:"clientSecret,omitempty"`
+	// Intermediates is the path to a PEM bundle with the certificates that
+	// chain the Key Vault certificate to the root. The root certificate, if
+	// present, is only used in GetCertificateAuthority.
+	Intermediates string `json:"intermediates,omitempty"`
+}
+
+// AzureKeyVaultCAS implements a CertificateAuthorityService using a
+// certificate and key stored in Azure Key Vault. Key Vault cannot sign
+// certificate requests, so certificates are signed like in SoftCAS, but the
+// signature is done by the non-exportable Key Vault key. New certificate
+// authorities are created using the Key Vault certificate issuance, the key is
+// generated by Key Vault, and the certificate is signed and merged into it.
+type AzureKeyVaultCAS struct {
+	client        *client
+	keyManager    kms.KeyManager
+	vault         string
+	name          string
+	version       string
+	intermediates []*x509.Certificate
+	root          *x509.Certificate
+	certificate   *x509.Certificate
+	softCAS       *softcas.SoftCAS
+}
+
+// New creates a new CertificateAuthorityService implementation using Azure
+// Key Vault. The certificate authority is the identifier of the certificate in
+// Key Vault, e.g.,
+// "https://my-vault.vault.azure.net/certificates/my-ca[/version]". When
+// initializing a new PKI, the certificate name can be omitted, and the name of
+// the certificate authority is used instead.
+func New(ctx context.Context, opts apiv1.Options) (*AzureKeyVaultCAS, error) {
+	if opts.CertificateAuthority == "" {
+		return nil, errors.New("azureKeyVaultCAS 'certificateAuthority' cannot be empty")
+	}
+	u, err := url.Parse(opts.CertificateAuthority)
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		return nil, errors.New("azureKeyVaultCAS 'certificateAuthority' is not a valid key vault url")
+	}
+
+	var name, version string
+	switch parts := strings.Split(strings.Trim(u.Path, "/"), "/"); {
+	case len(parts) == 2 && parts[0] == "certificates":
+		name = parts[1]
+	case len(parts) == 3 && parts[0] == "certificates":
+		name, version = parts[1], parts[2]
+	case len(parts) == 1 && parts[0] == "" && opts.IsCreator:
+	default:
+		return nil, errors.New("azureKeyVaultCAS 'certificateAuthority' is not a valid key vault certificate identifier")
+	}
+	if name != "" && !nameRegexp.MatchString(name) {
+		return nil, errors.New("azureKeyVaultCAS 'certificateAuthority' is not a valid key vault certificate identifier")
+	}
+
+	var o Options
+	if opts.Config != nil {
+		if err := json.Unmarshal(opts.Config, &o); err != nil {
+			return nil, fmt.Errorf("error decoding azureKeyVaultCAS config: %w", err)
+		}
+	}
+
+	var intermediates []*x509.Certificate
+	if o.Intermediates != "" {
+		if intermediates, err = pemutil.ReadCertificateBundle(o.Intermediates); err != nil {
+			return nil, fmt.Errorf("error reading azureKeyVaultCAS intermediates: %w", err)
+		}
+	}
+
+	// The host of a vault is <vault-name>.<dns-suffix>
+	hostname := u.Hostname()
+	vault, suffix, _ := strings.Cut(hostname, ".")
+	token, err := newTokenFunc(&o, suffix)
+	if err != nil {
+		return nil, err
+	}
+
+	values := url.Values{"vault": []string{vault}}
+	if env, ok := vaultEnvironments[suffix]; ok {
+		values.Set("environment", env)
+	}
+	if o.TenantID != "" && o.ClientID != "" && o.ClientSecret != "" {
+		values.Set("tenant-id", o.TenantID)
+		values.Set("client-id", o.ClientID)
+		values.Set("client-secret", o.ClientSecret)
+	}
+	km, err := newKeyManager(ctx, kmsapi.Options{
+		Type: kmsapi.AzureKMS,
+		URI:  uri.New("azurekms", values).String(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error creating azureKeyVaultCAS key manager: %w", err)
+	}
+
+	c := &AzureKeyVaultCAS{
+		client:     newClient(u.Scheme+"://"+u.Host, token),
+		keyManager: km,
+		vault:      vault,
+		name:       name,
+		version:    version,
+	}
+	for _, crt := range intermediates {
+		if isRoot(crt) {
+			c.root = crt
+		} else {
+			c.intermediates = append(c.intermediates, crt)
+		}
+	}
+
+	// The certificate does not exist yet if we are going to create it.
+	if name != "" && !opts.IsCreator {
+		if err := c.loadCertificate(); err != nil {
+			return nil, err
+		}
+	}
+
+	return c, nil
+}
+
+// Type returns the type of this CertificateAuthorityService.
+func (c *AzureKeyVaultCAS) Type() apiv1.Type {
+	return apiv1.AzureKeyVaultCAS
+}
+
+// GetSigner implements [apiv1.CertificateAuthoritySigner] and returns a
+// [crypto.Signer] with the Key Vault key.
+func (c *AzureKeyVaultCAS) GetSigner() (crypto.Signer, error) {
+	if c.softCAS == nil {
+		return nil, errors.New("azureKeyVaultCAS certificate is not loaded")
+	}
+	return c.softCAS.GetSigner()
+}
+
+// CreateCertificate signs a new certificate using the Key Vault key.
+func (c *AzureKeyVaultCAS) CreateCertificate(req *apiv1.CreateCertificateRequest) (*apiv1.CreateCertificateResponse, error) {
+	if c.softCAS == nil {
+		return nil, errors.New("azureKeyVaultCAS certificate is not loaded")
+	}
+	return c.softCAS.CreateCertificate(req)
+}
+
+// RenewCertificate renews the given certificate using the Key Vault key.
+func (c *AzureKeyVaultCAS) RenewCertificate(req *apiv1.RenewCertificateRequest) (*apiv1.RenewCertificateResponse, error) {
+	if c.softCAS == nil {
+		return nil, errors.New("azureKeyVaultCAS certificate is not loaded")
+	}
+	return c.softCAS.RenewCertificate(req)
+}
+
+// RevokeCertificate revokes the given certificate in step-ca. Like in
+// SoftCAS, this operation is a no-op as the actual revoke will happen when we
+// store the entry in the db.
+func (c *AzureKeyVaultCAS) RevokeCertificate(req *apiv1.RevokeCertificateRequest) (*apiv1.RevokeCertificateResponse, error) {
+	if c.softCAS == nil {
+		return nil, errors.New("azureKeyVaultCAS certificate is not loaded")
+	}
+	return c.softCAS.RevokeCertificate(req)
+}
+
+// GetCertificateAuthority returns the root certificate configured in the
+// intermediates bundle, and the Key Vault certificate and the rest of the
+// intermediates as the intermediate certificates.
+func (c *AzureKeyVaultCAS) GetCertificateAuthority(*apiv1.GetCertificateAuthorityRequest) (*apiv1.GetCertificateAuthorityResponse, error) {
+	if c.root == nil {
+		return nil, errors.New("azureKeyVaultCAS 'intermediates' does not contain a root certificate")
+	}
+
+	var intermediates []*x509.Certificate
+	if c.certificate != nil && !isRoot(c.certificate) {
+		intermediates = append(intermediates, c.certificate)
+	}
+	intermediates = append(intermediates, c.intermediates...)
+
+	return &apiv1.GetCertificateAuthorityResponse{
+		RootCertificate:          c.root,
+		IntermediateCertificates: intermediates,
+		Metadata:                 apiv1.NewCertificateAuthorityMetadata(c.certificate),
+	}, nil
+}
+
+// CheckHealth gets the certificate from Key Vault and signs a random message
+// with its key.
+func (c *AzureKeyVaultCAS) CheckHealth(ctx context.Context) error {
+	if c.softCAS == nil {
+		return errors.New("azureKeyVaultCAS certificate is not loaded")
+	}
+	if _, err := c.client.GetCertificate(ctx, c.name, c.version); err != nil {
+		return fmt.Errorf("azureKeyVaultCAS GetCertificate failed: %w", err)
+	}
+	return c.softCAS.CheckHealth(ctx)
+}
+
+// CreateCertificateAuthority creates a new root or intermediate certificate
+// in Key Vault. Key Vault generates a new non-exportable key and a
+// certificate request. The certificate request is signed by the new key for a
+// root, or by the parent for an intermediate, and the resulting certificate is
+// merged into Key Vault.
+func (c *AzureKeyVaultCAS) CreateCertificateAuthority(req *apiv1.CreateCertificateAuthorityRequest) (*apiv1.CreateCertificateAuthorityResponse, error) {
+	switch {
+	case req.Template == nil:
+		return nil, errors.New("createCertificateAuthorityRequest `template` cannot be nil")
+	case req.Lifetime == 0:
+		return nil, errors.New("createCertificateAuthorityRequest `lifetime` cannot be 0")
+	case req.Type != apiv1.RootCA && req.Type != apiv1.IntermediateCA:
+		return nil, fmt.Errorf("createCertificateAuthorityRequest `type=%d' is invalid or not supported", req.Type)
+	case req.Type == apiv1.IntermediateCA && req.Parent == nil:
+		return nil, errors.New("createCertificateAuthorityRequest `parent` cannot be nil")
+	case req.Type == apiv1.IntermediateCA && req.Parent.Certificate == nil:
+		return nil, errors.New("createCertificateAuthorityRequest `parent.certificate` cannot be nil")
+	case req.Type == apiv1.IntermediateCA && req.Parent.Signer == nil:
+		return nil, errors.New("createCertificateAuthorityRequest `parent.signer` cannot be nil")
+	}
+
+	name := c.name
+	if name == "" {
+		name = req.Name
+	}
+	if !nameRegexp.MatchString(name) {
+		return nil, fmt.Errorf("createCertificateAuthorityRequest `name=%s' is not a valid key vault certificate name", name)
+	}
+
+	keyProps, err := createKeyProperties(req.CreateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	t := now()
+	if req.Template.NotBefore.IsZero() {
+		req.Template.NotBefore = t.Add(-1 * req.Backdate)
+	}
+	if req.Template.NotAfter.IsZero() {
+		req.Template.NotAfter = t.Add(req.Lifetime)
+	}
+
+	ctx, cancel := defaultContext()
+	defer cancel()
+
+	// Key Vault generates the key and returns a certificate request, the
+	// issuer "Unknown" means that the certificate will be signed outside Key
+	// Vault.
+	op, err := c.client.CreateCertificate(ctx, name, &createCertificateRequest{
+		Policy: certificatePolicy{
+			KeyProps: keyProps,
+			SecretProps: secretProperties{
+				ContentType: "application/x-pem-file",
+			},
+			X509Props: x509Properties{
+				Subject: req.Template.Subject.String(),
+			},
+			Issuer: issuerParameters{
+				Name: "Unknown",
+			},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("azureKeyVaultCAS CreateCertificate failed: %w", err)
+	}
+	csr, err := parseCertificateRequest(op.Csr)
+	if err != nil {
+		return nil, err
+	}
+
+	var cert *x509.Certificate
+	switch req.Type {
+	case apiv1.RootCA:
+		// The pending key is the latest version of the key.
+		signer, err := c.keyManager.CreateSigner(&kmsapi.CreateSignerRequest{
+			SigningKey: c.keyName(name, ""),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("azureKeyVaultCAS CreateSigner failed: %w", err)
+		}
+		if !keyutil.Equal(signer.Public(), csr.PublicKey) {
+			return nil, errors.New("azureKeyVaultCAS key does not match the certificate request")
+		}
+		cert, err = x509util.CreateCertificate(req.Template, req.Template, csr.PublicKey, signer)
+		if err != nil {
+			return nil, err
+		}
+	case apiv1.IntermediateCA:
+		cert, err = x509util.CreateCertificate(req.Template, req.Parent.Certificate, csr.PublicKey, req.Parent.Signer)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Add the parent
+	var chain []*x509.Certificate
+	if req.Parent != nil {
+		chain = append(chain, req.Parent.Certificate)
+		chain = append(chain, req.Parent.CertificateChain...)
+	}
+
+	x5c := []string{base64.StdEncoding.EncodeToString(cert.Raw)}
+	for _, crt := range chain {
+		x5c = append(x5c, base64.StdEncoding.EncodeToString(crt.Raw))
+	}
+	bundle, err := c.client.MergeCertificate(ctx, name, &mergeCertificateRequest{
+		X5C: x5c,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("azureKeyVaultCAS MergeCertificate failed: %w", err)
+	}
+
+	keyName, err := c.keyNameFromKid(bundle.Kid)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := c.keyManager.CreateSigner(&kmsapi.CreateSignerRequest{
+		SigningKey: keyName,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("azureKeyVaultCAS CreateSigner failed: %w", err)
+	}
+
+	return &apiv1.CreateCertificateAuthorityResponse{
+		Name:             bundle.ID,
+		Certificate:      cert,
+		CertificateChain: chain,
+		KeyName:          keyName,
+		PublicKey:        signer.Public(),
+		Signer:           signer,
+	}, nil
+}
+
+// loadCertificate gets the certificate from Key Vault and initializes the
+// signer with its key.
+func (c *AzureKeyVaultCAS) loadCertificate() error {
+	ctx, cancel := defaultContext()
+	defer cancel()
+
+	bundle, err := c.client.GetCertificate(ctx, c.name, c.version)
+	if err != nil {
+		return fmt.Errorf("azureKeyVaultCAS GetCertificate failed: %w", err)
+	}
+	der, err := base64.StdEncoding.DecodeString(bundle.Cer)
+	if err != nil {
+		return fmt.Errorf("error decoding azureKeyVaultCAS certificate: %w", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return fmt.Errorf("error parsing azureKeyVaultCAS certificate: %w", err)
+	}
+
+	keyName, err := c.keyNameFromKid(bundle.Kid)
+	if err != nil {
+		return err
+	}
+	signer, err := c.keyManager.CreateSigner(&kmsapi.CreateSignerRequest{
+		SigningKey: keyName,
+	})
+	if err != nil {
+		return fmt.Errorf("azureKeyVaultCAS CreateSigner failed: %w", err)
+	}
+	if !keyutil.Equal(signer.Public(), cert.PublicKey) {
+		return errors.New("azureKeyVaultCAS key does not match the certificate")
+	}
+
+	c.softCAS, err = softcas.New(ctx, apiv1.Options{
+		CertificateChain: append([]*x509.Certificate{cert}, c.intermediates...),
+		Signer:           signer,
+	})
+	if err != nil {
+		return err
+	}
+	c.certificate = cert
+	return nil
+}
+
+// keyName returns the azurekms uri of the given key.
+func (c *AzureKeyVaultCAS) keyName(name, version string) string {
+	values := url.Values{
+		"vault": []string{c.vault},
+		"name":  []string{name},
+	}
+	if version != "" {
+		values.Set("version", version)
+	}
+	return uri.New("azurekms", values).String()
+}
+
+// keyNameFromKid returns the azurekms uri of a key identifier, e.g.,
+// "https://my-vault.vault.azure.net/keys/my-ca/<version>".
+func (c *AzureKeyVaultCAS) keyNameFromKid(kid string) (string, error) {
+	u, err := url.Parse(kid)
+	if err != nil {
+		return "", fmt.Errorf("error parsing key vault key id %q: %w", kid, err)
+	}
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	switch {
+	case len(parts) == 2 && parts[0] == "keys":
+		return c.keyName(parts[1], ""), nil
+	case len(parts) == 3 && parts[0] == "keys":
+		return c.keyName(parts[1], parts[2]), nil
+	default:
+		return "", fmt.Errorf("key vault key id %q is not valid", kid)
+	}
+}
+
+// createKeyProperties returns the Key Vault key properties for the given key
+// request. If the request is nil, it will create an EC P-256 key.
+func createKeyProperties(req *apiv1.CreateKeyRequest) (keyProperties, error) {
+	var props keyProperties
+	var alg kmsapi.SignatureAlgorithm
+	if req != nil {
+		alg = req.SignatureAlgorithm
+	}
+	switch alg {
+	case kmsapi.UnspecifiedSignAlgorithm, kmsapi.ECDSAWithSHA256:
+		props = keyProperties{KeyType: "EC", Curve: "P-256"}
+	case kmsapi.ECDSAWithSHA384:
+		props = keyProperties{KeyType: "EC", Curve: "P-384"}
+	case kmsapi.ECDSAWithSHA512:
+		props = keyProperties{KeyType: "EC", Curve: "P-521"}
+	case kmsapi.SHA256WithRSA, kmsapi.SHA384WithRSA, kmsapi.SHA512WithRSA,
+		kmsapi.SHA256WithRSAPSS, kmsapi.SHA384WithRSAPSS, kmsapi.SHA512WithRSAPSS:
+		props = keyProperties{KeyType: "RSA", KeySize: 3072}
+		if req.Bits != 0 {
+			props.KeySize = req.Bits
+		}
+	default:
+		return keyProperties{}, fmt.Errorf("createCertificateAuthorityRequest `createKey.signatureAlgorithm=%s` is not supported", alg)
+	}
+	if req != nil && req.ProtectionLevel == kmsapi.HSM {
+		props.KeyType += "-HSM"
+	}
+	return props, nil
+}
+
+// parseCertificateRequest parses a base64 encoded DER certificate request.
+func parseCertificateRequest(s string) (*x509.CertificateRequest, error) {
+	der, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding key vault certificate request: %w", err)
+	}
+	csr, err := x509.ParseCertificateRequest(der)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing key vault certificate request: %w", err)
+	}
+	if err := csr.CheckSignature(); err != nil {
+		return nil, fmt.Errorf("error verifying key vault certificate request: %w", err)
+	}
+	return csr, nil
+}
+
+// isRoot returns true if the given certificate is a root certificate.
+func isRoot(cert *x509.Certificate) bool {
+	if cert.BasicConstraintsValid && cert.IsCA {
+		return cert.CheckSignatureFrom(cert) == nil
+	}
+	return false
+}
+
+func defaultContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), 60*time.Second)
+}
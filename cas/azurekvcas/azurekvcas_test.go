@@ -0,0 +1,611 @@
+package azurekvcas
+
+import (
+	"context"
+	"crypto"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.step.sm/crypto/keyutil"
+	"go.step.sm/crypto/kms"
+	kmsapi "go.step.sm/crypto/kms/apiv1"
+	"go.step.sm/crypto/kms/uri"
+	"go.step.sm/crypto/minica"
+	"go.step.sm/crypto/x509util"
+
+	"github.com/smallstep/certificates/cas/apiv1"
+)
+
+const testToken = "token"
+
+// testVault is a fake Key Vault with the certificates and keys API, and the
+// key manager used to sign with its keys.
+type testVault struct {
+	url   string
+	mu    sync.Mutex
+	keys  map[string][]crypto.Signer
+	certs map[string]*x509.Certificate
+	last  *createCertificateRequest
+}
+
+func newTestVault(t *testing.T) *testVault {
+	t.Helper()
+	v := &testVault{
+		keys:  make(map[string][]crypto.Signer),
+		certs: make(map[string]*x509.Certificate),
+	}
+	srv := httptest.NewTLSServer(v)
+	t.Cleanup(srv.Close)
+	v.url = srv.URL
+
+	// Use the test server client and fake credentials and key manager.
+	tmpTransport, tmpToken, tmpKeyManager := http.DefaultTransport, newTokenFunc, newKeyManager
+	t.Cleanup(func() {
+		http.DefaultTransport, newTokenFunc, newKeyManager = tmpTransport, tmpToken, tmpKeyManager
+	})
+	http.DefaultTransport = srv.Client().Transport
+	newTokenFunc = func(*Options, string) (tokenFunc, error) {
+		return func(context.Context) (string, error) {
+			return testToken, nil
+		}, nil
+	}
+	newKeyManager = func(_ context.Context, opts kmsapi.Options) (kms.KeyManager, error) {
+		if opts.Type != kmsapi.AzureKMS {
+			return nil, errors.New("unexpected kms type")
+		}
+		return v, nil
+	}
+	return v
+}
+
+// mustCertificate adds a certificate and its key to the vault.
+func (v *testVault) mustCertificate(t *testing.T, name string, ca *minica.CA) *x509.Certificate {
+	t.Helper()
+	signer, err := keyutil.GenerateDefaultSigner()
+	require.NoError(t, err)
+	cert, err := ca.Sign(&x509.Certificate{
+		Subject:               pkix.Name{CommonName: "Test Intermediate CA"},
+		PublicKey:             signer.Public(),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		MaxPathLen:            0,
+		MaxPathLenZero:        true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+	})
+	require.NoError(t, err)
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.keys[name] = append(v.keys[name], signer)
+	v.certs[name] = cert
+	return cert
+}
+
+func (v *testVault) version(name string) string {
+	return "v" + strconv.Itoa(len(v.keys[name]))
+}
+
+func (v *testVault) bundle(name string) certificateBundle {
+	return certificateBundle{
+		ID:  v.url + "/certificates/" + name + "/" + v.version(name),
+		Kid: v.url + "/keys/" + name + "/" + v.version(name),
+		Cer: base64.StdEncoding.EncodeToString(v.certs[name].Raw),
+	}
+}
+
+func (v *testVault) writeJSON(w http.ResponseWriter, code int, val any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(val)
+}
+
+func (v *testVault) writeError(w http.ResponseWriter, code int, msg string) {
+	v.writeJSON(w, code, map[string]any{
+		"error": map[string]string{"code": "BadParameter", "message": msg},
+	})
+}
+
+func (v *testVault) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer "+testToken {
+		v.writeError(w, http.StatusUnauthorized, "invalid token")
+		return
+	}
+	if r.URL.Query().Get("api-version") != apiVersion {
+		v.writeError(w, http.StatusBadRequest, "invalid api-version")
+		return
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch {
+	case r.Method == http.MethodGet && parts[0] == "certificates" && (len(parts) == 2 || len(parts) == 3):
+		name := parts[1]
+		if _, ok := v.certs[name]; !ok || (len(parts) == 3 && parts[2] != v.version(name)) {
+			v.writeError(w, http.StatusNotFound, "certificate not found")
+			return
+		}
+		v.writeJSON(w, http.StatusOK, v.bundle(name))
+	case r.Method == http.MethodPost && len(parts) == 3 && parts[0] == "certificates" && parts[2] == "create":
+		name := parts[1]
+		req := new(createCertificateRequest)
+		if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+			v.writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		v.last = req
+		if req.Policy.KeyProps.KeyType != "EC" {
+			v.writeError(w, http.StatusBadRequest, "unsupported key type")
+			return
+		}
+		signer, err := keyutil.GenerateDefaultSigner()
+		if err != nil {
+			v.writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		csr, err := x509util.CreateCertificateRequest(name, nil, signer)
+		if err != nil {
+			v.writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		v.keys[name] = append(v.keys[name], signer)
+		v.writeJSON(w, http.StatusAccepted, certificateOperation{
+			ID:     v.url + "/certificates/" + name + "/pending",
+			Csr:    base64.StdEncoding.EncodeToString(csr.Raw),
+			Status: "inProgress",
+		})
+	case r.Method == http.MethodPost && len(parts) == 4 && parts[0] == "certificates" && parts[2] == "pending" && parts[3] == "merge":
+		name := parts[1]
+		req := new(mergeCertificateRequest)
+		if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+			v.writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		keys := v.keys[name]
+		if len(keys) == 0 || len(req.X5C) == 0 {
+			v.writeError(w, http.StatusBadRequest, "pending certificate not found")
+			return
+		}
+		der, err := base64.StdEncoding.DecodeString(req.X5C[0])
+		if err != nil {
+			v.writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			v.writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if !keyutil.Equal(cert.PublicKey, keys[len(keys)-1].Public()) {
+			v.writeError(w, http.StatusBadRequest, "public key does not match")
+			return
+		}
+		v.certs[name] = cert
+		v.writeJSON(w, http.StatusCreated, v.bundle(name))
+	default:
+		v.writeError(w, http.StatusNotFound, "not found")
+	}
+}
+
+func (v *testVault) GetPublicKey(req *kmsapi.GetPublicKeyRequest) (crypto.PublicKey, error) {
+	signer, err := v.CreateSigner(&kmsapi.CreateSignerRequest{SigningKey: req.Name})
+	if err != nil {
+		return nil, err
+	}
+	return signer.Public(), nil
+}
+
+func (v *testVault) CreateKey(*kmsapi.CreateKeyRequest) (*kmsapi.CreateKeyResponse, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (v *testVault) CreateSigner(req *kmsapi.CreateSignerRequest) (crypto.Signer, error) {
+	u, err := uri.ParseWithScheme("azurekms", req.SigningKey)
+	if err != nil {
+		return nil, err
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	keys := v.keys[u.Get("name")]
+	if len(keys) == 0 {
+		return nil, errors.New("key not found")
+	}
+	if version := u.Get("version"); version != "" {
+		n, err := strconv.Atoi(strings.TrimPrefix(version, "v"))
+		if err != nil || n < 1 || n > len(keys) {
+			return nil, errors.New("key version not found")
+		}
+		return keys[n-1], nil
+	}
+	return keys[len(keys)-1], nil
+}
+
+func (v *testVault) Close() error {
+	return nil
+}
+
+func mustIntermediates(t *testing.T, certs ...*x509.Certificate) string {
+	t.Helper()
+	var b []byte
+	for _, crt := range certs {
+		b = append(b, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: crt.Raw})...)
+	}
+	fn := filepath.Join(t.TempDir(), "intermediates.crt")
+	require.NoError(t, os.WriteFile(fn, b, 0600))
+	return fn
+}
+
+func mustCA(t *testing.T) *minica.CA {
+	t.Helper()
+	ca, err := minica.New()
+	require.NoError(t, err)
+	return ca
+}
+
+func TestNew(t *testing.T) {
+	v := newTestVault(t)
+	ca := mustCA(t)
+	cert := v.mustCertificate(t, "my-ca", ca)
+	intermediates := mustIntermediates(t, ca.Intermediate, ca.Root)
+
+	type args struct {
+		opts apiv1.Options
+	}
+	tests := []struct {
+		name        string
+		args        args
+		wantName    string
+		wantVersion string
+		wantChain   []*x509.Certificate
+		wantRoot    *x509.Certificate
+		wantErr     bool
+	}{
+		{"ok", args{apiv1.Options{
+			CertificateAuthority: v.url + "/certificates/my-ca",
+		}}, "my-ca", "", []*x509.Certificate{cert}, nil, false},
+		{"ok version", args{apiv1.Options{
+			CertificateAuthority: v.url + "/certificates/my-ca/v1",
+		}}, "my-ca", "v1", []*x509.Certificate{cert}, nil, false},
+		{"ok intermediates", args{apiv1.Options{
+			CertificateAuthority: v.url + "/certificates/my-ca",
+			Config:               json.RawMessage(`{"intermediates":"` + intermediates + `"}`),
+		}}, "my-ca", "", []*x509.Certificate{cert, ca.Intermediate}, ca.Root, false},
+		{"ok creator", args{apiv1.Options{
+			IsCreator:            true,
+			CertificateAuthority: v.url,
+		}}, "", "", nil, nil, false},
+		{"ok creator name", args{apiv1.Options{
+			IsCreator:            true,
+			CertificateAuthority: v.url + "/certificates/new-ca",
+		}}, "new-ca", "", nil, nil, false},
+		{"fail empty", args{apiv1.Options{}}, "", "", nil, nil, true},
+		{"fail scheme", args{apiv1.Options{
+			CertificateAuthority: strings.Replace(v.url, "https", "http", 1) + "/certificates/my-ca",
+		}}, "", "", nil, nil, true},
+		{"fail no name", args{apiv1.Options{
+			CertificateAuthority: v.url,
+		}}, "", "", nil, nil, true},
+		{"fail path", args{apiv1.Options{
+			CertificateAuthority: v.url + "/keys/my-ca",
+		}}, "", "", nil, nil, true},
+		{"fail name", args{apiv1.Options{
+			CertificateAuthority: v.url + "/certificates/my_ca",
+		}}, "", "", nil, nil, true},
+		{"fail config", args{apiv1.Options{
+			CertificateAuthority: v.url + "/certificates/my-ca",
+			Config:               json.RawMessage(`{`),
+		}}, "", "", nil, nil, true},
+		{"fail intermediates", args{apiv1.Options{
+			CertificateAuthority: v.url + "/certificates/my-ca",
+			Config:               json.RawMessage(`{"intermediates":"missing.crt"}`),
+		}}, "", "", nil, nil, true},
+		{"fail not found", args{apiv1.Options{
+			CertificateAuthority: v.url + "/certificates/missing",
+		}}, "", "", nil, nil, true},
+		{"fail version", args{apiv1.Options{
+			CertificateAuthority: v.url + "/certificates/my-ca/v2",
+		}}, "", "", nil, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := New(context.Background(), tt.args.opts)
+			if tt.wantErr {
+				assert.Error(t, err)
+				assert.Nil(t, got)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantName, got.name)
+			assert.Equal(t, tt.wantVersion, got.version)
+			assert.Equal(t, tt.wantRoot, got.root)
+			if tt.wantChain == nil {
+				assert.Nil(t, got.softCAS)
+			} else {
+				require.NotNil(t, got.softCAS)
+				assert.Equal(t, tt.wantChain, got.softCAS.CertificateChain)
+			}
+		})
+	}
+}
+
+func TestNew_keyManager(t *testing.T) {
+	v := newTestVault(t)
+	v.mustCertificate(t, "my-ca", mustCA(t))
+
+	var got kmsapi.Options
+	newKeyManager = func(_ context.Context, opts kmsapi.Options) (kms.KeyManager, error) {
+		got = opts
+		return v, nil
+	}
+	_, err := New(context.Background(), apiv1.Options{
+		CertificateAuthority: v.url + "/certificates/my-ca",
+		Config:               json.RawMessage(`{"tenantID":"tenant","clientID":"client","clientSecret":"secret"}`),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, kmsapi.AzureKMS, got.Type)
+	u, err := uri.ParseWithScheme("azurekms", got.URI)
+	require.NoError(t, err)
+	assert.Equal(t, "127", u.Get("vault"))
+	assert.Equal(t, "tenant", u.Get("tenant-id"))
+	assert.Equal(t, "client", u.Get("client-id"))
+	assert.Equal(t, "secret", u.Get("client-secret"))
+
+	newKeyManager = func(context.Context, kmsapi.Options) (kms.KeyManager, error) {
+		return nil, errors.New("kms error")
+	}
+	_, err = New(context.Background(), apiv1.Options{
+		CertificateAuthority: v.url + "/certificates/my-ca",
+	})
+	assert.ErrorContains(t, err, "kms error")
+}
+
+func Test_init(t *testing.T) {
+	v := newTestVault(t)
+	v.mustCertificate(t, "my-ca", mustCA(t))
+	fn, ok := apiv1.LoadCertificateAuthorityServiceNewFunc(apiv1.AzureKeyVaultCAS)
+	require.True(t, ok)
+	cas, err := fn(context.Background(), apiv1.Options{
+		CertificateAuthority: v.url + "/certificates/my-ca",
+	})
+	require.NoError(t, err)
+	assert.IsType(t, &AzureKeyVaultCAS{}, cas)
+}
+
+func TestAzureKeyVaultCAS_CreateCertificate(t *testing.T) {
+	v := newTestVault(t)
+	ca := mustCA(t)
+	issuer := v.mustCertificate(t, "my-ca", ca)
+	c, err := New(context.Background(), apiv1.Options{
+		CertificateAuthority: v.url + "/certificates/my-ca",
+		Config:               json.RawMessage(`{"intermediates":"` + mustIntermediates(t, ca.Intermediate) + `"}`),
+	})
+	require.NoError(t, err)
+
+	signer, err := keyutil.GenerateDefaultSigner()
+	require.NoError(t, err)
+	resp, err := c.CreateCertificate(&apiv1.CreateCertificateRequest{
+		Template: &x509.Certificate{
+			Subject:   pkix.Name{CommonName: "test.example.com"},
+			DNSNames:  []string{"test.example.com"},
+			PublicKey: signer.Public(),
+		},
+		Lifetime: time.Hour,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, signer.Public(), resp.Certificate.PublicKey)
+	assert.Equal(t, []*x509.Certificate{issuer, ca.Intermediate}, resp.CertificateChain)
+	require.NoError(t, resp.Certificate.CheckSignatureFrom(issuer))
+
+	renew, err := c.RenewCertificate(&apiv1.RenewCertificateRequest{
+		Template: &x509.Certificate{
+			Subject:   pkix.Name{CommonName: "test.example.com"},
+			PublicKey: signer.Public(),
+		},
+		Lifetime: time.Hour,
+	})
+	require.NoError(t, err)
+	require.NoError(t, renew.Certificate.CheckSignatureFrom(issuer))
+
+	revoke, err := c.RevokeCertificate(&apiv1.RevokeCertificateRequest{
+		Certificate: resp.Certificate,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, resp.Certificate, revoke.Certificate)
+
+	s, err := c.GetSigner()
+	require.NoError(t, err)
+	assert.Equal(t, issuer.PublicKey, s.Public())
+	assert.NoError(t, c.CheckHealth(context.Background()))
+
+	// Without a certificate
+	c, err = New(context.Background(), apiv1.Options{
+		IsCreator:            true,
+		CertificateAuthority: v.url + "/certificates/my-ca",
+	})
+	require.NoError(t, err)
+	_, err = c.CreateCertificate(&apiv1.CreateCertificateRequest{})
+	assert.Error(t, err)
+	_, err = c.RenewCertificate(&apiv1.RenewCertificateRequest{})
+	assert.Error(t, err)
+	_, err = c.RevokeCertificate(&apiv1.RevokeCertificateRequest{})
+	assert.Error(t, err)
+	_, err = c.GetSigner()
+	assert.Error(t, err)
+	assert.Error(t, c.CheckHealth(context.Background()))
+}
+
+func TestAzureKeyVaultCAS_GetCertificateAuthority(t *testing.T) {
+	v := newTestVault(t)
+	ca := mustCA(t)
+	cert := v.mustCertificate(t, "my-ca", ca)
+
+	c, err := New(context.Background(), apiv1.Options{
+		CertificateAuthority: v.url + "/certificates/my-ca",
+		Config:               json.RawMessage(`{"intermediates":"` + mustIntermediates(t, ca.Intermediate, ca.Root) + `"}`),
+	})
+	require.NoError(t, err)
+	resp, err := c.GetCertificateAuthority(&apiv1.GetCertificateAuthorityRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, &apiv1.GetCertificateAuthorityResponse{
+		RootCertificate:          ca.Root,
+		IntermediateCertificates: []*x509.Certificate{cert, ca.Intermediate},
+		Metadata:                 apiv1.NewCertificateAuthorityMetadata(cert),
+	}, resp)
+
+	c, err = New(context.Background(), apiv1.Options{
+		CertificateAuthority: v.url + "/certificates/my-ca",
+	})
+	require.NoError(t, err)
+	_, err = c.GetCertificateAuthority(&apiv1.GetCertificateAuthorityRequest{})
+	assert.Error(t, err)
+}
+
+func TestAzureKeyVaultCAS_CreateCertificateAuthority(t *testing.T) {
+	v := newTestVault(t)
+	c, err := New(context.Background(), apiv1.Options{
+		IsCreator:            true,
+		CertificateAuthority: v.url,
+	})
+	require.NoError(t, err)
+
+	root, err := c.CreateCertificateAuthority(&apiv1.CreateCertificateAuthorityRequest{
+		Name: "root-ca",
+		Type: apiv1.RootCA,
+		Template: &x509.Certificate{
+			Subject:               pkix.Name{CommonName: "Test Root CA"},
+			IsCA:                  true,
+			BasicConstraintsValid: true,
+			KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		},
+		Lifetime: 24 * time.Hour,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, v.url+"/certificates/root-ca/v1", root.Name)
+	assert.Equal(t, "azurekms:name=root-ca;vault=127;version=v1", root.KeyName)
+	assert.Nil(t, root.CertificateChain)
+	assert.Equal(t, root.Certificate.PublicKey, root.PublicKey)
+	require.NoError(t, root.Certificate.CheckSignatureFrom(root.Certificate))
+	assert.Equal(t, createCertificateRequest{
+		Policy: certificatePolicy{
+			KeyProps:    keyProperties{KeyType: "EC", Curve: "P-256"},
+			SecretProps: secretProperties{ContentType: "application/x-pem-file"},
+			X509Props:   x509Properties{Subject: "CN=Test Root CA"},
+			Issuer:      issuerParameters{Name: "Unknown"},
+		},
+	}, *v.last)
+
+	intermediate, err := c.CreateCertificateAuthority(&apiv1.CreateCertificateAuthorityRequest{
+		Name: "intermediate-ca",
+		Type: apiv1.IntermediateCA,
+		Template: &x509.Certificate{
+			Subject:               pkix.Name{CommonName: "Test Intermediate CA"},
+			IsCA:                  true,
+			BasicConstraintsValid: true,
+			MaxPathLenZero:        true,
+			KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		},
+		Lifetime: time.Hour,
+		Parent:   root,
+		CreateKey: &apiv1.CreateKeyRequest{
+			SignatureAlgorithm: kmsapi.ECDSAWithSHA256,
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []*x509.Certificate{root.Certificate}, intermediate.CertificateChain)
+	require.NoError(t, intermediate.Certificate.CheckSignatureFrom(root.Certificate))
+	assert.Equal(t, intermediate.Certificate.PublicKey, intermediate.Signer.Public())
+
+	// The new intermediate can be used to sign certificates.
+	cas, err := New(context.Background(), apiv1.Options{
+		CertificateAuthority: v.url + "/certificates/intermediate-ca",
+	})
+	require.NoError(t, err)
+	s, err := cas.GetSigner()
+	require.NoError(t, err)
+	assert.Equal(t, intermediate.Signer.Public(), s.Public())
+
+	tests := []struct {
+		name string
+		req  *apiv1.CreateCertificateAuthorityRequest
+	}{
+		{"fail template", &apiv1.CreateCertificateAuthorityRequest{Name: "ca", Type: apiv1.RootCA, Lifetime: time.Hour}},
+		{"fail lifetime", &apiv1.CreateCertificateAuthorityRequest{Name: "ca", Type: apiv1.RootCA, Template: &x509.Certificate{}}},
+		{"fail type", &apiv1.CreateCertificateAuthorityRequest{Name: "ca", Template: &x509.Certificate{}, Lifetime: time.Hour}},
+		{"fail parent", &apiv1.CreateCertificateAuthorityRequest{Name: "ca", Type: apiv1.IntermediateCA, Template: &x509.Certificate{}, Lifetime: time.Hour}},
+		{"fail parent certificate", &apiv1.CreateCertificateAuthorityRequest{Name: "ca", Type: apiv1.IntermediateCA, Template: &x509.Certificate{}, Lifetime: time.Hour,
+			Parent: &apiv1.CreateCertificateAuthorityResponse{Signer: root.Signer}}},
+		{"fail parent signer", &apiv1.CreateCertificateAuthorityRequest{Name: "ca", Type: apiv1.IntermediateCA, Template: &x509.Certificate{}, Lifetime: time.Hour,
+			Parent: &apiv1.CreateCertificateAuthorityResponse{Certificate: root.Certificate}}},
+		{"fail name", &apiv1.CreateCertificateAuthorityRequest{Name: "my ca", Type: apiv1.RootCA, Template: &x509.Certificate{}, Lifetime: time.Hour}},
+		{"fail signature algorithm", &apiv1.CreateCertificateAuthorityRequest{Name: "ca", Type: apiv1.RootCA, Template: &x509.Certificate{}, Lifetime: time.Hour,
+			CreateKey: &apiv1.CreateKeyRequest{SignatureAlgorithm: kmsapi.PureEd25519}}},
+		{"fail create", &apiv1.CreateCertificateAuthorityRequest{Name: "ca", Type: apiv1.RootCA, Template: &x509.Certificate{}, Lifetime: time.Hour,
+			CreateKey: &apiv1.CreateKeyRequest{SignatureAlgorithm: kmsapi.SHA256WithRSA}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := c.CreateCertificateAuthority(tt.req)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func Test_createKeyProperties(t *testing.T) {
+	tests := []struct {
+		name    string
+		req     *apiv1.CreateKeyRequest
+		want    keyProperties
+		wantErr bool
+	}{
+		{"default", nil, keyProperties{KeyType: "EC", Curve: "P-256"}, false},
+		{"P-384", &apiv1.CreateKeyRequest{SignatureAlgorithm: kmsapi.ECDSAWithSHA384}, keyProperties{KeyType: "EC", Curve: "P-384"}, false},
+		{"P-521 HSM", &apiv1.CreateKeyRequest{SignatureAlgorithm: kmsapi.ECDSAWithSHA512, ProtectionLevel: kmsapi.HSM}, keyProperties{KeyType: "EC-HSM", Curve: "P-521"}, false},
+		{"RSA", &apiv1.CreateKeyRequest{SignatureAlgorithm: kmsapi.SHA256WithRSA}, keyProperties{KeyType: "RSA", KeySize: 3072}, false},
+		{"RSA-PSS 4096", &apiv1.CreateKeyRequest{SignatureAlgorithm: kmsapi.SHA384WithRSAPSS, Bits: 4096}, keyProperties{KeyType: "RSA", KeySize: 4096}, false},
+		{"fail Ed25519", &apiv1.CreateKeyRequest{SignatureAlgorithm: kmsapi.PureEd25519}, keyProperties{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := createKeyProperties(tt.req)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_client_errors(t *testing.T) {
+	v := newTestVault(t)
+	c := newClient(v.url, func(context.Context) (string, error) {
+		return "bad-token", nil
+	})
+	_, err := c.GetCertificate(context.Background(), "my-ca", "")
+	var apiErr *apiError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusUnauthorized, apiErr.StatusCode)
+	assert.EqualError(t, err, "key vault request failed with status code 401: BadParameter: invalid token")
+
+	c.token = func(context.Context) (string, error) {
+		return "", errors.New("token error")
+	}
+	_, err = c.GetCertificate(context.Background(), "my-ca", "")
+	assert.ErrorContains(t, err, "token error")
+}
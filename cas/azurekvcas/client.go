@@ -0,0 +1,180 @@
+package azurekvcas
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// apiVersion is the version of the Key Vault REST API used.
+const apiVersion = "7.4"
+
+// tokenFunc returns an OAuth access token for the Key Vault service.
+type tokenFunc func(ctx context.Context) (string, error)
+
+// client is a minimal client of the Key Vault certificates REST API.
+type client struct {
+	vaultURL   string
+	token      tokenFunc
+	httpClient *http.Client
+}
+
+func newClient(vaultURL string, token tokenFunc) *client {
+	return &client{
+		vaultURL:   strings.TrimRight(vaultURL, "/"),
+		token:      token,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// certificateBundle is a certificate stored in Key Vault. Cer is the base64
+// encoded DER certificate, and Kid is the identifier of the key of the
+// certificate.
+type certificateBundle struct {
+	ID  string `json:"id"`
+	Kid string `json:"kid"`
+	Cer string `json:"cer"`
+}
+
+// certificatePolicy is the policy used to create a certificate.
+type certificatePolicy struct {
+	KeyProps    keyProperties    `json:"key_props"`
+	SecretProps secretProperties `json:"secret_props"`
+	X509Props   x509Properties   `json:"x509_props"`
+	Issuer      issuerParameters `json:"issuer"`
+}
+
+type keyProperties struct {
+	Exportable bool   `json:"exportable"`
+	KeyType    string `json:"kty"`
+	KeySize    int    `json:"key_size,omitempty"`
+	Curve      string `json:"crv,omitempty"`
+	ReuseKey   bool   `json:"reuse_key"`
+}
+
+type secretProperties struct {
+	ContentType string `json:"contentType"`
+}
+
+type x509Properties struct {
+	Subject        string `json:"subject"`
+	ValidityMonths int    `json:"validity_months,omitempty"`
+}
+
+type issuerParameters struct {
+	Name string `json:"name"`
+}
+
+type createCertificateRequest struct {
+	Policy certificatePolicy `json:"policy"`
+}
+
+// certificateOperation is a pending certificate operation. Csr is the base64
+// encoded DER certificate request of the new key.
+type certificateOperation struct {
+	ID     string `json:"id"`
+	Csr    string `json:"csr"`
+	Status string `json:"status"`
+}
+
+type mergeCertificateRequest struct {
+	X5C []string `json:"x5c"`
+}
+
+// apiError is the error returned by the Key Vault API.
+type apiError struct {
+	StatusCode int
+	Err        struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func (e *apiError) Error() string {
+	if e.Err.Code == "" && e.Err.Message == "" {
+		return fmt.Sprintf("key vault request failed with status code %d", e.StatusCode)
+	}
+	return fmt.Sprintf("key vault request failed with status code %d: %s: %s", e.StatusCode, e.Err.Code, e.Err.Message)
+}
+
+// GetCertificate returns the given version of a certificate. If version is
+// empty, the latest version is returned.
+func (c *client) GetCertificate(ctx context.Context, name, version string) (*certificateBundle, error) {
+	path := "/certificates/" + url.PathEscape(name)
+	if version != "" {
+		path += "/" + url.PathEscape(version)
+	}
+	resp := new(certificateBundle)
+	if err := c.do(ctx, http.MethodGet, path, nil, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// CreateCertificate starts the creation of a new version of a certificate.
+func (c *client) CreateCertificate(ctx context.Context, name string, req *createCertificateRequest) (*certificateOperation, error) {
+	resp := new(certificateOperation)
+	if err := c.do(ctx, http.MethodPost, "/certificates/"+url.PathEscape(name)+"/create", req, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// MergeCertificate completes a pending certificate operation with a
+// certificate signed outside Key Vault.
+func (c *client) MergeCertificate(ctx context.Context, name string, req *mergeCertificateRequest) (*certificateBundle, error) {
+	resp := new(certificateBundle)
+	if err := c.do(ctx, http.MethodPost, "/certificates/"+url.PathEscape(name)+"/pending/merge", req, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (c *client) do(ctx context.Context, method, path string, in, out any) error {
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return fmt.Errorf("error marshaling request: %w", err)
+		}
+		body = bytes.NewReader(b)
+	}
+
+	token, err := c.token(ctx)
+	if err != nil {
+		return fmt.Errorf("error getting key vault token: %w", err)
+	}
+
+	u := c.vaultURL + path + "?" + url.Values{"api-version": []string{apiVersion}}.Encode()
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Accept", "application/json")
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("key vault %s %s failed: %w", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		e := &apiError{StatusCode: resp.StatusCode}
+		_ = json.NewDecoder(resp.Body).Decode(e)
+		return e
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("error decoding response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package azurekvcas
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/cloud"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+)
+
+// cloudConfigurations maps the DNS suffix of a key vault to the Azure cloud
+// configuration used to authenticate.
+var cloudConfigurations = map[string]cloud.Configuration{
+	"vault.azure.net":         cloud.AzurePublic,
+	"vault.usgovcloudapi.net": cloud.AzureGovernment,
+	"vault.azure.cn":          cloud.AzureChina,
+}
+
+// newTokenFunc returns a function that gets tokens for the key vault with the
+// given DNS suffix. It uses the client credentials in the options if they are
+// set, or the default Azure credentials if not. This function is used for
+// testing purposes.
+var newTokenFunc = func(o *Options, dnsSuffix string) (tokenFunc, error) {
+	var clientOptions policy.ClientOptions
+	if conf, ok := cloudConfigurations[dnsSuffix]; ok {
+		clientOptions.Cloud = conf
+	}
+
+	var credential azcore.TokenCredential
+	var err error
+	if o.TenantID != "" && o.ClientID != "" && o.ClientSecret != "" {
+		credential, err = azidentity.NewClientSecretCredential(o.TenantID, o.ClientID, o.ClientSecret, &azidentity.ClientSecretCredentialOptions{
+			ClientOptions: clientOptions,
+		})
+	} else {
+		credential, err = azidentity.NewDefaultAzureCredential(&azidentity.DefaultAzureCredentialOptions{
+			ClientOptions: clientOptions,
+			TenantID:      o.TenantID,
+		})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error creating azure credentials: %w", err)
+	}
+
+	scope := "https://" + dnsSuffix + "/.default"
+	return func(ctx context.Context) (string, error) {
+		tk, err := credential.GetToken(ctx, policy.TokenRequestOptions{
+			Scopes: []string{scope},
+		})
+		if err != nil {
+			return "", err
+		}
+		return tk.Token, nil
+	}, nil
+}
@@ -5,6 +5,7 @@ import (
 	"crypto/rand"
 	"crypto/x509"
 	"encoding/asn1"
+	"encoding/json"
 	"encoding/pem"
 	"regexp"
 	"strings"
@@ -38,6 +39,47 @@ var now = time.Now
 // But we will allow a more flexible one to fail if this changes.
 var caRegexp = regexp.MustCompile("^projects/[^/]+/locations/[^/]+/caPools/[^/]+/certificateAuthorities/[^/]+$")
 
+var (
+	caPoolRegexp   = regexp.MustCompile("^projects/[^/]+/locations/[^/]+/caPools/[^/]+$")
+	templateRegexp = regexp.MustCompile("^projects/[^/]+/locations/[^/]+/certificateTemplates/[^/]+$")
+)
+
+// Options are the CloudCAS options, they are set in the config property of the
+// CAS options.
+type Options struct {
+	// CertificateTemplate is the Google CAS certificate template used by
+	// default, e.g., "projects/*/locations/*/certificateTemplates/*". If not
+	// set, no template is used.
+	CertificateTemplate string `json:"certificateTemplate,omitempty"`
+	// ProvisionerTemplates maps provisioner names to the certificate template
+	// used to issue certificates authorized by them.
+	ProvisionerTemplates map[string]string `json:"provisionerTemplates,omitempty"`
+	// ProvisionerCaPools maps provisioner names to the CA pool used to issue
+	// certificates authorized by them, e.g.,
+	// "projects/*/locations/*/caPools/*". The certificates will be issued by
+	// any enabled certificate authority in the pool, and the issuance policy
+	// of that pool will be enforced.
+	ProvisionerCaPools map[string]string `json:"provisionerCaPools,omitempty"`
+}
+
+// Validate validates the format of the templates and CA pools.
+func (o *Options) Validate() error {
+	if o.CertificateTemplate != "" && !templateRegexp.MatchString(o.CertificateTemplate) {
+		return errors.New("cloudCAS 'certificateTemplate' is not a valid certificate template resource")
+	}
+	for name, tpl := range o.ProvisionerTemplates {
+		if !templateRegexp.MatchString(tpl) {
+			return errors.Errorf("cloudCAS 'provisionerTemplates' for %s is not a valid certificate template resource", name)
+		}
+	}
+	for name, pool := range o.ProvisionerCaPools {
+		if !caPoolRegexp.MatchString(pool) {
+			return errors.Errorf("cloudCAS 'provisionerCaPools' for %s is not a valid CA pool resource", name)
+		}
+	}
+	return nil
+}
+
 // CertificateAuthorityClient is the interface implemented by the Google CAS
 // client.
 type CertificateAuthorityClient interface {
@@ -83,6 +125,7 @@ type CloudCAS struct {
 	caPool               string
 	caPoolTier           pb.CaPool_Tier
 	gcsBucket            string
+	options              Options
 }
 
 // newCertificateAuthorityClient creates the certificate authority client. This
@@ -137,6 +180,16 @@ func New(ctx context.Context, opts apiv1.Options) (*CloudCAS, error) {
 		}
 	}
 
+	var o Options
+	if opts.Config != nil {
+		if err := json.Unmarshal(opts.Config, &o); err != nil {
+			return nil, errors.Wrap(err, "error decoding cloudCAS config")
+		}
+		if err := o.Validate(); err != nil {
+			return nil, err
+		}
+	}
+
 	client, err := newCertificateAuthorityClient(ctx, opts.CredentialsFile)
 	if err != nil {
 		return nil, err
@@ -151,6 +204,7 @@ func New(ctx context.Context, opts apiv1.Options) (*CloudCAS, error) {
 		caPool:               opts.CaPool,
 		gcsBucket:            opts.GCSBucket,
 		caPoolTier:           caPoolTier,
+		options:              o,
 	}, nil
 }
 
@@ -181,14 +235,24 @@ func (c *CloudCAS) GetCertificateAuthority(req *apiv1.GetCertificateAuthorityReq
 		return nil, errors.New("cloudCAS GetCertificateAuthority: PemCACertificate should not be empty")
 	}
 
-	// Last certificate in the chain is the root.
-	root, err := parseCertificate(resp.PemCaCertificates[len(resp.PemCaCertificates)-1])
-	if err != nil {
-		return nil, err
+	// The first certificate is the certificate authority, and the last
+	// certificate in the chain is the root.
+	certs := make([]*x509.Certificate, len(resp.PemCaCertificates))
+	for i, pemCert := range resp.PemCaCertificates {
+		if certs[i], err = parseCertificate(pemCert); err != nil {
+			return nil, err
+		}
+	}
+
+	metadata := apiv1.NewCertificateAuthorityMetadata(certs[0])
+	if resp.State != pb.CertificateAuthority_STATE_UNSPECIFIED {
+		metadata.State = resp.State.String()
 	}
 
 	return &apiv1.GetCertificateAuthorityResponse{
-		RootCertificate: root,
+		RootCertificate:          certs[len(certs)-1],
+		IntermediateCertificates: certs[:len(certs)-1],
+		Metadata:                 metadata,
 	}, nil
 }
 
@@ -201,7 +265,7 @@ func (c *CloudCAS) CreateCertificate(req *apiv1.CreateCertificateRequest) (*apiv
 		return nil, errors.New("createCertificateRequest `lifetime` cannot be 0")
 	}
 
-	cert, chain, err := c.createCertificate(req.Template, req.Lifetime, req.RequestID)
+	cert, chain, err := c.createCertificate(req.Template, req.Lifetime, req.RequestID, req.Provisioner, createLabels(req.Metadata))
 	if err != nil {
 		return nil, err
 	}
@@ -223,7 +287,7 @@ func (c *CloudCAS) RenewCertificate(req *apiv1.RenewCertificateRequest) (*apiv1.
 		return nil, errors.New("renewCertificateRequest `lifetime` cannot be 0")
 	}
 
-	cert, chain, err := c.createCertificate(req.Template, req.Lifetime, req.RequestID)
+	cert, chain, err := c.createCertificate(req.Template, req.Lifetime, req.RequestID, nil, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -277,6 +341,28 @@ func (c *CloudCAS) RevokeCertificate(req *apiv1.RevokeCertificateRequest) (*apiv
 	}, nil
 }
 
+// CheckHealth checks that the configured certificate authority exists and it
+// is enabled.
+func (c *CloudCAS) CheckHealth(ctx context.Context) error {
+	if c.certificateAuthority == "" {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	defer cancel()
+
+	resp, err := c.client.GetCertificateAuthority(ctx, &pb.GetCertificateAuthorityRequest{
+		Name: c.certificateAuthority,
+	})
+	if err != nil {
+		return errors.Wrap(err, "cloudCAS GetCertificateAuthority failed")
+	}
+	if resp.State != pb.CertificateAuthority_ENABLED {
+		return errors.Errorf("cloudCAS certificate authority %s is %s", c.certificateAuthority, resp.State)
+	}
+	return nil
+}
+
 // CreateCertificateAuthority creates a new root or intermediate certificate
 // using Google Cloud CAS.
 func (c *CloudCAS) CreateCertificateAuthority(req *apiv1.CreateCertificateAuthorityRequest) (*apiv1.CreateCertificateAuthorityResponse, error) {
@@ -501,7 +587,7 @@ func (c *CloudCAS) enableCertificateAuthority(ca *pb.CertificateAuthority) (*pb.
 	return ca, nil
 }
 
-func (c *CloudCAS) createCertificate(tpl *x509.Certificate, lifetime time.Duration, requestID string) (*x509.Certificate, []*x509.Certificate, error) {
+func (c *CloudCAS) createCertificate(tpl *x509.Certificate, lifetime time.Duration, requestID string, p *apiv1.ProvisionerInfo, labels map[string]string) (*x509.Certificate, []*x509.Certificate, error) {
 	// Removes the CAS extension if it exists.
 	apiv1.RemoveCertificateAuthorityExtension(tpl)
 
@@ -522,18 +608,24 @@ func (c *CloudCAS) createCertificate(tpl *x509.Certificate, lifetime time.Durati
 		return nil, nil, err
 	}
 
+	if labels == nil {
+		labels = map[string]string{}
+	}
+
 	ctx, cancel := defaultContext()
 	defer cancel()
 
+	parent, issuingCertificateAuthorityID := c.caPoolFor(p)
 	cert, err := c.client.CreateCertificate(ctx, &pb.CreateCertificateRequest{
-		Parent:        "projects/" + c.project + "/locations/" + c.location + "/caPools/" + c.caPool,
+		Parent:        parent,
 		CertificateId: id,
 		Certificate: &pb.Certificate{
-			CertificateConfig: certConfig,
-			Lifetime:          durationpb.New(lifetime),
-			Labels:            map[string]string{},
+			CertificateConfig:   certConfig,
+			Lifetime:            durationpb.New(lifetime),
+			Labels:              labels,
+			CertificateTemplate: c.templateFor(p),
 		},
-		IssuingCertificateAuthorityId: getResourceName(c.certificateAuthority),
+		IssuingCertificateAuthorityId: issuingCertificateAuthorityID,
 		RequestId:                     requestID,
 	})
 	if err != nil {
@@ -544,6 +636,30 @@ func (c *CloudCAS) createCertificate(tpl *x509.Certificate, lifetime time.Durati
 	return getCertificateAndChain(cert)
 }
 
+// templateFor returns the certificate template used for the given
+// provisioner.
+func (c *CloudCAS) templateFor(p *apiv1.ProvisionerInfo) string {
+	if p != nil {
+		if tpl, ok := c.options.ProvisionerTemplates[p.Name]; ok {
+			return tpl
+		}
+	}
+	return c.options.CertificateTemplate
+}
+
+// caPoolFor returns the CA pool and the id of the certificate authority used
+// for the given provisioner. If the provisioner is mapped to a different CA
+// pool, the id is empty and Google CAS will select a certificate authority in
+// that pool.
+func (c *CloudCAS) caPoolFor(p *apiv1.ProvisionerInfo) (string, string) {
+	if p != nil {
+		if pool, ok := c.options.ProvisionerCaPools[p.Name]; ok {
+			return pool, ""
+		}
+	}
+	return "projects/" + c.project + "/locations/" + c.location + "/caPools/" + c.caPool, getResourceName(c.certificateAuthority)
+}
+
 func (c *CloudCAS) signIntermediateCA(parent, name string, req *apiv1.CreateCertificateAuthorityRequest) (*pb.CertificateAuthority, error) {
 	id, err := createCertificateID()
 	if err != nil {
@@ -720,6 +836,43 @@ func getResourceName(name string) string {
 	return parts[len(parts)-1]
 }
 
+// createLabels converts the metadata of a request into Google Cloud labels.
+// Label keys and values can only contain lowercase letters, numeric
+// characters, underscores and dashes, and they cannot be longer than 63
+// characters.
+func createLabels(md map[string]string) map[string]string {
+	labels := make(map[string]string, len(md))
+	for k, v := range md {
+		if k = normalizeLabel(k); k != "" {
+			labels[k] = normalizeLabel(v)
+		}
+	}
+	return labels
+}
+
+func normalizeLabel(s string) string {
+	s = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r + 'a' - 'A'
+		case r >= '0' && r <= '9':
+			return r
+		case r == '-':
+			return r
+		case r == '_':
+			return r
+		default:
+			return '-'
+		}
+	}, s)
+	if len(s) > 63 {
+		s = s[:63]
+	}
+	return s
+}
+
 // Normalize a certificate authority name to comply with [a-zA-Z0-9-_].
 func normalizeCertificateAuthorityName(name string) string {
 	return strings.Map(func(r rune) rune {
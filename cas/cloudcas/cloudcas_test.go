@@ -19,6 +19,7 @@ import (
 	"os"
 	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
@@ -45,6 +46,8 @@ var (
 	errTest             = errors.New("test error")
 	testCaPoolName      = "projects/test-project/locations/us-west1/caPools/test-capool"
 	testAuthorityName   = "projects/test-project/locations/us-west1/caPools/test-capool/certificateAuthorities/test-ca"
+	testTemplateName    = "projects/test-project/locations/us-west1/certificateTemplates/test-template"
+	testACMECaPoolName  = "projects/test-project/locations/us-west1/caPools/acme-capool"
 	testCertificateName = "projects/test-project/locations/us-west1/caPools/test-capool/certificateAuthorities/test-ca/certificates/test-certificate"
 	testProject         = "test-project"
 	testLocation        = "us-west1"
@@ -120,6 +123,7 @@ type testClient struct {
 	certificate          *pb.Certificate
 	certificateAuthority *pb.CertificateAuthority
 	err                  error
+	createRequest        *pb.CreateCertificateRequest
 }
 
 func newTestClient(credentialsFile string) (CertificateAuthorityClient, error) {
@@ -198,7 +202,8 @@ func (b *badSigner) Sign(io.Reader, []byte, crypto.SignerOpts) ([]byte, error) {
 	return nil, fmt.Errorf("💥")
 }
 
-func (c *testClient) CreateCertificate(context.Context, *pb.CreateCertificateRequest, ...gax.CallOption) (*pb.Certificate, error) {
+func (c *testClient) CreateCertificate(_ context.Context, req *pb.CreateCertificateRequest, _ ...gax.CallOption) (*pb.Certificate, error) {
+	c.createRequest = req
 	return c.certificate, c.err
 }
 
@@ -333,6 +338,37 @@ func TestNew(t *testing.T) {
 			caPool:     testCaPool,
 			caPoolTier: pb.CaPool_ENTERPRISE,
 		}, false},
+		{"ok with config", args{context.Background(), apiv1.Options{
+			CertificateAuthority: testAuthorityName,
+			Config:               []byte(`{"certificateTemplate":"` + testTemplateName + `","provisionerTemplates":{"acme":"` + testTemplateName + `"},"provisionerCaPools":{"acme":"` + testACMECaPoolName + `"}}`),
+		}}, &CloudCAS{
+			client:               &testClient{},
+			certificateAuthority: testAuthorityName,
+			project:              testProject,
+			location:             testLocation,
+			caPool:               testCaPool,
+			options: Options{
+				CertificateTemplate:  testTemplateName,
+				ProvisionerTemplates: map[string]string{"acme": testTemplateName},
+				ProvisionerCaPools:   map[string]string{"acme": testACMECaPoolName},
+			},
+		}, false},
+		{"fail config", args{context.Background(), apiv1.Options{
+			CertificateAuthority: testAuthorityName,
+			Config:               []byte(`{"certificateTemplate":1}`),
+		}}, nil, true},
+		{"fail config certificateTemplate", args{context.Background(), apiv1.Options{
+			CertificateAuthority: testAuthorityName,
+			Config:               []byte(`{"certificateTemplate":"bad-template"}`),
+		}}, nil, true},
+		{"fail config provisionerTemplates", args{context.Background(), apiv1.Options{
+			CertificateAuthority: testAuthorityName,
+			Config:               []byte(`{"provisionerTemplates":{"acme":"bad-template"}}`),
+		}}, nil, true},
+		{"fail config provisionerCaPools", args{context.Background(), apiv1.Options{
+			CertificateAuthority: testAuthorityName,
+			Config:               []byte(`{"provisionerCaPools":{"acme":"` + testAuthorityName + `"}}`),
+		}}, nil, true},
 		{"fail certificate authority", args{context.Background(), apiv1.Options{
 			CertificateAuthority: "projects/ok1234/locations/ok1234/caPools/ok1234/certificateAuthorities/ok1234/bad",
 		}}, nil, true},
@@ -461,8 +497,40 @@ func TestCloudCAS_Type(t *testing.T) {
 	}
 }
 
+func TestCloudCAS_CheckHealth(t *testing.T) {
+	tests := []struct {
+		name                 string
+		client               CertificateAuthorityClient
+		certificateAuthority string
+		wantErr              bool
+	}{
+		{"ok", &testClient{certificateAuthority: &pb.CertificateAuthority{
+			State: pb.CertificateAuthority_ENABLED,
+		}}, testAuthorityName, false},
+		{"ok no certificateAuthority", failTestClient(), "", false},
+		{"fail GetCertificateAuthority", failTestClient(), testAuthorityName, true},
+		{"fail disabled", &testClient{certificateAuthority: &pb.CertificateAuthority{
+			State: pb.CertificateAuthority_DISABLED,
+		}}, testAuthorityName, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &CloudCAS{
+				client:               tt.client,
+				certificateAuthority: tt.certificateAuthority,
+			}
+			if err := c.CheckHealth(context.Background()); (err != nil) != tt.wantErr {
+				t.Errorf("CloudCAS.CheckHealth() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
 func TestCloudCAS_GetCertificateAuthority(t *testing.T) {
 	root := mustParseCertificate(t, testRootCertificate)
+	intermediate := mustParseCertificate(t, testIntermediateCertificate)
+	enabledClient := okTestClient()
+	enabledClient.certificateAuthority.State = pb.CertificateAuthority_ENABLED
 	type fields struct {
 		client               CertificateAuthorityClient
 		certificateAuthority string
@@ -478,12 +546,25 @@ func TestCloudCAS_GetCertificateAuthority(t *testing.T) {
 		wantErr bool
 	}{
 		{"ok", fields{okTestClient(), testCertificateName}, args{&apiv1.GetCertificateAuthorityRequest{}}, &apiv1.GetCertificateAuthorityResponse{
-			RootCertificate: root,
+			RootCertificate:          root,
+			IntermediateCertificates: []*x509.Certificate{intermediate},
+			Metadata:                 apiv1.NewCertificateAuthorityMetadata(intermediate),
 		}, false},
 		{"ok with name", fields{okTestClient(), testCertificateName}, args{&apiv1.GetCertificateAuthorityRequest{
 			Name: testCertificateName,
 		}}, &apiv1.GetCertificateAuthorityResponse{
-			RootCertificate: root,
+			RootCertificate:          root,
+			IntermediateCertificates: []*x509.Certificate{intermediate},
+			Metadata:                 apiv1.NewCertificateAuthorityMetadata(intermediate),
+		}, false},
+		{"ok with state", fields{enabledClient, testCertificateName}, args{&apiv1.GetCertificateAuthorityRequest{}}, &apiv1.GetCertificateAuthorityResponse{
+			RootCertificate:          root,
+			IntermediateCertificates: []*x509.Certificate{intermediate},
+			Metadata: &apiv1.CertificateAuthorityMetadata{
+				NotBefore: intermediate.NotBefore,
+				NotAfter:  intermediate.NotAfter,
+				State:     "ENABLED",
+			},
 		}, false},
 		{"fail GetCertificateAuthority", fields{failTestClient(), testCertificateName}, args{&apiv1.GetCertificateAuthorityRequest{}}, nil, true},
 		{"fail bad root", fields{badTestClient(), testCertificateName}, args{&apiv1.GetCertificateAuthorityRequest{}}, nil, true},
@@ -608,7 +689,7 @@ func TestCloudCAS_createCertificate(t *testing.T) {
 				client:               tt.fields.client,
 				certificateAuthority: tt.fields.certificateAuthority,
 			}
-			got, got1, err := c.createCertificate(tt.args.tpl, tt.args.lifetime, tt.args.requestID)
+			got, got1, err := c.createCertificate(tt.args.tpl, tt.args.lifetime, tt.args.requestID, nil, nil)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("CloudCAS.createCertificate() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -623,6 +704,70 @@ func TestCloudCAS_createCertificate(t *testing.T) {
 	}
 }
 
+func TestCloudCAS_CreateCertificate_options(t *testing.T) {
+	leaf := mustParseCertificate(t, testLeafCertificate)
+	defaultPool := "projects/" + testProject + "/locations/" + testLocation + "/caPools/" + testCaPool
+	otherTemplate := "projects/test-project/locations/us-west1/certificateTemplates/other-template"
+
+	tests := []struct {
+		name            string
+		options         Options
+		provisioner     *apiv1.ProvisionerInfo
+		wantParent      string
+		wantIssuingCaID string
+		wantTemplate    string
+	}{
+		{"ok no options", Options{}, &apiv1.ProvisionerInfo{Name: "acme"}, defaultPool, "test-ca", ""},
+		{"ok no provisioner", Options{
+			CertificateTemplate:  testTemplateName,
+			ProvisionerTemplates: map[string]string{"acme": otherTemplate},
+			ProvisionerCaPools:   map[string]string{"acme": testACMECaPoolName},
+		}, nil, defaultPool, "test-ca", testTemplateName},
+		{"ok default template", Options{
+			CertificateTemplate:  testTemplateName,
+			ProvisionerTemplates: map[string]string{"acme": otherTemplate},
+		}, &apiv1.ProvisionerInfo{Name: "jwk"}, defaultPool, "test-ca", testTemplateName},
+		{"ok provisioner template", Options{
+			CertificateTemplate:  testTemplateName,
+			ProvisionerTemplates: map[string]string{"acme": otherTemplate},
+		}, &apiv1.ProvisionerInfo{Name: "acme"}, defaultPool, "test-ca", otherTemplate},
+		{"ok provisioner pool", Options{
+			ProvisionerCaPools: map[string]string{"acme": testACMECaPoolName},
+		}, &apiv1.ProvisionerInfo{Name: "acme"}, testACMECaPoolName, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := okTestClient()
+			c := &CloudCAS{
+				client:               client,
+				certificateAuthority: testAuthorityName,
+				project:              testProject,
+				location:             testLocation,
+				caPool:               testCaPool,
+				options:              tt.options,
+			}
+			_, err := c.CreateCertificate(&apiv1.CreateCertificateRequest{
+				Template:    leaf,
+				Lifetime:    24 * time.Hour,
+				Provisioner: tt.provisioner,
+			})
+			if err != nil {
+				t.Fatalf("CloudCAS.CreateCertificate() error = %v", err)
+			}
+			req := client.createRequest
+			if req.Parent != tt.wantParent {
+				t.Errorf("CreateCertificateRequest.Parent = %v, want %v", req.Parent, tt.wantParent)
+			}
+			if req.IssuingCertificateAuthorityId != tt.wantIssuingCaID {
+				t.Errorf("CreateCertificateRequest.IssuingCertificateAuthorityId = %v, want %v", req.IssuingCertificateAuthorityId, tt.wantIssuingCaID)
+			}
+			if req.Certificate.CertificateTemplate != tt.wantTemplate {
+				t.Errorf("CreateCertificateRequest.Certificate.CertificateTemplate = %v, want %v", req.Certificate.CertificateTemplate, tt.wantTemplate)
+			}
+		})
+	}
+}
+
 func TestCloudCAS_RenewCertificate(t *testing.T) {
 	type fields struct {
 		client               CertificateAuthorityClient
@@ -1532,3 +1677,35 @@ func Test_normalizeCertificateAuthorityName(t *testing.T) {
 		})
 	}
 }
+
+func Test_createLabels(t *testing.T) {
+	type args struct {
+		md map[string]string
+	}
+	tests := []struct {
+		name string
+		args args
+		want map[string]string
+	}{
+		{"ok", args{map[string]string{
+			apiv1.MetadataProvisionerName: "Jane@Example.com",
+			apiv1.MetadataProvisionerType: "JWK",
+			apiv1.MetadataACMEOrderID:     strings.Repeat("a", 70),
+			apiv1.MetadataTemplate:        "",
+		}}, map[string]string{
+			"provisioner-name": "jane-example-com",
+			"provisioner-type": "jwk",
+			"acme-order-id":    strings.Repeat("a", 63),
+			"template":         "",
+		}},
+		{"ok nil", args{nil}, map[string]string{}},
+		{"ok empty key", args{map[string]string{"": "value"}}, map[string]string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := createLabels(tt.args.md); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("createLabels() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
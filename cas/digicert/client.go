@@ -0,0 +1,205 @@
+package digicert
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// client is a minimal client of the DigiCert CertCentral Services API v2.
+type client struct {
+	baseURL    string
+	apiKey     string
+	httpClient *http.Client
+}
+
+func newClient(baseURL, apiKey string) *client {
+	return &client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		apiKey:     apiKey,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// orderRequest is the body of the order certificate request.
+type orderRequest struct {
+	Certificate   orderCertificate   `json:"certificate"`
+	Organization  *orderOrganization `json:"organization,omitempty"`
+	OrderValidity orderValidity      `json:"order_validity"`
+	PaymentMethod string             `json:"payment_method,omitempty"`
+	SkipApproval  bool               `json:"skip_approval"`
+}
+
+type orderCertificate struct {
+	CommonName    string   `json:"common_name"`
+	DNSNames      []string `json:"dns_names,omitempty"`
+	CSR           string   `json:"csr"`
+	SignatureHash string   `json:"signature_hash"`
+}
+
+type orderOrganization struct {
+	ID int `json:"id"`
+}
+
+type orderValidity struct {
+	Days int `json:"days"`
+}
+
+// orderResponse is the response of the order certificate request. The
+// certificate chain is only present if the certificate was issued
+// immediately.
+type orderResponse struct {
+	ID               int                `json:"id"`
+	CertificateID    int                `json:"certificate_id"`
+	CertificateChain []certificateChain `json:"certificate_chain"`
+}
+
+type certificateChain struct {
+	SubjectCommonName string `json:"subject_common_name"`
+	PEM               string `json:"pem"`
+}
+
+// order is the order info returned by the get order request.
+type order struct {
+	ID          int    `json:"id"`
+	Status      string `json:"status"`
+	Certificate struct {
+		ID           int    `json:"id"`
+		SerialNumber string `json:"serial_number"`
+	} `json:"certificate"`
+}
+
+type listOrdersResponse struct {
+	Orders []order `json:"orders"`
+}
+
+type revokeRequest struct {
+	Reason   string `json:"reason"`
+	Comments string `json:"comments,omitempty"`
+}
+
+// apiError is the error returned by the CertCentral API.
+type apiError struct {
+	StatusCode int
+	Errors     []struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+func (e *apiError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		msgs[i] = err.Code + ": " + err.Message
+	}
+	if len(msgs) == 0 {
+		return fmt.Sprintf("digicert request failed with status code %d", e.StatusCode)
+	}
+	return fmt.Sprintf("digicert request failed with status code %d: %s", e.StatusCode, strings.Join(msgs, ", "))
+}
+
+// OrderCertificate submits a new order for the given product.
+func (c *client) OrderCertificate(ctx context.Context, product string, req *orderRequest) (*orderResponse, error) {
+	resp := new(orderResponse)
+	if err := c.do(ctx, http.MethodPost, "/order/certificate/"+url.PathEscape(product), req, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// GetOrder returns the information of the order with the given id.
+func (c *client) GetOrder(ctx context.Context, id int) (*order, error) {
+	resp := new(order)
+	if err := c.do(ctx, http.MethodGet, "/order/certificate/"+strconv.Itoa(id), nil, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// FindOrder returns the order of the certificate with the given serial
+// number.
+func (c *client) FindOrder(ctx context.Context, serialNumber string) (*order, error) {
+	resp := new(listOrdersResponse)
+	path := "/order/certificate?" + url.Values{"filters[serial_number]": []string{serialNumber}}.Encode()
+	if err := c.do(ctx, http.MethodGet, path, nil, resp); err != nil {
+		return nil, err
+	}
+	for i := range resp.Orders {
+		if strings.EqualFold(resp.Orders[i].Certificate.SerialNumber, serialNumber) {
+			return &resp.Orders[i], nil
+		}
+	}
+	return nil, fmt.Errorf("certificate with serial number %s not found", serialNumber)
+}
+
+// DownloadCertificate returns the PEM encoded certificate with the given id,
+// followed by its chain.
+func (c *client) DownloadCertificate(ctx context.Context, id int) ([]byte, error) {
+	var b bytes.Buffer
+	if err := c.do(ctx, http.MethodGet, "/certificate/"+strconv.Itoa(id)+"/download/format/pem_all", nil, &b); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// RevokeCertificate revokes the certificate with the given id.
+func (c *client) RevokeCertificate(ctx context.Context, id int, req *revokeRequest) error {
+	return c.do(ctx, http.MethodPut, "/certificate/"+strconv.Itoa(id)+"/revoke", req, nil)
+}
+
+// do sends a request to the API. The response body is copied to out if it is
+// a *bytes.Buffer, or decoded as JSON otherwise.
+func (c *client) do(ctx context.Context, method, path string, in, out any) error {
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return fmt.Errorf("error marshaling request: %w", err)
+		}
+		body = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, body)
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("X-DC-DEVKEY", c.apiKey)
+	req.Header.Set("Accept", "application/json")
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("digicert %s %s failed: %w", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		e := &apiError{StatusCode: resp.StatusCode}
+		_ = json.NewDecoder(resp.Body).Decode(e)
+		return e
+	}
+
+	switch v := out.(type) {
+	case nil:
+		return nil
+	case *bytes.Buffer:
+		if _, err := v.ReadFrom(resp.Body); err != nil {
+			return fmt.Errorf("error reading response: %w", err)
+		}
+		return nil
+	default:
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return fmt.Errorf("error decoding response: %w", err)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,395 @@
+package digicert
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"time"
+
+	"github.com/smallstep/certificates/cas/apiv1"
+)
+
+func init() {
+	apiv1.Register(apiv1.DigiCertCAS, func(ctx context.Context, opts apiv1.Options) (apiv1.CertificateAuthorityService, error) {
+		return New(ctx, opts)
+	})
+}
+
+// DefaultURL is the URL of the DigiCert CertCentral Services API.
+const DefaultURL = "https://www.digicert.com/services/v2"
+
+// defaultProduct is the product ordered if none is configured.
+const defaultProduct = "ssl_basic"
+
+// pollInterval is the time between order requests while the certificate is
+// being issued.
+var pollInterval = 5 * time.Second
+
+// retryAfter is the time suggested to clients to wait before getting a
+// pending certificate.
+var retryAfter = 30 * time.Second
+
+// Options are the DigiCert options, they are set in the config property of the
+// CAS options.
+type Options struct {
+	// APIKey is the CertCentral API key.
+	APIKey string `json:"apiKey"`
+	// OrganizationID is the id of the organization used in the orders. It is
+	// required by OV and private products.
+	OrganizationID int `json:"organizationID,omitempty"`
+	// Product is the product name id ordered by default, e.g. "ssl_basic" or
+	// "private_ssl_plus". Defaults to "ssl_basic".
+	Product string `json:"product,omitempty"`
+	// ProvisionerProducts maps provisioner names to the product ordered for
+	// certificates authorized by them.
+	ProvisionerProducts map[string]string `json:"provisionerProducts,omitempty"`
+	// ValidityDays, if set, is the validity of all the orders. By default the
+	// validity is the certificate lifetime rounded up to days.
+	ValidityDays int `json:"validityDays,omitempty"`
+	// SignatureHash is the signature hash of the certificates. Defaults to
+	// "sha256".
+	SignatureHash string `json:"signatureHash,omitempty"`
+	// PaymentMethod is the payment method of the orders. Defaults to the
+	// account default.
+	PaymentMethod string `json:"paymentMethod,omitempty"`
+	// AsyncIssuance, if true, does not wait for orders that are not issued
+	// immediately. Instead, a PendingCertificateError is returned and the
+	// certificate can be retrieved later with GetPendingCertificate.
+	AsyncIssuance bool `json:"asyncIssuance,omitempty"`
+}
+
+// revocationReasonMap maps revocation reason codes from RFC 5280 to the
+// revocation reasons supported by DigiCert.
+var revocationReasonMap = map[int]string{
+	0: "unspecified",
+	1: "key_compromise",
+	3: "affiliation_changed",
+	4: "superseded",
+	5: "cessation_of_operation",
+}
+
+// DigiCert implements a CertificateAuthorityService using DigiCert
+// CertCentral.
+type DigiCert struct {
+	client  *client
+	options Options
+}
+
+// New creates a new CertificateAuthorityService implementation using DigiCert
+// CertCentral. The certificate authority is the URL of the API and it
+// defaults to DefaultURL.
+func New(_ context.Context, opts apiv1.Options) (*DigiCert, error) {
+	var o Options
+	if opts.Config != nil {
+		if err := json.Unmarshal(opts.Config, &o); err != nil {
+			return nil, fmt.Errorf("error decoding digicert config: %w", err)
+		}
+	}
+	switch {
+	case o.APIKey == "":
+		return nil, errors.New("digicert 'apiKey' cannot be empty")
+	case o.ValidityDays < 0:
+		return nil, errors.New("digicert 'validityDays' cannot be less than 0")
+	}
+	if o.Product == "" {
+		o.Product = defaultProduct
+	}
+	if o.SignatureHash == "" {
+		o.SignatureHash = "sha256"
+	}
+
+	baseURL := opts.CertificateAuthority
+	if baseURL == "" {
+		baseURL = DefaultURL
+	}
+
+	return &DigiCert{
+		client:  newClient(baseURL, o.APIKey),
+		options: o,
+	}, nil
+}
+
+// Type returns the type of this CertificateAuthorityService.
+func (c *DigiCert) Type() apiv1.Type {
+	return apiv1.DigiCertCAS
+}
+
+// CreateCertificate orders a new certificate using the product configured
+// for the provisioner.
+func (c *DigiCert) CreateCertificate(req *apiv1.CreateCertificateRequest) (*apiv1.CreateCertificateResponse, error) {
+	switch {
+	case req.CSR == nil:
+		return nil, errors.New("createCertificateRequest `csr` cannot be nil")
+	case req.Lifetime == 0:
+		return nil, errors.New("createCertificateRequest `lifetime` cannot be 0")
+	}
+
+	cert, chain, err := c.createCertificate(req.CSR, req.Lifetime, c.product(req.Provisioner))
+	if err != nil {
+		return nil, err
+	}
+
+	return &apiv1.CreateCertificateResponse{
+		Certificate:      cert,
+		CertificateChain: chain,
+	}, nil
+}
+
+// RenewCertificate orders a new certificate with the CSR in the request.
+// DigiCert only signs certificate requests, so renewals without a CSR will
+// return a non-implemented error.
+func (c *DigiCert) RenewCertificate(req *apiv1.RenewCertificateRequest) (*apiv1.RenewCertificateResponse, error) {
+	switch {
+	case req.CSR == nil:
+		return nil, apiv1.NotImplementedError{Message: "digicert does not support renewals without a certificate request"}
+	case req.Lifetime == 0:
+		return nil, errors.New("renewCertificateRequest `lifetime` cannot be 0")
+	}
+
+	cert, chain, err := c.createCertificate(req.CSR, req.Lifetime, c.product(nil))
+	if err != nil {
+		return nil, err
+	}
+
+	return &apiv1.RenewCertificateResponse{
+		Certificate:      cert,
+		CertificateChain: chain,
+	}, nil
+}
+
+// RevokeCertificate revokes a certificate using DigiCert. The certificate is
+// looked up by serial number.
+func (c *DigiCert) RevokeCertificate(req *apiv1.RevokeCertificateRequest) (*apiv1.RevokeCertificateResponse, error) {
+	reason, ok := revocationReasonMap[req.ReasonCode]
+	switch {
+	case !ok:
+		return nil, fmt.Errorf("revokeCertificateRequest 'reasonCode=%d' is invalid or not supported", req.ReasonCode)
+	case req.SerialNumber == "" && req.Certificate == nil:
+		return nil, errors.New("revokeCertificateRequest `serialNumber` or `certificate` are required")
+	}
+
+	var sn *big.Int
+	if req.Certificate != nil {
+		sn = req.Certificate.SerialNumber
+	} else if sn, ok = new(big.Int).SetString(req.SerialNumber, 10); !ok {
+		return nil, fmt.Errorf("error parsing serialNumber: %v cannot be converted to big.Int", req.SerialNumber)
+	}
+
+	ctx, cancel := defaultContext()
+	defer cancel()
+
+	o, err := c.client.FindOrder(ctx, hex.EncodeToString(sn.Bytes()))
+	if err != nil {
+		return nil, fmt.Errorf("digicert RevokeCertificate failed: %w", err)
+	}
+	if err := c.client.RevokeCertificate(ctx, o.Certificate.ID, &revokeRequest{
+		Reason:   reason,
+		Comments: req.Reason,
+	}); err != nil {
+		return nil, fmt.Errorf("digicert RevokeCertificate failed: %w", err)
+	}
+
+	return &apiv1.RevokeCertificateResponse{
+		Certificate: req.Certificate,
+	}, nil
+}
+
+// product returns the product ordered for the given provisioner.
+func (c *DigiCert) product(p *apiv1.ProvisionerInfo) string {
+	if p != nil {
+		if product, ok := c.options.ProvisionerProducts[p.Name]; ok {
+			return product
+		}
+	}
+	return c.options.Product
+}
+
+// validityDays returns the validity of the order for the given lifetime.
+func (c *DigiCert) validityDays(lifetime time.Duration) int {
+	if c.options.ValidityDays > 0 {
+		return c.options.ValidityDays
+	}
+	days := int((lifetime + 24*time.Hour - 1) / (24 * time.Hour))
+	if days < 1 {
+		days = 1
+	}
+	return days
+}
+
+func (c *DigiCert) createCertificate(cr *x509.CertificateRequest, lifetime time.Duration, product string) (*x509.Certificate, []*x509.Certificate, error) {
+	commonName := cr.Subject.CommonName
+	if commonName == "" && len(cr.DNSNames) > 0 {
+		commonName = cr.DNSNames[0]
+	}
+	if commonName == "" {
+		return nil, nil, errors.New("error creating certificate: certificate request does not contain a common name or DNS names")
+	}
+
+	req := &orderRequest{
+		Certificate: orderCertificate{
+			CommonName: commonName,
+			DNSNames:   cr.DNSNames,
+			CSR: string(pem.EncodeToMemory(&pem.Block{
+				Type:  "CERTIFICATE REQUEST",
+				Bytes: cr.Raw,
+			})),
+			SignatureHash: c.options.SignatureHash,
+		},
+		OrderValidity: orderValidity{
+			Days: c.validityDays(lifetime),
+		},
+		PaymentMethod: c.options.PaymentMethod,
+		SkipApproval:  true,
+	}
+	if c.options.OrganizationID != 0 {
+		req.Organization = &orderOrganization{ID: c.options.OrganizationID}
+	}
+
+	ctx, cancel := defaultContext()
+	defer cancel()
+
+	resp, err := c.client.OrderCertificate(ctx, product, req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("digicert OrderCertificate failed: %w", err)
+	}
+
+	// Certificates issued immediately are returned in the response.
+	var b []byte
+	if len(resp.CertificateChain) > 0 {
+		for _, cc := range resp.CertificateChain {
+			b = append(b, cc.PEM...)
+			b = append(b, '\n')
+		}
+	} else if c.options.AsyncIssuance {
+		return c.getOrderCertificate(ctx, resp.ID)
+	} else {
+		certificateID, err := c.waitOrder(ctx, resp.ID)
+		if err != nil {
+			return nil, nil, err
+		}
+		if b, err = c.client.DownloadCertificate(ctx, certificateID); err != nil {
+			return nil, nil, fmt.Errorf("digicert DownloadCertificate failed: %w", err)
+		}
+	}
+
+	return parseCertificateChain(b)
+}
+
+// GetPendingCertificate returns the certificate of an order that was not
+// issued immediately. It returns a PendingCertificateError if the order has not
+// been issued yet.
+func (c *DigiCert) GetPendingCertificate(req *apiv1.GetPendingCertificateRequest) (*apiv1.GetPendingCertificateResponse, error) {
+	id, err := strconv.Atoi(req.ID)
+	if err != nil {
+		return nil, apiv1.ValidationError{Message: fmt.Sprintf("getPendingCertificateRequest 'id=%s' is not valid", req.ID)}
+	}
+
+	ctx, cancel := defaultContext()
+	defer cancel()
+
+	cert, chain, err := c.getOrderCertificate(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return &apiv1.GetPendingCertificateResponse{
+		Certificate:      cert,
+		CertificateChain: chain,
+	}, nil
+}
+
+// getOrderCertificate returns the certificate of an order if it has been
+// issued, or a PendingCertificateError if it is still being processed.
+func (c *DigiCert) getOrderCertificate(ctx context.Context, id int) (*x509.Certificate, []*x509.Certificate, error) {
+	o, err := c.client.GetOrder(ctx, id)
+	if err != nil {
+		return nil, nil, fmt.Errorf("digicert GetOrder failed: %w", err)
+	}
+	switch o.Status {
+	case "issued":
+		b, err := c.client.DownloadCertificate(ctx, o.Certificate.ID)
+		if err != nil {
+			return nil, nil, fmt.Errorf("digicert DownloadCertificate failed: %w", err)
+		}
+		return parseCertificateChain(b)
+	case "rejected", "canceled", "revoked", "expired":
+		return nil, nil, fmt.Errorf("digicert order %d is %s", id, o.Status)
+	default:
+		return nil, nil, apiv1.PendingCertificateError{
+			ID:         strconv.Itoa(id),
+			RetryAfter: retryAfter,
+		}
+	}
+}
+
+// waitOrder waits until the order is issued and returns the id of the
+// certificate.
+func (c *DigiCert) waitOrder(ctx context.Context, id int) (int, error) {
+	for {
+		o, err := c.client.GetOrder(ctx, id)
+		if err != nil {
+			return 0, fmt.Errorf("digicert GetOrder failed: %w", err)
+		}
+		switch o.Status {
+		case "issued":
+			return o.Certificate.ID, nil
+		case "rejected", "canceled", "revoked", "expired":
+			return 0, fmt.Errorf("digicert order %d is %s", id, o.Status)
+		}
+
+		select {
+		case <-ctx.Done():
+			return 0, fmt.Errorf("error waiting for digicert order %d: %w", id, ctx.Err())
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+// parseCertificateChain parses the PEM encoded certificate followed by its
+// chain. The root certificate is not part of the chain.
+func parseCertificateChain(b []byte) (*x509.Certificate, []*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for len(b) > 0 {
+		var block *pem.Block
+		if block, b = pem.Decode(b); block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error parsing certificate: %w", err)
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, nil, errors.New("error parsing certificate: certificate not found")
+	}
+
+	var chain []*x509.Certificate
+	for _, cert := range certs[1:] {
+		if !isRoot(cert) {
+			chain = append(chain, cert)
+		}
+	}
+	return certs[0], chain, nil
+}
+
+// isRoot returns true if the given certificate is a root certificate.
+func isRoot(cert *x509.Certificate) bool {
+	if cert.BasicConstraintsValid && cert.IsCA {
+		return cert.CheckSignatureFrom(cert) == nil
+	}
+	return false
+}
+
+func defaultContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), 2*time.Minute)
+}
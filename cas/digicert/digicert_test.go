@@ -0,0 +1,474 @@
+package digicert
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.step.sm/crypto/keyutil"
+	"go.step.sm/crypto/minica"
+	"go.step.sm/crypto/x509util"
+
+	"github.com/smallstep/certificates/cas/apiv1"
+)
+
+const testAPIKey = "api-key"
+
+// testServer is a fake CertCentral API. Orders of the "ssl_basic" product
+// are issued immediately, orders of any other product are issued after
+// polling the order once.
+type testServer struct {
+	ca     *minica.CA
+	mu     sync.Mutex
+	orders map[int]*testOrder
+	last   *orderRequest
+	revoke map[int]*revokeRequest
+}
+
+type testOrder struct {
+	cert  *x509.Certificate
+	polls int
+}
+
+func newTestServer(t *testing.T) (*testServer, string) {
+	t.Helper()
+	ca, err := minica.New()
+	require.NoError(t, err)
+	s := &testServer{
+		ca:     ca,
+		orders: make(map[int]*testOrder),
+		revoke: make(map[int]*revokeRequest),
+	}
+	srv := httptest.NewServer(s)
+	t.Cleanup(srv.Close)
+	return s, srv.URL
+}
+
+func (s *testServer) writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func (s *testServer) writeError(w http.ResponseWriter, code int, msg string) {
+	s.writeJSON(w, code, map[string]any{
+		"errors": []map[string]string{{"code": "error", "message": msg}},
+	})
+}
+
+func (s *testServer) pemAll(cert *x509.Certificate) string {
+	var b []byte
+	for _, c := range []*x509.Certificate{cert, s.ca.Intermediate, s.ca.Root} {
+		b = append(b, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.Raw})...)
+	}
+	return string(b)
+}
+
+func (s *testServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("X-DC-DEVKEY") != testAPIKey {
+		s.writeError(w, http.StatusUnauthorized, "invalid api key")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var id int
+	switch {
+	case r.Method == http.MethodPost && strings.HasPrefix(r.URL.Path, "/order/certificate/"):
+		product := strings.TrimPrefix(r.URL.Path, "/order/certificate/")
+		req := new(orderRequest)
+		if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+			s.writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		s.last = req
+		if product == "fail" {
+			s.writeError(w, http.StatusBadRequest, "invalid product")
+			return
+		}
+		block, _ := pem.Decode([]byte(req.Certificate.CSR))
+		if block == nil {
+			s.writeError(w, http.StatusBadRequest, "invalid csr")
+			return
+		}
+		csr, err := x509.ParseCertificateRequest(block.Bytes)
+		if err != nil {
+			s.writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		cert, err := s.ca.SignCSR(csr, minica.WithModifyFunc(func(c *x509.Certificate) error {
+			c.NotAfter = c.NotBefore.Add(time.Duration(req.OrderValidity.Days) * 24 * time.Hour)
+			return nil
+		}))
+		if err != nil {
+			s.writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		id = len(s.orders) + 1
+		s.orders[id] = &testOrder{cert: cert}
+		resp := orderResponse{ID: id}
+		if product == defaultProduct {
+			resp.CertificateID = 100 + id
+			resp.CertificateChain = []certificateChain{{PEM: s.pemAll(cert)}}
+		}
+		s.writeJSON(w, http.StatusCreated, resp)
+	case r.Method == http.MethodGet && r.URL.Path == "/order/certificate":
+		sn := r.URL.Query().Get("filters[serial_number]")
+		var orders []order
+		for id, o := range s.orders {
+			if hex.EncodeToString(o.cert.SerialNumber.Bytes()) == sn {
+				var ord order
+				ord.ID = id
+				ord.Status = "issued"
+				ord.Certificate.ID = 100 + id
+				ord.Certificate.SerialNumber = sn
+				orders = append(orders, ord)
+			}
+		}
+		s.writeJSON(w, http.StatusOK, listOrdersResponse{Orders: orders})
+	case r.Method == http.MethodGet && pathID(r.URL.Path, "/order/certificate/", "", &id):
+		o, ok := s.orders[id]
+		if !ok {
+			s.writeError(w, http.StatusNotFound, "order not found")
+			return
+		}
+		var ord order
+		ord.ID = id
+		ord.Status = "pending"
+		if o.polls++; o.polls > 1 {
+			ord.Status = "issued"
+			ord.Certificate.ID = 100 + id
+		}
+		s.writeJSON(w, http.StatusOK, ord)
+	case r.Method == http.MethodGet && pathID(r.URL.Path, "/certificate/", "/download/format/pem_all", &id):
+		o, ok := s.orders[id-100]
+		if !ok {
+			s.writeError(w, http.StatusNotFound, "certificate not found")
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, s.pemAll(o.cert))
+	case r.Method == http.MethodPut && pathID(r.URL.Path, "/certificate/", "/revoke", &id):
+		req := new(revokeRequest)
+		if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+			s.writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		s.revoke[id] = req
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		s.writeError(w, http.StatusNotFound, "not found")
+	}
+}
+
+// pathID parses the id in a path with the given prefix and suffix.
+func pathID(path, prefix, suffix string, id *int) bool {
+	s, ok := strings.CutPrefix(path, prefix)
+	if !ok {
+		return false
+	}
+	if s, ok = strings.CutSuffix(s, suffix); !ok {
+		return false
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return false
+	}
+	*id = n
+	return true
+}
+
+func mustCertificateRequest(t *testing.T, cn string, sans ...string) *x509.CertificateRequest {
+	t.Helper()
+	signer, err := keyutil.GenerateDefaultSigner()
+	require.NoError(t, err)
+	cr, err := x509util.CreateCertificateRequest(cn, sans, signer)
+	require.NoError(t, err)
+	return cr
+}
+
+func mustDigiCert(t *testing.T, baseURL string, o Options) *DigiCert {
+	t.Helper()
+	if o.APIKey == "" {
+		o.APIKey = testAPIKey
+	}
+	config, err := json.Marshal(o)
+	require.NoError(t, err)
+	c, err := New(context.Background(), apiv1.Options{
+		Type:                 apiv1.DigiCertCAS,
+		CertificateAuthority: baseURL,
+		Config:               config,
+	})
+	require.NoError(t, err)
+	return c
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    apiv1.Options
+		want    *DigiCert
+		wantErr bool
+	}{
+		{"ok", apiv1.Options{Config: json.RawMessage(`{"apiKey":"key"}`)}, &DigiCert{
+			client:  newClient(DefaultURL, "key"),
+			options: Options{APIKey: "key", Product: "ssl_basic", SignatureHash: "sha256"},
+		}, false},
+		{"ok options", apiv1.Options{CertificateAuthority: "https://digicert.example.com/", Config: json.RawMessage(`{
+			"apiKey":"key", "organizationID": 1234, "product": "private_ssl_plus",
+			"provisionerProducts": {"acme": "ssl_basic"}, "validityDays": 30, "signatureHash": "sha384"
+		}`)}, &DigiCert{
+			client: newClient("https://digicert.example.com", "key"),
+			options: Options{
+				APIKey: "key", OrganizationID: 1234, Product: "private_ssl_plus",
+				ProvisionerProducts: map[string]string{"acme": "ssl_basic"},
+				ValidityDays:        30, SignatureHash: "sha384",
+			},
+		}, false},
+		{"fail config", apiv1.Options{Config: json.RawMessage(`{`)}, nil, true},
+		{"fail apiKey", apiv1.Options{Config: json.RawMessage(`{}`)}, nil, true},
+		{"fail validityDays", apiv1.Options{Config: json.RawMessage(`{"apiKey":"key","validityDays":-1}`)}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := New(context.Background(), tt.opts)
+			if tt.wantErr {
+				assert.Error(t, err)
+				assert.Nil(t, got)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_init(t *testing.T) {
+	fn, ok := apiv1.LoadCertificateAuthorityServiceNewFunc(apiv1.DigiCertCAS)
+	require.True(t, ok)
+	cas, err := fn(context.Background(), apiv1.Options{Config: json.RawMessage(`{"apiKey":"key"}`)})
+	require.NoError(t, err)
+	assert.IsType(t, &DigiCert{}, cas)
+}
+
+func TestDigiCert_CreateCertificate(t *testing.T) {
+	tmp := pollInterval
+	pollInterval = time.Millisecond
+	t.Cleanup(func() { pollInterval = tmp })
+
+	srv, baseURL := newTestServer(t)
+	c := mustDigiCert(t, baseURL, Options{
+		OrganizationID: 1234,
+		ProvisionerProducts: map[string]string{
+			"private": "private_ssl_plus",
+			"fail":    "fail",
+		},
+	})
+
+	t.Run("ok", func(t *testing.T) {
+		cr := mustCertificateRequest(t, "test.example.com", "test.example.com", "www.example.com")
+		resp, err := c.CreateCertificate(&apiv1.CreateCertificateRequest{
+			CSR:      cr,
+			Lifetime: 36 * time.Hour,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, cr.PublicKey, resp.Certificate.PublicKey)
+		assert.Equal(t, []*x509.Certificate{srv.ca.Intermediate}, resp.CertificateChain)
+		assert.Equal(t, orderCertificate{
+			CommonName:    "test.example.com",
+			DNSNames:      []string{"test.example.com", "www.example.com"},
+			CSR:           string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: cr.Raw})),
+			SignatureHash: "sha256",
+		}, srv.last.Certificate)
+		assert.Equal(t, &orderOrganization{ID: 1234}, srv.last.Organization)
+		assert.Equal(t, orderValidity{Days: 2}, srv.last.OrderValidity)
+		assert.True(t, srv.last.SkipApproval)
+	})
+
+	t.Run("ok pending", func(t *testing.T) {
+		cr := mustCertificateRequest(t, "", "private.example.com")
+		resp, err := c.CreateCertificate(&apiv1.CreateCertificateRequest{
+			CSR:         cr,
+			Lifetime:    time.Hour,
+			Provisioner: &apiv1.ProvisionerInfo{Name: "private"},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, cr.PublicKey, resp.Certificate.PublicKey)
+		assert.Equal(t, []*x509.Certificate{srv.ca.Intermediate}, resp.CertificateChain)
+		assert.Equal(t, "private.example.com", srv.last.Certificate.CommonName)
+		assert.Equal(t, orderValidity{Days: 1}, srv.last.OrderValidity)
+	})
+
+	t.Run("fail csr", func(t *testing.T) {
+		_, err := c.CreateCertificate(&apiv1.CreateCertificateRequest{Lifetime: time.Hour})
+		assert.Error(t, err)
+	})
+
+	t.Run("fail lifetime", func(t *testing.T) {
+		_, err := c.CreateCertificate(&apiv1.CreateCertificateRequest{CSR: mustCertificateRequest(t, "test.example.com")})
+		assert.Error(t, err)
+	})
+
+	t.Run("fail common name", func(t *testing.T) {
+		_, err := c.CreateCertificate(&apiv1.CreateCertificateRequest{CSR: mustCertificateRequest(t, ""), Lifetime: time.Hour})
+		assert.Error(t, err)
+	})
+
+	t.Run("fail order", func(t *testing.T) {
+		_, err := c.CreateCertificate(&apiv1.CreateCertificateRequest{
+			CSR:         mustCertificateRequest(t, "test.example.com"),
+			Lifetime:    time.Hour,
+			Provisioner: &apiv1.ProvisionerInfo{Name: "fail"},
+		})
+		assert.ErrorContains(t, err, "invalid product")
+	})
+
+	t.Run("fail api key", func(t *testing.T) {
+		c := mustDigiCert(t, baseURL, Options{APIKey: "bad-key"})
+		_, err := c.CreateCertificate(&apiv1.CreateCertificateRequest{
+			CSR:      mustCertificateRequest(t, "test.example.com"),
+			Lifetime: time.Hour,
+		})
+		assert.ErrorContains(t, err, "status code 401")
+	})
+}
+
+func TestDigiCert_GetPendingCertificate(t *testing.T) {
+	srv, baseURL := newTestServer(t)
+	c := mustDigiCert(t, baseURL, Options{
+		AsyncIssuance: true,
+		ProvisionerProducts: map[string]string{
+			"private": "private_ssl_plus",
+		},
+	})
+
+	t.Run("ok", func(t *testing.T) {
+		cr := mustCertificateRequest(t, "private.example.com")
+		_, err := c.CreateCertificate(&apiv1.CreateCertificateRequest{
+			CSR:         cr,
+			Lifetime:    time.Hour,
+			Provisioner: &apiv1.ProvisionerInfo{Name: "private"},
+		})
+		var pe apiv1.PendingCertificateError
+		require.ErrorAs(t, err, &pe)
+		assert.NotEmpty(t, pe.ID)
+		assert.Equal(t, retryAfter, pe.RetryAfter)
+
+		resp, err := c.GetPendingCertificate(&apiv1.GetPendingCertificateRequest{ID: pe.ID})
+		require.NoError(t, err)
+		assert.Equal(t, cr.PublicKey, resp.Certificate.PublicKey)
+		assert.Equal(t, []*x509.Certificate{srv.ca.Intermediate}, resp.CertificateChain)
+	})
+
+	t.Run("ok issued", func(t *testing.T) {
+		cr := mustCertificateRequest(t, "test.example.com")
+		resp, err := c.CreateCertificate(&apiv1.CreateCertificateRequest{
+			CSR:      cr,
+			Lifetime: time.Hour,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, cr.PublicKey, resp.Certificate.PublicKey)
+	})
+
+	t.Run("fail id", func(t *testing.T) {
+		_, err := c.GetPendingCertificate(&apiv1.GetPendingCertificateRequest{ID: "not-a-number"})
+		assert.ErrorAs(t, err, &apiv1.ValidationError{})
+	})
+
+	t.Run("fail not found", func(t *testing.T) {
+		_, err := c.GetPendingCertificate(&apiv1.GetPendingCertificateRequest{ID: "1000"})
+		assert.ErrorContains(t, err, "status code 404")
+	})
+}
+
+func TestDigiCert_RenewCertificate(t *testing.T) {
+	srv, baseURL := newTestServer(t)
+	c := mustDigiCert(t, baseURL, Options{ValidityDays: 90})
+
+	cr := mustCertificateRequest(t, "test.example.com", "test.example.com")
+	resp, err := c.RenewCertificate(&apiv1.RenewCertificateRequest{
+		CSR:      cr,
+		Lifetime: time.Hour,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, cr.PublicKey, resp.Certificate.PublicKey)
+	assert.Equal(t, orderValidity{Days: 90}, srv.last.OrderValidity)
+
+	_, err = c.RenewCertificate(&apiv1.RenewCertificateRequest{Lifetime: time.Hour})
+	assert.Equal(t, apiv1.NotImplementedError{Message: "digicert does not support renewals without a certificate request"}, err)
+	_, err = c.RenewCertificate(&apiv1.RenewCertificateRequest{CSR: cr})
+	assert.Error(t, err)
+}
+
+func TestDigiCert_RevokeCertificate(t *testing.T) {
+	srv, baseURL := newTestServer(t)
+	c := mustDigiCert(t, baseURL, Options{})
+
+	resp, err := c.CreateCertificate(&apiv1.CreateCertificateRequest{
+		CSR:      mustCertificateRequest(t, "test.example.com", "test.example.com"),
+		Lifetime: time.Hour,
+	})
+	require.NoError(t, err)
+	cert := resp.Certificate
+
+	tests := []struct {
+		name    string
+		req     *apiv1.RevokeCertificateRequest
+		want    *revokeRequest
+		wantErr bool
+	}{
+		{"ok", &apiv1.RevokeCertificateRequest{
+			Certificate: cert, ReasonCode: 1, Reason: "key compromise",
+		}, &revokeRequest{Reason: "key_compromise", Comments: "key compromise"}, false},
+		{"ok serial number", &apiv1.RevokeCertificateRequest{
+			SerialNumber: cert.SerialNumber.String(), ReasonCode: 4,
+		}, &revokeRequest{Reason: "superseded"}, false},
+		{"fail reason code", &apiv1.RevokeCertificateRequest{Certificate: cert, ReasonCode: 6}, nil, true},
+		{"fail empty", &apiv1.RevokeCertificateRequest{}, nil, true},
+		{"fail serial number", &apiv1.RevokeCertificateRequest{SerialNumber: "foo"}, nil, true},
+		{"fail not found", &apiv1.RevokeCertificateRequest{SerialNumber: "1234"}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := c.RevokeCertificate(tt.req)
+			if tt.wantErr {
+				assert.Error(t, err)
+				assert.Nil(t, got)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.req.Certificate, got.Certificate)
+			assert.Equal(t, tt.want, srv.revoke[101])
+		})
+	}
+}
+
+func Test_parseCertificateChain(t *testing.T) {
+	srv, _ := newTestServer(t)
+	cr := mustCertificateRequest(t, "test.example.com", "test.example.com")
+	cert, err := srv.ca.SignCSR(cr)
+	require.NoError(t, err)
+
+	got, chain, err := parseCertificateChain([]byte(srv.pemAll(cert)))
+	require.NoError(t, err)
+	assert.Equal(t, cert, got)
+	assert.Equal(t, []*x509.Certificate{srv.ca.Intermediate}, chain)
+
+	_, _, err = parseCertificateChain([]byte("foo"))
+	assert.Error(t, err)
+	_, _, err = parseCertificateChain(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: []byte("foo")}))
+	assert.Error(t, err)
+}
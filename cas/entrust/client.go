@@ -0,0 +1,133 @@
+package entrust
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// client is a minimal client of the Entrust CA Gateway API. The client
+// authenticates using the TLS client certificate configured in the
+// http.Client.
+type client struct {
+	caURL      string
+	httpClient *http.Client
+}
+
+// enrollmentRequest is the body of the enrollment request.
+type enrollmentRequest struct {
+	ProfileID                         string                             `json:"profileId"`
+	RequiredFormat                    requiredFormat                     `json:"requiredFormat"`
+	CSR                               string                             `json:"csr"`
+	OptionalCertificateRequestDetails *optionalCertificateRequestDetails `json:"optionalCertificateRequestDetails,omitempty"`
+}
+
+type requiredFormat struct {
+	Format string `json:"format"`
+}
+
+type optionalCertificateRequestDetails struct {
+	// ValidityPeriod is an ISO 8601 time interval, e.g.
+	// "2024-01-01T00:00:00Z/2024-01-02T00:00:00Z".
+	ValidityPeriod string `json:"validityPeriod,omitempty"`
+}
+
+// enrollmentResponse is the response of the enrollment request. The body and
+// the chain are base64 encoded DER certificates or PEM certificates.
+type enrollmentResponse struct {
+	Enrollment struct {
+		ID           string   `json:"id"`
+		SerialNumber string   `json:"serialNumber"`
+		Body         string   `json:"body"`
+		Chain        []string `json:"chain"`
+	} `json:"enrollment"`
+}
+
+// actionRequest is the body of a certificate action like a revocation.
+type actionRequest struct {
+	Type    string `json:"type"`
+	Action  string `json:"action"`
+	Reason  string `json:"reason,omitempty"`
+	Comment string `json:"comment,omitempty"`
+}
+
+// apiError is the error returned by the CA Gateway API.
+type apiError struct {
+	StatusCode int
+	Message    string `json:"message"`
+	Errors     []struct {
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+func (e *apiError) Error() string {
+	msgs := make([]string, 0, len(e.Errors)+1)
+	if e.Message != "" {
+		msgs = append(msgs, e.Message)
+	}
+	for _, err := range e.Errors {
+		msgs = append(msgs, err.Message)
+	}
+	if len(msgs) == 0 {
+		return fmt.Sprintf("entrust request failed with status code %d", e.StatusCode)
+	}
+	return fmt.Sprintf("entrust request failed with status code %d: %s", e.StatusCode, strings.Join(msgs, ", "))
+}
+
+// Enroll requests a new certificate.
+func (c *client) Enroll(ctx context.Context, req *enrollmentRequest) (*enrollmentResponse, error) {
+	resp := new(enrollmentResponse)
+	if err := c.do(ctx, http.MethodPost, "/enrollments", req, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// Revoke revokes the certificate with the given serial number.
+func (c *client) Revoke(ctx context.Context, serialNumber string, req *actionRequest) error {
+	return c.do(ctx, http.MethodPost, "/certificates/"+url.PathEscape(serialNumber)+"/actions", req, nil)
+}
+
+func (c *client) do(ctx context.Context, method, path string, in, out any) error {
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return fmt.Errorf("error marshaling request: %w", err)
+		}
+		body = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.caURL+path, body)
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("entrust %s %s failed: %w", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		e := &apiError{StatusCode: resp.StatusCode}
+		_ = json.NewDecoder(resp.Body).Decode(e)
+		return e
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("error decoding response: %w", err)
+	}
+	return nil
+}
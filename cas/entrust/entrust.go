@@ -0,0 +1,292 @@
+package entrust
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/smallstep/certificates/cas/apiv1"
+)
+
+func init() {
+	apiv1.Register(apiv1.EntrustCAS, func(ctx context.Context, opts apiv1.Options) (apiv1.CertificateAuthorityService, error) {
+		return New(ctx, opts)
+	})
+}
+
+var now = time.Now
+
+// Options are the Entrust options, they are set in the config property of the
+// CAS options.
+type Options struct {
+	// Certificate and Key are the paths to the PEM encoded client certificate
+	// and key used to authenticate to the CA Gateway.
+	Certificate string `json:"crt"`
+	Key         string `json:"key"`
+	// Root is the path to a PEM bundle used to verify the TLS connection to
+	// the CA Gateway. If empty, the system roots are used.
+	Root string `json:"root,omitempty"`
+	// Profile is the id of the certificate profile used by default.
+	Profile string `json:"profile"`
+	// ProvisionerProfiles maps provisioner names to the certificate profile
+	// used to issue certificates authorized by them.
+	ProvisionerProfiles map[string]string `json:"provisionerProfiles,omitempty"`
+}
+
+// revocationReasonMap maps revocation reason codes from RFC 5280 to the
+// revocation reasons supported by the CA Gateway. Reason 8 (removeFromCRL)
+// is not supported.
+var revocationReasonMap = map[int]string{
+	0:  "unspecified",
+	1:  "keyCompromise",
+	2:  "caCompromise",
+	3:  "affiliationChanged",
+	4:  "superseded",
+	5:  "cessationOfOperation",
+	6:  "certificateHold",
+	9:  "privilegeWithdrawn",
+	10: "aACompromise",
+}
+
+// Entrust implements a CertificateAuthorityService using the Entrust CA
+// Gateway.
+type Entrust struct {
+	client  *client
+	options Options
+}
+
+// New creates a new CertificateAuthorityService implementation using the
+// Entrust CA Gateway. The certificate authority must be the URL of the CA in
+// the gateway, e.g.
+// https://gateway.example.com/cagw/v1/certificate-authorities/<id>.
+func New(_ context.Context, opts apiv1.Options) (*Entrust, error) {
+	if opts.CertificateAuthority == "" {
+		return nil, errors.New("entrust 'certificateAuthority' cannot be empty")
+	}
+	u, err := url.Parse(opts.CertificateAuthority)
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		return nil, errors.New("entrust 'certificateAuthority' is not a valid https URL")
+	}
+
+	var o Options
+	if opts.Config != nil {
+		if err := json.Unmarshal(opts.Config, &o); err != nil {
+			return nil, fmt.Errorf("error decoding entrust config: %w", err)
+		}
+	}
+	switch {
+	case o.Certificate == "":
+		return nil, errors.New("entrust 'crt' cannot be empty")
+	case o.Key == "":
+		return nil, errors.New("entrust 'key' cannot be empty")
+	case o.Profile == "":
+		return nil, errors.New("entrust 'profile' cannot be empty")
+	}
+
+	cert, err := tls.LoadX509KeyPair(o.Certificate, o.Key)
+	if err != nil {
+		return nil, fmt.Errorf("error reading entrust client certificate: %w", err)
+	}
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if o.Root != "" {
+		b, err := os.ReadFile(o.Root)
+		if err != nil {
+			return nil, fmt.Errorf("error reading entrust root: %w", err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(b) {
+			return nil, errors.New("error reading entrust root: no certificates found")
+		}
+	}
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	tr.TLSClientConfig = tlsConfig
+
+	return &Entrust{
+		client: &client{
+			caURL: strings.TrimRight(opts.CertificateAuthority, "/"),
+			httpClient: &http.Client{
+				Transport: tr,
+				Timeout:   30 * time.Second,
+			},
+		},
+		options: o,
+	}, nil
+}
+
+// Type returns the type of this CertificateAuthorityService.
+func (c *Entrust) Type() apiv1.Type {
+	return apiv1.EntrustCAS
+}
+
+// CreateCertificate signs a new certificate using the profile configured for
+// the provisioner.
+func (c *Entrust) CreateCertificate(req *apiv1.CreateCertificateRequest) (*apiv1.CreateCertificateResponse, error) {
+	switch {
+	case req.CSR == nil:
+		return nil, errors.New("createCertificateRequest `csr` cannot be nil")
+	case req.Lifetime == 0:
+		return nil, errors.New("createCertificateRequest `lifetime` cannot be 0")
+	}
+
+	cert, chain, err := c.createCertificate(req.CSR, req.Lifetime, req.Backdate, c.profile(req.Provisioner))
+	if err != nil {
+		return nil, err
+	}
+
+	return &apiv1.CreateCertificateResponse{
+		Certificate:      cert,
+		CertificateChain: chain,
+	}, nil
+}
+
+// RenewCertificate signs the CSR in the request using the default profile.
+// The CA Gateway only signs certificate requests, so renewals without a CSR
+// will return a non-implemented error.
+func (c *Entrust) RenewCertificate(req *apiv1.RenewCertificateRequest) (*apiv1.RenewCertificateResponse, error) {
+	switch {
+	case req.CSR == nil:
+		return nil, apiv1.NotImplementedError{Message: "entrust does not support renewals without a certificate request"}
+	case req.Lifetime == 0:
+		return nil, errors.New("renewCertificateRequest `lifetime` cannot be 0")
+	}
+
+	cert, chain, err := c.createCertificate(req.CSR, req.Lifetime, req.Backdate, c.profile(nil))
+	if err != nil {
+		return nil, err
+	}
+
+	return &apiv1.RenewCertificateResponse{
+		Certificate:      cert,
+		CertificateChain: chain,
+	}, nil
+}
+
+// RevokeCertificate revokes a certificate using the CA Gateway.
+func (c *Entrust) RevokeCertificate(req *apiv1.RevokeCertificateRequest) (*apiv1.RevokeCertificateResponse, error) {
+	reason, ok := revocationReasonMap[req.ReasonCode]
+	switch {
+	case !ok:
+		return nil, fmt.Errorf("revokeCertificateRequest 'reasonCode=%d' is invalid or not supported", req.ReasonCode)
+	case req.SerialNumber == "" && req.Certificate == nil:
+		return nil, errors.New("revokeCertificateRequest `serialNumber` or `certificate` are required")
+	}
+
+	var sn *big.Int
+	if req.Certificate != nil {
+		sn = req.Certificate.SerialNumber
+	} else if sn, ok = new(big.Int).SetString(req.SerialNumber, 10); !ok {
+		return nil, fmt.Errorf("error parsing serialNumber: %v cannot be converted to big.Int", req.SerialNumber)
+	}
+
+	ctx, cancel := defaultContext()
+	defer cancel()
+
+	if err := c.client.Revoke(ctx, hex.EncodeToString(sn.Bytes()), &actionRequest{
+		Type:    "RevokeAction",
+		Action:  "Revoke",
+		Reason:  reason,
+		Comment: req.Reason,
+	}); err != nil {
+		return nil, fmt.Errorf("entrust Revoke failed: %w", err)
+	}
+
+	return &apiv1.RevokeCertificateResponse{
+		Certificate: req.Certificate,
+	}, nil
+}
+
+// profile returns the certificate profile used for the given provisioner.
+func (c *Entrust) profile(p *apiv1.ProvisionerInfo) string {
+	if p != nil {
+		if profile, ok := c.options.ProvisionerProfiles[p.Name]; ok {
+			return profile
+		}
+	}
+	return c.options.Profile
+}
+
+func (c *Entrust) createCertificate(cr *x509.CertificateRequest, lifetime, backdate time.Duration, profile string) (*x509.Certificate, []*x509.Certificate, error) {
+	t := now().UTC().Truncate(time.Second)
+	notBefore, notAfter := t.Add(-backdate), t.Add(lifetime)
+
+	ctx, cancel := defaultContext()
+	defer cancel()
+
+	resp, err := c.client.Enroll(ctx, &enrollmentRequest{
+		ProfileID:      profile,
+		RequiredFormat: requiredFormat{Format: "X509"},
+		CSR: string(pem.EncodeToMemory(&pem.Block{
+			Type:  "CERTIFICATE REQUEST",
+			Bytes: cr.Raw,
+		})),
+		OptionalCertificateRequestDetails: &optionalCertificateRequestDetails{
+			ValidityPeriod: notBefore.Format(time.RFC3339) + "/" + notAfter.Format(time.RFC3339),
+		},
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("entrust Enroll failed: %w", err)
+	}
+
+	cert, err := parseCertificate(resp.Enrollment.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+	var chain []*x509.Certificate
+	for _, s := range resp.Enrollment.Chain {
+		crt, err := parseCertificate(s)
+		if err != nil {
+			return nil, nil, err
+		}
+		// The root certificate is not part of the chain.
+		if !isRoot(crt) {
+			chain = append(chain, crt)
+		}
+	}
+
+	return cert, chain, nil
+}
+
+// parseCertificate parses a PEM or a base64 encoded DER certificate.
+func parseCertificate(s string) (*x509.Certificate, error) {
+	var der []byte
+	if block, _ := pem.Decode([]byte(s)); block != nil {
+		der = block.Bytes
+	} else {
+		var err error
+		if der, err = base64.StdEncoding.DecodeString(s); err != nil {
+			return nil, fmt.Errorf("error decoding certificate: %w", err)
+		}
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing certificate: %w", err)
+	}
+	return cert, nil
+}
+
+// isRoot returns true if the given certificate is a root certificate.
+func isRoot(cert *x509.Certificate) bool {
+	if cert.BasicConstraintsValid && cert.IsCA {
+		return cert.CheckSignatureFrom(cert) == nil
+	}
+	return false
+}
+
+func defaultContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), 60*time.Second)
+}
@@ -0,0 +1,437 @@
+package entrust
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.step.sm/crypto/keyutil"
+	"go.step.sm/crypto/minica"
+	"go.step.sm/crypto/pemutil"
+	"go.step.sm/crypto/x509util"
+
+	"github.com/smallstep/certificates/cas/apiv1"
+)
+
+const testCAPath = "/cagw/v1/certificate-authorities/CA-1"
+
+// testServer is a fake CA Gateway. Enrollments with the "fail" profile
+// return an error.
+type testServer struct {
+	ca     *minica.CA
+	mu     sync.Mutex
+	last   *enrollmentRequest
+	revoke map[string]*actionRequest
+}
+
+type testFiles struct {
+	URL  string
+	Root string
+	Crt  string
+	Key  string
+}
+
+// newTestServer starts a TLS server that requires client certificates and
+// writes the client certificate, key and root used to connect to it.
+func newTestServer(t *testing.T) (*testServer, *testFiles) {
+	t.Helper()
+	ca, err := minica.New()
+	require.NoError(t, err)
+	clientCA, err := minica.New(minica.WithName("Client"))
+	require.NoError(t, err)
+
+	s := &testServer{
+		ca:     ca,
+		revoke: make(map[string]*actionRequest),
+	}
+	srv := httptest.NewUnstartedServer(s)
+	srv.TLS = &tls.Config{
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		ClientCAs:  x509.NewCertPool(),
+		MinVersion: tls.VersionTLS12,
+	}
+	srv.TLS.ClientCAs.AddCert(clientCA.Root)
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+
+	dir := t.TempDir()
+	files := &testFiles{
+		URL:  srv.URL + testCAPath,
+		Root: filepath.Join(dir, "root.crt"),
+		Crt:  filepath.Join(dir, "client.crt"),
+		Key:  filepath.Join(dir, "client.key"),
+	}
+	require.NoError(t, os.WriteFile(files.Root, pem.EncodeToMemory(&pem.Block{
+		Type: "CERTIFICATE", Bytes: srv.Certificate().Raw,
+	}), 0600))
+
+	signer, err := keyutil.GenerateDefaultSigner()
+	require.NoError(t, err)
+	cert, err := clientCA.Sign(&x509.Certificate{
+		Subject:     clientCA.Intermediate.Subject,
+		PublicKey:   signer.Public(),
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(files.Crt, append(
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}),
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: clientCA.Intermediate.Raw})...,
+	), 0600))
+	_, err = pemutil.Serialize(signer, pemutil.ToFile(files.Key, 0600))
+	require.NoError(t, err)
+
+	return s, files
+}
+
+func (s *testServer) writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func (s *testServer) writeError(w http.ResponseWriter, code int, msg string) {
+	s.writeJSON(w, code, map[string]any{
+		"type":    "ErrorResponse",
+		"message": msg,
+	})
+}
+
+func (s *testServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	path, ok := strings.CutPrefix(r.URL.Path, testCAPath)
+	if !ok {
+		s.writeError(w, http.StatusNotFound, "certificate authority not found")
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodPost && path == "/enrollments":
+		req := new(enrollmentRequest)
+		if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+			s.writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		s.last = req
+		if req.ProfileID == "fail" {
+			s.writeError(w, http.StatusBadRequest, "invalid profile")
+			return
+		}
+		block, _ := pem.Decode([]byte(req.CSR))
+		if block == nil {
+			s.writeError(w, http.StatusBadRequest, "invalid csr")
+			return
+		}
+		csr, err := x509.ParseCertificateRequest(block.Bytes)
+		if err != nil {
+			s.writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		var notBefore, notAfter time.Time
+		if req.OptionalCertificateRequestDetails != nil {
+			nb, na, _ := strings.Cut(req.OptionalCertificateRequestDetails.ValidityPeriod, "/")
+			notBefore, _ = time.Parse(time.RFC3339, nb)
+			notAfter, _ = time.Parse(time.RFC3339, na)
+		}
+		cert, err := s.ca.SignCSR(csr, minica.WithModifyFunc(func(c *x509.Certificate) error {
+			if !notBefore.IsZero() && !notAfter.IsZero() {
+				c.NotBefore, c.NotAfter = notBefore, notAfter
+			}
+			return nil
+		}))
+		if err != nil {
+			s.writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		var resp enrollmentResponse
+		resp.Enrollment.SerialNumber = hex.EncodeToString(cert.SerialNumber.Bytes())
+		resp.Enrollment.Body = base64.StdEncoding.EncodeToString(cert.Raw)
+		resp.Enrollment.Chain = []string{
+			string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: s.ca.Intermediate.Raw})),
+			base64.StdEncoding.EncodeToString(s.ca.Root.Raw),
+		}
+		s.writeJSON(w, http.StatusCreated, resp)
+	case r.Method == http.MethodPost && strings.HasPrefix(path, "/certificates/") && strings.HasSuffix(path, "/actions"):
+		sn := strings.TrimSuffix(strings.TrimPrefix(path, "/certificates/"), "/actions")
+		if sn == "01" {
+			s.writeError(w, http.StatusNotFound, "certificate not found")
+			return
+		}
+		req := new(actionRequest)
+		if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+			s.writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		s.revoke[sn] = req
+		s.writeJSON(w, http.StatusOK, map[string]string{"type": "ActionResponse"})
+	default:
+		s.writeError(w, http.StatusNotFound, "not found")
+	}
+}
+
+func mustCertificateRequest(t *testing.T, cn string, sans ...string) *x509.CertificateRequest {
+	t.Helper()
+	signer, err := keyutil.GenerateDefaultSigner()
+	require.NoError(t, err)
+	cr, err := x509util.CreateCertificateRequest(cn, sans, signer)
+	require.NoError(t, err)
+	return cr
+}
+
+func mustEntrust(t *testing.T, files *testFiles, o Options) *Entrust {
+	t.Helper()
+	o.Certificate = files.Crt
+	o.Key = files.Key
+	o.Root = files.Root
+	if o.Profile == "" {
+		o.Profile = "profile"
+	}
+	config, err := json.Marshal(o)
+	require.NoError(t, err)
+	c, err := New(context.Background(), apiv1.Options{
+		Type:                 apiv1.EntrustCAS,
+		CertificateAuthority: files.URL,
+		Config:               config,
+	})
+	require.NoError(t, err)
+	return c
+}
+
+func TestNew(t *testing.T) {
+	_, files := newTestServer(t)
+	config := func(o map[string]any) json.RawMessage {
+		b, err := json.Marshal(o)
+		require.NoError(t, err)
+		return b
+	}
+	ok := map[string]any{"crt": files.Crt, "key": files.Key, "root": files.Root, "profile": "profile"}
+	without := func(key string) json.RawMessage {
+		o := make(map[string]any, len(ok))
+		for k, v := range ok {
+			if k != key {
+				o[k] = v
+			}
+		}
+		return config(o)
+	}
+	with := func(key string, value any) json.RawMessage {
+		o := make(map[string]any, len(ok))
+		for k, v := range ok {
+			o[k] = v
+		}
+		o[key] = value
+		return config(o)
+	}
+
+	tests := []struct {
+		name    string
+		opts    apiv1.Options
+		want    Options
+		wantErr bool
+	}{
+		{"ok", apiv1.Options{CertificateAuthority: files.URL, Config: config(ok)}, Options{
+			Certificate: files.Crt, Key: files.Key, Root: files.Root, Profile: "profile",
+		}, false},
+		{"ok provisioner profiles", apiv1.Options{CertificateAuthority: files.URL, Config: with("provisionerProfiles", map[string]string{"acme": "acme-profile"})}, Options{
+			Certificate: files.Crt, Key: files.Key, Root: files.Root, Profile: "profile",
+			ProvisionerProfiles: map[string]string{"acme": "acme-profile"},
+		}, false},
+		{"ok without root", apiv1.Options{CertificateAuthority: files.URL, Config: without("root")}, Options{
+			Certificate: files.Crt, Key: files.Key, Profile: "profile",
+		}, false},
+		{"fail certificateAuthority", apiv1.Options{Config: config(ok)}, Options{}, true},
+		{"fail certificateAuthority http", apiv1.Options{CertificateAuthority: "http://gateway.example.com", Config: config(ok)}, Options{}, true},
+		{"fail config", apiv1.Options{CertificateAuthority: files.URL, Config: json.RawMessage(`{`)}, Options{}, true},
+		{"fail crt", apiv1.Options{CertificateAuthority: files.URL, Config: without("crt")}, Options{}, true},
+		{"fail key", apiv1.Options{CertificateAuthority: files.URL, Config: without("key")}, Options{}, true},
+		{"fail profile", apiv1.Options{CertificateAuthority: files.URL, Config: without("profile")}, Options{}, true},
+		{"fail key pair", apiv1.Options{CertificateAuthority: files.URL, Config: with("key", files.Root)}, Options{}, true},
+		{"fail root missing", apiv1.Options{CertificateAuthority: files.URL, Config: with("root", "missing.crt")}, Options{}, true},
+		{"fail root empty", apiv1.Options{CertificateAuthority: files.URL, Config: with("root", files.Key)}, Options{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := New(context.Background(), tt.opts)
+			if tt.wantErr {
+				assert.Error(t, err)
+				assert.Nil(t, got)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got.options)
+			assert.Equal(t, files.URL, got.client.caURL)
+		})
+	}
+}
+
+func Test_init(t *testing.T) {
+	_, files := newTestServer(t)
+	fn, ok := apiv1.LoadCertificateAuthorityServiceNewFunc(apiv1.EntrustCAS)
+	require.True(t, ok)
+	cas, err := fn(context.Background(), apiv1.Options{
+		CertificateAuthority: files.URL,
+		Config:               json.RawMessage(`{"crt":"` + files.Crt + `","key":"` + files.Key + `","profile":"profile"}`),
+	})
+	require.NoError(t, err)
+	assert.IsType(t, &Entrust{}, cas)
+}
+
+func TestEntrust_CreateCertificate(t *testing.T) {
+	tmp := now
+	t.Cleanup(func() { now = tmp })
+	now = func() time.Time {
+		return time.Date(2024, 1, 2, 3, 4, 5, 6, time.UTC)
+	}
+
+	srv, files := newTestServer(t)
+	c := mustEntrust(t, files, Options{
+		ProvisionerProfiles: map[string]string{
+			"acme": "acme-profile",
+			"fail": "fail",
+		},
+	})
+
+	t.Run("ok", func(t *testing.T) {
+		cr := mustCertificateRequest(t, "test.example.com", "test.example.com")
+		resp, err := c.CreateCertificate(&apiv1.CreateCertificateRequest{
+			CSR:      cr,
+			Lifetime: 24 * time.Hour,
+			Backdate: time.Minute,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, cr.PublicKey, resp.Certificate.PublicKey)
+		assert.Equal(t, time.Date(2024, 1, 2, 3, 3, 5, 0, time.UTC), resp.Certificate.NotBefore)
+		assert.Equal(t, time.Date(2024, 1, 3, 3, 4, 5, 0, time.UTC), resp.Certificate.NotAfter)
+		assert.Equal(t, []*x509.Certificate{srv.ca.Intermediate}, resp.CertificateChain)
+		assert.Equal(t, &enrollmentRequest{
+			ProfileID:      "profile",
+			RequiredFormat: requiredFormat{Format: "X509"},
+			CSR:            string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: cr.Raw})),
+			OptionalCertificateRequestDetails: &optionalCertificateRequestDetails{
+				ValidityPeriod: "2024-01-02T03:03:05Z/2024-01-03T03:04:05Z",
+			},
+		}, srv.last)
+	})
+
+	t.Run("ok provisioner profile", func(t *testing.T) {
+		_, err := c.CreateCertificate(&apiv1.CreateCertificateRequest{
+			CSR:         mustCertificateRequest(t, "test.example.com"),
+			Lifetime:    time.Hour,
+			Provisioner: &apiv1.ProvisionerInfo{Name: "acme"},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "acme-profile", srv.last.ProfileID)
+	})
+
+	t.Run("fail csr", func(t *testing.T) {
+		_, err := c.CreateCertificate(&apiv1.CreateCertificateRequest{Lifetime: time.Hour})
+		assert.Error(t, err)
+	})
+
+	t.Run("fail lifetime", func(t *testing.T) {
+		_, err := c.CreateCertificate(&apiv1.CreateCertificateRequest{CSR: mustCertificateRequest(t, "test.example.com")})
+		assert.Error(t, err)
+	})
+
+	t.Run("fail enroll", func(t *testing.T) {
+		_, err := c.CreateCertificate(&apiv1.CreateCertificateRequest{
+			CSR:         mustCertificateRequest(t, "test.example.com"),
+			Lifetime:    time.Hour,
+			Provisioner: &apiv1.ProvisionerInfo{Name: "fail"},
+		})
+		assert.ErrorContains(t, err, "invalid profile")
+	})
+
+	t.Run("fail client certificate", func(t *testing.T) {
+		_, other := newTestServer(t)
+		c := mustEntrust(t, &testFiles{
+			URL: files.URL, Root: files.Root, Crt: other.Crt, Key: other.Key,
+		}, Options{})
+		_, err := c.CreateCertificate(&apiv1.CreateCertificateRequest{
+			CSR:      mustCertificateRequest(t, "test.example.com"),
+			Lifetime: time.Hour,
+		})
+		assert.Error(t, err)
+	})
+}
+
+func TestEntrust_RenewCertificate(t *testing.T) {
+	srv, files := newTestServer(t)
+	c := mustEntrust(t, files, Options{
+		ProvisionerProfiles: map[string]string{"acme": "acme-profile"},
+	})
+
+	cr := mustCertificateRequest(t, "test.example.com", "test.example.com")
+	resp, err := c.RenewCertificate(&apiv1.RenewCertificateRequest{
+		CSR:      cr,
+		Lifetime: time.Hour,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, cr.PublicKey, resp.Certificate.PublicKey)
+	assert.Equal(t, []*x509.Certificate{srv.ca.Intermediate}, resp.CertificateChain)
+	assert.Equal(t, "profile", srv.last.ProfileID)
+
+	_, err = c.RenewCertificate(&apiv1.RenewCertificateRequest{Lifetime: time.Hour})
+	assert.Equal(t, apiv1.NotImplementedError{Message: "entrust does not support renewals without a certificate request"}, err)
+	_, err = c.RenewCertificate(&apiv1.RenewCertificateRequest{CSR: cr})
+	assert.Error(t, err)
+}
+
+func TestEntrust_RevokeCertificate(t *testing.T) {
+	srv, files := newTestServer(t)
+	c := mustEntrust(t, files, Options{})
+
+	resp, err := c.CreateCertificate(&apiv1.CreateCertificateRequest{
+		CSR:      mustCertificateRequest(t, "test.example.com", "test.example.com"),
+		Lifetime: time.Hour,
+	})
+	require.NoError(t, err)
+	cert := resp.Certificate
+	sn := hex.EncodeToString(cert.SerialNumber.Bytes())
+
+	tests := []struct {
+		name    string
+		req     *apiv1.RevokeCertificateRequest
+		want    *actionRequest
+		wantErr bool
+	}{
+		{"ok", &apiv1.RevokeCertificateRequest{
+			Certificate: cert, ReasonCode: 1, Reason: "key compromise",
+		}, &actionRequest{Type: "RevokeAction", Action: "Revoke", Reason: "keyCompromise", Comment: "key compromise"}, false},
+		{"ok serial number", &apiv1.RevokeCertificateRequest{
+			SerialNumber: cert.SerialNumber.String(), ReasonCode: 4,
+		}, &actionRequest{Type: "RevokeAction", Action: "Revoke", Reason: "superseded"}, false},
+		{"fail reason code", &apiv1.RevokeCertificateRequest{Certificate: cert, ReasonCode: 8}, nil, true},
+		{"fail empty", &apiv1.RevokeCertificateRequest{}, nil, true},
+		{"fail serial number", &apiv1.RevokeCertificateRequest{SerialNumber: "foo"}, nil, true},
+		{"fail not found", &apiv1.RevokeCertificateRequest{SerialNumber: "1"}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := c.RevokeCertificate(tt.req)
+			if tt.wantErr {
+				assert.Error(t, err)
+				assert.Nil(t, got)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, &apiv1.RevokeCertificateResponse{Certificate: tt.req.Certificate}, got)
+			assert.Equal(t, tt.want, srv.revoke[sn])
+		})
+	}
+}
@@ -0,0 +1,543 @@
+// The bindings are generated with protoc v28.2 (v5.28.2), and the plugins are
+// installed using the versions pinned below.
+//
+//go:generate go install google.golang.org/protobuf/cmd/protoc-gen-go@v1.34.2
+//go:generate go install google.golang.org/grpc/cmd/protoc-gen-go-grpc@v1.5.1
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative grpccas.proto
+
+package grpccas
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/smallstep/certificates/cas/apiv1"
+)
+
+func init() {
+	apiv1.Register(apiv1.GRPCCAS, func(ctx context.Context, opts apiv1.Options) (apiv1.CertificateAuthorityService, error) {
+		return New(ctx, opts)
+	})
+}
+
+const defaultTimeout = 30 * time.Second
+
+// Options defines the configuration options added using the
+// apiv1.Options.Config field.
+type Options struct {
+	// Args are the arguments passed to the plugin started with an exec URI.
+	Args []string `json:"args,omitempty"`
+	// Env are additional environment variables, in the form "key=value",
+	// passed to the plugin started with an exec URI.
+	Env []string `json:"env,omitempty"`
+	// Timeout is the maximum time to wait for a response from the plugin,
+	// e.g. "1m". Defaults to 30s.
+	Timeout string `json:"timeout,omitempty"`
+	// Root is the path to a PEM bundle used to verify the certificate of a
+	// plugin listening on a tcp URI. If empty, the system roots are used.
+	Root string `json:"root,omitempty"`
+	// Certificate and Key are the paths to the PEM encoded client certificate
+	// and key used to authenticate step-ca to a plugin listening on a tcp URI.
+	Certificate string `json:"crt,omitempty"`
+	Key         string `json:"key,omitempty"`
+	// ServerName overrides the name used to verify the certificate of the
+	// plugin. Defaults to the host in the tcp URI.
+	ServerName string `json:"serverName,omitempty"`
+}
+
+// GRPCCAS implements a CertificateAuthorityService using an external plugin
+// that implements the gRPC service defined in grpccas.proto.
+//
+// The plugin is configured using the certificateAuthority property with one
+// of the following URIs:
+//
+//   - unix:///path/to/socket connects to a plugin listening on the given unix
+//     socket.
+//   - exec:///path/to/plugin starts the given executable and connects to it
+//     using a unix socket. The path of the socket is passed to the plugin in
+//     the STEP_CAS_PLUGIN_SOCKET environment variable.
+//   - tcp://host:port connects to a remote plugin using TLS. If a client
+//     certificate is configured, step-ca authenticates to the plugin using
+//     mTLS.
+type GRPCCAS struct {
+	conn    *grpc.ClientConn
+	client  CertificateAuthorityServiceClient
+	timeout time.Duration
+	cmd     *exec.Cmd
+	tempDir string
+	once    sync.Once
+}
+
+// New creates a new CertificateAuthorityService implementation that uses a
+// gRPC plugin.
+func New(_ context.Context, opts apiv1.Options) (*GRPCCAS, error) {
+	if opts.CertificateAuthority == "" {
+		return nil, errors.New("grpcCAS 'certificateAuthority' cannot be empty")
+	}
+
+	var o Options
+	if len(opts.Config) > 0 {
+		if err := json.Unmarshal(opts.Config, &o); err != nil {
+			return nil, fmt.Errorf("error decoding grpcCAS config: %w", err)
+		}
+	}
+	timeout := defaultTimeout
+	if o.Timeout != "" {
+		d, err := time.ParseDuration(o.Timeout)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("grpcCAS 'timeout' %q is not valid", o.Timeout)
+		}
+		timeout = d
+	}
+
+	u, err := url.Parse(opts.CertificateAuthority)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing grpcCAS 'certificateAuthority': %w", err)
+	}
+
+	c := &GRPCCAS{
+		timeout: timeout,
+	}
+
+	var target string
+	creds := insecure.NewCredentials()
+	switch u.Scheme {
+	case "unix":
+		target = "unix://" + unixPath(u)
+	case "exec":
+		socket, err := c.startPlugin(unixPath(u), o)
+		if err != nil {
+			return nil, err
+		}
+		target = "unix://" + socket
+	case "tcp":
+		if u.Host == "" {
+			return nil, errors.New("grpcCAS 'certificateAuthority' host cannot be empty")
+		}
+		tlsConfig, err := newTLSConfig(o)
+		if err != nil {
+			return nil, err
+		}
+		target = "dns:///" + u.Host
+		creds = credentials.NewTLS(tlsConfig)
+	default:
+		return nil, fmt.Errorf("grpcCAS 'certificateAuthority' scheme %q is not supported", u.Scheme)
+	}
+
+	c.conn, err = grpc.NewClient(target,
+		grpc.WithTransportCredentials(creds),
+		grpc.WithDefaultCallOptions(grpc.WaitForReady(true)),
+	)
+	if err != nil {
+		c.Close()
+		return nil, fmt.Errorf("error creating grpcCAS client: %w", err)
+	}
+	c.client = NewCertificateAuthorityServiceClient(c.conn)
+
+	return c, nil
+}
+
+func unixPath(u *url.URL) string {
+	if u.Opaque != "" {
+		return u.Opaque
+	}
+	return u.Path
+}
+
+// newTLSConfig returns the TLS configuration used to connect to a plugin
+// listening on a tcp URI.
+func newTLSConfig(o Options) (*tls.Config, error) {
+	config := &tls.Config{
+		ServerName: o.ServerName,
+		MinVersion: tls.VersionTLS12,
+	}
+	if o.Root != "" {
+		b, err := os.ReadFile(o.Root)
+		if err != nil {
+			return nil, fmt.Errorf("error reading grpcCAS root: %w", err)
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(b) {
+			return nil, errors.New("error reading grpcCAS root: no certificates found")
+		}
+	}
+	switch {
+	case o.Certificate == "" && o.Key == "":
+	case o.Certificate == "":
+		return nil, errors.New("grpcCAS 'crt' cannot be empty if 'key' is set")
+	case o.Key == "":
+		return nil, errors.New("grpcCAS 'key' cannot be empty if 'crt' is set")
+	default:
+		cert, err := tls.LoadX509KeyPair(o.Certificate, o.Key)
+		if err != nil {
+			return nil, fmt.Errorf("error reading grpcCAS client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+// startPlugin starts the plugin with the given path and returns the path of
+// the unix socket it will listen on.
+func (c *GRPCCAS) startPlugin(path string, o Options) (string, error) {
+	if path == "" {
+		return "", errors.New("grpcCAS 'certificateAuthority' plugin path cannot be empty")
+	}
+	dir, err := os.MkdirTemp("", "step-cas-plugin-")
+	if err != nil {
+		return "", fmt.Errorf("error creating plugin directory: %w", err)
+	}
+	socket := filepath.Join(dir, "plugin.sock")
+
+	cmd := exec.Command(path, o.Args...) //nolint:gosec // path is configured by the operator
+	cmd.Env = append(append(os.Environ(), o.Env...), PluginSocketEnv+"="+socket)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	if err := cmd.Start(); err != nil {
+		os.RemoveAll(dir)
+		return "", fmt.Errorf("error starting plugin %s: %w", path, err)
+	}
+
+	c.cmd = cmd
+	c.tempDir = dir
+	return socket, nil
+}
+
+// Type returns the type of this CertificateAuthorityService.
+func (c *GRPCCAS) Type() apiv1.Type {
+	return apiv1.GRPCCAS
+}
+
+// Close closes the connection with the plugin and stops it if it was started
+// by step-ca.
+func (c *GRPCCAS) Close() (err error) {
+	c.once.Do(func() {
+		if c.conn != nil {
+			err = c.conn.Close()
+		}
+		if c.cmd != nil && c.cmd.Process != nil {
+			_ = c.cmd.Process.Kill()
+			_ = c.cmd.Wait()
+		}
+		if c.tempDir != "" {
+			os.RemoveAll(c.tempDir)
+		}
+	})
+	return
+}
+
+// CreateCertificate signs a new certificate using the plugin.
+func (c *GRPCCAS) CreateCertificate(req *apiv1.CreateCertificateRequest) (*apiv1.CreateCertificateResponse, error) {
+	switch {
+	case req.Template == nil:
+		return nil, errors.New("createCertificateRequest `template` cannot be nil")
+	case req.Lifetime == 0:
+		return nil, errors.New("createCertificateRequest `lifetime` cannot be 0")
+	}
+
+	template, err := marshalTemplate(req.Template)
+	if err != nil {
+		return nil, err
+	}
+	m := &CreateCertificateRequest{
+		Template:       template,
+		Lifetime:       durationpb.New(req.Lifetime),
+		Backdate:       durationpb.New(req.Backdate),
+		RequestId:      req.RequestID,
+		IsCaServerCert: req.IsCAServerCert,
+	}
+	if req.CSR != nil {
+		m.Csr = req.CSR.Raw
+	}
+	if p := req.Provisioner; p != nil {
+		m.Provisioner = &ProvisionerInfo{
+			Id:   p.ID,
+			Type: p.Type,
+			Name: p.Name,
+		}
+	}
+
+	ctx, cancel := c.context()
+	defer cancel()
+	resp, err := c.client.CreateCertificate(ctx, m)
+	if err != nil {
+		return nil, fromStatusError("CreateCertificate", err)
+	}
+	cert, chain, err := parseCertificateResponse(resp.GetCertificate(), resp.GetCertificateChain())
+	if err != nil {
+		return nil, err
+	}
+	return &apiv1.CreateCertificateResponse{
+		Certificate:      cert,
+		CertificateChain: chain,
+	}, nil
+}
+
+// RenewCertificate renews a certificate using the plugin.
+func (c *GRPCCAS) RenewCertificate(req *apiv1.RenewCertificateRequest) (*apiv1.RenewCertificateResponse, error) {
+	switch {
+	case req.Template == nil:
+		return nil, errors.New("renewCertificateRequest `template` cannot be nil")
+	case req.Lifetime == 0:
+		return nil, errors.New("renewCertificateRequest `lifetime` cannot be 0")
+	}
+
+	template, err := marshalTemplate(req.Template)
+	if err != nil {
+		return nil, err
+	}
+	m := &RenewCertificateRequest{
+		Template:  template,
+		Lifetime:  durationpb.New(req.Lifetime),
+		Backdate:  durationpb.New(req.Backdate),
+		RequestId: req.RequestID,
+		Token:     req.Token,
+	}
+	if req.CSR != nil {
+		m.Csr = req.CSR.Raw
+	}
+
+	ctx, cancel := c.context()
+	defer cancel()
+	resp, err := c.client.RenewCertificate(ctx, m)
+	if err != nil {
+		return nil, fromStatusError("RenewCertificate", err)
+	}
+	cert, chain, err := parseCertificateResponse(resp.GetCertificate(), resp.GetCertificateChain())
+	if err != nil {
+		return nil, err
+	}
+	return &apiv1.RenewCertificateResponse{
+		Certificate:      cert,
+		CertificateChain: chain,
+	}, nil
+}
+
+// RevokeCertificate revokes a certificate using the plugin.
+func (c *GRPCCAS) RevokeCertificate(req *apiv1.RevokeCertificateRequest) (*apiv1.RevokeCertificateResponse, error) {
+	if req.Certificate == nil && req.SerialNumber == "" {
+		return nil, errors.New("revokeCertificateRequest `certificate` or `serialNumber` must be set")
+	}
+
+	m := &RevokeCertificateRequest{
+		SerialNumber: req.SerialNumber,
+		Reason:       req.Reason,
+		ReasonCode:   int32(req.ReasonCode), //nolint:gosec // reason codes are small integers
+		PassiveOnly:  req.PassiveOnly,
+		RequestId:    req.RequestID,
+	}
+	if req.Certificate != nil {
+		m.Certificate = req.Certificate.Raw
+	}
+
+	ctx, cancel := c.context()
+	defer cancel()
+	resp, err := c.client.RevokeCertificate(ctx, m)
+	if err != nil {
+		return nil, fromStatusError("RevokeCertificate", err)
+	}
+	cert, chain, err := parseCertificateResponse(resp.GetCertificate(), resp.GetCertificateChain())
+	if err != nil {
+		return nil, err
+	}
+	return &apiv1.RevokeCertificateResponse{
+		Certificate:      cert,
+		CertificateChain: chain,
+	}, nil
+}
+
+// GetCertificateAuthority returns the root and intermediate certificates of
+// the certificate authority used by the plugin.
+func (c *GRPCCAS) GetCertificateAuthority(req *apiv1.GetCertificateAuthorityRequest) (*apiv1.GetCertificateAuthorityResponse, error) {
+	ctx, cancel := c.context()
+	defer cancel()
+	resp, err := c.client.GetCertificateAuthority(ctx, &GetCertificateAuthorityRequest{Name: req.Name})
+	if err != nil {
+		return nil, fromStatusError("GetCertificateAuthority", err)
+	}
+	if len(resp.GetRootCertificate()) == 0 {
+		return nil, errors.New("error getting certificate authority: root certificate is empty")
+	}
+	root, err := x509.ParseCertificate(resp.GetRootCertificate())
+	if err != nil {
+		return nil, fmt.Errorf("error parsing root certificate: %w", err)
+	}
+	intermediates, err := parseCertificates(resp.GetIntermediateCertificates())
+	if err != nil {
+		return nil, err
+	}
+	var metadata *apiv1.CertificateAuthorityMetadata
+	if md := resp.GetMetadata(); md != nil {
+		metadata = &apiv1.CertificateAuthorityMetadata{
+			NotBefore: parseTimestamp(md.GetNotBefore()),
+			NotAfter:  parseTimestamp(md.GetNotAfter()),
+			State:     md.GetState(),
+		}
+	}
+	return &apiv1.GetCertificateAuthorityResponse{
+		RootCertificate:          root,
+		IntermediateCertificates: intermediates,
+		Metadata:                 metadata,
+	}, nil
+}
+
+// CheckHealth checks the health of the plugin using the standard gRPC health
+// service. Plugins that do not implement it are considered healthy.
+func (c *GRPCCAS) CheckHealth(ctx context.Context) error {
+	resp, err := healthpb.NewHealthClient(c.conn).Check(ctx, &healthpb.HealthCheckRequest{
+		Service: serviceName,
+	})
+	if err != nil {
+		if status.Code(err) == codes.Unimplemented {
+			return nil
+		}
+		return fromStatusError("Check", err)
+	}
+	if st := resp.GetStatus(); st != healthpb.HealthCheckResponse_SERVING {
+		return fmt.Errorf("grpcCAS plugin status is %s", st)
+	}
+	return nil
+}
+
+// context returns the context used in the requests to the plugin.
+func (c *GRPCCAS) context() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), c.timeout)
+}
+
+// fromStatusError converts the gRPC errors returned by the plugin.
+func fromStatusError(method string, err error) error {
+	st, ok := status.FromError(err)
+	if !ok {
+		return fmt.Errorf("grpcCAS %s failed: %w", method, err)
+	}
+	switch st.Code() {
+	case codes.Unimplemented:
+		return apiv1.NotImplementedError{Message: st.Message()}
+	case codes.InvalidArgument:
+		return apiv1.ValidationError{Message: st.Message()}
+	default:
+		return fmt.Errorf("grpcCAS %s failed: %w", method, err)
+	}
+}
+
+// parseCertificateResponse parses the certificate and chain in the responses
+// of the CreateCertificate, RenewCertificate and RevokeCertificate methods.
+func parseCertificateResponse(der []byte, chainDER [][]byte) (*x509.Certificate, []*x509.Certificate, error) {
+	var cert *x509.Certificate
+	if len(der) > 0 {
+		var err error
+		if cert, err = x509.ParseCertificate(der); err != nil {
+			return nil, nil, fmt.Errorf("error parsing certificate: %w", err)
+		}
+	}
+	chain, err := parseCertificates(chainDER)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cert, chain, nil
+}
+
+func parseCertificates(ders [][]byte) ([]*x509.Certificate, error) {
+	certs := make([]*x509.Certificate, len(ders))
+	for i, der := range ders {
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing certificate chain: %w", err)
+		}
+		certs[i] = cert
+	}
+	return certs, nil
+}
+
+// parseTimestamp returns the time in the given google.protobuf.Timestamp, or
+// the zero time if it is not set.
+func parseTimestamp(ts *timestamppb.Timestamp) time.Time {
+	if ts == nil {
+		return time.Time{}
+	}
+	return ts.AsTime()
+}
+
+var (
+	templateKey     *ecdsa.PrivateKey
+	templateKeyErr  error
+	templateKeyOnce sync.Once
+)
+
+// marshalTemplate encodes the given template as a certificate signed with an
+// ephemeral key, so all the properties of the template can be sent to the
+// plugin.
+func marshalTemplate(template *x509.Certificate) ([]byte, error) {
+	if template.PublicKey == nil {
+		return nil, errors.New("certificate template `publicKey` cannot be nil")
+	}
+	templateKeyOnce.Do(func() {
+		templateKey, templateKeyErr = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	})
+	if templateKeyErr != nil {
+		return nil, fmt.Errorf("error generating template key: %w", templateKeyErr)
+	}
+
+	tmpl := *template
+	if tmpl.SerialNumber == nil {
+		tmpl.SerialNumber = big.NewInt(0)
+	}
+	// The signature algorithm of the template refers to the final issuer.
+	tmpl.SignatureAlgorithm = x509.UnknownSignatureAlgorithm
+
+	parent := &x509.Certificate{
+		Subject:   tmpl.Subject,
+		PublicKey: templateKey.Public(),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &tmpl, parent, template.PublicKey, templateKey)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding certificate template: %w", err)
+	}
+	return der, nil
+}
+
+// oidAuthorityKeyID is the authority key identifier extension, it depends on
+// the issuer and it is not part of the template.
+var oidAuthorityKeyID = asn1.ObjectIdentifier{2, 5, 29, 35}
+
+// unmarshalTemplate decodes a template encoded with marshalTemplate.
+func unmarshalTemplate(der []byte) (*x509.Certificate, error) {
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing certificate template: %w", err)
+	}
+	// Keep the extensions as they are in the template, this way extensions
+	// not supported by the x509 package, like otherName SANs, are preserved.
+	cert.ExtraExtensions = nil
+	for _, ext := range cert.Extensions {
+		if !ext.Id.Equal(oidAuthorityKeyID) {
+			cert.ExtraExtensions = append(cert.ExtraExtensions, ext)
+		}
+	}
+	cert.SignatureAlgorithm = x509.UnknownSignatureAlgorithm
+	return cert, nil
+}
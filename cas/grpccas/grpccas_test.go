@@ -0,0 +1,487 @@
+package grpccas
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.step.sm/crypto/keyutil"
+	"go.step.sm/crypto/minica"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+
+	"github.com/smallstep/certificates/cas/apiv1"
+)
+
+var oidCustomExtension = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 37476, 9000, 64, 1}
+
+// testCAS is a CertificateAuthorityService used as the plugin implementation.
+type testCAS struct {
+	ca          *minica.CA
+	mu          sync.Mutex
+	createReq   *apiv1.CreateCertificateRequest
+	renewReq    *apiv1.RenewCertificateRequest
+	revokeReq   *apiv1.RevokeCertificateRequest
+	createError error
+	healthError error
+}
+
+func newTestCAS(t *testing.T) *testCAS {
+	t.Helper()
+	ca, err := minica.New()
+	require.NoError(t, err)
+	return &testCAS{ca: ca}
+}
+
+func (c *testCAS) sign(template *x509.Certificate, lifetime time.Duration) (*x509.Certificate, error) {
+	template.SerialNumber = big.NewInt(1234)
+	template.NotBefore = time.Now()
+	template.NotAfter = template.NotBefore.Add(lifetime)
+	der, err := x509.CreateCertificate(rand.Reader, template, c.ca.Intermediate, template.PublicKey, c.ca.Signer)
+	if err != nil {
+		return nil, err
+	}
+	return x509.ParseCertificate(der)
+}
+
+func (c *testCAS) CreateCertificate(req *apiv1.CreateCertificateRequest) (*apiv1.CreateCertificateResponse, error) {
+	c.mu.Lock()
+	c.createReq = req
+	c.mu.Unlock()
+	if c.createError != nil {
+		return nil, c.createError
+	}
+	cert, err := c.sign(req.Template, req.Lifetime)
+	if err != nil {
+		return nil, err
+	}
+	return &apiv1.CreateCertificateResponse{
+		Certificate:      cert,
+		CertificateChain: []*x509.Certificate{c.ca.Intermediate},
+	}, nil
+}
+
+func (c *testCAS) RenewCertificate(req *apiv1.RenewCertificateRequest) (*apiv1.RenewCertificateResponse, error) {
+	c.mu.Lock()
+	c.renewReq = req
+	c.mu.Unlock()
+	cert, err := c.sign(req.Template, req.Lifetime)
+	if err != nil {
+		return nil, err
+	}
+	return &apiv1.RenewCertificateResponse{
+		Certificate:      cert,
+		CertificateChain: []*x509.Certificate{c.ca.Intermediate},
+	}, nil
+}
+
+func (c *testCAS) RevokeCertificate(req *apiv1.RevokeCertificateRequest) (*apiv1.RevokeCertificateResponse, error) {
+	c.mu.Lock()
+	c.revokeReq = req
+	c.mu.Unlock()
+	return &apiv1.RevokeCertificateResponse{
+		Certificate:      req.Certificate,
+		CertificateChain: []*x509.Certificate{c.ca.Intermediate},
+	}, nil
+}
+
+func (c *testCAS) GetCertificateAuthority(*apiv1.GetCertificateAuthorityRequest) (*apiv1.GetCertificateAuthorityResponse, error) {
+	return &apiv1.GetCertificateAuthorityResponse{
+		RootCertificate:          c.ca.Root,
+		IntermediateCertificates: []*x509.Certificate{c.ca.Intermediate},
+		Metadata: &apiv1.CertificateAuthorityMetadata{
+			NotBefore: c.ca.Intermediate.NotBefore,
+			NotAfter:  c.ca.Intermediate.NotAfter,
+			State:     "ENABLED",
+		},
+	}, nil
+}
+
+func (c *testCAS) CheckHealth(context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.healthError
+}
+
+// startServer starts a plugin on a unix socket and returns the
+// certificateAuthority URI.
+func startServer(t *testing.T, cas apiv1.CertificateAuthorityService) string {
+	t.Helper()
+	// Use a short path, unix socket paths are limited in length.
+	dir, err := os.MkdirTemp("", "grpccas")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	path := filepath.Join(dir, "cas.sock")
+	lis, err := net.Listen("unix", path)
+	require.NoError(t, err)
+
+	srv := NewServer(cas)
+	go srv.Serve(lis) //nolint:errcheck // the error is returned on stop
+	t.Cleanup(srv.Stop)
+	return "unix://" + path
+}
+
+func mustTemplate(t *testing.T) *x509.Certificate {
+	t.Helper()
+	signer, err := keyutil.GenerateDefaultSigner()
+	require.NoError(t, err)
+	return &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "test.example.com"},
+		DNSNames:    []string{"test.example.com"},
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		PublicKey:   signer.Public(),
+		ExtraExtensions: []pkix.Extension{
+			{Id: oidCustomExtension, Value: []byte{0x04, 0x03, 'f', 'o', 'o'}},
+		},
+	}
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    apiv1.Options
+		wantErr bool
+	}{
+		{"ok/unix", apiv1.Options{CertificateAuthority: "unix:///tmp/cas.sock"}, false},
+		{"ok/timeout", apiv1.Options{CertificateAuthority: "unix:///tmp/cas.sock", Config: json.RawMessage(`{"timeout":"1m"}`)}, false},
+		{"fail/empty", apiv1.Options{}, true},
+		{"fail/scheme", apiv1.Options{CertificateAuthority: "https://ca.example.com"}, true},
+		{"fail/config", apiv1.Options{CertificateAuthority: "unix:///tmp/cas.sock", Config: json.RawMessage(`{`)}, true},
+		{"fail/timeout", apiv1.Options{CertificateAuthority: "unix:///tmp/cas.sock", Config: json.RawMessage(`{"timeout":"foo"}`)}, true},
+		{"fail/exec", apiv1.Options{CertificateAuthority: "exec:///does/not/exist"}, true},
+		{"ok/tcp", apiv1.Options{CertificateAuthority: "tcp://localhost:9443"}, false},
+		{"fail/tcp host", apiv1.Options{CertificateAuthority: "tcp:///localhost"}, true},
+		{"fail/tcp root", apiv1.Options{CertificateAuthority: "tcp://localhost:9443", Config: json.RawMessage(`{"root":"testdata/missing.crt"}`)}, true},
+		{"fail/tcp crt", apiv1.Options{CertificateAuthority: "tcp://localhost:9443", Config: json.RawMessage(`{"key":"client.key"}`)}, true},
+		{"fail/tcp key", apiv1.Options{CertificateAuthority: "tcp://localhost:9443", Config: json.RawMessage(`{"crt":"client.crt"}`)}, true},
+		{"fail/tcp keypair", apiv1.Options{CertificateAuthority: "tcp://localhost:9443", Config: json.RawMessage(`{"crt":"client.crt","key":"client.key"}`)}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := New(context.Background(), tt.opts)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, apiv1.Type(apiv1.GRPCCAS), got.Type())
+			assert.NoError(t, got.Close())
+		})
+	}
+}
+
+func TestGRPCCAS(t *testing.T) {
+	cas := newTestCAS(t)
+	c, err := New(context.Background(), apiv1.Options{
+		CertificateAuthority: startServer(t, cas),
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { c.Close() })
+
+	// CreateCertificate
+	template := mustTemplate(t)
+	resp, err := c.CreateCertificate(&apiv1.CreateCertificateRequest{
+		Template:  template,
+		Lifetime:  time.Hour,
+		Backdate:  time.Minute,
+		RequestID: "request-id",
+		Provisioner: &apiv1.ProvisionerInfo{
+			ID: "provisioner-id", Type: "JWK", Name: "jwk",
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "test.example.com", resp.Certificate.Subject.CommonName)
+	assert.Equal(t, []string{"test.example.com"}, resp.Certificate.DNSNames)
+	assert.Equal(t, template.PublicKey, resp.Certificate.PublicKey)
+	assert.Equal(t, []*x509.Certificate{cas.ca.Intermediate}, resp.CertificateChain)
+	var found bool
+	for _, ext := range resp.Certificate.Extensions {
+		if ext.Id.Equal(oidCustomExtension) {
+			found = true
+			assert.Equal(t, []byte{0x04, 0x03, 'f', 'o', 'o'}, ext.Value)
+		}
+	}
+	assert.True(t, found, "custom extension not found")
+	assert.Equal(t, time.Hour, cas.createReq.Lifetime)
+	assert.Equal(t, time.Minute, cas.createReq.Backdate)
+	assert.Equal(t, "request-id", cas.createReq.RequestID)
+	assert.Equal(t, &apiv1.ProvisionerInfo{ID: "provisioner-id", Type: "JWK", Name: "jwk"}, cas.createReq.Provisioner)
+
+	// RenewCertificate
+	renewResp, err := c.RenewCertificate(&apiv1.RenewCertificateRequest{
+		Template: mustTemplate(t),
+		Lifetime: 2 * time.Hour,
+		Token:    "token",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "test.example.com", renewResp.Certificate.Subject.CommonName)
+	assert.Equal(t, "token", cas.renewReq.Token)
+	assert.Equal(t, 2*time.Hour, cas.renewReq.Lifetime)
+
+	// RevokeCertificate
+	revokeResp, err := c.RevokeCertificate(&apiv1.RevokeCertificateRequest{
+		Certificate:  resp.Certificate,
+		SerialNumber: "1234",
+		Reason:       "key compromise",
+		ReasonCode:   1,
+		PassiveOnly:  true,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, resp.Certificate, revokeResp.Certificate)
+	assert.Equal(t, &apiv1.RevokeCertificateRequest{
+		Certificate:  resp.Certificate,
+		SerialNumber: "1234",
+		Reason:       "key compromise",
+		ReasonCode:   1,
+		PassiveOnly:  true,
+	}, cas.revokeReq)
+
+	// GetCertificateAuthority
+	caResp, err := c.GetCertificateAuthority(&apiv1.GetCertificateAuthorityRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, cas.ca.Root, caResp.RootCertificate)
+	assert.Equal(t, []*x509.Certificate{cas.ca.Intermediate}, caResp.IntermediateCertificates)
+	assert.Equal(t, &apiv1.CertificateAuthorityMetadata{
+		NotBefore: cas.ca.Intermediate.NotBefore.UTC(),
+		NotAfter:  cas.ca.Intermediate.NotAfter.UTC(),
+		State:     "ENABLED",
+	}, caResp.Metadata)
+
+	// Errors
+	cas.createError = apiv1.NotImplementedError{Message: "not implemented"}
+	_, err = c.CreateCertificate(&apiv1.CreateCertificateRequest{Template: mustTemplate(t), Lifetime: time.Hour})
+	assert.Equal(t, apiv1.NotImplementedError{Message: "not implemented"}, err)
+	cas.createError = apiv1.ValidationError{Message: "bad request"}
+	_, err = c.CreateCertificate(&apiv1.CreateCertificateRequest{Template: mustTemplate(t), Lifetime: time.Hour})
+	assert.Equal(t, apiv1.ValidationError{Message: "bad request"}, err)
+	cas.createError = errors.New("force")
+	_, err = c.CreateCertificate(&apiv1.CreateCertificateRequest{Template: mustTemplate(t), Lifetime: time.Hour})
+	assert.ErrorContains(t, err, "force")
+
+	_, err = c.CreateCertificate(&apiv1.CreateCertificateRequest{Lifetime: time.Hour})
+	assert.Error(t, err)
+	_, err = c.RenewCertificate(&apiv1.RenewCertificateRequest{Template: mustTemplate(t)})
+	assert.Error(t, err)
+	_, err = c.RevokeCertificate(&apiv1.RevokeCertificateRequest{})
+	assert.Error(t, err)
+}
+
+func mustSignTLS(t *testing.T, ca *minica.CA, name string, extKeyUsage x509.ExtKeyUsage) (*x509.Certificate, crypto.Signer) {
+	t.Helper()
+	signer, err := keyutil.GenerateDefaultSigner()
+	require.NoError(t, err)
+	cert, err := ca.Sign(&x509.Certificate{
+		Subject:     pkix.Name{CommonName: name},
+		DNSNames:    []string{name},
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{extKeyUsage},
+		PublicKey:   signer.Public(),
+	})
+	require.NoError(t, err)
+	return cert, signer
+}
+
+func mustWritePEM(t *testing.T, filename string, blocks ...*pem.Block) string {
+	t.Helper()
+	var b []byte
+	for _, block := range blocks {
+		b = append(b, pem.EncodeToMemory(block)...)
+	}
+	require.NoError(t, os.WriteFile(filename, b, 0600))
+	return filename
+}
+
+func TestGRPCCAS_tcp(t *testing.T) {
+	ca, err := minica.New()
+	require.NoError(t, err)
+	serverCrt, serverKey := mustSignTLS(t, ca, "localhost", x509.ExtKeyUsageServerAuth)
+	clientCrt, clientKey := mustSignTLS(t, ca, "step-ca", x509.ExtKeyUsageClientAuth)
+
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(ca.Root)
+	srv := NewServer(newTestCAS(t), grpc.Creds(credentials.NewTLS(&tls.Config{
+		Certificates: []tls.Certificate{{
+			Certificate: [][]byte{serverCrt.Raw, ca.Intermediate.Raw},
+			PrivateKey:  serverKey,
+		}},
+		ClientCAs:  clientCAs,
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		MinVersion: tls.VersionTLS12,
+	})))
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go srv.Serve(lis) //nolint:errcheck // the error is returned on stop
+	t.Cleanup(srv.Stop)
+
+	dir := t.TempDir()
+	keyBytes, err := x509.MarshalPKCS8PrivateKey(clientKey)
+	require.NoError(t, err)
+	root := mustWritePEM(t, filepath.Join(dir, "root.crt"), &pem.Block{Type: "CERTIFICATE", Bytes: ca.Root.Raw})
+	crt := mustWritePEM(t, filepath.Join(dir, "client.crt"),
+		&pem.Block{Type: "CERTIFICATE", Bytes: clientCrt.Raw},
+		&pem.Block{Type: "CERTIFICATE", Bytes: ca.Intermediate.Raw})
+	key := mustWritePEM(t, filepath.Join(dir, "client.key"), &pem.Block{Type: "PRIVATE KEY", Bytes: keyBytes})
+
+	_, port, err := net.SplitHostPort(lis.Addr().String())
+	require.NoError(t, err)
+	caURI := "tcp://localhost:" + port
+
+	tests := []struct {
+		name    string
+		options Options
+		wantErr bool
+	}{
+		{"ok", Options{Root: root, Certificate: crt, Key: key}, false},
+		{"ok server name", Options{Root: root, Certificate: crt, Key: key, ServerName: "localhost"}, false},
+		{"fail no client certificate", Options{Root: root, Timeout: "1s"}, true},
+		{"fail server name", Options{Root: root, Certificate: crt, Key: key, ServerName: "plugin.example.com", Timeout: "1s"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := json.Marshal(tt.options)
+			require.NoError(t, err)
+			c, err := New(context.Background(), apiv1.Options{
+				CertificateAuthority: caURI,
+				Config:               config,
+			})
+			require.NoError(t, err)
+			t.Cleanup(func() { c.Close() })
+
+			resp, err := c.GetCertificateAuthority(&apiv1.GetCertificateAuthorityRequest{})
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.NotNil(t, resp.RootCertificate)
+			assert.NoError(t, c.CheckHealth(context.Background()))
+		})
+	}
+}
+
+func TestGRPCCAS_CheckHealth(t *testing.T) {
+	cas := newTestCAS(t)
+	c, err := New(context.Background(), apiv1.Options{
+		CertificateAuthority: startServer(t, cas),
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { c.Close() })
+
+	assert.NoError(t, c.CheckHealth(context.Background()))
+
+	cas.mu.Lock()
+	cas.healthError = errors.New("force")
+	cas.mu.Unlock()
+	assert.ErrorContains(t, c.CheckHealth(context.Background()), "NOT_SERVING")
+
+	// Plugins without the health service are considered healthy.
+	dir, err := os.MkdirTemp("", "grpccas")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	path := filepath.Join(dir, "cas.sock")
+	lis, err := net.Listen("unix", path)
+	require.NoError(t, err)
+	srv := grpc.NewServer()
+	RegisterCertificateAuthorityServiceServer(srv, &server{cas: cas})
+	go srv.Serve(lis) //nolint:errcheck // the error is returned on stop
+	t.Cleanup(srv.Stop)
+
+	c2, err := New(context.Background(), apiv1.Options{
+		CertificateAuthority: "unix://" + path,
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { c2.Close() })
+	assert.NoError(t, c2.CheckHealth(context.Background()))
+
+	// Requests fail if the plugin is not available.
+	c3, err := New(context.Background(), apiv1.Options{
+		CertificateAuthority: "unix://" + filepath.Join(dir, "missing.sock"),
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { c3.Close() })
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	assert.Error(t, c3.CheckHealth(ctx))
+}
+
+// TestHelperPlugin is not a real test, it is the plugin started in
+// TestGRPCCAS_exec.
+func TestHelperPlugin(t *testing.T) {
+	if os.Getenv("GRPCCAS_HELPER_PLUGIN") != "1" {
+		t.Skip("helper process")
+	}
+	if err := ServePlugin(newTestCAS(t)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGRPCCAS_exec(t *testing.T) {
+	config, err := json.Marshal(Options{
+		Args:    []string{"-test.run=^TestHelperPlugin$"},
+		Env:     []string{"GRPCCAS_HELPER_PLUGIN=1"},
+		Timeout: "1m",
+	})
+	require.NoError(t, err)
+
+	c, err := New(context.Background(), apiv1.Options{
+		CertificateAuthority: "exec://" + os.Args[0],
+		Config:               config,
+	})
+	require.NoError(t, err)
+
+	resp, err := c.GetCertificateAuthority(&apiv1.GetCertificateAuthorityRequest{})
+	require.NoError(t, err)
+	assert.NotNil(t, resp.RootCertificate)
+	assert.Len(t, resp.IntermediateCertificates, 1)
+
+	require.NoError(t, c.Close())
+	assert.NoDirExists(t, c.tempDir)
+}
+
+func Test_marshalTemplate(t *testing.T) {
+	template := mustTemplate(t)
+	template.SignatureAlgorithm = x509.SHA256WithRSA
+	der, err := marshalTemplate(template)
+	require.NoError(t, err)
+
+	got, err := unmarshalTemplate(der)
+	require.NoError(t, err)
+	assert.Equal(t, template.Subject.CommonName, got.Subject.CommonName)
+	assert.Equal(t, template.DNSNames, got.DNSNames)
+	assert.Equal(t, template.KeyUsage, got.KeyUsage)
+	assert.Equal(t, template.ExtKeyUsage, got.ExtKeyUsage)
+	assert.Equal(t, template.PublicKey, got.PublicKey)
+	assert.Equal(t, x509.UnknownSignatureAlgorithm, got.SignatureAlgorithm)
+	assert.Contains(t, got.ExtraExtensions, template.ExtraExtensions[0])
+
+	_, err = marshalTemplate(&x509.Certificate{})
+	assert.Error(t, err)
+	_, err = unmarshalTemplate([]byte("foo"))
+	assert.Error(t, err)
+}
+
+func Test_timestamp(t *testing.T) {
+	now := time.Unix(1800000000, 500).UTC()
+	assert.Equal(t, now, parseTimestamp(newTimestamp(now)))
+	assert.Nil(t, newTimestamp(time.Time{}))
+	assert.True(t, parseTimestamp(nil).IsZero())
+}
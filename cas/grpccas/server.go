@@ -0,0 +1,257 @@
+package grpccas
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/smallstep/certificates/cas/apiv1"
+)
+
+// PluginSocketEnv is the environment variable with the path of the unix socket
+// a plugin started by step-ca must listen on.
+const PluginSocketEnv = "STEP_CAS_PLUGIN_SOCKET"
+
+// serviceName is the name of the service in grpccas.proto, it is also used
+// in health checks.
+var serviceName = CertificateAuthorityService_ServiceDesc.ServiceName
+
+// NewServer returns a gRPC server that serves the given
+// CertificateAuthorityService using the protocol defined in grpccas.proto. The
+// server also implements the standard gRPC health service, which reports the
+// result of CheckHealth if the service implements apiv1.HealthChecker.
+//
+// Plugins listening on a tcp address should pass grpc.Creds with a TLS
+// configuration that requires and verifies the client certificates used by
+// step-ca.
+func NewServer(cas apiv1.CertificateAuthorityService, opts ...grpc.ServerOption) *grpc.Server {
+	srv := grpc.NewServer(opts...)
+	RegisterCertificateAuthorityServiceServer(srv, &server{cas: cas})
+	healthpb.RegisterHealthServer(srv, &healthServer{cas: cas})
+	return srv
+}
+
+// ServePlugin serves the given CertificateAuthorityService on the unix socket
+// defined by step-ca in the STEP_CAS_PLUGIN_SOCKET environment variable. It is
+// meant to be called from the main function of a plugin, and it blocks until
+// the server is stopped.
+func ServePlugin(cas apiv1.CertificateAuthorityService, opts ...grpc.ServerOption) error {
+	path := os.Getenv(PluginSocketEnv)
+	if path == "" {
+		return errors.New("grpccas: " + PluginSocketEnv + " is not set")
+	}
+	lis, err := net.Listen("unix", path)
+	if err != nil {
+		return err
+	}
+	return NewServer(cas, opts...).Serve(lis)
+}
+
+// server adapts a CertificateAuthorityService to the gRPC service.
+type server struct {
+	UnimplementedCertificateAuthorityServiceServer
+	cas apiv1.CertificateAuthorityService
+}
+
+func (s *server) CreateCertificate(_ context.Context, req *CreateCertificateRequest) (*CreateCertificateResponse, error) {
+	template, csr, err := parseTemplate(req.GetTemplate(), req.GetCsr())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	var provisioner *apiv1.ProvisionerInfo
+	if p := req.GetProvisioner(); p != nil {
+		provisioner = &apiv1.ProvisionerInfo{
+			ID:   p.GetId(),
+			Type: p.GetType(),
+			Name: p.GetName(),
+		}
+	}
+	resp, err := s.cas.CreateCertificate(&apiv1.CreateCertificateRequest{
+		Template:       template,
+		CSR:            csr,
+		Lifetime:       req.GetLifetime().AsDuration(),
+		Backdate:       req.GetBackdate().AsDuration(),
+		RequestID:      req.GetRequestId(),
+		Provisioner:    provisioner,
+		IsCAServerCert: req.GetIsCaServerCert(),
+	})
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+	cert, chain := rawCertificates(resp.Certificate, resp.CertificateChain)
+	return &CreateCertificateResponse{
+		Certificate:      cert,
+		CertificateChain: chain,
+	}, nil
+}
+
+func (s *server) RenewCertificate(_ context.Context, req *RenewCertificateRequest) (*RenewCertificateResponse, error) {
+	template, csr, err := parseTemplate(req.GetTemplate(), req.GetCsr())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	resp, err := s.cas.RenewCertificate(&apiv1.RenewCertificateRequest{
+		Template:  template,
+		CSR:       csr,
+		Lifetime:  req.GetLifetime().AsDuration(),
+		Backdate:  req.GetBackdate().AsDuration(),
+		Token:     req.GetToken(),
+		RequestID: req.GetRequestId(),
+	})
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+	cert, chain := rawCertificates(resp.Certificate, resp.CertificateChain)
+	return &RenewCertificateResponse{
+		Certificate:      cert,
+		CertificateChain: chain,
+	}, nil
+}
+
+func (s *server) RevokeCertificate(_ context.Context, req *RevokeCertificateRequest) (*RevokeCertificateResponse, error) {
+	var cert *x509.Certificate
+	if der := req.GetCertificate(); len(der) > 0 {
+		var err error
+		if cert, err = x509.ParseCertificate(der); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "error parsing certificate: %v", err)
+		}
+	}
+	resp, err := s.cas.RevokeCertificate(&apiv1.RevokeCertificateRequest{
+		Certificate:  cert,
+		SerialNumber: req.GetSerialNumber(),
+		Reason:       req.GetReason(),
+		ReasonCode:   int(req.GetReasonCode()),
+		PassiveOnly:  req.GetPassiveOnly(),
+		RequestID:    req.GetRequestId(),
+	})
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+	rawCert, chain := rawCertificates(resp.Certificate, resp.CertificateChain)
+	return &RevokeCertificateResponse{
+		Certificate:      rawCert,
+		CertificateChain: chain,
+	}, nil
+}
+
+func (s *server) GetCertificateAuthority(_ context.Context, req *GetCertificateAuthorityRequest) (*GetCertificateAuthorityResponse, error) {
+	getter, ok := s.cas.(apiv1.CertificateAuthorityGetter)
+	if !ok {
+		return nil, status.Error(codes.Unimplemented, "getCertificateAuthority is not implemented")
+	}
+	resp, err := getter.GetCertificateAuthority(&apiv1.GetCertificateAuthorityRequest{
+		Name: req.GetName(),
+	})
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+	m := new(GetCertificateAuthorityResponse)
+	if resp.RootCertificate != nil {
+		m.RootCertificate = resp.RootCertificate.Raw
+	}
+	for _, c := range resp.IntermediateCertificates {
+		m.IntermediateCertificates = append(m.IntermediateCertificates, c.Raw)
+	}
+	if md := resp.Metadata; md != nil {
+		m.Metadata = &CertificateAuthorityMetadata{
+			NotBefore: newTimestamp(md.NotBefore),
+			NotAfter:  newTimestamp(md.NotAfter),
+			State:     md.State,
+		}
+	}
+	return m, nil
+}
+
+// healthServer implements the standard gRPC health service.
+type healthServer struct {
+	healthpb.UnimplementedHealthServer
+	cas apiv1.CertificateAuthorityService
+}
+
+func (s *healthServer) Check(ctx context.Context, req *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
+	if svc := req.GetService(); svc != "" && svc != serviceName {
+		return nil, status.Errorf(codes.NotFound, "unknown service %s", svc)
+	}
+	if hc, ok := s.cas.(apiv1.HealthChecker); ok {
+		if err := hc.CheckHealth(ctx); err != nil {
+			return &healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_NOT_SERVING}, nil
+		}
+	}
+	return &healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_SERVING}, nil
+}
+
+func parseTemplate(template, csr []byte) (*x509.Certificate, *x509.CertificateRequest, error) {
+	var (
+		err  error
+		tmpl *x509.Certificate
+		cr   *x509.CertificateRequest
+	)
+	if len(template) > 0 {
+		if tmpl, err = unmarshalTemplate(template); err != nil {
+			return nil, nil, err
+		}
+	}
+	if len(csr) > 0 {
+		if cr, err = x509.ParseCertificateRequest(csr); err != nil {
+			return nil, nil, err
+		}
+	}
+	return tmpl, cr, nil
+}
+
+// rawCertificates returns the DER encoding of the given certificate and chain.
+func rawCertificates(cert *x509.Certificate, chain []*x509.Certificate) ([]byte, [][]byte) {
+	var (
+		rawCert  []byte
+		rawChain [][]byte
+	)
+	if cert != nil {
+		rawCert = cert.Raw
+	}
+	for _, c := range chain {
+		rawChain = append(rawChain, c.Raw)
+	}
+	return rawCert, rawChain
+}
+
+// newTimestamp returns the google.protobuf.Timestamp for the given time, or
+// nil if the time is not set.
+func newTimestamp(t time.Time) *timestamppb.Timestamp {
+	if t.IsZero() {
+		return nil
+	}
+	return timestamppb.New(t)
+}
+
+// toStatusError converts the errors returned by a CertificateAuthorityService
+// to gRPC status errors.
+func toStatusError(err error) error {
+	var sc interface{ StatusCode() int }
+	if !errors.As(err, &sc) {
+		return status.Error(codes.Unknown, err.Error())
+	}
+	switch sc.StatusCode() {
+	case http.StatusBadRequest:
+		return status.Error(codes.InvalidArgument, err.Error())
+	case http.StatusUnauthorized:
+		return status.Error(codes.Unauthenticated, err.Error())
+	case http.StatusForbidden:
+		return status.Error(codes.PermissionDenied, err.Error())
+	case http.StatusNotFound:
+		return status.Error(codes.NotFound, err.Error())
+	case http.StatusNotImplemented:
+		return status.Error(codes.Unimplemented, err.Error())
+	default:
+		return status.Error(codes.Unknown, err.Error())
+	}
+}
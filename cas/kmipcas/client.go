@@ -0,0 +1,207 @@
+package kmipcas
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// defaultTimeout is the timeout used in KMIP requests if the context does not
+// have a deadline.
+const defaultTimeout = 30 * time.Second
+
+// client is a minimal KMIP client over TLS. It only implements the Sign
+// operation using KMIP 1.2 messages. Requests are serialized over a single
+// connection that is reopened after any error.
+type client struct {
+	addr      string
+	tlsConfig *tls.Config
+	mu        sync.Mutex
+	conn      net.Conn
+}
+
+func newClient(addr string, tlsConfig *tls.Config) *client {
+	return &client{
+		addr:      addr,
+		tlsConfig: tlsConfig,
+	}
+}
+
+// Sign signs the given data with the private key with the given unique
+// identifier. The data is signed as it is, without hashing it on the server.
+func (c *client) Sign(ctx context.Context, keyID string, algorithm, padding uint32, data []byte) ([]byte, error) {
+	params := [][]byte{
+		enumeration(tagCryptographicAlgorithm, algorithm),
+	}
+	if padding != 0 {
+		params = append(params, enumeration(tagPaddingMethod, padding))
+	}
+	payload, err := c.do(ctx, operationSign, structure(tagRequestPayload,
+		textString(tagUniqueIdentifier, keyID),
+		structure(tagCryptographicParameters, params...),
+		byteString(tagData, data),
+	))
+	if err != nil {
+		return nil, err
+	}
+	sig, ok := payload.find(tagSignatureData)
+	if !ok || len(sig.value) == 0 {
+		return nil, errors.New("kmip sign response does not contain a signature")
+	}
+	return sig.value, nil
+}
+
+// do sends a request with the given operation and payload and returns the
+// response payload.
+func (c *client) do(ctx context.Context, operation uint32, payload []byte) (item, error) {
+	req := structure(tagRequestMessage,
+		structure(tagRequestHeader,
+			structure(tagProtocolVersion,
+				integer(tagProtocolVersionMajor, 1),
+				integer(tagProtocolVersionMinor, 2),
+			),
+			integer(tagBatchCount, 1),
+		),
+		structure(tagBatchItem,
+			enumeration(tagOperation, operation),
+			payload,
+		),
+	)
+
+	b, err := c.roundTrip(ctx, req)
+	if err != nil {
+		return item{}, err
+	}
+	resp, err := decode(b)
+	if err != nil {
+		return item{}, err
+	}
+	if resp.tag != tagResponseMessage {
+		return item{}, fmt.Errorf("unexpected kmip message %06X", resp.tag)
+	}
+	batch, ok := resp.find(tagBatchItem)
+	if !ok {
+		return item{}, errors.New("kmip response does not contain a batch item")
+	}
+	if op, ok := batch.find(tagOperation); ok && op.uint32() != operation {
+		return item{}, fmt.Errorf("unexpected kmip operation %#x in response", op.uint32())
+	}
+	status, ok := batch.find(tagResultStatus)
+	if !ok {
+		return item{}, errors.New("kmip response does not contain a result status")
+	}
+	if status.uint32() != resultStatusSuccess {
+		return item{}, newResultError(batch)
+	}
+	payloadItem, ok := batch.find(tagResponsePayload)
+	if !ok {
+		return item{}, errors.New("kmip response does not contain a payload")
+	}
+	return payloadItem, nil
+}
+
+// roundTrip writes the request and reads the response. A request using a
+// reused connection is retried once on a new connection, as the server might
+// have closed it.
+func (c *client) roundTrip(ctx context.Context, req []byte) ([]byte, error) {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, defaultTimeout)
+		defer cancel()
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	reused := c.conn != nil
+	b, err := c.send(ctx, req)
+	if err != nil && reused && ctx.Err() == nil {
+		b, err = c.send(ctx, req)
+	}
+	return b, err
+}
+
+func (c *client) send(ctx context.Context, req []byte) ([]byte, error) {
+	if c.conn == nil {
+		d := &tls.Dialer{Config: c.tlsConfig}
+		conn, err := d.DialContext(ctx, "tcp", c.addr)
+		if err != nil {
+			return nil, fmt.Errorf("error connecting to kmip server: %w", err)
+		}
+		c.conn = conn
+	}
+
+	deadline, _ := ctx.Deadline()
+	b, err := exchange(c.conn, deadline, req)
+	if err != nil {
+		c.conn.Close()
+		c.conn = nil
+		return nil, fmt.Errorf("error sending kmip request: %w", err)
+	}
+	return b, nil
+}
+
+// exchange writes a message and reads the response in the given connection.
+func exchange(conn net.Conn, deadline time.Time, req []byte) ([]byte, error) {
+	if err := conn.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+	if _, err := conn.Write(req); err != nil {
+		return nil, err
+	}
+	return readMessage(conn)
+}
+
+// readMessage reads a TTLV message.
+func readMessage(r io.Reader) ([]byte, error) {
+	header := make([]byte, 8)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	length := binary.BigEndian.Uint32(header[4:])
+	if length > maxMessageSize {
+		return nil, fmt.Errorf("kmip message is too large: %d bytes", length)
+	}
+	b := make([]byte, 8+int(length))
+	copy(b, header)
+	if _, err := io.ReadFull(r, b[8:]); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// resultError is the error returned when the KMIP server returns a result
+// status different than success.
+type resultError struct {
+	status  uint32
+	reason  uint32
+	message string
+}
+
+func newResultError(batch item) *resultError {
+	err := &resultError{}
+	if it, ok := batch.find(tagResultStatus); ok {
+		err.status = it.uint32()
+	}
+	if it, ok := batch.find(tagResultReason); ok {
+		err.reason = it.uint32()
+	}
+	if it, ok := batch.find(tagResultMessage); ok {
+		err.message = it.text()
+	}
+	return err
+}
+
+// Error implements the error interface.
+func (e *resultError) Error() string {
+	if e.message != "" {
+		return fmt.Sprintf("kmip operation failed with status %#x and reason %#x: %s", e.status, e.reason, e.message)
+	}
+	return fmt.Sprintf("kmip operation failed with status %#x and reason %#x", e.status, e.reason)
+}
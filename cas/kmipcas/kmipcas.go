@@ -0,0 +1,227 @@
+package kmipcas
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+
+	"go.step.sm/crypto/pemutil"
+
+	"github.com/smallstep/certificates/cas/apiv1"
+	"github.com/smallstep/certificates/cas/softcas"
+)
+
+func init() {
+	apiv1.Register(apiv1.KMIPCAS, func(ctx context.Context, opts apiv1.Options) (apiv1.CertificateAuthorityService, error) {
+		return New(ctx, opts)
+	})
+}
+
+// defaultPort is the IANA port for KMIP over TLS.
+const defaultPort = "5696"
+
+// Options are the KMIP options, they are set in the config property of the
+// CAS options.
+type Options struct {
+	// KeyID is the unique identifier of the private key of the issuer in the
+	// KMIP server.
+	KeyID string `json:"keyID"`
+	// Certificate is the path to a PEM bundle with the issuer certificate
+	// followed by the certificates that chain it to the root. The root
+	// certificate, if present, is only used in GetCertificateAuthority.
+	Certificate string `json:"crt"`
+	// ClientCertificate and ClientKey are the paths to the PEM certificate and
+	// key used to authenticate the TLS connection to the KMIP server.
+	ClientCertificate string `json:"clientCertificate,omitempty"`
+	ClientKey         string `json:"clientKey,omitempty"`
+	// Roots is the path to a PEM bundle with the roots used to verify the
+	// certificate of the KMIP server. If not set, the system roots are used.
+	Roots string `json:"roots,omitempty"`
+	// ServerName is the name used to verify the certificate of the KMIP
+	// server. It defaults to the host in the certificate authority address.
+	ServerName string `json:"serverName,omitempty"`
+}
+
+// KMIPCAS implements a CertificateAuthorityService using a key stored in a
+// KMIP server, e.g., an HSM or a key manager. Certificates are signed like in
+// SoftCAS, but the signature is done by the KMIP server using the Sign
+// operation, so no PKCS #11 libraries are required in the host.
+type KMIPCAS struct {
+	client        *client
+	signer        *signer
+	certificate   *x509.Certificate
+	intermediates []*x509.Certificate
+	root          *x509.Certificate
+	softCAS       *softcas.SoftCAS
+}
+
+// New creates a new CertificateAuthorityService implementation using a KMIP
+// server. The certificate authority is the address of the KMIP server, e.g.,
+// "kmip.example.com:5696", if the port is omitted the default one is used.
+func New(ctx context.Context, opts apiv1.Options) (*KMIPCAS, error) {
+	if opts.CertificateAuthority == "" {
+		return nil, errors.New("kmipCAS 'certificateAuthority' cannot be empty")
+	}
+	addr := opts.CertificateAuthority
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+		addr = net.JoinHostPort(addr, defaultPort)
+	}
+	if host == "" {
+		return nil, errors.New("kmipCAS 'certificateAuthority' is not a valid address")
+	}
+
+	var o Options
+	if opts.Config != nil {
+		if err := json.Unmarshal(opts.Config, &o); err != nil {
+			return nil, fmt.Errorf("error decoding kmipCAS config: %w", err)
+		}
+	}
+	switch {
+	case o.KeyID == "":
+		return nil, errors.New("kmipCAS 'config.keyID' cannot be empty")
+	case o.Certificate == "":
+		return nil, errors.New("kmipCAS 'config.crt' cannot be empty")
+	case (o.ClientCertificate == "") != (o.ClientKey == ""):
+		return nil, errors.New("kmipCAS 'config.clientCertificate' and 'config.clientKey' must be set together")
+	}
+
+	chain, err := pemutil.ReadCertificateBundle(o.Certificate)
+	if err != nil {
+		return nil, fmt.Errorf("error reading kmipCAS certificate: %w", err)
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: host,
+	}
+	if o.ServerName != "" {
+		tlsConfig.ServerName = o.ServerName
+	}
+	if o.Roots != "" {
+		b, err := os.ReadFile(o.Roots)
+		if err != nil {
+			return nil, fmt.Errorf("error reading kmipCAS roots: %w", err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(b) {
+			return nil, fmt.Errorf("error reading kmipCAS roots: %s does not contain any certificate", o.Roots)
+		}
+	}
+	if o.ClientCertificate != "" {
+		crt, err := tls.LoadX509KeyPair(o.ClientCertificate, o.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("error reading kmipCAS client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{crt}
+	}
+
+	c := &KMIPCAS{
+		client:      newClient(addr, tlsConfig),
+		certificate: chain[0],
+	}
+	for _, crt := range chain[1:] {
+		if isRoot(crt) {
+			c.root = crt
+		} else {
+			c.intermediates = append(c.intermediates, crt)
+		}
+	}
+
+	if c.signer, err = newSigner(c.client, o.KeyID, c.certificate.PublicKey); err != nil {
+		return nil, err
+	}
+	c.softCAS, err = softcas.New(ctx, apiv1.Options{
+		CertificateChain: append([]*x509.Certificate{c.certificate}, c.intermediates...),
+		Signer:           c.signer,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// Type returns the type of this CertificateAuthorityService.
+func (c *KMIPCAS) Type() apiv1.Type {
+	return apiv1.KMIPCAS
+}
+
+// GetSigner implements [apiv1.CertificateAuthoritySigner] and returns a
+// [crypto.Signer] with the KMIP key.
+func (c *KMIPCAS) GetSigner() (crypto.Signer, error) {
+	return c.softCAS.GetSigner()
+}
+
+// CreateCertificate signs a new certificate using the KMIP key.
+func (c *KMIPCAS) CreateCertificate(req *apiv1.CreateCertificateRequest) (*apiv1.CreateCertificateResponse, error) {
+	return c.softCAS.CreateCertificate(req)
+}
+
+// RenewCertificate renews the given certificate using the KMIP key.
+func (c *KMIPCAS) RenewCertificate(req *apiv1.RenewCertificateRequest) (*apiv1.RenewCertificateResponse, error) {
+	return c.softCAS.RenewCertificate(req)
+}
+
+// RevokeCertificate revokes the given certificate in step-ca. Like in
+// SoftCAS, this operation is a no-op as the actual revoke will happen when we
+// store the entry in the db.
+func (c *KMIPCAS) RevokeCertificate(req *apiv1.RevokeCertificateRequest) (*apiv1.RevokeCertificateResponse, error) {
+	return c.softCAS.RevokeCertificate(req)
+}
+
+// GetCertificateAuthority returns the root certificate configured in the
+// certificate bundle, and the issuer certificate and the rest of the bundle
+// as the intermediate certificates.
+func (c *KMIPCAS) GetCertificateAuthority(*apiv1.GetCertificateAuthorityRequest) (*apiv1.GetCertificateAuthorityResponse, error) {
+	if c.root == nil {
+		return nil, errors.New("kmipCAS 'config.crt' does not contain a root certificate")
+	}
+	return &apiv1.GetCertificateAuthorityResponse{
+		RootCertificate:          c.root,
+		IntermediateCertificates: append([]*x509.Certificate{c.certificate}, c.intermediates...),
+		Metadata:                 apiv1.NewCertificateAuthorityMetadata(c.certificate),
+	}, nil
+}
+
+// CheckHealth signs a random message with the KMIP key and verifies the
+// signature with the issuer certificate.
+func (c *KMIPCAS) CheckHealth(ctx context.Context) error {
+	msg := make([]byte, 32)
+	if _, err := rand.Read(msg); err != nil {
+		return fmt.Errorf("error generating random message: %w", err)
+	}
+	sum := sha256.Sum256(msg)
+
+	sig, err := c.signer.sign(ctx, sum[:], crypto.SHA256)
+	if err != nil {
+		return fmt.Errorf("kmipCAS Sign failed: %w", err)
+	}
+
+	alg := x509.ECDSAWithSHA256
+	if c.certificate.PublicKeyAlgorithm == x509.RSA {
+		alg = x509.SHA256WithRSA
+	}
+	if err := c.certificate.CheckSignature(alg, msg, sig); err != nil {
+		return fmt.Errorf("kmipCAS key does not match the certificate: %w", err)
+	}
+	return nil
+}
+
+// isRoot returns true if the given certificate is a root certificate.
+func isRoot(cert *x509.Certificate) bool {
+	if cert.BasicConstraintsValid && cert.IsCA {
+		return bytes.Equal(cert.RawIssuer, cert.RawSubject) && cert.CheckSignatureFrom(cert) == nil
+	}
+	return false
+}
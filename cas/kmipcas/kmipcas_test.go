@@ -0,0 +1,608 @@
+package kmipcas
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.step.sm/crypto/minica"
+
+	"github.com/smallstep/certificates/cas/apiv1"
+)
+
+// testServer is a fake KMIP server that implements the Sign operation.
+type testServer struct {
+	addr  string
+	mu    sync.Mutex
+	keys  map[string]crypto.Signer
+	raw   bool
+	close bool
+	conns int
+}
+
+func newTestServer(t *testing.T, ca *minica.CA) *testServer {
+	t.Helper()
+	key := mustSigner(t)
+	crt, err := ca.Sign(&x509.Certificate{
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		PublicKey:   key.Public(),
+	})
+	require.NoError(t, err)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.Root)
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{{
+			Certificate: [][]byte{crt.Raw, ca.Intermediate.Raw},
+			PrivateKey:  key,
+		}},
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		ClientCAs:  pool,
+		MinVersion: tls.VersionTLS12,
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+
+	s := &testServer{
+		addr: ln.Addr().String(),
+		keys: make(map[string]crypto.Signer),
+	}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.conns++
+			s.mu.Unlock()
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *testServer) serve(conn net.Conn) {
+	defer conn.Close()
+	for {
+		b, err := readMessage(conn)
+		if err != nil {
+			return
+		}
+		req, err := decode(b)
+		if err != nil {
+			return
+		}
+		if _, err := conn.Write(s.handle(req)); err != nil {
+			return
+		}
+		s.mu.Lock()
+		closeConn := s.close
+		s.mu.Unlock()
+		if closeConn {
+			return
+		}
+	}
+}
+
+func (s *testServer) handle(req item) []byte {
+	batch, _ := req.find(tagBatchItem)
+	op, _ := batch.find(tagOperation)
+	payload, _ := batch.find(tagRequestPayload)
+	uid, _ := payload.find(tagUniqueIdentifier)
+	data, _ := payload.find(tagData)
+	params, _ := payload.find(tagCryptographicParameters)
+	alg, _ := params.find(tagCryptographicAlgorithm)
+	padding, _ := params.find(tagPaddingMethod)
+
+	s.mu.Lock()
+	key, ok := s.keys[uid.text()]
+	raw := s.raw
+	s.mu.Unlock()
+
+	if op.uint32() != operationSign {
+		return testResponse(op.uint32(), testFailure("operation not supported"))
+	}
+	if !ok {
+		return testResponse(op.uint32(), testFailure("key not found"))
+	}
+
+	var sig []byte
+	var err error
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		if alg.uint32() != cryptographicAlgorithmRSA || padding.uint32() != paddingMethodPKCS1v15 {
+			return testResponse(op.uint32(), testFailure("invalid cryptographic parameters"))
+		}
+		sig, err = rsa.SignPKCS1v15(rand.Reader, k, 0, data.value)
+	case *ecdsa.PrivateKey:
+		if alg.uint32() != cryptographicAlgorithmECDSA {
+			return testResponse(op.uint32(), testFailure("invalid cryptographic parameters"))
+		}
+		if raw {
+			var r, ss *big.Int
+			if r, ss, err = ecdsa.Sign(rand.Reader, k, data.value); err == nil {
+				size := (k.Curve.Params().BitSize + 7) / 8
+				sig = make([]byte, 2*size)
+				r.FillBytes(sig[:size])
+				ss.FillBytes(sig[size:])
+			}
+		} else {
+			sig, err = ecdsa.SignASN1(rand.Reader, k, data.value)
+		}
+	}
+	if err != nil {
+		return testResponse(op.uint32(), testFailure(err.Error()))
+	}
+
+	return testResponse(op.uint32(),
+		enumeration(tagResultStatus, resultStatusSuccess),
+		structure(tagResponsePayload,
+			textString(tagUniqueIdentifier, uid.text()),
+			byteString(tagSignatureData, sig),
+		),
+	)
+}
+
+func testResponse(operation uint32, items ...[]byte) []byte {
+	ts := make([]byte, 8)
+	binary.BigEndian.PutUint64(ts, uint64(time.Now().Unix()))
+	return structure(tagResponseMessage,
+		structure(tagResponseHeader,
+			structure(tagProtocolVersion,
+				integer(tagProtocolVersionMajor, 1),
+				integer(tagProtocolVersionMinor, 2),
+			),
+			encode(tagTimeStamp, typeDateTime, ts),
+			integer(tagBatchCount, 1),
+		),
+		structure(tagBatchItem, append([][]byte{enumeration(tagOperation, operation)}, items...)...),
+	)
+}
+
+func testFailure(msg string) []byte {
+	return append(append(
+		enumeration(tagResultStatus, 0x01),
+		enumeration(tagResultReason, 0x01)...),
+		textString(tagResultMessage, msg)...,
+	)
+}
+
+func (s *testServer) setKey(id string, key crypto.Signer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys[id] = key
+}
+
+func mustSigner(t *testing.T) crypto.Signer {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	return key
+}
+
+func mustEd25519(t *testing.T) ed25519.PublicKey {
+	t.Helper()
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	return pub
+}
+
+func mustCA(t *testing.T, rsaKey bool) *minica.CA {
+	t.Helper()
+	var opts []minica.Option
+	if rsaKey {
+		opts = append(opts, minica.WithGetSignerFunc(func() (crypto.Signer, error) {
+			return rsa.GenerateKey(rand.Reader, 2048)
+		}))
+	}
+	ca, err := minica.New(opts...)
+	require.NoError(t, err)
+	return ca
+}
+
+func mustWriteFile(t *testing.T, name string, blocks ...*pem.Block) string {
+	t.Helper()
+	var b []byte
+	for _, block := range blocks {
+		b = append(b, pem.EncodeToMemory(block)...)
+	}
+	filename := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(filename, b, 0o600))
+	return filename
+}
+
+func certBlock(crt *x509.Certificate) *pem.Block {
+	return &pem.Block{Type: "CERTIFICATE", Bytes: crt.Raw}
+}
+
+type testFiles struct {
+	crt, clientCrt, clientKey, roots string
+}
+
+// mustFiles writes the chain of the given CA and a client certificate signed
+// by the CA of the server.
+func mustFiles(t *testing.T, ca, serverCA *minica.CA) testFiles {
+	t.Helper()
+	key := mustSigner(t)
+	crt, err := serverCA.Sign(&x509.Certificate{
+		DNSNames:    []string{"client"},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		PublicKey:   key.Public(),
+	})
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+
+	return testFiles{
+		crt:       mustWriteFile(t, "ca.crt", certBlock(ca.Intermediate), certBlock(ca.Root)),
+		clientCrt: mustWriteFile(t, "client.crt", certBlock(crt), certBlock(serverCA.Intermediate)),
+		clientKey: mustWriteFile(t, "client.key", &pem.Block{Type: "PRIVATE KEY", Bytes: der}),
+		roots:     mustWriteFile(t, "roots.crt", certBlock(serverCA.Root)),
+	}
+}
+
+func mustConfig(t *testing.T, v any) json.RawMessage {
+	t.Helper()
+	b, err := json.Marshal(v)
+	require.NoError(t, err)
+	return b
+}
+
+func mustKMIPCAS(t *testing.T, rsaKey bool) (*KMIPCAS, *testServer, *minica.CA) {
+	t.Helper()
+	serverCA := mustCA(t, false)
+	srv := newTestServer(t, serverCA)
+	ca := mustCA(t, rsaKey)
+	srv.setKey("key-1", ca.Signer)
+	files := mustFiles(t, ca, serverCA)
+
+	c, err := New(context.Background(), apiv1.Options{
+		Type:                 apiv1.KMIPCAS,
+		CertificateAuthority: srv.addr,
+		Config: mustConfig(t, Options{
+			KeyID:             "key-1",
+			Certificate:       files.crt,
+			ClientCertificate: files.clientCrt,
+			ClientKey:         files.clientKey,
+			Roots:             files.roots,
+		}),
+	})
+	require.NoError(t, err)
+	return c, srv, ca
+}
+
+func Test_init(t *testing.T) {
+	fn, ok := apiv1.LoadCertificateAuthorityServiceNewFunc(apiv1.KMIPCAS)
+	require.True(t, ok)
+	_, err := fn(context.Background(), apiv1.Options{})
+	assert.EqualError(t, err, "kmipCAS 'certificateAuthority' cannot be empty")
+}
+
+func Test_ttlv(t *testing.T) {
+	b := structure(tagRequestMessage,
+		integer(tagBatchCount, 1),
+		enumeration(tagOperation, operationSign),
+		textString(tagUniqueIdentifier, "key-1"),
+		byteString(tagData, []byte("data")),
+	)
+	assert.Zero(t, len(b)%8)
+
+	it, err := decode(b)
+	require.NoError(t, err)
+	assert.Equal(t, tagRequestMessage, it.tag)
+	assert.Len(t, it.items, 4)
+
+	v, ok := it.find(tagBatchCount)
+	require.True(t, ok)
+	assert.Equal(t, uint32(1), v.uint32())
+	v, ok = it.find(tagOperation)
+	require.True(t, ok)
+	assert.Equal(t, operationSign, v.uint32())
+	v, ok = it.find(tagUniqueIdentifier)
+	require.True(t, ok)
+	assert.Equal(t, "key-1", v.text())
+	v, ok = it.find(tagData)
+	require.True(t, ok)
+	assert.Equal(t, []byte("data"), v.value)
+	_, ok = it.find(tagSignatureData)
+	assert.False(t, ok)
+
+	badLength := integer(tagBatchCount, 1)
+	binary.BigEndian.PutUint32(badLength[4:], 3)
+	badPadding := textString(tagUniqueIdentifier, "key-1")
+	badPadding[len(badPadding)-1] = 1
+	overflow := textString(tagUniqueIdentifier, "key-1")
+	binary.BigEndian.PutUint32(overflow[4:], 0xFFFFFFFF)
+	nested := integer(tagBatchCount, 1)
+	for range maxDepth + 1 {
+		nested = structure(tagBatchItem, nested)
+	}
+
+	tests := []struct {
+		name    string
+		b       []byte
+		wantErr string
+	}{
+		{"fail short", b[:4], "error decoding kmip message: item is too short"},
+		{"fail truncated", b[:len(b)-8], "error decoding kmip message: item 420078 is too long"},
+		{"fail length", badLength, "error decoding kmip message: item 42000D has an invalid length"},
+		{"fail multiple", append(integer(tagBatchCount, 1), integer(tagBatchCount, 1)...), "error decoding kmip message: found 2 items"},
+		{"fail padding", badPadding, "error decoding kmip message: item 420094 has an invalid padding"},
+		{"fail overflow", overflow, "error decoding kmip message: item 420094 is too long"},
+		{"fail nested", nested, "error decoding kmip message: too many nested structures"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := decode(tt.b)
+			assert.EqualError(t, err, tt.wantErr)
+		})
+	}
+}
+
+// encodeItem encodes a decoded item, it is the inverse of decode.
+func encodeItem(it item) []byte {
+	if it.typ != typeStructure {
+		return encode(it.tag, it.typ, it.value)
+	}
+	items := make([][]byte, len(it.items))
+	for i, child := range it.items {
+		items[i] = encodeItem(child)
+	}
+	return structure(it.tag, items...)
+}
+
+func FuzzDecode(f *testing.F) {
+	f.Add(structure(tagResponseMessage,
+		structure(tagResponseHeader,
+			structure(tagProtocolVersion,
+				integer(tagProtocolVersionMajor, 1),
+				integer(tagProtocolVersionMinor, 4),
+			),
+			integer(tagBatchCount, 1),
+		),
+		structure(tagBatchItem,
+			enumeration(tagOperation, operationSign),
+			enumeration(tagResultStatus, resultStatusSuccess),
+			structure(tagResponsePayload,
+				textString(tagUniqueIdentifier, "key-1"),
+				byteString(tagSignatureData, []byte("signature")),
+			),
+		),
+	))
+	f.Add(textString(tagResultMessage, "error"))
+	f.Add(encode(tagTimeStamp, typeDateTime, make([]byte, 8)))
+	f.Add([]byte{0x42, 0x00, 0x94, 0x07, 0xff, 0xff, 0xff, 0xff})
+	f.Add([]byte{0x42, 0x00, 0x0d, 0x02, 0x00, 0x00, 0x00, 0x04})
+
+	f.Fuzz(func(t *testing.T, b []byte) {
+		it, err := decode(b)
+		if err != nil {
+			return
+		}
+		// The decoder only accepts the canonical encoding, the encoding
+		// of a decoded item must be the original message.
+		assert.Equal(t, b, encodeItem(it))
+	})
+}
+
+func TestNew(t *testing.T) {
+	ca := mustCA(t, false)
+	files := mustFiles(t, ca, ca)
+	noRoot := mustWriteFile(t, "noroot.crt", certBlock(ca.Intermediate))
+	ed25519Crt, err := ca.Sign(&x509.Certificate{
+		DNSNames:  []string{"ed25519"},
+		PublicKey: mustEd25519(t),
+	})
+	require.NoError(t, err)
+	ed25519File := mustWriteFile(t, "ed25519.crt", certBlock(ed25519Crt))
+
+	type args struct {
+		ca     string
+		config any
+	}
+	tests := []struct {
+		name     string
+		args     args
+		wantAddr string
+		wantRoot bool
+		wantErr  string
+	}{
+		{"ok", args{"kmip.example.com:5696", Options{KeyID: "key", Certificate: files.crt}}, "kmip.example.com:5696", true, ""},
+		{"ok default port", args{"kmip.example.com", Options{KeyID: "key", Certificate: files.crt}}, "kmip.example.com:5696", true, ""},
+		{"ok client certificate", args{"127.0.0.1:1234", Options{KeyID: "key", Certificate: files.crt, ClientCertificate: files.clientCrt, ClientKey: files.clientKey, Roots: files.roots}}, "127.0.0.1:1234", true, ""},
+		{"ok no root", args{"kmip.example.com", Options{KeyID: "key", Certificate: noRoot}}, "kmip.example.com:5696", false, ""},
+		{"fail certificateAuthority", args{"", Options{KeyID: "key", Certificate: files.crt}}, "", false, "kmipCAS 'certificateAuthority' cannot be empty"},
+		{"fail address", args{":5696", Options{KeyID: "key", Certificate: files.crt}}, "", false, "kmipCAS 'certificateAuthority' is not a valid address"},
+		{"fail config", args{"kmip.example.com", "not an object"}, "", false, "error decoding kmipCAS config: json: cannot unmarshal string into Go value of type kmipcas.Options"},
+		{"fail keyID", args{"kmip.example.com", Options{Certificate: files.crt}}, "", false, "kmipCAS 'config.keyID' cannot be empty"},
+		{"fail crt", args{"kmip.example.com", Options{KeyID: "key"}}, "", false, "kmipCAS 'config.crt' cannot be empty"},
+		{"fail clientKey", args{"kmip.example.com", Options{KeyID: "key", Certificate: files.crt, ClientCertificate: files.clientCrt}}, "", false, "kmipCAS 'config.clientCertificate' and 'config.clientKey' must be set together"},
+		{"fail read crt", args{"kmip.example.com", Options{KeyID: "key", Certificate: "missing.crt"}}, "", false, "error reading kmipCAS certificate"},
+		{"fail read roots", args{"kmip.example.com", Options{KeyID: "key", Certificate: files.crt, Roots: "missing.crt"}}, "", false, "error reading kmipCAS roots"},
+		{"fail parse roots", args{"kmip.example.com", Options{KeyID: "key", Certificate: files.crt, Roots: files.clientKey}}, "", false, "does not contain any certificate"},
+		{"fail client certificate", args{"kmip.example.com", Options{KeyID: "key", Certificate: files.crt, ClientCertificate: files.clientCrt, ClientKey: files.crt}}, "", false, "error reading kmipCAS client certificate"},
+		{"fail key type", args{"kmip.example.com", Options{KeyID: "key", Certificate: ed25519File}}, "", false, "kmipCAS does not support keys of type ed25519.PublicKey"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := New(context.Background(), apiv1.Options{
+				Type:                 apiv1.KMIPCAS,
+				CertificateAuthority: tt.args.ca,
+				Config:               mustConfig(t, tt.args.config),
+			})
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				assert.Nil(t, got)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantAddr, got.client.addr)
+			assert.Equal(t, ca.Intermediate, got.certificate)
+			assert.Empty(t, got.intermediates)
+			if tt.wantRoot {
+				assert.Equal(t, ca.Root, got.root)
+			} else {
+				assert.Nil(t, got.root)
+			}
+			assert.Equal(t, apiv1.Type(apiv1.KMIPCAS), got.Type())
+		})
+	}
+}
+
+func TestKMIPCAS_CreateCertificate(t *testing.T) {
+	tests := []struct {
+		name   string
+		rsaKey bool
+		raw    bool
+	}{
+		{"ok ecdsa", false, false},
+		{"ok ecdsa raw", false, true},
+		{"ok rsa", true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, srv, ca := mustKMIPCAS(t, tt.rsaKey)
+			srv.mu.Lock()
+			srv.raw = tt.raw
+			srv.mu.Unlock()
+
+			pub := mustSigner(t).Public()
+			resp, err := c.CreateCertificate(&apiv1.CreateCertificateRequest{
+				Template: &x509.Certificate{
+					DNSNames:  []string{"leaf.example.com"},
+					PublicKey: pub,
+				},
+				Lifetime: time.Hour,
+			})
+			require.NoError(t, err)
+			assert.NoError(t, resp.Certificate.CheckSignatureFrom(ca.Intermediate))
+			assert.Equal(t, []*x509.Certificate{ca.Intermediate}, resp.CertificateChain)
+
+			renew, err := c.RenewCertificate(&apiv1.RenewCertificateRequest{
+				Template: &x509.Certificate{
+					DNSNames:  []string{"leaf.example.com"},
+					PublicKey: pub,
+				},
+				Lifetime: time.Hour,
+			})
+			require.NoError(t, err)
+			assert.NoError(t, renew.Certificate.CheckSignatureFrom(ca.Intermediate))
+
+			revoke, err := c.RevokeCertificate(&apiv1.RevokeCertificateRequest{
+				Certificate: resp.Certificate,
+			})
+			require.NoError(t, err)
+			assert.Equal(t, resp.Certificate, revoke.Certificate)
+
+			signer, err := c.GetSigner()
+			require.NoError(t, err)
+			assert.Equal(t, ca.Intermediate.PublicKey, signer.Public())
+		})
+	}
+}
+
+func TestKMIPCAS_GetCertificateAuthority(t *testing.T) {
+	c, _, ca := mustKMIPCAS(t, false)
+	resp, err := c.GetCertificateAuthority(&apiv1.GetCertificateAuthorityRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, ca.Root, resp.RootCertificate)
+	assert.Equal(t, []*x509.Certificate{ca.Intermediate}, resp.IntermediateCertificates)
+	assert.Equal(t, apiv1.NewCertificateAuthorityMetadata(ca.Intermediate), resp.Metadata)
+
+	c.root = nil
+	_, err = c.GetCertificateAuthority(&apiv1.GetCertificateAuthorityRequest{})
+	assert.EqualError(t, err, "kmipCAS 'config.crt' does not contain a root certificate")
+}
+
+func TestKMIPCAS_CheckHealth(t *testing.T) {
+	c, srv, _ := mustKMIPCAS(t, true)
+	ctx := context.Background()
+	assert.NoError(t, c.CheckHealth(ctx))
+
+	// Key does not match the certificate.
+	srv.setKey("key-1", mustSigner(t))
+	assert.ErrorContains(t, c.CheckHealth(ctx), "kmipCAS Sign failed: kmip operation failed with status 0x1 and reason 0x1: invalid cryptographic parameters")
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	srv.setKey("key-1", rsaKey)
+	assert.ErrorContains(t, c.CheckHealth(ctx), "kmipCAS key does not match the certificate")
+
+	// Key not found.
+	srv.mu.Lock()
+	delete(srv.keys, "key-1")
+	srv.mu.Unlock()
+	err = c.CheckHealth(ctx)
+	assert.EqualError(t, err, "kmipCAS Sign failed: kmip operation failed with status 0x1 and reason 0x1: key not found")
+	var re *resultError
+	assert.True(t, errors.As(err, &re))
+}
+
+func TestKMIPCAS_reconnect(t *testing.T) {
+	c, srv, _ := mustKMIPCAS(t, false)
+	ctx := context.Background()
+	require.NoError(t, c.CheckHealth(ctx))
+	require.NoError(t, c.CheckHealth(ctx))
+	srv.mu.Lock()
+	assert.Equal(t, 1, srv.conns)
+	srv.close = true
+	srv.mu.Unlock()
+
+	// The server closes the connection after each response.
+	require.NoError(t, c.CheckHealth(ctx))
+	require.NoError(t, c.CheckHealth(ctx))
+	require.NoError(t, c.CheckHealth(ctx))
+	srv.mu.Lock()
+	assert.Equal(t, 3, srv.conns)
+	srv.mu.Unlock()
+}
+
+func TestKMIPCAS_CheckHealth_unavailable(t *testing.T) {
+	ca := mustCA(t, false)
+	files := mustFiles(t, ca, ca)
+	c, err := New(context.Background(), apiv1.Options{
+		Type:                 apiv1.KMIPCAS,
+		CertificateAuthority: "127.0.0.1:1",
+		Config:               mustConfig(t, Options{KeyID: "key", Certificate: files.crt}),
+	})
+	require.NoError(t, err)
+	assert.ErrorContains(t, c.CheckHealth(context.Background()), "kmipCAS Sign failed: error connecting to kmip server")
+}
+
+func Test_signer_Sign(t *testing.T) {
+	s, err := newSigner(nil, "key", mustSigner(t).Public())
+	require.NoError(t, err)
+	_, err = s.Sign(rand.Reader, make([]byte, 32), &rsa.PSSOptions{Hash: crypto.SHA256})
+	assert.EqualError(t, err, "kmipCAS does not support RSA-PSS signatures")
+	_, err = s.Sign(rand.Reader, make([]byte, 20), crypto.SHA256)
+	assert.EqualError(t, err, "kmipCAS digest size does not match the hash function SHA-256")
+	_, err = s.Sign(rand.Reader, make([]byte, 32), crypto.Hash(0))
+	assert.Error(t, err)
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	s, err = newSigner(nil, "key", key.Public())
+	require.NoError(t, err)
+	_, err = s.Sign(rand.Reader, make([]byte, 20), crypto.SHA1)
+	assert.EqualError(t, err, "kmipCAS does not support hash function SHA-1")
+}
@@ -0,0 +1,114 @@
+package kmipcas
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+
+	"golang.org/x/crypto/cryptobyte"
+	"golang.org/x/crypto/cryptobyte/asn1"
+)
+
+// digestInfoPrefixes are the DER encoded DigestInfo prefixes used in RSA
+// PKCS #1 v1.5 signatures.
+var digestInfoPrefixes = map[crypto.Hash][]byte{
+	crypto.SHA256: {0x30, 0x31, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x01, 0x05, 0x00, 0x04, 0x20},
+	crypto.SHA384: {0x30, 0x41, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x02, 0x05, 0x00, 0x04, 0x30},
+	crypto.SHA512: {0x30, 0x51, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x03, 0x05, 0x00, 0x04, 0x40},
+}
+
+// signer implements a crypto.Signer using a private key stored in a KMIP
+// server. The digest is signed by the server without hashing it again, for
+// RSA keys the server adds the PKCS #1 v1.5 padding to the DigestInfo.
+type signer struct {
+	client    *client
+	keyID     string
+	publicKey crypto.PublicKey
+}
+
+func newSigner(c *client, keyID string, pub crypto.PublicKey) (*signer, error) {
+	switch pub.(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey:
+		return &signer{
+			client:    c,
+			keyID:     keyID,
+			publicKey: pub,
+		}, nil
+	default:
+		return nil, fmt.Errorf("kmipCAS does not support keys of type %T", pub)
+	}
+}
+
+// Public returns the public key of the certificate.
+func (s *signer) Public() crypto.PublicKey {
+	return s.publicKey
+}
+
+// Sign signs the given digest using the KMIP Sign operation. RSA-PSS
+// signatures are not supported.
+func (s *signer) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	defer cancel()
+	return s.sign(ctx, digest, opts)
+}
+
+func (s *signer) sign(ctx context.Context, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	if _, ok := opts.(*rsa.PSSOptions); ok {
+		return nil, errors.New("kmipCAS does not support RSA-PSS signatures")
+	}
+	if h := opts.HashFunc(); h == 0 || len(digest) != h.Size() {
+		return nil, fmt.Errorf("kmipCAS digest size does not match the hash function %s", h)
+	}
+
+	switch pub := s.publicKey.(type) {
+	case *rsa.PublicKey:
+		prefix, ok := digestInfoPrefixes[opts.HashFunc()]
+		if !ok {
+			return nil, fmt.Errorf("kmipCAS does not support hash function %s", opts.HashFunc())
+		}
+		data := append(append([]byte{}, prefix...), digest...)
+		return s.client.Sign(ctx, s.keyID, cryptographicAlgorithmRSA, paddingMethodPKCS1v15, data)
+	case *ecdsa.PublicKey:
+		sig, err := s.client.Sign(ctx, s.keyID, cryptographicAlgorithmECDSA, 0, digest)
+		if err != nil {
+			return nil, err
+		}
+		return ecdsaSignature(pub, sig)
+	default:
+		return nil, fmt.Errorf("kmipCAS does not support keys of type %T", pub)
+	}
+}
+
+// ecdsaSignature returns the ASN.1 encoding of an ECDSA signature. Some KMIP
+// servers return the signature as the concatenation of r and s, the rest
+// already return the ASN.1 encoding.
+func ecdsaSignature(pub *ecdsa.PublicKey, sig []byte) ([]byte, error) {
+	size := (pub.Curve.Params().BitSize + 7) / 8
+	if len(sig) != 2*size || isASN1Signature(sig) {
+		return sig, nil
+	}
+
+	r := new(big.Int).SetBytes(sig[:size])
+	s := new(big.Int).SetBytes(sig[size:])
+	var b cryptobyte.Builder
+	b.AddASN1(asn1.SEQUENCE, func(b *cryptobyte.Builder) {
+		b.AddASN1BigInt(r)
+		b.AddASN1BigInt(s)
+	})
+	return b.Bytes()
+}
+
+// isASN1Signature returns true if the signature is an ASN.1 sequence of two
+// integers.
+func isASN1Signature(sig []byte) bool {
+	var inner cryptobyte.String
+	input := cryptobyte.String(sig)
+	r, s := new(big.Int), new(big.Int)
+	return input.ReadASN1(&inner, asn1.SEQUENCE) && input.Empty() &&
+		inner.ReadASN1Integer(r) && inner.ReadASN1Integer(s) && inner.Empty()
+}
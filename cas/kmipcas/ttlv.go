@@ -0,0 +1,213 @@
+package kmipcas
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// KMIP tags used in the requests and responses.
+const (
+	tagBatchCount              uint32 = 0x42000D
+	tagBatchItem               uint32 = 0x42000F
+	tagCryptographicAlgorithm  uint32 = 0x420028
+	tagCryptographicParameters uint32 = 0x42002B
+	tagOperation               uint32 = 0x42005C
+	tagPaddingMethod           uint32 = 0x42005F
+	tagProtocolVersion         uint32 = 0x420069
+	tagProtocolVersionMajor    uint32 = 0x42006A
+	tagProtocolVersionMinor    uint32 = 0x42006B
+	tagRequestHeader           uint32 = 0x420077
+	tagRequestMessage          uint32 = 0x420078
+	tagRequestPayload          uint32 = 0x420079
+	tagResponseHeader          uint32 = 0x42007A
+	tagResponseMessage         uint32 = 0x42007B
+	tagResponsePayload         uint32 = 0x42007C
+	tagResultMessage           uint32 = 0x42007D
+	tagResultReason            uint32 = 0x42007E
+	tagResultStatus            uint32 = 0x42007F
+	tagTimeStamp               uint32 = 0x420092
+	tagUniqueIdentifier        uint32 = 0x420094
+	tagData                    uint32 = 0x4200C2
+	tagSignatureData           uint32 = 0x4200C3
+)
+
+// KMIP item types.
+const (
+	typeStructure   byte = 0x01
+	typeInteger     byte = 0x02
+	typeLongInteger byte = 0x03
+	typeBigInteger  byte = 0x04
+	typeEnumeration byte = 0x05
+	typeBoolean     byte = 0x06
+	typeTextString  byte = 0x07
+	typeByteString  byte = 0x08
+	typeDateTime    byte = 0x09
+	typeInterval    byte = 0x0A
+)
+
+// KMIP enumeration values.
+const (
+	operationSign uint32 = 0x21
+
+	resultStatusSuccess uint32 = 0x00
+
+	cryptographicAlgorithmRSA   uint32 = 0x04
+	cryptographicAlgorithmECDSA uint32 = 0x06
+
+	paddingMethodPKCS1v15 uint32 = 0x08
+)
+
+// maxMessageSize is the maximum size of a KMIP response.
+const maxMessageSize = 1 << 20
+
+// maxDepth is the maximum nesting of structures in a KMIP response.
+const maxDepth = 16
+
+// item is a decoded TTLV (tag, type, length, value) item. The items of a
+// structure are stored in items, the value of other types in value.
+type item struct {
+	tag   uint32
+	typ   byte
+	value []byte
+	items []item
+}
+
+// structure encodes a KMIP structure with the given encoded items.
+func structure(tag uint32, items ...[]byte) []byte {
+	var value []byte
+	for _, it := range items {
+		value = append(value, it...)
+	}
+	return encode(tag, typeStructure, value)
+}
+
+// integer encodes a KMIP integer.
+func integer(tag uint32, v int32) []byte {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, uint32(v))
+	return encode(tag, typeInteger, b)
+}
+
+// enumeration encodes a KMIP enumeration.
+func enumeration(tag, v uint32) []byte {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, v)
+	return encode(tag, typeEnumeration, b)
+}
+
+// textString encodes a KMIP text string.
+func textString(tag uint32, s string) []byte {
+	return encode(tag, typeTextString, []byte(s))
+}
+
+// byteString encodes a KMIP byte string.
+func byteString(tag uint32, b []byte) []byte {
+	return encode(tag, typeByteString, b)
+}
+
+// encode returns the TTLV encoding of the given value, the value is padded
+// to a multiple of 8 bytes.
+func encode(tag uint32, typ byte, value []byte) []byte {
+	padding := (8 - len(value)%8) % 8
+	b := make([]byte, 8, 8+len(value)+padding)
+	b[0], b[1], b[2] = byte(tag>>16), byte(tag>>8), byte(tag)
+	b[3] = typ
+	binary.BigEndian.PutUint32(b[4:], uint32(len(value)))
+	b = append(b, value...)
+	return append(b, make([]byte, padding)...)
+}
+
+// decode decodes a single TTLV item. It fails if there are trailing bytes.
+func decode(b []byte) (item, error) {
+	items, err := decodeItems(b, 0)
+	if err != nil {
+		return item{}, err
+	}
+	if len(items) != 1 {
+		return item{}, fmt.Errorf("error decoding kmip message: found %d items", len(items))
+	}
+	return items[0], nil
+}
+
+// decodeItems decodes a sequence of TTLV items, depth is the number of
+// enclosing structures.
+func decodeItems(b []byte, depth int) ([]item, error) {
+	if depth > maxDepth {
+		return nil, errors.New("error decoding kmip message: too many nested structures")
+	}
+	var items []item
+	for len(b) > 0 {
+		if len(b) < 8 {
+			return nil, errors.New("error decoding kmip message: item is too short")
+		}
+		it := item{
+			tag: uint32(b[0])<<16 | uint32(b[1])<<8 | uint32(b[2]),
+			typ: b[3],
+		}
+		// The length is not converted to an int, adding the padding to it
+		// would overflow on 32-bit platforms.
+		length := uint64(binary.BigEndian.Uint32(b[4:8]))
+		padded := length + (8-length%8)%8
+		if padded > uint64(len(b)-8) {
+			return nil, fmt.Errorf("error decoding kmip message: item %06X is too long", it.tag)
+		}
+		value := b[8 : 8+length]
+		switch it.typ {
+		case typeStructure:
+			children, err := decodeItems(value, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			it.items = children
+		case typeInteger, typeEnumeration, typeInterval:
+			if length != 4 {
+				return nil, fmt.Errorf("error decoding kmip message: item %06X has an invalid length", it.tag)
+			}
+			it.value = value
+		case typeLongInteger, typeBoolean, typeDateTime:
+			if length != 8 {
+				return nil, fmt.Errorf("error decoding kmip message: item %06X has an invalid length", it.tag)
+			}
+			it.value = value
+		case typeBigInteger:
+			if length == 0 || length%8 != 0 {
+				return nil, fmt.Errorf("error decoding kmip message: item %06X has an invalid length", it.tag)
+			}
+			it.value = value
+		default:
+			it.value = value
+		}
+		for _, v := range b[8+length : 8+padded] {
+			if v != 0 {
+				return nil, fmt.Errorf("error decoding kmip message: item %06X has an invalid padding", it.tag)
+			}
+		}
+		items = append(items, it)
+		b = b[8+padded:]
+	}
+	return items, nil
+}
+
+// find returns the first child item with the given tag.
+func (it item) find(tag uint32) (item, bool) {
+	for _, i := range it.items {
+		if i.tag == tag {
+			return i, true
+		}
+	}
+	return item{}, false
+}
+
+// uint32 returns the value of an integer or enumeration.
+func (it item) uint32() uint32 {
+	if len(it.value) != 4 {
+		return 0
+	}
+	return binary.BigEndian.Uint32(it.value)
+}
+
+// text returns the value of a text string.
+func (it item) text() string {
+	return string(it.value)
+}
@@ -0,0 +1,118 @@
+package mockcas
+
+import (
+	"crypto"
+	"fmt"
+	"sync"
+
+	"github.com/pkg/errors"
+	"go.step.sm/crypto/keyutil"
+	kmsapi "go.step.sm/crypto/kms/apiv1"
+)
+
+// KMS is a fake key manager that keeps the keys in memory. It implements the
+// kms.KeyManager interface and can be used with the CAS implementations and
+// the authority.
+type KMS struct {
+	mu   sync.Mutex
+	keys map[string]crypto.Signer
+}
+
+// NewKMS creates a new fake key manager.
+func NewKMS() *KMS {
+	return &KMS{
+		keys: make(map[string]crypto.Signer),
+	}
+}
+
+// AddKey adds the given signer to the key manager with the given name.
+func (k *KMS) AddKey(name string, signer crypto.Signer) {
+	k.mu.Lock()
+	k.keys[name] = signer
+	k.mu.Unlock()
+}
+
+// GetPublicKey returns the public key of the key with the given name.
+func (k *KMS) GetPublicKey(req *kmsapi.GetPublicKeyRequest) (crypto.PublicKey, error) {
+	signer, err := k.getKey(req.Name)
+	if err != nil {
+		return nil, err
+	}
+	return signer.Public(), nil
+}
+
+// CreateKey generates a new key in memory and stores it with the given name.
+func (k *KMS) CreateKey(req *kmsapi.CreateKeyRequest) (*kmsapi.CreateKeyResponse, error) {
+	if req.Name == "" {
+		return nil, errors.New("createKeyRequest 'name' cannot be empty")
+	}
+
+	kty, crv, size, err := keyParameters(req)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := keyutil.GenerateSigner(kty, crv, size)
+	if err != nil {
+		return nil, err
+	}
+
+	k.AddKey(req.Name, signer)
+	return &kmsapi.CreateKeyResponse{
+		Name:       req.Name,
+		PublicKey:  signer.Public(),
+		PrivateKey: signer,
+		CreateSignerRequest: kmsapi.CreateSignerRequest{
+			SigningKey: req.Name,
+		},
+	}, nil
+}
+
+// CreateSigner returns the signer with the given name, or the signer in the
+// request if set.
+func (k *KMS) CreateSigner(req *kmsapi.CreateSignerRequest) (crypto.Signer, error) {
+	if req.Signer != nil {
+		return req.Signer, nil
+	}
+	return k.getKey(req.SigningKey)
+}
+
+// Close implements the kms.KeyManager interface.
+func (k *KMS) Close() error {
+	return nil
+}
+
+func (k *KMS) getKey(name string) (crypto.Signer, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	signer, ok := k.keys[name]
+	if !ok {
+		return nil, kmsapi.NotFoundError{
+			Message: fmt.Sprintf("key %q not found", name),
+		}
+	}
+	return signer, nil
+}
+
+func keyParameters(req *kmsapi.CreateKeyRequest) (kty, crv string, size int, err error) {
+	switch req.SignatureAlgorithm {
+	case kmsapi.UnspecifiedSignAlgorithm, kmsapi.ECDSAWithSHA256:
+		return "EC", "P-256", 0, nil
+	case kmsapi.ECDSAWithSHA384:
+		return "EC", "P-384", 0, nil
+	case kmsapi.ECDSAWithSHA512:
+		return "EC", "P-521", 0, nil
+	case kmsapi.PureEd25519:
+		return "OKP", "Ed25519", 0, nil
+	case kmsapi.SHA256WithRSA, kmsapi.SHA384WithRSA, kmsapi.SHA512WithRSA,
+		kmsapi.SHA256WithRSAPSS, kmsapi.SHA384WithRSAPSS, kmsapi.SHA512WithRSAPSS:
+		size = req.Bits
+		if size == 0 {
+			size = 3072
+		}
+		return "RSA", "", size, nil
+	default:
+		return "", "", 0, errors.Errorf("createKeyRequest 'signatureAlgorithm=%s' is not supported", req.SignatureAlgorithm)
+	}
+}
+
+var _ kmsapi.KeyManager = (*KMS)(nil)
@@ -0,0 +1,59 @@
+package mockcas
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.step.sm/crypto/keyutil"
+	kmsapi "go.step.sm/crypto/kms/apiv1"
+)
+
+func TestKMS(t *testing.T) {
+	k := NewKMS()
+	t.Cleanup(func() {
+		assert.NoError(t, k.Close())
+	})
+
+	resp, err := k.CreateKey(&kmsapi.CreateKeyRequest{Name: "ec"})
+	require.NoError(t, err)
+	if assert.IsType(t, &ecdsa.PublicKey{}, resp.PublicKey) {
+		assert.Equal(t, elliptic.P256(), resp.PublicKey.(*ecdsa.PublicKey).Curve)
+	}
+
+	pub, err := k.GetPublicKey(&kmsapi.GetPublicKeyRequest{Name: "ec"})
+	require.NoError(t, err)
+	assert.Equal(t, resp.PublicKey, pub)
+
+	signer, err := k.CreateSigner(&resp.CreateSignerRequest)
+	require.NoError(t, err)
+	assert.Equal(t, resp.PublicKey, signer.Public())
+
+	resp, err = k.CreateKey(&kmsapi.CreateKeyRequest{Name: "rsa", SignatureAlgorithm: kmsapi.SHA256WithRSAPSS, Bits: 2048})
+	require.NoError(t, err)
+	if assert.IsType(t, &rsa.PublicKey{}, resp.PublicKey) {
+		assert.Equal(t, 2048, resp.PublicKey.(*rsa.PublicKey).N.BitLen())
+	}
+
+	resp, err = k.CreateKey(&kmsapi.CreateKeyRequest{Name: "ed25519", SignatureAlgorithm: kmsapi.PureEd25519})
+	require.NoError(t, err)
+	assert.IsType(t, ed25519.PublicKey{}, resp.PublicKey)
+
+	existing, err := keyutil.GenerateDefaultSigner()
+	require.NoError(t, err)
+	k.AddKey("existing", existing)
+	signer, err = k.CreateSigner(&kmsapi.CreateSignerRequest{SigningKey: "existing"})
+	require.NoError(t, err)
+	assert.Equal(t, existing, signer)
+
+	_, err = k.GetPublicKey(&kmsapi.GetPublicKeyRequest{Name: "missing"})
+	assert.ErrorIs(t, err, kmsapi.NotFoundError{})
+	_, err = k.CreateKey(&kmsapi.CreateKeyRequest{})
+	assert.Error(t, err)
+	_, err = k.CreateKey(&kmsapi.CreateKeyRequest{Name: "foo", SignatureAlgorithm: kmsapi.SignatureAlgorithm(100)})
+	assert.Error(t, err)
+}
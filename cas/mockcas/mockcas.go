@@ -0,0 +1,276 @@
+// Package mockcas implements an in-memory CertificateAuthorityService that can
+// be used in unit tests, along with a fake key manager and provisioners with
+// their credentials.
+//
+// The CAS records all the requests it receives and, by default, signs the
+// certificates with a deterministic Ed25519 root and intermediate, so tests
+// don't need to create any key material. The responses can be replaced using
+// the Mock functions.
+//
+// The package is meant to be used in tests only, the keys it generates are
+// kept in memory and the helpers that take a testing.TB fail the test on
+// error.
+package mockcas
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.step.sm/crypto/x509util"
+
+	"github.com/smallstep/certificates/cas/apiv1"
+)
+
+var (
+	rootSeed         = []byte("smallstep mockcas root key seed.")[:ed25519.SeedSize]
+	intermediateSeed = []byte("smallstep mockcas issuer key seed")[:ed25519.SeedSize]
+	notBefore        = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	notAfter         = time.Date(9999, 12, 31, 23, 59, 59, 0, time.UTC)
+)
+
+// now is used for testing purposes.
+var now = time.Now
+
+// CAS is an in-memory CertificateAuthorityService. The zero value is ready to
+// use and it's safe for concurrent use.
+type CAS struct {
+	// MockCreateCertificate, if set, is used to create the response of
+	// CreateCertificate.
+	MockCreateCertificate func(req *apiv1.CreateCertificateRequest) (*apiv1.CreateCertificateResponse, error)
+	// MockRenewCertificate, if set, is used to create the response of
+	// RenewCertificate.
+	MockRenewCertificate func(req *apiv1.RenewCertificateRequest) (*apiv1.RenewCertificateResponse, error)
+	// MockRevokeCertificate, if set, is used to create the response of
+	// RevokeCertificate.
+	MockRevokeCertificate func(req *apiv1.RevokeCertificateRequest) (*apiv1.RevokeCertificateResponse, error)
+
+	once         sync.Once
+	root         *x509.Certificate
+	intermediate *x509.Certificate
+	signer       ed25519.PrivateKey
+	initErr      error
+
+	mu             sync.Mutex
+	serial         int64
+	createRequests []*apiv1.CreateCertificateRequest
+	renewRequests  []*apiv1.RenewCertificateRequest
+	revokeRequests []*apiv1.RevokeCertificateRequest
+}
+
+// New returns a new CAS.
+func New() *CAS {
+	return &CAS{}
+}
+
+// Type returns the type of this CertificateAuthorityService.
+func (c *CAS) Type() apiv1.Type {
+	return apiv1.Type("mockcas")
+}
+
+// Root returns the root certificate used by default to sign certificates.
+func (c *CAS) Root() (*x509.Certificate, error) {
+	if err := c.init(); err != nil {
+		return nil, err
+	}
+	return c.root, nil
+}
+
+// Intermediate returns the intermediate certificate used by default to sign
+// certificates.
+func (c *CAS) Intermediate() (*x509.Certificate, error) {
+	if err := c.init(); err != nil {
+		return nil, err
+	}
+	return c.intermediate, nil
+}
+
+// CreateCertificateRequests returns the requests received by
+// CreateCertificate.
+func (c *CAS) CreateCertificateRequests() []*apiv1.CreateCertificateRequest {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]*apiv1.CreateCertificateRequest(nil), c.createRequests...)
+}
+
+// RenewCertificateRequests returns the requests received by RenewCertificate.
+func (c *CAS) RenewCertificateRequests() []*apiv1.RenewCertificateRequest {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]*apiv1.RenewCertificateRequest(nil), c.renewRequests...)
+}
+
+// RevokeCertificateRequests returns the requests received by
+// RevokeCertificate.
+func (c *CAS) RevokeCertificateRequests() []*apiv1.RevokeCertificateRequest {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]*apiv1.RevokeCertificateRequest(nil), c.revokeRequests...)
+}
+
+// Reset removes the recorded requests and restarts the serial numbers.
+func (c *CAS) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.serial = 0
+	c.createRequests = nil
+	c.renewRequests = nil
+	c.revokeRequests = nil
+}
+
+// CreateCertificate records the request and signs the template in it.
+// Templates without a serial number get sequential serial numbers starting at
+// 1.
+func (c *CAS) CreateCertificate(req *apiv1.CreateCertificateRequest) (*apiv1.CreateCertificateResponse, error) {
+	c.mu.Lock()
+	c.createRequests = append(c.createRequests, req)
+	c.mu.Unlock()
+
+	if c.MockCreateCertificate != nil {
+		return c.MockCreateCertificate(req)
+	}
+
+	switch {
+	case req.Template == nil:
+		return nil, errors.New("createCertificateRequest `template` cannot be nil")
+	case req.Lifetime == 0:
+		return nil, errors.New("createCertificateRequest `lifetime` cannot be 0")
+	}
+
+	t := now()
+	if req.Template.NotBefore.IsZero() {
+		req.Template.NotBefore = t.Add(-1 * req.Backdate)
+	}
+	if req.Template.NotAfter.IsZero() {
+		req.Template.NotAfter = t.Add(req.Lifetime)
+	}
+
+	cert, err := c.sign(req.Template)
+	if err != nil {
+		return nil, err
+	}
+
+	return &apiv1.CreateCertificateResponse{
+		Certificate:      cert,
+		CertificateChain: []*x509.Certificate{c.intermediate},
+	}, nil
+}
+
+// RenewCertificate records the request and signs the template in it.
+func (c *CAS) RenewCertificate(req *apiv1.RenewCertificateRequest) (*apiv1.RenewCertificateResponse, error) {
+	c.mu.Lock()
+	c.renewRequests = append(c.renewRequests, req)
+	c.mu.Unlock()
+
+	if c.MockRenewCertificate != nil {
+		return c.MockRenewCertificate(req)
+	}
+
+	switch {
+	case req.Template == nil:
+		return nil, errors.New("renewCertificateRequest `template` cannot be nil")
+	case req.Lifetime == 0:
+		return nil, errors.New("renewCertificateRequest `lifetime` cannot be 0")
+	}
+
+	t := now()
+	req.Template.NotBefore = t.Add(-1 * req.Backdate)
+	req.Template.NotAfter = t.Add(req.Lifetime)
+
+	cert, err := c.sign(req.Template)
+	if err != nil {
+		return nil, err
+	}
+
+	return &apiv1.RenewCertificateResponse{
+		Certificate:      cert,
+		CertificateChain: []*x509.Certificate{c.intermediate},
+	}, nil
+}
+
+// RevokeCertificate records the request and returns the certificate in it.
+func (c *CAS) RevokeCertificate(req *apiv1.RevokeCertificateRequest) (*apiv1.RevokeCertificateResponse, error) {
+	c.mu.Lock()
+	c.revokeRequests = append(c.revokeRequests, req)
+	c.mu.Unlock()
+
+	if c.MockRevokeCertificate != nil {
+		return c.MockRevokeCertificate(req)
+	}
+
+	if err := c.init(); err != nil {
+		return nil, err
+	}
+
+	return &apiv1.RevokeCertificateResponse{
+		Certificate:      req.Certificate,
+		CertificateChain: []*x509.Certificate{c.intermediate},
+	}, nil
+}
+
+// GetCertificateAuthority returns the root and intermediate certificates used
+// by default to sign certificates.
+func (c *CAS) GetCertificateAuthority(*apiv1.GetCertificateAuthorityRequest) (*apiv1.GetCertificateAuthorityResponse, error) {
+	if err := c.init(); err != nil {
+		return nil, err
+	}
+	return &apiv1.GetCertificateAuthorityResponse{
+		RootCertificate:          c.root,
+		IntermediateCertificates: []*x509.Certificate{c.intermediate},
+		Metadata:                 apiv1.NewCertificateAuthorityMetadata(c.intermediate),
+	}, nil
+}
+
+// sign signs the template with the intermediate key.
+func (c *CAS) sign(template *x509.Certificate) (*x509.Certificate, error) {
+	if err := c.init(); err != nil {
+		return nil, err
+	}
+	if template.SerialNumber == nil {
+		c.mu.Lock()
+		c.serial++
+		template.SerialNumber = big.NewInt(c.serial)
+		c.mu.Unlock()
+	}
+	return x509util.CreateCertificate(template, c.intermediate, template.PublicKey, c.signer)
+}
+
+// init creates the root and intermediate certificates. Ed25519 signatures are
+// deterministic, so the certificates are always the same.
+func (c *CAS) init() error {
+	c.once.Do(func() {
+		rootKey := ed25519.NewKeyFromSeed(rootSeed)
+		c.signer = ed25519.NewKeyFromSeed(intermediateSeed)
+
+		root := &x509.Certificate{
+			Subject:               pkix.Name{CommonName: "Mock Root CA"},
+			SerialNumber:          big.NewInt(1),
+			NotBefore:             notBefore,
+			NotAfter:              notAfter,
+			KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+			BasicConstraintsValid: true,
+			IsCA:                  true,
+			MaxPathLen:            1,
+		}
+		if c.root, c.initErr = x509util.CreateCertificate(root, root, rootKey.Public(), rootKey); c.initErr != nil {
+			return
+		}
+
+		intermediate := &x509.Certificate{
+			Subject:               pkix.Name{CommonName: "Mock Intermediate CA"},
+			SerialNumber:          big.NewInt(2),
+			NotBefore:             notBefore,
+			NotAfter:              notAfter,
+			KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+			BasicConstraintsValid: true,
+			IsCA:                  true,
+			MaxPathLenZero:        true,
+		}
+		c.intermediate, c.initErr = x509util.CreateCertificate(intermediate, c.root, c.signer.Public(), rootKey)
+	})
+	return c.initErr
+}
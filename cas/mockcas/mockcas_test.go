@@ -0,0 +1,217 @@
+package mockcas
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/smallstep/certificates/cas/apiv1"
+)
+
+var _ apiv1.CertificateAuthorityService = (*CAS)(nil)
+var _ apiv1.CertificateAuthorityGetter = (*CAS)(nil)
+
+func mockNow(t *testing.T) time.Time {
+	t.Helper()
+	tmp := now
+	t.Cleanup(func() {
+		now = tmp
+	})
+	n := time.Unix(1700000000, 0).UTC()
+	now = func() time.Time {
+		return n
+	}
+	return n
+}
+
+func newTemplate(t *testing.T, cn string) *x509.Certificate {
+	t.Helper()
+	pub, _, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	return &x509.Certificate{
+		Subject:   pkix.Name{CommonName: cn},
+		DNSNames:  []string{cn},
+		PublicKey: pub,
+	}
+}
+
+func TestCAS_deterministic(t *testing.T) {
+	c1, c2 := New(), new(CAS)
+
+	root1, err := c1.Root()
+	require.NoError(t, err)
+	root2, err := c2.Root()
+	require.NoError(t, err)
+	assert.Equal(t, root1.Raw, root2.Raw)
+
+	intermediate1, err := c1.Intermediate()
+	require.NoError(t, err)
+	intermediate2, err := c2.Intermediate()
+	require.NoError(t, err)
+	assert.Equal(t, intermediate1.Raw, intermediate2.Raw)
+	assert.NoError(t, intermediate1.CheckSignatureFrom(root1))
+
+	resp, err := c1.GetCertificateAuthority(&apiv1.GetCertificateAuthorityRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, &apiv1.GetCertificateAuthorityResponse{
+		RootCertificate:          root1,
+		IntermediateCertificates: []*x509.Certificate{intermediate1},
+		Metadata:                 apiv1.NewCertificateAuthorityMetadata(intermediate1),
+	}, resp)
+}
+
+func TestCAS_CreateCertificate(t *testing.T) {
+	n := mockNow(t)
+	c := New()
+	root, err := c.Root()
+	require.NoError(t, err)
+	intermediate, err := c.Intermediate()
+	require.NoError(t, err)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(root)
+	intermediates := x509.NewCertPool()
+	intermediates.AddCert(intermediate)
+
+	for i := 1; i <= 2; i++ {
+		req := &apiv1.CreateCertificateRequest{
+			Template: newTemplate(t, "test.smallstep.com"),
+			Lifetime: time.Hour,
+			Backdate: time.Minute,
+		}
+		resp, err := c.CreateCertificate(req)
+		require.NoError(t, err)
+		assert.Equal(t, big.NewInt(int64(i)), resp.Certificate.SerialNumber)
+		assert.Equal(t, n.Add(-time.Minute), resp.Certificate.NotBefore)
+		assert.Equal(t, n.Add(time.Hour), resp.Certificate.NotAfter)
+		assert.Equal(t, []*x509.Certificate{intermediate}, resp.CertificateChain)
+
+		_, err = resp.Certificate.Verify(x509.VerifyOptions{
+			DNSName:       "test.smallstep.com",
+			Roots:         roots,
+			Intermediates: intermediates,
+			CurrentTime:   n,
+		})
+		assert.NoError(t, err)
+	}
+
+	reqs := c.CreateCertificateRequests()
+	assert.Len(t, reqs, 2)
+
+	c.Reset()
+	assert.Empty(t, c.CreateCertificateRequests())
+	resp, err := c.CreateCertificate(&apiv1.CreateCertificateRequest{
+		Template: newTemplate(t, "test.smallstep.com"),
+		Lifetime: time.Hour,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, big.NewInt(1), resp.Certificate.SerialNumber)
+}
+
+func TestCAS_CreateCertificate_fail(t *testing.T) {
+	c := New()
+	_, err := c.CreateCertificate(&apiv1.CreateCertificateRequest{Lifetime: time.Hour})
+	assert.EqualError(t, err, "createCertificateRequest `template` cannot be nil")
+	_, err = c.CreateCertificate(&apiv1.CreateCertificateRequest{Template: newTemplate(t, "test")})
+	assert.EqualError(t, err, "createCertificateRequest `lifetime` cannot be 0")
+	assert.Len(t, c.CreateCertificateRequests(), 2)
+}
+
+func TestCAS_RenewCertificate(t *testing.T) {
+	n := mockNow(t)
+	c := New()
+
+	req := &apiv1.RenewCertificateRequest{
+		Template: newTemplate(t, "test.smallstep.com"),
+		Lifetime: time.Hour,
+	}
+	resp, err := c.RenewCertificate(req)
+	require.NoError(t, err)
+	assert.Equal(t, n, resp.Certificate.NotBefore)
+	assert.Equal(t, n.Add(time.Hour), resp.Certificate.NotAfter)
+	assert.Equal(t, []*apiv1.RenewCertificateRequest{req}, c.RenewCertificateRequests())
+
+	_, err = c.RenewCertificate(&apiv1.RenewCertificateRequest{Lifetime: time.Hour})
+	assert.EqualError(t, err, "renewCertificateRequest `template` cannot be nil")
+	_, err = c.RenewCertificate(&apiv1.RenewCertificateRequest{Template: newTemplate(t, "test")})
+	assert.EqualError(t, err, "renewCertificateRequest `lifetime` cannot be 0")
+}
+
+func TestCAS_RevokeCertificate(t *testing.T) {
+	c := New()
+	intermediate, err := c.Intermediate()
+	require.NoError(t, err)
+
+	req := &apiv1.RevokeCertificateRequest{
+		Certificate:  &x509.Certificate{SerialNumber: big.NewInt(1)},
+		SerialNumber: "1",
+		Reason:       "key compromised",
+	}
+	resp, err := c.RevokeCertificate(req)
+	require.NoError(t, err)
+	assert.Equal(t, &apiv1.RevokeCertificateResponse{
+		Certificate:      req.Certificate,
+		CertificateChain: []*x509.Certificate{intermediate},
+	}, resp)
+	assert.Equal(t, []*apiv1.RevokeCertificateRequest{req}, c.RevokeCertificateRequests())
+}
+
+func TestCAS_mock(t *testing.T) {
+	errTest := errors.New("test error")
+	c := &CAS{
+		MockCreateCertificate: func(*apiv1.CreateCertificateRequest) (*apiv1.CreateCertificateResponse, error) {
+			return nil, errTest
+		},
+		MockRenewCertificate: func(*apiv1.RenewCertificateRequest) (*apiv1.RenewCertificateResponse, error) {
+			return nil, errTest
+		},
+		MockRevokeCertificate: func(*apiv1.RevokeCertificateRequest) (*apiv1.RevokeCertificateResponse, error) {
+			return &apiv1.RevokeCertificateResponse{}, nil
+		},
+	}
+
+	_, err := c.CreateCertificate(&apiv1.CreateCertificateRequest{})
+	assert.ErrorIs(t, err, errTest)
+	_, err = c.RenewCertificate(&apiv1.RenewCertificateRequest{})
+	assert.ErrorIs(t, err, errTest)
+	resp, err := c.RevokeCertificate(&apiv1.RevokeCertificateRequest{})
+	assert.NoError(t, err)
+	assert.Equal(t, &apiv1.RevokeCertificateResponse{}, resp)
+
+	assert.Len(t, c.CreateCertificateRequests(), 1)
+	assert.Len(t, c.RenewCertificateRequests(), 1)
+	assert.Len(t, c.RevokeCertificateRequests(), 1)
+}
+
+func TestCAS_concurrent(t *testing.T) {
+	c := New()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		template := newTemplate(t, "test.smallstep.com")
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := c.CreateCertificate(&apiv1.CreateCertificateRequest{
+				Template: template,
+				Lifetime: time.Hour,
+			})
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	serials := make(map[string]bool)
+	for _, req := range c.CreateCertificateRequests() {
+		serials[req.Template.SerialNumber.String()] = true
+	}
+	assert.Len(t, serials, 10)
+}
@@ -0,0 +1,111 @@
+package mockcas
+
+import (
+	"testing"
+	"time"
+
+	"go.step.sm/crypto/jose"
+	"go.step.sm/crypto/randutil"
+
+	"github.com/smallstep/certificates/authority/config"
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+// NewProvisionerConfig returns a provisioner configuration with the default
+// global claims and the given audiences for sign tokens. It can be used to
+// initialize the provisioners created with this package.
+func NewProvisionerConfig(audiences ...string) provisioner.Config {
+	return provisioner.Config{
+		Claims: config.GlobalProvisionerClaims,
+		Audiences: provisioner.Audiences{
+			Sign: audiences,
+		},
+	}
+}
+
+// JWK is a JWK provisioner with the private key used to sign its tokens.
+type JWK struct {
+	Provisioner *provisioner.JWK
+	Key         *jose.JSONWebKey
+}
+
+// NewJWK creates a new JWK provisioner with the given name and a new P-256
+// key. The provisioner is not initialized, it can be added to the authority
+// configuration or initialized with the Init method.
+func NewJWK(t testing.TB, name string) *JWK {
+	t.Helper()
+
+	jwk, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+	if err != nil {
+		t.Fatalf("mockcas: error generating JWK: %v", err)
+	}
+	public := jwk.Public()
+	return &JWK{
+		Provisioner: &provisioner.JWK{
+			Type: provisioner.TypeJWK.String(),
+			Name: name,
+			Key:  &public,
+		},
+		Key: jwk,
+	}
+}
+
+// Token returns a token signed by the provisioner key for the given subject
+// and audience. If no sans are given, the subject will be used.
+func (p *JWK) Token(t testing.TB, subject, audience string, sans ...string) string {
+	t.Helper()
+
+	so := new(jose.SignerOptions)
+	so.WithType("JWT")
+	so.WithHeader("kid", p.Key.KeyID)
+	signer, err := jose.NewSigner(jose.SigningKey{
+		Algorithm: jose.SignatureAlgorithm(p.Key.Algorithm),
+		Key:       p.Key.Key,
+	}, so)
+	if err != nil {
+		t.Fatalf("mockcas: error creating signer: %v", err)
+	}
+
+	id, err := randutil.Hex(64)
+	if err != nil {
+		t.Fatalf("mockcas: error generating token id: %v", err)
+	}
+	if len(sans) == 0 {
+		sans = []string{subject}
+	}
+
+	now := time.Now()
+	claims := struct {
+		jose.Claims
+		SANs []string `json:"sans"`
+	}{
+		Claims: jose.Claims{
+			ID:        id,
+			Subject:   subject,
+			Issuer:    p.Provisioner.Name,
+			Audience:  []string{audience},
+			NotBefore: jose.NewNumericDate(now),
+			IssuedAt:  jose.NewNumericDate(now),
+			Expiry:    jose.NewNumericDate(now.Add(5 * time.Minute)),
+		},
+		SANs: sans,
+	}
+	tok, err := jose.Signed(signer).Claims(claims).CompactSerialize()
+	if err != nil {
+		t.Fatalf("mockcas: error signing token: %v", err)
+	}
+	return tok
+}
+
+// NewACME creates a new ACME provisioner with the given name that accepts the
+// http-01, dns-01 and tls-alpn-01 challenges. The provisioner is not
+// initialized.
+func NewACME(name string) *provisioner.ACME {
+	return &provisioner.ACME{
+		Type: provisioner.TypeACME.String(),
+		Name: name,
+		Challenges: []provisioner.ACMEChallenge{
+			provisioner.HTTP_01, provisioner.DNS_01, provisioner.TLS_ALPN_01,
+		},
+	}
+}
@@ -0,0 +1,31 @@
+package mockcas
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+func TestJWK_Token(t *testing.T) {
+	const audience = "https://ca.example.com/1.0/sign"
+	p := NewJWK(t, "jwk")
+	require.NoError(t, p.Provisioner.Init(NewProvisionerConfig(audience)))
+
+	opts, err := p.Provisioner.AuthorizeSign(context.Background(), p.Token(t, "test.example.com", audience))
+	require.NoError(t, err)
+	assert.NotEmpty(t, opts)
+
+	_, err = p.Provisioner.AuthorizeSign(context.Background(), p.Token(t, "test.example.com", "https://other.example.com/1.0/sign"))
+	assert.Error(t, err)
+}
+
+func TestNewACME(t *testing.T) {
+	p := NewACME("acme")
+	require.NoError(t, p.Init(NewProvisionerConfig()))
+	assert.Equal(t, "acme", p.GetName())
+	assert.Equal(t, provisioner.TypeACME, p.GetType())
+}
@@ -0,0 +1,121 @@
+package ratelimit
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/smallstep/certificates/cas/apiv1"
+)
+
+const (
+	defaultFailureThreshold = 5
+	defaultOpenTimeout      = 30 * time.Second
+)
+
+// circuitBreaker rejects the requests after a number of consecutive failures.
+// Once the timeout expires, a single trial request is allowed; if it succeeds
+// the circuit is closed again, if it fails the requests are rejected for
+// another timeout.
+type circuitBreaker struct {
+	mu        sync.Mutex
+	threshold int
+	timeout   time.Duration
+	failures  int
+	openUntil time.Time
+	trial     bool
+}
+
+// newCircuitBreaker creates a circuitBreaker from the given options. If the
+// options are nil, it returns a nil circuitBreaker that allows all requests.
+func newCircuitBreaker(o *apiv1.CircuitBreakerOptions) (*circuitBreaker, error) {
+	if o == nil {
+		return nil, nil //nolint:nilnil // a nil circuitBreaker is valid
+	}
+
+	b := &circuitBreaker{
+		threshold: o.FailureThreshold,
+		timeout:   defaultOpenTimeout,
+	}
+	switch {
+	case b.threshold < 0:
+		return nil, errors.New("ratelimit: `circuitBreaker.failureThreshold` cannot be less than 0")
+	case b.threshold == 0:
+		b.threshold = defaultFailureThreshold
+	}
+	if o.OpenTimeout != "" {
+		d, err := time.ParseDuration(o.OpenTimeout)
+		if err != nil || d <= 0 {
+			return nil, errors.New("ratelimit: `circuitBreaker.openTimeout` is not a valid duration")
+		}
+		b.timeout = d
+	}
+
+	return b, nil
+}
+
+// allow returns an error if the circuit is open, or if it is half-open and the
+// trial request has already been sent.
+func (b *circuitBreaker) allow(t time.Time) error {
+	if b == nil {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.failures < b.threshold {
+		return nil
+	}
+	if t.Before(b.openUntil) || b.trial {
+		retryAfter := b.openUntil.Sub(t)
+		if retryAfter <= 0 {
+			retryAfter = b.timeout
+		}
+		return apiv1.TooManyRequestsError{
+			Message:    "certificate authority service is temporarily unavailable",
+			RetryAfter: retryAfter,
+		}
+	}
+
+	b.trial = true
+	return nil
+}
+
+// done records the result of a request.
+func (b *circuitBreaker) done(err error) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.trial = false
+	if !isFailure(err) {
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	if b.failures >= b.threshold {
+		b.openUntil = now().Add(b.timeout)
+	}
+}
+
+// isFailure returns true if the error is a server error. Errors with a status
+// code below 500, like validation errors or pending certificates, and not
+// implemented errors are not failures of the service.
+func isFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+	var sc interface{ StatusCode() int }
+	if errors.As(err, &sc) {
+		code := sc.StatusCode()
+		return code >= http.StatusInternalServerError && code != http.StatusNotImplemented
+	}
+	return true
+}
@@ -0,0 +1,182 @@
+// Package ratelimit implements a CertificateAuthorityService that limits the
+// number of certificates issued by another CertificateAuthorityService, and
+// stops sending requests to it if it is failing.
+//
+// Upstream CAS like Google CAS or AWS Private CA bill each certificate, and a
+// runaway client can exhaust the quota of the account. The rejected requests
+// return an apiv1.TooManyRequestsError.
+package ratelimit
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/time/rate"
+
+	"github.com/smallstep/certificates/cas/apiv1"
+)
+
+// now is the function used to get the current time. It's used for unit
+// testing purposes.
+var now = time.Now
+
+// CertificateAuthorityService wraps another CertificateAuthorityService and
+// applies the configured rate limits and circuit breaker to the requests to
+// create and renew certificates. Revocation requests are always sent.
+//
+// The optional interfaces of the wrapped service, like
+// apiv1.CertificateAuthorityGetter, are not implemented, use Unwrap to access
+// them.
+type CertificateAuthorityService struct {
+	svc          apiv1.CertificateAuthorityService
+	limiter      *rate.Limiter
+	provisioners map[string]*rate.Limiter
+	breaker      *circuitBreaker
+}
+
+// New creates a new CertificateAuthorityService that wraps the given one. Nil
+// options disable the rate limits or the circuit breaker.
+func New(svc apiv1.CertificateAuthorityService, rl *apiv1.RateLimitOptions, cb *apiv1.CircuitBreakerOptions) (*CertificateAuthorityService, error) {
+	if svc == nil {
+		return nil, errors.New("ratelimit: certificate authority service cannot be nil")
+	}
+
+	s := &CertificateAuthorityService{
+		svc: svc,
+	}
+	if rl != nil {
+		var err error
+		if rl.Requests != 0 || rl.Period != "" || rl.Burst != 0 {
+			if s.limiter, err = newLimiter("rateLimit", rl.RateLimit); err != nil {
+				return nil, err
+			}
+		}
+		if len(rl.Provisioners) > 0 {
+			s.provisioners = make(map[string]*rate.Limiter, len(rl.Provisioners))
+			for name, l := range rl.Provisioners {
+				if s.provisioners[name], err = newLimiter("rateLimit.provisioners."+name, l); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	var err error
+	if s.breaker, err = newCircuitBreaker(cb); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// newLimiter creates a token bucket that allows l.Requests every l.Period,
+// with bursts of up to l.Burst requests.
+func newLimiter(name string, l apiv1.RateLimit) (*rate.Limiter, error) {
+	period := time.Second
+	if l.Period != "" {
+		d, err := time.ParseDuration(l.Period)
+		if err != nil || d <= 0 {
+			return nil, errors.Errorf("ratelimit: `%s.period` is not a valid duration", name)
+		}
+		period = d
+	}
+	switch {
+	case l.Requests <= 0:
+		return nil, errors.Errorf("ratelimit: `%s.requests` must be greater than 0", name)
+	case l.Burst < 0:
+		return nil, errors.Errorf("ratelimit: `%s.burst` cannot be less than 0", name)
+	case l.Burst == 0:
+		l.Burst = l.Requests
+	}
+	return rate.NewLimiter(rate.Limit(float64(l.Requests)/period.Seconds()), l.Burst), nil
+}
+
+// Unwrap returns the wrapped CertificateAuthorityService.
+func (s *CertificateAuthorityService) Unwrap() apiv1.CertificateAuthorityService {
+	return s.svc
+}
+
+// Type returns the type of the wrapped CertificateAuthorityService.
+func (s *CertificateAuthorityService) Type() apiv1.Type {
+	return apiv1.TypeOf(s.svc)
+}
+
+// CreateCertificate checks the global limit and the limit of the provisioner
+// in the request metadata, and calls CreateCertificate in the wrapped service.
+func (s *CertificateAuthorityService) CreateCertificate(req *apiv1.CreateCertificateRequest) (*apiv1.CreateCertificateResponse, error) {
+	var provisioner string
+	if req != nil {
+		provisioner = req.Metadata[apiv1.MetadataProvisionerName]
+	}
+	if err := s.allow(provisioner); err != nil {
+		return nil, err
+	}
+
+	resp, err := s.svc.CreateCertificate(req)
+	s.breaker.done(err)
+	return resp, err
+}
+
+// RenewCertificate checks the global limit and calls RenewCertificate in the
+// wrapped service.
+func (s *CertificateAuthorityService) RenewCertificate(req *apiv1.RenewCertificateRequest) (*apiv1.RenewCertificateResponse, error) {
+	if err := s.allow(""); err != nil {
+		return nil, err
+	}
+
+	resp, err := s.svc.RenewCertificate(req)
+	s.breaker.done(err)
+	return resp, err
+}
+
+// RevokeCertificate calls RevokeCertificate in the wrapped service.
+func (s *CertificateAuthorityService) RevokeCertificate(req *apiv1.RevokeCertificateRequest) (*apiv1.RevokeCertificateResponse, error) {
+	return s.svc.RevokeCertificate(req)
+}
+
+// allow returns an apiv1.TooManyRequestsError if the circuit breaker is open,
+// or if the global or provisioner limits have been exceeded. A request
+// rejected by one of the limits does not consume the others.
+func (s *CertificateAuthorityService) allow(provisioner string) error {
+	t := now()
+
+	var reservations []*rate.Reservation
+	cancel := func() {
+		for _, r := range reservations {
+			r.CancelAt(t)
+		}
+	}
+
+	for _, l := range []struct {
+		name    string
+		limiter *rate.Limiter
+	}{
+		{"", s.limiter},
+		{provisioner, s.provisioners[provisioner]},
+	} {
+		if l.limiter == nil {
+			continue
+		}
+		r := l.limiter.ReserveN(t, 1)
+		reservations = append(reservations, r)
+		if d := r.DelayFrom(t); d > 0 {
+			cancel()
+			msg := "certificate rate limit exceeded"
+			if l.name != "" {
+				msg = fmt.Sprintf("certificate rate limit exceeded for provisioner %s", l.name)
+			}
+			return apiv1.TooManyRequestsError{
+				Message:    msg,
+				RetryAfter: d,
+			}
+		}
+	}
+
+	if err := s.breaker.allow(t); err != nil {
+		cancel()
+		return err
+	}
+
+	return nil
+}
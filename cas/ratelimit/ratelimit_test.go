@@ -0,0 +1,266 @@
+package ratelimit
+
+import (
+	"crypto/x509"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/smallstep/certificates/cas/apiv1"
+)
+
+type mockCAS struct {
+	err   error
+	calls int
+}
+
+func (m *mockCAS) CreateCertificate(*apiv1.CreateCertificateRequest) (*apiv1.CreateCertificateResponse, error) {
+	m.calls++
+	if m.err != nil {
+		return nil, m.err
+	}
+	return &apiv1.CreateCertificateResponse{
+		Certificate: &x509.Certificate{SerialNumber: big.NewInt(int64(m.calls))},
+	}, nil
+}
+
+func (m *mockCAS) RenewCertificate(*apiv1.RenewCertificateRequest) (*apiv1.RenewCertificateResponse, error) {
+	m.calls++
+	if m.err != nil {
+		return nil, m.err
+	}
+	return &apiv1.RenewCertificateResponse{
+		Certificate: &x509.Certificate{SerialNumber: big.NewInt(int64(m.calls))},
+	}, nil
+}
+
+func (m *mockCAS) RevokeCertificate(*apiv1.RevokeCertificateRequest) (*apiv1.RevokeCertificateResponse, error) {
+	m.calls++
+	return &apiv1.RevokeCertificateResponse{}, m.err
+}
+
+func (m *mockCAS) Type() apiv1.Type {
+	return apiv1.DigiCertCAS
+}
+
+func mockNow(t *testing.T, tm time.Time) *time.Time {
+	t.Helper()
+	tmp := now
+	t.Cleanup(func() {
+		now = tmp
+	})
+	current := tm
+	now = func() time.Time {
+		return current
+	}
+	return &current
+}
+
+func createRequest(provisioner string) *apiv1.CreateCertificateRequest {
+	return &apiv1.CreateCertificateRequest{
+		Metadata: map[string]string{
+			apiv1.MetadataProvisionerName: provisioner,
+		},
+	}
+}
+
+func TestNew(t *testing.T) {
+	svc := &mockCAS{}
+	tests := []struct {
+		name    string
+		svc     apiv1.CertificateAuthorityService
+		rl      *apiv1.RateLimitOptions
+		cb      *apiv1.CircuitBreakerOptions
+		wantErr string
+	}{
+		{"ok", svc, nil, nil, ""},
+		{"ok rate limit", svc, &apiv1.RateLimitOptions{RateLimit: apiv1.RateLimit{Requests: 10, Period: "1m", Burst: 2}}, nil, ""},
+		{"ok provisioners", svc, &apiv1.RateLimitOptions{Provisioners: map[string]apiv1.RateLimit{"acme": {Requests: 1}}}, nil, ""},
+		{"ok circuit breaker", svc, nil, &apiv1.CircuitBreakerOptions{FailureThreshold: 2, OpenTimeout: "1m"}, ""},
+		{"fail svc", nil, nil, nil, "ratelimit: certificate authority service cannot be nil"},
+		{"fail requests", svc, &apiv1.RateLimitOptions{RateLimit: apiv1.RateLimit{Period: "1m"}}, nil, "ratelimit: `rateLimit.requests` must be greater than 0"},
+		{"fail period", svc, &apiv1.RateLimitOptions{RateLimit: apiv1.RateLimit{Requests: 1, Period: "foo"}}, nil, "ratelimit: `rateLimit.period` is not a valid duration"},
+		{"fail negative period", svc, &apiv1.RateLimitOptions{RateLimit: apiv1.RateLimit{Requests: 1, Period: "-1s"}}, nil, "ratelimit: `rateLimit.period` is not a valid duration"},
+		{"fail burst", svc, &apiv1.RateLimitOptions{RateLimit: apiv1.RateLimit{Requests: 1, Burst: -1}}, nil, "ratelimit: `rateLimit.burst` cannot be less than 0"},
+		{"fail provisioner", svc, &apiv1.RateLimitOptions{Provisioners: map[string]apiv1.RateLimit{"acme": {}}}, nil, "ratelimit: `rateLimit.provisioners.acme.requests` must be greater than 0"},
+		{"fail failure threshold", svc, nil, &apiv1.CircuitBreakerOptions{FailureThreshold: -1}, "ratelimit: `circuitBreaker.failureThreshold` cannot be less than 0"},
+		{"fail open timeout", svc, nil, &apiv1.CircuitBreakerOptions{OpenTimeout: "0s"}, "ratelimit: `circuitBreaker.openTimeout` is not a valid duration"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := New(tt.svc, tt.rl, tt.cb)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				assert.Nil(t, got)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.svc, got.Unwrap())
+			assert.Equal(t, apiv1.Type(apiv1.DigiCertCAS), got.Type())
+		})
+	}
+}
+
+func TestCertificateAuthorityService_rateLimit(t *testing.T) {
+	current := mockNow(t, time.Now())
+	svc := &mockCAS{}
+	s, err := New(svc, &apiv1.RateLimitOptions{
+		RateLimit: apiv1.RateLimit{Requests: 3, Period: "1m"},
+		Provisioners: map[string]apiv1.RateLimit{
+			"acme": {Requests: 1, Period: "1m"},
+		},
+	}, nil)
+	require.NoError(t, err)
+
+	// The provisioner limit is exceeded on the second request.
+	_, err = s.CreateCertificate(createRequest("acme"))
+	require.NoError(t, err)
+	_, err = s.CreateCertificate(createRequest("acme"))
+	var tooMany apiv1.TooManyRequestsError
+	if assert.True(t, errors.As(err, &tooMany)) {
+		assert.Equal(t, "certificate rate limit exceeded for provisioner acme", tooMany.Message)
+		assert.Equal(t, time.Minute, tooMany.RetryAfter)
+	}
+
+	// Rejected requests do not consume the global limit.
+	_, err = s.CreateCertificate(createRequest("jwk"))
+	require.NoError(t, err)
+	_, err = s.RenewCertificate(&apiv1.RenewCertificateRequest{})
+	require.NoError(t, err)
+	_, err = s.CreateCertificate(createRequest("jwk"))
+	if assert.True(t, errors.As(err, &tooMany)) {
+		assert.Equal(t, "certificate rate limit exceeded", tooMany.Message)
+		assert.Equal(t, 20*time.Second, tooMany.RetryAfter)
+	}
+	_, err = s.RenewCertificate(&apiv1.RenewCertificateRequest{})
+	assert.ErrorAs(t, err, &tooMany)
+	assert.Equal(t, 3, svc.calls)
+
+	// Revocations are not limited.
+	_, err = s.RevokeCertificate(&apiv1.RevokeCertificateRequest{})
+	assert.NoError(t, err)
+	assert.Equal(t, 4, svc.calls)
+
+	// New tokens are added over time.
+	*current = current.Add(20 * time.Second)
+	_, err = s.CreateCertificate(createRequest("jwk"))
+	assert.NoError(t, err)
+	_, err = s.CreateCertificate(createRequest("acme"))
+	assert.ErrorAs(t, err, &tooMany)
+	*current = current.Add(time.Minute)
+	_, err = s.CreateCertificate(createRequest("acme"))
+	assert.NoError(t, err)
+	_, err = s.CreateCertificate(nil)
+	assert.NoError(t, err)
+}
+
+func TestCertificateAuthorityService_circuitBreaker(t *testing.T) {
+	current := mockNow(t, time.Now())
+	svc := &mockCAS{}
+	s, err := New(svc, nil, &apiv1.CircuitBreakerOptions{
+		FailureThreshold: 2,
+		OpenTimeout:      "1m",
+	})
+	require.NoError(t, err)
+
+	// Client errors do not open the circuit.
+	svc.err = apiv1.ValidationError{Message: "bad request"}
+	for i := 0; i < 3; i++ {
+		_, err = s.CreateCertificate(createRequest("jwk"))
+		assert.Equal(t, svc.err, err)
+	}
+	svc.err = apiv1.NotImplementedError{}
+	for i := 0; i < 3; i++ {
+		_, err = s.RenewCertificate(&apiv1.RenewCertificateRequest{})
+		assert.Equal(t, svc.err, err)
+	}
+
+	// Consecutive server errors open the circuit.
+	svc.err = errors.New("server error")
+	_, err = s.CreateCertificate(createRequest("jwk"))
+	assert.Equal(t, svc.err, err)
+	svc.err = nil
+	_, err = s.CreateCertificate(createRequest("jwk"))
+	assert.NoError(t, err)
+	svc.err = errors.New("server error")
+	for i := 0; i < 2; i++ {
+		_, err = s.CreateCertificate(createRequest("jwk"))
+		assert.Equal(t, svc.err, err)
+	}
+	calls := svc.calls
+
+	var tooMany apiv1.TooManyRequestsError
+	_, err = s.CreateCertificate(createRequest("jwk"))
+	if assert.True(t, errors.As(err, &tooMany)) {
+		assert.Equal(t, "certificate authority service is temporarily unavailable", tooMany.Message)
+		assert.Equal(t, time.Minute, tooMany.RetryAfter)
+	}
+	*current = current.Add(30 * time.Second)
+	_, err = s.RenewCertificate(&apiv1.RenewCertificateRequest{})
+	if assert.True(t, errors.As(err, &tooMany)) {
+		assert.Equal(t, 30*time.Second, tooMany.RetryAfter)
+	}
+	assert.Equal(t, calls, svc.calls)
+
+	// After the timeout, the trial request fails and opens the circuit again.
+	*current = current.Add(30 * time.Second)
+	_, err = s.CreateCertificate(createRequest("jwk"))
+	assert.Equal(t, svc.err, err)
+	_, err = s.CreateCertificate(createRequest("jwk"))
+	assert.ErrorAs(t, err, &tooMany)
+	assert.Equal(t, calls+1, svc.calls)
+
+	// A successful trial request closes the circuit.
+	*current = current.Add(time.Minute)
+	svc.err = nil
+	for i := 0; i < 3; i++ {
+		_, err = s.CreateCertificate(createRequest("jwk"))
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, calls+4, svc.calls)
+}
+
+func Test_circuitBreaker_trial(t *testing.T) {
+	current := mockNow(t, time.Now())
+	b, err := newCircuitBreaker(&apiv1.CircuitBreakerOptions{FailureThreshold: 1})
+	require.NoError(t, err)
+
+	require.NoError(t, b.allow(now()))
+	b.done(errors.New("server error"))
+	assert.Error(t, b.allow(now()))
+
+	// Only one request is allowed while the circuit is half-open.
+	*current = current.Add(defaultOpenTimeout)
+	assert.NoError(t, b.allow(now()))
+	err = b.allow(now())
+	var tooMany apiv1.TooManyRequestsError
+	if assert.ErrorAs(t, err, &tooMany) {
+		assert.Equal(t, defaultOpenTimeout, tooMany.RetryAfter)
+	}
+	b.done(nil)
+	assert.NoError(t, b.allow(now()))
+}
+
+func Test_isFailure(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"error", errors.New("an error"), true},
+		{"validation", apiv1.ValidationError{}, false},
+		{"not implemented", apiv1.NotImplementedError{}, false},
+		{"pending", apiv1.PendingCertificateError{ID: "1234"}, false},
+		{"too many requests", apiv1.TooManyRequestsError{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, isFailure(tt.err))
+		})
+	}
+}
@@ -0,0 +1,205 @@
+package softcas
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"go.step.sm/crypto/keyutil"
+	"go.step.sm/crypto/kms"
+	kmsapi "go.step.sm/crypto/kms/apiv1"
+	"go.step.sm/crypto/kms/uri"
+
+	certkms "github.com/smallstep/certificates/kms"
+)
+
+// NewKeyManager wraps a software key manager to support private keys in PKCS
+// #8 encrypted with scrypt. Any other key is loaded by the given
+// key manager.
+func NewKeyManager(km kms.KeyManager) kms.KeyManager {
+	if d, ok := km.(kmsapi.Decrypter); ok {
+		return &pkcs8KeyAndDecrypterManager{&pkcs8KeyManager{km}, d}
+	}
+	return &pkcs8KeyManager{km}
+}
+
+type pkcs8KeyManager struct {
+	kms.KeyManager
+}
+
+type pkcs8KeyAndDecrypterManager struct {
+	*pkcs8KeyManager
+	decrypter kmsapi.Decrypter
+}
+
+// CreateSigner implements kmsapi.KeyManager.
+func (k *pkcs8KeyManager) CreateSigner(req *kmsapi.CreateSignerRequest) (crypto.Signer, error) {
+	if req.Signer != nil {
+		return req.Signer, nil
+	}
+	key, ok, err := loadModernPKCS8(req.SigningKeyPEM, req.SigningKey, req.Password, req.PasswordPrompter)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return k.KeyManager.CreateSigner(req)
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("signingKey is not a crypto.Signer")
+	}
+	return signer, nil
+}
+
+// CreateDecrypter implements kmsapi.Decrypter.
+func (k *pkcs8KeyAndDecrypterManager) CreateDecrypter(req *kmsapi.CreateDecrypterRequest) (crypto.Decrypter, error) {
+	if req.Decrypter != nil {
+		return req.Decrypter, nil
+	}
+	key, ok, err := loadModernPKCS8(req.DecryptionKeyPEM, req.DecryptionKey, req.Password, req.PasswordPrompter)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return k.decrypter.CreateDecrypter(req)
+	}
+	decrypter, ok := key.(crypto.Decrypter)
+	if !ok {
+		return nil, errors.New("decryptionKey is not a crypto.Decrypter")
+	}
+	return decrypter, nil
+}
+
+// RotateKey implements kms.KeyRotator. A key stored in a file is replaced by a
+// new key, with the same algorithm, written to a new file next to the current
+// one. If a password is given, the new key is encrypted as a PKCS #8 key using
+// the key derivation function of the current key, or scrypt if the current
+// key uses a legacy encryption scheme. Other keys are rotated by the wrapped
+// key manager.
+func (k *pkcs8KeyManager) RotateKey(req *certkms.RotateKeyRequest) (*kmsapi.CreateKeyResponse, error) {
+	filename := keyFilename(req.Name)
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return certkms.RotateKey(k.KeyManager, req)
+	}
+
+	key, err := ParsePrivateKey(data, req.Password)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error loading key %s", req.Name)
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, errors.Errorf("key %s is not a crypto.Signer", req.Name)
+	}
+	newSigner, err := generateSigner(signer.Public())
+	if err != nil {
+		return nil, err
+	}
+
+	var block *pem.Block
+	if len(req.Password) > 0 {
+		kdf := ScryptKDF
+		if b, _ := pem.Decode(data); IsModernPKCS8(b) {
+			kdf, _ = pkcs8KDF(b.Bytes)
+		}
+		block, err = EncryptPKCS8PrivateKey(newSigner, req.Password, kdf)
+	} else {
+		var der []byte
+		der, err = x509.MarshalPKCS8PrivateKey(newSigner)
+		block = &pem.Block{Type: "PRIVATE KEY", Bytes: der}
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "error rotating key %s", req.Name)
+	}
+
+	// The current key is not modified.
+	ext := filepath.Ext(filename)
+	name := strings.TrimSuffix(filename, ext) + "-" + time.Now().UTC().Format("20060102T150405Z") + ext
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error rotating key %s", req.Name)
+	}
+	if err := pem.Encode(f, block); err != nil {
+		f.Close()
+		return nil, errors.Wrapf(err, "error writing %s", name)
+	}
+	if err := f.Close(); err != nil {
+		return nil, errors.Wrapf(err, "error writing %s", name)
+	}
+
+	return &kmsapi.CreateKeyResponse{
+		Name:       name,
+		PublicKey:  newSigner.Public(),
+		PrivateKey: newSigner,
+		CreateSignerRequest: kmsapi.CreateSignerRequest{
+			Signer: newSigner,
+		},
+	}, nil
+}
+
+// generateSigner creates a new key with the same algorithm and size of the
+// given public key.
+func generateSigner(pub crypto.PublicKey) (crypto.Signer, error) {
+	switch k := pub.(type) {
+	case *ecdsa.PublicKey:
+		return keyutil.GenerateSigner("EC", k.Curve.Params().Name, 0)
+	case *rsa.PublicKey:
+		return keyutil.GenerateSigner("RSA", "", k.N.BitLen())
+	case ed25519.PublicKey:
+		return keyutil.GenerateSigner("OKP", "Ed25519", 0)
+	default:
+		return nil, errors.Errorf("unsupported public key type %T", pub)
+	}
+}
+
+// keyFilename returns the file name in a softkms URI, or the given name if
+// it is not a URI.
+func keyFilename(name string) string {
+	if u, err := uri.ParseWithScheme(string(kmsapi.SoftKMS), name); err == nil {
+		if name = u.Get("path"); name == "" {
+			name = u.Opaque
+		}
+	}
+	return name
+}
+
+// loadModernPKCS8 returns the private key in the given PEM, or in the given
+// file, if it's encrypted with scrypt. It returns false if the key
+// must be loaded by the wrapped key manager.
+func loadModernPKCS8(data []byte, name string, password []byte, prompter kmsapi.PasswordPrompter) (crypto.PrivateKey, bool, error) {
+	if len(data) == 0 && name != "" {
+		// Keys that are not files are always handled by the key manager.
+		var err error
+		if data, err = os.ReadFile(keyFilename(name)); err != nil {
+			return nil, false, nil
+		}
+	}
+	block, _ := pem.Decode(data)
+	if !IsModernPKCS8(block) {
+		return nil, false, nil
+	}
+
+	if len(password) == 0 && prompter != nil {
+		var err error
+		if password, err = prompter("Please enter the password to decrypt the private key"); err != nil {
+			return nil, false, errors.Wrap(err, "error reading password")
+		}
+	}
+	if len(password) == 0 {
+		return nil, false, errors.New("error decrypting private key: password is required")
+	}
+	key, err := DecryptPKCS8PrivateKey(block.Bytes, password)
+	if err != nil {
+		return nil, false, errors.Wrap(err, "error decrypting private key")
+	}
+	return key, true, nil
+}
@@ -0,0 +1,60 @@
+//go:build go1.27 && mldsa
+
+package softcas
+
+import (
+	"crypto"
+	"crypto/mldsa"
+	"crypto/x509"
+	"strings"
+
+	"github.com/pkg/errors"
+	kmsapi "go.step.sm/crypto/kms/apiv1"
+)
+
+// mldsaParameters maps the names of the supported ML-DSA parameter sets to
+// their values.
+var mldsaParameters = map[string]mldsa.Parameters{
+	"ML-DSA-44": mldsa.MLDSA44(),
+	"ML-DSA-65": mldsa.MLDSA65(),
+	"ML-DSA-87": mldsa.MLDSA87(),
+}
+
+// mldsaSignatureAlgorithm returns the signature algorithm used with the given
+// public key if it is an ML-DSA key.
+func mldsaSignatureAlgorithm(pub crypto.PublicKey) (x509.SignatureAlgorithm, bool) {
+	key, ok := pub.(*mldsa.PublicKey)
+	if !ok {
+		return x509.UnknownSignatureAlgorithm, false
+	}
+	switch key.Parameters() {
+	case mldsa.MLDSA44():
+		return x509.MLDSA44, true
+	case mldsa.MLDSA65():
+		return x509.MLDSA65, true
+	case mldsa.MLDSA87():
+		return x509.MLDSA87, true
+	default:
+		return x509.UnknownSignatureAlgorithm, false
+	}
+}
+
+// createMLDSAKey generates a new ML-DSA key in software using the parameter
+// set with the given name, e.g., "ML-DSA-65".
+func createMLDSAKey(name string) (*kmsapi.CreateKeyResponse, crypto.Signer, error) {
+	params, ok := mldsaParameters[strings.ToUpper(name)]
+	if !ok {
+		return nil, nil, errors.Errorf("key algorithm %s is not supported", name)
+	}
+	key, err := mldsa.GenerateKey(params)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "error generating ML-DSA key")
+	}
+	return &kmsapi.CreateKeyResponse{
+		PublicKey:  key.Public(),
+		PrivateKey: key,
+		CreateSignerRequest: kmsapi.CreateSignerRequest{
+			Signer: key,
+		},
+	}, key, nil
+}
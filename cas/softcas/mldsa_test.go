@@ -0,0 +1,126 @@
+//go:build go1.27 && mldsa
+
+package softcas
+
+import (
+	"context"
+	"crypto/mldsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/smallstep/certificates/cas/apiv1"
+)
+
+func TestSoftCAS_CreateCertificateAuthority_mldsa(t *testing.T) {
+	caTemplate := func(cn string, serial int64) *x509.Certificate {
+		return &x509.Certificate{
+			Subject:               pkix.Name{CommonName: cn},
+			KeyUsage:              x509.KeyUsageCRLSign | x509.KeyUsageCertSign,
+			BasicConstraintsValid: true,
+			IsCA:                  true,
+			SerialNumber:          big.NewInt(serial),
+		}
+	}
+
+	tests := []struct {
+		name                  string
+		rootAlgorithm         string
+		intermediateAlgorithm string
+		wantRoot              x509.SignatureAlgorithm
+		wantIntermediate      x509.SignatureAlgorithm
+		wantLeaf              x509.SignatureAlgorithm
+	}{
+		{"ML-DSA-44", "ML-DSA-44", "ml-dsa-44", x509.MLDSA44, x509.MLDSA44, x509.MLDSA44},
+		{"ML-DSA-87 root", "ML-DSA-87", "ML-DSA-65", x509.MLDSA87, x509.MLDSA87, x509.MLDSA65},
+		{"ECDSA root", "", "ML-DSA-65", x509.ECDSAWithSHA256, x509.ECDSAWithSHA256, x509.MLDSA65},
+		{"ML-DSA root", "ML-DSA-65", "", x509.MLDSA65, x509.MLDSA65, x509.ECDSAWithSHA256},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &SoftCAS{}
+			root, err := c.CreateCertificateAuthority(&apiv1.CreateCertificateAuthorityRequest{
+				Type:         apiv1.RootCA,
+				Template:     caTemplate("Test Root CA", 1),
+				Lifetime:     24 * time.Hour,
+				KeyAlgorithm: tt.rootAlgorithm,
+			})
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantRoot, root.Certificate.SignatureAlgorithm)
+
+			intermediate, err := c.CreateCertificateAuthority(&apiv1.CreateCertificateAuthorityRequest{
+				Type:         apiv1.IntermediateCA,
+				Template:     caTemplate("Test Intermediate CA", 2),
+				Lifetime:     24 * time.Hour,
+				Parent:       root,
+				KeyAlgorithm: tt.intermediateAlgorithm,
+			})
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantIntermediate, intermediate.Certificate.SignatureAlgorithm)
+
+			cas, err := New(context.Background(), apiv1.Options{
+				CertificateChain: []*x509.Certificate{intermediate.Certificate},
+				Signer:           intermediate.Signer,
+			})
+			require.NoError(t, err)
+			require.NoError(t, cas.CheckHealth(context.Background()))
+
+			leaf, err := cas.CreateCertificate(&apiv1.CreateCertificateRequest{
+				Template: &x509.Certificate{
+					Subject:      pkix.Name{CommonName: "test.smallstep.com"},
+					DNSNames:     []string{"test.smallstep.com"},
+					KeyUsage:     x509.KeyUsageDigitalSignature,
+					ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+					PublicKey:    testSigner.Public(),
+					SerialNumber: big.NewInt(3),
+				},
+				Lifetime: time.Hour,
+			})
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantLeaf, leaf.Certificate.SignatureAlgorithm)
+
+			roots := x509.NewCertPool()
+			roots.AddCert(root.Certificate)
+			intermediates := x509.NewCertPool()
+			intermediates.AddCert(intermediate.Certificate)
+			_, err = leaf.Certificate.Verify(x509.VerifyOptions{
+				Roots:         roots,
+				Intermediates: intermediates,
+				KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+			})
+			assert.NoError(t, err)
+		})
+	}
+
+	t.Run("fail algorithm", func(t *testing.T) {
+		c := &SoftCAS{}
+		_, err := c.CreateCertificateAuthority(&apiv1.CreateCertificateAuthorityRequest{
+			Type:         apiv1.RootCA,
+			Template:     caTemplate("Test Root CA", 1),
+			Lifetime:     24 * time.Hour,
+			KeyAlgorithm: "SLH-DSA-SHA2-128s",
+		})
+		assert.Error(t, err)
+	})
+}
+
+func Test_mldsaSignatureAlgorithm(t *testing.T) {
+	key, err := mldsa.GenerateKey(mldsa.MLDSA65())
+	require.NoError(t, err)
+
+	sa, ok := mldsaSignatureAlgorithm(key.Public())
+	assert.True(t, ok)
+	assert.Equal(t, x509.MLDSA65, sa)
+
+	sa, ok = mldsaSignatureAlgorithm(testSigner.Public())
+	assert.False(t, ok)
+	assert.Equal(t, x509.UnknownSignatureAlgorithm, sa)
+
+	assert.NoError(t, checkSignatureAlgorithm(x509.MLDSA65, key))
+	assert.Error(t, checkSignatureAlgorithm(x509.MLDSA44, key))
+}
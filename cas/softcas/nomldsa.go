@@ -0,0 +1,23 @@
+//go:build !go1.27 || !mldsa
+
+package softcas
+
+import (
+	"crypto"
+	"crypto/x509"
+
+	"github.com/pkg/errors"
+	kmsapi "go.step.sm/crypto/kms/apiv1"
+)
+
+// mldsaSignatureAlgorithm always returns false, ML-DSA keys are only
+// supported when step-ca is built with the mldsa tag.
+func mldsaSignatureAlgorithm(crypto.PublicKey) (x509.SignatureAlgorithm, bool) {
+	return x509.UnknownSignatureAlgorithm, false
+}
+
+// createMLDSAKey always fails, ML-DSA keys are only supported when step-ca is
+// built with the mldsa tag.
+func createMLDSAKey(name string) (*kmsapi.CreateKeyResponse, crypto.Signer, error) {
+	return nil, nil, errors.Errorf("key algorithm %s is not supported: post-quantum algorithms require building with the mldsa tag", name)
+}
@@ -0,0 +1,32 @@
+//go:build !go1.27 || !mldsa
+
+package softcas
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/smallstep/certificates/cas/apiv1"
+)
+
+func TestSoftCAS_CreateCertificateAuthority_mldsa(t *testing.T) {
+	c := &SoftCAS{}
+	_, err := c.CreateCertificateAuthority(&apiv1.CreateCertificateAuthorityRequest{
+		Type: apiv1.RootCA,
+		Template: &x509.Certificate{
+			Subject:               pkix.Name{CommonName: "Test Root CA"},
+			KeyUsage:              x509.KeyUsageCRLSign | x509.KeyUsageCertSign,
+			BasicConstraintsValid: true,
+			IsCA:                  true,
+			SerialNumber:          big.NewInt(1),
+		},
+		Lifetime:     24 * time.Hour,
+		KeyAlgorithm: "ML-DSA-65",
+	})
+	assert.ErrorContains(t, err, "mldsa tag")
+}
@@ -0,0 +1,387 @@
+package softcas
+
+import (
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"io"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/scrypt"
+
+	"go.step.sm/crypto/pemutil"
+)
+
+// KDF is the key derivation function used to derive the key that encrypts a
+// PKCS #8 private key.
+type KDF string
+
+const (
+	// ScryptKDF derives the encryption key using scrypt, as defined in RFC
+	// 7914. This is the default.
+	ScryptKDF KDF = "scrypt"
+	// PBKDF2KDF derives the encryption key using PBKDF2 with HMAC-SHA256.
+	// This is the only scheme supported by older versions of step-ca.
+	PBKDF2KDF KDF = "pbkdf2"
+)
+
+// Parameters used to encrypt new keys. They follow the OWASP recommendations
+// for password storage.
+var (
+	scryptN = 1 << 17
+	scryptR = 8
+	scryptP = 1
+)
+
+const (
+	pkcs8SaltSize = 16
+	pkcs8KeySize  = 32
+
+	// Limits of the key derivation parameters accepted when a key is
+	// decrypted. They prevent a crafted key from using an unbounded amount
+	// of memory or CPU.
+	maxScryptMemory     = 256 << 20
+	maxScryptP          = 16
+	maxPBKDF2Iterations = 10_000_000
+	maxPKCS8SaltSize    = 64
+)
+
+var (
+	oidPBES2     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidPBKDF2    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+	oidScrypt    = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11591, 4, 11}
+	oidAES128CBC = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}
+	oidAES192CBC = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}
+	oidAES256CBC = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+)
+
+type encryptedPrivateKeyInfo struct {
+	Algo       pkix.AlgorithmIdentifier
+	PrivateKey []byte
+}
+
+type pbes2Params struct {
+	KeyDerivationFunc pkix.AlgorithmIdentifier
+	EncryptionScheme  pkix.AlgorithmIdentifier
+}
+
+// scryptParams are the scrypt parameters defined in RFC 7914, section 7.1.
+type scryptParams struct {
+	Salt                     []byte
+	CostParameter            int
+	BlockSize                int
+	ParallelizationParameter int
+	KeyLength                int `asn1:"optional"`
+}
+
+// pbkdf2Params are the PBKDF2 parameters defined in RFC 8018, appendix A.2.
+type pbkdf2Params struct {
+	Salt           []byte
+	IterationCount int
+	KeyLength      int                      `asn1:"optional"`
+	PRF            pkix.AlgorithmIdentifier `asn1:"optional"`
+}
+
+// EncryptPKCS8PrivateKey returns an "ENCRYPTED PRIVATE KEY" PEM block with the
+// given key encrypted using PBES2 with AES-256-CBC and a key derived from the
+// password with the given key derivation function.
+func EncryptPKCS8PrivateKey(key crypto.PrivateKey, password []byte, kdf KDF) (*pem.Block, error) {
+	if len(password) == 0 {
+		return nil, errors.New("password cannot be empty")
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "error marshaling private key")
+	}
+
+	var params asn1.RawValue
+	var derivedKey []byte
+	switch kdf {
+	case ScryptKDF, "":
+		params, derivedKey, err = newScryptKey(password)
+	case PBKDF2KDF:
+		return pemutil.EncryptPKCS8PrivateKey(rand.Reader, der, password, x509.PEMCipherAES256)
+	default:
+		return nil, errors.Errorf("unsupported key derivation function %q", kdf)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(derivedKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating cipher")
+	}
+	iv := make([]byte, aes.BlockSize)
+	if _, err := io.ReadFull(rand.Reader, iv); err != nil {
+		return nil, errors.Wrap(err, "error generating iv")
+	}
+	ivParam, err := asn1.Marshal(iv)
+	if err != nil {
+		return nil, errors.Wrap(err, "error marshaling iv")
+	}
+
+	// Padding as defined in RFC 8018, section 6.1.1.
+	pad := aes.BlockSize - len(der)%aes.BlockSize
+	encrypted := make([]byte, len(der), len(der)+pad)
+	copy(encrypted, der)
+	for i := 0; i < pad; i++ {
+		encrypted = append(encrypted, byte(pad))
+	}
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(encrypted, encrypted)
+
+	pbes2, err := asn1.Marshal(pbes2Params{
+		KeyDerivationFunc: pkix.AlgorithmIdentifier{
+			Algorithm:  oidScrypt,
+			Parameters: params,
+		},
+		EncryptionScheme: pkix.AlgorithmIdentifier{
+			Algorithm:  oidAES256CBC,
+			Parameters: asn1.RawValue{FullBytes: ivParam},
+		},
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "error marshaling pbes2 parameters")
+	}
+	b, err := asn1.Marshal(encryptedPrivateKeyInfo{
+		Algo: pkix.AlgorithmIdentifier{
+			Algorithm:  oidPBES2,
+			Parameters: asn1.RawValue{FullBytes: pbes2},
+		},
+		PrivateKey: encrypted,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "error marshaling encrypted private key")
+	}
+	return &pem.Block{
+		Type:  "ENCRYPTED PRIVATE KEY",
+		Bytes: b,
+	}, nil
+}
+
+// DecryptPKCS8PrivateKey decrypts a DER encoded PKCS #8 encrypted private key.
+// It supports PBES2 with the scrypt and PBKDF2 key derivation functions. The
+// key derivation parameters are checked against fixed limits before the key is
+// derived.
+func DecryptPKCS8PrivateKey(der, password []byte) (crypto.PrivateKey, error) {
+	info, params, err := parsePBES2(der)
+	if err != nil {
+		return nil, err
+	}
+	kdf, err := pbes2KDF(params)
+	if err != nil {
+		return nil, err
+	}
+	if kdf == PBKDF2KDF {
+		if err := checkPBKDF2Params(params.KeyDerivationFunc.Parameters.FullBytes); err != nil {
+			return nil, err
+		}
+		b, err := pemutil.DecryptPKCS8PrivateKey(der, password)
+		if err != nil {
+			return nil, err
+		}
+		return x509.ParsePKCS8PrivateKey(b)
+	}
+
+	var keySize int
+	switch alg := params.EncryptionScheme.Algorithm; {
+	case alg.Equal(oidAES128CBC):
+		keySize = 16
+	case alg.Equal(oidAES192CBC):
+		keySize = 24
+	case alg.Equal(oidAES256CBC):
+		keySize = 32
+	default:
+		return nil, errors.Errorf("unsupported encryption scheme %s", alg)
+	}
+	var iv []byte
+	if _, err := asn1.Unmarshal(params.EncryptionScheme.Parameters.FullBytes, &iv); err != nil {
+		return nil, errors.Wrap(err, "error parsing iv")
+	}
+	if len(iv) != aes.BlockSize {
+		return nil, errors.New("error parsing iv: invalid size")
+	}
+
+	derivedKey, err := deriveScryptKey(password, params.KeyDerivationFunc.Parameters.FullBytes, keySize)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(derivedKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating cipher")
+	}
+	data := info.PrivateKey
+	if len(data) == 0 || len(data)%aes.BlockSize != 0 {
+		return nil, errors.New("error decrypting private key: invalid size")
+	}
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(data, data)
+
+	// An invalid padding is most probably caused by the wrong password.
+	n := len(data)
+	pad := int(data[n-1])
+	if pad == 0 || pad > aes.BlockSize {
+		return nil, x509.IncorrectPasswordError
+	}
+	for _, v := range data[n-pad:] {
+		if int(v) != pad {
+			return nil, x509.IncorrectPasswordError
+		}
+	}
+	key, err := x509.ParsePKCS8PrivateKey(data[:n-pad])
+	if err != nil {
+		return nil, x509.IncorrectPasswordError
+	}
+	return key, nil
+}
+
+// IsModernPKCS8 returns true if the given PEM block is a PKCS #8 private key
+// encrypted with a key derivation function not supported by the default KMS,
+// scrypt.
+func IsModernPKCS8(block *pem.Block) bool {
+	if block == nil || block.Type != "ENCRYPTED PRIVATE KEY" {
+		return false
+	}
+	kdf, err := pkcs8KDF(block.Bytes)
+	return err == nil && kdf != PBKDF2KDF
+}
+
+// ParsePrivateKey parses a PEM encoded private key. Keys encrypted with PBES2
+// and scrypt are decrypted in this package, other formats,
+// including the legacy PEM encryption, are parsed using pemutil.
+func ParsePrivateKey(data, password []byte) (crypto.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("error decoding private key: not a valid PEM")
+	}
+	if IsModernPKCS8(block) {
+		if len(password) == 0 {
+			return nil, errors.New("error decrypting private key: password is required")
+		}
+		return DecryptPKCS8PrivateKey(block.Bytes, password)
+	}
+	var opts []pemutil.Options
+	if len(password) > 0 {
+		opts = append(opts, pemutil.WithPassword(password))
+	}
+	return pemutil.ParseKey(data, opts...)
+}
+
+// ReencryptPrivateKey decrypts the given PEM encoded private key with the old
+// password and encrypts it again with the new password and key derivation
+// function. It can be used to rotate the password of a key or to migrate a
+// key encrypted with a legacy scheme. If the old password is empty, the key
+// is expected to be unencrypted.
+func ReencryptPrivateKey(data, oldPassword, newPassword []byte, kdf KDF) ([]byte, error) {
+	key, err := ParsePrivateKey(data, oldPassword)
+	if err != nil {
+		return nil, err
+	}
+	block, err := EncryptPKCS8PrivateKey(key, newPassword, kdf)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(block), nil
+}
+
+// pkcs8KDF returns the key derivation function used in a PBES2 encrypted
+// private key.
+func pkcs8KDF(der []byte) (KDF, error) {
+	_, params, err := parsePBES2(der)
+	if err != nil {
+		return "", err
+	}
+	return pbes2KDF(params)
+}
+
+// parsePBES2 parses a PKCS #8 private key encrypted with PBES2.
+func parsePBES2(der []byte) (*encryptedPrivateKeyInfo, *pbes2Params, error) {
+	var info encryptedPrivateKeyInfo
+	if _, err := asn1.Unmarshal(der, &info); err != nil {
+		return nil, nil, errors.Wrap(err, "error parsing encrypted private key")
+	}
+	if !info.Algo.Algorithm.Equal(oidPBES2) {
+		return nil, nil, errors.Errorf("unsupported encryption algorithm %s: only PBES2 is supported", info.Algo.Algorithm)
+	}
+	var params pbes2Params
+	if _, err := asn1.Unmarshal(info.Algo.Parameters.FullBytes, &params); err != nil {
+		return nil, nil, errors.Wrap(err, "error parsing pbes2 parameters")
+	}
+	return &info, &params, nil
+}
+
+func pbes2KDF(params *pbes2Params) (KDF, error) {
+	switch alg := params.KeyDerivationFunc.Algorithm; {
+	case alg.Equal(oidScrypt):
+		return ScryptKDF, nil
+	case alg.Equal(oidPBKDF2):
+		return PBKDF2KDF, nil
+	default:
+		return "", errors.Errorf("unsupported key derivation function %s", alg)
+	}
+}
+
+// checkPBKDF2Params returns an error if the PBKDF2 parameters exceed the
+// limits. The key is derived by pemutil.
+func checkPBKDF2Params(params []byte) error {
+	var p pbkdf2Params
+	if _, err := asn1.Unmarshal(params, &p); err != nil {
+		return errors.Wrap(err, "error parsing pbkdf2 parameters")
+	}
+	switch {
+	case len(p.Salt) == 0 || len(p.Salt) > maxPKCS8SaltSize:
+		return errors.New("error parsing pbkdf2 parameters: invalid salt")
+	case p.IterationCount < 1 || p.IterationCount > maxPBKDF2Iterations:
+		return errors.New("error parsing pbkdf2 parameters: invalid iteration count")
+	}
+	return nil
+}
+
+func newScryptKey(password []byte) (asn1.RawValue, []byte, error) {
+	salt := make([]byte, pkcs8SaltSize)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return asn1.RawValue{}, nil, errors.Wrap(err, "error generating salt")
+	}
+	b, err := asn1.Marshal(scryptParams{
+		Salt:                     salt,
+		CostParameter:            scryptN,
+		BlockSize:                scryptR,
+		ParallelizationParameter: scryptP,
+		KeyLength:                pkcs8KeySize,
+	})
+	if err != nil {
+		return asn1.RawValue{}, nil, errors.Wrap(err, "error marshaling scrypt parameters")
+	}
+	key, err := deriveScryptKey(password, b, pkcs8KeySize)
+	return asn1.RawValue{FullBytes: b}, key, err
+}
+
+func deriveScryptKey(password, params []byte, keySize int) ([]byte, error) {
+	var p scryptParams
+	if _, err := asn1.Unmarshal(params, &p); err != nil {
+		return nil, errors.Wrap(err, "error parsing scrypt parameters")
+	}
+	n, r := p.CostParameter, p.BlockSize
+	switch {
+	case p.KeyLength != 0 && p.KeyLength != keySize:
+		return nil, errors.New("error parsing scrypt parameters: invalid key length")
+	case len(p.Salt) == 0 || len(p.Salt) > maxPKCS8SaltSize:
+		return nil, errors.New("error parsing scrypt parameters: invalid salt")
+	case n < 2 || n&(n-1) != 0:
+		return nil, errors.New("error parsing scrypt parameters: invalid cost parameter")
+	case r < 1 || n > maxScryptMemory/128/r:
+		return nil, errors.New("error parsing scrypt parameters: cost parameter and block size exceed the memory limit")
+	case p.ParallelizationParameter < 1 || p.ParallelizationParameter > maxScryptP:
+		return nil, errors.New("error parsing scrypt parameters: invalid parallelization parameter")
+	}
+	key, err := scrypt.Key(password, p.Salt, p.CostParameter, p.BlockSize, p.ParallelizationParameter, keySize)
+	if err != nil {
+		return nil, errors.Wrap(err, "error deriving key")
+	}
+	return key, nil
+}
@@ -0,0 +1,341 @@
+package softcas
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.step.sm/crypto/kms"
+	kmsapi "go.step.sm/crypto/kms/apiv1"
+	"go.step.sm/crypto/pemutil"
+
+	certkms "github.com/smallstep/certificates/kms"
+)
+
+func init() {
+	// Use weak parameters to speed up tests.
+	scryptN = 1 << 10
+}
+
+func mustPKCS8Keys(t *testing.T) []crypto.Signer {
+	t.Helper()
+	ec, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	_, ed, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	return []crypto.Signer{ec, rsaKey, ed}
+}
+
+func TestEncryptPKCS8PrivateKey(t *testing.T) {
+	password := []byte("password")
+	for _, kdf := range []KDF{"", ScryptKDF, PBKDF2KDF} {
+		for _, key := range mustPKCS8Keys(t) {
+			block, err := EncryptPKCS8PrivateKey(key, password, kdf)
+			require.NoError(t, err)
+			assert.Equal(t, "ENCRYPTED PRIVATE KEY", block.Type)
+			assert.Equal(t, kdf != PBKDF2KDF, IsModernPKCS8(block))
+
+			got, err := DecryptPKCS8PrivateKey(block.Bytes, password)
+			require.NoError(t, err)
+			assert.Equal(t, key, got)
+
+			_, err = DecryptPKCS8PrivateKey(block.Bytes, []byte("wrong password"))
+			assert.Error(t, err)
+		}
+	}
+
+	key := mustPKCS8Keys(t)[0]
+	_, err := EncryptPKCS8PrivateKey(key, nil, ScryptKDF)
+	assert.Error(t, err)
+	_, err = EncryptPKCS8PrivateKey(key, password, "argon2id")
+	assert.Error(t, err)
+	_, err = EncryptPKCS8PrivateKey("not a key", password, ScryptKDF)
+	assert.Error(t, err)
+}
+
+func TestDecryptPKCS8PrivateKey_fail(t *testing.T) {
+	key := mustPKCS8Keys(t)[0]
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	legacy, err := pemutil.Serialize(key, pemutil.WithPassword([]byte("password")), pemutil.WithPKCS8(false))
+	require.NoError(t, err)
+
+	_, err = DecryptPKCS8PrivateKey([]byte("foo"), []byte("password"))
+	assert.Error(t, err)
+	_, err = DecryptPKCS8PrivateKey(der, []byte("password"))
+	assert.Error(t, err)
+	_, err = DecryptPKCS8PrivateKey(legacy.Bytes, []byte("password"))
+	assert.Error(t, err)
+}
+
+func TestDecryptPKCS8PrivateKey_limits(t *testing.T) {
+	key := mustPKCS8Keys(t)[0]
+	password := []byte("password")
+	scryptBlock, err := EncryptPKCS8PrivateKey(key, password, ScryptKDF)
+	require.NoError(t, err)
+	pbkdf2Block, err := EncryptPKCS8PrivateKey(key, password, PBKDF2KDF)
+	require.NoError(t, err)
+
+	// withKDFParams replaces the key derivation parameters of a key.
+	withKDFParams := func(t *testing.T, der []byte, kdfParams any) []byte {
+		t.Helper()
+		var info encryptedPrivateKeyInfo
+		_, err := asn1.Unmarshal(der, &info)
+		require.NoError(t, err)
+		var params pbes2Params
+		_, err = asn1.Unmarshal(info.Algo.Parameters.FullBytes, &params)
+		require.NoError(t, err)
+		b, err := asn1.Marshal(kdfParams)
+		require.NoError(t, err)
+		params.KeyDerivationFunc.Parameters = asn1.RawValue{FullBytes: b}
+		b, err = asn1.Marshal(params)
+		require.NoError(t, err)
+		info.Algo.Parameters = asn1.RawValue{FullBytes: b}
+		b, err = asn1.Marshal(info)
+		require.NoError(t, err)
+		return b
+	}
+	salt := make([]byte, pkcs8SaltSize)
+
+	tests := []struct {
+		name    string
+		der     []byte
+		wantErr string
+	}{
+		{"ok/scrypt", scryptBlock.Bytes, ""},
+		{"ok/pbkdf2", pbkdf2Block.Bytes, ""},
+		{"fail/scrypt-n", withKDFParams(t, scryptBlock.Bytes, scryptParams{salt, 1 << 30, 8, 1, pkcs8KeySize}), "cost parameter and block size exceed the memory limit"},
+		{"fail/scrypt-r", withKDFParams(t, scryptBlock.Bytes, scryptParams{salt, 1 << 10, 1 << 20, 1, pkcs8KeySize}), "cost parameter and block size exceed the memory limit"},
+		{"fail/scrypt-r-zero", withKDFParams(t, scryptBlock.Bytes, scryptParams{salt, 1 << 10, 0, 1, pkcs8KeySize}), "cost parameter and block size exceed the memory limit"},
+		{"fail/scrypt-n-power", withKDFParams(t, scryptBlock.Bytes, scryptParams{salt, 1000, 8, 1, pkcs8KeySize}), "invalid cost parameter"},
+		{"fail/scrypt-p", withKDFParams(t, scryptBlock.Bytes, scryptParams{salt, 1 << 10, 8, 1 << 20, pkcs8KeySize}), "invalid parallelization parameter"},
+		{"fail/scrypt-salt", withKDFParams(t, scryptBlock.Bytes, scryptParams{make([]byte, 1024), 1 << 10, 8, 1, pkcs8KeySize}), "invalid salt"},
+		{"fail/scrypt-key-length", withKDFParams(t, scryptBlock.Bytes, scryptParams{salt, 1 << 10, 8, 1, 16}), "invalid key length"},
+		{"fail/pbkdf2-iterations", withKDFParams(t, pbkdf2Block.Bytes, pbkdf2Params{Salt: salt, IterationCount: 1 << 30}), "invalid iteration count"},
+		{"fail/pbkdf2-salt", withKDFParams(t, pbkdf2Block.Bytes, pbkdf2Params{IterationCount: 1000}), "invalid salt"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DecryptPKCS8PrivateKey(tt.der, password)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, key, got)
+		})
+	}
+}
+
+func TestParsePrivateKey(t *testing.T) {
+	key := mustPKCS8Keys(t)[0]
+	password := []byte("password")
+
+	scryptBlock, err := EncryptPKCS8PrivateKey(key, password, ScryptKDF)
+	require.NoError(t, err)
+	pbkdf2Block, err := EncryptPKCS8PrivateKey(key, password, PBKDF2KDF)
+	require.NoError(t, err)
+	legacyBlock, err := pemutil.Serialize(key, pemutil.WithPassword(password), pemutil.WithPKCS8(false))
+	require.NoError(t, err)
+	plainBlock, err := pemutil.Serialize(key)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		data     []byte
+		password []byte
+		wantErr  bool
+	}{
+		{"ok/scrypt", pem.EncodeToMemory(scryptBlock), password, false},
+		{"ok/pbkdf2", pem.EncodeToMemory(pbkdf2Block), password, false},
+		{"ok/legacy", pem.EncodeToMemory(legacyBlock), password, false},
+		{"ok/plain", pem.EncodeToMemory(plainBlock), nil, false},
+		{"fail/no-password", pem.EncodeToMemory(scryptBlock), nil, true},
+		{"fail/password", pem.EncodeToMemory(scryptBlock), []byte("foo"), true},
+		{"fail/pem", []byte("foo"), password, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParsePrivateKey(tt.data, tt.password)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, key, got)
+		})
+	}
+}
+
+func TestReencryptPrivateKey(t *testing.T) {
+	key := mustPKCS8Keys(t)[0]
+	legacyBlock, err := pemutil.Serialize(key, pemutil.WithPassword([]byte("old")), pemutil.WithPKCS8(false))
+	require.NoError(t, err)
+
+	data, err := ReencryptPrivateKey(pem.EncodeToMemory(legacyBlock), []byte("old"), []byte("new"), ScryptKDF)
+	require.NoError(t, err)
+	block, _ := pem.Decode(data)
+	assert.True(t, IsModernPKCS8(block))
+
+	// Rotate the password.
+	data, err = ReencryptPrivateKey(data, []byte("new"), []byte("newer"), ScryptKDF)
+	require.NoError(t, err)
+	got, err := ParsePrivateKey(data, []byte("newer"))
+	require.NoError(t, err)
+	assert.Equal(t, key, got)
+
+	_, err = ReencryptPrivateKey(data, []byte("new"), []byte("newer"), ScryptKDF)
+	assert.Error(t, err)
+	_, err = ReencryptPrivateKey(data, []byte("newer"), nil, ScryptKDF)
+	assert.Error(t, err)
+}
+
+func TestNewKeyManager(t *testing.T) {
+	km, err := kms.New(context.Background(), kmsapi.Options{Type: kmsapi.SoftKMS})
+	require.NoError(t, err)
+	wrapped := NewKeyManager(km)
+	_, ok := wrapped.(kmsapi.Decrypter)
+	assert.True(t, ok)
+
+	signer := mustPKCS8Keys(t)[1]
+	password := []byte("password")
+	dir := t.TempDir()
+	writeKey := func(name string, block *pem.Block) string {
+		fn := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(fn, pem.EncodeToMemory(block), 0o600))
+		return fn
+	}
+	scryptBlock, err := EncryptPKCS8PrivateKey(signer, password, ScryptKDF)
+	require.NoError(t, err)
+	pbkdf2Block, err := EncryptPKCS8PrivateKey(signer, password, PBKDF2KDF)
+	require.NoError(t, err)
+	scryptFile := writeKey("scrypt.key", scryptBlock)
+	pbkdf2File := writeKey("pbkdf2.key", pbkdf2Block)
+
+	prompter := func(string) ([]byte, error) { return password, nil }
+	failPrompter := func(string) ([]byte, error) { return nil, errors.New("force") }
+
+	tests := []struct {
+		name    string
+		req     *kmsapi.CreateSignerRequest
+		wantErr bool
+	}{
+		{"ok/scrypt", &kmsapi.CreateSignerRequest{SigningKey: scryptFile, Password: password}, false},
+		{"ok/path", &kmsapi.CreateSignerRequest{SigningKey: "softkms:path=" + scryptFile, PasswordPrompter: prompter}, false},
+		{"ok/pem", &kmsapi.CreateSignerRequest{SigningKeyPEM: pem.EncodeToMemory(scryptBlock), Password: password}, false},
+		{"ok/pbkdf2", &kmsapi.CreateSignerRequest{SigningKey: pbkdf2File, Password: password}, false},
+		{"ok/signer", &kmsapi.CreateSignerRequest{Signer: signer}, false},
+		{"fail/password", &kmsapi.CreateSignerRequest{SigningKey: scryptFile, Password: []byte("foo")}, true},
+		{"fail/no-password", &kmsapi.CreateSignerRequest{SigningKey: scryptFile}, true},
+		{"fail/prompter", &kmsapi.CreateSignerRequest{SigningKey: scryptFile, PasswordPrompter: failPrompter}, true},
+		{"fail/missing", &kmsapi.CreateSignerRequest{SigningKey: filepath.Join(dir, "missing.key")}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := wrapped.CreateSigner(tt.req)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, signer.Public(), got.Public())
+		})
+	}
+
+	decrypter, err := wrapped.(kmsapi.Decrypter).CreateDecrypter(&kmsapi.CreateDecrypterRequest{
+		DecryptionKey: scryptFile,
+		Password:      password,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, signer.Public(), decrypter.Public())
+}
+
+func TestNewKeyManager_RotateKey(t *testing.T) {
+	km, err := kms.New(context.Background(), kmsapi.Options{Type: kmsapi.SoftKMS})
+	require.NoError(t, err)
+	wrapped := NewKeyManager(km)
+
+	keys := mustPKCS8Keys(t)
+	password := []byte("password")
+	dir := t.TempDir()
+	writeKey := func(name string, block *pem.Block) string {
+		fn := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(fn, pem.EncodeToMemory(block), 0o600))
+		return fn
+	}
+	scryptBlock, err := EncryptPKCS8PrivateKey(keys[0], password, ScryptKDF)
+	require.NoError(t, err)
+	pbkdf2Block, err := EncryptPKCS8PrivateKey(keys[1], password, PBKDF2KDF)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(keys[2])
+	require.NoError(t, err)
+	scryptFile := writeKey("scrypt.key", scryptBlock)
+	pbkdf2File := writeKey("pbkdf2", pbkdf2Block)
+	plainFile := writeKey("plain.key", &pem.Block{Type: "PRIVATE KEY", Bytes: der})
+
+	tests := []struct {
+		name     string
+		req      *certkms.RotateKeyRequest
+		key      crypto.Signer
+		wantKDF  KDF
+		wantName string
+		wantErr  bool
+	}{
+		{"ok/scrypt", &certkms.RotateKeyRequest{Name: scryptFile, Password: password}, keys[0], ScryptKDF, filepath.Join(dir, "scrypt-"), false},
+		{"ok/pbkdf2", &certkms.RotateKeyRequest{Name: "softkms:path=" + pbkdf2File, Password: password}, keys[1], ScryptKDF, filepath.Join(dir, "pbkdf2-"), false},
+		{"ok/plain", &certkms.RotateKeyRequest{Name: plainFile}, keys[2], "", filepath.Join(dir, "plain-"), false},
+		{"fail/password", &certkms.RotateKeyRequest{Name: scryptFile, Password: []byte("foo")}, nil, "", "", true},
+		{"fail/missing", &certkms.RotateKeyRequest{Name: filepath.Join(dir, "missing.key")}, nil, "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := certkms.RotateKey(wrapped, tt.req)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.True(t, strings.HasPrefix(got.Name, tt.wantName), got.Name)
+			assert.Equal(t, filepath.Ext(keyFilename(tt.req.Name)), filepath.Ext(got.Name))
+			assert.IsType(t, tt.key.Public(), got.PublicKey)
+			assert.False(t, tt.key.Public().(interface{ Equal(crypto.PublicKey) bool }).Equal(got.PublicKey))
+
+			// The new key is stored encrypted with a modern KDF.
+			data, err := os.ReadFile(got.Name)
+			require.NoError(t, err)
+			block, _ := pem.Decode(data)
+			require.NotNil(t, block)
+			if tt.wantKDF == "" {
+				assert.Equal(t, "PRIVATE KEY", block.Type)
+			} else {
+				kdf, err := pkcs8KDF(block.Bytes)
+				require.NoError(t, err)
+				assert.Equal(t, tt.wantKDF, kdf)
+			}
+			signer, err := wrapped.CreateSigner(&kmsapi.CreateSignerRequest{SigningKey: got.Name, Password: tt.req.Password})
+			require.NoError(t, err)
+			assert.Equal(t, got.PublicKey, signer.Public())
+
+			// The current key is not modified.
+			current, err := wrapped.CreateSigner(&kmsapi.CreateSignerRequest{SigningKey: tt.req.Name, Password: tt.req.Password})
+			require.NoError(t, err)
+			assert.Equal(t, tt.key.Public(), current.Public())
+		})
+	}
+}
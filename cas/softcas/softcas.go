@@ -3,9 +3,14 @@ package softcas
 import (
 	"context"
 	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/rand"
 	"crypto/rsa"
+	"crypto/sha256"
 	"crypto/x509"
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/pkg/errors"
@@ -15,6 +20,7 @@ import (
 	"go.step.sm/crypto/x509util"
 
 	"github.com/smallstep/certificates/cas/apiv1"
+	certkms "github.com/smallstep/certificates/kms"
 )
 
 func init() {
@@ -28,10 +34,22 @@ var now = time.Now
 // SoftCAS implements a Certificate Authority Service using Golang or KMS
 // crypto. This is the default CAS used in step-ca.
 type SoftCAS struct {
-	CertificateChain  []*x509.Certificate
-	Signer            crypto.Signer
-	CertificateSigner func() ([]*x509.Certificate, crypto.Signer, error)
-	KeyManager        kms.KeyManager
+	CertificateChain   []*x509.Certificate
+	Signer             crypto.Signer
+	CertificateSigner  func() ([]*x509.Certificate, crypto.Signer, error)
+	KeyManager         kms.KeyManager
+	SignatureAlgorithm x509.SignatureAlgorithm
+}
+
+// signatureAlgorithms maps the names of the supported signature algorithms to
+// their x509 values. Only RSA algorithms can be configured.
+var signatureAlgorithms = map[string]x509.SignatureAlgorithm{
+	"SHA256-RSA":    x509.SHA256WithRSA,
+	"SHA384-RSA":    x509.SHA384WithRSA,
+	"SHA512-RSA":    x509.SHA512WithRSA,
+	"SHA256-RSAPSS": x509.SHA256WithRSAPSS,
+	"SHA384-RSAPSS": x509.SHA384WithRSAPSS,
+	"SHA512-RSAPSS": x509.SHA512WithRSAPSS,
 }
 
 // New creates a new CertificateAuthorityService implementation using Golang or KMS
@@ -45,11 +63,26 @@ func New(_ context.Context, opts apiv1.Options) (*SoftCAS, error) {
 			return nil, errors.New("softCAS 'signer' cannot be nil")
 		}
 	}
+
+	var sa x509.SignatureAlgorithm
+	if opts.SignatureAlgorithm != "" {
+		var ok bool
+		if sa, ok = signatureAlgorithms[strings.ToUpper(opts.SignatureAlgorithm)]; !ok {
+			return nil, errors.Errorf("softCAS 'signatureAlgorithm=%s' is not supported", opts.SignatureAlgorithm)
+		}
+		if opts.Signer != nil {
+			if _, ok := opts.Signer.Public().(*rsa.PublicKey); !ok {
+				return nil, errors.Errorf("softCAS 'signatureAlgorithm=%s' requires an RSA signer", opts.SignatureAlgorithm)
+			}
+		}
+	}
+
 	return &SoftCAS{
-		CertificateChain:  opts.CertificateChain,
-		Signer:            opts.Signer,
-		CertificateSigner: opts.CertificateSigner,
-		KeyManager:        opts.KeyManager,
+		CertificateChain:   opts.CertificateChain,
+		Signer:             opts.Signer,
+		CertificateSigner:  opts.CertificateSigner,
+		KeyManager:         opts.KeyManager,
+		SignatureAlgorithm: sa,
 	}, nil
 }
 
@@ -90,7 +123,7 @@ func (c *SoftCAS) CreateCertificate(req *apiv1.CreateCertificateRequest) (*apiv1
 	}
 	req.Template.Issuer = chain[0].Subject
 
-	cert, err := createCertificate(req.Template, chain[0], req.Template.PublicKey, signer)
+	cert, err := c.createCertificate(req.Template, chain[0], req.Template.PublicKey, signer)
 	if err != nil {
 		return nil, err
 	}
@@ -120,7 +153,7 @@ func (c *SoftCAS) RenewCertificate(req *apiv1.RenewCertificateRequest) (*apiv1.R
 	}
 	req.Template.Issuer = chain[0].Subject
 
-	cert, err := createCertificate(req.Template, chain[0], req.Template.PublicKey, signer)
+	cert, err := c.createCertificate(req.Template, chain[0], req.Template.PublicKey, signer)
 	if err != nil {
 		return nil, err
 	}
@@ -151,6 +184,9 @@ func (c *SoftCAS) CreateCRL(req *apiv1.CreateCRLRequest) (*apiv1.CreateCRLRespon
 	if err != nil {
 		return nil, err
 	}
+	if req.RevocationList.SignatureAlgorithm == 0 && c.useSignatureAlgorithm(signer) {
+		req.RevocationList.SignatureAlgorithm = c.SignatureAlgorithm
+	}
 	revocationListBytes, err := x509.CreateRevocationList(rand.Reader, req.RevocationList, certChain[0], signer)
 	if err != nil {
 		return nil, err
@@ -162,9 +198,11 @@ func (c *SoftCAS) CreateCRL(req *apiv1.CreateCRLRequest) (*apiv1.CreateCRLRespon
 // CreateCertificateAuthority creates a root or an intermediate certificate.
 func (c *SoftCAS) CreateCertificateAuthority(req *apiv1.CreateCertificateAuthorityRequest) (*apiv1.CreateCertificateAuthorityResponse, error) {
 	switch {
-	case req.Template == nil:
+	case req.CrossSign != nil && req.Type != apiv1.IntermediateCA:
+		return nil, errors.New("createCertificateAuthorityRequest `crossSign` requires an intermediate type")
+	case req.Template == nil && req.CrossSign == nil:
 		return nil, errors.New("createCertificateAuthorityRequest `template` cannot be nil")
-	case req.Lifetime == 0:
+	case req.Lifetime == 0 && req.Template != nil:
 		return nil, errors.New("createCertificateAuthorityRequest `lifetime` cannot be 0")
 	case req.Type == apiv1.IntermediateCA && req.Parent == nil:
 		return nil, errors.New("createCertificateAuthorityRequest `parent` cannot be nil")
@@ -174,12 +212,11 @@ func (c *SoftCAS) CreateCertificateAuthority(req *apiv1.CreateCertificateAuthori
 		return nil, errors.New("createCertificateAuthorityRequest `parent.signer` cannot be nil")
 	}
 
-	key, err := c.createKey(req.CreateKey)
-	if err != nil {
-		return nil, err
+	if req.CrossSign != nil {
+		return c.createCrossSignedCertificateAuthority(req)
 	}
 
-	signer, err := c.createSigner(&key.CreateSignerRequest)
+	key, signer, err := c.createKeyAndSigner(req)
 	if err != nil {
 		return nil, err
 	}
@@ -195,12 +232,12 @@ func (c *SoftCAS) CreateCertificateAuthority(req *apiv1.CreateCertificateAuthori
 	var cert *x509.Certificate
 	switch req.Type {
 	case apiv1.RootCA:
-		cert, err = createCertificate(req.Template, req.Template, signer.Public(), signer)
+		cert, err = c.createCertificate(req.Template, req.Template, signer.Public(), signer)
 		if err != nil {
 			return nil, err
 		}
 	case apiv1.IntermediateCA:
-		cert, err = createCertificate(req.Template, req.Parent.Certificate, signer.Public(), req.Parent.Signer)
+		cert, err = c.createCertificate(req.Template, req.Parent.Certificate, signer.Public(), req.Parent.Signer)
 		if err != nil {
 			return nil, err
 		}
@@ -226,6 +263,99 @@ func (c *SoftCAS) CreateCertificateAuthority(req *apiv1.CreateCertificateAuthori
 	}, nil
 }
 
+// createCrossSignedCertificateAuthority signs the public key of an existing
+// intermediate with the parent in the request. The new certificate keeps the
+// subject and the subject key identifier of the existing one, so clients can
+// build a path to either of the roots.
+func (c *SoftCAS) createCrossSignedCertificateAuthority(req *apiv1.CreateCertificateAuthorityRequest) (*apiv1.CreateCertificateAuthorityResponse, error) {
+	template := req.Template
+	if template == nil {
+		template = crossSignTemplate(req.CrossSign)
+	} else {
+		t := now()
+		if template.NotBefore.IsZero() {
+			template.NotBefore = t.Add(-1 * req.Backdate)
+		}
+		if template.NotAfter.IsZero() {
+			template.NotAfter = t.Add(req.Lifetime)
+		}
+	}
+
+	cert, err := c.createCertificate(template, req.Parent.Certificate, req.CrossSign.PublicKey, req.Parent.Signer)
+	if err != nil {
+		return nil, err
+	}
+
+	chain := append([]*x509.Certificate{req.Parent.Certificate}, req.Parent.CertificateChain...)
+	return &apiv1.CreateCertificateAuthorityResponse{
+		Name:             cert.Subject.CommonName,
+		Certificate:      cert,
+		CertificateChain: chain,
+		PublicKey:        cert.PublicKey,
+	}, nil
+}
+
+// crossSignTemplate returns a template with the subject, CA extensions and
+// validity period of the given certificate. The serial number, the issuer, and
+// the issuer specific extensions, like the authority key identifier, are not
+// copied.
+func crossSignTemplate(cert *x509.Certificate) *x509.Certificate {
+	return &x509.Certificate{
+		RawSubject:                  cert.RawSubject,
+		NotBefore:                   cert.NotBefore,
+		NotAfter:                    cert.NotAfter,
+		KeyUsage:                    cert.KeyUsage,
+		ExtKeyUsage:                 cert.ExtKeyUsage,
+		UnknownExtKeyUsage:          cert.UnknownExtKeyUsage,
+		BasicConstraintsValid:       cert.BasicConstraintsValid,
+		IsCA:                        cert.IsCA,
+		MaxPathLen:                  cert.MaxPathLen,
+		MaxPathLenZero:              cert.MaxPathLenZero,
+		SubjectKeyId:                cert.SubjectKeyId,
+		PolicyIdentifiers:           cert.PolicyIdentifiers,
+		Policies:                    cert.Policies,
+		PermittedDNSDomainsCritical: cert.PermittedDNSDomainsCritical,
+		PermittedDNSDomains:         cert.PermittedDNSDomains,
+		ExcludedDNSDomains:          cert.ExcludedDNSDomains,
+		PermittedIPRanges:           cert.PermittedIPRanges,
+		ExcludedIPRanges:            cert.ExcludedIPRanges,
+		PermittedEmailAddresses:     cert.PermittedEmailAddresses,
+		ExcludedEmailAddresses:      cert.ExcludedEmailAddresses,
+		PermittedURIDomains:         cert.PermittedURIDomains,
+		ExcludedURIDomains:          cert.ExcludedURIDomains,
+	}
+}
+
+// CheckHealth signs a random message with the issuer key to check that the
+// key, or the KMS where the key is stored, is available.
+func (c *SoftCAS) CheckHealth(context.Context) error {
+	_, signer, err := c.getCertSigner()
+	if err != nil {
+		return errors.Wrap(err, "error getting certificate signer")
+	}
+	if signer == nil {
+		return errors.New("certificate signer is not configured")
+	}
+
+	msg := make([]byte, 32)
+	if _, err := rand.Read(msg); err != nil {
+		return errors.Wrap(err, "error generating random message")
+	}
+	var opts crypto.SignerOpts = crypto.SHA256
+	if _, ok := signer.Public().(ed25519.PublicKey); ok {
+		opts = crypto.Hash(0)
+	} else if _, ok := mldsaSignatureAlgorithm(signer.Public()); ok {
+		opts = crypto.Hash(0)
+	} else {
+		sum := sha256.Sum256(msg)
+		msg = sum[:]
+	}
+	if _, err := signer.Sign(rand.Reader, msg, opts); err != nil {
+		return errors.Wrap(err, "error signing with certificate signer")
+	}
+	return nil
+}
+
 // initializeKeyManager initializes the default key manager if was not given.
 func (c *SoftCAS) initializeKeyManager() (err error) {
 	if c.KeyManager == nil {
@@ -244,6 +374,33 @@ func (c *SoftCAS) getCertSigner() ([]*x509.Certificate, crypto.Signer, error) {
 	return c.CertificateChain, c.Signer, nil
 }
 
+// createKeyAndSigner creates the key and signer of a new certificate
+// authority. Post-quantum keys are not supported by the KMS, and they are
+// created in software.
+func (c *SoftCAS) createKeyAndSigner(req *apiv1.CreateCertificateAuthorityRequest) (*kmsapi.CreateKeyResponse, crypto.Signer, error) {
+	if req.KeyAlgorithm != "" {
+		return createMLDSAKey(req.KeyAlgorithm)
+	}
+
+	var key *kmsapi.CreateKeyResponse
+	var err error
+	if req.RotateKey != "" {
+		key, err = c.rotateKey(req.RotateKey, req.RotateKeyPassword)
+	} else {
+		key, err = c.createKey(req.CreateKey)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	signer, err := c.createSigner(&key.CreateSignerRequest)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return key, signer, nil
+}
+
 // createKey uses the configured kms to create a key.
 func (c *SoftCAS) createKey(req *kmsapi.CreateKeyRequest) (*kmsapi.CreateKeyResponse, error) {
 	if err := c.initializeKeyManager(); err != nil {
@@ -257,6 +414,18 @@ func (c *SoftCAS) createKey(req *kmsapi.CreateKeyRequest) (*kmsapi.CreateKeyResp
 	return c.KeyManager.CreateKey(req)
 }
 
+// rotateKey uses the configured kms to create a key that replaces the given
+// one.
+func (c *SoftCAS) rotateKey(name string, password []byte) (*kmsapi.CreateKeyResponse, error) {
+	if err := c.initializeKeyManager(); err != nil {
+		return nil, err
+	}
+	return certkms.RotateKey(c.KeyManager, &certkms.RotateKeyRequest{
+		Name:     name,
+		Password: password,
+	})
+}
+
 // createSigner uses the configured kms to create a singer
 func (c *SoftCAS) createSigner(req *kmsapi.CreateSignerRequest) (crypto.Signer, error) {
 	if err := c.initializeKeyManager(); err != nil {
@@ -267,11 +436,15 @@ func (c *SoftCAS) createSigner(req *kmsapi.CreateSignerRequest) (crypto.Signer,
 
 // createCertificate sets the SignatureAlgorithm of the template if necessary
 // and calls x509util.CreateCertificate.
-func createCertificate(template, parent *x509.Certificate, pub crypto.PublicKey, signer crypto.Signer) (*x509.Certificate, error) {
-	// Signers can specify the signature algorithm. This is especially important
-	// when x509.CreateCertificate attempts to validate a RSAPSS signature.
+func (c *SoftCAS) createCertificate(template, parent *x509.Certificate, pub crypto.PublicKey, signer crypto.Signer) (*x509.Certificate, error) {
+	// The configured signature algorithm takes precedence over the ones
+	// defined by the signer or the parent. Signers can specify the signature
+	// algorithm. This is especially important when x509.CreateCertificate
+	// attempts to validate a RSAPSS signature.
 	if template.SignatureAlgorithm == 0 {
-		if sa, ok := signer.(apiv1.SignatureAlgorithmGetter); ok {
+		if c.useSignatureAlgorithm(signer) {
+			template.SignatureAlgorithm = c.SignatureAlgorithm
+		} else if sa, ok := signer.(apiv1.SignatureAlgorithmGetter); ok {
 			template.SignatureAlgorithm = sa.SignatureAlgorithm()
 		} else if _, ok := parent.PublicKey.(*rsa.PublicKey); ok {
 			// For RSA issuers, only overwrite the default algorithm is the
@@ -281,9 +454,74 @@ func createCertificate(template, parent *x509.Certificate, pub crypto.PublicKey,
 			}
 		}
 	}
+	if signer != nil {
+		if err := checkSignatureAlgorithm(template.SignatureAlgorithm, signer); err != nil {
+			return nil, err
+		}
+	}
 	return x509util.CreateCertificate(template, parent, pub, signer)
 }
 
+// checkSignatureAlgorithm returns an error if the signer key cannot be used to
+// sign certificates, or if the given signature algorithm cannot be used with
+// it. Ed448 keys are not supported by crypto/x509, and ML-DSA keys are only
+// supported if step-ca is built with the mldsa tag.
+func checkSignatureAlgorithm(sa x509.SignatureAlgorithm, signer crypto.Signer) error {
+	var ok bool
+	switch pub := signer.Public().(type) {
+	case *rsa.PublicKey:
+		ok = isRSA(sa)
+	case *ecdsa.PublicKey:
+		ok = isECDSA(sa)
+	case ed25519.PublicKey:
+		ok = sa == x509.PureEd25519
+	default:
+		mldsaAlgorithm, isMLDSA := mldsaSignatureAlgorithm(pub)
+		if !isMLDSA {
+			return errors.Errorf("signer key type %T is not supported", pub)
+		}
+		ok = sa == mldsaAlgorithm
+	}
+	if sa != x509.UnknownSignatureAlgorithm && !ok {
+		return apiv1.ValidationError{
+			Message: fmt.Sprintf("signature algorithm %s cannot be used with a %s key", sa, keyType(signer.Public())),
+		}
+	}
+	return nil
+}
+
+func keyType(pub crypto.PublicKey) string {
+	switch pub.(type) {
+	case *rsa.PublicKey:
+		return "RSA"
+	case *ecdsa.PublicKey:
+		return "ECDSA"
+	case ed25519.PublicKey:
+		return "Ed25519"
+	default:
+		return fmt.Sprintf("%T", pub)
+	}
+}
+
+// useSignatureAlgorithm returns true if the configured signature algorithm
+// must be used with the given signer. Only RSA signers are supported.
+func (c *SoftCAS) useSignatureAlgorithm(signer crypto.Signer) bool {
+	if c.SignatureAlgorithm == x509.UnknownSignatureAlgorithm || signer == nil {
+		return false
+	}
+	_, ok := signer.Public().(*rsa.PublicKey)
+	return ok
+}
+
+func isECDSA(sa x509.SignatureAlgorithm) bool {
+	switch sa {
+	case x509.ECDSAWithSHA256, x509.ECDSAWithSHA384, x509.ECDSAWithSHA512:
+		return true
+	default:
+		return false
+	}
+}
+
 func isRSA(sa x509.SignatureAlgorithm) bool {
 	switch sa {
 	case x509.SHA256WithRSA, x509.SHA384WithRSA, x509.SHA512WithRSA:
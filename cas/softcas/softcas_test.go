@@ -5,6 +5,7 @@ import (
 	"context"
 	"crypto"
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
@@ -217,6 +218,9 @@ func TestNew(t *testing.T) {
 		{"ok with callback", args{context.Background(), apiv1.Options{CertificateSigner: testCertificateSigner}}, &SoftCAS{CertificateSigner: testCertificateSigner}, false},
 		{"fail no issuer", args{context.Background(), apiv1.Options{Signer: testSigner}}, nil, true},
 		{"fail no signer", args{context.Background(), apiv1.Options{CertificateChain: []*x509.Certificate{testIssuer}}}, nil, true},
+		{"ok with signature algorithm", args{context.Background(), apiv1.Options{CertificateSigner: testCertificateSigner, SignatureAlgorithm: "sha256-rsapss"}}, &SoftCAS{CertificateSigner: testCertificateSigner, SignatureAlgorithm: x509.SHA256WithRSAPSS}, false},
+		{"fail signature algorithm", args{context.Background(), apiv1.Options{CertificateSigner: testCertificateSigner, SignatureAlgorithm: "ECDSA-SHA256"}}, nil, true},
+		{"fail signature algorithm signer", args{context.Background(), apiv1.Options{CertificateChain: []*x509.Certificate{testIssuer}, Signer: testSigner, SignatureAlgorithm: "SHA256-RSAPSS"}}, nil, true},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -311,6 +315,32 @@ func TestSoftCAS_GetSigner(t *testing.T) {
 	}
 }
 
+func TestSoftCAS_CheckHealth(t *testing.T) {
+	ca, err := minica.New()
+	require.NoError(t, err)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name      string
+		ca        *SoftCAS
+		assertion assert.ErrorAssertionFunc
+	}{
+		{"ok ed25519", &SoftCAS{CertificateChain: []*x509.Certificate{testIssuer}, Signer: testSigner}, assert.NoError},
+		{"ok ecdsa", &SoftCAS{CertificateChain: []*x509.Certificate{ca.Intermediate}, Signer: ca.Signer}, assert.NoError},
+		{"ok rsa", &SoftCAS{Signer: rsaKey}, assert.NoError},
+		{"ok certificateSigner", &SoftCAS{CertificateSigner: testCertificateSigner}, assert.NoError},
+		{"fail certificateSigner", &SoftCAS{CertificateSigner: testFailCertificateSigner}, assert.Error},
+		{"fail signer", &SoftCAS{CertificateChain: []*x509.Certificate{testIssuer}, Signer: &badSigner{}}, assert.Error},
+		{"fail no signer", &SoftCAS{}, assert.Error},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.assertion(t, tt.ca.CheckHealth(context.Background()))
+		})
+	}
+}
+
 func TestSoftCAS_CreateCertificate(t *testing.T) {
 	mockNow(t)
 	// Set rand.Reader to EOF
@@ -389,6 +419,9 @@ func TestSoftCAS_CreateCertificate(t *testing.T) {
 		{"fail with callback", fields{nil, nil, testFailCertificateSigner}, args{&apiv1.CreateCertificateRequest{
 			Template: testTemplate, Lifetime: 24 * time.Hour,
 		}}, nil, true},
+		{"fail nil signer", fields{testIssuer, nil, nil}, args{&apiv1.CreateCertificateRequest{
+			Template: testTemplate, Lifetime: 24 * time.Hour,
+		}}, nil, true},
 	}
 
 	for _, tt := range tests {
@@ -471,6 +504,90 @@ func TestSoftCAS_CreateCertificate_pss(t *testing.T) {
 	}
 }
 
+func TestSoftCAS_CreateCertificate_signatureAlgorithm(t *testing.T) {
+	signer, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "Test Root CA"},
+		KeyUsage:              x509.KeyUsageCRLSign | x509.KeyUsageCertSign,
+		PublicKey:             signer.Public(),
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLen:            0,
+		SerialNumber:          big.NewInt(1234),
+		SignatureAlgorithm:    x509.SHA256WithRSA,
+		NotBefore:             now,
+		NotAfter:              now.Add(24 * time.Hour),
+	}
+
+	iss, err := x509util.CreateCertificate(template, template, signer.Public(), signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := New(context.Background(), apiv1.Options{
+		CertificateChain:   []*x509.Certificate{iss},
+		Signer:             signer,
+		SignatureAlgorithm: "SHA384-RSAPSS",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := c.CreateCertificate(&apiv1.CreateCertificateRequest{
+		Template: &x509.Certificate{
+			Subject:      pkix.Name{CommonName: "test.smallstep.com"},
+			DNSNames:     []string{"test.smallstep.com"},
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+			PublicKey:    testSigner.Public(),
+			SerialNumber: big.NewInt(1234),
+		},
+		Lifetime: time.Hour, Backdate: time.Minute,
+	})
+	if err != nil {
+		t.Fatalf("SoftCAS.CreateCertificate() error = %v", err)
+	}
+	if cert.Certificate.SignatureAlgorithm != x509.SHA384WithRSAPSS {
+		t.Errorf("Certificate.SignatureAlgorithm = %v, want %v", cert.Certificate.SignatureAlgorithm, x509.SHA384WithRSAPSS)
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(iss)
+	if _, err = cert.Certificate.Verify(x509.VerifyOptions{
+		CurrentTime: time.Now(),
+		Roots:       pool,
+		KeyUsages:   []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
+	}); err != nil {
+		t.Errorf("Certificate.Verify() error = %v", err)
+	}
+
+	crl, err := c.CreateCRL(&apiv1.CreateCRLRequest{
+		RevocationList: &x509.RevocationList{
+			Number:     big.NewInt(1),
+			ThisUpdate: now,
+			NextUpdate: now.Add(time.Hour),
+		},
+	})
+	if err != nil {
+		t.Fatalf("SoftCAS.CreateCRL() error = %v", err)
+	}
+	rl, err := x509.ParseRevocationList(crl.CRL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rl.SignatureAlgorithm != x509.SHA384WithRSAPSS {
+		t.Errorf("RevocationList.SignatureAlgorithm = %v, want %v", rl.SignatureAlgorithm, x509.SHA384WithRSAPSS)
+	}
+	if err := rl.CheckSignatureFrom(iss); err != nil {
+		t.Errorf("RevocationList.CheckSignatureFrom() error = %v", err)
+	}
+}
+
 func TestSoftCAS_CreateCertificate_ec_rsa(t *testing.T) {
 	rootSigner, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
 	if err != nil {
@@ -921,6 +1038,153 @@ func TestSoftCAS_defaultKeyManager(t *testing.T) {
 	}
 }
 
+func TestSoftCAS_CreateCertificateAuthority_ed25519(t *testing.T) {
+	c := &SoftCAS{}
+	root, err := c.CreateCertificateAuthority(&apiv1.CreateCertificateAuthorityRequest{
+		Type: apiv1.RootCA,
+		Template: &x509.Certificate{
+			Subject:               pkix.Name{CommonName: "Test Root CA"},
+			KeyUsage:              x509.KeyUsageCRLSign | x509.KeyUsageCertSign,
+			BasicConstraintsValid: true,
+			IsCA:                  true,
+			MaxPathLen:            1,
+			SerialNumber:          big.NewInt(1),
+		},
+		Lifetime:  24 * time.Hour,
+		CreateKey: &kmsapi.CreateKeyRequest{SignatureAlgorithm: kmsapi.PureEd25519},
+	})
+	if err != nil {
+		t.Fatalf("SoftCAS.CreateCertificateAuthority() error = %v", err)
+	}
+	intermediate, err := c.CreateCertificateAuthority(&apiv1.CreateCertificateAuthorityRequest{
+		Type: apiv1.IntermediateCA,
+		Template: &x509.Certificate{
+			Subject:               pkix.Name{CommonName: "Test Intermediate CA"},
+			KeyUsage:              x509.KeyUsageCRLSign | x509.KeyUsageCertSign,
+			BasicConstraintsValid: true,
+			IsCA:                  true,
+			MaxPathLen:            0,
+			MaxPathLenZero:        true,
+			SerialNumber:          big.NewInt(2),
+		},
+		Lifetime:  24 * time.Hour,
+		Parent:    root,
+		CreateKey: &kmsapi.CreateKeyRequest{SignatureAlgorithm: kmsapi.PureEd25519},
+	})
+	if err != nil {
+		t.Fatalf("SoftCAS.CreateCertificateAuthority() error = %v", err)
+	}
+	for _, crt := range []*x509.Certificate{root.Certificate, intermediate.Certificate} {
+		if crt.SignatureAlgorithm != x509.PureEd25519 {
+			t.Errorf("Certificate.SignatureAlgorithm = %v, want %v", crt.SignatureAlgorithm, x509.PureEd25519)
+		}
+	}
+
+	cas, err := New(context.Background(), apiv1.Options{
+		CertificateChain: []*x509.Certificate{intermediate.Certificate},
+		Signer:           intermediate.Signer,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := cas.CreateCertificate(&apiv1.CreateCertificateRequest{
+		Template: &x509.Certificate{
+			Subject:      pkix.Name{CommonName: "test.smallstep.com"},
+			DNSNames:     []string{"test.smallstep.com"},
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+			PublicKey:    testSigner.Public(),
+			SerialNumber: big.NewInt(3),
+		},
+		Lifetime: time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("SoftCAS.CreateCertificate() error = %v", err)
+	}
+	if leaf.Certificate.SignatureAlgorithm != x509.PureEd25519 {
+		t.Errorf("Certificate.SignatureAlgorithm = %v, want %v", leaf.Certificate.SignatureAlgorithm, x509.PureEd25519)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(root.Certificate)
+	intermediates := x509.NewCertPool()
+	intermediates.AddCert(intermediate.Certificate)
+	if _, err := leaf.Certificate.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}); err != nil {
+		t.Errorf("Certificate.Verify() error = %v", err)
+	}
+
+	// Templates with a signature algorithm for other key types are rejected.
+	_, err = cas.CreateCertificate(&apiv1.CreateCertificateRequest{
+		Template: &x509.Certificate{
+			Subject:            pkix.Name{CommonName: "test.smallstep.com"},
+			PublicKey:          testSigner.Public(),
+			SerialNumber:       big.NewInt(4),
+			SignatureAlgorithm: x509.SHA256WithRSA,
+		},
+		Lifetime: time.Hour,
+	})
+	var ve apiv1.ValidationError
+	if !errors.As(err, &ve) {
+		t.Errorf("SoftCAS.CreateCertificate() error = %v, want apiv1.ValidationError", err)
+	}
+}
+
+type unsupportedSigner struct {
+	crypto.Signer
+}
+
+func (unsupportedSigner) Public() crypto.PublicKey {
+	return []byte("ed448-public-key")
+}
+
+func Test_checkSignatureAlgorithm(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type args struct {
+		sa     x509.SignatureAlgorithm
+		signer crypto.Signer
+	}
+	tests := []struct {
+		name    string
+		args    args
+		wantErr bool
+	}{
+		{"ok rsa", args{x509.SHA256WithRSA, rsaKey}, false},
+		{"ok rsa pss", args{x509.SHA512WithRSAPSS, rsaKey}, false},
+		{"ok rsa default", args{x509.UnknownSignatureAlgorithm, rsaKey}, false},
+		{"ok ecdsa", args{x509.ECDSAWithSHA256, ecKey}, false},
+		{"ok ecdsa default", args{x509.UnknownSignatureAlgorithm, ecKey}, false},
+		{"ok ed25519", args{x509.PureEd25519, edKey}, false},
+		{"ok ed25519 default", args{x509.UnknownSignatureAlgorithm, edKey}, false},
+		{"fail rsa", args{x509.ECDSAWithSHA256, rsaKey}, true},
+		{"fail ecdsa", args{x509.PureEd25519, ecKey}, true},
+		{"fail ed25519", args{x509.SHA256WithRSAPSS, edKey}, true},
+		{"fail unsupported", args{x509.UnknownSignatureAlgorithm, unsupportedSigner{}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := checkSignatureAlgorithm(tt.args.sa, tt.args.signer); (err != nil) != tt.wantErr {
+				t.Errorf("checkSignatureAlgorithm() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
 func Test_isRSA(t *testing.T) {
 	type args struct {
 		sa x509.SignatureAlgorithm
@@ -949,3 +1213,165 @@ func Test_isRSA(t *testing.T) {
 		})
 	}
 }
+
+func TestSoftCAS_CreateCertificateAuthority_rotateKey(t *testing.T) {
+	ca, err := minica.New()
+	require.NoError(t, err)
+
+	c := &SoftCAS{KeyManager: &mockKeyManager{}}
+	template := &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "Test Intermediate CA"},
+		KeyUsage:              x509.KeyUsageCRLSign | x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLen:            0,
+		MaxPathLenZero:        true,
+	}
+	parent := &apiv1.CreateCertificateAuthorityResponse{
+		Certificate: ca.Root,
+		Signer:      ca.RootSigner,
+	}
+
+	resp, err := c.CreateCertificateAuthority(&apiv1.CreateCertificateAuthorityRequest{
+		Type:      apiv1.IntermediateCA,
+		Template:  template,
+		Lifetime:  time.Hour,
+		Parent:    parent,
+		RotateKey: "cloudkms:projects/p/locations/l/keyRings/r/cryptoKeys/intermediate/cryptoKeyVersions/1",
+		CreateKey: &kmsapi.CreateKeyRequest{Name: "ignored"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "cloudkms:projects/p/locations/l/keyRings/r/cryptoKeys/intermediate", resp.KeyName)
+	assert.Equal(t, testSigner.Public(), resp.Certificate.PublicKey)
+	assert.NoError(t, resp.Certificate.CheckSignatureFrom(ca.Root))
+
+	// Keys in files cannot be rotated.
+	_, err = c.CreateCertificateAuthority(&apiv1.CreateCertificateAuthorityRequest{
+		Type:      apiv1.IntermediateCA,
+		Template:  template,
+		Lifetime:  time.Hour,
+		Parent:    parent,
+		RotateKey: "intermediate_ca_key",
+	})
+	assert.ErrorAs(t, err, &kmsapi.NotImplementedError{})
+}
+
+func TestSoftCAS_CreateCertificateAuthority_crossSign(t *testing.T) {
+	caTemplate := func(cn string, maxPathLen int) *x509.Certificate {
+		return &x509.Certificate{
+			Subject:               pkix.Name{CommonName: cn},
+			KeyUsage:              x509.KeyUsageCRLSign | x509.KeyUsageCertSign,
+			BasicConstraintsValid: true,
+			IsCA:                  true,
+			MaxPathLen:            maxPathLen,
+			MaxPathLenZero:        maxPathLen == 0,
+		}
+	}
+
+	c := &SoftCAS{}
+	oldRoot, err := c.CreateCertificateAuthority(&apiv1.CreateCertificateAuthorityRequest{
+		Type:     apiv1.RootCA,
+		Template: caTemplate("Old Root CA", 1),
+		Lifetime: 24 * time.Hour,
+	})
+	require.NoError(t, err)
+	newRoot, err := c.CreateCertificateAuthority(&apiv1.CreateCertificateAuthorityRequest{
+		Type:      apiv1.RootCA,
+		Template:  caTemplate("New Root CA", 1),
+		Lifetime:  48 * time.Hour,
+		CreateKey: &kmsapi.CreateKeyRequest{SignatureAlgorithm: kmsapi.ECDSAWithSHA384},
+	})
+	require.NoError(t, err)
+	intermediate, err := c.CreateCertificateAuthority(&apiv1.CreateCertificateAuthorityRequest{
+		Type:     apiv1.IntermediateCA,
+		Template: caTemplate("Intermediate CA", 0),
+		Lifetime: 24 * time.Hour,
+		Parent:   oldRoot,
+	})
+	require.NoError(t, err)
+
+	crossSigned, err := c.CreateCertificateAuthority(&apiv1.CreateCertificateAuthorityRequest{
+		Type:      apiv1.IntermediateCA,
+		Parent:    newRoot,
+		CrossSign: intermediate.Certificate,
+	})
+	require.NoError(t, err)
+
+	cert := crossSigned.Certificate
+	assert.Equal(t, intermediate.Certificate.RawSubject, cert.RawSubject)
+	assert.Equal(t, intermediate.Certificate.SubjectKeyId, cert.SubjectKeyId)
+	assert.Equal(t, intermediate.Certificate.PublicKey, cert.PublicKey)
+	assert.Equal(t, intermediate.Certificate.NotBefore, cert.NotBefore)
+	assert.Equal(t, intermediate.Certificate.NotAfter, cert.NotAfter)
+	assert.True(t, cert.MaxPathLenZero)
+	assert.Equal(t, newRoot.Certificate.RawSubject, cert.RawIssuer)
+	assert.Equal(t, newRoot.Certificate.SubjectKeyId, cert.AuthorityKeyId)
+	assert.NotEqual(t, intermediate.Certificate.SerialNumber, cert.SerialNumber)
+	assert.Equal(t, x509.ECDSAWithSHA384, cert.SignatureAlgorithm)
+	assert.Equal(t, []*x509.Certificate{newRoot.Certificate}, crossSigned.CertificateChain)
+	assert.Equal(t, intermediate.Certificate.PublicKey, crossSigned.PublicKey)
+	assert.Nil(t, crossSigned.Signer)
+	assert.Empty(t, crossSigned.KeyName)
+
+	// Leaves issued by the intermediate can be verified with both roots.
+	cas, err := New(context.Background(), apiv1.Options{
+		CertificateChain: []*x509.Certificate{intermediate.Certificate},
+		Signer:           intermediate.Signer,
+	})
+	require.NoError(t, err)
+	leaf, err := cas.CreateCertificate(&apiv1.CreateCertificateRequest{
+		Template: &x509.Certificate{
+			Subject:     pkix.Name{CommonName: "test.smallstep.com"},
+			DNSNames:    []string{"test.smallstep.com"},
+			KeyUsage:    x509.KeyUsageDigitalSignature,
+			ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+			PublicKey:   testSigner.Public(),
+		},
+		Lifetime: time.Hour,
+	})
+	require.NoError(t, err)
+	for _, tc := range []struct {
+		root, intermediate *x509.Certificate
+	}{
+		{oldRoot.Certificate, intermediate.Certificate},
+		{newRoot.Certificate, cert},
+	} {
+		roots := x509.NewCertPool()
+		roots.AddCert(tc.root)
+		intermediates := x509.NewCertPool()
+		intermediates.AddCert(tc.intermediate)
+		_, err := leaf.Certificate.Verify(x509.VerifyOptions{
+			Roots:         roots,
+			Intermediates: intermediates,
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		})
+		assert.NoError(t, err)
+	}
+
+	// A template can be used to change the validity period.
+	template := crossSignTemplate(intermediate.Certificate)
+	template.NotBefore, template.NotAfter = time.Time{}, time.Time{}
+	crossSigned, err = c.CreateCertificateAuthority(&apiv1.CreateCertificateAuthorityRequest{
+		Type:      apiv1.IntermediateCA,
+		Template:  template,
+		Lifetime:  36 * time.Hour,
+		Parent:    newRoot,
+		CrossSign: intermediate.Certificate,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, intermediate.Certificate.PublicKey, crossSigned.Certificate.PublicKey)
+	assert.WithinDuration(t, time.Now().Add(36*time.Hour), crossSigned.Certificate.NotAfter, time.Minute)
+
+	// Cross-signing requires an intermediate type and a parent.
+	_, err = c.CreateCertificateAuthority(&apiv1.CreateCertificateAuthorityRequest{
+		Type:      apiv1.RootCA,
+		Parent:    newRoot,
+		CrossSign: intermediate.Certificate,
+	})
+	assert.EqualError(t, err, "createCertificateAuthorityRequest `crossSign` requires an intermediate type")
+	_, err = c.CreateCertificateAuthority(&apiv1.CreateCertificateAuthorityRequest{
+		Type:      apiv1.IntermediateCA,
+		CrossSign: intermediate.Certificate,
+	})
+	assert.EqualError(t, err, "createCertificateAuthorityRequest `parent` cannot be nil")
+}
@@ -0,0 +1,133 @@
+package stepcas
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/ca"
+	"github.com/smallstep/certificates/cas/apiv1"
+)
+
+const (
+	failoverActivePassive = "active-passive"
+	failoverRoundRobin    = "round-robin"
+)
+
+// upstream contains the client and the token issuer of an upstream CA.
+type upstream struct {
+	client *ca.Client
+	iss    stepIssuer
+}
+
+// failover sends the requests to a list of upstream CAs, moving to the next
+// one if the connection fails.
+type failover struct {
+	upstreams  []upstream
+	roundRobin bool
+	next       atomic.Uint32
+}
+
+// parseFailoverURLs validates the failover options and returns the URLs of the
+// additional upstream CAs.
+func parseFailoverURLs(o *apiv1.FailoverOptions) ([]*url.URL, error) {
+	if o == nil {
+		return nil, nil
+	}
+
+	switch strings.ToLower(o.Policy) {
+	case "", failoverActivePassive, failoverRoundRobin:
+	default:
+		return nil, errors.Errorf("stepCAS `failover.policy` %s is not supported", o.Policy)
+	}
+	if len(o.CertificateAuthorities) == 0 {
+		return nil, errors.New("stepCAS `failover.certificateAuthorities` cannot be empty")
+	}
+
+	urls := make([]*url.URL, 0, len(o.CertificateAuthorities))
+	for _, s := range o.CertificateAuthorities {
+		u, err := url.Parse(s)
+		if err != nil || u.Host == "" {
+			return nil, errors.Errorf("stepCAS `failover.certificateAuthorities` %q is not valid", s)
+		}
+		urls = append(urls, u)
+	}
+	return urls, nil
+}
+
+// newFailover creates the failover using the primary client and issuer and the
+// given failover URLs. The clients of the other upstream CAs are created with
+// the same options as the primary one.
+func newFailover(o *apiv1.FailoverOptions, primary upstream, urls []*url.URL, clientOpts []ca.ClientOption) (*failover, error) {
+	f := &failover{
+		upstreams:  []upstream{primary},
+		roundRobin: strings.EqualFold(o.Policy, failoverRoundRobin),
+	}
+	for _, u := range urls {
+		client, err := ca.NewClient(u.String(), clientOpts...) //nolint:contextcheck // deeply nested context
+		if err != nil {
+			return nil, err
+		}
+		f.upstreams = append(f.upstreams, upstream{
+			client: client,
+			iss:    issuerWithCAURL(primary.iss, u),
+		})
+	}
+	return f, nil
+}
+
+// do calls fn with the upstream CAs until it succeeds or it fails with an error
+// that is not a connection error.
+func (f *failover) do(fn func(client *ca.Client, iss stepIssuer) error) error {
+	var start int
+	if f.roundRobin {
+		start = int((f.next.Add(1) - 1) % uint32(len(f.upstreams)))
+	}
+
+	var err error
+	for i := range f.upstreams {
+		u := f.upstreams[(start+i)%len(f.upstreams)]
+		if err = fn(u.client, u.iss); err == nil || !isConnectionError(err) {
+			return err
+		}
+	}
+	return err
+}
+
+// issuerWithCAURL returns a copy of the given issuer that creates tokens for
+// the given CA URL.
+func issuerWithCAURL(iss stepIssuer, caURL *url.URL) stepIssuer {
+	switch i := iss.(type) {
+	case *jwkIssuer:
+		return &jwkIssuer{
+			caURL:  caURL,
+			issuer: i.issuer,
+			signer: i.signer,
+		}
+	case *x5cIssuer:
+		return &x5cIssuer{
+			caURL:    caURL,
+			issuer:   i.issuer,
+			certFile: i.certFile,
+			keyFile:  i.keyFile,
+			password: i.password,
+			key:      i.key,
+		}
+	default:
+		return iss
+	}
+}
+
+// isConnectionError returns true if the error was caused by a failed connection
+// to the upstream CA. Error responses are not connection errors.
+func isConnectionError(err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	var nerr net.Error
+	return errors.As(err, &nerr) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
@@ -0,0 +1,203 @@
+package stepcas
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/smallstep/certificates/ca"
+	"github.com/smallstep/certificates/cas/apiv1"
+	"github.com/smallstep/certificates/errs"
+)
+
+func Test_parseFailoverURLs(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    *apiv1.FailoverOptions
+		want    []*url.URL
+		wantErr bool
+	}{
+		{"ok nil", nil, nil, false},
+		{"ok", &apiv1.FailoverOptions{
+			CertificateAuthorities: []string{"https://ca-2.smallstep.com", "https://ca-3.smallstep.com:9000"},
+		}, []*url.URL{
+			{Scheme: "https", Host: "ca-2.smallstep.com"},
+			{Scheme: "https", Host: "ca-3.smallstep.com:9000"},
+		}, false},
+		{"ok round-robin", &apiv1.FailoverOptions{
+			CertificateAuthorities: []string{"https://ca-2.smallstep.com"},
+			Policy:                 "Round-Robin",
+		}, []*url.URL{{Scheme: "https", Host: "ca-2.smallstep.com"}}, false},
+		{"fail policy", &apiv1.FailoverOptions{
+			CertificateAuthorities: []string{"https://ca-2.smallstep.com"},
+			Policy:                 "random",
+		}, nil, true},
+		{"fail empty", &apiv1.FailoverOptions{}, nil, true},
+		{"fail url", &apiv1.FailoverOptions{
+			CertificateAuthorities: []string{"ca-2.smallstep.com"},
+		}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseFailoverURLs(tt.opts)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_isConnectionError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"net error", &net.OpError{Op: "dial", Err: errors.New("connection refused")}, true},
+		{"dns error", &net.DNSError{Name: "ca.smallstep.com", IsNotFound: true}, true},
+		{"eof", io.ErrUnexpectedEOF, true},
+		{"canceled", context.Canceled, false},
+		{"response error", errs.InternalServer("internal error"), false},
+		{"other error", errors.New("an error"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, isConnectionError(tt.err))
+		})
+	}
+}
+
+func Test_failover_do(t *testing.T) {
+	connErr := &net.OpError{Op: "dial", Err: errors.New("connection refused")}
+	newUpstreams := func(t *testing.T) []upstream {
+		var upstreams []upstream
+		for _, s := range []string{"https://ca-1.smallstep.com", "https://ca-2.smallstep.com", "https://ca-3.smallstep.com"} {
+			client, err := ca.NewClient(s, ca.WithTransport(http.DefaultTransport))
+			require.NoError(t, err)
+			upstreams = append(upstreams, upstream{client: client})
+		}
+		return upstreams
+	}
+
+	t.Run("active-passive", func(t *testing.T) {
+		f := &failover{upstreams: newUpstreams(t)}
+		var got []string
+		err := f.do(func(client *ca.Client, _ stepIssuer) error {
+			got = append(got, client.GetCaURL())
+			if client.GetCaURL() == "https://ca-1.smallstep.com" {
+				return connErr
+			}
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"https://ca-1.smallstep.com", "https://ca-2.smallstep.com"}, got)
+	})
+
+	t.Run("round-robin", func(t *testing.T) {
+		f := &failover{upstreams: newUpstreams(t), roundRobin: true}
+		var got []string
+		for i := 0; i < 4; i++ {
+			assert.NoError(t, f.do(func(client *ca.Client, _ stepIssuer) error {
+				got = append(got, client.GetCaURL())
+				return nil
+			}))
+		}
+		assert.Equal(t, []string{
+			"https://ca-1.smallstep.com", "https://ca-2.smallstep.com",
+			"https://ca-3.smallstep.com", "https://ca-1.smallstep.com",
+		}, got)
+	})
+
+	t.Run("fail all", func(t *testing.T) {
+		f := &failover{upstreams: newUpstreams(t)}
+		var calls int
+		err := f.do(func(*ca.Client, stepIssuer) error {
+			calls++
+			return connErr
+		})
+		assert.ErrorIs(t, err, connErr)
+		assert.Equal(t, 3, calls)
+	})
+
+	t.Run("fail response", func(t *testing.T) {
+		f := &failover{upstreams: newUpstreams(t)}
+		var calls int
+		err := f.do(func(*ca.Client, stepIssuer) error {
+			calls++
+			return errs.BadRequest("bad request")
+		})
+		assert.Error(t, err)
+		assert.Equal(t, 1, calls)
+	})
+}
+
+func Test_issuerWithCAURL(t *testing.T) {
+	caURL, _ := testCAHelper(t)
+	u := &url.URL{Scheme: "https", Host: "ca-2.smallstep.com"}
+
+	jwk := testJWKIssuer(t, caURL, "")
+	assert.Equal(t, &jwkIssuer{caURL: u, issuer: jwk.issuer, signer: jwk.signer}, issuerWithCAURL(jwk, u))
+
+	x5c := testX5CIssuer(t, caURL, "")
+	got, ok := issuerWithCAURL(x5c, u).(*x5cIssuer)
+	require.True(t, ok)
+	assert.Equal(t, u, got.caURL)
+	assert.Equal(t, x5c.certFile, got.certFile)
+	assert.Equal(t, x5c.keyFile, got.keyFile)
+	_, err := got.SignToken("doe.org", []string{"doe.org"}, nil)
+	assert.NoError(t, err)
+
+	assert.Equal(t, mockErrIssuer{}, issuerWithCAURL(mockErrIssuer{}, u))
+	assert.Nil(t, issuerWithCAURL(nil, u))
+}
+
+func TestStepCAS_failover(t *testing.T) {
+	caURL, _ := testCAHelper(t)
+
+	s, err := New(context.TODO(), apiv1.Options{
+		CertificateAuthority:            "http://127.0.0.1:1",
+		CertificateAuthorityFingerprint: testRootFingerprint,
+		CertificateIssuer: &apiv1.CertificateIssuer{
+			Type:        "x5c",
+			Provisioner: "X5C",
+			Certificate: testX5CPath,
+			Key:         testX5CKeyPath,
+		},
+		Failover: &apiv1.FailoverOptions{
+			CertificateAuthorities: []string{caURL.String()},
+		},
+	})
+	require.NoError(t, err)
+	require.NotNil(t, s.failover)
+	assert.Len(t, s.failover.upstreams, 2)
+
+	resp, err := s.CreateCertificate(&apiv1.CreateCertificateRequest{
+		CSR: testCR,
+		Template: &x509.Certificate{
+			Subject:  testCR.Subject,
+			DNSNames: testCR.DNSNames,
+		},
+		Lifetime: time.Hour,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, testCrt, resp.Certificate)
+	assert.Equal(t, []*x509.Certificate{testIssCrt}, resp.CertificateChain)
+
+	got, err := s.GetCertificateAuthority(&apiv1.GetCertificateAuthorityRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, testRootCrt, got.RootCertificate)
+
+	assert.NoError(t, s.CheckHealth(context.Background()))
+}
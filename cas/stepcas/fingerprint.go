@@ -0,0 +1,136 @@
+package stepcas
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/api"
+)
+
+// parseFingerprints returns the normalized list of fingerprints in the given
+// values. Fingerprints are hex-encoded SHA-256 or SHA-512 digests, colons and
+// dashes are ignored.
+func parseFingerprints(values ...string) ([]string, error) {
+	var fingerprints []string
+	seen := make(map[string]bool)
+	for _, v := range values {
+		if v == "" {
+			continue
+		}
+		fp := strings.ToLower(strings.NewReplacer(":", "", "-", "").Replace(v))
+		b, err := hex.DecodeString(fp)
+		if err != nil || (len(b) != sha256.Size && len(b) != sha512.Size) {
+			return nil, errors.Errorf("stepCAS fingerprint %q is not a valid SHA-256 or SHA-512 fingerprint", v)
+		}
+		if !seen[fp] {
+			seen[fp] = true
+			fingerprints = append(fingerprints, fp)
+		}
+	}
+	return fingerprints, nil
+}
+
+// matchFingerprint returns true if the fingerprint of the given certificate is
+// the given one.
+func matchFingerprint(cert *x509.Certificate, fingerprint string) bool {
+	if cert == nil {
+		return false
+	}
+	switch len(fingerprint) {
+	case sha256.Size * 2:
+		sum := sha256.Sum256(cert.Raw)
+		return fingerprint == hex.EncodeToString(sum[:])
+	case sha512.Size * 2:
+		sum := sha512.Sum512(cert.Raw)
+		return fingerprint == hex.EncodeToString(sum[:])
+	default:
+		return false
+	}
+}
+
+// filterRoots returns the roots matching the given fingerprints, in the order
+// of the fingerprints.
+func filterRoots(roots []*x509.Certificate, fingerprints []string) []*x509.Certificate {
+	var certs []*x509.Certificate
+	for _, fp := range fingerprints {
+		for _, crt := range roots {
+			if matchFingerprint(crt, fp) {
+				certs = append(certs, crt)
+				break
+			}
+		}
+	}
+	return certs
+}
+
+// getRootsBundle gets the roots of the first upstream CA available and returns
+// a PEM bundle with the ones matching the given fingerprints. As the roots are
+// not known yet, the request is done using an insecure connection, but only
+// the roots with a configured fingerprint are trusted.
+func getRootsBundle(ctx context.Context, caURLs []*url.URL, fingerprints []string) (bundle []byte, err error) {
+	for _, caURL := range caURLs {
+		if bundle, err = getRootsBundleFrom(ctx, caURL, fingerprints); err == nil || !isConnectionError(err) {
+			return
+		}
+	}
+	return
+}
+
+func getRootsBundleFrom(ctx context.Context, caURL *url.URL, fingerprints []string) ([]byte, error) {
+	u := caURL.ResolveReference(&url.URL{Path: "/roots"})
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), http.NoBody)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating roots request")
+	}
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			Proxy: http.ProxyFromEnvironment,
+			//nolint:gosec // the roots are verified using the fingerprints
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		},
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error getting %s", u)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return nil, errors.Errorf("error getting %s: status code %d", u, resp.StatusCode)
+	}
+
+	var roots api.RootsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&roots); err != nil {
+		return nil, errors.Wrapf(err, "error reading %s", u)
+	}
+	certs := make([]*x509.Certificate, 0, len(roots.Certificates))
+	for _, crt := range roots.Certificates {
+		if crt.Certificate != nil {
+			certs = append(certs, crt.Certificate)
+		}
+	}
+
+	certs = filterRoots(certs, fingerprints)
+	if len(certs) == 0 {
+		return nil, errors.New("stepCAS could not find any root certificate matching the configured fingerprints")
+	}
+
+	var buf bytes.Buffer
+	for _, crt := range certs {
+		if err := pem.Encode(&buf, &pem.Block{Type: "CERTIFICATE", Bytes: crt.Raw}); err != nil {
+			return nil, errors.Wrap(err, "error encoding root certificate")
+		}
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,109 @@
+package stepcas
+
+import (
+	"context"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/hex"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.step.sm/crypto/pemutil"
+
+	"github.com/smallstep/certificates/cas/apiv1"
+)
+
+func sha512Fingerprint(crt *x509.Certificate) string {
+	sum := sha512.Sum512(crt.Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+func Test_parseFingerprints(t *testing.T) {
+	sha256Fp := testRootFingerprint
+	sha512Fp := sha512Fingerprint(testRootCrt)
+
+	tests := []struct {
+		name    string
+		values  []string
+		want    []string
+		wantErr bool
+	}{
+		{"ok", []string{sha256Fp}, []string{sha256Fp}, false},
+		{"ok sha512", []string{sha512Fp}, []string{sha512Fp}, false},
+		{"ok multiple", []string{"", sha256Fp, sha512Fp}, []string{sha256Fp, sha512Fp}, false},
+		{"ok duplicated", []string{sha256Fp, strings.ToUpper(sha256Fp)}, []string{sha256Fp}, false},
+		{"ok colons", []string{sha256Fp[:2] + ":" + sha256Fp[2:4] + "-" + sha256Fp[4:]}, []string{sha256Fp}, false},
+		{"ok empty", []string{""}, nil, false},
+		{"fail hex", []string{"fail"}, nil, true},
+		{"fail length", []string{sha256Fp[:40]}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseFingerprints(tt.values...)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_filterRoots(t *testing.T) {
+	roots := []*x509.Certificate{testIssCrt, nil, testRootCrt}
+	assert.Equal(t, []*x509.Certificate{testRootCrt}, filterRoots(roots, []string{testRootFingerprint}))
+	assert.Equal(t, []*x509.Certificate{testRootCrt}, filterRoots(roots, []string{sha512Fingerprint(testRootCrt)}))
+	assert.Equal(t, []*x509.Certificate{testIssCrt, testRootCrt}, filterRoots(roots, []string{
+		sha512Fingerprint(testIssCrt), testRootFingerprint,
+	}))
+	assert.Empty(t, filterRoots(roots, []string{strings.Repeat("a", 64)}))
+}
+
+func Test_getRootsBundle(t *testing.T) {
+	caURL, _ := testCAHelper(t)
+
+	bundle, err := getRootsBundle(context.Background(), []*url.URL{caURL}, []string{strings.Repeat("a", 64), sha512Fingerprint(testRootCrt)})
+	require.NoError(t, err)
+	certs, err := pemutil.ParseCertificateBundle(bundle)
+	require.NoError(t, err)
+	assert.Equal(t, []*x509.Certificate{testRootCrt}, certs)
+
+	_, err = getRootsBundle(context.Background(), []*url.URL{caURL}, []string{strings.Repeat("a", 64)})
+	assert.Error(t, err)
+
+	_, err = getRootsBundle(context.Background(), []*url.URL{{Scheme: "http", Host: "127.0.0.1:1"}}, []string{testRootFingerprint})
+	assert.Error(t, err)
+
+	bundle, err = getRootsBundle(context.Background(), []*url.URL{{Scheme: "http", Host: "127.0.0.1:1"}, caURL}, []string{testRootFingerprint})
+	require.NoError(t, err)
+	certs, err = pemutil.ParseCertificateBundle(bundle)
+	require.NoError(t, err)
+	assert.Equal(t, []*x509.Certificate{testRootCrt}, certs)
+}
+
+func TestStepCAS_GetCertificateAuthority_fingerprints(t *testing.T) {
+	caURL, _ := testCAHelper(t)
+
+	s, err := New(context.Background(), apiv1.Options{
+		IsCAGetter:                       true,
+		CertificateAuthority:             caURL.String(),
+		CertificateAuthorityFingerprints: []string{strings.Repeat("a", 64), sha512Fingerprint(testRootCrt)},
+	})
+	require.NoError(t, err)
+
+	resp, err := s.GetCertificateAuthority(&apiv1.GetCertificateAuthorityRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, &apiv1.GetCertificateAuthorityResponse{
+		RootCertificate:          testRootCrt,
+		IntermediateCertificates: []*x509.Certificate{testIssCrt},
+		Metadata:                 apiv1.NewCertificateAuthorityMetadata(testIssCrt),
+	}, resp)
+
+	s.fingerprints = []string{strings.Repeat("a", 64)}
+	_, err = s.GetCertificateAuthority(&apiv1.GetCertificateAuthorityRequest{})
+	assert.Error(t, err)
+}
@@ -2,6 +2,7 @@ package stepcas
 
 import (
 	"context"
+	"crypto"
 	"net/url"
 	"strings"
 	"time"
@@ -10,6 +11,8 @@ import (
 	"github.com/pkg/errors"
 	"github.com/smallstep/certificates/ca"
 	"github.com/smallstep/certificates/cas/apiv1"
+	"go.step.sm/crypto/kms"
+	kmsapi "go.step.sm/crypto/kms/apiv1"
 )
 
 // raAuthorityNS is a custom namespace used to generate endpoint ids based on
@@ -43,11 +46,20 @@ func newStepIssuer(ctx context.Context, caURL *url.URL, client *ca.Client, iss *
 		return nil, err
 	}
 
+	// Do not return typed nil issuers on errors.
 	switch strings.ToLower(iss.Type) {
 	case "x5c":
-		return newX5CIssuer(caURL, iss)
+		x5c, err := newX5CIssuer(ctx, caURL, iss)
+		if err != nil {
+			return nil, err
+		}
+		return x5c, nil
 	case "jwk":
-		return newJWKIssuer(ctx, caURL, client, iss)
+		jwk, err := newJWKIssuer(ctx, caURL, client, iss)
+		if err != nil {
+			return nil, err
+		}
+		return jwk, nil
 	default:
 		return nil, errors.Errorf("stepCAS `certificateIssuer.type` %s is not supported", iss.Type)
 	}
@@ -87,6 +99,42 @@ func validateX5CIssuer(iss *apiv1.CertificateIssuer) error {
 	}
 }
 
+// isKMSURI returns true if the given key is a KMS URI.
+func isKMSURI(key string) bool {
+	_, err := kmsapi.TypeOf(key)
+	return err == nil
+}
+
+// loadSigner returns the signer for the given key. The key can be a KMS URI,
+// e.g., "awskms:key-id=..." or "pkcs11:id=...;object=...", or the path to a
+// PEM encoded private key. The password is used as the PIN of the KMS.
+func loadSigner(ctx context.Context, key, password string) (crypto.Signer, error) {
+	typ, err := kmsapi.TypeOf(key)
+	if err != nil {
+		return readKey(key, password)
+	}
+
+	km, err := kms.New(ctx, kmsapi.Options{
+		Type: typ,
+		URI:  key,
+		Pin:  password,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "error initializing kms")
+	}
+	req := &kmsapi.CreateSignerRequest{
+		SigningKey: key,
+	}
+	if password != "" {
+		req.Password = []byte(password)
+	}
+	signer, err := km.CreateSigner(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating signer")
+	}
+	return signer, nil
+}
+
 // validateJWKIssuer validates the configuration of jwk issuer. If the key is
 // not given, then it will download it from the CA. If the password is not set
 // it will be prompted.
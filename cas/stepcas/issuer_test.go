@@ -102,6 +102,30 @@ func Test_newStepIssuer(t *testing.T) {
 			keyFile:  testX5CKeyPath,
 			issuer:   "X5C",
 		}, false},
+		{"x5c kms", args{caURL, client, &apiv1.CertificateIssuer{
+			Type:        "x5c",
+			Provisioner: "X5C",
+			Certificate: testX5CPath,
+			Key:         "softkms:path=" + testX5CKeyPath,
+		}}, &x5cIssuer{
+			caURL:    caURL,
+			certFile: testX5CPath,
+			keyFile:  "softkms:path=" + testX5CKeyPath,
+			issuer:   "X5C",
+			key:      testX5CKey,
+		}, false},
+		{"fail x5c kms", args{caURL, client, &apiv1.CertificateIssuer{
+			Type:        "x5c",
+			Provisioner: "X5C",
+			Certificate: testX5CPath,
+			Key:         "softkms:path=" + testX5CKeyPath + ".missing",
+		}}, nil, true},
+		{"fail x5c kms chain", args{caURL, client, &apiv1.CertificateIssuer{
+			Type:        "x5c",
+			Provisioner: "X5C",
+			Certificate: testX5CPath,
+			Key:         "softkms:path=" + testIssKeyPath,
+		}}, nil, true},
 		{"jwk", args{caURL, client, &apiv1.CertificateIssuer{
 			Type:        "jwk",
 			Provisioner: "ra@doe.org",
@@ -111,6 +135,20 @@ func Test_newStepIssuer(t *testing.T) {
 			issuer: "ra@doe.org",
 			signer: signer,
 		}, false},
+		{"jwk kms", args{caURL, client, &apiv1.CertificateIssuer{
+			Type:        "jwk",
+			Provisioner: "ra@doe.org",
+			Key:         "softkms:path=" + testX5CKeyPath,
+		}}, &jwkIssuer{
+			caURL:  caURL,
+			issuer: "ra@doe.org",
+			signer: signer,
+		}, false},
+		{"fail jwk kms", args{caURL, client, &apiv1.CertificateIssuer{
+			Type:        "jwk",
+			Provisioner: "ra@doe.org",
+			Key:         "softkms:path=" + testX5CKeyPath + ".missing",
+		}}, nil, true},
 		{"fail", args{caURL, client, &apiv1.CertificateIssuer{
 			Type:        "unknown",
 			Provisioner: "ra@doe.org",
@@ -133,3 +171,36 @@ func Test_newStepIssuer(t *testing.T) {
 		})
 	}
 }
+
+func Test_loadSigner(t *testing.T) {
+	type args struct {
+		key      string
+		password string
+	}
+	tests := []struct {
+		name    string
+		args    args
+		wantErr bool
+	}{
+		{"ok file", args{testX5CKeyPath, ""}, false},
+		{"ok encrypted file", args{testEncryptedKeyPath, testPassword}, false},
+		{"ok kms", args{"softkms:path=" + testX5CKeyPath, ""}, false},
+		{"ok kms encrypted", args{"softkms:path=" + testEncryptedKeyPath, testPassword}, false},
+		{"fail file", args{testX5CKeyPath + ".missing", ""}, true},
+		{"fail kms", args{"softkms:path=" + testX5CKeyPath + ".missing", ""}, true},
+		{"fail kms password", args{"softkms:path=" + testEncryptedKeyPath, "bad-password"}, true},
+		{"fail kms type", args{"unknownkms:key-id=foo", ""}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := loadSigner(context.TODO(), tt.args.key, tt.args.password)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("loadSigner() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got.Public(), testX5CKey.Public()) {
+				t.Errorf("loadSigner() public key = %v, want %v", got.Public(), testX5CKey.Public())
+			}
+		})
+	}
+}
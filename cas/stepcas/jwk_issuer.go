@@ -26,7 +26,7 @@ func newJWKIssuer(ctx context.Context, caURL *url.URL, client *ca.Client, cfg *a
 	var err error
 	var signer jose.Signer
 	// Read the key from the CA if not provided.
-	// Or read it from a PEM file.
+	// Or read it from a PEM file or a KMS.
 	if cfg.Key == "" {
 		p, err := findProvisioner(ctx, client, provisioner.TypeJWK, cfg.Provisioner)
 		if err != nil {
@@ -41,7 +41,7 @@ func newJWKIssuer(ctx context.Context, caURL *url.URL, client *ca.Client, cfg *a
 			return nil, err
 		}
 	} else {
-		signer, err = newJWKSigner(cfg.Key, cfg.Password)
+		signer, err = newJWKSigner(ctx, cfg.Key, cfg.Password)
 		if err != nil {
 			return nil, err
 		}
@@ -101,8 +101,8 @@ func (i *jwkIssuer) createToken(aud, sub string, sans []string, info *raInfo) (s
 	return tok, nil
 }
 
-func newJWKSigner(keyFile, password string) (jose.Signer, error) {
-	signer, err := readKey(keyFile, password)
+func newJWKSigner(ctx context.Context, key, password string) (jose.Signer, error) {
+	signer, err := loadSigner(ctx, key, password)
 	if err != nil {
 		return nil, err
 	}
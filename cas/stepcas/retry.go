@@ -0,0 +1,128 @@
+package stepcas
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/cas/apiv1"
+	"github.com/smallstep/certificates/errs"
+)
+
+const (
+	defaultRetryAttempts       = 3
+	defaultRetryInitialBackoff = 500 * time.Millisecond
+	defaultRetryMaxBackoff     = 10 * time.Second
+)
+
+// sleep waits for the given duration or until the context is done.
+// This method is used for unit testing purposes.
+var sleep = func(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// retrier retries the requests to the upstream CA that fail with network
+// errors or 5xx responses using an exponential backoff with full jitter.
+type retrier struct {
+	attempts       int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+	timeout        time.Duration
+}
+
+// newRetrier creates a retrier from the given options. If the options are nil,
+// it returns a nil retrier and the requests are done only once.
+func newRetrier(o *apiv1.RetryOptions) (*retrier, error) {
+	if o == nil {
+		return nil, nil //nolint:nilnil // a nil retrier is valid
+	}
+
+	r := &retrier{
+		attempts:       o.MaxAttempts,
+		initialBackoff: defaultRetryInitialBackoff,
+		maxBackoff:     defaultRetryMaxBackoff,
+	}
+	switch {
+	case r.attempts < 0:
+		return nil, errors.New("stepCAS `retry.maxAttempts` cannot be less than 0")
+	case r.attempts == 0:
+		r.attempts = defaultRetryAttempts
+	}
+
+	var err error
+	for _, d := range []struct {
+		name  string
+		value string
+		dst   *time.Duration
+	}{
+		{"initialBackoff", o.InitialBackoff, &r.initialBackoff},
+		{"maxBackoff", o.MaxBackoff, &r.maxBackoff},
+		{"timeout", o.Timeout, &r.timeout},
+	} {
+		if d.value == "" {
+			continue
+		}
+		if *d.dst, err = time.ParseDuration(d.value); err != nil || *d.dst < 0 {
+			return nil, errors.Errorf("stepCAS `retry.%s` is not a valid duration", d.name)
+		}
+	}
+	if r.maxBackoff < r.initialBackoff {
+		r.maxBackoff = r.initialBackoff
+	}
+
+	return r, nil
+}
+
+// do calls fn until it succeeds, returns a non-retryable error, or the maximum
+// number of attempts is reached. Each attempt gets its own context with the
+// configured timeout. A nil retrier calls fn only once.
+func (r *retrier) do(ctx context.Context, fn func(ctx context.Context) error) error {
+	if r == nil {
+		return fn(ctx)
+	}
+
+	var err error
+	backoff := r.initialBackoff
+	for attempt := 1; ; attempt++ {
+		if err = r.attempt(ctx, fn); err == nil || attempt >= r.attempts || !isRetryable(err) {
+			return err
+		}
+		//nolint:gosec // jitter does not require a secure random
+		if serr := sleep(ctx, time.Duration(rand.Int63n(int64(backoff)+1))); serr != nil {
+			return err
+		}
+		if backoff *= 2; backoff > r.maxBackoff {
+			backoff = r.maxBackoff
+		}
+	}
+}
+
+func (r *retrier) attempt(ctx context.Context, fn func(ctx context.Context) error) error {
+	if r.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.timeout)
+		defer cancel()
+	}
+	return fn(ctx)
+}
+
+// isRetryable returns true if the error is a network error or a server error
+// response from the upstream CA. Client errors like 4xx responses are
+// rejections and they are not retried.
+func isRetryable(err error) bool {
+	var e *errs.Error
+	if errors.As(err, &e) {
+		code := e.StatusCode()
+		return code >= http.StatusInternalServerError || code == http.StatusTooManyRequests
+	}
+	return !errors.Is(err, context.Canceled)
+}
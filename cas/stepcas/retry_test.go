@@ -0,0 +1,183 @@
+package stepcas
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/smallstep/certificates/cas/apiv1"
+	"github.com/smallstep/certificates/errs"
+)
+
+func fakeSleep(t *testing.T) *[]time.Duration {
+	t.Helper()
+	var sleeps []time.Duration
+	tmp := sleep
+	t.Cleanup(func() {
+		sleep = tmp
+	})
+	sleep = func(ctx context.Context, d time.Duration) error {
+		sleeps = append(sleeps, d)
+		return ctx.Err()
+	}
+	return &sleeps
+}
+
+func Test_newRetrier(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    *apiv1.RetryOptions
+		want    *retrier
+		wantErr bool
+	}{
+		{"ok nil", nil, nil, false},
+		{"ok defaults", &apiv1.RetryOptions{}, &retrier{
+			attempts: 3, initialBackoff: 500 * time.Millisecond, maxBackoff: 10 * time.Second,
+		}, false},
+		{"ok", &apiv1.RetryOptions{MaxAttempts: 5, InitialBackoff: "1s", MaxBackoff: "1m", Timeout: "30s"}, &retrier{
+			attempts: 5, initialBackoff: time.Second, maxBackoff: time.Minute, timeout: 30 * time.Second,
+		}, false},
+		{"ok maxBackoff", &apiv1.RetryOptions{InitialBackoff: "1m", MaxBackoff: "1s"}, &retrier{
+			attempts: 3, initialBackoff: time.Minute, maxBackoff: time.Minute,
+		}, false},
+		{"fail maxAttempts", &apiv1.RetryOptions{MaxAttempts: -1}, nil, true},
+		{"fail initialBackoff", &apiv1.RetryOptions{InitialBackoff: "foo"}, nil, true},
+		{"fail maxBackoff", &apiv1.RetryOptions{MaxBackoff: "-1s"}, nil, true},
+		{"fail timeout", &apiv1.RetryOptions{Timeout: "1"}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := newRetrier(tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("newRetrier() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("newRetrier() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_retrier_do(t *testing.T) {
+	unavailable := errs.New(http.StatusServiceUnavailable, "service unavailable")
+	forbidden := errs.New(http.StatusForbidden, "forbidden")
+	r := &retrier{
+		attempts:       4,
+		initialBackoff: time.Second,
+		maxBackoff:     2 * time.Second,
+	}
+
+	failN := func(n int, err error) (func(context.Context) error, *int) {
+		var calls int
+		return func(context.Context) error {
+			calls++
+			if calls <= n {
+				return err
+			}
+			return nil
+		}, &calls
+	}
+
+	tests := []struct {
+		name      string
+		retrier   *retrier
+		failures  int
+		err       error
+		wantCalls int
+		wantErr   error
+	}{
+		{"ok", r, 0, nil, 1, nil},
+		{"ok nil", nil, 0, nil, 1, nil},
+		{"ok retry", r, 2, unavailable, 3, nil},
+		{"ok retry network", r, 3, errors.New("connection refused"), 4, nil},
+		{"fail attempts", r, 4, unavailable, 4, unavailable},
+		{"fail nil", nil, 1, unavailable, 1, unavailable},
+		{"fail forbidden", r, 1, forbidden, 1, forbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fakeSleep(t)
+			fn, calls := failN(tt.failures, tt.err)
+			err := tt.retrier.do(context.Background(), fn)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("retrier.do() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if *calls != tt.wantCalls {
+				t.Errorf("retrier.do() calls = %d, want %d", *calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func Test_retrier_do_backoff(t *testing.T) {
+	sleeps := fakeSleep(t)
+	r := &retrier{
+		attempts:       5,
+		initialBackoff: time.Second,
+		maxBackoff:     2 * time.Second,
+	}
+	err := r.do(context.Background(), func(context.Context) error {
+		return errs.InternalServer("internal server error")
+	})
+	if err == nil {
+		t.Fatal("retrier.do() error = nil, wantErr true")
+	}
+	maxSleeps := []time.Duration{time.Second, 2 * time.Second, 2 * time.Second, 2 * time.Second}
+	if len(*sleeps) != len(maxSleeps) {
+		t.Fatalf("retrier.do() sleeps = %v, want %d sleeps", *sleeps, len(maxSleeps))
+	}
+	for i, d := range *sleeps {
+		if d < 0 || d > maxSleeps[i] {
+			t.Errorf("retrier.do() sleep %d = %v, want between 0 and %v", i, d, maxSleeps[i])
+		}
+	}
+}
+
+func Test_retrier_do_timeout(t *testing.T) {
+	fakeSleep(t)
+	r := &retrier{attempts: 2, timeout: time.Millisecond}
+	var calls int
+	err := r.do(context.Background(), func(ctx context.Context) error {
+		calls++
+		if _, ok := ctx.Deadline(); !ok {
+			t.Error("context does not have a deadline")
+		}
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("retrier.do() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if calls != 2 {
+		t.Errorf("retrier.do() calls = %d, want 2", calls)
+	}
+}
+
+func Test_isRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"internal server error", errs.InternalServer("internal server error"), true},
+		{"service unavailable", errs.New(http.StatusServiceUnavailable, "unavailable"), true},
+		{"too many requests", errs.New(http.StatusTooManyRequests, "too many requests"), true},
+		{"network", fmt.Errorf("client POST https://ca.smallstep.com/sign failed: %w", errors.New("connection refused")), true},
+		{"deadline exceeded", context.DeadlineExceeded, true},
+		{"bad request", errs.BadRequest("bad request"), false},
+		{"unauthorized", errs.New(http.StatusUnauthorized, "unauthorized"), false},
+		{"canceled", fmt.Errorf("client request failed: %w", context.Canceled), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isRetryable(tt.err); got != tt.want {
+				t.Errorf("isRetryable() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
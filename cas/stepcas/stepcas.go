@@ -2,6 +2,10 @@ package stepcas
 
 import (
 	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
 	"crypto/x509"
 	"net/url"
 	"time"
@@ -10,6 +14,10 @@ import (
 	"github.com/smallstep/certificates/api"
 	"github.com/smallstep/certificates/ca"
 	"github.com/smallstep/certificates/cas/apiv1"
+	"go.step.sm/crypto/keyutil"
+	"go.step.sm/crypto/kms"
+	kmsapi "go.step.sm/crypto/kms/apiv1"
+	"go.step.sm/crypto/pemutil"
 )
 
 func init() {
@@ -23,8 +31,16 @@ func init() {
 type StepCAS struct {
 	iss         stepIssuer
 	client      *ca.Client
+	retrier     *retrier
+	keyManager  kms.KeyManager
 	authorityID string
 	fingerprint string
+	// fingerprints is used instead of fingerprint if multiple fingerprints
+	// or SHA-512 fingerprints are configured.
+	fingerprints []string
+	// failover is used to send the requests if multiple upstream CAs are
+	// configured.
+	failover *failover
 }
 
 // New creates a new CertificateAuthorityService implementation using another
@@ -33,17 +49,58 @@ func New(ctx context.Context, opts apiv1.Options) (*StepCAS, error) {
 	switch {
 	case opts.CertificateAuthority == "":
 		return nil, errors.New("stepCAS 'certificateAuthority' cannot be empty")
-	case opts.CertificateAuthorityFingerprint == "":
+	case opts.CertificateAuthorityFingerprint == "" && len(opts.CertificateAuthorityFingerprints) == 0:
 		return nil, errors.New("stepCAS 'certificateAuthorityFingerprint' cannot be empty")
 	}
 
+	fingerprints, err := parseFingerprints(append([]string{opts.CertificateAuthorityFingerprint}, opts.CertificateAuthorityFingerprints...)...)
+	if err != nil {
+		return nil, err
+	}
+
 	caURL, err := url.Parse(opts.CertificateAuthority)
 	if err != nil {
 		return nil, errors.Wrap(err, "stepCAS `certificateAuthority` is not valid")
 	}
 
-	// Create client.
-	client, err := ca.NewClient(opts.CertificateAuthority, ca.WithRootSHA256(opts.CertificateAuthorityFingerprint)) //nolint:contextcheck // deeply nested context
+	failoverURLs, err := parseFailoverURLs(opts.Failover)
+	if err != nil {
+		return nil, err
+	}
+
+	retrier, err := newRetrier(opts.Retry)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create client. A single SHA-256 fingerprint and upstream CA uses the root
+	// endpoint, otherwise the roots matching the fingerprints are trusted.
+	var fingerprint string
+	var clientOpts []ca.ClientOption
+	if len(fingerprints) == 1 && len(fingerprints[0]) == sha256.Size*2 {
+		fingerprint, fingerprints = fingerprints[0], nil
+	}
+	if fingerprint != "" && len(failoverURLs) == 0 {
+		clientOpts = append(clientOpts, ca.WithRootSHA256(fingerprint))
+	} else {
+		trusted := fingerprints
+		if fingerprint != "" {
+			trusted = []string{fingerprint}
+		}
+		bundle, err := getRootsBundle(ctx, append([]*url.URL{caURL}, failoverURLs...), trusted)
+		if err != nil {
+			return nil, err
+		}
+		clientOpts = append(clientOpts, ca.WithCABundle(bundle))
+	}
+	if opts.ClientCertificate != nil {
+		cert, err := newClientCertificate(ctx, opts.ClientCertificate)
+		if err != nil {
+			return nil, err
+		}
+		clientOpts = append(clientOpts, ca.WithCertificate(cert))
+	}
+	client, err := ca.NewClient(opts.CertificateAuthority, clientOpts...) //nolint:contextcheck // deeply nested context
 	if err != nil {
 		return nil, err
 	}
@@ -57,11 +114,22 @@ func New(ctx context.Context, opts apiv1.Options) (*StepCAS, error) {
 		}
 	}
 
+	var fo *failover
+	if len(failoverURLs) > 0 {
+		if fo, err = newFailover(opts.Failover, upstream{client: client, iss: iss}, failoverURLs, clientOpts); err != nil {
+			return nil, err
+		}
+	}
+
 	return &StepCAS{
-		iss:         iss,
-		client:      client,
-		authorityID: opts.AuthorityID,
-		fingerprint: opts.CertificateAuthorityFingerprint,
+		iss:          iss,
+		client:       client,
+		retrier:      retrier,
+		keyManager:   opts.KeyManager,
+		authorityID:  opts.AuthorityID,
+		fingerprint:  fingerprint,
+		fingerprints: fingerprints,
+		failover:     fo,
 	}, nil
 }
 
@@ -112,7 +180,13 @@ func (s *StepCAS) RenewCertificate(req *apiv1.RenewCertificateRequest) (*apiv1.R
 		return nil, apiv1.ValidationError{Message: "renewCertificateRequest `token` cannot be empty"}
 	}
 
-	resp, err := s.client.RenewWithToken(req.Token)
+	var resp *api.SignResponse
+	err := s.retrier.do(context.Background(), func(ctx context.Context) error {
+		return s.do(func(client *ca.Client, _ stepIssuer) (err error) {
+			resp, err = client.RenewWithTokenAndContext(ctx, req.Token)
+			return
+		})
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -140,18 +214,23 @@ func (s *StepCAS) RevokeCertificate(req *apiv1.RevokeCertificateRequest) (*apiv1
 		serialNumber = req.Certificate.SerialNumber.String()
 	}
 
-	token, err := s.iss.RevokeToken(serialNumber)
-	if err != nil {
-		return nil, err
-	}
-
-	_, err = s.client.Revoke(&api.RevokeRequest{
-		Serial:     serialNumber,
-		ReasonCode: req.ReasonCode,
-		Reason:     req.Reason,
-		OTT:        token,
-		Passive:    req.PassiveOnly,
-	}, nil)
+	// Tokens can only be used once, so each attempt uses a new one.
+	err := s.retrier.do(context.Background(), func(ctx context.Context) error {
+		return s.do(func(client *ca.Client, iss stepIssuer) error {
+			token, err := iss.RevokeToken(serialNumber)
+			if err != nil {
+				return err
+			}
+			_, err = client.RevokeWithContext(ctx, &api.RevokeRequest{
+				Serial:     serialNumber,
+				ReasonCode: req.ReasonCode,
+				Reason:     req.Reason,
+				OTT:        token,
+				Passive:    req.PassiveOnly,
+			}, nil)
+			return err
+		})
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -163,17 +242,147 @@ func (s *StepCAS) RevokeCertificate(req *apiv1.RevokeCertificateRequest) (*apiv1
 }
 
 // GetCertificateAuthority returns the root certificate of the certificate
-// authority using the configured fingerprint.
+// authority using the configured fingerprint. If multiple fingerprints are
+// configured, the root of the first fingerprint found is returned. The
+// intermediates are also returned if the upstream CA provides them.
 func (s *StepCAS) GetCertificateAuthority(*apiv1.GetCertificateAuthorityRequest) (*apiv1.GetCertificateAuthorityResponse, error) {
-	resp, err := s.client.Root(s.fingerprint)
+	root, err := s.getRootCertificate()
 	if err != nil {
 		return nil, err
 	}
-	return &apiv1.GetCertificateAuthorityResponse{
-		RootCertificate: resp.RootPEM.Certificate,
+	intermediates, err := s.getIntermediateCertificates()
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &apiv1.GetCertificateAuthorityResponse{
+		RootCertificate:          root,
+		IntermediateCertificates: intermediates,
+	}
+	if len(intermediates) > 0 {
+		resp.Metadata = apiv1.NewCertificateAuthorityMetadata(intermediates[0])
+	}
+	return resp, nil
+}
+
+// getRootCertificate returns the root certificate of the upstream CA.
+func (s *StepCAS) getRootCertificate() (*x509.Certificate, error) {
+	if len(s.fingerprints) > 0 {
+		var resp *api.RootsResponse
+		if err := s.do(func(client *ca.Client, _ stepIssuer) (err error) {
+			resp, err = client.Roots()
+			return
+		}); err != nil {
+			return nil, err
+		}
+		certs := make([]*x509.Certificate, 0, len(resp.Certificates))
+		for _, crt := range resp.Certificates {
+			certs = append(certs, crt.Certificate)
+		}
+		roots := filterRoots(certs, s.fingerprints)
+		if len(roots) == 0 {
+			return nil, errors.New("stepCAS could not find any root certificate matching the configured fingerprints")
+		}
+		return roots[0], nil
+	}
+
+	var resp *api.RootResponse
+	if err := s.do(func(client *ca.Client, _ stepIssuer) (err error) {
+		resp, err = client.Root(s.fingerprint)
+		return
+	}); err != nil {
+		return nil, err
+	}
+	return resp.RootPEM.Certificate, nil
+}
+
+// getIntermediateCertificates returns the intermediate certificates of the
+// upstream CA. The intermediates are optional, versions of step-ca without the
+// intermediates endpoint, or without intermediates, return no certificates.
+// Only connection errors are returned.
+func (s *StepCAS) getIntermediateCertificates() ([]*x509.Certificate, error) {
+	var resp *api.IntermediatesResponse
+	if err := s.do(func(client *ca.Client, _ stepIssuer) (err error) {
+		resp, err = client.Intermediates()
+		return
+	}); err != nil {
+		if isConnectionError(err) {
+			return nil, err
+		}
+		return nil, nil
+	}
+
+	certs := make([]*x509.Certificate, 0, len(resp.Certificates))
+	for _, crt := range resp.Certificates {
+		certs = append(certs, crt.Certificate)
+	}
+	return certs, nil
+}
+
+// CreateCertificateAuthority creates an intermediate certificate signed by the
+// upstream CA. The key is created using the configured key manager, and the
+// certificate request is signed using the configured provisioner, whose
+// template must allow the creation of CA certificates.
+func (s *StepCAS) CreateCertificateAuthority(req *apiv1.CreateCertificateAuthorityRequest) (*apiv1.CreateCertificateAuthorityResponse, error) {
+	switch {
+	case req.Type != apiv1.IntermediateCA:
+		return nil, errors.Errorf("createCertificateAuthorityRequest `type=%d' is invalid or not supported", req.Type)
+	case req.Template == nil:
+		return nil, errors.New("createCertificateAuthorityRequest `template` cannot be nil")
+	case req.Lifetime < 0:
+		return nil, errors.New("createCertificateAuthorityRequest `lifetime` cannot be less than 0")
+	}
+
+	key, signer, err := s.createKey(req.CreateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	cr, err := createCertificateRequest(req.Template, signer)
+	if err != nil {
+		return nil, err
+	}
+
+	cert, chain, err := s.createCertificate(cr, req.Template, req.Lifetime, &raInfo{
+		AuthorityID: s.authorityID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !cert.BasicConstraintsValid || !cert.IsCA {
+		return nil, errors.New("error creating certificate authority: upstream CA did not sign a CA certificate, " +
+			"check that the provisioner template allows intermediate certificates")
+	}
+	if !keyutil.Equal(cert.PublicKey, signer.Public()) {
+		return nil, errors.New("error creating certificate authority: certificate does not match the key")
+	}
+
+	return &apiv1.CreateCertificateAuthorityResponse{
+		Name:             cert.Subject.CommonName,
+		Certificate:      cert,
+		CertificateChain: chain,
+		KeyName:          key.Name,
+		PublicKey:        key.PublicKey,
+		PrivateKey:       key.PrivateKey,
+		Signer:           signer,
 	}, nil
 }
 
+// CheckHealth checks the health endpoint of the upstream CA.
+func (s *StepCAS) CheckHealth(ctx context.Context) error {
+	var resp *api.HealthResponse
+	if err := s.do(func(client *ca.Client, _ stepIssuer) (err error) {
+		resp, err = client.HealthWithContext(ctx)
+		return
+	}); err != nil {
+		return errors.Wrap(err, "error checking upstream CA health")
+	}
+	if resp.Status != "ok" {
+		return errors.Errorf("upstream CA status is %s", resp.Status)
+	}
+	return nil
+}
+
 func (s *StepCAS) createCertificate(cr *x509.CertificateRequest, template *x509.Certificate, lifetime time.Duration, raInfo *raInfo) (*x509.Certificate, []*x509.Certificate, error) {
 	sans := make([]string, 0, len(template.DNSNames)+len(template.EmailAddresses)+len(template.IPAddresses)+len(template.URIs))
 	sans = append(sans, template.DNSNames...)
@@ -190,15 +399,21 @@ func (s *StepCAS) createCertificate(cr *x509.CertificateRequest, template *x509.
 		commonName = sans[0]
 	}
 
-	token, err := s.iss.SignToken(commonName, sans, raInfo)
-	if err != nil {
-		return nil, nil, err
-	}
-
-	resp, err := s.client.Sign(&api.SignRequest{
-		CsrPEM:   api.CertificateRequest{CertificateRequest: cr},
-		OTT:      token,
-		NotAfter: s.lifetime(lifetime),
+	// Tokens can only be used once, so each attempt uses a new one.
+	var resp *api.SignResponse
+	err := s.retrier.do(context.Background(), func(ctx context.Context) error {
+		return s.do(func(client *ca.Client, iss stepIssuer) error {
+			token, err := iss.SignToken(commonName, sans, raInfo)
+			if err != nil {
+				return err
+			}
+			resp, err = client.SignWithContext(ctx, &api.SignRequest{
+				CsrPEM:   api.CertificateRequest{CertificateRequest: cr},
+				OTT:      token,
+				NotAfter: s.lifetime(lifetime),
+			})
+			return err
+		})
 	})
 	if err != nil {
 		return nil, nil, err
@@ -213,8 +428,99 @@ func (s *StepCAS) createCertificate(cr *x509.CertificateRequest, template *x509.
 	return cert, chain, nil
 }
 
+// do calls fn with the client and issuer of the upstream CA. If failover is
+// configured, the next upstream CA is used while fn fails with connection
+// errors.
+func (s *StepCAS) do(fn func(client *ca.Client, iss stepIssuer) error) error {
+	if s.failover == nil {
+		return fn(s.client, s.iss)
+	}
+	return s.failover.do(fn)
+}
+
 func (s *StepCAS) lifetime(d time.Duration) api.TimeDuration {
 	var td api.TimeDuration
 	td.SetDuration(s.iss.Lifetime(d))
 	return td
 }
+
+// createKey creates a new key and signer using the configured key manager, or
+// the default one if none was configured.
+func (s *StepCAS) createKey(req *kmsapi.CreateKeyRequest) (*kmsapi.CreateKeyResponse, crypto.Signer, error) {
+	if s.keyManager == nil {
+		km, err := kms.New(context.Background(), kmsapi.Options{
+			Type: kmsapi.DefaultKMS,
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		s.keyManager = km
+	}
+	if req == nil {
+		req = &kmsapi.CreateKeyRequest{
+			SignatureAlgorithm: kmsapi.ECDSAWithSHA256,
+		}
+	}
+
+	key, err := s.keyManager.CreateKey(req)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "error creating key")
+	}
+	signer, err := s.keyManager.CreateSigner(&key.CreateSignerRequest)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "error creating signer")
+	}
+	return key, signer, nil
+}
+
+// createCertificateRequest creates a certificate request with the subject and
+// SANs of the given template.
+func createCertificateRequest(template *x509.Certificate, signer crypto.Signer) (*x509.CertificateRequest, error) {
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:        template.Subject,
+		DNSNames:       template.DNSNames,
+		EmailAddresses: template.EmailAddresses,
+		IPAddresses:    template.IPAddresses,
+		URIs:           template.URIs,
+	}, signer)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating certificate request")
+	}
+	cr, err := x509.ParseCertificateRequest(der)
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing certificate request")
+	}
+	return cr, nil
+}
+
+// newClientCertificate loads the certificate and key used in the TLS
+// connection with the upstream CA.
+func newClientCertificate(ctx context.Context, cc *apiv1.ClientCertificate) (tls.Certificate, error) {
+	switch {
+	case cc.Certificate == "":
+		return tls.Certificate{}, errors.New("stepCAS `clientCertificate.crt` cannot be empty")
+	case cc.Key == "":
+		return tls.Certificate{}, errors.New("stepCAS `clientCertificate.key` cannot be empty")
+	}
+
+	certs, err := pemutil.ReadCertificateBundle(cc.Certificate)
+	if err != nil {
+		return tls.Certificate{}, errors.Wrap(err, "error reading client certificate")
+	}
+	signer, err := loadSigner(ctx, cc.Key, cc.Password)
+	if err != nil {
+		return tls.Certificate{}, errors.Wrap(err, "error reading client certificate key")
+	}
+	if !keyutil.Equal(certs[0].PublicKey, signer.Public()) {
+		return tls.Certificate{}, errors.New("error reading client certificate: certificate does not match the key")
+	}
+
+	cert := tls.Certificate{
+		PrivateKey: signer,
+		Leaf:       certs[0],
+	}
+	for _, crt := range certs {
+		cert.Certificate = append(cert.Certificate, crt.Raw)
+	}
+	return cert, nil
+}
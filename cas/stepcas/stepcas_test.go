@@ -7,6 +7,7 @@ import (
 	"crypto/ed25519"
 	"crypto/rand"
 	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/json"
 	"encoding/pem"
 	"fmt"
@@ -16,6 +17,7 @@ import (
 	"os"
 	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
@@ -25,6 +27,8 @@ import (
 	"github.com/smallstep/certificates/cas/apiv1"
 	"github.com/stretchr/testify/require"
 	"go.step.sm/crypto/jose"
+	"go.step.sm/crypto/kms"
+	kmsapi "go.step.sm/crypto/kms/apiv1"
 	"go.step.sm/crypto/pemutil"
 	"go.step.sm/crypto/randutil"
 	"go.step.sm/crypto/x509util"
@@ -81,6 +85,20 @@ func mustSignCertificate(subject string, sans []string, template string, parent
 	return crt, priv
 }
 
+func mustSignCertificateRequest(cr *x509.CertificateRequest) *x509.Certificate {
+	cert, err := x509util.NewCertificate(cr, x509util.WithTemplate(x509util.DefaultIntermediateTemplate, x509util.CreateTemplateData(cr.Subject.CommonName, nil)))
+	if err != nil {
+		panic(err)
+	}
+	crt := cert.GetCertificate()
+	crt.NotBefore = time.Now()
+	crt.NotAfter = crt.NotBefore.Add(time.Hour)
+	if crt, err = x509util.CreateCertificate(crt, testRootCrt, cr.PublicKey, testRootKey); err != nil {
+		panic(err)
+	}
+	return crt
+}
+
 func mustSerializeCrt(filename string, certs ...*x509.Certificate) {
 	buf := new(bytes.Buffer)
 	for _, c := range certs {
@@ -136,14 +154,34 @@ func testCAHelper(t *testing.T) (*url.URL, *ca.Client) {
 			writeJSON(w, api.RootResponse{
 				RootPEM: api.NewCertificate(testRootCrt),
 			})
+		case r.RequestURI == "/roots":
+			w.WriteHeader(http.StatusOK)
+			writeJSON(w, api.RootsResponse{
+				Certificates: []api.Certificate{api.NewCertificate(testIssCrt), api.NewCertificate(testRootCrt)},
+			})
+		case r.RequestURI == "/intermediates":
+			w.WriteHeader(http.StatusOK)
+			writeJSON(w, api.IntermediatesResponse{
+				Certificates: []api.Certificate{api.NewCertificate(testIssCrt)},
+			})
 		case r.RequestURI == "/sign":
 			var msg api.SignRequest
 			parseJSON(r, &msg)
-			if msg.CsrPEM.DNSNames[0] == "fail.doe.org" {
+			if len(msg.CsrPEM.DNSNames) > 0 && msg.CsrPEM.DNSNames[0] == "fail.doe.org" {
 				w.WriteHeader(http.StatusBadRequest)
 				fmt.Fprintf(w, `{"error":"fail","message":"fail"}`)
 				return
 			}
+			if msg.CsrPEM.Subject.CommonName == "Test Subordinate CA" {
+				w.WriteHeader(http.StatusOK)
+				writeJSON(w, api.SignResponse{
+					CertChainPEM: []api.Certificate{
+						api.NewCertificate(mustSignCertificateRequest(msg.CsrPEM.CertificateRequest)),
+						api.NewCertificate(testRootCrt),
+					},
+				})
+				return
+			}
 			w.WriteHeader(http.StatusOK)
 			writeJSON(w, api.SignResponse{
 				CertChainPEM: []api.Certificate{api.NewCertificate(testCrt), api.NewCertificate(testIssCrt)},
@@ -191,6 +229,9 @@ func testCAHelper(t *testing.T) (*url.URL, *ca.Client) {
 		case r.RequestURI == "/provisioners?cursor=cursor":
 			w.WriteHeader(http.StatusOK)
 			writeJSON(w, api.ProvisionersResponse{})
+		case r.RequestURI == "/health":
+			w.WriteHeader(http.StatusOK)
+			writeJSON(w, api.HealthResponse{Status: "ok"})
 		default:
 			w.WriteHeader(http.StatusNotFound)
 			fmt.Fprintf(w, `{"error":"not found"}`)
@@ -221,7 +262,7 @@ func testX5CIssuer(t *testing.T, caURL *url.URL, password string) *x5cIssuer {
 		key = testEncryptedKeyPath
 		password = testPassword
 	}
-	x5c, err := newX5CIssuer(caURL, &apiv1.CertificateIssuer{
+	x5c, err := newX5CIssuer(context.TODO(), caURL, &apiv1.CertificateIssuer{
 		Type:        "x5c",
 		Provisioner: "X5C",
 		Certificate: testX5CPath,
@@ -387,6 +428,31 @@ func TestNew(t *testing.T) {
 			client:      client,
 			fingerprint: testRootFingerprint,
 		}, false},
+		{"ok retry", args{context.TODO(), apiv1.Options{
+			CertificateAuthority:            caURL.String(),
+			CertificateAuthorityFingerprint: testRootFingerprint,
+			CertificateIssuer: &apiv1.CertificateIssuer{
+				Type:        "x5c",
+				Provisioner: "X5C",
+				Certificate: testX5CPath,
+				Key:         testX5CKeyPath,
+			},
+			Retry: &apiv1.RetryOptions{MaxAttempts: 5},
+		}}, &StepCAS{
+			iss: &x5cIssuer{
+				caURL:    caURL,
+				certFile: testX5CPath,
+				keyFile:  testX5CKeyPath,
+				issuer:   "X5C",
+			},
+			client: client,
+			retrier: &retrier{
+				attempts:       5,
+				initialBackoff: defaultRetryInitialBackoff,
+				maxBackoff:     defaultRetryMaxBackoff,
+			},
+			fingerprint: testRootFingerprint,
+		}, false},
 		{"ok jwk", args{context.TODO(), apiv1.Options{
 			CertificateAuthority:            caURL.String(),
 			CertificateAuthorityFingerprint: testRootFingerprint,
@@ -434,6 +500,25 @@ func TestNew(t *testing.T) {
 			client:      client,
 			fingerprint: testRootFingerprint,
 		}, false},
+		{"ok sha512 fingerprint", args{context.TODO(), apiv1.Options{
+			IsCAGetter:                      true,
+			CertificateAuthority:            caURL.String(),
+			CertificateAuthorityFingerprint: sha512Fingerprint(testRootCrt),
+		}}, &StepCAS{
+			iss:          nil,
+			client:       client,
+			fingerprints: []string{sha512Fingerprint(testRootCrt)},
+		}, false},
+		{"ok multiple fingerprints", args{context.TODO(), apiv1.Options{
+			IsCAGetter:                       true,
+			CertificateAuthority:             caURL.String(),
+			CertificateAuthorityFingerprint:  strings.Repeat("a", 64),
+			CertificateAuthorityFingerprints: []string{testRootFingerprint},
+		}}, &StepCAS{
+			iss:          nil,
+			client:       client,
+			fingerprints: []string{strings.Repeat("a", 64), testRootFingerprint},
+		}, false},
 		{"fail authority", args{context.TODO(), apiv1.Options{
 			CertificateAuthority:            "",
 			CertificateAuthorityFingerprint: testRootFingerprint,
@@ -444,6 +529,31 @@ func TestNew(t *testing.T) {
 				Key:         testX5CKeyPath,
 			},
 		}}, nil, true},
+		{"fail client certificate", args{context.TODO(), apiv1.Options{
+			CertificateAuthority:            caURL.String(),
+			CertificateAuthorityFingerprint: testRootFingerprint,
+			CertificateIssuer: &apiv1.CertificateIssuer{
+				Type:        "x5c",
+				Provisioner: "X5C",
+				Certificate: testX5CPath,
+				Key:         testX5CKeyPath,
+			},
+			ClientCertificate: &apiv1.ClientCertificate{
+				Certificate: testX5CPath,
+				Key:         testIssKeyPath,
+			},
+		}}, nil, true},
+		{"fail retry", args{context.TODO(), apiv1.Options{
+			CertificateAuthority:            caURL.String(),
+			CertificateAuthorityFingerprint: testRootFingerprint,
+			CertificateIssuer: &apiv1.CertificateIssuer{
+				Type:        "x5c",
+				Provisioner: "X5C",
+				Certificate: testX5CPath,
+				Key:         testX5CKeyPath,
+			},
+			Retry: &apiv1.RetryOptions{MaxAttempts: -1},
+		}}, nil, true},
 		{"fail fingerprint", args{context.TODO(), apiv1.Options{
 			CertificateAuthority:            caURL.String(),
 			CertificateAuthorityFingerprint: "",
@@ -454,6 +564,16 @@ func TestNew(t *testing.T) {
 				Key:         testX5CKeyPath,
 			},
 		}}, nil, true},
+		{"fail fingerprint format", args{context.TODO(), apiv1.Options{
+			IsCAGetter:                       true,
+			CertificateAuthority:             caURL.String(),
+			CertificateAuthorityFingerprints: []string{"not-a-fingerprint"},
+		}}, nil, true},
+		{"fail fingerprints not found", args{context.TODO(), apiv1.Options{
+			IsCAGetter:                       true,
+			CertificateAuthority:             caURL.String(),
+			CertificateAuthorityFingerprints: []string{strings.Repeat("a", 64), strings.Repeat("b", 128)},
+		}}, nil, true},
 		{"fail type", args{context.TODO(), apiv1.Options{
 			CertificateAuthority:            caURL.String(),
 			CertificateAuthorityFingerprint: testRootFingerprint,
@@ -780,6 +900,115 @@ func TestStepCAS_CreateCertificate(t *testing.T) {
 	}
 }
 
+func TestStepCAS_CreateCertificateAuthority(t *testing.T) {
+	caURL, client := testCAHelper(t)
+	x5c := testX5CIssuer(t, caURL, "")
+	jwk := testJWKIssuer(t, caURL, "")
+
+	km, err := kms.New(context.Background(), kmsapi.Options{Type: kmsapi.DefaultKMS})
+	require.NoError(t, err)
+
+	subordinate := func() *x509.Certificate {
+		return &x509.Certificate{
+			Subject: pkix.Name{CommonName: "Test Subordinate CA"},
+		}
+	}
+
+	type fields struct {
+		iss        stepIssuer
+		keyManager kms.KeyManager
+	}
+	tests := []struct {
+		name    string
+		fields  fields
+		req     *apiv1.CreateCertificateAuthorityRequest
+		wantErr bool
+	}{
+		{"ok", fields{x5c, nil}, &apiv1.CreateCertificateAuthorityRequest{
+			Type:     apiv1.IntermediateCA,
+			Template: subordinate(),
+			Lifetime: time.Hour,
+		}, false},
+		{"ok jwk", fields{jwk, nil}, &apiv1.CreateCertificateAuthorityRequest{
+			Type:     apiv1.IntermediateCA,
+			Template: subordinate(),
+			Lifetime: time.Hour,
+		}, false},
+		{"ok key manager", fields{x5c, km}, &apiv1.CreateCertificateAuthorityRequest{
+			Type:     apiv1.IntermediateCA,
+			Template: subordinate(),
+			Lifetime: time.Hour,
+			CreateKey: &kmsapi.CreateKeyRequest{
+				SignatureAlgorithm: kmsapi.PureEd25519,
+			},
+		}, false},
+		{"fail type", fields{x5c, nil}, &apiv1.CreateCertificateAuthorityRequest{
+			Type:     apiv1.RootCA,
+			Template: subordinate(),
+			Lifetime: time.Hour,
+		}, true},
+		{"fail template", fields{x5c, nil}, &apiv1.CreateCertificateAuthorityRequest{
+			Type:     apiv1.IntermediateCA,
+			Lifetime: time.Hour,
+		}, true},
+		{"fail lifetime", fields{x5c, nil}, &apiv1.CreateCertificateAuthorityRequest{
+			Type:     apiv1.IntermediateCA,
+			Template: subordinate(),
+			Lifetime: -time.Hour,
+		}, true},
+		{"fail create key", fields{x5c, nil}, &apiv1.CreateCertificateAuthorityRequest{
+			Type:     apiv1.IntermediateCA,
+			Template: subordinate(),
+			Lifetime: time.Hour,
+			CreateKey: &kmsapi.CreateKeyRequest{
+				SignatureAlgorithm: kmsapi.SignatureAlgorithm(100),
+			},
+		}, true},
+		{"fail sign token", fields{mockErrIssuer{}, nil}, &apiv1.CreateCertificateAuthorityRequest{
+			Type:     apiv1.IntermediateCA,
+			Template: subordinate(),
+			Lifetime: time.Hour,
+		}, true},
+		{"fail not ca", fields{x5c, nil}, &apiv1.CreateCertificateAuthorityRequest{
+			Type: apiv1.IntermediateCA,
+			Template: &x509.Certificate{
+				Subject:  pkix.Name{CommonName: "Test Certificate"},
+				DNSNames: []string{"doe.org"},
+			},
+			Lifetime: time.Hour,
+		}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &StepCAS{
+				iss:         tt.fields.iss,
+				client:      client,
+				keyManager:  tt.fields.keyManager,
+				authorityID: "authority-id",
+				fingerprint: testRootFingerprint,
+			}
+			got, err := s.CreateCertificateAuthority(tt.req)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("StepCAS.CreateCertificateAuthority() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				if got != nil {
+					t.Errorf("StepCAS.CreateCertificateAuthority() = %v, want nil", got)
+				}
+				return
+			}
+			require.Equal(t, "Test Subordinate CA", got.Name)
+			require.True(t, got.Certificate.IsCA)
+			require.Equal(t, []*x509.Certificate{testRootCrt}, got.CertificateChain)
+			require.NotEmpty(t, got.PrivateKey)
+			require.NotNil(t, got.Signer)
+			require.Equal(t, got.PublicKey, got.Certificate.PublicKey)
+			require.Equal(t, got.PublicKey, got.Signer.Public())
+		})
+	}
+}
+
 func TestStepCAS_RenewCertificate(t *testing.T) {
 	caURL, client := testCAHelper(t)
 	jwk := testJWKIssuer(t, caURL, "")
@@ -968,12 +1197,16 @@ func TestStepCAS_GetCertificateAuthority(t *testing.T) {
 		{"ok", fields{x5c, client, testRootFingerprint}, args{&apiv1.GetCertificateAuthorityRequest{
 			Name: caURL.String(),
 		}}, &apiv1.GetCertificateAuthorityResponse{
-			RootCertificate: testRootCrt,
+			RootCertificate:          testRootCrt,
+			IntermediateCertificates: []*x509.Certificate{testIssCrt},
+			Metadata:                 apiv1.NewCertificateAuthorityMetadata(testIssCrt),
 		}, false},
 		{"ok jwk", fields{jwk, client, testRootFingerprint}, args{&apiv1.GetCertificateAuthorityRequest{
 			Name: caURL.String(),
 		}}, &apiv1.GetCertificateAuthorityResponse{
-			RootCertificate: testRootCrt,
+			RootCertificate:          testRootCrt,
+			IntermediateCertificates: []*x509.Certificate{testIssCrt},
+			Metadata:                 apiv1.NewCertificateAuthorityMetadata(testIssCrt),
 		}, false},
 		{"fail fingerprint", fields{x5c, client, "fail"}, args{&apiv1.GetCertificateAuthorityRequest{
 			Name: caURL.String(),
@@ -997,3 +1230,84 @@ func TestStepCAS_GetCertificateAuthority(t *testing.T) {
 		})
 	}
 }
+
+func Test_newClientCertificate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cc      *apiv1.ClientCertificate
+		wantErr bool
+	}{
+		{"ok", &apiv1.ClientCertificate{Certificate: testX5CPath, Key: testX5CKeyPath}, false},
+		{"ok encrypted", &apiv1.ClientCertificate{Certificate: testX5CPath, Key: testEncryptedKeyPath, Password: testPassword}, false},
+		{"ok kms", &apiv1.ClientCertificate{Certificate: testX5CPath, Key: "softkms:path=" + testX5CKeyPath}, false},
+		{"fail crt", &apiv1.ClientCertificate{Key: testX5CKeyPath}, true},
+		{"fail key", &apiv1.ClientCertificate{Certificate: testX5CPath}, true},
+		{"fail read crt", &apiv1.ClientCertificate{Certificate: testX5CPath + ".missing", Key: testX5CKeyPath}, true},
+		{"fail read key", &apiv1.ClientCertificate{Certificate: testX5CPath, Key: testX5CKeyPath + ".missing"}, true},
+		{"fail mismatch", &apiv1.ClientCertificate{Certificate: testX5CPath, Key: testIssKeyPath}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := newClientCertificate(context.TODO(), tt.cc)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("newClientCertificate() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			if len(got.Certificate) != 2 || !bytes.Equal(got.Certificate[0], testX5CCrt.Raw) || !bytes.Equal(got.Certificate[1], testIssCrt.Raw) {
+				t.Error("newClientCertificate() certificate chain does not match")
+			}
+			if got.Leaf == nil || !got.Leaf.Equal(testX5CCrt) {
+				t.Error("newClientCertificate() leaf does not match")
+			}
+			if _, ok := got.PrivateKey.(crypto.Signer); !ok {
+				t.Errorf("newClientCertificate() private key type = %T, want crypto.Signer", got.PrivateKey)
+			}
+		})
+	}
+}
+
+func TestStepCAS_CheckHealth(t *testing.T) {
+	_, client := testCAHelper(t)
+
+	newClient := func(t *testing.T, h http.HandlerFunc) *ca.Client {
+		t.Helper()
+		srv := httptest.NewServer(h)
+		t.Cleanup(srv.Close)
+		c, err := ca.NewClient(srv.URL, ca.WithTransport(http.DefaultTransport))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+	degraded := newClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, `{"status":"degraded"}`)
+	})
+	unavailable := newClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprint(w, `{"status":503,"message":"service unavailable"}`)
+	})
+
+	tests := []struct {
+		name    string
+		client  *ca.Client
+		wantErr bool
+	}{
+		{"ok", client, false},
+		{"fail degraded", degraded, true},
+		{"fail unavailable", unavailable, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &StepCAS{
+				client: tt.client,
+			}
+			if err := s.CheckHealth(context.Background()); (err != nil) != tt.wantErr {
+				t.Errorf("StepCAS.CheckHealth() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -1,11 +1,14 @@
 package stepcas
 
 import (
+	"context"
 	"crypto"
 	"crypto/ecdsa"
 	"crypto/ed25519"
 	"crypto/rsa"
 	"net/url"
+	"os"
+	"sync"
 	"time"
 
 	"github.com/pkg/errors"
@@ -27,23 +30,38 @@ type x5cIssuer struct {
 	certFile string
 	keyFile  string
 	password string
+	// key is the signer of the keys in a KMS, these keys are loaded only once.
+	key crypto.Signer
+
+	// The signer is cached and reloaded only if the certificate or key files
+	// change, so a certificate renewed on disk is picked up by the next token.
+	mu      sync.Mutex
+	signer  jose.Signer
+	modTime time.Time
 }
 
 // newX5CIssuer create a new x5c token issuer. The given configuration should be
-// already validate.
-func newX5CIssuer(caURL *url.URL, cfg *apiv1.CertificateIssuer) (*x5cIssuer, error) {
-	_, err := newX5CSigner(cfg.Certificate, cfg.Key, cfg.Password)
-	if err != nil {
-		return nil, err
-	}
-
-	return &x5cIssuer{
+// already validate. The key can be a file or a KMS URI.
+func newX5CIssuer(ctx context.Context, caURL *url.URL, cfg *apiv1.CertificateIssuer) (*x5cIssuer, error) {
+	iss := &x5cIssuer{
 		caURL:    caURL,
 		issuer:   cfg.Provisioner,
 		certFile: cfg.Certificate,
 		keyFile:  cfg.Key,
 		password: cfg.Password,
-	}, nil
+	}
+	if isKMSURI(cfg.Key) {
+		key, err := loadSigner(ctx, cfg.Key, cfg.Password)
+		if err != nil {
+			return nil, err
+		}
+		iss.key = key
+	}
+	if _, err := iss.newSigner(); err != nil {
+		return nil, err
+	}
+
+	return iss, nil
 }
 
 func (i *x5cIssuer) SignToken(subject string, sans []string, info *raInfo) (string, error) {
@@ -77,7 +95,7 @@ func (i *x5cIssuer) Lifetime(d time.Duration) time.Duration {
 }
 
 func (i *x5cIssuer) createToken(aud, sub string, sans []string, info *raInfo) (string, error) {
-	signer, err := newX5CSigner(i.certFile, i.keyFile, i.password)
+	signer, err := i.getSigner()
 	if err != nil {
 		return "", err
 	}
@@ -110,6 +128,60 @@ func (i *x5cIssuer) createToken(aud, sub string, sans []string, info *raInfo) (s
 	return tok, nil
 }
 
+// getSigner returns the cached signer, or creates a new one if the certificate
+// or key files have been modified.
+func (i *x5cIssuer) getSigner() (jose.Signer, error) {
+	files := []string{i.certFile}
+	if i.key == nil {
+		files = append(files, i.keyFile)
+	}
+	modTime, err := lastModified(files...)
+	if err != nil {
+		return nil, err
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if i.signer != nil && modTime.Equal(i.modTime) {
+		return i.signer, nil
+	}
+
+	signer, err := i.newSigner()
+	if err != nil {
+		return nil, err
+	}
+	i.signer, i.modTime = signer, modTime
+	return signer, nil
+}
+
+// newSigner creates a new signer using the certificate chain on disk and the
+// KMS key or the key on disk.
+func (i *x5cIssuer) newSigner() (jose.Signer, error) {
+	key := i.key
+	if key == nil {
+		var err error
+		if key, err = readKey(i.keyFile, i.password); err != nil {
+			return nil, err
+		}
+	}
+	return newX5CSigner(i.certFile, key)
+}
+
+// lastModified returns the latest modification time of the given files.
+func lastModified(files ...string) (time.Time, error) {
+	var t time.Time
+	for _, fn := range files {
+		st, err := os.Stat(fn)
+		if err != nil {
+			return time.Time{}, errors.Wrapf(err, "error reading %s", fn)
+		}
+		if st.ModTime().After(t) {
+			t = st.ModTime()
+		}
+	}
+	return t, nil
+}
+
 func defaultClaims(iss, sub, aud, id string) jose.Claims {
 	now := timeNow()
 	return jose.Claims{
@@ -139,11 +211,7 @@ func readKey(keyFile, password string) (crypto.Signer, error) {
 	return signer, nil
 }
 
-func newX5CSigner(certFile, keyFile, password string) (jose.Signer, error) {
-	signer, err := readKey(keyFile, password)
-	if err != nil {
-		return nil, err
-	}
+func newX5CSigner(certFile string, signer crypto.Signer) (jose.Signer, error) {
 	kid, err := jose.Thumbprint(&jose.JSONWebKey{Key: signer.Public()})
 	if err != nil {
 		return nil, err
@@ -9,11 +9,14 @@ import (
 	"crypto/rsa"
 	"io"
 	"net/url"
+	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
 	"time"
 
 	"go.step.sm/crypto/jose"
+	"go.step.sm/crypto/x509util"
 )
 
 type noneSigner []byte
@@ -290,3 +293,75 @@ func Test_newJoseSigner(t *testing.T) {
 		})
 	}
 }
+
+func Test_x5cIssuer_getSigner(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "x5c.crt")
+	keyFile := filepath.Join(dir, "x5c.key")
+	mustSerializeCrt(certFile, testX5CCrt, testIssCrt)
+	mustSerializeKey(keyFile, testX5CKey)
+
+	i := &x5cIssuer{
+		certFile: certFile,
+		keyFile:  keyFile,
+		issuer:   "X5C",
+	}
+
+	s1, err := i.getSigner()
+	if err != nil {
+		t.Fatalf("x5cIssuer.getSigner() error = %v", err)
+	}
+	s2, err := i.getSigner()
+	if err != nil {
+		t.Fatalf("x5cIssuer.getSigner() error = %v", err)
+	}
+	if s1 != s2 {
+		t.Error("x5cIssuer.getSigner() did not return the cached signer")
+	}
+
+	// Renew the certificate on disk.
+	crt, key := mustSignCertificate("Test X5C Certificate", nil, x509util.DefaultLeafTemplate, testIssCrt, testIssKey)
+	mustSerializeCrt(certFile, crt, testIssCrt)
+	mustSerializeKey(keyFile, key)
+	modTime := time.Now().Add(time.Minute)
+	for _, fn := range []string{certFile, keyFile} {
+		if err := os.Chtimes(fn, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s3, err := i.getSigner()
+	if err != nil {
+		t.Fatalf("x5cIssuer.getSigner() error = %v", err)
+	}
+	if s3 == s1 {
+		t.Error("x5cIssuer.getSigner() did not reload the signer")
+	}
+
+	// Fail if the files are removed.
+	if err := os.Remove(certFile); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := i.getSigner(); err == nil {
+		t.Error("x5cIssuer.getSigner() error = nil, wantErr true")
+	}
+}
+
+func Test_x5cIssuer_getSigner_kms(t *testing.T) {
+	i := &x5cIssuer{
+		certFile: testX5CPath,
+		keyFile:  "softkms:path=" + testX5CKeyPath,
+		issuer:   "X5C",
+		key:      testX5CKey,
+	}
+	if _, err := i.getSigner(); err != nil {
+		t.Errorf("x5cIssuer.getSigner() error = %v", err)
+	}
+
+	// The key must match the certificate.
+	i.key = testIssKey
+	i.signer = nil
+	if _, err := i.getSigner(); err == nil {
+		t.Error("x5cIssuer.getSigner() error = nil, wantErr true")
+	}
+}
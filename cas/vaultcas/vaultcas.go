@@ -3,6 +3,8 @@ package vaultcas
 import (
 	"bytes"
 	"context"
+	"crypto"
+	"crypto/rand"
 	"crypto/sha256"
 	"crypto/x509"
 	"encoding/hex"
@@ -20,6 +22,8 @@ import (
 	"github.com/smallstep/certificates/cas/vaultcas/auth/kubernetes"
 
 	vault "github.com/hashicorp/vault/api"
+	"go.step.sm/crypto/kms"
+	kmsapi "go.step.sm/crypto/kms/apiv1"
 )
 
 func init() {
@@ -47,6 +51,7 @@ type VaultCAS struct {
 	client      *vault.Client
 	config      VaultOptions
 	fingerprint string
+	keyManager  kms.KeyManager
 }
 
 type certBundle struct {
@@ -88,7 +93,7 @@ func New(ctx context.Context, opts apiv1.Options) (*VaultCAS, error) {
 	case "aws":
 		method, err = aws.NewAwsAuthMethod(vc.AuthMountPath, vc.AuthOptions)
 	default:
-		return nil, fmt.Errorf("unknown auth type: %s, only 'kubernetes' and 'approle' currently supported", vc.AuthType)
+		return nil, fmt.Errorf("unknown auth type: %s, only 'kubernetes', 'approle' and 'aws' currently supported", vc.AuthType)
 	}
 	if err != nil {
 		return nil, fmt.Errorf("unable to configure %s auth method: %w", vc.AuthType, err)
@@ -110,6 +115,7 @@ func New(ctx context.Context, opts apiv1.Options) (*VaultCAS, error) {
 		client:      client,
 		config:      *vc,
 		fingerprint: opts.CertificateAuthorityFingerprint,
+		keyManager:  opts.KeyManager,
 	}, nil
 }
 
@@ -167,16 +173,118 @@ func (v *VaultCAS) GetCertificateAuthority(*apiv1.GetCertificateAuthorityRequest
 		return nil, errors.New("error verifying vault root: fingerprint does not match")
 	}
 
+	issuer := cert.root
+	if len(cert.intermediates) > 0 {
+		issuer = cert.intermediates[0]
+	}
+
 	return &apiv1.GetCertificateAuthorityResponse{
 		RootCertificate:          cert.root,
 		IntermediateCertificates: cert.intermediates,
+		Metadata:                 apiv1.NewCertificateAuthorityMetadata(issuer),
 	}, nil
 }
 
-// RenewCertificate will always return a non-implemented error as renewals
-// are not supported yet.
-func (v *VaultCAS) RenewCertificate(*apiv1.RenewCertificateRequest) (*apiv1.RenewCertificateResponse, error) {
-	return nil, apiv1.NotImplementedError{Message: "vaultCAS does not support renewals"}
+// CreateCertificateAuthority creates an intermediate certificate using the
+// Vault pki/root/sign-intermediate endpoint. The key is created using the
+// configured key manager and only the certificate request is sent to Vault.
+func (v *VaultCAS) CreateCertificateAuthority(req *apiv1.CreateCertificateAuthorityRequest) (*apiv1.CreateCertificateAuthorityResponse, error) {
+	switch {
+	case req.Type != apiv1.IntermediateCA:
+		return nil, fmt.Errorf("createCertificateAuthority `type=%d' is invalid or not supported", req.Type)
+	case req.Template == nil:
+		return nil, errors.New("createCertificateAuthority `template` cannot be nil")
+	case req.Template.Subject.CommonName == "":
+		return nil, errors.New("createCertificateAuthority `template.subject.commonName` cannot be empty")
+	case req.Lifetime == 0:
+		return nil, errors.New("createCertificateAuthority `lifetime` cannot be 0")
+	}
+
+	key, signer, err := v.createKey(req.CreateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:        req.Template.Subject,
+		DNSNames:       req.Template.DNSNames,
+		EmailAddresses: req.Template.EmailAddresses,
+		IPAddresses:    req.Template.IPAddresses,
+		URIs:           req.Template.URIs,
+	}, signer)
+	if err != nil {
+		return nil, fmt.Errorf("error creating certificate request: %w", err)
+	}
+
+	vaultReq := map[string]interface{}{
+		"csr": string(pem.EncodeToMemory(&pem.Block{
+			Type:  "CERTIFICATE REQUEST",
+			Bytes: csr,
+		})),
+		"common_name":    req.Template.Subject.CommonName,
+		"use_csr_values": true,
+		"format":         "pem_bundle",
+		"ttl":            req.Lifetime.String(),
+	}
+
+	secret, err := v.client.Logical().Write(v.config.PKIMountPath+"/root/sign-intermediate", vaultReq)
+	if err != nil {
+		return nil, fmt.Errorf("error signing intermediate certificate: %w", err)
+	}
+	if secret == nil {
+		return nil, errors.New("error signing intermediate certificate: response is empty")
+	}
+
+	bundle, ok := secret.Data["certificate"].(string)
+	if !ok {
+		return nil, errors.New("error unmarshaling vault response: certificate not found")
+	}
+
+	// The first certificate in the bundle is the new intermediate, the root is
+	// not part of the chain.
+	certs := parseCertificates(bundle)
+	if len(certs) == 0 {
+		return nil, errors.New("error unmarshaling vault response: certificate not found")
+	}
+	cert := certs[0]
+	var chain []*x509.Certificate
+	for _, c := range certs[1:] {
+		if !isRoot(c) {
+			chain = append(chain, c)
+		}
+	}
+
+	return &apiv1.CreateCertificateAuthorityResponse{
+		Name:             cert.Subject.CommonName,
+		Certificate:      cert,
+		CertificateChain: chain,
+		KeyName:          key.Name,
+		PublicKey:        key.PublicKey,
+		PrivateKey:       key.PrivateKey,
+		Signer:           signer,
+	}, nil
+}
+
+// RenewCertificate signs the CSR in the request using the Vault pki/sign
+// endpoint. Vault only signs certificate requests, so renewals without a CSR
+// will return a non-implemented error.
+func (v *VaultCAS) RenewCertificate(req *apiv1.RenewCertificateRequest) (*apiv1.RenewCertificateResponse, error) {
+	switch {
+	case req.CSR == nil:
+		return nil, apiv1.NotImplementedError{Message: "vaultCAS does not support renewals without a certificate request"}
+	case req.Lifetime == 0:
+		return nil, errors.New("renewCertificate `lifetime` cannot be 0")
+	}
+
+	cert, chain, err := v.createCertificate(req.CSR, req.Lifetime)
+	if err != nil {
+		return nil, err
+	}
+
+	return &apiv1.RenewCertificateResponse{
+		Certificate:      cert,
+		CertificateChain: chain,
+	}, nil
 }
 
 // RevokeCertificate revokes a certificate by serial number.
@@ -254,6 +362,35 @@ func (v *VaultCAS) createCertificate(cr *x509.CertificateRequest, lifetime time.
 	return cert.leaf, cert.intermediates, nil
 }
 
+// createKey creates a new key and signer using the configured key manager, or
+// the default one if none was configured.
+func (v *VaultCAS) createKey(req *kmsapi.CreateKeyRequest) (*kmsapi.CreateKeyResponse, crypto.Signer, error) {
+	if v.keyManager == nil {
+		km, err := kms.New(context.Background(), kmsapi.Options{
+			Type: kmsapi.DefaultKMS,
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		v.keyManager = km
+	}
+	if req == nil {
+		req = &kmsapi.CreateKeyRequest{
+			SignatureAlgorithm: kmsapi.ECDSAWithSHA256,
+		}
+	}
+
+	key, err := v.keyManager.CreateKey(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error creating key: %w", err)
+	}
+	signer, err := v.keyManager.CreateSigner(&key.CreateSignerRequest)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error creating signer: %w", err)
+	}
+	return key, signer, nil
+}
+
 func loadOptions(config json.RawMessage) (*VaultOptions, error) {
 	// setup default values
 	vc := VaultOptions{
@@ -3,8 +3,12 @@ package vaultcas
 import (
 	"bytes"
 	"context"
+	"crypto/ed25519"
+	"crypto/rand"
 	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/json"
+	"encoding/pem"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
@@ -15,7 +19,10 @@ import (
 
 	vault "github.com/hashicorp/vault/api"
 	"github.com/smallstep/certificates/cas/apiv1"
+	"go.step.sm/crypto/kms"
+	kmsapi "go.step.sm/crypto/kms/apiv1"
 	"go.step.sm/crypto/pemutil"
+	"go.step.sm/crypto/x509util"
 )
 
 var (
@@ -89,6 +96,42 @@ func mustParseCertificateRequest(t *testing.T, pemData string) *x509.Certificate
 	return csr
 }
 
+// mustSignIntermediate signs the given certificate request with a new root
+// and returns a PEM bundle with the intermediate and the root.
+func mustSignIntermediate(csrPEM string) string {
+	cr, err := pemutil.ParseCertificateRequest([]byte(csrPEM))
+	if err != nil {
+		panic(err)
+	}
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+	root, err := x509util.CreateCertificate(&x509.Certificate{
+		Subject:               pkix.Name{CommonName: "Vault Root CA"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}, &x509.Certificate{Subject: pkix.Name{CommonName: "Vault Root CA"}}, pub, priv)
+	if err != nil {
+		panic(err)
+	}
+	cert, err := x509util.NewCertificate(cr, x509util.WithTemplate(x509util.DefaultIntermediateTemplate, x509util.CreateTemplateData(cr.Subject.CommonName, nil)))
+	if err != nil {
+		panic(err)
+	}
+	crt := cert.GetCertificate()
+	crt.NotBefore = time.Now()
+	crt.NotAfter = crt.NotBefore.Add(time.Hour)
+	if crt, err = x509util.CreateCertificate(crt, root, cr.PublicKey, priv); err != nil {
+		panic(err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: crt.Raw})) +
+		string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: root.Raw}))
+}
+
 func testCAHelper(t *testing.T) (*url.URL, *vault.Client) {
 	t.Helper()
 
@@ -120,6 +163,19 @@ func testCAHelper(t *testing.T) (*url.URL, *vault.Client) {
 			cert := map[string]interface{}{"data": map[string]interface{}{"certificate": testCertificateSigned + "\n" + testRootCertificate}}
 			writeJSON(w, cert)
 			return
+		case r.RequestURI == "/v1/pki/root/sign-intermediate":
+			var m map[string]interface{}
+			json.NewDecoder(r.Body).Decode(&m)
+			csr, _ := m["csr"].(string)
+			if m["common_name"] == "fail" || m["use_csr_values"] != true {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprintf(w, `{"errors":["bad request"]}`)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+			cert := map[string]interface{}{"data": map[string]interface{}{"certificate": mustSignIntermediate(csr)}}
+			writeJSON(w, cert)
+			return
 		case r.RequestURI == "/v1/pki/cert/ca_chain":
 			w.WriteHeader(http.StatusOK)
 			cert := map[string]interface{}{"data": map[string]interface{}{"certificate": testCertificateSigned + "\n" + testRootCertificate}}
@@ -286,6 +342,112 @@ func TestVaultCAS_CreateCertificate(t *testing.T) {
 	}
 }
 
+func TestVaultCAS_CreateCertificateAuthority(t *testing.T) {
+	_, client := testCAHelper(t)
+
+	options := VaultOptions{
+		PKIMountPath: "pki",
+	}
+
+	km, err := kms.New(context.Background(), kmsapi.Options{Type: kmsapi.DefaultKMS})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type fields struct {
+		client     *vault.Client
+		options    VaultOptions
+		keyManager kms.KeyManager
+	}
+	tests := []struct {
+		name    string
+		fields  fields
+		req     *apiv1.CreateCertificateAuthorityRequest
+		wantErr bool
+	}{
+		{"ok", fields{client, options, nil}, &apiv1.CreateCertificateAuthorityRequest{
+			Type:     apiv1.IntermediateCA,
+			Template: &x509.Certificate{Subject: pkix.Name{CommonName: "Intermediate CA"}},
+			Lifetime: time.Hour,
+		}, false},
+		{"ok key manager", fields{client, options, km}, &apiv1.CreateCertificateAuthorityRequest{
+			Type:     apiv1.IntermediateCA,
+			Template: &x509.Certificate{Subject: pkix.Name{CommonName: "Intermediate CA"}},
+			Lifetime: time.Hour,
+			CreateKey: &kmsapi.CreateKeyRequest{
+				SignatureAlgorithm: kmsapi.SHA256WithRSA,
+				Bits:               2048,
+			},
+		}, false},
+		{"fail type", fields{client, options, nil}, &apiv1.CreateCertificateAuthorityRequest{
+			Type:     apiv1.RootCA,
+			Template: &x509.Certificate{Subject: pkix.Name{CommonName: "Intermediate CA"}},
+			Lifetime: time.Hour,
+		}, true},
+		{"fail template", fields{client, options, nil}, &apiv1.CreateCertificateAuthorityRequest{
+			Type:     apiv1.IntermediateCA,
+			Lifetime: time.Hour,
+		}, true},
+		{"fail common name", fields{client, options, nil}, &apiv1.CreateCertificateAuthorityRequest{
+			Type:     apiv1.IntermediateCA,
+			Template: &x509.Certificate{},
+			Lifetime: time.Hour,
+		}, true},
+		{"fail lifetime", fields{client, options, nil}, &apiv1.CreateCertificateAuthorityRequest{
+			Type:     apiv1.IntermediateCA,
+			Template: &x509.Certificate{Subject: pkix.Name{CommonName: "Intermediate CA"}},
+		}, true},
+		{"fail create key", fields{client, options, nil}, &apiv1.CreateCertificateAuthorityRequest{
+			Type:     apiv1.IntermediateCA,
+			Template: &x509.Certificate{Subject: pkix.Name{CommonName: "Intermediate CA"}},
+			Lifetime: time.Hour,
+			CreateKey: &kmsapi.CreateKeyRequest{
+				SignatureAlgorithm: kmsapi.SignatureAlgorithm(100),
+			},
+		}, true},
+		{"fail sign", fields{client, options, nil}, &apiv1.CreateCertificateAuthorityRequest{
+			Type:     apiv1.IntermediateCA,
+			Template: &x509.Certificate{Subject: pkix.Name{CommonName: "fail"}},
+			Lifetime: time.Hour,
+		}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &VaultCAS{
+				client:     tt.fields.client,
+				config:     tt.fields.options,
+				keyManager: tt.fields.keyManager,
+			}
+			got, err := c.CreateCertificateAuthority(tt.req)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("VaultCAS.CreateCertificateAuthority() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				if got != nil {
+					t.Errorf("VaultCAS.CreateCertificateAuthority() = %v, want nil", got)
+				}
+				return
+			}
+			if got.Name != "Intermediate CA" {
+				t.Errorf("VaultCAS.CreateCertificateAuthority() Name = %v, want Intermediate CA", got.Name)
+			}
+			if !got.Certificate.IsCA {
+				t.Error("VaultCAS.CreateCertificateAuthority() Certificate.IsCA = false, want true")
+			}
+			if got.CertificateChain != nil {
+				t.Errorf("VaultCAS.CreateCertificateAuthority() CertificateChain = %v, want nil", got.CertificateChain)
+			}
+			if got.Signer == nil || got.PrivateKey == nil {
+				t.Error("VaultCAS.CreateCertificateAuthority() Signer and PrivateKey cannot be nil")
+			}
+			if !reflect.DeepEqual(got.Certificate.PublicKey, got.PublicKey) {
+				t.Errorf("VaultCAS.CreateCertificateAuthority() PublicKey = %v, want %v", got.PublicKey, got.Certificate.PublicKey)
+			}
+		})
+	}
+}
+
 func TestVaultCAS_GetCertificateAuthority(t *testing.T) {
 	caURL, client := testCAHelper(t)
 
@@ -316,6 +478,7 @@ func TestVaultCAS_GetCertificateAuthority(t *testing.T) {
 			Name: caURL.String(),
 		}}, &apiv1.GetCertificateAuthorityResponse{
 			RootCertificate: rootCert,
+			Metadata:        apiv1.NewCertificateAuthorityMetadata(rootCert),
 		}, false},
 		{"fail fingerprint", fields{client, options, "fail"}, args{&apiv1.GetCertificateAuthorityRequest{
 			Name: caURL.String(),
@@ -435,8 +598,19 @@ func TestVaultCAS_RenewCertificate(t *testing.T) {
 		want    *apiv1.RenewCertificateResponse
 		wantErr bool
 	}{
-		{"not implemented", fields{client, options}, args{&apiv1.RenewCertificateRequest{
+		{"ok", fields{client, options}, args{&apiv1.RenewCertificateRequest{
+			CSR:      mustParseCertificateRequest(t, testCertificateCsrEc),
+			Lifetime: time.Hour,
+		}}, &apiv1.RenewCertificateResponse{
+			Certificate:      mustParseCertificate(t, testCertificateSigned),
+			CertificateChain: nil,
+		}, false},
+		{"fail lifetime", fields{client, options}, args{&apiv1.RenewCertificateRequest{
 			CSR:      mustParseCertificateRequest(t, testCertificateCsrEc),
+			Lifetime: 0,
+		}}, nil, true},
+		{"fail not implemented", fields{client, options}, args{&apiv1.RenewCertificateRequest{
+			Template: mustParseCertificate(t, testCertificateSigned),
 			Lifetime: time.Hour,
 		}}, nil, true},
 	}
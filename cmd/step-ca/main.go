@@ -27,8 +27,9 @@ import (
 	"go.step.sm/crypto/pemutil"
 
 	// Enabled kms interfaces.
-	_ "go.step.sm/crypto/kms/awskms"
-	_ "go.step.sm/crypto/kms/azurekms"
+	_ "github.com/smallstep/certificates/kms/awskms"
+	_ "github.com/smallstep/certificates/kms/azurekms"
+	_ "github.com/smallstep/certificates/kms/fortanixkms"
 	_ "go.step.sm/crypto/kms/cloudkms"
 	_ "go.step.sm/crypto/kms/pkcs11"
 	_ "go.step.sm/crypto/kms/softkms"
@@ -37,7 +38,14 @@ import (
 	_ "go.step.sm/crypto/kms/yubikey"
 
 	// Enabled cas interfaces.
+	_ "github.com/smallstep/certificates/cas/acmecas"
+	_ "github.com/smallstep/certificates/cas/acmpca"
+	_ "github.com/smallstep/certificates/cas/azurekvcas"
 	_ "github.com/smallstep/certificates/cas/cloudcas"
+	_ "github.com/smallstep/certificates/cas/digicert"
+	_ "github.com/smallstep/certificates/cas/entrust"
+	_ "github.com/smallstep/certificates/cas/grpccas"
+	_ "github.com/smallstep/certificates/cas/kmipcas"
 	_ "github.com/smallstep/certificates/cas/softcas"
 	_ "github.com/smallstep/certificates/cas/stepcas"
 	_ "github.com/smallstep/certificates/cas/vaultcas"
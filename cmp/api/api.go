@@ -0,0 +1,497 @@
+// Package api implements a CMP (RFC 9483) HTTP server.
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"go.step.sm/crypto/x509util"
+
+	"github.com/smallstep/certificates/api"
+	"github.com/smallstep/certificates/api/log"
+	"github.com/smallstep/certificates/authority"
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/cmp"
+)
+
+const (
+	maxPayloadSize = 2 << 20
+	contentType    = "application/pkixcmp"
+)
+
+// Authority is the interface used by the CMP handlers.
+type Authority interface {
+	LoadProvisionerByName(string) (provisioner.Interface, error)
+	GetRootCertificates() []*x509.Certificate
+	GetIntermediateCertificates() []*x509.Certificate
+	GetX509Signer() (crypto.Signer, error)
+	SignWithContext(ctx context.Context, csr *x509.CertificateRequest, signOpts provisioner.SignOptions, extraOpts ...provisioner.SignOption) ([]*x509.Certificate, error)
+	IsRevoked(sn string) (bool, error)
+	Revoke(ctx context.Context, opts *authority.RevokeOptions) error
+}
+
+var mustAuthority = func(ctx context.Context) Authority {
+	return authority.MustFromContext(ctx)
+}
+
+// Route traffic and implement the Router interface. The routes are mounted
+// in /.well-known/cmp, and the name in the path is the name of the
+// provisioner.
+func Route(r api.Router) {
+	r.MethodFunc(http.MethodPost, "/p/{provisionerName}", Post)
+}
+
+// pkiError is an error sent to the client in a CMP error message.
+type pkiError struct {
+	failInfo int
+	err      error
+}
+
+func (e *pkiError) Error() string {
+	return e.err.Error()
+}
+
+func (e *pkiError) Unwrap() error {
+	return e.err
+}
+
+func newPKIError(failInfo int, err error) *pkiError {
+	return &pkiError{failInfo: failInfo, err: err}
+}
+
+func pkiErrorf(failInfo int, format string, args ...any) *pkiError {
+	return &pkiError{failInfo: failInfo, err: fmt.Errorf(format, args...)}
+}
+
+// protection is the protection of a verified request. The response is
+// protected in the same way: with the same shared secret, or signed by the CA
+// if the request was signed.
+type protection struct {
+	secret []byte
+	cert   *x509.Certificate
+	chains [][]*x509.Certificate
+}
+
+// Post handles the CMP requests.
+func Post(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxPayloadSize))
+	if err != nil {
+		fail(w, r, http.StatusBadRequest, fmt.Errorf("error reading request body: %w", err))
+		return
+	}
+	req, err := cmp.ParseMessage(body)
+	if err != nil {
+		fail(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	name := chi.URLParam(r, "provisionerName")
+	p, err := mustAuthority(ctx).LoadProvisionerByName(name)
+	if err != nil {
+		fail(w, r, http.StatusNotFound, fmt.Errorf("provisioner %q not found", name))
+		return
+	}
+	prov, ok := p.(*provisioner.CMP)
+	if !ok {
+		fail(w, r, http.StatusNotFound, fmt.Errorf("provisioner %q is not a cmp provisioner", name))
+		return
+	}
+
+	if !req.SupportedVersion() {
+		writeError(w, r, req, nil, pkiErrorf(cmp.FailUnsupportedVersion, "unsupported pvno %d", req.Header.PVNO))
+		return
+	}
+	prot, err := verifyProtection(ctx, prov, req)
+	if err != nil {
+		writeError(w, r, req, nil, err)
+		return
+	}
+
+	var resp *cmp.Message
+	switch req.Type() {
+	case cmp.TypeIR:
+		resp, err = certification(ctx, prov, req, prot, cmp.TypeIP)
+	case cmp.TypeCR:
+		resp, err = certification(ctx, prov, req, prot, cmp.TypeCP)
+	case cmp.TypeKUR:
+		resp, err = keyUpdate(ctx, prov, req, prot)
+	case cmp.TypeRR:
+		resp, err = revocation(ctx, prov, req, prot)
+	case cmp.TypeCertConf:
+		resp, err = newResponse(ctx, req, cmp.TypePKIConf, asn1.NullRawValue)
+	default:
+		err = pkiErrorf(cmp.FailBadRequest, "unsupported message type %d", req.Type())
+	}
+	if err != nil {
+		writeError(w, r, req, prot, err)
+		return
+	}
+	writeResponse(w, r, req, prot, resp)
+}
+
+// verifyProtection verifies the MAC or the signature of the request.
+func verifyProtection(ctx context.Context, p *provisioner.CMP, req *cmp.Message) (*protection, error) {
+	switch {
+	case req.IsMACProtected():
+		secret, err := p.GetSharedSecret(ctx, req.Header.SenderKID)
+		if err != nil {
+			return nil, newPKIError(cmp.FailNotAuthorized, err)
+		}
+		if err := req.VerifyMAC(secret); err != nil {
+			return nil, newPKIError(cmp.FailBadMessageCheck, err)
+		}
+		return &protection{secret: secret}, nil
+	case req.IsSignatureProtected():
+		cert, err := req.ProtectionCertificate()
+		if err != nil {
+			return nil, newPKIError(cmp.FailBadMessageCheck, err)
+		}
+		a := mustAuthority(ctx)
+		roots := x509.NewCertPool()
+		for _, c := range a.GetRootCertificates() {
+			roots.AddCert(c)
+		}
+		intermediates := x509.NewCertPool()
+		for _, c := range a.GetIntermediateCertificates() {
+			intermediates.AddCert(c)
+		}
+		for _, c := range req.ExtraCerts[1:] {
+			intermediates.AddCert(c)
+		}
+		chains, err := cert.Verify(x509.VerifyOptions{
+			Roots:         roots,
+			Intermediates: intermediates,
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+		})
+		if err != nil {
+			return nil, pkiErrorf(cmp.FailSignerNotTrusted, "error verifying protection certificate: %w", err)
+		}
+		revoked, err := a.IsRevoked(cert.SerialNumber.String())
+		switch {
+		case err != nil:
+			return nil, pkiErrorf(cmp.FailSystemFailure, "error checking certificate revocation: %w", err)
+		case revoked:
+			return nil, pkiErrorf(cmp.FailCertRevoked, "protection certificate has been revoked")
+		}
+		if err := req.VerifySignature(cert); err != nil {
+			return nil, newPKIError(cmp.FailBadMessageCheck, err)
+		}
+		return &protection{cert: cert, chains: chains}, nil
+	default:
+		return nil, pkiErrorf(cmp.FailBadMessageCheck, "message is not protected")
+	}
+}
+
+// parseCertReqMsg returns the only certificate request of an ir, cr or kur
+// message.
+func parseCertReqMsg(req *cmp.Message) (*cmp.CertReqMsg, *cmp.CertRequest, error) {
+	var msgs []cmp.CertReqMsg
+	if err := req.UnmarshalBody(&msgs); err != nil {
+		return nil, nil, newPKIError(cmp.FailBadDataFormat, err)
+	}
+	if len(msgs) != 1 {
+		return nil, nil, pkiErrorf(cmp.FailBadRequest, "only one certificate request per message is supported")
+	}
+	cr, err := msgs[0].ParseCertRequest()
+	if err != nil {
+		return nil, nil, newPKIError(cmp.FailBadDataFormat, err)
+	}
+	return &msgs[0], cr, nil
+}
+
+// certification handles ir and cr messages.
+func certification(ctx context.Context, p *provisioner.CMP, req *cmp.Message, prot *protection, respType int) (*cmp.Message, error) {
+	msg, cr, err := parseCertReqMsg(req)
+	if err != nil {
+		return nil, err
+	}
+	csr, err := cr.CertTemplate.CertificateRequest()
+	if err != nil {
+		return nil, newPKIError(cmp.FailBadCertTemplate, err)
+	}
+	if prot.cert != nil {
+		if err := p.AuthorizeClientCertificate(ctx, prot.chains, csr); err != nil {
+			return nil, newPKIError(cmp.FailNotAuthorized, err)
+		}
+	}
+	if err := msg.VerifyProofOfPossession(csr.PublicKey); err != nil {
+		return nil, newPKIError(cmp.FailBadPOP, err)
+	}
+
+	chain, err := sign(ctx, p, csr, &cr.CertTemplate)
+	if err != nil {
+		return nil, err
+	}
+	content := cmp.CertRepMessage{
+		Response: []cmp.CertResponse{cmp.NewCertResponse(cr.CertReqID, chain[0])},
+	}
+	// Clients using a shared secret might not have the root yet.
+	if respType == cmp.TypeIP && prot.secret != nil {
+		content.CAPubs = cmp.RawCertificates(mustAuthority(ctx).GetRootCertificates())
+	}
+	resp, err := newResponse(ctx, req, respType, content)
+	if err != nil {
+		return nil, err
+	}
+	resp.ExtraCerts = chain[1:]
+	return resp, nil
+}
+
+// keyUpdate handles kur messages, which must be signed with the certificate
+// to update.
+func keyUpdate(ctx context.Context, p *provisioner.CMP, req *cmp.Message, prot *protection) (*cmp.Message, error) {
+	if prot.cert == nil {
+		return nil, pkiErrorf(cmp.FailNotAuthorized, "key update requests must be signed with the certificate to update")
+	}
+
+	msg, cr, err := parseCertReqMsg(req)
+	if err != nil {
+		return nil, err
+	}
+	csr, err := cr.CertTemplate.CertificateRequest()
+	if err != nil {
+		return nil, newPKIError(cmp.FailBadCertTemplate, err)
+	}
+	// The subject and names default to the ones in the certificate.
+	if !cr.CertTemplate.HasSubject() {
+		csr.Subject = prot.cert.Subject
+		csr.RawSubject = prot.cert.RawSubject
+		if len(csr.DNSNames)+len(csr.EmailAddresses)+len(csr.IPAddresses)+len(csr.URIs) == 0 {
+			csr.DNSNames = prot.cert.DNSNames
+			csr.EmailAddresses = prot.cert.EmailAddresses
+			csr.IPAddresses = prot.cert.IPAddresses
+			csr.URIs = prot.cert.URIs
+		}
+	}
+	if pub, ok := prot.cert.PublicKey.(interface{ Equal(crypto.PublicKey) bool }); ok && pub.Equal(csr.PublicKey) {
+		return nil, pkiErrorf(cmp.FailBadCertTemplate, "key update requests must use a new key")
+	}
+	if err := p.AuthorizeKeyUpdate(ctx, csr, prot.cert); err != nil {
+		return nil, newPKIError(cmp.FailNotAuthorized, err)
+	}
+	if err := msg.VerifyProofOfPossession(csr.PublicKey); err != nil {
+		return nil, newPKIError(cmp.FailBadPOP, err)
+	}
+
+	chain, err := sign(ctx, p, csr, &cr.CertTemplate)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := newResponse(ctx, req, cmp.TypeKUP, cmp.CertRepMessage{
+		Response: []cmp.CertResponse{cmp.NewCertResponse(cr.CertReqID, chain[0])},
+	})
+	if err != nil {
+		return nil, err
+	}
+	resp.ExtraCerts = chain[1:]
+	return resp, nil
+}
+
+// revocation handles rr messages, which must be signed with the certificate
+// to revoke.
+func revocation(ctx context.Context, p *provisioner.CMP, req *cmp.Message, prot *protection) (*cmp.Message, error) {
+	if prot.cert == nil {
+		return nil, pkiErrorf(cmp.FailNotAuthorized, "revocation requests must be signed with the certificate to revoke")
+	}
+
+	var details []cmp.RevDetails
+	if err := req.UnmarshalBody(&details); err != nil {
+		return nil, newPKIError(cmp.FailBadDataFormat, err)
+	}
+	if len(details) != 1 {
+		return nil, pkiErrorf(cmp.FailBadRequest, "only one revocation request per message is supported")
+	}
+	d := details[0]
+	if d.CertDetails.SerialNumber == nil || d.CertDetails.SerialNumber.Cmp(prot.cert.SerialNumber) != 0 {
+		return nil, pkiErrorf(cmp.FailNotAuthorized, "revocation requests must be signed with the certificate to revoke")
+	}
+	if len(d.CertDetails.Issuer.Bytes) > 0 && !bytes.Equal(d.CertDetails.Issuer.Bytes, prot.cert.RawIssuer) {
+		return nil, pkiErrorf(cmp.FailBadCertID, "issuer does not match the certificate")
+	}
+	if err := p.AuthorizeRevocation(ctx, prot.cert); err != nil {
+		return nil, newPKIError(cmp.FailNotAuthorized, err)
+	}
+	reasonCode, err := d.ReasonCode()
+	if err != nil {
+		return nil, newPKIError(cmp.FailBadDataFormat, err)
+	}
+
+	// Like in mTLS revocations, the request is authenticated with the
+	// certificate to revoke.
+	ctx = provisioner.NewContextWithMethod(ctx, provisioner.RevokeMethod)
+	if err := mustAuthority(ctx).Revoke(ctx, &authority.RevokeOptions{
+		Serial:     prot.cert.SerialNumber.String(),
+		ReasonCode: reasonCode,
+		MTLS:       true,
+		Crt:        prot.cert,
+	}); err != nil {
+		return nil, pkiErrorf(cmp.FailSystemFailure, "error revoking certificate: %w", err)
+	}
+
+	return newResponse(ctx, req, cmp.TypeRP, cmp.RevRepContent{
+		Status: []cmp.PKIStatusInfo{cmp.NewStatusInfo(cmp.StatusAccepted, -1, "")},
+	})
+}
+
+// sign signs the certificate request with the given provisioner. The
+// proof of possession must have been verified.
+func sign(ctx context.Context, p *provisioner.CMP, csr *x509.CertificateRequest, tmpl *cmp.CertTemplate) ([]*x509.Certificate, error) {
+	sans := append([]string{}, csr.DNSNames...)
+	sans = append(sans, csr.EmailAddresses...)
+	for _, v := range csr.IPAddresses {
+		sans = append(sans, v.String())
+	}
+	for _, v := range csr.URIs {
+		sans = append(sans, v.String())
+	}
+	if len(sans) == 0 {
+		sans = append(sans, csr.Subject.CommonName)
+	}
+	data := x509util.CreateTemplateData(csr.Subject.CommonName, sans)
+	data.SetCertificateRequest(csr)
+	data.SetSubject(x509util.Subject{
+		Country:            csr.Subject.Country,
+		Organization:       csr.Subject.Organization,
+		OrganizationalUnit: csr.Subject.OrganizationalUnit,
+		Locality:           csr.Subject.Locality,
+		Province:           csr.Subject.Province,
+		StreetAddress:      csr.Subject.StreetAddress,
+		PostalCode:         csr.Subject.PostalCode,
+		SerialNumber:       csr.Subject.SerialNumber,
+		CommonName:         csr.Subject.CommonName,
+	})
+
+	ctx = provisioner.NewContextWithMethod(ctx, provisioner.SignMethod)
+	signOps, err := p.AuthorizeSign(ctx, "")
+	if err != nil {
+		return nil, newPKIError(cmp.FailNotAuthorized, err)
+	}
+	for _, signOp := range signOps {
+		if wc, ok := signOp.(*provisioner.WebhookController); ok {
+			wc.TemplateData = data
+		}
+	}
+	templateOptions, err := provisioner.TemplateOptions(p.GetOptions(), data)
+	if err != nil {
+		return nil, pkiErrorf(cmp.FailSystemFailure, "error creating template options from CMP provisioner: %w", err)
+	}
+	signOps = append(signOps, templateOptions)
+
+	var opts provisioner.SignOptions
+	notBefore, notAfter, err := tmpl.ValidityPeriod()
+	if err != nil {
+		return nil, pkiErrorf(cmp.FailBadCertTemplate, "error parsing validity: %w", err)
+	}
+	if !notBefore.IsZero() {
+		opts.NotBefore = provisioner.NewTimeDuration(notBefore)
+	}
+	if !notAfter.IsZero() {
+		opts.NotAfter = provisioner.NewTimeDuration(notAfter)
+	}
+
+	chain, err := mustAuthority(ctx).SignWithContext(ctx, csr, opts, signOps...)
+	if err != nil {
+		return nil, pkiErrorf(cmp.FailBadCertTemplate, "error generating certificate: %w", err)
+	}
+	return chain, nil
+}
+
+// newResponse creates a response sent by the CA intermediate.
+func newResponse(ctx context.Context, req *cmp.Message, bodyType int, content any) (*cmp.Message, error) {
+	var sender pkix.Name
+	if intermediates := mustAuthority(ctx).GetIntermediateCertificates(); len(intermediates) > 0 {
+		sender = intermediates[0].Subject
+	}
+	resp, err := cmp.NewResponse(req, sender, bodyType, content)
+	if err != nil {
+		return nil, pkiErrorf(cmp.FailSystemFailure, "error creating response: %w", err)
+	}
+	return resp, nil
+}
+
+// protect protects the response in the same way as the request.
+func protect(ctx context.Context, req, resp *cmp.Message, prot *protection) error {
+	switch {
+	case prot == nil:
+		return nil
+	case prot.secret != nil:
+		return resp.ProtectWithMAC(req, prot.secret)
+	default:
+		a := mustAuthority(ctx)
+		signer, err := a.GetX509Signer()
+		if err != nil {
+			return fmt.Errorf("error getting the CA signer: %w", err)
+		}
+		intermediates := a.GetIntermediateCertificates()
+		if len(intermediates) == 0 {
+			return errors.New("the CA intermediate certificate is not available")
+		}
+		return resp.ProtectWithSignature(signer, intermediates)
+	}
+}
+
+func writeResponse(w http.ResponseWriter, r *http.Request, req *cmp.Message, prot *protection, resp *cmp.Message) {
+	if err := protect(r.Context(), req, resp, prot); err != nil {
+		writeError(w, r, req, nil, newPKIError(cmp.FailSystemFailure, err))
+		return
+	}
+	b, err := resp.Marshal()
+	if err != nil {
+		fail(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	w.Write(b)
+}
+
+// writeError writes a CMP error message. The message is protected if the
+// request protection was verified.
+func writeError(w http.ResponseWriter, r *http.Request, req *cmp.Message, prot *protection, err error) {
+	log.Error(w, r, err)
+
+	failInfo := cmp.FailSystemFailure
+	var pkiErr *pkiError
+	if errors.As(err, &pkiErr) {
+		failInfo = pkiErr.failInfo
+	}
+	resp, rerr := newResponse(r.Context(), req, cmp.TypeError, cmp.ErrorMsgContent{
+		PKIStatusInfo: cmp.NewStatusInfo(cmp.StatusRejection, failInfo, err.Error()),
+	})
+	if rerr != nil {
+		fail(w, r, http.StatusInternalServerError, rerr)
+		return
+	}
+	if perr := protect(r.Context(), req, resp, prot); perr != nil {
+		// Send the error unprotected.
+		resp.Header.ProtectionAlg = pkix.AlgorithmIdentifier{}
+		resp.Header.SenderKID = nil
+		resp.Protection = asn1.BitString{}
+		resp.ExtraCerts = nil
+	}
+	b, merr := resp.Marshal()
+	if merr != nil {
+		fail(w, r, http.StatusInternalServerError, merr)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	w.Write(b)
+}
+
+// fail writes an error that cannot be sent in a CMP message.
+func fail(w http.ResponseWriter, r *http.Request, status int, err error) {
+	log.Error(w, r, err)
+	http.Error(w, err.Error(), status)
+}
@@ -0,0 +1,534 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.step.sm/crypto/keyutil"
+	"go.step.sm/crypto/minica"
+
+	"github.com/smallstep/certificates/authority"
+	"github.com/smallstep/certificates/authority/config"
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/cmp"
+)
+
+var (
+	oidPasswordBasedMAC = asn1.ObjectIdentifier{1, 2, 840, 113533, 7, 66, 13}
+	oidSHA256           = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidHMACWithSHA256   = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}
+	oidECDSAWithSHA256  = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}
+	oidImplicitConfirm  = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 4, 13}
+	oidSubjectAltName   = asn1.ObjectIdentifier{2, 5, 29, 17}
+	oidCRLReasonCode    = asn1.ObjectIdentifier{2, 5, 29, 21}
+)
+
+type mockAuthority struct {
+	ca          *minica.CA
+	provisioner provisioner.Interface
+	revoked     map[string]bool
+	revokeOpts  *authority.RevokeOptions
+}
+
+func (m *mockAuthority) LoadProvisionerByName(name string) (provisioner.Interface, error) {
+	if m.provisioner == nil || m.provisioner.GetName() != name {
+		return nil, errors.New("not found")
+	}
+	return m.provisioner, nil
+}
+
+func (m *mockAuthority) GetRootCertificates() []*x509.Certificate {
+	return []*x509.Certificate{m.ca.Root}
+}
+
+func (m *mockAuthority) GetIntermediateCertificates() []*x509.Certificate {
+	return []*x509.Certificate{m.ca.Intermediate}
+}
+
+func (m *mockAuthority) GetX509Signer() (crypto.Signer, error) {
+	return m.ca.Signer, nil
+}
+
+func (m *mockAuthority) SignWithContext(_ context.Context, csr *x509.CertificateRequest, _ provisioner.SignOptions, extraOpts ...provisioner.SignOption) ([]*x509.Certificate, error) {
+	if !slices.ContainsFunc(extraOpts, provisioner.IsProofOfPossessionVerified) {
+		return nil, errors.New("missing proof of possession option")
+	}
+	return m.sign(csr.Subject, csr.DNSNames, csr.PublicKey)
+}
+
+func (m *mockAuthority) sign(subject pkix.Name, dnsNames []string, pub crypto.PublicKey) ([]*x509.Certificate, error) {
+	ext, err := (&provisioner.Extension{Type: provisioner.TypeCMP, Name: m.provisioner.GetName()}).ToExtension()
+	if err != nil {
+		return nil, err
+	}
+	cert, err := m.ca.Sign(&x509.Certificate{
+		Subject:         subject,
+		DNSNames:        dnsNames,
+		PublicKey:       pub,
+		NotBefore:       time.Now().Add(-time.Minute),
+		NotAfter:        time.Now().Add(time.Hour),
+		ExtraExtensions: []pkix.Extension{ext},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return []*x509.Certificate{cert, m.ca.Intermediate}, nil
+}
+
+func (m *mockAuthority) IsRevoked(sn string) (bool, error) {
+	return m.revoked[sn], nil
+}
+
+func (m *mockAuthority) Revoke(ctx context.Context, opts *authority.RevokeOptions) error {
+	if method := provisioner.MethodFromContext(ctx); method != provisioner.RevokeMethod {
+		return errors.New("unexpected method")
+	}
+	m.revokeOpts = opts
+	return nil
+}
+
+func mockMustAuthority(t *testing.T, a Authority) {
+	t.Helper()
+	fn := mustAuthority
+	t.Cleanup(func() {
+		mustAuthority = fn
+	})
+	mustAuthority = func(context.Context) Authority {
+		return a
+	}
+}
+
+func newRouter() http.Handler {
+	r := chi.NewRouter()
+	r.Route("/.well-known/cmp", func(r chi.Router) {
+		Route(r)
+	})
+	return r
+}
+
+func newCMP(t *testing.T, ca *minica.CA) *provisioner.CMP {
+	t.Helper()
+	p := &provisioner.CMP{
+		Type:                   "CMP",
+		Name:                   "cmp",
+		SharedSecret:           "password",
+		ClientCertificates:     true,
+		ClientCertificateRoots: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Root.Raw}),
+	}
+	require.NoError(t, p.Init(provisioner.Config{Claims: config.GlobalProvisionerClaims}))
+	return p
+}
+
+func mustMarshal(t *testing.T, v any, params ...string) []byte {
+	t.Helper()
+	var p string
+	if len(params) > 0 {
+		p = params[0]
+	}
+	b, err := asn1.MarshalWithParams(v, p)
+	require.NoError(t, err)
+	return b
+}
+
+// newCertReqMsg creates a certificate request with a signature proof of
+// possession. The subject and names are optional.
+func newCertReqMsg(t *testing.T, signer crypto.Signer, cn string, dnsNames ...string) cmp.CertReqMsg {
+	t.Helper()
+	spki, err := x509.MarshalPKIXPublicKey(signer.Public())
+	require.NoError(t, err)
+	spki[0] = 0xa6
+	tmpl := cmp.CertTemplate{
+		PublicKey: asn1.RawValue{FullBytes: spki},
+	}
+	if cn != "" {
+		tmpl.Subject = asn1.RawValue{FullBytes: mustMarshal(t, asn1.RawValue{
+			Class:      asn1.ClassContextSpecific,
+			Tag:        5,
+			IsCompound: true,
+			Bytes:      mustMarshal(t, pkix.Name{CommonName: cn}.ToRDNSequence()),
+		})}
+	}
+	if len(dnsNames) > 0 {
+		var sans []asn1.RawValue
+		for _, n := range dnsNames {
+			sans = append(sans, asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 2, Bytes: []byte(n)})
+		}
+		tmpl.Extensions = []pkix.Extension{{Id: oidSubjectAltName, Value: mustMarshal(t, sans)}}
+	}
+
+	certReq := mustMarshal(t, cmp.CertRequest{CertReqID: big.NewInt(0), CertTemplate: tmpl})
+	digest := crypto.SHA256.New()
+	digest.Write(certReq)
+	sig, err := signer.Sign(rand.Reader, digest.Sum(nil), crypto.SHA256)
+	require.NoError(t, err)
+	popo := mustMarshal(t, struct {
+		AlgorithmIdentifier pkix.AlgorithmIdentifier
+		Signature           asn1.BitString
+	}{
+		AlgorithmIdentifier: pkix.AlgorithmIdentifier{Algorithm: oidECDSAWithSHA256},
+		Signature:           asn1.BitString{Bytes: sig, BitLength: len(sig) * 8},
+	}, "tag:1")
+	return cmp.CertReqMsg{
+		CertReq: asn1.RawValue{FullBytes: certReq},
+		POPO:    asn1.RawValue{FullBytes: popo},
+	}
+}
+
+func newMessage(t *testing.T, bodyType int, content any) *cmp.Message {
+	t.Helper()
+	sender, err := cmp.DirectoryName(pkix.Name{CommonName: "client"})
+	require.NoError(t, err)
+	recipient, err := cmp.DirectoryName(pkix.Name{CommonName: "ca"})
+	require.NoError(t, err)
+	return &cmp.Message{
+		Header: cmp.PKIHeader{
+			PVNO:          2,
+			Sender:        sender,
+			Recipient:     recipient,
+			TransactionID: []byte("transaction-id"),
+			SenderNonce:   []byte("sender-nonce"),
+		},
+		Body: asn1.RawValue{
+			Class:      asn1.ClassContextSpecific,
+			Tag:        bodyType,
+			IsCompound: true,
+			Bytes:      mustMarshal(t, content),
+		},
+	}
+}
+
+// protectWithMAC protects a request with a password-based MAC.
+func protectWithMAC(t *testing.T, m *cmp.Message, secret string) *cmp.Message {
+	t.Helper()
+	params := struct {
+		Salt           []byte
+		OWF            pkix.AlgorithmIdentifier
+		IterationCount int
+		MAC            pkix.AlgorithmIdentifier
+	}{
+		Salt:           []byte("salt"),
+		OWF:            pkix.AlgorithmIdentifier{Algorithm: oidSHA256},
+		IterationCount: 500,
+		MAC:            pkix.AlgorithmIdentifier{Algorithm: oidHMACWithSHA256},
+	}
+	template := &cmp.Message{Header: cmp.PKIHeader{
+		SenderKID: []byte("key-id"),
+		ProtectionAlg: pkix.AlgorithmIdentifier{
+			Algorithm:  oidPasswordBasedMAC,
+			Parameters: asn1.RawValue{FullBytes: mustMarshal(t, params)},
+		},
+	}}
+	require.NoError(t, m.ProtectWithMAC(template, []byte(secret)))
+	return m
+}
+
+func post(t *testing.T, name string, m *cmp.Message) *cmp.Message {
+	t.Helper()
+	der, err := m.Marshal()
+	require.NoError(t, err)
+	w := httptest.NewRecorder()
+	newRouter().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/.well-known/cmp/p/"+name, bytes.NewReader(der)))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, contentType, w.Header().Get("Content-Type"))
+	resp, err := cmp.ParseMessage(w.Body.Bytes())
+	require.NoError(t, err)
+	assert.Equal(t, []byte("transaction-id"), resp.Header.TransactionID)
+	assert.Equal(t, []byte("sender-nonce"), resp.Header.RecipNonce)
+	return resp
+}
+
+func certificateFromResponse(t *testing.T, resp *cmp.Message) (*x509.Certificate, *cmp.CertRepMessage) {
+	t.Helper()
+	var content cmp.CertRepMessage
+	require.NoError(t, resp.UnmarshalBody(&content))
+	require.Len(t, content.Response, 1)
+	r := content.Response[0]
+	assert.Equal(t, cmp.StatusAccepted, r.Status.Status)
+	assert.Equal(t, int64(0), r.CertReqID.Int64())
+	cert, err := x509.ParseCertificate(r.CertifiedKeyPair.CertOrEncCert.Bytes)
+	require.NoError(t, err)
+	return cert, &content
+}
+
+func assertError(t *testing.T, resp *cmp.Message, failInfo int) {
+	t.Helper()
+	require.Equal(t, cmp.TypeError, resp.Type())
+	var content cmp.ErrorMsgContent
+	require.NoError(t, resp.UnmarshalBody(&content))
+	assert.Equal(t, cmp.StatusRejection, content.PKIStatusInfo.Status)
+	assert.Equal(t, 1, content.PKIStatusInfo.FailInfo.At(failInfo), "failInfo %d is not set", failInfo)
+}
+
+func newClientCertificate(t *testing.T, a *mockAuthority, cn string) (*x509.Certificate, crypto.Signer) {
+	t.Helper()
+	key, err := keyutil.GenerateDefaultSigner()
+	require.NoError(t, err)
+	chain, err := a.sign(pkix.Name{CommonName: cn}, []string{cn}, key.Public())
+	require.NoError(t, err)
+	return chain[0], key
+}
+
+func TestPost_ir(t *testing.T) {
+	ca, err := minica.New()
+	require.NoError(t, err)
+	mockMustAuthority(t, &mockAuthority{ca: ca, provisioner: newCMP(t, ca)})
+
+	key, err := keyutil.GenerateDefaultSigner()
+	require.NoError(t, err)
+	req := newMessage(t, cmp.TypeIR, []cmp.CertReqMsg{newCertReqMsg(t, key, "device", "device.example.com")})
+	req.Header.GeneralInfo = []cmp.InfoTypeAndValue{{InfoType: oidImplicitConfirm, InfoValue: asn1.NullRawValue}}
+	resp := post(t, "cmp", protectWithMAC(t, req, "password"))
+
+	require.Equal(t, cmp.TypeIP, resp.Type())
+	assert.True(t, resp.ImplicitConfirm())
+	assert.True(t, resp.IsMACProtected())
+	assert.Equal(t, []byte("key-id"), resp.Header.SenderKID)
+	assert.NoError(t, resp.VerifyMAC([]byte("password")))
+
+	cert, content := certificateFromResponse(t, resp)
+	assert.Equal(t, "device", cert.Subject.CommonName)
+	assert.Equal(t, []string{"device.example.com"}, cert.DNSNames)
+	assert.Equal(t, key.Public(), cert.PublicKey)
+	require.Len(t, content.CAPubs, 1)
+	assert.Equal(t, ca.Root.Raw, content.CAPubs[0].FullBytes)
+	assert.Equal(t, []*x509.Certificate{ca.Intermediate}, resp.ExtraCerts)
+}
+
+func TestPost_cr(t *testing.T) {
+	ca, err := minica.New()
+	require.NoError(t, err)
+	a := &mockAuthority{ca: ca, provisioner: newCMP(t, ca)}
+	mockMustAuthority(t, a)
+
+	clientCert, clientKey := newClientCertificate(t, a, "device")
+	key, err := keyutil.GenerateDefaultSigner()
+	require.NoError(t, err)
+	req := newMessage(t, cmp.TypeCR, []cmp.CertReqMsg{newCertReqMsg(t, key, "device")})
+	require.NoError(t, req.ProtectWithSignature(clientKey, []*x509.Certificate{clientCert, ca.Intermediate}))
+	resp := post(t, "cmp", req)
+
+	require.Equal(t, cmp.TypeCP, resp.Type())
+	assert.False(t, resp.ImplicitConfirm())
+	assert.True(t, resp.IsSignatureProtected())
+	assert.Equal(t, []*x509.Certificate{ca.Intermediate}, resp.ExtraCerts)
+	assert.NoError(t, resp.VerifySignature(ca.Intermediate))
+
+	cert, content := certificateFromResponse(t, resp)
+	assert.Equal(t, "device", cert.Subject.CommonName)
+	assert.Empty(t, content.CAPubs)
+
+	// The request can only contain the names in the client certificate.
+	req = newMessage(t, cmp.TypeCR, []cmp.CertReqMsg{newCertReqMsg(t, key, "other")})
+	require.NoError(t, req.ProtectWithSignature(clientKey, []*x509.Certificate{clientCert, ca.Intermediate}))
+	assertError(t, post(t, "cmp", req), cmp.FailNotAuthorized)
+}
+
+func TestPost_kur(t *testing.T) {
+	ca, err := minica.New()
+	require.NoError(t, err)
+	a := &mockAuthority{ca: ca, provisioner: newCMP(t, ca)}
+	mockMustAuthority(t, a)
+
+	oldCert, oldKey := newClientCertificate(t, a, "device.example.com")
+	key, err := keyutil.GenerateDefaultSigner()
+	require.NoError(t, err)
+
+	t.Run("ok", func(t *testing.T) {
+		req := newMessage(t, cmp.TypeKUR, []cmp.CertReqMsg{newCertReqMsg(t, key, "")})
+		require.NoError(t, req.ProtectWithSignature(oldKey, []*x509.Certificate{oldCert}))
+		resp := post(t, "cmp", req)
+		require.Equal(t, cmp.TypeKUP, resp.Type())
+		assert.NoError(t, resp.VerifySignature(ca.Intermediate))
+		cert, _ := certificateFromResponse(t, resp)
+		assert.Equal(t, "device.example.com", cert.Subject.CommonName)
+		assert.Equal(t, []string{"device.example.com"}, cert.DNSNames)
+		assert.Equal(t, key.Public(), cert.PublicKey)
+	})
+
+	t.Run("fail/same key", func(t *testing.T) {
+		req := newMessage(t, cmp.TypeKUR, []cmp.CertReqMsg{newCertReqMsg(t, oldKey, "")})
+		require.NoError(t, req.ProtectWithSignature(oldKey, []*x509.Certificate{oldCert}))
+		assertError(t, post(t, "cmp", req), cmp.FailBadCertTemplate)
+	})
+
+	t.Run("fail/other subject", func(t *testing.T) {
+		req := newMessage(t, cmp.TypeKUR, []cmp.CertReqMsg{newCertReqMsg(t, key, "other")})
+		require.NoError(t, req.ProtectWithSignature(oldKey, []*x509.Certificate{oldCert}))
+		assertError(t, post(t, "cmp", req), cmp.FailNotAuthorized)
+	})
+
+	t.Run("fail/mac", func(t *testing.T) {
+		req := newMessage(t, cmp.TypeKUR, []cmp.CertReqMsg{newCertReqMsg(t, key, "")})
+		resp := post(t, "cmp", protectWithMAC(t, req, "password"))
+		assertError(t, resp, cmp.FailNotAuthorized)
+		// Errors are protected like the request
+		assert.NoError(t, resp.VerifyMAC([]byte("password")))
+	})
+}
+
+func TestPost_rr(t *testing.T) {
+	ca, err := minica.New()
+	require.NoError(t, err)
+	a := &mockAuthority{ca: ca, provisioner: newCMP(t, ca)}
+	mockMustAuthority(t, a)
+
+	cert, key := newClientCertificate(t, a, "device.example.com")
+	newRevDetails := func(serial *big.Int, issuer []byte) []cmp.RevDetails {
+		d := cmp.RevDetails{
+			CertDetails: cmp.CertTemplate{SerialNumber: serial},
+			CRLEntryDetails: []pkix.Extension{
+				{Id: oidCRLReasonCode, Value: mustMarshal(t, asn1.Enumerated(1))},
+			},
+		}
+		if issuer != nil {
+			d.CertDetails.Issuer = asn1.RawValue{FullBytes: mustMarshal(t, asn1.RawValue{
+				Class:      asn1.ClassContextSpecific,
+				Tag:        3,
+				IsCompound: true,
+				Bytes:      issuer,
+			})}
+		}
+		return []cmp.RevDetails{d}
+	}
+
+	t.Run("ok", func(t *testing.T) {
+		req := newMessage(t, cmp.TypeRR, newRevDetails(cert.SerialNumber, cert.RawIssuer))
+		require.NoError(t, req.ProtectWithSignature(key, []*x509.Certificate{cert}))
+		resp := post(t, "cmp", req)
+		require.Equal(t, cmp.TypeRP, resp.Type())
+		assert.NoError(t, resp.VerifySignature(ca.Intermediate))
+
+		var content cmp.RevRepContent
+		require.NoError(t, resp.UnmarshalBody(&content))
+		require.Len(t, content.Status, 1)
+		assert.Equal(t, cmp.StatusAccepted, content.Status[0].Status)
+
+		require.NotNil(t, a.revokeOpts)
+		assert.Equal(t, cert.SerialNumber.String(), a.revokeOpts.Serial)
+		assert.Equal(t, 1, a.revokeOpts.ReasonCode)
+		assert.True(t, a.revokeOpts.MTLS)
+		assert.Equal(t, cert, a.revokeOpts.Crt)
+	})
+
+	t.Run("fail/other serial", func(t *testing.T) {
+		req := newMessage(t, cmp.TypeRR, newRevDetails(big.NewInt(1234), nil))
+		require.NoError(t, req.ProtectWithSignature(key, []*x509.Certificate{cert}))
+		assertError(t, post(t, "cmp", req), cmp.FailNotAuthorized)
+	})
+
+	t.Run("fail/other issuer", func(t *testing.T) {
+		req := newMessage(t, cmp.TypeRR, newRevDetails(cert.SerialNumber, ca.Root.RawSubject))
+		require.NoError(t, req.ProtectWithSignature(key, []*x509.Certificate{cert}))
+		assertError(t, post(t, "cmp", req), cmp.FailBadCertID)
+	})
+
+	t.Run("fail/revoked", func(t *testing.T) {
+		a.revoked = map[string]bool{cert.SerialNumber.String(): true}
+		t.Cleanup(func() { a.revoked = nil })
+		req := newMessage(t, cmp.TypeRR, newRevDetails(cert.SerialNumber, nil))
+		require.NoError(t, req.ProtectWithSignature(key, []*x509.Certificate{cert}))
+		resp := post(t, "cmp", req)
+		assertError(t, resp, cmp.FailCertRevoked)
+		// The request protection was not verified.
+		assert.False(t, resp.IsSignatureProtected())
+		assert.False(t, resp.IsMACProtected())
+	})
+}
+
+func TestPost_certConf(t *testing.T) {
+	ca, err := minica.New()
+	require.NoError(t, err)
+	mockMustAuthority(t, &mockAuthority{ca: ca, provisioner: newCMP(t, ca)})
+
+	req := newMessage(t, cmp.TypeCertConf, []cmp.CertStatus{{CertHash: []byte("hash"), CertReqID: big.NewInt(0)}})
+	resp := post(t, "cmp", protectWithMAC(t, req, "password"))
+	assert.Equal(t, cmp.TypePKIConf, resp.Type())
+	assert.NoError(t, resp.VerifyMAC([]byte("password")))
+}
+
+func TestPost_errors(t *testing.T) {
+	ca, err := minica.New()
+	require.NoError(t, err)
+	a := &mockAuthority{ca: ca, provisioner: newCMP(t, ca)}
+	mockMustAuthority(t, a)
+
+	key, err := keyutil.GenerateDefaultSigner()
+	require.NoError(t, err)
+	otherKey, err := keyutil.GenerateDefaultSigner()
+	require.NoError(t, err)
+	otherCA, err := minica.New()
+	require.NoError(t, err)
+	untrusted, err := otherCA.Sign(&x509.Certificate{Subject: pkix.Name{CommonName: "client"}, PublicKey: key.Public()})
+	require.NoError(t, err)
+
+	t.Run("bad request", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		newRouter().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/.well-known/cmp/p/cmp", bytes.NewReader([]byte("foo"))))
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		der, err := newMessage(t, cmp.TypeCertConf, []cmp.CertStatus{}).Marshal()
+		require.NoError(t, err)
+		w := httptest.NewRecorder()
+		newRouter().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/.well-known/cmp/p/other", bytes.NewReader(der)))
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	tests := []struct {
+		name     string
+		req      func(t *testing.T) *cmp.Message
+		failInfo int
+	}{
+		{"unprotected", func(t *testing.T) *cmp.Message {
+			return newMessage(t, cmp.TypeIR, []cmp.CertReqMsg{newCertReqMsg(t, key, "device")})
+		}, cmp.FailBadMessageCheck},
+		{"wrong secret", func(t *testing.T) *cmp.Message {
+			return protectWithMAC(t, newMessage(t, cmp.TypeIR, []cmp.CertReqMsg{newCertReqMsg(t, key, "device")}), "wrong")
+		}, cmp.FailBadMessageCheck},
+		{"unsupported version", func(t *testing.T) *cmp.Message {
+			m := newMessage(t, cmp.TypeIR, []cmp.CertReqMsg{newCertReqMsg(t, key, "device")})
+			m.Header.PVNO = 1
+			return protectWithMAC(t, m, "password")
+		}, cmp.FailUnsupportedVersion},
+		{"untrusted signer", func(t *testing.T) *cmp.Message {
+			m := newMessage(t, cmp.TypeIR, []cmp.CertReqMsg{newCertReqMsg(t, key, "device")})
+			require.NoError(t, m.ProtectWithSignature(key, []*x509.Certificate{untrusted}))
+			return m
+		}, cmp.FailSignerNotTrusted},
+		{"bad pop", func(t *testing.T) *cmp.Message {
+			msg := newCertReqMsg(t, key, "device")
+			msg.POPO = newCertReqMsg(t, otherKey, "device").POPO
+			return protectWithMAC(t, newMessage(t, cmp.TypeIR, []cmp.CertReqMsg{msg}), "password")
+		}, cmp.FailBadPOP},
+		{"multiple requests", func(t *testing.T) *cmp.Message {
+			msg := newCertReqMsg(t, key, "device")
+			return protectWithMAC(t, newMessage(t, cmp.TypeIR, []cmp.CertReqMsg{msg, msg}), "password")
+		}, cmp.FailBadRequest},
+		{"unsupported message", func(t *testing.T) *cmp.Message {
+			return protectWithMAC(t, newMessage(t, cmp.TypeP10CR, asn1.NullRawValue), "password")
+		}, cmp.FailBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assertError(t, post(t, "cmp", tt.req(t)), tt.failInfo)
+		})
+	}
+}
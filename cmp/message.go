@@ -0,0 +1,505 @@
+// Package cmp implements the messages of the Certificate Management Protocol,
+// CMP, as defined in RFC 4210 and profiled in RFC 9483.
+package cmp
+
+import (
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"net/url"
+	"time"
+)
+
+// Types of the body of a PKIMessage. The type is the tag of the body.
+const (
+	TypeIR       = 0
+	TypeIP       = 1
+	TypeCR       = 2
+	TypeCP       = 3
+	TypeP10CR    = 4
+	TypeKUR      = 7
+	TypeKUP      = 8
+	TypeRR       = 11
+	TypeRP       = 12
+	TypePKIConf  = 19
+	TypeError    = 23
+	TypeCertConf = 24
+)
+
+// PKIStatus values.
+const (
+	StatusAccepted        = 0
+	StatusGrantedWithMods = 1
+	StatusRejection       = 2
+)
+
+// PKIFailureInfo bits.
+const (
+	FailBadAlg              = 0
+	FailBadMessageCheck     = 1
+	FailBadRequest          = 2
+	FailBadCertID           = 4
+	FailBadDataFormat       = 5
+	FailWrongAuthority      = 6
+	FailBadPOP              = 9
+	FailCertRevoked         = 10
+	FailBadCertTemplate     = 19
+	FailSignerNotTrusted    = 20
+	FailUnsupportedVersion  = 22
+	FailNotAuthorized       = 23
+	FailSystemFailure       = 25
+	FailDuplicateCertReq    = 26
+	maxFailureInfoBitLength = 27
+)
+
+// generalNameDirectory is the tag of the directoryName GeneralName.
+const generalNameDirectory = 4
+
+var (
+	oidImplicitConfirm = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 4, 13}
+	oidSubjectAltName  = asn1.ObjectIdentifier{2, 5, 29, 17}
+	oidCRLReasonCode   = asn1.ObjectIdentifier{2, 5, 29, 21}
+)
+
+// PKIHeader is the header of a PKIMessage.
+type PKIHeader struct {
+	PVNO          int
+	Sender        asn1.RawValue
+	Recipient     asn1.RawValue
+	MessageTime   time.Time                `asn1:"generalized,explicit,tag:0,optional"`
+	ProtectionAlg pkix.AlgorithmIdentifier `asn1:"explicit,tag:1,optional"`
+	SenderKID     []byte                   `asn1:"explicit,tag:2,optional"`
+	RecipKID      []byte                   `asn1:"explicit,tag:3,optional"`
+	TransactionID []byte                   `asn1:"explicit,tag:4,optional"`
+	SenderNonce   []byte                   `asn1:"explicit,tag:5,optional"`
+	RecipNonce    []byte                   `asn1:"explicit,tag:6,optional"`
+	FreeText      []asn1.RawValue          `asn1:"explicit,tag:7,optional"`
+	GeneralInfo   []InfoTypeAndValue       `asn1:"explicit,tag:8,optional"`
+}
+
+// InfoTypeAndValue is an item of the generalInfo of a PKIHeader.
+type InfoTypeAndValue struct {
+	InfoType  asn1.ObjectIdentifier
+	InfoValue asn1.RawValue `asn1:"optional"`
+}
+
+// rawPKIMessage is used to parse a PKIMessage keeping the DER encoding of
+// the header and the body, which is the input of the protection.
+type rawPKIMessage struct {
+	Header     asn1.RawValue
+	Body       asn1.RawValue
+	Protection asn1.BitString  `asn1:"explicit,tag:0,optional"`
+	ExtraCerts []asn1.RawValue `asn1:"explicit,tag:1,optional"`
+}
+
+type protectedPart struct {
+	Header asn1.RawValue
+	Body   asn1.RawValue
+}
+
+// Message is a PKIMessage.
+type Message struct {
+	Header     PKIHeader
+	Body       asn1.RawValue
+	Protection asn1.BitString
+	ExtraCerts []*x509.Certificate
+	rawHeader  []byte
+}
+
+// ParseMessage parses a DER encoded PKIMessage.
+func ParseMessage(der []byte) (*Message, error) {
+	var raw rawPKIMessage
+	rest, err := asn1.Unmarshal(der, &raw)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing PKIMessage: %w", err)
+	}
+	if len(rest) > 0 {
+		return nil, errors.New("error parsing PKIMessage: trailing data")
+	}
+	if raw.Body.Class != asn1.ClassContextSpecific || !raw.Body.IsCompound {
+		return nil, errors.New("error parsing PKIMessage: invalid body")
+	}
+
+	m := &Message{
+		Body:       raw.Body,
+		Protection: raw.Protection,
+		rawHeader:  raw.Header.FullBytes,
+	}
+	if _, err := asn1.Unmarshal(raw.Header.FullBytes, &m.Header); err != nil {
+		return nil, fmt.Errorf("error parsing PKIHeader: %w", err)
+	}
+	for _, c := range raw.ExtraCerts {
+		cert, err := x509.ParseCertificate(c.FullBytes)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing extraCerts: %w", err)
+		}
+		m.ExtraCerts = append(m.ExtraCerts, cert)
+	}
+	return m, nil
+}
+
+// Type returns the type of the message body.
+func (m *Message) Type() int {
+	return m.Body.Tag
+}
+
+// ImplicitConfirm returns true if the header contains the implicitConfirm
+// general info.
+func (m *Message) ImplicitConfirm() bool {
+	for _, v := range m.Header.GeneralInfo {
+		if v.InfoType.Equal(oidImplicitConfirm) {
+			return true
+		}
+	}
+	return false
+}
+
+// UnmarshalBody parses the body content into v.
+func (m *Message) UnmarshalBody(v any) error {
+	rest, err := asn1.Unmarshal(m.Body.Bytes, v)
+	if err != nil {
+		return fmt.Errorf("error parsing PKIBody: %w", err)
+	}
+	if len(rest) > 0 {
+		return errors.New("error parsing PKIBody: trailing data")
+	}
+	return nil
+}
+
+// protectedPart returns the DER encoding of the ProtectedPart of the message.
+func (m *Message) protectedPart() ([]byte, error) {
+	header := m.rawHeader
+	if header == nil {
+		var err error
+		if header, err = asn1.Marshal(m.Header); err != nil {
+			return nil, fmt.Errorf("error marshaling PKIHeader: %w", err)
+		}
+	}
+	return asn1.Marshal(protectedPart{
+		Header: asn1.RawValue{FullBytes: header},
+		Body:   m.Body,
+	})
+}
+
+// Marshal returns the DER encoding of the message.
+func (m *Message) Marshal() ([]byte, error) {
+	header := m.rawHeader
+	if header == nil {
+		var err error
+		if header, err = asn1.Marshal(m.Header); err != nil {
+			return nil, fmt.Errorf("error marshaling PKIHeader: %w", err)
+		}
+	}
+	raw := rawPKIMessage{
+		Header:     asn1.RawValue{FullBytes: header},
+		Body:       m.Body,
+		Protection: m.Protection,
+	}
+	for _, c := range m.ExtraCerts {
+		raw.ExtraCerts = append(raw.ExtraCerts, asn1.RawValue{FullBytes: c.Raw})
+	}
+	return asn1.Marshal(raw)
+}
+
+// NewResponse creates a response to the given request with the given body.
+// The sender is the name of the CA. The response must be protected before
+// marshaling it.
+func NewResponse(req *Message, sender pkix.Name, bodyType int, content any) (*Message, error) {
+	body, err := asn1.Marshal(content)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling PKIBody: %w", err)
+	}
+	senderNonce := make([]byte, 16)
+	if _, err := rand.Read(senderNonce); err != nil {
+		return nil, fmt.Errorf("error generating nonce: %w", err)
+	}
+	directoryName, err := DirectoryName(sender)
+	if err != nil {
+		return nil, err
+	}
+
+	pvno := 2
+	if req.Header.PVNO == 3 {
+		pvno = 3
+	}
+	h := PKIHeader{
+		PVNO:          pvno,
+		Sender:        directoryName,
+		Recipient:     req.Header.Sender,
+		MessageTime:   time.Now().UTC().Truncate(time.Second),
+		TransactionID: req.Header.TransactionID,
+		SenderNonce:   senderNonce,
+		RecipNonce:    req.Header.SenderNonce,
+	}
+	if req.ImplicitConfirm() && (bodyType == TypeIP || bodyType == TypeCP || bodyType == TypeKUP) {
+		h.GeneralInfo = []InfoTypeAndValue{{InfoType: oidImplicitConfirm, InfoValue: asn1.NullRawValue}}
+	}
+
+	return &Message{
+		Header: h,
+		Body: asn1.RawValue{
+			Class:      asn1.ClassContextSpecific,
+			Tag:        bodyType,
+			IsCompound: true,
+			Bytes:      body,
+		},
+	}, nil
+}
+
+// DirectoryName returns a GeneralName with the given name.
+func DirectoryName(name pkix.Name) (asn1.RawValue, error) {
+	b, err := asn1.Marshal(name.ToRDNSequence())
+	if err != nil {
+		return asn1.RawValue{}, fmt.Errorf("error marshaling name: %w", err)
+	}
+	return asn1.RawValue{
+		Class:      asn1.ClassContextSpecific,
+		Tag:        generalNameDirectory,
+		IsCompound: true,
+		Bytes:      b,
+	}, nil
+}
+
+// SupportedVersion returns true if the protocol version of the message is
+// supported.
+func (m *Message) SupportedVersion() bool {
+	return m.Header.PVNO == 2 || m.Header.PVNO == 3
+}
+
+// PKIStatusInfo is the status of a response.
+type PKIStatusInfo struct {
+	Status       int
+	StatusString []asn1.RawValue `asn1:"optional"`
+	FailInfo     asn1.BitString  `asn1:"optional"`
+}
+
+// NewStatusInfo returns a PKIStatusInfo with the given status. If failInfo
+// is not negative, the failure bit is set.
+func NewStatusInfo(status, failInfo int, text string) PKIStatusInfo {
+	s := PKIStatusInfo{Status: status}
+	if text != "" {
+		s.StatusString = []asn1.RawValue{{Tag: asn1.TagUTF8String, Bytes: []byte(text)}}
+	}
+	if failInfo >= 0 && failInfo < maxFailureInfoBitLength {
+		b := make([]byte, failInfo/8+1)
+		b[failInfo/8] = 0x80 >> (failInfo % 8)
+		s.FailInfo = asn1.BitString{Bytes: b, BitLength: failInfo + 1}
+	}
+	return s
+}
+
+// ErrorMsgContent is the content of an error message.
+type ErrorMsgContent struct {
+	PKIStatusInfo PKIStatusInfo
+	ErrorCode     int             `asn1:"optional"`
+	ErrorDetails  []asn1.RawValue `asn1:"optional"`
+}
+
+// CertReqMsg is a certificate request message (RFC 4211).
+type CertReqMsg struct {
+	CertReq asn1.RawValue
+	POPO    asn1.RawValue `asn1:"optional"`
+	RegInfo asn1.RawValue `asn1:"optional"`
+}
+
+// CertRequest is a certificate request (RFC 4211).
+type CertRequest struct {
+	CertReqID    *big.Int
+	CertTemplate CertTemplate
+	Controls     asn1.RawValue `asn1:"optional"`
+}
+
+// CertTemplate contains the fields of the requested certificate (RFC 4211).
+// The tags are implicit, except the ones of CHOICE types. The raw values of
+// explicitly tagged fields include the tag, the content is in Bytes.
+type CertTemplate struct {
+	Version      int                      `asn1:"optional,tag:0"`
+	SerialNumber *big.Int                 `asn1:"optional,tag:1"`
+	SigningAlg   pkix.AlgorithmIdentifier `asn1:"optional,tag:2"`
+	Issuer       asn1.RawValue            `asn1:"optional,explicit,tag:3"`
+	Validity     OptionalValidity         `asn1:"optional,tag:4"`
+	Subject      asn1.RawValue            `asn1:"optional,explicit,tag:5"`
+	PublicKey    asn1.RawValue            `asn1:"optional,tag:6"`
+	IssuerUID    asn1.BitString           `asn1:"optional,tag:7"`
+	SubjectUID   asn1.BitString           `asn1:"optional,tag:8"`
+	Extensions   []pkix.Extension         `asn1:"optional,tag:9"`
+}
+
+// OptionalValidity is the requested validity of a CertTemplate.
+type OptionalValidity struct {
+	NotBefore asn1.RawValue `asn1:"optional,explicit,tag:0"`
+	NotAfter  asn1.RawValue `asn1:"optional,explicit,tag:1"`
+}
+
+// ValidityPeriod returns the requested validity period, the times are zero
+// if they are not present.
+func (t *CertTemplate) ValidityPeriod() (notBefore, notAfter time.Time, err error) {
+	// The explicit tags are kept in the raw values, the times are in Bytes.
+	if len(t.Validity.NotBefore.Bytes) > 0 {
+		if _, err = asn1.Unmarshal(t.Validity.NotBefore.Bytes, &notBefore); err != nil {
+			return
+		}
+	}
+	if len(t.Validity.NotAfter.Bytes) > 0 {
+		_, err = asn1.Unmarshal(t.Validity.NotAfter.Bytes, &notAfter)
+	}
+	return
+}
+
+// HasSubject returns true if the template contains a subject.
+func (t *CertTemplate) HasSubject() bool {
+	return len(t.Subject.FullBytes) > 0
+}
+
+// CertificateRequest returns an unsigned certificate request with the
+// subject, public key and extensions of the template.
+func (t *CertTemplate) CertificateRequest() (*x509.CertificateRequest, error) {
+	if len(t.PublicKey.FullBytes) == 0 {
+		return nil, errors.New("certificate template does not contain a public key")
+	}
+	// Replace the implicit tag with the SEQUENCE one.
+	spki := append([]byte{}, t.PublicKey.FullBytes...)
+	spki[0] = 0x30
+	pub, err := x509.ParsePKIXPublicKey(spki)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing public key: %w", err)
+	}
+
+	csr := &x509.CertificateRequest{
+		PublicKey:  pub,
+		Extensions: t.Extensions,
+	}
+	if csr.PublicKeyAlgorithm, err = publicKeyAlgorithm(pub); err != nil {
+		return nil, err
+	}
+	if t.HasSubject() {
+		var rdn pkix.RDNSequence
+		if _, err := asn1.Unmarshal(t.Subject.Bytes, &rdn); err != nil {
+			return nil, fmt.Errorf("error parsing subject: %w", err)
+		}
+		csr.Subject.FillFromRDNSequence(&rdn)
+		csr.RawSubject = t.Subject.Bytes
+	}
+	for _, ext := range t.Extensions {
+		if ext.Id.Equal(oidSubjectAltName) {
+			if err := parseSubjectAltNames(ext.Value, csr); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return csr, nil
+}
+
+// parseSubjectAltNames parses the GeneralNames in a subject alternative name
+// extension.
+func parseSubjectAltNames(der []byte, csr *x509.CertificateRequest) error {
+	var names []asn1.RawValue
+	if _, err := asn1.Unmarshal(der, &names); err != nil {
+		return fmt.Errorf("error parsing subject alternative names: %w", err)
+	}
+	for _, n := range names {
+		if n.Class != asn1.ClassContextSpecific {
+			continue
+		}
+		switch n.Tag {
+		case 1:
+			csr.EmailAddresses = append(csr.EmailAddresses, string(n.Bytes))
+		case 2:
+			csr.DNSNames = append(csr.DNSNames, string(n.Bytes))
+		case 6:
+			u, err := url.Parse(string(n.Bytes))
+			if err != nil {
+				return fmt.Errorf("error parsing uri %q: %w", n.Bytes, err)
+			}
+			csr.URIs = append(csr.URIs, u)
+		case 7:
+			if len(n.Bytes) != net.IPv4len && len(n.Bytes) != net.IPv6len {
+				return errors.New("error parsing subject alternative names: invalid ip address")
+			}
+			csr.IPAddresses = append(csr.IPAddresses, net.IP(n.Bytes))
+		}
+	}
+	return nil
+}
+
+// CertRepMessage is the content of ip, cp and kup messages.
+type CertRepMessage struct {
+	CAPubs   []asn1.RawValue `asn1:"explicit,tag:1,optional"`
+	Response []CertResponse
+}
+
+// CertResponse is the response to a certificate request.
+type CertResponse struct {
+	CertReqID        *big.Int
+	Status           PKIStatusInfo
+	CertifiedKeyPair CertifiedKeyPair `asn1:"optional"`
+}
+
+// CertifiedKeyPair contains the issued certificate.
+type CertifiedKeyPair struct {
+	CertOrEncCert asn1.RawValue
+}
+
+// NewCertResponse returns an accepted CertResponse with the given
+// certificate.
+func NewCertResponse(certReqID *big.Int, cert *x509.Certificate) CertResponse {
+	return CertResponse{
+		CertReqID: certReqID,
+		Status:    NewStatusInfo(StatusAccepted, -1, ""),
+		CertifiedKeyPair: CertifiedKeyPair{
+			CertOrEncCert: asn1.RawValue{
+				Class:      asn1.ClassContextSpecific,
+				Tag:        0,
+				IsCompound: true,
+				Bytes:      cert.Raw,
+			},
+		},
+	}
+}
+
+// RawCertificates returns the certificates as a list of raw values.
+func RawCertificates(certs []*x509.Certificate) []asn1.RawValue {
+	ret := make([]asn1.RawValue, len(certs))
+	for i, c := range certs {
+		ret[i] = asn1.RawValue{FullBytes: c.Raw}
+	}
+	return ret
+}
+
+// RevDetails is a revocation request.
+type RevDetails struct {
+	CertDetails     CertTemplate
+	CRLEntryDetails []pkix.Extension `asn1:"optional"`
+}
+
+// ReasonCode returns the CRL reason code in the revocation request, or 0
+// (unspecified) if it is not present.
+func (r *RevDetails) ReasonCode() (int, error) {
+	for _, ext := range r.CRLEntryDetails {
+		if ext.Id.Equal(oidCRLReasonCode) {
+			var code asn1.Enumerated
+			if _, err := asn1.Unmarshal(ext.Value, &code); err != nil {
+				return 0, fmt.Errorf("error parsing reason code: %w", err)
+			}
+			return int(code), nil
+		}
+	}
+	return 0, nil
+}
+
+// RevRepContent is the content of rp messages.
+type RevRepContent struct {
+	Status []PKIStatusInfo
+}
+
+// CertStatus is an item of a certConf message.
+type CertStatus struct {
+	CertHash   []byte
+	CertReqID  *big.Int
+	StatusInfo PKIStatusInfo `asn1:"optional"`
+}
@@ -0,0 +1,252 @@
+package cmp
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"net"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func mustMarshal(t *testing.T, v any, params ...string) []byte {
+	t.Helper()
+	var p string
+	if len(params) > 0 {
+		p = params[0]
+	}
+	b, err := asn1.MarshalWithParams(v, p)
+	require.NoError(t, err)
+	return b
+}
+
+// explicit returns a raw value with the given explicit tag.
+func explicit(t *testing.T, tag int, der []byte) asn1.RawValue {
+	t.Helper()
+	return asn1.RawValue{FullBytes: mustMarshal(t, asn1.RawValue{
+		Class:      asn1.ClassContextSpecific,
+		Tag:        tag,
+		IsCompound: true,
+		Bytes:      der,
+	})}
+}
+
+func newTestTemplate(t *testing.T, pub crypto.PublicKey, subject *pkix.Name, sans ...asn1.RawValue) CertTemplate {
+	t.Helper()
+	spki, err := x509.MarshalPKIXPublicKey(pub)
+	require.NoError(t, err)
+	spki[0] = 0xa6 // [6] IMPLICIT SubjectPublicKeyInfo
+	tmpl := CertTemplate{
+		PublicKey: asn1.RawValue{FullBytes: spki},
+	}
+	if subject != nil {
+		tmpl.Subject = explicit(t, 5, mustMarshal(t, subject.ToRDNSequence()))
+	}
+	if len(sans) > 0 {
+		tmpl.Extensions = []pkix.Extension{{Id: oidSubjectAltName, Value: mustMarshal(t, sans)}}
+	}
+	return tmpl
+}
+
+func newTestCertReqMsg(t *testing.T, signer crypto.Signer, tmpl CertTemplate) CertReqMsg {
+	t.Helper()
+	certReq := mustMarshal(t, CertRequest{CertReqID: big.NewInt(0), CertTemplate: tmpl})
+	alg, h, err := signatureAlgorithmFor(signer.Public())
+	require.NoError(t, err)
+	digest := certReq
+	if h != 0 {
+		hh := h.New()
+		hh.Write(certReq)
+		digest = hh.Sum(nil)
+	}
+	sig, err := signer.Sign(rand.Reader, digest, h)
+	require.NoError(t, err)
+	popo := mustMarshal(t, popoSigningKey{
+		AlgorithmIdentifier: pkix.AlgorithmIdentifier{Algorithm: alg},
+		Signature:           asn1.BitString{Bytes: sig, BitLength: len(sig) * 8},
+	}, "tag:1")
+	return CertReqMsg{
+		CertReq: asn1.RawValue{FullBytes: certReq},
+		POPO:    asn1.RawValue{FullBytes: popo},
+	}
+}
+
+func newTestMessage(t *testing.T, bodyType int, content any, generalInfo ...InfoTypeAndValue) *Message {
+	t.Helper()
+	sender, err := DirectoryName(pkix.Name{CommonName: "client"})
+	require.NoError(t, err)
+	recipient, err := DirectoryName(pkix.Name{CommonName: "ca"})
+	require.NoError(t, err)
+	return &Message{
+		Header: PKIHeader{
+			PVNO:          2,
+			Sender:        sender,
+			Recipient:     recipient,
+			TransactionID: []byte("transaction-id"),
+			SenderNonce:   []byte("sender-nonce"),
+			GeneralInfo:   generalInfo,
+		},
+		Body: asn1.RawValue{
+			Class:      asn1.ClassContextSpecific,
+			Tag:        bodyType,
+			IsCompound: true,
+			Bytes:      mustMarshal(t, content),
+		},
+	}
+}
+
+func TestParseMessage(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	msg := newTestCertReqMsg(t, key, newTestTemplate(t, key.Public(), &pkix.Name{CommonName: "test"}))
+	m := newTestMessage(t, TypeIR, []CertReqMsg{msg}, InfoTypeAndValue{InfoType: oidImplicitConfirm, InfoValue: asn1.NullRawValue})
+	der, err := m.Marshal()
+	require.NoError(t, err)
+
+	got, err := ParseMessage(der)
+	require.NoError(t, err)
+	assert.Equal(t, TypeIR, got.Type())
+	assert.True(t, got.SupportedVersion())
+	assert.True(t, got.ImplicitConfirm())
+	assert.Equal(t, []byte("transaction-id"), got.Header.TransactionID)
+	var msgs []CertReqMsg
+	require.NoError(t, got.UnmarshalBody(&msgs))
+	require.Len(t, msgs, 1)
+	assert.Equal(t, msg.CertReq.FullBytes, msgs[0].CertReq.FullBytes)
+	assert.NoError(t, msgs[0].VerifyProofOfPossession(key.Public()))
+
+	_, err = ParseMessage(append(der, 0))
+	assert.Error(t, err)
+	_, err = ParseMessage([]byte("foo"))
+	assert.Error(t, err)
+}
+
+func TestNewResponse(t *testing.T) {
+	req := newTestMessage(t, TypeIR, asn1.NullRawValue, InfoTypeAndValue{InfoType: oidImplicitConfirm, InfoValue: asn1.NullRawValue})
+	resp, err := NewResponse(req, pkix.Name{CommonName: "ca"}, TypeIP, CertRepMessage{})
+	require.NoError(t, err)
+	assert.Equal(t, TypeIP, resp.Type())
+	assert.Equal(t, 2, resp.Header.PVNO)
+	assert.Equal(t, req.Header.Sender, resp.Header.Recipient)
+	assert.Equal(t, req.Header.TransactionID, resp.Header.TransactionID)
+	assert.Equal(t, req.Header.SenderNonce, resp.Header.RecipNonce)
+	assert.Len(t, resp.Header.SenderNonce, 16)
+	assert.True(t, resp.ImplicitConfirm())
+
+	// implicitConfirm is only sent in certificate responses
+	resp, err = NewResponse(req, pkix.Name{CommonName: "ca"}, TypeError, ErrorMsgContent{
+		PKIStatusInfo: NewStatusInfo(StatusRejection, FailBadRequest, "bad request"),
+	})
+	require.NoError(t, err)
+	assert.False(t, resp.ImplicitConfirm())
+}
+
+func TestNewStatusInfo(t *testing.T) {
+	s := NewStatusInfo(StatusAccepted, -1, "")
+	assert.Equal(t, PKIStatusInfo{Status: StatusAccepted}, s)
+
+	s = NewStatusInfo(StatusRejection, FailBadPOP, "bad pop")
+	assert.Equal(t, StatusRejection, s.Status)
+	assert.Equal(t, 10, s.FailInfo.BitLength)
+	assert.Equal(t, 1, s.FailInfo.At(FailBadPOP))
+	for i := 0; i < FailBadPOP; i++ {
+		assert.Equal(t, 0, s.FailInfo.At(i))
+	}
+	require.Len(t, s.StatusString, 1)
+	assert.Equal(t, []byte("bad pop"), s.StatusString[0].Bytes)
+}
+
+func TestCertTemplate_CertificateRequest(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	subject := &pkix.Name{CommonName: "test", Organization: []string{"Smallstep"}}
+	sans := []asn1.RawValue{
+		{Class: asn1.ClassContextSpecific, Tag: 1, Bytes: []byte("jane@example.com")},
+		{Class: asn1.ClassContextSpecific, Tag: 2, Bytes: []byte("test.example.com")},
+		{Class: asn1.ClassContextSpecific, Tag: 6, Bytes: []byte("spiffe://example.com/test")},
+		{Class: asn1.ClassContextSpecific, Tag: 7, Bytes: net.IPv4(127, 0, 0, 1).To4()},
+	}
+
+	t.Run("ok", func(t *testing.T) {
+		tmpl := newTestTemplate(t, key.Public(), subject, sans...)
+		notBefore := time.Now().UTC().Truncate(time.Second)
+		notAfter := notBefore.Add(time.Hour)
+		tmpl.Validity = OptionalValidity{
+			NotBefore: explicit(t, 0, mustMarshal(t, notBefore)),
+			NotAfter:  explicit(t, 1, mustMarshal(t, notAfter)),
+		}
+
+		// Round trip the template.
+		var cr CertRequest
+		_, err := asn1.Unmarshal(mustMarshal(t, CertRequest{CertReqID: big.NewInt(0), CertTemplate: tmpl}), &cr)
+		require.NoError(t, err)
+		tmpl = cr.CertTemplate
+
+		assert.True(t, tmpl.HasSubject())
+		nb, na, err := tmpl.ValidityPeriod()
+		require.NoError(t, err)
+		assert.Equal(t, notBefore, nb)
+		assert.Equal(t, notAfter, na)
+
+		csr, err := tmpl.CertificateRequest()
+		require.NoError(t, err)
+		assert.Equal(t, key.Public(), csr.PublicKey)
+		assert.Equal(t, x509.ECDSA, csr.PublicKeyAlgorithm)
+		assert.Equal(t, "test", csr.Subject.CommonName)
+		assert.Equal(t, []string{"Smallstep"}, csr.Subject.Organization)
+		assert.Equal(t, mustMarshal(t, subject.ToRDNSequence()), csr.RawSubject)
+		assert.Equal(t, []string{"jane@example.com"}, csr.EmailAddresses)
+		assert.Equal(t, []string{"test.example.com"}, csr.DNSNames)
+		assert.Equal(t, []*url.URL{{Scheme: "spiffe", Host: "example.com", Path: "/test"}}, csr.URIs)
+		assert.Equal(t, []net.IP{net.IPv4(127, 0, 0, 1).To4()}, csr.IPAddresses)
+	})
+
+	t.Run("ok/no subject", func(t *testing.T) {
+		tmpl := newTestTemplate(t, key.Public(), nil)
+		assert.False(t, tmpl.HasSubject())
+		nb, na, err := tmpl.ValidityPeriod()
+		require.NoError(t, err)
+		assert.True(t, nb.IsZero())
+		assert.True(t, na.IsZero())
+		csr, err := tmpl.CertificateRequest()
+		require.NoError(t, err)
+		assert.Equal(t, pkix.Name{}, csr.Subject)
+	})
+
+	t.Run("fail/no public key", func(t *testing.T) {
+		tmpl := CertTemplate{}
+		_, err := tmpl.CertificateRequest()
+		assert.Error(t, err)
+	})
+
+	t.Run("fail/bad ip", func(t *testing.T) {
+		tmpl := newTestTemplate(t, key.Public(), nil, asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 7, Bytes: []byte{1, 2, 3}})
+		_, err := tmpl.CertificateRequest()
+		assert.Error(t, err)
+	})
+}
+
+func TestRevDetails_ReasonCode(t *testing.T) {
+	r := RevDetails{}
+	code, err := r.ReasonCode()
+	require.NoError(t, err)
+	assert.Equal(t, 0, code)
+
+	r.CRLEntryDetails = []pkix.Extension{{Id: oidCRLReasonCode, Value: mustMarshal(t, asn1.Enumerated(1))}}
+	code, err = r.ReasonCode()
+	require.NoError(t, err)
+	assert.Equal(t, 1, code)
+
+	r.CRLEntryDetails = []pkix.Extension{{Id: oidCRLReasonCode, Value: []byte("foo")}}
+	_, err = r.ReasonCode()
+	assert.Error(t, err)
+}
@@ -0,0 +1,410 @@
+package cmp
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"hash"
+	"slices"
+)
+
+// Limits of the iteration count of the password-based MAC. Higher values are
+// rejected to avoid spending too much time on unauthenticated requests.
+const (
+	minPBMIterationCount     = 100
+	maxPBMIterationCount     = 100000
+	defaultPBMIterationCount = 1000
+	pbmSaltSize              = 16
+)
+
+var (
+	oidPasswordBasedMAC = asn1.ObjectIdentifier{1, 2, 840, 113533, 7, 66, 13}
+
+	oidSHA1   = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}
+	oidSHA256 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidSHA384 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 2}
+	oidSHA512 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}
+
+	oidHMACWithSHA1   = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 8, 1, 2}
+	oidHMACWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}
+	oidHMACWithSHA384 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 10}
+	oidHMACWithSHA512 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 11}
+
+	oidSHA256WithRSA   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 11}
+	oidSHA384WithRSA   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 12}
+	oidSHA512WithRSA   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 13}
+	oidECDSAWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}
+	oidECDSAWithSHA384 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 3}
+	oidECDSAWithSHA512 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 4}
+	oidEd25519         = asn1.ObjectIdentifier{1, 3, 101, 112}
+)
+
+// ErrBadMessageCheck is the error returned when the protection of a message
+// cannot be verified.
+var ErrBadMessageCheck = errors.New("message protection is not valid")
+
+type hashAlgorithm struct {
+	oid  asn1.ObjectIdentifier
+	hash crypto.Hash
+}
+
+var owfAlgorithms = []hashAlgorithm{
+	{oidSHA1, crypto.SHA1},
+	{oidSHA256, crypto.SHA256},
+	{oidSHA384, crypto.SHA384},
+	{oidSHA512, crypto.SHA512},
+}
+
+var macAlgorithms = []hashAlgorithm{
+	{oidHMACWithSHA1, crypto.SHA1},
+	{oidHMACWithSHA256, crypto.SHA256},
+	{oidHMACWithSHA384, crypto.SHA384},
+	{oidHMACWithSHA512, crypto.SHA512},
+}
+
+type signatureAlgorithm struct {
+	oid     asn1.ObjectIdentifier
+	keyType x509.PublicKeyAlgorithm
+	hash    crypto.Hash
+}
+
+var signatureAlgorithms = []signatureAlgorithm{
+	{oidSHA256WithRSA, x509.RSA, crypto.SHA256},
+	{oidSHA384WithRSA, x509.RSA, crypto.SHA384},
+	{oidSHA512WithRSA, x509.RSA, crypto.SHA512},
+	{oidECDSAWithSHA256, x509.ECDSA, crypto.SHA256},
+	{oidECDSAWithSHA384, x509.ECDSA, crypto.SHA384},
+	{oidECDSAWithSHA512, x509.ECDSA, crypto.SHA512},
+	{oidEd25519, x509.Ed25519, crypto.Hash(0)},
+}
+
+func findHash(algs []hashAlgorithm, oid asn1.ObjectIdentifier) (crypto.Hash, bool) {
+	for _, a := range algs {
+		if a.oid.Equal(oid) {
+			return a.hash, true
+		}
+	}
+	return 0, false
+}
+
+// pbmParameter are the parameters of the password-based MAC (RFC 4211).
+type pbmParameter struct {
+	Salt           []byte
+	OWF            pkix.AlgorithmIdentifier
+	IterationCount int
+	MAC            pkix.AlgorithmIdentifier
+}
+
+// IsMACProtected returns true if the message is protected with a
+// password-based MAC.
+func (m *Message) IsMACProtected() bool {
+	return m.Header.ProtectionAlg.Algorithm.Equal(oidPasswordBasedMAC)
+}
+
+// IsSignatureProtected returns true if the message is protected with a
+// signature.
+func (m *Message) IsSignatureProtected() bool {
+	alg := m.Header.ProtectionAlg.Algorithm
+	return len(alg) > 0 && !alg.Equal(oidPasswordBasedMAC)
+}
+
+// VerifyMAC verifies the password-based MAC of the message using the given
+// shared secret.
+func (m *Message) VerifyMAC(secret []byte) error {
+	if !m.IsMACProtected() {
+		return fmt.Errorf("%w: message is not protected with a password-based mac", ErrBadMessageCheck)
+	}
+	var params pbmParameter
+	if _, err := asn1.Unmarshal(m.Header.ProtectionAlg.Parameters.FullBytes, &params); err != nil {
+		return fmt.Errorf("%w: error parsing password-based mac parameters: %w", ErrBadMessageCheck, err)
+	}
+	if params.IterationCount < minPBMIterationCount || params.IterationCount > maxPBMIterationCount {
+		return fmt.Errorf("%w: password-based mac iteration count %d is not allowed", ErrBadMessageCheck, params.IterationCount)
+	}
+	owf, ok := findHash(owfAlgorithms, params.OWF.Algorithm)
+	if !ok {
+		return fmt.Errorf("%w: unsupported password-based mac owf %s", ErrBadMessageCheck, params.OWF.Algorithm)
+	}
+	mac, ok := findHash(macAlgorithms, params.MAC.Algorithm)
+	if !ok {
+		return fmt.Errorf("%w: unsupported password-based mac algorithm %s", ErrBadMessageCheck, params.MAC.Algorithm)
+	}
+
+	data, err := m.protectedPart()
+	if err != nil {
+		return err
+	}
+	expected := computePBM(secret, params.Salt, owf, params.IterationCount, mac, data)
+	if !hmac.Equal(expected, m.Protection.RightAlign()) {
+		return fmt.Errorf("%w: invalid password-based mac", ErrBadMessageCheck)
+	}
+	return nil
+}
+
+// computePBM computes the password-based MAC defined in RFC 4211, section
+// 4.4.
+func computePBM(secret, salt []byte, owf crypto.Hash, iterationCount int, mac crypto.Hash, data []byte) []byte {
+	h := owf.New()
+	h.Write(secret)
+	h.Write(salt)
+	key := h.Sum(nil)
+	for i := 1; i < iterationCount; i++ {
+		h.Reset()
+		h.Write(key)
+		key = h.Sum(nil)
+	}
+	mh := hmac.New(func() hash.Hash { return mac.New() }, key)
+	mh.Write(data)
+	return mh.Sum(nil)
+}
+
+// ProtectWithMAC protects the message with a password-based MAC using the
+// given shared secret and the same algorithms as the given request.
+func (m *Message) ProtectWithMAC(req *Message, secret []byte) error {
+	var params pbmParameter
+	if _, err := asn1.Unmarshal(req.Header.ProtectionAlg.Parameters.FullBytes, &params); err != nil {
+		return fmt.Errorf("error parsing password-based mac parameters: %w", err)
+	}
+	owf, ok := findHash(owfAlgorithms, params.OWF.Algorithm)
+	if !ok {
+		owf, params.OWF = crypto.SHA256, pkix.AlgorithmIdentifier{Algorithm: oidSHA256}
+	}
+	mac, ok := findHash(macAlgorithms, params.MAC.Algorithm)
+	if !ok {
+		mac, params.MAC = crypto.SHA256, pkix.AlgorithmIdentifier{Algorithm: oidHMACWithSHA256}
+	}
+	if params.IterationCount < minPBMIterationCount || params.IterationCount > maxPBMIterationCount {
+		params.IterationCount = defaultPBMIterationCount
+	}
+	params.Salt = make([]byte, pbmSaltSize)
+	if _, err := rand.Read(params.Salt); err != nil {
+		return fmt.Errorf("error generating salt: %w", err)
+	}
+
+	b, err := asn1.Marshal(params)
+	if err != nil {
+		return fmt.Errorf("error marshaling password-based mac parameters: %w", err)
+	}
+	m.Header.ProtectionAlg = pkix.AlgorithmIdentifier{
+		Algorithm:  oidPasswordBasedMAC,
+		Parameters: asn1.RawValue{FullBytes: b},
+	}
+	m.Header.SenderKID = req.Header.SenderKID
+	m.rawHeader = nil
+
+	data, err := m.protectedPart()
+	if err != nil {
+		return err
+	}
+	sum := computePBM(secret, params.Salt, owf, params.IterationCount, mac, data)
+	m.Protection = asn1.BitString{Bytes: sum, BitLength: len(sum) * 8}
+	return nil
+}
+
+// ProtectionCertificate returns the certificate used to sign the message, the
+// first one in the extraCerts.
+func (m *Message) ProtectionCertificate() (*x509.Certificate, error) {
+	if len(m.ExtraCerts) == 0 {
+		return nil, fmt.Errorf("%w: message does not contain the protection certificate", ErrBadMessageCheck)
+	}
+	return m.ExtraCerts[0], nil
+}
+
+// VerifySignature verifies the signature of the message with the given
+// certificate.
+func (m *Message) VerifySignature(cert *x509.Certificate) error {
+	data, err := m.protectedPart()
+	if err != nil {
+		return err
+	}
+	if err := verifySignature(cert.PublicKey, m.Header.ProtectionAlg.Algorithm, data, m.Protection.RightAlign()); err != nil {
+		return fmt.Errorf("%w: %w", ErrBadMessageCheck, err)
+	}
+	return nil
+}
+
+// ProtectWithSignature signs the message with the given signer. The chain,
+// starting with the signer certificate, is added at the beginning of the
+// extraCerts.
+func (m *Message) ProtectWithSignature(signer crypto.Signer, chain []*x509.Certificate) error {
+	if len(chain) == 0 {
+		return errors.New("signer certificate is required")
+	}
+	alg, h, err := signatureAlgorithmFor(signer.Public())
+	if err != nil {
+		return err
+	}
+	m.Header.ProtectionAlg = pkix.AlgorithmIdentifier{Algorithm: alg}
+	m.Header.SenderKID = chain[0].SubjectKeyId
+	m.rawHeader = nil
+	extraCerts := append([]*x509.Certificate{}, chain...)
+	for _, c := range m.ExtraCerts {
+		if !slices.ContainsFunc(extraCerts, c.Equal) {
+			extraCerts = append(extraCerts, c)
+		}
+	}
+	m.ExtraCerts = extraCerts
+
+	data, err := m.protectedPart()
+	if err != nil {
+		return err
+	}
+	digest := data
+	if h != 0 {
+		hh := h.New()
+		hh.Write(data)
+		digest = hh.Sum(nil)
+	}
+	sig, err := signer.Sign(rand.Reader, digest, h)
+	if err != nil {
+		return fmt.Errorf("error signing message: %w", err)
+	}
+	m.Protection = asn1.BitString{Bytes: sig, BitLength: len(sig) * 8}
+	return nil
+}
+
+// signatureAlgorithmFor returns the signature algorithm used with the given
+// key.
+func signatureAlgorithmFor(pub crypto.PublicKey) (asn1.ObjectIdentifier, crypto.Hash, error) {
+	switch k := pub.(type) {
+	case *rsa.PublicKey:
+		return oidSHA256WithRSA, crypto.SHA256, nil
+	case *ecdsa.PublicKey:
+		switch k.Curve {
+		case elliptic.P384():
+			return oidECDSAWithSHA384, crypto.SHA384, nil
+		case elliptic.P521():
+			return oidECDSAWithSHA512, crypto.SHA512, nil
+		default:
+			return oidECDSAWithSHA256, crypto.SHA256, nil
+		}
+	case ed25519.PublicKey:
+		return oidEd25519, crypto.Hash(0), nil
+	default:
+		return nil, 0, fmt.Errorf("unsupported key type %T", pub)
+	}
+}
+
+// publicKeyAlgorithm returns the x509.PublicKeyAlgorithm of the given key.
+func publicKeyAlgorithm(pub crypto.PublicKey) (x509.PublicKeyAlgorithm, error) {
+	switch pub.(type) {
+	case *rsa.PublicKey:
+		return x509.RSA, nil
+	case *ecdsa.PublicKey:
+		return x509.ECDSA, nil
+	case ed25519.PublicKey:
+		return x509.Ed25519, nil
+	default:
+		return x509.UnknownPublicKeyAlgorithm, fmt.Errorf("unsupported public key type %T", pub)
+	}
+}
+
+// verifySignature verifies a signature of data with the given algorithm.
+func verifySignature(pub crypto.PublicKey, alg asn1.ObjectIdentifier, data, sig []byte) error {
+	var sa *signatureAlgorithm
+	for i := range signatureAlgorithms {
+		if signatureAlgorithms[i].oid.Equal(alg) {
+			sa = &signatureAlgorithms[i]
+			break
+		}
+	}
+	if sa == nil {
+		return fmt.Errorf("unsupported signature algorithm %s", alg)
+	}
+
+	digest := data
+	if sa.hash != 0 {
+		h := sa.hash.New()
+		h.Write(data)
+		digest = h.Sum(nil)
+	}
+
+	switch k := pub.(type) {
+	case *rsa.PublicKey:
+		if sa.keyType != x509.RSA {
+			return errors.New("signature algorithm does not match the key type")
+		}
+		if err := rsa.VerifyPKCS1v15(k, sa.hash, digest, sig); err != nil {
+			return errors.New("invalid signature")
+		}
+	case *ecdsa.PublicKey:
+		if sa.keyType != x509.ECDSA {
+			return errors.New("signature algorithm does not match the key type")
+		}
+		if !ecdsa.VerifyASN1(k, digest, sig) {
+			return errors.New("invalid signature")
+		}
+	case ed25519.PublicKey:
+		if sa.keyType != x509.Ed25519 {
+			return errors.New("signature algorithm does not match the key type")
+		}
+		if !ed25519.Verify(k, data, sig) {
+			return errors.New("invalid signature")
+		}
+	default:
+		return fmt.Errorf("unsupported public key type %T", pub)
+	}
+	return nil
+}
+
+// popoSigningKey is the signature proof of possession of a certificate
+// request (RFC 4211).
+type popoSigningKey struct {
+	POPOSKInput         asn1.RawValue `asn1:"optional,tag:0"`
+	AlgorithmIdentifier pkix.AlgorithmIdentifier
+	Signature           asn1.BitString
+}
+
+// Proof of possession types.
+const (
+	popoRAVerified = 0
+	popoSignature  = 1
+)
+
+// VerifyProofOfPossession verifies the signature proof of possession of the
+// certificate request with the given public key. The signature is computed
+// over the DER encoding of the CertRequest.
+func (m *CertReqMsg) VerifyProofOfPossession(pub crypto.PublicKey) error {
+	if len(m.POPO.FullBytes) == 0 {
+		return errors.New("certificate request does not contain a proof of possession")
+	}
+	if m.POPO.Class != asn1.ClassContextSpecific || m.POPO.Tag != popoSignature {
+		return errors.New("only signature proof of possession is supported")
+	}
+	var popo popoSigningKey
+	if _, err := asn1.UnmarshalWithParams(m.POPO.FullBytes, &popo, fmt.Sprintf("tag:%d", popoSignature)); err != nil {
+		return fmt.Errorf("error parsing proof of possession: %w", err)
+	}
+	if len(popo.POPOSKInput.FullBytes) > 0 {
+		return errors.New("proof of possession with poposkInput is not supported")
+	}
+	if err := verifySignature(pub, popo.AlgorithmIdentifier.Algorithm, m.CertReq.FullBytes, popo.Signature.RightAlign()); err != nil {
+		return fmt.Errorf("invalid proof of possession: %w", err)
+	}
+	return nil
+}
+
+// ParseCertRequest parses the certificate request of the message.
+func (m *CertReqMsg) ParseCertRequest() (*CertRequest, error) {
+	var req CertRequest
+	rest, err := asn1.Unmarshal(m.CertReq.FullBytes, &req)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing certificate request: %w", err)
+	}
+	if len(rest) > 0 {
+		return nil, errors.New("error parsing certificate request: trailing data")
+	}
+	if req.CertReqID == nil {
+		return nil, errors.New("error parsing certificate request: missing certReqId")
+	}
+	return &req, nil
+}
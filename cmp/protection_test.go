@@ -0,0 +1,191 @@
+package cmp
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.step.sm/crypto/minica"
+)
+
+func newTestPBMRequest(t *testing.T, iterationCount int) *Message {
+	t.Helper()
+	m := newTestMessage(t, TypeIR, asn1.NullRawValue)
+	m.Header.SenderKID = []byte("key-id")
+	m.Header.ProtectionAlg = pkix.AlgorithmIdentifier{
+		Algorithm: oidPasswordBasedMAC,
+		Parameters: asn1.RawValue{FullBytes: mustMarshal(t, pbmParameter{
+			Salt:           []byte("salt"),
+			OWF:            pkix.AlgorithmIdentifier{Algorithm: oidSHA256},
+			IterationCount: iterationCount,
+			MAC:            pkix.AlgorithmIdentifier{Algorithm: oidHMACWithSHA256},
+		})},
+	}
+	return m
+}
+
+// reparse marshals and parses the message like the server does.
+func reparse(t *testing.T, m *Message) *Message {
+	t.Helper()
+	der, err := m.Marshal()
+	require.NoError(t, err)
+	m, err = ParseMessage(der)
+	require.NoError(t, err)
+	return m
+}
+
+func TestMessage_MAC(t *testing.T) {
+	secret := []byte("password")
+	req := newTestPBMRequest(t, 1000)
+	require.NoError(t, req.ProtectWithMAC(req, secret))
+	assert.Equal(t, []byte("key-id"), req.Header.SenderKID)
+
+	req = reparse(t, req)
+	assert.True(t, req.IsMACProtected())
+	assert.False(t, req.IsSignatureProtected())
+	assert.NoError(t, req.VerifyMAC(secret))
+	assert.ErrorIs(t, req.VerifyMAC([]byte("wrong")), ErrBadMessageCheck)
+
+	// Tampered body
+	tampered := *req
+	tampered.Body = asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: TypeCR, IsCompound: true, Bytes: req.Body.Bytes}
+	assert.ErrorIs(t, tampered.VerifyMAC(secret), ErrBadMessageCheck)
+
+	// The response uses the same algorithms
+	resp, err := NewResponse(req, pkix.Name{CommonName: "ca"}, TypePKIConf, asn1.NullRawValue)
+	require.NoError(t, err)
+	require.NoError(t, resp.ProtectWithMAC(req, secret))
+	resp = reparse(t, resp)
+	assert.Equal(t, []byte("key-id"), resp.Header.SenderKID)
+	assert.NoError(t, resp.VerifyMAC(secret))
+}
+
+func TestMessage_VerifyMAC_iterationCount(t *testing.T) {
+	secret := []byte("password")
+	for _, n := range []int{1, maxPBMIterationCount + 1} {
+		req := newTestPBMRequest(t, n)
+		data, err := req.protectedPart()
+		require.NoError(t, err)
+		sum := computePBM(secret, []byte("salt"), crypto.SHA256, n, crypto.SHA256, data)
+		req.Protection = asn1.BitString{Bytes: sum, BitLength: len(sum) * 8}
+		assert.ErrorIs(t, req.VerifyMAC(secret), ErrBadMessageCheck)
+	}
+
+	// Responses to requests with a non-valid count use the default one.
+	req := newTestPBMRequest(t, 1)
+	resp, err := NewResponse(req, pkix.Name{CommonName: "ca"}, TypePKIConf, asn1.NullRawValue)
+	require.NoError(t, err)
+	require.NoError(t, resp.ProtectWithMAC(req, secret))
+	var params pbmParameter
+	_, err = asn1.Unmarshal(resp.Header.ProtectionAlg.Parameters.FullBytes, &params)
+	require.NoError(t, err)
+	assert.Equal(t, defaultPBMIterationCount, params.IterationCount)
+	assert.Len(t, params.Salt, pbmSaltSize)
+}
+
+func TestMessage_Signature(t *testing.T) {
+	ca, err := minica.New()
+	require.NoError(t, err)
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	require.NoError(t, err)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	for name, signer := range map[string]crypto.Signer{"ecdsa": ecKey, "rsa": rsaKey, "ed25519": edKey} {
+		t.Run(name, func(t *testing.T) {
+			cert, err := ca.Sign(&x509.Certificate{
+				Subject:   pkix.Name{CommonName: "client"},
+				PublicKey: signer.Public(),
+			})
+			require.NoError(t, err)
+
+			m := newTestMessage(t, TypeCertConf, []CertStatus{})
+			m.ExtraCerts = []*x509.Certificate{ca.Root, cert}
+			require.NoError(t, m.ProtectWithSignature(signer, []*x509.Certificate{cert, ca.Intermediate}))
+			assert.Equal(t, []*x509.Certificate{cert, ca.Intermediate, ca.Root}, m.ExtraCerts)
+			assert.Equal(t, cert.SubjectKeyId, m.Header.SenderKID)
+
+			m = reparse(t, m)
+			assert.True(t, m.IsSignatureProtected())
+			assert.False(t, m.IsMACProtected())
+			got, err := m.ProtectionCertificate()
+			require.NoError(t, err)
+			assert.Equal(t, cert, got)
+			assert.NoError(t, m.VerifySignature(cert))
+			assert.ErrorIs(t, m.VerifySignature(ca.Intermediate), ErrBadMessageCheck)
+			assert.ErrorIs(t, m.VerifyMAC([]byte("password")), ErrBadMessageCheck)
+		})
+	}
+
+	m := newTestMessage(t, TypeCertConf, []CertStatus{})
+	_, err = m.ProtectionCertificate()
+	assert.ErrorIs(t, err, ErrBadMessageCheck)
+	assert.Error(t, m.ProtectWithSignature(ecKey, nil))
+}
+
+func TestCertReqMsg_VerifyProofOfPossession(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	msg := newTestCertReqMsg(t, key, newTestTemplate(t, key.Public(), &pkix.Name{CommonName: "test"}))
+
+	tests := []struct {
+		name    string
+		msg     CertReqMsg
+		pub     crypto.PublicKey
+		wantErr error
+	}{
+		{"ok", msg, key.Public(), nil},
+		{"fail/wrong key", msg, otherKey.Public(), errors.New("invalid proof of possession: invalid signature")},
+		{"fail/missing", CertReqMsg{CertReq: msg.CertReq}, key.Public(), errors.New("certificate request does not contain a proof of possession")},
+		{"fail/raVerified", CertReqMsg{
+			CertReq: msg.CertReq,
+			POPO:    asn1.RawValue{FullBytes: []byte{0x80, 0x00}},
+		}, key.Public(), errors.New("only signature proof of possession is supported")},
+		{"fail/other request", CertReqMsg{
+			CertReq: newTestCertReqMsg(t, otherKey, newTestTemplate(t, key.Public(), nil)).CertReq,
+			POPO:    msg.POPO,
+		}, key.Public(), errors.New("invalid proof of possession: invalid signature")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Parse the message as the server does.
+			var msgs []CertReqMsg
+			_, err := asn1.Unmarshal(mustMarshal(t, []CertReqMsg{tt.msg}), &msgs)
+			require.NoError(t, err)
+			err = msgs[0].VerifyProofOfPossession(tt.pub)
+			if tt.wantErr != nil {
+				assert.EqualError(t, err, tt.wantErr.Error())
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestCertReqMsg_ParseCertRequest(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	msg := newTestCertReqMsg(t, key, newTestTemplate(t, key.Public(), &pkix.Name{CommonName: "test"}))
+	cr, err := msg.ParseCertRequest()
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), cr.CertReqID.Int64())
+	assert.True(t, cr.CertTemplate.HasSubject())
+
+	_, err = (&CertReqMsg{CertReq: asn1.RawValue{FullBytes: []byte("foo")}}).ParseCertRequest()
+	assert.Error(t, err)
+}
@@ -0,0 +1,214 @@
+package commands
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/pkg/errors"
+	"github.com/urfave/cli"
+	"go.step.sm/crypto/kms"
+	kmsapi "go.step.sm/crypto/kms/apiv1"
+
+	"go.step.sm/cli-utils/command"
+	"go.step.sm/cli-utils/errs"
+
+	"github.com/smallstep/certificates/authority/config"
+	"github.com/smallstep/certificates/cas/softcas"
+)
+
+func init() {
+	command.Register(cli.Command{
+		Name:      "benchmark",
+		Usage:     "measure the signing performance of the configured kms",
+		UsageText: "**step-ca benchmark** <config> [**--key**=<uri>] [**--concurrency**=<n>] [**--duration**=<duration>]",
+		Action:    benchmarkAction,
+		Description: `**step-ca benchmark** signs random digests with the intermediate key, or
+the given key, using the KMS configured in the ca.json, and reports the number
+of signatures per second and their latency.
+
+Run it with different concurrency levels to find the value of
+signingPool.maxConcurrency that the KMS can sustain.
+
+## POSITIONAL ARGUMENTS
+
+<config>
+:  The ca.json that contains the step-ca configuration.
+
+## EXAMPLES
+
+Benchmark the intermediate key for 10 seconds:
+'''
+$ step-ca benchmark $(step path)/config/ca.json
+'''
+
+Benchmark the SSH host key with 16 concurrent signers for a minute:
+'''
+$ step-ca benchmark --key $(step path)/secrets/ssh_host_ca_key \
+  --concurrency 16 --duration 1m $(step path)/config/ca.json
+'''`,
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "key",
+				Usage: `the <uri> or file of the key to use, it defaults to the intermediate key.`,
+			},
+			cli.StringFlag{
+				Name:  "password-file",
+				Usage: `path to the <file> containing the password to decrypt the key.`,
+			},
+			cli.IntFlag{
+				Name:  "concurrency",
+				Usage: `the <number> of concurrent signatures.`,
+				Value: 1,
+			},
+			cli.DurationFlag{
+				Name:  "duration",
+				Usage: `the <duration> of the benchmark.`,
+				Value: 10 * time.Second,
+			},
+		},
+	})
+}
+
+func benchmarkAction(ctx *cli.Context) error {
+	if err := errs.NumberOfArguments(ctx, 1); err != nil {
+		return err
+	}
+
+	concurrency := ctx.Int("concurrency")
+	if concurrency <= 0 {
+		return errs.InvalidFlagValue(ctx, "concurrency", ctx.String("concurrency"), "")
+	}
+	duration := ctx.Duration("duration")
+	if duration <= 0 {
+		return errs.InvalidFlagValue(ctx, "duration", ctx.String("duration"), "")
+	}
+
+	cfg, err := config.LoadConfiguration(ctx.Args().Get(0))
+	if err != nil {
+		return err
+	}
+
+	key := ctx.String("key")
+	if key == "" {
+		key = cfg.IntermediateKey
+	}
+	var password []byte
+	if passwordFile := ctx.String("password-file"); passwordFile != "" {
+		b, err := os.ReadFile(passwordFile)
+		if err != nil {
+			return errors.Wrapf(err, "error reading %s", passwordFile)
+		}
+		password = bytes.TrimRightFunc(b, unicode.IsSpace)
+	} else if cfg.Password != "" {
+		password = []byte(cfg.Password)
+	}
+
+	var options kmsapi.Options
+	if cfg.KMS != nil {
+		options = *cfg.KMS
+	}
+	km, err := kms.New(context.Background(), options)
+	if err != nil {
+		return err
+	}
+	defer km.Close()
+	if typ, err := options.GetType(); err == nil && kmsapi.SoftKMS == kmsapi.Type(strings.ToLower(string(typ))) {
+		km = softcas.NewKeyManager(km)
+	}
+
+	signer, err := km.CreateSigner(&kmsapi.CreateSignerRequest{
+		SigningKey: key,
+		Password:   password,
+	})
+	if err != nil {
+		return errors.Wrapf(err, "error creating signer for %s", key)
+	}
+
+	fmt.Printf("Benchmarking %s with %d concurrent signers for %s...\n", key, concurrency, duration)
+	r := runBenchmark(signer, concurrency, duration)
+	fmt.Println()
+	fmt.Printf("Signatures: %d\n", len(r.latencies))
+	fmt.Printf("Errors:     %d\n", r.errors)
+	if r.err != nil {
+		fmt.Printf("Last error: %v\n", r.err)
+	}
+	if len(r.latencies) == 0 {
+		return errors.New("no signatures completed")
+	}
+	fmt.Printf("Throughput: %.2f signatures/s\n", float64(len(r.latencies))/r.elapsed.Seconds())
+	fmt.Printf("Latency:    min %s, p50 %s, p90 %s, p99 %s, max %s\n",
+		r.percentile(0), r.percentile(50), r.percentile(90), r.percentile(99), r.percentile(100))
+	return nil
+}
+
+type benchmarkResult struct {
+	latencies []time.Duration
+	errors    int
+	err       error
+	elapsed   time.Duration
+}
+
+// percentile returns the given percentile of the sorted latencies.
+func (r *benchmarkResult) percentile(p int) time.Duration {
+	i := (len(r.latencies) - 1) * p / 100
+	return r.latencies[i].Round(time.Microsecond)
+}
+
+// runBenchmark signs SHA-256 digests with the given signer from concurrency
+// goroutines until the duration expires.
+func runBenchmark(signer crypto.Signer, concurrency int, duration time.Duration) *benchmarkResult {
+	var opts crypto.SignerOpts = crypto.SHA256
+	if _, ok := signer.Public().(ed25519.PublicKey); ok {
+		opts = crypto.Hash(0)
+	}
+	digest := sha256.Sum256([]byte("step-ca benchmark"))
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	result := new(benchmarkResult)
+	start := time.Now()
+	deadline := start.Add(duration)
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var latencies []time.Duration
+			var failures int
+			var lastErr error
+			for time.Now().Before(deadline) {
+				t := time.Now()
+				if _, err := signer.Sign(rand.Reader, digest[:], opts); err != nil {
+					failures++
+					lastErr = err
+					continue
+				}
+				latencies = append(latencies, time.Since(t))
+			}
+			mu.Lock()
+			result.latencies = append(result.latencies, latencies...)
+			result.errors += failures
+			if lastErr != nil {
+				result.err = lastErr
+			}
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	result.elapsed = time.Since(start)
+	sort.Slice(result.latencies, func(i, j int) bool {
+		return result.latencies[i] < result.latencies[j]
+	})
+	return result
+}
@@ -26,6 +26,11 @@ var (
 	sshHostsTable          = []byte("ssh_hosts")
 	sshUsersTable          = []byte("ssh_users")
 	sshHostPrincipalsTable = []byte("ssh_host_principals")
+	webAuthnCredsTable     = []byte("webauthn_credentials")
+	rateLimitsTable        = []byte("rate_limits")
+	certsStatusTable       = []byte("x509_certs_status")
+	renewalPoliciesTable   = []byte("renewal_policies")
+	scepChallengesTable    = []byte("scep_challenges")
 )
 
 // TODO: at the moment we store a single CRL in the database, in a dedicated table.
@@ -36,6 +41,20 @@ var crlKey = []byte("crl")
 // been previously set.
 var ErrAlreadyExists = errors.New("already exists")
 
+// ErrNotOnHold is returned if the DB attempts to unrevoke a certificate that
+// is not on hold.
+var ErrNotOnHold = errors.New("certificate is not on hold")
+
+// Revocation reason codes, RFC 5280, 5.3.1, with a special meaning in the
+// revocation table. Certificates with the certificateHold reason can be
+// unrevoked or revoked again with a different reason. Unrevoked certificates
+// are kept in the table with the removeFromCRL reason, so they can be
+// included in delta CRLs, but they are not considered revoked.
+const (
+	ReasonCodeCertificateHold = 6
+	ReasonCodeRemoveFromCRL   = 8
+)
+
 // Config represents the JSON attributes used for configuring a step-ca DB.
 type Config struct {
 	Type       string `json:"type"`
@@ -102,6 +121,26 @@ type CertificateRevocationListDB interface {
 	StoreCRL(*CertificateRevocationListInfo) error
 }
 
+// UnrevokeDB is an interface to indicate whether the DB supports removing the
+// hold of certificates.
+type UnrevokeDB interface {
+	Unrevoke(serialNumber string, unrevokedAt time.Time) error
+}
+
+// CertificateRevocationListsDB is an interface to indicate whether the DB
+// supports storing multiple CRLs, required by partitioned and delta CRLs.
+type CertificateRevocationListsDB interface {
+	GetCRLByID(id string) (*CertificateRevocationListInfo, error)
+	StoreCRLByID(id string, crlInfo *CertificateRevocationListInfo) error
+}
+
+// RevokedCertificateDB is an interface to indicate whether the DB supports
+// retrieving the revocation information of a certificate, used by the OCSP
+// responder.
+type RevokedCertificateDB interface {
+	GetRevokedCertificate(serialNumber string) (*RevokedCertificateInfo, error)
+}
+
 // DB is a wrapper over the nosql.DB interface.
 type DB struct {
 	nosql.DB
@@ -128,7 +167,9 @@ func New(c *Config) (AuthDB, error) {
 	tables := [][]byte{
 		revokedCertsTable, certsTable, usedOTTTable,
 		sshCertsTable, sshHostsTable, sshHostPrincipalsTable, sshUsersTable,
-		revokedSSHCertsTable, certsDataTable, crlTable,
+		revokedSSHCertsTable, certsDataTable, crlTable, webAuthnCredsTable,
+		rateLimitsTable, certsStatusTable, renewalPoliciesTable,
+		scepChallengesTable,
 	}
 	for _, b := range tables {
 		if err := db.CreateTable(b); err != nil {
@@ -152,15 +193,22 @@ type RevokedCertificateInfo struct {
 	TokenID       string
 	MTLS          bool
 	ACME          bool
+	// CRLPartition is the CRL partition the certificate points to, 0 if the
+	// certificate does not point to a partition or it is not known.
+	CRLPartition int `json:",omitempty"`
 }
 
 // CertificateRevocationListInfo contains a CRL in DER format and associated
 // metadata to allow a decision on whether to regenerate the CRL or not easier
 type CertificateRevocationListInfo struct {
-	Number    int64
-	ExpiresAt time.Time
-	Duration  time.Duration
-	DER       []byte
+	Number     int64
+	ThisUpdate time.Time
+	ExpiresAt  time.Time
+	Duration   time.Duration
+	DER        []byte
+	// Partitions is the number of CRL partitions when the full CRL was
+	// generated.
+	Partitions int `json:",omitempty"`
 }
 
 // IsRevoked returns whether or not a certificate with the given identifier
@@ -175,15 +223,16 @@ func (db *DB) IsRevoked(sn string) (bool, error) {
 
 	// If the error is `Not Found` then the certificate has not been revoked.
 	// Any other error should be propagated to the caller.
-	if _, err := db.Get(revokedCertsTable, []byte(sn)); err != nil {
+	b, err := db.Get(revokedCertsTable, []byte(sn))
+	if err != nil {
 		if nosql.IsErrNotFound(err) {
 			return false, nil
 		}
 		return false, errors.Wrap(err, "error checking revocation bucket")
 	}
 
-	// This certificate has been revoked.
-	return true, nil
+	// This certificate has been revoked, unless it has been unrevoked.
+	return !isUnrevoked(b), nil
 }
 
 // IsSSHRevoked returns whether or not a certificate with the given identifier
@@ -216,17 +265,80 @@ func (db *DB) Revoke(rci *RevokedCertificateInfo) error {
 		return errors.Wrap(err, "error marshaling revoked certificate info")
 	}
 
-	_, swapped, err := db.CmpAndSwap(revokedCertsTable, []byte(rci.Serial), nil, rcib)
+	current, swapped, err := db.CmpAndSwap(revokedCertsTable, []byte(rci.Serial), nil, rcib)
 	switch {
 	case err != nil:
 		return errors.Wrap(err, "error AuthDB CmpAndSwap")
-	case !swapped:
+	case swapped:
+		return nil
+	}
+
+	// Certificates on hold can be revoked with a different reason, and
+	// unrevoked certificates can be revoked again.
+	var old RevokedCertificateInfo
+	if err := json.Unmarshal(current, &old); err != nil {
 		return ErrAlreadyExists
+	}
+	onHold := old.ReasonCode == ReasonCodeCertificateHold && rci.ReasonCode != ReasonCodeCertificateHold
+	if !onHold && old.ReasonCode != ReasonCodeRemoveFromCRL {
+		return ErrAlreadyExists
+	}
+	if _, swapped, err = db.CmpAndSwap(revokedCertsTable, []byte(rci.Serial), current, rcib); err != nil {
+		return errors.Wrap(err, "error AuthDB CmpAndSwap")
+	} else if !swapped {
+		return ErrAlreadyExists
+	}
+	return nil
+}
+
+// Unrevoke removes the hold of a certificate. The certificate is kept in the
+// revocation table with the removeFromCRL reason and the time it was
+// unrevoked.
+func (db *DB) Unrevoke(serialNumber string, unrevokedAt time.Time) error {
+	current, err := db.Get(revokedCertsTable, []byte(serialNumber))
+	if err != nil {
+		if nosql.IsErrNotFound(err) {
+			return ErrNotOnHold
+		}
+		return errors.Wrap(err, "error checking revocation bucket")
+	}
+
+	var rci RevokedCertificateInfo
+	if err := json.Unmarshal(current, &rci); err != nil {
+		return errors.Wrap(err, "error unmarshaling revoked certificate info")
+	}
+	if rci.ReasonCode != ReasonCodeCertificateHold {
+		return ErrNotOnHold
+	}
+	rci.ReasonCode = ReasonCodeRemoveFromCRL
+	rci.Reason = ""
+	rci.RevokedAt = unrevokedAt
+
+	rcib, err := json.Marshal(rci)
+	if err != nil {
+		return errors.Wrap(err, "error marshaling revoked certificate info")
+	}
+	_, swapped, err := db.CmpAndSwap(revokedCertsTable, []byte(serialNumber), current, rcib)
+	switch {
+	case err != nil:
+		return errors.Wrap(err, "error AuthDB CmpAndSwap")
+	case !swapped:
+		return ErrNotOnHold
 	default:
 		return nil
 	}
 }
 
+// isUnrevoked returns true if the given revocation table value is of an
+// unrevoked certificate.
+func isUnrevoked(b []byte) bool {
+	var rci RevokedCertificateInfo
+	if err := json.Unmarshal(b, &rci); err != nil {
+		return false
+	}
+	return rci.ReasonCode == ReasonCodeRemoveFromCRL
+}
+
 // RevokeSSH adds a SSH certificate to the revocation table.
 func (db *DB) RevokeSSH(rci *RevokedCertificateInfo) error {
 	rcib, err := json.Marshal(rci)
@@ -262,6 +374,27 @@ func (db *DB) GetRevokedCertificates() (*[]RevokedCertificateInfo, error) {
 	return &revokedCerts, nil
 }
 
+// GetRevokedCertificate returns the revocation information of the certificate
+// with the given serial number, or nil if it has not been revoked or it has
+// been unrevoked.
+func (db *DB) GetRevokedCertificate(serialNumber string) (*RevokedCertificateInfo, error) {
+	b, err := db.Get(revokedCertsTable, []byte(serialNumber))
+	if err != nil {
+		if nosql.IsErrNotFound(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "error checking revocation bucket")
+	}
+	var rci RevokedCertificateInfo
+	if err := json.Unmarshal(b, &rci); err != nil {
+		return nil, errors.Wrap(err, "error unmarshaling revoked certificate info")
+	}
+	if rci.ReasonCode == ReasonCodeRemoveFromCRL {
+		return nil, nil
+	}
+	return &rci, nil
+}
+
 // StoreCRL stores a CRL in the DB
 func (db *DB) StoreCRL(crlInfo *CertificateRevocationListInfo) error {
 	crlInfoBytes, err := json.Marshal(crlInfo)
@@ -290,6 +423,38 @@ func (db *DB) GetCRL() (*CertificateRevocationListInfo, error) {
 	return &crlInfo, err
 }
 
+// StoreCRLByID stores the CRL with the given id in the DB. The id identifies
+// a partition or a delta CRL.
+func (db *DB) StoreCRLByID(id string, crlInfo *CertificateRevocationListInfo) error {
+	crlInfoBytes, err := json.Marshal(crlInfo)
+	if err != nil {
+		return errors.Wrap(err, "json Marshal error")
+	}
+
+	if err := db.Set(crlTable, crlKeyByID(id), crlInfoBytes); err != nil {
+		return errors.Wrap(err, "database Set error")
+	}
+	return nil
+}
+
+// GetCRLByID gets the CRL with the given id from the database.
+func (db *DB) GetCRLByID(id string) (*CertificateRevocationListInfo, error) {
+	crlInfoBytes, err := db.Get(crlTable, crlKeyByID(id))
+	if err != nil {
+		return nil, errors.Wrap(err, "database Get error")
+	}
+
+	var crlInfo CertificateRevocationListInfo
+	if err := json.Unmarshal(crlInfoBytes, &crlInfo); err != nil {
+		return nil, errors.Wrap(err, "json Unmarshal error")
+	}
+	return &crlInfo, nil
+}
+
+func crlKeyByID(id string) []byte {
+	return []byte(string(crlKey) + "/" + id)
+}
+
 // GetCertificate retrieves a certificate by the serial number.
 func (db *DB) GetCertificate(serialNumber string) (*x509.Certificate, error) {
 	asn1Data, err := db.Get(certsTable, []byte(serialNumber))
@@ -500,8 +665,12 @@ type MockAuthDB struct {
 	MGetSSHHostPrincipals   func() ([]string, error)
 	MShutdown               func() error
 	MGetRevokedCertificates func() (*[]RevokedCertificateInfo, error)
+	MGetRevokedCertificate  func(serialNumber string) (*RevokedCertificateInfo, error)
 	MGetCRL                 func() (*CertificateRevocationListInfo, error)
 	MStoreCRL               func(*CertificateRevocationListInfo) error
+	MUnrevoke               func(serialNumber string, unrevokedAt time.Time) error
+	MGetCRLByID             func(id string) (*CertificateRevocationListInfo, error)
+	MStoreCRLByID           func(id string, info *CertificateRevocationListInfo) error
 }
 
 func (m *MockAuthDB) GetRevokedCertificates() (*[]RevokedCertificateInfo, error) {
@@ -511,6 +680,17 @@ func (m *MockAuthDB) GetRevokedCertificates() (*[]RevokedCertificateInfo, error)
 	return m.Ret1.(*[]RevokedCertificateInfo), m.Err
 }
 
+// GetRevokedCertificate mock.
+func (m *MockAuthDB) GetRevokedCertificate(serialNumber string) (*RevokedCertificateInfo, error) {
+	if m.MGetRevokedCertificate != nil {
+		return m.MGetRevokedCertificate(serialNumber)
+	}
+	if rci, ok := m.Ret1.(*RevokedCertificateInfo); ok {
+		return rci, m.Err
+	}
+	return nil, m.Err
+}
+
 func (m *MockAuthDB) GetCRL() (*CertificateRevocationListInfo, error) {
 	if m.MGetCRL != nil {
 		return m.MGetCRL()
@@ -525,6 +705,33 @@ func (m *MockAuthDB) StoreCRL(info *CertificateRevocationListInfo) error {
 	return m.Err
 }
 
+// Unrevoke mock.
+func (m *MockAuthDB) Unrevoke(serialNumber string, unrevokedAt time.Time) error {
+	if m.MUnrevoke != nil {
+		return m.MUnrevoke(serialNumber, unrevokedAt)
+	}
+	return m.Err
+}
+
+// GetCRLByID mock.
+func (m *MockAuthDB) GetCRLByID(id string) (*CertificateRevocationListInfo, error) {
+	if m.MGetCRLByID != nil {
+		return m.MGetCRLByID(id)
+	}
+	if info, ok := m.Ret1.(*CertificateRevocationListInfo); ok {
+		return info, m.Err
+	}
+	return nil, m.Err
+}
+
+// StoreCRLByID mock.
+func (m *MockAuthDB) StoreCRLByID(id string, info *CertificateRevocationListInfo) error {
+	if m.MStoreCRLByID != nil {
+		return m.MStoreCRLByID(id, info)
+	}
+	return m.Err
+}
+
 // IsRevoked mock.
 func (m *MockAuthDB) IsRevoked(sn string) (bool, error) {
 	if m.MIsRevoked != nil {
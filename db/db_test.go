@@ -3,10 +3,12 @@ package db
 import (
 	"bytes"
 	"crypto/x509"
+	"encoding/json"
 	"errors"
 	"math/big"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/smallstep/assert"
 	"github.com/smallstep/certificates/authority/provisioner"
@@ -38,6 +40,15 @@ func TestIsRevoked(t *testing.T) {
 			db:        &DB{&MockNoSQLDB{Ret1: []byte("value")}, true},
 			isRevoked: true,
 		},
+		"true/on hold": {
+			key:       "sn",
+			db:        &DB{&MockNoSQLDB{Ret1: []byte(`{"Serial":"sn","ReasonCode":6}`)}, true},
+			isRevoked: true,
+		},
+		"false/removed from CRL": {
+			key: "sn",
+			db:  &DB{&MockNoSQLDB{Ret1: []byte(`{"Serial":"sn","ReasonCode":8}`)}, true},
+		},
 	}
 	for name, tc := range tests {
 		t.Run(name, func(t *testing.T) {
@@ -78,6 +89,37 @@ func TestRevoke(t *testing.T) {
 			}, true},
 			err: ErrAlreadyExists,
 		},
+		"error/hold was already on hold": {
+			rci: &RevokedCertificateInfo{Serial: "sn", ReasonCode: ReasonCodeCertificateHold},
+			db: &DB{&MockNoSQLDB{
+				MCmpAndSwap: func(bucket, sn, old, newval []byte) ([]byte, bool, error) {
+					return []byte(`{"Serial":"sn","ReasonCode":6}`), false, nil
+				},
+			}, true},
+			err: ErrAlreadyExists,
+		},
+		"ok/revoke on hold": {
+			rci: &RevokedCertificateInfo{Serial: "sn", ReasonCode: 1},
+			db: &DB{&MockNoSQLDB{
+				MCmpAndSwap: func(bucket, sn, old, newval []byte) ([]byte, bool, error) {
+					if old == nil {
+						return []byte(`{"Serial":"sn","ReasonCode":6}`), false, nil
+					}
+					return newval, true, nil
+				},
+			}, true},
+		},
+		"ok/revoke removed from CRL": {
+			rci: &RevokedCertificateInfo{Serial: "sn", ReasonCode: ReasonCodeCertificateHold},
+			db: &DB{&MockNoSQLDB{
+				MCmpAndSwap: func(bucket, sn, old, newval []byte) ([]byte, bool, error) {
+					if old == nil {
+						return []byte(`{"Serial":"sn","ReasonCode":8}`), false, nil
+					}
+					return newval, true, nil
+				},
+			}, true},
+		},
 		"ok": {
 			rci: &RevokedCertificateInfo{Serial: "sn"},
 			db: &DB{&MockNoSQLDB{
@@ -100,6 +142,150 @@ func TestRevoke(t *testing.T) {
 	}
 }
 
+func TestDB_GetRevokedCertificate(t *testing.T) {
+	revokedAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	rcib, err := json.Marshal(&RevokedCertificateInfo{Serial: "sn", ReasonCode: 1, RevokedAt: revokedAt})
+	assert.FatalError(t, err)
+
+	tests := map[string]struct {
+		db   *DB
+		want *RevokedCertificateInfo
+		err  error
+	}{
+		"ok": {
+			db:   &DB{&MockNoSQLDB{Ret1: rcib}, true},
+			want: &RevokedCertificateInfo{Serial: "sn", ReasonCode: 1, RevokedAt: revokedAt},
+		},
+		"ok/not revoked": {
+			db: &DB{&MockNoSQLDB{Err: database.ErrNotFound}, true},
+		},
+		"ok/removed from CRL": {
+			db: &DB{&MockNoSQLDB{Ret1: []byte(`{"Serial":"sn","ReasonCode":8}`)}, true},
+		},
+		"error/checking bucket": {
+			db:  &DB{&MockNoSQLDB{Err: errors.New("force")}, true},
+			err: errors.New("error checking revocation bucket: force"),
+		},
+		"error/unmarshal": {
+			db:  &DB{&MockNoSQLDB{Ret1: []byte("foo")}, true},
+			err: errors.New("error unmarshaling revoked certificate info"),
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := tc.db.GetRevokedCertificate("sn")
+			if err != nil {
+				if assert.NotNil(t, tc.err) {
+					assert.HasPrefix(t, err.Error(), tc.err.Error())
+				}
+			} else {
+				assert.Nil(t, tc.err)
+				assert.Equals(t, tc.want, got)
+			}
+		})
+	}
+}
+
+func TestDB_Unrevoke(t *testing.T) {
+	unrevokedAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	onHold := []byte(`{"Serial":"sn","ReasonCode":6,"Reason":"hold"}`)
+
+	var got *RevokedCertificateInfo
+	tests := map[string]struct {
+		db   *DB
+		want *RevokedCertificateInfo
+		err  error
+	}{
+		"ok": {
+			db: &DB{&MockNoSQLDB{
+				Ret1: onHold,
+				MCmpAndSwap: func(bucket, sn, old, newval []byte) ([]byte, bool, error) {
+					got = new(RevokedCertificateInfo)
+					assert.FatalError(t, json.Unmarshal(newval, got))
+					return newval, true, nil
+				},
+			}, true},
+			want: &RevokedCertificateInfo{Serial: "sn", ReasonCode: ReasonCodeRemoveFromCRL, RevokedAt: unrevokedAt},
+		},
+		"error/not revoked": {
+			db:  &DB{&MockNoSQLDB{Err: database.ErrNotFound}, true},
+			err: ErrNotOnHold,
+		},
+		"error/not on hold": {
+			db:  &DB{&MockNoSQLDB{Ret1: []byte(`{"Serial":"sn","ReasonCode":1}`)}, true},
+			err: ErrNotOnHold,
+		},
+		"error/checking bucket": {
+			db:  &DB{&MockNoSQLDB{Err: errors.New("force")}, true},
+			err: errors.New("error checking revocation bucket: force"),
+		},
+		"error/unmarshal": {
+			db:  &DB{&MockNoSQLDB{Ret1: []byte("foo")}, true},
+			err: errors.New("error unmarshaling revoked certificate info"),
+		},
+		"error/swapped": {
+			db: &DB{&MockNoSQLDB{
+				Ret1: onHold,
+				MCmpAndSwap: func(bucket, sn, old, newval []byte) ([]byte, bool, error) {
+					return []byte(`{"Serial":"sn","ReasonCode":1}`), false, nil
+				},
+			}, true},
+			err: ErrNotOnHold,
+		},
+		"error/force CmpAndSwap": {
+			db: &DB{&MockNoSQLDB{
+				Ret1: onHold,
+				MCmpAndSwap: func(bucket, sn, old, newval []byte) ([]byte, bool, error) {
+					return nil, false, errors.New("force")
+				},
+			}, true},
+			err: errors.New("error AuthDB CmpAndSwap: force"),
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got = nil
+			if err := tc.db.Unrevoke("sn", unrevokedAt); err != nil {
+				if assert.NotNil(t, tc.err) {
+					assert.HasPrefix(t, err.Error(), tc.err.Error())
+				}
+			} else {
+				assert.Nil(t, tc.err)
+				assert.Equals(t, tc.want, got)
+			}
+		})
+	}
+}
+
+func TestDB_CRLByID(t *testing.T) {
+	thisUpdate := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	info := &CertificateRevocationListInfo{Number: 2, ThisUpdate: thisUpdate, ExpiresAt: thisUpdate.Add(time.Hour), Duration: time.Hour, DER: []byte("der")}
+	var stored []byte
+	db := &DB{&MockNoSQLDB{
+		MSet: func(bucket, key, value []byte) error {
+			assert.Equals(t, crlTable, bucket)
+			assert.Equals(t, []byte("crl/3/delta"), key)
+			stored = value
+			return nil
+		},
+		MGet: func(bucket, key []byte) ([]byte, error) {
+			assert.Equals(t, crlTable, bucket)
+			if string(key) != "crl/3/delta" {
+				return nil, database.ErrNotFound
+			}
+			return stored, nil
+		},
+	}, true}
+
+	assert.FatalError(t, db.StoreCRLByID("3/delta", info))
+	got, err := db.GetCRLByID("3/delta")
+	assert.FatalError(t, err)
+	assert.Equals(t, info, got)
+
+	_, err = db.GetCRLByID("3")
+	assert.HasPrefix(t, err.Error(), "database Get error")
+}
+
 func TestUseToken(t *testing.T) {
 	type result struct {
 		err error
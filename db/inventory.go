@@ -0,0 +1,82 @@
+package db
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/nosql/database"
+)
+
+// InventoryStatus is the status of a certificate in the inventory.
+type InventoryStatus string
+
+const (
+	// InventoryStatusActive is the status of a certificate in use. It's also
+	// the status of the certificates without an inventory record.
+	InventoryStatusActive InventoryStatus = "active"
+	// InventoryStatusDecommissioned is the status of a certificate whose
+	// host or device has been deprovisioned.
+	InventoryStatusDecommissioned InventoryStatus = "decommissioned"
+	// InventoryStatusRevoked is the status of a certificate marked as revoked
+	// in the inventory, it might not have been revoked in the CA yet.
+	InventoryStatusRevoked InventoryStatus = "revoked"
+)
+
+// Validate returns an error if the status is not supported.
+func (s InventoryStatus) Validate() error {
+	switch s {
+	case InventoryStatusActive, InventoryStatusDecommissioned, InventoryStatusRevoked:
+		return nil
+	default:
+		return errors.Errorf("inventory status %q is not supported", s)
+	}
+}
+
+// InventoryDB is an extension of AuthDB that keeps the inventory status of
+// the certificates.
+type InventoryDB interface {
+	GetCertificateStatus(serialNumber string) (*CertificateStatus, error)
+	SetCertificateStatus(serialNumber string, status *CertificateStatus) error
+}
+
+// CertificateStatus is the inventory record of a certificate.
+type CertificateStatus struct {
+	Status    InventoryStatus `json:"status"`
+	Reason    string          `json:"reason,omitempty"`
+	UpdatedAt time.Time       `json:"updatedAt"`
+}
+
+// GetCertificateStatus returns the inventory record of the certificate with
+// the given serial number. It returns an active status if the certificate
+// does not have a record.
+func (db *DB) GetCertificateStatus(serialNumber string) (*CertificateStatus, error) {
+	b, err := db.Get(certsStatusTable, []byte(serialNumber))
+	switch {
+	case database.IsErrNotFound(err):
+		return &CertificateStatus{Status: InventoryStatusActive}, nil
+	case err != nil:
+		return nil, errors.Wrap(err, "database Get error")
+	}
+	st := new(CertificateStatus)
+	if err := json.Unmarshal(b, st); err != nil {
+		return nil, errors.Wrap(err, "error unmarshaling certificate status")
+	}
+	return st, nil
+}
+
+// SetCertificateStatus stores the inventory record of the certificate with
+// the given serial number.
+func (db *DB) SetCertificateStatus(serialNumber string, status *CertificateStatus) error {
+	if err := status.Status.Validate(); err != nil {
+		return err
+	}
+	b, err := json.Marshal(status)
+	if err != nil {
+		return errors.Wrap(err, "error marshaling certificate status")
+	}
+	if err := db.Set(certsStatusTable, []byte(serialNumber), b); err != nil {
+		return errors.Wrap(err, "database Set error")
+	}
+	return nil
+}
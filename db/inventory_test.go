@@ -0,0 +1,70 @@
+package db
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/smallstep/assert"
+	"github.com/smallstep/nosql/database"
+)
+
+func TestDB_CertificateStatus(t *testing.T) {
+	m := map[string][]byte{}
+	db := &DB{&MockNoSQLDB{
+		MGet: func(bucket, key []byte) ([]byte, error) {
+			assert.Equals(t, certsStatusTable, bucket)
+			if v, ok := m[string(key)]; ok {
+				return v, nil
+			}
+			return nil, database.ErrNotFound
+		},
+		MSet: func(bucket, key, value []byte) error {
+			assert.Equals(t, certsStatusTable, bucket)
+			m[string(key)] = value
+			return nil
+		},
+	}, true}
+
+	st, err := db.GetCertificateStatus("1234")
+	assert.FatalError(t, err)
+	assert.Equals(t, &CertificateStatus{Status: InventoryStatusActive}, st)
+
+	now := time.Now().UTC().Truncate(time.Second)
+	want := &CertificateStatus{
+		Status:    InventoryStatusDecommissioned,
+		Reason:    "host deprovisioned",
+		UpdatedAt: now,
+	}
+	assert.FatalError(t, db.SetCertificateStatus("1234", want))
+
+	st, err = db.GetCertificateStatus("1234")
+	assert.FatalError(t, err)
+	assert.Equals(t, want, st)
+
+	st, err = db.GetCertificateStatus("5678")
+	assert.FatalError(t, err)
+	assert.Equals(t, InventoryStatusActive, st.Status)
+
+	assert.Error(t, db.SetCertificateStatus("1234", &CertificateStatus{Status: "lost"}))
+}
+
+func TestDB_CertificateStatus_errors(t *testing.T) {
+	db := &DB{&MockNoSQLDB{
+		MGet: func(bucket, key []byte) ([]byte, error) {
+			if string(key) == "bad" {
+				return []byte("{!?}"), nil
+			}
+			return nil, errors.New("force")
+		},
+		MSet: func(bucket, key, value []byte) error {
+			return errors.New("force")
+		},
+	}, true}
+
+	_, err := db.GetCertificateStatus("1234")
+	assert.Error(t, err)
+	_, err = db.GetCertificateStatus("bad")
+	assert.Error(t, err)
+	assert.Error(t, db.SetCertificateStatus("1234", &CertificateStatus{Status: InventoryStatusRevoked}))
+}
@@ -0,0 +1,67 @@
+package db
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/nosql/database"
+)
+
+// rateLimitMaxRetries is the number of times the update of a rate limit
+// counter is retried if it is modified concurrently.
+const rateLimitMaxRetries = 10
+
+// RateLimitDB is an extension of AuthDB that keeps the counters used to
+// enforce the rate limits of the provisioners.
+type RateLimitDB interface {
+	IncrementRateLimitCounter(key string, window time.Duration) (*RateLimitCounter, error)
+}
+
+// RateLimitCounter is the number of requests done in a fixed window of time.
+// The window starts with the first request and ends at ResetAt.
+type RateLimitCounter struct {
+	Count   int64     `json:"count"`
+	ResetAt time.Time `json:"resetAt"`
+}
+
+// increment returns the counter after adding a new request at the given time.
+func (c *RateLimitCounter) increment(now time.Time, window time.Duration) *RateLimitCounter {
+	if c == nil || !now.Before(c.ResetAt) {
+		return &RateLimitCounter{Count: 1, ResetAt: now.Add(window)}
+	}
+	return &RateLimitCounter{Count: c.Count + 1, ResetAt: c.ResetAt}
+}
+
+// IncrementRateLimitCounter adds a request to the counter with the given key
+// and returns the updated counter. The counter is reset if the window has
+// elapsed.
+func (db *DB) IncrementRateLimitCounter(key string, window time.Duration) (*RateLimitCounter, error) {
+	for i := 0; i < rateLimitMaxRetries; i++ {
+		var old *RateLimitCounter
+		oldb, err := db.Get(rateLimitsTable, []byte(key))
+		switch {
+		case database.IsErrNotFound(err):
+			// First request, the counter does not exist yet.
+		case err != nil:
+			return nil, errors.Wrap(err, "database Get error")
+		default:
+			old = new(RateLimitCounter)
+			if err := json.Unmarshal(oldb, old); err != nil {
+				return nil, errors.Wrap(err, "error unmarshaling rate limit counter")
+			}
+		}
+
+		c := old.increment(time.Now(), window)
+		b, err := json.Marshal(c)
+		if err != nil {
+			return nil, errors.Wrap(err, "error marshaling rate limit counter")
+		}
+		if _, swapped, err := db.CmpAndSwap(rateLimitsTable, []byte(key), oldb, b); err != nil {
+			return nil, errors.Wrap(err, "database CmpAndSwap error")
+		} else if swapped {
+			return c, nil
+		}
+	}
+	return nil, errors.Errorf("error updating rate limit counter %s: too many concurrent updates", key)
+}
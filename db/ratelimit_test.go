@@ -0,0 +1,117 @@
+package db
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/smallstep/assert"
+	"github.com/smallstep/nosql/database"
+)
+
+func newRateLimitMockDB(m map[string][]byte) *DB {
+	return &DB{&MockNoSQLDB{
+		MGet: func(bucket, key []byte) ([]byte, error) {
+			if v, ok := m[string(key)]; ok {
+				return v, nil
+			}
+			return nil, database.ErrNotFound
+		},
+		MCmpAndSwap: func(bucket, key, old, newval []byte) ([]byte, bool, error) {
+			if v := m[string(key)]; !bytes.Equal(v, old) {
+				return v, false, nil
+			}
+			m[string(key)] = newval
+			return newval, true, nil
+		},
+	}, true}
+}
+
+func TestDB_IncrementRateLimitCounter(t *testing.T) {
+	m := map[string][]byte{}
+	db := newRateLimitMockDB(m)
+
+	before := time.Now()
+	for i := int64(1); i <= 3; i++ {
+		c, err := db.IncrementRateLimitCounter("tokens/prov", time.Minute)
+		assert.FatalError(t, err)
+		assert.Equals(t, i, c.Count)
+		assert.True(t, c.ResetAt.After(before.Add(59*time.Second)))
+		assert.True(t, c.ResetAt.Before(time.Now().Add(time.Minute+time.Second)))
+	}
+
+	// Other keys use a different counter.
+	c, err := db.IncrementRateLimitCounter("certs/prov", 24*time.Hour)
+	assert.FatalError(t, err)
+	assert.Equals(t, int64(1), c.Count)
+
+	// Expired counters are reset.
+	b, err := json.Marshal(RateLimitCounter{Count: 100, ResetAt: time.Now().Add(-time.Second)})
+	assert.FatalError(t, err)
+	m["tokens/prov"] = b
+	c, err = db.IncrementRateLimitCounter("tokens/prov", time.Minute)
+	assert.FatalError(t, err)
+	assert.Equals(t, int64(1), c.Count)
+}
+
+func TestDB_IncrementRateLimitCounter_concurrentUpdate(t *testing.T) {
+	var swaps int
+	db := &DB{&MockNoSQLDB{
+		MGet: func(bucket, key []byte) ([]byte, error) {
+			return nil, database.ErrNotFound
+		},
+		MCmpAndSwap: func(bucket, key, old, newval []byte) ([]byte, bool, error) {
+			swaps++
+			return nil, swaps == 3, nil
+		},
+	}, true}
+	c, err := db.IncrementRateLimitCounter("tokens/prov", time.Minute)
+	assert.FatalError(t, err)
+	assert.Equals(t, int64(1), c.Count)
+	assert.Equals(t, 3, swaps)
+
+	swaps = -100
+	_, err = db.IncrementRateLimitCounter("tokens/prov", time.Minute)
+	assert.Error(t, err)
+}
+
+func TestDB_IncrementRateLimitCounter_errors(t *testing.T) {
+	db := &DB{&MockNoSQLDB{
+		MGet: func(bucket, key []byte) ([]byte, error) {
+			return nil, errors.New("force")
+		},
+	}, true}
+	_, err := db.IncrementRateLimitCounter("tokens/prov", time.Minute)
+	assert.Error(t, err)
+
+	db = newRateLimitMockDB(map[string][]byte{"tokens/prov": []byte("not json")})
+	_, err = db.IncrementRateLimitCounter("tokens/prov", time.Minute)
+	assert.Error(t, err)
+
+	db = &DB{&MockNoSQLDB{
+		MGet: func(bucket, key []byte) ([]byte, error) {
+			return nil, database.ErrNotFound
+		},
+		MCmpAndSwap: func(bucket, key, old, newval []byte) ([]byte, bool, error) {
+			return nil, false, errors.New("force")
+		},
+	}, true}
+	_, err = db.IncrementRateLimitCounter("tokens/prov", time.Minute)
+	assert.Error(t, err)
+}
+
+func TestSimpleDB_IncrementRateLimitCounter(t *testing.T) {
+	db, err := newSimpleDB(nil)
+	assert.FatalError(t, err)
+	for i := int64(1); i <= 3; i++ {
+		c, err := db.IncrementRateLimitCounter("tokens/prov", time.Minute)
+		assert.FatalError(t, err)
+		assert.Equals(t, i, c.Count)
+	}
+	db.rateLimits["tokens/prov"].ResetAt = time.Now().Add(-time.Second)
+	c, err := db.IncrementRateLimitCounter("tokens/prov", time.Minute)
+	assert.FatalError(t, err)
+	assert.Equals(t, int64(1), c.Count)
+}
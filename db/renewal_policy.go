@@ -0,0 +1,132 @@
+package db
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/nosql/database"
+)
+
+// RenewalPolicyAction is the action taken when a certificate signed by a
+// deleted provisioner is renewed.
+type RenewalPolicyAction string
+
+const (
+	// RenewalPolicyDeny denies the renewal of the certificates.
+	RenewalPolicyDeny RenewalPolicyAction = "deny"
+	// RenewalPolicySunset allows the renewal of the certificates until the
+	// sunset date.
+	RenewalPolicySunset RenewalPolicyAction = "sunset"
+	// RenewalPolicyMigrate renews the certificates using a different
+	// provisioner.
+	RenewalPolicyMigrate RenewalPolicyAction = "migrate"
+)
+
+// RenewalPolicyDB is an extension of AuthDB that keeps the policies used to
+// renew the certificates of deleted provisioners.
+type RenewalPolicyDB interface {
+	GetRenewalPolicy(provisionerName string) (*RenewalPolicy, error)
+	GetRenewalPolicies() ([]*RenewalPolicy, error)
+	StoreRenewalPolicy(policy *RenewalPolicy) error
+	DeleteRenewalPolicy(provisionerName string) error
+}
+
+// RenewalPolicy defines how the certificates signed by a provisioner are
+// renewed after the provisioner has been deleted.
+type RenewalPolicy struct {
+	// Provisioner is the name of the provisioner.
+	Provisioner string `json:"provisioner"`
+	// Action is the action taken on renewals.
+	Action RenewalPolicyAction `json:"action"`
+	// SunsetAt is the time when renewals stop being allowed, it's only used
+	// with the sunset action.
+	SunsetAt time.Time `json:"sunsetAt,omitempty"`
+	// MigrateTo is the name of the provisioner used to renew the
+	// certificates, it's only used with the migrate action.
+	MigrateTo string `json:"migrateTo,omitempty"`
+}
+
+// Validate returns an error if the renewal policy is not valid.
+func (p *RenewalPolicy) Validate() error {
+	if p.Provisioner == "" {
+		return errors.New("renewal policy provisioner cannot be empty")
+	}
+	switch p.Action {
+	case RenewalPolicyDeny:
+	case RenewalPolicySunset:
+		if p.SunsetAt.IsZero() {
+			return errors.New("renewal policy sunsetAt is required with the sunset action")
+		}
+	case RenewalPolicyMigrate:
+		switch p.MigrateTo {
+		case "":
+			return errors.New("renewal policy migrateTo is required with the migrate action")
+		case p.Provisioner:
+			return errors.New("renewal policy migrateTo cannot be the same provisioner")
+		}
+	default:
+		return errors.Errorf("renewal policy action %q is not supported", p.Action)
+	}
+	return nil
+}
+
+// GetRenewalPolicy returns the renewal policy of the provisioner with the
+// given name. It returns nil if the provisioner does not have a policy.
+func (db *DB) GetRenewalPolicy(provisionerName string) (*RenewalPolicy, error) {
+	b, err := db.Get(renewalPoliciesTable, []byte(provisionerName))
+	switch {
+	case database.IsErrNotFound(err):
+		//nolint:nilnil // the provisioner does not have a policy
+		return nil, nil
+	case err != nil:
+		return nil, errors.Wrap(err, "database Get error")
+	}
+	p := new(RenewalPolicy)
+	if err := json.Unmarshal(b, p); err != nil {
+		return nil, errors.Wrap(err, "error unmarshaling renewal policy")
+	}
+	return p, nil
+}
+
+// GetRenewalPolicies returns all the renewal policies.
+func (db *DB) GetRenewalPolicies() ([]*RenewalPolicy, error) {
+	entries, err := db.List(renewalPoliciesTable)
+	if err != nil {
+		return nil, errors.Wrap(err, "database List error")
+	}
+	policies := make([]*RenewalPolicy, 0, len(entries))
+	for _, e := range entries {
+		p := new(RenewalPolicy)
+		if err := json.Unmarshal(e.Value, p); err != nil {
+			return nil, errors.Wrap(err, "error unmarshaling renewal policy")
+		}
+		policies = append(policies, p)
+	}
+	return policies, nil
+}
+
+// StoreRenewalPolicy stores the given renewal policy, replacing the previous
+// policy of the provisioner.
+func (db *DB) StoreRenewalPolicy(p *RenewalPolicy) error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	b, err := json.Marshal(p)
+	if err != nil {
+		return errors.Wrap(err, "error marshaling renewal policy")
+	}
+	if err := db.Set(renewalPoliciesTable, []byte(p.Provisioner), b); err != nil {
+		return errors.Wrap(err, "database Set error")
+	}
+	return nil
+}
+
+// DeleteRenewalPolicy deletes the renewal policy of the provisioner with the
+// given name.
+func (db *DB) DeleteRenewalPolicy(provisionerName string) error {
+	if err := db.Del(renewalPoliciesTable, []byte(provisionerName)); err != nil {
+		return errors.Wrap(err, "database Del error")
+	}
+	return nil
+}
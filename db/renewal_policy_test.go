@@ -0,0 +1,117 @@
+package db
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/smallstep/assert"
+	"github.com/smallstep/nosql/database"
+)
+
+func TestRenewalPolicy_Validate(t *testing.T) {
+	tests := map[string]struct {
+		policy  *RenewalPolicy
+		wantErr bool
+	}{
+		"ok/deny":           {&RenewalPolicy{Provisioner: "old", Action: RenewalPolicyDeny}, false},
+		"ok/sunset":         {&RenewalPolicy{Provisioner: "old", Action: RenewalPolicySunset, SunsetAt: time.Now()}, false},
+		"ok/migrate":        {&RenewalPolicy{Provisioner: "old", Action: RenewalPolicyMigrate, MigrateTo: "new"}, false},
+		"fail/provisioner":  {&RenewalPolicy{Action: RenewalPolicyDeny}, true},
+		"fail/action":       {&RenewalPolicy{Provisioner: "old", Action: "allow"}, true},
+		"fail/sunsetAt":     {&RenewalPolicy{Provisioner: "old", Action: RenewalPolicySunset}, true},
+		"fail/migrateTo":    {&RenewalPolicy{Provisioner: "old", Action: RenewalPolicyMigrate}, true},
+		"fail/migrate-self": {&RenewalPolicy{Provisioner: "old", Action: RenewalPolicyMigrate, MigrateTo: "old"}, true},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := tc.policy.Validate()
+			assert.Equals(t, tc.wantErr, err != nil)
+		})
+	}
+}
+
+func TestDB_RenewalPolicies(t *testing.T) {
+	m := map[string][]byte{}
+	db := &DB{&MockNoSQLDB{
+		MGet: func(bucket, key []byte) ([]byte, error) {
+			assert.Equals(t, renewalPoliciesTable, bucket)
+			if v, ok := m[string(key)]; ok {
+				return v, nil
+			}
+			return nil, database.ErrNotFound
+		},
+		MSet: func(bucket, key, value []byte) error {
+			assert.Equals(t, renewalPoliciesTable, bucket)
+			m[string(key)] = value
+			return nil
+		},
+		MDel: func(bucket, key []byte) error {
+			assert.Equals(t, renewalPoliciesTable, bucket)
+			delete(m, string(key))
+			return nil
+		},
+		MList: func(bucket []byte) ([]*database.Entry, error) {
+			assert.Equals(t, renewalPoliciesTable, bucket)
+			var entries []*database.Entry
+			for k, v := range m {
+				entries = append(entries, &database.Entry{Bucket: bucket, Key: []byte(k), Value: v})
+			}
+			return entries, nil
+		},
+	}, true}
+
+	p, err := db.GetRenewalPolicy("old")
+	assert.FatalError(t, err)
+	assert.Nil(t, p)
+
+	want := &RenewalPolicy{
+		Provisioner: "old",
+		Action:      RenewalPolicySunset,
+		SunsetAt:    time.Now().UTC().Truncate(time.Second),
+	}
+	assert.FatalError(t, db.StoreRenewalPolicy(want))
+	assert.Error(t, db.StoreRenewalPolicy(&RenewalPolicy{Provisioner: "old", Action: "allow"}))
+
+	p, err = db.GetRenewalPolicy("old")
+	assert.FatalError(t, err)
+	assert.Equals(t, want, p)
+
+	policies, err := db.GetRenewalPolicies()
+	assert.FatalError(t, err)
+	assert.Equals(t, []*RenewalPolicy{want}, policies)
+
+	assert.FatalError(t, db.DeleteRenewalPolicy("old"))
+	p, err = db.GetRenewalPolicy("old")
+	assert.FatalError(t, err)
+	assert.Nil(t, p)
+}
+
+func TestDB_RenewalPolicies_errors(t *testing.T) {
+	db := &DB{&MockNoSQLDB{
+		MGet: func(bucket, key []byte) ([]byte, error) {
+			if string(key) == "bad" {
+				return []byte("{!?}"), nil
+			}
+			return nil, errors.New("force")
+		},
+		MSet: func(bucket, key, value []byte) error {
+			return errors.New("force")
+		},
+		MDel: func(bucket, key []byte) error {
+			return errors.New("force")
+		},
+		MList: func(bucket []byte) ([]*database.Entry, error) {
+			return nil, errors.New("force")
+		},
+	}, true}
+
+	_, err := db.GetRenewalPolicy("old")
+	assert.Error(t, err)
+	_, err = db.GetRenewalPolicy("bad")
+	assert.Error(t, err)
+	_, err = db.GetRenewalPolicies()
+	assert.Error(t, err)
+	assert.Error(t, db.StoreRenewalPolicy(&RenewalPolicy{Provisioner: "old", Action: RenewalPolicyDeny}))
+	assert.Error(t, db.DeleteRenewalPolicy("old"))
+}
@@ -0,0 +1,102 @@
+package db
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+// SCEPChallengeDB is an extension of AuthDB that allows to store the dynamic
+// challenge passwords of SCEP provisioners.
+type SCEPChallengeDB interface {
+	StoreSCEPChallenge(ch *provisioner.SCEPDynamicChallenge) error
+	GetSCEPChallenges(provisionerID string) ([]*provisioner.SCEPDynamicChallenge, error)
+	ConsumeSCEPChallenge(provisionerID, id string, now time.Time) error
+	DeleteSCEPChallenge(provisionerID, id string) error
+}
+
+func scepChallengeKey(provisionerID, id string) []byte {
+	return []byte(provisionerID + "/" + id)
+}
+
+// StoreSCEPChallenge stores a SCEP dynamic challenge. It returns
+// ErrAlreadyExists if the challenge already exists for the provisioner.
+func (db *DB) StoreSCEPChallenge(ch *provisioner.SCEPDynamicChallenge) error {
+	b, err := json.Marshal(ch)
+	if err != nil {
+		return errors.Wrap(err, "error marshaling scep challenge")
+	}
+	_, swapped, err := db.CmpAndSwap(scepChallengesTable, scepChallengeKey(ch.ProvisionerID, ch.ID), nil, b)
+	switch {
+	case err != nil:
+		return errors.Wrap(err, "database CmpAndSwap error")
+	case !swapped:
+		return ErrAlreadyExists
+	default:
+		return nil
+	}
+}
+
+// GetSCEPChallenges returns all the dynamic challenges of the given
+// provisioner, including the used and expired ones.
+func (db *DB) GetSCEPChallenges(provisionerID string) ([]*provisioner.SCEPDynamicChallenge, error) {
+	entries, err := db.List(scepChallengesTable)
+	if err != nil {
+		return nil, errors.Wrap(err, "database List error")
+	}
+	var challenges []*provisioner.SCEPDynamicChallenge
+	for _, e := range entries {
+		ch := new(provisioner.SCEPDynamicChallenge)
+		if err := json.Unmarshal(e.Value, ch); err != nil {
+			return nil, errors.Wrap(err, "error unmarshaling scep challenge")
+		}
+		if ch.ProvisionerID == provisionerID {
+			challenges = append(challenges, ch)
+		}
+	}
+	return challenges, nil
+}
+
+// ConsumeSCEPChallenge marks the dynamic challenge with the given id as used.
+// It returns an error if the challenge does not exist, if it has expired, or
+// if it has already been used, also by a concurrent request.
+func (db *DB) ConsumeSCEPChallenge(provisionerID, id string, now time.Time) error {
+	key := scepChallengeKey(provisionerID, id)
+	old, err := db.Get(scepChallengesTable, key)
+	if err != nil {
+		return errors.Wrap(err, "database Get error")
+	}
+	var ch provisioner.SCEPDynamicChallenge
+	if err := json.Unmarshal(old, &ch); err != nil {
+		return errors.Wrap(err, "error unmarshaling scep challenge")
+	}
+	if err := ch.Validate(now); err != nil {
+		return err
+	}
+
+	ch.UsedAt = now
+	b, err := json.Marshal(ch)
+	if err != nil {
+		return errors.Wrap(err, "error marshaling scep challenge")
+	}
+	_, swapped, err := db.CmpAndSwap(scepChallengesTable, key, old, b)
+	switch {
+	case err != nil:
+		return errors.Wrap(err, "database CmpAndSwap error")
+	case !swapped:
+		return errors.New("challenge password has already been used")
+	default:
+		return nil
+	}
+}
+
+// DeleteSCEPChallenge deletes the dynamic challenge with the given id of the
+// given provisioner.
+func (db *DB) DeleteSCEPChallenge(provisionerID, id string) error {
+	if err := db.Del(scepChallengesTable, scepChallengeKey(provisionerID, id)); err != nil {
+		return errors.Wrap(err, "database Del error")
+	}
+	return nil
+}
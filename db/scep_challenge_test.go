@@ -0,0 +1,73 @@
+package db
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/smallstep/assert"
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/nosql/database"
+)
+
+func TestDB_SCEPChallenges(t *testing.T) {
+	db := newWebAuthnMockDB()
+	now := time.Now().UTC().Truncate(time.Second)
+	ch1 := &provisioner.SCEPDynamicChallenge{ID: "id1", ProvisionerID: "prov1", CreatedAt: now, ExpiresAt: now.Add(time.Hour)}
+	ch2 := &provisioner.SCEPDynamicChallenge{ID: "id2", ProvisionerID: "prov1", CreatedAt: now, ExpiresAt: now.Add(time.Minute)}
+	ch3 := &provisioner.SCEPDynamicChallenge{ID: "id1", ProvisionerID: "prov2", CreatedAt: now, ExpiresAt: now.Add(time.Hour)}
+
+	assert.FatalError(t, db.StoreSCEPChallenge(ch1))
+	assert.FatalError(t, db.StoreSCEPChallenge(ch2))
+	assert.FatalError(t, db.StoreSCEPChallenge(ch3))
+	assert.Equals(t, ErrAlreadyExists, db.StoreSCEPChallenge(ch1))
+
+	challenges, err := db.GetSCEPChallenges("prov1")
+	assert.FatalError(t, err)
+	assert.Len(t, 2, challenges)
+
+	// Challenges can only be used once.
+	assert.FatalError(t, db.ConsumeSCEPChallenge("prov1", "id1", now))
+	assert.Error(t, db.ConsumeSCEPChallenge("prov1", "id1", now))
+	assert.FatalError(t, db.ConsumeSCEPChallenge("prov2", "id1", now))
+
+	// Expired challenges cannot be used.
+	assert.Error(t, db.ConsumeSCEPChallenge("prov1", "id2", now.Add(time.Minute)))
+
+	err = db.ConsumeSCEPChallenge("prov1", "id3", now)
+	assert.True(t, database.IsErrNotFound(err))
+
+	assert.FatalError(t, db.DeleteSCEPChallenge("prov1", "id1"))
+	challenges, err = db.GetSCEPChallenges("prov1")
+	assert.FatalError(t, err)
+	assert.Equals(t, []*provisioner.SCEPDynamicChallenge{ch2}, challenges)
+}
+
+func TestDB_ConsumeSCEPChallenge_concurrent(t *testing.T) {
+	db := &DB{&MockNoSQLDB{
+		MGet: func(bucket, key []byte) ([]byte, error) {
+			return []byte(`{"id":"id1","provisionerID":"prov1","expiresAt":"2100-01-01T00:00:00Z"}`), nil
+		},
+		MCmpAndSwap: func(bucket, key, old, newval []byte) ([]byte, bool, error) {
+			return []byte(`{"id":"id1","provisionerID":"prov1","expiresAt":"2100-01-01T00:00:00Z","usedAt":"2024-01-01T00:00:00Z"}`), false, nil
+		},
+	}, true}
+	err := db.ConsumeSCEPChallenge("prov1", "id1", time.Now())
+	assert.Equals(t, "challenge password has already been used", err.Error())
+}
+
+func TestDB_SCEPChallenges_fail(t *testing.T) {
+	db := &DB{&MockNoSQLDB{
+		Err: errors.New("force"),
+		MList: func(bucket []byte) ([]*database.Entry, error) {
+			return nil, errors.New("force")
+		},
+	}, true}
+	ch := &provisioner.SCEPDynamicChallenge{ID: "id1", ProvisionerID: "prov1", ExpiresAt: time.Now().Add(time.Hour)}
+
+	assert.Error(t, db.StoreSCEPChallenge(ch))
+	_, err := db.GetSCEPChallenges("prov1")
+	assert.Error(t, err)
+	assert.Error(t, db.ConsumeSCEPChallenge("prov1", "id1", time.Now()))
+	assert.Error(t, db.DeleteSCEPChallenge("prov1", "id1"))
+}
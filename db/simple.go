@@ -18,11 +18,14 @@ var ErrNotImplemented = errors.Errorf("not implemented")
 // functionality that the CA requires to operate securely.
 type SimpleDB struct {
 	usedTokens *sync.Map
+	rateLimits map[string]*RateLimitCounter
+	mu         sync.Mutex
 }
 
 func newSimpleDB(*Config) (*SimpleDB, error) {
 	db := &SimpleDB{}
 	db.usedTokens = new(sync.Map)
+	db.rateLimits = make(map[string]*RateLimitCounter)
 	return db, nil
 }
 
@@ -89,6 +92,16 @@ func (s *SimpleDB) UseToken(id, tok string) (bool, error) {
 	return true, nil
 }
 
+// IncrementRateLimitCounter adds a request to the in-memory counter with the
+// given key and returns the updated counter.
+func (s *SimpleDB) IncrementRateLimitCounter(key string, window time.Duration) (*RateLimitCounter, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c := s.rateLimits[key].increment(time.Now(), window)
+	s.rateLimits[key] = c
+	return c, nil
+}
+
 // IsSSHHost returns a "NotImplemented" error.
 func (s *SimpleDB) IsSSHHost(string) (bool, error) {
 	return false, ErrNotImplemented
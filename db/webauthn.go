@@ -0,0 +1,118 @@
+package db
+
+import (
+	"encoding/json"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+// WebAuthnCredentialDB is an extension of AuthDB that allows to store the
+// WebAuthn credentials registered for WebAuthn provisioners.
+type WebAuthnCredentialDB interface {
+	StoreWebAuthnCredential(cred *provisioner.WebAuthnCredential) error
+	GetWebAuthnCredential(provisionerID, credentialID string) (*provisioner.WebAuthnCredential, error)
+	GetWebAuthnCredentials(provisionerID string) ([]*provisioner.WebAuthnCredential, error)
+	UpdateWebAuthnCredentialSignCount(provisionerID, credentialID string, signCount uint32) error
+	DeleteWebAuthnCredential(provisionerID, credentialID string) error
+}
+
+func webAuthnCredentialKey(provisionerID, credentialID string) []byte {
+	return []byte(provisionerID + "/" + credentialID)
+}
+
+// StoreWebAuthnCredential stores a WebAuthn credential. It returns
+// ErrAlreadyExists if the credential is already registered for the
+// provisioner.
+func (db *DB) StoreWebAuthnCredential(cred *provisioner.WebAuthnCredential) error {
+	b, err := json.Marshal(cred)
+	if err != nil {
+		return errors.Wrap(err, "error marshaling webauthn credential")
+	}
+	_, swapped, err := db.CmpAndSwap(webAuthnCredsTable, webAuthnCredentialKey(cred.ProvisionerID, cred.ID), nil, b)
+	switch {
+	case err != nil:
+		return errors.Wrap(err, "database CmpAndSwap error")
+	case !swapped:
+		return ErrAlreadyExists
+	default:
+		return nil
+	}
+}
+
+// GetWebAuthnCredential returns the WebAuthn credential with the given id
+// registered for the given provisioner.
+func (db *DB) GetWebAuthnCredential(provisionerID, credentialID string) (*provisioner.WebAuthnCredential, error) {
+	b, err := db.Get(webAuthnCredsTable, webAuthnCredentialKey(provisionerID, credentialID))
+	if err != nil {
+		return nil, errors.Wrap(err, "database Get error")
+	}
+	var cred provisioner.WebAuthnCredential
+	if err := json.Unmarshal(b, &cred); err != nil {
+		return nil, errors.Wrap(err, "error unmarshaling webauthn credential")
+	}
+	return &cred, nil
+}
+
+// GetWebAuthnCredentials returns all the WebAuthn credentials registered for
+// the given provisioner.
+func (db *DB) GetWebAuthnCredentials(provisionerID string) ([]*provisioner.WebAuthnCredential, error) {
+	entries, err := db.List(webAuthnCredsTable)
+	if err != nil {
+		return nil, errors.Wrap(err, "database List error")
+	}
+	var creds []*provisioner.WebAuthnCredential
+	for _, e := range entries {
+		cred := new(provisioner.WebAuthnCredential)
+		if err := json.Unmarshal(e.Value, cred); err != nil {
+			return nil, errors.Wrap(err, "error unmarshaling webauthn credential")
+		}
+		if cred.ProvisionerID == provisionerID {
+			creds = append(creds, cred)
+		}
+	}
+	return creds, nil
+}
+
+// UpdateWebAuthnCredentialSignCount updates the signature counter of the
+// WebAuthn credential with the given id registered for the given provisioner.
+// It returns an error if the counter does not increase the stored one, or if
+// the credential is updated concurrently.
+func (db *DB) UpdateWebAuthnCredentialSignCount(provisionerID, credentialID string, signCount uint32) error {
+	key := webAuthnCredentialKey(provisionerID, credentialID)
+	old, err := db.Get(webAuthnCredsTable, key)
+	if err != nil {
+		return errors.Wrap(err, "database Get error")
+	}
+	var cred provisioner.WebAuthnCredential
+	if err := json.Unmarshal(old, &cred); err != nil {
+		return errors.Wrap(err, "error unmarshaling webauthn credential")
+	}
+	if err := cred.CheckSignCount(signCount); err != nil {
+		return err
+	}
+
+	cred.SignCount = signCount
+	b, err := json.Marshal(cred)
+	if err != nil {
+		return errors.Wrap(err, "error marshaling webauthn credential")
+	}
+	_, swapped, err := db.CmpAndSwap(webAuthnCredsTable, key, old, b)
+	switch {
+	case err != nil:
+		return errors.Wrap(err, "database CmpAndSwap error")
+	case !swapped:
+		return errors.Errorf("webauthn credential %s was updated concurrently", credentialID)
+	default:
+		return nil
+	}
+}
+
+// DeleteWebAuthnCredential deletes the WebAuthn credential with the given id
+// registered for the given provisioner.
+func (db *DB) DeleteWebAuthnCredential(provisionerID, credentialID string) error {
+	if err := db.Del(webAuthnCredsTable, webAuthnCredentialKey(provisionerID, credentialID)); err != nil {
+		return errors.Wrap(err, "database Del error")
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package db
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/smallstep/assert"
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/nosql/database"
+)
+
+func newWebAuthnMockDB() *DB {
+	m := map[string][]byte{}
+	return &DB{&MockNoSQLDB{
+		MCmpAndSwap: func(bucket, key, old, newval []byte) ([]byte, bool, error) {
+			if v, ok := m[string(key)]; ok != (old != nil) || !bytes.Equal(v, old) {
+				return v, false, nil
+			}
+			m[string(key)] = newval
+			return newval, true, nil
+		},
+		MGet: func(bucket, key []byte) ([]byte, error) {
+			if v, ok := m[string(key)]; ok {
+				return v, nil
+			}
+			return nil, database.ErrNotFound
+		},
+		MList: func(bucket []byte) ([]*database.Entry, error) {
+			var entries []*database.Entry
+			for k, v := range m {
+				entries = append(entries, &database.Entry{Bucket: bucket, Key: []byte(k), Value: v})
+			}
+			return entries, nil
+		},
+		MDel: func(bucket, key []byte) error {
+			delete(m, string(key))
+			return nil
+		},
+	}, true}
+}
+
+func TestDB_WebAuthnCredentials(t *testing.T) {
+	db := newWebAuthnMockDB()
+	cred1 := &provisioner.WebAuthnCredential{ID: "Y3JlZDE", ProvisionerID: "prov1", Subject: "jane", PublicKey: []byte("key1")}
+	cred2 := &provisioner.WebAuthnCredential{ID: "Y3JlZDI", ProvisionerID: "prov1", Subject: "joe", PublicKey: []byte("key2")}
+	cred3 := &provisioner.WebAuthnCredential{ID: "Y3JlZDE", ProvisionerID: "prov2", Subject: "jane", PublicKey: []byte("key3")}
+
+	assert.FatalError(t, db.StoreWebAuthnCredential(cred1))
+	assert.FatalError(t, db.StoreWebAuthnCredential(cred2))
+	assert.FatalError(t, db.StoreWebAuthnCredential(cred3))
+	assert.Equals(t, ErrAlreadyExists, db.StoreWebAuthnCredential(cred1))
+
+	got, err := db.GetWebAuthnCredential("prov2", "Y3JlZDE")
+	assert.FatalError(t, err)
+	assert.Equals(t, cred3, got)
+
+	_, err = db.GetWebAuthnCredential("prov2", "Y3JlZDI")
+	assert.True(t, database.IsErrNotFound(err))
+
+	creds, err := db.GetWebAuthnCredentials("prov1")
+	assert.FatalError(t, err)
+	assert.Len(t, 2, creds)
+
+	assert.FatalError(t, db.DeleteWebAuthnCredential("prov1", "Y3JlZDE"))
+	creds, err = db.GetWebAuthnCredentials("prov1")
+	assert.FatalError(t, err)
+	assert.Equals(t, []*provisioner.WebAuthnCredential{cred2}, creds)
+}
+
+func TestDB_UpdateWebAuthnCredentialSignCount(t *testing.T) {
+	db := newWebAuthnMockDB()
+	cred := &provisioner.WebAuthnCredential{ID: "Y3JlZDE", ProvisionerID: "prov1", Subject: "jane", PublicKey: []byte("key1")}
+	assert.FatalError(t, db.StoreWebAuthnCredential(cred))
+
+	assert.FatalError(t, db.UpdateWebAuthnCredentialSignCount("prov1", "Y3JlZDE", 0))
+	assert.FatalError(t, db.UpdateWebAuthnCredentialSignCount("prov1", "Y3JlZDE", 5))
+	assert.Error(t, db.UpdateWebAuthnCredentialSignCount("prov1", "Y3JlZDE", 5))
+	assert.Error(t, db.UpdateWebAuthnCredentialSignCount("prov1", "Y3JlZDE", 4))
+	assert.Error(t, db.UpdateWebAuthnCredentialSignCount("prov1", "Y3JlZDE", 0))
+	assert.FatalError(t, db.UpdateWebAuthnCredentialSignCount("prov1", "Y3JlZDE", 6))
+
+	got, err := db.GetWebAuthnCredential("prov1", "Y3JlZDE")
+	assert.FatalError(t, err)
+	assert.Equals(t, uint32(6), got.SignCount)
+
+	err = db.UpdateWebAuthnCredentialSignCount("prov1", "Y3JlZDI", 1)
+	assert.True(t, database.IsErrNotFound(err))
+
+	// Concurrent update.
+	db = &DB{&MockNoSQLDB{
+		MGet: func(bucket, key []byte) ([]byte, error) {
+			return []byte(`{"id":"Y3JlZDE","provisionerID":"prov1","subject":"jane","publicKey":"a2V5MQ==","signCount":1}`), nil
+		},
+		MCmpAndSwap: func(bucket, key, old, newval []byte) ([]byte, bool, error) {
+			return []byte(`{"id":"Y3JlZDE","provisionerID":"prov1","subject":"jane","publicKey":"a2V5MQ==","signCount":2}`), false, nil
+		},
+	}, true}
+	assert.Error(t, db.UpdateWebAuthnCredentialSignCount("prov1", "Y3JlZDE", 2))
+}
+
+func TestDB_WebAuthnCredentials_fail(t *testing.T) {
+	db := &DB{&MockNoSQLDB{
+		Err: errors.New("force"),
+		MList: func(bucket []byte) ([]*database.Entry, error) {
+			return nil, errors.New("force")
+		},
+	}, true}
+	cred := &provisioner.WebAuthnCredential{ID: "Y3JlZDE", ProvisionerID: "prov1", Subject: "jane", PublicKey: []byte("key1")}
+
+	assert.Error(t, db.StoreWebAuthnCredential(cred))
+	_, err := db.GetWebAuthnCredential("prov1", "Y3JlZDE")
+	assert.Error(t, err)
+	_, err = db.GetWebAuthnCredentials("prov1")
+	assert.Error(t, err)
+	assert.Error(t, db.DeleteWebAuthnCredential("prov1", "Y3JlZDE"))
+}
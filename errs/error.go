@@ -67,6 +67,11 @@ func (e *Error) Cause() error {
 	return e.Err
 }
 
+// Unwrap returns the original error.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
 // Error implements the error interface and returns the error string.
 func (e *Error) Error() string {
 	return e.Err.Error()
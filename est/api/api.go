@@ -0,0 +1,416 @@
+// Package api implements an EST (RFC 7030) HTTP server.
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/smallstep/pkcs7"
+
+	"go.step.sm/crypto/x509util"
+
+	"github.com/smallstep/certificates/api"
+	"github.com/smallstep/certificates/api/log"
+	"github.com/smallstep/certificates/authority"
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+const maxPayloadSize = 2 << 20
+
+const (
+	certsOnlyContentType = "application/pkcs7-mime; smime-type=certs-only"
+	pkcs8ContentType     = "application/pkcs8"
+)
+
+// Authority is the interface used by the EST handlers.
+type Authority interface {
+	LoadProvisionerByName(string) (provisioner.Interface, error)
+	GetRootCertificates() []*x509.Certificate
+	GetIntermediateCertificates() []*x509.Certificate
+	SignWithContext(ctx context.Context, csr *x509.CertificateRequest, signOpts provisioner.SignOptions, extraOpts ...provisioner.SignOption) ([]*x509.Certificate, error)
+	IsRevoked(sn string) (bool, error)
+}
+
+var mustAuthority = func(ctx context.Context) Authority {
+	return authority.MustFromContext(ctx)
+}
+
+// Error is an EST error with an HTTP status code.
+type Error struct {
+	Status int
+	Err    error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func newError(status int, format string, args ...any) *Error {
+	return &Error{Status: status, Err: fmt.Errorf(format, args...)}
+}
+
+// Route traffic and implement the Router interface. The routes are mounted
+// in /.well-known/est, and the label of the EST path is the name of the
+// provisioner.
+func Route(r api.Router) {
+	r.MethodFunc(http.MethodGet, "/{provisionerName}/cacerts", lookupProvisioner(CACerts))
+	r.MethodFunc(http.MethodPost, "/{provisionerName}/simpleenroll", lookupProvisioner(SimpleEnroll))
+	r.MethodFunc(http.MethodPost, "/{provisionerName}/simplereenroll", lookupProvisioner(SimpleReenroll))
+	r.MethodFunc(http.MethodPost, "/{provisionerName}/serverkeygen", lookupProvisioner(ServerKeyGen))
+}
+
+type provisionerKey struct{}
+
+func provisionerFromContext(ctx context.Context) *provisioner.EST {
+	p, ok := ctx.Value(provisionerKey{}).(*provisioner.EST)
+	if !ok {
+		panic("est provisioner expected in request context")
+	}
+	return p
+}
+
+// lookupProvisioner loads the EST provisioner in the request path and stores
+// it in the context.
+func lookupProvisioner(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := chi.URLParam(r, "provisionerName")
+		p, err := mustAuthority(r.Context()).LoadProvisionerByName(name)
+		if err != nil {
+			fail(w, r, newError(http.StatusNotFound, "provisioner %q not found", name))
+			return
+		}
+		prov, ok := p.(*provisioner.EST)
+		if !ok {
+			fail(w, r, newError(http.StatusNotFound, "provisioner %q is not an est provisioner", name))
+			return
+		}
+		ctx := context.WithValue(r.Context(), provisionerKey{}, prov)
+		next(w, r.WithContext(ctx))
+	}
+}
+
+// CACerts returns the CA intermediates and roots.
+func CACerts(w http.ResponseWriter, r *http.Request) {
+	a := mustAuthority(r.Context())
+	certs := append([]*x509.Certificate{}, a.GetIntermediateCertificates()...)
+	certs = append(certs, a.GetRootCertificates()...)
+
+	data, err := degenerateCertificates(certs)
+	if err != nil {
+		fail(w, r, err)
+		return
+	}
+	writeBase64(w, certsOnlyContentType, http.StatusOK, data)
+}
+
+// SimpleEnroll signs a certificate request authenticated using HTTP Basic
+// authentication or a TLS client certificate.
+func SimpleEnroll(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	csr, err := readCertificateRequest(r)
+	if err != nil {
+		fail(w, r, err)
+		return
+	}
+	if err := authorizeEnroll(ctx, r, csr); err != nil {
+		fail(w, r, err)
+		return
+	}
+	chain, err := sign(ctx, csr)
+	if err != nil {
+		fail(w, r, err)
+		return
+	}
+	data, err := degenerateCertificates(chain)
+	if err != nil {
+		fail(w, r, err)
+		return
+	}
+	writeBase64(w, certsOnlyContentType, http.StatusOK, data)
+}
+
+// SimpleReenroll signs a certificate request authenticated using the TLS
+// client certificate to renew.
+func SimpleReenroll(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	cert, err := verifiedPeerCertificate(ctx, r)
+	if err != nil {
+		fail(w, r, err)
+		return
+	}
+	csr, err := readCertificateRequest(r)
+	if err != nil {
+		fail(w, r, err)
+		return
+	}
+	if err := provisionerFromContext(ctx).AuthorizeReenroll(ctx, csr, cert); err != nil {
+		fail(w, r, &Error{Status: http.StatusForbidden, Err: err})
+		return
+	}
+	chain, err := sign(ctx, csr)
+	if err != nil {
+		fail(w, r, err)
+		return
+	}
+	data, err := degenerateCertificates(chain)
+	if err != nil {
+		fail(w, r, err)
+		return
+	}
+	writeBase64(w, certsOnlyContentType, http.StatusOK, data)
+}
+
+// ServerKeyGen generates a new key and signs a certificate for it using the
+// subject and names in the certificate request. The response contains the
+// PKCS #8 private key and the certificate.
+func ServerKeyGen(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	p := provisionerFromContext(ctx)
+	if !p.IsServerKeyGenEnabled() {
+		fail(w, r, newError(http.StatusNotImplemented, "provisioner %q does not support serverkeygen", p.GetName()))
+		return
+	}
+	csr, err := readCertificateRequest(r)
+	if err != nil {
+		fail(w, r, err)
+		return
+	}
+	if err := authorizeEnroll(ctx, r, csr); err != nil {
+		fail(w, r, err)
+		return
+	}
+
+	key, err := p.ServerKeyGen.GenerateKey()
+	if err != nil {
+		fail(w, r, err)
+		return
+	}
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:        csr.Subject,
+		DNSNames:       csr.DNSNames,
+		EmailAddresses: csr.EmailAddresses,
+		IPAddresses:    csr.IPAddresses,
+		URIs:           csr.URIs,
+	}, key)
+	if err != nil {
+		fail(w, r, fmt.Errorf("error creating certificate request: %w", err))
+		return
+	}
+	if csr, err = x509.ParseCertificateRequest(der); err != nil {
+		fail(w, r, fmt.Errorf("error parsing certificate request: %w", err))
+		return
+	}
+
+	chain, err := sign(ctx, csr)
+	if err != nil {
+		fail(w, r, err)
+		return
+	}
+	certs, err := degenerateCertificates(chain)
+	if err != nil {
+		fail(w, r, err)
+		return
+	}
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		fail(w, r, fmt.Errorf("error marshaling private key: %w", err))
+		return
+	}
+
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	for _, part := range []struct {
+		contentType string
+		data        []byte
+	}{
+		{pkcs8ContentType, pkcs8},
+		{certsOnlyContentType, certs},
+	} {
+		pw, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"base64"},
+		})
+		if err != nil {
+			fail(w, r, err)
+			return
+		}
+		if _, err := pw.Write([]byte(base64.StdEncoding.EncodeToString(part.data))); err != nil {
+			fail(w, r, err)
+			return
+		}
+	}
+	if err := mw.Close(); err != nil {
+		fail(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "multipart/mixed; boundary="+mw.Boundary())
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
+
+// authorizeEnroll authenticates an enrollment request using the TLS client
+// certificate, if the provisioner allows it and one was sent, or HTTP Basic
+// authentication.
+func authorizeEnroll(ctx context.Context, r *http.Request, csr *x509.CertificateRequest) error {
+	p := provisionerFromContext(ctx)
+	if p.ClientCertificates && r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+		if _, err := verifiedPeerCertificate(ctx, r); err != nil {
+			return err
+		}
+		if err := p.AuthorizeClientCertificate(ctx, r.TLS.VerifiedChains, csr); err != nil {
+			return &Error{Status: http.StatusForbidden, Err: err}
+		}
+		return nil
+	}
+
+	username, password, ok := r.BasicAuth()
+	if !ok {
+		return newError(http.StatusUnauthorized, "request is not authenticated")
+	}
+	if err := p.AuthorizeBasicAuth(ctx, username, password); err != nil {
+		return &Error{Status: http.StatusUnauthorized, Err: err}
+	}
+	return nil
+}
+
+// verifiedPeerCertificate returns the TLS client certificate of the request
+// if it has been verified and it is not revoked.
+func verifiedPeerCertificate(ctx context.Context, r *http.Request) (*x509.Certificate, error) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+		return nil, newError(http.StatusUnauthorized, "request does not have a verified client certificate")
+	}
+	cert := r.TLS.VerifiedChains[0][0]
+	revoked, err := mustAuthority(ctx).IsRevoked(cert.SerialNumber.String())
+	switch {
+	case err != nil:
+		return nil, fmt.Errorf("error checking certificate revocation: %w", err)
+	case revoked:
+		return nil, newError(http.StatusForbidden, "client certificate has been revoked")
+	}
+	return cert, nil
+}
+
+// readCertificateRequest reads the base64 encoded PKCS #10 certificate
+// request in the body.
+func readCertificateRequest(r *http.Request) (*x509.CertificateRequest, error) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxPayloadSize))
+	if err != nil {
+		return nil, newError(http.StatusBadRequest, "error reading request body: %w", err)
+	}
+	der, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(string(body)), ""))
+	if err != nil {
+		return nil, newError(http.StatusBadRequest, "error decoding certificate request: %w", err)
+	}
+	csr, err := x509.ParseCertificateRequest(der)
+	if err != nil {
+		return nil, newError(http.StatusBadRequest, "error parsing certificate request: %w", err)
+	}
+	if err := csr.CheckSignature(); err != nil {
+		return nil, newError(http.StatusBadRequest, "invalid certificate request signature: %w", err)
+	}
+	return csr, nil
+}
+
+// sign signs the certificate request with the provisioner in the context.
+func sign(ctx context.Context, csr *x509.CertificateRequest) ([]*x509.Certificate, error) {
+	p := provisionerFromContext(ctx)
+
+	sans := append([]string{}, csr.DNSNames...)
+	sans = append(sans, csr.EmailAddresses...)
+	for _, v := range csr.IPAddresses {
+		sans = append(sans, v.String())
+	}
+	for _, v := range csr.URIs {
+		sans = append(sans, v.String())
+	}
+	if len(sans) == 0 {
+		sans = append(sans, csr.Subject.CommonName)
+	}
+	data := x509util.CreateTemplateData(csr.Subject.CommonName, sans)
+	data.SetCertificateRequest(csr)
+	data.SetSubject(x509util.Subject{
+		Country:            csr.Subject.Country,
+		Organization:       csr.Subject.Organization,
+		OrganizationalUnit: csr.Subject.OrganizationalUnit,
+		Locality:           csr.Subject.Locality,
+		Province:           csr.Subject.Province,
+		StreetAddress:      csr.Subject.StreetAddress,
+		PostalCode:         csr.Subject.PostalCode,
+		SerialNumber:       csr.Subject.SerialNumber,
+		CommonName:         csr.Subject.CommonName,
+	})
+
+	ctx = provisioner.NewContextWithMethod(ctx, provisioner.SignMethod)
+	signOps, err := p.AuthorizeSign(ctx, "")
+	if err != nil {
+		return nil, &Error{Status: http.StatusForbidden, Err: err}
+	}
+	for _, signOp := range signOps {
+		if wc, ok := signOp.(*provisioner.WebhookController); ok {
+			wc.TemplateData = data
+		}
+	}
+	templateOptions, err := provisioner.TemplateOptions(p.GetOptions(), data)
+	if err != nil {
+		return nil, fmt.Errorf("error creating template options from EST provisioner: %w", err)
+	}
+	signOps = append(signOps, templateOptions)
+
+	chain, err := mustAuthority(ctx).SignWithContext(ctx, csr, provisioner.SignOptions{}, signOps...)
+	if err != nil {
+		return nil, &Error{Status: http.StatusBadRequest, Err: fmt.Errorf("error generating certificate: %w", err)}
+	}
+	return chain, nil
+}
+
+// degenerateCertificates returns a certs-only PKCS #7 SignedData structure
+// with the given certificates.
+func degenerateCertificates(certs []*x509.Certificate) ([]byte, error) {
+	var raw []byte
+	for _, c := range certs {
+		raw = append(raw, c.Raw...)
+	}
+	data, err := pkcs7.DegenerateCertificate(raw)
+	if err != nil {
+		return nil, fmt.Errorf("error creating certs-only response: %w", err)
+	}
+	return data, nil
+}
+
+func writeBase64(w http.ResponseWriter, contentType string, status int, data []byte) {
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Transfer-Encoding", "base64")
+	w.WriteHeader(status)
+	w.Write([]byte(base64.StdEncoding.EncodeToString(data)))
+}
+
+// fail writes the error as a plain text response.
+func fail(w http.ResponseWriter, r *http.Request, err error) {
+	log.Error(w, r, err)
+
+	status := http.StatusInternalServerError
+	var estErr *Error
+	if errors.As(err, &estErr) {
+		status = estErr.Status
+	}
+	if status == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", `Basic realm="step-ca"`)
+	}
+	http.Error(w, err.Error(), status)
+}
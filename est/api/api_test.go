@@ -0,0 +1,335 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/smallstep/pkcs7"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.step.sm/crypto/keyutil"
+	"go.step.sm/crypto/minica"
+
+	"github.com/smallstep/certificates/authority/config"
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+type mockAuthority struct {
+	ca          *minica.CA
+	provisioner provisioner.Interface
+	revoked     map[string]bool
+}
+
+func (m *mockAuthority) LoadProvisionerByName(name string) (provisioner.Interface, error) {
+	if m.provisioner == nil || m.provisioner.GetName() != name {
+		return nil, errors.New("not found")
+	}
+	return m.provisioner, nil
+}
+
+func (m *mockAuthority) GetRootCertificates() []*x509.Certificate {
+	return []*x509.Certificate{m.ca.Root}
+}
+
+func (m *mockAuthority) GetIntermediateCertificates() []*x509.Certificate {
+	return []*x509.Certificate{m.ca.Intermediate}
+}
+
+func (m *mockAuthority) SignWithContext(_ context.Context, csr *x509.CertificateRequest, _ provisioner.SignOptions, _ ...provisioner.SignOption) ([]*x509.Certificate, error) {
+	ext, err := (&provisioner.Extension{Type: provisioner.TypeEST, Name: m.provisioner.GetName()}).ToExtension()
+	if err != nil {
+		return nil, err
+	}
+	cert, err := m.ca.Sign(&x509.Certificate{
+		Subject:         csr.Subject,
+		DNSNames:        csr.DNSNames,
+		PublicKey:       csr.PublicKey,
+		NotBefore:       time.Now().Add(-time.Minute),
+		NotAfter:        time.Now().Add(time.Hour),
+		ExtraExtensions: []pkix.Extension{ext},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return []*x509.Certificate{cert, m.ca.Intermediate}, nil
+}
+
+func (m *mockAuthority) IsRevoked(sn string) (bool, error) {
+	return m.revoked[sn], nil
+}
+
+func mockMustAuthority(t *testing.T, a Authority) {
+	t.Helper()
+	fn := mustAuthority
+	t.Cleanup(func() {
+		mustAuthority = fn
+	})
+	mustAuthority = func(context.Context) Authority {
+		return a
+	}
+}
+
+func newCSR(t *testing.T, cn string, dnsNames ...string) (*x509.CertificateRequest, crypto.Signer) {
+	t.Helper()
+	key, err := keyutil.GenerateDefaultSigner()
+	require.NoError(t, err)
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: cn},
+		DNSNames: dnsNames,
+	}, key)
+	require.NoError(t, err)
+	csr, err := x509.ParseCertificateRequest(der)
+	require.NoError(t, err)
+	return csr, key
+}
+
+func newRouter() http.Handler {
+	r := chi.NewRouter()
+	r.Route("/.well-known/est", func(r chi.Router) {
+		Route(r)
+	})
+	return r
+}
+
+func parseCertsOnly(t *testing.T, body []byte) []*x509.Certificate {
+	t.Helper()
+	der, err := base64.StdEncoding.DecodeString(string(body))
+	require.NoError(t, err)
+	p7, err := pkcs7.Parse(der)
+	require.NoError(t, err)
+	return p7.Certificates
+}
+
+func newEST(t *testing.T, ca *minica.CA) *provisioner.EST {
+	t.Helper()
+	p := &provisioner.EST{
+		Type:                   "EST",
+		Name:                   "est",
+		BasicAuth:              &provisioner.ESTBasicAuth{Username: "user", Password: "pass"},
+		ClientCertificates:     true,
+		ClientCertificateRoots: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Root.Raw}),
+		ServerKeyGen:           &provisioner.ESTServerKeyGenOptions{},
+	}
+	require.NoError(t, p.Init(provisioner.Config{Claims: config.GlobalProvisionerClaims}))
+	return p
+}
+
+func TestCACerts(t *testing.T) {
+	ca, err := minica.New()
+	require.NoError(t, err)
+	mockMustAuthority(t, &mockAuthority{ca: ca, provisioner: newEST(t, ca)})
+
+	w := httptest.NewRecorder()
+	newRouter().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/.well-known/est/est/cacerts", http.NoBody))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, certsOnlyContentType, w.Header().Get("Content-Type"))
+	assert.Equal(t, "base64", w.Header().Get("Content-Transfer-Encoding"))
+	assert.Equal(t, []*x509.Certificate{ca.Intermediate, ca.Root}, parseCertsOnly(t, w.Body.Bytes()))
+
+	w = httptest.NewRecorder()
+	newRouter().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/.well-known/est/missing/cacerts", http.NoBody))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestSimpleEnroll(t *testing.T) {
+	ca, err := minica.New()
+	require.NoError(t, err)
+	a := &mockAuthority{ca: ca, provisioner: newEST(t, ca), revoked: map[string]bool{}}
+	mockMustAuthority(t, a)
+
+	csr, _ := newCSR(t, "device", "device.example.com")
+	body := base64.StdEncoding.EncodeToString(csr.Raw)
+
+	clientCert, err := ca.Sign(&x509.Certificate{
+		Subject:   pkix.Name{CommonName: "device"},
+		DNSNames:  []string{"device.example.com"},
+		PublicKey: csr.PublicKey,
+		NotBefore: time.Now().Add(-time.Minute),
+		NotAfter:  time.Now().Add(time.Hour),
+	})
+	require.NoError(t, err)
+	otherCert, err := ca.Sign(&x509.Certificate{
+		Subject:   pkix.Name{CommonName: "device"},
+		DNSNames:  []string{"other.example.com"},
+		PublicKey: csr.PublicKey,
+		NotBefore: time.Now().Add(-time.Minute),
+		NotAfter:  time.Now().Add(time.Hour),
+	})
+	require.NoError(t, err)
+	otherCA, err := minica.New()
+	require.NoError(t, err)
+	untrustedCert, err := otherCA.Sign(&x509.Certificate{
+		Subject:   pkix.Name{CommonName: "device"},
+		DNSNames:  []string{"device.example.com"},
+		PublicKey: csr.PublicKey,
+		NotBefore: time.Now().Add(-time.Minute),
+		NotAfter:  time.Now().Add(time.Hour),
+	})
+	require.NoError(t, err)
+	revokedCert, err := ca.Sign(&x509.Certificate{
+		Subject:   pkix.Name{CommonName: "revoked"},
+		PublicKey: csr.PublicKey,
+		NotBefore: time.Now().Add(-time.Minute),
+		NotAfter:  time.Now().Add(time.Hour),
+	})
+	require.NoError(t, err)
+	a.revoked[revokedCert.SerialNumber.String()] = true
+
+	tests := []struct {
+		name       string
+		body       string
+		modify     func(r *http.Request)
+		wantStatus int
+	}{
+		{"ok/basic", body, func(r *http.Request) { r.SetBasicAuth("user", "pass") }, http.StatusOK},
+		{"ok/client-certificate", body, func(r *http.Request) {
+			r.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{clientCert, ca.Intermediate, ca.Root}}}
+		}, http.StatusOK},
+		{"fail/no-auth", body, func(*http.Request) {}, http.StatusUnauthorized},
+		{"fail/bad-password", body, func(r *http.Request) { r.SetBasicAuth("user", "bad") }, http.StatusUnauthorized},
+		{"fail/client-certificate-names", body, func(r *http.Request) {
+			r.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{otherCert, ca.Intermediate, ca.Root}}}
+		}, http.StatusForbidden},
+		{"fail/client-certificate-root", body, func(r *http.Request) {
+			r.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{untrustedCert, otherCA.Intermediate, otherCA.Root}}}
+		}, http.StatusForbidden},
+		{"fail/revoked", body, func(r *http.Request) {
+			r.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{revokedCert, ca.Intermediate, ca.Root}}}
+		}, http.StatusForbidden},
+		{"fail/bad-base64", "%%%", func(r *http.Request) { r.SetBasicAuth("user", "pass") }, http.StatusBadRequest},
+		{"fail/bad-csr", base64.StdEncoding.EncodeToString([]byte("foo")), func(r *http.Request) { r.SetBasicAuth("user", "pass") }, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/.well-known/est/est/simpleenroll", bytes.NewBufferString(tt.body))
+			tt.modify(r)
+			w := httptest.NewRecorder()
+			newRouter().ServeHTTP(w, r)
+			require.Equal(t, tt.wantStatus, w.Code, w.Body.String())
+			switch tt.wantStatus {
+			case http.StatusOK:
+				certs := parseCertsOnly(t, w.Body.Bytes())
+				require.Len(t, certs, 2)
+				assert.Equal(t, "device", certs[0].Subject.CommonName)
+				assert.Equal(t, ca.Intermediate, certs[1])
+			case http.StatusUnauthorized:
+				assert.Equal(t, `Basic realm="step-ca"`, w.Header().Get("WWW-Authenticate"))
+			}
+		})
+	}
+}
+
+func TestSimpleReenroll(t *testing.T) {
+	ca, err := minica.New()
+	require.NoError(t, err)
+	a := &mockAuthority{ca: ca, provisioner: newEST(t, ca)}
+	mockMustAuthority(t, a)
+
+	csr, _ := newCSR(t, "device", "device.example.com")
+	chain, err := a.SignWithContext(context.Background(), csr, provisioner.SignOptions{})
+	require.NoError(t, err)
+	otherCert, err := ca.Sign(&x509.Certificate{
+		Subject:   pkix.Name{CommonName: "device"},
+		DNSNames:  []string{"device.example.com"},
+		PublicKey: csr.PublicKey,
+		NotBefore: time.Now().Add(-time.Minute),
+		NotAfter:  time.Now().Add(time.Hour),
+	})
+	require.NoError(t, err)
+
+	renewCSR, _ := newCSR(t, "device", "device.example.com")
+	otherCSR, _ := newCSR(t, "other")
+
+	tests := []struct {
+		name       string
+		csr        *x509.CertificateRequest
+		cert       *x509.Certificate
+		wantStatus int
+	}{
+		{"ok", renewCSR, chain[0], http.StatusOK},
+		{"fail/no-client-certificate", renewCSR, nil, http.StatusUnauthorized},
+		{"fail/other-provisioner", renewCSR, otherCert, http.StatusForbidden},
+		{"fail/subject", otherCSR, chain[0], http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/.well-known/est/est/simplereenroll", bytes.NewBufferString(base64.StdEncoding.EncodeToString(tt.csr.Raw)))
+			if tt.cert != nil {
+				r.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{tt.cert, ca.Intermediate, ca.Root}}}
+			}
+			w := httptest.NewRecorder()
+			newRouter().ServeHTTP(w, r)
+			require.Equal(t, tt.wantStatus, w.Code, w.Body.String())
+			if tt.wantStatus == http.StatusOK {
+				certs := parseCertsOnly(t, w.Body.Bytes())
+				assert.Equal(t, renewCSR.PublicKey, certs[0].PublicKey)
+			}
+		})
+	}
+}
+
+func TestServerKeyGen(t *testing.T) {
+	ca, err := minica.New()
+	require.NoError(t, err)
+	p := newEST(t, ca)
+	mockMustAuthority(t, &mockAuthority{ca: ca, provisioner: p})
+
+	csr, _ := newCSR(t, "device", "device.example.com")
+	r := httptest.NewRequest(http.MethodPost, "/.well-known/est/est/serverkeygen", bytes.NewBufferString(base64.StdEncoding.EncodeToString(csr.Raw)))
+	r.SetBasicAuth("user", "pass")
+	w := httptest.NewRecorder()
+	newRouter().ServeHTTP(w, r)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	mediaType, params, err := mime.ParseMediaType(w.Header().Get("Content-Type"))
+	require.NoError(t, err)
+	assert.Equal(t, "multipart/mixed", mediaType)
+
+	mr := multipart.NewReader(w.Body, params["boundary"])
+	part, err := mr.NextPart()
+	require.NoError(t, err)
+	assert.Equal(t, pkcs8ContentType, part.Header.Get("Content-Type"))
+	b, err := io.ReadAll(part)
+	require.NoError(t, err)
+	der, err := base64.StdEncoding.DecodeString(string(b))
+	require.NoError(t, err)
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	require.NoError(t, err)
+
+	part, err = mr.NextPart()
+	require.NoError(t, err)
+	assert.Equal(t, certsOnlyContentType, part.Header.Get("Content-Type"))
+	b, err = io.ReadAll(part)
+	require.NoError(t, err)
+	certs := parseCertsOnly(t, b)
+	require.Len(t, certs, 2)
+	assert.Equal(t, "device", certs[0].Subject.CommonName)
+	assert.Equal(t, []string{"device.example.com"}, certs[0].DNSNames)
+	assert.Equal(t, key.(crypto.Signer).Public(), certs[0].PublicKey)
+	assert.NotEqual(t, csr.PublicKey, certs[0].PublicKey)
+
+	// serverkeygen must be enabled in the provisioner
+	p.ServerKeyGen = nil
+	r = httptest.NewRequest(http.MethodPost, "/.well-known/est/est/serverkeygen", bytes.NewBufferString(base64.StdEncoding.EncodeToString(csr.Raw)))
+	r.SetBasicAuth("user", "pass")
+	w = httptest.NewRecorder()
+	newRouter().ServeHTTP(w, r)
+	assert.Equal(t, http.StatusNotImplemented, w.Code)
+}
@@ -0,0 +1,158 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+const (
+	bigQueryEndpoint = "https://bigquery.googleapis.com/bigquery/v2"
+	bigQueryScope    = "https://www.googleapis.com/auth/bigquery.insertdata"
+)
+
+// BigQueryConfig is the configuration of a sink that streams records to a
+// BigQuery table. The table must have a schema compatible with the JSON
+// representation of a Record.
+type BigQueryConfig struct {
+	ProjectID string `json:"projectId"`
+	DatasetID string `json:"datasetId"`
+	TableID   string `json:"tableId"`
+	// CredentialsFile is the path to a service account key file. If empty the
+	// application default credentials are used.
+	CredentialsFile string `json:"credentialsFile,omitempty"`
+}
+
+// Validate validates the BigQuery sink configuration.
+func (c *BigQueryConfig) Validate() error {
+	switch {
+	case c == nil:
+		return errors.New("bigQuery cannot be empty")
+	case c.ProjectID == "":
+		return errors.New("bigQuery projectId cannot be empty")
+	case c.DatasetID == "":
+		return errors.New("bigQuery datasetId cannot be empty")
+	case c.TableID == "":
+		return errors.New("bigQuery tableId cannot be empty")
+	default:
+		return nil
+	}
+}
+
+// BigQuerySink is a Sink that streams records to a BigQuery table using the
+// tabledata.insertAll API. The record id is used as the insert id, so BigQuery
+// can remove duplicated records.
+type BigQuerySink struct {
+	endpoint string
+	client   *http.Client
+}
+
+// NewBigQuerySink creates a new BigQuery sink.
+func NewBigQuerySink(ctx context.Context, c *BigQueryConfig) (*BigQuerySink, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+
+	var ts oauth2.TokenSource
+	if c.CredentialsFile != "" {
+		b, err := os.ReadFile(c.CredentialsFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "error reading bigQuery credentialsFile")
+		}
+		creds, err := google.CredentialsFromJSON(ctx, b, bigQueryScope)
+		if err != nil {
+			return nil, errors.Wrap(err, "error parsing bigQuery credentialsFile")
+		}
+		ts = creds.TokenSource
+	} else {
+		var err error
+		if ts, err = google.DefaultTokenSource(ctx, bigQueryScope); err != nil {
+			return nil, errors.Wrap(err, "error loading google default credentials")
+		}
+	}
+
+	client := oauth2.NewClient(ctx, ts)
+	client.Timeout = 30 * time.Second
+	return newBigQuerySink(bigQueryEndpoint, c, client), nil
+}
+
+func newBigQuerySink(endpoint string, c *BigQueryConfig, client *http.Client) *BigQuerySink {
+	return &BigQuerySink{
+		endpoint: strings.TrimSuffix(endpoint, "/") + "/projects/" + url.PathEscape(c.ProjectID) +
+			"/datasets/" + url.PathEscape(c.DatasetID) + "/tables/" + url.PathEscape(c.TableID) + "/insertAll",
+		client: client,
+	}
+}
+
+type bigQueryRow struct {
+	InsertID string  `json:"insertId"`
+	JSON     *Record `json:"json"`
+}
+
+type bigQueryInsertAllRequest struct {
+	Rows []bigQueryRow `json:"rows"`
+}
+
+type bigQueryInsertAllResponse struct {
+	InsertErrors []struct {
+		Index  int `json:"index"`
+		Errors []struct {
+			Reason  string `json:"reason"`
+			Message string `json:"message"`
+		} `json:"errors"`
+	} `json:"insertErrors"`
+}
+
+// Write implements the Sink interface.
+func (s *BigQuerySink) Write(ctx context.Context, records []*Record) error {
+	body := bigQueryInsertAllRequest{
+		Rows: make([]bigQueryRow, len(records)),
+	}
+	for i, r := range records {
+		body.Rows[i] = bigQueryRow{InsertID: r.ID, JSON: r}
+	}
+	b, err := json.Marshal(body)
+	if err != nil {
+		return errors.Wrap(err, "error marshaling records")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.endpoint, bytes.NewReader(b))
+	if err != nil {
+		return errors.Wrap(err, "error creating request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "error inserting records")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return errors.Errorf("error inserting records: %s %s", resp.Status, bytes.TrimSpace(b))
+	}
+
+	var ir bigQueryInsertAllResponse
+	if err := json.NewDecoder(resp.Body).Decode(&ir); err != nil {
+		return errors.Wrap(err, "error decoding response")
+	}
+	if len(ir.InsertErrors) > 0 {
+		e := ir.InsertErrors[0]
+		var msg string
+		if len(e.Errors) > 0 {
+			msg = e.Errors[0].Reason + ": " + e.Errors[0].Message
+		}
+		return errors.Errorf("error inserting records: %d rows failed, row %d: %s", len(ir.InsertErrors), e.Index, msg)
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package export
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBigQuerySink_Write(t *testing.T) {
+	records := testRecords(2)
+	tests := []struct {
+		name     string
+		status   int
+		response string
+		wantErr  bool
+	}{
+		{"ok", http.StatusOK, `{"kind":"bigquery#tableDataInsertAllResponse"}`, false},
+		{"fail status", http.StatusForbidden, `{"error":{"code":403}}`, true},
+		{"fail insertErrors", http.StatusOK, `{"insertErrors":[{"index":1,"errors":[{"reason":"invalid","message":"no such field"}]}]}`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, http.MethodPost, r.Method)
+				assert.Equal(t, "/bigquery/v2/projects/project/datasets/dataset/tables/table/insertAll", r.URL.Path)
+
+				var body bigQueryInsertAllRequest
+				assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+				if assert.Len(t, body.Rows, 2) {
+					assert.Equal(t, records[0].ID, body.Rows[0].InsertID)
+					assert.Equal(t, records[1].SerialNumber, body.Rows[1].JSON.SerialNumber)
+				}
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.response))
+			}))
+			defer srv.Close()
+
+			s := newBigQuerySink(srv.URL+"/bigquery/v2", &BigQueryConfig{
+				ProjectID: "project",
+				DatasetID: "dataset",
+				TableID:   "table",
+			}, srv.Client())
+			err := s.Write(context.Background(), records)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
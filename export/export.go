@@ -0,0 +1,262 @@
+// Package export implements a pipeline that streams records of issued,
+// renewed and revoked certificates to external sinks, so analytics and
+// compliance reporting do not need to query the operational database of the
+// CA.
+//
+// If a spool directory is configured, records are delivered at least once:
+// batches are written to disk before being delivered, and pending batches are
+// delivered again after a restart. A batch is retried, with an exponential
+// backoff, up to a maximum number of attempts, and then it is moved to the
+// dead-letter directory of the spool. Sinks should use the record id to
+// discard duplicates.
+//
+// Export never blocks the requests that issue certificates. Each sink has its
+// own bounded queue; when a queue is full the records are written to the
+// spool, or dropped if there is no spool directory.
+package export
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+// Kind is the event that generated a record.
+type Kind string
+
+const (
+	// Issued is the kind of the records of new certificates.
+	Issued Kind = "issued"
+	// Renewed is the kind of the records of renewed or rekeyed certificates.
+	Renewed Kind = "renewed"
+	// Revoked is the kind of the records of revoked certificates.
+	Revoked Kind = "revoked"
+)
+
+// CertificateType is the type of certificate in a record.
+type CertificateType string
+
+const (
+	// X509 is the type of the records of X.509 certificates.
+	X509 CertificateType = "x509"
+	// SSH is the type of the records of SSH certificates.
+	SSH CertificateType = "ssh"
+)
+
+// Provisioner contains the provisioner that authorized the operation.
+type Provisioner struct {
+	ID   string `json:"id,omitempty"`
+	Name string `json:"name,omitempty"`
+	Type string `json:"type,omitempty"`
+}
+
+// Record is the data exported for a certificate event.
+type Record struct {
+	// ID uniquely identifies the record, sinks can use it to remove
+	// duplicates.
+	ID                   string          `json:"id"`
+	Kind                 Kind            `json:"kind"`
+	Type                 CertificateType `json:"type"`
+	Timestamp            time.Time       `json:"timestamp"`
+	SerialNumber         string          `json:"serialNumber"`
+	PreviousSerialNumber string          `json:"previousSerialNumber,omitempty"`
+	Subject              string          `json:"subject,omitempty"`
+	Issuer               string          `json:"issuer,omitempty"`
+	SANs                 []string        `json:"sans,omitempty"`
+	KeyID                string          `json:"keyID,omitempty"`
+	CertType             string          `json:"certType,omitempty"`
+	NotBefore            *time.Time      `json:"notBefore,omitempty"`
+	NotAfter             *time.Time      `json:"notAfter,omitempty"`
+	Fingerprint          string          `json:"fingerprint,omitempty"`
+	Provisioner          *Provisioner    `json:"provisioner,omitempty"`
+	ReasonCode           *int            `json:"reasonCode,omitempty"`
+	Reason               string          `json:"reason,omitempty"`
+}
+
+func newRecord(kind Kind, typ CertificateType) *Record {
+	return &Record{
+		ID:        uuid.NewString(),
+		Kind:      kind,
+		Type:      typ,
+		Timestamp: time.Now().UTC(),
+	}
+}
+
+// NewX509Record returns a record for the given X.509 certificate. The
+// previous certificate is only used in renewals.
+func NewX509Record(kind Kind, cert, previous *x509.Certificate) *Record {
+	r := newRecord(kind, X509)
+	r.SerialNumber = cert.SerialNumber.String()
+	r.Subject = cert.Subject.String()
+	r.Issuer = cert.Issuer.String()
+	r.SANs = append(r.SANs, cert.DNSNames...)
+	r.SANs = append(r.SANs, cert.EmailAddresses...)
+	for _, ip := range cert.IPAddresses {
+		r.SANs = append(r.SANs, ip.String())
+	}
+	for _, u := range cert.URIs {
+		r.SANs = append(r.SANs, u.String())
+	}
+	notBefore, notAfter := cert.NotBefore.UTC(), cert.NotAfter.UTC()
+	r.NotBefore, r.NotAfter = &notBefore, &notAfter
+	sum := sha256.Sum256(cert.Raw)
+	r.Fingerprint = hex.EncodeToString(sum[:])
+	if previous != nil {
+		r.PreviousSerialNumber = previous.SerialNumber.String()
+	}
+	return r
+}
+
+// NewSSHRecord returns a record for the given SSH certificate. The previous
+// certificate is only used in renewals.
+func NewSSHRecord(kind Kind, cert, previous *ssh.Certificate) *Record {
+	r := newRecord(kind, SSH)
+	r.SerialNumber = strconv.FormatUint(cert.Serial, 10)
+	r.KeyID = cert.KeyId
+	r.SANs = cert.ValidPrincipals
+	switch cert.CertType {
+	case ssh.UserCert:
+		r.CertType = "user"
+	case ssh.HostCert:
+		r.CertType = "host"
+	}
+	notBefore := time.Unix(int64(cert.ValidAfter), 0).UTC()
+	r.NotBefore = &notBefore
+	if cert.ValidBefore != ssh.CertTimeInfinity {
+		notAfter := time.Unix(int64(cert.ValidBefore), 0).UTC()
+		r.NotAfter = &notAfter
+	}
+	sum := sha256.Sum256(cert.Marshal())
+	r.Fingerprint = hex.EncodeToString(sum[:])
+	if previous != nil {
+		r.PreviousSerialNumber = strconv.FormatUint(previous.Serial, 10)
+	}
+	return r
+}
+
+// NewRevocationRecord returns a record for a revoked certificate.
+func NewRevocationRecord(typ CertificateType, serialNumber string, reasonCode int, reason string) *Record {
+	r := newRecord(Revoked, typ)
+	r.SerialNumber = serialNumber
+	r.ReasonCode = &reasonCode
+	r.Reason = reason
+	return r
+}
+
+// Sink is the interface implemented by the destinations of the records.
+type Sink interface {
+	// Write sends a batch of records to the sink. Write must return an error
+	// if any of the records was not accepted, the whole batch will be sent
+	// again.
+	Write(ctx context.Context, records []*Record) error
+}
+
+// Default values of the pipeline configuration.
+const (
+	DefaultQueueSize     = 1024
+	DefaultBatchSize     = 100
+	DefaultFlushInterval = 5 * time.Second
+	DefaultMinBackoff    = time.Second
+	DefaultMaxBackoff    = time.Minute
+	DefaultMaxAttempts   = 10
+)
+
+// Config is the configuration of the export pipeline.
+type Config struct {
+	// Sinks is the list of destinations of the records.
+	Sinks []*SinkConfig `json:"sinks"`
+	// QueueSize is the maximum number of records waiting to be delivered to
+	// each sink. Records exported while a queue is full are written to the
+	// spool directory, or dropped if there is no spool directory.
+	QueueSize int `json:"queueSize,omitempty"`
+	// BatchSize is the maximum number of records sent in a single write.
+	BatchSize int `json:"batchSize,omitempty"`
+	// FlushInterval is the maximum time a record waits for a batch to fill.
+	FlushInterval *provisioner.Duration `json:"flushInterval,omitempty"`
+	// MaxAttempts is the maximum number of times a batch is sent to a sink.
+	// Batches that are not delivered are moved to the "failed" subdirectory
+	// of the spool, or dropped if there is no spool directory.
+	MaxAttempts int `json:"maxAttempts,omitempty"`
+	// SpoolDirectory, if set, is the directory where batches are persisted
+	// until they are delivered.
+	SpoolDirectory string `json:"spoolDirectory,omitempty"`
+}
+
+// SinkConfig is the configuration of a sink. The type must be "kafka",
+// "bigQuery" or "s3", and the properties with the same name configure the
+// sink.
+type SinkConfig struct {
+	Name     string          `json:"name"`
+	Type     string          `json:"type"`
+	Kafka    *KafkaConfig    `json:"kafka,omitempty"`
+	BigQuery *BigQueryConfig `json:"bigQuery,omitempty"`
+	S3       *S3Config       `json:"s3,omitempty"`
+}
+
+// Validate validates the export configuration.
+func (c *Config) Validate() error {
+	switch {
+	case c == nil:
+		return nil
+	case len(c.Sinks) == 0:
+		return errors.New("export sinks cannot be empty")
+	case c.QueueSize < 0:
+		return errors.New("export queueSize cannot be negative")
+	case c.BatchSize < 0:
+		return errors.New("export batchSize cannot be negative")
+	case c.MaxAttempts < 0:
+		return errors.New("export maxAttempts cannot be negative")
+	}
+	names := make(map[string]bool, len(c.Sinks))
+	for i, s := range c.Sinks {
+		if s == nil {
+			return errors.Errorf("export sinks[%d] cannot be empty", i)
+		}
+		if s.Name == "" {
+			return errors.Errorf("export sinks[%d] name cannot be empty", i)
+		}
+		if names[s.Name] {
+			return errors.Errorf("export sink %s is duplicated", s.Name)
+		}
+		names[s.Name] = true
+		if err := s.validate(); err != nil {
+			return errors.Wrapf(err, "export sink %s is not valid", s.Name)
+		}
+	}
+	return nil
+}
+
+func (c *SinkConfig) validate() error {
+	switch c.Type {
+	case "kafka":
+		return c.Kafka.Validate()
+	case "bigQuery":
+		return c.BigQuery.Validate()
+	case "s3":
+		return c.S3.Validate()
+	default:
+		return errors.Errorf("unsupported type %q", c.Type)
+	}
+}
+
+func (c *SinkConfig) newSink(ctx context.Context) (Sink, error) {
+	switch c.Type {
+	case "kafka":
+		return NewKafkaSink(c.Kafka)
+	case "bigQuery":
+		return NewBigQuerySink(ctx, c.BigQuery)
+	case "s3":
+		return NewS3Sink(c.S3)
+	default:
+		return nil, errors.Errorf("unsupported type %q", c.Type)
+	}
+}
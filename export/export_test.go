@@ -0,0 +1,362 @@
+package export
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+type testSink struct {
+	mu      sync.Mutex
+	fail    int
+	block   chan struct{}
+	batches [][]*Record
+}
+
+func (s *testSink) Write(ctx context.Context, records []*Record) error {
+	if s.block != nil {
+		select {
+		case <-s.block:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.fail > 0 {
+		s.fail--
+		return errors.New("write failed")
+	}
+	s.batches = append(s.batches, records)
+	return nil
+}
+
+func (s *testSink) records() []*Record {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var records []*Record
+	for _, b := range s.batches {
+		records = append(records, b...)
+	}
+	return records
+}
+
+func (s *testSink) numBatches() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.batches)
+}
+
+func testRecords(n int) []*Record {
+	records := make([]*Record, n)
+	for i := range records {
+		records[i] = NewRevocationRecord(X509, big.NewInt(int64(i)).String(), 0, "")
+	}
+	return records
+}
+
+func newTestPipeline(t *testing.T, sink Sink, c *Config) *Exporter {
+	t.Helper()
+	p, err := newPipeline("test", sink, c)
+	require.NoError(t, err)
+	p.minBackoff = time.Millisecond
+	p.maxBackoff = 10 * time.Millisecond
+	go p.run()
+	return &Exporter{pipelines: []*pipeline{p}}
+}
+
+func TestNewX509Record(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	now := time.Now().Truncate(time.Second)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1234),
+		Subject:      pkix.Name{CommonName: "test.example.com"},
+		DNSNames:     []string{"test.example.com"},
+		IPAddresses:  []net.IP{net.ParseIP("10.0.0.1")},
+		NotBefore:    now,
+		NotAfter:     now.Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	r := NewX509Record(Renewed, cert, &x509.Certificate{SerialNumber: big.NewInt(1000)})
+	assert.NotEmpty(t, r.ID)
+	assert.Equal(t, Renewed, r.Kind)
+	assert.Equal(t, X509, r.Type)
+	assert.Equal(t, "1234", r.SerialNumber)
+	assert.Equal(t, "1000", r.PreviousSerialNumber)
+	assert.Equal(t, "CN=test.example.com", r.Subject)
+	assert.Equal(t, []string{"test.example.com", "10.0.0.1"}, r.SANs)
+	assert.Equal(t, now.UTC(), *r.NotBefore)
+	assert.Equal(t, now.Add(time.Hour).UTC(), *r.NotAfter)
+	assert.Len(t, r.Fingerprint, 64)
+}
+
+func TestNewSSHRecord(t *testing.T) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	signer, err := ssh.NewSignerFromKey(key)
+	require.NoError(t, err)
+	cert := &ssh.Certificate{
+		Key:             signer.PublicKey(),
+		Serial:          1234,
+		CertType:        ssh.UserCert,
+		KeyId:           "jane@example.com",
+		ValidPrincipals: []string{"jane"},
+		ValidAfter:      1000,
+		ValidBefore:     ssh.CertTimeInfinity,
+	}
+	require.NoError(t, cert.SignCert(rand.Reader, signer))
+
+	r := NewSSHRecord(Issued, cert, nil)
+	assert.Equal(t, Issued, r.Kind)
+	assert.Equal(t, SSH, r.Type)
+	assert.Equal(t, "1234", r.SerialNumber)
+	assert.Empty(t, r.PreviousSerialNumber)
+	assert.Equal(t, "jane@example.com", r.KeyID)
+	assert.Equal(t, "user", r.CertType)
+	assert.Equal(t, []string{"jane"}, r.SANs)
+	assert.Equal(t, time.Unix(1000, 0).UTC(), *r.NotBefore)
+	assert.Nil(t, r.NotAfter)
+}
+
+func TestConfig_Validate(t *testing.T) {
+	kafka := &SinkConfig{Name: "kafka", Type: "kafka", Kafka: &KafkaConfig{URL: "http://localhost:8082", Topic: "certs"}}
+	tests := []struct {
+		name    string
+		config  *Config
+		wantErr bool
+	}{
+		{"ok nil", nil, false},
+		{"ok", &Config{Sinks: []*SinkConfig{kafka}}, false},
+		{"ok s3", &Config{Sinks: []*SinkConfig{{Name: "s3", Type: "s3", S3: &S3Config{Bucket: "certs", Region: "us-east-1"}}}}, false},
+		{"ok bigQuery", &Config{Sinks: []*SinkConfig{{Name: "bq", Type: "bigQuery", BigQuery: &BigQueryConfig{ProjectID: "p", DatasetID: "d", TableID: "t"}}}}, false},
+		{"fail no sinks", &Config{}, true},
+		{"fail nil sink", &Config{Sinks: []*SinkConfig{nil}}, true},
+		{"fail no name", &Config{Sinks: []*SinkConfig{{Type: "kafka", Kafka: kafka.Kafka}}}, true},
+		{"fail duplicated", &Config{Sinks: []*SinkConfig{kafka, kafka}}, true},
+		{"fail type", &Config{Sinks: []*SinkConfig{{Name: "foo", Type: "foo"}}}, true},
+		{"fail missing kafka", &Config{Sinks: []*SinkConfig{{Name: "kafka", Type: "kafka"}}}, true},
+		{"fail kafka topic", &Config{Sinks: []*SinkConfig{{Name: "kafka", Type: "kafka", Kafka: &KafkaConfig{URL: "http://localhost:8082"}}}}, true},
+		{"fail bigQuery table", &Config{Sinks: []*SinkConfig{{Name: "bq", Type: "bigQuery", BigQuery: &BigQueryConfig{ProjectID: "p", DatasetID: "d"}}}}, true},
+		{"fail s3 region", &Config{Sinks: []*SinkConfig{{Name: "s3", Type: "s3", S3: &S3Config{Bucket: "certs"}}}}, true},
+		{"fail queueSize", &Config{Sinks: []*SinkConfig{kafka}, QueueSize: -1}, true},
+		{"fail maxAttempts", &Config{Sinks: []*SinkConfig{kafka}, MaxAttempts: -1}, true},
+		{"fail batchSize", &Config{Sinks: []*SinkConfig{kafka}, BatchSize: -1}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.Validate()
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestExporter_batchSize(t *testing.T) {
+	sink := new(testSink)
+	e := newTestPipeline(t, sink, &Config{
+		BatchSize:     10,
+		FlushInterval: &provisioner.Duration{Duration: time.Hour},
+	})
+
+	records := testRecords(25)
+	require.NoError(t, e.Export(context.Background(), records...))
+	assert.Eventually(t, func() bool {
+		return sink.numBatches() == 2
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// Close flushes the remaining records.
+	require.NoError(t, e.Close(context.Background()))
+	assert.Equal(t, 3, sink.numBatches())
+	assert.Equal(t, records, sink.records())
+	assert.ErrorIs(t, e.Export(context.Background(), records[0]), ErrClosed)
+}
+
+func TestExporter_flushInterval(t *testing.T) {
+	sink := new(testSink)
+	e := newTestPipeline(t, sink, &Config{
+		FlushInterval: &provisioner.Duration{Duration: 10 * time.Millisecond},
+	})
+	t.Cleanup(func() { e.Close(context.Background()) })
+
+	records := testRecords(3)
+	require.NoError(t, e.Export(context.Background(), records...))
+	assert.Eventually(t, func() bool {
+		return len(sink.records()) == 3
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, records, sink.records())
+}
+
+func TestExporter_retry(t *testing.T) {
+	sink := &testSink{fail: 3}
+	e := newTestPipeline(t, sink, &Config{
+		FlushInterval: &provisioner.Duration{Duration: 10 * time.Millisecond},
+	})
+
+	records := testRecords(5)
+	require.NoError(t, e.Export(context.Background(), records...))
+	require.NoError(t, e.Close(context.Background()))
+	assert.Equal(t, records, sink.records())
+}
+
+func TestExporter_queueFull(t *testing.T) {
+	sink := &testSink{block: make(chan struct{})}
+	e := newTestPipeline(t, sink, &Config{
+		QueueSize:     2,
+		BatchSize:     1,
+		FlushInterval: &provisioner.Duration{Duration: time.Hour},
+	})
+
+	// One record is blocked in the sink and two are queued, Export does not
+	// block and drops the next record.
+	records := testRecords(4)
+	require.NoError(t, e.Export(context.Background(), records[:1]...))
+	assert.Eventually(t, func() bool {
+		return len(e.pipelines[0].queue) == 0
+	}, 5*time.Second, 10*time.Millisecond)
+	require.NoError(t, e.Export(context.Background(), records[1:3]...))
+	assert.ErrorIs(t, e.Export(context.Background(), records[3]), ErrQueueFull)
+
+	close(sink.block)
+	assert.Error(t, e.Close(context.Background()))
+	assert.Equal(t, records[:3], sink.records())
+}
+
+func TestExporter_queueFull_spool(t *testing.T) {
+	sink := &testSink{block: make(chan struct{})}
+	e := newTestPipeline(t, sink, &Config{
+		QueueSize:      1,
+		BatchSize:      1,
+		FlushInterval:  &provisioner.Duration{Duration: 10 * time.Millisecond},
+		SpoolDirectory: t.TempDir(),
+	})
+
+	// The records that do not fit in the queue are spooled and delivered
+	// later.
+	records := testRecords(4)
+	require.NoError(t, e.Export(context.Background(), records[:1]...))
+	assert.Eventually(t, func() bool {
+		return len(e.pipelines[0].queue) == 0
+	}, 5*time.Second, 10*time.Millisecond)
+	require.NoError(t, e.Export(context.Background(), records[1:]...))
+
+	close(sink.block)
+	assert.Eventually(t, func() bool {
+		return len(sink.records()) == 4
+	}, 5*time.Second, 10*time.Millisecond)
+	require.NoError(t, e.Close(context.Background()))
+
+	got := make(map[string]bool)
+	for _, r := range sink.records() {
+		got[r.ID] = true
+	}
+	for _, r := range records {
+		assert.True(t, got[r.ID], "record %s was not delivered", r.SerialNumber)
+	}
+}
+
+func TestExporter_maxAttempts(t *testing.T) {
+	dir := t.TempDir()
+	sink := &testSink{fail: 5}
+	e := newTestPipeline(t, sink, &Config{
+		MaxAttempts:    2,
+		FlushInterval:  &provisioner.Duration{Duration: time.Hour},
+		SpoolDirectory: dir,
+	})
+
+	// The batch is moved to the dead-letter directory.
+	require.NoError(t, e.Export(context.Background(), testRecords(3)...))
+	require.NoError(t, e.Close(context.Background()))
+	assert.Empty(t, sink.records())
+	assert.Equal(t, 3, sink.fail)
+
+	entries, err := os.ReadDir(filepath.Join(dir, "test", "failed"))
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+
+	// Without spool the batch is dropped.
+	sink = &testSink{fail: 5}
+	e = newTestPipeline(t, sink, &Config{
+		MaxAttempts:   2,
+		FlushInterval: &provisioner.Duration{Duration: time.Hour},
+	})
+	require.NoError(t, e.Export(context.Background(), testRecords(3)...))
+	assert.Error(t, e.Close(context.Background()))
+	assert.Equal(t, 3, sink.fail)
+}
+
+func TestExporter_Close_timeout(t *testing.T) {
+	sink := &testSink{block: make(chan struct{})}
+	e := newTestPipeline(t, sink, &Config{
+		FlushInterval: &provisioner.Duration{Duration: time.Hour},
+	})
+
+	require.NoError(t, e.Export(context.Background(), testRecords(3)...))
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.Error(t, e.Close(ctx))
+	assert.Empty(t, sink.records())
+}
+
+func TestExporter_spool(t *testing.T) {
+	dir := t.TempDir()
+	config := &Config{
+		FlushInterval:  &provisioner.Duration{Duration: time.Hour},
+		SpoolDirectory: dir,
+	}
+
+	// The sink never accepts the records, they are kept in the spool.
+	sink := &testSink{block: make(chan struct{})}
+	e := newTestPipeline(t, sink, config)
+	records := testRecords(3)
+	require.NoError(t, e.Export(context.Background(), records...))
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.NoError(t, e.Close(ctx))
+
+	entries, err := os.ReadDir(filepath.Join(dir, "test"))
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+
+	// A new exporter delivers the spooled records.
+	sink = new(testSink)
+	e = newTestPipeline(t, sink, config)
+	assert.Eventually(t, func() bool {
+		return len(sink.records()) == 3
+	}, 5*time.Second, 10*time.Millisecond)
+	require.NoError(t, e.Close(context.Background()))
+
+	got := sink.records()
+	for i := range records {
+		assert.Equal(t, records[i].ID, got[i].ID)
+		assert.Equal(t, records[i].SerialNumber, got[i].SerialNumber)
+	}
+	entries, err = os.ReadDir(filepath.Join(dir, "test"))
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
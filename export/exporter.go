@@ -0,0 +1,462 @@
+package export
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ErrClosed is returned by Export if the exporter has been closed.
+var ErrClosed = errors.New("exporter is closed")
+
+// ErrQueueFull is returned by Export if the queue of a sink is full and there
+// is no spool directory to keep the records.
+var ErrQueueFull = errors.New("export queue is full")
+
+// Exporter sends records to all the configured sinks.
+type Exporter struct {
+	pipelines []*pipeline
+}
+
+// New creates an exporter with the given configuration and starts the
+// delivery of records, including the ones pending in the spool directory.
+func New(ctx context.Context, c *Config) (*Exporter, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	e := new(Exporter)
+	for _, sc := range c.Sinks {
+		sink, err := sc.newSink(ctx)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error creating export sink %s", sc.Name)
+		}
+		p, err := newPipeline(sc.Name, sink, c)
+		if err != nil {
+			return nil, err
+		}
+		e.pipelines = append(e.pipelines, p)
+	}
+	for _, p := range e.pipelines {
+		go p.run()
+	}
+	return e, nil
+}
+
+// NewWithSinks creates an exporter that delivers records to the given sinks.
+// The sink configuration in c is ignored.
+func NewWithSinks(sinks map[string]Sink, c *Config) (*Exporter, error) {
+	if c == nil {
+		c = new(Config)
+	}
+	names := make([]string, 0, len(sinks))
+	for name := range sinks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	e := new(Exporter)
+	for _, name := range names {
+		p, err := newPipeline(name, sinks[name], c)
+		if err != nil {
+			return nil, err
+		}
+		e.pipelines = append(e.pipelines, p)
+	}
+	for _, p := range e.pipelines {
+		go p.run()
+	}
+	return e, nil
+}
+
+// Export queues the given records for delivery to all the sinks. Export never
+// blocks: if the queue of a sink is full, the records are written to the spool
+// directory and delivered later, or dropped if there is no spool directory.
+func (e *Exporter) Export(_ context.Context, records ...*Record) error {
+	var firstErr error
+	for _, p := range e.pipelines {
+		if err := p.enqueue(records); err != nil && firstErr == nil {
+			firstErr = errors.Wrapf(err, "error exporting records to %s", p.name)
+		}
+	}
+	return firstErr
+}
+
+// Close stops accepting new records and waits until the queued records are
+// delivered or the context is done. Records that are not delivered are kept in
+// the spool directory if one is configured, otherwise they are lost and an
+// error is returned.
+func (e *Exporter) Close(ctx context.Context) error {
+	var wg sync.WaitGroup
+	errs := make([]error, len(e.pipelines))
+	for i, p := range e.pipelines {
+		wg.Add(1)
+		go func(i int, p *pipeline) {
+			defer wg.Done()
+			errs[i] = p.close(ctx)
+		}(i, p)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type pipeline struct {
+	name          string
+	sink          Sink
+	queue         chan *Record
+	batchSize     int
+	flushInterval time.Duration
+	minBackoff    time.Duration
+	maxBackoff    time.Duration
+	maxAttempts   int
+	spool         *spool
+
+	mu        sync.RWMutex
+	closed    bool
+	closing   chan struct{}
+	closeOnce sync.Once
+	done      chan struct{}
+	ctx       context.Context
+	cancel    context.CancelFunc
+	dropped   atomic.Int64
+}
+
+func newPipeline(name string, sink Sink, c *Config) (*pipeline, error) {
+	p := &pipeline{
+		name:          name,
+		sink:          sink,
+		queue:         make(chan *Record, DefaultQueueSize),
+		batchSize:     DefaultBatchSize,
+		flushInterval: DefaultFlushInterval,
+		minBackoff:    DefaultMinBackoff,
+		maxBackoff:    DefaultMaxBackoff,
+		maxAttempts:   DefaultMaxAttempts,
+		closing:       make(chan struct{}),
+		done:          make(chan struct{}),
+	}
+	if c.QueueSize > 0 {
+		p.queue = make(chan *Record, c.QueueSize)
+	}
+	if c.BatchSize > 0 {
+		p.batchSize = c.BatchSize
+	}
+	if c.MaxAttempts > 0 {
+		p.maxAttempts = c.MaxAttempts
+	}
+	if c.FlushInterval != nil && c.FlushInterval.Duration > 0 {
+		p.flushInterval = c.FlushInterval.Duration
+	}
+	if c.SpoolDirectory != "" {
+		s, err := newSpool(filepath.Join(c.SpoolDirectory, name))
+		if err != nil {
+			return nil, err
+		}
+		p.spool = s
+	}
+	p.ctx, p.cancel = context.WithCancel(context.Background())
+	return p, nil
+}
+
+func (p *pipeline) enqueue(records []*Record) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		return ErrClosed
+	}
+	for i, r := range records {
+		select {
+		case p.queue <- r:
+		default:
+			return p.overflow(records[i:])
+		}
+	}
+	return nil
+}
+
+// overflow writes the records that do not fit in the queue to the spool, they
+// are delivered with the pending batches. If there is no spool, the records
+// are dropped.
+func (p *pipeline) overflow(records []*Record) error {
+	if p.spool != nil {
+		_, err := p.spool.write(records)
+		if err == nil {
+			return nil
+		}
+		log.Printf("error writing export spool for %s: %v", p.name, err)
+	}
+	p.dropped.Add(int64(len(records)))
+	return ErrQueueFull
+}
+
+func (p *pipeline) close(ctx context.Context) error {
+	// Unblock and reject new records, and wait for the ones being queued.
+	p.closeOnce.Do(func() { close(p.closing) })
+	p.mu.Lock()
+	p.closed = true
+	p.mu.Unlock()
+
+	select {
+	case <-p.done:
+	case <-ctx.Done():
+		// Abort the delivery in progress.
+		p.cancel()
+		<-p.done
+	}
+	p.cancel()
+
+	if n := p.dropped.Load(); n > 0 {
+		return errors.Errorf("error exporting records to %s: %d records were not delivered", p.name, n)
+	}
+	return nil
+}
+
+// run delivers the pending batches in the spool and the records in the queue
+// until the pipeline is closed.
+func (p *pipeline) run() {
+	defer close(p.done)
+
+	if p.spool != nil {
+		p.deliverSpool()
+	}
+
+	timer := time.NewTimer(p.flushInterval)
+	defer timer.Stop()
+
+	batch := make([]*Record, 0, p.batchSize)
+	for {
+		select {
+		case r := <-p.queue:
+			if batch = append(batch, r); len(batch) < p.batchSize {
+				continue
+			}
+		case <-timer.C:
+			// Deliver the records that did not fit in the queue.
+			if p.spool != nil {
+				p.deliverSpool()
+			}
+			timer.Reset(p.flushInterval)
+		case <-p.closing:
+			// Wait until no more records can be added to the queue, and
+			// deliver the remaining ones.
+			p.mu.Lock()
+			p.mu.Unlock() //nolint:staticcheck // wait for enqueue to return
+			for {
+				select {
+				case r := <-p.queue:
+					if batch = append(batch, r); len(batch) == p.batchSize {
+						p.deliver(batch)
+						batch = make([]*Record, 0, p.batchSize)
+					}
+					continue
+				default:
+				}
+				break
+			}
+			p.deliver(batch)
+			return
+		}
+		p.deliver(batch)
+		batch = make([]*Record, 0, p.batchSize)
+	}
+}
+
+// deliver writes the batch to the spool, if configured, and sends it to the
+// sink. Batches that are not delivered are moved to the dead-letter directory
+// of the spool, or dropped if there is no spool. Batches of an aborted
+// pipeline are kept in the spool.
+func (p *pipeline) deliver(batch []*Record) {
+	if len(batch) == 0 {
+		return
+	}
+	if p.spool == nil {
+		if err := p.send(batch); err != nil {
+			p.dropped.Add(int64(len(batch)))
+			log.Printf("error exporting %d records to %s: %v", len(batch), p.name, err)
+		}
+		return
+	}
+
+	name, err := p.spool.write(batch)
+	if err != nil {
+		log.Printf("error writing export spool for %s: %v", p.name, err)
+	}
+	if err := p.send(batch); err != nil {
+		log.Printf("error exporting %d records to %s: %v", len(batch), p.name, err)
+		if name == "" {
+			p.dropped.Add(int64(len(batch)))
+		} else if p.ctx.Err() == nil {
+			p.deadLetter(name)
+		}
+		return
+	}
+	if name != "" {
+		if err := p.spool.remove(name); err != nil {
+			log.Printf("error removing export spool file for %s: %v", p.name, err)
+		}
+	}
+}
+
+// deliverSpool sends the batches left in the spool by a previous run, and the
+// records that did not fit in the queue.
+func (p *pipeline) deliverSpool() {
+	names, err := p.spool.list()
+	if err != nil {
+		log.Printf("error reading export spool for %s: %v", p.name, err)
+		return
+	}
+	for _, name := range names {
+		batch, err := p.spool.read(name)
+		if err != nil {
+			log.Printf("error reading export spool file %s: %v", name, err)
+			continue
+		}
+		if err := p.send(batch); err != nil {
+			log.Printf("error exporting %d records to %s: %v", len(batch), p.name, err)
+			if p.ctx.Err() != nil {
+				return
+			}
+			p.deadLetter(name)
+			continue
+		}
+		if err := p.spool.remove(name); err != nil {
+			log.Printf("error removing export spool file for %s: %v", p.name, err)
+		}
+	}
+}
+
+// deadLetter moves a spooled batch that could not be delivered to the
+// dead-letter directory.
+func (p *pipeline) deadLetter(name string) {
+	if err := p.spool.deadLetter(name); err != nil {
+		log.Printf("error moving export spool file %s to the dead-letter directory: %v", name, err)
+		return
+	}
+	log.Printf("export spool file %s for %s moved to the dead-letter directory", name, p.name)
+}
+
+// send sends the batch to the sink, retrying with an exponential backoff until
+// the sink accepts it, the maximum number of attempts is reached, or the
+// pipeline is aborted.
+func (p *pipeline) send(batch []*Record) error {
+	backoff := p.minBackoff
+	for attempt := 1; ; attempt++ {
+		err := p.sink.Write(p.ctx, batch)
+		if err == nil {
+			return nil
+		}
+		if attempt >= p.maxAttempts {
+			return errors.Wrapf(err, "giving up after %d attempts", attempt)
+		}
+		select {
+		case <-p.ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > p.maxBackoff {
+			backoff = p.maxBackoff
+		}
+	}
+}
+
+// spool stores batches of records in a directory, one JSON Lines file per
+// batch, until they are delivered.
+type spool struct {
+	dir string
+	seq atomic.Uint64
+}
+
+func newSpool(dir string) (*spool, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, errors.Wrap(err, "error creating export spool directory")
+	}
+	return &spool{dir: dir}, nil
+}
+
+func (s *spool) write(batch []*Record) (string, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, r := range batch {
+		if err := enc.Encode(r); err != nil {
+			return "", errors.Wrap(err, "error marshaling record")
+		}
+	}
+
+	// Names sort in the order the batches were created.
+	name := fmt.Sprintf("%020d-%06d.jsonl", time.Now().UnixNano(), s.seq.Add(1)%1000000)
+	tmp := filepath.Join(s.dir, "."+name)
+	if err := os.WriteFile(tmp, buf.Bytes(), 0600); err != nil {
+		return "", errors.Wrap(err, "error writing spool file")
+	}
+	if err := os.Rename(tmp, filepath.Join(s.dir, name)); err != nil {
+		return "", errors.Wrap(err, "error writing spool file")
+	}
+	return name, nil
+}
+
+func (s *spool) list() ([]string, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading spool directory")
+	}
+	var names []string
+	for _, e := range entries {
+		if name := e.Name(); !e.IsDir() && !strings.HasPrefix(name, ".") && strings.HasSuffix(name, ".jsonl") {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (s *spool) read(name string) ([]*Record, error) {
+	f, err := os.Open(filepath.Join(s.dir, name))
+	if err != nil {
+		return nil, errors.Wrap(err, "error opening spool file")
+	}
+	defer f.Close()
+
+	var batch []*Record
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		r := new(Record)
+		if err := json.Unmarshal(scanner.Bytes(), r); err != nil {
+			return nil, errors.Wrap(err, "error unmarshaling record")
+		}
+		batch = append(batch, r)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "error reading spool file")
+	}
+	return batch, nil
+}
+
+func (s *spool) remove(name string) error {
+	return os.Remove(filepath.Join(s.dir, name))
+}
+
+// deadLetter moves a batch to the "failed" subdirectory, where it is kept for
+// inspection and it's not delivered again.
+func (s *spool) deadLetter(name string) error {
+	dir := filepath.Join(s.dir, "failed")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return errors.Wrap(err, "error creating dead-letter directory")
+	}
+	return os.Rename(filepath.Join(s.dir, name), filepath.Join(dir, name))
+}
@@ -0,0 +1,124 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// KafkaConfig is the configuration of a sink that produces records to a Kafka
+// topic using the Kafka REST Proxy v2 API.
+type KafkaConfig struct {
+	// URL is the base URL of the REST proxy.
+	URL string `json:"url"`
+	// Topic is the topic where the records are produced. Records use the
+	// serial number as the key.
+	Topic    string `json:"topic"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+}
+
+// Validate validates the Kafka sink configuration.
+func (c *KafkaConfig) Validate() error {
+	switch {
+	case c == nil:
+		return errors.New("kafka cannot be empty")
+	case c.URL == "":
+		return errors.New("kafka url cannot be empty")
+	case c.Topic == "":
+		return errors.New("kafka topic cannot be empty")
+	}
+	if _, err := url.Parse(c.URL); err != nil {
+		return errors.Wrap(err, "kafka url is not valid")
+	}
+	return nil
+}
+
+// KafkaSink is a Sink that produces records to a Kafka topic.
+type KafkaSink struct {
+	endpoint string
+	username string
+	password string
+	client   *http.Client
+}
+
+// NewKafkaSink creates a new Kafka sink.
+func NewKafkaSink(c *KafkaConfig) (*KafkaSink, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return &KafkaSink{
+		endpoint: strings.TrimSuffix(c.URL, "/") + "/topics/" + url.PathEscape(c.Topic),
+		username: c.Username,
+		password: c.Password,
+		client:   &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+type kafkaRecord struct {
+	Key   string  `json:"key"`
+	Value *Record `json:"value"`
+}
+
+type kafkaProduceRequest struct {
+	Records []kafkaRecord `json:"records"`
+}
+
+type kafkaProduceResponse struct {
+	Offsets []struct {
+		ErrorCode *int   `json:"error_code"`
+		Error     string `json:"error"`
+	} `json:"offsets"`
+}
+
+// Write implements the Sink interface.
+func (s *KafkaSink) Write(ctx context.Context, records []*Record) error {
+	body := kafkaProduceRequest{
+		Records: make([]kafkaRecord, len(records)),
+	}
+	for i, r := range records {
+		body.Records[i] = kafkaRecord{Key: r.SerialNumber, Value: r}
+	}
+	b, err := json.Marshal(body)
+	if err != nil {
+		return errors.Wrap(err, "error marshaling records")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.endpoint, bytes.NewReader(b))
+	if err != nil {
+		return errors.Wrap(err, "error creating request")
+	}
+	req.Header.Set("Content-Type", "application/vnd.kafka.json.v2+json")
+	req.Header.Set("Accept", "application/vnd.kafka.v2+json")
+	if s.username != "" {
+		req.SetBasicAuth(s.username, s.password)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return errors.Wrapf(err, "error posting records to %s", s.endpoint)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return errors.Errorf("error posting records to %s: %s %s", s.endpoint, resp.Status, bytes.TrimSpace(b))
+	}
+
+	var pr kafkaProduceResponse
+	if err := json.NewDecoder(resp.Body).Decode(&pr); err != nil {
+		return errors.Wrap(err, "error decoding response")
+	}
+	for i, o := range pr.Offsets {
+		if o.ErrorCode != nil || o.Error != "" {
+			return errors.Errorf("error producing record %d: %s", i, o.Error)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package export
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKafkaSink_Write(t *testing.T) {
+	records := testRecords(2)
+	tests := []struct {
+		name     string
+		status   int
+		response string
+		wantErr  bool
+	}{
+		{"ok", http.StatusOK, `{"offsets":[{"partition":0,"offset":1},{"partition":0,"offset":2}]}`, false},
+		{"fail status", http.StatusInternalServerError, `{"error_code":50001,"message":"error"}`, true},
+		{"fail offset", http.StatusOK, `{"offsets":[{"partition":0,"offset":1},{"error_code":50002,"error":"retriable"}]}`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, http.MethodPost, r.Method)
+				assert.Equal(t, "/topics/certificates", r.URL.Path)
+				assert.Equal(t, "application/vnd.kafka.json.v2+json", r.Header.Get("Content-Type"))
+				username, password, ok := r.BasicAuth()
+				assert.True(t, ok)
+				assert.Equal(t, "user", username)
+				assert.Equal(t, "pass", password)
+
+				var body kafkaProduceRequest
+				assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+				if assert.Len(t, body.Records, 2) {
+					assert.Equal(t, records[0].SerialNumber, body.Records[0].Key)
+					assert.Equal(t, records[1].ID, body.Records[1].Value.ID)
+				}
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.response))
+			}))
+			defer srv.Close()
+
+			s, err := NewKafkaSink(&KafkaConfig{
+				URL:      srv.URL + "/",
+				Topic:    "certificates",
+				Username: "user",
+				Password: "pass",
+			})
+			require.NoError(t, err)
+			err = s.Write(context.Background(), records)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
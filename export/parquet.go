@@ -0,0 +1,428 @@
+package export
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+
+	"github.com/pkg/errors"
+)
+
+// This file implements the subset of the Apache Parquet format used to store
+// batches of records: a flat schema with required, optional and repeated
+// columns, written in a single row group with one gzip compressed data page
+// per column. Values use the PLAIN encoding, and repetition and definition
+// levels the RLE encoding. The file metadata is serialized using the Thrift
+// compact protocol as defined in parquet.thrift.
+
+const parquetMagic = "PAR1"
+
+// parquetCreatedBy is the application that wrote the file.
+const parquetCreatedBy = "smallstep certificates"
+
+// Parquet physical types.
+const (
+	parquetInt32     int32 = 1
+	parquetInt64     int32 = 2
+	parquetByteArray int32 = 6
+)
+
+// Parquet field repetition types.
+const (
+	parquetRequired int32 = 0
+	parquetOptional int32 = 1
+	parquetRepeated int32 = 2
+)
+
+// Parquet converted types. parquetNoConvertedType is used to omit the type
+// from the schema.
+const (
+	parquetNoConvertedType int32 = -1
+	parquetUTF8            int32 = 0
+	parquetTimestampMicros int32 = 10
+)
+
+// Parquet encodings, compression codecs and page types.
+const (
+	parquetPlainEncoding int32 = 0
+	parquetRLEEncoding   int32 = 3
+	parquetGzipCodec     int32 = 2
+	parquetDataPage      int32 = 0
+)
+
+// parquetColumn contains the encoded values and levels of a column.
+type parquetColumn struct {
+	name          string
+	typ           int32
+	repetition    int32
+	convertedType int32
+	values        bytes.Buffer
+	repLevels     []byte
+	defLevels     []byte
+	numValues     int
+}
+
+func newParquetColumn(name string, typ, repetition, convertedType int32) *parquetColumn {
+	return &parquetColumn{
+		name:          name,
+		typ:           typ,
+		repetition:    repetition,
+		convertedType: convertedType,
+	}
+}
+
+// addLevels adds an entry to the column, repetition levels are only stored in
+// repeated columns, and definition levels in optional and repeated ones.
+func (c *parquetColumn) addLevels(rep, def byte) {
+	if c.repetition == parquetRepeated {
+		c.repLevels = append(c.repLevels, rep)
+	}
+	if c.repetition != parquetRequired {
+		c.defLevels = append(c.defLevels, def)
+	}
+	c.numValues++
+}
+
+// addString adds a BYTE_ARRAY value, or a null value if ok is false.
+func (c *parquetColumn) addString(s string, ok bool) {
+	if !ok {
+		c.addLevels(0, 0)
+		return
+	}
+	c.addLevels(0, 1)
+	c.values.Write(binary.LittleEndian.AppendUint32(nil, uint32(len(s)))) //nolint:gosec // values are smaller than 4GB
+	c.values.WriteString(s)
+}
+
+// addStrings adds the values of a repeated BYTE_ARRAY column for a record.
+func (c *parquetColumn) addStrings(values []string) {
+	if len(values) == 0 {
+		c.addLevels(0, 0)
+		return
+	}
+	for i, s := range values {
+		var rep byte
+		if i > 0 {
+			rep = 1
+		}
+		c.addLevels(rep, 1)
+		c.values.Write(binary.LittleEndian.AppendUint32(nil, uint32(len(s)))) //nolint:gosec // values are smaller than 4GB
+		c.values.WriteString(s)
+	}
+}
+
+// addInt32 adds an INT32 value, or a null value if ok is false.
+func (c *parquetColumn) addInt32(v int32, ok bool) {
+	if !ok {
+		c.addLevels(0, 0)
+		return
+	}
+	c.addLevels(0, 1)
+	c.values.Write(binary.LittleEndian.AppendUint32(nil, uint32(v))) //nolint:gosec // two's complement encoding
+}
+
+// addInt64 adds an INT64 value, or a null value if ok is false.
+func (c *parquetColumn) addInt64(v int64, ok bool) {
+	if !ok {
+		c.addLevels(0, 0)
+		return
+	}
+	c.addLevels(0, 1)
+	c.values.Write(binary.LittleEndian.AppendUint64(nil, uint64(v))) //nolint:gosec // two's complement encoding
+}
+
+// page returns the uncompressed data page of the column: the repetition
+// levels, the definition levels and the values.
+func (c *parquetColumn) page() []byte {
+	var b []byte
+	if c.repetition == parquetRepeated {
+		b = appendParquetLevels(b, c.repLevels)
+	}
+	if c.repetition != parquetRequired {
+		b = appendParquetLevels(b, c.defLevels)
+	}
+	return append(b, c.values.Bytes()...)
+}
+
+// appendParquetLevels appends the given levels, with a maximum value of 1,
+// using the RLE/bit-packing hybrid encoding prefixed by its length. Only RLE
+// runs are used.
+func appendParquetLevels(b, levels []byte) []byte {
+	var runs []byte
+	for i := 0; i < len(levels); {
+		j := i + 1
+		for j < len(levels) && levels[j] == levels[i] {
+			j++
+		}
+		runs = binary.AppendUvarint(runs, uint64(j-i)<<1)
+		runs = append(runs, levels[i])
+		i = j
+	}
+	b = binary.LittleEndian.AppendUint32(b, uint32(len(runs))) //nolint:gosec // pages are smaller than 4GB
+	return append(b, runs...)
+}
+
+// recordColumns returns the columns of a batch of records. The provisioner is
+// flattened into top-level columns, and the timestamps are stored in
+// microseconds since the Unix epoch.
+func recordColumns(records []*Record) []*parquetColumn {
+	var (
+		id                   = newParquetColumn("id", parquetByteArray, parquetRequired, parquetUTF8)
+		kind                 = newParquetColumn("kind", parquetByteArray, parquetRequired, parquetUTF8)
+		typ                  = newParquetColumn("type", parquetByteArray, parquetRequired, parquetUTF8)
+		timestamp            = newParquetColumn("timestamp", parquetInt64, parquetRequired, parquetTimestampMicros)
+		serialNumber         = newParquetColumn("serialNumber", parquetByteArray, parquetRequired, parquetUTF8)
+		previousSerialNumber = newParquetColumn("previousSerialNumber", parquetByteArray, parquetOptional, parquetUTF8)
+		subject              = newParquetColumn("subject", parquetByteArray, parquetOptional, parquetUTF8)
+		issuer               = newParquetColumn("issuer", parquetByteArray, parquetOptional, parquetUTF8)
+		sans                 = newParquetColumn("sans", parquetByteArray, parquetRepeated, parquetUTF8)
+		keyID                = newParquetColumn("keyID", parquetByteArray, parquetOptional, parquetUTF8)
+		certType             = newParquetColumn("certType", parquetByteArray, parquetOptional, parquetUTF8)
+		notBefore            = newParquetColumn("notBefore", parquetInt64, parquetOptional, parquetTimestampMicros)
+		notAfter             = newParquetColumn("notAfter", parquetInt64, parquetOptional, parquetTimestampMicros)
+		fingerprint          = newParquetColumn("fingerprint", parquetByteArray, parquetOptional, parquetUTF8)
+		provisionerID        = newParquetColumn("provisionerID", parquetByteArray, parquetOptional, parquetUTF8)
+		provisionerName      = newParquetColumn("provisionerName", parquetByteArray, parquetOptional, parquetUTF8)
+		provisionerType      = newParquetColumn("provisionerType", parquetByteArray, parquetOptional, parquetUTF8)
+		reasonCode           = newParquetColumn("reasonCode", parquetInt32, parquetOptional, parquetNoConvertedType)
+		reason               = newParquetColumn("reason", parquetByteArray, parquetOptional, parquetUTF8)
+	)
+
+	for _, r := range records {
+		id.addString(r.ID, true)
+		kind.addString(string(r.Kind), true)
+		typ.addString(string(r.Type), true)
+		timestamp.addInt64(r.Timestamp.UnixMicro(), true)
+		serialNumber.addString(r.SerialNumber, true)
+		previousSerialNumber.addString(r.PreviousSerialNumber, r.PreviousSerialNumber != "")
+		subject.addString(r.Subject, r.Subject != "")
+		issuer.addString(r.Issuer, r.Issuer != "")
+		sans.addStrings(r.SANs)
+		keyID.addString(r.KeyID, r.KeyID != "")
+		certType.addString(r.CertType, r.CertType != "")
+		if r.NotBefore != nil {
+			notBefore.addInt64(r.NotBefore.UnixMicro(), true)
+		} else {
+			notBefore.addInt64(0, false)
+		}
+		if r.NotAfter != nil {
+			notAfter.addInt64(r.NotAfter.UnixMicro(), true)
+		} else {
+			notAfter.addInt64(0, false)
+		}
+		fingerprint.addString(r.Fingerprint, r.Fingerprint != "")
+		var p Provisioner
+		if r.Provisioner != nil {
+			p = *r.Provisioner
+		}
+		provisionerID.addString(p.ID, p.ID != "")
+		provisionerName.addString(p.Name, p.Name != "")
+		provisionerType.addString(p.Type, p.Type != "")
+		if r.ReasonCode != nil {
+			reasonCode.addInt32(int32(*r.ReasonCode), true) //nolint:gosec // revocation reason codes are small
+		} else {
+			reasonCode.addInt32(0, false)
+		}
+		reason.addString(r.Reason, r.Reason != "")
+	}
+
+	return []*parquetColumn{
+		id, kind, typ, timestamp, serialNumber, previousSerialNumber, subject,
+		issuer, sans, keyID, certType, notBefore, notAfter, fingerprint,
+		provisionerID, provisionerName, provisionerType, reasonCode, reason,
+	}
+}
+
+// marshalParquet encodes the given records in a Parquet file.
+func marshalParquet(records []*Record) ([]byte, error) {
+	columns := recordColumns(records)
+
+	var buf bytes.Buffer
+	buf.WriteString(parquetMagic)
+
+	// Write a data page per column, and the column metadata pointing to it.
+	chunks := make([]*thriftCompactWriter, len(columns))
+	var totalSize int64
+	for i, c := range columns {
+		page := c.page()
+		var zbuf bytes.Buffer
+		zw := gzip.NewWriter(&zbuf)
+		if _, err := zw.Write(page); err != nil {
+			return nil, errors.Wrap(err, "error compressing parquet page")
+		}
+		if err := zw.Close(); err != nil {
+			return nil, errors.Wrap(err, "error compressing parquet page")
+		}
+
+		header := newThriftCompactWriter()
+		header.i32Field(1, parquetDataPage)
+		header.i32Field(2, int32(len(page)))     //nolint:gosec // pages are smaller than 2GB
+		header.i32Field(3, int32(zbuf.Len()))    //nolint:gosec // pages are smaller than 2GB
+		header.structField(5)                    // data_page_header
+		header.i32Field(1, int32(c.numValues))   //nolint:gosec // batches are smaller than 2G values
+		header.i32Field(2, parquetPlainEncoding) // encoding
+		header.i32Field(3, parquetRLEEncoding)   // definition_level_encoding
+		header.i32Field(4, parquetRLEEncoding)   // repetition_level_encoding
+		header.structEnd()
+		header.structEnd()
+
+		offset := int64(buf.Len())
+		buf.Write(header.Bytes())
+		buf.Write(zbuf.Bytes())
+		uncompressedSize := int64(header.Len() + len(page))
+		compressedSize := int64(header.Len() + zbuf.Len())
+		totalSize += uncompressedSize
+
+		chunk := newThriftCompactWriter()
+		chunk.i64Field(2, offset) // file_offset
+		chunk.structField(3)      // meta_data
+		chunk.i32Field(1, c.typ)
+		chunk.listField(2, thriftI32, 2) // encodings
+		chunk.i32(parquetPlainEncoding)
+		chunk.i32(parquetRLEEncoding)
+		chunk.listField(3, thriftBinary, 1) // path_in_schema
+		chunk.binary(c.name)
+		chunk.i32Field(4, parquetGzipCodec)
+		chunk.i64Field(5, int64(c.numValues))
+		chunk.i64Field(6, uncompressedSize)
+		chunk.i64Field(7, compressedSize)
+		chunk.i64Field(9, offset) // data_page_offset
+		chunk.structEnd()
+		chunk.structEnd()
+		chunks[i] = chunk
+	}
+
+	// Write the file metadata.
+	meta := newThriftCompactWriter()
+	meta.i32Field(1, 1) // version
+	meta.listField(2, thriftStruct, len(columns)+1)
+	meta.structBegin()
+	meta.binaryField(4, "schema")
+	meta.i32Field(5, int32(len(columns))) //nolint:gosec // the number of columns is fixed
+	meta.structEnd()
+	for _, c := range columns {
+		meta.structBegin()
+		meta.i32Field(1, c.typ)
+		meta.i32Field(3, c.repetition)
+		meta.binaryField(4, c.name)
+		if c.convertedType != parquetNoConvertedType {
+			meta.i32Field(6, c.convertedType)
+		}
+		meta.structEnd()
+	}
+	meta.i64Field(3, int64(len(records)))
+	meta.listField(4, thriftStruct, 1) // row_groups
+	meta.structBegin()
+	meta.listField(1, thriftStruct, len(chunks))
+	for _, chunk := range chunks {
+		meta.raw(chunk.Bytes())
+	}
+	meta.i64Field(2, totalSize)
+	meta.i64Field(3, int64(len(records)))
+	meta.structEnd()
+	meta.binaryField(6, parquetCreatedBy)
+	meta.structEnd()
+
+	buf.Write(meta.Bytes())
+	buf.Write(binary.LittleEndian.AppendUint32(nil, uint32(meta.Len()))) //nolint:gosec // metadata is smaller than 4GB
+	buf.WriteString(parquetMagic)
+	return buf.Bytes(), nil
+}
+
+// Thrift compact protocol types.
+const (
+	thriftI32    byte = 5
+	thriftI64    byte = 6
+	thriftBinary byte = 8
+	thriftList   byte = 9
+	thriftStruct byte = 12
+)
+
+// thriftCompactWriter serializes Thrift structs using the compact protocol.
+// The writer starts inside a struct that must be closed with structEnd.
+type thriftCompactWriter struct {
+	buf    bytes.Buffer
+	lastID int16
+	stack  []int16
+}
+
+func newThriftCompactWriter() *thriftCompactWriter {
+	return new(thriftCompactWriter)
+}
+
+func (w *thriftCompactWriter) Bytes() []byte { return w.buf.Bytes() }
+
+func (w *thriftCompactWriter) Len() int { return w.buf.Len() }
+
+func (w *thriftCompactWriter) varint(v int64) {
+	w.buf.Write(binary.AppendUvarint(nil, uint64((v<<1)^(v>>63)))) //nolint:gosec // zigzag encoding
+}
+
+func (w *thriftCompactWriter) fieldHeader(id int16, typ byte) {
+	if delta := id - w.lastID; delta > 0 && delta <= 15 {
+		w.buf.WriteByte(byte(delta)<<4 | typ)
+	} else {
+		w.buf.WriteByte(typ)
+		w.varint(int64(id))
+	}
+	w.lastID = id
+}
+
+func (w *thriftCompactWriter) i32(v int32) { w.varint(int64(v)) }
+
+func (w *thriftCompactWriter) binary(s string) {
+	w.buf.Write(binary.AppendUvarint(nil, uint64(len(s))))
+	w.buf.WriteString(s)
+}
+
+// raw writes an element that was serialized by another writer.
+func (w *thriftCompactWriter) raw(b []byte) { w.buf.Write(b) }
+
+func (w *thriftCompactWriter) i32Field(id int16, v int32) {
+	w.fieldHeader(id, thriftI32)
+	w.i32(v)
+}
+
+func (w *thriftCompactWriter) i64Field(id int16, v int64) {
+	w.fieldHeader(id, thriftI64)
+	w.varint(v)
+}
+
+func (w *thriftCompactWriter) binaryField(id int16, s string) {
+	w.fieldHeader(id, thriftBinary)
+	w.binary(s)
+}
+
+// listField writes the header of a list field, the elements must be written
+// after it.
+func (w *thriftCompactWriter) listField(id int16, elemType byte, size int) {
+	w.fieldHeader(id, thriftList)
+	if size < 15 {
+		w.buf.WriteByte(byte(size)<<4 | elemType)
+	} else {
+		w.buf.WriteByte(0xf0 | elemType)
+		w.buf.Write(binary.AppendUvarint(nil, uint64(size)))
+	}
+}
+
+// structField starts a struct field, it must be closed with structEnd.
+func (w *thriftCompactWriter) structField(id int16) {
+	w.fieldHeader(id, thriftStruct)
+	w.structBegin()
+}
+
+// structBegin starts a struct element of a list, it must be closed with
+// structEnd.
+func (w *thriftCompactWriter) structBegin() {
+	w.stack = append(w.stack, w.lastID)
+	w.lastID = 0
+}
+
+// structEnd writes the stop field of the current struct.
+func (w *thriftCompactWriter) structEnd() {
+	w.buf.WriteByte(0)
+	if n := len(w.stack); n > 0 {
+		w.lastID = w.stack[n-1]
+		w.stack = w.stack[:n-1]
+	}
+}
@@ -0,0 +1,296 @@
+package export
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// readThriftStruct decodes a struct serialized with the Thrift compact
+// protocol. Integers are returned as int64, binaries as []byte, lists as
+// []any and structs as map[int16]any.
+func readThriftStruct(t *testing.T, r *bytes.Reader) map[int16]any {
+	t.Helper()
+	m := make(map[int16]any)
+	var lastID int16
+	for {
+		b, err := r.ReadByte()
+		require.NoError(t, err)
+		if b == 0 {
+			return m
+		}
+		id := lastID + int16(b>>4)
+		if b>>4 == 0 {
+			id = int16(readThriftVarint(t, r))
+		}
+		lastID = id
+		m[id] = readThriftValue(t, r, b&0x0f)
+	}
+}
+
+func readThriftVarint(t *testing.T, r *bytes.Reader) int64 {
+	t.Helper()
+	v, err := binary.ReadUvarint(r)
+	require.NoError(t, err)
+	return int64(v>>1) ^ -int64(v&1)
+}
+
+func readThriftValue(t *testing.T, r *bytes.Reader, typ byte) any {
+	t.Helper()
+	switch typ {
+	case thriftI32, thriftI64:
+		return readThriftVarint(t, r)
+	case thriftBinary:
+		n, err := binary.ReadUvarint(r)
+		require.NoError(t, err)
+		b := make([]byte, n)
+		_, err = io.ReadFull(r, b)
+		require.NoError(t, err)
+		return b
+	case thriftList:
+		h, err := r.ReadByte()
+		require.NoError(t, err)
+		size := uint64(h >> 4)
+		if size == 15 {
+			size, err = binary.ReadUvarint(r)
+			require.NoError(t, err)
+		}
+		list := make([]any, size)
+		for i := range list {
+			list[i] = readThriftValue(t, r, h&0x0f)
+		}
+		return list
+	case thriftStruct:
+		return readThriftStruct(t, r)
+	default:
+		t.Fatalf("unsupported thrift type %d", typ)
+		return nil
+	}
+}
+
+// readParquetLevels decodes n levels encoded with RLE runs.
+func readParquetLevels(t *testing.T, r *bytes.Reader, n int) []byte {
+	t.Helper()
+	var size uint32
+	require.NoError(t, binary.Read(r, binary.LittleEndian, &size))
+	data := make([]byte, size)
+	_, err := io.ReadFull(r, data)
+	require.NoError(t, err)
+	lr := bytes.NewReader(data)
+	var levels []byte
+	for len(levels) < n {
+		h, err := binary.ReadUvarint(lr)
+		require.NoError(t, err)
+		require.Zero(t, h&1, "unexpected bit-packed run")
+		v, err := lr.ReadByte()
+		require.NoError(t, err)
+		levels = append(levels, bytes.Repeat([]byte{v}, int(h>>1))...)
+	}
+	require.Len(t, levels, n)
+	return levels
+}
+
+// readParquet decodes the Parquet files written by marshalParquet and returns
+// the values of each column by row. Null values are nil, and repeated
+// columns contain a []string per row.
+func readParquet(t *testing.T, b []byte) map[string][]any {
+	t.Helper()
+	require.True(t, bytes.HasPrefix(b, []byte(parquetMagic)))
+	require.True(t, bytes.HasSuffix(b, []byte(parquetMagic)))
+	n := int(binary.LittleEndian.Uint32(b[len(b)-8:]))
+	meta := readThriftStruct(t, bytes.NewReader(b[len(b)-8-n:len(b)-8]))
+	assert.Equal(t, int64(1), meta[1])
+	assert.Equal(t, []byte(parquetCreatedBy), meta[6])
+
+	schema := meta[2].([]any)
+	rowGroups := meta[4].([]any)
+	require.Len(t, rowGroups, 1)
+	rowGroup := rowGroups[0].(map[int16]any)
+	chunks := rowGroup[1].([]any)
+	numRows := int(meta[3].(int64))
+	assert.Equal(t, meta[3], rowGroup[3])
+	require.Len(t, schema, len(chunks)+1)
+	assert.Equal(t, int64(len(chunks)), schema[0].(map[int16]any)[5])
+
+	columns := make(map[string][]any, len(chunks))
+	for i, c := range chunks {
+		element := schema[i+1].(map[int16]any)
+		name := string(element[4].([]byte))
+		typ, repetition := element[1].(int64), element[3].(int64)
+		chunk := c.(map[int16]any)[3].(map[int16]any)
+		assert.Equal(t, []any{[]byte(name)}, chunk[3])
+		assert.Equal(t, int64(parquetGzipCodec), chunk[4])
+
+		// Read the page header and decompress the page.
+		offset := chunk[9].(int64)
+		r := bytes.NewReader(b[offset:])
+		header := readThriftStruct(t, r)
+		pageStart := int(offset) + len(b[offset:]) - r.Len()
+		compressed := b[pageStart : pageStart+int(header[3].(int64))]
+		assert.Equal(t, chunk[7], int64(pageStart)-offset+header[3].(int64))
+		zr, err := gzip.NewReader(bytes.NewReader(compressed))
+		require.NoError(t, err)
+		page, err := io.ReadAll(zr)
+		require.NoError(t, err)
+		require.Len(t, page, int(header[2].(int64)))
+
+		numValues := int(header[5].(map[int16]any)[1].(int64))
+		assert.Equal(t, chunk[5], int64(numValues))
+		pr := bytes.NewReader(page)
+		repLevels, defLevels := make([]byte, numValues), make([]byte, numValues)
+		if repetition == int64(parquetRepeated) {
+			repLevels = readParquetLevels(t, pr, numValues)
+		}
+		if repetition != int64(parquetRequired) {
+			defLevels = readParquetLevels(t, pr, numValues)
+		} else {
+			for j := range defLevels {
+				defLevels[j] = 1
+			}
+		}
+
+		var rows []any
+		for j := 0; j < numValues; j++ {
+			var v any
+			if defLevels[j] == 1 {
+				switch typ {
+				case int64(parquetByteArray):
+					var size uint32
+					require.NoError(t, binary.Read(pr, binary.LittleEndian, &size))
+					s := make([]byte, size)
+					_, err := io.ReadFull(pr, s)
+					require.NoError(t, err)
+					v = string(s)
+				case int64(parquetInt64):
+					var i64 int64
+					require.NoError(t, binary.Read(pr, binary.LittleEndian, &i64))
+					v = i64
+				case int64(parquetInt32):
+					var i32 int32
+					require.NoError(t, binary.Read(pr, binary.LittleEndian, &i32))
+					v = i32
+				default:
+					t.Fatalf("unsupported parquet type %d", typ)
+				}
+			}
+			switch {
+			case repetition != int64(parquetRepeated):
+				rows = append(rows, v)
+			case repLevels[j] == 0:
+				values := []string{}
+				if v != nil {
+					values = append(values, v.(string))
+				}
+				rows = append(rows, values)
+			default:
+				rows[len(rows)-1] = append(rows[len(rows)-1].([]string), v.(string))
+			}
+		}
+		assert.Zero(t, pr.Len(), "column %s has trailing data", name)
+		require.Len(t, rows, numRows, "column %s", name)
+		columns[name] = rows
+	}
+	return columns
+}
+
+func Test_marshalParquet(t *testing.T) {
+	notBefore := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	notAfter := notBefore.Add(24 * time.Hour)
+	reasonCode := 1
+	records := []*Record{
+		{
+			ID: "1", Kind: Issued, Type: X509, Timestamp: notBefore,
+			SerialNumber: "1234", Subject: "CN=test", Issuer: "CN=ca",
+			SANs:      []string{"test.example.com", "127.0.0.1"},
+			NotBefore: &notBefore, NotAfter: &notAfter, Fingerprint: "abcd",
+			Provisioner: &Provisioner{ID: "prov-id", Name: "prov", Type: "JWK"},
+		},
+		{
+			ID: "2", Kind: Revoked, Type: SSH, Timestamp: notAfter,
+			SerialNumber: "5678", ReasonCode: &reasonCode, Reason: "key compromise",
+		},
+		{
+			ID: "3", Kind: Renewed, Type: SSH, Timestamp: notAfter,
+			SerialNumber: "9012", PreviousSerialNumber: "5678", KeyID: "key-id",
+			CertType: "user", SANs: []string{"root"}, NotBefore: &notBefore,
+		},
+	}
+
+	b, err := marshalParquet(records)
+	require.NoError(t, err)
+	got := readParquet(t, b)
+	assert.Len(t, got, 19)
+
+	assert.Equal(t, []any{"1", "2", "3"}, got["id"])
+	assert.Equal(t, []any{"issued", "revoked", "renewed"}, got["kind"])
+	assert.Equal(t, []any{"x509", "ssh", "ssh"}, got["type"])
+	assert.Equal(t, []any{notBefore.UnixMicro(), notAfter.UnixMicro(), notAfter.UnixMicro()}, got["timestamp"])
+	assert.Equal(t, []any{"1234", "5678", "9012"}, got["serialNumber"])
+	assert.Equal(t, []any{nil, nil, "5678"}, got["previousSerialNumber"])
+	assert.Equal(t, []any{"CN=test", nil, nil}, got["subject"])
+	assert.Equal(t, []any{"CN=ca", nil, nil}, got["issuer"])
+	assert.Equal(t, []any{[]string{"test.example.com", "127.0.0.1"}, []string{}, []string{"root"}}, got["sans"])
+	assert.Equal(t, []any{nil, nil, "key-id"}, got["keyID"])
+	assert.Equal(t, []any{nil, nil, "user"}, got["certType"])
+	assert.Equal(t, []any{notBefore.UnixMicro(), nil, notBefore.UnixMicro()}, got["notBefore"])
+	assert.Equal(t, []any{notAfter.UnixMicro(), nil, nil}, got["notAfter"])
+	assert.Equal(t, []any{"abcd", nil, nil}, got["fingerprint"])
+	assert.Equal(t, []any{"prov-id", nil, nil}, got["provisionerID"])
+	assert.Equal(t, []any{"prov", nil, nil}, got["provisionerName"])
+	assert.Equal(t, []any{"JWK", nil, nil}, got["provisionerType"])
+	assert.Equal(t, []any{nil, int32(1), nil}, got["reasonCode"])
+	assert.Equal(t, []any{nil, "key compromise", nil}, got["reason"])
+}
+
+func Test_appendParquetLevels(t *testing.T) {
+	tests := []struct {
+		name   string
+		levels []byte
+		want   []byte
+	}{
+		{"empty", nil, []byte{0, 0, 0, 0}},
+		{"single", []byte{1}, []byte{2, 0, 0, 0, 2, 1}},
+		{"runs", []byte{1, 1, 1, 0, 0, 1}, []byte{6, 0, 0, 0, 6, 1, 4, 0, 2, 1}},
+		{"long run", bytes.Repeat([]byte{1}, 100), []byte{3, 0, 0, 0, 0xc8, 0x01, 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, appendParquetLevels(nil, tt.levels))
+		})
+	}
+}
+
+func Test_thriftCompactWriter(t *testing.T) {
+	w := newThriftCompactWriter()
+	w.i32Field(1, -1)
+	w.i64Field(2, 300)
+	w.structField(3)
+	w.binaryField(1, "ab")
+	w.structEnd()
+	w.listField(20, thriftI32, 16)
+	for i := 0; i < 16; i++ {
+		w.i32(int32(i))
+	}
+	w.structEnd()
+
+	// Short and long field headers, zigzag integers, nested structs and long
+	// list headers.
+	want := []byte{0x15, 0x01, 0x16, 0xd8, 0x04, 0x1c, 0x18, 0x02, 'a', 'b', 0x00, 0x09, 0x28, 0xf5, 0x10}
+	for i := 0; i < 16; i++ {
+		want = append(want, byte(i*2))
+	}
+	want = append(want, 0x00)
+	assert.Equal(t, want, w.Bytes())
+
+	m := readThriftStruct(t, bytes.NewReader(w.Bytes()))
+	assert.Equal(t, int64(-1), m[1])
+	assert.Equal(t, int64(300), m[2])
+	assert.Equal(t, map[int16]any{1: []byte("ab")}, m[3])
+	assert.Len(t, m[20], 16)
+}
@@ -0,0 +1,122 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/pkg/errors"
+)
+
+// S3Config is the configuration of a sink that uploads batches of records to
+// an S3 bucket. Each batch is stored as a Parquet object, compressed with gzip,
+// with the key <prefix>/YYYY/MM/DD/<timestamp>-<first record id>.parquet.
+type S3Config struct {
+	Bucket string `json:"bucket"`
+	Region string `json:"region"`
+	Prefix string `json:"prefix,omitempty"`
+	// Endpoint is the URL of an S3 compatible service. If set, path-style
+	// requests are used.
+	Endpoint string `json:"endpoint,omitempty"`
+	// AccessKeyID, SecretAccessKey and SessionToken are the credentials used
+	// to sign the requests. If empty the credentials are loaded using the
+	// default chain of the AWS SDK: the environment, the shared configuration
+	// files, or the ECS task or EC2 instance role.
+	AccessKeyID     string `json:"accessKeyID,omitempty"`
+	SecretAccessKey string `json:"secretAccessKey,omitempty"`
+	SessionToken    string `json:"sessionToken,omitempty"`
+}
+
+// Validate validates the S3 sink configuration.
+func (c *S3Config) Validate() error {
+	switch {
+	case c == nil:
+		return errors.New("s3 cannot be empty")
+	case c.Bucket == "":
+		return errors.New("s3 bucket cannot be empty")
+	case c.Region == "":
+		return errors.New("s3 region cannot be empty")
+	}
+	if c.Endpoint != "" {
+		if _, err := url.Parse(c.Endpoint); err != nil {
+			return errors.Wrap(err, "s3 endpoint is not valid")
+		}
+	}
+	return nil
+}
+
+// s3PutObjectAPI is the subset of the S3 client used by the S3 sink.
+type s3PutObjectAPI interface {
+	PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error)
+}
+
+// S3Sink is a Sink that uploads batches of records to an S3 bucket.
+type S3Sink struct {
+	bucket string
+	prefix string
+	client s3PutObjectAPI
+}
+
+// NewS3Sink creates a new S3 sink.
+func NewS3Sink(c *S3Config) (*S3Sink, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+
+	opts := []func(*awsconfig.LoadOptions) error{
+		awsconfig.WithRegion(c.Region),
+	}
+	if c.AccessKeyID != "" {
+		opts = append(opts, awsconfig.WithCredentialsProvider(
+			credentials.NewStaticCredentialsProvider(c.AccessKeyID, c.SecretAccessKey, c.SessionToken),
+		))
+	}
+	cfg, err := awsconfig.LoadDefaultConfig(context.Background(), opts...)
+	if err != nil {
+		return nil, errors.Wrap(err, "error loading aws configuration")
+	}
+
+	return &S3Sink{
+		bucket: c.Bucket,
+		prefix: strings.Trim(c.Prefix, "/"),
+		client: s3.NewFromConfig(cfg, func(o *s3.Options) {
+			if c.Endpoint != "" {
+				o.BaseEndpoint = aws.String(c.Endpoint)
+				o.UsePathStyle = true
+			}
+		}),
+	}, nil
+}
+
+// Write implements the Sink interface.
+func (s *S3Sink) Write(ctx context.Context, records []*Record) error {
+	if len(records) == 0 {
+		return nil
+	}
+
+	b, err := marshalParquet(records)
+	if err != nil {
+		return err
+	}
+
+	// The key is derived from the batch, so a retried upload overwrites the
+	// previous attempt.
+	ts := records[0].Timestamp.UTC()
+	key := path.Join(s.prefix, ts.Format("2006/01/02"), ts.Format("20060102T150405Z")+"-"+records[0].ID+".parquet")
+
+	if _, err := s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(s.bucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(b),
+		ContentType: aws.String("application/vnd.apache.parquet"),
+	}); err != nil {
+		return errors.Wrap(err, "error uploading records")
+	}
+	return nil
+}
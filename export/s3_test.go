@@ -0,0 +1,83 @@
+package export
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestS3Sink_Write(t *testing.T) {
+	records := testRecords(2)
+	ts := records[0].Timestamp
+
+	var called bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		assert.Equal(t, http.MethodPut, r.Method)
+		assert.Equal(t, "/certs/exports/"+ts.Format("2006/01/02")+"/"+ts.Format("20060102T150405Z")+"-"+records[0].ID+".parquet", r.URL.Path)
+		assert.Equal(t, "application/vnd.apache.parquet", r.Header.Get("Content-Type"))
+		assert.Equal(t, "token", r.Header.Get("X-Amz-Security-Token"))
+		assert.True(t, strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/"))
+
+		b, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		got := readParquet(t, b)
+		assert.Equal(t, []any{records[0].ID, records[1].ID}, got["id"])
+		assert.Equal(t, []any{"revoked", "revoked"}, got["kind"])
+		assert.Equal(t, []any{records[0].SerialNumber, records[1].SerialNumber}, got["serialNumber"])
+	}))
+	defer srv.Close()
+
+	s, err := NewS3Sink(&S3Config{
+		Bucket:          "certs",
+		Region:          "us-east-1",
+		Prefix:          "/exports/",
+		Endpoint:        srv.URL,
+		AccessKeyID:     "AKID",
+		SecretAccessKey: "secret",
+		SessionToken:    "token",
+	})
+	require.NoError(t, err)
+	assert.NoError(t, s.Write(context.Background(), records))
+	assert.True(t, called)
+}
+
+func TestNewS3Sink(t *testing.T) {
+	s, err := NewS3Sink(&S3Config{Bucket: "certs", Region: "us-east-1", Prefix: "/exports/"})
+	require.NoError(t, err)
+	assert.Equal(t, "certs", s.bucket)
+	assert.Equal(t, "exports", s.prefix)
+	assert.Nil(t, s.client.(*s3.Client).Options().BaseEndpoint)
+
+	s, err = NewS3Sink(&S3Config{Bucket: "certs", Region: "us-east-1", Endpoint: "http://localhost:9000/"})
+	require.NoError(t, err)
+	opts := s.client.(*s3.Client).Options()
+	assert.Equal(t, "http://localhost:9000/", aws.ToString(opts.BaseEndpoint))
+	assert.True(t, opts.UsePathStyle)
+
+	_, err = NewS3Sink(&S3Config{Bucket: "certs"})
+	assert.Error(t, err)
+}
+
+type mockS3Client struct {
+	err error
+}
+
+func (m *mockS3Client) PutObject(context.Context, *s3.PutObjectInput, ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	return nil, m.err
+}
+
+func TestS3Sink_Write_error(t *testing.T) {
+	s := &S3Sink{bucket: "certs", client: &mockS3Client{err: errors.New("force")}}
+	assert.Error(t, s.Write(context.Background(), testRecords(1)))
+	assert.NoError(t, s.Write(context.Background(), nil))
+}
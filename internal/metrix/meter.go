@@ -33,6 +33,9 @@ func New() (m *Meter) {
 			signed: prometheus.NewCounter(prometheus.CounterOpts(opts("kms", "signed", "Number of KMS-backed signatures"))),
 			errors: prometheus.NewCounter(prometheus.CounterOpts(opts("kms", "errors", "Number of KMS-related errors"))),
 		},
+		acmeGCDeleted: newCounterVec("acme", "gc_deleted_total", "Number of expired ACME objects removed by the garbage collector",
+			"type",
+		),
 	}
 
 	reg := prometheus.NewRegistry()
@@ -51,6 +54,7 @@ func New() (m *Meter) {
 		m.x509.webhookEnriched,
 		m.kms.signed,
 		m.kms.errors,
+		m.acmeGCDeleted,
 	)
 
 	h := promhttp.HandlerFor(reg, promhttp.HandlerOpts{
@@ -74,6 +78,8 @@ type Meter struct {
 	ssh    *provisionerInstruments
 	x509   *provisionerInstruments
 	kms    *kms
+
+	acmeGCDeleted *prometheus.CounterVec
 }
 
 // SSHRekeyed implements [authority.Meter] for [Meter].
@@ -144,6 +150,12 @@ func (m *Meter) KMSSigned(err error) {
 	}
 }
 
+// ACMEGarbageCollected records the number of expired ACME objects of the given
+// type, e.g. "orders", removed by the garbage collector.
+func (m *Meter) ACMEGarbageCollected(typ string, n int) {
+	m.acmeGCDeleted.WithLabelValues(typ).Add(float64(n))
+}
+
 // provisionerInstruments wraps the counters exported by provisioners.
 type provisionerInstruments struct {
 	rekeyed *prometheus.CounterVec
@@ -0,0 +1,108 @@
+//go:build !noawskms
+
+package awskms
+
+import (
+	"context"
+	"crypto"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"go.step.sm/crypto/kms/apiv1"
+	"go.step.sm/crypto/kms/awskms"
+	"go.step.sm/crypto/kms/uri"
+)
+
+// Scheme is the scheme used in the AWS KMS URIs.
+const Scheme = awskms.Scheme
+
+func init() {
+	apiv1.Register(apiv1.AmazonKMS, func(ctx context.Context, opts apiv1.Options) (apiv1.KeyManager, error) {
+		return New(ctx, opts)
+	})
+}
+
+// DecryptClient defines the methods of the AWS KMS client used by the
+// decrypter.
+type DecryptClient interface {
+	GetPublicKey(ctx context.Context, input *kms.GetPublicKeyInput, opts ...func(*kms.Options)) (*kms.GetPublicKeyOutput, error)
+	Decrypt(ctx context.Context, input *kms.DecryptInput, opts ...func(*kms.Options)) (*kms.DecryptOutput, error)
+}
+
+// KMS implements a KMS using AWS Key Management Service. It's the KMS
+// implemented in go.step.sm/crypto/kms/awskms with support for decryption.
+type KMS struct {
+	*awskms.KMS
+	client DecryptClient
+}
+
+// New creates a new AWS KMS. It accepts the same options as the AWS KMS in
+// go.step.sm/crypto: the region, profile and credentials file can be set in
+// the URI or in the options, and the default AWS configuration is used
+// otherwise.
+func New(ctx context.Context, opts apiv1.Options) (*KMS, error) {
+	k, err := awskms.New(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := loadConfig(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &KMS{
+		KMS:    k,
+		client: kms.NewFromConfig(cfg),
+	}, nil
+}
+
+// loadConfig loads the AWS configuration the same way
+// go.step.sm/crypto/kms/awskms does.
+func loadConfig(ctx context.Context, opts apiv1.Options) (cfg aws.Config, err error) {
+	var configOptions []func(*config.LoadOptions) error
+	if opts.URI != "" {
+		u, err := uri.ParseWithScheme(Scheme, opts.URI)
+		if err != nil {
+			return cfg, err
+		}
+		if v := u.Get("profile"); v != "" {
+			configOptions = append(configOptions, config.WithSharedConfigProfile(v))
+		}
+		if v := u.Get("region"); v != "" {
+			configOptions = append(configOptions, config.WithRegion(v))
+		}
+		if v := u.Get("credentials-file"); v != "" {
+			configOptions = append(configOptions, config.WithSharedConfigFiles([]string{v}))
+		}
+	}
+	if opts.Region != "" {
+		configOptions = append(configOptions, config.WithRegion(opts.Region))
+	}
+	if opts.Profile != "" {
+		configOptions = append(configOptions, config.WithSharedConfigProfile(opts.Profile))
+	}
+	if opts.CredentialsFile != "" {
+		configOptions = append(configOptions, config.WithSharedConfigFiles([]string{opts.CredentialsFile}))
+	}
+
+	if cfg, err = config.LoadDefaultConfig(ctx, configOptions...); err != nil {
+		return cfg, fmt.Errorf("error loading AWS config: %w", err)
+	}
+	return cfg, nil
+}
+
+// CreateDecrypter returns a crypto.Decrypter using an RSA key in AWS KMS. The
+// key must have the ENCRYPT_DECRYPT key usage.
+func (k *KMS) CreateDecrypter(req *apiv1.CreateDecrypterRequest) (crypto.Decrypter, error) {
+	if req.DecryptionKey == "" {
+		return nil, errors.New("createDecrypterRequest 'decryptionKey' cannot be empty")
+	}
+	return newDecrypter(k.client, req.DecryptionKey)
+}
+
+func defaultContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), 15*time.Second)
+}
@@ -0,0 +1,168 @@
+//go:build !noawskms
+
+package awskms
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1" //nolint:gosec // RSA-OAEP with SHA-1 is supported by AWS KMS
+	"crypto/sha256"
+	"crypto/x509"
+	"errors"
+	"hash"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	kmspkg "go.step.sm/crypto/kms"
+	"go.step.sm/crypto/kms/apiv1"
+)
+
+// mockClient decrypts the requests with the given key.
+type mockClient struct {
+	key      crypto.Signer
+	keyUsage types.KeyUsageType
+	err      error
+}
+
+func (m *mockClient) GetPublicKey(_ context.Context, input *kms.GetPublicKeyInput, _ ...func(*kms.Options)) (*kms.GetPublicKeyOutput, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	b, err := x509.MarshalPKIXPublicKey(m.key.Public())
+	if err != nil {
+		return nil, err
+	}
+	return &kms.GetPublicKeyOutput{
+		KeyId:     input.KeyId,
+		KeyUsage:  m.keyUsage,
+		PublicKey: b,
+	}, nil
+}
+
+func (m *mockClient) Decrypt(_ context.Context, input *kms.DecryptInput, _ ...func(*kms.Options)) (*kms.DecryptOutput, error) {
+	var h hash.Hash
+	switch input.EncryptionAlgorithm {
+	case types.EncryptionAlgorithmSpecRsaesOaepSha1:
+		h = sha1.New() //nolint:gosec // RSA-OAEP with SHA-1 is supported by AWS KMS
+	case types.EncryptionAlgorithmSpecRsaesOaepSha256:
+		h = sha256.New()
+	default:
+		return nil, errors.New("unsupported algorithm")
+	}
+	plaintext, err := rsa.DecryptOAEP(h, nil, m.key.(*rsa.PrivateKey), input.CiphertextBlob, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &kms.DecryptOutput{KeyId: input.KeyId, Plaintext: plaintext}, nil
+}
+
+func TestNew(t *testing.T) {
+	t.Setenv("AWS_CONFIG_FILE", "testdata/missing")
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", "testdata/missing")
+
+	got, err := New(context.Background(), apiv1.Options{URI: "awskms:region=us-east-1"})
+	require.NoError(t, err)
+	assert.NotNil(t, got.KMS)
+	assert.NotNil(t, got.client)
+
+	_, err = New(context.Background(), apiv1.Options{URI: "fortanixkms:region=us-east-1"})
+	assert.Error(t, err)
+}
+
+func TestRegister(t *testing.T) {
+	t.Setenv("AWS_CONFIG_FILE", "testdata/missing")
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", "testdata/missing")
+
+	k, err := kmspkg.New(context.Background(), apiv1.Options{
+		Type: apiv1.AmazonKMS,
+		URI:  "awskms:region=us-east-1",
+	})
+	require.NoError(t, err)
+	assert.IsType(t, &KMS{}, k)
+	assert.Implements(t, (*apiv1.Decrypter)(nil), k)
+}
+
+func TestKMS_CreateDecrypter(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name      string
+		client    DecryptClient
+		key       string
+		wantKeyID string
+		wantErr   bool
+	}{
+		{"ok", &mockClient{key: rsaKey, keyUsage: types.KeyUsageTypeEncryptDecrypt}, "awskms:key-id=be468355-ca7a-40d9-a28b-8ae1c4c7f936", "be468355-ca7a-40d9-a28b-8ae1c4c7f936", false},
+		{"ok arn", &mockClient{key: rsaKey, keyUsage: types.KeyUsageTypeEncryptDecrypt}, "arn:aws:kms:us-east-1:123456789012:key/be468355-ca7a-40d9-a28b-8ae1c4c7f936", "arn:aws:kms:us-east-1:123456789012:key/be468355-ca7a-40d9-a28b-8ae1c4c7f936", false},
+		{"fail empty", &mockClient{key: rsaKey, keyUsage: types.KeyUsageTypeEncryptDecrypt}, "", "", true},
+		{"fail uri", &mockClient{key: rsaKey, keyUsage: types.KeyUsageTypeEncryptDecrypt}, "awskms:name=foo", "", true},
+		{"fail usage", &mockClient{key: rsaKey, keyUsage: types.KeyUsageTypeSignVerify}, "awskms:key-id=foo", "", true},
+		{"fail key type", &mockClient{key: ecKey, keyUsage: types.KeyUsageTypeEncryptDecrypt}, "awskms:key-id=foo", "", true},
+		{"fail client", &mockClient{err: errors.New("test error")}, "awskms:key-id=foo", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k := &KMS{client: tt.client}
+			got, err := k.CreateDecrypter(&apiv1.CreateDecrypterRequest{DecryptionKey: tt.key})
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantKeyID, got.(*Decrypter).keyID)
+			assert.Equal(t, rsaKey.Public(), got.Public())
+		})
+	}
+}
+
+func TestDecrypter_Decrypt(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	k := &KMS{client: &mockClient{key: key, keyUsage: types.KeyUsageTypeEncryptDecrypt}}
+	d, err := k.CreateDecrypter(&apiv1.CreateDecrypterRequest{DecryptionKey: "awskms:key-id=foo"})
+	require.NoError(t, err)
+
+	msg := []byte("the content encryption key")
+	sha1Ciphertext, err := rsa.EncryptOAEP(sha1.New(), rand.Reader, &key.PublicKey, msg, nil) //nolint:gosec // RSA-OAEP with SHA-1 is supported by AWS KMS
+	require.NoError(t, err)
+	sha256Ciphertext, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, &key.PublicKey, msg, nil)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		ciphertext []byte
+		opts       crypto.DecrypterOpts
+		wantErr    bool
+	}{
+		{"ok sha1", sha1Ciphertext, &rsa.OAEPOptions{Hash: crypto.SHA1}, false},
+		{"ok sha256", sha256Ciphertext, &rsa.OAEPOptions{Hash: crypto.SHA256, MGFHash: crypto.SHA256}, false},
+		{"fail pkcs1v15", sha256Ciphertext, nil, true},
+		{"fail pkcs1v15 options", sha256Ciphertext, &rsa.PKCS1v15DecryptOptions{}, true},
+		{"fail hash", sha256Ciphertext, &rsa.OAEPOptions{Hash: crypto.SHA384}, true},
+		{"fail mgf hash", sha256Ciphertext, &rsa.OAEPOptions{Hash: crypto.SHA256, MGFHash: crypto.SHA1}, true},
+		{"fail label", sha256Ciphertext, &rsa.OAEPOptions{Hash: crypto.SHA256, Label: []byte("label")}, true},
+		{"fail options", sha256Ciphertext, crypto.SHA256, true},
+		{"fail decrypt", sha1Ciphertext, &rsa.OAEPOptions{Hash: crypto.SHA256}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := d.Decrypt(rand.Reader, tt.ciphertext, tt.opts)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, msg, got)
+		})
+	}
+}
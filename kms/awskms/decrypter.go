@@ -0,0 +1,129 @@
+//go:build !noawskms
+
+package awskms
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"go.step.sm/crypto/kms/uri"
+	"go.step.sm/crypto/pemutil"
+)
+
+// Decrypter implements a crypto.Decrypter using an RSA key in AWS KMS.
+type Decrypter struct {
+	client    DecryptClient
+	keyID     string
+	publicKey *rsa.PublicKey
+}
+
+// newDecrypter creates a new decrypter, the key is loaded to make sure it
+// exists and it can be used for decryption.
+func newDecrypter(client DecryptClient, decryptionKey string) (*Decrypter, error) {
+	keyID, err := parseKeyID(decryptionKey)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := defaultContext()
+	defer cancel()
+
+	resp, err := client.GetPublicKey(ctx, &kms.GetPublicKeyInput{
+		KeyId: aws.String(keyID),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("awskms GetPublicKey failed: %w", err)
+	}
+	if resp.KeyUsage != types.KeyUsageTypeEncryptDecrypt {
+		return nil, fmt.Errorf("awskms key %s cannot be used for decryption", keyID)
+	}
+	pub, err := pemutil.ParseDER(resp.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	publicKey, ok := pub.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("awskms does not support decryption with keys of type %T", pub)
+	}
+
+	return &Decrypter{
+		client:    client,
+		keyID:     keyID,
+		publicKey: publicKey,
+	}, nil
+}
+
+// Public returns the public key of this decrypter.
+func (d *Decrypter) Public() crypto.PublicKey {
+	return d.publicKey
+}
+
+// Decrypt decrypts the ciphertext with the key in AWS KMS. Only RSAES-OAEP
+// with SHA-1 or SHA-256, and no label, is supported, opts must be an
+// *rsa.OAEPOptions.
+func (d *Decrypter) Decrypt(_ io.Reader, ciphertext []byte, opts crypto.DecrypterOpts) ([]byte, error) {
+	alg, err := getEncryptionAlgorithm(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := defaultContext()
+	defer cancel()
+
+	resp, err := d.client.Decrypt(ctx, &kms.DecryptInput{
+		KeyId:               aws.String(d.keyID),
+		CiphertextBlob:      ciphertext,
+		EncryptionAlgorithm: alg,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("awskms Decrypt failed: %w", err)
+	}
+	return resp.Plaintext, nil
+}
+
+func getEncryptionAlgorithm(opts crypto.DecrypterOpts) (types.EncryptionAlgorithmSpec, error) {
+	switch o := opts.(type) {
+	case *rsa.OAEPOptions:
+		if len(o.Label) > 0 {
+			return "", errors.New("awskms does not support RSA-OAEP labels")
+		}
+		if o.MGFHash != 0 && o.MGFHash != o.Hash {
+			return "", fmt.Errorf("awskms does not support RSA-OAEP with MGF1 hash function %s", o.MGFHash)
+		}
+		switch o.Hash {
+		case crypto.SHA1:
+			return types.EncryptionAlgorithmSpecRsaesOaepSha1, nil
+		case crypto.SHA256:
+			return types.EncryptionAlgorithmSpecRsaesOaepSha256, nil
+		default:
+			return "", fmt.Errorf("awskms does not support RSA-OAEP with hash function %s", o.Hash)
+		}
+	case nil, *rsa.PKCS1v15DecryptOptions:
+		return "", errors.New("awskms does not support RSA PKCS #1 v1.5 decryption")
+	default:
+		return "", fmt.Errorf("awskms does not support decrypter options %T", opts)
+	}
+}
+
+// parseKeyID returns the key id, or ARN, in a URI like "awskms:key-id=<id>".
+// Other names are used as the key id.
+func parseKeyID(name string) (string, error) {
+	if !strings.HasPrefix(strings.ToLower(name), Scheme+":") && !strings.HasPrefix(strings.ToLower(name), "aws:") {
+		return name, nil
+	}
+	u, err := uri.Parse(name)
+	if err != nil {
+		return "", err
+	}
+	if k := u.Get("key-id"); k != "" {
+		return k, nil
+	}
+	return "", fmt.Errorf("failed to get key-id from %s", name)
+}
@@ -0,0 +1,9 @@
+// Package awskms extends the AWS KMS of go.step.sm/crypto with support for
+// RSA decryption, so an RSA key in AWS KMS can be used as the decrypter of a
+// SCEP provisioner. It registers the "awskms" type, replacing the one
+// registered by go.step.sm/crypto/kms/awskms, and all the other operations are
+// delegated to it.
+//
+// AWS KMS only supports RSA decryption with RSAES-OAEP using SHA-1 or
+// SHA-256, SCEP clients must use one of them to encrypt their requests.
+package awskms
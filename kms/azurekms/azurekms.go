@@ -0,0 +1,190 @@
+//go:build !noazurekms
+
+package azurekms
+
+import (
+	"context"
+	"crypto"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/cloud"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/azure-sdk-for-go/sdk/keyvault/azkeys"
+	"go.step.sm/crypto/kms/apiv1"
+	"go.step.sm/crypto/kms/azurekms"
+	"go.step.sm/crypto/kms/uri"
+)
+
+// Scheme is the scheme used in the Azure Key Vault URIs.
+const Scheme = azurekms.Scheme
+
+func init() {
+	apiv1.Register(apiv1.AzureKMS, func(ctx context.Context, opts apiv1.Options) (apiv1.KeyManager, error) {
+		return New(ctx, opts)
+	})
+}
+
+// DecryptClient defines the methods of the Key Vault client used by the
+// decrypter.
+type DecryptClient interface {
+	GetKey(ctx context.Context, name string, version string, options *azkeys.GetKeyOptions) (azkeys.GetKeyResponse, error)
+	Decrypt(ctx context.Context, name string, version string, parameters azkeys.KeyOperationsParameters, options *azkeys.DecryptOptions) (azkeys.DecryptResponse, error)
+}
+
+// KeyVault implements a KMS using Azure Key Vault. It's the KMS implemented in
+// go.step.sm/crypto/kms/azurekms with support for decryption.
+type KeyVault struct {
+	*azurekms.KeyVault
+	vault     string
+	dnsSuffix string
+	newClient func(vaultURL string) (DecryptClient, error)
+	mu        sync.Mutex
+	clients   map[string]DecryptClient
+}
+
+// New creates a new KMS using Azure Key Vault. It accepts the same URIs as the
+// Azure Key Vault KMS in go.step.sm/crypto, e.g.:
+//
+//	azurekms:vault=vault-name;environment=env-name
+func New(ctx context.Context, opts apiv1.Options) (*KeyVault, error) {
+	k, err := azurekms.New(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var u *uri.URI
+	if opts.URI != "" {
+		if u, err = uri.ParseWithScheme(Scheme, opts.URI); err != nil {
+			return nil, err
+		}
+	} else {
+		u = uri.New(Scheme, nil)
+	}
+	cloudConf, dnsSuffix, err := getCloudConfiguration(u.Get("environment"))
+	if err != nil {
+		return nil, err
+	}
+	credential, err := createCredentials(u, cloudConf)
+	if err != nil {
+		return nil, fmt.Errorf("error creating azure credentials: %w", err)
+	}
+
+	return &KeyVault{
+		KeyVault:  k,
+		vault:     u.Get("vault"),
+		dnsSuffix: dnsSuffix,
+		newClient: func(vaultURL string) (DecryptClient, error) {
+			return azkeys.NewClient(vaultURL, credential, &azkeys.ClientOptions{
+				// See https://aka.ms/azsdk/blog/vault-uri
+				DisableChallengeResourceVerification: true,
+			})
+		},
+		clients: make(map[string]DecryptClient),
+	}, nil
+}
+
+// createCredentials creates the Azure credentials the same way
+// go.step.sm/crypto/kms/azurekms does: using the client credentials in the
+// URI if they are set, or the default Azure credentials otherwise.
+func createCredentials(u *uri.URI, cloudConf cloud.Configuration) (azcore.TokenCredential, error) {
+	if v := u.Get("aad-endpoint"); v != "" {
+		cloudConf.ActiveDirectoryAuthorityHost = v
+	}
+	clientOptions := policy.ClientOptions{Cloud: cloudConf}
+
+	clientID := u.Get("client-id")
+	clientSecret := u.Get("client-secret")
+	tenantID := u.Get("tenant-id")
+	if clientID != "" && clientSecret != "" && tenantID != "" {
+		return azidentity.NewClientSecretCredential(tenantID, clientID, clientSecret, &azidentity.ClientSecretCredentialOptions{
+			ClientOptions: clientOptions,
+		})
+	}
+	return azidentity.NewDefaultAzureCredential(&azidentity.DefaultAzureCredentialOptions{
+		ClientOptions: clientOptions,
+		TenantID:      tenantID,
+	})
+}
+
+// getCloudConfiguration returns the configuration and the Key Vault DNS suffix
+// of an Azure cloud environment.
+func getCloudConfiguration(name string) (cloud.Configuration, string, error) {
+	switch strings.ToUpper(name) {
+	case "", "PUBLIC", "AZURECLOUD", "AZUREPUBLICCLOUD":
+		return cloud.AzurePublic, "vault.azure.net", nil
+	case "USGOV", "AZUREUSGOVERNMENT", "AZUREUSGOVERNMENTCLOUD":
+		return cloud.AzureGovernment, "vault.usgovcloudapi.net", nil
+	case "CHINA", "AZURECHINACLOUD":
+		return cloud.AzureChina, "vault.azure.cn", nil
+	case "GERMAN", "GERMANY", "AZUREGERMANCLOUD":
+		return cloud.Configuration{
+			ActiveDirectoryAuthorityHost: "https://login.microsoftonline.de/",
+			Services:                     map[cloud.ServiceName]cloud.ServiceConfiguration{},
+		}, "vault.microsoftazure.de", nil
+	default:
+		return cloud.Configuration{}, "", fmt.Errorf("unknown key vault cloud environment with name %q", name)
+	}
+}
+
+// CreateDecrypter returns a crypto.Decrypter using an RSA key in Azure Key
+// Vault. The key must allow the decrypt operation.
+func (k *KeyVault) CreateDecrypter(req *apiv1.CreateDecrypterRequest) (crypto.Decrypter, error) {
+	if req.DecryptionKey == "" {
+		return nil, errors.New("createDecrypterRequest 'decryptionKey' cannot be empty")
+	}
+	vault, name, version, err := parseKeyName(req.DecryptionKey, k.vault)
+	if err != nil {
+		return nil, err
+	}
+	client, err := k.getClient(vault)
+	if err != nil {
+		return nil, err
+	}
+	return newDecrypter(client, name, version)
+}
+
+// getClient returns the client of a vault, creating it the first time.
+func (k *KeyVault) getClient(vault string) (DecryptClient, error) {
+	vaultURL := "https://" + vault + "." + k.dnsSuffix + "/"
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if c, ok := k.clients[vaultURL]; ok {
+		return c, nil
+	}
+	c, err := k.newClient(vaultURL)
+	if err != nil {
+		return nil, fmt.Errorf("error creating client for vault %q: %w", vaultURL, err)
+	}
+	k.clients[vaultURL] = c
+	return c, nil
+}
+
+// parseKeyName returns the vault, name and version in URIs like
+// "azurekms:vault=vault-name;name=key-name?version=key-version".
+func parseKeyName(rawURI, defaultVault string) (vault, name, version string, err error) {
+	u, err := uri.ParseWithScheme(Scheme, rawURI)
+	if err != nil {
+		return "", "", "", err
+	}
+	if name = u.Get("name"); name == "" {
+		return "", "", "", fmt.Errorf("key uri %q is not valid: name is missing", rawURI)
+	}
+	if vault = u.Get("vault"); vault == "" {
+		if defaultVault == "" {
+			return "", "", "", fmt.Errorf("key uri %q is not valid: vault is missing", rawURI)
+		}
+		vault = defaultVault
+	}
+	return vault, name, u.Get("version"), nil
+}
+
+func defaultContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), 15*time.Second)
+}
@@ -0,0 +1,195 @@
+//go:build !noazurekms
+
+package azurekms
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1" //nolint:gosec // RSA-OAEP with SHA-1 is supported by Key Vault
+	"crypto/sha256"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/keyvault/azkeys"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.step.sm/crypto/kms"
+	"go.step.sm/crypto/kms/apiv1"
+)
+
+// mockClient decrypts the requests with the given key.
+type mockClient struct {
+	key    *rsa.PrivateKey
+	kty    azkeys.JSONWebKeyType
+	keyOps []*string
+	err    error
+}
+
+func (m *mockClient) GetKey(_ context.Context, name, version string, _ *azkeys.GetKeyOptions) (azkeys.GetKeyResponse, error) {
+	if m.err != nil {
+		return azkeys.GetKeyResponse{}, m.err
+	}
+	if name != "my-key" || (version != "" && version != "my-version") {
+		return azkeys.GetKeyResponse{}, errors.New("not found")
+	}
+	kty := m.kty
+	var resp azkeys.GetKeyResponse
+	resp.Key = &azkeys.JSONWebKey{
+		Kty:    &kty,
+		N:      m.key.N.Bytes(),
+		E:      big.NewInt(int64(m.key.E)).Bytes(),
+		KeyOps: m.keyOps,
+	}
+	return resp, nil
+}
+
+func (m *mockClient) Decrypt(_ context.Context, _, _ string, params azkeys.KeyOperationsParameters, _ *azkeys.DecryptOptions) (azkeys.DecryptResponse, error) {
+	var plaintext []byte
+	var err error
+	switch *params.Algorithm {
+	case azkeys.JSONWebKeyEncryptionAlgorithmRSA15:
+		plaintext, err = rsa.DecryptPKCS1v15(nil, m.key, params.Value)
+	case azkeys.JSONWebKeyEncryptionAlgorithmRSAOAEP:
+		plaintext, err = rsa.DecryptOAEP(sha1.New(), nil, m.key, params.Value, nil) //nolint:gosec // RSA-OAEP with SHA-1 is supported by Key Vault
+	case azkeys.JSONWebKeyEncryptionAlgorithmRSAOAEP256:
+		plaintext, err = rsa.DecryptOAEP(sha256.New(), nil, m.key, params.Value, nil)
+	default:
+		err = errors.New("unsupported algorithm")
+	}
+	if err != nil {
+		return azkeys.DecryptResponse{}, err
+	}
+	var resp azkeys.DecryptResponse
+	resp.Result = plaintext
+	return resp, nil
+}
+
+func newTestKeyVault(t *testing.T, client DecryptClient) *KeyVault {
+	t.Helper()
+	return &KeyVault{
+		vault:     "my-vault",
+		dnsSuffix: "vault.azure.net",
+		newClient: func(vaultURL string) (DecryptClient, error) {
+			if vaultURL != "https://my-vault.vault.azure.net/" {
+				return nil, errors.New("unknown vault")
+			}
+			return client, nil
+		},
+		clients: make(map[string]DecryptClient),
+	}
+}
+
+func TestNew(t *testing.T) {
+	ctx := context.Background()
+	got, err := New(ctx, apiv1.Options{URI: "azurekms:vault=my-vault;environment=usgov;tenant-id=tenant;client-id=client;client-secret=secret"})
+	require.NoError(t, err)
+	assert.NotNil(t, got.KeyVault)
+	assert.Equal(t, "my-vault", got.vault)
+	assert.Equal(t, "vault.usgovcloudapi.net", got.dnsSuffix)
+
+	_, err = New(ctx, apiv1.Options{URI: "azurekms:environment=mars;tenant-id=tenant;client-id=client;client-secret=secret"})
+	assert.Error(t, err)
+	_, err = New(ctx, apiv1.Options{URI: "awskms:vault=my-vault"})
+	assert.Error(t, err)
+}
+
+func TestRegister(t *testing.T) {
+	k, err := kms.New(context.Background(), apiv1.Options{
+		Type: apiv1.AzureKMS,
+		URI:  "azurekms:vault=my-vault;tenant-id=tenant;client-id=client;client-secret=secret",
+	})
+	require.NoError(t, err)
+	assert.IsType(t, &KeyVault{}, k)
+	assert.Implements(t, (*apiv1.Decrypter)(nil), k)
+}
+
+func TestKeyVault_CreateDecrypter(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	decrypt, sign := string(azkeys.JSONWebKeyOperationDecrypt), string(azkeys.JSONWebKeyOperationSign)
+
+	tests := []struct {
+		name        string
+		client      *mockClient
+		key         string
+		wantVersion string
+		wantErr     bool
+	}{
+		{"ok", &mockClient{key: key, kty: azkeys.JSONWebKeyTypeRSA}, "azurekms:name=my-key", "", false},
+		{"ok vault", &mockClient{key: key, kty: azkeys.JSONWebKeyTypeRSAHSM, keyOps: []*string{&sign, &decrypt}}, "azurekms:name=my-key;vault=my-vault?version=my-version", "my-version", false},
+		{"fail empty", &mockClient{key: key, kty: azkeys.JSONWebKeyTypeRSA}, "", "", true},
+		{"fail name", &mockClient{key: key, kty: azkeys.JSONWebKeyTypeRSA}, "azurekms:vault=my-vault", "", true},
+		{"fail scheme", &mockClient{key: key, kty: azkeys.JSONWebKeyTypeRSA}, "awskms:name=my-key", "", true},
+		{"fail vault", &mockClient{key: key, kty: azkeys.JSONWebKeyTypeRSA}, "azurekms:name=my-key;vault=other-vault", "", true},
+		{"fail key type", &mockClient{key: key, kty: azkeys.JSONWebKeyTypeEC}, "azurekms:name=my-key", "", true},
+		{"fail key ops", &mockClient{key: key, kty: azkeys.JSONWebKeyTypeRSA, keyOps: []*string{&sign}}, "azurekms:name=my-key", "", true},
+		{"fail client", &mockClient{err: errors.New("test error")}, "azurekms:name=my-key", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k := newTestKeyVault(t, tt.client)
+			got, err := k.CreateDecrypter(&apiv1.CreateDecrypterRequest{DecryptionKey: tt.key})
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "my-key", got.(*Decrypter).name)
+			assert.Equal(t, tt.wantVersion, got.(*Decrypter).version)
+			assert.Equal(t, key.Public(), got.Public())
+		})
+	}
+
+	// Without a default vault the vault is required.
+	k := newTestKeyVault(t, &mockClient{key: key, kty: azkeys.JSONWebKeyTypeRSA})
+	k.vault = ""
+	_, err = k.CreateDecrypter(&apiv1.CreateDecrypterRequest{DecryptionKey: "azurekms:name=my-key"})
+	assert.Error(t, err)
+}
+
+func TestDecrypter_Decrypt(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	k := newTestKeyVault(t, &mockClient{key: key, kty: azkeys.JSONWebKeyTypeRSA})
+	d, err := k.CreateDecrypter(&apiv1.CreateDecrypterRequest{DecryptionKey: "azurekms:name=my-key"})
+	require.NoError(t, err)
+
+	msg := []byte("the content encryption key")
+	pkcs1Ciphertext, err := rsa.EncryptPKCS1v15(rand.Reader, &key.PublicKey, msg)
+	require.NoError(t, err)
+	sha1Ciphertext, err := rsa.EncryptOAEP(sha1.New(), rand.Reader, &key.PublicKey, msg, nil) //nolint:gosec // RSA-OAEP with SHA-1 is supported by Key Vault
+	require.NoError(t, err)
+	sha256Ciphertext, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, &key.PublicKey, msg, nil)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		ciphertext []byte
+		opts       crypto.DecrypterOpts
+		wantErr    bool
+	}{
+		{"ok pkcs1v15", pkcs1Ciphertext, nil, false},
+		{"ok pkcs1v15 options", pkcs1Ciphertext, &rsa.PKCS1v15DecryptOptions{}, false},
+		{"ok sha1", sha1Ciphertext, &rsa.OAEPOptions{Hash: crypto.SHA1}, false},
+		{"ok sha256", sha256Ciphertext, &rsa.OAEPOptions{Hash: crypto.SHA256, MGFHash: crypto.SHA256}, false},
+		{"fail hash", sha256Ciphertext, &rsa.OAEPOptions{Hash: crypto.SHA512}, true},
+		{"fail mgf hash", sha256Ciphertext, &rsa.OAEPOptions{Hash: crypto.SHA256, MGFHash: crypto.SHA1}, true},
+		{"fail label", sha256Ciphertext, &rsa.OAEPOptions{Hash: crypto.SHA256, Label: []byte("label")}, true},
+		{"fail options", sha256Ciphertext, crypto.SHA256, true},
+		{"fail decrypt", sha1Ciphertext, &rsa.OAEPOptions{Hash: crypto.SHA256}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := d.Decrypt(rand.Reader, tt.ciphertext, tt.opts)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, msg, got)
+		})
+	}
+}
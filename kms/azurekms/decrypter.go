@@ -0,0 +1,118 @@
+//go:build !noazurekms
+
+package azurekms
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/keyvault/azkeys"
+)
+
+// Decrypter implements a crypto.Decrypter using an RSA key in Azure Key Vault.
+type Decrypter struct {
+	client    DecryptClient
+	name      string
+	version   string
+	publicKey *rsa.PublicKey
+}
+
+// newDecrypter creates a new decrypter, the key is loaded to make sure it
+// exists and it can be used for decryption.
+func newDecrypter(client DecryptClient, name, version string) (*Decrypter, error) {
+	ctx, cancel := defaultContext()
+	defer cancel()
+
+	resp, err := client.GetKey(ctx, name, version, nil)
+	if err != nil {
+		return nil, fmt.Errorf("keyVault GetKey failed: %w", err)
+	}
+	key := resp.Key
+	if key == nil || key.Kty == nil {
+		return nil, errors.New("invalid key: missing kty value")
+	}
+	if kty := *key.Kty; kty != azkeys.JSONWebKeyTypeRSA && kty != azkeys.JSONWebKeyTypeRSAHSM {
+		return nil, fmt.Errorf("keyVault does not support decryption with keys of type %q", kty)
+	}
+	if len(key.N) == 0 || len(key.E) == 0 || len(key.E) > 4 {
+		return nil, errors.New("invalid RSA key: invalid modulus or exponent")
+	}
+	if key.KeyOps != nil && !hasKeyOperation(key.KeyOps, azkeys.JSONWebKeyOperationDecrypt) {
+		return nil, fmt.Errorf("keyVault key %s cannot be used for decryption", name)
+	}
+
+	return &Decrypter{
+		client:  client,
+		name:    name,
+		version: version,
+		publicKey: &rsa.PublicKey{
+			N: new(big.Int).SetBytes(key.N),
+			E: int(new(big.Int).SetBytes(key.E).Int64()),
+		},
+	}, nil
+}
+
+func hasKeyOperation(ops []*string, op azkeys.JSONWebKeyOperation) bool {
+	for _, o := range ops {
+		if o != nil && *o == string(op) {
+			return true
+		}
+	}
+	return false
+}
+
+// Public returns the public key of this decrypter.
+func (d *Decrypter) Public() crypto.PublicKey {
+	return d.publicKey
+}
+
+// Decrypt decrypts the ciphertext with the key in Azure Key Vault. It uses
+// RSAES-PKCS1-v1_5 if opts is nil or an *rsa.PKCS1v15DecryptOptions, and
+// RSAES-OAEP with SHA-1 or SHA-256, and no label, if opts is an
+// *rsa.OAEPOptions.
+func (d *Decrypter) Decrypt(_ io.Reader, ciphertext []byte, opts crypto.DecrypterOpts) ([]byte, error) {
+	alg, err := getEncryptionAlgorithm(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := defaultContext()
+	defer cancel()
+
+	resp, err := d.client.Decrypt(ctx, d.name, d.version, azkeys.KeyOperationsParameters{
+		Algorithm: &alg,
+		Value:     ciphertext,
+	}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("keyVault Decrypt failed: %w", err)
+	}
+	return resp.Result, nil
+}
+
+func getEncryptionAlgorithm(opts crypto.DecrypterOpts) (azkeys.JSONWebKeyEncryptionAlgorithm, error) {
+	switch o := opts.(type) {
+	case nil, *rsa.PKCS1v15DecryptOptions:
+		return azkeys.JSONWebKeyEncryptionAlgorithmRSA15, nil
+	case *rsa.OAEPOptions:
+		if len(o.Label) > 0 {
+			return "", errors.New("keyVault does not support RSA-OAEP labels")
+		}
+		if o.MGFHash != 0 && o.MGFHash != o.Hash {
+			return "", fmt.Errorf("keyVault does not support RSA-OAEP with MGF1 hash function %s", o.MGFHash)
+		}
+		switch o.Hash {
+		case crypto.SHA1:
+			return azkeys.JSONWebKeyEncryptionAlgorithmRSAOAEP, nil
+		case crypto.SHA256:
+			return azkeys.JSONWebKeyEncryptionAlgorithmRSAOAEP256, nil
+		default:
+			return "", fmt.Errorf("keyVault does not support RSA-OAEP with hash function %s", o.Hash)
+		}
+	default:
+		return "", fmt.Errorf("keyVault does not support decrypter options %T", opts)
+	}
+}
@@ -0,0 +1,9 @@
+// Package azurekms extends the Azure Key Vault KMS of go.step.sm/crypto with
+// support for RSA decryption, so an RSA key in Azure Key Vault can be used as
+// the decrypter of a SCEP provisioner. It registers the "azurekms" type,
+// replacing the one registered by go.step.sm/crypto/kms/azurekms, and all the
+// other operations are delegated to it.
+//
+// Key Vault supports RSA decryption with RSAES-PKCS1-v1_5 and RSAES-OAEP
+// using SHA-1 or SHA-256.
+package azurekms
@@ -0,0 +1,234 @@
+package fortanixkms
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// tokenExpiryMargin is the time before the expiration of the session token in
+// which a new token is requested.
+const tokenExpiryMargin = 30 * time.Second
+
+// client is a minimal client of the Fortanix DSM REST API. It authenticates
+// as an application using an API key, the base64 encoding of the application
+// id and secret, and uses the returned bearer token in the crypto requests.
+type client struct {
+	baseURL    string
+	apiKey     string
+	httpClient *http.Client
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+func newClient(baseURL, apiKey string) *client {
+	return &client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		apiKey:     apiKey,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// authResponse is the response of the session auth request.
+type authResponse struct {
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int    `json:"expires_in"`
+	AccessToken string `json:"access_token"`
+}
+
+// sobjectDescriptor identifies a security object by kid or by name.
+type sobjectDescriptor struct {
+	Kid  string `json:"kid,omitempty"`
+	Name string `json:"name,omitempty"`
+}
+
+// sobject is the security object returned by the API. PubKey is the DER
+// encoded public key.
+type sobject struct {
+	Kid           string `json:"kid"`
+	Name          string `json:"name"`
+	ObjType       string `json:"obj_type"`
+	KeySize       int    `json:"key_size,omitempty"`
+	EllipticCurve string `json:"elliptic_curve,omitempty"`
+	PubKey        []byte `json:"pub_key"`
+}
+
+// sobjectRequest is the body of the create key request.
+type sobjectRequest struct {
+	Name          string   `json:"name"`
+	ObjType       string   `json:"obj_type"`
+	KeySize       int      `json:"key_size,omitempty"`
+	EllipticCurve string   `json:"elliptic_curve,omitempty"`
+	KeyOps        []string `json:"key_ops"`
+}
+
+// signRequest is the body of the sign request. Hash is the digest to sign.
+type signRequest struct {
+	Key     sobjectDescriptor `json:"key"`
+	HashAlg string            `json:"hash_alg"`
+	Hash    []byte            `json:"hash"`
+	Mode    *signatureMode    `json:"mode,omitempty"`
+}
+
+// signatureMode is the padding used in RSA signatures, only one of the
+// fields must be set.
+type signatureMode struct {
+	PKCS1v15 *struct{}  `json:"PKCS1_V15,omitempty"`
+	PSS      *pssParams `json:"PSS,omitempty"`
+}
+
+type pssParams struct {
+	MGF mgf `json:"mgf"`
+}
+
+type mgf struct {
+	MGF1 mgf1 `json:"mgf1"`
+}
+
+type mgf1 struct {
+	Hash string `json:"hash"`
+}
+
+// signResponse is the response of the sign request.
+type signResponse struct {
+	Kid       string `json:"kid"`
+	Signature []byte `json:"signature"`
+}
+
+// apiError is the error returned by the API, the body of the response is a
+// plain text message.
+type apiError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *apiError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("fortanix request failed with status code %d", e.StatusCode)
+	}
+	return fmt.Sprintf("fortanix request failed with status code %d: %s", e.StatusCode, e.Message)
+}
+
+// GetKey returns the security object with the given kid or name.
+func (c *client) GetKey(ctx context.Context, key sobjectDescriptor) (*sobject, error) {
+	resp := new(sobject)
+	if err := c.do(ctx, http.MethodPost, "/crypto/v1/keys/info", key, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// CreateKey creates a new security object.
+func (c *client) CreateKey(ctx context.Context, req *sobjectRequest) (*sobject, error) {
+	resp := new(sobject)
+	if err := c.do(ctx, http.MethodPost, "/crypto/v1/keys", req, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// Sign signs a digest with the given key.
+func (c *client) Sign(ctx context.Context, req *signRequest) (*signResponse, error) {
+	resp := new(signResponse)
+	if err := c.do(ctx, http.MethodPost, "/crypto/v1/sign", req, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// getToken returns the current session token, or authenticates to get a new
+// one if it's not set or it's about to expire.
+func (c *client) getToken(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.token != "" && time.Now().Add(tokenExpiryMargin).Before(c.expires) {
+		return c.token, nil
+	}
+
+	resp := new(authResponse)
+	if err := c.send(ctx, http.MethodPost, "/sys/v1/session/auth", "Basic "+c.apiKey, nil, resp); err != nil {
+		return "", fmt.Errorf("fortanix authentication failed: %w", err)
+	}
+	if resp.AccessToken == "" {
+		return "", errors.New("fortanix authentication failed: access_token is empty")
+	}
+	c.token = resp.AccessToken
+	c.expires = time.Now().Add(time.Duration(resp.ExpiresIn) * time.Second)
+	return c.token, nil
+}
+
+// resetToken removes the session token if it's still the given one.
+func (c *client) resetToken(token string) {
+	c.mu.Lock()
+	if c.token == token {
+		c.token = ""
+	}
+	c.mu.Unlock()
+}
+
+// do sends an authenticated request to the API. If the session token is
+// rejected, it authenticates again and retries the request once.
+func (c *client) do(ctx context.Context, method, path string, in, out any) error {
+	for i := 0; ; i++ {
+		token, err := c.getToken(ctx)
+		if err != nil {
+			return err
+		}
+		err = c.send(ctx, method, path, "Bearer "+token, in, out)
+		var e *apiError
+		if i == 0 && errors.As(err, &e) && e.StatusCode == http.StatusUnauthorized {
+			c.resetToken(token)
+			continue
+		}
+		return err
+	}
+}
+
+func (c *client) send(ctx context.Context, method, path, authorization string, in, out any) error {
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return fmt.Errorf("error marshaling request: %w", err)
+		}
+		body = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, body)
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("Authorization", authorization)
+	req.Header.Set("Accept", "application/json")
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("fortanix %s %s failed: %w", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return &apiError{
+			StatusCode: resp.StatusCode,
+			Message:    strings.TrimSpace(string(b)),
+		}
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("error decoding response: %w", err)
+	}
+	return nil
+}
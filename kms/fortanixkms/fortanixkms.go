@@ -0,0 +1,223 @@
+// Package fortanixkms implements a KMS using the REST API of Fortanix DSM. It
+// registers the "fortanixkms" type, so it can be used in the kms object of
+// the ca.json, and keys can be referenced by URIs like
+// "fortanixkms:kid=<uuid>" or "fortanixkms:name=<name>".
+//
+// Other REST "HSM as a service" products can be added following the same
+// layout: a client with the authentication and the get public key, create key
+// and sign requests of the product, and an implementation of
+// apiv1.KeyManager, registered with apiv1.Register, that maps the key URIs
+// and signature algorithms to them. The signer only sends the digest to the
+// service, signatures are verified locally with the public key.
+package fortanixkms
+
+import (
+	"context"
+	"crypto"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"go.step.sm/crypto/kms/apiv1"
+	"go.step.sm/crypto/kms/uri"
+	"go.step.sm/crypto/pemutil"
+)
+
+// Scheme is the scheme used in the Fortanix DSM URIs.
+const Scheme = "fortanixkms"
+
+// Type is the KMS type of Fortanix DSM.
+const Type = apiv1.Type(Scheme)
+
+// DefaultEndpoint is the endpoint of the Fortanix DSM SaaS in North America.
+const DefaultEndpoint = "https://amer.smartkey.io"
+
+func init() {
+	apiv1.Register(Type, func(ctx context.Context, opts apiv1.Options) (apiv1.KeyManager, error) {
+		return New(ctx, opts)
+	})
+}
+
+// keyOps are the operations allowed in the keys created by the KMS.
+var keyOps = []string{"SIGN", "VERIFY", "APPMANAGEABLE"}
+
+// ellipticCurves maps the ECDSA signature algorithms to Fortanix curves.
+var ellipticCurves = map[apiv1.SignatureAlgorithm]string{
+	apiv1.UnspecifiedSignAlgorithm: "NistP256",
+	apiv1.ECDSAWithSHA256:          "NistP256",
+	apiv1.ECDSAWithSHA384:          "NistP384",
+	apiv1.ECDSAWithSHA512:          "NistP521",
+}
+
+// KMS implements a KMS using Fortanix DSM, or Fortanix SDKMS, as a REST HSM.
+type KMS struct {
+	client *client
+}
+
+// New creates a new KMS using Fortanix DSM. The endpoint and the file with the
+// application API key are configured in the URI, e.g.:
+//
+//	fortanixkms:endpoint=https://eu.smartkey.io;api-key-file=/run/secrets/fortanix
+//
+// The API key file can also be set using the credentialsFile option. The
+// endpoint defaults to DefaultEndpoint.
+func New(_ context.Context, opts apiv1.Options) (*KMS, error) {
+	endpoint := DefaultEndpoint
+	apiKeyFile := opts.CredentialsFile
+	if opts.URI != "" {
+		u, err := uri.ParseWithScheme(Scheme, opts.URI)
+		if err != nil {
+			return nil, err
+		}
+		if v := u.Get("endpoint"); v != "" {
+			endpoint = v
+		}
+		if v := u.Get("api-key-file"); v != "" {
+			apiKeyFile = v
+		}
+	}
+	if apiKeyFile == "" {
+		return nil, errors.New("fortanixkms api-key-file or credentialsFile are required")
+	}
+	if _, err := url.ParseRequestURI(endpoint); err != nil {
+		return nil, fmt.Errorf("fortanixkms endpoint %q is not valid: %w", endpoint, err)
+	}
+
+	b, err := os.ReadFile(apiKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", apiKeyFile, err)
+	}
+	apiKey := strings.TrimSpace(string(b))
+	if apiKey == "" {
+		return nil, fmt.Errorf("fortanixkms api key in %s is empty", apiKeyFile)
+	}
+
+	return &KMS{
+		client: newClient(endpoint, apiKey),
+	}, nil
+}
+
+// GetPublicKey returns the public key of a key in Fortanix DSM.
+func (k *KMS) GetPublicKey(req *apiv1.GetPublicKeyRequest) (crypto.PublicKey, error) {
+	if req.Name == "" {
+		return nil, errors.New("getPublicKey 'name' cannot be empty")
+	}
+	key, err := parseKey(req.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := defaultContext()
+	defer cancel()
+
+	obj, err := k.client.GetKey(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("fortanixkms GetKey failed: %w", err)
+	}
+	return pemutil.ParseDER(obj.PubKey)
+}
+
+// CreateKey creates a new key in Fortanix DSM. The name of the key is the
+// name of the security object, and the returned name is a URI with its kid.
+func (k *KMS) CreateKey(req *apiv1.CreateKeyRequest) (*apiv1.CreateKeyResponse, error) {
+	if req.Name == "" {
+		return nil, errors.New("createKeyRequest 'name' cannot be empty")
+	}
+	key, err := parseKey(req.Name)
+	if err != nil {
+		return nil, err
+	}
+	if key.Name == "" {
+		return nil, fmt.Errorf("createKeyRequest 'name' %s does not contain a key name", req.Name)
+	}
+
+	sreq := &sobjectRequest{
+		Name:   key.Name,
+		KeyOps: keyOps,
+	}
+	switch req.SignatureAlgorithm {
+	case apiv1.SHA256WithRSA, apiv1.SHA384WithRSA, apiv1.SHA512WithRSA,
+		apiv1.SHA256WithRSAPSS, apiv1.SHA384WithRSAPSS, apiv1.SHA512WithRSAPSS:
+		sreq.ObjType = "RSA"
+		sreq.KeySize = req.Bits
+		if sreq.KeySize == 0 {
+			sreq.KeySize = 3072
+		}
+	default:
+		curve, ok := ellipticCurves[req.SignatureAlgorithm]
+		if !ok {
+			return nil, fmt.Errorf("fortanixkms does not support signature algorithm '%s'", req.SignatureAlgorithm)
+		}
+		sreq.ObjType = "EC"
+		sreq.EllipticCurve = curve
+	}
+
+	ctx, cancel := defaultContext()
+	defer cancel()
+
+	obj, err := k.client.CreateKey(ctx, sreq)
+	if err != nil {
+		return nil, fmt.Errorf("fortanixkms CreateKey failed: %w", err)
+	}
+	pub, err := pemutil.ParseDER(obj.PubKey)
+	if err != nil {
+		return nil, err
+	}
+
+	name := uri.New(Scheme, url.Values{
+		"kid": []string{obj.Kid},
+	}).String()
+	return &apiv1.CreateKeyResponse{
+		Name:      name,
+		PublicKey: pub,
+		CreateSignerRequest: apiv1.CreateSignerRequest{
+			SigningKey: name,
+		},
+	}, nil
+}
+
+// CreateSigner creates a new crypto.Signer with a key in Fortanix DSM.
+func (k *KMS) CreateSigner(req *apiv1.CreateSignerRequest) (crypto.Signer, error) {
+	if req.SigningKey == "" {
+		return nil, errors.New("createSigner 'signingKey' cannot be empty")
+	}
+	key, err := parseKey(req.SigningKey)
+	if err != nil {
+		return nil, err
+	}
+	return newSigner(k.client, key)
+}
+
+// Close releases the connections of the KMS client.
+func (k *KMS) Close() error {
+	k.client.httpClient.CloseIdleConnections()
+	return nil
+}
+
+// parseKey returns the descriptor of a key in the formats
+// "fortanixkms:kid=<uuid>", "fortanixkms:name=<name>", or just the name of
+// the key.
+func parseKey(rawuri string) (sobjectDescriptor, error) {
+	if !strings.HasPrefix(strings.ToLower(rawuri), Scheme+":") {
+		return sobjectDescriptor{Name: rawuri}, nil
+	}
+	u, err := uri.ParseWithScheme(Scheme, rawuri)
+	if err != nil {
+		return sobjectDescriptor{}, err
+	}
+	key := sobjectDescriptor{
+		Kid:  u.Get("kid"),
+		Name: u.Get("name"),
+	}
+	if key.Kid == "" && key.Name == "" {
+		return sobjectDescriptor{}, fmt.Errorf("failed to get kid or name from %s", rawuri)
+	}
+	return key, nil
+}
+
+func defaultContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), 15*time.Second)
+}
@@ -0,0 +1,385 @@
+package fortanixkms
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.step.sm/crypto/kms"
+	"go.step.sm/crypto/kms/apiv1"
+)
+
+const testAPIKey = "YXBwLWlkOnNlY3JldA=="
+
+// testServer is a fake Fortanix DSM API.
+type testServer struct {
+	mu     sync.Mutex
+	keys   map[string]crypto.Signer
+	names  map[string]string
+	tokens map[string]bool
+	auths  int
+	last   *signRequest
+}
+
+func newTestServer(t *testing.T) (*testServer, string) {
+	t.Helper()
+	s := &testServer{
+		keys:   make(map[string]crypto.Signer),
+		names:  make(map[string]string),
+		tokens: make(map[string]bool),
+	}
+	srv := httptest.NewServer(s)
+	t.Cleanup(srv.Close)
+	return s, srv.URL
+}
+
+func (s *testServer) addKey(t *testing.T, kid, name string, key crypto.Signer) {
+	t.Helper()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys[kid] = key
+	s.names[name] = kid
+}
+
+func (s *testServer) expireTokens() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokens = make(map[string]bool)
+}
+
+func (s *testServer) sobject(kid string) (*sobject, error) {
+	key, ok := s.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("key %s not found", kid)
+	}
+	der, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		return nil, err
+	}
+	obj := &sobject{Kid: kid, PubKey: der}
+	for name, k := range s.names {
+		if k == kid {
+			obj.Name = name
+		}
+	}
+	return obj, nil
+}
+
+func (s *testServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if r.URL.Path == "/sys/v1/session/auth" {
+		if r.Header.Get("Authorization") != "Basic "+testAPIKey {
+			http.Error(w, "invalid api key", http.StatusUnauthorized)
+			return
+		}
+		s.auths++
+		token := fmt.Sprintf("token-%d", s.auths)
+		s.tokens[token] = true
+		writeJSON(w, &authResponse{TokenType: "Bearer", ExpiresIn: 600, AccessToken: token})
+		return
+	}
+
+	if !s.tokens[strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")] {
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	switch r.URL.Path {
+	case "/crypto/v1/keys/info":
+		var req sobjectDescriptor
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		kid := req.Kid
+		if kid == "" {
+			kid = s.names[req.Name]
+		}
+		obj, err := s.sobject(kid)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		writeJSON(w, obj)
+	case "/crypto/v1/keys":
+		var req sobjectRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var key crypto.Signer
+		var err error
+		switch {
+		case req.ObjType == "RSA":
+			key, err = rsa.GenerateKey(rand.Reader, req.KeySize)
+		case req.ObjType == "EC" && req.EllipticCurve == "NistP256":
+			key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		case req.ObjType == "EC" && req.EllipticCurve == "NistP384":
+			key, err = ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+		default:
+			err = fmt.Errorf("unsupported key %s %s", req.ObjType, req.EllipticCurve)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		kid := fmt.Sprintf("kid-%d", len(s.keys)+1)
+		s.keys[kid] = key
+		s.names[req.Name] = kid
+		obj, err := s.sobject(kid)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, obj)
+	case "/crypto/v1/sign":
+		var req signRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.last = &req
+		key, ok := s.keys[req.Key.Kid]
+		if !ok {
+			http.Error(w, "key not found", http.StatusNotFound)
+			return
+		}
+		var opts crypto.SignerOpts = crypto.SHA256
+		if req.Mode != nil && req.Mode.PSS != nil {
+			opts = &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: crypto.SHA256}
+		}
+		sig, err := key.Sign(rand.Reader, req.Hash, opts)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, &signResponse{Kid: req.Key.Kid, Signature: sig})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeAPIKey(t *testing.T, apiKey string) string {
+	t.Helper()
+	filename := filepath.Join(t.TempDir(), "api-key")
+	require.NoError(t, os.WriteFile(filename, []byte(apiKey+"\n"), 0o600))
+	return filename
+}
+
+func newTestKMS(t *testing.T) (*KMS, *testServer) {
+	t.Helper()
+	s, u := newTestServer(t)
+	k, err := New(context.Background(), apiv1.Options{
+		Type: Type,
+		URI:  "fortanixkms:endpoint=" + u + ";api-key-file=" + writeAPIKey(t, testAPIKey),
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { k.Close() })
+	return k, s
+}
+
+func TestNew(t *testing.T) {
+	apiKeyFile := writeAPIKey(t, testAPIKey)
+	emptyFile := writeAPIKey(t, "")
+
+	tests := []struct {
+		name     string
+		opts     apiv1.Options
+		endpoint string
+		wantErr  bool
+	}{
+		{"ok", apiv1.Options{URI: "fortanixkms:endpoint=https://eu.smartkey.io;api-key-file=" + apiKeyFile}, "https://eu.smartkey.io", false},
+		{"ok credentialsFile", apiv1.Options{CredentialsFile: apiKeyFile}, DefaultEndpoint, false},
+		{"fail uri", apiv1.Options{URI: "awskms:api-key-file=" + apiKeyFile}, "", true},
+		{"fail no api key", apiv1.Options{URI: "fortanixkms:endpoint=https://eu.smartkey.io"}, "", true},
+		{"fail missing file", apiv1.Options{CredentialsFile: filepath.Join(t.TempDir(), "missing")}, "", true},
+		{"fail empty file", apiv1.Options{CredentialsFile: emptyFile}, "", true},
+		{"fail endpoint", apiv1.Options{URI: "fortanixkms:endpoint=smartkey;api-key-file=" + apiKeyFile}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := New(context.Background(), tt.opts)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.endpoint, got.client.baseURL)
+			assert.Equal(t, testAPIKey, got.client.apiKey)
+		})
+	}
+}
+
+func TestRegister(t *testing.T) {
+	_, u := newTestServer(t)
+	k, err := kms.New(context.Background(), apiv1.Options{
+		Type:            "fortanixkms",
+		URI:             "fortanixkms:endpoint=" + u,
+		CredentialsFile: writeAPIKey(t, testAPIKey),
+	})
+	require.NoError(t, err)
+	assert.IsType(t, &KMS{}, k)
+}
+
+func TestKMS_GetPublicKey(t *testing.T) {
+	k, s := newTestKMS(t)
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	s.addKey(t, "kid-1", "my-key", key)
+
+	for _, name := range []string{"fortanixkms:kid=kid-1", "fortanixkms:name=my-key", "my-key"} {
+		pub, err := k.GetPublicKey(&apiv1.GetPublicKeyRequest{Name: name})
+		require.NoError(t, err, name)
+		assert.Equal(t, key.Public(), pub, name)
+	}
+
+	_, err = k.GetPublicKey(&apiv1.GetPublicKeyRequest{})
+	assert.Error(t, err)
+	_, err = k.GetPublicKey(&apiv1.GetPublicKeyRequest{Name: "fortanixkms:foo=bar"})
+	assert.Error(t, err)
+	_, err = k.GetPublicKey(&apiv1.GetPublicKeyRequest{Name: "fortanixkms:kid=missing"})
+	var e *apiError
+	require.ErrorAs(t, err, &e)
+	assert.Equal(t, http.StatusNotFound, e.StatusCode)
+}
+
+func TestKMS_CreateKey(t *testing.T) {
+	k, _ := newTestKMS(t)
+
+	resp, err := k.CreateKey(&apiv1.CreateKeyRequest{Name: "fortanixkms:name=ec-key"})
+	require.NoError(t, err)
+	assert.Equal(t, "fortanixkms:kid=kid-1", resp.Name)
+	assert.Equal(t, "fortanixkms:kid=kid-1", resp.CreateSignerRequest.SigningKey)
+	assert.Equal(t, elliptic.P256(), resp.PublicKey.(*ecdsa.PublicKey).Curve)
+
+	resp, err = k.CreateKey(&apiv1.CreateKeyRequest{Name: "ec384-key", SignatureAlgorithm: apiv1.ECDSAWithSHA384})
+	require.NoError(t, err)
+	assert.Equal(t, elliptic.P384(), resp.PublicKey.(*ecdsa.PublicKey).Curve)
+
+	resp, err = k.CreateKey(&apiv1.CreateKeyRequest{Name: "rsa-key", SignatureAlgorithm: apiv1.SHA256WithRSA, Bits: 2048})
+	require.NoError(t, err)
+	assert.Equal(t, 2048, resp.PublicKey.(*rsa.PublicKey).N.BitLen())
+
+	pub, err := k.GetPublicKey(&apiv1.GetPublicKeyRequest{Name: "rsa-key"})
+	require.NoError(t, err)
+	assert.Equal(t, resp.PublicKey, pub)
+
+	_, err = k.CreateKey(&apiv1.CreateKeyRequest{})
+	assert.Error(t, err)
+	_, err = k.CreateKey(&apiv1.CreateKeyRequest{Name: "fortanixkms:kid=kid-1"})
+	assert.Error(t, err)
+	_, err = k.CreateKey(&apiv1.CreateKeyRequest{Name: "ed-key", SignatureAlgorithm: apiv1.PureEd25519})
+	assert.Error(t, err)
+	_, err = k.CreateKey(&apiv1.CreateKeyRequest{Name: "ec521-key", SignatureAlgorithm: apiv1.ECDSAWithSHA512})
+	assert.Error(t, err)
+}
+
+func TestKMS_CreateSigner(t *testing.T) {
+	k, s := newTestKMS(t)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	s.addKey(t, "kid-ec", "ec-key", ecKey)
+	s.addKey(t, "kid-rsa", "rsa-key", rsaKey)
+	digest := sha256.Sum256([]byte("message"))
+
+	t.Run("ecdsa", func(t *testing.T) {
+		signer, err := k.CreateSigner(&apiv1.CreateSignerRequest{SigningKey: "fortanixkms:name=ec-key"})
+		require.NoError(t, err)
+		assert.Equal(t, ecKey.Public(), signer.Public())
+		sig, err := signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+		require.NoError(t, err)
+		assert.True(t, ecdsa.VerifyASN1(&ecKey.PublicKey, digest[:], sig))
+		assert.Equal(t, sobjectDescriptor{Kid: "kid-ec"}, s.last.Key)
+		assert.Equal(t, "SHA256", s.last.HashAlg)
+		assert.Nil(t, s.last.Mode)
+	})
+
+	t.Run("rsa", func(t *testing.T) {
+		signer, err := k.CreateSigner(&apiv1.CreateSignerRequest{SigningKey: "fortanixkms:kid=kid-rsa"})
+		require.NoError(t, err)
+		sig, err := signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+		require.NoError(t, err)
+		assert.NoError(t, rsa.VerifyPKCS1v15(&rsaKey.PublicKey, crypto.SHA256, digest[:], sig))
+		assert.NotNil(t, s.last.Mode.PKCS1v15)
+	})
+
+	t.Run("rsa-pss", func(t *testing.T) {
+		signer, err := k.CreateSigner(&apiv1.CreateSignerRequest{SigningKey: "rsa-key"})
+		require.NoError(t, err)
+		opts := &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: crypto.SHA256}
+		sig, err := signer.Sign(rand.Reader, digest[:], opts)
+		require.NoError(t, err)
+		assert.NoError(t, rsa.VerifyPSS(&rsaKey.PublicKey, crypto.SHA256, digest[:], sig, opts))
+		assert.Equal(t, "SHA256", s.last.Mode.PSS.MGF.MGF1.Hash)
+
+		_, err = signer.Sign(rand.Reader, digest[:], &rsa.PSSOptions{SaltLength: 10, Hash: crypto.SHA256})
+		assert.Error(t, err)
+	})
+
+	t.Run("fail", func(t *testing.T) {
+		_, err := k.CreateSigner(&apiv1.CreateSignerRequest{})
+		assert.Error(t, err)
+		_, err = k.CreateSigner(&apiv1.CreateSignerRequest{SigningKey: "fortanixkms:kid=missing"})
+		assert.Error(t, err)
+
+		signer, err := k.CreateSigner(&apiv1.CreateSignerRequest{SigningKey: "ec-key"})
+		require.NoError(t, err)
+		_, err = signer.Sign(rand.Reader, digest[:], crypto.SHA1)
+		assert.Error(t, err)
+		_, err = signer.Sign(rand.Reader, digest[:16], crypto.SHA256)
+		assert.Error(t, err)
+	})
+}
+
+func TestKMS_tokens(t *testing.T) {
+	k, s := newTestKMS(t)
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	s.addKey(t, "kid-1", "my-key", key)
+
+	_, err = k.GetPublicKey(&apiv1.GetPublicKeyRequest{Name: "my-key"})
+	require.NoError(t, err)
+	_, err = k.GetPublicKey(&apiv1.GetPublicKeyRequest{Name: "my-key"})
+	require.NoError(t, err)
+	assert.Equal(t, 1, s.auths)
+
+	// A rejected token is renewed.
+	s.expireTokens()
+	_, err = k.GetPublicKey(&apiv1.GetPublicKeyRequest{Name: "my-key"})
+	require.NoError(t, err)
+	assert.Equal(t, 2, s.auths)
+
+	// Invalid api key.
+	k.client.apiKey = "invalid"
+	k.client.token = ""
+	_, err = k.GetPublicKey(&apiv1.GetPublicKeyRequest{Name: "my-key"})
+	var e *apiError
+	require.ErrorAs(t, err, &e)
+	assert.Equal(t, http.StatusUnauthorized, e.StatusCode)
+	assert.Contains(t, err.Error(), "fortanix authentication failed")
+}
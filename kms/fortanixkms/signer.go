@@ -0,0 +1,96 @@
+package fortanixkms
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"fmt"
+	"io"
+
+	"go.step.sm/crypto/pemutil"
+)
+
+// hashAlgorithms maps the supported hash functions to Fortanix names.
+var hashAlgorithms = map[crypto.Hash]string{
+	crypto.SHA256: "SHA256",
+	crypto.SHA384: "SHA384",
+	crypto.SHA512: "SHA512",
+}
+
+// signer implements a crypto.Signer using a key in Fortanix DSM.
+type signer struct {
+	client    *client
+	key       sobjectDescriptor
+	publicKey crypto.PublicKey
+}
+
+// newSigner creates a new signer, the key is loaded to make sure it exists and
+// to get its public key.
+func newSigner(c *client, key sobjectDescriptor) (*signer, error) {
+	ctx, cancel := defaultContext()
+	defer cancel()
+
+	obj, err := c.GetKey(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("fortanixkms GetKey failed: %w", err)
+	}
+	pub, err := pemutil.ParseDER(obj.PubKey)
+	if err != nil {
+		return nil, err
+	}
+	switch pub.(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey:
+	default:
+		return nil, fmt.Errorf("fortanixkms does not support keys of type %T", pub)
+	}
+
+	// Always use the kid, names can be reassigned.
+	return &signer{
+		client:    c,
+		key:       sobjectDescriptor{Kid: obj.Kid},
+		publicKey: pub,
+	}, nil
+}
+
+// Public returns the public key of this signer.
+func (s *signer) Public() crypto.PublicKey {
+	return s.publicKey
+}
+
+// Sign signs the digest with the key in Fortanix DSM.
+func (s *signer) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	h := opts.HashFunc()
+	hashAlg, ok := hashAlgorithms[h]
+	if !ok {
+		return nil, fmt.Errorf("fortanixkms does not support hash function %s", h)
+	}
+	if len(digest) != h.Size() {
+		return nil, fmt.Errorf("fortanixkms digest size does not match the hash function %s", h)
+	}
+
+	req := &signRequest{
+		Key:     s.key,
+		HashAlg: hashAlg,
+		Hash:    digest,
+	}
+	if _, ok := s.publicKey.(*rsa.PublicKey); ok {
+		if pss, ok := opts.(*rsa.PSSOptions); ok {
+			// Fortanix DSM uses a salt of the size of the hash.
+			if pss.SaltLength != rsa.PSSSaltLengthEqualsHash && pss.SaltLength != h.Size() {
+				return nil, fmt.Errorf("fortanixkms does not support RSA-PSS salt length %d", pss.SaltLength)
+			}
+			req.Mode = &signatureMode{PSS: &pssParams{MGF: mgf{MGF1: mgf1{Hash: hashAlg}}}}
+		} else {
+			req.Mode = &signatureMode{PKCS1v15: &struct{}{}}
+		}
+	}
+
+	ctx, cancel := defaultContext()
+	defer cancel()
+
+	resp, err := s.client.Sign(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("fortanixkms Sign failed: %w", err)
+	}
+	return resp.Signature, nil
+}
@@ -0,0 +1,161 @@
+// Package kms contains extensions to the key managers implemented in
+// go.step.sm/crypto/kms.
+package kms
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"go.step.sm/crypto/kms/apiv1"
+	"go.step.sm/crypto/kms/uri"
+	"go.step.sm/crypto/randutil"
+)
+
+// KeyRotator is an optional interface implemented by the key managers that can
+// rotate keys natively. It complements the interfaces defined in
+// go.step.sm/crypto/kms/apiv1.
+type KeyRotator interface {
+	RotateKey(req *RotateKeyRequest) (*apiv1.CreateKeyResponse, error)
+}
+
+// RotateKeyRequest is the parameter used in RotateKey.
+type RotateKeyRequest struct {
+	// Name is the name of the key to rotate, e.g., the KMS URI used to
+	// configure the current key.
+	Name string
+	// Password is used by the key managers that store keys in files to
+	// decrypt the current key and to encrypt the new one.
+	Password []byte
+}
+
+// cloudKMSVersion matches the version in a Google Cloud KMS key resource.
+var cloudKMSVersion = regexp.MustCompile(`/cryptoKeyVersions/[^/]+$`)
+
+// pkcs11IDSize is the size in bytes of the id of rotated PKCS #11 keys.
+const pkcs11IDSize = 16
+
+// RotateKey creates a new key that replaces the given one, using the same
+// algorithm and size. If the key manager implements KeyRotator, its
+// implementation is used, otherwise, the new key is created with CreateKey
+// using a name based on the current one:
+//
+//   - cloudkms: the version is removed from the name, and CloudKMS creates a
+//     new version of the same crypto key.
+//   - awskms: a new key with the name in the URI is created, and a new alias
+//     points to it. If the URI does not contain a name, the id of the current
+//     key is used, so the alias of the new key references the key it
+//     replaces.
+//   - pkcs11: a new key pair with a new random id and the same object label
+//     is created in the same token.
+//
+// The current key is not modified nor deleted, it can still be used to sign
+// until the new one is configured.
+func RotateKey(km apiv1.KeyManager, req *RotateKeyRequest) (*apiv1.CreateKeyResponse, error) {
+	if req.Name == "" {
+		return nil, errors.New("rotateKeyRequest 'name' cannot be empty")
+	}
+	if r, ok := km.(KeyRotator); ok {
+		return r.RotateKey(req)
+	}
+
+	name, err := rotatedKeyName(req.Name)
+	if err != nil {
+		return nil, err
+	}
+	pub, err := km.GetPublicKey(&apiv1.GetPublicKeyRequest{
+		Name: req.Name,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error getting public key of %s: %w", req.Name, err)
+	}
+	alg, bits, err := signatureAlgorithm(pub)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := km.CreateKey(&apiv1.CreateKeyRequest{
+		Name:               name,
+		SignatureAlgorithm: alg,
+		Bits:               bits,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error rotating key %s: %w", req.Name, err)
+	}
+	return resp, nil
+}
+
+// rotatedKeyName returns the name used to create the key that replaces the
+// given one.
+func rotatedKeyName(name string) (string, error) {
+	scheme, _, _ := strings.Cut(name, ":")
+	switch strings.ToLower(scheme) {
+	case "cloudkms":
+		return cloudKMSVersion.ReplaceAllString(name, ""), nil
+	case "awskms", "aws":
+		u, err := uri.Parse(name)
+		if err != nil {
+			return "", err
+		}
+		keyName := u.Get("name")
+		if keyName == "" {
+			keyName = u.Get("key-id")
+		}
+		if keyName == "" {
+			return "", fmt.Errorf("key %s cannot be rotated: name or key-id are required", name)
+		}
+		return uri.New("awskms", map[string][]string{"name": {keyName}}).String(), nil
+	case "pkcs11":
+		u, err := uri.Parse(name)
+		if err != nil {
+			return "", err
+		}
+		if u.Get("object") == "" {
+			return "", fmt.Errorf("key %s cannot be rotated: object is required", name)
+		}
+		id, err := randutil.Salt(pkcs11IDSize)
+		if err != nil {
+			return "", fmt.Errorf("error generating key id: %w", err)
+		}
+		u.Values.Set("id", hex.EncodeToString(id))
+		return u.String(), nil
+	default:
+		// Raw Google Cloud KMS resource names do not have a scheme.
+		if strings.HasPrefix(name, "projects/") && strings.Contains(name, "/cryptoKeys/") {
+			return cloudKMSVersion.ReplaceAllString(name, ""), nil
+		}
+		return "", apiv1.NotImplementedError{
+			Message: fmt.Sprintf("key %s cannot be rotated: rotation is not supported by the kms", name),
+		}
+	}
+}
+
+// signatureAlgorithm returns the KMS signature algorithm and size of the given
+// public key.
+func signatureAlgorithm(pub crypto.PublicKey) (apiv1.SignatureAlgorithm, int, error) {
+	switch k := pub.(type) {
+	case *ecdsa.PublicKey:
+		switch k.Curve {
+		case elliptic.P256():
+			return apiv1.ECDSAWithSHA256, 0, nil
+		case elliptic.P384():
+			return apiv1.ECDSAWithSHA384, 0, nil
+		case elliptic.P521():
+			return apiv1.ECDSAWithSHA512, 0, nil
+		default:
+			return 0, 0, fmt.Errorf("unsupported elliptic curve %s", k.Curve.Params().Name)
+		}
+	case *rsa.PublicKey:
+		return apiv1.SHA256WithRSA, k.N.BitLen(), nil
+	case ed25519.PublicKey:
+		return apiv1.PureEd25519, 0, nil
+	default:
+		return 0, 0, fmt.Errorf("unsupported public key type %T", pub)
+	}
+}
@@ -0,0 +1,155 @@
+package kms
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.step.sm/crypto/kms/apiv1"
+)
+
+type mockKeyManager struct {
+	publicKey crypto.PublicKey
+	createKey func(req *apiv1.CreateKeyRequest) (*apiv1.CreateKeyResponse, error)
+}
+
+func (m *mockKeyManager) GetPublicKey(req *apiv1.GetPublicKeyRequest) (crypto.PublicKey, error) {
+	if m.publicKey == nil {
+		return nil, errors.New("not found")
+	}
+	return m.publicKey, nil
+}
+
+func (m *mockKeyManager) CreateKey(req *apiv1.CreateKeyRequest) (*apiv1.CreateKeyResponse, error) {
+	return m.createKey(req)
+}
+
+func (m *mockKeyManager) CreateSigner(req *apiv1.CreateSignerRequest) (crypto.Signer, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (m *mockKeyManager) Close() error {
+	return nil
+}
+
+type mockKeyRotator struct {
+	mockKeyManager
+}
+
+func (m *mockKeyRotator) RotateKey(req *RotateKeyRequest) (*apiv1.CreateKeyResponse, error) {
+	return &apiv1.CreateKeyResponse{Name: req.Name + "-rotated"}, nil
+}
+
+func TestRotateKey(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	require.NoError(t, err)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	edPub, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	expectCreateKey := func(t *testing.T, want *apiv1.CreateKeyRequest) func(req *apiv1.CreateKeyRequest) (*apiv1.CreateKeyResponse, error) {
+		return func(req *apiv1.CreateKeyRequest) (*apiv1.CreateKeyResponse, error) {
+			assert.Equal(t, want, req)
+			return &apiv1.CreateKeyResponse{Name: req.Name}, nil
+		}
+	}
+
+	tests := []struct {
+		name     string
+		km       func(t *testing.T) apiv1.KeyManager
+		keyName  string
+		wantName string
+		wantErr  bool
+	}{
+		{"ok/cloudkms", func(t *testing.T) apiv1.KeyManager {
+			return &mockKeyManager{publicKey: ecKey.Public(), createKey: expectCreateKey(t, &apiv1.CreateKeyRequest{
+				Name:               "cloudkms:projects/p/locations/global/keyRings/r/cryptoKeys/intermediate",
+				SignatureAlgorithm: apiv1.ECDSAWithSHA384,
+			})}
+		}, "cloudkms:projects/p/locations/global/keyRings/r/cryptoKeys/intermediate/cryptoKeyVersions/1", "cloudkms:projects/p/locations/global/keyRings/r/cryptoKeys/intermediate", false},
+		{"ok/cloudkms-resource", func(t *testing.T) apiv1.KeyManager {
+			return &mockKeyManager{publicKey: rsaKey.Public(), createKey: expectCreateKey(t, &apiv1.CreateKeyRequest{
+				Name:               "projects/p/locations/global/keyRings/r/cryptoKeys/intermediate",
+				SignatureAlgorithm: apiv1.SHA256WithRSA,
+				Bits:               2048,
+			})}
+		}, "projects/p/locations/global/keyRings/r/cryptoKeys/intermediate/cryptoKeyVersions/3", "projects/p/locations/global/keyRings/r/cryptoKeys/intermediate", false},
+		{"ok/awskms-name", func(t *testing.T) apiv1.KeyManager {
+			return &mockKeyManager{publicKey: ecKey.Public(), createKey: expectCreateKey(t, &apiv1.CreateKeyRequest{
+				Name:               "awskms:name=intermediate",
+				SignatureAlgorithm: apiv1.ECDSAWithSHA384,
+			})}
+		}, "awskms:key-id=be468355-ca7a-40d9-a28b-8ae1c4c7f936;name=intermediate", "awskms:name=intermediate", false},
+		{"ok/awskms-key-id", func(t *testing.T) apiv1.KeyManager {
+			return &mockKeyManager{publicKey: edPub, createKey: expectCreateKey(t, &apiv1.CreateKeyRequest{
+				Name:               "awskms:name=be468355-ca7a-40d9-a28b-8ae1c4c7f936",
+				SignatureAlgorithm: apiv1.PureEd25519,
+			})}
+		}, "awskms:key-id=be468355-ca7a-40d9-a28b-8ae1c4c7f936", "awskms:name=be468355-ca7a-40d9-a28b-8ae1c4c7f936", false},
+		{"ok/key-rotator", func(t *testing.T) apiv1.KeyManager {
+			return &mockKeyRotator{}
+		}, "fortanixkms:name=intermediate", "fortanixkms:name=intermediate-rotated", false},
+		{"fail/empty", func(t *testing.T) apiv1.KeyManager {
+			return &mockKeyManager{}
+		}, "", "", true},
+		{"fail/pkcs11-no-object", func(t *testing.T) apiv1.KeyManager {
+			return &mockKeyManager{publicKey: ecKey.Public()}
+		}, "pkcs11:id=7331", "", true},
+		{"fail/softkms", func(t *testing.T) apiv1.KeyManager {
+			return &mockKeyManager{publicKey: ecKey.Public()}
+		}, "intermediate_ca_key", "", true},
+		{"fail/public-key", func(t *testing.T) apiv1.KeyManager {
+			return &mockKeyManager{}
+		}, "cloudkms:projects/p/locations/global/keyRings/r/cryptoKeys/intermediate/cryptoKeyVersions/1", "", true},
+		{"fail/create-key", func(t *testing.T) apiv1.KeyManager {
+			return &mockKeyManager{publicKey: ecKey.Public(), createKey: func(req *apiv1.CreateKeyRequest) (*apiv1.CreateKeyResponse, error) {
+				return nil, errors.New("force")
+			}}
+		}, "cloudkms:projects/p/locations/global/keyRings/r/cryptoKeys/intermediate/cryptoKeyVersions/1", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := RotateKey(tt.km(t), &RotateKeyRequest{Name: tt.keyName})
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantName, got.Name)
+		})
+	}
+}
+
+func TestRotateKey_pkcs11(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	var names []string
+	km := &mockKeyManager{publicKey: key.Public(), createKey: func(req *apiv1.CreateKeyRequest) (*apiv1.CreateKeyResponse, error) {
+		assert.Equal(t, apiv1.ECDSAWithSHA256, req.SignatureAlgorithm)
+		names = append(names, req.Name)
+		return &apiv1.CreateKeyResponse{Name: req.Name}, nil
+	}}
+
+	for i := 0; i < 2; i++ {
+		_, err := RotateKey(km, &RotateKeyRequest{
+			Name: "pkcs11:module-path=/usr/lib/softhsm/libsofthsm2.so;token=smallstep;id=7331;object=intermediate-key?pin-value=password",
+		})
+		require.NoError(t, err)
+	}
+
+	re := regexp.MustCompile(`^pkcs11:id=[0-9a-f]{32};module-path=%2Fusr%2Flib%2Fsofthsm%2Flibsofthsm2.so;object=intermediate-key;token=smallstep\?pin-value=password$`)
+	require.Len(t, names, 2)
+	assert.Regexp(t, re, names[0])
+	assert.Regexp(t, re, names[1])
+	assert.NotEqual(t, names[0], names[1])
+}
@@ -131,10 +131,15 @@ func Post(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	ctx := r.Context()
 	var res Response
 	switch req.Operation {
 	case opnPKIOperation:
-		res, err = PKIOperation(r.Context(), req)
+		if !scep.MustFromContext(ctx).HasCapability(ctx, scep.CapabilityPOSTPKIOperation) {
+			err = errors.New("POSTPKIOperation is not supported")
+			break
+		}
+		res, err = PKIOperation(ctx, req)
 	default:
 		err = fmt.Errorf("unknown operation: %s", req.Operation)
 	}
@@ -379,12 +384,32 @@ func PKIOperation(ctx context.Context, req request) (Response, error) {
 	transactionID := string(msg.TransactionID)
 	challengePassword := msg.CSRReqMessage.ChallengePassword
 
+	// Requests using algorithms or message types not advertised in the
+	// capabilities are rejected. Legacy clients that do not support the
+	// capabilities negotiated by GetCACaps must be configured accordingly.
+	if err := auth.ValidateAlgorithms(ctx, msg); err != nil {
+		return createFailureResponse(ctx, csr, msg, smallscep.BadAlg, err.Error(), err)
+	}
+	if msg.MessageType == smallscep.RenewalReq && !auth.HasCapability(ctx, scep.CapabilityRenewal) {
+		scepErr := errors.New("RenewalReq is not supported")
+		return createFailureResponse(ctx, csr, msg, smallscep.BadRequest, scepErr.Error(), scepErr)
+	}
+
 	// NOTE: we're blocking the RenewalReq if the challenge does not match, because otherwise we don't have any authentication.
 	// The macOS SCEP client performs renewals using PKCSreq. The CertNanny SCEP client will use PKCSreq with challenge too, it seems,
 	// even if using the renewal flow as described in the README.md. MicroMDM SCEP client also only does PKCSreq by default, unless
 	// a certificate exists; then it will use RenewalReq. Adding the challenge check here may be a small breaking change for clients.
 	// We'll have to see how it works out.
-	if msg.MessageType == smallscep.PKCSReq || msg.MessageType == smallscep.RenewalReq {
+	//
+	// If the provisioner allows renewals, a RenewalReq without a challenge password is authenticated
+	// with the certificate used to sign the message, which must have been issued by the CA.
+	switch {
+	case msg.MessageType == smallscep.RenewalReq && challengePassword == "" && auth.IsRenewalEnabled(ctx):
+		if err := auth.AuthorizeRenewal(ctx, msg); err != nil {
+			scepErr := fmt.Errorf("failed authorizing renewal: %w", err)
+			return createFailureResponse(ctx, csr, msg, smallscep.BadRequest, scepErr.Error(), scepErr)
+		}
+	case msg.MessageType == smallscep.PKCSReq || msg.MessageType == smallscep.RenewalReq:
 		if err := auth.ValidateChallenge(ctx, csr, challengePassword, transactionID); err != nil {
 			if errors.Is(err, provisioner.ErrSCEPChallengeInvalid) {
 				return createFailureResponse(ctx, csr, msg, smallscep.BadRequest, err.Error(), err)
@@ -394,14 +419,6 @@ func PKIOperation(ctx context.Context, req request) (Response, error) {
 		}
 	}
 
-	// TODO: authorize renewal: we can authorize renewals with the challenge password (if reusable secrets are used).
-	// Renewals OPTIONALLY include the challenge if the existing cert is used as authentication, but client SHOULD omit the challenge.
-	// This means that for renewal requests we should check the certificate provided to be signed before by the CA. We could
-	// enforce use of the challenge if we want too. That way we could be more flexible in terms of authentication scheme (i.e. reusing
-	// tokens from other provisioners, calling a webhook, storing multiple secrets, allowing them to be multi-use, etc).
-	// Authentication by the (self-signed) certificate with an optional challenge is required; supporting renewals incl. verification
-	// of the client cert is not.
-
 	certRep, err := auth.SignCSR(ctx, csr, msg)
 	if err != nil {
 		if notifyErr := auth.NotifyFailure(ctx, csr, transactionID, 0, err.Error()); notifyErr != nil {
@@ -3,6 +3,7 @@ package api
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
 	"errors"
 	"fmt"
@@ -15,6 +16,9 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/scep"
 )
 
 func Test_decodeRequest(t *testing.T) {
@@ -181,3 +185,13 @@ func Test_decodeRequest(t *testing.T) {
 		})
 	}
 }
+
+func TestPost_POSTPKIOperation(t *testing.T) {
+	ctx := scep.NewContext(context.Background(), &scep.Authority{})
+	ctx = scep.NewProvisionerContext(ctx, &provisioner.SCEP{Capabilities: []string{"SHA-256", "AES"}})
+	req := httptest.NewRequest(http.MethodPost, "/scep?operation=PKIOperation", bytes.NewBufferString("message")).WithContext(ctx)
+	w := httptest.NewRecorder()
+	Post(w, req)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Contains(t, w.Body.String(), "POSTPKIOperation is not supported")
+}
@@ -30,6 +30,9 @@ type Authority struct {
 
 	provisionersMutex        sync.RWMutex
 	encryptionAlgorithmMutex sync.Mutex
+
+	raMutex  sync.Mutex
+	raStates map[string]*raState
 }
 
 type authorityKey struct{}
@@ -100,6 +103,12 @@ func (a *Authority) Validate() error {
 			return fmt.Errorf("failed loading provisioner %q: %w", name, err)
 		}
 		if scepProv, ok := p.(*provisioner.SCEP); ok {
+			if scepProv.GetRAOptions() != nil {
+				if a.defaultSigner == nil {
+					return fmt.Errorf("SCEP provisioner %q requires the CA intermediate key to generate RA certificates", name)
+				}
+				continue
+			}
 			cert, decrypter := scepProv.GetDecrypter()
 			// TODO(hs): return sentinel/typed error, to be able to ignore/log these cases during init?
 			if cert == nil && noDefaultDecrypterAvailable {
@@ -128,19 +137,6 @@ func (a *Authority) UpdateProvisioners(scepProvisionerNames []string) {
 	a.scepProvisionerNames = scepProvisionerNames
 }
 
-var (
-	// TODO: check the default capabilities; https://tools.ietf.org/html/rfc8894#section-3.5.2
-	defaultCapabilities = []string{
-		"Renewal", // NOTE: removing this will result in macOS SCEP client stating the server doesn't support renewal, but it uses PKCSreq to do so.
-		"SHA-1",
-		"SHA-256",
-		"AES",
-		"DES3",
-		"SCEPStandard",
-		"POSTPKIOperation",
-	}
-)
-
 // LoadProvisionerByName calls out to the SignAuthority interface to load a
 // provisioner by name.
 func (a *Authority) LoadProvisionerByName(name string) (provisioner.Interface, error) {
@@ -161,6 +157,24 @@ func (a *Authority) LoadProvisionerByName(name string) (provisioner.Interface, e
 func (a *Authority) GetCACertificates(ctx context.Context) (certs []*x509.Certificate, err error) {
 	p := provisionerFromContext(ctx)
 
+	// if the provisioner uses RA certificates generated by the CA, the current
+	// and, during a rotation, the previous RA certificates are returned first.
+	// The intermediate is always included, it's required to verify them.
+	ras, err := a.getRACertificates(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(ras) > 0 {
+		for _, ra := range ras {
+			certs = append(certs, ra.cert)
+		}
+		certs = append(certs, a.intermediates...)
+		if p.ShouldIncludeRootInChain() {
+			certs = append(certs, a.roots...)
+		}
+		return certs, nil
+	}
+
 	// if a provisioner specific RSA decrypter is available, it is returned as
 	// the first certificate.
 	if decrypterCertificate, _ := p.GetDecrypter(); decrypterCertificate != nil {
@@ -193,17 +207,15 @@ func (a *Authority) DecryptPKIEnvelope(ctx context.Context, msg *PKIMessage) err
 		return fmt.Errorf("error parsing pkcs7 content: %w", err)
 	}
 
-	cert, decrypter, err := a.selectDecrypter(ctx)
-	if err != nil {
-		return fmt.Errorf("failed selecting decrypter: %w", err)
-	}
-
-	envelope, err := p7c.Decrypt(cert, decrypter)
+	envelope, err := a.decrypt(ctx, p7c)
 	if err != nil {
-		return fmt.Errorf("error decrypting encrypted pkcs7 content: %w", err)
+		return err
 	}
 
 	msg.pkiEnvelope = envelope
+	if msg.contentEncryptionAlgorithm, err = parseContentEncryptionAlgorithm(msg.P7.Content); err != nil {
+		return err
+	}
 
 	switch msg.MessageType {
 	case smallscep.CertRep:
@@ -320,7 +332,7 @@ func (a *Authority) SignCSR(ctx context.Context, csr *x509.CertificateRequest, m
 		return nil, fmt.Errorf("failed generating degenerate certificate: %w", err)
 	}
 
-	e7, err := a.encrypt(deg, msg.P7.Certificates, p.GetContentEncryptionAlgorithm())
+	e7, err := a.encrypt(deg, msg.P7.Certificates, a.responseEncryptionAlgorithm(ctx, msg))
 	if err != nil {
 		return nil, fmt.Errorf("failed encrypting degenerate certificate: %w", err)
 	}
@@ -355,6 +367,7 @@ func (a *Authority) SignCSR(ctx context.Context, csr *x509.CertificateRequest, m
 	if err != nil {
 		return nil, err
 	}
+	signedData.SetDigestAlgorithm(a.responseDigestAlgorithm(ctx, msg))
 
 	// add the certificate into the signed data type
 	// this cert must be added before the signedData because the recipient will expect it
@@ -455,6 +468,7 @@ func (a *Authority) CreateFailureResponse(ctx context.Context, _ *x509.Certifica
 	if err != nil {
 		return nil, err
 	}
+	signedData.SetDigestAlgorithm(a.responseDigestAlgorithm(ctx, msg))
 
 	signerCert, signer, err := a.selectSigner(ctx)
 	if err != nil {
@@ -488,22 +502,57 @@ func (a *Authority) CreateFailureResponse(ctx context.Context, _ *x509.Certifica
 	return crepMsg, nil
 }
 
-// GetCACaps returns the CA capabilities
-func (a *Authority) GetCACaps(ctx context.Context) []string {
+// IsRenewalEnabled returns true if the provisioner in the context allows
+// renewals authenticated with the certificate to renew.
+func (a *Authority) IsRenewalEnabled(ctx context.Context) bool {
+	return provisionerFromContext(ctx).IsRenewalEnabled()
+}
+
+// AuthorizeRenewal authorizes a RenewalReq message authenticated with the
+// certificate used to sign it. The certificate must have been issued by the
+// CA, must not be revoked, and must be accepted by the renewal options of
+// the provisioner.
+func (a *Authority) AuthorizeRenewal(ctx context.Context, msg *PKIMessage) error {
 	p := provisionerFromContext(ctx)
+	if !p.IsRenewalEnabled() {
+		return fmt.Errorf("provisioner %q does not allow renewals", p.GetName())
+	}
+	if msg.MessageType != smallscep.RenewalReq {
+		return fmt.Errorf("message type %s is not a renewal request", msg.MessageType)
+	}
 
-	caps := p.GetCapabilities()
-	if len(caps) == 0 {
-		return defaultCapabilities
+	signer := msg.P7.GetOnlySigner()
+	if signer == nil {
+		return errors.New("renewal request must be signed by a single certificate")
 	}
 
-	// TODO: validate the caps? Ensure they are the right format according to RFC?
-	// TODO: ensure that the capabilities are actually "enforced"/"verified" in code too:
-	// check that only parts of the spec are used in the implementation belonging to the capabilities.
-	// For example for renewals, which we could disable in the provisioner, should then also
-	// not be reported in cacaps operation.
+	roots := x509.NewCertPool()
+	for _, crt := range a.roots {
+		roots.AddCert(crt)
+	}
+	intermediates := x509.NewCertPool()
+	for _, crt := range a.intermediates {
+		intermediates.AddCert(crt)
+	}
+	if _, err := signer.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}); err != nil {
+		return fmt.Errorf("failed verifying renewal certificate: %w", err)
+	}
+
+	if ra, ok := a.signAuth.(interface{ IsRevoked(string) (bool, error) }); ok {
+		revoked, err := ra.IsRevoked(signer.SerialNumber.String())
+		if err != nil {
+			return fmt.Errorf("failed checking renewal certificate revocation: %w", err)
+		}
+		if revoked {
+			return errors.New("renewal certificate has been revoked")
+		}
+	}
 
-	return caps
+	return p.AuthorizeRenewal(ctx, msg.CSRReqMessage.CSR, signer)
 }
 
 func (a *Authority) ValidateChallenge(ctx context.Context, csr *x509.CertificateRequest, challenge, transactionID string) error {
@@ -521,6 +570,35 @@ func (a *Authority) NotifyFailure(ctx context.Context, csr *x509.CertificateRequ
 	return p.NotifyFailure(ctx, csr, transactionID, errorCode, errorDescription)
 }
 
+// decrypt decrypts the enveloped content. If the provisioner uses RA
+// certificates generated by the CA, the content can be encrypted to the
+// current or to the previous RA certificate.
+func (a *Authority) decrypt(ctx context.Context, p7c *pkcs7.PKCS7) ([]byte, error) {
+	ras, err := a.getRACertificates(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed selecting decrypter: %w", err)
+	}
+	if len(ras) > 0 {
+		for _, ra := range ras {
+			var envelope []byte
+			if envelope, err = p7c.Decrypt(ra.cert, ra.key); err == nil {
+				return envelope, nil
+			}
+		}
+		return nil, fmt.Errorf("error decrypting encrypted pkcs7 content: %w", err)
+	}
+
+	cert, decrypter, err := a.selectDecrypter(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed selecting decrypter: %w", err)
+	}
+	envelope, err := p7c.Decrypt(cert, decrypter)
+	if err != nil {
+		return nil, fmt.Errorf("error decrypting encrypted pkcs7 content: %w", err)
+	}
+	return envelope, nil
+}
+
 func (a *Authority) selectDecrypter(ctx context.Context) (cert *x509.Certificate, decrypter crypto.Decrypter, err error) {
 	p := provisionerFromContext(ctx)
 	cert, decrypter = p.GetDecrypter()
@@ -546,6 +624,14 @@ func (a *Authority) selectDecrypter(ctx context.Context) (cert *x509.Certificate
 
 func (a *Authority) selectSigner(ctx context.Context) (cert *x509.Certificate, signer crypto.Signer, err error) {
 	p := provisionerFromContext(ctx)
+	ras, err := a.getRACertificates(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(ras) > 0 {
+		return ras[0].cert, ras[0].key, nil
+	}
+
 	cert, signer = p.GetSigner()
 	switch {
 	case cert != nil && signer != nil:
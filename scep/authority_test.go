@@ -1,16 +1,20 @@
 package scep
 
 import (
+	"context"
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"testing"
 
 	"github.com/smallstep/pkcs7"
+	smallscep "github.com/smallstep/scep"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"go.step.sm/crypto/keyutil"
 	"go.step.sm/crypto/minica"
 	"go.step.sm/crypto/randutil"
+
+	"github.com/smallstep/certificates/authority/provisioner"
 )
 
 func generateContent(t *testing.T, size int) []byte {
@@ -71,3 +75,85 @@ func TestAuthority_encrypt(t *testing.T) {
 		})
 	}
 }
+
+type mockRevocationSignAuthority struct {
+	SignAuthority
+	revoked bool
+}
+
+func (m *mockRevocationSignAuthority) IsRevoked(string) (bool, error) {
+	return m.revoked, nil
+}
+
+func TestAuthority_AuthorizeRenewal(t *testing.T) {
+	ca, err := minica.New()
+	require.NoError(t, err)
+	otherCA, err := minica.New()
+	require.NoError(t, err)
+
+	signer, err := keyutil.GenerateSigner("EC", "P-256", 0)
+	require.NoError(t, err)
+	ext, err := (&provisioner.Extension{Type: provisioner.TypeSCEP, Name: "scep"}).ToExtension()
+	require.NoError(t, err)
+	newCert := func(ca *minica.CA) *x509.Certificate {
+		cert, err := ca.Sign(&x509.Certificate{
+			PublicKey:       signer.Public(),
+			Subject:         pkix.Name{CommonName: "device"},
+			DNSNames:        []string{"device.example.com"},
+			ExtraExtensions: []pkix.Extension{ext},
+		})
+		require.NoError(t, err)
+		return cert
+	}
+	newMessage := func(cert *x509.Certificate, typ smallscep.MessageType, cn string) *PKIMessage {
+		sd, err := pkcs7.NewSignedData([]byte("content"))
+		require.NoError(t, err)
+		require.NoError(t, sd.AddSigner(cert, signer, pkcs7.SignerInfoConfig{}))
+		b, err := sd.Finish()
+		require.NoError(t, err)
+		p7, err := pkcs7.Parse(b)
+		require.NoError(t, err)
+		return &PKIMessage{
+			MessageType: typ,
+			P7:          p7,
+			CSRReqMessage: &smallscep.CSRReqMessage{
+				CSR: &x509.CertificateRequest{
+					Subject:  pkix.Name{CommonName: cn},
+					DNSNames: []string{"device.example.com"},
+				},
+			},
+		}
+	}
+
+	renewalProv := &provisioner.SCEP{Name: "scep", Type: "SCEP", Renewal: &provisioner.SCEPRenewalOptions{}}
+	tests := []struct {
+		name    string
+		prov    *provisioner.SCEP
+		revoked bool
+		msg     *PKIMessage
+		wantErr bool
+	}{
+		{"ok", renewalProv, false, newMessage(newCert(ca), smallscep.RenewalReq, "device"), false},
+		{"fail/renewal-disabled", &provisioner.SCEP{Name: "scep", Type: "SCEP"}, false, newMessage(newCert(ca), smallscep.RenewalReq, "device"), true},
+		{"fail/not-renewal", renewalProv, false, newMessage(newCert(ca), smallscep.PKCSReq, "device"), true},
+		{"fail/untrusted", renewalProv, false, newMessage(newCert(otherCA), smallscep.RenewalReq, "device"), true},
+		{"fail/revoked", renewalProv, true, newMessage(newCert(ca), smallscep.RenewalReq, "device"), true},
+		{"fail/subject", renewalProv, false, newMessage(newCert(ca), smallscep.RenewalReq, "other"), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &Authority{
+				signAuth:      &mockRevocationSignAuthority{revoked: tt.revoked},
+				roots:         []*x509.Certificate{ca.Root},
+				intermediates: []*x509.Certificate{ca.Intermediate},
+			}
+			ctx := NewProvisionerContext(context.Background(), tt.prov)
+			err := a.AuthorizeRenewal(ctx, tt.msg)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
@@ -0,0 +1,188 @@
+package scep
+
+import (
+	"context"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/smallstep/pkcs7"
+)
+
+// Capabilities returned in the GetCACaps response, as defined in RFC 8894,
+// section 3.5.2.
+const (
+	CapabilityAES              = "AES"
+	CapabilityDES3             = "DES3"
+	CapabilityPOSTPKIOperation = "POSTPKIOperation"
+	CapabilityRenewal          = "Renewal"
+	CapabilitySHA1             = "SHA-1"
+	CapabilitySHA256           = "SHA-256"
+	CapabilitySHA512           = "SHA-512"
+	CapabilitySCEPStandard     = "SCEPStandard"
+)
+
+// defaultCapabilities are the capabilities of the provisioners that do not
+// configure them.
+var defaultCapabilities = []string{
+	CapabilityRenewal, // NOTE: removing this will result in macOS SCEP client stating the server doesn't support renewal, but it uses PKCSreq to do so.
+	CapabilitySHA1,
+	CapabilitySHA256,
+	CapabilitySHA512,
+	CapabilityAES,
+	CapabilityDES3,
+	CapabilitySCEPStandard,
+	CapabilityPOSTPKIOperation,
+}
+
+// digestCapabilities are the digest algorithms of the messages and the
+// capability required to use them.
+var digestCapabilities = []struct {
+	oid        asn1.ObjectIdentifier
+	capability string
+}{
+	{pkcs7.OIDDigestAlgorithmSHA1, CapabilitySHA1},
+	{pkcs7.OIDDigestAlgorithmSHA256, CapabilitySHA256},
+	{pkcs7.OIDDigestAlgorithmSHA512, CapabilitySHA512},
+}
+
+// encryptionCapabilities are the content encryption algorithms of the
+// messages, the capability required to use them, and the identifier used by
+// the pkcs7 package to encrypt the responses. DES-CBC is always supported;
+// responses to requests encrypted with DES-EDE3-CBC use DES-CBC.
+var encryptionCapabilities = []struct {
+	oid        asn1.ObjectIdentifier
+	capability string
+	algorithm  int
+}{
+	{pkcs7.OIDEncryptionAlgorithmDESCBC, "", pkcs7.EncryptionAlgorithmDESCBC},
+	{pkcs7.OIDEncryptionAlgorithmDESEDE3CBC, CapabilityDES3, pkcs7.EncryptionAlgorithmDESCBC},
+	{pkcs7.OIDEncryptionAlgorithmAES128CBC, CapabilityAES, pkcs7.EncryptionAlgorithmAES128CBC},
+	{pkcs7.OIDEncryptionAlgorithmAES256CBC, CapabilityAES, pkcs7.EncryptionAlgorithmAES256CBC},
+	{pkcs7.OIDEncryptionAlgorithmAES128GCM, CapabilityAES, pkcs7.EncryptionAlgorithmAES128GCM},
+	{pkcs7.OIDEncryptionAlgorithmAES256GCM, CapabilityAES, pkcs7.EncryptionAlgorithmAES256GCM},
+}
+
+// GetCACaps returns the CA capabilities of the provisioner in the context.
+// The capabilities configured in the provisioner replace the default ones.
+func (a *Authority) GetCACaps(ctx context.Context) []string {
+	p := provisionerFromContext(ctx)
+	if caps := p.GetCapabilities(); len(caps) > 0 {
+		return caps
+	}
+	return defaultCapabilities
+}
+
+// HasCapability returns true if the provisioner in the context advertises
+// the given capability.
+func (a *Authority) HasCapability(ctx context.Context, capability string) bool {
+	return slices.ContainsFunc(a.GetCACaps(ctx), func(c string) bool {
+		return strings.EqualFold(c, capability)
+	})
+}
+
+// ValidateAlgorithms validates that the digest and content encryption
+// algorithms of a decrypted message are advertised by the provisioner in the
+// context. Unknown digest algorithms are not checked, they are validated when
+// the message is parsed.
+func (a *Authority) ValidateAlgorithms(ctx context.Context, msg *PKIMessage) error {
+	if oid := messageDigestAlgorithm(msg); oid != nil {
+		for _, d := range digestCapabilities {
+			if d.oid.Equal(oid) && !a.HasCapability(ctx, d.capability) {
+				return fmt.Errorf("digest algorithm %s is not supported", d.capability)
+			}
+		}
+	}
+
+	if msg.contentEncryptionAlgorithm == nil {
+		return nil
+	}
+	for _, e := range encryptionCapabilities {
+		if e.oid.Equal(msg.contentEncryptionAlgorithm) {
+			if e.capability != "" && !a.HasCapability(ctx, e.capability) {
+				return fmt.Errorf("content encryption algorithm %s is not supported", e.capability)
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("content encryption algorithm %s is not supported", msg.contentEncryptionAlgorithm)
+}
+
+// responseDigestAlgorithm returns the digest algorithm used to sign a
+// response. It's the algorithm used in the request if it's advertised,
+// otherwise the strongest advertised algorithm. Legacy clients that sign
+// with SHA-1 do not always support responses signed with other algorithms.
+func (a *Authority) responseDigestAlgorithm(ctx context.Context, msg *PKIMessage) asn1.ObjectIdentifier {
+	if oid := messageDigestAlgorithm(msg); oid != nil {
+		for _, d := range digestCapabilities {
+			if d.oid.Equal(oid) && a.HasCapability(ctx, d.capability) {
+				return d.oid
+			}
+		}
+	}
+	switch {
+	case a.HasCapability(ctx, CapabilitySHA256):
+		return pkcs7.OIDDigestAlgorithmSHA256
+	case a.HasCapability(ctx, CapabilitySHA512):
+		return pkcs7.OIDDigestAlgorithmSHA512
+	default:
+		return pkcs7.OIDDigestAlgorithmSHA1
+	}
+}
+
+// responseEncryptionAlgorithm returns the pkcs7 content encryption algorithm
+// used to encrypt a response. The algorithm configured in the provisioner is
+// always used, otherwise it's the algorithm used in the request, so clients
+// always receive responses they can decrypt. It defaults to DES-CBC.
+func (a *Authority) responseEncryptionAlgorithm(ctx context.Context, msg *PKIMessage) int {
+	if alg := provisionerFromContext(ctx).GetContentEncryptionAlgorithm(); alg != pkcs7.EncryptionAlgorithmDESCBC {
+		return alg
+	}
+	for _, e := range encryptionCapabilities {
+		if e.oid.Equal(msg.contentEncryptionAlgorithm) && (e.capability == "" || a.HasCapability(ctx, e.capability)) {
+			return e.algorithm
+		}
+	}
+	return pkcs7.EncryptionAlgorithmDESCBC
+}
+
+// messageDigestAlgorithm returns the digest algorithm of the signer of a
+// message, or nil if it's not available.
+func messageDigestAlgorithm(msg *PKIMessage) asn1.ObjectIdentifier {
+	if msg == nil || msg.P7 == nil || len(msg.P7.Signers) == 0 {
+		return nil
+	}
+	return msg.P7.Signers[0].DigestAlgorithm.Algorithm
+}
+
+// parseContentEncryptionAlgorithm returns the content encryption algorithm of
+// a PKCS #7 enveloped data.
+func parseContentEncryptionAlgorithm(der []byte) (asn1.ObjectIdentifier, error) {
+	var ci struct {
+		ContentType asn1.ObjectIdentifier
+		Content     asn1.RawValue `asn1:"explicit,tag:0"`
+	}
+	if _, err := asn1.Unmarshal(der, &ci); err != nil {
+		return nil, fmt.Errorf("error parsing pkcs7 content: %w", err)
+	}
+	if !ci.ContentType.Equal(pkcs7.OIDEnvelopedData) {
+		return nil, errors.New("pkcs7 content is not an enveloped data")
+	}
+	var ed struct {
+		Version              int
+		RecipientInfos       asn1.RawValue
+		EncryptedContentInfo struct {
+			ContentType                asn1.ObjectIdentifier
+			ContentEncryptionAlgorithm struct {
+				Algorithm  asn1.ObjectIdentifier
+				Parameters asn1.RawValue `asn1:"optional"`
+			}
+		}
+	}
+	if _, err := asn1.Unmarshal(ci.Content.Bytes, &ed); err != nil {
+		return nil, fmt.Errorf("error parsing pkcs7 enveloped data: %w", err)
+	}
+	return ed.EncryptedContentInfo.ContentEncryptionAlgorithm.Algorithm, nil
+}
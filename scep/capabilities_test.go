@@ -0,0 +1,170 @@
+package scep
+
+import (
+	"context"
+	"encoding/asn1"
+	"testing"
+
+	"github.com/smallstep/pkcs7"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.step.sm/crypto/keyutil"
+
+	"github.com/smallstep/certificates/authority/config"
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+// newTestMessage returns a message signed with the given digest algorithm and
+// encrypted with the given content encryption algorithm.
+func newTestMessage(t *testing.T, digest, encryption asn1.ObjectIdentifier) *PKIMessage {
+	t.Helper()
+	signer, err := keyutil.GenerateSigner("RSA", "", 2048)
+	require.NoError(t, err)
+	recipients := generateRecipients(t)
+	sd, err := pkcs7.NewSignedData([]byte("content"))
+	require.NoError(t, err)
+	sd.SetDigestAlgorithm(digest)
+	require.NoError(t, sd.AddSigner(recipients[0], signer, pkcs7.SignerInfoConfig{}))
+	b, err := sd.Finish()
+	require.NoError(t, err)
+	p7, err := pkcs7.Parse(b)
+	require.NoError(t, err)
+	return &PKIMessage{P7: p7, contentEncryptionAlgorithm: encryption}
+}
+
+func TestAuthority_HasCapability(t *testing.T) {
+	a := &Authority{}
+	ctx := NewProvisionerContext(context.Background(), &provisioner.SCEP{})
+	for _, c := range defaultCapabilities {
+		assert.True(t, a.HasCapability(ctx, c))
+	}
+
+	ctx = NewProvisionerContext(context.Background(), &provisioner.SCEP{
+		Capabilities: []string{"sha-256", "AES"},
+	})
+	assert.True(t, a.HasCapability(ctx, CapabilitySHA256))
+	assert.True(t, a.HasCapability(ctx, CapabilityAES))
+	assert.False(t, a.HasCapability(ctx, CapabilitySHA1))
+	assert.False(t, a.HasCapability(ctx, CapabilityRenewal))
+	assert.False(t, a.HasCapability(ctx, CapabilityPOSTPKIOperation))
+}
+
+func TestAuthority_ValidateAlgorithms(t *testing.T) {
+	legacy := &provisioner.SCEP{Capabilities: []string{"SHA-1", "DES3"}}
+	modern := &provisioner.SCEP{Capabilities: []string{"SHA-256", "AES"}}
+	tests := []struct {
+		name    string
+		prov    *provisioner.SCEP
+		msg     *PKIMessage
+		wantErr bool
+	}{
+		{"ok/default", &provisioner.SCEP{}, newTestMessage(t, pkcs7.OIDDigestAlgorithmSHA512, pkcs7.OIDEncryptionAlgorithmAES256CBC), false},
+		{"ok/legacy", legacy, newTestMessage(t, pkcs7.OIDDigestAlgorithmSHA1, pkcs7.OIDEncryptionAlgorithmDESEDE3CBC), false},
+		{"ok/legacy-des", legacy, newTestMessage(t, pkcs7.OIDDigestAlgorithmSHA1, pkcs7.OIDEncryptionAlgorithmDESCBC), false},
+		{"ok/modern", modern, newTestMessage(t, pkcs7.OIDDigestAlgorithmSHA256, pkcs7.OIDEncryptionAlgorithmAES128GCM), false},
+		{"ok/no-encryption", modern, newTestMessage(t, pkcs7.OIDDigestAlgorithmSHA256, nil), false},
+		{"fail/legacy-digest", legacy, newTestMessage(t, pkcs7.OIDDigestAlgorithmSHA256, pkcs7.OIDEncryptionAlgorithmDESEDE3CBC), true},
+		{"fail/legacy-encryption", legacy, newTestMessage(t, pkcs7.OIDDigestAlgorithmSHA1, pkcs7.OIDEncryptionAlgorithmAES128CBC), true},
+		{"fail/modern-digest", modern, newTestMessage(t, pkcs7.OIDDigestAlgorithmSHA1, pkcs7.OIDEncryptionAlgorithmAES128CBC), true},
+		{"fail/modern-encryption", modern, newTestMessage(t, pkcs7.OIDDigestAlgorithmSHA256, pkcs7.OIDEncryptionAlgorithmDESEDE3CBC), true},
+		{"fail/unknown-encryption", modern, newTestMessage(t, pkcs7.OIDDigestAlgorithmSHA256, asn1.ObjectIdentifier{1, 2, 3, 4}), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &Authority{}
+			ctx := NewProvisionerContext(context.Background(), tt.prov)
+			err := a.ValidateAlgorithms(ctx, tt.msg)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestAuthority_responseDigestAlgorithm(t *testing.T) {
+	tests := []struct {
+		name string
+		prov *provisioner.SCEP
+		msg  *PKIMessage
+		want asn1.ObjectIdentifier
+	}{
+		{"sha1", &provisioner.SCEP{}, newTestMessage(t, pkcs7.OIDDigestAlgorithmSHA1, nil), pkcs7.OIDDigestAlgorithmSHA1},
+		{"sha256", &provisioner.SCEP{}, newTestMessage(t, pkcs7.OIDDigestAlgorithmSHA256, nil), pkcs7.OIDDigestAlgorithmSHA256},
+		{"sha512", &provisioner.SCEP{}, newTestMessage(t, pkcs7.OIDDigestAlgorithmSHA512, nil), pkcs7.OIDDigestAlgorithmSHA512},
+		{"not advertised", &provisioner.SCEP{Capabilities: []string{"SHA-256"}}, newTestMessage(t, pkcs7.OIDDigestAlgorithmSHA1, nil), pkcs7.OIDDigestAlgorithmSHA256},
+		{"no message", &provisioner.SCEP{}, &PKIMessage{}, pkcs7.OIDDigestAlgorithmSHA256},
+		{"no message sha512", &provisioner.SCEP{Capabilities: []string{"SHA-512"}}, &PKIMessage{}, pkcs7.OIDDigestAlgorithmSHA512},
+		{"no message legacy", &provisioner.SCEP{Capabilities: []string{"DES3"}}, &PKIMessage{}, pkcs7.OIDDigestAlgorithmSHA1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &Authority{}
+			ctx := NewProvisionerContext(context.Background(), tt.prov)
+			assert.Equal(t, tt.want, a.responseDigestAlgorithm(ctx, tt.msg))
+		})
+	}
+}
+
+func TestAuthority_responseEncryptionAlgorithm(t *testing.T) {
+	override := &provisioner.SCEP{Type: "SCEP", Name: "scep", EncryptionAlgorithmIdentifier: pkcs7.EncryptionAlgorithmAES256GCM}
+	require.NoError(t, override.Init(provisioner.Config{Claims: config.GlobalProvisionerClaims}))
+
+	tests := []struct {
+		name       string
+		prov       *provisioner.SCEP
+		encryption asn1.ObjectIdentifier
+		want       int
+	}{
+		{"des", &provisioner.SCEP{}, pkcs7.OIDEncryptionAlgorithmDESCBC, pkcs7.EncryptionAlgorithmDESCBC},
+		{"des3", &provisioner.SCEP{}, pkcs7.OIDEncryptionAlgorithmDESEDE3CBC, pkcs7.EncryptionAlgorithmDESCBC},
+		{"aes128-cbc", &provisioner.SCEP{}, pkcs7.OIDEncryptionAlgorithmAES128CBC, pkcs7.EncryptionAlgorithmAES128CBC},
+		{"aes256-cbc", &provisioner.SCEP{}, pkcs7.OIDEncryptionAlgorithmAES256CBC, pkcs7.EncryptionAlgorithmAES256CBC},
+		{"aes128-gcm", &provisioner.SCEP{}, pkcs7.OIDEncryptionAlgorithmAES128GCM, pkcs7.EncryptionAlgorithmAES128GCM},
+		{"aes256-gcm", &provisioner.SCEP{}, pkcs7.OIDEncryptionAlgorithmAES256GCM, pkcs7.EncryptionAlgorithmAES256GCM},
+		{"aes not advertised", &provisioner.SCEP{Capabilities: []string{"DES3"}}, pkcs7.OIDEncryptionAlgorithmAES256CBC, pkcs7.EncryptionAlgorithmDESCBC},
+		{"unknown", &provisioner.SCEP{}, asn1.ObjectIdentifier{1, 2, 3, 4}, pkcs7.EncryptionAlgorithmDESCBC},
+		{"override", override, pkcs7.OIDEncryptionAlgorithmDESCBC, pkcs7.EncryptionAlgorithmAES256GCM},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &Authority{}
+			ctx := NewProvisionerContext(context.Background(), tt.prov)
+			assert.Equal(t, tt.want, a.responseEncryptionAlgorithm(ctx, &PKIMessage{contentEncryptionAlgorithm: tt.encryption}))
+		})
+	}
+}
+
+func Test_parseContentEncryptionAlgorithm(t *testing.T) {
+	a := &Authority{}
+	recipients := generateRecipients(t)
+	tests := []struct {
+		algorithm int
+		want      asn1.ObjectIdentifier
+	}{
+		{pkcs7.EncryptionAlgorithmDESCBC, pkcs7.OIDEncryptionAlgorithmDESCBC},
+		{pkcs7.EncryptionAlgorithmAES128CBC, pkcs7.OIDEncryptionAlgorithmAES128CBC},
+		{pkcs7.EncryptionAlgorithmAES256CBC, pkcs7.OIDEncryptionAlgorithmAES256CBC},
+		{pkcs7.EncryptionAlgorithmAES128GCM, pkcs7.OIDEncryptionAlgorithmAES128GCM},
+		{pkcs7.EncryptionAlgorithmAES256GCM, pkcs7.OIDEncryptionAlgorithmAES256GCM},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want.String(), func(t *testing.T) {
+			der, err := a.encrypt(generateContent(t, 32), recipients, tt.algorithm)
+			require.NoError(t, err)
+			got, err := parseContentEncryptionAlgorithm(der)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	sd, err := pkcs7.NewSignedData([]byte("content"))
+	require.NoError(t, err)
+	der, err := sd.Finish()
+	require.NoError(t, err)
+	_, err = parseContentEncryptionAlgorithm(der)
+	assert.Error(t, err)
+	_, err = parseContentEncryptionAlgorithm([]byte("foo"))
+	assert.Error(t, err)
+}
@@ -19,8 +19,11 @@ type Provisioner interface {
 	ShouldIncludeIntermediateInChain() bool
 	GetDecrypter() (*x509.Certificate, crypto.Decrypter)
 	GetSigner() (*x509.Certificate, crypto.Signer)
+	GetRAOptions() *provisioner.SCEPRAOptions
 	GetContentEncryptionAlgorithm() int
 	ValidateChallenge(ctx context.Context, csr *x509.CertificateRequest, challenge, transactionID string) error
+	IsRenewalEnabled() bool
+	AuthorizeRenewal(ctx context.Context, csr *x509.CertificateRequest, cert *x509.Certificate) error
 	NotifySuccess(ctx context.Context, csr *x509.CertificateRequest, cert *x509.Certificate, transactionID string) error
 	NotifyFailure(ctx context.Context, csr *x509.CertificateRequest, transactionID string, errorCode int, errorDescription string) error
 }
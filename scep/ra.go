@@ -0,0 +1,118 @@
+package scep
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+// raCertificate is an RA certificate generated for a SCEP provisioner and its
+// key.
+type raCertificate struct {
+	cert *x509.Certificate
+	key  *rsa.PrivateKey
+}
+
+// raState contains the RA certificates of a SCEP provisioner. The previous
+// certificate is kept until it expires, so clients that have not fetched the
+// new one yet can still use it.
+type raState struct {
+	current  *raCertificate
+	previous *raCertificate
+}
+
+// getRACertificates returns the valid RA certificates of the provisioner in
+// the context, the current one first. A new RA certificate is generated if
+// there is none or if the current one is in its renewal period. It returns
+// nil if the provisioner does not use generated RA certificates.
+func (a *Authority) getRACertificates(ctx context.Context) ([]*raCertificate, error) {
+	p := provisionerFromContext(ctx)
+	opts := p.GetRAOptions()
+	if opts == nil {
+		return nil, nil
+	}
+
+	a.raMutex.Lock()
+	defer a.raMutex.Unlock()
+
+	now := time.Now()
+	st := a.raStates[p.GetName()]
+	if st == nil || a.shouldRotateRA(st.current, opts, now) {
+		ra, err := a.newRACertificate(p.GetName(), opts, now)
+		if err != nil {
+			return nil, fmt.Errorf("failed generating RA certificate for provisioner %q: %w", p.GetName(), err)
+		}
+		next := &raState{current: ra}
+		if st != nil && now.Before(st.current.cert.NotAfter) {
+			next.previous = st.current
+		}
+		if a.raStates == nil {
+			a.raStates = make(map[string]*raState)
+		}
+		a.raStates[p.GetName()] = next
+		st = next
+	}
+
+	ras := []*raCertificate{st.current}
+	if st.previous != nil && now.Before(st.previous.cert.NotAfter) {
+		ras = append(ras, st.previous)
+	}
+	return ras, nil
+}
+
+// shouldRotateRA returns true if the given RA certificate is in its renewal
+// period. Certificates limited by the expiration of the issuer are not
+// rotated, a new one would not last longer.
+func (a *Authority) shouldRotateRA(ra *raCertificate, opts *provisioner.SCEPRAOptions, now time.Time) bool {
+	if now.Add(opts.GetRenewBefore()).Before(ra.cert.NotAfter) {
+		return false
+	}
+	return a.signerCertificate == nil || ra.cert.NotAfter.Before(a.signerCertificate.NotAfter)
+}
+
+// newRACertificate generates a new RSA key and an RA certificate for it,
+// signed by the CA intermediate.
+func (a *Authority) newRACertificate(name string, opts *provisioner.SCEPRAOptions, now time.Time) (*raCertificate, error) {
+	if a.signerCertificate == nil || a.defaultSigner == nil {
+		return nil, errors.New("the CA intermediate signer is not available")
+	}
+
+	key, err := rsa.GenerateKey(rand.Reader, opts.GetKeySize())
+	if err != nil {
+		return nil, fmt.Errorf("failed generating RSA key: %w", err)
+	}
+	serialNumber, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("failed generating serial number: %w", err)
+	}
+
+	notAfter := now.Add(opts.GetLifetime())
+	if notAfter.After(a.signerCertificate.NotAfter) {
+		notAfter = a.signerCertificate.NotAfter
+	}
+	template := &x509.Certificate{
+		SerialNumber:          serialNumber,
+		Subject:               pkix.Name{CommonName: name + " SCEP RA"},
+		NotBefore:             now.Add(-time.Minute),
+		NotAfter:              notAfter,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment | x509.KeyUsageDataEncipherment,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, a.signerCertificate, key.Public(), a.defaultSigner)
+	if err != nil {
+		return nil, fmt.Errorf("failed signing RA certificate: %w", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, fmt.Errorf("failed parsing RA certificate: %w", err)
+	}
+	return &raCertificate{cert: cert, key: key}, nil
+}
@@ -0,0 +1,95 @@
+package scep
+
+import (
+	"context"
+	"crypto/x509"
+	"testing"
+	"time"
+
+	"github.com/smallstep/pkcs7"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.step.sm/crypto/minica"
+
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+func TestAuthority_getRACertificates(t *testing.T) {
+	ca, err := minica.New()
+	require.NoError(t, err)
+
+	a := &Authority{
+		intermediates:     []*x509.Certificate{ca.Intermediate},
+		signerCertificate: ca.Intermediate,
+		defaultSigner:     ca.Signer,
+	}
+
+	// Provisioners without RA options use the configured decrypter.
+	ctx := NewProvisionerContext(context.Background(), &provisioner.SCEP{Name: "scep", Type: "SCEP"})
+	ras, err := a.getRACertificates(ctx)
+	require.NoError(t, err)
+	assert.Nil(t, ras)
+
+	p := &provisioner.SCEP{Name: "scep", Type: "SCEP", RA: &provisioner.SCEPRAOptions{
+		Lifetime: &provisioner.Duration{Duration: time.Hour},
+	}}
+	ctx = NewProvisionerContext(context.Background(), p)
+	ras, err = a.getRACertificates(ctx)
+	require.NoError(t, err)
+	require.Len(t, ras, 1)
+	first := ras[0]
+	assert.Equal(t, "scep SCEP RA", first.cert.Subject.CommonName)
+	assert.Equal(t, x509.KeyUsageDigitalSignature|x509.KeyUsageKeyEncipherment|x509.KeyUsageDataEncipherment, first.cert.KeyUsage)
+	assert.Equal(t, 2048, first.key.N.BitLen())
+	assert.NoError(t, first.cert.CheckSignatureFrom(ca.Intermediate))
+
+	// The certificate is reused until the renewal period.
+	ras, err = a.getRACertificates(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []*raCertificate{first}, ras)
+
+	// Force the rotation, the previous certificate is kept.
+	p.RA.RenewBefore = &provisioner.Duration{Duration: time.Hour}
+	ras, err = a.getRACertificates(ctx)
+	require.NoError(t, err)
+	require.Len(t, ras, 2)
+	assert.NotEqual(t, first, ras[0])
+	assert.Equal(t, first, ras[1])
+
+	// Only the current and the previous certificates are returned with the
+	// intermediate.
+	p.RA.RenewBefore = nil
+	certs, err := a.GetCACertificates(ctx)
+	require.NoError(t, err)
+	require.Len(t, certs, 3)
+	assert.Equal(t, ras[0].cert, certs[0])
+	assert.Equal(t, ras[1].cert, certs[1])
+	assert.Equal(t, ca.Intermediate, certs[2])
+
+	// Content encrypted to the previous certificate can be decrypted.
+	ras, err = a.getRACertificates(ctx)
+	require.NoError(t, err)
+	require.Len(t, ras, 2)
+	e7, err := pkcs7.Encrypt([]byte("content"), []*x509.Certificate{ras[1].cert})
+	require.NoError(t, err)
+	p7, err := pkcs7.Parse(e7)
+	require.NoError(t, err)
+	content, err := a.decrypt(ctx, p7)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("content"), content)
+
+	// Responses are signed with the current certificate.
+	cert, signer, err := a.selectSigner(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, ras[0].cert, cert)
+	assert.Equal(t, ras[0].key, signer)
+}
+
+func TestAuthority_getRACertificates_noSigner(t *testing.T) {
+	a := &Authority{}
+	ctx := NewProvisionerContext(context.Background(), &provisioner.SCEP{
+		Name: "scep", Type: "SCEP", RA: &provisioner.SCEPRAOptions{},
+	})
+	_, err := a.getRACertificates(ctx)
+	assert.EqualError(t, err, `failed generating RA certificate for provisioner "scep": the CA intermediate signer is not available`)
+}
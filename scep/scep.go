@@ -51,6 +51,9 @@ type PKIMessage struct {
 	// decrypted enveloped content
 	pkiEnvelope []byte
 
+	// algorithm used to encrypt the enveloped content
+	contentEncryptionAlgorithm asn1.ObjectIdentifier
+
 	// Used to sign message
 	Recipients []*x509.Certificate
 }
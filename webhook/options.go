@@ -75,6 +75,24 @@ func WithAuthorizationPrincipal(p string) RequestBodyOption {
 	}
 }
 
+func WithOperation(op Operation) RequestBodyOption {
+	return func(rb *RequestBody) error {
+		rb.Operation = op
+		return nil
+	}
+}
+
+func WithRevocation(serial string, reasonCode int, reason string) RequestBodyOption {
+	return func(rb *RequestBody) error {
+		rb.Revocation = &Revocation{
+			SerialNumber: serial,
+			ReasonCode:   reasonCode,
+			Reason:       reason,
+		}
+		return nil
+	}
+}
+
 func WithSSHCertificateRequest(cr sshutil.CertificateRequest) RequestBodyOption {
 	return func(rb *RequestBody) error {
 		rb.SSHCertificateRequest = &SSHCertificateRequest{
@@ -32,6 +32,21 @@ func TestNewRequestBody(t *testing.T) {
 		wantErr bool
 	}
 	tests := map[string]test{
+		"Revocation": {
+			options: []RequestBodyOption{
+				WithOperation(OperationRevoke),
+				WithRevocation("1234", 1, "key compromised"),
+			},
+			want: &RequestBody{
+				Operation: OperationRevoke,
+				Revocation: &Revocation{
+					SerialNumber: "1234",
+					ReasonCode:   1,
+					Reason:       "key compromised",
+				},
+			},
+			wantErr: false,
+		},
 		"Permanent Identifier": {
 			options: []RequestBodyOption{WithAttestationData(&AttestationData{PermanentIdentifier: "mydevice123"})},
 			want: &RequestBody{
@@ -11,8 +11,24 @@ import (
 type ResponseBody struct {
 	Data  any  `json:"data"`
 	Allow bool `json:"allow"`
+	// AllowedSANs is an optional list of SANs returned by authorizing
+	// webhooks. If present, the SANs of the X.509 certificate that are not in
+	// the list are removed before signing it.
+	AllowedSANs []string `json:"allowedSANs,omitempty"`
 }
 
+// Operation is the type of the operation authorized by a webhook.
+type Operation string
+
+const (
+	// OperationSign is the operation used when a certificate is signed.
+	OperationSign Operation = "sign"
+	// OperationRenew is the operation used when a certificate is renewed.
+	OperationRenew Operation = "renew"
+	// OperationRevoke is the operation used when a certificate is revoked.
+	OperationRevoke Operation = "revoke"
+)
+
 // X509CertificateRequest is the certificate request sent to webhook servers for
 // enriching webhooks when signing x509 certificates
 type X509CertificateRequest struct {
@@ -52,6 +68,14 @@ type SSHCertificate struct {
 	ValidAfter   uint64 `json:"validAfter"`
 }
 
+// Revocation is the revocation request sent to authorizing webhooks when a
+// certificate is revoked.
+type Revocation struct {
+	SerialNumber string `json:"serialNumber"`
+	ReasonCode   int    `json:"reasonCode"`
+	Reason       string `json:"reason,omitempty"`
+}
+
 // AttestationData is data validated by acme device-attest-01 challenge
 type AttestationData struct {
 	PermanentIdentifier string `json:"permanentIdentifier"`
@@ -72,6 +96,8 @@ type X5CCertificate struct {
 type RequestBody struct {
 	Timestamp       time.Time `json:"timestamp"`
 	ProvisionerName string    `json:"provisionerName,omitempty"`
+	// Set for authorizing webhooks
+	Operation Operation `json:"operation,omitempty"`
 	// Only set after successfully completing acme device-attest-01 challenge
 	AttestationData *AttestationData `json:"attestationData,omitempty"`
 	// Set for most provisioners, but not acme or scep
@@ -81,6 +107,8 @@ type RequestBody struct {
 	X509Certificate        *X509Certificate        `json:"x509Certificate,omitempty"`
 	SSHCertificateRequest  *SSHCertificateRequest  `json:"sshCertificateRequest,omitempty"`
 	SSHCertificate         *SSHCertificate         `json:"sshCertificate,omitempty"`
+	// Only set for revocation requests
+	Revocation *Revocation `json:"revocation,omitempty"`
 	// Only set for SCEP webhook requests
 	SCEPChallenge        string `json:"scepChallenge,omitempty"`
 	SCEPTransactionID    string `json:"scepTransactionID,omitempty"`
@@ -0,0 +1,337 @@
+// Package api implements the Windows certificate enrollment web services,
+// MS-XCEP and MS-WSTEP, used by Windows autoenrollment.
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/smallstep/pkcs7"
+
+	"go.step.sm/crypto/x509util"
+
+	"github.com/smallstep/certificates/api"
+	"github.com/smallstep/certificates/api/log"
+	"github.com/smallstep/certificates/authority"
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/wstep"
+)
+
+const (
+	maxPayloadSize = 2 << 20
+	contentType    = "application/soap+xml; charset=utf-8"
+	// nextUpdateHours is the interval between policy updates.
+	nextUpdateHours = 8
+)
+
+// Authority is the interface used by the WSTEP handlers.
+type Authority interface {
+	LoadProvisionerByName(string) (provisioner.Interface, error)
+	GetIntermediateCertificates() []*x509.Certificate
+	SignWithContext(ctx context.Context, csr *x509.CertificateRequest, signOpts provisioner.SignOptions, extraOpts ...provisioner.SignOption) ([]*x509.Certificate, error)
+}
+
+var mustAuthority = func(ctx context.Context) Authority {
+	return authority.MustFromContext(ctx)
+}
+
+// Route traffic and implement the Router interface. The routes are mounted in
+// /wstep, and the label in the path is the name of the provisioner. The
+// policy endpoint, the URL configured in the group policy, is
+// /wstep/{provisionerName}/cep, and the enrollment endpoint is
+// /wstep/{provisionerName}/ces.
+func Route(r api.Router) {
+	r.MethodFunc(http.MethodPost, "/{provisionerName}/cep", lookupProvisioner(Policies))
+	r.MethodFunc(http.MethodPost, "/{provisionerName}/ces", lookupProvisioner(authenticate(Enroll)))
+}
+
+// Error is a WSTEP error sent to the client in a SOAP fault.
+type Error struct {
+	Sender    bool
+	ErrorCode int
+	Err       error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func senderError(errorCode int, format string, args ...any) *Error {
+	return &Error{Sender: true, ErrorCode: errorCode, Err: fmt.Errorf(format, args...)}
+}
+
+func receiverError(format string, args ...any) *Error {
+	return &Error{ErrorCode: wstep.ErrorFail, Err: fmt.Errorf(format, args...)}
+}
+
+type provisionerKey struct{}
+
+type identityKey struct{}
+
+func provisionerFromContext(ctx context.Context) *provisioner.WSTEP {
+	p, ok := ctx.Value(provisionerKey{}).(*provisioner.WSTEP)
+	if !ok {
+		panic("wstep provisioner expected in request context")
+	}
+	return p
+}
+
+func identityFromContext(ctx context.Context) *provisioner.WSTEPIdentity {
+	id, ok := ctx.Value(identityKey{}).(*provisioner.WSTEPIdentity)
+	if !ok {
+		panic("wstep identity expected in request context")
+	}
+	return id
+}
+
+// lookupProvisioner loads the WSTEP provisioner in the request path and
+// stores it in the context.
+func lookupProvisioner(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := chi.URLParam(r, "provisionerName")
+		p, err := mustAuthority(r.Context()).LoadProvisionerByName(name)
+		if err != nil {
+			fail(w, r, http.StatusNotFound, fmt.Errorf("provisioner %q not found", name))
+			return
+		}
+		prov, ok := p.(*provisioner.WSTEP)
+		if !ok {
+			fail(w, r, http.StatusNotFound, fmt.Errorf("provisioner %q is not a wstep provisioner", name))
+			return
+		}
+		ctx := context.WithValue(r.Context(), provisionerKey{}, prov)
+		next(w, r.WithContext(ctx))
+	}
+}
+
+// authenticate verifies the Kerberos token in the Negotiate authorization
+// header and stores the identity of the machine in the context.
+func authenticate(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+		if !ok || !strings.EqualFold(scheme, "Negotiate") {
+			unauthorized(w, r, errors.New("missing negotiate authorization header"))
+			return
+		}
+		b, err := base64.StdEncoding.DecodeString(strings.TrimSpace(token))
+		if err != nil {
+			unauthorized(w, r, fmt.Errorf("error decoding negotiate token: %w", err))
+			return
+		}
+		ctx := r.Context()
+		id, err := provisionerFromContext(ctx).AuthorizeKerberos(ctx, b, r.RemoteAddr)
+		if err != nil {
+			unauthorized(w, r, err)
+			return
+		}
+		ctx = context.WithValue(ctx, identityKey{}, id)
+		next(w, r.WithContext(ctx))
+	}
+}
+
+// readRequest reads and parses the SOAP request with the given action.
+func readRequest(r *http.Request, action string) (*wstep.Request, error) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxPayloadSize))
+	if err != nil {
+		return nil, senderError(wstep.ErrorInvalidArgument, "error reading request body: %w", err)
+	}
+	req, err := wstep.ParseRequest(body)
+	if err != nil {
+		return nil, senderError(wstep.ErrorInvalidArgument, "%w", err)
+	}
+	if req.Header.Action != action {
+		return req, senderError(wstep.ErrorInvalidArgument, "unsupported action %q", req.Header.Action)
+	}
+	return req, nil
+}
+
+// Policies returns the certificate enrollment policy with the certificate
+// template of the provisioner. This endpoint is not authenticated.
+func Policies(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	req, err := readRequest(r, wstep.ActionGetPolicies)
+	if err != nil {
+		writeFault(w, r, req, err)
+		return
+	}
+	if req.Body.GetPolicies == nil {
+		writeFault(w, r, req, senderError(wstep.ErrorInvalidArgument, "missing GetPolicies body"))
+		return
+	}
+
+	p := provisionerFromContext(ctx)
+	intermediates := mustAuthority(ctx).GetIntermediateCertificates()
+	if len(intermediates) == 0 {
+		writeFault(w, r, req, receiverError("the CA intermediate certificate is not available"))
+		return
+	}
+	major, minor := p.GetTemplateVersion()
+	validity := int64(p.DefaultTLSCertDuration().Seconds())
+	resp, err := wstep.NewPoliciesResponse(req, &wstep.Policy{
+		ID:               policyID(p),
+		FriendlyName:     p.GetName(),
+		NextUpdateHours:  nextUpdateHours,
+		TemplateName:     p.TemplateName,
+		TemplateOID:      p.GetTemplateOID().String(),
+		MajorRevision:    major,
+		MinorRevision:    minor,
+		ValiditySeconds:  validity,
+		RenewalSeconds:   validity / 3,
+		MinimalKeyLength: p.MinimumPublicKeyLength,
+		EnrollmentURL:    enrollmentURL(r, p),
+		Certificate:      intermediates[0],
+	})
+	if err != nil {
+		writeFault(w, r, req, receiverError("error creating policies response: %w", err))
+		return
+	}
+	writeResponse(w, http.StatusOK, resp)
+}
+
+// Enroll signs the certificate request of a machine authenticated with
+// Kerberos. Renewals are processed as new requests, the certificate is issued
+// to the authenticated machine.
+func Enroll(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	req, err := readRequest(r, wstep.ActionRequestToken)
+	if err != nil {
+		writeFault(w, r, req, err)
+		return
+	}
+	rst := req.Body.RequestSecurityToken
+	if rst == nil {
+		writeFault(w, r, req, senderError(wstep.ErrorInvalidArgument, "missing RequestSecurityToken body"))
+		return
+	}
+	if rst.RequestType != wstep.RequestTypeIssue && rst.RequestType != wstep.RequestTypeRenew {
+		writeFault(w, r, req, senderError(wstep.ErrorInvalidArgument, "unsupported request type %q", rst.RequestType))
+		return
+	}
+	csr, err := rst.CertificateRequest()
+	if err != nil {
+		writeFault(w, r, req, senderError(wstep.ErrorInvalidArgument, "%w", err))
+		return
+	}
+
+	chain, err := sign(ctx, csr)
+	if err != nil {
+		writeFault(w, r, req, err)
+		return
+	}
+	var raw []byte
+	for _, c := range chain {
+		raw = append(raw, c.Raw...)
+	}
+	certsOnly, err := pkcs7.DegenerateCertificate(raw)
+	if err != nil {
+		writeFault(w, r, req, receiverError("error creating certs-only response: %w", err))
+		return
+	}
+	resp, err := wstep.NewTokenResponse(req, chain[0], certsOnly)
+	if err != nil {
+		writeFault(w, r, req, receiverError("error creating token response: %w", err))
+		return
+	}
+	writeResponse(w, http.StatusOK, resp)
+}
+
+// sign signs the certificate request for the authenticated machine with the
+// provisioner in the context. The names in the request are replaced by the
+// DNS name of the machine.
+func sign(ctx context.Context, csr *x509.CertificateRequest) ([]*x509.Certificate, error) {
+	p := provisionerFromContext(ctx)
+	id := identityFromContext(ctx)
+
+	data := x509util.CreateTemplateData(id.DNSName, []string{id.DNSName})
+	data.SetCertificateRequest(csr)
+
+	ctx = provisioner.NewContextWithMethod(ctx, provisioner.SignMethod)
+	signOps, err := p.AuthorizeSign(ctx, "")
+	if err != nil {
+		return nil, senderError(wstep.ErrorAccessDenied, "%w", err)
+	}
+	for _, signOp := range signOps {
+		if wc, ok := signOp.(*provisioner.WebhookController); ok {
+			wc.TemplateData = data
+		}
+	}
+	templateOptions, err := provisioner.TemplateOptions(p.GetOptions(), data)
+	if err != nil {
+		return nil, receiverError("error creating template options from WSTEP provisioner: %w", err)
+	}
+	signOps = append(signOps, templateOptions)
+
+	chain, err := mustAuthority(ctx).SignWithContext(ctx, csr, provisioner.SignOptions{}, signOps...)
+	if err != nil {
+		return nil, senderError(wstep.ErrorInvalidArgument, "error generating certificate: %w", err)
+	}
+	return chain, nil
+}
+
+// policyID returns a stable GUID identifying the policy of the provisioner.
+func policyID(p *provisioner.WSTEP) string {
+	b := sha256.Sum256([]byte("wstep policy " + p.GetID()))
+	return fmt.Sprintf("{%X-%X-%X-%X-%X}", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// enrollmentURL returns the URL of the enrollment endpoint of the provisioner
+// using the host of the policy request.
+func enrollmentURL(r *http.Request, p *provisioner.WSTEP) string {
+	u := url.URL{
+		Scheme: "https",
+		Host:   r.Host,
+		Path:   "/wstep/" + p.GetName() + "/ces",
+	}
+	return u.String()
+}
+
+func writeResponse(w http.ResponseWriter, status int, b []byte) {
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(status)
+	w.Write(b)
+}
+
+// writeFault writes the error as a SOAP fault. Sender faults use the status
+// 400 Bad Request, and receiver faults 500 Internal Server Error.
+func writeFault(w http.ResponseWriter, r *http.Request, req *wstep.Request, err error) {
+	log.Error(w, r, err)
+
+	wsErr := receiverError("%w", err)
+	errors.As(err, &wsErr)
+	status := http.StatusInternalServerError
+	if wsErr.Sender {
+		status = http.StatusBadRequest
+	}
+	b, ferr := wstep.NewFault(req, wsErr.Sender, wsErr.ErrorCode, err.Error())
+	if ferr != nil {
+		fail(w, r, http.StatusInternalServerError, ferr)
+		return
+	}
+	writeResponse(w, status, b)
+}
+
+// unauthorized writes a 401 Unauthorized response asking for Kerberos
+// authentication.
+func unauthorized(w http.ResponseWriter, r *http.Request, err error) {
+	w.Header().Set("WWW-Authenticate", "Negotiate")
+	fail(w, r, http.StatusUnauthorized, err)
+}
+
+// fail writes an error that cannot be sent in a SOAP fault.
+func fail(w http.ResponseWriter, r *http.Request, status int, err error) {
+	log.Error(w, r, err)
+	http.Error(w, err.Error(), status)
+}
@@ -0,0 +1,290 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jcmturner/gokrb5/v8/client"
+	krbconfig "github.com/jcmturner/gokrb5/v8/config"
+	"github.com/jcmturner/gokrb5/v8/iana/nametype"
+	"github.com/jcmturner/gokrb5/v8/keytab"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/spnego"
+	"github.com/jcmturner/gokrb5/v8/types"
+	"github.com/smallstep/pkcs7"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.step.sm/crypto/keyutil"
+	"go.step.sm/crypto/minica"
+	"go.step.sm/crypto/x509util"
+
+	"github.com/smallstep/certificates/authority/config"
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/wstep"
+)
+
+type mockAuthority struct {
+	ca          *minica.CA
+	provisioner provisioner.Interface
+	data        x509util.TemplateData
+	signErr     error
+}
+
+func (m *mockAuthority) LoadProvisionerByName(name string) (provisioner.Interface, error) {
+	if m.provisioner == nil || m.provisioner.GetName() != name {
+		return nil, errors.New("not found")
+	}
+	return m.provisioner, nil
+}
+
+func (m *mockAuthority) GetIntermediateCertificates() []*x509.Certificate {
+	return []*x509.Certificate{m.ca.Intermediate}
+}
+
+func (m *mockAuthority) SignWithContext(_ context.Context, csr *x509.CertificateRequest, _ provisioner.SignOptions, extraOpts ...provisioner.SignOption) ([]*x509.Certificate, error) {
+	if m.signErr != nil {
+		return nil, m.signErr
+	}
+	for _, o := range extraOpts {
+		if wc, ok := o.(*provisioner.WebhookController); ok {
+			m.data, _ = wc.TemplateData.(x509util.TemplateData)
+		}
+	}
+	cn := m.data[x509util.SubjectKey].(x509util.Subject).CommonName
+	cert, err := m.ca.Sign(&x509.Certificate{
+		Subject:   pkix.Name{CommonName: cn},
+		DNSNames:  []string{cn},
+		PublicKey: csr.PublicKey,
+		NotBefore: time.Now().Add(-time.Minute),
+		NotAfter:  time.Now().Add(time.Hour),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return []*x509.Certificate{cert, m.ca.Intermediate}, nil
+}
+
+func mockMustAuthority(t *testing.T, a Authority) {
+	t.Helper()
+	fn := mustAuthority
+	t.Cleanup(func() {
+		mustAuthority = fn
+	})
+	mustAuthority = func(context.Context) Authority {
+		return a
+	}
+}
+
+func newRouter() http.Handler {
+	r := chi.NewRouter()
+	r.Route("/wstep", func(r chi.Router) {
+		Route(r)
+	})
+	return r
+}
+
+func newWSTEP(t *testing.T) (*provisioner.WSTEP, *keytab.Keytab) {
+	t.Helper()
+	kt := keytab.New()
+	require.NoError(t, kt.AddEntry("HTTP/ca.example.com", "EXAMPLE.COM", "password", time.Now(), 1, 18))
+	b, err := kt.Marshal()
+	require.NoError(t, err)
+	p := &provisioner.WSTEP{
+		Type:   "WSTEP",
+		Name:   "wstep",
+		Keytab: b,
+	}
+	require.NoError(t, p.Init(provisioner.Config{Claims: config.GlobalProvisionerClaims}))
+	return p, kt
+}
+
+// negotiate returns the value of a Negotiate authorization header for the
+// given machine account.
+func negotiate(t *testing.T, kt *keytab.Keytab, username string) string {
+	t.Helper()
+	now := time.Now().UTC()
+	cname := types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, username)
+	sname := types.NewPrincipalName(nametype.KRB_NT_SRV_INST, "HTTP/ca.example.com")
+	tkt, sessionKey, err := messages.NewTicket(cname, "EXAMPLE.COM", sname, "EXAMPLE.COM", types.NewKrbFlags(), kt, 18, 1, now, now, now.Add(time.Hour), now.Add(time.Hour))
+	require.NoError(t, err)
+	cl := client.NewWithKeytab(username, "EXAMPLE.COM", keytab.New(), krbconfig.New())
+	init, err := spnego.NewNegTokenInitKRB5(cl, tkt, sessionKey)
+	require.NoError(t, err)
+	b, err := (&spnego.SPNEGOToken{Init: true, NegTokenInit: init}).Marshal()
+	require.NoError(t, err)
+	return "Negotiate " + base64.StdEncoding.EncodeToString(b)
+}
+
+const getPoliciesRequest = `<s:Envelope xmlns:a="http://www.w3.org/2005/08/addressing" xmlns:s="http://www.w3.org/2003/05/soap-envelope">
+  <s:Header>
+    <a:Action s:mustUnderstand="1">%s</a:Action>
+    <a:MessageID>urn:uuid:72048fc1-ce8c-4f3a-9d5f-2d4b2a3ebf3c</a:MessageID>
+  </s:Header>
+  <s:Body>
+    <GetPolicies xmlns="http://schemas.microsoft.com/windows/pki/2009/01/enrollmentpolicy">
+      <client><lastUpdate>0001-01-01T00:00:00</lastUpdate></client>
+    </GetPolicies>
+  </s:Body>
+</s:Envelope>`
+
+const requestSecurityTokenRequest = `<s:Envelope xmlns:a="http://www.w3.org/2005/08/addressing" xmlns:s="http://www.w3.org/2003/05/soap-envelope">
+  <s:Header>
+    <a:Action s:mustUnderstand="1">http://schemas.microsoft.com/windows/pki/2009/01/enrollment/RST/wstep</a:Action>
+    <a:MessageID>urn:uuid:b5d1a601-5091-4a7d-b34b-5204c18b5919</a:MessageID>
+  </s:Header>
+  <s:Body>
+    <RequestSecurityToken xmlns="http://docs.oasis-open.org/ws-sx/ws-trust/200512">
+      <TokenType>http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-x509-token-profile-1.0#X509v3</TokenType>
+      <RequestType>%s</RequestType>
+      <BinarySecurityToken ValueType="http://schemas.microsoft.com/windows/pki/2009/01/enrollment#PKCS10" EncodingType="http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-secext-1.0.xsd#base64binary" xmlns="http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-secext-1.0.xsd">%s</BinarySecurityToken>
+    </RequestSecurityToken>
+  </s:Body>
+</s:Envelope>`
+
+func newCSR(t *testing.T) string {
+	t.Helper()
+	key, err := keyutil.GenerateDefaultSigner()
+	require.NoError(t, err)
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: "other.example.com"},
+	}, key)
+	require.NoError(t, err)
+	return base64.StdEncoding.EncodeToString(der)
+}
+
+type testFault struct {
+	Code      string `xml:"Body>Fault>Code>Value"`
+	ErrorCode int    `xml:"Body>Fault>Detail>CertificateEnrollmentWSDetail>ErrorCode"`
+}
+
+func TestPolicies(t *testing.T) {
+	ca, err := minica.New()
+	require.NoError(t, err)
+	p, _ := newWSTEP(t)
+
+	tests := []struct {
+		name       string
+		url        string
+		body       string
+		wantStatus int
+		wantFault  int
+	}{
+		{"ok", "/wstep/wstep/cep", fmt.Sprintf(getPoliciesRequest, wstep.ActionGetPolicies), http.StatusOK, 0},
+		{"fail provisioner", "/wstep/other/cep", fmt.Sprintf(getPoliciesRequest, wstep.ActionGetPolicies), http.StatusNotFound, 0},
+		{"fail action", "/wstep/wstep/cep", fmt.Sprintf(getPoliciesRequest, wstep.ActionRequestToken), http.StatusBadRequest, wstep.ErrorInvalidArgument},
+		{"fail body", "/wstep/wstep/cep", "<foo", http.StatusBadRequest, wstep.ErrorInvalidArgument},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockMustAuthority(t, &mockAuthority{ca: ca, provisioner: p})
+			req := httptest.NewRequest(http.MethodPost, tt.url, bytes.NewBufferString(tt.body))
+			req.Host = "ca.example.com"
+			w := httptest.NewRecorder()
+			newRouter().ServeHTTP(w, req)
+			require.Equal(t, tt.wantStatus, w.Code)
+
+			switch {
+			case tt.wantStatus == http.StatusOK:
+				assert.Equal(t, contentType, w.Header().Get("Content-Type"))
+				var resp struct {
+					PolicyID string `xml:"Body>GetPoliciesResponse>response>policyID"`
+					URI      string `xml:"Body>GetPoliciesResponse>cAs>cA>uris>cAURI>uri"`
+					OID      string `xml:"Body>GetPoliciesResponse>oIDs>oID>value"`
+				}
+				require.NoError(t, xml.Unmarshal(w.Body.Bytes(), &resp))
+				assert.Equal(t, policyID(p), resp.PolicyID)
+				assert.Regexp(t, `^\{[0-9A-F]{8}-[0-9A-F]{4}-[0-9A-F]{4}-[0-9A-F]{4}-[0-9A-F]{12}\}$`, resp.PolicyID)
+				assert.Equal(t, "https://ca.example.com/wstep/wstep/ces", resp.URI)
+				assert.Equal(t, p.GetTemplateOID().String(), resp.OID)
+			case tt.wantFault != 0:
+				var f testFault
+				require.NoError(t, xml.Unmarshal(w.Body.Bytes(), &f))
+				assert.Equal(t, "s:Sender", f.Code)
+				assert.Equal(t, tt.wantFault, f.ErrorCode)
+			}
+		})
+	}
+}
+
+func TestEnroll(t *testing.T) {
+	ca, err := minica.New()
+	require.NoError(t, err)
+	p, kt := newWSTEP(t)
+
+	tests := []struct {
+		name          string
+		authorization string
+		body          string
+		signErr       error
+		wantStatus    int
+		wantFault     int
+	}{
+		{"ok issue", negotiate(t, kt, "WS01$"), fmt.Sprintf(requestSecurityTokenRequest, wstep.RequestTypeIssue, newCSR(t)), nil, http.StatusOK, 0},
+		{"ok renew", negotiate(t, kt, "WS01$"), fmt.Sprintf(requestSecurityTokenRequest, wstep.RequestTypeRenew, newCSR(t)), nil, http.StatusOK, 0},
+		{"fail no authorization", "", fmt.Sprintf(requestSecurityTokenRequest, wstep.RequestTypeIssue, newCSR(t)), nil, http.StatusUnauthorized, 0},
+		{"fail basic authorization", "Basic dXNlcjpwYXNz", fmt.Sprintf(requestSecurityTokenRequest, wstep.RequestTypeIssue, newCSR(t)), nil, http.StatusUnauthorized, 0},
+		{"fail negotiate token", "Negotiate Zm9v", fmt.Sprintf(requestSecurityTokenRequest, wstep.RequestTypeIssue, newCSR(t)), nil, http.StatusUnauthorized, 0},
+		{"fail user account", negotiate(t, kt, "jane"), fmt.Sprintf(requestSecurityTokenRequest, wstep.RequestTypeIssue, newCSR(t)), nil, http.StatusUnauthorized, 0},
+		{"fail request type", negotiate(t, kt, "WS01$"), fmt.Sprintf(requestSecurityTokenRequest, "http://schemas.microsoft.com/windows/pki/2009/01/enrollment/QueryTokenStatus", newCSR(t)), nil, http.StatusBadRequest, wstep.ErrorInvalidArgument},
+		{"fail csr", negotiate(t, kt, "WS01$"), fmt.Sprintf(requestSecurityTokenRequest, wstep.RequestTypeIssue, "Zm9v"), nil, http.StatusBadRequest, wstep.ErrorInvalidArgument},
+		{"fail sign", negotiate(t, kt, "WS01$"), fmt.Sprintf(requestSecurityTokenRequest, wstep.RequestTypeIssue, newCSR(t)), errors.New("force"), http.StatusBadRequest, wstep.ErrorInvalidArgument},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &mockAuthority{ca: ca, provisioner: p, signErr: tt.signErr}
+			mockMustAuthority(t, a)
+			req := httptest.NewRequest(http.MethodPost, "/wstep/wstep/ces", bytes.NewBufferString(tt.body))
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			w := httptest.NewRecorder()
+			newRouter().ServeHTTP(w, req)
+			require.Equal(t, tt.wantStatus, w.Code, w.Body.String())
+
+			switch {
+			case tt.wantStatus == http.StatusOK:
+				assert.Equal(t, contentType, w.Header().Get("Content-Type"))
+				assert.Equal(t, x509util.Subject{CommonName: "ws01.example.com"}, a.data[x509util.SubjectKey])
+				assert.Equal(t, []x509util.SubjectAlternativeName{{Type: "dns", Value: "ws01.example.com"}}, a.data[x509util.SANsKey])
+
+				var resp struct {
+					RelatesTo string `xml:"Header>RelatesTo"`
+					PKCS7     string `xml:"Body>RequestSecurityTokenResponseCollection>RequestSecurityTokenResponse>BinarySecurityToken"`
+					Cert      string `xml:"Body>RequestSecurityTokenResponseCollection>RequestSecurityTokenResponse>RequestedSecurityToken>BinarySecurityToken"`
+				}
+				require.NoError(t, xml.Unmarshal(w.Body.Bytes(), &resp))
+				assert.Equal(t, "urn:uuid:b5d1a601-5091-4a7d-b34b-5204c18b5919", resp.RelatesTo)
+				der, err := base64.StdEncoding.DecodeString(resp.Cert)
+				require.NoError(t, err)
+				cert, err := x509.ParseCertificate(der)
+				require.NoError(t, err)
+				assert.Equal(t, []string{"ws01.example.com"}, cert.DNSNames)
+				der, err = base64.StdEncoding.DecodeString(resp.PKCS7)
+				require.NoError(t, err)
+				p7, err := pkcs7.Parse(der)
+				require.NoError(t, err)
+				assert.Equal(t, []*x509.Certificate{cert, ca.Intermediate}, p7.Certificates)
+			case tt.wantStatus == http.StatusUnauthorized:
+				assert.Equal(t, "Negotiate", w.Header().Get("WWW-Authenticate"))
+			case tt.wantFault != 0:
+				var f testFault
+				require.NoError(t, xml.Unmarshal(w.Body.Bytes(), &f))
+				assert.Equal(t, "s:Sender", f.Code)
+				assert.Equal(t, tt.wantFault, f.ErrorCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,200 @@
+// Package wstep implements the SOAP messages of the Windows certificate
+// enrollment web services: the certificate enrollment policy protocol,
+// MS-XCEP, and the WS-Trust X.509v3 token enrollment extensions, MS-WSTEP.
+package wstep
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/smallstep/pkcs7"
+)
+
+// Namespaces used in the messages.
+const (
+	NamespaceSOAP        = "http://www.w3.org/2003/05/soap-envelope"
+	NamespaceAddressing  = "http://www.w3.org/2005/08/addressing"
+	NamespaceXSI         = "http://www.w3.org/2001/XMLSchema-instance"
+	NamespacePolicy      = "http://schemas.microsoft.com/windows/pki/2009/01/enrollmentpolicy"
+	NamespaceEnrollment  = "http://schemas.microsoft.com/windows/pki/2009/01/enrollment"
+	NamespaceTrust       = "http://docs.oasis-open.org/ws-sx/ws-trust/200512"
+	NamespaceSecurityExt = "http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-secext-1.0.xsd"
+)
+
+// SOAP actions of the requests and responses.
+const (
+	ActionGetPolicies          = "http://schemas.microsoft.com/windows/pki/2009/01/enrollmentpolicy/IPolicy/GetPolicies"
+	ActionGetPoliciesResponse  = "http://schemas.microsoft.com/windows/pki/2009/01/enrollmentpolicy/IPolicy/GetPoliciesResponse"
+	ActionRequestToken         = "http://schemas.microsoft.com/windows/pki/2009/01/enrollment/RST/wstep"
+	ActionRequestTokenResponse = "http://schemas.microsoft.com/windows/pki/2009/01/enrollment/RSTRC/wstep"
+	ActionFault                = "http://www.w3.org/2005/08/addressing/soap/fault"
+)
+
+// Request types of a RequestSecurityToken message.
+const (
+	RequestTypeIssue = "http://docs.oasis-open.org/ws-sx/ws-trust/200512/Issue"
+	RequestTypeRenew = "http://docs.oasis-open.org/ws-sx/ws-trust/200512/Renew"
+)
+
+// Value types of a BinarySecurityToken.
+const (
+	ValueTypePKCS10 = "http://schemas.microsoft.com/windows/pki/2009/01/enrollment#PKCS10"
+	ValueTypePKCS7  = "http://schemas.microsoft.com/windows/pki/2009/01/enrollment#PKCS7"
+	ValueTypeCMC    = "http://schemas.microsoft.com/windows/pki/2009/01/enrollment#CMC"
+	ValueTypeX509v3 = "http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-x509-token-profile-1.0#X509v3"
+)
+
+// EncodingTypeBase64 is the encoding of the BinarySecurityToken.
+const EncodingTypeBase64 = "http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-secext-1.0.xsd#base64binary"
+
+// Request is a SOAP request sent by a Windows client.
+type Request struct {
+	XMLName xml.Name `xml:"http://www.w3.org/2003/05/soap-envelope Envelope"`
+	Header  struct {
+		Action    string `xml:"http://www.w3.org/2005/08/addressing Action"`
+		MessageID string `xml:"http://www.w3.org/2005/08/addressing MessageID"`
+	} `xml:"http://www.w3.org/2003/05/soap-envelope Header"`
+	Body struct {
+		GetPolicies          *GetPolicies          `xml:"http://schemas.microsoft.com/windows/pki/2009/01/enrollmentpolicy GetPolicies"`
+		RequestSecurityToken *RequestSecurityToken `xml:"http://docs.oasis-open.org/ws-sx/ws-trust/200512 RequestSecurityToken"`
+	} `xml:"http://www.w3.org/2003/05/soap-envelope Body"`
+}
+
+// GetPolicies is the body of a MS-XCEP request. The filters in the request
+// are ignored.
+type GetPolicies struct {
+	Client struct {
+		LastUpdate        string `xml:"lastUpdate"`
+		PreferredLanguage string `xml:"preferredLanguage"`
+	} `xml:"client"`
+}
+
+// RequestSecurityToken is the body of a MS-WSTEP request.
+type RequestSecurityToken struct {
+	TokenType           string              `xml:"TokenType"`
+	RequestType         string              `xml:"RequestType"`
+	BinarySecurityToken BinarySecurityToken `xml:"http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-secext-1.0.xsd BinarySecurityToken"`
+}
+
+// BinarySecurityToken is a base64 encoded token.
+type BinarySecurityToken struct {
+	ValueType    string `xml:"ValueType,attr"`
+	EncodingType string `xml:"EncodingType,attr"`
+	Value        string `xml:",chardata"`
+}
+
+// Bytes returns the decoded token. Windows clients might split the base64
+// value in multiple lines.
+func (t *BinarySecurityToken) Bytes() ([]byte, error) {
+	value := strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '\t', '\r', '\n':
+			return -1
+		default:
+			return r
+		}
+	}, t.Value)
+	b, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding binary security token: %w", err)
+	}
+	return b, nil
+}
+
+// ParseRequest parses a SOAP 1.2 request.
+func ParseRequest(data []byte) (*Request, error) {
+	var req Request
+	if err := xml.Unmarshal(data, &req); err != nil {
+		return nil, fmt.Errorf("error parsing soap request: %w", err)
+	}
+	return &req, nil
+}
+
+// CertificateRequest returns the certificate request in the token. The token
+// can be a PKCS #10 request, a CMC request, or a PKCS #7 signed data with a
+// PKCS #10 or CMC request. The signature of the PKCS #7 structure is not
+// verified, the requests are authenticated by the transport.
+func (r *RequestSecurityToken) CertificateRequest() (*x509.CertificateRequest, error) {
+	b, err := r.BinarySecurityToken.Bytes()
+	if err != nil {
+		return nil, err
+	}
+
+	var der []byte
+	switch r.BinarySecurityToken.ValueType {
+	case ValueTypePKCS10:
+		der = b
+	case ValueTypePKCS7, ValueTypeCMC:
+		if der, err = parseSignedRequest(b); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported binary security token value type %q", r.BinarySecurityToken.ValueType)
+	}
+
+	csr, err := x509.ParseCertificateRequest(der)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing certificate request: %w", err)
+	}
+	if err := csr.CheckSignature(); err != nil {
+		return nil, fmt.Errorf("invalid certificate request signature: %w", err)
+	}
+	return csr, nil
+}
+
+// parseSignedRequest returns the PKCS #10 request in a PKCS #7 signed data.
+// The content can be a PKCS #10 request or a CMC PKIData with only one
+// request.
+func parseSignedRequest(b []byte) ([]byte, error) {
+	p7, err := pkcs7.Parse(b)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing pkcs7 request: %w", err)
+	}
+	if _, err := x509.ParseCertificateRequest(p7.Content); err == nil {
+		return p7.Content, nil
+	}
+	return parsePKIData(p7.Content)
+}
+
+// pkiData is the CMC PKIData defined in RFC 5272.
+type pkiData struct {
+	ControlSequence  []asn1.RawValue
+	ReqSequence      []asn1.RawValue
+	CMSSequence      []asn1.RawValue
+	OtherMsgSequence []asn1.RawValue
+}
+
+// taggedCertificationRequest is the tcr choice of a CMC TaggedRequest.
+type taggedCertificationRequest struct {
+	BodyPartID           int
+	CertificationRequest asn1.RawValue
+}
+
+// parsePKIData returns the PKCS #10 request of a CMC PKIData.
+func parsePKIData(b []byte) ([]byte, error) {
+	var data pkiData
+	rest, err := asn1.Unmarshal(b, &data)
+	switch {
+	case err != nil:
+		return nil, fmt.Errorf("error parsing cmc request: %w", err)
+	case len(rest) > 0:
+		return nil, errors.New("error parsing cmc request: trailing data")
+	case len(data.ReqSequence) != 1:
+		return nil, errors.New("cmc requests must contain exactly one certificate request")
+	}
+
+	req := data.ReqSequence[0]
+	if req.Class != asn1.ClassContextSpecific || req.Tag != 0 {
+		return nil, errors.New("cmc requests must contain a pkcs10 certificate request")
+	}
+	var tcr taggedCertificationRequest
+	if _, err := asn1.UnmarshalWithParams(req.FullBytes, &tcr, "tag:0"); err != nil {
+		return nil, fmt.Errorf("error parsing cmc certificate request: %w", err)
+	}
+	return tcr.CertificationRequest.FullBytes, nil
+}
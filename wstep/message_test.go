@@ -0,0 +1,184 @@
+package wstep
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/smallstep/pkcs7"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.step.sm/crypto/minica"
+)
+
+const testGetPolicies = `<s:Envelope xmlns:a="http://www.w3.org/2005/08/addressing" xmlns:s="http://www.w3.org/2003/05/soap-envelope">
+  <s:Header>
+    <a:Action s:mustUnderstand="1">http://schemas.microsoft.com/windows/pki/2009/01/enrollmentpolicy/IPolicy/GetPolicies</a:Action>
+    <a:MessageID>urn:uuid:72048fc1-ce8c-4f3a-9d5f-2d4b2a3ebf3c</a:MessageID>
+    <a:To s:mustUnderstand="1">https://ca.example.com/wstep/wstep/cep</a:To>
+  </s:Header>
+  <s:Body xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xmlns:xsd="http://www.w3.org/2001/XMLSchema">
+    <GetPolicies xmlns="http://schemas.microsoft.com/windows/pki/2009/01/enrollmentpolicy">
+      <client>
+        <lastUpdate>0001-01-01T00:00:00</lastUpdate>
+        <preferredLanguage xsi:nil="true"/>
+      </client>
+      <requestFilter xsi:nil="true"/>
+    </GetPolicies>
+  </s:Body>
+</s:Envelope>`
+
+const testRequestSecurityToken = `<s:Envelope xmlns:a="http://www.w3.org/2005/08/addressing" xmlns:s="http://www.w3.org/2003/05/soap-envelope">
+  <s:Header>
+    <a:Action s:mustUnderstand="1">http://schemas.microsoft.com/windows/pki/2009/01/enrollment/RST/wstep</a:Action>
+    <a:MessageID>urn:uuid:b5d1a601-5091-4a7d-b34b-5204c18b5919</a:MessageID>
+    <a:To s:mustUnderstand="1">https://ca.example.com/wstep/wstep/ces</a:To>
+  </s:Header>
+  <s:Body>
+    <RequestSecurityToken PreferredLanguage="en-US" xmlns="http://docs.oasis-open.org/ws-sx/ws-trust/200512">
+      <TokenType>http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-x509-token-profile-1.0#X509v3</TokenType>
+      <RequestType>%s</RequestType>
+      <BinarySecurityToken ValueType="%s" EncodingType="http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-secext-1.0.xsd#base64binary" a:Id="" xmlns:a="http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-utility-1.0.xsd" xmlns="http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-secext-1.0.xsd">%s</BinarySecurityToken>
+    </RequestSecurityToken>
+  </s:Body>
+</s:Envelope>`
+
+func newTestCSR(t *testing.T) []byte {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: "ws01"},
+	}, key)
+	require.NoError(t, err)
+	return der
+}
+
+// newTestSignedData returns a PKCS #7 signed data with the given content,
+// like the ones sent by Windows clients.
+func newTestSignedData(t *testing.T, content []byte) []byte {
+	t.Helper()
+	ca, err := minica.New()
+	require.NoError(t, err)
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	cert, err := ca.Sign(&x509.Certificate{
+		Subject:   pkix.Name{CommonName: "ws01"},
+		PublicKey: key.Public(),
+	})
+	require.NoError(t, err)
+	sd, err := pkcs7.NewSignedData(content)
+	require.NoError(t, err)
+	require.NoError(t, sd.AddSigner(cert, key, pkcs7.SignerInfoConfig{}))
+	b, err := sd.Finish()
+	require.NoError(t, err)
+	return b
+}
+
+func newTestPKIData(t *testing.T, csrs ...[]byte) []byte {
+	t.Helper()
+	data := pkiData{
+		ControlSequence:  []asn1.RawValue{},
+		CMSSequence:      []asn1.RawValue{},
+		OtherMsgSequence: []asn1.RawValue{},
+	}
+	for i, csr := range csrs {
+		tcr, err := asn1.MarshalWithParams(taggedCertificationRequest{
+			BodyPartID:           i + 1,
+			CertificationRequest: asn1.RawValue{FullBytes: csr},
+		}, "tag:0")
+		require.NoError(t, err)
+		data.ReqSequence = append(data.ReqSequence, asn1.RawValue{FullBytes: tcr})
+	}
+	b, err := asn1.Marshal(data)
+	require.NoError(t, err)
+	return b
+}
+
+// encodeLines encodes the data in base64 with lines of 64 characters.
+func encodeLines(b []byte) string {
+	s := base64.StdEncoding.EncodeToString(b)
+	var lines []string
+	for len(s) > 64 {
+		lines = append(lines, s[:64])
+		s = s[64:]
+	}
+	return strings.Join(append(lines, s), "\r\n")
+}
+
+func TestParseRequest(t *testing.T) {
+	req, err := ParseRequest([]byte(testGetPolicies))
+	require.NoError(t, err)
+	assert.Equal(t, ActionGetPolicies, req.Header.Action)
+	assert.Equal(t, "urn:uuid:72048fc1-ce8c-4f3a-9d5f-2d4b2a3ebf3c", req.Header.MessageID)
+	require.NotNil(t, req.Body.GetPolicies)
+	assert.Equal(t, "0001-01-01T00:00:00", req.Body.GetPolicies.Client.LastUpdate)
+	assert.Nil(t, req.Body.RequestSecurityToken)
+
+	csr := newTestCSR(t)
+	req, err = ParseRequest([]byte(fmt.Sprintf(testRequestSecurityToken, RequestTypeIssue, ValueTypePKCS10, encodeLines(csr))))
+	require.NoError(t, err)
+	assert.Equal(t, ActionRequestToken, req.Header.Action)
+	assert.Equal(t, "urn:uuid:b5d1a601-5091-4a7d-b34b-5204c18b5919", req.Header.MessageID)
+	assert.Nil(t, req.Body.GetPolicies)
+	require.NotNil(t, req.Body.RequestSecurityToken)
+	assert.Equal(t, ValueTypeX509v3, req.Body.RequestSecurityToken.TokenType)
+	assert.Equal(t, RequestTypeIssue, req.Body.RequestSecurityToken.RequestType)
+	assert.Equal(t, ValueTypePKCS10, req.Body.RequestSecurityToken.BinarySecurityToken.ValueType)
+	b, err := req.Body.RequestSecurityToken.BinarySecurityToken.Bytes()
+	require.NoError(t, err)
+	assert.Equal(t, csr, b)
+
+	_, err = ParseRequest([]byte("<foo"))
+	assert.Error(t, err)
+	_, err = ParseRequest([]byte(`<Envelope xmlns="urn:other"></Envelope>`))
+	assert.Error(t, err)
+}
+
+func TestRequestSecurityToken_CertificateRequest(t *testing.T) {
+	csr := newTestCSR(t)
+	badSignature := append([]byte{}, csr...)
+	badSignature[len(badSignature)-1] ^= 0xff
+
+	tests := []struct {
+		name      string
+		valueType string
+		value     string
+		wantErr   bool
+	}{
+		{"ok pkcs10", ValueTypePKCS10, encodeLines(csr), false},
+		{"ok pkcs7", ValueTypePKCS7, encodeLines(newTestSignedData(t, csr)), false},
+		{"ok cmc", ValueTypeCMC, encodeLines(newTestSignedData(t, newTestPKIData(t, csr))), false},
+		{"ok pkcs7 with cmc", ValueTypePKCS7, encodeLines(newTestSignedData(t, newTestPKIData(t, csr))), false},
+		{"fail value type", "urn:other", encodeLines(csr), true},
+		{"fail base64", ValueTypePKCS10, "%%%", true},
+		{"fail pkcs10", ValueTypePKCS10, encodeLines([]byte("foo")), true},
+		{"fail signature", ValueTypePKCS10, encodeLines(badSignature), true},
+		{"fail pkcs7", ValueTypePKCS7, encodeLines([]byte("foo")), true},
+		{"fail cmc content", ValueTypeCMC, encodeLines(newTestSignedData(t, []byte("foo"))), true},
+		{"fail cmc requests", ValueTypeCMC, encodeLines(newTestSignedData(t, newTestPKIData(t, csr, csr))), true},
+		{"fail cmc no requests", ValueTypeCMC, encodeLines(newTestSignedData(t, newTestPKIData(t))), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := ParseRequest([]byte(fmt.Sprintf(testRequestSecurityToken, RequestTypeIssue, tt.valueType, tt.value)))
+			require.NoError(t, err)
+			got, err := req.Body.RequestSecurityToken.CertificateRequest()
+			if tt.wantErr {
+				assert.Error(t, err)
+				assert.Nil(t, got)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, csr, got.Raw)
+		})
+	}
+}
@@ -0,0 +1,338 @@
+package wstep
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/xml"
+)
+
+// Flags of the certificate templates sent in a MS-XCEP response.
+const (
+	// SubjectNameFlags: CT_FLAG_SUBJECT_ALT_REQUIRE_DNS and
+	// CT_FLAG_SUBJECT_REQUIRE_DNS_AS_CN, the CA builds the subject and the
+	// DNS name using the account of the machine.
+	subjectNameFlags = 0x08000000 | 0x40000000
+	// EnrollmentFlags: CT_FLAG_AUTO_ENROLLMENT.
+	enrollmentFlags = 0x00000020
+	// GeneralFlags: CT_FLAG_MACHINE_TYPE.
+	generalFlags = 0x00000040
+	// KeySpec: AT_KEYEXCHANGE.
+	keySpecKeyExchange = 1
+	// ClientAuthentication: Kerberos (Windows integrated) authentication.
+	clientAuthenticationKerberos = 2
+	// Group of the template OIDs: CERT_TEMPLATE_OID_GROUP_ID.
+	oidGroupTemplate = 9
+)
+
+// Error codes of the faults, HRESULT values as signed integers.
+const (
+	ErrorInvalidArgument = -2147024809 // E_INVALIDARG
+	ErrorAccessDenied    = -2147024891 // E_ACCESSDENIED
+	ErrorFail            = -2147467259 // E_FAIL
+)
+
+// Policy is a certificate enrollment policy with only one certificate
+// template, sent in a MS-XCEP response.
+type Policy struct {
+	// ID is the identifier of the policy, a GUID.
+	ID string
+	// FriendlyName is the name of the policy displayed to the users.
+	FriendlyName string
+	// NextUpdateHours is the number of hours a client should wait before
+	// updating the policy.
+	NextUpdateHours int
+	// TemplateName is the common name of the certificate template.
+	TemplateName string
+	// TemplateOID is the OID of the certificate template in dot notation.
+	TemplateOID string
+	// MajorRevision and MinorRevision are the version of the template.
+	MajorRevision int
+	MinorRevision int
+	// ValiditySeconds is the validity of the certificates.
+	ValiditySeconds int64
+	// RenewalSeconds is the time before the expiration of a certificate when
+	// the clients should renew it.
+	RenewalSeconds int64
+	// MinimalKeyLength is the minimum length of the keys.
+	MinimalKeyLength int
+	// EnrollmentURL is the URL of the MS-WSTEP endpoint.
+	EnrollmentURL string
+	// Certificate is the certificate of the CA issuing the certificates.
+	Certificate *x509.Certificate
+}
+
+type nilElement struct {
+	Nil string `xml:"xsi:nil,attr"`
+}
+
+var xsiNil = &nilElement{Nil: "true"}
+
+type envelope struct {
+	XMLName xml.Name `xml:"s:Envelope"`
+	S       string   `xml:"xmlns:s,attr"`
+	A       string   `xml:"xmlns:a,attr"`
+	XSI     string   `xml:"xmlns:xsi,attr"`
+	Header  struct {
+		Action struct {
+			MustUnderstand string `xml:"s:mustUnderstand,attr"`
+			Value          string `xml:",chardata"`
+		} `xml:"a:Action"`
+		RelatesTo string `xml:"a:RelatesTo,omitempty"`
+	} `xml:"s:Header"`
+	Body struct {
+		Content any `xml:",any"`
+	} `xml:"s:Body"`
+}
+
+func marshalEnvelope(req *Request, action string, content any) ([]byte, error) {
+	env := envelope{
+		S:   NamespaceSOAP,
+		A:   NamespaceAddressing,
+		XSI: NamespaceXSI,
+	}
+	env.Header.Action.MustUnderstand = "1"
+	env.Header.Action.Value = action
+	if req != nil {
+		env.Header.RelatesTo = req.Header.MessageID
+	}
+	env.Body.Content = content
+	b, err := xml.Marshal(env)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), b...), nil
+}
+
+type getPoliciesResponse struct {
+	XMLName  xml.Name `xml:"GetPoliciesResponse"`
+	Xmlns    string   `xml:"xmlns,attr"`
+	Response struct {
+		PolicyID           string      `xml:"policyID"`
+		PolicyFriendlyName string      `xml:"policyFriendlyName"`
+		NextUpdateHours    int         `xml:"nextUpdateHours"`
+		PoliciesNotChanged *nilElement `xml:"policiesNotChanged"`
+		Policies           struct {
+			Policy []policy `xml:"policy"`
+		} `xml:"policies"`
+	} `xml:"response"`
+	CAs struct {
+		CA []ca `xml:"cA"`
+	} `xml:"cAs"`
+	OIDs struct {
+		OID []oid `xml:"oID"`
+	} `xml:"oIDs"`
+}
+
+type policy struct {
+	PolicyOIDReference int `xml:"policyOIDReference"`
+	CAs                struct {
+		CAReference []int `xml:"cAReference"`
+	} `xml:"cAs"`
+	Attributes struct {
+		CommonName          string `xml:"commonName"`
+		PolicySchema        int    `xml:"policySchema"`
+		CertificateValidity struct {
+			ValidityPeriodSeconds int64 `xml:"validityPeriodSeconds"`
+			RenewalPeriodSeconds  int64 `xml:"renewalPeriodSeconds"`
+		} `xml:"certificateValidity"`
+		Permission struct {
+			Enroll     bool `xml:"enroll"`
+			AutoEnroll bool `xml:"autoEnroll"`
+		} `xml:"permission"`
+		PrivateKeyAttributes struct {
+			MinimalKeyLength      int         `xml:"minimalKeyLength"`
+			KeySpec               int         `xml:"keySpec"`
+			KeyUsageProperty      *nilElement `xml:"keyUsageProperty"`
+			Permissions           *nilElement `xml:"permissions"`
+			AlgorithmOIDReference *nilElement `xml:"algorithmOIDReference"`
+			CryptoProviders       *nilElement `xml:"cryptoProviders"`
+		} `xml:"privateKeyAttributes"`
+		Revision struct {
+			MajorRevision int `xml:"majorRevision"`
+			MinorRevision int `xml:"minorRevision"`
+		} `xml:"revision"`
+		SupersededPolicies        *nilElement `xml:"supersededPolicies"`
+		PrivateKeyFlags           int         `xml:"privateKeyFlags"`
+		SubjectNameFlags          int         `xml:"subjectNameFlags"`
+		EnrollmentFlags           int         `xml:"enrollmentFlags"`
+		GeneralFlags              int         `xml:"generalFlags"`
+		HashAlgorithmOIDReference *nilElement `xml:"hashAlgorithmOIDReference"`
+		RARequirements            *nilElement `xml:"rARequirements"`
+		KeyArchivalAttributes     *nilElement `xml:"keyArchivalAttributes"`
+		Extensions                *nilElement `xml:"extensions"`
+	} `xml:"attributes"`
+}
+
+type ca struct {
+	URIs struct {
+		CAURI []caURI `xml:"cAURI"`
+	} `xml:"uris"`
+	Certificate      string `xml:"certificate"`
+	EnrollPermission bool   `xml:"enrollPermission"`
+	CAReferenceID    int    `xml:"cAReferenceID"`
+}
+
+type caURI struct {
+	ClientAuthentication int    `xml:"clientAuthentication"`
+	URI                  string `xml:"uri"`
+	Priority             int    `xml:"priority"`
+	RenewalOnly          bool   `xml:"renewalOnly"`
+}
+
+type oid struct {
+	Value          string `xml:"value"`
+	Group          int    `xml:"group"`
+	OIDReferenceID int    `xml:"oIDReferenceID"`
+	DefaultName    string `xml:"defaultName"`
+}
+
+// NewPoliciesResponse returns the MS-XCEP response with the given policy.
+func NewPoliciesResponse(req *Request, p *Policy) ([]byte, error) {
+	resp := getPoliciesResponse{Xmlns: NamespacePolicy}
+	resp.Response.PolicyID = p.ID
+	resp.Response.PolicyFriendlyName = p.FriendlyName
+	resp.Response.NextUpdateHours = p.NextUpdateHours
+	resp.Response.PoliciesNotChanged = xsiNil
+
+	var pol policy
+	pol.PolicyOIDReference = 0
+	pol.CAs.CAReference = []int{0}
+	attrs := &pol.Attributes
+	attrs.CommonName = p.TemplateName
+	attrs.PolicySchema = 2
+	attrs.CertificateValidity.ValidityPeriodSeconds = p.ValiditySeconds
+	attrs.CertificateValidity.RenewalPeriodSeconds = p.RenewalSeconds
+	attrs.Permission.Enroll = true
+	attrs.Permission.AutoEnroll = true
+	attrs.PrivateKeyAttributes.MinimalKeyLength = p.MinimalKeyLength
+	attrs.PrivateKeyAttributes.KeySpec = keySpecKeyExchange
+	attrs.PrivateKeyAttributes.KeyUsageProperty = xsiNil
+	attrs.PrivateKeyAttributes.Permissions = xsiNil
+	attrs.PrivateKeyAttributes.AlgorithmOIDReference = xsiNil
+	attrs.PrivateKeyAttributes.CryptoProviders = xsiNil
+	attrs.Revision.MajorRevision = p.MajorRevision
+	attrs.Revision.MinorRevision = p.MinorRevision
+	attrs.SupersededPolicies = xsiNil
+	attrs.SubjectNameFlags = subjectNameFlags
+	attrs.EnrollmentFlags = enrollmentFlags
+	attrs.GeneralFlags = generalFlags
+	attrs.HashAlgorithmOIDReference = xsiNil
+	attrs.RARequirements = xsiNil
+	attrs.KeyArchivalAttributes = xsiNil
+	attrs.Extensions = xsiNil
+	resp.Response.Policies.Policy = []policy{pol}
+
+	var c ca
+	c.URIs.CAURI = []caURI{{
+		ClientAuthentication: clientAuthenticationKerberos,
+		URI:                  p.EnrollmentURL,
+		Priority:             1,
+	}}
+	if p.Certificate != nil {
+		c.Certificate = base64.StdEncoding.EncodeToString(p.Certificate.Raw)
+	}
+	c.EnrollPermission = true
+	c.CAReferenceID = 0
+	resp.CAs.CA = []ca{c}
+
+	resp.OIDs.OID = []oid{{
+		Value:          p.TemplateOID,
+		Group:          oidGroupTemplate,
+		OIDReferenceID: 0,
+		DefaultName:    p.TemplateName,
+	}}
+
+	return marshalEnvelope(req, ActionGetPoliciesResponse, resp)
+}
+
+type binarySecurityToken struct {
+	XMLName      xml.Name `xml:"BinarySecurityToken"`
+	Xmlns        string   `xml:"xmlns,attr"`
+	ValueType    string   `xml:"ValueType,attr"`
+	EncodingType string   `xml:"EncodingType,attr"`
+	Value        string   `xml:",chardata"`
+}
+
+func newBinarySecurityToken(valueType string, b []byte) binarySecurityToken {
+	return binarySecurityToken{
+		Xmlns:        NamespaceSecurityExt,
+		ValueType:    valueType,
+		EncodingType: EncodingTypeBase64,
+		Value:        base64.StdEncoding.EncodeToString(b),
+	}
+}
+
+type enrollmentElement struct {
+	Xmlns string `xml:"xmlns,attr"`
+	Nil   string `xml:"xsi:nil,attr,omitempty"`
+	Value string `xml:",chardata"`
+}
+
+type requestSecurityTokenResponseCollection struct {
+	XMLName  xml.Name `xml:"RequestSecurityTokenResponseCollection"`
+	Xmlns    string   `xml:"xmlns,attr"`
+	Response struct {
+		TokenType              string              `xml:"TokenType"`
+		DispositionMessage     enrollmentElement   `xml:"DispositionMessage"`
+		BinarySecurityToken    binarySecurityToken `xml:"BinarySecurityToken"`
+		RequestedSecurityToken struct {
+			BinarySecurityToken binarySecurityToken `xml:"BinarySecurityToken"`
+		} `xml:"RequestedSecurityToken"`
+		RequestID enrollmentElement `xml:"RequestID"`
+	} `xml:"RequestSecurityTokenResponse"`
+}
+
+// NewTokenResponse returns the MS-WSTEP response with the issued certificate.
+// The certs-only PKCS #7 is the certificate chain.
+func NewTokenResponse(req *Request, cert *x509.Certificate, certsOnly []byte) ([]byte, error) {
+	resp := requestSecurityTokenResponseCollection{Xmlns: NamespaceTrust}
+	resp.Response.TokenType = ValueTypeX509v3
+	resp.Response.DispositionMessage = enrollmentElement{Xmlns: NamespaceEnrollment, Value: "Issued"}
+	resp.Response.BinarySecurityToken = newBinarySecurityToken(ValueTypePKCS7, certsOnly)
+	resp.Response.RequestedSecurityToken.BinarySecurityToken = newBinarySecurityToken(ValueTypeX509v3, cert.Raw)
+	resp.Response.RequestID = enrollmentElement{Xmlns: NamespaceEnrollment, Nil: "true"}
+	return marshalEnvelope(req, ActionRequestTokenResponse, resp)
+}
+
+type fault struct {
+	XMLName xml.Name `xml:"s:Fault"`
+	Code    struct {
+		Value string `xml:"s:Value"`
+	} `xml:"s:Code"`
+	Reason struct {
+		Text struct {
+			Lang  string `xml:"xml:lang,attr"`
+			Value string `xml:",chardata"`
+		} `xml:"s:Text"`
+	} `xml:"s:Reason"`
+	Detail struct {
+		CertificateEnrollmentWSDetail struct {
+			Xmlns          string      `xml:"xmlns,attr"`
+			BinaryResponse *nilElement `xml:"BinaryResponse"`
+			ErrorCode      int         `xml:"ErrorCode"`
+			InvalidRequest bool        `xml:"InvalidRequest"`
+			RequestID      *nilElement `xml:"RequestID"`
+		} `xml:"CertificateEnrollmentWSDetail"`
+	} `xml:"s:Detail"`
+}
+
+// NewFault returns a SOAP fault with the given reason and error code. Sender
+// faults are caused by an invalid request, and receiver faults by an error in
+// the server.
+func NewFault(req *Request, sender bool, errorCode int, reason string) ([]byte, error) {
+	var f fault
+	if sender {
+		f.Code.Value = "s:Sender"
+	} else {
+		f.Code.Value = "s:Receiver"
+	}
+	f.Reason.Text.Lang = "en-US"
+	f.Reason.Text.Value = reason
+	detail := &f.Detail.CertificateEnrollmentWSDetail
+	detail.Xmlns = NamespaceEnrollment
+	detail.BinaryResponse = xsiNil
+	detail.ErrorCode = errorCode
+	detail.InvalidRequest = sender
+	detail.RequestID = xsiNil
+	return marshalEnvelope(req, ActionFault, f)
+}
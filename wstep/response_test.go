@@ -0,0 +1,221 @@
+package wstep
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/xml"
+	"testing"
+
+	"github.com/smallstep/pkcs7"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.step.sm/crypto/minica"
+)
+
+// testEnvelope is used to parse the responses.
+type testEnvelope struct {
+	XMLName xml.Name `xml:"http://www.w3.org/2003/05/soap-envelope Envelope"`
+	Header  struct {
+		Action    string `xml:"http://www.w3.org/2005/08/addressing Action"`
+		RelatesTo string `xml:"http://www.w3.org/2005/08/addressing RelatesTo"`
+	} `xml:"http://www.w3.org/2003/05/soap-envelope Header"`
+}
+
+// parseTestEnvelope parses the envelope and decodes the content of the body
+// in v. The content is decoded with the namespaces declared in the envelope.
+func parseTestEnvelope(t *testing.T, b []byte, v any) *testEnvelope {
+	t.Helper()
+	var env testEnvelope
+	require.NoError(t, xml.Unmarshal(b, &env))
+
+	d := xml.NewDecoder(bytes.NewReader(b))
+	var inBody bool
+	for {
+		tok, err := d.Token()
+		require.NoError(t, err)
+		if se, ok := tok.(xml.StartElement); ok {
+			if inBody {
+				require.NoError(t, d.DecodeElement(v, &se))
+				return &env
+			}
+			inBody = se.Name.Space == NamespaceSOAP && se.Name.Local == "Body"
+		}
+	}
+}
+
+func TestNewPoliciesResponse(t *testing.T) {
+	ca, err := minica.New()
+	require.NoError(t, err)
+	req, err := ParseRequest([]byte(testGetPolicies))
+	require.NoError(t, err)
+
+	b, err := NewPoliciesResponse(req, &Policy{
+		ID:               "{B0F5A6C4-0E4B-4D3A-8C1F-3C5B5E9B7A21}",
+		FriendlyName:     "wstep",
+		NextUpdateHours:  8,
+		TemplateName:     "Machine",
+		TemplateOID:      "1.3.6.1.4.1.311.21.8.1.2",
+		MajorRevision:    100,
+		ValiditySeconds:  86400,
+		RenewalSeconds:   28800,
+		MinimalKeyLength: 2048,
+		EnrollmentURL:    "https://ca.example.com/wstep/wstep/ces",
+		Certificate:      ca.Intermediate,
+	})
+	require.NoError(t, err)
+
+	var resp struct {
+		XMLName  xml.Name `xml:"http://schemas.microsoft.com/windows/pki/2009/01/enrollmentpolicy GetPoliciesResponse"`
+		Response struct {
+			PolicyID           string `xml:"policyID"`
+			PolicyFriendlyName string `xml:"policyFriendlyName"`
+			NextUpdateHours    int    `xml:"nextUpdateHours"`
+			PoliciesNotChanged struct {
+				Nil string `xml:"http://www.w3.org/2001/XMLSchema-instance nil,attr"`
+			} `xml:"policiesNotChanged"`
+			Policies struct {
+				Policy []struct {
+					PolicyOIDReference int   `xml:"policyOIDReference"`
+					CAReference        []int `xml:"cAs>cAReference"`
+					Attributes         struct {
+						CommonName            string `xml:"commonName"`
+						PolicySchema          int    `xml:"policySchema"`
+						ValidityPeriodSeconds int64  `xml:"certificateValidity>validityPeriodSeconds"`
+						RenewalPeriodSeconds  int64  `xml:"certificateValidity>renewalPeriodSeconds"`
+						AutoEnroll            bool   `xml:"permission>autoEnroll"`
+						MinimalKeyLength      int    `xml:"privateKeyAttributes>minimalKeyLength"`
+						MajorRevision         int    `xml:"revision>majorRevision"`
+						SubjectNameFlags      int    `xml:"subjectNameFlags"`
+						EnrollmentFlags       int    `xml:"enrollmentFlags"`
+						GeneralFlags          int    `xml:"generalFlags"`
+					} `xml:"attributes"`
+				} `xml:"policy"`
+			} `xml:"policies"`
+		} `xml:"response"`
+		CAs []struct {
+			URI                  string `xml:"uris>cAURI>uri"`
+			ClientAuthentication int    `xml:"uris>cAURI>clientAuthentication"`
+			Certificate          string `xml:"certificate"`
+			CAReferenceID        int    `xml:"cAReferenceID"`
+		} `xml:"cAs>cA"`
+		OIDs []struct {
+			Value          string `xml:"value"`
+			Group          int    `xml:"group"`
+			OIDReferenceID int    `xml:"oIDReferenceID"`
+			DefaultName    string `xml:"defaultName"`
+		} `xml:"oIDs>oID"`
+	}
+	env := parseTestEnvelope(t, b, &resp)
+	assert.Equal(t, ActionGetPoliciesResponse, env.Header.Action)
+	assert.Equal(t, req.Header.MessageID, env.Header.RelatesTo)
+
+	assert.Equal(t, "{B0F5A6C4-0E4B-4D3A-8C1F-3C5B5E9B7A21}", resp.Response.PolicyID)
+	assert.Equal(t, "wstep", resp.Response.PolicyFriendlyName)
+	assert.Equal(t, 8, resp.Response.NextUpdateHours)
+	assert.Equal(t, "true", resp.Response.PoliciesNotChanged.Nil)
+	require.Len(t, resp.Response.Policies.Policy, 1)
+	pol := resp.Response.Policies.Policy[0]
+	assert.Equal(t, 0, pol.PolicyOIDReference)
+	assert.Equal(t, []int{0}, pol.CAReference)
+	assert.Equal(t, "Machine", pol.Attributes.CommonName)
+	assert.Equal(t, 2, pol.Attributes.PolicySchema)
+	assert.Equal(t, int64(86400), pol.Attributes.ValidityPeriodSeconds)
+	assert.Equal(t, int64(28800), pol.Attributes.RenewalPeriodSeconds)
+	assert.True(t, pol.Attributes.AutoEnroll)
+	assert.Equal(t, 2048, pol.Attributes.MinimalKeyLength)
+	assert.Equal(t, 100, pol.Attributes.MajorRevision)
+	assert.Equal(t, subjectNameFlags, pol.Attributes.SubjectNameFlags)
+	assert.Equal(t, enrollmentFlags, pol.Attributes.EnrollmentFlags)
+	assert.Equal(t, generalFlags, pol.Attributes.GeneralFlags)
+
+	require.Len(t, resp.CAs, 1)
+	assert.Equal(t, "https://ca.example.com/wstep/wstep/ces", resp.CAs[0].URI)
+	assert.Equal(t, clientAuthenticationKerberos, resp.CAs[0].ClientAuthentication)
+	assert.Equal(t, base64.StdEncoding.EncodeToString(ca.Intermediate.Raw), resp.CAs[0].Certificate)
+	assert.Equal(t, 0, resp.CAs[0].CAReferenceID)
+
+	require.Len(t, resp.OIDs, 1)
+	assert.Equal(t, "1.3.6.1.4.1.311.21.8.1.2", resp.OIDs[0].Value)
+	assert.Equal(t, oidGroupTemplate, resp.OIDs[0].Group)
+	assert.Equal(t, 0, resp.OIDs[0].OIDReferenceID)
+	assert.Equal(t, "Machine", resp.OIDs[0].DefaultName)
+}
+
+func TestNewTokenResponse(t *testing.T) {
+	ca, err := minica.New()
+	require.NoError(t, err)
+	cert := ca.Intermediate
+	certsOnly, err := pkcs7.DegenerateCertificate(append(cert.Raw, ca.Root.Raw...))
+	require.NoError(t, err)
+
+	req, err := ParseRequest([]byte(testGetPolicies))
+	require.NoError(t, err)
+	b, err := NewTokenResponse(req, cert, certsOnly)
+	require.NoError(t, err)
+
+	type token struct {
+		ValueType    string `xml:"ValueType,attr"`
+		EncodingType string `xml:"EncodingType,attr"`
+		Value        string `xml:",chardata"`
+	}
+	var resp struct {
+		XMLName  xml.Name `xml:"http://docs.oasis-open.org/ws-sx/ws-trust/200512 RequestSecurityTokenResponseCollection"`
+		Response struct {
+			TokenType              string `xml:"TokenType"`
+			DispositionMessage     string `xml:"http://schemas.microsoft.com/windows/pki/2009/01/enrollment DispositionMessage"`
+			BinarySecurityToken    token  `xml:"http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-secext-1.0.xsd BinarySecurityToken"`
+			RequestedSecurityToken struct {
+				BinarySecurityToken token `xml:"http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-secext-1.0.xsd BinarySecurityToken"`
+			} `xml:"RequestedSecurityToken"`
+			RequestID struct {
+				Nil string `xml:"http://www.w3.org/2001/XMLSchema-instance nil,attr"`
+			} `xml:"http://schemas.microsoft.com/windows/pki/2009/01/enrollment RequestID"`
+		} `xml:"RequestSecurityTokenResponse"`
+	}
+	env := parseTestEnvelope(t, b, &resp)
+	assert.Equal(t, ActionRequestTokenResponse, env.Header.Action)
+	assert.Equal(t, req.Header.MessageID, env.Header.RelatesTo)
+
+	assert.Equal(t, ValueTypeX509v3, resp.Response.TokenType)
+	assert.Equal(t, "Issued", resp.Response.DispositionMessage)
+	assert.Equal(t, ValueTypePKCS7, resp.Response.BinarySecurityToken.ValueType)
+	assert.Equal(t, EncodingTypeBase64, resp.Response.BinarySecurityToken.EncodingType)
+	assert.Equal(t, base64.StdEncoding.EncodeToString(certsOnly), resp.Response.BinarySecurityToken.Value)
+	assert.Equal(t, ValueTypeX509v3, resp.Response.RequestedSecurityToken.BinarySecurityToken.ValueType)
+	assert.Equal(t, base64.StdEncoding.EncodeToString(cert.Raw), resp.Response.RequestedSecurityToken.BinarySecurityToken.Value)
+	assert.Equal(t, "true", resp.Response.RequestID.Nil)
+}
+
+func TestNewFault(t *testing.T) {
+	type fault struct {
+		XMLName   xml.Name `xml:"http://www.w3.org/2003/05/soap-envelope Fault"`
+		Code      string   `xml:"http://www.w3.org/2003/05/soap-envelope Code>Value"`
+		Reason    string   `xml:"http://www.w3.org/2003/05/soap-envelope Reason>Text"`
+		ErrorCode int      `xml:"Detail>CertificateEnrollmentWSDetail>ErrorCode"`
+		Invalid   bool     `xml:"Detail>CertificateEnrollmentWSDetail>InvalidRequest"`
+	}
+
+	req, err := ParseRequest([]byte(testGetPolicies))
+	require.NoError(t, err)
+	b, err := NewFault(req, true, ErrorInvalidArgument, "bad request")
+	require.NoError(t, err)
+	var f fault
+	env := parseTestEnvelope(t, b, &f)
+	assert.Equal(t, ActionFault, env.Header.Action)
+	assert.Equal(t, req.Header.MessageID, env.Header.RelatesTo)
+	assert.Equal(t, "s:Sender", f.Code)
+	assert.Equal(t, "bad request", f.Reason)
+	assert.Equal(t, ErrorInvalidArgument, f.ErrorCode)
+	assert.True(t, f.Invalid)
+
+	// Faults can be sent before parsing the request.
+	b, err = NewFault(nil, false, ErrorFail, "internal error")
+	require.NoError(t, err)
+	f = fault{}
+	env = parseTestEnvelope(t, b, &f)
+	assert.Empty(t, env.Header.RelatesTo)
+	assert.Equal(t, "s:Receiver", f.Code)
+	assert.Equal(t, ErrorFail, f.ErrorCode)
+	assert.False(t, f.Invalid)
+}